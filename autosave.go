@@ -0,0 +1,63 @@
+package viamcartographer
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/viam-modules/viam-cartographer/cartofacade"
+)
+
+const (
+	// autosaveMapPrefix is the prefix of the internal states saved to internal_state_save_dir, which is followed by
+	// the time they were saved at in warmStartMapTimeFormat.
+	autosaveMapPrefix = "autosave_"
+	// defaultInternalStateSaveRetention is the number of internal states kept in internal_state_save_dir.
+	defaultInternalStateSaveRetention = 10
+)
+
+// createInternalStateSaveDir creates internal_state_save_dir if it does not exist yet, so that a directory that
+// cannot be written to fails the construction of the service rather than every save.
+func createInternalStateSaveDir(dir string) error {
+	return errors.Wrap(os.MkdirAll(dir, 0o750), "failed to create internal_state_save_dir")
+}
+
+// startAutosave saves the internal state to internal_state_save_dir every internal_state_save_interval_sec until
+// ctx is done. It is one of the sensor process workers, so that Close waits for a save in progress before it stops
+// the cartofacade.
+func startAutosave(ctx context.Context, cartoSvc *CartographerService) {
+	cartoSvc.goWorker("autosave", func(w *worker) {
+		ticker := time.NewTicker(cartoSvc.internalStateSaveInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				w.heartbeat()
+				cartoSvc.autosave(ctx, now)
+			}
+		}
+	})
+}
+
+// autosave saves the internal state to internal_state_save_dir, unless the map does not change because the service
+// is localizing, which set_mode may switch in and out of.
+func (cartoSvc *CartographerService) autosave(ctx context.Context, now time.Time) {
+	if _, slamMode := cartoSvc.mode(); slamMode == cartofacade.LocalizingMode {
+		return
+	}
+	if cartoSvc.cartofacade.Unresponsive() {
+		// the request would wait on the hung call
+		return
+	}
+	path, err := cartoSvc.saveInternalStateToDir(ctx, cartoSvc.internalStateSaveDir, autosaveMapPrefix,
+		cartoSvc.internalStateSaveRetention, now)
+	if err != nil {
+		cartoSvc.logger.Errorw("failed to save the internal state to internal_state_save_dir", "path", path, "error", err)
+		return
+	}
+	cartoSvc.logger.Debugw("saved the internal state to internal_state_save_dir", "path", path)
+}
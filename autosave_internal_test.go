@@ -0,0 +1,82 @@
+package viamcartographer
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.viam.com/rdk/logging"
+	"go.viam.com/test"
+	"go.viam.com/utils/testutils"
+
+	"github.com/viam-modules/viam-cartographer/cartofacade"
+)
+
+func TestAutosave(t *testing.T) {
+	logger := logging.NewTestLogger(t)
+
+	t.Run("the internal state is saved on every interval and the oldest ones are removed", func(t *testing.T) {
+		dir := t.TempDir()
+		var numSaves atomic.Int64
+		var stopped, savedAfterStop atomic.Bool
+		mockCartoFacade := &cartofacade.Mock{}
+		mockCartoFacade.InternalStateFunc = func(ctx context.Context, timeout time.Duration) ([]byte, error) {
+			if stopped.Load() {
+				savedAfterStop.Store(true)
+			}
+			return []byte(strconv.FormatInt(numSaves.Add(1), 10)), nil
+		}
+		mockCartoFacade.DrainFunc = func(ctx context.Context, timeout time.Duration) error { return nil }
+		mockCartoFacade.StopFunc = func(ctx context.Context, timeout time.Duration) error {
+			stopped.Store(true)
+			return nil
+		}
+		mockCartoFacade.TerminateFunc = func(ctx context.Context, timeout time.Duration) error { return nil }
+		cancelCtx, cancelFunc := context.WithCancel(context.Background())
+		svc := newTestService(mockCartoFacade, logger)
+		svc.SlamMode = cartofacade.MappingMode
+		svc.cancelSensorProcessFunc = cancelFunc
+		svc.cancelCartoFacadeFunc = func() {}
+		svc.internalStateSaveDir = dir
+		svc.internalStateSaveInterval = 10 * time.Millisecond
+		svc.internalStateSaveRetention = 2
+		startAutosave(cancelCtx, svc)
+		testutils.WaitForAssertion(t, func(tb testing.TB) {
+			tb.Helper()
+			test.That(tb, numSaves.Load(), test.ShouldBeGreaterThanOrEqualTo, 4)
+		})
+		_, err := svc.closeInPhases(context.Background())
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, savedAfterStop.Load(), test.ShouldBeFalse)
+
+		paths, err := listSavedInternalStates(dir, autosaveMapPrefix)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, paths, test.ShouldHaveLength, 2)
+		lastSave := numSaves.Load()
+		for i, path := range paths {
+			data, err := os.ReadFile(path)
+			test.That(t, err, test.ShouldBeNil)
+			test.That(t, string(data), test.ShouldEqual, strconv.FormatInt(lastSave-int64(i), 10))
+		}
+	})
+
+	t.Run("the internal state is not saved while localizing", func(t *testing.T) {
+		dir := t.TempDir()
+		mockCartoFacade := &cartofacade.Mock{}
+		mockCartoFacade.InternalStateFunc = func(ctx context.Context, timeout time.Duration) ([]byte, error) {
+			t.Fatal("the internal state must not be saved while localizing")
+			return nil, nil
+		}
+		svc := newTestService(mockCartoFacade, logger)
+		svc.SlamMode = cartofacade.LocalizingMode
+		svc.internalStateSaveDir = dir
+		svc.internalStateSaveRetention = 2
+		svc.autosave(context.Background(), time.Now())
+		paths, err := listSavedInternalStates(dir, autosaveMapPrefix)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, paths, test.ShouldBeEmpty)
+	})
+}
@@ -0,0 +1,114 @@
+// Package cartofacade contains the api to call into CGO
+package cartofacade
+
+import "sort"
+
+// AlgoConfigDifference describes a single algo config value that cartographer is operating with
+// which differs from the value that was requested.
+type AlgoConfigDifference struct {
+	Name      string
+	Requested interface{}
+	Applied   interface{}
+}
+
+// ToMap returns the algo config keyed by the config_params names used to set each value.
+func (acfg CartoAlgoConfig) ToMap() map[string]interface{} {
+	m := map[string]interface{}{
+		"optimize_on_start":       acfg.OptimizeOnStart,
+		"optimize_every_n_nodes":  acfg.OptimizeEveryNNodes,
+		"num_range_data":          acfg.NumRangeData,
+		"missing_data_ray_length": float64(acfg.MissingDataRayLength),
+		"max_range":               float64(acfg.MaxRange),
+		"min_range":               float64(acfg.MinRange),
+		"use_imu_data":            acfg.UseIMUData,
+		"max_submaps_to_keep":     acfg.MaxSubmapsToKeep,
+		"fresh_submaps_count":     acfg.FreshSubmapsCount,
+		"min_covered_area":        acfg.MinCoveredArea,
+		"min_added_submaps_count": acfg.MinAddedSubmapsCount,
+		"occupied_space_weight":   acfg.OccupiedSpaceWeight,
+		"translation_weight":      acfg.TranslationWeight,
+		"rotation_weight":         acfg.RotationWeight,
+	}
+	if acfg.HasInitialTrajectoryPose {
+		m["initial_starting_pose"] = map[string]interface{}{
+			"x":     acfg.InitialTrajectoryPoseX,
+			"y":     acfg.InitialTrajectoryPoseY,
+			"theta": acfg.InitialTrajectoryPoseTheta,
+		}
+	}
+	if acfg.FinalOptimizationIterations > 0 {
+		m["final_optimization_iterations"] = acfg.FinalOptimizationIterations
+	}
+	if acfg.HasInitialTrajectoryPoseSigma {
+		m["initial_starting_pose_sigma"] = map[string]interface{}{
+			"x":     acfg.InitialTrajectoryPoseSigmaX,
+			"y":     acfg.InitialTrajectoryPoseSigmaY,
+			"theta": acfg.InitialTrajectoryPoseSigmaTheta,
+		}
+	}
+	return m
+}
+
+// algoConfigParamApplies returns whether cartographer is expected to honor the named
+// algo config value in the given slam mode. Values which only take effect in a
+// specific slam mode are left at their lua defaults otherwise.
+func algoConfigParamApplies(name string, slamMode SlamMode) bool {
+	switch name {
+	case "max_submaps_to_keep":
+		return slamMode == LocalizingMode
+	case "fresh_submaps_count", "min_covered_area", "min_added_submaps_count":
+		return slamMode == UpdatingMode
+	default:
+		return true
+	}
+}
+
+// DiffAlgoConfig returns the algo config values that differ between what was requested and
+// what cartographer is operating with, sorted by name. Values which do not apply to the
+// given slam mode are not compared.
+func DiffAlgoConfig(requested, applied CartoAlgoConfig, slamMode SlamMode) []AlgoConfigDifference {
+	requestedMap := requested.ToMap()
+	appliedMap := applied.ToMap()
+
+	names := make([]string, 0, len(requestedMap))
+	for name := range requestedMap {
+		names = append(names, name)
+	}
+	for name := range appliedMap {
+		if _, ok := requestedMap[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var diffs []AlgoConfigDifference
+	for _, name := range names {
+		if !algoConfigParamApplies(name, slamMode) {
+			continue
+		}
+		requestedVal := requestedMap[name]
+		appliedVal := appliedMap[name]
+		if algoConfigValuesEqual(requestedVal, appliedVal) {
+			continue
+		}
+		diffs = append(diffs, AlgoConfigDifference{Name: name, Requested: requestedVal, Applied: appliedVal})
+	}
+	return diffs
+}
+
+func algoConfigValuesEqual(a, b interface{}) bool {
+	aPose, aIsPose := a.(map[string]interface{})
+	bPose, bIsPose := b.(map[string]interface{})
+	if aIsPose || bIsPose {
+		if !aIsPose || !bIsPose {
+			return false
+		}
+		for k, v := range aPose {
+			if bPose[k] != v {
+				return false
+			}
+		}
+		return len(aPose) == len(bPose)
+	}
+	return a == b
+}
@@ -0,0 +1,77 @@
+package cartofacade
+
+import (
+	"testing"
+
+	"go.viam.com/test"
+)
+
+func TestDiffAlgoConfig(t *testing.T) {
+	t.Run("identical configs have no differences", func(t *testing.T) {
+		requested := GetTestAlgoConfig(false)
+		applied := GetTestAlgoConfig(false)
+		for _, slamMode := range []SlamMode{MappingMode, LocalizingMode, UpdatingMode} {
+			test.That(t, DiffAlgoConfig(requested, applied, slamMode), test.ShouldBeEmpty)
+		}
+	})
+
+	t.Run("differences are reported sorted by name", func(t *testing.T) {
+		requested := GetTestAlgoConfig(false)
+		applied := GetTestAlgoConfig(true)
+		applied.MaxRange = 10
+		applied.NumRangeData = 50
+
+		diffs := DiffAlgoConfig(requested, applied, MappingMode)
+		test.That(t, diffs, test.ShouldResemble, []AlgoConfigDifference{
+			{Name: "max_range", Requested: float64(25), Applied: float64(10)},
+			{Name: "num_range_data", Requested: 100, Applied: 50},
+			{Name: "use_imu_data", Requested: false, Applied: true},
+		})
+	})
+
+	t.Run("values which do not apply to the slam mode are ignored", func(t *testing.T) {
+		requested := GetTestAlgoConfig(false)
+		applied := GetTestAlgoConfig(false)
+		applied.MaxSubmapsToKeep = 0
+		applied.FreshSubmapsCount = 0
+
+		test.That(t, DiffAlgoConfig(requested, applied, MappingMode), test.ShouldBeEmpty)
+
+		diffs := DiffAlgoConfig(requested, applied, LocalizingMode)
+		test.That(t, diffs, test.ShouldResemble, []AlgoConfigDifference{
+			{Name: "max_submaps_to_keep", Requested: 3, Applied: 0},
+		})
+
+		diffs = DiffAlgoConfig(requested, applied, UpdatingMode)
+		test.That(t, diffs, test.ShouldResemble, []AlgoConfigDifference{
+			{Name: "fresh_submaps_count", Requested: 3, Applied: 0},
+		})
+	})
+
+	t.Run("initial starting pose differences are reported", func(t *testing.T) {
+		requested := GetTestAlgoConfig(false)
+		requested.HasInitialTrajectoryPose = true
+		requested.InitialTrajectoryPoseX = 1
+		applied := GetTestAlgoConfig(false)
+
+		diffs := DiffAlgoConfig(requested, applied, UpdatingMode)
+		test.That(t, len(diffs), test.ShouldEqual, 1)
+		test.That(t, diffs[0].Name, test.ShouldEqual, "initial_starting_pose")
+		test.That(t, diffs[0].Applied, test.ShouldBeNil)
+
+		applied.HasInitialTrajectoryPose = true
+		applied.InitialTrajectoryPoseX = 1
+		test.That(t, DiffAlgoConfig(requested, applied, UpdatingMode), test.ShouldBeEmpty)
+	})
+}
+
+func TestAlgoConfigToMap(t *testing.T) {
+	acfg := GetTestAlgoConfig(true)
+	m := acfg.ToMap()
+	test.That(t, m["optimize_every_n_nodes"], test.ShouldEqual, 3)
+	test.That(t, m["num_range_data"], test.ShouldEqual, 100)
+	test.That(t, m["min_range"], test.ShouldEqual, float64(float32(0.2)))
+	test.That(t, m["use_imu_data"], test.ShouldBeTrue)
+	_, ok := m["initial_starting_pose"]
+	test.That(t, ok, test.ShouldBeFalse)
+}
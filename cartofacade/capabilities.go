@@ -0,0 +1,149 @@
+package cartofacade
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Feature is an optional feature of the cartographer library. Robots may run a library that predates the C
+// functions of a feature, in which case it is unavailable.
+type Feature string
+
+const (
+	// FeatureMemoryUsage is viam_carto_lib_get_memory_usage.
+	FeatureMemoryUsage Feature = "memory_usage"
+	// FeatureInternalStateVersion is viam_carto_lib_get_internal_state_version.
+	FeatureInternalStateVersion Feature = "internal_state_version"
+	// FeatureInternalStateMigration is viam_carto_lib_migrate_internal_state.
+	FeatureInternalStateMigration Feature = "internal_state_migration"
+	// FeatureInternalStateStream is viam_carto_get_internal_state_stream and the functions to read and close it.
+	FeatureInternalStateStream Feature = "internal_state_stream"
+	// FeatureSlamStats is viam_carto_get_slam_stats.
+	FeatureSlamStats Feature = "slam_stats"
+	// FeatureSubmaps is viam_carto_get_submap_list and viam_carto_get_submap.
+	FeatureSubmaps Feature = "submaps"
+	// FeatureSetSlamMode is viam_carto_set_slam_mode.
+	FeatureSetSlamMode Feature = "set_slam_mode"
+	// FeatureBackgroundInitialOptimization is viam_carto_start_initial_optimization and
+	// viam_carto_get_initial_optimization_running.
+	FeatureBackgroundInitialOptimization Feature = "background_initial_optimization"
+)
+
+// Features are all optional features of the cartographer library.
+var Features = []Feature{
+	FeatureMemoryUsage,
+	FeatureInternalStateVersion,
+	FeatureInternalStateMigration,
+	FeatureInternalStateStream,
+	FeatureSlamStats,
+	FeatureSubmaps,
+	FeatureSetSlamMode,
+	FeatureBackgroundInitialOptimization,
+}
+
+// ErrFeatureUnavailable denotes that an optional feature of the cartographer library is unavailable, as the
+// library predates its C functions. It is matched by every FeatureUnavailableError.
+var ErrFeatureUnavailable = errors.New("feature is unavailable in the cartographer library")
+
+// featureErrors are the errors the features reported before the capabilities were probed, which their
+// FeatureUnavailableErrors still match so that callers checking for them keep working.
+var featureErrors = map[Feature]error{
+	FeatureMemoryUsage:            ErrMemoryUsageUnavailable,
+	FeatureInternalStateVersion:   ErrInternalStateVersionUnavailable,
+	FeatureInternalStateMigration: ErrInternalStateMigrationUnsupported,
+	FeatureInternalStateStream:    ErrInternalStateStreamUnavailable,
+}
+
+// FeatureUnavailableError is returned instead of calling into C when a feature of the cartographer library is
+// unavailable.
+type FeatureUnavailableError struct {
+	Feature Feature
+}
+
+func (e *FeatureUnavailableError) Error() string {
+	return fmt.Sprintf("%s is unavailable in the cartographer library, which predates it", e.Feature)
+}
+
+// Is returns whether target is ErrFeatureUnavailable or the error the feature reported before the capabilities
+// were probed.
+func (e *FeatureUnavailableError) Is(target error) bool {
+	return target == ErrFeatureUnavailable || (target != nil && target == featureErrors[e.Feature])
+}
+
+// ErrIncompatibleLibrary denotes that the cartographer library was built with another layout of the structs that
+// are passed to it than the module, e.g. of viam_carto_config or viam_carto_algo_config, which it would misread.
+// Unlike an optional feature, this cannot be probed per function, so the library is refused as a whole.
+var ErrIncompatibleLibrary = errors.New("the cartographer library is incompatible with the module")
+
+// abi is the version of the layout of the structs that are passed to the cartographer library along with the
+// sizes of its config structs.
+type abi struct {
+	version        int
+	configSize     uint64
+	algoConfigSize uint64
+}
+
+// checkABI returns an error wrapping ErrIncompatibleLibrary if the abi of the library differs from the one the
+// module was built with. lib is nil if the library predates viam_carto_lib_get_abi.
+func checkABI(lib *abi, module abi) error {
+	if lib == nil {
+		return fmt.Errorf("%w: the library predates ABI version %d of the module, rebuild it from the same revision "+
+			"as the module", ErrIncompatibleLibrary, module.version)
+	}
+	if *lib != module {
+		return fmt.Errorf("%w: the library has ABI version %d with config sizes %d and %d, but the module has ABI "+
+			"version %d with config sizes %d and %d, rebuild it from the same revision as the module",
+			ErrIncompatibleLibrary, lib.version, lib.configSize, lib.algoConfigSize,
+			module.version, module.configSize, module.algoConfigSize)
+	}
+	return nil
+}
+
+// Capabilities are the optional features the cartographer library provides. The zero value provides none.
+type Capabilities struct {
+	available map[Feature]bool
+}
+
+// NewCapabilities returns the capabilities of a library that provides the features available.
+func NewCapabilities(available ...Feature) Capabilities {
+	capabilities := Capabilities{available: map[Feature]bool{}}
+	for _, feature := range available {
+		capabilities.available[feature] = true
+	}
+	return capabilities
+}
+
+// Has returns whether feature is available.
+func (c Capabilities) Has(feature Feature) bool {
+	return c.available[feature]
+}
+
+// Require returns a FeatureUnavailableError if feature is unavailable.
+func (c Capabilities) Require(feature Feature) error {
+	if !c.Has(feature) {
+		return &FeatureUnavailableError{Feature: feature}
+	}
+	return nil
+}
+
+// Available returns the names of the available features in the order of Features.
+func (c Capabilities) Available() []string {
+	available := []string{}
+	for _, feature := range Features {
+		if c.Has(feature) {
+			available = append(available, string(feature))
+		}
+	}
+	return available
+}
+
+// Unavailable returns the names of the unavailable features in the order of Features.
+func (c Capabilities) Unavailable() []string {
+	unavailable := []string{}
+	for _, feature := range Features {
+		if !c.Has(feature) {
+			unavailable = append(unavailable, string(feature))
+		}
+	}
+	return unavailable
+}
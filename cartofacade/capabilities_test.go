@@ -0,0 +1,144 @@
+package cartofacade
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"go.viam.com/test"
+)
+
+func TestCapabilities(t *testing.T) {
+	t.Run("lists the available and unavailable features in order", func(t *testing.T) {
+		capabilities := NewCapabilities(FeatureSubmaps, FeatureMemoryUsage)
+		test.That(t, capabilities.Has(FeatureMemoryUsage), test.ShouldBeTrue)
+		test.That(t, capabilities.Has(FeatureSlamStats), test.ShouldBeFalse)
+		test.That(t, capabilities.Available(), test.ShouldResemble, []string{"memory_usage", "submaps"})
+		test.That(t, capabilities.Unavailable(), test.ShouldResemble, []string{
+			"internal_state_version", "internal_state_migration", "internal_state_stream", "slam_stats", "set_slam_mode",
+			"background_initial_optimization",
+		})
+
+		test.That(t, Capabilities{}.Available(), test.ShouldBeEmpty)
+		test.That(t, NewCapabilities(Features...).Unavailable(), test.ShouldBeEmpty)
+	})
+
+	t.Run("unavailable features return a typed error", func(t *testing.T) {
+		capabilities := NewCapabilities(FeatureSubmaps)
+		test.That(t, capabilities.Require(FeatureSubmaps), test.ShouldBeNil)
+
+		err := capabilities.Require(FeatureSlamStats)
+		var featureErr *FeatureUnavailableError
+		test.That(t, errors.As(err, &featureErr), test.ShouldBeTrue)
+		test.That(t, featureErr.Feature, test.ShouldEqual, FeatureSlamStats)
+		test.That(t, errors.Is(err, ErrFeatureUnavailable), test.ShouldBeTrue)
+		test.That(t, err.Error(), test.ShouldContainSubstring, "slam_stats")
+
+		// the errors the features reported before they were probed still match
+		for feature, featureErr := range map[Feature]error{
+			FeatureMemoryUsage:            ErrMemoryUsageUnavailable,
+			FeatureInternalStateVersion:   ErrInternalStateVersionUnavailable,
+			FeatureInternalStateMigration: ErrInternalStateMigrationUnsupported,
+			FeatureInternalStateStream:    ErrInternalStateStreamUnavailable,
+		} {
+			err := capabilities.Require(feature)
+			test.That(t, errors.Is(err, featureErr), test.ShouldBeTrue)
+			test.That(t, errors.Is(err, ErrMemoryUsageUnavailable), test.ShouldEqual, feature == FeatureMemoryUsage)
+		}
+	})
+}
+
+func TestCheckABI(t *testing.T) {
+	module := abi{version: 2, configSize: 80, algoConfigSize: 160}
+
+	t.Run("accepts a library of the same abi", func(t *testing.T) {
+		lib := module
+		test.That(t, checkABI(&lib, module), test.ShouldBeNil)
+	})
+
+	t.Run("refuses a library that predates the abi check", func(t *testing.T) {
+		err := checkABI(nil, module)
+		test.That(t, errors.Is(err, ErrIncompatibleLibrary), test.ShouldBeTrue)
+		test.That(t, err.Error(), test.ShouldContainSubstring, "predates ABI version 2")
+	})
+
+	t.Run("refuses a library of another abi version or config layout", func(t *testing.T) {
+		libs := []abi{
+			{version: 1, configSize: 80, algoConfigSize: 160},
+			{version: 2, configSize: 72, algoConfigSize: 160},
+			{version: 2, configSize: 80, algoConfigSize: 152},
+		}
+		for i := range libs {
+			err := checkABI(&libs[i], module)
+			test.That(t, errors.Is(err, ErrIncompatibleLibrary), test.ShouldBeTrue)
+		}
+	})
+
+	t.Run("the linked library has the abi of the module", func(t *testing.T) {
+		test.That(t, checkLibABI(), test.ShouldBeNil)
+	})
+}
+
+func TestFeatureUnavailable(t *testing.T) {
+	lib := CartoLibMock{
+		CapabilitiesFunc: func() Capabilities { return NewCapabilities() },
+		MemoryUsageFunc: func() (uint64, error) {
+			t.Error("memory usage was polled although it is unavailable")
+			return 0, nil
+		},
+	}
+
+	cancelCtx, cancelFunc := context.WithCancel(context.Background())
+	activeBackgroundWorkers := sync.WaitGroup{}
+
+	cfg := GetTestConfig("my-lidar", "", "", true)
+	algoCfg := GetTestAlgoConfig(false)
+
+	cartoFacade := New(&lib, cfg, algoCfg)
+	// cartographer is never called into for unavailable features
+	calledIntoC := func() error {
+		t.Error("called into cartographer for an unavailable feature")
+		return errors.New("unavailable feature")
+	}
+	carto := CartoMock{
+		SlamStatsFunc:           func() (SlamStats, error) { return SlamStats{}, calledIntoC() },
+		SubmapListFunc:          func() ([]Submap, error) { return nil, calledIntoC() },
+		SubmapFunc:              func(SubmapID) (SubmapPointCloud, error) { return SubmapPointCloud{}, calledIntoC() },
+		SetSlamModeFunc:         func(SlamMode) error { return calledIntoC() },
+		InternalStateStreamFunc: func() (*internalStateStreamHandle, error) { return nil, calledIntoC() },
+	}
+	cartoFacade.carto = &carto
+	cartoFacade.startCGoroutine(cancelCtx, &activeBackgroundWorkers)
+
+	requireUnavailable := func(t *testing.T, err error, feature Feature) {
+		t.Helper()
+		var featureErr *FeatureUnavailableError
+		test.That(t, errors.As(err, &featureErr), test.ShouldBeTrue)
+		test.That(t, featureErr.Feature, test.ShouldEqual, feature)
+		test.That(t, errors.Is(err, ErrFeatureUnavailable), test.ShouldBeTrue)
+	}
+
+	_, err := cartoFacade.SlamStats(cancelCtx, 5*time.Second)
+	requireUnavailable(t, err, FeatureSlamStats)
+	_, err = cartoFacade.SubmapList(cancelCtx, 5*time.Second)
+	requireUnavailable(t, err, FeatureSubmaps)
+	_, err = cartoFacade.Submap(cancelCtx, 5*time.Second, SubmapID{})
+	requireUnavailable(t, err, FeatureSubmaps)
+	err = cartoFacade.SetSlamMode(cancelCtx, 5*time.Second, LocalizingMode)
+	requireUnavailable(t, err, FeatureSetSlamMode)
+	_, err = cartoFacade.InternalStateStream(cancelCtx, 5*time.Second)
+	requireUnavailable(t, err, FeatureInternalStateStream)
+	test.That(t, errors.Is(err, ErrInternalStateStreamUnavailable), test.ShouldBeTrue)
+
+	// the memory monitor is not started
+	monitorWorkers := sync.WaitGroup{}
+	cartoFacade.StartMemoryMonitor(cancelCtx, time.Millisecond, &monitorWorkers)
+	monitorWorkers.Wait()
+	_, ok := cartoFacade.MemoryUsage()
+	test.That(t, ok, test.ShouldBeFalse)
+
+	cancelFunc()
+	activeBackgroundWorkers.Wait()
+}
@@ -10,27 +10,227 @@ package cartofacade
 	#cgo LDFLAGS: -lviam-cartographer  -lcartographer -ldl -lm -labsl_hash  -labsl_city -labsl_bad_optional_access -labsl_strerror  -labsl_str_format_internal -labsl_synchronization -labsl_strings -labsl_throw_delegate -lcairo -llua5.3 -lstdc++ -lceres -lprotobuf -lglog -lboost_filesystem -lboost_iostreams -lpcl_io -lpcl_common -labsl_raw_hash_set
 
 	#include "../viam-cartographer/src/carto_facade/carto_facade.h"
+	#include <stdio.h>
+
+	static void flush_stdout() { fflush(stdout); }
+
+	// viam_carto_lib_get_memory_usage is referenced weakly so that libraries built before it was added can
+	// still be linked against, in which case the memory usage is reported as unavailable.
+	#pragma weak viam_carto_lib_get_memory_usage
+	static int get_memory_usage(viam_carto_lib *vcl, viam_carto_get_memory_usage_response *r) {
+		if (viam_carto_lib_get_memory_usage == NULL) {
+			return VIAM_CARTO_MEMORY_USAGE_UNAVAILABLE;
+		}
+		return viam_carto_lib_get_memory_usage(vcl, r);
+	}
+
+	// the internal state version functions are referenced weakly for the same reason, in which case the version
+	// of internal states is reported as unavailable.
+	#pragma weak viam_carto_lib_get_internal_state_version
+	static int get_internal_state_version(viam_carto_lib *vcl, bstring path, viam_carto_get_internal_state_version_response *r) {
+		if (viam_carto_lib_get_internal_state_version == NULL) {
+			return VIAM_CARTO_INTERNAL_STATE_VERSION_UNAVAILABLE;
+		}
+		return viam_carto_lib_get_internal_state_version(vcl, path, r);
+	}
+
+	#pragma weak viam_carto_lib_migrate_internal_state
+	static int migrate_internal_state(viam_carto_lib *vcl, bstring src, bstring dst) {
+		if (viam_carto_lib_migrate_internal_state == NULL) {
+			return VIAM_CARTO_INTERNAL_STATE_MIGRATION_UNSUPPORTED;
+		}
+		return viam_carto_lib_migrate_internal_state(vcl, src, dst);
+	}
+
+	// the internal state stream functions are referenced weakly for the same reason, in which case the internal
+	// state is only copied as a whole.
+	#pragma weak viam_carto_get_internal_state_stream
+	static int get_internal_state_stream(viam_carto *vc, viam_carto_internal_state_stream **s) {
+		if (viam_carto_get_internal_state_stream == NULL) {
+			return VIAM_CARTO_INTERNAL_STATE_STREAM_UNAVAILABLE;
+		}
+		return viam_carto_get_internal_state_stream(vc, s);
+	}
+
+	#pragma weak viam_carto_get_internal_state_chunk
+	static int get_internal_state_chunk(viam_carto_internal_state_stream *s, int max_size, viam_carto_get_internal_state_chunk_response *r) {
+		if (viam_carto_get_internal_state_chunk == NULL) {
+			return VIAM_CARTO_INTERNAL_STATE_STREAM_UNAVAILABLE;
+		}
+		return viam_carto_get_internal_state_chunk(s, max_size, r);
+	}
+
+	#pragma weak viam_carto_get_internal_state_chunk_response_destroy
+	static int get_internal_state_chunk_response_destroy(viam_carto_get_internal_state_chunk_response *r) {
+		if (viam_carto_get_internal_state_chunk_response_destroy == NULL) {
+			return VIAM_CARTO_INTERNAL_STATE_STREAM_UNAVAILABLE;
+		}
+		return viam_carto_get_internal_state_chunk_response_destroy(r);
+	}
+
+	#pragma weak viam_carto_internal_state_stream_destroy
+	static int internal_state_stream_destroy(viam_carto_internal_state_stream **s) {
+		if (viam_carto_internal_state_stream_destroy == NULL) {
+			return VIAM_CARTO_INTERNAL_STATE_STREAM_UNAVAILABLE;
+		}
+		return viam_carto_internal_state_stream_destroy(s);
+	}
+
+	// the slam stats, submap, slam mode and initial optimization functions are referenced weakly as well. They are only called once
+	// probeCapabilities found them.
+	#pragma weak viam_carto_get_slam_stats
+	#pragma weak viam_carto_get_submap_list
+	#pragma weak viam_carto_get_submap_list_response_destroy
+	#pragma weak viam_carto_get_submap
+	#pragma weak viam_carto_get_submap_response_destroy
+	#pragma weak viam_carto_set_slam_mode
+	#pragma weak viam_carto_start_initial_optimization
+	#pragma weak viam_carto_get_initial_optimization_running
+
+	// viam_carto_lib_get_abi is referenced weakly so that a library that predates it is refused with a
+	// descriptive error rather than failing to link.
+	#pragma weak viam_carto_lib_get_abi
+	static int get_abi(viam_carto_abi *abi) {
+		if (viam_carto_lib_get_abi == NULL) {
+			return VIAM_CARTO_ABI_UNAVAILABLE;
+		}
+		return viam_carto_lib_get_abi(abi);
+	}
+
+	// the has_* functions return whether the functions of an optional feature were linked.
+	static int has_memory_usage() { return viam_carto_lib_get_memory_usage != NULL; }
+	static int has_internal_state_version() { return viam_carto_lib_get_internal_state_version != NULL; }
+	static int has_internal_state_migration() { return viam_carto_lib_migrate_internal_state != NULL; }
+	static int has_internal_state_stream() {
+		return viam_carto_get_internal_state_stream != NULL && viam_carto_get_internal_state_chunk != NULL &&
+			viam_carto_get_internal_state_chunk_response_destroy != NULL &&
+			viam_carto_internal_state_stream_destroy != NULL;
+	}
+	static int has_slam_stats() { return viam_carto_get_slam_stats != NULL; }
+	static int has_submaps() {
+		return viam_carto_get_submap_list != NULL && viam_carto_get_submap_list_response_destroy != NULL &&
+			viam_carto_get_submap != NULL && viam_carto_get_submap_response_destroy != NULL;
+	}
+	static int has_set_slam_mode() { return viam_carto_set_slam_mode != NULL; }
+	static int has_background_initial_optimization() {
+		return viam_carto_start_initial_optimization != NULL && viam_carto_get_initial_optimization_running != NULL;
+	}
 */
 import "C"
 
 import (
 	"errors"
+	"math"
+	"time"
 	"unsafe"
 
+	"github.com/golang/geo/r3"
 	geo "github.com/kellydunn/golang-geo"
 	"go.viam.com/rdk/spatialmath"
 
 	s "github.com/viam-modules/viam-cartographer/sensors"
 )
 
+// ErrMemoryUsageUnavailable denotes that the cartographer library does not report its memory usage, either
+// because it predates viam_carto_lib_get_memory_usage or because the allocator of the platform does not report
+// its statistics.
+var ErrMemoryUsageUnavailable = errors.New("cartographer memory usage is unavailable")
+
+// ErrInternalStateVersionUnavailable denotes that the cartographer library predates
+// viam_carto_lib_get_internal_state_version, so the version of internal states cannot be probed.
+var ErrInternalStateVersionUnavailable = errors.New("cartographer internal state version is unavailable")
+
+// ErrInternalStateStreamUnavailable denotes that the cartographer library predates
+// viam_carto_get_internal_state_stream, so the internal state can only be copied as a whole.
+var ErrInternalStateStreamUnavailable = errors.New("cartographer internal state stream is unavailable")
+
+// ErrInternalStateMigrationUnsupported denotes that cartographer provides no migration of an internal state from
+// its version to the current one.
+var ErrInternalStateMigrationUnsupported = errors.New("VIAM_CARTO_INTERNAL_STATE_MIGRATION_UNSUPPORTED")
+
+// ErrIMUProvidedAndIMUEnabledMismatch denotes that cartographer was configured to use IMU data without a movement
+// sensor, or with a movement sensor but without using IMU data.
+var ErrIMUProvidedAndIMUEnabledMismatch = errors.New("VIAM_CARTO_IMU_PROVIDED_AND_IMU_ENABLED_MISMATCH")
+
+// ErrSubmapNotFound denotes that cartographer's pose graph has no submap of the requested id.
+var ErrSubmapNotFound = errors.New("VIAM_CARTO_SUBMAP_NOT_FOUND")
+
+// ErrTrajectoryNotFound denotes that cartographer's pose graph has no trajectory of the requested id.
+var ErrTrajectoryNotFound = errors.New("VIAM_CARTO_TRAJECTORY_NOT_FOUND")
+
+// ErrTrajectoryActive denotes that the trajectory sensor readings are added to was requested to be frozen.
+var ErrTrajectoryActive = errors.New("VIAM_CARTO_TRAJECTORY_ACTIVE")
+
+// ErrNotLocalizing denotes that the trajectory was requested to be restarted while cartographer is not in
+// LocalizingMode.
+var ErrNotLocalizing = errors.New("VIAM_CARTO_NOT_LOCALIZING")
+
+// ErrInitialOptimizationAlreadyStarted denotes that the initial optimization was requested to be started a second
+// time.
+var ErrInitialOptimizationAlreadyStarted = errors.New("VIAM_CARTO_INITIAL_OPTIMIZATION_ALREADY_STARTED")
+
+// ErrFloorPlanInvalid denotes that cartographer could not load the floor plan, because it has no known cells, was
+// combined with an existing map or lacks a resolution.
+var ErrFloorPlanInvalid = errors.New("VIAM_CARTO_FLOOR_PLAN_INVALID")
+
+// ErrPointCloudMapEmpty denotes that cartographer has no points in its map yet, e.g. before any lidar reading was
+// added.
+var ErrPointCloudMapEmpty = errors.New("VIAM_CARTO_POINTCLOUD_MAP_EMPTY")
+
+// ErrLidarReadingEmpty, ErrLidarReadingInvalid, ErrIMUReadingEmpty, ErrIMUReadingInvalid and
+// ErrOdometerReadingInvalid denote that cartographer rejected a sensor reading, e.g. one corrupt frame of a dataset.
+var (
+	ErrLidarReadingEmpty      = errors.New("VIAM_CARTO_LIDAR_READING_EMPTY")
+	ErrLidarReadingInvalid    = errors.New("VIAM_CARTO_LIDAR_READING_INVALID")
+	ErrIMUReadingEmpty        = errors.New("VIAM_CARTO_IMU_READING_EMPTY")
+	ErrIMUReadingInvalid      = errors.New("VIAM_CARTO_IMU_READING_INVALID")
+	ErrOdometerReadingInvalid = errors.New("VIAM_CARTO_ODOMETER_READING_INVALID")
+)
+
+// IsReadingRejected returns whether err denotes that a sensor reading was rejected for its contents, so that
+// adding the same reading again fails the same way, unlike e.g. ErrUnableToAcquireLock.
+func IsReadingRejected(err error) bool {
+	for _, rejected := range []error{
+		ErrLidarReadingEmpty, ErrLidarReadingInvalid, ErrIMUReadingEmpty, ErrIMUReadingInvalid,
+		ErrOdometerReadingInvalid, errOdometerReadingNotFinite, errOdometerReadingMissing,
+	} {
+		if errors.Is(err, rejected) {
+			return true
+		}
+	}
+	return false
+}
+
+// errOdometerReadingNotFinite denotes that an odometer reading contains NaN or Inf values, which must never
+// be passed to the C facade.
+var errOdometerReadingNotFinite = errors.New("odometer reading contains NaN or Inf values")
+
+// errOdometerReadingMissing denotes that an odometer reading lacks its position or its orientation.
+var errOdometerReadingMissing = errors.New("odometer reading is missing its position or orientation")
+
 // CartoLib holds the c type viam_carto_lib
 type CartoLib struct {
 	value *C.viam_carto_lib
+	// capabilities are the optional features of the library, probed by NewLib.
+	capabilities *Capabilities
 }
 
 // CartoLibInterface describes the method signatures that CartoLib must implement
 type CartoLibInterface interface {
 	Terminate() error
+	SetLogLevel(minloglevel, verbose int) error
+	LogLevel() (minloglevel, verbose int)
+	MemoryUsage() (uint64, error)
+	InternalStateVersion(path string) (InternalStateVersion, error)
+	MigrateInternalState(src, dst string) error
+	Capabilities() Capabilities
+}
+
+// InternalStateVersion holds the serialization format version of an internal state file and the one the
+// cartographer library writes and loads.
+type InternalStateVersion struct {
+	Version        int
+	CurrentVersion int
 }
 
 // SlamMode represents the lidar configuration
@@ -47,6 +247,20 @@ const (
 	UpdatingMode
 )
 
+// String returns the name of the slam mode.
+func (mode SlamMode) String() string {
+	switch mode {
+	case MappingMode:
+		return "mapping"
+	case LocalizingMode:
+		return "localizing"
+	case UpdatingMode:
+		return "updating"
+	case UnknownMode:
+	}
+	return "unknown"
+}
+
 // Carto holds the c type viam_carto
 type Carto struct {
 	value *C.viam_carto
@@ -64,7 +278,22 @@ type CartoInterface interface {
 	position() (Position, error)
 	pointCloudMap() ([]byte, error)
 	internalState() ([]byte, error)
+	internalStateStream() (*internalStateStreamHandle, error)
+	internalStateChunk(stream *internalStateStreamHandle, maxSize int) ([]byte, error)
+	closeInternalStateStream(stream *internalStateStreamHandle) error
 	runFinalOptimization() error
+	startInitialOptimization() error
+	initialOptimizationRunning() (bool, error)
+	algoConfig() (CartoAlgoConfig, error)
+	startNewTrajectory(initialPose *TrajectoryPose) (NewTrajectory, error)
+	freezeTrajectory(id int) error
+	restartTrajectory(initialPose *TrajectoryPose) (RestartedTrajectory, error)
+	trajectories() ([]Trajectory, error)
+	trajectory() ([]TrajectoryNode, error)
+	submapList() ([]Submap, error)
+	submap(id SubmapID) (SubmapPointCloud, error)
+	slamStats() (SlamStats, error)
+	setSlamMode(mode SlamMode) error
 }
 
 // Position holds values returned from c to be processed later
@@ -77,6 +306,110 @@ type Position struct {
 	Imag float64
 	Jmag float64
 	Kmag float64
+
+	// Confidence is the mean probability, between 0 and 1, of the finished submaps being occupied at the points of
+	// the latest lidar reading, placed by its optimized pose, where points off the map count as 0. It is -1, i.e.
+	// unknown, until the map has been optimized for the first time and has a finished submap.
+	Confidence float64
+}
+
+// TrajectoryPose is the pose a new trajectory starts at relative to the starting point of the first
+// trajectory. It has the same units as the initial trajectory pose of the algo config.
+type TrajectoryPose struct {
+	X     float64
+	Y     float64
+	Theta float64
+}
+
+// NewTrajectory holds the ids of the trajectory that was finished and of the trajectory that was started
+// by a call to StartNewTrajectory.
+type NewTrajectory struct {
+	FinishedTrajectoryID int
+	TrajectoryID         int
+}
+
+// RestartedTrajectory holds the ids of the localization trajectory that was deleted and of the trajectory that
+// replaced it by a call to RestartTrajectory.
+type RestartedTrajectory struct {
+	RestartedTrajectoryID int
+	TrajectoryID          int
+}
+
+// TrajectoryState represents the state of a trajectory in cartographer's pose graph
+type TrajectoryState int64
+
+const (
+	// TrajectoryActive denotes a trajectory sensor readings are added to
+	TrajectoryActive TrajectoryState = iota
+	// TrajectoryFinished denotes a trajectory that no longer receives sensor readings
+	TrajectoryFinished
+	// TrajectoryFrozen denotes a finished trajectory that is no longer changed by optimization
+	TrajectoryFrozen
+	// TrajectoryDeleted denotes a trajectory that was removed from the pose graph
+	TrajectoryDeleted
+)
+
+// String returns the name of the trajectory state.
+func (state TrajectoryState) String() string {
+	switch state {
+	case TrajectoryActive:
+		return "active"
+	case TrajectoryFinished:
+		return "finished"
+	case TrajectoryFrozen:
+		return "frozen"
+	case TrajectoryDeleted:
+		return "deleted"
+	default:
+		return "unknown"
+	}
+}
+
+// Trajectory holds the id and state of a trajectory in cartographer's pose graph
+type Trajectory struct {
+	ID    int
+	State TrajectoryState
+}
+
+// TrajectoryNode holds the time of a node of a trajectory in cartographer's pose graph and its optimized pose,
+// in millimeters, relative to the starting point of the first trajectory.
+type TrajectoryNode struct {
+	TrajectoryID int
+	Time         time.Time
+	Pose         spatialmath.Pose
+}
+
+// SubmapID identifies a submap of cartographer's pose graph by the trajectory it belongs to and its index within
+// that trajectory.
+type SubmapID struct {
+	TrajectoryID int
+	SubmapIndex  int
+}
+
+// Submap holds the id of a submap of cartographer's pose graph, its version, which increases with every lidar
+// reading inserted into it, and its optimized pose, in millimeters, relative to the starting point of the first
+// trajectory.
+type Submap struct {
+	ID      SubmapID
+	Version int
+	Pose    spatialmath.Pose
+}
+
+// SubmapPointCloud holds a submap along with its pointcloud, the submap painted on its own as a binary PCD in the
+// format and frame of the pointcloud map.
+type SubmapPointCloud struct {
+	Submap
+	PointCloud []byte
+}
+
+// SlamStats holds the number of nodes of the current trajectory and how far the optimization of cartographer's
+// pose graph lags behind them.
+type SlamStats struct {
+	NumNodes            int
+	NumUnoptimizedNodes int
+	// OldestUnoptimizedNodeAge is the age of the oldest node not yet covered by an optimization pass, measured
+	// against the time of the latest node.
+	OldestUnoptimizedNodeAge time.Duration
 }
 
 // LidarConfig represents the lidar configuration
@@ -89,6 +422,21 @@ const (
 	ThreeD
 )
 
+// SensorStreams declares which streams of sensor readings will be added to cartographer, which checks it against
+// the movement sensor of the config. The readings cartographer waits on follow from use_imu_data, which is only set
+// with an IMU, so a lidar only config never waits on IMU readings.
+type SensorStreams int64
+
+const (
+	// SensorStreamsUnspecified skips the check against the movement sensor.
+	SensorStreamsUnspecified SensorStreams = iota
+	// LidarOnly declares that only lidar readings will be added.
+	LidarOnly
+	// LidarAndMovementSensor declares that the readings of the movement sensor will be added along with those of
+	// the lidars.
+	LidarAndMovementSensor
+)
+
 // CartoConfig contains config values from app
 type CartoConfig struct {
 	Camera         string
@@ -97,6 +445,17 @@ type CartoConfig struct {
 
 	EnableMapping bool
 	ExistingMap   string
+	// FloorPlan, if not empty, is loaded as the map instead of ExistingMap. It is a probability grid PCD, see
+	// floorplan.Convert.
+	FloorPlan []byte
+	// FloorPlanResolution is the size of the cells of FloorPlan in meters.
+	FloorPlanResolution float64
+	// AdditionalCameras are the names of the lidars other than Camera whose readings are added to the same
+	// trajectory, each as a range sensor of its own.
+	AdditionalCameras []string
+	// SensorStreams declares which streams of sensor readings will be added. LidarOnly requires MovementSensor
+	// to be empty and LidarAndMovementSensor requires it to be set.
+	SensorStreams SensorStreams
 }
 
 // CartoAlgoConfig contains config values from app
@@ -120,21 +479,91 @@ type CartoAlgoConfig struct {
 	InitialTrajectoryPoseX     float64
 	InitialTrajectoryPoseY     float64
 	InitialTrajectoryPoseTheta float64
+
+	// The standard deviations of the initial trajectory pose, X and Y in meters and Theta in degrees. When set in
+	// localizing mode, the first lidar readings are searched for in the region they span rather than trusting the
+	// initial pose exactly, and the trajectory is restarted where they match.
+	HasInitialTrajectoryPoseSigma   bool
+	InitialTrajectoryPoseSigmaX     float64
+	InitialTrajectoryPoseSigmaY     float64
+	InitialTrajectoryPoseSigmaTheta float64
+
+	// FinalOptimizationIterations is the maximum number of ceres iterations of the final optimization. Zero leaves
+	// it at the default of the lua config.
+	FinalOptimizationIterations int `json:",omitempty"`
 }
 
-// NewLib calls viam_carto_lib_init and returns a pointer to a viam carto lib object.
+// NewLib calls viam_carto_lib_init and returns a pointer to a viam carto lib object. It fails with
+// ErrIncompatibleLibrary without initializing the library if it was built with another ABI version than the module.
 func NewLib(miniloglevel, verbose int) (CartoLib, error) {
+	if err := checkLibABI(); err != nil {
+		return CartoLib{}, err
+	}
+
 	var pVcl *C.viam_carto_lib
 	status := C.viam_carto_lib_init(&pVcl, C.int(miniloglevel), C.int(verbose))
 	if err := toError(status); err != nil {
 		return CartoLib{}, err
 	}
 
-	vcl := CartoLib{value: pVcl}
+	capabilities := probeCapabilities()
+	vcl := CartoLib{value: pVcl, capabilities: &capabilities}
 
 	return vcl, nil
 }
 
+// checkLibABI returns an error wrapping ErrIncompatibleLibrary if the linked library was built with another
+// layout of the structs that are passed to it than the module.
+func checkLibABI() error {
+	module := abi{
+		version:        int(C.VIAM_CARTO_ABI_VERSION),
+		configSize:     uint64(C.sizeof_viam_carto_config),
+		algoConfigSize: uint64(C.sizeof_viam_carto_algo_config),
+	}
+	var vcAbi C.viam_carto_abi
+	status := C.get_abi(&vcAbi)
+	if status == C.VIAM_CARTO_ABI_UNAVAILABLE {
+		return checkABI(nil, module)
+	}
+	if err := toError(status); err != nil {
+		return err
+	}
+	return checkABI(&abi{
+		version:        int(vcAbi.version),
+		configSize:     uint64(vcAbi.config_size),
+		algoConfigSize: uint64(vcAbi.algo_config_size),
+	}, module)
+}
+
+// probeCapabilities returns the optional features whose functions the linked library provides.
+func probeCapabilities() Capabilities {
+	var available []Feature
+	for feature, has := range map[Feature]C.int{
+		FeatureMemoryUsage:                   C.has_memory_usage(),
+		FeatureInternalStateVersion:          C.has_internal_state_version(),
+		FeatureInternalStateMigration:        C.has_internal_state_migration(),
+		FeatureInternalStateStream:           C.has_internal_state_stream(),
+		FeatureSlamStats:                     C.has_slam_stats(),
+		FeatureSubmaps:                       C.has_submaps(),
+		FeatureSetSlamMode:                   C.has_set_slam_mode(),
+		FeatureBackgroundInitialOptimization: C.has_background_initial_optimization(),
+	} {
+		if has != 0 {
+			available = append(available, feature)
+		}
+	}
+	return NewCapabilities(available...)
+}
+
+// Capabilities returns the optional features the library provides, as probed by NewLib, or probed now if the
+// library was not created by NewLib.
+func (vcl *CartoLib) Capabilities() Capabilities {
+	if vcl.capabilities == nil {
+		return probeCapabilities()
+	}
+	return *vcl.capabilities
+}
+
 // Terminate calls viam_carto_lib_terminate to clean up memory for viam carto lib.
 func (vcl *CartoLib) Terminate() error {
 	status := C.viam_carto_lib_terminate(&vcl.value)
@@ -144,6 +573,67 @@ func (vcl *CartoLib) Terminate() error {
 	return nil
 }
 
+// SetLogLevel calls viam_carto_lib_set_log_level to change the glog minloglevel and verbose level of
+// cartographer at runtime.
+func (vcl *CartoLib) SetLogLevel(minloglevel, verbose int) error {
+	status := C.viam_carto_lib_set_log_level(vcl.value, C.int(minloglevel), C.int(verbose))
+	if err := toError(status); err != nil {
+		return err
+	}
+	return nil
+}
+
+// LogLevel returns the glog minloglevel and verbose level cartographer is currently logging with.
+func (vcl *CartoLib) LogLevel() (minloglevel, verbose int) {
+	if vcl.value == nil {
+		return 0, 0
+	}
+	return int(vcl.value.minloglevel), int(vcl.value.verbose)
+}
+
+// MemoryUsage calls viam_carto_lib_get_memory_usage and returns the approximate number of bytes allocated
+// on the C side of the process, which is dominated by cartographer's submaps and nodes.
+func (vcl *CartoLib) MemoryUsage() (uint64, error) {
+	if err := vcl.Capabilities().Require(FeatureMemoryUsage); err != nil {
+		return 0, err
+	}
+	var resp C.viam_carto_get_memory_usage_response
+	status := C.get_memory_usage(vcl.value, &resp)
+	if err := toError(status); err != nil {
+		return 0, err
+	}
+	return uint64(resp.allocated_bytes), nil
+}
+
+// InternalStateVersion calls viam_carto_lib_get_internal_state_version and returns the serialization format version
+// of the internal state file at path along with the current one.
+func (vcl *CartoLib) InternalStateVersion(path string) (InternalStateVersion, error) {
+	if err := vcl.Capabilities().Require(FeatureInternalStateVersion); err != nil {
+		return InternalStateVersion{}, err
+	}
+	var resp C.viam_carto_get_internal_state_version_response
+	cPath := goStringToBstring(path)
+	defer C.bdestroy(cPath)
+	status := C.get_internal_state_version(vcl.value, cPath, &resp)
+	if err := toError(status); err != nil {
+		return InternalStateVersion{}, err
+	}
+	return InternalStateVersion{Version: int(resp.version), CurrentVersion: int(resp.current_version)}, nil
+}
+
+// MigrateInternalState calls viam_carto_lib_migrate_internal_state, which writes the internal state file at src
+// in the current serialization format version to dst.
+func (vcl *CartoLib) MigrateInternalState(src, dst string) error {
+	if err := vcl.Capabilities().Require(FeatureInternalStateMigration); err != nil {
+		return err
+	}
+	cSrc := goStringToBstring(src)
+	defer C.bdestroy(cSrc)
+	cDst := goStringToBstring(dst)
+	defer C.bdestroy(cDst)
+	return toError(C.migrate_internal_state(vcl.value, cSrc, cDst))
+}
+
 func toSlamMode(cSlamMode C.int) SlamMode {
 	switch cSlamMode {
 	case C.VIAM_CARTO_SLAM_MODE_MAPPING:
@@ -157,6 +647,19 @@ func toSlamMode(cSlamMode C.int) SlamMode {
 	}
 }
 
+func toCSlamMode(slamMode SlamMode) C.int {
+	switch slamMode {
+	case MappingMode:
+		return C.VIAM_CARTO_SLAM_MODE_MAPPING
+	case LocalizingMode:
+		return C.VIAM_CARTO_SLAM_MODE_LOCALIZING
+	case UpdatingMode:
+		return C.VIAM_CARTO_SLAM_MODE_UPDATING
+	default:
+		return C.VIAM_CARTO_SLAM_MODE_UNKNOWN
+	}
+}
+
 // NewCarto calls viam_carto_init and returns a pointer to a viam carto object. vcl is only an
 // interface to facilitate testing. The only type vcl is expected to have is a CartoLib.
 func NewCarto(cfg CartoConfig, acfg CartoAlgoConfig, vcl CartoLibInterface) (Carto, error) {
@@ -217,6 +720,12 @@ func (vc *Carto) terminate() error {
 
 // addLidarReading is a wrapper for viam_carto_add_lidar_reading
 func (vc *Carto) addLidarReading(lidar string, reading s.TimedLidarReadingResponse) error {
+	// cartographer only reads ascii and binary PCDs
+	pcd, err := s.DecompressPCD(reading.Reading)
+	if err != nil {
+		return err
+	}
+	reading.Reading = pcd
 	value := toLidarReading(lidar, reading)
 
 	status := C.viam_carto_add_lidar_reading(vc.value, &value)
@@ -253,7 +762,10 @@ func (vc *Carto) addIMUReading(imu string, reading s.TimedIMUReadingResponse) er
 
 // addOdometerReading is a wrapper for viam_carto_add_odometer_reading
 func (vc *Carto) addOdometerReading(odometer string, reading s.TimedOdometerReadingResponse) error {
-	value := toOdometerReading(odometer, reading)
+	value, err := toOdometerReading(odometer, reading)
+	if err != nil {
+		return err
+	}
 
 	status := C.viam_carto_add_odometer_reading(vc.value, &value)
 
@@ -329,6 +841,51 @@ func (vc *Carto) internalState() ([]byte, error) {
 	return interalState, nil
 }
 
+// internalStateStreamHandle holds the c type viam_carto_internal_state_stream, an internal state that is read in
+// chunks.
+type internalStateStreamHandle struct {
+	value *C.viam_carto_internal_state_stream
+}
+
+// internalStateStream is a wrapper for viam_carto_get_internal_state_stream
+func (vc *Carto) internalStateStream() (*internalStateStreamHandle, error) {
+	stream := internalStateStreamHandle{}
+
+	status := C.get_internal_state_stream(vc.value, &stream.value)
+
+	if err := toError(status); err != nil {
+		return nil, err
+	}
+
+	return &stream, nil
+}
+
+// internalStateChunk is a wrapper for viam_carto_get_internal_state_chunk, it returns an empty chunk once all of
+// the internal state has been read.
+func (vc *Carto) internalStateChunk(stream *internalStateStreamHandle, maxSize int) ([]byte, error) {
+	value := C.viam_carto_get_internal_state_chunk_response{}
+
+	status := C.get_internal_state_chunk(stream.value, C.int(maxSize), &value)
+
+	if err := toError(status); err != nil {
+		return nil, err
+	}
+
+	chunk := bstringToByteSlice(value.chunk)
+
+	status = C.get_internal_state_chunk_response_destroy(&value)
+	if err := toError(status); err != nil {
+		return nil, err
+	}
+
+	return chunk, nil
+}
+
+// closeInternalStateStream is a wrapper for viam_carto_internal_state_stream_destroy
+func (vc *Carto) closeInternalStateStream(stream *internalStateStreamHandle) error {
+	return toError(C.internal_state_stream_destroy(&stream.value))
+}
+
 // runFinalOptimization is a wrapper for viam_carto_run_final_optimization
 func (vc *Carto) runFinalOptimization() error {
 	status := C.viam_carto_run_final_optimization(vc.value)
@@ -340,6 +897,196 @@ func (vc *Carto) runFinalOptimization() error {
 	return nil
 }
 
+// startInitialOptimization is a wrapper for viam_carto_start_initial_optimization
+func (vc *Carto) startInitialOptimization() error {
+	status := C.viam_carto_start_initial_optimization(vc.value)
+
+	if err := toError(status); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// initialOptimizationRunning is a wrapper for viam_carto_get_initial_optimization_running
+func (vc *Carto) initialOptimizationRunning() (bool, error) {
+	var running C.bool
+	status := C.viam_carto_get_initial_optimization_running(vc.value, &running)
+
+	if err := toError(status); err != nil {
+		return false, err
+	}
+
+	return bool(running), nil
+}
+
+// algoConfig is a wrapper for viam_carto_get_algo_config
+func (vc *Carto) algoConfig() (CartoAlgoConfig, error) {
+	value := C.viam_carto_algo_config{}
+
+	status := C.viam_carto_get_algo_config(vc.value, &value)
+
+	if err := toError(status); err != nil {
+		return CartoAlgoConfig{}, err
+	}
+
+	return fromAlgoConfig(value), nil
+}
+
+// startNewTrajectory is a wrapper for viam_carto_start_new_trajectory
+func (vc *Carto) startNewTrajectory(initialPose *TrajectoryPose) (NewTrajectory, error) {
+	req := C.viam_carto_start_new_trajectory_request{}
+	if initialPose != nil {
+		req.has_initial_pose = C.bool(true)
+		req.initial_pose_x = C.double(initialPose.X)
+		req.initial_pose_y = C.double(initialPose.Y)
+		req.initial_pose_theta = C.double(initialPose.Theta)
+	}
+	value := C.viam_carto_start_new_trajectory_response{}
+
+	status := C.viam_carto_start_new_trajectory(vc.value, &req, &value)
+
+	if err := toError(status); err != nil {
+		return NewTrajectory{}, err
+	}
+
+	return NewTrajectory{
+		FinishedTrajectoryID: int(value.finished_trajectory_id),
+		TrajectoryID:         int(value.trajectory_id),
+	}, nil
+}
+
+// trajectories is a wrapper for viam_carto_get_trajectories
+func (vc *Carto) trajectories() ([]Trajectory, error) {
+	value := C.viam_carto_get_trajectories_response{}
+
+	status := C.viam_carto_get_trajectories(vc.value, &value)
+
+	if err := toError(status); err != nil {
+		return nil, err
+	}
+
+	trajectories := toTrajectories(value)
+
+	status = C.viam_carto_get_trajectories_response_destroy(&value)
+	if err := toError(status); err != nil {
+		return nil, err
+	}
+
+	return trajectories, nil
+}
+
+// trajectory is a wrapper for viam_carto_get_trajectory
+func (vc *Carto) trajectory() ([]TrajectoryNode, error) {
+	value := C.viam_carto_get_trajectory_response{}
+
+	status := C.viam_carto_get_trajectory(vc.value, &value)
+
+	if err := toError(status); err != nil {
+		return nil, err
+	}
+
+	nodes := toTrajectoryNodes(value)
+
+	status = C.viam_carto_get_trajectory_response_destroy(&value)
+	if err := toError(status); err != nil {
+		return nil, err
+	}
+
+	return nodes, nil
+}
+
+// submapList is a wrapper for viam_carto_get_submap_list
+func (vc *Carto) submapList() ([]Submap, error) {
+	value := C.viam_carto_get_submap_list_response{}
+
+	status := C.viam_carto_get_submap_list(vc.value, &value)
+
+	if err := toError(status); err != nil {
+		return nil, err
+	}
+
+	submaps := toSubmaps(value)
+
+	status = C.viam_carto_get_submap_list_response_destroy(&value)
+	if err := toError(status); err != nil {
+		return nil, err
+	}
+
+	return submaps, nil
+}
+
+// submap is a wrapper for viam_carto_get_submap
+func (vc *Carto) submap(id SubmapID) (SubmapPointCloud, error) {
+	req := C.viam_carto_get_submap_request{
+		trajectory_id: C.int(id.TrajectoryID),
+		submap_index:  C.int(id.SubmapIndex),
+	}
+	value := C.viam_carto_get_submap_response{}
+
+	status := C.viam_carto_get_submap(vc.value, &req, &value)
+
+	if err := toError(status); err != nil {
+		return SubmapPointCloud{}, err
+	}
+
+	submap := toSubmapPointCloud(value)
+
+	status = C.viam_carto_get_submap_response_destroy(&value)
+	if err := toError(status); err != nil {
+		return SubmapPointCloud{}, err
+	}
+
+	return submap, nil
+}
+
+// slamStats is a wrapper for viam_carto_get_slam_stats
+func (vc *Carto) slamStats() (SlamStats, error) {
+	value := C.viam_carto_get_slam_stats_response{}
+
+	status := C.viam_carto_get_slam_stats(vc.value, &value)
+
+	if err := toError(status); err != nil {
+		return SlamStats{}, err
+	}
+
+	return toSlamStats(value), nil
+}
+
+// freezeTrajectory is a wrapper for viam_carto_freeze_trajectory
+func (vc *Carto) freezeTrajectory(id int) error {
+	return toError(C.viam_carto_freeze_trajectory(vc.value, C.int(id)))
+}
+
+// restartTrajectory is a wrapper for viam_carto_restart_trajectory
+func (vc *Carto) restartTrajectory(initialPose *TrajectoryPose) (RestartedTrajectory, error) {
+	req := toRestartTrajectoryRequest(initialPose)
+	value := C.viam_carto_restart_trajectory_response{}
+
+	status := C.viam_carto_restart_trajectory(vc.value, &req, &value)
+
+	if err := toError(status); err != nil {
+		return RestartedTrajectory{}, err
+	}
+
+	return RestartedTrajectory{
+		RestartedTrajectoryID: int(value.restarted_trajectory_id),
+		TrajectoryID:          int(value.trajectory_id),
+	}, nil
+}
+
+// setSlamMode is a wrapper for viam_carto_set_slam_mode
+func (vc *Carto) setSlamMode(mode SlamMode) error {
+	status := C.viam_carto_set_slam_mode(vc.value, toCSlamMode(mode))
+
+	if err := toError(status); err != nil {
+		return err
+	}
+
+	vc.SlamMode = mode
+	return nil
+}
+
 // getTestPositionResponse is only used for testing purposes, but needs to be in this file
 // as CGo is not supported in go test files
 func getTestPositionResponse() C.viam_carto_get_position_response {
@@ -354,10 +1101,50 @@ func getTestPositionResponse() C.viam_carto_get_position_response {
 	gpr.kmag = C.double(900)
 
 	gpr.real = C.double(1100)
+	gpr.confidence = C.double(0.75)
 
 	return gpr
 }
 
+// getTestTrajectoryNodes is only used for testing purposes, but needs to be in this file
+// as CGo is not supported in go test files. It converts a response of two nodes.
+func getTestTrajectoryNodes() []TrajectoryNode {
+	nodes := []C.viam_carto_trajectory_node{
+		{trajectory_id: 0, time_unix_milli: 1000, x: 100, y: 200, z: 300, real: 1},
+		{trajectory_id: 1, time_unix_milli: 2500, x: -100, y: 0, z: 0, real: 0.5, imag: 0.5, jmag: 0.5, kmag: 0.5},
+	}
+	gtr := C.viam_carto_get_trajectory_response{nodes: &nodes[0], num_nodes: C.int(len(nodes))}
+	return toTrajectoryNodes(gtr)
+}
+
+// getTestSubmaps is only used for testing purposes, but needs to be in this file
+// as CGo is not supported in go test files. It converts a submap list response of two submaps.
+func getTestSubmaps() []Submap {
+	submaps := []C.viam_carto_submap{
+		{trajectory_id: 0, submap_index: 0, version: 180, x: 100, y: 200, z: 300, real: 1},
+		{trajectory_id: 1, submap_index: 3, version: 20, x: -100, real: 0.5, imag: 0.5, jmag: 0.5, kmag: 0.5},
+	}
+	gslr := C.viam_carto_get_submap_list_response{submaps: &submaps[0], num_submaps: C.int(len(submaps))}
+	return toSubmaps(gslr)
+}
+
+// getTestSubmapPointCloud is only used for testing purposes, but needs to be in this file
+// as CGo is not supported in go test files. It converts a submap response holding pcd.
+func getTestSubmapPointCloud(pcd string) SubmapPointCloud {
+	gsr := C.viam_carto_get_submap_response{
+		submap:          C.viam_carto_submap{trajectory_id: 2, submap_index: 1, version: 40, y: 50, real: 1},
+		point_cloud_pcd: goStringToBstring(pcd),
+	}
+	defer C.bdestroy(gsr.point_cloud_pcd)
+	return toSubmapPointCloud(gsr)
+}
+
+// flushStdout flushes the C stdout buffer cartographer logs to. It is only used for testing purposes, but
+// needs to be in this file as CGo is not supported in go test files.
+func flushStdout() {
+	C.flush_stdout()
+}
+
 func bstringToGoString(bstr C.bstring) string {
 	return C.GoStringN(C.bstr2cstr(bstr, 0), bstr.slen)
 }
@@ -368,6 +1155,38 @@ func goStringToBstring(goStr string) C.bstring {
 	return C.blk2bstr(unsafe.Pointer(cstr), C.int(len(goStr)))
 }
 
+// goStringsToBstrList returns a bstrList holding the given strings, or nil if there are none.
+func goStringsToBstrList(goStrs []string) (*C.struct_bstrList, error) {
+	if len(goStrs) == 0 {
+		return nil, nil
+	}
+	list := C.bstrListCreate()
+	if list == nil {
+		return nil, errors.New("unable to allocate bstrList")
+	}
+	if C.bstrListAlloc(list, C.int(len(goStrs))) != C.BSTR_OK {
+		C.bstrListDestroy(list)
+		return nil, errors.New("unable to allocate bstrList")
+	}
+	entries := unsafe.Slice(list.entry, len(goStrs))
+	for i, goStr := range goStrs {
+		entries[i] = goStringToBstring(goStr)
+	}
+	list.qty = C.int(len(goStrs))
+	return list, nil
+}
+
+func bstrListToGoStrings(list *C.struct_bstrList) []string {
+	if list == nil || list.qty == 0 {
+		return nil
+	}
+	goStrs := []string{}
+	for _, entry := range unsafe.Slice(list.entry, int(list.qty)) {
+		goStrs = append(goStrs, bstringToGoString(entry))
+	}
+	return goStrs
+}
+
 func toLidarConfig(lidarConfig LidarConfig) (C.viam_carto_LIDAR_CONFIG, error) {
 	switch lidarConfig {
 	case TwoD:
@@ -379,6 +1198,43 @@ func toLidarConfig(lidarConfig LidarConfig) (C.viam_carto_LIDAR_CONFIG, error) {
 	}
 }
 
+func fromLidarConfig(lidarConfig C.viam_carto_LIDAR_CONFIG) (LidarConfig, error) {
+	switch lidarConfig {
+	case C.VIAM_CARTO_TWO_D:
+		return TwoD, nil
+	case C.VIAM_CARTO_THREE_D:
+		return ThreeD, nil
+	default:
+		return 0, errors.New("invalid lidar config value")
+	}
+}
+
+func toSensorStreams(sensorStreams SensorStreams) (C.viam_carto_SENSOR_STREAMS, error) {
+	switch sensorStreams {
+	case SensorStreamsUnspecified:
+		return C.VIAM_CARTO_SENSOR_STREAMS_UNSPECIFIED, nil
+	case LidarOnly:
+		return C.VIAM_CARTO_LIDAR_ONLY, nil
+	case LidarAndMovementSensor:
+		return C.VIAM_CARTO_LIDAR_AND_MOVEMENT_SENSOR, nil
+	default:
+		return 0, errors.New("invalid sensor streams value")
+	}
+}
+
+func fromSensorStreams(sensorStreams C.viam_carto_SENSOR_STREAMS) (SensorStreams, error) {
+	switch sensorStreams {
+	case C.VIAM_CARTO_SENSOR_STREAMS_UNSPECIFIED:
+		return SensorStreamsUnspecified, nil
+	case C.VIAM_CARTO_LIDAR_ONLY:
+		return LidarOnly, nil
+	case C.VIAM_CARTO_LIDAR_AND_MOVEMENT_SENSOR:
+		return LidarAndMovementSensor, nil
+	default:
+		return 0, errors.New("invalid sensor streams value")
+	}
+}
+
 func getConfig(cfg CartoConfig) (C.viam_carto_config, error) {
 	vcc := C.viam_carto_config{}
 	vcc.camera = goStringToBstring(cfg.Camera)
@@ -391,12 +1247,52 @@ func getConfig(cfg CartoConfig) (C.viam_carto_config, error) {
 
 	vcc.lidar_config = lidarCfg
 
+	sensorStreams, err := toSensorStreams(cfg.SensorStreams)
+	if err != nil {
+		return C.viam_carto_config{}, err
+	}
+	vcc.sensor_streams = sensorStreams
+
 	vcc.enable_mapping = C.bool(cfg.EnableMapping)
 	vcc.existing_map = goStringToBstring(cfg.ExistingMap)
+	vcc.floor_plan = goStringToBstring(string(cfg.FloorPlan))
+	vcc.floor_plan_resolution = C.double(cfg.FloorPlanResolution)
+
+	additionalCameras, err := goStringsToBstrList(cfg.AdditionalCameras)
+	if err != nil {
+		return C.viam_carto_config{}, err
+	}
+	vcc.additional_cameras = additionalCameras
 
 	return vcc, nil
 }
 
+// fromConfig is the inverse of getConfig. Cartographer never hands a config back, it exists so that the tests
+// can verify that getConfig converts every field of CartoConfig.
+func fromConfig(vcc C.viam_carto_config) (CartoConfig, error) {
+	lidarCfg, err := fromLidarConfig(vcc.lidar_config)
+	if err != nil {
+		return CartoConfig{}, err
+	}
+	sensorStreams, err := fromSensorStreams(vcc.sensor_streams)
+	if err != nil {
+		return CartoConfig{}, err
+	}
+
+	return CartoConfig{
+		Camera:         bstringToGoString(vcc.camera),
+		MovementSensor: bstringToGoString(vcc.movement_sensor),
+		LidarConfig:    lidarCfg,
+
+		EnableMapping:       bool(vcc.enable_mapping),
+		ExistingMap:         bstringToGoString(vcc.existing_map),
+		FloorPlan:           bstringToByteSlice(vcc.floor_plan),
+		FloorPlanResolution: float64(vcc.floor_plan_resolution),
+		AdditionalCameras:   bstrListToGoStrings(vcc.additional_cameras),
+		SensorStreams:       sensorStreams,
+	}, nil
+}
+
 func toAlgoConfig(acfg CartoAlgoConfig) C.viam_carto_algo_config {
 	vcac := C.viam_carto_algo_config{}
 
@@ -421,10 +1317,128 @@ func toAlgoConfig(acfg CartoAlgoConfig) C.viam_carto_algo_config {
 	vcac.initial_trajectory_pose_x = C.double(acfg.InitialTrajectoryPoseX)
 	vcac.initial_trajectory_pose_y = C.double(acfg.InitialTrajectoryPoseY)
 	vcac.initial_trajectory_pose_theta = C.double(acfg.InitialTrajectoryPoseTheta)
+	vcac.has_initial_trajectory_pose_sigma = C.bool(acfg.HasInitialTrajectoryPoseSigma)
+	vcac.initial_trajectory_pose_sigma_x = C.double(acfg.InitialTrajectoryPoseSigmaX)
+	vcac.initial_trajectory_pose_sigma_y = C.double(acfg.InitialTrajectoryPoseSigmaY)
+	vcac.initial_trajectory_pose_sigma_theta = C.double(acfg.InitialTrajectoryPoseSigmaTheta)
+
+	vcac.final_optimization_iterations = C.int(acfg.FinalOptimizationIterations)
 
 	return vcac
 }
 
+func fromAlgoConfig(vcac C.viam_carto_algo_config) CartoAlgoConfig {
+	return CartoAlgoConfig{
+		// Cartographer tuning parameters
+		OptimizeOnStart:      bool(vcac.optimize_on_start),
+		OptimizeEveryNNodes:  int(vcac.optimize_every_n_nodes),
+		NumRangeData:         int(vcac.num_range_data),
+		MissingDataRayLength: float32(vcac.missing_data_ray_length),
+		MaxRange:             float32(vcac.max_range),
+		MinRange:             float32(vcac.min_range),
+		UseIMUData:           bool(vcac.use_imu_data),
+		MaxSubmapsToKeep:     int(vcac.max_submaps_to_keep),
+		FreshSubmapsCount:    int(vcac.fresh_submaps_count),
+		MinCoveredArea:       float64(vcac.min_covered_area),
+		MinAddedSubmapsCount: int(vcac.min_added_submaps_count),
+		OccupiedSpaceWeight:  float64(vcac.occupied_space_weight),
+		TranslationWeight:    float64(vcac.translation_weight),
+		RotationWeight:       float64(vcac.rotation_weight),
+
+		// Values used to define starting position
+		HasInitialTrajectoryPose:   bool(vcac.has_initial_trajectory_pose),
+		InitialTrajectoryPoseX:     float64(vcac.initial_trajectory_pose_x),
+		InitialTrajectoryPoseY:     float64(vcac.initial_trajectory_pose_y),
+		InitialTrajectoryPoseTheta: float64(vcac.initial_trajectory_pose_theta),
+
+		HasInitialTrajectoryPoseSigma:   bool(vcac.has_initial_trajectory_pose_sigma),
+		InitialTrajectoryPoseSigmaX:     float64(vcac.initial_trajectory_pose_sigma_x),
+		InitialTrajectoryPoseSigmaY:     float64(vcac.initial_trajectory_pose_sigma_y),
+		InitialTrajectoryPoseSigmaTheta: float64(vcac.initial_trajectory_pose_sigma_theta),
+
+		FinalOptimizationIterations: int(vcac.final_optimization_iterations),
+	}
+}
+
+func toTrajectories(value C.viam_carto_get_trajectories_response) []Trajectory {
+	trajectories := make([]Trajectory, 0, int(value.num_trajectories))
+	if value.num_trajectories == 0 {
+		return trajectories
+	}
+	for _, t := range unsafe.Slice(value.trajectories, int(value.num_trajectories)) {
+		trajectories = append(trajectories, Trajectory{ID: int(t.trajectory_id), State: toTrajectoryState(t.state)})
+	}
+	return trajectories
+}
+
+func toTrajectoryNodes(value C.viam_carto_get_trajectory_response) []TrajectoryNode {
+	nodes := make([]TrajectoryNode, 0, int(value.num_nodes))
+	if value.num_nodes == 0 {
+		return nodes
+	}
+	for _, n := range unsafe.Slice(value.nodes, int(value.num_nodes)) {
+		nodes = append(nodes, TrajectoryNode{
+			TrajectoryID: int(n.trajectory_id),
+			Time:         time.UnixMilli(int64(n.time_unix_milli)),
+			Pose: spatialmath.NewPose(
+				r3.Vector{X: float64(n.x), Y: float64(n.y), Z: float64(n.z)},
+				&spatialmath.Quaternion{Real: float64(n.real), Imag: float64(n.imag), Jmag: float64(n.jmag), Kmag: float64(n.kmag)},
+			),
+		})
+	}
+	return nodes
+}
+
+func toSubmaps(value C.viam_carto_get_submap_list_response) []Submap {
+	submaps := make([]Submap, 0, int(value.num_submaps))
+	if value.num_submaps == 0 {
+		return submaps
+	}
+	for _, s := range unsafe.Slice(value.submaps, int(value.num_submaps)) {
+		submaps = append(submaps, toSubmap(s))
+	}
+	return submaps
+}
+
+func toSubmap(s C.viam_carto_submap) Submap {
+	return Submap{
+		ID:      SubmapID{TrajectoryID: int(s.trajectory_id), SubmapIndex: int(s.submap_index)},
+		Version: int(s.version),
+		Pose: spatialmath.NewPose(
+			r3.Vector{X: float64(s.x), Y: float64(s.y), Z: float64(s.z)},
+			&spatialmath.Quaternion{Real: float64(s.real), Imag: float64(s.imag), Jmag: float64(s.jmag), Kmag: float64(s.kmag)},
+		),
+	}
+}
+
+func toSubmapPointCloud(value C.viam_carto_get_submap_response) SubmapPointCloud {
+	return SubmapPointCloud{
+		Submap:     toSubmap(value.submap),
+		PointCloud: bstringToByteSlice(value.point_cloud_pcd),
+	}
+}
+
+func toSlamStats(value C.viam_carto_get_slam_stats_response) SlamStats {
+	return SlamStats{
+		NumNodes:                 int(value.num_nodes),
+		NumUnoptimizedNodes:      int(value.num_unoptimized_nodes),
+		OldestUnoptimizedNodeAge: time.Duration(float64(value.oldest_unoptimized_node_age_sec) * float64(time.Second)),
+	}
+}
+
+func toTrajectoryState(cState C.int) TrajectoryState {
+	switch cState {
+	case C.VIAM_CARTO_TRAJECTORY_STATE_ACTIVE:
+		return TrajectoryActive
+	case C.VIAM_CARTO_TRAJECTORY_STATE_FINISHED:
+		return TrajectoryFinished
+	case C.VIAM_CARTO_TRAJECTORY_STATE_FROZEN:
+		return TrajectoryFrozen
+	default:
+		return TrajectoryDeleted
+	}
+}
+
 func toPositionResponse(value C.viam_carto_get_position_response) Position {
 	return Position{
 		X: float64(value.x),
@@ -435,6 +1449,8 @@ func toPositionResponse(value C.viam_carto_get_position_response) Position {
 		Imag: float64(value.imag),
 		Jmag: float64(value.jmag),
 		Kmag: float64(value.kmag),
+
+		Confidence: float64(value.confidence),
 	}
 }
 
@@ -450,6 +1466,17 @@ func toLidarReading(lidar string, reading s.TimedLidarReadingResponse) C.viam_ca
 	return sr
 }
 
+func toRestartTrajectoryRequest(initialPose *TrajectoryPose) C.viam_carto_restart_trajectory_request {
+	req := C.viam_carto_restart_trajectory_request{}
+	if initialPose != nil {
+		req.has_initial_pose = C.bool(true)
+		req.initial_pose_x = C.double(initialPose.X)
+		req.initial_pose_y = C.double(initialPose.Y)
+		req.initial_pose_theta = C.double(initialPose.Theta)
+	}
+	return req
+}
+
 func toIMUReading(movementSensor string, reading s.TimedIMUReadingResponse) C.viam_carto_imu_reading {
 	sr := C.viam_carto_imu_reading{}
 	sensorCStr := C.CString(movementSensor)
@@ -467,15 +1494,26 @@ func toIMUReading(movementSensor string, reading s.TimedIMUReadingResponse) C.vi
 	return sr
 }
 
-func toOdometerReading(movementSensor string, reading s.TimedOdometerReadingResponse) C.viam_carto_odometer_reading {
+func toOdometerReading(movementSensor string, reading s.TimedOdometerReadingResponse) (C.viam_carto_odometer_reading, error) {
+	if reading.Position == nil || reading.Orientation == nil {
+		return C.viam_carto_odometer_reading{}, errOdometerReadingMissing
+	}
+	translation := spatialmath.GeoPointToPoint(reading.Position, geo.NewPoint(0, 0))
+	for _, component := range []float64{translation.X, translation.Y, translation.Z} {
+		if math.IsNaN(component) || math.IsInf(component, 0) {
+			return C.viam_carto_odometer_reading{}, errOdometerReadingNotFinite
+		}
+	}
+	rotation, err := s.NormalizeOrientation(reading.Orientation)
+	if err != nil {
+		return C.viam_carto_odometer_reading{}, err
+	}
+
 	sr := C.viam_carto_odometer_reading{}
 	sensorCStr := C.CString(movementSensor)
 	defer C.free(unsafe.Pointer(sensorCStr))
 	sr.odometer = C.blk2bstr(unsafe.Pointer(sensorCStr), C.int(len(movementSensor)))
 
-	translation := spatialmath.GeoPointToPoint(reading.Position, geo.NewPoint(0, 0))
-	rotation := reading.Orientation.Quaternion()
-
 	sr.translation_x = C.double(translation.X)
 	sr.translation_y = C.double(translation.Y)
 	sr.translation_z = C.double(translation.Z)
@@ -485,7 +1523,7 @@ func toOdometerReading(movementSensor string, reading s.TimedOdometerReadingResp
 	sr.rotation_w = C.double(rotation.Real)
 
 	sr.odometer_reading_time_unix_milli = C.int64_t(reading.ReadingTime.UnixMilli())
-	return sr
+	return sr, nil
 }
 
 func bstringToByteSlice(bstr C.bstring) []byte {
@@ -525,15 +1563,15 @@ func toError(status C.int) error {
 	case C.VIAM_CARTO_UNKNOWN_SENSOR_NAME:
 		return errors.New("VIAM_CARTO_UNKNOWN_SENSOR_NAME")
 	case C.VIAM_CARTO_LIDAR_READING_EMPTY:
-		return errors.New("VIAM_CARTO_LIDAR_READING_EMPTY")
+		return ErrLidarReadingEmpty
 	case C.VIAM_CARTO_LIDAR_READING_INVALID:
-		return errors.New("VIAM_CARTO_LIDAR_READING_INVALID")
+		return ErrLidarReadingInvalid
 	case C.VIAM_CARTO_GET_POSITION_RESPONSE_INVALID:
 		return errors.New("VIAM_CARTO_GET_POSITION_RESPONSE_INVALID")
 	case C.VIAM_CARTO_GET_POSITION_NOT_INITIALIZED:
 		return errors.New("VIAM_CARTO_GET_POSITION_NOT_INITIALIZED")
 	case C.VIAM_CARTO_POINTCLOUD_MAP_EMPTY:
-		return errors.New("VIAM_CARTO_POINTCLOUD_MAP_EMPTY")
+		return ErrPointCloudMapEmpty
 	case C.VIAM_CARTO_GET_POINT_CLOUD_MAP_RESPONSE_INVALID:
 		return errors.New("VIAM_CARTO_GET_POINT_CLOUD_MAP_RESPONSE_INVALID")
 	case C.VIAM_CARTO_LIB_ALREADY_INITIALIZED:
@@ -553,13 +1591,67 @@ func toError(status C.int) error {
 	case C.VIAM_CARTO_NOT_IN_TERMINATABLE_STATE:
 		return errors.New("VIAM_CARTO_NOT_IN_TERMINATABLE_STATE")
 	case C.VIAM_CARTO_IMU_PROVIDED_AND_IMU_ENABLED_MISMATCH:
-		return errors.New("VIAM_CARTO_IMU_PROVIDED_AND_IMU_ENABLED_MISMATCH")
+		return ErrIMUProvidedAndIMUEnabledMismatch
 	case C.VIAM_CARTO_IMU_READING_EMPTY:
-		return errors.New("VIAM_CARTO_IMU_READING_EMPTY")
+		return ErrIMUReadingEmpty
 	case C.VIAM_CARTO_IMU_READING_INVALID:
-		return errors.New("VIAM_CARTO_IMU_READING_INVALID")
+		return ErrIMUReadingInvalid
 	case C.VIAM_CARTO_ODOMETER_READING_INVALID:
-		return errors.New("VIAM_CARTO_ODOMETER_READING_INVALID")
+		return ErrOdometerReadingInvalid
+	case C.VIAM_CARTO_GET_ALGO_CONFIG_RESPONSE_INVALID:
+		return errors.New("VIAM_CARTO_GET_ALGO_CONFIG_RESPONSE_INVALID")
+	case C.VIAM_CARTO_START_NEW_TRAJECTORY_RESPONSE_INVALID:
+		return errors.New("VIAM_CARTO_START_NEW_TRAJECTORY_RESPONSE_INVALID")
+	case C.VIAM_CARTO_GET_TRAJECTORIES_RESPONSE_INVALID:
+		return errors.New("VIAM_CARTO_GET_TRAJECTORIES_RESPONSE_INVALID")
+	case C.VIAM_CARTO_LOG_LEVEL_INVALID:
+		return errors.New("VIAM_CARTO_LOG_LEVEL_INVALID")
+	case C.VIAM_CARTO_MEMORY_USAGE_UNAVAILABLE:
+		return ErrMemoryUsageUnavailable
+	case C.VIAM_CARTO_GET_MEMORY_USAGE_RESPONSE_INVALID:
+		return errors.New("VIAM_CARTO_GET_MEMORY_USAGE_RESPONSE_INVALID")
+	case C.VIAM_CARTO_GET_SLAM_STATS_RESPONSE_INVALID:
+		return errors.New("VIAM_CARTO_GET_SLAM_STATS_RESPONSE_INVALID")
+	case C.VIAM_CARTO_FLOOR_PLAN_INVALID:
+		return ErrFloorPlanInvalid
+	case C.VIAM_CARTO_INTERNAL_STATE_VERSION_UNAVAILABLE:
+		return ErrInternalStateVersionUnavailable
+	case C.VIAM_CARTO_GET_INTERNAL_STATE_VERSION_RESPONSE_INVALID:
+		return errors.New("VIAM_CARTO_GET_INTERNAL_STATE_VERSION_RESPONSE_INVALID")
+	case C.VIAM_CARTO_INTERNAL_STATE_INVALID:
+		return errors.New("VIAM_CARTO_INTERNAL_STATE_INVALID")
+	case C.VIAM_CARTO_INTERNAL_STATE_MIGRATION_UNSUPPORTED:
+		return ErrInternalStateMigrationUnsupported
+	case C.VIAM_CARTO_INTERNAL_STATE_MIGRATION_FAILED:
+		return errors.New("VIAM_CARTO_INTERNAL_STATE_MIGRATION_FAILED")
+	case C.VIAM_CARTO_GET_TRAJECTORY_RESPONSE_INVALID:
+		return errors.New("VIAM_CARTO_GET_TRAJECTORY_RESPONSE_INVALID")
+	case C.VIAM_CARTO_SENSOR_STREAMS_INVALID:
+		return errors.New("VIAM_CARTO_SENSOR_STREAMS_INVALID")
+	case C.VIAM_CARTO_GET_SUBMAP_LIST_RESPONSE_INVALID:
+		return errors.New("VIAM_CARTO_GET_SUBMAP_LIST_RESPONSE_INVALID")
+	case C.VIAM_CARTO_GET_SUBMAP_RESPONSE_INVALID:
+		return errors.New("VIAM_CARTO_GET_SUBMAP_RESPONSE_INVALID")
+	case C.VIAM_CARTO_SUBMAP_NOT_FOUND:
+		return ErrSubmapNotFound
+	case C.VIAM_CARTO_TRAJECTORY_NOT_FOUND:
+		return ErrTrajectoryNotFound
+	case C.VIAM_CARTO_TRAJECTORY_ACTIVE:
+		return ErrTrajectoryActive
+	case C.VIAM_CARTO_NOT_LOCALIZING:
+		return ErrNotLocalizing
+	case C.VIAM_CARTO_INTERNAL_STATE_STREAM_UNAVAILABLE:
+		return ErrInternalStateStreamUnavailable
+	case C.VIAM_CARTO_INTERNAL_STATE_STREAM_INVALID:
+		return errors.New("VIAM_CARTO_INTERNAL_STATE_STREAM_INVALID")
+	case C.VIAM_CARTO_GET_INTERNAL_STATE_CHUNK_RESPONSE_INVALID:
+		return errors.New("VIAM_CARTO_GET_INTERNAL_STATE_CHUNK_RESPONSE_INVALID")
+	case C.VIAM_CARTO_INITIAL_OPTIMIZATION_ALREADY_STARTED:
+		return ErrInitialOptimizationAlreadyStarted
+	case C.VIAM_CARTO_ABI_UNAVAILABLE:
+		return ErrIncompatibleLibrary
+	case C.VIAM_CARTO_GET_ABI_RESPONSE_INVALID:
+		return errors.New("VIAM_CARTO_GET_ABI_RESPONSE_INVALID")
 	default:
 		return errors.New("status code unclassified")
 	}
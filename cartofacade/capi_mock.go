@@ -8,7 +8,14 @@ import (
 // CartoLibMock represents a fake instance of cartofacade.
 type CartoLibMock struct {
 	CartoLib
-	TerminateFunc func() error
+	TerminateFunc   func() error
+	SetLogLevelFunc func(minloglevel, verbose int) error
+	LogLevelFunc    func() (minloglevel, verbose int)
+	MemoryUsageFunc func() (uint64, error)
+
+	InternalStateVersionFunc func(path string) (InternalStateVersion, error)
+	MigrateInternalStateFunc func(src, dst string) error
+	CapabilitiesFunc         func() Capabilities
 }
 
 // Terminate calls the injected TerminateFunc or the real version.
@@ -19,19 +26,82 @@ func (cf *CartoLibMock) Terminate() error {
 	return cf.TerminateFunc()
 }
 
+// SetLogLevel calls the injected SetLogLevelFunc or the real version.
+func (cf *CartoLibMock) SetLogLevel(minloglevel, verbose int) error {
+	if cf.SetLogLevelFunc == nil {
+		return cf.CartoLib.SetLogLevel(minloglevel, verbose)
+	}
+	return cf.SetLogLevelFunc(minloglevel, verbose)
+}
+
+// LogLevel calls the injected LogLevelFunc or the real version.
+func (cf *CartoLibMock) LogLevel() (minloglevel, verbose int) {
+	if cf.LogLevelFunc == nil {
+		return cf.CartoLib.LogLevel()
+	}
+	return cf.LogLevelFunc()
+}
+
+// MemoryUsage calls the injected MemoryUsageFunc or the real version.
+func (cf *CartoLibMock) MemoryUsage() (uint64, error) {
+	if cf.MemoryUsageFunc == nil {
+		return cf.CartoLib.MemoryUsage()
+	}
+	return cf.MemoryUsageFunc()
+}
+
+// InternalStateVersion calls the injected InternalStateVersionFunc or the real version.
+func (cf *CartoLibMock) InternalStateVersion(path string) (InternalStateVersion, error) {
+	if cf.InternalStateVersionFunc == nil {
+		return cf.CartoLib.InternalStateVersion(path)
+	}
+	return cf.InternalStateVersionFunc(path)
+}
+
+// MigrateInternalState calls the injected MigrateInternalStateFunc or the real version.
+func (cf *CartoLibMock) MigrateInternalState(src, dst string) error {
+	if cf.MigrateInternalStateFunc == nil {
+		return cf.CartoLib.MigrateInternalState(src, dst)
+	}
+	return cf.MigrateInternalStateFunc(src, dst)
+}
+
+// Capabilities calls the injected CapabilitiesFunc or the real version.
+func (cf *CartoLibMock) Capabilities() Capabilities {
+	if cf.CapabilitiesFunc == nil {
+		return cf.CartoLib.Capabilities()
+	}
+	return cf.CapabilitiesFunc()
+}
+
 // CartoMock represents a fake instance of cartofacade.
 type CartoMock struct {
 	Carto
-	StartFunc                func() error
-	StopFunc                 func() error
-	TerminateFunc            func() error
-	AddLidarReadingFunc      func(string, s.TimedLidarReadingResponse) error
-	AddIMUReadingFunc        func(string, s.TimedIMUReadingResponse) error
-	AddOdometerReadingFunc   func(string, s.TimedOdometerReadingResponse) error
-	PositionFunc             func() (Position, error)
-	PointCloudMapFunc        func() ([]byte, error)
-	InternalStateFunc        func() ([]byte, error)
-	RunFinalOptimizationFunc func() error
+	StartFunc                      func() error
+	StopFunc                       func() error
+	TerminateFunc                  func() error
+	AddLidarReadingFunc            func(string, s.TimedLidarReadingResponse) error
+	AddIMUReadingFunc              func(string, s.TimedIMUReadingResponse) error
+	AddOdometerReadingFunc         func(string, s.TimedOdometerReadingResponse) error
+	PositionFunc                   func() (Position, error)
+	PointCloudMapFunc              func() ([]byte, error)
+	InternalStateFunc              func() ([]byte, error)
+	InternalStateStreamFunc        func() (*internalStateStreamHandle, error)
+	InternalStateChunkFunc         func(*internalStateStreamHandle, int) ([]byte, error)
+	CloseInternalStateStreamFunc   func(*internalStateStreamHandle) error
+	RunFinalOptimizationFunc       func() error
+	StartInitialOptimizationFunc   func() error
+	InitialOptimizationRunningFunc func() (bool, error)
+	AlgoConfigFunc                 func() (CartoAlgoConfig, error)
+	StartNewTrajectoryFunc         func(*TrajectoryPose) (NewTrajectory, error)
+	FreezeTrajectoryFunc           func(int) error
+	RestartTrajectoryFunc          func(*TrajectoryPose) (RestartedTrajectory, error)
+	TrajectoriesFunc               func() ([]Trajectory, error)
+	TrajectoryFunc                 func() ([]TrajectoryNode, error)
+	SubmapListFunc                 func() ([]Submap, error)
+	SubmapFunc                     func(SubmapID) (SubmapPointCloud, error)
+	SlamStatsFunc                  func() (SlamStats, error)
+	SetSlamModeFunc                func(SlamMode) error
 }
 
 // start calls the injected StartFunc or the real version.
@@ -106,6 +176,30 @@ func (cf *CartoMock) internalState() ([]byte, error) {
 	return cf.InternalStateFunc()
 }
 
+// internalStateStream calls the injected InternalStateStreamFunc or the real version.
+func (cf *CartoMock) internalStateStream() (*internalStateStreamHandle, error) {
+	if cf.InternalStateStreamFunc == nil {
+		return cf.Carto.internalStateStream()
+	}
+	return cf.InternalStateStreamFunc()
+}
+
+// internalStateChunk calls the injected InternalStateChunkFunc or the real version.
+func (cf *CartoMock) internalStateChunk(stream *internalStateStreamHandle, maxSize int) ([]byte, error) {
+	if cf.InternalStateChunkFunc == nil {
+		return cf.Carto.internalStateChunk(stream, maxSize)
+	}
+	return cf.InternalStateChunkFunc(stream, maxSize)
+}
+
+// closeInternalStateStream calls the injected CloseInternalStateStreamFunc or the real version.
+func (cf *CartoMock) closeInternalStateStream(stream *internalStateStreamHandle) error {
+	if cf.CloseInternalStateStreamFunc == nil {
+		return cf.Carto.closeInternalStateStream(stream)
+	}
+	return cf.CloseInternalStateStreamFunc(stream)
+}
+
 // runFinalOptimization calls the injected RunFinalOptimization or the real version.
 func (cf *CartoMock) runFinalOptimization() error {
 	if cf.RunFinalOptimizationFunc == nil {
@@ -113,3 +207,99 @@ func (cf *CartoMock) runFinalOptimization() error {
 	}
 	return cf.RunFinalOptimizationFunc()
 }
+
+// startInitialOptimization calls the injected StartInitialOptimizationFunc or the real version.
+func (cf *CartoMock) startInitialOptimization() error {
+	if cf.StartInitialOptimizationFunc == nil {
+		return cf.Carto.startInitialOptimization()
+	}
+	return cf.StartInitialOptimizationFunc()
+}
+
+// initialOptimizationRunning calls the injected InitialOptimizationRunningFunc or the real version.
+func (cf *CartoMock) initialOptimizationRunning() (bool, error) {
+	if cf.InitialOptimizationRunningFunc == nil {
+		return cf.Carto.initialOptimizationRunning()
+	}
+	return cf.InitialOptimizationRunningFunc()
+}
+
+// algoConfig calls the injected AlgoConfigFunc or the real version.
+func (cf *CartoMock) algoConfig() (CartoAlgoConfig, error) {
+	if cf.AlgoConfigFunc == nil {
+		return cf.Carto.algoConfig()
+	}
+	return cf.AlgoConfigFunc()
+}
+
+// startNewTrajectory calls the injected StartNewTrajectoryFunc or the real version.
+func (cf *CartoMock) startNewTrajectory(initialPose *TrajectoryPose) (NewTrajectory, error) {
+	if cf.StartNewTrajectoryFunc == nil {
+		return cf.Carto.startNewTrajectory(initialPose)
+	}
+	return cf.StartNewTrajectoryFunc(initialPose)
+}
+
+// freezeTrajectory calls the injected FreezeTrajectoryFunc or the real version.
+func (cf *CartoMock) freezeTrajectory(id int) error {
+	if cf.FreezeTrajectoryFunc == nil {
+		return cf.Carto.freezeTrajectory(id)
+	}
+	return cf.FreezeTrajectoryFunc(id)
+}
+
+// restartTrajectory calls the injected RestartTrajectoryFunc or the real version.
+func (cf *CartoMock) restartTrajectory(initialPose *TrajectoryPose) (RestartedTrajectory, error) {
+	if cf.RestartTrajectoryFunc == nil {
+		return cf.Carto.restartTrajectory(initialPose)
+	}
+	return cf.RestartTrajectoryFunc(initialPose)
+}
+
+// trajectories calls the injected TrajectoriesFunc or the real version.
+func (cf *CartoMock) trajectories() ([]Trajectory, error) {
+	if cf.TrajectoriesFunc == nil {
+		return cf.Carto.trajectories()
+	}
+	return cf.TrajectoriesFunc()
+}
+
+// trajectory calls the injected TrajectoryFunc or the real version.
+func (cf *CartoMock) trajectory() ([]TrajectoryNode, error) {
+	if cf.TrajectoryFunc == nil {
+		return cf.Carto.trajectory()
+	}
+	return cf.TrajectoryFunc()
+}
+
+// submapList calls the injected SubmapListFunc or the real version.
+func (cf *CartoMock) submapList() ([]Submap, error) {
+	if cf.SubmapListFunc == nil {
+		return cf.Carto.submapList()
+	}
+	return cf.SubmapListFunc()
+}
+
+// submap calls the injected SubmapFunc or the real version.
+func (cf *CartoMock) submap(id SubmapID) (SubmapPointCloud, error) {
+	if cf.SubmapFunc == nil {
+		return cf.Carto.submap(id)
+	}
+	return cf.SubmapFunc(id)
+}
+
+// slamStats calls the injected SlamStatsFunc or the real version.
+func (cf *CartoMock) slamStats() (SlamStats, error) {
+	if cf.SlamStatsFunc == nil {
+		return cf.Carto.slamStats()
+	}
+	return cf.SlamStatsFunc()
+}
+
+// setSlamMode calls the injected SetSlamModeFunc or the real version.
+func (cf *CartoMock) setSlamMode(mode SlamMode) error {
+	if cf.SetSlamModeFunc == nil {
+		return cf.Carto.setSlamMode(mode)
+	}
+	return cf.SetSlamModeFunc(mode)
+}
@@ -2,17 +2,26 @@ package cartofacade
 
 import (
 	"bytes"
+	"context"
 	"errors"
+	"fmt"
+	"io"
+	"math"
 	"os"
+	"path/filepath"
+	"reflect"
 	"testing"
 	"time"
 
 	"github.com/golang/geo/r3"
 	geo "github.com/kellydunn/golang-geo"
+	"go.viam.com/rdk/logging"
 	"go.viam.com/rdk/pointcloud"
 	"go.viam.com/rdk/spatialmath"
+	rdkutils "go.viam.com/rdk/utils"
 	"go.viam.com/test"
 	"go.viam.com/utils/artifact"
+	"golang.org/x/sys/unix"
 
 	s "github.com/viam-modules/viam-cartographer/sensors"
 )
@@ -28,19 +37,71 @@ func positionIsZero(t *testing.T, position Position) {
 	test.That(t, position.Real, test.ShouldEqual, 1)
 }
 
-// confirm the pointcloud package still doesn't support binary compressed
-// pointclouds. If it does, we need to implement:
-// https://viam.atlassian.net/browse/RSDK-3753
-func confirmBinaryCompressedUnsupported(t *testing.T) {
-	file, err := os.Open(artifact.MustPath("viam-cartographer/mock_lidar/0.pcd"))
-	test.That(t, err, test.ShouldBeNil)
-	pc, err := pointcloud.ReadPCD(file)
-	test.That(t, err, test.ShouldBeNil)
+// fillNonZero sets every field of the struct ptr points to to a non-zero value that differs from the values of
+// the other fields of its kind, so that a conversion which drops or swaps a field can be detected.
+func fillNonZero(t *testing.T, ptr interface{}) {
+	t.Helper()
+	v := reflect.ValueOf(ptr).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Field(i)
+		name := v.Type().Field(i).Name
+		switch field.Kind() {
+		case reflect.Bool:
+			field.SetBool(true)
+		case reflect.Int, reflect.Int32, reflect.Int64:
+			field.SetInt(int64(i + 1))
+		case reflect.Float32, reflect.Float64:
+			field.SetFloat(float64(i) + 0.5)
+		case reflect.String:
+			field.SetString(name)
+		case reflect.Slice:
+			switch field.Type().Elem().Kind() {
+			case reflect.Uint8:
+				field.SetBytes([]byte(name))
+			case reflect.String:
+				field.Set(reflect.ValueOf([]string{name + "0", name + "1"}))
+			default:
+				t.Fatalf("fillNonZero does not support field %s of type %s", name, field.Type())
+			}
+		default:
+			t.Fatalf("fillNonZero does not support field %s of type %s", name, field.Type())
+		}
+	}
+}
 
-	buf := new(bytes.Buffer)
-	err = pointcloud.ToPCD(pc, buf, pointcloud.PCDCompressed)
-	test.That(t, err, test.ShouldBeError)
-	test.That(t, err.Error(), test.ShouldResemble, "compressed PCD not yet implemented")
+// unconvertedFields returns the names of the fields of the struct expected that are zero or differ in the struct
+// actual, i.e. the fields that a conversion of a struct filled by fillNonZero did not carry over.
+func unconvertedFields(expected, actual interface{}) []string {
+	expectedValue := reflect.ValueOf(expected)
+	actualValue := reflect.ValueOf(actual)
+	var unconverted []string
+	for i := 0; i < expectedValue.NumField(); i++ {
+		field := actualValue.Field(i)
+		if field.IsZero() || !reflect.DeepEqual(field.Interface(), expectedValue.Field(i).Interface()) {
+			unconverted = append(unconverted, expectedValue.Type().Field(i).Name)
+		}
+	}
+	return unconverted
+}
+
+func TestUnconvertedFields(t *testing.T) {
+	type config struct {
+		Name     string
+		Enabled  bool
+		Count    int
+		Scale    float64
+		Contents []byte
+	}
+	var cfg config
+	fillNonZero(t, &cfg)
+	test.That(t, cfg, test.ShouldResemble, config{Name: "Name", Enabled: true, Count: 3, Scale: 3.5, Contents: []byte("Contents")})
+	test.That(t, unconvertedFields(cfg, cfg), test.ShouldBeEmpty)
+
+	lossy := cfg
+	lossy.Enabled = false
+	lossy.Count = 4
+	lossy.Contents = nil
+	test.That(t, unconvertedFields(cfg, lossy), test.ShouldResemble, []string{"Enabled", "Count", "Contents"})
 }
 
 func testAddLidarReading(t *testing.T, vc Carto, pcdPath string, timestamp time.Time, pcdType pointcloud.PCDType) {
@@ -113,6 +174,70 @@ func TestGetConfig(t *testing.T) {
 
 		test.That(t, vcc.lidar_config, test.ShouldEqual, TwoD)
 	})
+
+	t.Run("config properly converted between C and go with a floor plan", func(t *testing.T) {
+		cfg := GetTestConfig("my-lidar", "", "", false)
+		cfg.FloorPlan = []byte("floor plan pcd")
+		cfg.FloorPlanResolution = 0.05
+		vcc, err := getConfig(cfg)
+		test.That(t, err, test.ShouldBeNil)
+
+		test.That(t, bstringToGoString(vcc.floor_plan), test.ShouldEqual, "floor plan pcd")
+		test.That(t, float64(vcc.floor_plan_resolution), test.ShouldEqual, 0.05)
+		test.That(t, bstringToGoString(vcc.existing_map), test.ShouldEqual, "")
+	})
+
+	t.Run("config properly converted between C and go with additional cameras", func(t *testing.T) {
+		cfg := GetTestConfig("my-lidar", "", "", true)
+		vcc, err := getConfig(cfg)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, vcc.additional_cameras, test.ShouldBeNil)
+
+		cfg.AdditionalCameras = []string{"rear-lidar", "side-lidar"}
+		vcc, err = getConfig(cfg)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, bstrListToGoStrings(vcc.additional_cameras), test.ShouldResemble, []string{"rear-lidar", "side-lidar"})
+	})
+
+	t.Run("the declared sensor streams are converted between C and go", func(t *testing.T) {
+		cfg := GetTestConfig("my-lidar", "", "", true)
+		for _, sensorStreams := range []SensorStreams{SensorStreamsUnspecified, LidarOnly, LidarAndMovementSensor} {
+			cfg.SensorStreams = sensorStreams
+			vcc, err := getConfig(cfg)
+			test.That(t, err, test.ShouldBeNil)
+			converted, err := fromConfig(vcc)
+			test.That(t, err, test.ShouldBeNil)
+			test.That(t, converted.SensorStreams, test.ShouldEqual, sensorStreams)
+		}
+
+		cfg.SensorStreams = 42
+		_, err := getConfig(cfg)
+		test.That(t, err, test.ShouldBeError, errors.New("invalid sensor streams value"))
+	})
+
+	t.Run("sensor names with spaces and slashes are converted between C and go as is", func(t *testing.T) {
+		cfg := GetTestConfig("front lidar", "cart:base/movement sensor", "", true)
+		cfg.AdditionalCameras = []string{"rear lidar", "cart:side/lidar"}
+		vcc, err := getConfig(cfg)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, bstringToGoString(vcc.camera), test.ShouldEqual, "front lidar")
+		test.That(t, bstringToGoString(vcc.movement_sensor), test.ShouldEqual, "cart:base/movement sensor")
+		test.That(t, bstrListToGoStrings(vcc.additional_cameras), test.ShouldResemble, []string{"rear lidar", "cart:side/lidar"})
+	})
+
+	t.Run("every field of the config is converted between C and go", func(t *testing.T) {
+		var cfg CartoConfig
+		fillNonZero(t, &cfg)
+		// TwoD is the zero value
+		cfg.LidarConfig = ThreeD
+		cfg.SensorStreams = LidarAndMovementSensor
+		vcc, err := getConfig(cfg)
+		test.That(t, err, test.ShouldBeNil)
+
+		converted, err := fromConfig(vcc)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, unconvertedFields(cfg, converted), test.ShouldBeEmpty)
+	})
 }
 
 func TestPositionResponse(t *testing.T) {
@@ -127,6 +252,104 @@ func TestPositionResponse(t *testing.T) {
 		test.That(t, holder.Jmag, test.ShouldEqual, 800)
 		test.That(t, holder.Kmag, test.ShouldEqual, 900)
 		test.That(t, holder.Real, test.ShouldEqual, 1100)
+		test.That(t, holder.Confidence, test.ShouldEqual, 0.75)
+	})
+}
+
+func TestTrajectoryNodes(t *testing.T) {
+	t.Run("trajectory response properly converted between C and go", func(t *testing.T) {
+		nodes := getTestTrajectoryNodes()
+		test.That(t, len(nodes), test.ShouldEqual, 2)
+
+		test.That(t, nodes[0].TrajectoryID, test.ShouldEqual, 0)
+		test.That(t, nodes[0].Time.Equal(time.UnixMilli(1000)), test.ShouldBeTrue)
+		test.That(t, spatialmath.PoseAlmostEqual(nodes[0].Pose,
+			spatialmath.NewPoseFromPoint(r3.Vector{X: 100, Y: 200, Z: 300})), test.ShouldBeTrue)
+
+		test.That(t, nodes[1].TrajectoryID, test.ShouldEqual, 1)
+		test.That(t, nodes[1].Time.Equal(time.UnixMilli(2500)), test.ShouldBeTrue)
+		test.That(t, nodes[1].Pose.Point(), test.ShouldResemble, r3.Vector{X: -100})
+		quat := nodes[1].Pose.Orientation().Quaternion()
+		test.That(t, quat.Real, test.ShouldAlmostEqual, 0.5)
+		test.That(t, quat.Imag, test.ShouldAlmostEqual, 0.5)
+		test.That(t, quat.Jmag, test.ShouldAlmostEqual, 0.5)
+		test.That(t, quat.Kmag, test.ShouldAlmostEqual, 0.5)
+	})
+}
+
+func TestSubmaps(t *testing.T) {
+	t.Run("submap list response properly converted between C and go", func(t *testing.T) {
+		submaps := getTestSubmaps()
+		test.That(t, len(submaps), test.ShouldEqual, 2)
+
+		test.That(t, submaps[0].ID, test.ShouldResemble, SubmapID{TrajectoryID: 0, SubmapIndex: 0})
+		test.That(t, submaps[0].Version, test.ShouldEqual, 180)
+		test.That(t, spatialmath.PoseAlmostEqual(submaps[0].Pose,
+			spatialmath.NewPoseFromPoint(r3.Vector{X: 100, Y: 200, Z: 300})), test.ShouldBeTrue)
+
+		test.That(t, submaps[1].ID, test.ShouldResemble, SubmapID{TrajectoryID: 1, SubmapIndex: 3})
+		test.That(t, submaps[1].Version, test.ShouldEqual, 20)
+		test.That(t, submaps[1].Pose.Point(), test.ShouldResemble, r3.Vector{X: -100})
+		quat := submaps[1].Pose.Orientation().Quaternion()
+		test.That(t, quat.Real, test.ShouldAlmostEqual, 0.5)
+		test.That(t, quat.Imag, test.ShouldAlmostEqual, 0.5)
+		test.That(t, quat.Jmag, test.ShouldAlmostEqual, 0.5)
+		test.That(t, quat.Kmag, test.ShouldAlmostEqual, 0.5)
+	})
+
+	t.Run("submap response properly converted between C and go", func(t *testing.T) {
+		pcd := "VERSION .7\nFIELDS x y z rgb\n\x00\x01binary"
+		submap := getTestSubmapPointCloud(pcd)
+		test.That(t, submap.ID, test.ShouldResemble, SubmapID{TrajectoryID: 2, SubmapIndex: 1})
+		test.That(t, submap.Version, test.ShouldEqual, 40)
+		test.That(t, spatialmath.PoseAlmostEqual(submap.Pose,
+			spatialmath.NewPoseFromPoint(r3.Vector{Y: 50})), test.ShouldBeTrue)
+		test.That(t, submap.PointCloud, test.ShouldResemble, []byte(pcd))
+	})
+}
+
+func TestFromAlgoConfig(t *testing.T) {
+	t.Run("algo config properly converted between C and go", func(t *testing.T) {
+		algoCfg := GetTestAlgoConfig(true)
+		algoCfg.HasInitialTrajectoryPose = true
+		algoCfg.InitialTrajectoryPoseX = 1
+		algoCfg.InitialTrajectoryPoseY = 2
+		algoCfg.InitialTrajectoryPoseTheta = 3
+
+		test.That(t, fromAlgoConfig(toAlgoConfig(algoCfg)), test.ShouldResemble, algoCfg)
+	})
+
+	t.Run("the standard deviations of the initial pose are converted between C and go", func(t *testing.T) {
+		algoCfg := GetTestAlgoConfig(false)
+		algoCfg.HasInitialTrajectoryPose = true
+		algoCfg.InitialTrajectoryPoseX = 1
+		algoCfg.InitialTrajectoryPoseY = 2
+		algoCfg.InitialTrajectoryPoseTheta = 3
+		algoCfg.HasInitialTrajectoryPoseSigma = true
+		algoCfg.InitialTrajectoryPoseSigmaX = 0.5
+		algoCfg.InitialTrajectoryPoseSigmaY = 0.25
+		algoCfg.InitialTrajectoryPoseSigmaTheta = 10
+
+		vcac := toAlgoConfig(algoCfg)
+		test.That(t, bool(vcac.has_initial_trajectory_pose_sigma), test.ShouldBeTrue)
+		test.That(t, float64(vcac.initial_trajectory_pose_sigma_x), test.ShouldEqual, 0.5)
+		test.That(t, fromAlgoConfig(vcac), test.ShouldResemble, algoCfg)
+	})
+
+	t.Run("the iterations of the final optimization are converted between C and go", func(t *testing.T) {
+		algoCfg := GetTestAlgoConfig(false)
+		test.That(t, int(toAlgoConfig(algoCfg).final_optimization_iterations), test.ShouldEqual, 0)
+
+		algoCfg.FinalOptimizationIterations = 20
+		vcac := toAlgoConfig(algoCfg)
+		test.That(t, int(vcac.final_optimization_iterations), test.ShouldEqual, 20)
+		test.That(t, fromAlgoConfig(vcac), test.ShouldResemble, algoCfg)
+	})
+
+	t.Run("every field of the algo config is converted between C and go", func(t *testing.T) {
+		var algoCfg CartoAlgoConfig
+		fillNonZero(t, &algoCfg)
+		test.That(t, unconvertedFields(algoCfg, fromAlgoConfig(toAlgoConfig(algoCfg))), test.ShouldBeEmpty)
 	})
 }
 
@@ -141,6 +364,29 @@ func TestToLidarReading(t *testing.T) {
 		test.That(t, bstringToGoString(sr.lidar), test.ShouldResemble, "my-lidar")
 		test.That(t, bstringToGoString(sr.lidar_reading), test.ShouldResemble, "he0llo")
 		test.That(t, sr.lidar_reading_time_unix_milli, test.ShouldEqual, timestamp.UnixMilli())
+
+		for _, name := range []string{"front lidar", "cart:front/lidar"} {
+			sr := toLidarReading(name, reading)
+			test.That(t, bstringToGoString(sr.lidar), test.ShouldEqual, name)
+		}
+	})
+}
+
+func TestToRestartTrajectoryRequest(t *testing.T) {
+	t.Run("a pose hint is marshaled into the request", func(t *testing.T) {
+		req := toRestartTrajectoryRequest(&TrajectoryPose{X: 1.5, Y: -2.25, Theta: 90})
+		test.That(t, bool(req.has_initial_pose), test.ShouldBeTrue)
+		test.That(t, float64(req.initial_pose_x), test.ShouldEqual, 1.5)
+		test.That(t, float64(req.initial_pose_y), test.ShouldEqual, -2.25)
+		test.That(t, float64(req.initial_pose_theta), test.ShouldEqual, 90)
+	})
+
+	t.Run("without a pose hint the request has no initial pose", func(t *testing.T) {
+		req := toRestartTrajectoryRequest(nil)
+		test.That(t, bool(req.has_initial_pose), test.ShouldBeFalse)
+		test.That(t, float64(req.initial_pose_x), test.ShouldEqual, 0)
+		test.That(t, float64(req.initial_pose_y), test.ShouldEqual, 0)
+		test.That(t, float64(req.initial_pose_theta), test.ShouldEqual, 0)
 	})
 }
 
@@ -162,19 +408,54 @@ func TestToIMUReading(t *testing.T) {
 		test.That(t, sr.ang_vel_z, test.ShouldEqual, reading.AngularVelocity.Z)
 		test.That(t, sr.imu_reading_time_unix_milli, test.ShouldEqual, timestamp.UnixMilli())
 	})
+
+	for _, tc := range []struct {
+		units          s.AngularVelocityUnits
+		expectedAngVel spatialmath.AngularVelocity
+	}{
+		{
+			units: s.DegreesPerSecond,
+			expectedAngVel: spatialmath.AngularVelocity{
+				X: rdkutils.DegToRad(s.TestAngVel.X),
+				Y: rdkutils.DegToRad(s.TestAngVel.Y),
+				Z: rdkutils.DegToRad(s.TestAngVel.Z),
+			},
+		},
+		{
+			units:          s.RadiansPerSecond,
+			expectedAngVel: s.TestAngVel,
+		},
+	} {
+		t.Run(fmt.Sprintf("IMU reading angular velocity reaches cartographer in radians per second from %s", tc.units),
+			func(t *testing.T) {
+				deps := s.SetupDeps(s.GoodLidar, s.GoodIMU)
+				ms, err := s.NewMovementSensor(context.Background(), deps, string(s.GoodIMU), 20, tc.units,
+					logging.NewTestLogger(t))
+				test.That(t, err, test.ShouldBeNil)
+				reading, err := ms.TimedMovementSensorReading(context.Background())
+				test.That(t, err, test.ShouldBeNil)
+
+				sr := toIMUReading(string(s.GoodIMU), *reading.TimedIMUResponse)
+				test.That(t, float64(sr.ang_vel_x), test.ShouldEqual, tc.expectedAngVel.X)
+				test.That(t, float64(sr.ang_vel_y), test.ShouldEqual, tc.expectedAngVel.Y)
+				test.That(t, float64(sr.ang_vel_z), test.ShouldEqual, tc.expectedAngVel.Z)
+			})
+	}
 }
 
 func TestToOdometerReading(t *testing.T) {
+	timestamp := time.Date(2021, 8, 15, 14, 30, 45, 100, time.UTC)
+
 	t.Run("odometer reading properly converted between c and go", func(t *testing.T) {
-		timestamp := time.Date(2021, 8, 15, 14, 30, 45, 100, time.UTC)
 		reading := s.TimedOdometerReadingResponse{
 			Position:    geo.NewPoint(4, 5),
-			Orientation: &spatialmath.Quaternion{Real: 0.8, Imag: -0.2, Jmag: 5.6, Kmag: -0.7},
+			Orientation: &spatialmath.Quaternion{Real: 0.8, Imag: -0.2, Jmag: 0.4, Kmag: -0.4},
 			ReadingTime: timestamp,
 		}
 		origin := geo.NewPoint(0, 0)
 		translation := spatialmath.GeoPointToPoint(reading.Position, origin)
-		sr := toOdometerReading("my-movement-sensor", reading)
+		sr, err := toOdometerReading("my-movement-sensor", reading)
+		test.That(t, err, test.ShouldBeNil)
 		test.That(t, bstringToGoString(sr.odometer), test.ShouldResemble, "my-movement-sensor")
 		test.That(t, sr.translation_x, test.ShouldEqual, translation.X)
 		test.That(t, sr.translation_y, test.ShouldEqual, translation.Y)
@@ -185,6 +466,55 @@ func TestToOdometerReading(t *testing.T) {
 		test.That(t, sr.rotation_w, test.ShouldEqual, reading.Orientation.Quaternion().Real)
 		test.That(t, sr.odometer_reading_time_unix_milli, test.ShouldEqual, timestamp.UnixMilli())
 	})
+
+	t.Run("denormalized odometer orientation is renormalized before being converted", func(t *testing.T) {
+		reading := s.TimedOdometerReadingResponse{
+			Position:    geo.NewPoint(4, 5),
+			Orientation: s.TestDenormalizedOrientation,
+			ReadingTime: timestamp,
+		}
+		sr, err := toOdometerReading("my-movement-sensor", reading)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, float64(sr.rotation_x), test.ShouldEqual, s.TestUnitOrientation.Imag)
+		test.That(t, float64(sr.rotation_y), test.ShouldEqual, s.TestUnitOrientation.Jmag)
+		test.That(t, float64(sr.rotation_z), test.ShouldEqual, s.TestUnitOrientation.Kmag)
+		test.That(t, float64(sr.rotation_w), test.ShouldEqual, s.TestUnitOrientation.Real)
+	})
+
+	t.Run("zero odometer orientation is rejected", func(t *testing.T) {
+		reading := s.TimedOdometerReadingResponse{
+			Position:    geo.NewPoint(4, 5),
+			Orientation: s.TestZeroOrientation,
+			ReadingTime: timestamp,
+		}
+		_, err := toOdometerReading("my-movement-sensor", reading)
+		test.That(t, err, test.ShouldBeError, s.ErrInvalidOrientation)
+	})
+
+	t.Run("odometer position with NaN values is rejected", func(t *testing.T) {
+		reading := s.TimedOdometerReadingResponse{
+			Position:    geo.NewPoint(math.NaN(), 5),
+			Orientation: s.TestOrientation,
+			ReadingTime: timestamp,
+		}
+		_, err := toOdometerReading("my-movement-sensor", reading)
+		test.That(t, err, test.ShouldBeError, errOdometerReadingNotFinite)
+	})
+
+	t.Run("odometer reading without a position or an orientation is rejected", func(t *testing.T) {
+		_, err := toOdometerReading("my-movement-sensor", s.TimedOdometerReadingResponse{
+			Orientation: s.TestOrientation,
+			ReadingTime: timestamp,
+		})
+		test.That(t, err, test.ShouldBeError, errOdometerReadingMissing)
+		test.That(t, IsReadingRejected(err), test.ShouldBeTrue)
+
+		_, err = toOdometerReading("my-movement-sensor", s.TimedOdometerReadingResponse{
+			Position:    geo.NewPoint(4, 5),
+			ReadingTime: timestamp,
+		})
+		test.That(t, err, test.ShouldBeError, errOdometerReadingMissing)
+	})
 }
 
 func TestBstringToByteSlice(t *testing.T) {
@@ -195,6 +525,131 @@ func TestBstringToByteSlice(t *testing.T) {
 	})
 }
 
+// captureStdout returns everything cartographer logged to stdout while f was running.
+func captureStdout(t *testing.T, f func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	test.That(t, err, test.ShouldBeNil)
+	stdout, err := unix.Dup(unix.Stdout)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, unix.Dup2(int(w.Fd()), unix.Stdout), test.ShouldBeNil)
+
+	output := make(chan []byte)
+	go func() {
+		out, _ := io.ReadAll(r)
+		output <- out
+	}()
+
+	f()
+	flushStdout()
+	test.That(t, unix.Dup2(stdout, unix.Stdout), test.ShouldBeNil)
+	test.That(t, unix.Close(stdout), test.ShouldBeNil)
+	test.That(t, w.Close(), test.ShouldBeNil)
+	out := <-output
+	test.That(t, r.Close(), test.ShouldBeNil)
+	return string(out)
+}
+
+func TestSetLogLevel(t *testing.T) {
+	// "Running in mapping mode" is logged at INFO and "slam mode:" at verbose level 1 by viam_carto_init
+	initCarto := func(pvcl *CartoLib) {
+		vc, err := NewCarto(GetTestConfig("my-lidar", "", "", true), GetTestAlgoConfig(false), pvcl)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, vc.terminate(), test.ShouldBeNil)
+	}
+
+	pvcl, err := NewLib(1, 0)
+	test.That(t, err, test.ShouldBeNil)
+	minloglevel, verbose := pvcl.LogLevel()
+	test.That(t, minloglevel, test.ShouldEqual, 1)
+	test.That(t, verbose, test.ShouldEqual, 0)
+
+	t.Run("info and verbose logs are dropped at warn level", func(t *testing.T) {
+		out := captureStdout(t, func() { initCarto(&pvcl) })
+		test.That(t, out, test.ShouldNotContainSubstring, "Running in mapping mode")
+		test.That(t, out, test.ShouldNotContainSubstring, "slam mode:")
+	})
+
+	t.Run("raising the verbosity at runtime takes effect immediately", func(t *testing.T) {
+		test.That(t, pvcl.SetLogLevel(0, 1), test.ShouldBeNil)
+		minloglevel, verbose := pvcl.LogLevel()
+		test.That(t, minloglevel, test.ShouldEqual, 0)
+		test.That(t, verbose, test.ShouldEqual, 1)
+
+		out := captureStdout(t, func() { initCarto(&pvcl) })
+		test.That(t, out, test.ShouldContainSubstring, "Running in mapping mode")
+		test.That(t, out, test.ShouldContainSubstring, "slam mode:")
+	})
+
+	t.Run("lowering the verbosity at runtime takes effect immediately", func(t *testing.T) {
+		test.That(t, pvcl.SetLogLevel(0, 0), test.ShouldBeNil)
+		out := captureStdout(t, func() { initCarto(&pvcl) })
+		test.That(t, out, test.ShouldContainSubstring, "Running in mapping mode")
+		test.That(t, out, test.ShouldNotContainSubstring, "slam mode:")
+	})
+
+	t.Run("invalid levels are rejected", func(t *testing.T) {
+		test.That(t, pvcl.SetLogLevel(4, 0), test.ShouldResemble, errors.New("VIAM_CARTO_LOG_LEVEL_INVALID"))
+		test.That(t, pvcl.SetLogLevel(0, -1), test.ShouldResemble, errors.New("VIAM_CARTO_LOG_LEVEL_INVALID"))
+		minloglevel, verbose := pvcl.LogLevel()
+		test.That(t, minloglevel, test.ShouldEqual, 0)
+		test.That(t, verbose, test.ShouldEqual, 0)
+	})
+
+	test.That(t, pvcl.Terminate(), test.ShouldBeNil)
+}
+
+func TestMemoryUsage(t *testing.T) {
+	t.Run("an uninitialized lib is rejected", func(t *testing.T) {
+		_, err := (&CartoLib{}).MemoryUsage()
+		test.That(t, err, test.ShouldResemble, errors.New("VIAM_CARTO_LIB_INVALID"))
+	})
+
+	pvcl, err := NewLib(0, 0)
+	test.That(t, err, test.ShouldBeNil)
+
+	t.Run("the bytes allocated by cartographer are reported", func(t *testing.T) {
+		allocatedBytes, err := pvcl.MemoryUsage()
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, allocatedBytes, test.ShouldBeGreaterThan, 0)
+
+		vc, err := NewCarto(GetTestConfig("my-lidar", "", "", true), GetTestAlgoConfig(false), &pvcl)
+		test.That(t, err, test.ShouldBeNil)
+		allocatedBytesWithCarto, err := pvcl.MemoryUsage()
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, allocatedBytesWithCarto, test.ShouldBeGreaterThan, allocatedBytes)
+		test.That(t, vc.terminate(), test.ShouldBeNil)
+	})
+
+	test.That(t, pvcl.Terminate(), test.ShouldBeNil)
+}
+
+func TestInternalStateVersion(t *testing.T) {
+	t.Run("an uninitialized lib is rejected", func(t *testing.T) {
+		_, err := (&CartoLib{}).InternalStateVersion("internal_state.pbstream")
+		test.That(t, err, test.ShouldResemble, errors.New("VIAM_CARTO_LIB_INVALID"))
+		err = (&CartoLib{}).MigrateInternalState("internal_state.pbstream", "migrated.pbstream")
+		test.That(t, err, test.ShouldResemble, errors.New("VIAM_CARTO_LIB_INVALID"))
+	})
+
+	pvcl, err := NewLib(0, 0)
+	test.That(t, err, test.ShouldBeNil)
+
+	t.Run("a missing internal state is invalid", func(t *testing.T) {
+		_, err := pvcl.InternalStateVersion(filepath.Join(t.TempDir(), "internal_state.pbstream"))
+		test.That(t, err, test.ShouldResemble, errors.New("VIAM_CARTO_INTERNAL_STATE_INVALID"))
+	})
+
+	t.Run("a file without the internal state magic number is invalid", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "internal_state.pbstream")
+		test.That(t, os.WriteFile(path, []byte("not an internal state"), 0o600), test.ShouldBeNil)
+		_, err := pvcl.InternalStateVersion(path)
+		test.That(t, err, test.ShouldResemble, errors.New("VIAM_CARTO_INTERNAL_STATE_INVALID"))
+	})
+
+	test.That(t, pvcl.Terminate(), test.ShouldBeNil)
+}
+
 func TestCGoAPIWithoutMovementSensor(t *testing.T) {
 	pvcl, err := NewLib(0, 1)
 
@@ -225,10 +680,20 @@ func TestCGoAPIWithoutMovementSensor(t *testing.T) {
 		test.That(t, vc, test.ShouldNotBeNil)
 		test.That(t, vc.SlamMode, test.ShouldEqual, MappingMode)
 
+		// test algoConfig reflects the requested algo config
+		appliedAlgoCfg, err := vc.algoConfig()
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, DiffAlgoConfig(algoCfg, appliedAlgoCfg, vc.SlamMode), test.ShouldBeEmpty)
+
 		// test start
 		err = vc.start()
 		test.That(t, err, test.ShouldBeNil)
 
+		// test slamStats before sensor data is added
+		stats, err := vc.slamStats()
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, stats, test.ShouldResemble, SlamStats{})
+
 		// test position before sensor data is added
 		position, err := vc.position()
 		test.That(t, err, test.ShouldNotBeNil)
@@ -297,8 +762,6 @@ func TestCGoAPIWithoutMovementSensor(t *testing.T) {
 		test.That(t, len(internalState), test.ShouldEqual, len(lastInternalState))
 		lastInternalState = internalState
 
-		confirmBinaryCompressedUnsupported(t)
-
 		// NOTE: This test is very carefully created in order to not hit
 		// cases where cartographer won't update the map for whatever reason.
 		// For example, if you change the time increments from 2 seconds to 1
@@ -512,8 +975,6 @@ func TestCGoAPIWithMovementSensor(t *testing.T) {
 		test.That(t, len(internalState), test.ShouldEqual, len(lastInternalState))
 		lastInternalState = internalState
 
-		confirmBinaryCompressedUnsupported(t)
-
 		// NOTE: This test is very carefully created in order to not hit
 		// cases where cartographer won't update the map for whatever reason.
 		// It is not clear why cartographer has this behavior.
@@ -631,3 +1092,69 @@ func TestCGoAPIWithMovementSensor(t *testing.T) {
 		test.That(t, err, test.ShouldBeNil)
 	})
 }
+
+func TestCGoAPIBinaryCompressedLidarReadings(t *testing.T) {
+	// the pointcloud package can't write binary compressed PCDs, so these are PCL-style fixtures of one scan
+	binaryScan, err := os.ReadFile("../sensors/testdata/scan_binary.pcd")
+	test.That(t, err, test.ShouldBeNil)
+	compressedScan, err := os.ReadFile("../sensors/testdata/scan_binary_compressed.pcd")
+	test.That(t, err, test.ShouldBeNil)
+
+	pvcl, err := NewLib(0, 1)
+	test.That(t, err, test.ShouldBeNil)
+
+	newStartedCarto := func(t *testing.T) Carto {
+		vc, err := NewCarto(GetTestConfig("my-lidar", "", "", true), GetTestAlgoConfig(false), &pvcl)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, vc.start(), test.ShouldBeNil)
+		return vc
+	}
+	stopCarto := func(t *testing.T, vc Carto) {
+		test.That(t, vc.stop(), test.ShouldBeNil)
+		test.That(t, vc.terminate(), test.ShouldBeNil)
+	}
+	addScans := func(t *testing.T, vc Carto, scan []byte) {
+		timestamp := time.Date(2021, 8, 15, 14, 30, 45, 100, time.UTC)
+		for i := 0; i < 10; i++ {
+			timestamp = timestamp.Add(time.Second * 2)
+			reading := s.TimedLidarReadingResponse{Reading: scan, ReadingTime: timestamp}
+			test.That(t, vc.addLidarReading("my-lidar", reading), test.ShouldBeNil)
+		}
+	}
+
+	t.Run("binary compressed scans are added like binary scans", func(t *testing.T) {
+		vc := newStartedCarto(t)
+		internalState, err := vc.internalState()
+		test.That(t, err, test.ShouldBeNil)
+		addScans(t, vc, binaryScan)
+		binaryInternalState, err := vc.internalState()
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, len(binaryInternalState), test.ShouldBeGreaterThan, len(internalState))
+		stopCarto(t, vc)
+
+		vc = newStartedCarto(t)
+		addScans(t, vc, compressedScan)
+		compressedInternalState, err := vc.internalState()
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, len(compressedInternalState), test.ShouldBeGreaterThan, len(internalState))
+		stopCarto(t, vc)
+	})
+
+	t.Run("a corrupt binary compressed scan is not added", func(t *testing.T) {
+		vc := newStartedCarto(t)
+		reading := s.TimedLidarReadingResponse{
+			Reading:     compressedScan[:len(compressedScan)-1],
+			ReadingTime: time.Date(2021, 8, 15, 14, 30, 45, 100, time.UTC),
+		}
+		err := vc.addLidarReading("my-lidar", reading)
+		test.That(t, err, test.ShouldBeError)
+		test.That(t, err.Error(), test.ShouldContainSubstring, "binary compressed PCD")
+
+		stats, err := vc.slamStats()
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, stats, test.ShouldResemble, SlamStats{})
+		stopCarto(t, vc)
+	})
+
+	test.That(t, pvcl.Terminate(), test.ShouldBeNil)
+}
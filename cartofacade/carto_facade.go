@@ -5,7 +5,9 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"go.uber.org/multierr"
@@ -79,6 +81,11 @@ func (cf *CartoFacade) AddLidarReading(
 		reading: currentReading,
 	}
 
+	if !cf.ingestion.enter() {
+		return ErrDrained
+	}
+	defer cf.ingestion.exit()
+
 	_, err := cf.request(ctx, addLidarReading, requestParams, timeout)
 	if err != nil {
 		return err
@@ -99,6 +106,11 @@ func (cf *CartoFacade) AddIMUReading(
 		reading: currentReading,
 	}
 
+	if !cf.ingestion.enter() {
+		return ErrDrained
+	}
+	defer cf.ingestion.exit()
+
 	_, err := cf.request(ctx, addIMUReading, requestParams, timeout)
 	if err != nil {
 		return err
@@ -119,6 +131,11 @@ func (cf *CartoFacade) AddOdometerReading(
 		reading: currentReading,
 	}
 
+	if !cf.ingestion.enter() {
+		return ErrDrained
+	}
+	defer cf.ingestion.exit()
+
 	_, err := cf.request(ctx, addOdometerReading, requestParams, timeout)
 	if err != nil {
 		return err
@@ -182,6 +199,238 @@ func (cf *CartoFacade) RunFinalOptimization(ctx context.Context, timeout time.Du
 	return nil
 }
 
+// initialOptimizationPollInterval is how often RunInitialOptimization checks whether the initial optimization
+// running in the background of the C facade is done.
+const initialOptimizationPollInterval = 100 * time.Millisecond
+
+// RunInitialOptimization calls into the cartofacade C code to run the optimization that optimize_on_start runs
+// while cartographer is initialized, for a cartographer that was started without it. Unlike RunFinalOptimization,
+// it is not recorded as the final optimization in the status.
+// If the library provides FeatureBackgroundInitialOptimization, the optimization runs on a thread of the C facade
+// so that the worker goroutine keeps serving other requests, and RunInitialOptimization waits for it until the
+// timeout or ctx ends. The optimization itself can not be interrupted: it keeps running and Stop waits for it.
+// Otherwise the optimization blocks the worker goroutine until it completes.
+func (cf *CartoFacade) RunInitialOptimization(ctx context.Context, timeout time.Duration) error {
+	if !cf.cartoLib.Capabilities().Has(FeatureBackgroundInitialOptimization) {
+		_, err := cf.request(ctx, runInitialOptimization, emptyRequestParams, timeout)
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	if _, err := cf.request(ctx, startInitialOptimization, emptyRequestParams, timeout); err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(initialOptimizationPollInterval)
+	defer ticker.Stop()
+	for {
+		untyped, err := cf.request(ctx, initialOptimizationRunning, emptyRequestParams, timeout)
+		if err != nil {
+			return err
+		}
+		running, ok := untyped.(bool)
+		if !ok {
+			return errors.New("unable to cast response from cartofacade to a bool")
+		}
+		if !running {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return multierr.Combine(errors.New("stopped waiting for the initial optimization"), ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+// AlgoConfig calls into the cartofacade C code and returns the algo config cartographer
+// is actually operating with.
+func (cf *CartoFacade) AlgoConfig(ctx context.Context, timeout time.Duration) (CartoAlgoConfig, error) {
+	untyped, err := cf.request(ctx, algoConfig, emptyRequestParams, timeout)
+	if err != nil {
+		return CartoAlgoConfig{}, err
+	}
+
+	algoConfig, ok := untyped.(CartoAlgoConfig)
+	if !ok {
+		return CartoAlgoConfig{}, errors.New("unable to cast response from cartofacade to an algo config struct")
+	}
+
+	return algoConfig, nil
+}
+
+// StartNewTrajectory calls into the cartofacade C code to finish and freeze the current trajectory and start
+// a new one, at initialPose if it is not nil. Readings added afterwards are attached to the new trajectory.
+func (cf *CartoFacade) StartNewTrajectory(
+	ctx context.Context,
+	timeout time.Duration,
+	initialPose *TrajectoryPose,
+) (NewTrajectory, error) {
+	requestParams := map[RequestParamType]interface{}{
+		pose: initialPose,
+	}
+
+	untyped, err := cf.request(ctx, startNewTrajectory, requestParams, timeout)
+	if err != nil {
+		return NewTrajectory{}, err
+	}
+
+	newTrajectory, ok := untyped.(NewTrajectory)
+	if !ok {
+		return NewTrajectory{}, errors.New("unable to cast response from cartofacade to a new trajectory struct")
+	}
+
+	return newTrajectory, nil
+}
+
+// FreezeTrajectory calls into the cartofacade C code to finish the trajectory of the given id if it is active and
+// freeze it, so that it stays part of the pose graph for localization while the optimization no longer moves it.
+// It returns ErrTrajectoryNotFound if the pose graph has no such trajectory and ErrTrajectoryActive if sensor
+// readings are added to it.
+func (cf *CartoFacade) FreezeTrajectory(ctx context.Context, timeout time.Duration, id int) error {
+	requestParams := map[RequestParamType]interface{}{
+		trajectoryID: id,
+	}
+
+	_, err := cf.request(ctx, freezeTrajectory, requestParams, timeout)
+	return err
+}
+
+// RestartTrajectory calls into the cartofacade C code to replace the current localization trajectory with a new
+// one against the frozen map, at initialPose if it is not nil and localized globally against the map otherwise.
+// It is queued like any other request, so readings added before it are attached to the restarted trajectory and
+// readings added afterwards to the new one. It returns ErrNotLocalizing if cartographer is not in LocalizingMode.
+func (cf *CartoFacade) RestartTrajectory(
+	ctx context.Context,
+	timeout time.Duration,
+	initialPose *TrajectoryPose,
+) (RestartedTrajectory, error) {
+	requestParams := map[RequestParamType]interface{}{
+		pose: initialPose,
+	}
+
+	untyped, err := cf.request(ctx, restartTrajectory, requestParams, timeout)
+	if err != nil {
+		return RestartedTrajectory{}, err
+	}
+
+	restartedTrajectory, ok := untyped.(RestartedTrajectory)
+	if !ok {
+		return RestartedTrajectory{}, errors.New("unable to cast response from cartofacade to a restarted trajectory struct")
+	}
+
+	return restartedTrajectory, nil
+}
+
+// Trajectories calls into the cartofacade C code and returns all trajectories in the pose graph.
+func (cf *CartoFacade) Trajectories(ctx context.Context, timeout time.Duration) ([]Trajectory, error) {
+	untyped, err := cf.request(ctx, trajectories, emptyRequestParams, timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	trajectories, ok := untyped.([]Trajectory)
+	if !ok {
+		return nil, errors.New("unable to cast response from cartofacade to a trajectory slice")
+	}
+
+	return trajectories, nil
+}
+
+// Trajectory calls into the cartofacade C code and returns the time and optimized pose of every node of every
+// trajectory in the pose graph, ordered by trajectory and time.
+func (cf *CartoFacade) Trajectory(ctx context.Context, timeout time.Duration) ([]TrajectoryNode, error) {
+	untyped, err := cf.request(ctx, trajectory, emptyRequestParams, timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	nodes, ok := untyped.([]TrajectoryNode)
+	if !ok {
+		return nil, errors.New("unable to cast response from cartofacade to a trajectory node slice")
+	}
+
+	return nodes, nil
+}
+
+// SubmapList calls into the cartofacade C code and returns the id, version and optimized pose of every submap
+// in the pose graph, ordered by id.
+func (cf *CartoFacade) SubmapList(ctx context.Context, timeout time.Duration) ([]Submap, error) {
+	if err := cf.cartoLib.Capabilities().Require(FeatureSubmaps); err != nil {
+		return nil, err
+	}
+	untyped, err := cf.request(ctx, submapList, emptyRequestParams, timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	submaps, ok := untyped.([]Submap)
+	if !ok {
+		return nil, errors.New("unable to cast response from cartofacade to a submap slice")
+	}
+
+	return submaps, nil
+}
+
+// Submap calls into the cartofacade C code and returns the submap of the given id along with its pointcloud. It
+// returns ErrSubmapNotFound if the pose graph has no such submap.
+func (cf *CartoFacade) Submap(ctx context.Context, timeout time.Duration, id SubmapID) (SubmapPointCloud, error) {
+	if err := cf.cartoLib.Capabilities().Require(FeatureSubmaps); err != nil {
+		return SubmapPointCloud{}, err
+	}
+	requestParams := map[RequestParamType]interface{}{
+		submapID: id,
+	}
+
+	untyped, err := cf.request(ctx, submap, requestParams, timeout)
+	if err != nil {
+		return SubmapPointCloud{}, err
+	}
+
+	submap, ok := untyped.(SubmapPointCloud)
+	if !ok {
+		return SubmapPointCloud{}, errors.New("unable to cast response from cartofacade to a submap pointcloud struct")
+	}
+
+	return submap, nil
+}
+
+// SlamStats calls into the cartofacade C code and returns the number of nodes of the current trajectory and how
+// far the optimization of the pose graph lags behind them.
+func (cf *CartoFacade) SlamStats(ctx context.Context, timeout time.Duration) (SlamStats, error) {
+	if err := cf.cartoLib.Capabilities().Require(FeatureSlamStats); err != nil {
+		return SlamStats{}, err
+	}
+	untyped, err := cf.request(ctx, slamStats, emptyRequestParams, timeout)
+	if err != nil {
+		return SlamStats{}, err
+	}
+
+	stats, ok := untyped.(SlamStats)
+	if !ok {
+		return SlamStats{}, errors.New("unable to cast response from cartofacade to slam stats")
+	}
+
+	return stats, nil
+}
+
+// SetSlamMode calls into the cartofacade C code to switch to mode by finishing and freezing the current
+// trajectory and starting a new one at the current pose. In LocalizingMode the new trajectory is only localized
+// against the map, in MappingMode and UpdatingMode its readings are added to the map.
+func (cf *CartoFacade) SetSlamMode(ctx context.Context, timeout time.Duration, mode SlamMode) error {
+	if err := cf.cartoLib.Capabilities().Require(FeatureSetSlamMode); err != nil {
+		return err
+	}
+	requestParams := map[RequestParamType]interface{}{
+		slamMode: mode,
+	}
+
+	_, err := cf.request(ctx, setSlamMode, requestParams, timeout)
+	return err
+}
+
 // RequestType defines the carto C API call that is being made.
 type RequestType int64
 
@@ -208,6 +457,38 @@ const (
 	pointCloudMap
 	// runFinalOptimization represents viam_carto_run_final_optimization.
 	runFinalOptimization
+	// algoConfig represents viam_carto_get_algo_config.
+	algoConfig
+	// startNewTrajectory represents viam_carto_start_new_trajectory.
+	startNewTrajectory
+	// trajectories represents viam_carto_get_trajectories.
+	trajectories
+	// slamStats represents viam_carto_get_slam_stats.
+	slamStats
+	// trajectory represents viam_carto_get_trajectory.
+	trajectory
+	// setSlamMode represents viam_carto_set_slam_mode.
+	setSlamMode
+	// submapList represents viam_carto_get_submap_list.
+	submapList
+	// submap represents viam_carto_get_submap.
+	submap
+	// freezeTrajectory represents viam_carto_freeze_trajectory.
+	freezeTrajectory
+	// restartTrajectory represents viam_carto_restart_trajectory.
+	restartTrajectory
+	// runInitialOptimization represents viam_carto_run_final_optimization, run in place of optimize_on_start.
+	runInitialOptimization
+	// startInitialOptimization represents viam_carto_start_initial_optimization.
+	startInitialOptimization
+	// initialOptimizationRunning represents viam_carto_get_initial_optimization_running.
+	initialOptimizationRunning
+	// internalStateStream represents viam_carto_get_internal_state_stream.
+	internalStateStream
+	// internalStateChunk represents viam_carto_get_internal_state_chunk.
+	internalStateChunk
+	// closeInternalStateStream represents viam_carto_internal_state_stream_destroy.
+	closeInternalStateStream
 )
 
 // RequestParamType defines the type being provided as input to the work.
@@ -218,6 +499,18 @@ const (
 	sensor RequestParamType = iota
 	// reading represents a sensor reading input into c funcs.
 	reading
+	// pose represents a trajectory pose input into c funcs.
+	pose
+	// slamMode represents a slam mode input into c funcs.
+	slamMode
+	// submapID represents a submap id input into c funcs.
+	submapID
+	// trajectoryID represents a trajectory id input into c funcs.
+	trajectoryID
+	// stream represents an internal state stream input into c funcs.
+	stream
+	// maxSize represents a maximum number of bytes input into c funcs.
+	maxSize
 )
 
 // Response defines the result of one piece of work that can be put on the result channel.
@@ -236,6 +529,13 @@ type CartoFacade struct {
 	cartoConfig     CartoConfig
 	cartoAlgoConfig CartoAlgoConfig
 	requestChan     chan Request
+	heartbeat       *heartbeat
+	dutyCycle       *dutyCycle
+	ingestion       *ingestionGate
+	memory          *memoryGauge
+	status          *status
+	// workerStarted is kept behind a pointer so that a CartoFacade can be copied.
+	workerStarted *atomic.Bool
 }
 
 // RequestInterface defines the functionality of a Request.
@@ -274,6 +574,10 @@ type Interface interface {
 		ctx context.Context,
 		timeout time.Duration,
 	) error
+	Drain(
+		ctx context.Context,
+		timeout time.Duration,
+	) error
 	AddLidarReading(
 		ctx context.Context,
 		timeout time.Duration,
@@ -300,6 +604,10 @@ type Interface interface {
 		ctx context.Context,
 		timeout time.Duration,
 	) ([]byte, error)
+	InternalStateStream(
+		ctx context.Context,
+		timeout time.Duration,
+	) (io.ReadCloser, error)
 	PointCloudMap(
 		ctx context.Context,
 		timeout time.Duration,
@@ -308,6 +616,59 @@ type Interface interface {
 		ctx context.Context,
 		timeout time.Duration,
 	) error
+	RunInitialOptimization(
+		ctx context.Context,
+		timeout time.Duration,
+	) error
+	AlgoConfig(
+		ctx context.Context,
+		timeout time.Duration,
+	) (CartoAlgoConfig, error)
+	StartNewTrajectory(
+		ctx context.Context,
+		timeout time.Duration,
+		initialPose *TrajectoryPose,
+	) (NewTrajectory, error)
+	FreezeTrajectory(
+		ctx context.Context,
+		timeout time.Duration,
+		id int,
+	) error
+	RestartTrajectory(
+		ctx context.Context,
+		timeout time.Duration,
+		initialPose *TrajectoryPose,
+	) (RestartedTrajectory, error)
+	Trajectories(
+		ctx context.Context,
+		timeout time.Duration,
+	) ([]Trajectory, error)
+	Trajectory(
+		ctx context.Context,
+		timeout time.Duration,
+	) ([]TrajectoryNode, error)
+	SubmapList(
+		ctx context.Context,
+		timeout time.Duration,
+	) ([]Submap, error)
+	Submap(
+		ctx context.Context,
+		timeout time.Duration,
+		id SubmapID,
+	) (SubmapPointCloud, error)
+	SlamStats(
+		ctx context.Context,
+		timeout time.Duration,
+	) (SlamStats, error)
+	SetSlamMode(
+		ctx context.Context,
+		timeout time.Duration,
+		mode SlamMode,
+	) error
+	Unresponsive() bool
+	DutyCycle() (float64, bool)
+	MemoryUsage() (uint64, bool)
+	Status() Status
 }
 
 // Request defines all of the necessary pieces to call into the CGo API.
@@ -325,6 +686,12 @@ func New(cartoLib CartoLibInterface, cartoCfg CartoConfig, cartoAlgoCfg CartoAlg
 		cartoConfig:     cartoCfg,
 		cartoAlgoConfig: cartoAlgoCfg,
 		requestChan:     make(chan Request),
+		heartbeat:       &heartbeat{},
+		dutyCycle:       newDutyCycle(DutyCycleWindow, time.Now()),
+		ingestion:       &ingestionGate{},
+		memory:          &memoryGauge{},
+		status:          &status{},
+		workerStarted:   &atomic.Bool{},
 	}
 }
 
@@ -383,14 +750,85 @@ func (r *Request) doWork(
 		return cf.carto.internalState()
 	case pointCloudMap:
 		return cf.carto.pointCloudMap()
-	case runFinalOptimization:
+	case runFinalOptimization, runInitialOptimization:
 		return nil, cf.carto.runFinalOptimization()
+	case startInitialOptimization:
+		return nil, cf.carto.startInitialOptimization()
+	case initialOptimizationRunning:
+		return cf.carto.initialOptimizationRunning()
+	case algoConfig:
+		return cf.carto.algoConfig()
+	case startNewTrajectory:
+		initialPose, ok := r.requestParams[pose].(*TrajectoryPose)
+		if !ok {
+			return nil, errors.New("could not cast inputted initial pose to type *TrajectoryPose")
+		}
+
+		return cf.carto.startNewTrajectory(initialPose)
+	case trajectories:
+		return cf.carto.trajectories()
+	case slamStats:
+		return cf.carto.slamStats()
+	case trajectory:
+		return cf.carto.trajectory()
+	case submapList:
+		return cf.carto.submapList()
+	case submap:
+		id, ok := r.requestParams[submapID].(SubmapID)
+		if !ok {
+			return nil, errors.New("could not cast inputted submap id to type SubmapID")
+		}
+
+		return cf.carto.submap(id)
+	case setSlamMode:
+		mode, ok := r.requestParams[slamMode].(SlamMode)
+		if !ok {
+			return nil, errors.New("could not cast inputted slam mode to type SlamMode")
+		}
+
+		return nil, cf.carto.setSlamMode(mode)
+	case freezeTrajectory:
+		id, ok := r.requestParams[trajectoryID].(int)
+		if !ok {
+			return nil, errors.New("could not cast inputted trajectory id to type int")
+		}
+
+		return nil, cf.carto.freezeTrajectory(id)
+	case restartTrajectory:
+		initialPose, ok := r.requestParams[pose].(*TrajectoryPose)
+		if !ok {
+			return nil, errors.New("could not cast inputted initial pose to type *TrajectoryPose")
+		}
+
+		return cf.carto.restartTrajectory(initialPose)
+	case internalStateStream:
+		return cf.carto.internalStateStream()
+	case internalStateChunk, closeInternalStateStream:
+		handle, ok := r.requestParams[stream].(*internalStateStreamHandle)
+		if !ok {
+			return nil, errors.New("could not cast inputted stream to type *internalStateStreamHandle")
+		}
+		if r.requestType == closeInternalStateStream {
+			return nil, cf.carto.closeInternalStateStream(handle)
+		}
+
+		size, ok := r.requestParams[maxSize].(int)
+		if !ok {
+			return nil, errors.New("could not cast inputted max size to type int")
+		}
+
+		return cf.carto.internalStateChunk(handle, size)
 	}
 	return nil, fmt.Errorf("no worktype found for: %v", r.requestType)
 }
 
 // request wraps calls into C. This function requires the caller to know which RequestTypes
-// requires casting to which response values.
+// requires casting to which response values. The request is bounded by the smaller of the timeout
+// and the deadline of ctxParent, so that callers can bound a single slow call, e.g. to PointCloudMap,
+// with the context they pass. Once either is reached, the returned error wraps context.DeadlineExceeded,
+// or context.Canceled if ctxParent was cancelled, which tells it apart from ErrUnableToAcquireLock.
+// A request whose context has ended is not queued at all. A call that is already running in C is not
+// interrupted: the worker finishes it and drops its response.
 func (cf *CartoFacade) request(
 	ctxParent context.Context,
 	requestType RequestType,
@@ -400,6 +838,11 @@ func (cf *CartoFacade) request(
 	ctx, cancel := context.WithTimeout(ctxParent, timeout)
 	defer cancel()
 
+	// select picks at random between the worker and the ended context when both are ready
+	if err := ctx.Err(); err != nil {
+		return nil, multierr.Combine(errors.New("timeout writing to cartographer"), err)
+	}
+
 	req := Request{
 		responseChan:  make(chan Response, 1),
 		requestType:   requestType,
@@ -407,8 +850,14 @@ func (cf *CartoFacade) request(
 	}
 
 	// wait until work can call into C (and timeout if needed)
+	if cf.status != nil {
+		cf.status.queueDepth.Add(1)
+	}
 	select {
 	case cf.requestChan <- req:
+		if cf.status != nil {
+			cf.status.queueDepth.Add(-1)
+		}
 		select {
 		case response := <-req.responseChan:
 			return response.result, response.err
@@ -417,14 +866,20 @@ func (cf *CartoFacade) request(
 			return nil, multierr.Combine(errors.New(msg), ctx.Err())
 		}
 	case <-ctx.Done():
+		if cf.status != nil {
+			cf.status.queueDepth.Add(-1)
+		}
 		msg := "timeout writing to cartographer"
 		return nil, multierr.Combine(errors.New(msg), ctx.Err())
 	}
 }
 
 // startCGoroutine starts the background goroutine that is responsible for ensuring only one call
-// into C is being made at a time.
+// into C is being made at a time. It is only started once, so that Initialize can be retried after failing.
 func (cf *CartoFacade) startCGoroutine(ctx context.Context, activeBackgroundWorkers *sync.WaitGroup) {
+	if cf.workerStarted != nil && !cf.workerStarted.CompareAndSwap(false, true) {
+		return
+	}
 	activeBackgroundWorkers.Add(1)
 	go func() {
 		defer activeBackgroundWorkers.Done()
@@ -434,7 +889,16 @@ func (cf *CartoFacade) startCGoroutine(ctx context.Context, activeBackgroundWork
 			case <-ctx.Done():
 				return
 			case workToDo := <-cf.requestChan:
+				// the start and end of the call are the only times read per request
+				callStartedAt := time.Now()
+				cf.heartbeat.callStartedAtUnixNano.Store(callStartedAt.UnixNano())
 				result, err := workToDo.doWork(cf)
+				cf.heartbeat.callStartedAtUnixNano.Store(0)
+				callEndedAt := time.Now()
+				cf.dutyCycle.record(callStartedAt, callEndedAt)
+				if err == nil && cf.status != nil {
+					cf.status.record(workToDo.requestType, callEndedAt)
+				}
 				workToDo.responseChan <- Response{result: result, err: err}
 			}
 		}
@@ -3,6 +3,7 @@ package cartofacade
 
 import (
 	"context"
+	"io"
 	"sync"
 	"time"
 
@@ -53,6 +54,10 @@ type Mock struct {
 		ctx context.Context,
 		timeout time.Duration,
 	) error
+	DrainFunc func(
+		ctx context.Context,
+		timeout time.Duration,
+	) error
 	AddLidarReadingFunc func(
 		ctx context.Context,
 		timeout time.Duration,
@@ -79,6 +84,10 @@ type Mock struct {
 		ctx context.Context,
 		timeout time.Duration,
 	) ([]byte, error)
+	InternalStateStreamFunc func(
+		ctx context.Context,
+		timeout time.Duration,
+	) (io.ReadCloser, error)
 	PointCloudMapFunc func(
 		ctx context.Context,
 		timeout time.Duration,
@@ -87,6 +96,59 @@ type Mock struct {
 		ctx context.Context,
 		timeout time.Duration,
 	) error
+	RunInitialOptimizationFunc func(
+		ctx context.Context,
+		timeout time.Duration,
+	) error
+	AlgoConfigFunc func(
+		ctx context.Context,
+		timeout time.Duration,
+	) (CartoAlgoConfig, error)
+	StartNewTrajectoryFunc func(
+		ctx context.Context,
+		timeout time.Duration,
+		initialPose *TrajectoryPose,
+	) (NewTrajectory, error)
+	FreezeTrajectoryFunc func(
+		ctx context.Context,
+		timeout time.Duration,
+		id int,
+	) error
+	RestartTrajectoryFunc func(
+		ctx context.Context,
+		timeout time.Duration,
+		initialPose *TrajectoryPose,
+	) (RestartedTrajectory, error)
+	TrajectoriesFunc func(
+		ctx context.Context,
+		timeout time.Duration,
+	) ([]Trajectory, error)
+	TrajectoryFunc func(
+		ctx context.Context,
+		timeout time.Duration,
+	) ([]TrajectoryNode, error)
+	SubmapListFunc func(
+		ctx context.Context,
+		timeout time.Duration,
+	) ([]Submap, error)
+	SubmapFunc func(
+		ctx context.Context,
+		timeout time.Duration,
+		id SubmapID,
+	) (SubmapPointCloud, error)
+	SlamStatsFunc func(
+		ctx context.Context,
+		timeout time.Duration,
+	) (SlamStats, error)
+	SetSlamModeFunc func(
+		ctx context.Context,
+		timeout time.Duration,
+		mode SlamMode,
+	) error
+	UnresponsiveFunc func() bool
+	DutyCycleFunc    func() (float64, bool)
+	MemoryUsageFunc  func() (uint64, bool)
+	StatusFunc       func() Status
 }
 
 // request calls the injected requestFunc or the real version.
@@ -158,6 +220,17 @@ func (cf *Mock) Terminate(
 	return cf.TerminateFunc(ctx, timeout)
 }
 
+// Drain calls the injected DrainFunc or the real version.
+func (cf *Mock) Drain(
+	ctx context.Context,
+	timeout time.Duration,
+) error {
+	if cf.DrainFunc == nil {
+		return cf.CartoFacade.Drain(ctx, timeout)
+	}
+	return cf.DrainFunc(ctx, timeout)
+}
+
 // AddLidarReading calls the injected AddLidarReadingFunc or the real version.
 func (cf *Mock) AddLidarReading(
 	ctx context.Context,
@@ -219,6 +292,17 @@ func (cf *Mock) InternalState(
 	return cf.InternalStateFunc(ctx, timeout)
 }
 
+// InternalStateStream calls the injected InternalStateStreamFunc or the real version.
+func (cf *Mock) InternalStateStream(
+	ctx context.Context,
+	timeout time.Duration,
+) (io.ReadCloser, error) {
+	if cf.InternalStateStreamFunc == nil {
+		return cf.CartoFacade.InternalStateStream(ctx, timeout)
+	}
+	return cf.InternalStateStreamFunc(ctx, timeout)
+}
+
 // PointCloudMap calls the injected PointCloudMapFunc or the real version.
 func (cf *Mock) PointCloudMap(
 	ctx context.Context,
@@ -240,3 +324,161 @@ func (cf *Mock) RunFinalOptimization(
 	}
 	return cf.RunFinalOptimizationFunc(ctx, timeout)
 }
+
+// RunInitialOptimization calls the injected RunInitialOptimizationFunc or the real version.
+func (cf *Mock) RunInitialOptimization(
+	ctx context.Context,
+	timeout time.Duration,
+) error {
+	if cf.RunInitialOptimizationFunc == nil {
+		return cf.CartoFacade.RunInitialOptimization(ctx, timeout)
+	}
+	return cf.RunInitialOptimizationFunc(ctx, timeout)
+}
+
+// AlgoConfig calls the injected AlgoConfigFunc or the real version.
+func (cf *Mock) AlgoConfig(
+	ctx context.Context,
+	timeout time.Duration,
+) (CartoAlgoConfig, error) {
+	if cf.AlgoConfigFunc == nil {
+		return cf.CartoFacade.AlgoConfig(ctx, timeout)
+	}
+	return cf.AlgoConfigFunc(ctx, timeout)
+}
+
+// StartNewTrajectory calls the injected StartNewTrajectoryFunc or the real version.
+func (cf *Mock) StartNewTrajectory(
+	ctx context.Context,
+	timeout time.Duration,
+	initialPose *TrajectoryPose,
+) (NewTrajectory, error) {
+	if cf.StartNewTrajectoryFunc == nil {
+		return cf.CartoFacade.StartNewTrajectory(ctx, timeout, initialPose)
+	}
+	return cf.StartNewTrajectoryFunc(ctx, timeout, initialPose)
+}
+
+// FreezeTrajectory calls the injected FreezeTrajectoryFunc or the real version.
+func (cf *Mock) FreezeTrajectory(
+	ctx context.Context,
+	timeout time.Duration,
+	id int,
+) error {
+	if cf.FreezeTrajectoryFunc == nil {
+		return cf.CartoFacade.FreezeTrajectory(ctx, timeout, id)
+	}
+	return cf.FreezeTrajectoryFunc(ctx, timeout, id)
+}
+
+// RestartTrajectory calls the injected RestartTrajectoryFunc or the real version.
+func (cf *Mock) RestartTrajectory(
+	ctx context.Context,
+	timeout time.Duration,
+	initialPose *TrajectoryPose,
+) (RestartedTrajectory, error) {
+	if cf.RestartTrajectoryFunc == nil {
+		return cf.CartoFacade.RestartTrajectory(ctx, timeout, initialPose)
+	}
+	return cf.RestartTrajectoryFunc(ctx, timeout, initialPose)
+}
+
+// Trajectories calls the injected TrajectoriesFunc or the real version.
+func (cf *Mock) Trajectories(
+	ctx context.Context,
+	timeout time.Duration,
+) ([]Trajectory, error) {
+	if cf.TrajectoriesFunc == nil {
+		return cf.CartoFacade.Trajectories(ctx, timeout)
+	}
+	return cf.TrajectoriesFunc(ctx, timeout)
+}
+
+// Trajectory calls the injected TrajectoryFunc or the real version.
+func (cf *Mock) Trajectory(
+	ctx context.Context,
+	timeout time.Duration,
+) ([]TrajectoryNode, error) {
+	if cf.TrajectoryFunc == nil {
+		return cf.CartoFacade.Trajectory(ctx, timeout)
+	}
+	return cf.TrajectoryFunc(ctx, timeout)
+}
+
+// SubmapList calls the injected SubmapListFunc or the real version.
+func (cf *Mock) SubmapList(
+	ctx context.Context,
+	timeout time.Duration,
+) ([]Submap, error) {
+	if cf.SubmapListFunc == nil {
+		return cf.CartoFacade.SubmapList(ctx, timeout)
+	}
+	return cf.SubmapListFunc(ctx, timeout)
+}
+
+// Submap calls the injected SubmapFunc or the real version.
+func (cf *Mock) Submap(
+	ctx context.Context,
+	timeout time.Duration,
+	id SubmapID,
+) (SubmapPointCloud, error) {
+	if cf.SubmapFunc == nil {
+		return cf.CartoFacade.Submap(ctx, timeout, id)
+	}
+	return cf.SubmapFunc(ctx, timeout, id)
+}
+
+// SlamStats calls the injected SlamStatsFunc or the real version.
+func (cf *Mock) SlamStats(
+	ctx context.Context,
+	timeout time.Duration,
+) (SlamStats, error) {
+	if cf.SlamStatsFunc == nil {
+		return cf.CartoFacade.SlamStats(ctx, timeout)
+	}
+	return cf.SlamStatsFunc(ctx, timeout)
+}
+
+// SetSlamMode calls the injected SetSlamModeFunc or the real version.
+func (cf *Mock) SetSlamMode(
+	ctx context.Context,
+	timeout time.Duration,
+	mode SlamMode,
+) error {
+	if cf.SetSlamModeFunc == nil {
+		return cf.CartoFacade.SetSlamMode(ctx, timeout, mode)
+	}
+	return cf.SetSlamModeFunc(ctx, timeout, mode)
+}
+
+// Unresponsive calls the injected UnresponsiveFunc or the real version.
+func (cf *Mock) Unresponsive() bool {
+	if cf.UnresponsiveFunc == nil {
+		return cf.CartoFacade.Unresponsive()
+	}
+	return cf.UnresponsiveFunc()
+}
+
+// DutyCycle calls the injected DutyCycleFunc or the real version.
+func (cf *Mock) DutyCycle() (float64, bool) {
+	if cf.DutyCycleFunc == nil {
+		return cf.CartoFacade.DutyCycle()
+	}
+	return cf.DutyCycleFunc()
+}
+
+// MemoryUsage calls the injected MemoryUsageFunc or the real version.
+func (cf *Mock) MemoryUsage() (uint64, bool) {
+	if cf.MemoryUsageFunc == nil {
+		return cf.CartoFacade.MemoryUsage()
+	}
+	return cf.MemoryUsageFunc()
+}
+
+// Status calls the injected StatusFunc or the real version.
+func (cf *Mock) Status() Status {
+	if cf.StatusFunc == nil {
+		return cf.CartoFacade.Status()
+	}
+	return cf.StatusFunc()
+}
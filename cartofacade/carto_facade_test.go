@@ -7,6 +7,7 @@ import (
 	"errors"
 	"os"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -17,6 +18,7 @@ import (
 	"go.viam.com/rdk/spatialmath"
 	"go.viam.com/test"
 	"go.viam.com/utils/artifact"
+	"go.viam.com/utils/testutils"
 
 	s "github.com/viam-modules/viam-cartographer/sensors"
 )
@@ -502,6 +504,48 @@ func TestPosition(t *testing.T) {
 		test.That(t, err, test.ShouldResemble, expectedErr)
 	})
 
+	t.Run("failure due to the deadline of the context before the timeout", func(t *testing.T) {
+		released := make(chan struct{})
+		carto.PositionFunc = func() (Position, error) {
+			defer close(released)
+			time.Sleep(200 * time.Millisecond)
+			return Position{X: 1}, nil
+		}
+		deadlineCtx, cancel := context.WithTimeout(cancelCtx, 50*time.Millisecond)
+		defer cancel()
+		start := time.Now()
+		_, err := cartoFacade.Position(deadlineCtx, 5*time.Second)
+		test.That(t, time.Since(start), test.ShouldBeLessThan, 200*time.Millisecond)
+		test.That(t, errors.Is(err, context.DeadlineExceeded), test.ShouldBeTrue)
+		test.That(t, errors.Is(err, ErrUnableToAcquireLock), test.ShouldBeFalse)
+		test.That(t, err, test.ShouldResemble, multierr.Combine(errors.New(timeoutErrMessage), context.DeadlineExceeded))
+
+		// the worker finishes the call and serves the next request
+		<-released
+		carto.PositionFunc = func() (Position, error) {
+			return Position{X: 2}, nil
+		}
+		pos, err := cartoFacade.Position(cancelCtx, 5*time.Second)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, pos.X, test.ShouldEqual, 2)
+	})
+
+	t.Run("a request whose context has ended is not queued", func(t *testing.T) {
+		called := false
+		carto.PositionFunc = func() (Position, error) {
+			called = true
+			return Position{}, nil
+		}
+		deadlineCtx, cancel := context.WithDeadline(cancelCtx, time.Now().Add(-time.Millisecond))
+		defer cancel()
+		for i := 0; i < 10; i++ {
+			_, err := cartoFacade.Position(deadlineCtx, 5*time.Second)
+			test.That(t, err, test.ShouldResemble,
+				multierr.Combine(errors.New("timeout writing to cartographer"), context.DeadlineExceeded))
+		}
+		test.That(t, called, test.ShouldBeFalse)
+	})
+
 	t.Run("failure due to time out", func(t *testing.T) {
 		carto.PositionFunc = func() (Position, error) {
 			time.Sleep(50 * time.Millisecond)
@@ -661,3 +705,661 @@ func TestRunFinalOptimization(t *testing.T) {
 	cancelFunc()
 	activeBackgroundWorkers.Wait()
 }
+
+func TestRunInitialOptimization(t *testing.T) {
+	cancelCtx, cancelFunc := context.WithCancel(context.Background())
+	activeBackgroundWorkers := sync.WaitGroup{}
+	defer func() {
+		cancelFunc()
+		activeBackgroundWorkers.Wait()
+	}()
+
+	newFacade := func(features ...Feature) (CartoFacade, *CartoMock) {
+		lib := CartoLibMock{CapabilitiesFunc: func() Capabilities { return NewCapabilities(features...) }}
+		cartoFacade := New(&lib, GetTestConfig("my-lidar", "", "", true), GetTestAlgoConfig(false))
+		carto := CartoMock{}
+		carto.RunFinalOptimizationFunc = func() error {
+			t.Fatal("the optimization blocked the worker goroutine")
+			return nil
+		}
+		cartoFacade.carto = &carto
+		cartoFacade.startCGoroutine(cancelCtx, &activeBackgroundWorkers)
+		return cartoFacade, &carto
+	}
+
+	t.Run("waits for the optimization in the background while other requests are served", func(t *testing.T) {
+		cartoFacade, carto := newFacade(FeatureBackgroundInitialOptimization)
+		var started, running atomic.Bool
+		running.Store(true)
+		carto.StartInitialOptimizationFunc = func() error {
+			started.Store(true)
+			return nil
+		}
+		carto.InitialOptimizationRunningFunc = func() (bool, error) { return running.Load(), nil }
+		carto.PositionFunc = func() (Position, error) { return Position{Real: 1}, nil }
+
+		done := make(chan error, 1)
+		go func() { done <- cartoFacade.RunInitialOptimization(cancelCtx, 5*time.Second) }()
+		testutils.WaitForAssertion(t, func(tb testing.TB) {
+			tb.Helper()
+			test.That(tb, started.Load(), test.ShouldBeTrue)
+		})
+		_, err := cartoFacade.Position(cancelCtx, 5*time.Second)
+		test.That(t, err, test.ShouldBeNil)
+		select {
+		case err := <-done:
+			t.Fatalf("returned before the optimization completed: %v", err)
+		default:
+		}
+
+		running.Store(false)
+		test.That(t, <-done, test.ShouldBeNil)
+	})
+
+	t.Run("stops waiting once the context is cancelled", func(t *testing.T) {
+		cartoFacade, carto := newFacade(FeatureBackgroundInitialOptimization)
+		carto.StartInitialOptimizationFunc = func() error { return nil }
+		carto.InitialOptimizationRunningFunc = func() (bool, error) { return true, nil }
+
+		ctx, cancel := context.WithCancel(cancelCtx)
+		done := make(chan error, 1)
+		go func() { done <- cartoFacade.RunInitialOptimization(ctx, time.Minute) }()
+		cancel()
+		test.That(t, errors.Is(<-done, context.Canceled), test.ShouldBeTrue)
+	})
+
+	t.Run("failure to start", func(t *testing.T) {
+		cartoFacade, carto := newFacade(FeatureBackgroundInitialOptimization)
+		carto.StartInitialOptimizationFunc = func() error { return ErrInitialOptimizationAlreadyStarted }
+		err := cartoFacade.RunInitialOptimization(cancelCtx, 5*time.Second)
+		test.That(t, err, test.ShouldBeError, ErrInitialOptimizationAlreadyStarted)
+	})
+
+	t.Run("blocks the worker goroutine with a library that predates the background optimization", func(t *testing.T) {
+		cartoFacade, carto := newFacade()
+		var ran bool
+		carto.RunFinalOptimizationFunc = func() error {
+			ran = true
+			return nil
+		}
+		test.That(t, cartoFacade.RunInitialOptimization(cancelCtx, 5*time.Second), test.ShouldBeNil)
+		test.That(t, ran, test.ShouldBeTrue)
+	})
+}
+
+func TestAlgoConfig(t *testing.T) {
+	lib := CartoLibMock{}
+
+	cancelCtx, cancelFunc := context.WithCancel(context.Background())
+	activeBackgroundWorkers := sync.WaitGroup{}
+
+	cfg := GetTestConfig("my-lidar", "", "", true)
+	algoCfg := GetTestAlgoConfig(false)
+
+	cartoFacade := New(&lib, cfg, algoCfg)
+	carto := CartoMock{}
+	cartoFacade.carto = &carto
+	cartoFacade.startCGoroutine(cancelCtx, &activeBackgroundWorkers)
+
+	t.Run("success", func(t *testing.T) {
+		appliedCfg := GetTestAlgoConfig(false)
+		appliedCfg.MaxSubmapsToKeep = 0
+		carto.AlgoConfigFunc = func() (CartoAlgoConfig, error) {
+			return appliedCfg, nil
+		}
+		res, err := cartoFacade.AlgoConfig(cancelCtx, 5*time.Second)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, res, test.ShouldResemble, appliedCfg)
+	})
+
+	t.Run("failure", func(t *testing.T) {
+		expectedErr := errors.New("AlgoConfig failed")
+		carto.AlgoConfigFunc = func() (CartoAlgoConfig, error) {
+			return CartoAlgoConfig{}, expectedErr
+		}
+		res, err := cartoFacade.AlgoConfig(cancelCtx, 5*time.Second)
+		test.That(t, err, test.ShouldBeError)
+		test.That(t, err, test.ShouldResemble, expectedErr)
+		test.That(t, res, test.ShouldResemble, CartoAlgoConfig{})
+	})
+
+	t.Run("failure due to time out", func(t *testing.T) {
+		carto.AlgoConfigFunc = func() (CartoAlgoConfig, error) {
+			time.Sleep(50 * time.Millisecond)
+			return CartoAlgoConfig{}, nil
+		}
+		res, err := cartoFacade.AlgoConfig(cancelCtx, 1*time.Millisecond)
+		test.That(t, err, test.ShouldBeError)
+		expectedErr := multierr.Combine(errors.New(timeoutErrMessage), context.DeadlineExceeded)
+		test.That(t, err, test.ShouldResemble, expectedErr)
+		test.That(t, res, test.ShouldResemble, CartoAlgoConfig{})
+	})
+
+	cancelFunc()
+	activeBackgroundWorkers.Wait()
+}
+
+func TestStartNewTrajectory(t *testing.T) {
+	lib := CartoLibMock{}
+
+	cancelCtx, cancelFunc := context.WithCancel(context.Background())
+	activeBackgroundWorkers := sync.WaitGroup{}
+
+	cfg := GetTestConfig("my-lidar", "", "", true)
+	algoCfg := GetTestAlgoConfig(false)
+
+	cartoFacade := New(&lib, cfg, algoCfg)
+	carto := CartoMock{}
+	cartoFacade.carto = &carto
+	cartoFacade.startCGoroutine(cancelCtx, &activeBackgroundWorkers)
+
+	t.Run("success without an initial pose", func(t *testing.T) {
+		var receivedPose *TrajectoryPose
+		carto.StartNewTrajectoryFunc = func(initialPose *TrajectoryPose) (NewTrajectory, error) {
+			receivedPose = initialPose
+			return NewTrajectory{FinishedTrajectoryID: 0, TrajectoryID: 1}, nil
+		}
+		res, err := cartoFacade.StartNewTrajectory(cancelCtx, 5*time.Second, nil)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, res, test.ShouldResemble, NewTrajectory{FinishedTrajectoryID: 0, TrajectoryID: 1})
+		test.That(t, receivedPose, test.ShouldBeNil)
+	})
+
+	t.Run("success with an initial pose", func(t *testing.T) {
+		var receivedPose *TrajectoryPose
+		carto.StartNewTrajectoryFunc = func(initialPose *TrajectoryPose) (NewTrajectory, error) {
+			receivedPose = initialPose
+			return NewTrajectory{FinishedTrajectoryID: 1, TrajectoryID: 2}, nil
+		}
+		initialPose := &TrajectoryPose{X: 1, Y: 2, Theta: 3}
+		res, err := cartoFacade.StartNewTrajectory(cancelCtx, 5*time.Second, initialPose)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, res, test.ShouldResemble, NewTrajectory{FinishedTrajectoryID: 1, TrajectoryID: 2})
+		test.That(t, receivedPose, test.ShouldResemble, initialPose)
+	})
+
+	t.Run("failure", func(t *testing.T) {
+		expectedErr := errors.New("StartNewTrajectory failed")
+		carto.StartNewTrajectoryFunc = func(initialPose *TrajectoryPose) (NewTrajectory, error) {
+			return NewTrajectory{}, expectedErr
+		}
+		res, err := cartoFacade.StartNewTrajectory(cancelCtx, 5*time.Second, nil)
+		test.That(t, err, test.ShouldBeError)
+		test.That(t, err, test.ShouldResemble, expectedErr)
+		test.That(t, res, test.ShouldResemble, NewTrajectory{})
+	})
+
+	t.Run("failure due to time out", func(t *testing.T) {
+		carto.StartNewTrajectoryFunc = func(initialPose *TrajectoryPose) (NewTrajectory, error) {
+			time.Sleep(50 * time.Millisecond)
+			return NewTrajectory{}, nil
+		}
+		res, err := cartoFacade.StartNewTrajectory(cancelCtx, 1*time.Millisecond, nil)
+		test.That(t, err, test.ShouldBeError)
+		expectedErr := multierr.Combine(errors.New(timeoutErrMessage), context.DeadlineExceeded)
+		test.That(t, err, test.ShouldResemble, expectedErr)
+		test.That(t, res, test.ShouldResemble, NewTrajectory{})
+	})
+
+	cancelFunc()
+	activeBackgroundWorkers.Wait()
+}
+
+func TestSetSlamMode(t *testing.T) {
+	lib := CartoLibMock{}
+
+	cancelCtx, cancelFunc := context.WithCancel(context.Background())
+	activeBackgroundWorkers := sync.WaitGroup{}
+
+	cfg := GetTestConfig("my-lidar", "", "", true)
+	algoCfg := GetTestAlgoConfig(false)
+
+	cartoFacade := New(&lib, cfg, algoCfg)
+	carto := CartoMock{}
+	cartoFacade.carto = &carto
+	cartoFacade.startCGoroutine(cancelCtx, &activeBackgroundWorkers)
+
+	t.Run("success", func(t *testing.T) {
+		var receivedMode SlamMode
+		carto.SetSlamModeFunc = func(mode SlamMode) error {
+			receivedMode = mode
+			return nil
+		}
+		err := cartoFacade.SetSlamMode(cancelCtx, 5*time.Second, LocalizingMode)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, receivedMode, test.ShouldEqual, LocalizingMode)
+	})
+
+	t.Run("failure", func(t *testing.T) {
+		expectedErr := errors.New("SetSlamMode failed")
+		carto.SetSlamModeFunc = func(mode SlamMode) error {
+			return expectedErr
+		}
+		err := cartoFacade.SetSlamMode(cancelCtx, 5*time.Second, MappingMode)
+		test.That(t, err, test.ShouldBeError)
+		test.That(t, err, test.ShouldResemble, expectedErr)
+	})
+
+	t.Run("failure due to time out", func(t *testing.T) {
+		carto.SetSlamModeFunc = func(mode SlamMode) error {
+			time.Sleep(50 * time.Millisecond)
+			return nil
+		}
+		err := cartoFacade.SetSlamMode(cancelCtx, 1*time.Millisecond, MappingMode)
+		test.That(t, err, test.ShouldBeError)
+		expectedErr := multierr.Combine(errors.New(timeoutErrMessage), context.DeadlineExceeded)
+		test.That(t, err, test.ShouldResemble, expectedErr)
+	})
+
+	cancelFunc()
+	activeBackgroundWorkers.Wait()
+}
+
+func TestFreezeTrajectory(t *testing.T) {
+	lib := CartoLibMock{}
+
+	cancelCtx, cancelFunc := context.WithCancel(context.Background())
+	activeBackgroundWorkers := sync.WaitGroup{}
+
+	cfg := GetTestConfig("my-lidar", "", "", true)
+	algoCfg := GetTestAlgoConfig(false)
+
+	cartoFacade := New(&lib, cfg, algoCfg)
+	carto := CartoMock{}
+	cartoFacade.carto = &carto
+	cartoFacade.startCGoroutine(cancelCtx, &activeBackgroundWorkers)
+
+	t.Run("success", func(t *testing.T) {
+		receivedID := -1
+		carto.FreezeTrajectoryFunc = func(id int) error {
+			receivedID = id
+			return nil
+		}
+		err := cartoFacade.FreezeTrajectory(cancelCtx, 5*time.Second, 2)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, receivedID, test.ShouldEqual, 2)
+	})
+
+	t.Run("failure", func(t *testing.T) {
+		carto.FreezeTrajectoryFunc = func(id int) error {
+			return ErrTrajectoryActive
+		}
+		err := cartoFacade.FreezeTrajectory(cancelCtx, 5*time.Second, 3)
+		test.That(t, err, test.ShouldBeError, ErrTrajectoryActive)
+	})
+
+	t.Run("failure due to time out", func(t *testing.T) {
+		carto.FreezeTrajectoryFunc = func(id int) error {
+			time.Sleep(50 * time.Millisecond)
+			return nil
+		}
+		err := cartoFacade.FreezeTrajectory(cancelCtx, 1*time.Millisecond, 2)
+		test.That(t, err, test.ShouldBeError)
+		expectedErr := multierr.Combine(errors.New(timeoutErrMessage), context.DeadlineExceeded)
+		test.That(t, err, test.ShouldResemble, expectedErr)
+	})
+
+	cancelFunc()
+	activeBackgroundWorkers.Wait()
+}
+
+func TestRestartTrajectory(t *testing.T) {
+	lib := CartoLibMock{}
+
+	cancelCtx, cancelFunc := context.WithCancel(context.Background())
+	activeBackgroundWorkers := sync.WaitGroup{}
+
+	cfg := GetTestConfig("my-lidar", "", "", false)
+	algoCfg := GetTestAlgoConfig(false)
+
+	cartoFacade := New(&lib, cfg, algoCfg)
+	carto := CartoMock{}
+	cartoFacade.carto = &carto
+	cartoFacade.startCGoroutine(cancelCtx, &activeBackgroundWorkers)
+
+	t.Run("success with a pose hint", func(t *testing.T) {
+		var receivedPose *TrajectoryPose
+		carto.RestartTrajectoryFunc = func(initialPose *TrajectoryPose) (RestartedTrajectory, error) {
+			receivedPose = initialPose
+			return RestartedTrajectory{RestartedTrajectoryID: 1, TrajectoryID: 2}, nil
+		}
+		initialPose := &TrajectoryPose{X: 1, Y: 2, Theta: 0.5}
+		restarted, err := cartoFacade.RestartTrajectory(cancelCtx, 5*time.Second, initialPose)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, restarted, test.ShouldResemble, RestartedTrajectory{RestartedTrajectoryID: 1, TrajectoryID: 2})
+		test.That(t, receivedPose, test.ShouldResemble, initialPose)
+	})
+
+	t.Run("success without a pose hint", func(t *testing.T) {
+		receivedPose := &TrajectoryPose{}
+		carto.RestartTrajectoryFunc = func(initialPose *TrajectoryPose) (RestartedTrajectory, error) {
+			receivedPose = initialPose
+			return RestartedTrajectory{RestartedTrajectoryID: 2, TrajectoryID: 3}, nil
+		}
+		restarted, err := cartoFacade.RestartTrajectory(cancelCtx, 5*time.Second, nil)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, restarted.TrajectoryID, test.ShouldEqual, 3)
+		test.That(t, receivedPose, test.ShouldBeNil)
+	})
+
+	t.Run("the request is queued behind the requests before it", func(t *testing.T) {
+		var mu sync.Mutex
+		var calls []string
+		started := make(chan struct{})
+		release := make(chan struct{})
+		carto.AddLidarReadingFunc = func(lidar string, reading s.TimedLidarReadingResponse) error {
+			close(started)
+			<-release
+			mu.Lock()
+			defer mu.Unlock()
+			calls = append(calls, "add_lidar_reading")
+			return nil
+		}
+		carto.RestartTrajectoryFunc = func(initialPose *TrajectoryPose) (RestartedTrajectory, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			calls = append(calls, "restart_trajectory")
+			return RestartedTrajectory{}, nil
+		}
+
+		var requests sync.WaitGroup
+		requests.Add(2)
+		go func() {
+			defer requests.Done()
+			err := cartoFacade.AddLidarReading(cancelCtx, 5*time.Second, "my-lidar", s.TimedLidarReadingResponse{})
+			test.That(t, err, test.ShouldBeNil)
+		}()
+		<-started
+		go func() {
+			defer requests.Done()
+			_, err := cartoFacade.RestartTrajectory(cancelCtx, 5*time.Second, nil)
+			test.That(t, err, test.ShouldBeNil)
+		}()
+		// the restart waits for the worker goroutine, which is adding the lidar reading
+		testutils.WaitForAssertion(t, func(tb testing.TB) {
+			tb.Helper()
+			test.That(tb, cartoFacade.Status().QueueDepth, test.ShouldEqual, 1)
+		})
+		mu.Lock()
+		test.That(t, calls, test.ShouldBeEmpty)
+		mu.Unlock()
+
+		close(release)
+		requests.Wait()
+		test.That(t, calls, test.ShouldResemble, []string{"add_lidar_reading", "restart_trajectory"})
+	})
+
+	t.Run("failure", func(t *testing.T) {
+		carto.RestartTrajectoryFunc = func(initialPose *TrajectoryPose) (RestartedTrajectory, error) {
+			return RestartedTrajectory{}, ErrNotLocalizing
+		}
+		_, err := cartoFacade.RestartTrajectory(cancelCtx, 5*time.Second, nil)
+		test.That(t, err, test.ShouldBeError, ErrNotLocalizing)
+	})
+
+	t.Run("failure due to time out", func(t *testing.T) {
+		carto.RestartTrajectoryFunc = func(initialPose *TrajectoryPose) (RestartedTrajectory, error) {
+			time.Sleep(50 * time.Millisecond)
+			return RestartedTrajectory{}, nil
+		}
+		_, err := cartoFacade.RestartTrajectory(cancelCtx, 1*time.Millisecond, nil)
+		test.That(t, err, test.ShouldBeError)
+		expectedErr := multierr.Combine(errors.New(timeoutErrMessage), context.DeadlineExceeded)
+		test.That(t, err, test.ShouldResemble, expectedErr)
+	})
+
+	cancelFunc()
+	activeBackgroundWorkers.Wait()
+}
+
+func TestTrajectories(t *testing.T) {
+	lib := CartoLibMock{}
+
+	cancelCtx, cancelFunc := context.WithCancel(context.Background())
+	activeBackgroundWorkers := sync.WaitGroup{}
+
+	cfg := GetTestConfig("my-lidar", "", "", true)
+	algoCfg := GetTestAlgoConfig(false)
+
+	cartoFacade := New(&lib, cfg, algoCfg)
+	carto := CartoMock{}
+	cartoFacade.carto = &carto
+	cartoFacade.startCGoroutine(cancelCtx, &activeBackgroundWorkers)
+
+	t.Run("success", func(t *testing.T) {
+		expected := []Trajectory{{ID: 0, State: TrajectoryFrozen}, {ID: 1, State: TrajectoryActive}}
+		carto.TrajectoriesFunc = func() ([]Trajectory, error) {
+			return expected, nil
+		}
+		res, err := cartoFacade.Trajectories(cancelCtx, 5*time.Second)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, res, test.ShouldResemble, expected)
+	})
+
+	t.Run("failure", func(t *testing.T) {
+		expectedErr := errors.New("Trajectories failed")
+		carto.TrajectoriesFunc = func() ([]Trajectory, error) {
+			return nil, expectedErr
+		}
+		res, err := cartoFacade.Trajectories(cancelCtx, 5*time.Second)
+		test.That(t, err, test.ShouldBeError)
+		test.That(t, err, test.ShouldResemble, expectedErr)
+		test.That(t, res, test.ShouldBeNil)
+	})
+
+	t.Run("failure due to time out", func(t *testing.T) {
+		carto.TrajectoriesFunc = func() ([]Trajectory, error) {
+			time.Sleep(50 * time.Millisecond)
+			return nil, nil
+		}
+		res, err := cartoFacade.Trajectories(cancelCtx, 1*time.Millisecond)
+		test.That(t, err, test.ShouldBeError)
+		expectedErr := multierr.Combine(errors.New(timeoutErrMessage), context.DeadlineExceeded)
+		test.That(t, err, test.ShouldResemble, expectedErr)
+		test.That(t, res, test.ShouldBeNil)
+	})
+
+	cancelFunc()
+	activeBackgroundWorkers.Wait()
+}
+
+func TestTrajectory(t *testing.T) {
+	lib := CartoLibMock{}
+
+	cancelCtx, cancelFunc := context.WithCancel(context.Background())
+	activeBackgroundWorkers := sync.WaitGroup{}
+
+	cfg := GetTestConfig("my-lidar", "", "", true)
+	algoCfg := GetTestAlgoConfig(false)
+
+	cartoFacade := New(&lib, cfg, algoCfg)
+	carto := CartoMock{}
+	cartoFacade.carto = &carto
+	cartoFacade.startCGoroutine(cancelCtx, &activeBackgroundWorkers)
+
+	t.Run("success", func(t *testing.T) {
+		expected := []TrajectoryNode{
+			{TrajectoryID: 0, Time: time.UnixMilli(1000), Pose: spatialmath.NewZeroPose()},
+			{TrajectoryID: 0, Time: time.UnixMilli(2000), Pose: spatialmath.NewPoseFromPoint(r3.Vector{X: 100})},
+		}
+		carto.TrajectoryFunc = func() ([]TrajectoryNode, error) {
+			return expected, nil
+		}
+		res, err := cartoFacade.Trajectory(cancelCtx, 5*time.Second)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, res, test.ShouldResemble, expected)
+	})
+
+	t.Run("failure", func(t *testing.T) {
+		expectedErr := errors.New("Trajectory failed")
+		carto.TrajectoryFunc = func() ([]TrajectoryNode, error) {
+			return nil, expectedErr
+		}
+		res, err := cartoFacade.Trajectory(cancelCtx, 5*time.Second)
+		test.That(t, err, test.ShouldBeError)
+		test.That(t, err, test.ShouldResemble, expectedErr)
+		test.That(t, res, test.ShouldBeNil)
+	})
+
+	t.Run("failure due to time out", func(t *testing.T) {
+		carto.TrajectoryFunc = func() ([]TrajectoryNode, error) {
+			time.Sleep(50 * time.Millisecond)
+			return nil, nil
+		}
+		res, err := cartoFacade.Trajectory(cancelCtx, 1*time.Millisecond)
+		test.That(t, err, test.ShouldBeError)
+		expectedErr := multierr.Combine(errors.New(timeoutErrMessage), context.DeadlineExceeded)
+		test.That(t, err, test.ShouldResemble, expectedErr)
+		test.That(t, res, test.ShouldBeNil)
+	})
+
+	cancelFunc()
+	activeBackgroundWorkers.Wait()
+}
+
+func TestSubmapList(t *testing.T) {
+	lib := CartoLibMock{}
+
+	cancelCtx, cancelFunc := context.WithCancel(context.Background())
+	activeBackgroundWorkers := sync.WaitGroup{}
+
+	cfg := GetTestConfig("my-lidar", "", "", true)
+	algoCfg := GetTestAlgoConfig(false)
+
+	cartoFacade := New(&lib, cfg, algoCfg)
+	carto := CartoMock{}
+	cartoFacade.carto = &carto
+	cartoFacade.startCGoroutine(cancelCtx, &activeBackgroundWorkers)
+
+	t.Run("success", func(t *testing.T) {
+		expected := []Submap{
+			{ID: SubmapID{TrajectoryID: 0, SubmapIndex: 0}, Version: 180, Pose: spatialmath.NewZeroPose()},
+			{ID: SubmapID{TrajectoryID: 0, SubmapIndex: 1}, Version: 90, Pose: spatialmath.NewPoseFromPoint(r3.Vector{X: 100})},
+		}
+		carto.SubmapListFunc = func() ([]Submap, error) {
+			return expected, nil
+		}
+		res, err := cartoFacade.SubmapList(cancelCtx, 5*time.Second)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, res, test.ShouldResemble, expected)
+	})
+
+	t.Run("failure", func(t *testing.T) {
+		expectedErr := errors.New("SubmapList failed")
+		carto.SubmapListFunc = func() ([]Submap, error) {
+			return nil, expectedErr
+		}
+		res, err := cartoFacade.SubmapList(cancelCtx, 5*time.Second)
+		test.That(t, err, test.ShouldBeError)
+		test.That(t, err, test.ShouldResemble, expectedErr)
+		test.That(t, res, test.ShouldBeNil)
+	})
+
+	t.Run("failure due to time out", func(t *testing.T) {
+		carto.SubmapListFunc = func() ([]Submap, error) {
+			time.Sleep(50 * time.Millisecond)
+			return nil, nil
+		}
+		res, err := cartoFacade.SubmapList(cancelCtx, 1*time.Millisecond)
+		test.That(t, err, test.ShouldBeError)
+		expectedErr := multierr.Combine(errors.New(timeoutErrMessage), context.DeadlineExceeded)
+		test.That(t, err, test.ShouldResemble, expectedErr)
+		test.That(t, res, test.ShouldBeNil)
+	})
+
+	cancelFunc()
+	activeBackgroundWorkers.Wait()
+}
+
+func TestSubmap(t *testing.T) {
+	lib := CartoLibMock{}
+
+	cancelCtx, cancelFunc := context.WithCancel(context.Background())
+	activeBackgroundWorkers := sync.WaitGroup{}
+
+	cfg := GetTestConfig("my-lidar", "", "", true)
+	algoCfg := GetTestAlgoConfig(false)
+
+	cartoFacade := New(&lib, cfg, algoCfg)
+	carto := CartoMock{}
+	cartoFacade.carto = &carto
+	cartoFacade.startCGoroutine(cancelCtx, &activeBackgroundWorkers)
+
+	id := SubmapID{TrajectoryID: 1, SubmapIndex: 2}
+
+	t.Run("success", func(t *testing.T) {
+		expected := SubmapPointCloud{
+			Submap:     Submap{ID: id, Version: 180, Pose: spatialmath.NewZeroPose()},
+			PointCloud: []byte("pcd"),
+		}
+		carto.SubmapFunc = func(requested SubmapID) (SubmapPointCloud, error) {
+			test.That(t, requested, test.ShouldResemble, id)
+			return expected, nil
+		}
+		res, err := cartoFacade.Submap(cancelCtx, 5*time.Second, id)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, res, test.ShouldResemble, expected)
+	})
+
+	t.Run("failure", func(t *testing.T) {
+		carto.SubmapFunc = func(requested SubmapID) (SubmapPointCloud, error) {
+			return SubmapPointCloud{}, ErrSubmapNotFound
+		}
+		res, err := cartoFacade.Submap(cancelCtx, 5*time.Second, id)
+		test.That(t, err, test.ShouldBeError, ErrSubmapNotFound)
+		test.That(t, res, test.ShouldResemble, SubmapPointCloud{})
+	})
+
+	t.Run("failure due to time out", func(t *testing.T) {
+		carto.SubmapFunc = func(requested SubmapID) (SubmapPointCloud, error) {
+			time.Sleep(50 * time.Millisecond)
+			return SubmapPointCloud{}, nil
+		}
+		res, err := cartoFacade.Submap(cancelCtx, 1*time.Millisecond, id)
+		test.That(t, err, test.ShouldBeError)
+		expectedErr := multierr.Combine(errors.New(timeoutErrMessage), context.DeadlineExceeded)
+		test.That(t, err, test.ShouldResemble, expectedErr)
+		test.That(t, res, test.ShouldResemble, SubmapPointCloud{})
+	})
+
+	cancelFunc()
+	activeBackgroundWorkers.Wait()
+}
+
+func TestSlamStats(t *testing.T) {
+	lib := CartoLibMock{}
+
+	cancelCtx, cancelFunc := context.WithCancel(context.Background())
+	activeBackgroundWorkers := sync.WaitGroup{}
+
+	cfg := GetTestConfig("my-lidar", "", "", true)
+	algoCfg := GetTestAlgoConfig(false)
+
+	cartoFacade := New(&lib, cfg, algoCfg)
+	carto := CartoMock{}
+	cartoFacade.carto = &carto
+	cartoFacade.startCGoroutine(cancelCtx, &activeBackgroundWorkers)
+
+	t.Run("success", func(t *testing.T) {
+		expected := SlamStats{NumNodes: 10, NumUnoptimizedNodes: 4, OldestUnoptimizedNodeAge: 3 * time.Second}
+		carto.SlamStatsFunc = func() (SlamStats, error) {
+			return expected, nil
+		}
+		res, err := cartoFacade.SlamStats(cancelCtx, 5*time.Second)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, res, test.ShouldResemble, expected)
+	})
+
+	t.Run("failure", func(t *testing.T) {
+		expectedErr := errors.New("SlamStats failed")
+		carto.SlamStatsFunc = func() (SlamStats, error) {
+			return SlamStats{}, expectedErr
+		}
+		res, err := cartoFacade.SlamStats(cancelCtx, 5*time.Second)
+		test.That(t, err, test.ShouldResemble, expectedErr)
+		test.That(t, res, test.ShouldResemble, SlamStats{})
+	})
+
+	cancelFunc()
+	activeBackgroundWorkers.Wait()
+}
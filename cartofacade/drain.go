@@ -0,0 +1,70 @@
+package cartofacade
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"go.uber.org/multierr"
+)
+
+// ErrDrained is the error returned from AddLidarReading, AddIMUReading and AddOdometerReading once the
+// cartofacade has been drained, as no sensor readings may be added while it is being shut down.
+var ErrDrained = errors.New("cartofacade has been drained and no longer accepts sensor readings")
+
+// ingestionGate tracks the sensor readings that are being added to the cartofacade so that it can be drained
+// of them. It is kept behind a pointer so that a CartoFacade can be copied.
+type ingestionGate struct {
+	// mu is held for reading while a sensor reading is added and for writing while draining, so that draining
+	// waits for the readings that are being added.
+	mu      sync.RWMutex
+	drained bool
+}
+
+// enter returns false if the cartofacade has been drained. Otherwise the caller may add a sensor reading and
+// must call exit once it has been added.
+func (g *ingestionGate) enter() bool {
+	if g == nil {
+		return true
+	}
+	g.mu.RLock()
+	if g.drained {
+		g.mu.RUnlock()
+		return false
+	}
+	return true
+}
+
+func (g *ingestionGate) exit() {
+	if g == nil {
+		return
+	}
+	g.mu.RUnlock()
+}
+
+// Drain stops the cartofacade from accepting sensor readings and waits until the ones that are being added
+// have been added or have failed. Sensor readings added after Drain was called fail with ErrDrained. It is
+// called during shutdown, after the sensor processes have stopped and before the cartofacade is stopped.
+func (cf *CartoFacade) Drain(ctx context.Context, timeout time.Duration) error {
+	if cf.ingestion == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	drained := make(chan struct{})
+	go func() {
+		cf.ingestion.mu.Lock()
+		cf.ingestion.drained = true
+		cf.ingestion.mu.Unlock()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+		return nil
+	case <-ctx.Done():
+		return multierr.Combine(errors.New("timeout draining cartographer"), ctx.Err())
+	}
+}
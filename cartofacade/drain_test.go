@@ -0,0 +1,96 @@
+package cartofacade
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.viam.com/test"
+
+	s "github.com/viam-modules/viam-cartographer/sensors"
+)
+
+func TestDrain(t *testing.T) {
+	lib := CartoLibMock{}
+
+	cancelCtx, cancelFunc := context.WithCancel(context.Background())
+	activeBackgroundWorkers := sync.WaitGroup{}
+
+	cfg := GetTestConfig("my-lidar", "my-movement-sensor", "", true)
+	algoCfg := GetTestAlgoConfig(false)
+
+	cartoFacade := New(&lib, cfg, algoCfg)
+	var drained atomic.Bool
+	var numAdded, numAddedAfterDrain atomic.Int64
+	add := func() error {
+		// readings take a while to be added so that some are in progress when draining
+		time.Sleep(time.Millisecond)
+		if drained.Load() {
+			numAddedAfterDrain.Add(1)
+		}
+		numAdded.Add(1)
+		return nil
+	}
+	carto := CartoMock{}
+	carto.AddLidarReadingFunc = func(string, s.TimedLidarReadingResponse) error { return add() }
+	carto.AddIMUReadingFunc = func(string, s.TimedIMUReadingResponse) error { return add() }
+	carto.StopFunc = func() error { return nil }
+	cartoFacade.carto = &carto
+	cartoFacade.startCGoroutine(cancelCtx, &activeBackgroundWorkers)
+
+	// add readings concurrently until they are rejected
+	ingestionWorkers := sync.WaitGroup{}
+	rejected := make(chan error, 8)
+	for i := 0; i < cap(rejected); i++ {
+		ingestionWorkers.Add(1)
+		go func(i int) {
+			defer ingestionWorkers.Done()
+			for {
+				var err error
+				if i%2 == 0 {
+					err = cartoFacade.AddLidarReading(cancelCtx, 5*time.Second, "my-lidar", s.TimedLidarReadingResponse{})
+				} else {
+					err = cartoFacade.AddIMUReading(cancelCtx, 5*time.Second, "my-movement-sensor", s.TimedIMUReadingResponse{})
+				}
+				if err != nil {
+					rejected <- err
+					return
+				}
+			}
+		}(i)
+	}
+
+	for numAdded.Load() < 50 {
+		time.Sleep(time.Millisecond)
+	}
+	test.That(t, cartoFacade.Drain(cancelCtx, 5*time.Second), test.ShouldBeNil)
+	drained.Store(true)
+	ingestionWorkers.Wait()
+	close(rejected)
+
+	t.Run("sensor readings added after draining fail", func(t *testing.T) {
+		for err := range rejected {
+			test.That(t, errors.Is(err, ErrDrained), test.ShouldBeTrue)
+		}
+		err := cartoFacade.AddOdometerReading(cancelCtx, 5*time.Second, "my-movement-sensor", s.TimedOdometerReadingResponse{})
+		test.That(t, err, test.ShouldBeError, ErrDrained)
+	})
+
+	t.Run("no sensor reading reaches cartographer after draining", func(t *testing.T) {
+		test.That(t, numAddedAfterDrain.Load(), test.ShouldEqual, 0)
+	})
+
+	t.Run("draining again succeeds", func(t *testing.T) {
+		test.That(t, cartoFacade.Drain(cancelCtx, 5*time.Second), test.ShouldBeNil)
+	})
+
+	t.Run("the drained cartofacade can be stopped", func(t *testing.T) {
+		test.That(t, cartoFacade.Stop(cancelCtx, 5*time.Second), test.ShouldBeNil)
+	})
+
+	cancelFunc()
+	activeBackgroundWorkers.Wait()
+}
@@ -0,0 +1,97 @@
+package cartofacade
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// DutyCycleWindow is the length of the windows over which the duty cycle of the worker goroutine is computed.
+const DutyCycleWindow = 10 * time.Second
+
+// dutyCycle accumulates the time the worker goroutine spends calling into C per window. It is kept behind a
+// pointer so that a CartoFacade can be copied.
+type dutyCycle struct {
+	mu          sync.Mutex
+	window      time.Duration
+	windowStart time.Time
+	busy        time.Duration
+	// last is the fraction of the last completed window that was spent calling into C.
+	last      float64
+	completed bool
+}
+
+func newDutyCycle(window time.Duration, now time.Time) *dutyCycle {
+	return &dutyCycle{window: window, windowStart: now}
+}
+
+// record adds a call into C from start to end, splitting it across the windows it spans.
+func (dc *dutyCycle) record(start, end time.Time) {
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+	dc.advance(start)
+	for {
+		windowEnd := dc.windowStart.Add(dc.window)
+		if end.Before(windowEnd) {
+			dc.busy += end.Sub(start)
+			return
+		}
+		dc.busy += windowEnd.Sub(start)
+		dc.advance(windowEnd)
+		start = windowEnd
+	}
+}
+
+// advance completes all windows that ended before now. The worker goroutine was idle for the remainder of them.
+func (dc *dutyCycle) advance(now time.Time) {
+	numCompleted := now.Sub(dc.windowStart) / dc.window
+	if numCompleted < 1 {
+		return
+	}
+	dc.last = float64(dc.busy) / float64(dc.window)
+	if numCompleted > 1 {
+		// the windows after the first completed one were idle throughout
+		dc.last = 0
+	}
+	dc.completed = true
+	dc.busy = 0
+	dc.windowStart = dc.windowStart.Add(numCompleted * dc.window)
+}
+
+// DutyCycle returns the percentage of the last completed window of DutyCycleWindow that the worker goroutine
+// spent calling into C, and false if no window has completed yet.
+func (cf *CartoFacade) DutyCycle() (float64, bool) {
+	if cf.dutyCycle == nil {
+		return 0, false
+	}
+	cf.dutyCycle.mu.Lock()
+	defer cf.dutyCycle.mu.Unlock()
+	cf.dutyCycle.advance(time.Now())
+	return 100 * cf.dutyCycle.last, cf.dutyCycle.completed
+}
+
+// StartDutyCycleMonitor starts a background goroutine that calls onWindow with the duty cycle of the worker
+// goroutine, in percent, whenever a window has completed.
+func (cf *CartoFacade) StartDutyCycleMonitor(
+	ctx context.Context,
+	onWindow func(dutyCyclePercent float64),
+	activeBackgroundWorkers *sync.WaitGroup,
+) {
+	activeBackgroundWorkers.Add(1)
+	go func() {
+		defer activeBackgroundWorkers.Done()
+
+		ticker := time.NewTicker(cf.dutyCycle.window)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			if dutyCyclePercent, ok := cf.DutyCycle(); ok {
+				onWindow(dutyCyclePercent)
+			}
+		}
+	}()
+}
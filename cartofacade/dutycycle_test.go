@@ -0,0 +1,111 @@
+package cartofacade
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"go.viam.com/test"
+	"go.viam.com/utils/testutils"
+)
+
+func TestDutyCycleRecord(t *testing.T) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	at := func(ms int) time.Time { return start.Add(time.Duration(ms) * time.Millisecond) }
+
+	t.Run("no window has completed before the first window ends", func(t *testing.T) {
+		dc := newDutyCycle(time.Second, start)
+		dc.record(at(0), at(500))
+		test.That(t, dc.completed, test.ShouldBeFalse)
+	})
+
+	t.Run("the duty cycle is the busy fraction of the last completed window", func(t *testing.T) {
+		dc := newDutyCycle(time.Second, start)
+		dc.record(at(0), at(200))
+		dc.record(at(400), at(500))
+		dc.record(at(1000), at(1100))
+		test.That(t, dc.completed, test.ShouldBeTrue)
+		test.That(t, dc.last, test.ShouldAlmostEqual, 0.3)
+	})
+
+	t.Run("calls spanning windows are split across them", func(t *testing.T) {
+		dc := newDutyCycle(time.Second, start)
+		dc.record(at(600), at(2300))
+		test.That(t, dc.last, test.ShouldAlmostEqual, 1)
+		dc.advance(at(3000))
+		test.That(t, dc.last, test.ShouldAlmostEqual, 0.3)
+	})
+
+	t.Run("idle windows have a duty cycle of zero", func(t *testing.T) {
+		dc := newDutyCycle(time.Second, start)
+		dc.record(at(0), at(900))
+		dc.advance(at(1500))
+		test.That(t, dc.last, test.ShouldAlmostEqual, 0.9)
+		dc.advance(at(3500))
+		test.That(t, dc.last, test.ShouldAlmostEqual, 0)
+	})
+}
+
+func TestDutyCycle(t *testing.T) {
+	lib := CartoLibMock{}
+
+	cancelCtx, cancelFunc := context.WithCancel(context.Background())
+	activeBackgroundWorkers := sync.WaitGroup{}
+
+	cfg := GetTestConfig("my-lidar", "", "", true)
+	algoCfg := GetTestAlgoConfig(false)
+
+	cartoFacade := New(&lib, cfg, algoCfg)
+	window := 200 * time.Millisecond
+	cartoFacade.dutyCycle = newDutyCycle(window, time.Now())
+	carto := CartoMock{}
+	carto.PositionFunc = func() (Position, error) {
+		time.Sleep(10 * time.Millisecond)
+		return Position{}, nil
+	}
+	cartoFacade.carto = &carto
+	cartoFacade.startCGoroutine(cancelCtx, &activeBackgroundWorkers)
+
+	dutyCycles := make(chan float64, 100)
+	cartoFacade.StartDutyCycleMonitor(cancelCtx, func(dutyCyclePercent float64) {
+		dutyCycles <- dutyCyclePercent
+	}, &activeBackgroundWorkers)
+
+	t.Run("no duty cycle is reported before a window has completed", func(t *testing.T) {
+		_, ok := cartoFacade.DutyCycle()
+		test.That(t, ok, test.ShouldBeFalse)
+	})
+
+	t.Run("the duty cycle is the fraction of time spent calling into C", func(t *testing.T) {
+		// each call takes 10ms and is followed by 30ms without a call
+		stop := time.Now().Add(3 * window)
+		for time.Now().Before(stop) {
+			_, err := cartoFacade.Position(cancelCtx, 5*time.Second)
+			test.That(t, err, test.ShouldBeNil)
+			time.Sleep(30 * time.Millisecond)
+		}
+		dutyCyclePercent, ok := cartoFacade.DutyCycle()
+		test.That(t, ok, test.ShouldBeTrue)
+		test.That(t, dutyCyclePercent, test.ShouldBeBetween, 10, 40)
+
+		select {
+		case dutyCyclePercent := <-dutyCycles:
+			test.That(t, dutyCyclePercent, test.ShouldBeBetween, 0, 40)
+		case <-time.After(5 * window):
+			t.Fatal("the duty cycle monitor did not report a window")
+		}
+	})
+
+	t.Run("the duty cycle drops to zero while idle", func(t *testing.T) {
+		testutils.WaitForAssertion(t, func(tb testing.TB) {
+			tb.Helper()
+			dutyCyclePercent, ok := cartoFacade.DutyCycle()
+			test.That(tb, ok, test.ShouldBeTrue)
+			test.That(tb, dutyCyclePercent, test.ShouldEqual, 0)
+		})
+	})
+
+	cancelFunc()
+	activeBackgroundWorkers.Wait()
+}
@@ -0,0 +1,82 @@
+package cartofacade
+
+import (
+	"context"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// stackDumpBufferSize bounds the size of the goroutine stack dump passed to the hang handler.
+const stackDumpBufferSize = 1024 * 1024
+
+// heartbeat records the liveness of the worker goroutine that calls into C. It is kept behind a pointer so
+// that a CartoFacade can be copied.
+type heartbeat struct {
+	// callStartedAtUnixNano is the time at which the call into C that is currently in progress started,
+	// or 0 if the worker goroutine is not calling into C. It is the only state the worker goroutine writes.
+	callStartedAtUnixNano atomic.Int64
+	unresponsive          atomic.Bool
+}
+
+// HangHandler is called by the hang monitor once per call into C that has been in progress for longer than
+// the hang threshold, with the duration of the call so far and a stack dump of all goroutines.
+type HangHandler func(callDuration time.Duration, stackDump []byte)
+
+// Unresponsive returns whether a call into C has been in progress for longer than the hang threshold of the
+// hang monitor. It returns to false once the call returns.
+func (cf *CartoFacade) Unresponsive() bool {
+	return cf.heartbeat != nil && cf.heartbeat.unresponsive.Load()
+}
+
+// StartHangMonitor starts a background goroutine that checks the heartbeat of the worker goroutine and marks
+// the CartoFacade unresponsive if a single call into C takes longer than hangThreshold. A non positive
+// hangThreshold disables the monitor.
+func (cf *CartoFacade) StartHangMonitor(
+	ctx context.Context,
+	hangThreshold time.Duration,
+	onHang HangHandler,
+	activeBackgroundWorkers *sync.WaitGroup,
+) {
+	if hangThreshold <= 0 {
+		return
+	}
+	activeBackgroundWorkers.Add(1)
+	go func() {
+		defer activeBackgroundWorkers.Done()
+
+		ticker := time.NewTicker(max(hangThreshold/4, time.Millisecond))
+		defer ticker.Stop()
+
+		var hungCallStartedAt int64
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			callStartedAt := cf.heartbeat.callStartedAtUnixNano.Load()
+			if callStartedAt == 0 || callStartedAt != hungCallStartedAt {
+				cf.heartbeat.unresponsive.Store(false)
+			}
+			if callStartedAt == 0 || callStartedAt == hungCallStartedAt {
+				continue
+			}
+
+			callDuration := time.Since(time.Unix(0, callStartedAt))
+			if callDuration <= hangThreshold {
+				continue
+			}
+
+			hungCallStartedAt = callStartedAt
+			cf.heartbeat.unresponsive.Store(true)
+			if onHang != nil {
+				stackDump := make([]byte, stackDumpBufferSize)
+				stackDump = stackDump[:runtime.Stack(stackDump, true)]
+				onHang(callDuration, stackDump)
+			}
+		}
+	}()
+}
@@ -0,0 +1,87 @@
+package cartofacade
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"go.viam.com/test"
+	"go.viam.com/utils/testutils"
+)
+
+func TestHangMonitor(t *testing.T) {
+	lib := CartoLibMock{}
+
+	cancelCtx, cancelFunc := context.WithCancel(context.Background())
+	activeBackgroundWorkers := sync.WaitGroup{}
+
+	cfg := GetTestConfig("my-lidar", "", "", true)
+	algoCfg := GetTestAlgoConfig(false)
+
+	cartoFacade := New(&lib, cfg, algoCfg)
+	carto := CartoMock{}
+	cartoFacade.carto = &carto
+	cartoFacade.startCGoroutine(cancelCtx, &activeBackgroundWorkers)
+
+	hangThreshold := 50 * time.Millisecond
+	type hang struct {
+		callDuration time.Duration
+		stackDump    []byte
+	}
+	hangs := make(chan hang, 10)
+	cartoFacade.StartHangMonitor(cancelCtx, hangThreshold, func(callDuration time.Duration, stackDump []byte) {
+		hangs <- hang{callDuration: callDuration, stackDump: stackDump}
+	}, &activeBackgroundWorkers)
+
+	t.Run("calls that return within the hang threshold are not reported", func(t *testing.T) {
+		carto.PositionFunc = func() (Position, error) {
+			return Position{}, nil
+		}
+		for i := 0; i < 5; i++ {
+			_, err := cartoFacade.Position(cancelCtx, 5*time.Second)
+			test.That(t, err, test.ShouldBeNil)
+		}
+		time.Sleep(2 * hangThreshold)
+		test.That(t, cartoFacade.heartbeat.callStartedAtUnixNano.Load(), test.ShouldEqual, int64(0))
+		test.That(t, cartoFacade.Unresponsive(), test.ShouldBeFalse)
+		test.That(t, len(hangs), test.ShouldEqual, 0)
+	})
+
+	t.Run("a call that never returns is detected once and cleared when it returns", func(t *testing.T) {
+		release := make(chan struct{})
+		carto.PositionFunc = func() (Position, error) {
+			<-release
+			return Position{}, nil
+		}
+		_, err := cartoFacade.Position(cancelCtx, 10*time.Millisecond)
+		test.That(t, err, test.ShouldNotBeNil)
+
+		select {
+		case h := <-hangs:
+			test.That(t, h.callDuration, test.ShouldBeGreaterThan, hangThreshold)
+			test.That(t, string(h.stackDump), test.ShouldContainSubstring, "startCGoroutine")
+		case <-time.After(5 * time.Second):
+			t.Fatal("hang was not detected")
+		}
+		test.That(t, cartoFacade.Unresponsive(), test.ShouldBeTrue)
+
+		// the same hung call is only reported once
+		time.Sleep(4 * hangThreshold)
+		test.That(t, len(hangs), test.ShouldEqual, 0)
+		test.That(t, cartoFacade.Unresponsive(), test.ShouldBeTrue)
+
+		close(release)
+		testutils.WaitForAssertion(t, func(tb testing.TB) {
+			tb.Helper()
+			test.That(tb, cartoFacade.Unresponsive(), test.ShouldBeFalse)
+		})
+	})
+
+	t.Run("a zero value CartoFacade is never unresponsive", func(t *testing.T) {
+		test.That(t, (&CartoFacade{}).Unresponsive(), test.ShouldBeFalse)
+	})
+
+	cancelFunc()
+	activeBackgroundWorkers.Wait()
+}
@@ -0,0 +1,101 @@
+package cartofacade
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"time"
+)
+
+// InternalStateChunkSize is the maximum number of bytes of the internal state that are copied out of the
+// cartographer library per request when it is streamed.
+const InternalStateChunkSize = 1024 * 1024
+
+// InternalStateStream calls into the cartofacade C code to open a stream of the internal state, which is read out of
+// the library InternalStateChunkSize bytes at a time rather than copied in full. Each read is a request to the
+// worker goroutine with the given timeout. The returned reader must be closed to release the stream. Returns
+// ErrInternalStateStreamUnavailable if the library does not support streaming the internal state.
+func (cf *CartoFacade) InternalStateStream(ctx context.Context, timeout time.Duration) (io.ReadCloser, error) {
+	if err := cf.cartoLib.Capabilities().Require(FeatureInternalStateStream); err != nil {
+		return nil, err
+	}
+	untyped, err := cf.request(ctx, internalStateStream, emptyRequestParams, timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	handle, ok := untyped.(*internalStateStreamHandle)
+	if !ok {
+		return nil, errors.New("unable to cast response from cartofacade to an internal state stream")
+	}
+
+	return &internalStateReader{ctx: ctx, cf: cf, timeout: timeout, handle: handle}, nil
+}
+
+// internalStateReader reads an internal state stream opened in the cartographer library.
+type internalStateReader struct {
+	ctx     context.Context
+	cf      *CartoFacade
+	timeout time.Duration
+	handle  *internalStateStreamHandle
+
+	mu      sync.Mutex
+	pending []byte
+	eof     bool
+	closed  bool
+}
+
+// Read reads the next bytes of the internal state, requesting another chunk from the library once the last one
+// has been read.
+func (r *internalStateReader) Read(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return 0, errors.New("read of a closed internal state stream")
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	for len(r.pending) == 0 {
+		if r.eof {
+			return 0, io.EOF
+		}
+		requestParams := map[RequestParamType]interface{}{
+			stream:  r.handle,
+			maxSize: InternalStateChunkSize,
+		}
+		untyped, err := r.cf.request(r.ctx, internalStateChunk, requestParams, r.timeout)
+		if err != nil {
+			return 0, err
+		}
+		chunk, ok := untyped.([]byte)
+		if !ok {
+			return 0, errors.New("unable to cast response from cartofacade to a byte slice")
+		}
+		// an empty chunk means all of the internal state has been read
+		r.eof = len(chunk) == 0
+		r.pending = chunk
+	}
+
+	n := copy(p, r.pending)
+	r.pending = r.pending[n:]
+	return n, nil
+}
+
+// Close releases the stream in the library. It is still released if the context the stream was opened with has
+// been cancelled, and later calls do nothing.
+func (r *internalStateReader) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return nil
+	}
+	r.closed = true
+	r.pending = nil
+
+	requestParams := map[RequestParamType]interface{}{stream: r.handle}
+	_, err := r.cf.request(context.WithoutCancel(r.ctx), closeInternalStateStream, requestParams, r.timeout)
+	return err
+}
@@ -0,0 +1,119 @@
+package cartofacade
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"go.viam.com/test"
+)
+
+func TestInternalStateStream(t *testing.T) {
+	lib := CartoLibMock{}
+
+	cancelCtx, cancelFunc := context.WithCancel(context.Background())
+	activeBackgroundWorkers := sync.WaitGroup{}
+
+	cfg := GetTestConfig("my-lidar", "", "", true)
+	algoCfg := GetTestAlgoConfig(false)
+
+	cartoFacade := New(&lib, cfg, algoCfg)
+	carto := CartoMock{}
+	cartoFacade.carto = &carto
+	cartoFacade.startCGoroutine(cancelCtx, &activeBackgroundWorkers)
+
+	internalState := make([]byte, 2*InternalStateChunkSize+1)
+	for i := range internalState {
+		internalState[i] = byte(i % 251)
+	}
+	handle := &internalStateStreamHandle{}
+	// mockStream streams internalState, returning an empty chunk once it has been read
+	mockStream := func() (*int, *int) {
+		var offset, numClosed int
+		carto.InternalStateStreamFunc = func() (*internalStateStreamHandle, error) {
+			return handle, nil
+		}
+		carto.InternalStateChunkFunc = func(stream *internalStateStreamHandle, maxSize int) ([]byte, error) {
+			if stream != handle {
+				return nil, errors.New("unknown stream")
+			}
+			end := min(offset+maxSize, len(internalState))
+			chunk := internalState[offset:end]
+			offset = end
+			return chunk, nil
+		}
+		carto.CloseInternalStateStreamFunc = func(stream *internalStateStreamHandle) error {
+			numClosed++
+			return nil
+		}
+		return &offset, &numClosed
+	}
+
+	t.Run("success", func(t *testing.T) {
+		_, numClosed := mockStream()
+		stream, err := cartoFacade.InternalStateStream(cancelCtx, 5*time.Second)
+		test.That(t, err, test.ShouldBeNil)
+
+		streamed, err := io.ReadAll(stream)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, streamed, test.ShouldResemble, internalState)
+
+		test.That(t, stream.Close(), test.ShouldBeNil)
+		test.That(t, stream.Close(), test.ShouldBeNil)
+		test.That(t, *numClosed, test.ShouldEqual, 1)
+		_, err = stream.Read(make([]byte, 1))
+		test.That(t, err, test.ShouldBeError)
+	})
+
+	t.Run("reads no more than a chunk at a time from cartographer", func(t *testing.T) {
+		offset, _ := mockStream()
+		stream, err := cartoFacade.InternalStateStream(cancelCtx, 5*time.Second)
+		test.That(t, err, test.ShouldBeNil)
+
+		n, err := stream.Read(make([]byte, 10))
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, n, test.ShouldEqual, 10)
+		test.That(t, *offset, test.ShouldEqual, InternalStateChunkSize)
+
+		test.That(t, stream.Close(), test.ShouldBeNil)
+	})
+
+	t.Run("closes the stream after the context is cancelled", func(t *testing.T) {
+		_, numClosed := mockStream()
+		ctx, cancel := context.WithCancel(cancelCtx)
+		stream, err := cartoFacade.InternalStateStream(ctx, 5*time.Second)
+		test.That(t, err, test.ShouldBeNil)
+
+		cancel()
+		test.That(t, stream.Close(), test.ShouldBeNil)
+		test.That(t, *numClosed, test.ShouldEqual, 1)
+	})
+
+	t.Run("failure", func(t *testing.T) {
+		expectedErr := errors.New("InternalStateChunk failed")
+		_, numClosed := mockStream()
+		carto.InternalStateChunkFunc = func(stream *internalStateStreamHandle, maxSize int) ([]byte, error) {
+			return nil, expectedErr
+		}
+		stream, err := cartoFacade.InternalStateStream(cancelCtx, 5*time.Second)
+		test.That(t, err, test.ShouldBeNil)
+		_, err = io.Copy(&bytes.Buffer{}, stream)
+		test.That(t, err, test.ShouldResemble, expectedErr)
+		test.That(t, stream.Close(), test.ShouldBeNil)
+		test.That(t, *numClosed, test.ShouldEqual, 1)
+
+		carto.InternalStateStreamFunc = func() (*internalStateStreamHandle, error) {
+			return nil, ErrInternalStateStreamUnavailable
+		}
+		stream, err = cartoFacade.InternalStateStream(cancelCtx, 5*time.Second)
+		test.That(t, stream, test.ShouldBeNil)
+		test.That(t, err, test.ShouldBeError, ErrInternalStateStreamUnavailable)
+	})
+
+	cancelFunc()
+	activeBackgroundWorkers.Wait()
+}
@@ -0,0 +1,66 @@
+package cartofacade
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// MemoryPollInterval is the interval at which the memory monitor polls the memory usage of the cartographer library.
+const MemoryPollInterval = 10 * time.Second
+
+// memoryGauge holds the last memory usage polled from the cartographer library. It is kept behind a pointer so
+// that a CartoFacade can be copied.
+type memoryGauge struct {
+	allocatedBytes atomic.Uint64
+	available      atomic.Bool
+}
+
+// MemoryUsage returns the approximate number of bytes allocated on the C side of the process as of the last
+// poll of the memory monitor, and false if it has not been polled yet or the library does not report it.
+func (cf *CartoFacade) MemoryUsage() (uint64, bool) {
+	if cf.memory == nil || !cf.memory.available.Load() {
+		return 0, false
+	}
+	return cf.memory.allocatedBytes.Load(), true
+}
+
+// StartMemoryMonitor starts a background goroutine that polls the memory usage of the cartographer library every
+// pollInterval. The library is called directly rather than through the worker goroutine, as its memory usage is
+// that of the whole process and does not depend on the state of cartographer. The monitor stops once the library
+// reports that its memory usage is unavailable, and is not started if the library lacks the feature.
+func (cf *CartoFacade) StartMemoryMonitor(
+	ctx context.Context,
+	pollInterval time.Duration,
+	activeBackgroundWorkers *sync.WaitGroup,
+) {
+	if !cf.cartoLib.Capabilities().Has(FeatureMemoryUsage) {
+		return
+	}
+	activeBackgroundWorkers.Add(1)
+	go func() {
+		defer activeBackgroundWorkers.Done()
+
+		ticker := time.NewTicker(pollInterval)
+		defer ticker.Stop()
+		for {
+			allocatedBytes, err := cf.cartoLib.MemoryUsage()
+			if errors.Is(err, ErrMemoryUsageUnavailable) {
+				cf.memory.available.Store(false)
+				return
+			}
+			if err == nil {
+				cf.memory.allocatedBytes.Store(allocatedBytes)
+			}
+			cf.memory.available.Store(err == nil)
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
@@ -0,0 +1,72 @@
+package cartofacade
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.viam.com/test"
+	"go.viam.com/utils/testutils"
+)
+
+func TestMemoryMonitor(t *testing.T) {
+	cfg := GetTestConfig("my-lidar", "", "", true)
+	algoCfg := GetTestAlgoConfig(false)
+
+	t.Run("no memory usage is reported before it is polled", func(t *testing.T) {
+		cartoFacade := New(&CartoLibMock{}, cfg, algoCfg)
+		_, ok := cartoFacade.MemoryUsage()
+		test.That(t, ok, test.ShouldBeFalse)
+	})
+
+	t.Run("the memory usage is polled periodically", func(t *testing.T) {
+		cancelCtx, cancelFunc := context.WithCancel(context.Background())
+		activeBackgroundWorkers := sync.WaitGroup{}
+
+		var allocatedBytes atomic.Uint64
+		allocatedBytes.Store(1000)
+		lib := CartoLibMock{MemoryUsageFunc: func() (uint64, error) { return allocatedBytes.Load(), nil }}
+		cartoFacade := New(&lib, cfg, algoCfg)
+		cartoFacade.StartMemoryMonitor(cancelCtx, 10*time.Millisecond, &activeBackgroundWorkers)
+
+		testutils.WaitForAssertion(t, func(tb testing.TB) {
+			tb.Helper()
+			memoryUsage, ok := cartoFacade.MemoryUsage()
+			test.That(tb, ok, test.ShouldBeTrue)
+			test.That(tb, memoryUsage, test.ShouldEqual, 1000)
+		})
+
+		allocatedBytes.Store(2000)
+		testutils.WaitForAssertion(t, func(tb testing.TB) {
+			tb.Helper()
+			memoryUsage, ok := cartoFacade.MemoryUsage()
+			test.That(tb, ok, test.ShouldBeTrue)
+			test.That(tb, memoryUsage, test.ShouldEqual, 2000)
+		})
+
+		cancelFunc()
+		activeBackgroundWorkers.Wait()
+	})
+
+	t.Run("the monitor stops once the memory usage is unavailable", func(t *testing.T) {
+		cancelCtx, cancelFunc := context.WithCancel(context.Background())
+		defer cancelFunc()
+		activeBackgroundWorkers := sync.WaitGroup{}
+
+		var polls atomic.Int64
+		lib := CartoLibMock{MemoryUsageFunc: func() (uint64, error) {
+			polls.Add(1)
+			return 0, ErrMemoryUsageUnavailable
+		}}
+		cartoFacade := New(&lib, cfg, algoCfg)
+		cartoFacade.StartMemoryMonitor(cancelCtx, time.Millisecond, &activeBackgroundWorkers)
+
+		// the monitor returns without the context being cancelled
+		activeBackgroundWorkers.Wait()
+		test.That(t, polls.Load(), test.ShouldEqual, 1)
+		_, ok := cartoFacade.MemoryUsage()
+		test.That(t, ok, test.ShouldBeFalse)
+	})
+}
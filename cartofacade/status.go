@@ -0,0 +1,86 @@
+package cartofacade
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// State is the state of the state machine of cartographer that the calls of a CartoFacade move it through.
+type State string
+
+const (
+	// StateNew is the state of a CartoFacade that has not been initialized yet.
+	StateNew State = "new"
+	// StateInitialized is the state after Initialize returned successfully.
+	StateInitialized State = "initialized"
+	// StateStarted is the state after Start returned successfully, the only one sensor readings are added in.
+	StateStarted State = "started"
+	// StateStopped is the state after Stop returned successfully.
+	StateStopped State = "stopped"
+	// StateTerminated is the state after Terminate returned successfully.
+	StateTerminated State = "terminated"
+)
+
+// Status is the status of a CartoFacade, to tell a cartographer that is busy, e.g. optimizing, from one that
+// is wedged.
+type Status struct {
+	State State
+	// LastLidarReadingAddedAt is the time the last lidar reading was successfully added at, or the zero time if
+	// none was.
+	LastLidarReadingAddedAt time.Time
+	// QueueDepth is the number of requests waiting for the worker goroutine to call into C.
+	QueueDepth int64
+	// FinalOptimizationRun is whether the final optimization ran successfully.
+	FinalOptimizationRun bool
+}
+
+// status tracks the Status of a CartoFacade. It is kept behind a pointer so that a CartoFacade can be copied.
+type status struct {
+	queueDepth atomic.Int64
+
+	mu                      sync.Mutex
+	state                   State
+	lastLidarReadingAddedAt time.Time
+	finalOptimizationRun    bool
+}
+
+// record updates the status after the worker goroutine completed a request of requestType successfully at now.
+func (st *status) record(requestType RequestType, now time.Time) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	switch requestType {
+	case initialize:
+		st.state = StateInitialized
+	case start:
+		st.state = StateStarted
+	case stop:
+		st.state = StateStopped
+	case terminate:
+		st.state = StateTerminated
+	case addLidarReading:
+		st.lastLidarReadingAddedAt = now
+	case runFinalOptimization:
+		st.finalOptimizationRun = true
+	}
+}
+
+// Status returns the status of the CartoFacade. It does not call into C, so it is safe to call while cartographer
+// is unresponsive.
+func (cf *CartoFacade) Status() Status {
+	if cf.status == nil {
+		return Status{State: StateNew}
+	}
+	cf.status.mu.Lock()
+	defer cf.status.mu.Unlock()
+	st := Status{
+		State:                   cf.status.state,
+		LastLidarReadingAddedAt: cf.status.lastLidarReadingAddedAt,
+		QueueDepth:              cf.status.queueDepth.Load(),
+		FinalOptimizationRun:    cf.status.finalOptimizationRun,
+	}
+	if st.State == "" {
+		st.State = StateNew
+	}
+	return st
+}
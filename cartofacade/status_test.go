@@ -0,0 +1,100 @@
+package cartofacade
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"go.viam.com/test"
+	"go.viam.com/utils/testutils"
+
+	s "github.com/viam-modules/viam-cartographer/sensors"
+)
+
+func TestStatus(t *testing.T) {
+	lib := CartoLibMock{}
+
+	cancelCtx, cancelFunc := context.WithCancel(context.Background())
+	activeBackgroundWorkers := sync.WaitGroup{}
+	defer func() {
+		cancelFunc()
+		activeBackgroundWorkers.Wait()
+	}()
+
+	cfg := GetTestConfig("my-lidar", "", "", true)
+	algoCfg := GetTestAlgoConfig(false)
+
+	cartoFacade := New(&lib, cfg, algoCfg)
+	carto := CartoMock{}
+	carto.StartFunc = func() error { return nil }
+	carto.StopFunc = func() error { return nil }
+	carto.TerminateFunc = func() error { return nil }
+	carto.AddLidarReadingFunc = func(name string, reading s.TimedLidarReadingResponse) error { return nil }
+	carto.RunFinalOptimizationFunc = func() error { return nil }
+	carto.StartInitialOptimizationFunc = func() error { return nil }
+	carto.InitialOptimizationRunningFunc = func() (bool, error) { return false, nil }
+	cartoFacade.carto = &carto
+	cartoFacade.startCGoroutine(cancelCtx, &activeBackgroundWorkers)
+
+	t.Run("the state follows the calls that succeeded", func(t *testing.T) {
+		test.That(t, cartoFacade.Status(), test.ShouldResemble, Status{State: StateNew})
+
+		carto.StartFunc = func() error { return errors.New("start failed") }
+		test.That(t, cartoFacade.Start(cancelCtx, 5*time.Second), test.ShouldNotBeNil)
+		test.That(t, cartoFacade.Status().State, test.ShouldEqual, StateNew)
+
+		carto.StartFunc = func() error { return nil }
+		test.That(t, cartoFacade.Start(cancelCtx, 5*time.Second), test.ShouldBeNil)
+		test.That(t, cartoFacade.Status().State, test.ShouldEqual, StateStarted)
+	})
+
+	t.Run("the time of the last lidar reading added and the final optimization are recorded", func(t *testing.T) {
+		before := time.Now()
+		err := cartoFacade.AddLidarReading(cancelCtx, 5*time.Second, "my-lidar", s.TimedLidarReadingResponse{})
+		test.That(t, err, test.ShouldBeNil)
+		status := cartoFacade.Status()
+		test.That(t, status.LastLidarReadingAddedAt.Before(before), test.ShouldBeFalse)
+		test.That(t, status.FinalOptimizationRun, test.ShouldBeFalse)
+
+		// the initial optimization is not the final one
+		test.That(t, cartoFacade.RunInitialOptimization(cancelCtx, 5*time.Second), test.ShouldBeNil)
+		test.That(t, cartoFacade.Status().FinalOptimizationRun, test.ShouldBeFalse)
+
+		test.That(t, cartoFacade.RunFinalOptimization(cancelCtx, 5*time.Second), test.ShouldBeNil)
+		test.That(t, cartoFacade.Status().FinalOptimizationRun, test.ShouldBeTrue)
+	})
+
+	t.Run("the requests waiting for the worker goroutine are counted", func(t *testing.T) {
+		release := make(chan struct{})
+		carto.PositionFunc = func() (Position, error) {
+			<-release
+			return Position{}, nil
+		}
+		var requests sync.WaitGroup
+		for i := 0; i < 3; i++ {
+			requests.Add(1)
+			go func() {
+				defer requests.Done()
+				_, err := cartoFacade.Position(cancelCtx, 5*time.Second)
+				test.That(t, err, test.ShouldBeNil)
+			}()
+		}
+		// one of the requests is being worked on, the others are waiting
+		testutils.WaitForAssertion(t, func(tb testing.TB) {
+			tb.Helper()
+			test.That(tb, cartoFacade.Status().QueueDepth, test.ShouldEqual, 2)
+		})
+		close(release)
+		requests.Wait()
+		test.That(t, cartoFacade.Status().QueueDepth, test.ShouldEqual, 0)
+	})
+
+	t.Run("the state is stopped and terminated on close", func(t *testing.T) {
+		test.That(t, cartoFacade.Stop(cancelCtx, 5*time.Second), test.ShouldBeNil)
+		test.That(t, cartoFacade.Status().State, test.ShouldEqual, StateStopped)
+		test.That(t, cartoFacade.Terminate(cancelCtx, 5*time.Second), test.ShouldBeNil)
+		test.That(t, cartoFacade.Status().State, test.ShouldEqual, StateTerminated)
+	})
+}
@@ -0,0 +1,49 @@
+package cartofacade
+
+import (
+	"math"
+
+	geo "github.com/kellydunn/golang-geo"
+	"go.viam.com/rdk/spatialmath"
+	"go.viam.com/rdk/utils"
+
+	s "github.com/viam-modules/viam-cartographer/sensors"
+)
+
+// VelocityIntegrator dead reckons the planar pose of a movement sensor that reports its odometry as velocity
+// readings, e.g. a wheel encoder, so that they can be added to cartographer as odometer readings, which its pose
+// extrapolator uses the same way regardless of where they came from. Cartographer only uses the relative motion
+// between odometer readings, so the integrated pose starts at the origin. It is not safe for concurrent use.
+type VelocityIntegrator struct {
+	// x and y are in meters, to the east and to the north respectively, and yaw is right handed from east.
+	x, y, yaw float64
+	previous  *s.TimedVelocityReadingResponse
+}
+
+// Integrate advances the pose by the mean velocities of the previous and the given reading over the time between
+// them and returns it as an odometer reading at the time of the given reading. Readings that are not later than
+// the previous one leave the pose as is, so that the same reading may be integrated again, e.g. when it is
+// retried.
+func (vi *VelocityIntegrator) Integrate(reading s.TimedVelocityReadingResponse) s.TimedOdometerReadingResponse {
+	if vi.previous != nil && reading.ReadingTime.After(vi.previous.ReadingTime) {
+		dt := reading.ReadingTime.Sub(vi.previous.ReadingTime).Seconds()
+		linVel := vi.previous.LinearVelocity.Add(reading.LinearVelocity).Mul(0.5)
+		angVel := (vi.previous.AngularVelocity.Z + reading.AngularVelocity.Z) / 2
+		// the linear velocity is rotated by the heading halfway through the interval
+		heading := vi.yaw + angVel*dt/2
+		vi.x += (linVel.X*math.Cos(heading) - linVel.Y*math.Sin(heading)) * dt
+		vi.y += (linVel.X*math.Sin(heading) + linVel.Y*math.Cos(heading)) * dt
+		vi.yaw += angVel * dt
+	}
+	if vi.previous == nil || reading.ReadingTime.After(vi.previous.ReadingTime) {
+		vi.previous = &reading
+	}
+
+	// the bearing of the position is clockwise from north and its distance in kilometers
+	bearing := utils.RadToDeg(math.Atan2(vi.x, vi.y))
+	return s.TimedOdometerReadingResponse{
+		Position:    geo.NewPoint(0, 0).PointAtDistanceAndBearing(math.Hypot(vi.x, vi.y)*1e-3, bearing),
+		Orientation: &spatialmath.EulerAngles{Yaw: vi.yaw},
+		ReadingTime: reading.ReadingTime,
+	}
+}
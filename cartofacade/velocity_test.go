@@ -0,0 +1,73 @@
+package cartofacade
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/golang/geo/r3"
+	geo "github.com/kellydunn/golang-geo"
+	"go.viam.com/rdk/spatialmath"
+	"go.viam.com/test"
+
+	s "github.com/viam-modules/viam-cartographer/sensors"
+)
+
+func TestVelocityIntegrator(t *testing.T) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	at := func(ms int) time.Time { return start.Add(time.Duration(ms) * time.Millisecond) }
+	// translation returns the translation of an odometer reading in millimeters, as it is added to cartographer
+	translation := func(reading s.TimedOdometerReadingResponse) r3.Vector {
+		return spatialmath.GeoPointToPoint(reading.Position, geo.NewPoint(0, 0))
+	}
+	const toleranceMm = 1.0
+
+	t.Run("the first reading is at the origin", func(t *testing.T) {
+		vi := &VelocityIntegrator{}
+		reading := vi.Integrate(s.TimedVelocityReadingResponse{LinearVelocity: r3.Vector{X: 1}, ReadingTime: at(0)})
+		test.That(t, translation(reading).Norm(), test.ShouldAlmostEqual, 0)
+		test.That(t, reading.Orientation.EulerAngles().Yaw, test.ShouldAlmostEqual, 0)
+		test.That(t, reading.ReadingTime, test.ShouldEqual, at(0))
+	})
+
+	t.Run("integrates a straight drive along the heading", func(t *testing.T) {
+		vi := &VelocityIntegrator{}
+		var reading s.TimedOdometerReadingResponse
+		for ms := 0; ms <= 2000; ms += 100 {
+			reading = vi.Integrate(s.TimedVelocityReadingResponse{LinearVelocity: r3.Vector{X: 0.5}, ReadingTime: at(ms)})
+		}
+		// 0.5 m/s for 2 s to the east
+		test.That(t, translation(reading).X, test.ShouldAlmostEqual, 1000, toleranceMm)
+		test.That(t, translation(reading).Y, test.ShouldAlmostEqual, 0, toleranceMm)
+		test.That(t, reading.ReadingTime, test.ShouldEqual, at(2000))
+	})
+
+	t.Run("integrates a quarter circle", func(t *testing.T) {
+		vi := &VelocityIntegrator{}
+		var reading s.TimedOdometerReadingResponse
+		// a radius of 1 m at 1 m/s takes pi/2 s, about 1571 ms, for a quarter circle
+		const quarter = 1571
+		for ms := 0; ms <= quarter; ms += 10 {
+			reading = vi.Integrate(s.TimedVelocityReadingResponse{
+				LinearVelocity:  r3.Vector{X: 1},
+				AngularVelocity: spatialmath.AngularVelocity{Z: 1},
+				ReadingTime:     at(ms),
+			})
+		}
+		test.That(t, translation(reading).X, test.ShouldAlmostEqual, 1000, 10*toleranceMm)
+		test.That(t, translation(reading).Y, test.ShouldAlmostEqual, 1000, 10*toleranceMm)
+		test.That(t, reading.Orientation.EulerAngles().Yaw, test.ShouldAlmostEqual, math.Pi/2, 0.01)
+	})
+
+	t.Run("a reading that is not later than the previous one leaves the pose as is", func(t *testing.T) {
+		vi := &VelocityIntegrator{}
+		vi.Integrate(s.TimedVelocityReadingResponse{LinearVelocity: r3.Vector{X: 1}, ReadingTime: at(0)})
+		first := vi.Integrate(s.TimedVelocityReadingResponse{LinearVelocity: r3.Vector{X: 1}, ReadingTime: at(1000)})
+		retried := vi.Integrate(s.TimedVelocityReadingResponse{LinearVelocity: r3.Vector{X: 1}, ReadingTime: at(1000)})
+		test.That(t, translation(first).X, test.ShouldAlmostEqual, 1000, toleranceMm)
+		test.That(t, translation(retried), test.ShouldResemble, translation(first))
+
+		next := vi.Integrate(s.TimedVelocityReadingResponse{LinearVelocity: r3.Vector{X: 1}, ReadingTime: at(2000)})
+		test.That(t, translation(next).X, test.ShouldAlmostEqual, 2000, toleranceMm)
+	})
+}
@@ -0,0 +1,191 @@
+package config
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"math"
+	"os"
+	"path/filepath"
+
+	"github.com/golang/geo/r3"
+	"github.com/pkg/errors"
+	"go.viam.com/rdk/spatialmath"
+	"gopkg.in/yaml.v3"
+
+	s "github.com/viam-modules/viam-cartographer/sensors"
+)
+
+// maxSensorTimeOffsetMs is the largest time offset, in milliseconds, that may be applied to the readings of a
+// sensor. Larger offsets point at a clock that is not synchronized rather than at a latency to calibrate.
+const maxSensorTimeOffsetMs = 10000
+
+// Orientation is an orientation vector in degrees, as used throughout the frame system.
+type Orientation struct {
+	OX    float64 `json:"o_x" yaml:"o_x"`
+	OY    float64 `json:"o_y" yaml:"o_y"`
+	OZ    float64 `json:"o_z" yaml:"o_z"`
+	Theta float64 `json:"theta" yaml:"theta"`
+}
+
+// Orientation returns the orientation as a spatialmath orientation.
+func (o *Orientation) Orientation() spatialmath.Orientation {
+	return &spatialmath.OrientationVectorDegrees{OX: o.OX, OY: o.OY, OZ: o.OZ, Theta: o.Theta}
+}
+
+func (o *Orientation) validate(field string) error {
+	for _, val := range []float64{o.OX, o.OY, o.OZ, o.Theta} {
+		if math.IsNaN(val) || math.IsInf(val, 0) {
+			return errors.Errorf("%s must only contain finite values", field)
+		}
+	}
+	if o.OX == 0 && o.OY == 0 && o.OZ == 0 {
+		return errors.Errorf("%s must have a non zero o_x, o_y or o_z", field)
+	}
+	return nil
+}
+
+// Extrinsics is the pose of a sensor relative to the base of the robot, with the translation in millimeters.
+// The fields are flattened rather than embedding an Orientation, as attributes are not decoded into embedded
+// structs.
+type Extrinsics struct {
+	X     float64 `json:"x" yaml:"x"`
+	Y     float64 `json:"y" yaml:"y"`
+	Z     float64 `json:"z" yaml:"z"`
+	OX    float64 `json:"o_x" yaml:"o_x"`
+	OY    float64 `json:"o_y" yaml:"o_y"`
+	OZ    float64 `json:"o_z" yaml:"o_z"`
+	Theta float64 `json:"theta" yaml:"theta"`
+}
+
+func (e *Extrinsics) orientation() *Orientation {
+	return &Orientation{OX: e.OX, OY: e.OY, OZ: e.OZ, Theta: e.Theta}
+}
+
+// Pose returns the extrinsics as a spatialmath pose.
+func (e *Extrinsics) Pose() spatialmath.Pose {
+	return spatialmath.NewPose(r3.Vector{X: e.X, Y: e.Y, Z: e.Z}, e.orientation().Orientation())
+}
+
+func (e *Extrinsics) validate(field string) error {
+	for _, val := range []float64{e.X, e.Y, e.Z} {
+		if math.IsNaN(val) || math.IsInf(val, 0) {
+			return errors.Errorf("%s must only contain finite values", field)
+		}
+	}
+	return e.orientation().validate(field)
+}
+
+// Calibration holds the fields of the config that differ between robots of the same model, which can be loaded
+// from the file at calibration_file so that robots can share the rest of their config.
+type Calibration struct {
+	LidarExtrinsics            *Extrinsics  `json:"lidar_extrinsics" yaml:"lidar_extrinsics"`
+	IMUOrientation             *Orientation `json:"imu_orientation" yaml:"imu_orientation"`
+	LidarTimeOffsetMs          *int         `json:"lidar_time_offset_ms" yaml:"lidar_time_offset_ms"`
+	MovementSensorTimeOffsetMs *int         `json:"movement_sensor_time_offset_ms" yaml:"movement_sensor_time_offset_ms"`
+	IMUAngularVelocityUnits    *string      `json:"imu_angular_velocity_units" yaml:"imu_angular_velocity_units"`
+}
+
+func (calibration *Calibration) validate() error {
+	if calibration.LidarExtrinsics != nil {
+		if err := calibration.LidarExtrinsics.validate("lidar_extrinsics"); err != nil {
+			return err
+		}
+	}
+	if calibration.IMUOrientation != nil {
+		if err := calibration.IMUOrientation.validate("imu_orientation"); err != nil {
+			return err
+		}
+	}
+	if calibration.LidarTimeOffsetMs != nil && abs(*calibration.LidarTimeOffsetMs) > maxSensorTimeOffsetMs {
+		return errors.Errorf("lidar_time_offset_ms must be between -%d and %d", maxSensorTimeOffsetMs, maxSensorTimeOffsetMs)
+	}
+	if calibration.MovementSensorTimeOffsetMs != nil && abs(*calibration.MovementSensorTimeOffsetMs) > maxSensorTimeOffsetMs {
+		return errors.Errorf("movement_sensor_time_offset_ms must be between -%d and %d",
+			maxSensorTimeOffsetMs, maxSensorTimeOffsetMs)
+	}
+	if calibration.IMUAngularVelocityUnits != nil {
+		switch s.AngularVelocityUnits(*calibration.IMUAngularVelocityUnits) {
+		case s.DegreesPerSecond, s.RadiansPerSecond:
+		default:
+			return errors.Errorf("imu_angular_velocity_units must be %q or %q", s.DegreesPerSecond, s.RadiansPerSecond)
+		}
+	}
+	return nil
+}
+
+func abs(val int) int {
+	if val < 0 {
+		return -val
+	}
+	return val
+}
+
+// calibration returns the calibration fields that are set explicitly in the config.
+func (config *Config) calibration() *Calibration {
+	return &Calibration{
+		LidarExtrinsics:            config.LidarExtrinsics,
+		IMUOrientation:             config.IMUOrientation,
+		LidarTimeOffsetMs:          config.LidarTimeOffsetMs,
+		MovementSensorTimeOffsetMs: config.MovementSensorTimeOffsetMs,
+		IMUAngularVelocityUnits:    config.IMUAngularVelocityUnits,
+	}
+}
+
+// LoadCalibration reads and validates the calibration file at path, which is decoded as YAML if its extension is
+// .yaml or .yml and as JSON otherwise. It returns the calibration along with the SHA-256 checksum of the file, hex
+// encoded. Unknown fields are rejected so that a misspelled field is not silently ignored.
+func LoadCalibration(path string) (*Calibration, string, error) {
+	data, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return nil, "", errors.Wrap(err, "unable to read calibration_file")
+	}
+
+	var calibration Calibration
+	switch filepath.Ext(path) {
+	case ".yaml", ".yml":
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		err = decoder.Decode(&calibration)
+	default:
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		err = decoder.Decode(&calibration)
+	}
+	if err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) {
+			err = errors.Errorf("%s must be of type %s, got %s", typeErr.Field, typeErr.Type, typeErr.Value)
+		}
+		return nil, "", errors.Wrapf(err, "malformed calibration_file %q", path)
+	}
+	if err := calibration.validate(); err != nil {
+		return nil, "", errors.Wrapf(err, "invalid calibration_file %q", path)
+	}
+
+	checksum := sha256.Sum256(data)
+	return &calibration, hex.EncodeToString(checksum[:]), nil
+}
+
+// WithCalibration returns a copy of the config with the calibration fields that are not set explicitly taken
+// from calibration.
+func (config *Config) WithCalibration(calibration *Calibration) *Config {
+	merged := *config
+	if merged.LidarExtrinsics == nil {
+		merged.LidarExtrinsics = calibration.LidarExtrinsics
+	}
+	if merged.IMUOrientation == nil {
+		merged.IMUOrientation = calibration.IMUOrientation
+	}
+	if merged.LidarTimeOffsetMs == nil {
+		merged.LidarTimeOffsetMs = calibration.LidarTimeOffsetMs
+	}
+	if merged.MovementSensorTimeOffsetMs == nil {
+		merged.MovementSensorTimeOffsetMs = calibration.MovementSensorTimeOffsetMs
+	}
+	if merged.IMUAngularVelocityUnits == nil {
+		merged.IMUAngularVelocityUnits = calibration.IMUAngularVelocityUnits
+	}
+	return &merged
+}
@@ -0,0 +1,145 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+	"go.viam.com/rdk/logging"
+	"go.viam.com/test"
+)
+
+func writeCalibrationFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	test.That(t, os.WriteFile(path, []byte(content), 0o600), test.ShouldBeNil)
+	return path
+}
+
+func TestLoadCalibration(t *testing.T) {
+	lidarTimeOffsetMs, movementSensorTimeOffsetMs, units := -20, 5, "rad_per_sec"
+	expected := &Calibration{
+		LidarExtrinsics:            &Extrinsics{X: 100, Y: -50, Z: 300, OZ: 1, Theta: 90},
+		IMUOrientation:             &Orientation{OX: 1, Theta: 180},
+		LidarTimeOffsetMs:          &lidarTimeOffsetMs,
+		MovementSensorTimeOffsetMs: &movementSensorTimeOffsetMs,
+		IMUAngularVelocityUnits:    &units,
+	}
+
+	t.Run("loads a JSON file", func(t *testing.T) {
+		path := writeCalibrationFile(t, "calibration.json", `{
+			"lidar_extrinsics": {"x": 100, "y": -50, "z": 300, "o_z": 1, "theta": 90},
+			"imu_orientation": {"o_x": 1, "theta": 180},
+			"lidar_time_offset_ms": -20,
+			"movement_sensor_time_offset_ms": 5,
+			"imu_angular_velocity_units": "rad_per_sec"
+		}`)
+		calibration, checksum, err := LoadCalibration(path)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, calibration, test.ShouldResemble, expected)
+		test.That(t, checksum, test.ShouldHaveLength, 64)
+	})
+
+	t.Run("loads a YAML file", func(t *testing.T) {
+		path := writeCalibrationFile(t, "calibration.yaml", `
+lidar_extrinsics: {x: 100, y: -50, z: 300, o_z: 1, theta: 90}
+imu_orientation:
+  o_x: 1
+  theta: 180
+lidar_time_offset_ms: -20
+movement_sensor_time_offset_ms: 5
+imu_angular_velocity_units: rad_per_sec
+`)
+		calibration, _, err := LoadCalibration(path)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, calibration, test.ShouldResemble, expected)
+	})
+
+	t.Run("the checksum changes with the content", func(t *testing.T) {
+		_, checksum1, err := LoadCalibration(writeCalibrationFile(t, "calibration.json", `{"lidar_time_offset_ms": 1}`))
+		test.That(t, err, test.ShouldBeNil)
+		_, checksum2, err := LoadCalibration(writeCalibrationFile(t, "calibration.json", `{"lidar_time_offset_ms": 2}`))
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, checksum1, test.ShouldNotEqual, checksum2)
+	})
+
+	t.Run("fails for a missing file", func(t *testing.T) {
+		_, _, err := LoadCalibration(filepath.Join(t.TempDir(), "missing.json"))
+		test.That(t, errors.Is(err, os.ErrNotExist), test.ShouldBeTrue)
+	})
+
+	t.Run("fails with the field of malformed content", func(t *testing.T) {
+		path := writeCalibrationFile(t, "calibration.json", `{"lidar_extrinsics": {"x": "front"}}`)
+		_, _, err := LoadCalibration(path)
+		test.That(t, err, test.ShouldBeError, errors.Errorf("malformed calibration_file %q: "+
+			"lidar_extrinsics.x must be of type float64, got string", path))
+
+		path = writeCalibrationFile(t, "calibration.json", `{"lidar_time_offset": 5}`)
+		_, _, err = LoadCalibration(path)
+		test.That(t, err, test.ShouldBeError, errors.Errorf("malformed calibration_file %q: "+
+			"json: unknown field \"lidar_time_offset\"", path))
+
+		path = writeCalibrationFile(t, "calibration.yml", "imu_orientation:\n  o_x: 1\n  thetaa: 90\n")
+		_, _, err = LoadCalibration(path)
+		test.That(t, err, test.ShouldNotBeNil)
+		test.That(t, err.Error(), test.ShouldContainSubstring, "line 3: field thetaa not found")
+	})
+
+	t.Run("fails with the field of invalid values", func(t *testing.T) {
+		for content, msg := range map[string]string{
+			`{"lidar_extrinsics": {"x": 100, "theta": 90}}`:  "lidar_extrinsics must have a non zero o_x, o_y or o_z",
+			`{"imu_orientation": {"o_x": 0, "theta": 90}}`:   "imu_orientation must have a non zero o_x, o_y or o_z",
+			`{"lidar_time_offset_ms": 10001}`:                "lidar_time_offset_ms must be between -10000 and 10000",
+			`{"movement_sensor_time_offset_ms": -20000}`:     "movement_sensor_time_offset_ms must be between -10000 and 10000",
+			`{"imu_angular_velocity_units": "rad_per_hour"}`: "imu_angular_velocity_units must be \"deg_per_sec\" or \"rad_per_sec\"",
+		} {
+			path := writeCalibrationFile(t, "calibration.json", content)
+			_, _, err := LoadCalibration(path)
+			test.That(t, err, test.ShouldBeError, errors.Errorf("invalid calibration_file %q: %s", path, msg))
+		}
+	})
+}
+
+func TestWithCalibration(t *testing.T) {
+	lidarTimeOffsetMs, movementSensorTimeOffsetMs, units := -20, 5, "rad_per_sec"
+	calibration := &Calibration{
+		LidarExtrinsics:            &Extrinsics{X: 100, OZ: 1},
+		IMUOrientation:             &Orientation{OX: 1, Theta: 180},
+		LidarTimeOffsetMs:          &lidarTimeOffsetMs,
+		MovementSensorTimeOffsetMs: &movementSensorTimeOffsetMs,
+		IMUAngularVelocityUnits:    &units,
+	}
+
+	t.Run("explicit config values take precedence over the calibration", func(t *testing.T) {
+		explicitLidarTimeOffsetMs, explicitUnits := 0, "deg_per_sec"
+		config := &Config{
+			LidarExtrinsics:         &Extrinsics{X: 200, OZ: 1},
+			LidarTimeOffsetMs:       &explicitLidarTimeOffsetMs,
+			IMUAngularVelocityUnits: &explicitUnits,
+		}
+		merged := config.WithCalibration(calibration)
+		test.That(t, merged.LidarExtrinsics, test.ShouldResemble, &Extrinsics{X: 200, OZ: 1})
+		test.That(t, *merged.LidarTimeOffsetMs, test.ShouldEqual, 0)
+		test.That(t, *merged.IMUAngularVelocityUnits, test.ShouldEqual, "deg_per_sec")
+		test.That(t, merged.IMUOrientation, test.ShouldResemble, &Orientation{OX: 1, Theta: 180})
+		test.That(t, *merged.MovementSensorTimeOffsetMs, test.ShouldEqual, 5)
+
+		// the config itself is left unchanged
+		test.That(t, config.IMUOrientation, test.ShouldBeNil)
+		test.That(t, config.MovementSensorTimeOffsetMs, test.ShouldBeNil)
+	})
+
+	t.Run("merged values are passed on as optional parameters", func(t *testing.T) {
+		cfg, err := newConfig(makeCfgService())
+		test.That(t, err, test.ShouldBeNil)
+		optionalConfigParams, err := GetOptionalParameters(cfg.WithCalibration(calibration), 1000, 1000,
+			logging.NewTestLogger(t))
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, optionalConfigParams.LidarExtrinsics, test.ShouldResemble, &Extrinsics{X: 100, OZ: 1})
+		test.That(t, optionalConfigParams.IMUOrientation, test.ShouldResemble, &Orientation{OX: 1, Theta: 180})
+		test.That(t, optionalConfigParams.LidarTimeOffsetMs, test.ShouldEqual, -20)
+		test.That(t, optionalConfigParams.MovementSensorTimeOffsetMs, test.ShouldEqual, 5)
+		test.That(t, optionalConfigParams.IMUAngularVelocityUnits, test.ShouldEqual, "rad_per_sec")
+	})
+}
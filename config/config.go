@@ -2,12 +2,22 @@
 package config
 
 import (
+	"fmt"
+	"math"
+	"path/filepath"
+	"reflect"
+	"sort"
 	"strconv"
 	"strings"
 
+	"github.com/golang/geo/r2"
 	"github.com/pkg/errors"
+	"go.uber.org/multierr"
 	"go.viam.com/rdk/logging"
 	"go.viam.com/utils"
+
+	"github.com/viam-modules/viam-cartographer/floorplan"
+	s "github.com/viam-modules/viam-cartographer/sensors"
 )
 
 // newError returns an error specific to a failure in the SLAM config.
@@ -20,54 +30,766 @@ type Config struct {
 	Camera         map[string]string `json:"camera"`
 	MovementSensor map[string]string `json:"movement_sensor"`
 	ConfigParams   map[string]string `json:"config_params"`
+	// AdditionalCameras are lidars whose readings are added to the same map as those of camera.
+	AdditionalCameras []AdditionalCamera `json:"additional_cameras"`
 
 	ExistingMap   string `json:"existing_map"`
 	EnableMapping *bool  `json:"enable_mapping"`
 	UseCloudSlam  *bool  `json:"use_cloud_slam"`
+	// FloorPlan is an occupancy grid image to localize against instead of an existing_map.
+	FloorPlan *FloorPlan `json:"floor_plan"`
+	// StrictCloudSlam makes the config invalid if use_cloud_slam is set along with fields the local service
+	// ignores, instead of only warning about them.
+	StrictCloudSlam *bool `json:"strict_cloud_slam"`
+
+	FallbackToPreviousInternalState *bool `json:"fallback_to_previous_internal_state"`
+	RebaseTimestamps                *bool `json:"rebase_timestamps"`
+	HangThresholdSec                *int  `json:"hang_threshold_sec"`
+	RestartOnHang                   *bool `json:"restart_on_hang"`
+	MinPointsPerScan                *int  `json:"min_points_per_scan"`
+	RunFinalOptimizationOnCancel    *bool `json:"run_final_optimization_on_cancel"`
+	MaxIngestionLatencyMs           *int  `json:"max_ingestion_latency_ms"`
+	ChangeDetection                 *bool `json:"change_detection"`
+	MaxDutyCyclePercent             *int  `json:"max_duty_cycle_percent"`
+	MaxConsecutiveLidarFailures     *int  `json:"max_consecutive_lidar_failures"`
+	MaxUnoptimizedNodeAgeSec        *int  `json:"max_unoptimized_node_age_sec"`
+	MaxPostprocessingTasks          *int  `json:"max_postprocessing_tasks"`
+	MaxInitAttempts                 *int  `json:"max_init_attempts"`
+	MaxSpeedMmPerSec                *int  `json:"max_speed_mm_per_sec"`
+	// MaxRejectedReadingRetries is the number of times a reading that cartographer rejects for its contents is
+	// added again in offline mode before it is skipped. 0 skips it right away.
+	MaxRejectedReadingRetries *int `json:"max_rejected_reading_retries"`
+	// MapStallLidarReadings is the number of lidar readings that may be added in mapping mode without
+	// the submaps of the map changing before the map is considered stalled.
+	MapStallLidarReadings *int `json:"map_stall_lidar_readings"`
+	// LocalizationLostTimeoutSec is how long the match confidence of the lidar readings against the map may stay
+	// below localization_min_confidence_percent in localization mode before the localization is considered lost.
+	LocalizationLostTimeoutSec       *int `json:"localization_lost_timeout_sec"`
+	LocalizationMinConfidencePercent *int `json:"localization_min_confidence_percent"`
+	// PositionErrorOnLocalizationLost makes Position return an error rather than a pose that drifts with the
+	// odometry while the localization is lost.
+	PositionErrorOnLocalizationLost *bool `json:"position_error_on_localization_lost"`
+	// RecentErrorsBufferSize is the number of most recent warnings and errors logged by the service that are
+	// listed in the status response.
+	RecentErrorsBufferSize *int `json:"recent_errors_buffer_size"`
+	// AllowMixedClockDomains lets the service combine a lidar and a movement sensor whose reading times are
+	// from different clocks, e.g. a replay lidar and a live movement sensor, which is refused by default.
+	AllowMixedClockDomains *bool `json:"allow_mixed_clock_domains"`
+	// SkipFinalOptimization skips the final optimization once offline mode reaches the end of a dataset, e.g. for
+	// quick parameter sweeps.
+	SkipFinalOptimization *bool `json:"skip_final_optimization"`
+	// FinalOptimizationIterations is the maximum number of ceres iterations of the final optimization.
+	FinalOptimizationIterations *int `json:"final_optimization_iterations"`
+	// OptimizeOnClose runs the final optimization on Close in online mapping mode, before the cartofacade is
+	// terminated, as offline mode does once it reaches the end of a dataset.
+	OptimizeOnClose *bool `json:"optimize_on_close"`
+	// MaxActiveTrajectories is the number of trajectories that may be left unfrozen, e.g. after several sessions
+	// of start_new_trajectory. Past it, the oldest ones are frozen if freeze_oldest_on_limit is set, and only
+	// warned about otherwise.
+	MaxActiveTrajectories *int  `json:"max_active_trajectories"`
+	FreezeOldestOnLimit   *bool `json:"freeze_oldest_on_limit"`
+	// MaxSensorSkewMs is how far the reading time of a movement sensor reading may be from that of the most recent
+	// lidar reading, e.g. for a replay sensor whose clock drifted. Past it, online mode drops the movement sensor
+	// reading and offline mode fails. It is disabled by default.
+	MaxSensorSkewMs *int `json:"max_sensor_skew_ms"`
+	// LidarBufferSize & MovementSensorBufferSize are the number of lidar & of IMU and odometer readings that are
+	// kept in online mode when cartographer is busy, e.g. during an optimization, to be added again before the
+	// next reading, rather than being skipped. Once a buffer is full, its oldest reading is dropped.
+	LidarBufferSize          *int `json:"lidar_buffer_size"`
+	MovementSensorBufferSize *int `json:"movement_sensor_buffer_size"`
+	// OptimizeOnStartAsync runs the optimization optimize_on_start runs on the existing map in the background once
+	// cartographer is started, rather than while it is initialized, so that a large map does not delay the
+	// construction of the service for minutes. Meanwhile the sensors are localized against the existing map as
+	// loaded, or, with a cartographer library that can not optimize in the background, read once it completes.
+	OptimizeOnStartAsync *bool `json:"optimize_on_start_async"`
+	// ConvertUnsupportedPCD converts lidar readings cartographer cannot read, i.e. organized pointclouds and ones
+	// with fields that are not 4 bytes as depth cameras return, into unorganized pointclouds of 4 byte floats
+	// instead of rejecting them.
+	ConvertUnsupportedPCD *bool `json:"convert_unsupported_pcd"`
+	// ExpectedTotal is the number of lidar readings of the dataset offline mode replays, from which job_progress
+	// reports how far along it is as a percentage.
+	ExpectedTotal *int `json:"expected_total"`
+	// MaxJobDurationSec is how long offline mode may add the readings of the dataset before it stops and finishes
+	// the job as if it had reached the end of the dataset. It is unlimited by default.
+	MaxJobDurationSec *int `json:"max_job_duration_sec"`
+	// RetryableInitErrors are the cartographer error codes, e.g. "VIAM_CARTO_OUT_OF_MEMORY", on which
+	// initializing or starting cartographer is retried, up to max_init_attempts times.
+	RetryableInitErrors []string `json:"retryable_init_errors"`
+	// IMUAngularVelocityUnits are the units the movement sensor reports its angular velocity in, either
+	// "deg_per_sec" as the movement sensor API prescribes, which is the default, or "rad_per_sec".
+	IMUAngularVelocityUnits *string `json:"imu_angular_velocity_units"`
+	// LidarExtrinsics is the pose of the lidar relative to the base of the robot, which its readings are
+	// transformed by before they are added to cartographer.
+	LidarExtrinsics *Extrinsics `json:"lidar_extrinsics"`
+	// IMUOrientation is the orientation of the movement sensor relative to the base of the robot, which its IMU
+	// readings and odometer orientations are rotated by before they are added to cartographer.
+	IMUOrientation *Orientation `json:"imu_orientation"`
+	// LidarTimeOffsetMs and MovementSensorTimeOffsetMs are added to the reading times of the respective sensor.
+	LidarTimeOffsetMs          *int `json:"lidar_time_offset_ms"`
+	MovementSensorTimeOffsetMs *int `json:"movement_sensor_time_offset_ms"`
+	// CalibrationFile is the absolute path of a JSON or YAML file holding any of lidar_extrinsics,
+	// imu_orientation, lidar_time_offset_ms, movement_sensor_time_offset_ms and imu_angular_velocity_units.
+	// Fields that are set in the config take precedence over the file.
+	CalibrationFile string `json:"calibration_file"`
+	// InternalStateExportDirs are the absolute paths of the directories the write_internal_state_to_path
+	// DoCommand may write the internal state to.
+	InternalStateExportDirs []string `json:"internal_state_export_dirs"`
+	// WarmStartDir is the absolute path of a directory the latest internal state is loaded from as the existing map
+	// on start, in mapping mode, and the internal state of the session is saved to on close. It is an alternative
+	// to existing_map.
+	WarmStartDir string `json:"warm_start_dir"`
+	// WarmStartRetention is the number of internal states kept in warm_start_dir, the oldest ones are removed.
+	WarmStartRetention *int `json:"warm_start_retention"`
+	// InternalStateSaveDir is the absolute path of a directory the internal state is saved to every
+	// internal_state_save_interval_sec while mapping, so that a crash does not lose the session.
+	InternalStateSaveDir         string `json:"internal_state_save_dir"`
+	InternalStateSaveIntervalSec *int   `json:"internal_state_save_interval_sec"`
+	// InternalStateSaveRetention is the number of internal states kept in internal_state_save_dir, the oldest ones
+	// are removed.
+	InternalStateSaveRetention *int `json:"internal_state_save_retention"`
+
+	// RecordDatasetDir is the absolute path of a directory the readings of camera are recorded to as an offline
+	// dataset, compressed with record_dataset_compression_level, which is uncompressed by default.
+	RecordDatasetDir              string `json:"record_dataset_dir"`
+	RecordDatasetCompressionLevel *int   `json:"record_dataset_compression_level"`
+
+	MappingBounds *MappingBounds `json:"mapping_bounds"`
+	// ShadowConfig is experimental: it overrides config_params for a second cartographer instance that is
+	// submitted the same readings, to compare two algo configs side by side.
+	ShadowConfig map[string]string `json:"shadow_config"`
+
+	// The attributes of the config of the versions of the service that ran cartographer as a separate process
+	// reading sensor data from data_dir. They are only decoded to point configs that still set them to the
+	// current config.
+	LegacySensors             interface{} `json:"sensors"`
+	LegacyDataDir             interface{} `json:"data_dir"`
+	LegacyDataRateMsec        interface{} `json:"data_rate_msec"`
+	LegacyMapRateSec          interface{} `json:"map_rate_sec"`
+	LegacyPort                interface{} `json:"port"`
+	LegacyDeleteProcessedData interface{} `json:"delete_processed_data"`
+	LegacyUseLiveData         interface{} `json:"use_live_data"`
+}
+
+// legacyAttributes returns the attributes of the legacy config that config sets.
+func (config *Config) legacyAttributes() []string {
+	var attributes []string
+	for _, attribute := range []struct {
+		name  string
+		value interface{}
+	}{
+		{"sensors", config.LegacySensors},
+		{"data_dir", config.LegacyDataDir},
+		{"data_rate_msec", config.LegacyDataRateMsec},
+		{"map_rate_sec", config.LegacyMapRateSec},
+		{"port", config.LegacyPort},
+		{"delete_processed_data", config.LegacyDeleteProcessedData},
+		{"use_live_data", config.LegacyUseLiveData},
+	} {
+		if attribute.value != nil {
+			attributes = append(attributes, attribute.name)
+		}
+	}
+	return attributes
+}
+
+// AdditionalCamera describes a lidar whose readings are added to the same map as those of camera.
+type AdditionalCamera struct {
+	Name string `json:"name"`
+	// DataFrequencyHz defaults to the default data frequency of camera in online mode. It must be 0 in offline
+	// mode, i.e. if camera[data_frequency_hz] is 0, and may not be 0 otherwise.
+	DataFrequencyHz *int `json:"data_frequency_hz"`
+	// Extrinsics is the pose of the lidar relative to the base of the robot, which its readings are transformed
+	// by before they are added to cartographer.
+	Extrinsics *Extrinsics `json:"extrinsics"`
+	// MinRangeMm, MaxRangeMm, AngleMinDeg and AngleMaxDeg filter the points of the readings of the lidar like
+	// the keys of camera of the same names. The filter of camera does not apply to additional cameras.
+	MinRangeMm  *float64 `json:"min_range_mm"`
+	MaxRangeMm  *float64 `json:"max_range_mm"`
+	AngleMinDeg *float64 `json:"angle_min_deg"`
+	AngleMaxDeg *float64 `json:"angle_max_deg"`
+}
+
+// pointFilter returns the filter of the points of the readings of the camera, which is at field in the config.
+// The angles must be set together.
+func (camera AdditionalCamera) pointFilter(field string) (s.LidarPointFilter, error) {
+	var filter s.LidarPointFilter
+	if camera.MinRangeMm != nil {
+		filter.MinRangeMm = *camera.MinRangeMm
+	}
+	if camera.MaxRangeMm != nil {
+		filter.MaxRangeMm = *camera.MaxRangeMm
+	}
+	if (camera.AngleMinDeg == nil) != (camera.AngleMaxDeg == nil) {
+		return s.LidarPointFilter{}, errors.Errorf("%s[angle_min_deg] and %s[angle_max_deg] must be set together",
+			field, field)
+	}
+	if camera.AngleMinDeg != nil {
+		filter.HasAngularWindow = true
+		filter.AngleMinDeg = *camera.AngleMinDeg
+		filter.AngleMaxDeg = *camera.AngleMaxDeg
+	}
+	if err := filter.Validate(); err != nil {
+		return s.LidarPointFilter{}, errors.Wrapf(err, "invalid %s point filter", field)
+	}
+	return filter, nil
+}
+
+// AdditionalLidar is an additional camera with its data frequency resolved.
+type AdditionalLidar struct {
+	Name            string
+	DataFrequencyHz int
+	Extrinsics      *Extrinsics
+	PointFilter     s.LidarPointFilter
+}
+
+// MappingBounds describes the 2D region, in millimeters in the map frame, that lidar scans are clipped to.
+// Either all of min_x, min_y, max_x & max_y, or a polygon of at least three points must be provided.
+type MappingBounds struct {
+	MinX    *float64   `json:"min_x"`
+	MinY    *float64   `json:"min_y"`
+	MaxX    *float64   `json:"max_x"`
+	MaxY    *float64   `json:"max_y"`
+	Polygon []r2.Point `json:"polygon"`
+
+	ClipPointCloudMap bool `json:"clip_point_cloud_map"`
+}
+
+// Vertices returns the vertices of the polygon described by the mapping bounds.
+func (bounds *MappingBounds) Vertices() ([]r2.Point, error) {
+	hasBox := bounds.MinX != nil || bounds.MinY != nil || bounds.MaxX != nil || bounds.MaxY != nil
+	switch {
+	case hasBox && len(bounds.Polygon) > 0:
+		return nil, newError("mapping_bounds must contain either min_x, min_y, max_x & max_y or a polygon, not both")
+	case hasBox:
+		if bounds.MinX == nil || bounds.MinY == nil || bounds.MaxX == nil || bounds.MaxY == nil {
+			return nil, newError("mapping_bounds must contain all of min_x, min_y, max_x & max_y")
+		}
+		if *bounds.MinX >= *bounds.MaxX || *bounds.MinY >= *bounds.MaxY {
+			return nil, newError("mapping_bounds min_x & min_y must be less than max_x & max_y")
+		}
+		return []r2.Point{
+			{X: *bounds.MinX, Y: *bounds.MinY},
+			{X: *bounds.MaxX, Y: *bounds.MinY},
+			{X: *bounds.MaxX, Y: *bounds.MaxY},
+			{X: *bounds.MinX, Y: *bounds.MaxY},
+		}, nil
+	case len(bounds.Polygon) < 3:
+		return nil, newError("mapping_bounds polygon must contain at least three points")
+	default:
+		return bounds.Polygon, nil
+	}
+}
+
+// FloorPlan describes an occupancy grid image, e.g. a floor plan or a map exported from another SLAM system,
+// whose pixels are classified as occupied, free or unknown by their darkness, as the ROS map_server does.
+type FloorPlan struct {
+	// Image is the absolute path of a .pgm or .png image.
+	Image string `json:"image"`
+	// ResolutionMm is the width of a pixel of the image in millimeters.
+	ResolutionMm float64 `json:"resolution_mm"`
+	// Origin is the position, in millimeters in the map frame, of the bottom left corner of the image. It
+	// defaults to the origin of the map frame.
+	Origin *r2.Point `json:"origin"`
+}
+
+func (floorPlan *FloorPlan) validate() error {
+	if floorPlan.Image == "" {
+		return errors.New("floor_plan must contain an image")
+	}
+	if !filepath.IsAbs(floorPlan.Image) {
+		return errors.Errorf("floor_plan image must be an absolute path, got %q", floorPlan.Image)
+	}
+	if !floorplan.Supported(floorPlan.Image) {
+		return errors.Errorf("floor_plan image must be a .pgm or .png file, got %q", floorPlan.Image)
+	}
+	if floorPlan.ResolutionMm <= 0 {
+		return errors.New("floor_plan resolution_mm must be greater than zero")
+	}
+	return nil
 }
 
 // OptionalConfigParams holds the optional config parameters of SLAM.
 type OptionalConfigParams struct {
-	LidarDataFrequencyHz          int
-	MovementSensorName            string
-	MovementSensorDataFrequencyHz int
-	EnableMapping                 bool
-	ExistingMap                   string
+	LidarDataFrequencyHz             int
+	MovementSensorName               string
+	MovementSensorDataFrequencyHz    int
+	MovementSensorHeadingOnly        bool
+	MovementSensorVelocityOdometry   bool
+	EnableMapping                    bool
+	ExistingMap                      string
+	FallbackToPreviousInternalState  bool
+	RebaseTimestamps                 bool
+	HangThresholdSec                 int
+	RestartOnHang                    bool
+	MinPointsPerScan                 int
+	RunFinalOptimizationOnCancel     bool
+	MaxIngestionLatencyMs            int
+	ChangeDetection                  bool
+	MaxDutyCyclePercent              int
+	MaxConsecutiveLidarFailures      int
+	MaxRejectedReadingRetries        int
+	HasMaxRejectedReadingRetries     bool
+	MaxUnoptimizedNodeAgeSec         int
+	MaxPostprocessingTasks           int
+	MaxInitAttempts                  int
+	MaxSpeedMmPerSec                 int
+	MapStallLidarReadings            int
+	LocalizationLostTimeoutSec       int
+	LocalizationMinConfidencePercent int
+	PositionErrorOnLocalizationLost  bool
+	RecentErrorsBufferSize           int
+	AllowMixedClockDomains           bool
+	SkipFinalOptimization            bool
+	FinalOptimizationIterations      int
+	OptimizeOnClose                  bool
+	MaxActiveTrajectories            int
+	FreezeOldestOnLimit              bool
+	MaxSensorSkewMs                  int
+	LidarBufferSize                  int
+	MovementSensorBufferSize         int
+	OptimizeOnStartAsync             bool
+	ConvertUnsupportedPCD            bool
+	ExpectedTotal                    int
+	MaxJobDurationSec                int
+	RetryableInitErrors              []string
+	IMUAngularVelocityUnits          s.AngularVelocityUnits
+	InternalStateExportDirs          []string
+	WarmStartDir                     string
+	WarmStartRetention               int
+	InternalStateSaveDir             string
+	InternalStateSaveIntervalSec     int
+	InternalStateSaveRetention       int
+	LidarExtrinsics                  *Extrinsics
+	IMUOrientation                   *Orientation
+	LidarTimeOffsetMs                int
+	MovementSensorTimeOffsetMs       int
+	FloorPlan                        *FloorPlan
+	AdditionalLidars                 []AdditionalLidar
+	LidarPointFilter                 s.LidarPointFilter
+	RecordDatasetDir                 string
+	RecordDatasetCompressionLevel    int
 }
 
 var (
 	errCameraMustHaveName        = errors.New("\"camera[name]\" is required")
 	errLocalizationInOfflineMode = newError("\"camera[data_freq_hz]\" and enable_mapping = false." +
 		" Localization in offline mode is not supported.")
+	// ErrLegacyConfig is the error of a config that sets attributes of the legacy config, which is no longer
+	// supported.
+	ErrLegacyConfig = errors.New("the legacy config is no longer supported, replace sensors with camera and " +
+		"movement_sensor, data_rate_msec with camera[data_frequency_hz], and remove data_dir, map_rate_sec, port, " +
+		"delete_processed_data and use_live_data, see https://docs.viam.com/services/slam/cartographer/")
+	errChangeDetectionWithoutLocalization = newError("change_detection is only supported in localization mode," +
+		" i.e. with an existing_map and enable_mapping = false")
 )
 
 // Validate creates the list of implicit dependencies.
 func (config *Config) Validate(path string) ([]string, error) {
 	var deps []string
+	if attributes := config.legacyAttributes(); len(attributes) > 0 {
+		return nil, utils.NewConfigValidationError(path,
+			errors.Wrapf(ErrLegacyConfig, "%s set", strings.Join(attributes, ", ")))
+	}
 	cameraName, ok := config.Camera["name"]
 	if !ok {
 		return nil, utils.NewConfigValidationError(path, errCameraMustHaveName)
 	}
+	// the remaining checks are independent of each other, so that all of the problems of the config are reported
+	// at once
+	var errs error
+	// isOffline is only known if camera[data_frequency_hz] is valid
+	isOffline, isOfflineKnown := false, true
 	dataFreqHz, ok := config.Camera["data_frequency_hz"]
 	if ok {
 		dataFreqHz, err := strconv.Atoi(dataFreqHz)
-		if err != nil {
-			return nil, errors.New("camera[data_frequency_hz] must only contain digits")
-		}
-		if dataFreqHz < 0 {
-			return nil, errors.New("cannot specify camera[data_frequency_hz] less than zero")
+		switch {
+		case err != nil:
+			errs = multierr.Append(errs, errors.Errorf("camera[data_frequency_hz] must only contain digits, got %q",
+				config.Camera["data_frequency_hz"]))
+			isOfflineKnown = false
+		case dataFreqHz < 0:
+			errs = multierr.Append(errs, errors.Errorf("cannot specify camera[data_frequency_hz] less than zero, got %d", dataFreqHz))
+			isOfflineKnown = false
+		default:
+			isOffline = dataFreqHz == 0
 		}
 	}
+	if _, err := config.lidarPointFilter(); err != nil {
+		errs = multierr.Append(errs, err)
+	}
 	deps = append(deps, cameraName)
 
+	cameraNames := map[string]bool{cameraName: true}
+	for i, camera := range config.AdditionalCameras {
+		if camera.Name == "" {
+			errs = multierr.Append(errs, errors.Errorf("additional_cameras[%d][name] is required", i))
+		} else if cameraNames[camera.Name] {
+			errs = multierr.Append(errs,
+				errors.Errorf("additional_cameras[%d][name] %q is already used by another camera", i, camera.Name))
+		}
+		cameraNames[camera.Name] = true
+		if camera.DataFrequencyHz != nil {
+			switch {
+			case *camera.DataFrequencyHz < 0:
+				errs = multierr.Append(errs,
+					errors.Errorf("cannot specify additional_cameras[%d][data_frequency_hz] less than zero", i))
+			case isOfflineKnown && isOffline && *camera.DataFrequencyHz != 0:
+				errs = multierr.Append(errs, errors.Errorf("additional_cameras[%d][data_frequency_hz] must be 0 in offline mode, "+
+					"i.e. if camera[data_frequency_hz] is 0", i))
+			case isOfflineKnown && !isOffline && *camera.DataFrequencyHz == 0:
+				errs = multierr.Append(errs, errors.Errorf("additional_cameras[%d][data_frequency_hz] can only be 0 in offline mode, "+
+					"i.e. if camera[data_frequency_hz] is 0", i))
+			}
+		}
+		if camera.Extrinsics != nil {
+			errs = multierr.Append(errs, camera.Extrinsics.validate(fmt.Sprintf("additional_cameras[%d][extrinsics]", i)))
+		}
+		if _, err := camera.pointFilter(fmt.Sprintf("additional_cameras[%d]", i)); err != nil {
+			errs = multierr.Append(errs, err)
+		}
+		deps = append(deps, camera.Name)
+	}
+
+	if config.MappingBounds != nil {
+		if _, err := config.MappingBounds.Vertices(); err != nil {
+			errs = multierr.Append(errs, err)
+		}
+	}
+
+	if config.HangThresholdSec != nil && *config.HangThresholdSec <= 0 {
+		errs = multierr.Append(errs, errors.New("hang_threshold_sec must be greater than zero"))
+	}
+
+	if config.MinPointsPerScan != nil && *config.MinPointsPerScan < 0 {
+		errs = multierr.Append(errs, errors.New("cannot specify min_points_per_scan less than zero"))
+	}
+
+	if config.MaxIngestionLatencyMs != nil && *config.MaxIngestionLatencyMs <= 0 {
+		errs = multierr.Append(errs, errors.New("max_ingestion_latency_ms must be greater than zero"))
+	}
+
+	if config.MaxDutyCyclePercent != nil && (*config.MaxDutyCyclePercent <= 0 || *config.MaxDutyCyclePercent > 100) {
+		errs = multierr.Append(errs, errors.New("max_duty_cycle_percent must be greater than zero and at most 100"))
+	}
+
+	if config.MaxConsecutiveLidarFailures != nil && *config.MaxConsecutiveLidarFailures <= 0 {
+		errs = multierr.Append(errs, errors.New("max_consecutive_lidar_failures must be greater than zero"))
+	}
+
+	if config.MaxRejectedReadingRetries != nil && *config.MaxRejectedReadingRetries < 0 {
+		errs = multierr.Append(errs, errors.New("max_rejected_reading_retries must not be negative"))
+	}
+
+	if config.MaxUnoptimizedNodeAgeSec != nil && *config.MaxUnoptimizedNodeAgeSec <= 0 {
+		errs = multierr.Append(errs, errors.New("max_unoptimized_node_age_sec must be greater than zero"))
+	}
+
+	if config.MaxPostprocessingTasks != nil && *config.MaxPostprocessingTasks <= 0 {
+		errs = multierr.Append(errs, errors.New("max_postprocessing_tasks must be greater than zero"))
+	}
+
+	if config.MaxInitAttempts != nil && *config.MaxInitAttempts <= 0 {
+		errs = multierr.Append(errs, errors.New("max_init_attempts must be greater than zero"))
+	}
+
+	if config.MaxSpeedMmPerSec != nil && *config.MaxSpeedMmPerSec <= 0 {
+		errs = multierr.Append(errs, errors.New("max_speed_mm_per_sec must be greater than zero"))
+	}
+
+	if config.MapStallLidarReadings != nil && *config.MapStallLidarReadings <= 0 {
+		errs = multierr.Append(errs, errors.New("map_stall_lidar_readings must be greater than zero"))
+	}
+
+	if config.LocalizationLostTimeoutSec != nil && *config.LocalizationLostTimeoutSec <= 0 {
+		errs = multierr.Append(errs, errors.New("localization_lost_timeout_sec must be greater than zero"))
+	}
+
+	if config.LocalizationMinConfidencePercent != nil &&
+		(*config.LocalizationMinConfidencePercent <= 0 || *config.LocalizationMinConfidencePercent > 100) {
+		errs = multierr.Append(errs, errors.New("localization_min_confidence_percent must be greater than zero and at most 100"))
+	}
+
+	if config.RecentErrorsBufferSize != nil && *config.RecentErrorsBufferSize <= 0 {
+		errs = multierr.Append(errs, errors.New("recent_errors_buffer_size must be greater than zero"))
+	}
+
+	if config.FinalOptimizationIterations != nil && *config.FinalOptimizationIterations <= 0 {
+		errs = multierr.Append(errs, errors.New("final_optimization_iterations must be greater than zero"))
+	}
+
+	if config.MaxActiveTrajectories != nil && *config.MaxActiveTrajectories <= 0 {
+		errs = multierr.Append(errs, errors.New("max_active_trajectories must be greater than zero"))
+	}
+
+	if config.MaxSensorSkewMs != nil && *config.MaxSensorSkewMs <= 0 {
+		errs = multierr.Append(errs, errors.New("max_sensor_skew_ms must be greater than zero"))
+	}
+
+	if config.LidarBufferSize != nil && *config.LidarBufferSize <= 0 {
+		errs = multierr.Append(errs, errors.New("lidar_buffer_size must be greater than zero"))
+	}
+
+	if config.MovementSensorBufferSize != nil && *config.MovementSensorBufferSize <= 0 {
+		errs = multierr.Append(errs, errors.New("movement_sensor_buffer_size must be greater than zero"))
+	}
+
+	if config.ExpectedTotal != nil && *config.ExpectedTotal <= 0 {
+		errs = multierr.Append(errs, errors.New("expected_total must be greater than zero"))
+	}
+
+	if config.MaxJobDurationSec != nil && *config.MaxJobDurationSec <= 0 {
+		errs = multierr.Append(errs, errors.New("max_job_duration_sec must be greater than zero"))
+	}
+
+	for _, code := range config.RetryableInitErrors {
+		if !strings.HasPrefix(code, "VIAM_CARTO_") {
+			errs = multierr.Append(errs,
+				errors.Errorf("retryable_init_errors must only contain cartographer error codes, got %q", code))
+		}
+	}
+
+	errs = multierr.Append(errs, config.calibration().validate())
+
+	if config.FloorPlan != nil {
+		errs = multierr.Append(errs, config.FloorPlan.validate())
+		if config.ExistingMap != "" {
+			errs = multierr.Append(errs, errors.New("floor_plan is an alternative to existing_map, only one of them may be set"))
+		}
+		if config.EnableMapping != nil && *config.EnableMapping {
+			errs = multierr.Append(errs,
+				errors.New("floor_plan is only supported in localization mode, i.e. with enable_mapping = false"))
+		}
+	}
+
+	if config.CalibrationFile != "" && !filepath.IsAbs(config.CalibrationFile) {
+		errs = multierr.Append(errs, errors.Errorf("calibration_file must be an absolute path, got %q", config.CalibrationFile))
+	}
+
+	for _, dir := range config.InternalStateExportDirs {
+		if !filepath.IsAbs(dir) {
+			errs = multierr.Append(errs,
+				errors.Errorf("internal_state_export_dirs must only contain absolute paths, got %q", dir))
+		}
+	}
+
+	errs = multierr.Append(errs, config.validateWarmStart())
+	errs = multierr.Append(errs, config.validateInternalStateSave())
+	errs = multierr.Append(errs, config.validateRecordDataset())
+	errs = multierr.Append(errs, config.validateShadowConfig())
+
 	movementSensorName, movementSensorExists := config.MovementSensor["name"]
 	if movementSensorExists && movementSensorName != "" {
 		deps = append(deps, movementSensorName)
 	}
 
+	if config.StrictCloudSlam != nil && *config.StrictCloudSlam {
+		if ignoredFields := config.CloudSlamIgnoredFields(); len(ignoredFields) > 0 {
+			errs = multierr.Append(errs,
+				errors.Errorf("strict_cloud_slam is set, but use_cloud_slam ignores %s", strings.Join(ignoredFields, ", ")))
+		}
+	}
+
+	if errs != nil {
+		return nil, errs
+	}
 	return deps, nil
 }
 
+// validateInternalStateSave returns an error unless internal_state_save_dir and internal_state_save_interval_sec
+// are set together.
+func (config *Config) validateInternalStateSave() error {
+	if config.InternalStateSaveDir == "" {
+		if config.InternalStateSaveIntervalSec != nil {
+			return errors.New("internal_state_save_interval_sec requires internal_state_save_dir")
+		}
+		if config.InternalStateSaveRetention != nil {
+			return errors.New("internal_state_save_retention requires internal_state_save_dir")
+		}
+		return nil
+	}
+	if !filepath.IsAbs(config.InternalStateSaveDir) {
+		return errors.Errorf("internal_state_save_dir must be an absolute path, got %q", config.InternalStateSaveDir)
+	}
+	if config.InternalStateSaveIntervalSec == nil {
+		return errors.New("internal_state_save_dir requires internal_state_save_interval_sec")
+	}
+	if *config.InternalStateSaveIntervalSec <= 0 {
+		return errors.New("internal_state_save_interval_sec must be greater than zero")
+	}
+	if config.InternalStateSaveRetention != nil && *config.InternalStateSaveRetention <= 0 {
+		return errors.New("internal_state_save_retention must be greater than zero")
+	}
+	return nil
+}
+
+// validateRecordDataset returns an error unless record_dataset_dir is an absolute path, set along with
+// record_dataset_compression_level if that is set, and the compression level is supported.
+func (config *Config) validateRecordDataset() error {
+	if config.RecordDatasetDir == "" {
+		if config.RecordDatasetCompressionLevel != nil {
+			return errors.New("record_dataset_compression_level requires record_dataset_dir")
+		}
+		return nil
+	}
+	if !filepath.IsAbs(config.RecordDatasetDir) {
+		return errors.Errorf("record_dataset_dir must be an absolute path, got %q", config.RecordDatasetDir)
+	}
+	if config.RecordDatasetCompressionLevel != nil {
+		if err := s.ValidateDatasetCompressionLevel(*config.RecordDatasetCompressionLevel); err != nil {
+			return errors.Wrap(err, "invalid record_dataset_compression_level")
+		}
+	}
+	return nil
+}
+
+// validateShadowConfig returns an error if shadow_config is set without overriding any of config_params, overrides
+// the mode, which the shadow shares with the primary, or holds an empty value. The values themselves are parsed
+// along with config_params.
+func (config *Config) validateShadowConfig() error {
+	if config.ShadowConfig == nil {
+		return nil
+	}
+	if len(config.ShadowConfig) == 0 {
+		return errors.New("shadow_config must override at least one of config_params")
+	}
+	keys := make([]string, 0, len(config.ShadowConfig))
+	for key := range config.ShadowConfig {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var errs error
+	for _, key := range keys {
+		switch {
+		case key == "mode":
+			errs = multierr.Append(errs,
+				errors.New("shadow_config[mode] is not supported, the shadow runs in the mode of config_params"))
+		case config.ShadowConfig[key] == "":
+			errs = multierr.Append(errs, errors.Errorf("shadow_config[%s] must not be empty", key))
+		}
+	}
+	return errs
+}
+
+// validateWarmStart returns an error if warm_start_dir is set along with a map to start from or in localization
+// mode, as warm_start_dir provides the existing map of a mapping session itself.
+func (config *Config) validateWarmStart() error {
+	if config.WarmStartDir == "" {
+		if config.WarmStartRetention != nil {
+			return errors.New("warm_start_retention requires warm_start_dir")
+		}
+		return nil
+	}
+	if !filepath.IsAbs(config.WarmStartDir) {
+		return errors.Errorf("warm_start_dir must be an absolute path, got %q", config.WarmStartDir)
+	}
+	if config.ExistingMap != "" {
+		return errors.New("warm_start_dir is an alternative to existing_map, only one of them may be set")
+	}
+	if config.FloorPlan != nil {
+		return errors.New("warm_start_dir is an alternative to floor_plan, only one of them may be set")
+	}
+	if config.EnableMapping != nil && !*config.EnableMapping {
+		return errors.New("warm_start_dir is only supported in mapping mode, i.e. with enable_mapping = true")
+	}
+	if config.WarmStartRetention != nil && *config.WarmStartRetention <= 0 {
+		return errors.New("warm_start_retention must be greater than zero")
+	}
+	return nil
+}
+
+// lidarPointFilter returns the filter of the points of the readings of camera, from camera[min_range_mm],
+// camera[max_range_mm], camera[angle_min_deg] and camera[angle_max_deg]. The angles must be set together.
+func (config *Config) lidarPointFilter() (s.LidarPointFilter, error) {
+	var filter s.LidarPointFilter
+	parse := func(key string) (float64, bool, error) {
+		str, ok := config.Camera[key]
+		if !ok {
+			return 0, false, nil
+		}
+		val, err := strconv.ParseFloat(str, 64)
+		if err != nil || math.IsNaN(val) || math.IsInf(val, 0) {
+			return 0, false, errors.Errorf("camera[%s] must be a number, got %q", key, str)
+		}
+		return val, true, nil
+	}
+	var err error
+	if filter.MinRangeMm, _, err = parse("min_range_mm"); err != nil {
+		return s.LidarPointFilter{}, err
+	}
+	if filter.MaxRangeMm, _, err = parse("max_range_mm"); err != nil {
+		return s.LidarPointFilter{}, err
+	}
+	angleMinDeg, hasAngleMin, err := parse("angle_min_deg")
+	if err != nil {
+		return s.LidarPointFilter{}, err
+	}
+	angleMaxDeg, hasAngleMax, err := parse("angle_max_deg")
+	if err != nil {
+		return s.LidarPointFilter{}, err
+	}
+	if hasAngleMin != hasAngleMax {
+		return s.LidarPointFilter{}, errors.New("camera[angle_min_deg] and camera[angle_max_deg] must be set together")
+	}
+	filter.HasAngularWindow = hasAngleMin
+	filter.AngleMinDeg = angleMinDeg
+	filter.AngleMaxDeg = angleMaxDeg
+	if err := filter.Validate(); err != nil {
+		return s.LidarPointFilter{}, errors.Wrap(err, "invalid camera point filter")
+	}
+	return filter, nil
+}
+
+// cloudSlamFields are the fields of the config, by json tag, that the slam service still uses when use_cloud_slam
+// is set. The keys of the sensors and config_params are checked separately.
+var cloudSlamFields = map[string]bool{
+	"camera":            true,
+	"movement_sensor":   true,
+	"config_params":     true,
+	"existing_map":      true,
+	"enable_mapping":    true,
+	"use_cloud_slam":    true,
+	"strict_cloud_slam": true,
+}
+
+// CloudSlamIgnoredFields returns the fields that are set but ignored by the slam service as use_cloud_slam is set,
+// as the mapping then runs in the cloud, e.g. camera[data_frequency_hz] or max_ingestion_latency_ms. Only the names
+// of the sensors, the mode and the mapping mode are used. It returns nothing if use_cloud_slam is not set.
+func (config *Config) CloudSlamIgnoredFields() []string {
+	if config.UseCloudSlam == nil || !*config.UseCloudSlam {
+		return nil
+	}
+	var ignoredFields []string
+	for _, params := range []struct {
+		field   string
+		values  map[string]string
+		usedKey string
+	}{
+		{"camera", config.Camera, "name"},
+		{"movement_sensor", config.MovementSensor, "name"},
+		{"config_params", config.ConfigParams, "mode"},
+	} {
+		var keys []string
+		for key := range params.values {
+			if key != params.usedKey {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			ignoredFields = append(ignoredFields, params.field+"["+key+"]")
+		}
+	}
+
+	val := reflect.ValueOf(*config)
+	for i := 0; i < val.NumField(); i++ {
+		field := strings.Split(val.Type().Field(i).Tag.Get("json"), ",")[0]
+		if !cloudSlamFields[field] && !val.Field(i).IsZero() {
+			ignoredFields = append(ignoredFields, field)
+		}
+	}
+	return ignoredFields
+}
+
 // GetOptionalParameters sets any unset optional config parameters to the values passed to this function,
 // and returns them.
 func GetOptionalParameters(config *Config, defaultLidarDataFrequencyHz, defaultMovementSensorDataFrequencyHz int, logger logging.Logger,
@@ -110,6 +832,27 @@ func GetOptionalParameters(config *Config, defaultLidarDataFrequencyHz, defaultM
 				optionalConfigParams.MovementSensorDataFrequencyHz = movementSensorDataFreqHz
 			}
 		}
+		// heading_only adds the heading of a movement sensor without Position, e.g. a compass, as odometer readings
+		if strHeadingOnly, ok := config.MovementSensor["heading_only"]; ok {
+			headingOnly, err := strconv.ParseBool(strHeadingOnly)
+			if err != nil {
+				return OptionalConfigParams{}, newError("movement_sensor[heading_only] must be true or false")
+			}
+			optionalConfigParams.MovementSensorHeadingOnly = headingOnly
+		}
+		// velocity_odometry integrates the velocities of a movement sensor without Position, e.g. a wheel encoder,
+		// into odometer readings
+		if strVelocityOdometry, ok := config.MovementSensor["velocity_odometry"]; ok {
+			velocityOdometry, err := strconv.ParseBool(strVelocityOdometry)
+			if err != nil {
+				return OptionalConfigParams{}, newError("movement_sensor[velocity_odometry] must be true or false")
+			}
+			optionalConfigParams.MovementSensorVelocityOdometry = velocityOdometry
+		}
+		if optionalConfigParams.MovementSensorHeadingOnly && optionalConfigParams.MovementSensorVelocityOdometry {
+			return OptionalConfigParams{}, newError(
+				"movement_sensor[heading_only] and movement_sensor[velocity_odometry] cannot both be set")
+		}
 	}
 
 	// Check if apriori map exists and is in correct format
@@ -122,6 +865,178 @@ func GetOptionalParameters(config *Config, defaultLidarDataFrequencyHz, defaultM
 		optionalConfigParams.ExistingMap = config.ExistingMap
 	}
 
+	optionalConfigParams.FloorPlan = config.FloorPlan
+
+	lidarPointFilter, err := config.lidarPointFilter()
+	if err != nil {
+		return OptionalConfigParams{}, newError(err.Error())
+	}
+	optionalConfigParams.LidarPointFilter = lidarPointFilter
+
+	for i, camera := range config.AdditionalCameras {
+		pointFilter, err := camera.pointFilter(fmt.Sprintf("additional_cameras[%d]", i))
+		if err != nil {
+			return OptionalConfigParams{}, newError(err.Error())
+		}
+		additionalLidar := AdditionalLidar{Name: camera.Name, Extrinsics: camera.Extrinsics, PointFilter: pointFilter}
+		switch {
+		case camera.DataFrequencyHz != nil:
+			additionalLidar.DataFrequencyHz = *camera.DataFrequencyHz
+		case optionalConfigParams.LidarDataFrequencyHz != 0:
+			additionalLidar.DataFrequencyHz = defaultLidarDataFrequencyHz
+		}
+		optionalConfigParams.AdditionalLidars = append(optionalConfigParams.AdditionalLidars, additionalLidar)
+	}
+
+	if config.FallbackToPreviousInternalState != nil {
+		optionalConfigParams.FallbackToPreviousInternalState = *config.FallbackToPreviousInternalState
+	}
+
+	if config.RebaseTimestamps != nil {
+		optionalConfigParams.RebaseTimestamps = *config.RebaseTimestamps
+	}
+
+	if config.HangThresholdSec != nil {
+		optionalConfigParams.HangThresholdSec = *config.HangThresholdSec
+	}
+
+	if config.RestartOnHang != nil {
+		optionalConfigParams.RestartOnHang = *config.RestartOnHang
+	}
+
+	if config.MinPointsPerScan != nil {
+		optionalConfigParams.MinPointsPerScan = *config.MinPointsPerScan
+	}
+
+	if config.RunFinalOptimizationOnCancel != nil {
+		optionalConfigParams.RunFinalOptimizationOnCancel = *config.RunFinalOptimizationOnCancel
+	}
+
+	if config.MaxIngestionLatencyMs != nil {
+		optionalConfigParams.MaxIngestionLatencyMs = *config.MaxIngestionLatencyMs
+	}
+
+	if config.MaxDutyCyclePercent != nil {
+		optionalConfigParams.MaxDutyCyclePercent = *config.MaxDutyCyclePercent
+	}
+
+	if config.MaxConsecutiveLidarFailures != nil {
+		optionalConfigParams.MaxConsecutiveLidarFailures = *config.MaxConsecutiveLidarFailures
+	}
+
+	if config.MaxRejectedReadingRetries != nil {
+		optionalConfigParams.MaxRejectedReadingRetries = *config.MaxRejectedReadingRetries
+		optionalConfigParams.HasMaxRejectedReadingRetries = true
+	}
+
+	if config.MaxUnoptimizedNodeAgeSec != nil {
+		optionalConfigParams.MaxUnoptimizedNodeAgeSec = *config.MaxUnoptimizedNodeAgeSec
+	}
+
+	if config.MaxPostprocessingTasks != nil {
+		optionalConfigParams.MaxPostprocessingTasks = *config.MaxPostprocessingTasks
+	}
+
+	if config.MaxInitAttempts != nil {
+		optionalConfigParams.MaxInitAttempts = *config.MaxInitAttempts
+	}
+
+	optionalConfigParams.RetryableInitErrors = config.RetryableInitErrors
+
+	if config.MaxSpeedMmPerSec != nil {
+		optionalConfigParams.MaxSpeedMmPerSec = *config.MaxSpeedMmPerSec
+	}
+
+	if config.MapStallLidarReadings != nil {
+		optionalConfigParams.MapStallLidarReadings = *config.MapStallLidarReadings
+	}
+
+	if config.LocalizationLostTimeoutSec != nil {
+		optionalConfigParams.LocalizationLostTimeoutSec = *config.LocalizationLostTimeoutSec
+	}
+
+	if config.LocalizationMinConfidencePercent != nil {
+		optionalConfigParams.LocalizationMinConfidencePercent = *config.LocalizationMinConfidencePercent
+	}
+
+	if config.PositionErrorOnLocalizationLost != nil {
+		optionalConfigParams.PositionErrorOnLocalizationLost = *config.PositionErrorOnLocalizationLost
+	}
+
+	if config.RecentErrorsBufferSize != nil {
+		optionalConfigParams.RecentErrorsBufferSize = *config.RecentErrorsBufferSize
+	}
+
+	if config.SkipFinalOptimization != nil {
+		optionalConfigParams.SkipFinalOptimization = *config.SkipFinalOptimization
+	}
+
+	if config.FinalOptimizationIterations != nil {
+		optionalConfigParams.FinalOptimizationIterations = *config.FinalOptimizationIterations
+	}
+
+	if config.OptimizeOnClose != nil {
+		optionalConfigParams.OptimizeOnClose = *config.OptimizeOnClose
+	}
+
+	if config.MaxActiveTrajectories != nil {
+		optionalConfigParams.MaxActiveTrajectories = *config.MaxActiveTrajectories
+	}
+
+	if config.FreezeOldestOnLimit != nil {
+		optionalConfigParams.FreezeOldestOnLimit = *config.FreezeOldestOnLimit
+	}
+
+	if config.MaxSensorSkewMs != nil {
+		optionalConfigParams.MaxSensorSkewMs = *config.MaxSensorSkewMs
+	}
+
+	if config.LidarBufferSize != nil {
+		optionalConfigParams.LidarBufferSize = *config.LidarBufferSize
+	}
+
+	if config.MovementSensorBufferSize != nil {
+		optionalConfigParams.MovementSensorBufferSize = *config.MovementSensorBufferSize
+	}
+
+	if config.OptimizeOnStartAsync != nil {
+		optionalConfigParams.OptimizeOnStartAsync = *config.OptimizeOnStartAsync
+	}
+
+	if config.ExpectedTotal != nil {
+		optionalConfigParams.ExpectedTotal = *config.ExpectedTotal
+	}
+
+	if config.MaxJobDurationSec != nil {
+		optionalConfigParams.MaxJobDurationSec = *config.MaxJobDurationSec
+	}
+
+	if config.AllowMixedClockDomains != nil {
+		optionalConfigParams.AllowMixedClockDomains = *config.AllowMixedClockDomains
+	}
+
+	if config.ConvertUnsupportedPCD != nil {
+		optionalConfigParams.ConvertUnsupportedPCD = *config.ConvertUnsupportedPCD
+	}
+
+	optionalConfigParams.IMUAngularVelocityUnits = s.DegreesPerSecond
+	if config.IMUAngularVelocityUnits != nil {
+		optionalConfigParams.IMUAngularVelocityUnits = s.AngularVelocityUnits(*config.IMUAngularVelocityUnits)
+	}
+
+	for _, dir := range config.InternalStateExportDirs {
+		optionalConfigParams.InternalStateExportDirs = append(optionalConfigParams.InternalStateExportDirs, filepath.Clean(dir))
+	}
+
+	optionalConfigParams.LidarExtrinsics = config.LidarExtrinsics
+	optionalConfigParams.IMUOrientation = config.IMUOrientation
+	if config.LidarTimeOffsetMs != nil {
+		optionalConfigParams.LidarTimeOffsetMs = *config.LidarTimeOffsetMs
+	}
+	if config.MovementSensorTimeOffsetMs != nil {
+		optionalConfigParams.MovementSensorTimeOffsetMs = *config.MovementSensorTimeOffsetMs
+	}
+
 	// Setting enable mapping
 	if config.EnableMapping == nil {
 		logger.Debug("no enable_mapping given, setting to default value of false")
@@ -129,11 +1044,42 @@ func GetOptionalParameters(config *Config, defaultLidarDataFrequencyHz, defaultM
 		optionalConfigParams.EnableMapping = *config.EnableMapping
 	}
 
+	if config.InternalStateSaveDir != "" {
+		optionalConfigParams.InternalStateSaveDir = filepath.Clean(config.InternalStateSaveDir)
+		optionalConfigParams.InternalStateSaveIntervalSec = *config.InternalStateSaveIntervalSec
+		if config.InternalStateSaveRetention != nil {
+			optionalConfigParams.InternalStateSaveRetention = *config.InternalStateSaveRetention
+		}
+	}
+
+	if config.RecordDatasetDir != "" {
+		optionalConfigParams.RecordDatasetDir = filepath.Clean(config.RecordDatasetDir)
+		if config.RecordDatasetCompressionLevel != nil {
+			optionalConfigParams.RecordDatasetCompressionLevel = *config.RecordDatasetCompressionLevel
+		}
+	}
+
+	// warm_start_dir provides the existing map of a mapping session
+	if config.WarmStartDir != "" {
+		optionalConfigParams.WarmStartDir = filepath.Clean(config.WarmStartDir)
+		optionalConfigParams.EnableMapping = true
+		if config.WarmStartRetention != nil {
+			optionalConfigParams.WarmStartRetention = *config.WarmStartRetention
+		}
+	}
+
 	// Validate slam mode
 	if err := validateModes(optionalConfigParams); err != nil {
 		return OptionalConfigParams{}, err
 	}
 
+	if config.ChangeDetection != nil && *config.ChangeDetection {
+		if optionalConfigParams.EnableMapping || optionalConfigParams.ExistingMap == "" {
+			return OptionalConfigParams{}, errChangeDetectionWithoutLocalization
+		}
+		optionalConfigParams.ChangeDetection = true
+	}
+
 	return optionalConfigParams, nil
 }
 
@@ -145,3 +1091,19 @@ func validateModes(optionalConfigParams OptionalConfigParams) error {
 	}
 	return nil
 }
+
+var errSLAMServiceRequired = errors.New("\"slam_service\" is required")
+
+// PoseSensorConfig describes how to configure the movement sensor that republishes the pose of a cartographer
+// SLAM service of the same module.
+type PoseSensorConfig struct {
+	SLAMService string `json:"slam_service"`
+}
+
+// Validate creates the list of implicit dependencies.
+func (config *PoseSensorConfig) Validate(path string) ([]string, error) {
+	if config.SLAMService == "" {
+		return nil, utils.NewConfigValidationError(path, errSLAMServiceRequired)
+	}
+	return []string{config.SLAMService}, nil
+}
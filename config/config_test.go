@@ -4,11 +4,15 @@ import (
 	"fmt"
 	"testing"
 
+	"github.com/golang/geo/r2"
+	"github.com/pkg/errors"
 	"go.viam.com/rdk/logging"
 	"go.viam.com/rdk/resource"
 	"go.viam.com/rdk/services/slam"
 	"go.viam.com/test"
 	"go.viam.com/utils"
+
+	s "github.com/viam-modules/viam-cartographer/sensors"
 )
 
 func TestValidate(t *testing.T) {
@@ -53,6 +57,19 @@ func TestValidate(t *testing.T) {
 		test.That(t, err, test.ShouldBeNil)
 	})
 
+	t.Run("Config with legacy attributes", func(t *testing.T) {
+		cfgService := makeCfgService()
+		cfgService.Attributes["sensors"] = []string{"rplidar"}
+		cfgService.Attributes["data_rate_msec"] = 200
+		_, err := newConfig(cfgService)
+		test.That(t, err, test.ShouldBeError, newError(utils.NewConfigValidationError(testCfgPath,
+			errors.Wrap(ErrLegacyConfig, "sensors, data_rate_msec set")).Error()))
+
+		delete(cfgService.Attributes, "camera")
+		_, err = newConfig(cfgService)
+		test.That(t, err.Error(), test.ShouldContainSubstring, ErrLegacyConfig.Error())
+	})
+
 	t.Run("Config with invalid parameter type", func(t *testing.T) {
 		key := "existing_map"
 
@@ -77,7 +94,252 @@ func TestValidate(t *testing.T) {
 			"data_frequency_hz": "-1",
 		}
 		_, err := newConfig(cfgService)
-		test.That(t, err, test.ShouldBeError, newError("cannot specify camera[data_frequency_hz] less than zero"))
+		test.That(t, err, test.ShouldBeError, newError("cannot specify camera[data_frequency_hz] less than zero, got -1"))
+
+		cfgService = makeCfgService()
+		cfgService.Attributes["hang_threshold_sec"] = 0
+		_, err = newConfig(cfgService)
+		test.That(t, err, test.ShouldBeError, newError("hang_threshold_sec must be greater than zero"))
+
+		cfgService = makeCfgService()
+		cfgService.Attributes["min_points_per_scan"] = -1
+		_, err = newConfig(cfgService)
+		test.That(t, err, test.ShouldBeError, newError("cannot specify min_points_per_scan less than zero"))
+
+		cfgService = makeCfgService()
+		cfgService.Attributes["max_ingestion_latency_ms"] = 0
+		_, err = newConfig(cfgService)
+		test.That(t, err, test.ShouldBeError, newError("max_ingestion_latency_ms must be greater than zero"))
+
+		for _, maxDutyCyclePercent := range []int{0, 101} {
+			cfgService = makeCfgService()
+			cfgService.Attributes["max_duty_cycle_percent"] = maxDutyCyclePercent
+			_, err = newConfig(cfgService)
+			test.That(t, err, test.ShouldBeError, newError("max_duty_cycle_percent must be greater than zero and at most 100"))
+		}
+
+		cfgService = makeCfgService()
+		cfgService.Attributes["max_consecutive_lidar_failures"] = 0
+		_, err = newConfig(cfgService)
+		test.That(t, err, test.ShouldBeError, newError("max_consecutive_lidar_failures must be greater than zero"))
+
+		cfgService = makeCfgService()
+		cfgService.Attributes["max_rejected_reading_retries"] = -1
+		_, err = newConfig(cfgService)
+		test.That(t, err, test.ShouldBeError, newError("max_rejected_reading_retries must not be negative"))
+
+		cfgService = makeCfgService()
+		cfgService.Attributes["max_rejected_reading_retries"] = 0
+		_, err = newConfig(cfgService)
+		test.That(t, err, test.ShouldBeNil)
+
+		cfgService = makeCfgService()
+		cfgService.Attributes["max_unoptimized_node_age_sec"] = 0
+		_, err = newConfig(cfgService)
+		test.That(t, err, test.ShouldBeError, newError("max_unoptimized_node_age_sec must be greater than zero"))
+
+		cfgService = makeCfgService()
+		cfgService.Attributes["max_postprocessing_tasks"] = 0
+		_, err = newConfig(cfgService)
+		test.That(t, err, test.ShouldBeError, newError("max_postprocessing_tasks must be greater than zero"))
+
+		cfgService = makeCfgService()
+		cfgService.Attributes["max_init_attempts"] = 0
+		_, err = newConfig(cfgService)
+		test.That(t, err, test.ShouldBeError, newError("max_init_attempts must be greater than zero"))
+
+		cfgService = makeCfgService()
+		cfgService.Attributes["max_speed_mm_per_sec"] = 0
+		_, err = newConfig(cfgService)
+		test.That(t, err, test.ShouldBeError, newError("max_speed_mm_per_sec must be greater than zero"))
+
+		cfgService = makeCfgService()
+		cfgService.Attributes["map_stall_lidar_readings"] = -1
+		_, err = newConfig(cfgService)
+		test.That(t, err, test.ShouldBeError, newError("map_stall_lidar_readings must be greater than zero"))
+
+		cfgService = makeCfgService()
+		cfgService.Attributes["localization_lost_timeout_sec"] = 0
+		_, err = newConfig(cfgService)
+		test.That(t, err, test.ShouldBeError, newError("localization_lost_timeout_sec must be greater than zero"))
+
+		for _, localizationMinConfidencePercent := range []int{0, 101} {
+			cfgService = makeCfgService()
+			cfgService.Attributes["localization_min_confidence_percent"] = localizationMinConfidencePercent
+			_, err = newConfig(cfgService)
+			test.That(t, err, test.ShouldBeError,
+				newError("localization_min_confidence_percent must be greater than zero and at most 100"))
+		}
+
+		cfgService = makeCfgService()
+		cfgService.Attributes["recent_errors_buffer_size"] = 0
+		_, err = newConfig(cfgService)
+		test.That(t, err, test.ShouldBeError, newError("recent_errors_buffer_size must be greater than zero"))
+
+		cfgService = makeCfgService()
+		cfgService.Attributes["final_optimization_iterations"] = 0
+		_, err = newConfig(cfgService)
+		test.That(t, err, test.ShouldBeError, newError("final_optimization_iterations must be greater than zero"))
+
+		cfgService = makeCfgService()
+		cfgService.Attributes["max_active_trajectories"] = 0
+		_, err = newConfig(cfgService)
+		test.That(t, err, test.ShouldBeError, newError("max_active_trajectories must be greater than zero"))
+
+		cfgService = makeCfgService()
+		cfgService.Attributes["max_sensor_skew_ms"] = 0
+		_, err = newConfig(cfgService)
+		test.That(t, err, test.ShouldBeError, newError("max_sensor_skew_ms must be greater than zero"))
+
+		cfgService = makeCfgService()
+		cfgService.Attributes["lidar_buffer_size"] = 0
+		_, err = newConfig(cfgService)
+		test.That(t, err, test.ShouldBeError, newError("lidar_buffer_size must be greater than zero"))
+
+		cfgService = makeCfgService()
+		cfgService.Attributes["movement_sensor_buffer_size"] = -1
+		_, err = newConfig(cfgService)
+		test.That(t, err, test.ShouldBeError, newError("movement_sensor_buffer_size must be greater than zero"))
+
+		cfgService = makeCfgService()
+		cfgService.Attributes["expected_total"] = 0
+		_, err = newConfig(cfgService)
+		test.That(t, err, test.ShouldBeError, newError("expected_total must be greater than zero"))
+
+		cfgService = makeCfgService()
+		cfgService.Attributes["max_job_duration_sec"] = 0
+		_, err = newConfig(cfgService)
+		test.That(t, err, test.ShouldBeError, newError("max_job_duration_sec must be greater than zero"))
+
+		cfgService = makeCfgService()
+		cfgService.Attributes["retryable_init_errors"] = []string{"VIAM_CARTO_OUT_OF_MEMORY", "out of memory"}
+		_, err = newConfig(cfgService)
+		test.That(t, err, test.ShouldBeError,
+			newError("retryable_init_errors must only contain cartographer error codes, got \"out of memory\""))
+
+		cfgService = makeCfgService()
+		cfgService.Attributes["imu_angular_velocity_units"] = "rpm"
+		_, err = newConfig(cfgService)
+		test.That(t, err, test.ShouldBeError, newError("imu_angular_velocity_units must be \"deg_per_sec\" or \"rad_per_sec\""))
+
+		cfgService = makeCfgService()
+		cfgService.Attributes["lidar_extrinsics"] = map[string]interface{}{"x": 100, "theta": 90}
+		_, err = newConfig(cfgService)
+		test.That(t, err, test.ShouldBeError, newError("lidar_extrinsics must have a non zero o_x, o_y or o_z"))
+
+		cfgService = makeCfgService()
+		cfgService.Attributes["calibration_file"] = "calibration.json"
+		_, err = newConfig(cfgService)
+		test.That(t, err, test.ShouldBeError, newError("calibration_file must be an absolute path, got \"calibration.json\""))
+
+		cfgService = makeCfgService()
+		cfgService.Attributes["internal_state_export_dirs"] = []string{"/data/exports", "exports"}
+		_, err = newConfig(cfgService)
+		test.That(t, err, test.ShouldBeError, newError("internal_state_export_dirs must only contain absolute paths, got \"exports\""))
+
+		for msg, floorPlan := range map[string]map[string]interface{}{
+			"floor_plan must contain an image":                           {"resolution_mm": 50},
+			"floor_plan image must be an absolute path, got \"map.pgm\"": {"image": "map.pgm", "resolution_mm": 50},
+			"floor_plan image must be a .pgm or .png file, got \"/data/map.yaml\"": {
+				"image": "/data/map.yaml", "resolution_mm": 50,
+			},
+			"floor_plan resolution_mm must be greater than zero": {"image": "/data/map.pgm"},
+		} {
+			cfgService = makeCfgService()
+			cfgService.Attributes["floor_plan"] = floorPlan
+			_, err = newConfig(cfgService)
+			test.That(t, err, test.ShouldBeError, newError(msg))
+		}
+
+		cfgService = makeCfgService()
+		cfgService.Attributes["floor_plan"] = map[string]interface{}{"image": "/data/map.pgm", "resolution_mm": 50}
+		cfgService.Attributes["existing_map"] = "/data/map.pbstream"
+		_, err = newConfig(cfgService)
+		test.That(t, err, test.ShouldBeError, newError("floor_plan is an alternative to existing_map, only one of them may be set"))
+
+		cfgService = makeCfgService()
+		cfgService.Attributes["floor_plan"] = map[string]interface{}{"image": "/data/map.pgm", "resolution_mm": 50}
+		cfgService.Attributes["enable_mapping"] = true
+		_, err = newConfig(cfgService)
+		test.That(t, err, test.ShouldBeError,
+			newError("floor_plan is only supported in localization mode, i.e. with enable_mapping = false"))
+
+		for msg, attributes := range map[string]map[string]interface{}{
+			"warm_start_dir must be an absolute path, got \"maps\"": {"warm_start_dir": "maps"},
+			"warm_start_dir is an alternative to existing_map, only one of them may be set": {
+				"warm_start_dir": "/data/maps", "existing_map": "/data/map.pbstream",
+			},
+			"warm_start_dir is an alternative to floor_plan, only one of them may be set": {
+				"warm_start_dir": "/data/maps",
+				"floor_plan":     map[string]interface{}{"image": "/data/map.pgm", "resolution_mm": 50},
+			},
+			"warm_start_dir is only supported in mapping mode, i.e. with enable_mapping = true": {
+				"warm_start_dir": "/data/maps", "enable_mapping": false,
+			},
+			"warm_start_retention must be greater than zero": {"warm_start_dir": "/data/maps", "warm_start_retention": 0},
+			"warm_start_retention requires warm_start_dir":   {"warm_start_retention": 3},
+			"internal_state_save_dir must be an absolute path, got \"maps\"": {
+				"internal_state_save_dir": "maps", "internal_state_save_interval_sec": 60,
+			},
+			"internal_state_save_dir requires internal_state_save_interval_sec": {
+				"internal_state_save_dir": "/data/maps",
+			},
+			"internal_state_save_interval_sec requires internal_state_save_dir": {
+				"internal_state_save_interval_sec": 60,
+			},
+			"internal_state_save_retention requires internal_state_save_dir": {
+				"internal_state_save_retention": 3,
+			},
+			"internal_state_save_interval_sec must be greater than zero": {
+				"internal_state_save_dir": "/data/maps", "internal_state_save_interval_sec": 0,
+			},
+			"internal_state_save_retention must be greater than zero": {
+				"internal_state_save_dir": "/data/maps", "internal_state_save_interval_sec": 60,
+				"internal_state_save_retention": 0,
+			},
+			"record_dataset_dir must be an absolute path, got \"recordings\"": {"record_dataset_dir": "recordings"},
+			"record_dataset_compression_level requires record_dataset_dir":    {"record_dataset_compression_level": 6},
+			"invalid record_dataset_compression_level: " + s.ErrInvalidDatasetCompressionLevel.Error(): {
+				"record_dataset_dir": "/data/recordings", "record_dataset_compression_level": 10,
+			},
+			"shadow_config must override at least one of config_params": {"shadow_config": map[string]string{}},
+			"shadow_config[mode] is not supported, the shadow runs in the mode of config_params": {
+				"shadow_config": map[string]string{"mode": "2d"},
+			},
+			"shadow_config[max_range] must not be empty": {
+				"shadow_config": map[string]string{"max_range": "", "min_range": "0.5"},
+			},
+		} {
+			cfgService = makeCfgService()
+			for name, value := range attributes {
+				cfgService.Attributes[name] = value
+			}
+			_, err = newConfig(cfgService)
+			test.That(t, err, test.ShouldBeError, newError(msg))
+		}
+	})
+
+	t.Run("Config with several invalid values reports all of them", func(t *testing.T) {
+		cfgService := makeCfgService()
+		cfgService.Attributes["camera"] = map[string]string{"name": "a", "data_frequency_hz": "fast"}
+		cfgService.Attributes["additional_cameras"] = []map[string]interface{}{{"name": "b", "data_frequency_hz": 0}}
+		cfgService.Attributes["hang_threshold_sec"] = 0
+		cfgService.Attributes["lidar_buffer_size"] = -1
+		cfgService.Attributes["calibration_file"] = "calibration.json"
+		_, err := newConfig(cfgService)
+		test.That(t, err, test.ShouldBeError, newError("camera[data_frequency_hz] must only contain digits, got \"fast\"; "+
+			"hang_threshold_sec must be greater than zero; "+
+			"lidar_buffer_size must be greater than zero; "+
+			"calibration_file must be an absolute path, got \"calibration.json\""))
+		// whether additional_cameras[0][data_frequency_hz] may be 0 is unknown without a valid camera[data_frequency_hz]
+		test.That(t, err.Error(), test.ShouldNotContainSubstring, "additional_cameras")
+
+		cfgService = makeCfgService()
+		cfgService.Attributes["camera"] = map[string]string{"name": "a", "data_frequency_hz": "0"}
+		cfgService.Attributes["additional_cameras"] = []map[string]interface{}{{"data_frequency_hz": 5}}
+		_, err = newConfig(cfgService)
+		test.That(t, err, test.ShouldBeError, newError("additional_cameras[0][name] is required; "+
+			"additional_cameras[0][data_frequency_hz] must be 0 in offline mode, i.e. if camera[data_frequency_hz] is 0"))
 	})
 
 	t.Run("All parameters e2e", func(t *testing.T) {
@@ -89,9 +351,253 @@ func TestValidate(t *testing.T) {
 			"value":   "0",
 			"value_2": "test",
 		}
+		cfgService.Attributes["shadow_config"] = map[string]string{"optimize_every_n_nodes": "10"}
 		cfg, err := newConfig(cfgService)
 		test.That(t, err, test.ShouldBeNil)
 		test.That(t, cfg.ConfigParams, test.ShouldResemble, cfgService.Attributes["config_params"])
+		test.That(t, cfg.ShadowConfig, test.ShouldResemble, cfgService.Attributes["shadow_config"])
+	})
+
+	t.Run("Config with mapping bounds", func(t *testing.T) {
+		cfgService := makeCfgService()
+		cfgService.Attributes["mapping_bounds"] = map[string]interface{}{
+			"min_x": -1000, "min_y": -2000, "max_x": 1000, "max_y": 2000,
+		}
+		cfg, err := newConfig(cfgService)
+		test.That(t, err, test.ShouldBeNil)
+		vertices, err := cfg.MappingBounds.Vertices()
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, vertices, test.ShouldResemble, []r2.Point{
+			{X: -1000, Y: -2000}, {X: 1000, Y: -2000}, {X: 1000, Y: 2000}, {X: -1000, Y: 2000},
+		})
+
+		cfgService.Attributes["mapping_bounds"] = map[string]interface{}{
+			"polygon":              []map[string]float64{{"x": 0, "y": 0}, {"x": 1000, "y": 0}, {"x": 0, "y": 1000}},
+			"clip_point_cloud_map": true,
+		}
+		cfg, err = newConfig(cfgService)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, cfg.MappingBounds.ClipPointCloudMap, test.ShouldBeTrue)
+		vertices, err = cfg.MappingBounds.Vertices()
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, vertices, test.ShouldResemble, []r2.Point{{X: 0, Y: 0}, {X: 1000, Y: 0}, {X: 0, Y: 1000}})
+	})
+
+	t.Run("Config with invalid mapping bounds", func(t *testing.T) {
+		for _, tc := range []struct {
+			bounds map[string]interface{}
+			errMsg string
+		}{
+			{
+				bounds: map[string]interface{}{"min_x": -1000, "min_y": -1000, "max_x": 1000},
+				errMsg: "mapping_bounds must contain all of min_x, min_y, max_x & max_y",
+			},
+			{
+				bounds: map[string]interface{}{"min_x": 1000, "min_y": -1000, "max_x": -1000, "max_y": 1000},
+				errMsg: "mapping_bounds min_x & min_y must be less than max_x & max_y",
+			},
+			{
+				bounds: map[string]interface{}{"polygon": []map[string]float64{{"x": 0, "y": 0}, {"x": 1000, "y": 0}}},
+				errMsg: "mapping_bounds polygon must contain at least three points",
+			},
+			{
+				bounds: map[string]interface{}{
+					"min_x": -1000, "min_y": -1000, "max_x": 1000, "max_y": 1000,
+					"polygon": []map[string]float64{{"x": 0, "y": 0}, {"x": 1000, "y": 0}, {"x": 0, "y": 1000}},
+				},
+				errMsg: "mapping_bounds must contain either min_x, min_y, max_x & max_y or a polygon, not both",
+			},
+		} {
+			cfgService := makeCfgService()
+			cfgService.Attributes["mapping_bounds"] = tc.bounds
+			_, err := newConfig(cfgService)
+			test.That(t, err, test.ShouldNotBeNil)
+			test.That(t, err.Error(), test.ShouldContainSubstring, tc.errMsg)
+		}
+	})
+
+	t.Run("Config with additional cameras", func(t *testing.T) {
+		cfgService := makeCfgService()
+		cfgService.Attributes["additional_cameras"] = []map[string]interface{}{
+			{"name": "b", "data_frequency_hz": 10, "extrinsics": map[string]float64{"x": 100, "o_z": 1, "theta": 180}},
+			{"name": "c", "max_range_mm": 8000, "angle_min_deg": -90, "angle_max_deg": 90},
+		}
+		cfg, err := newConfig(cfgService)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, len(cfg.AdditionalCameras), test.ShouldEqual, 2)
+		test.That(t, *cfg.AdditionalCameras[0].DataFrequencyHz, test.ShouldEqual, 10)
+		test.That(t, cfg.AdditionalCameras[0].Extrinsics.X, test.ShouldEqual, 100)
+		test.That(t, cfg.AdditionalCameras[1].DataFrequencyHz, test.ShouldBeNil)
+		deps, err := cfg.Validate(testCfgPath)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, deps, test.ShouldResemble, []string{"a", "b", "c"})
+
+		// the filter of camera does not apply to the additional cameras, which have their own
+		cfg.Camera["min_range_mm"] = "100"
+		optionalConfigParams, err := GetOptionalParameters(cfg, 5, 20, logger)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, optionalConfigParams.AdditionalLidars[0].PointFilter, test.ShouldResemble, s.LidarPointFilter{})
+		test.That(t, optionalConfigParams.AdditionalLidars[1].PointFilter, test.ShouldResemble, s.LidarPointFilter{
+			MaxRangeMm: 8000, HasAngularWindow: true, AngleMinDeg: -90, AngleMaxDeg: 90,
+		})
+
+		cfgService.Attributes["camera"] = map[string]string{"name": "a", "data_frequency_hz": "0"}
+		cfgService.Attributes["additional_cameras"] = []map[string]interface{}{{"name": "b", "data_frequency_hz": 0}, {"name": "c"}}
+		_, err = newConfig(cfgService)
+		test.That(t, err, test.ShouldBeNil)
+	})
+
+	t.Run("Config with invalid additional cameras", func(t *testing.T) {
+		for _, tc := range []struct {
+			camera            map[string]string
+			additionalCameras []map[string]interface{}
+			errMsg            string
+		}{
+			{
+				additionalCameras: []map[string]interface{}{{"data_frequency_hz": 5}},
+				errMsg:            "additional_cameras[0][name] is required",
+			},
+			{
+				additionalCameras: []map[string]interface{}{{"name": "b"}, {"name": "a"}},
+				errMsg:            "additional_cameras[1][name] \"a\" is already used by another camera",
+			},
+			{
+				additionalCameras: []map[string]interface{}{{"name": "b"}, {"name": "b"}},
+				errMsg:            "additional_cameras[1][name] \"b\" is already used by another camera",
+			},
+			{
+				additionalCameras: []map[string]interface{}{{"name": "b", "data_frequency_hz": -1}},
+				errMsg:            "cannot specify additional_cameras[0][data_frequency_hz] less than zero",
+			},
+			{
+				additionalCameras: []map[string]interface{}{{"name": "b", "data_frequency_hz": 0}},
+				errMsg:            "additional_cameras[0][data_frequency_hz] can only be 0 in offline mode",
+			},
+			{
+				camera:            map[string]string{"name": "a", "data_frequency_hz": "0"},
+				additionalCameras: []map[string]interface{}{{"name": "b", "data_frequency_hz": 5}},
+				errMsg:            "additional_cameras[0][data_frequency_hz] must be 0 in offline mode",
+			},
+			{
+				additionalCameras: []map[string]interface{}{{"name": "b", "extrinsics": map[string]float64{"theta": 90}}},
+				errMsg:            "additional_cameras[0][extrinsics]",
+			},
+			{
+				additionalCameras: []map[string]interface{}{{"name": "b", "angle_min_deg": -90}},
+				errMsg:            "additional_cameras[0][angle_min_deg] and additional_cameras[0][angle_max_deg] must be set together",
+			},
+			{
+				additionalCameras: []map[string]interface{}{{"name": "b", "min_range_mm": 500, "max_range_mm": 100}},
+				errMsg:            "invalid additional_cameras[0] point filter",
+			},
+		} {
+			cfgService := makeCfgService()
+			if tc.camera != nil {
+				cfgService.Attributes["camera"] = tc.camera
+			}
+			cfgService.Attributes["additional_cameras"] = tc.additionalCameras
+			_, err := newConfig(cfgService)
+			test.That(t, err, test.ShouldNotBeNil)
+			test.That(t, err.Error(), test.ShouldContainSubstring, tc.errMsg)
+		}
+	})
+
+	t.Run("Config with invalid camera point filters", func(t *testing.T) {
+		for _, tc := range []struct {
+			camera map[string]string
+			errMsg string
+		}{
+			{
+				camera: map[string]string{"name": "a", "min_range_mm": "near"},
+				errMsg: "camera[min_range_mm] must be a number, got \"near\"",
+			},
+			{
+				camera: map[string]string{"name": "a", "min_range_mm": "-1"},
+				errMsg: "the ranges of a lidar point filter must not be negative",
+			},
+			{
+				camera: map[string]string{"name": "a", "min_range_mm": "500", "max_range_mm": "200"},
+				errMsg: "the max range of a lidar point filter must be greater than its min range",
+			},
+			{
+				camera: map[string]string{"name": "a", "angle_min_deg": "-90"},
+				errMsg: "camera[angle_min_deg] and camera[angle_max_deg] must be set together",
+			},
+			{
+				camera: map[string]string{"name": "a", "angle_min_deg": "-90", "angle_max_deg": "270"},
+				errMsg: "the angles of a lidar point filter must be between -180 and 180 degrees",
+			},
+		} {
+			cfgService := makeCfgService()
+			cfgService.Attributes["camera"] = tc.camera
+			_, err := newConfig(cfgService)
+			test.That(t, err, test.ShouldNotBeNil)
+			test.That(t, err.Error(), test.ShouldContainSubstring, tc.errMsg)
+		}
+	})
+
+	t.Run("Config with strict_cloud_slam", func(t *testing.T) {
+		cfgService := makeCfgService()
+		cfgService.Attributes["use_cloud_slam"] = true
+		cfgService.Attributes["strict_cloud_slam"] = true
+		_, err := newConfig(cfgService)
+		test.That(t, err, test.ShouldBeNil)
+
+		cfgService.Attributes["camera"] = map[string]string{"name": "a", "data_frequency_hz": "5"}
+		cfgService.Attributes["max_ingestion_latency_ms"] = 100
+		_, err = newConfig(cfgService)
+		test.That(t, err, test.ShouldBeError,
+			newError("strict_cloud_slam is set, but use_cloud_slam ignores camera[data_frequency_hz], max_ingestion_latency_ms"))
+
+		cfgService.Attributes["use_cloud_slam"] = false
+		_, err = newConfig(cfgService)
+		test.That(t, err, test.ShouldBeNil)
+	})
+}
+
+func TestCloudSlamIgnoredFields(t *testing.T) {
+	t.Run("Nothing is ignored without use_cloud_slam", func(t *testing.T) {
+		cfgService := makeCfgService()
+		cfgService.Attributes["camera"] = map[string]string{"name": "a", "data_frequency_hz": "5"}
+		cfg, err := newConfig(cfgService)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, cfg.CloudSlamIgnoredFields(), test.ShouldBeEmpty)
+	})
+
+	t.Run("The sensor names, the mode and the mapping mode are not ignored", func(t *testing.T) {
+		cfgService := makeCfgService()
+		cfgService.Attributes["use_cloud_slam"] = true
+		cfgService.Attributes["movement_sensor"] = map[string]string{"name": "b"}
+		cfgService.Attributes["enable_mapping"] = true
+		cfgService.Attributes["existing_map"] = "map.pbstream"
+		cfg, err := newConfig(cfgService)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, cfg.CloudSlamIgnoredFields(), test.ShouldBeEmpty)
+	})
+
+	t.Run("Every other field that is set is ignored", func(t *testing.T) {
+		cfgService := makeCfgService()
+		cfgService.Attributes["use_cloud_slam"] = true
+		cfgService.Attributes["camera"] = map[string]string{"name": "a", "data_frequency_hz": "5"}
+		cfgService.Attributes["movement_sensor"] = map[string]string{"name": "b", "heading_only": "true", "data_frequency_hz": "20"}
+		cfgService.Attributes["config_params"] = map[string]string{"mode": "2d", "optimize_every_n_nodes": "3", "min_range": "0.3"}
+		cfgService.Attributes["rebase_timestamps"] = false
+		cfgService.Attributes["max_duty_cycle_percent"] = 80
+		cfgService.Attributes["internal_state_export_dirs"] = []string{"/tmp"}
+		cfgService.Attributes["shadow_config"] = map[string]string{"optimize_every_n_nodes": "1"}
+		cfg, err := newConfig(cfgService)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, cfg.CloudSlamIgnoredFields(), test.ShouldResemble, []string{
+			"camera[data_frequency_hz]",
+			"movement_sensor[data_frequency_hz]",
+			"movement_sensor[heading_only]",
+			"config_params[min_range]",
+			"config_params[optimize_every_n_nodes]",
+			"rebase_timestamps",
+			"max_duty_cycle_percent",
+			"internal_state_export_dirs",
+			"shadow_config",
+		})
 	})
 }
 
@@ -126,8 +632,58 @@ func TestGetOptionalParameters(t *testing.T) {
 		test.That(t, optionalConfigParams.LidarDataFrequencyHz, test.ShouldEqual, 1000)
 		test.That(t, optionalConfigParams.MovementSensorName, test.ShouldEqual, "")
 		test.That(t, optionalConfigParams.MovementSensorDataFrequencyHz, test.ShouldEqual, 0)
+		test.That(t, optionalConfigParams.MovementSensorHeadingOnly, test.ShouldBeFalse)
+		test.That(t, optionalConfigParams.MovementSensorVelocityOdometry, test.ShouldBeFalse)
 		test.That(t, optionalConfigParams.EnableMapping, test.ShouldBeFalse)
 		test.That(t, optionalConfigParams.ExistingMap, test.ShouldEqual, "")
+		test.That(t, optionalConfigParams.FallbackToPreviousInternalState, test.ShouldBeFalse)
+		test.That(t, optionalConfigParams.RebaseTimestamps, test.ShouldBeFalse)
+		test.That(t, optionalConfigParams.HangThresholdSec, test.ShouldEqual, 0)
+		test.That(t, optionalConfigParams.RestartOnHang, test.ShouldBeFalse)
+		test.That(t, optionalConfigParams.MinPointsPerScan, test.ShouldEqual, 0)
+		test.That(t, optionalConfigParams.RunFinalOptimizationOnCancel, test.ShouldBeFalse)
+		test.That(t, optionalConfigParams.MaxIngestionLatencyMs, test.ShouldEqual, 0)
+		test.That(t, optionalConfigParams.ChangeDetection, test.ShouldBeFalse)
+		test.That(t, optionalConfigParams.MaxDutyCyclePercent, test.ShouldEqual, 0)
+		test.That(t, optionalConfigParams.MaxConsecutiveLidarFailures, test.ShouldEqual, 0)
+		test.That(t, optionalConfigParams.MaxRejectedReadingRetries, test.ShouldEqual, 0)
+		test.That(t, optionalConfigParams.HasMaxRejectedReadingRetries, test.ShouldBeFalse)
+		test.That(t, optionalConfigParams.MaxUnoptimizedNodeAgeSec, test.ShouldEqual, 0)
+		test.That(t, optionalConfigParams.MaxPostprocessingTasks, test.ShouldEqual, 0)
+		test.That(t, optionalConfigParams.MaxInitAttempts, test.ShouldEqual, 0)
+		test.That(t, optionalConfigParams.MaxSpeedMmPerSec, test.ShouldEqual, 0)
+		test.That(t, optionalConfigParams.MapStallLidarReadings, test.ShouldEqual, 0)
+		test.That(t, optionalConfigParams.LocalizationLostTimeoutSec, test.ShouldEqual, 0)
+		test.That(t, optionalConfigParams.LocalizationMinConfidencePercent, test.ShouldEqual, 0)
+		test.That(t, optionalConfigParams.PositionErrorOnLocalizationLost, test.ShouldBeFalse)
+		test.That(t, optionalConfigParams.RecentErrorsBufferSize, test.ShouldEqual, 0)
+		test.That(t, optionalConfigParams.AllowMixedClockDomains, test.ShouldBeFalse)
+		test.That(t, optionalConfigParams.SkipFinalOptimization, test.ShouldBeFalse)
+		test.That(t, optionalConfigParams.FinalOptimizationIterations, test.ShouldEqual, 0)
+		test.That(t, optionalConfigParams.OptimizeOnClose, test.ShouldBeFalse)
+		test.That(t, optionalConfigParams.MaxActiveTrajectories, test.ShouldEqual, 0)
+		test.That(t, optionalConfigParams.FreezeOldestOnLimit, test.ShouldBeFalse)
+		test.That(t, optionalConfigParams.MaxSensorSkewMs, test.ShouldEqual, 0)
+		test.That(t, optionalConfigParams.LidarBufferSize, test.ShouldEqual, 0)
+		test.That(t, optionalConfigParams.MovementSensorBufferSize, test.ShouldEqual, 0)
+		test.That(t, optionalConfigParams.OptimizeOnStartAsync, test.ShouldBeFalse)
+		test.That(t, optionalConfigParams.ConvertUnsupportedPCD, test.ShouldBeFalse)
+		test.That(t, optionalConfigParams.ExpectedTotal, test.ShouldEqual, 0)
+		test.That(t, optionalConfigParams.MaxJobDurationSec, test.ShouldEqual, 0)
+		test.That(t, optionalConfigParams.LidarExtrinsics, test.ShouldBeNil)
+		test.That(t, optionalConfigParams.IMUOrientation, test.ShouldBeNil)
+		test.That(t, optionalConfigParams.LidarTimeOffsetMs, test.ShouldEqual, 0)
+		test.That(t, optionalConfigParams.MovementSensorTimeOffsetMs, test.ShouldEqual, 0)
+		test.That(t, optionalConfigParams.RetryableInitErrors, test.ShouldBeEmpty)
+		test.That(t, optionalConfigParams.IMUAngularVelocityUnits, test.ShouldEqual, s.DegreesPerSecond)
+		test.That(t, optionalConfigParams.InternalStateExportDirs, test.ShouldBeEmpty)
+		test.That(t, optionalConfigParams.WarmStartDir, test.ShouldEqual, "")
+		test.That(t, optionalConfigParams.WarmStartRetention, test.ShouldEqual, 0)
+		test.That(t, optionalConfigParams.InternalStateSaveDir, test.ShouldEqual, "")
+		test.That(t, optionalConfigParams.InternalStateSaveIntervalSec, test.ShouldEqual, 0)
+		test.That(t, optionalConfigParams.InternalStateSaveRetention, test.ShouldEqual, 0)
+		test.That(t, optionalConfigParams.FloorPlan, test.ShouldBeNil)
+		test.That(t, optionalConfigParams.LidarPointFilter.IsZero(), test.ShouldBeTrue)
 	})
 
 	t.Run("Pass default parameters with no movement sensor name specified", func(t *testing.T) {
@@ -163,9 +719,47 @@ func TestGetOptionalParameters(t *testing.T) {
 		cfgService.Attributes["movement_sensor"] = map[string]string{
 			"name":              "testNameSensor",
 			"data_frequency_hz": "2",
+			"heading_only":      "true",
 		}
 
 		cfgService.Attributes["enable_mapping"] = true
+		cfgService.Attributes["fallback_to_previous_internal_state"] = true
+		cfgService.Attributes["rebase_timestamps"] = true
+		cfgService.Attributes["hang_threshold_sec"] = 60
+		cfgService.Attributes["restart_on_hang"] = true
+		cfgService.Attributes["min_points_per_scan"] = 50
+		cfgService.Attributes["run_final_optimization_on_cancel"] = true
+		cfgService.Attributes["max_ingestion_latency_ms"] = 250
+		cfgService.Attributes["imu_angular_velocity_units"] = "rad_per_sec"
+		cfgService.Attributes["max_duty_cycle_percent"] = 80
+		cfgService.Attributes["max_consecutive_lidar_failures"] = 3
+		cfgService.Attributes["max_rejected_reading_retries"] = 5
+		cfgService.Attributes["max_unoptimized_node_age_sec"] = 120
+		cfgService.Attributes["max_postprocessing_tasks"] = 50
+		cfgService.Attributes["max_init_attempts"] = 5
+		cfgService.Attributes["max_speed_mm_per_sec"] = 2000
+		cfgService.Attributes["map_stall_lidar_readings"] = 50
+		cfgService.Attributes["localization_lost_timeout_sec"] = 15
+		cfgService.Attributes["localization_min_confidence_percent"] = 60
+		cfgService.Attributes["position_error_on_localization_lost"] = true
+		cfgService.Attributes["recent_errors_buffer_size"] = 10
+		cfgService.Attributes["allow_mixed_clock_domains"] = true
+		cfgService.Attributes["skip_final_optimization"] = true
+		cfgService.Attributes["final_optimization_iterations"] = 20
+		cfgService.Attributes["optimize_on_close"] = true
+		cfgService.Attributes["max_active_trajectories"] = 2
+		cfgService.Attributes["freeze_oldest_on_limit"] = true
+		cfgService.Attributes["max_sensor_skew_ms"] = 100
+		cfgService.Attributes["lidar_buffer_size"] = 10
+		cfgService.Attributes["movement_sensor_buffer_size"] = 50
+		cfgService.Attributes["optimize_on_start_async"] = true
+		cfgService.Attributes["convert_unsupported_pcd"] = true
+		cfgService.Attributes["expected_total"] = 1500
+		cfgService.Attributes["max_job_duration_sec"] = 3600
+		cfgService.Attributes["lidar_extrinsics"] = map[string]interface{}{"x": 100, "y": -50, "o_z": 1, "theta": 90}
+		cfgService.Attributes["lidar_time_offset_ms"] = -20
+		cfgService.Attributes["retryable_init_errors"] = []string{"VIAM_CARTO_MAP_CREATION_ERROR"}
+		cfgService.Attributes["internal_state_export_dirs"] = []string{"/data/exports/", "/tmp"}
 
 		cfg, err := newConfig(cfgService)
 		test.That(t, err, test.ShouldBeNil)
@@ -177,8 +771,157 @@ func TestGetOptionalParameters(t *testing.T) {
 		test.That(t, err, test.ShouldBeNil)
 		test.That(t, optionalConfigParams.MovementSensorName, test.ShouldEqual, "testNameSensor")
 		test.That(t, optionalConfigParams.MovementSensorDataFrequencyHz, test.ShouldEqual, 2)
+		test.That(t, optionalConfigParams.MovementSensorHeadingOnly, test.ShouldBeTrue)
 		test.That(t, optionalConfigParams.LidarDataFrequencyHz, test.ShouldEqual, 2)
 		test.That(t, optionalConfigParams.EnableMapping, test.ShouldBeTrue)
+		test.That(t, optionalConfigParams.FallbackToPreviousInternalState, test.ShouldBeTrue)
+		test.That(t, optionalConfigParams.RebaseTimestamps, test.ShouldBeTrue)
+		test.That(t, optionalConfigParams.HangThresholdSec, test.ShouldEqual, 60)
+		test.That(t, optionalConfigParams.RestartOnHang, test.ShouldBeTrue)
+		test.That(t, optionalConfigParams.MinPointsPerScan, test.ShouldEqual, 50)
+		test.That(t, optionalConfigParams.RunFinalOptimizationOnCancel, test.ShouldBeTrue)
+		test.That(t, optionalConfigParams.MaxIngestionLatencyMs, test.ShouldEqual, 250)
+		test.That(t, optionalConfigParams.IMUAngularVelocityUnits, test.ShouldEqual, s.RadiansPerSecond)
+		test.That(t, optionalConfigParams.MaxDutyCyclePercent, test.ShouldEqual, 80)
+		test.That(t, optionalConfigParams.MaxConsecutiveLidarFailures, test.ShouldEqual, 3)
+		test.That(t, optionalConfigParams.MaxRejectedReadingRetries, test.ShouldEqual, 5)
+		test.That(t, optionalConfigParams.HasMaxRejectedReadingRetries, test.ShouldBeTrue)
+		test.That(t, optionalConfigParams.MaxUnoptimizedNodeAgeSec, test.ShouldEqual, 120)
+		test.That(t, optionalConfigParams.MaxPostprocessingTasks, test.ShouldEqual, 50)
+		test.That(t, optionalConfigParams.MaxInitAttempts, test.ShouldEqual, 5)
+		test.That(t, optionalConfigParams.MaxSpeedMmPerSec, test.ShouldEqual, 2000)
+		test.That(t, optionalConfigParams.MapStallLidarReadings, test.ShouldEqual, 50)
+		test.That(t, optionalConfigParams.LocalizationLostTimeoutSec, test.ShouldEqual, 15)
+		test.That(t, optionalConfigParams.LocalizationMinConfidencePercent, test.ShouldEqual, 60)
+		test.That(t, optionalConfigParams.PositionErrorOnLocalizationLost, test.ShouldBeTrue)
+		test.That(t, optionalConfigParams.RecentErrorsBufferSize, test.ShouldEqual, 10)
+		test.That(t, optionalConfigParams.AllowMixedClockDomains, test.ShouldBeTrue)
+		test.That(t, optionalConfigParams.SkipFinalOptimization, test.ShouldBeTrue)
+		test.That(t, optionalConfigParams.FinalOptimizationIterations, test.ShouldEqual, 20)
+		test.That(t, optionalConfigParams.OptimizeOnClose, test.ShouldBeTrue)
+		test.That(t, optionalConfigParams.MaxActiveTrajectories, test.ShouldEqual, 2)
+		test.That(t, optionalConfigParams.FreezeOldestOnLimit, test.ShouldBeTrue)
+		test.That(t, optionalConfigParams.MaxSensorSkewMs, test.ShouldEqual, 100)
+		test.That(t, optionalConfigParams.LidarBufferSize, test.ShouldEqual, 10)
+		test.That(t, optionalConfigParams.MovementSensorBufferSize, test.ShouldEqual, 50)
+		test.That(t, optionalConfigParams.OptimizeOnStartAsync, test.ShouldBeTrue)
+		test.That(t, optionalConfigParams.ConvertUnsupportedPCD, test.ShouldBeTrue)
+		test.That(t, optionalConfigParams.ExpectedTotal, test.ShouldEqual, 1500)
+		test.That(t, optionalConfigParams.MaxJobDurationSec, test.ShouldEqual, 3600)
+		test.That(t, optionalConfigParams.LidarExtrinsics, test.ShouldResemble, &Extrinsics{X: 100, Y: -50, OZ: 1, Theta: 90})
+		test.That(t, optionalConfigParams.LidarTimeOffsetMs, test.ShouldEqual, -20)
+		test.That(t, optionalConfigParams.RetryableInitErrors, test.ShouldResemble, []string{"VIAM_CARTO_MAP_CREATION_ERROR"})
+		test.That(t, optionalConfigParams.InternalStateExportDirs, test.ShouldResemble, []string{"/data/exports", "/tmp"})
+	})
+
+	t.Run("Pass floor plan", func(t *testing.T) {
+		cfgService := makeCfgService()
+		cfgService.Attributes["floor_plan"] = map[string]interface{}{
+			"image":         "/data/map.pgm",
+			"resolution_mm": 50,
+			"origin":        map[string]float64{"x": -1000, "y": 2000},
+		}
+		cfg, err := newConfig(cfgService)
+		test.That(t, err, test.ShouldBeNil)
+		optionalConfigParams, err := GetOptionalParameters(cfg, 1000, 1000, logger)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, optionalConfigParams.FloorPlan, test.ShouldResemble, &FloorPlan{
+			Image:        "/data/map.pgm",
+			ResolutionMm: 50,
+			Origin:       &r2.Point{X: -1000, Y: 2000},
+		})
+		test.That(t, optionalConfigParams.ExistingMap, test.ShouldEqual, "")
+		test.That(t, optionalConfigParams.EnableMapping, test.ShouldBeFalse)
+	})
+
+	t.Run("Pass warm start dir", func(t *testing.T) {
+		cfgService := makeCfgService()
+		cfgService.Attributes["warm_start_dir"] = "/data/maps/"
+		cfgService.Attributes["warm_start_retention"] = 3
+		cfg, err := newConfig(cfgService)
+		test.That(t, err, test.ShouldBeNil)
+		optionalConfigParams, err := GetOptionalParameters(cfg, 1000, 1000, logger)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, optionalConfigParams.WarmStartDir, test.ShouldEqual, "/data/maps")
+		test.That(t, optionalConfigParams.WarmStartRetention, test.ShouldEqual, 3)
+		test.That(t, optionalConfigParams.ExistingMap, test.ShouldEqual, "")
+		test.That(t, optionalConfigParams.EnableMapping, test.ShouldBeTrue)
+	})
+
+	t.Run("Pass internal state save dir", func(t *testing.T) {
+		cfgService := makeCfgService()
+		cfgService.Attributes["internal_state_save_dir"] = "/data/autosave/"
+		cfgService.Attributes["internal_state_save_interval_sec"] = 300
+		cfgService.Attributes["internal_state_save_retention"] = 4
+		cfg, err := newConfig(cfgService)
+		test.That(t, err, test.ShouldBeNil)
+		optionalConfigParams, err := GetOptionalParameters(cfg, 1000, 1000, logger)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, optionalConfigParams.InternalStateSaveDir, test.ShouldEqual, "/data/autosave")
+		test.That(t, optionalConfigParams.InternalStateSaveIntervalSec, test.ShouldEqual, 300)
+		test.That(t, optionalConfigParams.InternalStateSaveRetention, test.ShouldEqual, 4)
+	})
+
+	t.Run("Pass record dataset dir", func(t *testing.T) {
+		cfgService := makeCfgService()
+		cfgService.Attributes["record_dataset_dir"] = "/data/recordings/"
+		cfg, err := newConfig(cfgService)
+		test.That(t, err, test.ShouldBeNil)
+		optionalConfigParams, err := GetOptionalParameters(cfg, 1000, 1000, logger)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, optionalConfigParams.RecordDatasetDir, test.ShouldEqual, "/data/recordings")
+		test.That(t, optionalConfigParams.RecordDatasetCompressionLevel, test.ShouldEqual, s.NoDatasetCompression)
+
+		cfgService.Attributes["record_dataset_compression_level"] = 6
+		cfg, err = newConfig(cfgService)
+		test.That(t, err, test.ShouldBeNil)
+		optionalConfigParams, err = GetOptionalParameters(cfg, 1000, 1000, logger)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, optionalConfigParams.RecordDatasetCompressionLevel, test.ShouldEqual, 6)
+	})
+
+	t.Run("Pass additional cameras", func(t *testing.T) {
+		cfgService := makeCfgService()
+		cfgService.Attributes["additional_cameras"] = []map[string]interface{}{
+			{"name": "b", "data_frequency_hz": 10, "extrinsics": map[string]float64{"y": 50, "o_z": 1}},
+			{"name": "c"},
+		}
+		cfg, err := newConfig(cfgService)
+		test.That(t, err, test.ShouldBeNil)
+		optionalConfigParams, err := GetOptionalParameters(cfg, 5, 20, logger)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, optionalConfigParams.AdditionalLidars, test.ShouldResemble, []AdditionalLidar{
+			{Name: "b", DataFrequencyHz: 10, Extrinsics: &Extrinsics{Y: 50, OZ: 1}},
+			{Name: "c", DataFrequencyHz: 5},
+		})
+
+		// additional cameras are offline along with camera
+		cfgService.Attributes["camera"] = map[string]string{"name": "a", "data_frequency_hz": "0"}
+		cfgService.Attributes["additional_cameras"] = []map[string]interface{}{{"name": "b"}}
+		cfgService.Attributes["enable_mapping"] = true
+		cfg, err = newConfig(cfgService)
+		test.That(t, err, test.ShouldBeNil)
+		optionalConfigParams, err = GetOptionalParameters(cfg, 5, 20, logger)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, optionalConfigParams.AdditionalLidars, test.ShouldResemble, []AdditionalLidar{{Name: "b"}})
+	})
+
+	t.Run("Pass camera point filters", func(t *testing.T) {
+		cfgService := makeCfgService()
+		cfgService.Attributes["camera"] = map[string]string{
+			"name": "a", "min_range_mm": "250", "max_range_mm": "12000", "angle_min_deg": "-135", "angle_max_deg": "135.5",
+		}
+		cfg, err := newConfig(cfgService)
+		test.That(t, err, test.ShouldBeNil)
+		optionalConfigParams, err := GetOptionalParameters(cfg, 5, 20, logger)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, optionalConfigParams.LidarPointFilter, test.ShouldResemble, s.LidarPointFilter{
+			MinRangeMm:       250,
+			MaxRangeMm:       12000,
+			HasAngularWindow: true,
+			AngleMinDeg:      -135,
+			AngleMaxDeg:      135.5,
+		})
 	})
 
 	t.Run("Pass invalid existing map", func(t *testing.T) {
@@ -215,6 +958,47 @@ func TestGetOptionalParameters(t *testing.T) {
 		test.That(t, optionalConfigParams, test.ShouldResemble, OptionalConfigParams{})
 	})
 
+	t.Run("Return change detection in localization mode", func(t *testing.T) {
+		cfgService := makeCfgService()
+		cfgService.Attributes["existing_map"] = "test-file.pbstream"
+		cfgService.Attributes["enable_mapping"] = false
+		cfgService.Attributes["change_detection"] = true
+
+		cfg, err := newConfig(cfgService)
+		test.That(t, err, test.ShouldBeNil)
+		optionalConfigParams, err := GetOptionalParameters(
+			cfg,
+			1000,
+			1000,
+			logger)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, optionalConfigParams.ChangeDetection, test.ShouldBeTrue)
+	})
+
+	t.Run("config that enables change detection outside of localization mode", func(t *testing.T) {
+		for _, attributes := range []map[string]interface{}{
+			{"enable_mapping": true, "existing_map": "test-file.pbstream"},
+			{"enable_mapping": true},
+			{"enable_mapping": false},
+		} {
+			cfgService := makeCfgService()
+			for key, value := range attributes {
+				cfgService.Attributes[key] = value
+			}
+			cfgService.Attributes["change_detection"] = true
+
+			cfg, err := newConfig(cfgService)
+			test.That(t, err, test.ShouldBeNil)
+			optionalConfigParams, err := GetOptionalParameters(
+				cfg,
+				1000,
+				1000,
+				logger)
+			test.That(t, err, test.ShouldBeError, errChangeDetectionWithoutLocalization)
+			test.That(t, optionalConfigParams, test.ShouldResemble, OptionalConfigParams{})
+		}
+	})
+
 	sensorAttributeTestHelper(t, logger)
 }
 
@@ -257,6 +1041,73 @@ func sensorAttributeTestHelper(
 			logger)
 		test.That(t, err, test.ShouldBeError, newError("movement_sensor[data_frequency_hz] must only contain digits"))
 	})
+
+	t.Run("Unit test return error if movement sensor heading only is invalid", func(t *testing.T) {
+		cfgService := makeCfgService()
+		cfgService.Attributes["movement_sensor"] = map[string]string{
+			"name":         "b",
+			"heading_only": "yes please",
+		}
+		cfg, err := newConfigWithoutValidate(cfgService)
+		test.That(t, err, test.ShouldBeNil)
+		_, err = GetOptionalParameters(
+			cfg,
+			1000,
+			1000,
+			logger)
+		test.That(t, err, test.ShouldBeError, newError("movement_sensor[heading_only] must be true or false"))
+	})
+
+	t.Run("Unit test return error if movement sensor velocity odometry is invalid", func(t *testing.T) {
+		cfgService := makeCfgService()
+		cfgService.Attributes["movement_sensor"] = map[string]string{
+			"name":              "b",
+			"velocity_odometry": "yes please",
+		}
+		cfg, err := newConfigWithoutValidate(cfgService)
+		test.That(t, err, test.ShouldBeNil)
+		_, err = GetOptionalParameters(
+			cfg,
+			1000,
+			1000,
+			logger)
+		test.That(t, err, test.ShouldBeError, newError("movement_sensor[velocity_odometry] must be true or false"))
+	})
+
+	t.Run("Unit test return error if movement sensor heading only and velocity odometry are both set", func(t *testing.T) {
+		cfgService := makeCfgService()
+		cfgService.Attributes["movement_sensor"] = map[string]string{
+			"name":              "b",
+			"heading_only":      "true",
+			"velocity_odometry": "true",
+		}
+		cfg, err := newConfigWithoutValidate(cfgService)
+		test.That(t, err, test.ShouldBeNil)
+		_, err = GetOptionalParameters(
+			cfg,
+			1000,
+			1000,
+			logger)
+		test.That(t, err, test.ShouldBeError, newError(
+			"movement_sensor[heading_only] and movement_sensor[velocity_odometry] cannot both be set"))
+	})
+}
+
+func TestValidatePoseSensorConfig(t *testing.T) {
+	testCfgPath := "components.movement_sensor.attributes.fake"
+
+	t.Run("Config without slam_service", func(t *testing.T) {
+		cfg := &PoseSensorConfig{}
+		_, err := cfg.Validate(testCfgPath)
+		test.That(t, err, test.ShouldBeError, utils.NewConfigValidationError(testCfgPath, errSLAMServiceRequired))
+	})
+
+	t.Run("Config with slam_service depends on the slam service", func(t *testing.T) {
+		cfg := &PoseSensorConfig{SLAMService: "slam"}
+		deps, err := cfg.Validate(testCfgPath)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, deps, test.ShouldResemble, []string{"slam"})
+	})
 }
 
 func newConfig(conf resource.Config) (*Config, error) {
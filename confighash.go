@@ -0,0 +1,124 @@
+package viamcartographer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+
+	"github.com/viam-modules/viam-cartographer/cartofacade"
+	vcConfig "github.com/viam-modules/viam-cartographer/config"
+	s "github.com/viam-modules/viam-cartographer/sensors"
+)
+
+const (
+	// ConfigHashKey is the key of the hash identifying the tuning of the run.
+	ConfigHashKey = "config_hash"
+)
+
+// configHashInput holds everything that the config hash is computed from: the resolved algo config and the
+// fields of the service config that affect the map that is built. Fields that only affect how the service is
+// run, such as timeouts, warning thresholds, sensor names or export directories, are left out so that runs with
+// identical tuning have identical hashes. Fields may only be added, as adding one changes every hash.
+type configHashInput struct {
+	AlgoConfig                    cartofacade.CartoAlgoConfig `json:"algo_config"`
+	LidarDataFrequencyHz          int                         `json:"lidar_data_frequency_hz"`
+	MovementSensorDataFrequencyHz int                         `json:"movement_sensor_data_frequency_hz"`
+	MovementSensorHeadingOnly     bool                        `json:"movement_sensor_heading_only"`
+	EnableMapping                 bool                        `json:"enable_mapping"`
+	ExistingMap                   string                      `json:"existing_map"`
+	RebaseTimestamps              bool                        `json:"rebase_timestamps"`
+	MinPointsPerScan              int                         `json:"min_points_per_scan"`
+	IMUAngularVelocityUnits       string                      `json:"imu_angular_velocity_units"`
+	MappingBounds                 *vcConfig.MappingBounds     `json:"mapping_bounds"`
+	FloorPlan                     *vcConfig.FloorPlan         `json:"floor_plan,omitempty"`
+	SkipFinalOptimization         bool                        `json:"skip_final_optimization,omitempty"`
+	LidarPointFilter              *s.LidarPointFilter         `json:"lidar_point_filter,omitempty"`
+	// AdditionalLidarDataFrequenciesHz holds the data frequency of each additional lidar.
+	AdditionalLidarDataFrequenciesHz []int `json:"additional_lidar_data_frequencies_hz,omitempty"`
+	MovementSensorVelocityOdometry   bool  `json:"movement_sensor_velocity_odometry,omitempty"`
+	// The calibration of the sensors, including that loaded from calibration_file, as it determines where the
+	// readings end up in the map. The checksum of calibration_file additionally identifies the file that was used.
+	LidarExtrinsics            *vcConfig.Extrinsics   `json:"lidar_extrinsics,omitempty"`
+	AdditionalLidarExtrinsics  []*vcConfig.Extrinsics `json:"additional_lidar_extrinsics,omitempty"`
+	IMUOrientation             *vcConfig.Orientation  `json:"imu_orientation,omitempty"`
+	LidarTimeOffsetMs          int                    `json:"lidar_time_offset_ms,omitempty"`
+	MovementSensorTimeOffsetMs int                    `json:"movement_sensor_time_offset_ms,omitempty"`
+	CalibrationFileChecksum    string                 `json:"calibration_file_sha256,omitempty"`
+	// FinalOptimizationIterations is also part of the algo config once it has been resolved, but is set here as
+	// well so that the hash does not depend on when the algo config is resolved.
+	FinalOptimizationIterations int `json:"final_optimization_iterations,omitempty"`
+}
+
+// newConfigHashInput returns the fields of the service config that the config hash is computed from, given the
+// checksum of the calibration_file, if any. The algo config is set once it has been resolved.
+func newConfigHashInput(
+	svcConfig *vcConfig.Config,
+	optionalConfigParams vcConfig.OptionalConfigParams,
+	calibrationFileChecksum string,
+) configHashInput {
+	return configHashInput{
+		LidarDataFrequencyHz:             optionalConfigParams.LidarDataFrequencyHz,
+		MovementSensorDataFrequencyHz:    optionalConfigParams.MovementSensorDataFrequencyHz,
+		MovementSensorHeadingOnly:        optionalConfigParams.MovementSensorHeadingOnly,
+		EnableMapping:                    optionalConfigParams.EnableMapping,
+		ExistingMap:                      optionalConfigParams.ExistingMap,
+		RebaseTimestamps:                 optionalConfigParams.RebaseTimestamps,
+		MinPointsPerScan:                 optionalConfigParams.MinPointsPerScan,
+		IMUAngularVelocityUnits:          string(optionalConfigParams.IMUAngularVelocityUnits),
+		MappingBounds:                    svcConfig.MappingBounds,
+		FloorPlan:                        optionalConfigParams.FloorPlan,
+		SkipFinalOptimization:            optionalConfigParams.SkipFinalOptimization,
+		AdditionalLidarDataFrequenciesHz: additionalLidarDataFrequenciesHz(optionalConfigParams.AdditionalLidars),
+		LidarPointFilter:                 lidarPointFilter(optionalConfigParams.LidarPointFilter),
+		MovementSensorVelocityOdometry:   optionalConfigParams.MovementSensorVelocityOdometry,
+		LidarExtrinsics:                  optionalConfigParams.LidarExtrinsics,
+		AdditionalLidarExtrinsics:        additionalLidarExtrinsics(optionalConfigParams.AdditionalLidars),
+		IMUOrientation:                   optionalConfigParams.IMUOrientation,
+		LidarTimeOffsetMs:                optionalConfigParams.LidarTimeOffsetMs,
+		MovementSensorTimeOffsetMs:       optionalConfigParams.MovementSensorTimeOffsetMs,
+		CalibrationFileChecksum:          calibrationFileChecksum,
+		FinalOptimizationIterations:      optionalConfigParams.FinalOptimizationIterations,
+	}
+}
+
+// lidarPointFilter returns the filter, or nil if it keeps all points so that it does not change the hash.
+func lidarPointFilter(filter s.LidarPointFilter) *s.LidarPointFilter {
+	if filter.IsZero() {
+		return nil
+	}
+	return &filter
+}
+
+func additionalLidarDataFrequenciesHz(additionalLidars []vcConfig.AdditionalLidar) []int {
+	var dataFrequenciesHz []int
+	for _, additionalLidar := range additionalLidars {
+		dataFrequenciesHz = append(dataFrequenciesHz, additionalLidar.DataFrequencyHz)
+	}
+	return dataFrequenciesHz
+}
+
+// additionalLidarExtrinsics returns the extrinsics of each additional lidar, or nil if none of them has any so
+// that they do not change the hash.
+func additionalLidarExtrinsics(additionalLidars []vcConfig.AdditionalLidar) []*vcConfig.Extrinsics {
+	var extrinsics []*vcConfig.Extrinsics
+	anySet := false
+	for _, additionalLidar := range additionalLidars {
+		extrinsics = append(extrinsics, additionalLidar.Extrinsics)
+		anySet = anySet || additionalLidar.Extrinsics != nil
+	}
+	if !anySet {
+		return nil
+	}
+	return extrinsics
+}
+
+// hash returns the SHA-256 checksum of the input, hex encoded.
+func (input configHashInput) hash() (string, error) {
+	// structs are marshaled in the order of their fields, so the hash does not depend on the order of the config
+	marshaled, err := json.Marshal(input)
+	if err != nil {
+		return "", err
+	}
+	checksum := sha256.Sum256(marshaled)
+	return hex.EncodeToString(checksum[:]), nil
+}
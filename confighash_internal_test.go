@@ -0,0 +1,142 @@
+package viamcartographer
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"go.viam.com/rdk/logging"
+	"go.viam.com/test"
+
+	"github.com/viam-modules/viam-cartographer/cartofacade"
+	vcConfig "github.com/viam-modules/viam-cartographer/config"
+	"github.com/viam-modules/viam-cartographer/sensorprocess"
+)
+
+func TestConfigHash(t *testing.T) {
+	logger := logging.NewTestLogger(t)
+	configHashWithCalibrationFile := func(t *testing.T, attributes, calibrationFileChecksum string) string {
+		t.Helper()
+		var svcConfig vcConfig.Config
+		test.That(t, json.Unmarshal([]byte(attributes), &svcConfig), test.ShouldBeNil)
+		optionalConfigParams, err := vcConfig.GetOptionalParameters(&svcConfig, defaultLidarDataFrequencyHz,
+			defaultMovementSensorDataFrequencyHz, logger)
+		test.That(t, err, test.ShouldBeNil)
+		input := newConfigHashInput(&svcConfig, optionalConfigParams, calibrationFileChecksum)
+		input.AlgoConfig, _, err = parseCartoAlgoConfig(svcConfig.ConfigParams, logger)
+		test.That(t, err, test.ShouldBeNil)
+		hash, err := input.hash()
+		test.That(t, err, test.ShouldBeNil)
+		return hash
+	}
+	configHash := func(t *testing.T, attributes string) string {
+		t.Helper()
+		return configHashWithCalibrationFile(t, attributes, "")
+	}
+	hash := configHash(t, `{
+		"camera": {"name": "my-lidar", "data_frequency_hz": "5"},
+		"config_params": {"mode": "2d", "optimize_every_n_nodes": "3", "min_range": "0.3"},
+		"enable_mapping": true,
+		"mapping_bounds": {"min_x": -1000, "min_y": -1000, "max_x": 1000, "max_y": 1000}
+	}`)
+
+	t.Run("the config hash does not depend on the order of the fields", func(t *testing.T) {
+		test.That(t, configHash(t, `{
+			"mapping_bounds": {"max_y": 1000, "max_x": 1000, "min_y": -1000, "min_x": -1000},
+			"enable_mapping": true,
+			"config_params": {"min_range": "0.3", "optimize_every_n_nodes": "3", "mode": "2d"},
+			"camera": {"data_frequency_hz": "5", "name": "my-lidar"}
+		}`), test.ShouldEqual, hash)
+	})
+
+	t.Run("the config hash does not depend on the sensor names, timeouts or thresholds", func(t *testing.T) {
+		test.That(t, configHash(t, `{
+			"camera": {"name": "other-lidar", "data_frequency_hz": "5"},
+			"config_params": {"mode": "2d", "optimize_every_n_nodes": "3", "min_range": "0.3"},
+			"enable_mapping": true,
+			"mapping_bounds": {"min_x": -1000, "min_y": -1000, "max_x": 1000, "max_y": 1000},
+			"hang_threshold_sec": 10,
+			"max_ingestion_latency_ms": 100,
+			"internal_state_export_dirs": ["/tmp"]
+		}`), test.ShouldEqual, hash)
+	})
+
+	t.Run("the config hash changes with a parameter", func(t *testing.T) {
+		test.That(t, configHash(t, `{
+			"camera": {"name": "my-lidar", "data_frequency_hz": "5"},
+			"config_params": {"mode": "2d", "optimize_every_n_nodes": "4", "min_range": "0.3"},
+			"enable_mapping": true,
+			"mapping_bounds": {"min_x": -1000, "min_y": -1000, "max_x": 1000, "max_y": 1000}
+		}`), test.ShouldNotEqual, hash)
+		test.That(t, configHash(t, `{
+			"camera": {"name": "my-lidar", "data_frequency_hz": "5"},
+			"config_params": {"mode": "2d", "optimize_every_n_nodes": "3", "min_range": "0.3"},
+			"enable_mapping": true,
+			"mapping_bounds": {"min_x": -1000, "min_y": -1000, "max_x": 1000, "max_y": 2000}
+		}`), test.ShouldNotEqual, hash)
+		test.That(t, configHash(t, `{
+			"camera": {"name": "my-lidar", "data_frequency_hz": "10"},
+			"config_params": {"mode": "2d", "optimize_every_n_nodes": "3", "min_range": "0.3"},
+			"enable_mapping": true,
+			"mapping_bounds": {"min_x": -1000, "min_y": -1000, "max_x": 1000, "max_y": 1000}
+		}`), test.ShouldNotEqual, hash)
+		test.That(t, configHash(t, `{
+			"camera": {"name": "my-lidar", "data_frequency_hz": "5", "max_range_mm": "8000"},
+			"config_params": {"mode": "2d", "optimize_every_n_nodes": "3", "min_range": "0.3"},
+			"enable_mapping": true,
+			"mapping_bounds": {"min_x": -1000, "min_y": -1000, "max_x": 1000, "max_y": 1000}
+		}`), test.ShouldNotEqual, hash)
+	})
+
+	t.Run("the config hash changes with the calibration and the final optimization iterations", func(t *testing.T) {
+		for _, attribute := range []string{
+			`"lidar_extrinsics": {"x": 100, "y": 0, "z": 0, "o_x": 0, "o_y": 0, "o_z": 1, "theta": 0}`,
+			`"imu_orientation": {"o_x": 0, "o_y": 0, "o_z": 1, "theta": 90}`,
+			`"lidar_time_offset_ms": 20`,
+			`"movement_sensor_time_offset_ms": -20`,
+			`"final_optimization_iterations": 10`,
+		} {
+			test.That(t, configHash(t, `{
+				"camera": {"name": "my-lidar", "data_frequency_hz": "5"},
+				"config_params": {"mode": "2d", "optimize_every_n_nodes": "3", "min_range": "0.3"},
+				"enable_mapping": true,
+				"mapping_bounds": {"min_x": -1000, "min_y": -1000, "max_x": 1000, "max_y": 1000},
+				`+attribute+`
+			}`), test.ShouldNotEqual, hash)
+		}
+
+		attributes := `{
+			"camera": {"name": "my-lidar", "data_frequency_hz": "5"},
+			"config_params": {"mode": "2d", "optimize_every_n_nodes": "3", "min_range": "0.3"},
+			"enable_mapping": true,
+			"mapping_bounds": {"min_x": -1000, "min_y": -1000, "max_x": 1000, "max_y": 1000}
+		}`
+		calibrationFileHash := configHashWithCalibrationFile(t, attributes, "checksum")
+		test.That(t, calibrationFileHash, test.ShouldNotEqual, hash)
+		test.That(t, configHashWithCalibrationFile(t, attributes, "other checksum"), test.ShouldNotEqual, calibrationFileHash)
+	})
+
+	t.Run("job_done and version report the config hash", func(t *testing.T) {
+		svc := newTestService(&cartofacade.Mock{}, logger)
+		svc.jobSummary = &sensorprocess.JobSummary{}
+		svc.configHash = hash
+		resp, err := svc.DoCommand(context.Background(), map[string]interface{}{JobDoneCommand: ""})
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, resp[ConfigHashKey], test.ShouldEqual, hash)
+
+		resp, err = svc.DoCommand(context.Background(), map[string]interface{}{VersionCommand: ""})
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, resp, test.ShouldResemble, map[string]interface{}{
+			ModuleVersionKey: ModuleVersion,
+			ConfigHashKey:    hash,
+		})
+
+		// the optional features the cartographer library provides are listed once it is set
+		svc.cartoLib = &cartofacade.CartoLibMock{CapabilitiesFunc: func() cartofacade.Capabilities {
+			return cartofacade.NewCapabilities(cartofacade.FeatureSubmaps, cartofacade.FeatureMemoryUsage)
+		}}
+		resp, err = svc.DoCommand(context.Background(), map[string]interface{}{VersionCommand: ""})
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, resp[CapabilitiesKey], test.ShouldResemble, []string{"memory_usage", "submaps"})
+	})
+}
@@ -0,0 +1,1503 @@
+package viamcartographer
+
+import (
+	"context"
+	"encoding/base64"
+	"maps"
+	"math"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.opencensus.io/trace"
+	viamgrpc "go.viam.com/rdk/grpc"
+
+	"github.com/viam-modules/viam-cartographer/cartofacade"
+	vcConfig "github.com/viam-modules/viam-cartographer/config"
+	"github.com/viam-modules/viam-cartographer/mapexport"
+	"github.com/viam-modules/viam-cartographer/postprocess"
+	"github.com/viam-modules/viam-cartographer/sensorprocess"
+	s "github.com/viam-modules/viam-cartographer/sensors"
+)
+
+const (
+	// JobProgressCommand is sent to DoCommand to get how far along the offline sensor process is.
+	JobProgressCommand = "job_progress"
+	// SessionStartTimeKey is the key of the wall clock time the session epoch corresponds to.
+	SessionStartTimeKey = "session_start_time"
+	// GetSessionStartTimeCommand is sent to DoCommand to get the session start time.
+	GetSessionStartTimeCommand = "get_session_start_time"
+	// StatusCommand is sent to DoCommand to get the status of the service.
+	StatusCommand = "status"
+	// UnresponsiveKey denotes whether a call into cartographer has been in progress for longer than hang_threshold_sec.
+	UnresponsiveKey = "unresponsive"
+	// CartoFacadeKey is the key of the state of cartographer in the status response.
+	CartoFacadeKey = "cartofacade"
+	// UnitsKey is the key of the linear units of positions and of the pointcloud map.
+	UnitsKey = "units"
+	// PositionUnitKey is the key of the linear unit of positions in the units declaration.
+	PositionUnitKey = "position"
+	// PointCloudMapUnitKey is the key of the linear unit of the pointcloud map in the units declaration.
+	PointCloudMapUnitKey = "pointcloud_map"
+	// SlamModeKey is the key of the slam mode of cartographer in the status response.
+	SlamModeKey = "slam_mode"
+	// TrajectoriesKey is the key of the id and state of every trajectory of the pose graph.
+	TrajectoriesKey = "trajectories"
+	// DroppedScansKey is the key of the number of lidar readings dropped for having too few points.
+	DroppedScansKey = "dropped_scans"
+	// IgnoredFieldsKey is the key of the fields of the config that are ignored because use_cloud_slam is set.
+	IgnoredFieldsKey = "ignored_fields"
+	// CalibrationFileKey is the key of the path and the checksum of the loaded calibration_file.
+	CalibrationFileKey = "calibration_file"
+	// SensorResourcesKey is the key of the health of the resources the sensors read from.
+	SensorResourcesKey = "sensor_resources"
+	// EditedMapInconsistentKey denotes whether the edited map diverges from the loaded existing map.
+	EditedMapInconsistentKey = "edited_map_inconsistent"
+	// MapOverlapKey is the key of the overlap of the lidar readings with the existing map being updated.
+	MapOverlapKey = "map_overlap"
+	// LidarRejectionDiagnosisKey is the key of the diagnosis of the last lidar reading cartographer rejected.
+	LidarRejectionDiagnosisKey = "lidar_rejection_diagnosis"
+	// LogLevelKey is the key of the level cartographer is logging at.
+	LogLevelKey = "log_level"
+	// MemoryKey is the key of the memory usage of the process in the status and sensor_metrics responses.
+	MemoryKey = "memory"
+	// SetLogLevelCommand is sent to DoCommand to change the level cartographer is logging at.
+	SetLogLevelCommand = "set_log_level"
+	// LogLevelInfo logs cartographer's info, warning and error logs.
+	LogLevelInfo = "info"
+	// LogLevelWarn logs cartographer's warning and error logs.
+	LogLevelWarn = "warn"
+	// LogLevelDebug logs cartographer's info, warning and error logs as well as its verbose logs.
+	LogLevelDebug = "debug"
+	// StartNewTrajectoryCommand is sent to DoCommand to finish the current trajectory and start a new one.
+	StartNewTrajectoryCommand = "start_new_trajectory"
+	// FinishedTrajectoryIDKey is the key of the id of the finished trajectory.
+	FinishedTrajectoryIDKey = "finished_trajectory_id"
+	// TrajectoryIDKey is the key of the id of the new trajectory.
+	TrajectoryIDKey = "trajectory_id"
+	// GetAlgoConfigCommand is sent to DoCommand to get the requested and applied algo config.
+	GetAlgoConfigCommand = "get_algo_config"
+	// SetMappingBoundsCommand is sent to DoCommand to change the mapping bounds.
+	SetMappingBoundsCommand = "set_mapping_bounds"
+	// RequestedAlgoConfigKey is the key of the algo config built from config_params.
+	RequestedAlgoConfigKey = "requested"
+	// AppliedAlgoConfigKey is the key of the algo config cartographer is operating with.
+	AppliedAlgoConfigKey = "applied"
+	// SensorMetricsCommand is sent to DoCommand to get the ingestion metrics of every sensor.
+	SensorMetricsCommand = "sensor_metrics"
+	// SensorStatsCommand is sent to DoCommand to get the reading counts and errors of every sensor.
+	SensorStatsCommand = "sensor_stats"
+	// SlamStatsCommand is sent to DoCommand to get the node and optimization stats of the pose graph.
+	SlamStatsCommand = "slam_stats"
+	// CapabilitiesKey is the key of the optional features the cartographer library provides.
+	CapabilitiesKey = "capabilities"
+	// ModuleVersionKey is the key of the version of the module.
+	ModuleVersionKey = "module_version"
+	// VersionCommand is sent to DoCommand to get the version of the module and the config hash.
+	VersionCommand = "version"
+	// ChangeHeatmapCommand is sent to DoCommand to get the heatmap of where lidar readings disagreed with the map.
+	ChangeHeatmapCommand = "change_heatmap"
+	// ChangeHeatmapFormatPCD returns the change heatmap as a pointcloud.
+	ChangeHeatmapFormatPCD = "pcd"
+	// ChangeHeatmapFormatPNG returns the change heatmap as a grayscale image.
+	ChangeHeatmapFormatPNG = "png"
+	// FacadeWorkerKey is the key of the duty cycle of the goroutine that calls into cartographer.
+	FacadeWorkerKey = "facade_worker"
+	// WriteInternalStateToPathCommand is sent to DoCommand to write the internal state to a file.
+	WriteInternalStateToPathCommand = "write_internal_state_to_path"
+	// ShadowPositionCommand is sent to DoCommand to compare the positions of the primary and the shadow instance.
+	ShadowPositionCommand = "shadow_position"
+	// ShadowMapInfoCommand is sent to DoCommand to compare the maps of the primary and the shadow instance.
+	ShadowMapInfoCommand = "shadow_map_info"
+	// PrimaryKey is the key of the primary instance's outputs in the shadow command responses.
+	PrimaryKey = "primary"
+	// ShadowKey is the key of the shadow instance's outputs in the shadow command responses.
+	ShadowKey = "shadow"
+	// GetMapGeoJSONCommand is sent to DoCommand to get the outline of the mapped area as GeoJSON.
+	GetMapGeoJSONCommand = "get_map_geojson"
+	// SetSessionPostprocessingCommand is sent to DoCommand to override postprocessing for the session.
+	SetSessionPostprocessingCommand = "set_session_postprocessing"
+	// SetModeCommand is sent to DoCommand to switch between localizing and mapping.
+	SetModeCommand = "set_mode"
+	// ModeLocalize is the value of set_mode to only localize against the map.
+	ModeLocalize = "localize"
+	// ModeMap is the value of set_mode to add to the map.
+	ModeMap = "map"
+	// RelocalizeCommand is sent to DoCommand to restart the localization, optionally at a pose hint.
+	RelocalizeCommand = "relocalize"
+	// RestartedTrajectoryIDKey is the key of the id of the replaced localization trajectory.
+	RestartedTrajectoryIDKey = "restarted_trajectory_id"
+	// LoadInternalStateCommand is sent to DoCommand to localize against another internal state.
+	LoadInternalStateCommand = "load_internal_state"
+	// ListCommandsCommand is sent to DoCommand to list the supported commands.
+	ListCommandsCommand = "list_commands"
+	// SchemaVersionKey is the key of the schema version in the list_commands response.
+	SchemaVersionKey = "schema_version"
+	// CommandsKey is the key of the supported commands in the list_commands response.
+	CommandsKey = "commands"
+	// UnknownCommandsKey is the key of the unknown commands of a request that also holds supported ones, along
+	// with the error each of them would fail with on its own.
+	UnknownCommandsKey = "unknown_commands"
+	// DoCommandSchemaVersion is increased whenever a key of a response is renamed, removed or changes type.
+	DoCommandSchemaVersion = 1
+	// defaultMapGeoJSONResolution is the cell size, in meters, of get_map_geojson if it is not given.
+	defaultMapGeoJSONResolution = 0.25
+)
+
+// maxCommandSuggestions is the number of supported commands that are suggested for an unknown command.
+const maxCommandSuggestions = 3
+
+// doCommand describes a command that can be sent to DoCommand as a key of the request.
+type doCommand struct {
+	description string
+	// input describes the value of the key, it is empty for commands that ignore it.
+	input  string
+	handle func(cartoSvc *CartographerService, ctx context.Context, val interface{}) (map[string]interface{}, error)
+}
+
+// doCommands holds every command DoCommand supports by the key it is sent under. It is set in init, as
+// list_commands refers to it.
+var doCommands map[string]doCommand
+
+func init() {
+	doCommands = map[string]doCommand{
+		ListCommandsCommand: {
+			description: "lists the supported commands with their description and the schema version of the responses",
+			handle:      (*CartographerService).doListCommands,
+		},
+		VersionCommand: {
+			description: "the version of the module, the config hash identifying the tuning of the run and the optional " +
+				"features the cartographer library provides",
+			handle: (*CartographerService).doVersion,
+		},
+		JobDoneCommand: {
+			description: "whether the job has finished and, in offline mode, its progress and result",
+			handle:      (*CartographerService).doJobDone,
+		},
+		JobProgressCommand: {
+			description: "how far along the offline sensor process is through the dataset",
+			handle:      (*CartographerService).doJobProgress,
+		},
+		StatusCommand: {
+			description: "whether cartographer is responsive, the level it logs at, the optional features it provides, its " +
+				"trajectories, its memory usage and the construction warnings",
+			handle: (*CartographerService).doStatus,
+		},
+		ClearWarningsCommand: {
+			description: "acknowledges and clears the warnings listed in the status response",
+			handle:      (*CartographerService).doClearWarnings,
+		},
+		ClearRecentErrorsCommand: {
+			description: "clears the recent warnings and errors listed in the status response",
+			handle:      (*CartographerService).doClearRecentErrors,
+		},
+		SetLogLevelCommand: {
+			description: "changes the level cartographer logs at",
+			input:       "one of \"info\", \"warn\" or \"debug\"",
+			handle:      (*CartographerService).doSetLogLevel,
+		},
+		StartNewTrajectoryCommand: {
+			description: "finishes and freezes the current trajectory and starts a new one",
+			input:       "null or the initial pose of the new trajectory as {\"x\": <val>, \"y\": <val>, \"theta\": <val>}",
+			handle:      (*CartographerService).doStartNewTrajectory,
+		},
+		SetModeCommand: {
+			description: "switches between localizing against the map and adding to it",
+			input:       "one of \"localize\" or \"map\"",
+			handle:      (*CartographerService).doSetMode,
+		},
+		RelocalizeCommand: {
+			description: "restarts the localization against the map, e.g. after the robot was moved",
+			input:       "null or a pose hint as {\"x\": <val>, \"y\": <val>, \"theta\": <val>}",
+			handle:      (*CartographerService).doRelocalize,
+		},
+		LoadInternalStateCommand: {
+			description: "replaces the internal state that is localized against, clearing the postprocessing of the " +
+				"previous map, the response holds the slam mode cartographer is started in",
+			input:  "the path of a .pbstream file",
+			handle: (*CartographerService).doLoadInternalState,
+		},
+		GetSessionStartTimeCommand: {
+			description: "the wall clock time of the session epoch when rebase_timestamps is enabled",
+			handle:      (*CartographerService).doGetSessionStartTime,
+		},
+		GetAlgoConfigCommand: {
+			description: "the requested and the applied cartographer algo config",
+			handle:      (*CartographerService).doGetAlgoConfig,
+		},
+		SensorMetricsCommand: {
+			description: "the number of readings and the ingestion latency per sensor and the duty cycle and memory usage of cartographer",
+			handle:      (*CartographerService).doSensorMetrics,
+		},
+		SensorStatsCommand: {
+			description: "the number of readings of every sensor that were attempted to be added to cartographer and their outcomes",
+			handle:      (*CartographerService).doSensorStats,
+		},
+		SlamStatsCommand: {
+			description: "the number of nodes of the current trajectory and how far the optimization of the pose graph lags behind them",
+			handle:      (*CartographerService).doSlamStats,
+		},
+		ExportMetricsCSVCommand: {
+			description: "exports the job statistics and sensor metrics as a CSV, optionally to a file within internal_state_export_dirs",
+			input:       "null or the absolute path of the file",
+			handle:      (*CartographerService).doExportMetricsCSV,
+		},
+		ChangeHeatmapCommand: {
+			description: "the heatmap of where lidar readings disagreed with the map when change_detection is enabled",
+			input:       "null, \"pcd\" or \"png\"",
+			handle:      (*CartographerService).doChangeHeatmap,
+		},
+		SubscribePosesCommand: {
+			description: "registers a subscription to the poses of cartographer, which are published whenever they " +
+				"change after every lidar reading that is added and once a second, holds up to buffer_size of the " +
+				"newest poses until they are polled and expires when it is not polled for a minute",
+			input:  "{\"id\": <string>, \"buffer_size\": <number>}, where buffer_size defaults to 100",
+			handle: (*CartographerService).doSubscribePoses,
+		},
+		PollPosesCommand: {
+			description: "the poses published to a subscription since it was last polled, from the oldest to the " +
+				"newest, and the number of older ones dropped because it was full. The poses published while the " +
+				"existing map is optimized in the background are marked as pre_optimization",
+			input:  "the id of the subscription",
+			handle: (*CartographerService).doPollPoses,
+		},
+		UnsubscribePosesCommand: {
+			description: "removes a subscription to the poses of cartographer",
+			input:       "the id of the subscription",
+			handle:      (*CartographerService).doUnsubscribePoses,
+		},
+		GetMapDeltaCommand: {
+			description: "the points added to the pointcloud map since a revision, or the full map if they are unavailable",
+			input:       "null or the revision of the map from the previous response",
+			handle:      (*CartographerService).doGetMapDelta,
+		},
+		GetTelemetryCompactCommand: {
+			description: "the pose, slam mode, map revision, reading counters and health flags as a base64 encoded " +
+				"binary blob of fixed layout, decoded by DecodeCompactTelemetry",
+			handle: (*CartographerService).doGetTelemetryCompact,
+		},
+		GetOccupancyGridCommand: {
+			description: "the pointcloud map projected onto a 2D occupancy grid as a PGM image and its map_server metadata",
+			input: "null or {\"resolution\": <meters>, \"occupied_threshold\": <points>, \"occupied_probability\": <percent>, " +
+				"\"free_probability\": <percent>, \"crop\": <crop>}, where <crop> is \"mapping_bounds\", " +
+				"{\"minx\": <val>, \"miny\": <val>, \"maxx\": <val>, \"maxy\": <val>} in mm or " +
+				"{\"polygon\": [{\"x\": <val>, \"y\": <val>}, ...]} in mm",
+			handle: (*CartographerService).doGetOccupancyGrid,
+		},
+		GetMapGeoJSONCommand: {
+			description: "the outline of the mapped area as a GeoJSON FeatureCollection of polygons in millimeters in the map frame",
+			input:       "null or {\"resolution\": <meters>, \"min_probability\": <percent>}",
+			handle:      (*CartographerService).doGetMapGeoJSON,
+		},
+		GetTrajectoryCommand: {
+			description: "the time and optimized pose of every node of every trajectory in the pose graph",
+			input:       "null or {\"since_unix_ms\": <val>, \"chunk\": <val>}",
+			handle:      (*CartographerService).doGetTrajectory,
+		},
+		SubmapListCommand: {
+			description: "the id, version and optimized pose of every submap in the pose graph",
+			handle:      (*CartographerService).doSubmapList,
+		},
+		GetSubmapCommand: {
+			description: "the pointcloud of a single submap of the pose graph",
+			input:       "{\"trajectory_id\": <val>, \"submap_index\": <val>, \"chunk\": <val>, \"version\": <val>}",
+			handle:      (*CartographerService).doGetSubmap,
+		},
+		WriteInternalStateToPathCommand: {
+			description: "writes the internal state to a file within internal_state_export_dirs",
+			input:       "the absolute path of the file",
+			handle:      (*CartographerService).doWriteInternalStateToPath,
+		},
+		ShadowPositionCommand: {
+			description: "the position of the primary and the shadow cartographer instance",
+			handle:      (*CartographerService).doShadowPosition,
+		},
+		ShadowMapInfoCommand: {
+			description: "the map info of the primary and the shadow cartographer instance",
+			handle:      (*CartographerService).doShadowMapInfo,
+		},
+		SetMappingBoundsCommand: {
+			description: "changes the mapping bounds lidar readings are clipped to",
+			input:       "null or the mapping bounds in the format of the mapping_bounds config",
+			handle:      (*CartographerService).doSetMappingBounds,
+		},
+		SetSessionPostprocessingCommand: {
+			description: "sets whether PointCloudMap postprocesses the map for the session of the request",
+			input:       "{\"postprocessed\": <bool>} or null to clear the override",
+			handle:      (*CartographerService).doSetSessionPostprocessing,
+		},
+		postprocess.ToggleCommand: {
+			description: "turns postprocessing of the pointcloud map on or off",
+			handle:      (*CartographerService).doPostprocessToggle,
+		},
+		postprocess.AddCommand: {
+			description: "adds points to the pointcloud map",
+			input:       "a list of points as {\"X\": <val>, \"Y\": <val>}",
+			handle:      (*CartographerService).doPostprocessAdd,
+		},
+		postprocess.RemoveCommand: {
+			description: "removes points from the pointcloud map",
+			input:       "a list of points as {\"X\": <val>, \"Y\": <val>}",
+			handle:      (*CartographerService).doPostprocessRemove,
+		},
+		postprocess.CropCommand: {
+			description: "removes the points outside of a box from the pointcloud map",
+			input:       "the box in mm as {\"minx\": <val>, \"miny\": <val>, \"maxx\": <val>, \"maxy\": <val>}",
+			handle:      (*CartographerService).doPostprocessCrop,
+		},
+		postprocess.DownsampleCommand: {
+			description: "keeps a single point per voxel of the pointcloud map, for clients that render large maps",
+			input:       "the edge length of the voxels in mm",
+			handle:      (*CartographerService).doPostprocessDownsample,
+		},
+		postprocess.UndoCommand: {
+			description: "undoes the last postprocessing step",
+			handle:      (*CartographerService).doPostprocessUndo,
+		},
+		postprocess.PathCommand: {
+			description: "replaces the postprocessed pointcloud map with a pcd file",
+			input:       "the path of the pcd file",
+			handle:      (*CartographerService).doPostprocessPath,
+		},
+	}
+}
+
+// DoCommand receives arbitrary commands. A request holds one or more of the supported commands, which are returned
+// by list_commands, as its keys. The commands of a request are run in the order of their names and their responses
+// are merged into one, the first command that fails fails the request. A value a command cannot use is rejected with
+// an error that reads "invalid argument for <command>: <detail>". Unknown commands along with supported ones are
+// skipped and listed under unknown_commands, a request of unknown commands only fails.
+func (cartoSvc *CartographerService) DoCommand(ctx context.Context, req map[string]interface{}) (map[string]interface{}, error) {
+	_, span := trace.StartSpan(ctx, "viamcartographer::CartographerService::DoCommand")
+	defer span.End()
+
+	if _, ok := req[StatusCommand]; ok && len(req) == 1 && cartoSvc.useCloudSlam {
+		return cartoSvc.cloudSlamStatus(), nil
+	}
+
+	if err := cartoSvc.isOpenAndRunningLocally("DoCommand"); err != nil {
+		return nil, err
+	}
+
+	if len(req) == 0 {
+		return nil, viamgrpc.UnimplementedError
+	}
+	// all commands are checked before any is run, so that a request with a value that is not an argument at all has
+	// no effect
+	names := make([]string, 0, len(req))
+	var unknown []string
+	for name, val := range req {
+		if _, ok := doCommands[name]; !ok {
+			unknown = append(unknown, name)
+			continue
+		}
+		if err := checkDoCommandArg(val); err != nil {
+			return nil, &invalidArgumentError{command: name, err: err}
+		}
+		names = append(names, name)
+	}
+	sort.Strings(unknown)
+	if len(names) == 0 {
+		return nil, unknownCommandError(unknown[0])
+	}
+	if len(names) == 1 && len(unknown) == 0 {
+		return cartoSvc.runDoCommand(ctx, names[0], req[names[0]])
+	}
+
+	sort.Strings(names)
+	resp := map[string]interface{}{}
+	if len(unknown) > 0 {
+		unknownErrs := map[string]interface{}{}
+		for _, name := range unknown {
+			unknownErrs[name] = unknownCommandError(name).Error()
+		}
+		resp[UnknownCommandsKey] = unknownErrs
+		cartoSvc.logger.Debugw("skipping the unknown commands of a DoCommand request", "commands", unknown)
+	}
+	for _, name := range names {
+		cmdResp, err := cartoSvc.runDoCommand(ctx, name, req[name])
+		if err != nil {
+			return nil, err
+		}
+		maps.Copy(resp, cmdResp)
+	}
+	return resp, nil
+}
+
+// runDoCommand runs the command name of a DoCommand request with its value val.
+func (cartoSvc *CartographerService) runDoCommand(
+	ctx context.Context,
+	name string,
+	val interface{},
+) (map[string]interface{}, error) {
+	// load_internal_state replaces the cartofacade the other commands use
+	if name != LoadInternalStateCommand {
+		cartoSvc.cartoFacadeMu.RLock()
+		defer cartoSvc.cartoFacadeMu.RUnlock()
+	}
+	resp, err := doCommands[name].handle(cartoSvc, ctx, val)
+	var argErr *invalidArgumentError
+	if errors.As(err, &argErr) {
+		argErr.command = name
+	}
+	return resp, err
+}
+
+// unknownCommandError returns the error for a command that is not supported, suggesting the supported commands
+// with the most similar names.
+func unknownCommandError(name string) error {
+	type candidate struct {
+		name     string
+		distance int
+	}
+	var candidates []candidate
+	for supported := range doCommands {
+		distance := editDistance(name, supported)
+		// near misses are typos of, or parts of, a supported command
+		if distance <= max(2, len(supported)/3) || (name != "" && strings.Contains(supported, name)) {
+			candidates = append(candidates, candidate{name: supported, distance: distance})
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].distance == candidates[j].distance {
+			return candidates[i].name < candidates[j].name
+		}
+		return candidates[i].distance < candidates[j].distance
+	})
+
+	err := errors.Wrapf(viamgrpc.UnimplementedError, "unknown command %q", name)
+	if len(candidates) == 0 {
+		return errors.Wrapf(err, "see %s for the supported commands", ListCommandsCommand)
+	}
+	suggestions := make([]string, 0, maxCommandSuggestions)
+	for _, c := range candidates[:min(len(candidates), maxCommandSuggestions)] {
+		suggestions = append(suggestions, c.name)
+	}
+	return errors.Wrapf(err, "did you mean %s", strings.Join(suggestions, ", "))
+}
+
+// editDistance returns the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			substitution := prev[j-1]
+			if a[i-1] != b[j-1] {
+				substitution++
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, substitution)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
+}
+
+func (cartoSvc *CartographerService) doListCommands(ctx context.Context, _ interface{}) (map[string]interface{}, error) {
+	commands := map[string]interface{}{}
+	for name, cmd := range doCommands {
+		commands[name] = map[string]interface{}{
+			"description": cmd.description,
+			"input":       cmd.input,
+		}
+	}
+	return map[string]interface{}{
+		SchemaVersionKey: DoCommandSchemaVersion,
+		CommandsKey:      commands,
+	}, nil
+}
+
+func (cartoSvc *CartographerService) doJobDone(ctx context.Context, _ interface{}) (map[string]interface{}, error) {
+	resp := map[string]interface{}{JobDoneCommand: cartoSvc.jobDone.Load()}
+	if cartoSvc.jobSummary == nil {
+		// the job summary is only set in offline mode
+		resp["cause"] = string(sensorprocess.CauseOnline)
+	} else {
+		for key, val := range cartoSvc.jobSummary.ToMap() {
+			resp[key] = val
+		}
+	}
+	if result := cartoSvc.jobResult.Load(); result != nil {
+		for key, val := range result.ToMap() {
+			resp[key] = val
+		}
+	}
+	if cartoSvc.configHash != "" {
+		resp[ConfigHashKey] = cartoSvc.configHash
+	}
+	cartoSvc.addSessionStartTime(resp)
+	if cartoSvc.sessionStats != nil {
+		resp[SessionStatsKey] = cartoSvc.sessionStats.toMap(time.Now())
+	}
+	return resp, nil
+}
+
+func (cartoSvc *CartographerService) doJobProgress(ctx context.Context, _ interface{}) (map[string]interface{}, error) {
+	if cartoSvc.jobSummary == nil {
+		// the job summary is only set in offline mode
+		return nil, ErrJobProgressOnline
+	}
+	resp := cartoSvc.jobSummary.Progress(time.Now())
+	resp[JobDoneCommand] = cartoSvc.jobDone.Load()
+	return resp, nil
+}
+
+func (cartoSvc *CartographerService) doVersion(ctx context.Context, _ interface{}) (map[string]interface{}, error) {
+	resp := map[string]interface{}{
+		ModuleVersionKey: ModuleVersion,
+		ConfigHashKey:    cartoSvc.configHash,
+	}
+	if cartoSvc.cartoLib != nil {
+		resp[CapabilitiesKey] = cartoSvc.cartoLib.Capabilities().Available()
+	}
+	return resp, nil
+}
+
+// cloudSlamStatus returns the status of a service with use_cloud_slam set, for users to check which sensors are
+// configured and which fields of the config do not apply.
+func (cartoSvc *CartographerService) cloudSlamStatus() map[string]interface{} {
+	resp := map[string]interface{}{
+		"use_cloud_slam": true,
+		"camera":         cartoSvc.lidar.Name(),
+		IgnoredFieldsKey: append([]string{}, cartoSvc.cloudSlamIgnoredFields...),
+	}
+	if cartoSvc.movementSensor != nil {
+		resp["movement_sensor"] = cartoSvc.movementSensor.Name()
+	}
+	return resp
+}
+
+func (cartoSvc *CartographerService) doStatus(ctx context.Context, _ interface{}) (map[string]interface{}, error) {
+	unresponsive := cartoSvc.cartofacade.Unresponsive()
+	_, slamMode := cartoSvc.mode()
+	resp := map[string]interface{}{
+		UnresponsiveKey: unresponsive,
+		LogLevelKey:     fromGlogLevels(cartoSvc.cartoLib.LogLevel()),
+		CapabilitiesKey: cartoSvc.cartoLib.Capabilities().Available(),
+		CartoFacadeKey:  cartoFacadeStatusToMap(cartoSvc.cartofacade.Status()),
+		SlamModeKey:     slamMode.String(),
+		JobDoneCommand:  cartoSvc.jobDone.Load(),
+		SharedCameraKey: cartoSvc.sharedCamera.Load(),
+		UnitsKey:        unitsToMap(),
+		MemoryKey:       cartoSvc.memoryMetrics(),
+	}
+	if cartoSvc.scanFilter != nil {
+		resp[DroppedScansKey] = cartoSvc.scanFilter.DroppedCount()
+	}
+	if cartoSvc.lidarRejectionDiagnostic != nil {
+		if diagnosis := cartoSvc.lidarRejectionDiagnostic.ToMap(); diagnosis != nil {
+			resp[LidarRejectionDiagnosisKey] = diagnosis
+		}
+	}
+	if cartoSvc.editedMap != nil {
+		resp[EditedMapInconsistentKey] = cartoSvc.editedMapInconsistent.Load()
+	}
+	if slamMode == cartofacade.MappingMode {
+		resp[MapStalledKey] = cartoSvc.mapStalled.Load()
+	}
+	if slamMode == cartofacade.LocalizingMode {
+		resp[LocalizationLostKey] = cartoSvc.localizationLost.Load()
+	}
+	if sensorResources := cartoSvc.sensorResourcesToMap(); len(sensorResources) > 0 {
+		resp[SensorResourcesKey] = sensorResources
+	}
+	if cartoSvc.movementSensor != nil {
+		resp[MovementSensorUsageKey] = cartoSvc.movementSensorUsageToMap()
+	}
+	if cartoSvc.sessionStats != nil {
+		resp[SessionStatsKey] = cartoSvc.sessionStats.toMap(time.Now())
+	}
+	if warnings, dropped := cartoSvc.constructionWarnings.toList(); len(warnings) > 0 {
+		resp[ConstructionWarningsKey] = warnings
+		if dropped > 0 {
+			resp[DroppedConstructionWarningsKey] = dropped
+		}
+	}
+	if cartoSvc.recentErrors != nil {
+		if recentErrors, dropped := cartoSvc.recentErrors.toList(); len(recentErrors) > 0 {
+			resp[RecentErrorsKey] = recentErrors
+			if dropped > 0 {
+				resp[DroppedRecentErrorsKey] = dropped
+			}
+		}
+	}
+	if cartoSvc.mapOverlap != nil {
+		resp[MapOverlapKey] = cartoSvc.mapOverlap.ToMap()
+	}
+	if workers := cartoSvc.workers.toList(); len(workers) > 0 {
+		resp[WorkersKey] = workers
+	}
+	if cartoSvc.calibrationFile != "" {
+		resp[CalibrationFileKey] = map[string]interface{}{
+			"path":   cartoSvc.calibrationFile,
+			"sha256": cartoSvc.calibrationFileChecksum,
+		}
+	}
+	initialOptimizationInProgress := cartoSvc.initialOptimizationInProgress.Load()
+	if cartoSvc.initialOptimizationDeferred {
+		resp[InitialOptimizationInProgressKey] = initialOptimizationInProgress
+	}
+	if unresponsive || cartoSvc.initialOptimizationBlocking() {
+		// a call to get the trajectories would wait on the hung call or on the optimization
+		return resp, nil
+	}
+	trajectories, err := cartoSvc.cartofacade.Trajectories(ctx, cartoSvc.cartoFacadeTimeout)
+	if err != nil {
+		return nil, err
+	}
+	resp[TrajectoriesKey] = trajectoriesToList(trajectories)
+	return resp, nil
+}
+
+// cartoFacadeStatusToMap returns the status of a cartofacade for the status response.
+func cartoFacadeStatusToMap(status cartofacade.Status) map[string]interface{} {
+	resp := map[string]interface{}{
+		"state":                  string(status.State),
+		"queue_depth":            status.QueueDepth,
+		"final_optimization_run": status.FinalOptimizationRun,
+	}
+	if !status.LastLidarReadingAddedAt.IsZero() {
+		resp["last_lidar_reading_added_at"] = status.LastLidarReadingAddedAt.UTC().Format(time.RFC3339Nano)
+	}
+	return resp
+}
+
+// sensorResourcesToMap returns the health of the resources the lidar and the movement sensor read from, in the
+// format of the status response.
+func (cartoSvc *CartographerService) sensorResourcesToMap() map[string]interface{} {
+	resp := map[string]interface{}{}
+	if health, ok := s.ResourceHealthOf(cartoSvc.lidar); ok {
+		resp["lidar"] = resourceHealthToMap(health)
+	}
+	if health, ok := s.ResourceHealthOf(cartoSvc.movementSensor); ok {
+		resp["movement_sensor"] = resourceHealthToMap(health)
+	}
+	return resp
+}
+
+func resourceHealthToMap(health s.ResourceHealth) map[string]interface{} {
+	resp := map[string]interface{}{
+		"name":           health.Name.String(),
+		"startup_checks": health.StartupChecks,
+	}
+	if !health.LastSuccessfulReadAt.IsZero() {
+		resp["last_successful_read_at"] = health.LastSuccessfulReadAt.UTC().Format(time.RFC3339Nano)
+	}
+	if health.LastError != "" {
+		resp["last_error"] = health.LastError
+		resp["last_error_at"] = health.LastErrorAt.UTC().Format(time.RFC3339Nano)
+	}
+	return resp
+}
+
+func (cartoSvc *CartographerService) doClearWarnings(ctx context.Context, _ interface{}) (map[string]interface{}, error) {
+	cleared := cartoSvc.constructionWarnings.clear()
+	cartoSvc.logger.Infow("cleared construction warnings", "cleared_warnings", cleared)
+	return map[string]interface{}{
+		ClearWarningsCommand: SuccessMessage,
+		ClearedWarningsKey:   cleared,
+	}, nil
+}
+
+func (cartoSvc *CartographerService) doClearRecentErrors(ctx context.Context, _ interface{}) (map[string]interface{}, error) {
+	cleared := 0
+	if cartoSvc.recentErrors != nil {
+		cleared = cartoSvc.recentErrors.clear()
+	}
+	cartoSvc.logger.Infow("cleared recent errors", "cleared_recent_errors", cleared)
+	return map[string]interface{}{
+		ClearRecentErrorsCommand: SuccessMessage,
+		ClearedRecentErrorsKey:   cleared,
+	}, nil
+}
+
+func (cartoSvc *CartographerService) doSetLogLevel(ctx context.Context, val interface{}) (map[string]interface{}, error) {
+	logLevel, err := decodeDoCommandArg[string](val)
+	if err != nil {
+		return nil, invalidArgument(errors.Wrap(ErrBadLogLevel, err.Error()))
+	}
+	minloglevel, vlog, err := toGlogLevels(logLevel)
+	if err != nil {
+		return nil, invalidArgument(err)
+	}
+	if err := cartoSvc.cartoLib.SetLogLevel(minloglevel, vlog); err != nil {
+		return nil, err
+	}
+	cartoSvc.logger.Infow("changed cartographer log level", "log_level", logLevel)
+	return map[string]interface{}{SetLogLevelCommand: SuccessMessage}, nil
+}
+
+func (cartoSvc *CartographerService) doStartNewTrajectory(ctx context.Context, val interface{}) (map[string]interface{}, error) {
+	initialPose, err := toTrajectoryPose(val)
+	if err != nil {
+		return nil, invalidArgument(err)
+	}
+	newTrajectory, err := cartoSvc.cartofacade.StartNewTrajectory(ctx, cartoSvc.cartoFacadeTimeout, initialPose)
+	if err != nil {
+		return nil, err
+	}
+	cartoSvc.logger.Infow("started new trajectory",
+		"finished_trajectory_id", newTrajectory.FinishedTrajectoryID,
+		"trajectory_id", newTrajectory.TrajectoryID)
+	cartoSvc.enforceTrajectoryLimit(ctx)
+	if cartoSvc.sessionStats != nil {
+		cartoSvc.sessionStats.reset(time.Now())
+	}
+	return map[string]interface{}{
+		StartNewTrajectoryCommand: SuccessMessage,
+		FinishedTrajectoryIDKey:   newTrajectory.FinishedTrajectoryID,
+		TrajectoryIDKey:           newTrajectory.TrajectoryID,
+	}, nil
+}
+
+func (cartoSvc *CartographerService) doRelocalize(ctx context.Context, val interface{}) (map[string]interface{}, error) {
+	poseHint, err := toTrajectoryPose(val)
+	if err != nil {
+		return nil, invalidArgument(err)
+	}
+
+	// set_mode can not switch to mapping while the trajectory is restarted
+	cartoSvc.modeMu.RLock()
+	defer cartoSvc.modeMu.RUnlock()
+	if cartoSvc.enableMapping {
+		return nil, ErrRelocalizeWhileMapping
+	}
+	restartedTrajectory, err := cartoSvc.cartofacade.RestartTrajectory(ctx, cartoSvc.cartoFacadeTimeout, poseHint)
+	if err != nil {
+		return nil, err
+	}
+	cartoSvc.logger.Infow("relocalizing against the map",
+		"restarted_trajectory_id", restartedTrajectory.RestartedTrajectoryID,
+		"trajectory_id", restartedTrajectory.TrajectoryID,
+		"pose_hint", poseHint != nil)
+	return map[string]interface{}{
+		RelocalizeCommand:        SuccessMessage,
+		RestartedTrajectoryIDKey: restartedTrajectory.RestartedTrajectoryID,
+		TrajectoryIDKey:          restartedTrajectory.TrajectoryID,
+	}, nil
+}
+
+func (cartoSvc *CartographerService) doSetMode(ctx context.Context, val interface{}) (map[string]interface{}, error) {
+	if err := cartoSvc.isOpenAndRunningLocally(SetModeCommand); err != nil {
+		return nil, err
+	}
+	mode, err := decodeDoCommandArg[string](val)
+	if err != nil || (mode != ModeLocalize && mode != ModeMap) {
+		return nil, invalidArgument(ErrBadMode)
+	}
+	// offline, the readings of a dataset are meant to end up in a single trajectory
+	if cartoSvc.lidar.DataFrequencyHz() == 0 && !cartoSvc.jobDone.Load() {
+		return nil, ErrSetModeOffline
+	}
+
+	enableMapping := mode == ModeMap
+	slamMode := cartofacade.LocalizingMode
+	if enableMapping {
+		slamMode = cartofacade.MappingMode
+		if cartoSvc.existingMap != "" || cartoSvc.floorPlan != nil {
+			slamMode = cartofacade.UpdatingMode
+		}
+	}
+
+	cartoSvc.modeMu.Lock()
+	defer cartoSvc.modeMu.Unlock()
+	if err := cartoSvc.cartofacade.SetSlamMode(ctx, cartoSvc.cartoFacadeTimeout, slamMode); err != nil {
+		return nil, err
+	}
+	cartoSvc.enableMapping = enableMapping
+	cartoSvc.SlamMode = slamMode
+	cartoSvc.updateMapGrowthMonitor(slamMode)
+	cartoSvc.logger.Infow("switched mode", "mode", mode, "slam_mode", slamMode)
+	cartoSvc.enforceTrajectoryLimit(ctx)
+	return map[string]interface{}{SetModeCommand: SuccessMessage}, nil
+}
+
+func (cartoSvc *CartographerService) doLoadInternalState(ctx context.Context, val interface{}) (map[string]interface{}, error) {
+	path, err := decodeDoCommandArg[string](val)
+	if err != nil {
+		return nil, invalidArgument(errors.Wrap(ErrBadLoadInternalStatePath, err.Error()))
+	}
+	if filepath.Ext(path) != internalStateFileType {
+		return nil, invalidArgument(ErrBadLoadInternalStatePath)
+	}
+	// offline, the readings of a dataset are meant to be added to a single internal state
+	if cartoSvc.lidar.DataFrequencyHz() == 0 {
+		return nil, ErrLoadInternalStateOffline
+	}
+
+	slamMode, err := cartoSvc.loadInternalState(ctx, filepath.Clean(path))
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		LoadInternalStateCommand: SuccessMessage,
+		SlamModeKey:              slamMode.String(),
+	}, nil
+}
+
+func (cartoSvc *CartographerService) doGetSessionStartTime(ctx context.Context, _ interface{}) (map[string]interface{}, error) {
+	resp := map[string]interface{}{}
+	cartoSvc.addSessionStartTime(resp)
+	return resp, nil
+}
+
+func (cartoSvc *CartographerService) doGetAlgoConfig(ctx context.Context, _ interface{}) (map[string]interface{}, error) {
+	applied, err := cartoSvc.cartofacade.AlgoConfig(ctx, cartoSvc.cartoFacadeTimeout)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		RequestedAlgoConfigKey: cartoSvc.requestedAlgoConfig.ToMap(),
+		AppliedAlgoConfigKey:   applied.ToMap(),
+	}, nil
+}
+
+func (cartoSvc *CartographerService) doSensorStats(ctx context.Context, _ interface{}) (map[string]interface{}, error) {
+	if cartoSvc.sensorStats == nil {
+		return map[string]interface{}{}, nil
+	}
+	return cartoSvc.sensorStats.ToMap(), nil
+}
+
+func (cartoSvc *CartographerService) doSensorMetrics(ctx context.Context, _ interface{}) (map[string]interface{}, error) {
+	resp := map[string]interface{}{}
+	if cartoSvc.ingestionLatency != nil {
+		for sensor, stats := range cartoSvc.ingestionLatency.Stats() {
+			resp[sensor] = stats.ToMap()
+		}
+	}
+	if emptyReadings := cartoSvc.emptyLidarReadings.Load(); emptyReadings > 0 {
+		lidarMetrics, ok := resp[sensorprocess.LidarSensor].(map[string]interface{})
+		if !ok {
+			lidarMetrics = map[string]interface{}{}
+			resp[sensorprocess.LidarSensor] = lidarMetrics
+		}
+		lidarMetrics["empty_readings"] = emptyReadings
+	}
+	if cartoSvc.cartofacade != nil {
+		if dutyCyclePercent, ok := cartoSvc.cartofacade.DutyCycle(); ok {
+			resp[FacadeWorkerKey] = map[string]interface{}{"duty_cycle_percent": dutyCyclePercent}
+		}
+	}
+	if stats := cartoSvc.slamStats.Load(); stats != nil {
+		resp[SlamStatsCommand] = slamStatsToMap(*stats)
+	}
+	if cartoSvc.mapOverlap != nil {
+		resp[MapOverlapKey] = cartoSvc.mapOverlap.ToMap()
+	}
+	resp[MemoryKey] = cartoSvc.memoryMetrics()
+	return resp, nil
+}
+
+func (cartoSvc *CartographerService) doSlamStats(ctx context.Context, _ interface{}) (map[string]interface{}, error) {
+	stats, err := cartoSvc.cartofacade.SlamStats(ctx, cartoSvc.cartoFacadeTimeout)
+	if err != nil {
+		return nil, err
+	}
+	trajectories, err := cartoSvc.cartofacade.Trajectories(ctx, cartoSvc.cartoFacadeTimeout)
+	if err != nil {
+		return nil, err
+	}
+	resp := slamStatsToMap(stats)
+	resp[TrajectoriesKey] = trajectoriesToList(trajectories)
+	return resp, nil
+}
+
+func (cartoSvc *CartographerService) doExportMetricsCSV(ctx context.Context, val interface{}) (map[string]interface{}, error) {
+	if val == nil || val == "" {
+		metrics, err := cartoSvc.metricsCSV(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"csv": string(metrics)}, nil
+	}
+	if len(cartoSvc.internalStateExportDirs) == 0 {
+		return nil, ErrInternalStateExportNotConfigured
+	}
+	path, err := decodeDoCommandArg[string](val)
+	if err != nil {
+		return nil, invalidArgument(errors.Wrap(ErrBadMetricsCSVPath, err.Error()))
+	}
+	if !filepath.IsAbs(path) {
+		return nil, invalidArgument(ErrBadMetricsCSVPath)
+	}
+	path, err = resolveInternalStateExportPath(path, cartoSvc.internalStateExportDirs)
+	if err != nil {
+		return nil, err
+	}
+	metrics, err := cartoSvc.metricsCSV(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := writeFileAtomically(path, metrics); err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"path":       path,
+		"size_bytes": len(metrics),
+	}, nil
+}
+
+// memoryMetrics returns the memory usage of cartographer as of the last poll of the memory monitor along with
+// highlights of the memory statistics of the go runtime, so that the memory usage of the process can be
+// attributed to either side.
+func (cartoSvc *CartographerService) memoryMetrics() map[string]interface{} {
+	var memStats runtime.MemStats
+	runtime.ReadMemStats(&memStats)
+	metrics := map[string]interface{}{
+		"cartographer_memory_available": false,
+		"go_heap_alloc_bytes":           memStats.HeapAlloc,
+		"go_heap_sys_bytes":             memStats.HeapSys,
+		"go_sys_bytes":                  memStats.Sys,
+		"go_num_gc":                     memStats.NumGC,
+	}
+	if cartoSvc.cartofacade == nil {
+		return metrics
+	}
+	if allocatedBytes, ok := cartoSvc.cartofacade.MemoryUsage(); ok {
+		metrics["cartographer_memory_available"] = true
+		metrics["cartographer_allocated_bytes"] = allocatedBytes
+	}
+	return metrics
+}
+
+func (cartoSvc *CartographerService) doChangeHeatmap(ctx context.Context, val interface{}) (map[string]interface{}, error) {
+	if cartoSvc.changeDetector == nil {
+		return nil, ErrChangeDetectionNotEnabled
+	}
+	format := ChangeHeatmapFormatPCD
+	if val != nil && val != "" {
+		var err error
+		if format, err = decodeDoCommandArg[string](val); err != nil {
+			return nil, invalidArgument(errors.Wrap(ErrBadChangeHeatmapFormat, err.Error()))
+		}
+	}
+	var heatmap []byte
+	var err error
+	switch format {
+	case ChangeHeatmapFormatPCD:
+		heatmap, err = cartoSvc.changeDetector.HeatmapPCD()
+	case ChangeHeatmapFormatPNG:
+		heatmap, err = cartoSvc.changeDetector.HeatmapPNG()
+	default:
+		return nil, invalidArgument(ErrBadChangeHeatmapFormat)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		ChangeHeatmapCommand: base64.StdEncoding.EncodeToString(heatmap),
+		"format":             format,
+		"num_scans":          cartoSvc.changeDetector.NumScans(),
+		"num_changed_cells":  cartoSvc.changeDetector.NumChangedCells(),
+	}, nil
+}
+
+func (cartoSvc *CartographerService) doGetMapDelta(ctx context.Context, val interface{}) (map[string]interface{}, error) {
+	since := -1
+	if val != nil {
+		revision, err := decodeDoCommandArg[float64](val)
+		if err != nil {
+			return nil, invalidArgument(errors.Wrap(ErrBadMapRevision, err.Error()))
+		}
+		if revision < 0 || revision != math.Trunc(revision) || revision > math.MaxInt32 {
+			return nil, invalidArgument(ErrBadMapRevision)
+		}
+		since = int(revision)
+	}
+	// the map revision tracker diffs the map from here on, only the first revision is taken on request
+	cartoSvc.mapRevisions.request(time.Now())
+	if cartoSvc.mapRevisions.current() == 0 {
+		if err := cartoSvc.updateMapRevisions(ctx); err != nil {
+			return nil, err
+		}
+	}
+	delta, err := cartoSvc.mapRevisions.delta(since)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		GetMapDeltaCommand:     base64.StdEncoding.EncodeToString(delta.pcd),
+		"num_points":           delta.numPoints,
+		MapRevisionKey:         delta.revision,
+		FullRefreshRequiredKey: delta.fullRefreshRequired,
+	}, nil
+}
+
+func (cartoSvc *CartographerService) doSubscribePoses(ctx context.Context, val interface{}) (map[string]interface{}, error) {
+	sub, err := decodeDoCommandArg[struct {
+		ID         string `json:"id"`
+		BufferSize *int   `json:"buffer_size"`
+	}](val)
+	if err != nil {
+		return nil, invalidArgument(errors.Wrap(ErrBadPoseSubscription, err.Error()))
+	}
+	bufferSize := defaultPoseSubscriptionBufferSize
+	if sub.BufferSize != nil {
+		bufferSize = *sub.BufferSize
+	}
+	if sub.ID == "" || bufferSize < 1 || bufferSize > maxPoseSubscriptionBufferSize {
+		return nil, invalidArgument(ErrBadPoseSubscription)
+	}
+	if err := cartoSvc.poseSubscriptions.subscribe(sub.ID, bufferSize, time.Now()); err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		SubscribePosesCommand: SuccessMessage,
+		"id":                  sub.ID,
+		"buffer_size":         bufferSize,
+		"expires_after_sec":   poseSubscriptionTimeout.Seconds(),
+	}, nil
+}
+
+func (cartoSvc *CartographerService) doPollPoses(ctx context.Context, val interface{}) (map[string]interface{}, error) {
+	id, err := decodeDoCommandArg[string](val)
+	if err != nil {
+		return nil, invalidArgument(errors.Wrap(ErrBadPoseSubscriptionID, err.Error()))
+	}
+	if id == "" {
+		return nil, invalidArgument(ErrBadPoseSubscriptionID)
+	}
+	poses, numDropped, err := cartoSvc.poseSubscriptions.poll(id, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	posesResp := make([]interface{}, 0, len(poses))
+	for _, pose := range poses {
+		poseResp := positionToMap(pose.pos)
+		poseResp["time"] = pose.at.UTC().Format(time.RFC3339Nano)
+		if pose.preOptimization {
+			poseResp[PreOptimizationKey] = true
+		}
+		posesResp = append(posesResp, poseResp)
+	}
+	return map[string]interface{}{
+		PosesKey:           posesResp,
+		NumDroppedPosesKey: numDropped,
+	}, nil
+}
+
+func (cartoSvc *CartographerService) doUnsubscribePoses(ctx context.Context, val interface{}) (map[string]interface{}, error) {
+	id, err := decodeDoCommandArg[string](val)
+	if err != nil {
+		return nil, invalidArgument(errors.Wrap(ErrBadPoseSubscriptionID, err.Error()))
+	}
+	if id == "" {
+		return nil, invalidArgument(ErrBadPoseSubscriptionID)
+	}
+	if !cartoSvc.poseSubscriptions.unsubscribe(id) {
+		return nil, ErrUnknownPoseSubscription
+	}
+	return map[string]interface{}{UnsubscribePosesCommand: SuccessMessage}, nil
+}
+
+func (cartoSvc *CartographerService) doGetTelemetryCompact(ctx context.Context, _ interface{}) (map[string]interface{}, error) {
+	telemetry, err := cartoSvc.compactTelemetry(ctx, time.Now()).encode()
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{GetTelemetryCompactCommand: base64.StdEncoding.EncodeToString(telemetry)}, nil
+}
+
+func (cartoSvc *CartographerService) doGetOccupancyGrid(ctx context.Context, val interface{}) (map[string]interface{}, error) {
+	req := occupancyGridRequest{
+		Resolution:          defaultOccupancyGridResolution,
+		OccupiedProbability: defaultOccupiedProbability,
+		FreeProbability:     defaultFreeProbability,
+	}
+	if val != nil {
+		decoded, err := decodeDoCommandArg[struct {
+			Resolution          *float64    `json:"resolution"`
+			OccupiedThreshold   *int        `json:"occupied_threshold"`
+			OccupiedProbability *float64    `json:"occupied_probability"`
+			FreeProbability     *float64    `json:"free_probability"`
+			Crop                interface{} `json:"crop"`
+		}](val)
+		if err != nil {
+			return nil, invalidArgument(errors.Wrap(ErrBadOccupancyGridRequest, err.Error()))
+		}
+		if decoded.Resolution != nil {
+			req.Resolution = *decoded.Resolution
+		}
+		if decoded.OccupiedThreshold != nil {
+			req.OccupiedThreshold = *decoded.OccupiedThreshold
+		}
+		if decoded.OccupiedProbability != nil {
+			req.OccupiedProbability = *decoded.OccupiedProbability
+		}
+		if decoded.FreeProbability != nil {
+			req.FreeProbability = *decoded.FreeProbability
+		}
+		if req.Resolution <= 0 || req.OccupiedThreshold < 0 || req.FreeProbability < 0 ||
+			req.FreeProbability >= req.OccupiedProbability || req.OccupiedProbability > 100 {
+			return nil, invalidArgument(ErrBadOccupancyGridRequest)
+		}
+		if decoded.Crop != nil {
+			crop, err := parseMapCrop(decoded.Crop)
+			if err != nil {
+				return nil, invalidArgument(err)
+			}
+			region, err := cartoSvc.mapCropRegion(crop)
+			if err != nil {
+				return nil, err
+			}
+			req.crop = &region
+		}
+	}
+	opts := cartoSvc.pointCloudMapOptions(ctx, false)
+	// the mapping bounds are resolved once, so that the grid covers the box of the region the map was cropped to
+	opts.crop = req.crop
+	pc, err := cartoSvc.pointCloudMap(ctx, opts)
+	if err != nil {
+		if errors.Is(err, cartofacade.ErrPointCloudMapEmpty) {
+			return nil, ErrOccupancyGridMapEmpty
+		}
+		return nil, err
+	}
+	grid, err := newOccupancyGrid(pc, req)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		GetOccupancyGridCommand: base64.StdEncoding.EncodeToString(grid.pgm),
+		"width":                 grid.width,
+		"height":                grid.height,
+		"resolution":            grid.resolution,
+		"origin":                []float64{grid.originX, grid.originY, 0},
+		"num_occupied_cells":    grid.numOccupied,
+		"yaml":                  grid.yaml(s.EncodeNameForPath(cartoSvc.Name().ShortName()) + ".pgm"),
+	}, nil
+}
+
+func (cartoSvc *CartographerService) doGetMapGeoJSON(ctx context.Context, val interface{}) (map[string]interface{}, error) {
+	resolution := defaultMapGeoJSONResolution
+	var minProbability int
+	if val != nil {
+		decoded, err := decodeDoCommandArg[struct {
+			Resolution     *float64 `json:"resolution"`
+			MinProbability *int     `json:"min_probability"`
+		}](val)
+		if err != nil {
+			return nil, invalidArgument(errors.Wrap(ErrBadMapGeoJSONRequest, err.Error()))
+		}
+		if decoded.Resolution != nil {
+			resolution = *decoded.Resolution
+		}
+		if decoded.MinProbability != nil {
+			minProbability = *decoded.MinProbability
+		}
+		if resolution <= 0 || minProbability < 0 || minProbability > 100 {
+			return nil, invalidArgument(ErrBadMapGeoJSONRequest)
+		}
+	}
+	pc, err := cartoSvc.pointCloudMap(ctx, cartoSvc.pointCloudMapOptions(ctx, false))
+	if err != nil && !errors.Is(err, cartofacade.ErrPointCloudMapEmpty) {
+		return nil, err
+	}
+	// an empty map has an empty outline
+	outline, err := mapexport.OutlineGeoJSON(pc, mapexport.OutlineOptions{
+		ResolutionMm:   resolution * 1000,
+		MinProbability: minProbability,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		GetMapGeoJSONCommand: string(outline.GeoJSON),
+		"num_polygons":       outline.NumPolygons,
+		"resolution":         resolution,
+	}, nil
+}
+
+func (cartoSvc *CartographerService) doGetTrajectory(ctx context.Context, val interface{}) (map[string]interface{}, error) {
+	var req trajectoryRequest
+	if val != nil {
+		decoded, err := decodeDoCommandArg[trajectoryRequest](val)
+		if err != nil {
+			return nil, invalidArgument(errors.Wrap(ErrBadTrajectoryRequest, err.Error()))
+		}
+		if decoded.Chunk < 0 {
+			return nil, invalidArgument(ErrBadTrajectoryRequest)
+		}
+		req = decoded
+	}
+	nodes, err := cartoSvc.cartofacade.Trajectory(ctx, cartoSvc.cartoFacadeTimeout)
+	if err != nil {
+		return nil, err
+	}
+	nodes = cartoSvc.toWallClockTime(nodes)
+	if req.SinceUnixMs != nil {
+		nodes = nodesSince(nodes, time.UnixMilli(*req.SinceUnixMs))
+	}
+	chunk, numChunks, err := trajectoryChunk(nodes, req.Chunk)
+	if err != nil {
+		return nil, invalidArgument(err)
+	}
+	return map[string]interface{}{
+		GetTrajectoryCommand: chunk,
+		"chunk":              req.Chunk,
+		"num_chunks":         numChunks,
+	}, nil
+}
+
+func (cartoSvc *CartographerService) doSubmapList(ctx context.Context, _ interface{}) (map[string]interface{}, error) {
+	submaps, err := cartoSvc.cartofacade.SubmapList(ctx, cartoSvc.cartoFacadeTimeout)
+	if err != nil {
+		return nil, err
+	}
+	list := make([]interface{}, 0, len(submaps))
+	for _, submap := range submaps {
+		list = append(list, submapToMap(submap))
+	}
+	return map[string]interface{}{SubmapListCommand: list}, nil
+}
+
+func (cartoSvc *CartographerService) doGetSubmap(ctx context.Context, val interface{}) (map[string]interface{}, error) {
+	req, err := decodeDoCommandArg[submapRequest](val)
+	if err != nil {
+		return nil, invalidArgument(errors.Wrap(ErrBadSubmapRequest, err.Error()))
+	}
+	if req.TrajectoryID == nil || req.SubmapIndex == nil || req.Chunk < 0 {
+		return nil, invalidArgument(ErrBadSubmapRequest)
+	}
+	id := cartofacade.SubmapID{TrajectoryID: *req.TrajectoryID, SubmapIndex: *req.SubmapIndex}
+	submap, err := cartoSvc.submapCache.submapPointCloud(ctx, cartoSvc.cartofacade, cartoSvc.cartoFacadeTimeout, id)
+	if errors.Is(err, cartofacade.ErrSubmapNotFound) {
+		return nil, invalidArgument(errors.Wrapf(err, "trajectory %d has no submap %d", id.TrajectoryID, id.SubmapIndex))
+	}
+	if err != nil {
+		return nil, err
+	}
+	if req.Version != nil && *req.Version != submap.Version {
+		return nil, invalidArgument(errors.Wrapf(ErrSubmapVersionChanged,
+			"chunks of version %d requested, the submap is at version %d", *req.Version, submap.Version))
+	}
+	chunk, numChunks, err := submapPointCloudChunk(submap.PointCloud, req.Chunk)
+	if err != nil {
+		return nil, invalidArgument(err)
+	}
+	resp := submapToMap(submap.Submap)
+	resp[GetSubmapCommand] = chunk
+	resp["chunk"] = req.Chunk
+	resp["num_chunks"] = numChunks
+	return resp, nil
+}
+
+func (cartoSvc *CartographerService) doWriteInternalStateToPath(ctx context.Context, val interface{}) (map[string]interface{}, error) {
+	if len(cartoSvc.internalStateExportDirs) == 0 {
+		return nil, ErrInternalStateExportNotConfigured
+	}
+	path, err := decodeDoCommandArg[string](val)
+	if err != nil {
+		return nil, invalidArgument(errors.Wrap(ErrBadInternalStatePath, err.Error()))
+	}
+	if !filepath.IsAbs(path) {
+		return nil, invalidArgument(ErrBadInternalStatePath)
+	}
+	if err := cartoSvc.isOpenAndRunningLocally(WriteInternalStateToPathCommand); err != nil {
+		return nil, err
+	}
+	return cartoSvc.writeInternalStateToPath(ctx, path)
+}
+
+func (cartoSvc *CartographerService) doShadowPosition(ctx context.Context, _ interface{}) (map[string]interface{}, error) {
+	if cartoSvc.shadowCartofacade == nil {
+		return nil, ErrShadowNotConfigured
+	}
+	resp := map[string]interface{}{}
+	for key, cf := range map[string]cartofacade.Interface{PrimaryKey: cartoSvc.cartofacade, ShadowKey: cartoSvc.shadowCartofacade} {
+		pos, err := cf.Position(ctx, cartoSvc.cartoFacadeTimeout)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to get the position of the %s cartographer instance", key)
+		}
+		resp[key] = positionToMap(pos)
+	}
+	return resp, nil
+}
+
+func (cartoSvc *CartographerService) doShadowMapInfo(ctx context.Context, _ interface{}) (map[string]interface{}, error) {
+	if cartoSvc.shadowCartofacade == nil {
+		return nil, ErrShadowNotConfigured
+	}
+	resp := map[string]interface{}{UnitsKey: unitsToMap()}
+	for key, cf := range map[string]cartofacade.Interface{PrimaryKey: cartoSvc.cartofacade, ShadowKey: cartoSvc.shadowCartofacade} {
+		mapInfo, err := getMapInfo(ctx, cf, cartoSvc.cartoFacadeTimeout, cartoSvc.cartoFacadeInternalTimeout)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to get the map info of the %s cartographer instance", key)
+		}
+		resp[key] = mapInfo
+	}
+	return resp, nil
+}
+
+func (cartoSvc *CartographerService) doSetMappingBounds(ctx context.Context, val interface{}) (map[string]interface{}, error) {
+	if val == nil {
+		cartoSvc.mappingBounds.Store(nil)
+		return map[string]interface{}{SetMappingBoundsCommand: SuccessMessage}, nil
+	}
+
+	// decoded like the mapping_bounds config, so that the command accepts the same format
+	boundsCfg, err := decodeDoCommandArg[vcConfig.MappingBounds](val)
+	if err != nil {
+		return nil, invalidArgument(errors.Wrap(ErrBadMappingBoundsFormat, err.Error()))
+	}
+	mappingBounds, err := toMappingBounds(&boundsCfg)
+	if err != nil {
+		return nil, invalidArgument(errors.Wrap(ErrBadMappingBoundsFormat, err.Error()))
+	}
+	cartoSvc.mappingBounds.Store(mappingBounds)
+	return map[string]interface{}{SetMappingBoundsCommand: SuccessMessage}, nil
+}
+
+func (cartoSvc *CartographerService) doSetSessionPostprocessing(ctx context.Context, val interface{}) (map[string]interface{}, error) {
+	var postprocessed *bool
+	if val != nil {
+		decoded, err := decodeDoCommandArg[struct {
+			Postprocessed *bool `json:"postprocessed"`
+		}](val)
+		if err != nil {
+			return nil, invalidArgument(errors.Wrap(ErrBadSessionPostprocessing, err.Error()))
+		}
+		if decoded.Postprocessed == nil {
+			return nil, invalidArgument(ErrBadSessionPostprocessing)
+		}
+		postprocessed = decoded.Postprocessed
+	}
+	id := sessionID(ctx)
+	if id == "" {
+		return nil, ErrNoSession
+	}
+	cartoSvc.sessionPostprocessing.set(id, postprocessed)
+	return map[string]interface{}{PostprocessToggleResponseKey: cartoSvc.pointCloudMapOptions(ctx, false).postprocessed}, nil
+}
+
+func (cartoSvc *CartographerService) doPostprocessToggle(ctx context.Context, _ interface{}) (map[string]interface{}, error) {
+	cartoSvc.postprocessed.Store(!cartoSvc.postprocessed.Load())
+	return map[string]interface{}{PostprocessToggleResponseKey: cartoSvc.postprocessed.Load()}, nil
+}
+
+func (cartoSvc *CartographerService) doPostprocessAdd(ctx context.Context, points interface{}) (map[string]interface{}, error) {
+	task, err := parsePostprocessingTask(points, postprocess.Add)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := cartoSvc.appendPostprocessingTask(task); err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{postprocess.AddCommand: SuccessMessage}, nil
+}
+
+func (cartoSvc *CartographerService) doPostprocessRemove(ctx context.Context, points interface{}) (map[string]interface{}, error) {
+	task, err := parsePostprocessingTask(points, postprocess.Remove)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := cartoSvc.appendPostprocessingTask(task); err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{postprocess.RemoveCommand: SuccessMessage}, nil
+}
+
+func (cartoSvc *CartographerService) doPostprocessCrop(ctx context.Context, val interface{}) (map[string]interface{}, error) {
+	box, err := decodeDoCommandArg[map[string]interface{}](val)
+	if err != nil {
+		return nil, invalidArgument(errors.Wrap(ErrBadPostprocessingCropFormat, err.Error()))
+	}
+	task, err := postprocess.ParseCropDoCommand(box)
+	if err != nil {
+		return nil, invalidArgument(errors.Wrap(ErrBadPostprocessingCropFormat, err.Error()))
+	}
+
+	if err := cartoSvc.appendPostprocessingTask(task); err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{postprocess.CropCommand: SuccessMessage}, nil
+}
+
+func (cartoSvc *CartographerService) doPostprocessDownsample(ctx context.Context, val interface{}) (map[string]interface{}, error) {
+	voxelSizeMm, err := decodeDoCommandArg[float64](val)
+	if err != nil {
+		return nil, invalidArgument(errors.Wrap(ErrBadPostprocessingVoxelSize, err.Error()))
+	}
+	task, err := postprocess.ParseDownsampleDoCommand(voxelSizeMm)
+	if err != nil {
+		return nil, invalidArgument(errors.Wrap(ErrBadPostprocessingVoxelSize, err.Error()))
+	}
+
+	if err := cartoSvc.appendPostprocessingTask(task); err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{postprocess.DownsampleCommand: SuccessMessage}, nil
+}
+
+// parsePostprocessingTask parses the points of a postprocessing DoCommand into a task, rejecting more than
+// maxPostprocessingTaskPoints points.
+func parsePostprocessingTask(val interface{}, instruction postprocess.Instruction) (postprocess.Task, error) {
+	points, err := decodeDoCommandArg[[]interface{}](val)
+	if err != nil {
+		return postprocess.Task{}, invalidArgument(errors.Wrap(ErrBadPostprocessingPointsFormat, err.Error()))
+	}
+	if len(points) > maxPostprocessingTaskPoints {
+		return postprocess.Task{}, invalidArgument(errors.Wrapf(ErrBadPostprocessingPointsFormat,
+			"got %d points, expected at most %d", len(points), maxPostprocessingTaskPoints))
+	}
+	task, err := postprocess.ParseDoCommand(points, instruction)
+	if err != nil {
+		return postprocess.Task{}, invalidArgument(errors.Wrap(ErrBadPostprocessingPointsFormat, err.Error()))
+	}
+	return task, nil
+}
+
+// appendPostprocessingTask adds task to the postprocessing tasks unless there are max_postprocessing_tasks already.
+func (cartoSvc *CartographerService) appendPostprocessingTask(task postprocess.Task) error {
+	cartoSvc.mu.Lock()
+	defer cartoSvc.mu.Unlock()
+	if len(cartoSvc.postprocessingTasks) >= cartoSvc.maxPostprocessingTasks {
+		return errors.Wrapf(ErrTooManyPostprocessingTasks, "the limit of max_postprocessing_tasks is %d", cartoSvc.maxPostprocessingTasks)
+	}
+	cartoSvc.postprocessingTasks = append(cartoSvc.postprocessingTasks, task)
+	cartoSvc.postprocessed.Store(true)
+	return nil
+}
+
+func (cartoSvc *CartographerService) doPostprocessUndo(ctx context.Context, _ interface{}) (map[string]interface{}, error) {
+	cartoSvc.mu.Lock()
+	defer cartoSvc.mu.Unlock()
+	if len(cartoSvc.postprocessingTasks) == 0 {
+		return nil, ErrNoPostprocessingToUndo
+	}
+
+	cartoSvc.postprocessingTasks = cartoSvc.postprocessingTasks[:len(cartoSvc.postprocessingTasks)-1]
+	return map[string]interface{}{postprocess.UndoCommand: SuccessMessage}, nil
+}
+
+func (cartoSvc *CartographerService) doPostprocessPath(ctx context.Context, val interface{}) (map[string]interface{}, error) {
+	path, err := decodeDoCommandArg[string](val)
+	if err != nil {
+		return nil, invalidArgument(errors.Wrap(ErrBadPostprocessingPath, err.Error()))
+	}
+	if path == "" {
+		return nil, invalidArgument(ErrBadPostprocessingPath)
+	}
+
+	path = filepath.Clean(path)
+	bytes, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	cartoSvc.mu.Lock()
+	cartoSvc.postprocessedPointCloud = &bytes
+	cartoSvc.mu.Unlock()
+	cartoSvc.postprocessed.Store(true)
+	return map[string]interface{}{postprocess.PathCommand: SuccessMessage}, nil
+}
@@ -0,0 +1,1649 @@
+package viamcartographer
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"image/color"
+	"image/png"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/geo/r2"
+	"github.com/golang/geo/r3"
+	"github.com/pkg/errors"
+	viamgrpc "go.viam.com/rdk/grpc"
+	"go.viam.com/rdk/logging"
+	"go.viam.com/rdk/pointcloud"
+	"go.viam.com/rdk/resource"
+	"go.viam.com/rdk/services/slam"
+	"go.viam.com/rdk/spatialmath"
+	"go.viam.com/test"
+	"go.viam.com/utils/artifact"
+
+	"github.com/viam-modules/viam-cartographer/cartofacade"
+	"github.com/viam-modules/viam-cartographer/postprocess"
+	"github.com/viam-modules/viam-cartographer/sensorprocess"
+	s "github.com/viam-modules/viam-cartographer/sensors"
+	"github.com/viam-modules/viam-cartographer/sensors/inject"
+	"github.com/viam-modules/viam-cartographer/testhelper/pcdtest"
+)
+
+func TestGetAlgoConfigCommand(t *testing.T) {
+	logger := logging.NewTestLogger(t)
+	mockCartoFacade := &cartofacade.Mock{}
+	svc := newTestService(mockCartoFacade, logger)
+	svc.requestedAlgoConfig = defaultCartoAlgoCfg
+
+	t.Run("returns the requested and applied algo config as separate sections", func(t *testing.T) {
+		applied := defaultCartoAlgoCfg
+		applied.NumRangeData = 100
+		mockCartoFacade.AlgoConfigFunc = func(
+			ctx context.Context,
+			timeout time.Duration,
+		) (cartofacade.CartoAlgoConfig, error) {
+			return applied, nil
+		}
+
+		resp, err := svc.DoCommand(context.Background(), map[string]interface{}{GetAlgoConfigCommand: ""})
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, resp, test.ShouldResemble, map[string]interface{}{
+			RequestedAlgoConfigKey: defaultCartoAlgoCfg.ToMap(),
+			AppliedAlgoConfigKey:   applied.ToMap(),
+		})
+		requested := resp[RequestedAlgoConfigKey].(map[string]interface{})
+		test.That(t, requested["num_range_data"], test.ShouldEqual, 30)
+	})
+
+	t.Run("returns an error when the cartofacade fails", func(t *testing.T) {
+		mockCartoFacade.AlgoConfigFunc = func(
+			ctx context.Context,
+			timeout time.Duration,
+		) (cartofacade.CartoAlgoConfig, error) {
+			return cartofacade.CartoAlgoConfig{}, errors.New("test")
+		}
+
+		resp, err := svc.DoCommand(context.Background(), map[string]interface{}{GetAlgoConfigCommand: ""})
+		test.That(t, err, test.ShouldBeError, errors.New("test"))
+		test.That(t, resp, test.ShouldBeNil)
+	})
+}
+
+func TestSetMappingBoundsCommand(t *testing.T) {
+	logger := logging.NewTestLogger(t)
+	mockCartoFacade := &cartofacade.Mock{}
+	svc := newTestService(mockCartoFacade, logger)
+
+	// map straddling the +x boundary of a 2m x 2m box
+	setMockPointCloudFunc(mockCartoFacade, pcdtest.PointsToPCD(t, []r3.Vector{{X: 500}, {X: 1000}, {X: 1500}}))
+
+	pointCloudMapSize := func(t *testing.T) int {
+		callback, err := svc.PointCloudMap(context.Background(), false)
+		test.That(t, err, test.ShouldBeNil)
+		pcd, err := slam.HelperConcatenateChunksToFull(callback)
+		test.That(t, err, test.ShouldBeNil)
+		pc, err := pointcloud.ReadPCD(bytes.NewReader(pcd))
+		test.That(t, err, test.ShouldBeNil)
+		return pc.Size()
+	}
+
+	t.Run("sets mapping bounds that optionally clip the pointcloud map", func(t *testing.T) {
+		bounds := map[string]interface{}{"min_x": -1000.0, "min_y": -1000.0, "max_x": 1000.0, "max_y": 1000.0}
+		resp, err := svc.DoCommand(context.Background(), map[string]interface{}{SetMappingBoundsCommand: bounds})
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, resp, test.ShouldResemble, map[string]interface{}{SetMappingBoundsCommand: SuccessMessage})
+		test.That(t, svc.mappingBounds.Load(), test.ShouldNotBeNil)
+		test.That(t, svc.mappingBounds.Load().Contains(r2.Point{X: 1000, Y: 0}), test.ShouldBeTrue)
+		test.That(t, pointCloudMapSize(t), test.ShouldEqual, 3)
+
+		bounds["clip_point_cloud_map"] = true
+		_, err = svc.DoCommand(context.Background(), map[string]interface{}{SetMappingBoundsCommand: bounds})
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, pointCloudMapSize(t), test.ShouldEqual, 2)
+	})
+
+	t.Run("clears mapping bounds when nil is sent", func(t *testing.T) {
+		resp, err := svc.DoCommand(context.Background(), map[string]interface{}{SetMappingBoundsCommand: nil})
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, resp, test.ShouldResemble, map[string]interface{}{SetMappingBoundsCommand: SuccessMessage})
+		test.That(t, svc.mappingBounds.Load(), test.ShouldBeNil)
+		test.That(t, pointCloudMapSize(t), test.ShouldEqual, 3)
+	})
+
+	t.Run("returns an error and keeps the current mapping bounds when the format is invalid", func(t *testing.T) {
+		polygon := []interface{}{
+			map[string]interface{}{"x": 0.0, "y": 0.0},
+			map[string]interface{}{"x": 1000.0, "y": 0.0},
+			map[string]interface{}{"x": 0.0, "y": 1000.0},
+		}
+		_, err := svc.DoCommand(context.Background(),
+			map[string]interface{}{SetMappingBoundsCommand: map[string]interface{}{"polygon": polygon}})
+		test.That(t, err, test.ShouldBeNil)
+		current := svc.mappingBounds.Load()
+
+		for _, invalid := range []interface{}{
+			"not bounds",
+			map[string]interface{}{"min_x": -1000.0, "max_x": 1000.0},
+			map[string]interface{}{"polygon": polygon[:2]},
+			map[string]interface{}{"polygon": []interface{}{polygon[0], polygon[0], polygon[0]}},
+		} {
+			resp, err := svc.DoCommand(context.Background(), map[string]interface{}{SetMappingBoundsCommand: invalid})
+			test.That(t, err, test.ShouldWrap, ErrBadMappingBoundsFormat)
+			test.That(t, resp, test.ShouldBeNil)
+			test.That(t, svc.mappingBounds.Load(), test.ShouldEqual, current)
+		}
+	})
+}
+
+func TestSessionStartTime(t *testing.T) {
+	logger := logging.NewTestLogger(t)
+	svc := newTestService(&cartofacade.Mock{}, logger)
+
+	t.Run("is not reported when timestamps are not rebased", func(t *testing.T) {
+		resp, err := svc.DoCommand(context.Background(), map[string]interface{}{JobDoneCommand: ""})
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, resp, test.ShouldResemble, map[string]interface{}{JobDoneCommand: false, "cause": "online"})
+
+		resp, err = svc.DoCommand(context.Background(), map[string]interface{}{GetSessionStartTimeCommand: ""})
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, resp, test.ShouldBeEmpty)
+	})
+
+	svc.sessionClock = &sensorprocess.SessionClock{}
+
+	t.Run("is not reported before the first reading", func(t *testing.T) {
+		resp, err := svc.DoCommand(context.Background(), map[string]interface{}{GetSessionStartTimeCommand: ""})
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, resp, test.ShouldBeEmpty)
+	})
+
+	t.Run("is reported in the job summary once the first reading was rebased", func(t *testing.T) {
+		startTime := time.Date(2024, 1, 2, 3, 4, 5, 6, time.UTC)
+		svc.sessionClock.Rebase(startTime)
+
+		resp, err := svc.DoCommand(context.Background(), map[string]interface{}{JobDoneCommand: ""})
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, resp, test.ShouldResemble, map[string]interface{}{
+			JobDoneCommand:      false,
+			"cause":             "online",
+			SessionStartTimeKey: "2024-01-02T03:04:05.000000006Z",
+		})
+
+		resp, err = svc.DoCommand(context.Background(), map[string]interface{}{GetSessionStartTimeCommand: ""})
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, resp, test.ShouldResemble, map[string]interface{}{SessionStartTimeKey: "2024-01-02T03:04:05.000000006Z"})
+	})
+}
+
+func TestJobProgressCommand(t *testing.T) {
+	svc := newTestService(&cartofacade.Mock{}, logging.NewTestLogger(t))
+
+	t.Run("job_progress fails in online mode", func(t *testing.T) {
+		_, err := svc.DoCommand(context.Background(), map[string]interface{}{JobProgressCommand: nil})
+		test.That(t, err, test.ShouldBeError, ErrJobProgressOnline)
+	})
+
+	t.Run("job_progress reports the progress of the offline sensor process", func(t *testing.T) {
+		svc.jobSummary = &sensorprocess.JobSummary{ExpectedLidarReadings: 200}
+		resp, err := svc.DoCommand(context.Background(), map[string]interface{}{JobProgressCommand: nil})
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, resp, test.ShouldResemble, map[string]interface{}{
+			JobDoneCommand:                           false,
+			"num_lidar_readings_processed":           int64(0),
+			"num_movement_sensor_readings_processed": int64(0),
+			"elapsed_sec":                            0.0,
+			"expected_lidar_readings":                200,
+			"percent":                                0.0,
+		})
+
+		svc.jobDone.Store(true)
+		resp, err = svc.DoCommand(context.Background(), map[string]interface{}{JobProgressCommand: nil})
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, resp[JobDoneCommand], test.ShouldBeTrue)
+	})
+}
+
+func TestJobSummary(t *testing.T) {
+	logger := logging.NewTestLogger(t)
+	svc := newTestService(&cartofacade.Mock{}, logger)
+	svc.jobSummary = &sensorprocess.JobSummary{}
+
+	t.Run("job_done reports the progress while the offline sensor process is running", func(t *testing.T) {
+		resp, err := svc.DoCommand(context.Background(), map[string]interface{}{JobDoneCommand: ""})
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, resp, test.ShouldResemble, map[string]interface{}{
+			JobDoneCommand:               false,
+			"cancelled":                  false,
+			"num_lidar_readings":         int64(0),
+			"num_imu_readings":           int64(0),
+			"num_odometer_readings":      int64(0),
+			"num_skipped_lidar_readings": int64(0),
+			"num_rejected_readings":      int64(0),
+			"skip_final_optimization":    false,
+		})
+	})
+
+	t.Run("job_done reports the settings of the final optimization", func(t *testing.T) {
+		svc.jobSummary = &sensorprocess.JobSummary{SkipFinalOptimization: true, FinalOptimizationIterations: 20}
+		defer func() { svc.jobSummary = &sensorprocess.JobSummary{} }()
+		resp, err := svc.DoCommand(context.Background(), map[string]interface{}{JobDoneCommand: ""})
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, resp["skip_final_optimization"], test.ShouldBeTrue)
+		test.That(t, resp["final_optimization_iterations"], test.ShouldEqual, 20)
+	})
+
+	t.Run("job_done reports why and when the offline sensor process finished", func(t *testing.T) {
+		svc.jobResult.Store(&sensorprocess.OfflineJobResult{
+			JobDone:                    true,
+			Cause:                      sensorprocess.CauseMovementSensorEnded,
+			CompletedAt:                time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+			FinalOptimizationSucceeded: true,
+		})
+		svc.jobDone.Store(true)
+
+		resp, err := svc.DoCommand(context.Background(), map[string]interface{}{JobDoneCommand: ""})
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, resp, test.ShouldResemble, map[string]interface{}{
+			JobDoneCommand:                 true,
+			"cancelled":                    false,
+			"num_lidar_readings":           int64(0),
+			"num_imu_readings":             int64(0),
+			"num_odometer_readings":        int64(0),
+			"num_skipped_lidar_readings":   int64(0),
+			"num_rejected_readings":        int64(0),
+			"skip_final_optimization":      false,
+			"cause":                        "movement_sensor_ended",
+			"completed_at":                 "2024-01-02T03:04:05Z",
+			"final_optimization_succeeded": true,
+		})
+	})
+}
+
+func TestStartNewTrajectory(t *testing.T) {
+	logger := logging.NewTestLogger(t)
+	mockCartoFacade := &cartofacade.Mock{}
+	svc := newTestService(mockCartoFacade, logger)
+	svc.cartoLib = &cartofacade.CartoLibMock{LogLevelFunc: func() (int, int) { return 1, 0 }}
+	svc.cartoFacadeTimeout = 5 * time.Second
+
+	// two sessions: the first trajectory is frozen once the second one is started
+	trajectories := []cartofacade.Trajectory{{ID: 0, State: cartofacade.TrajectoryActive}}
+	var receivedPoses []*cartofacade.TrajectoryPose
+	mockCartoFacade.StartNewTrajectoryFunc = func(
+		ctx context.Context,
+		timeout time.Duration,
+		initialPose *cartofacade.TrajectoryPose,
+	) (cartofacade.NewTrajectory, error) {
+		receivedPoses = append(receivedPoses, initialPose)
+		finished := len(trajectories) - 1
+		trajectories[finished].State = cartofacade.TrajectoryFrozen
+		trajectories = append(trajectories, cartofacade.Trajectory{ID: finished + 1, State: cartofacade.TrajectoryActive})
+		return cartofacade.NewTrajectory{FinishedTrajectoryID: finished, TrajectoryID: finished + 1}, nil
+	}
+	mockCartoFacade.TrajectoriesFunc = func(ctx context.Context, timeout time.Duration) ([]cartofacade.Trajectory, error) {
+		return trajectories, nil
+	}
+	mockCartoFacade.UnresponsiveFunc = func() bool { return false }
+
+	t.Run("starts a new trajectory without an initial pose", func(t *testing.T) {
+		resp, err := svc.DoCommand(context.Background(), map[string]interface{}{StartNewTrajectoryCommand: nil})
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, resp, test.ShouldResemble, map[string]interface{}{
+			StartNewTrajectoryCommand: SuccessMessage,
+			FinishedTrajectoryIDKey:   0,
+			TrajectoryIDKey:           1,
+		})
+		test.That(t, receivedPoses, test.ShouldResemble, []*cartofacade.TrajectoryPose{nil})
+
+		resp, err = svc.DoCommand(context.Background(), map[string]interface{}{StatusCommand: ""})
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, resp[TrajectoriesKey], test.ShouldResemble, []interface{}{
+			map[string]interface{}{"id": 0, "state": "frozen"},
+			map[string]interface{}{"id": 1, "state": "active"},
+		})
+	})
+
+	t.Run("starts a new trajectory at an initial pose", func(t *testing.T) {
+		resp, err := svc.DoCommand(context.Background(), map[string]interface{}{
+			StartNewTrajectoryCommand: map[string]interface{}{"x": 1.0, "y": 2.0, "theta": 90.0},
+		})
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, resp[TrajectoryIDKey], test.ShouldEqual, 2)
+		test.That(t, receivedPoses[1], test.ShouldResemble, &cartofacade.TrajectoryPose{X: 1, Y: 2, Theta: 90})
+	})
+
+	t.Run("fails for an invalid initial pose", func(t *testing.T) {
+		for _, val := range []interface{}{"X:1, Y:2, Theta:3", map[string]interface{}{"x": 1.0, "y": 2.0}} {
+			resp, err := svc.DoCommand(context.Background(), map[string]interface{}{StartNewTrajectoryCommand: val})
+			test.That(t, errors.Is(err, ErrBadTrajectoryPoseFormat), test.ShouldBeTrue)
+			test.That(t, resp, test.ShouldBeNil)
+		}
+		test.That(t, len(receivedPoses), test.ShouldEqual, 2)
+	})
+
+	t.Run("returns the error of the cartofacade", func(t *testing.T) {
+		expectedErr := errors.New("VIAM_CARTO_NOT_IN_IO_INITIALIZED_STATE")
+		mockCartoFacade.StartNewTrajectoryFunc = func(
+			ctx context.Context,
+			timeout time.Duration,
+			initialPose *cartofacade.TrajectoryPose,
+		) (cartofacade.NewTrajectory, error) {
+			return cartofacade.NewTrajectory{}, expectedErr
+		}
+		resp, err := svc.DoCommand(context.Background(), map[string]interface{}{StartNewTrajectoryCommand: nil})
+		test.That(t, err, test.ShouldBeError, expectedErr)
+		test.That(t, resp, test.ShouldBeNil)
+	})
+}
+
+func TestSetLogLevelCommand(t *testing.T) {
+	logger := logging.NewTestLogger(t)
+	minloglevel, vlog := 1, 0
+	mockCartoLib := &cartofacade.CartoLibMock{}
+	mockCartoLib.LogLevelFunc = func() (int, int) { return minloglevel, vlog }
+	mockCartoLib.SetLogLevelFunc = func(newMinloglevel, newVlog int) error {
+		minloglevel, vlog = newMinloglevel, newVlog
+		return nil
+	}
+	mockCartoFacade := &cartofacade.Mock{}
+	mockCartoFacade.UnresponsiveFunc = func() bool { return true }
+	svc := newTestService(mockCartoFacade, logger)
+	svc.cartoLib = mockCartoLib
+
+	t.Run("changes the glog levels and reports them in the status", func(t *testing.T) {
+		cases := []struct {
+			logLevel    string
+			minloglevel int
+			vlog        int
+		}{
+			{logLevel: LogLevelDebug, minloglevel: 0, vlog: 1},
+			{logLevel: LogLevelInfo, minloglevel: 0, vlog: 0},
+			{logLevel: LogLevelWarn, minloglevel: 1, vlog: 0},
+		}
+		for _, tc := range cases {
+			resp, err := svc.DoCommand(context.Background(), map[string]interface{}{SetLogLevelCommand: tc.logLevel})
+			test.That(t, err, test.ShouldBeNil)
+			test.That(t, resp, test.ShouldResemble, map[string]interface{}{SetLogLevelCommand: SuccessMessage})
+			test.That(t, minloglevel, test.ShouldEqual, tc.minloglevel)
+			test.That(t, vlog, test.ShouldEqual, tc.vlog)
+
+			resp, err = svc.DoCommand(context.Background(), map[string]interface{}{StatusCommand: ""})
+			test.That(t, err, test.ShouldBeNil)
+			test.That(t, resp[LogLevelKey], test.ShouldEqual, tc.logLevel)
+		}
+	})
+
+	t.Run("rejects invalid levels", func(t *testing.T) {
+		for _, val := range []interface{}{"verbose", "", 1} {
+			resp, err := svc.DoCommand(context.Background(), map[string]interface{}{SetLogLevelCommand: val})
+			test.That(t, errors.Is(err, ErrBadLogLevel), test.ShouldBeTrue)
+			test.That(t, err.Error(), test.ShouldStartWith, "invalid argument for "+SetLogLevelCommand+": ")
+			test.That(t, resp, test.ShouldBeNil)
+		}
+		test.That(t, minloglevel, test.ShouldEqual, 1)
+		test.That(t, vlog, test.ShouldEqual, 0)
+	})
+
+	t.Run("returns the error of the library", func(t *testing.T) {
+		expectedErr := errors.New("VIAM_CARTO_LIB_INVALID")
+		mockCartoLib.SetLogLevelFunc = func(int, int) error { return expectedErr }
+		resp, err := svc.DoCommand(context.Background(), map[string]interface{}{SetLogLevelCommand: LogLevelDebug})
+		test.That(t, err, test.ShouldBeError, expectedErr)
+		test.That(t, resp, test.ShouldBeNil)
+	})
+}
+
+func TestDroppedScansStatus(t *testing.T) {
+	logger := logging.NewTestLogger(t)
+	mockCartoFacade := &cartofacade.Mock{}
+	mockCartoFacade.UnresponsiveFunc = func() bool { return true }
+	svc := newTestService(mockCartoFacade, logger)
+	svc.cartoLib = &cartofacade.CartoLibMock{LogLevelFunc: func() (int, int) { return 0, 0 }}
+
+	t.Run("status omits the dropped scans when min_points_per_scan is not set", func(t *testing.T) {
+		resp, err := svc.DoCommand(context.Background(), map[string]interface{}{StatusCommand: ""})
+		test.That(t, err, test.ShouldBeNil)
+		_, ok := resp[DroppedScansKey]
+		test.That(t, ok, test.ShouldBeFalse)
+	})
+
+	t.Run("status reports the dropped scans when min_points_per_scan is set", func(t *testing.T) {
+		svc.scanFilter = &sensorprocess.ScanFilter{MinPointsPerScan: 10}
+		resp, err := svc.DoCommand(context.Background(), map[string]interface{}{StatusCommand: ""})
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, resp[DroppedScansKey], test.ShouldEqual, int64(0))
+	})
+}
+
+func TestMapOverlapMetrics(t *testing.T) {
+	mockCartoFacade := &cartofacade.Mock{}
+	mockCartoFacade.UnresponsiveFunc = func() bool { return true }
+	mockCartoFacade.DutyCycleFunc = func() (float64, bool) { return 0, false }
+	mockCartoFacade.MemoryUsageFunc = func() (uint64, bool) { return 0, false }
+	svc := newTestService(mockCartoFacade, logging.NewTestLogger(t))
+	svc.cartoLib = &cartofacade.CartoLibMock{LogLevelFunc: func() (int, int) { return 0, 0 }}
+
+	t.Run("status and sensor_metrics omit the map overlap unless updating an existing map", func(t *testing.T) {
+		for _, cmd := range []string{StatusCommand, SensorMetricsCommand} {
+			resp, err := svc.DoCommand(context.Background(), map[string]interface{}{cmd: nil})
+			test.That(t, err, test.ShouldBeNil)
+			test.That(t, resp, test.ShouldNotContainKey, MapOverlapKey)
+		}
+	})
+
+	t.Run("status and sensor_metrics report the map overlap when updating an existing map", func(t *testing.T) {
+		svc.mapOverlap = &sensorprocess.MapOverlap{Resolution: mapOverlapResolution, Window: mapOverlapWindow}
+		for _, cmd := range []string{StatusCommand, SensorMetricsCommand} {
+			resp, err := svc.DoCommand(context.Background(), map[string]interface{}{cmd: nil})
+			test.That(t, err, test.ShouldBeNil)
+			test.That(t, resp[MapOverlapKey], test.ShouldResemble, map[string]interface{}{"num_readings": int64(0)})
+		}
+	})
+}
+
+func TestSensorMetricsCommand(t *testing.T) {
+	svc := &CartographerService{
+		Named:  resource.NewName(slam.API, "test").AsNamed(),
+		logger: logging.NewTestLogger(t),
+	}
+	// sensorMetrics returns the sensor_metrics response without the memory usage, which is always present
+	sensorMetrics := func(t *testing.T) map[string]interface{} {
+		t.Helper()
+		resp, err := svc.DoCommand(context.Background(), map[string]interface{}{SensorMetricsCommand: ""})
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, resp[MemoryKey], test.ShouldNotBeNil)
+		delete(resp, MemoryKey)
+		return resp
+	}
+
+	t.Run("sensor_metrics is empty before the sensor processes start", func(t *testing.T) {
+		test.That(t, sensorMetrics(t), test.ShouldBeEmpty)
+	})
+
+	t.Run("sensor_metrics is empty until a reading is added", func(t *testing.T) {
+		svc.ingestionLatency = &sensorprocess.IngestionLatency{MaxP95: defaultMaxIngestionLatency}
+		test.That(t, sensorMetrics(t), test.ShouldBeEmpty)
+	})
+
+	t.Run("sensor_metrics holds the number of skipped empty lidar readings", func(t *testing.T) {
+		svc.emptyLidarReadings.Store(2)
+		test.That(t, sensorMetrics(t), test.ShouldResemble, map[string]interface{}{
+			sensorprocess.LidarSensor: map[string]interface{}{"empty_readings": int64(2)},
+		})
+	})
+
+	t.Run("sensor_metrics holds the duty cycle of the cartofacade worker", func(t *testing.T) {
+		svc.emptyLidarReadings.Store(0)
+		mockCartoFacade := &cartofacade.Mock{}
+		svc.cartofacade = mockCartoFacade
+		test.That(t, sensorMetrics(t), test.ShouldBeEmpty)
+
+		mockCartoFacade.DutyCycleFunc = func() (float64, bool) {
+			return 42, true
+		}
+		test.That(t, sensorMetrics(t), test.ShouldResemble, map[string]interface{}{
+			FacadeWorkerKey: map[string]interface{}{"duty_cycle_percent": 42.0},
+		})
+	})
+
+	t.Run("status and sensor_metrics hold the memory usage of cartographer and the go runtime", func(t *testing.T) {
+		mockCartoFacade := &cartofacade.Mock{}
+		mockCartoFacade.UnresponsiveFunc = func() bool { return true }
+		svc.cartofacade = mockCartoFacade
+		svc.cartoLib = &cartofacade.CartoLibMock{LogLevelFunc: func() (int, int) { return 0, 0 }}
+		defer func() { svc.cartoLib = nil }()
+		memory := func(t *testing.T, cmd string) map[string]interface{} {
+			t.Helper()
+			resp, err := svc.DoCommand(context.Background(), map[string]interface{}{cmd: ""})
+			test.That(t, err, test.ShouldBeNil)
+			memory, ok := resp[MemoryKey].(map[string]interface{})
+			test.That(t, ok, test.ShouldBeTrue)
+			test.That(t, memory["go_heap_alloc_bytes"], test.ShouldBeGreaterThan, 0)
+			test.That(t, memory["go_sys_bytes"], test.ShouldBeGreaterThan, 0)
+			return memory
+		}
+
+		for _, cmd := range []string{StatusCommand, SensorMetricsCommand} {
+			// the memory usage of a library that does not report it is unavailable
+			mockCartoFacade.MemoryUsageFunc = nil
+			resp := memory(t, cmd)
+			test.That(t, resp["cartographer_memory_available"], test.ShouldBeFalse)
+			test.That(t, resp, test.ShouldNotContainKey, "cartographer_allocated_bytes")
+
+			mockCartoFacade.MemoryUsageFunc = func() (uint64, bool) {
+				return 1234, true
+			}
+			resp = memory(t, cmd)
+			test.That(t, resp["cartographer_memory_available"], test.ShouldBeTrue)
+			test.That(t, resp["cartographer_allocated_bytes"], test.ShouldEqual, uint64(1234))
+		}
+	})
+
+	t.Run("sensor_metrics holds the last polled slam stats", func(t *testing.T) {
+		svc.cartofacade = &cartofacade.Mock{}
+		test.That(t, sensorMetrics(t), test.ShouldBeEmpty)
+
+		svc.handleSlamStats(cartofacade.SlamStats{NumNodes: 10, NumUnoptimizedNodes: 3, OldestUnoptimizedNodeAge: 2 * time.Second}, false)
+		test.That(t, sensorMetrics(t), test.ShouldResemble, map[string]interface{}{
+			SlamStatsCommand: map[string]interface{}{
+				"num_nodes":                       10,
+				"num_unoptimized_nodes":           3,
+				"oldest_unoptimized_node_age_sec": 2.0,
+			},
+		})
+	})
+}
+
+func TestSensorStatsCommand(t *testing.T) {
+	svc := &CartographerService{
+		Named:  resource.NewName(slam.API, "test").AsNamed(),
+		logger: logging.NewTestLogger(t),
+	}
+
+	t.Run("returns nothing before the sensor processes are started", func(t *testing.T) {
+		resp, err := svc.DoCommand(context.Background(), map[string]interface{}{SensorStatsCommand: nil})
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, resp, test.ShouldBeEmpty)
+	})
+
+	t.Run("returns the counters of every sensor and the offline stats in offline mode", func(t *testing.T) {
+		svc.sensorStats = &sensorprocess.SensorStats{}
+		resp, err := svc.DoCommand(context.Background(), map[string]interface{}{SensorStatsCommand: nil})
+		test.That(t, err, test.ShouldBeNil)
+		counters := map[string]interface{}{
+			"readings_attempted":   int64(0),
+			"readings_added":       int64(0),
+			"lock_errors":          int64(0),
+			"unknown_errors":       int64(0),
+			"buffer_dropped":       int64(0),
+			"out_of_order_dropped": int64(0),
+		}
+		test.That(t, resp, test.ShouldResemble, map[string]interface{}{
+			sensorprocess.LidarSensor:    counters,
+			sensorprocess.IMUSensor:      counters,
+			sensorprocess.OdometerSensor: counters,
+			"offline":                    map[string]interface{}{"readings_inserted": int64(0)},
+		})
+	})
+
+	t.Run("leaves out the offline stats in online mode", func(t *testing.T) {
+		svc.sensorStats = &sensorprocess.SensorStats{IsOnline: true}
+		resp, err := svc.DoCommand(context.Background(), map[string]interface{}{SensorStatsCommand: nil})
+		test.That(t, err, test.ShouldBeNil)
+		_, ok := resp["offline"]
+		test.That(t, ok, test.ShouldBeFalse)
+		test.That(t, resp, test.ShouldContainKey, sensorprocess.LidarSensor)
+	})
+}
+
+func TestSetModeCommand(t *testing.T) {
+	dataFrequencyHz := 5
+	lidar := &inject.TimedLidar{}
+	lidar.NameFunc = func() string { return "my-lidar" }
+	lidar.DataFrequencyHzFunc = func() int { return dataFrequencyHz }
+	var receivedModes []cartofacade.SlamMode
+	mockCartoFacade := &cartofacade.Mock{}
+	mockCartoFacade.SetSlamModeFunc = func(ctx context.Context, timeout time.Duration, mode cartofacade.SlamMode) error {
+		receivedModes = append(receivedModes, mode)
+		return nil
+	}
+	livePointCloud := []byte("live")
+	mockCartoFacade.PointCloudMapFunc = func(ctx context.Context, timeout time.Duration) ([]byte, error) {
+		return livePointCloud, nil
+	}
+	newSvc := func(existingMap string) *CartographerService {
+		receivedModes = nil
+		postprocessedPointCloud := []byte("postprocessed")
+		return &CartographerService{
+			Named:                   resource.NewName(slam.API, "test").AsNamed(),
+			logger:                  logging.NewTestLogger(t),
+			lidar:                   lidar,
+			cartofacade:             mockCartoFacade,
+			enableMapping:           true,
+			SlamMode:                cartofacade.MappingMode,
+			existingMap:             existingMap,
+			postprocessedPointCloud: &postprocessedPointCloud,
+		}
+	}
+	checkMappingMode := func(t *testing.T, svc *CartographerService, mappingMode slam.MappingMode) {
+		t.Helper()
+		props, err := svc.Properties(context.Background())
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, props.MappingMode, test.ShouldEqual, mappingMode)
+	}
+
+	t.Run("switches from mapping to localizing and back", func(t *testing.T) {
+		svc := newSvc("")
+		resp, err := svc.DoCommand(context.Background(), map[string]interface{}{SetModeCommand: ModeLocalize})
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, resp, test.ShouldResemble, map[string]interface{}{SetModeCommand: SuccessMessage})
+		test.That(t, svc.SlamMode, test.ShouldEqual, cartofacade.LocalizingMode)
+		checkMappingMode(t, svc, slam.MappingModeLocalizationOnly)
+
+		_, err = svc.DoCommand(context.Background(), map[string]interface{}{SetModeCommand: ModeMap})
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, svc.SlamMode, test.ShouldEqual, cartofacade.MappingMode)
+		checkMappingMode(t, svc, slam.MappingModeNewMap)
+		test.That(t, receivedModes, test.ShouldResemble, []cartofacade.SlamMode{cartofacade.LocalizingMode, cartofacade.MappingMode})
+	})
+
+	t.Run("switches between localizing against and updating an existing map", func(t *testing.T) {
+		svc := newSvc("map.pbstream")
+		opts := svc.pointCloudMapOptions(context.Background(), false)
+		opts.postprocessed = true
+		pc, err := svc.pointCloudMap(context.Background(), opts)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, pc, test.ShouldResemble, livePointCloud)
+
+		_, err = svc.DoCommand(context.Background(), map[string]interface{}{SetModeCommand: ModeLocalize})
+		test.That(t, err, test.ShouldBeNil)
+		checkMappingMode(t, svc, slam.MappingModeLocalizationOnly)
+		pc, err = svc.pointCloudMap(context.Background(), opts)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, pc, test.ShouldResemble, []byte("postprocessed"))
+
+		_, err = svc.DoCommand(context.Background(), map[string]interface{}{SetModeCommand: ModeMap})
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, svc.SlamMode, test.ShouldEqual, cartofacade.UpdatingMode)
+		checkMappingMode(t, svc, slam.MappingModeUpdateExistingMap)
+		pc, err = svc.pointCloudMap(context.Background(), opts)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, pc, test.ShouldResemble, livePointCloud)
+		test.That(t, receivedModes, test.ShouldResemble, []cartofacade.SlamMode{cartofacade.LocalizingMode, cartofacade.UpdatingMode})
+	})
+
+	t.Run("starts the map growth monitor in mapping mode and stops it in any other mode", func(t *testing.T) {
+		svc := newSvc("")
+		mapGrowthMonitorRunning := func() bool {
+			for _, w := range svc.workers.running() {
+				if w.name == "map_growth_monitor" {
+					return true
+				}
+			}
+			return false
+		}
+		sensorProcessCtx, cancelSensorProcessFunc := context.WithCancel(context.Background())
+		defer func() {
+			cancelSensorProcessFunc()
+			svc.sensorProcessWorkers.Wait()
+		}()
+		svc.resetMapGrowthMonitor(sensorProcessCtx, svc.SlamMode)
+		test.That(t, mapGrowthMonitorRunning(), test.ShouldBeTrue)
+
+		svc.mapStalled.Store(true)
+		_, err := svc.DoCommand(context.Background(), map[string]interface{}{SetModeCommand: ModeLocalize})
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, mapGrowthMonitorRunning(), test.ShouldBeFalse)
+		test.That(t, svc.mapStalled.Load(), test.ShouldBeFalse)
+
+		_, err = svc.DoCommand(context.Background(), map[string]interface{}{SetModeCommand: ModeMap})
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, mapGrowthMonitorRunning(), test.ShouldBeTrue)
+	})
+
+	t.Run("fails once the service is closed", func(t *testing.T) {
+		svc := newSvc("")
+		svc.closed = true
+		resp, err := svc.doSetMode(context.Background(), ModeLocalize)
+		test.That(t, err, test.ShouldBeError, ErrClosed)
+		test.That(t, resp, test.ShouldBeNil)
+		test.That(t, receivedModes, test.ShouldBeEmpty)
+	})
+
+	t.Run("fails for an invalid mode", func(t *testing.T) {
+		svc := newSvc("")
+		for _, val := range []interface{}{nil, "mapping", 1.0} {
+			resp, err := svc.DoCommand(context.Background(), map[string]interface{}{SetModeCommand: val})
+			test.That(t, errors.Is(err, ErrBadMode), test.ShouldBeTrue)
+			test.That(t, resp, test.ShouldBeNil)
+		}
+		test.That(t, receivedModes, test.ShouldBeEmpty)
+	})
+
+	t.Run("fails while the offline sensor process is running", func(t *testing.T) {
+		dataFrequencyHz = 0
+		defer func() { dataFrequencyHz = 5 }()
+		svc := newSvc("")
+		_, err := svc.DoCommand(context.Background(), map[string]interface{}{SetModeCommand: ModeLocalize})
+		test.That(t, errors.Is(err, ErrSetModeOffline), test.ShouldBeTrue)
+		test.That(t, receivedModes, test.ShouldBeEmpty)
+
+		svc.jobDone.Store(true)
+		_, err = svc.DoCommand(context.Background(), map[string]interface{}{SetModeCommand: ModeLocalize})
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, svc.SlamMode, test.ShouldEqual, cartofacade.LocalizingMode)
+	})
+
+	t.Run("keeps the mode if cartographer fails to switch", func(t *testing.T) {
+		svc := newSvc("")
+		expectedErr := errors.New("VIAM_CARTO_POINTCLOUD_MAP_EMPTY")
+		mockCartoFacade.SetSlamModeFunc = func(ctx context.Context, timeout time.Duration, mode cartofacade.SlamMode) error {
+			return expectedErr
+		}
+		_, err := svc.DoCommand(context.Background(), map[string]interface{}{SetModeCommand: ModeLocalize})
+		test.That(t, err, test.ShouldBeError, expectedErr)
+		test.That(t, svc.SlamMode, test.ShouldEqual, cartofacade.MappingMode)
+		checkMappingMode(t, svc, slam.MappingModeNewMap)
+	})
+}
+
+func TestRelocalizeCommand(t *testing.T) {
+	var receivedPoses []*cartofacade.TrajectoryPose
+	mockCartoFacade := &cartofacade.Mock{}
+	mockCartoFacade.RestartTrajectoryFunc = func(
+		ctx context.Context, timeout time.Duration, initialPose *cartofacade.TrajectoryPose,
+	) (cartofacade.RestartedTrajectory, error) {
+		receivedPoses = append(receivedPoses, initialPose)
+		return cartofacade.RestartedTrajectory{RestartedTrajectoryID: 1, TrajectoryID: 2}, nil
+	}
+	newSvc := func(enableMapping bool) *CartographerService {
+		receivedPoses = nil
+		slamMode := cartofacade.LocalizingMode
+		if enableMapping {
+			slamMode = cartofacade.MappingMode
+		}
+		return &CartographerService{
+			Named:         resource.NewName(slam.API, "test").AsNamed(),
+			logger:        logging.NewTestLogger(t),
+			cartofacade:   mockCartoFacade,
+			enableMapping: enableMapping,
+			SlamMode:      slamMode,
+		}
+	}
+
+	t.Run("restarts the localization trajectory at the pose hint", func(t *testing.T) {
+		svc := newSvc(false)
+		resp, err := svc.DoCommand(context.Background(), map[string]interface{}{
+			RelocalizeCommand: map[string]interface{}{"x": 1.5, "y": -2.0, "theta": 90.0},
+		})
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, resp, test.ShouldResemble, map[string]interface{}{
+			RelocalizeCommand:        SuccessMessage,
+			RestartedTrajectoryIDKey: 1,
+			TrajectoryIDKey:          2,
+		})
+		test.That(t, receivedPoses, test.ShouldResemble,
+			[]*cartofacade.TrajectoryPose{{X: 1.5, Y: -2, Theta: 90}})
+	})
+
+	t.Run("restarts the localization trajectory without a pose hint", func(t *testing.T) {
+		svc := newSvc(false)
+		_, err := svc.DoCommand(context.Background(), map[string]interface{}{RelocalizeCommand: nil})
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, receivedPoses, test.ShouldResemble, []*cartofacade.TrajectoryPose{nil})
+	})
+
+	t.Run("is rejected while mapping", func(t *testing.T) {
+		svc := newSvc(true)
+		_, err := svc.DoCommand(context.Background(), map[string]interface{}{RelocalizeCommand: nil})
+		test.That(t, err, test.ShouldBeError, ErrRelocalizeWhileMapping)
+		test.That(t, receivedPoses, test.ShouldBeEmpty)
+	})
+
+	t.Run("rejects an incomplete pose hint", func(t *testing.T) {
+		svc := newSvc(false)
+		_, err := svc.DoCommand(context.Background(), map[string]interface{}{
+			RelocalizeCommand: map[string]interface{}{"x": 1.5, "y": -2.0},
+		})
+		test.That(t, err, test.ShouldNotBeNil)
+		test.That(t, errors.Is(err, ErrBadTrajectoryPoseFormat), test.ShouldBeTrue)
+		test.That(t, receivedPoses, test.ShouldBeEmpty)
+	})
+
+	t.Run("returns the error of cartographer", func(t *testing.T) {
+		svc := newSvc(false)
+		mockCartoFacade.RestartTrajectoryFunc = func(
+			ctx context.Context, timeout time.Duration, initialPose *cartofacade.TrajectoryPose,
+		) (cartofacade.RestartedTrajectory, error) {
+			return cartofacade.RestartedTrajectory{}, cartofacade.ErrNotLocalizing
+		}
+		_, err := svc.DoCommand(context.Background(), map[string]interface{}{RelocalizeCommand: nil})
+		test.That(t, errors.Is(err, cartofacade.ErrNotLocalizing), test.ShouldBeTrue)
+	})
+}
+
+func TestSlamStatsCommand(t *testing.T) {
+	mockCartoFacade := &cartofacade.Mock{}
+	svc := newTestService(mockCartoFacade, logging.NewTestLogger(t))
+
+	t.Run("returns the slam stats of cartographer", func(t *testing.T) {
+		mockCartoFacade.SlamStatsFunc = func(ctx context.Context, timeout time.Duration) (cartofacade.SlamStats, error) {
+			return cartofacade.SlamStats{NumNodes: 42, NumUnoptimizedNodes: 5, OldestUnoptimizedNodeAge: 1500 * time.Millisecond}, nil
+		}
+		mockCartoFacade.TrajectoriesFunc = func(ctx context.Context, timeout time.Duration) ([]cartofacade.Trajectory, error) {
+			return []cartofacade.Trajectory{
+				{ID: 0, State: cartofacade.TrajectoryFrozen},
+				{ID: 1, State: cartofacade.TrajectoryActive},
+			}, nil
+		}
+		resp, err := svc.DoCommand(context.Background(), map[string]interface{}{SlamStatsCommand: ""})
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, resp, test.ShouldResemble, map[string]interface{}{
+			"num_nodes":                       42,
+			"num_unoptimized_nodes":           5,
+			"oldest_unoptimized_node_age_sec": 1.5,
+			TrajectoriesKey: []interface{}{
+				map[string]interface{}{"id": 0, "state": "frozen"},
+				map[string]interface{}{"id": 1, "state": "active"},
+			},
+		})
+	})
+
+	t.Run("returns an error when cartographer fails to return the slam stats", func(t *testing.T) {
+		mockCartoFacade.SlamStatsFunc = func(ctx context.Context, timeout time.Duration) (cartofacade.SlamStats, error) {
+			return cartofacade.SlamStats{}, errors.New("slam stats failed")
+		}
+		resp, err := svc.DoCommand(context.Background(), map[string]interface{}{SlamStatsCommand: ""})
+		test.That(t, err, test.ShouldBeError, errors.New("slam stats failed"))
+		test.That(t, resp, test.ShouldBeNil)
+	})
+}
+
+func TestSensorResourcesStatus(t *testing.T) {
+	logger := logging.NewTestLogger(t)
+	ctx := context.Background()
+	mockCartoFacade := &cartofacade.Mock{}
+	mockCartoFacade.UnresponsiveFunc = func() bool { return true }
+	newService := func(lidar s.TimedLidar, movementSensor s.TimedMovementSensor) *CartographerService {
+		return &CartographerService{
+			Named:          resource.NewName(slam.API, "test").AsNamed(),
+			SlamMode:       cartofacade.MappingMode,
+			cartoLib:       &cartofacade.CartoLibMock{LogLevelFunc: func() (int, int) { return 0, 0 }},
+			cartofacade:    mockCartoFacade,
+			logger:         logger,
+			lidar:          lidar,
+			movementSensor: movementSensor,
+		}
+	}
+	sensorResources := func(svc *CartographerService) map[string]interface{} {
+		resp, err := svc.DoCommand(ctx, map[string]interface{}{StatusCommand: ""})
+		test.That(t, err, test.ShouldBeNil)
+		sensorResources, ok := resp[SensorResourcesKey].(map[string]interface{})
+		test.That(t, ok, test.ShouldBeTrue)
+		return sensorResources
+	}
+
+	t.Run("a config with both sensors lists the resources of the lidar and the movement sensor", func(t *testing.T) {
+		deps := s.SetupDeps(s.GoodLidar, s.GoodMovementSensorBothIMUAndOdometer)
+		lidar, err := s.NewLidar(ctx, deps, string(s.GoodLidar), 5, logger)
+		test.That(t, err, test.ShouldBeNil)
+		// the sensors are wrapped as in New
+		lidar = s.NewCalibratedLidar(lidar, spatialmath.NewPoseFromPoint(r3.Vector{X: 100}), 0)
+		movementSensor, err := s.NewMovementSensor(ctx, deps, string(s.GoodMovementSensorBothIMUAndOdometer), 20,
+			s.DegreesPerSecond, logger)
+		test.That(t, err, test.ShouldBeNil)
+		movementSensor = s.NewCalibratedMovementSensor(movementSensor, nil, 10*time.Millisecond)
+		svc := newService(lidar, movementSensor)
+
+		before := time.Now()
+		_, err = lidar.TimedLidarReading(ctx)
+		test.That(t, err, test.ShouldBeNil)
+		_, err = movementSensor.TimedMovementSensorReading(ctx)
+		test.That(t, err, test.ShouldBeNil)
+
+		resources := sensorResources(svc)
+		lidarResource, ok := resources["lidar"].(map[string]interface{})
+		test.That(t, ok, test.ShouldBeTrue)
+		test.That(t, lidarResource["name"], test.ShouldEqual, "rdk:component:camera/good_lidar")
+		test.That(t, lidarResource["startup_checks"], test.ShouldResemble, []string{"Properties", "SupportsPCD", "NextPointCloud"})
+		lastSuccessfulReadAt, err := time.Parse(time.RFC3339Nano, lidarResource["last_successful_read_at"].(string))
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, lastSuccessfulReadAt.Before(before), test.ShouldBeFalse)
+		test.That(t, lidarResource, test.ShouldNotContainKey, "last_error")
+
+		movementSensorResource, ok := resources["movement_sensor"].(map[string]interface{})
+		test.That(t, ok, test.ShouldBeTrue)
+		test.That(t, movementSensorResource["name"], test.ShouldEqual,
+			"rdk:component:movement_sensor/good_movement_sensor_imu_and_odometer")
+		test.That(t, movementSensorResource["startup_checks"], test.ShouldResemble,
+			[]string{"Properties", "IMUSupported", "OdometerSupported"})
+		test.That(t, movementSensorResource, test.ShouldContainKey, "last_successful_read_at")
+		test.That(t, movementSensorResource, test.ShouldNotContainKey, "last_error")
+	})
+
+	t.Run("a lidar only config lists the resource of the lidar with its last error", func(t *testing.T) {
+		deps := s.SetupDeps(s.LidarWithErroringFunctions, s.NoMovementSensor)
+		lidar, err := s.NewLidar(ctx, deps, string(s.LidarWithErroringFunctions), 5, logger)
+		test.That(t, err, test.ShouldBeNil)
+		svc := newService(lidar, nil)
+
+		_, err = lidar.TimedLidarReading(ctx)
+		test.That(t, err, test.ShouldNotBeNil)
+
+		resources := sensorResources(svc)
+		test.That(t, resources, test.ShouldNotContainKey, "movement_sensor")
+		lidarResource, ok := resources["lidar"].(map[string]interface{})
+		test.That(t, ok, test.ShouldBeTrue)
+		test.That(t, lidarResource["name"], test.ShouldEqual, "rdk:component:camera/lidar_with_erroring_functions")
+		test.That(t, lidarResource["startup_checks"], test.ShouldResemble, []string{"Properties", "SupportsPCD"})
+		test.That(t, lidarResource, test.ShouldNotContainKey, "last_successful_read_at")
+		test.That(t, lidarResource["last_error"], test.ShouldEqual, err.Error())
+		test.That(t, lidarResource, test.ShouldContainKey, "last_error_at")
+	})
+
+	t.Run("status omits the sensor resources of sensors that do not read from a resource", func(t *testing.T) {
+		resp, err := newService(&inject.TimedLidar{}, nil).DoCommand(ctx, map[string]interface{}{StatusCommand: ""})
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, resp, test.ShouldNotContainKey, SensorResourcesKey)
+	})
+}
+
+func TestChangeHeatmapCommand(t *testing.T) {
+	mockCartoFacade := &cartofacade.Mock{}
+	svc := newTestService(mockCartoFacade, logging.NewTestLogger(t))
+	svc.cartoFacadeTimeout = 5 * time.Second
+
+	t.Run("change_heatmap fails without change_detection", func(t *testing.T) {
+		resp, err := svc.DoCommand(context.Background(), map[string]interface{}{ChangeHeatmapCommand: nil})
+		test.That(t, err, test.ShouldBeError, ErrChangeDetectionNotEnabled)
+		test.That(t, resp, test.ShouldBeNil)
+	})
+
+	svc.changeDetector = &sensorprocess.ChangeDetector{Resolution: changeDetectionResolution}
+
+	t.Run("change_heatmap fails until cartographer's map is loaded", func(t *testing.T) {
+		resp, err := svc.DoCommand(context.Background(), map[string]interface{}{ChangeHeatmapCommand: nil})
+		test.That(t, err, test.ShouldBeError, sensorprocess.ErrChangeDetectionMapNotLoaded)
+		test.That(t, resp, test.ShouldBeNil)
+	})
+
+	var points []r3.Vector
+	for x := 0.0; x <= 1000; x += 50 {
+		points = append(points, r3.Vector{X: x})
+	}
+	currentMap := pcdtest.PointsToPCD(t, points)
+	mockCartoFacade.PointCloudMapFunc = func(ctx context.Context, timeout time.Duration) ([]byte, error) {
+		return currentMap, nil
+	}
+	onPointCloudMapAvailable(context.Background(), svc, "change_detection_map_loader", svc.loadChangeDetectionMap)
+	svc.sensorProcessWorkers.Wait()
+
+	t.Run("change_heatmap returns an empty pointcloud by default before readings are compared", func(t *testing.T) {
+		for _, val := range []interface{}{nil, "", ChangeHeatmapFormatPCD} {
+			resp, err := svc.DoCommand(context.Background(), map[string]interface{}{ChangeHeatmapCommand: val})
+			test.That(t, err, test.ShouldBeNil)
+			test.That(t, resp["format"], test.ShouldEqual, ChangeHeatmapFormatPCD)
+			test.That(t, resp["num_scans"], test.ShouldEqual, 0)
+			test.That(t, resp["num_changed_cells"], test.ShouldEqual, 0)
+
+			heatmap, err := base64.StdEncoding.DecodeString(resp[ChangeHeatmapCommand].(string))
+			test.That(t, err, test.ShouldBeNil)
+			heatmapPC, err := pointcloud.ReadPCD(bytes.NewReader(heatmap))
+			test.That(t, err, test.ShouldBeNil)
+			test.That(t, heatmapPC.Size(), test.ShouldEqual, 0)
+		}
+	})
+
+	t.Run("change_heatmap returns an image covering the map", func(t *testing.T) {
+		resp, err := svc.DoCommand(context.Background(), map[string]interface{}{ChangeHeatmapCommand: ChangeHeatmapFormatPNG})
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, resp["format"], test.ShouldEqual, ChangeHeatmapFormatPNG)
+
+		heatmap, err := base64.StdEncoding.DecodeString(resp[ChangeHeatmapCommand].(string))
+		test.That(t, err, test.ShouldBeNil)
+		img, err := png.Decode(bytes.NewReader(heatmap))
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, img.Bounds().Dx(), test.ShouldBeGreaterThan, 1000/changeDetectionResolution)
+	})
+
+	t.Run("change_heatmap fails for an invalid format", func(t *testing.T) {
+		for _, val := range []interface{}{"jpg", 1} {
+			resp, err := svc.DoCommand(context.Background(), map[string]interface{}{ChangeHeatmapCommand: val})
+			test.That(t, errors.Is(err, ErrBadChangeHeatmapFormat), test.ShouldBeTrue)
+			test.That(t, err.Error(), test.ShouldStartWith, "invalid argument for "+ChangeHeatmapCommand+": ")
+			test.That(t, resp, test.ShouldBeNil)
+		}
+	})
+}
+
+func TestGetMapGeoJSONCommand(t *testing.T) {
+	// the walls of a room of 2x1 meters and, a meter apart, the corners of a smaller region of a lower probability
+	var points []r3.Vector
+	for x := 0.0; x < 2000; x += 100 {
+		points = append(points, r3.Vector{X: x, Y: 0}, r3.Vector{X: x, Y: 900})
+	}
+	for y := 0.0; y < 1000; y += 100 {
+		points = append(points, r3.Vector{X: 0, Y: y}, r3.Vector{X: 1900, Y: y})
+	}
+	lowProbabilityPoints := []r3.Vector{{X: 3000, Y: 0}, {X: 3400, Y: 400}, {X: 3000, Y: 400}, {X: 3400, Y: 0}}
+	var pointCloudMapErr error
+	mockCartoFacade := &cartofacade.Mock{}
+	mockCartoFacade.PointCloudMapFunc = func(ctx context.Context, timeout time.Duration) ([]byte, error) {
+		if pointCloudMapErr != nil {
+			return nil, pointCloudMapErr
+		}
+		pc := pointcloud.New()
+		for _, p := range points {
+			test.That(t, pc.Set(p, pointcloud.NewColoredData(color.NRGBA{B: 100})), test.ShouldBeNil)
+		}
+		for _, p := range lowProbabilityPoints {
+			test.That(t, pc.Set(p, pointcloud.NewColoredData(color.NRGBA{B: 10})), test.ShouldBeNil)
+		}
+		buf := new(bytes.Buffer)
+		test.That(t, pointcloud.ToPCD(pc, buf, pointcloud.PCDBinary), test.ShouldBeNil)
+		return buf.Bytes(), nil
+	}
+	svc := newTestService(mockCartoFacade, logging.NewTestLogger(t))
+	type featureCollection struct {
+		Type     string `json:"type"`
+		Features []struct {
+			Geometry struct {
+				Type        string         `json:"type"`
+				Coordinates [][][2]float64 `json:"coordinates"`
+			} `json:"geometry"`
+			Properties map[string]float64 `json:"properties"`
+		} `json:"features"`
+	}
+	getMapGeoJSON := func(val interface{}) (map[string]interface{}, featureCollection) {
+		resp, err := svc.DoCommand(context.Background(), map[string]interface{}{GetMapGeoJSONCommand: val})
+		test.That(t, err, test.ShouldBeNil)
+		var collection featureCollection
+		test.That(t, json.Unmarshal([]byte(resp[GetMapGeoJSONCommand].(string)), &collection), test.ShouldBeNil)
+		test.That(t, collection.Type, test.ShouldEqual, "FeatureCollection")
+		test.That(t, collection.Features, test.ShouldHaveLength, resp["num_polygons"])
+		return resp, collection
+	}
+
+	t.Run("get_map_geojson outlines every region of the map in millimeters, largest first", func(t *testing.T) {
+		resp, collection := getMapGeoJSON(nil)
+		test.That(t, resp["resolution"], test.ShouldEqual, 0.25)
+		test.That(t, resp["num_polygons"], test.ShouldEqual, 2)
+		for _, f := range collection.Features {
+			test.That(t, f.Geometry.Type, test.ShouldEqual, "Polygon")
+			test.That(t, f.Geometry.Coordinates, test.ShouldHaveLength, 1)
+		}
+		// the room is filled in
+		test.That(t, collection.Features[0].Geometry.Coordinates[0], test.ShouldResemble, [][2]float64{
+			{2000, 0}, {2000, 1000}, {0, 1000}, {0, 0}, {2000, 0},
+		})
+		test.That(t, collection.Features[0].Properties["area_mm2"], test.ShouldEqual, 2e6)
+		test.That(t, collection.Features[1].Geometry.Coordinates[0], test.ShouldResemble, [][2]float64{
+			{3500, 0}, {3500, 500}, {3000, 500}, {3000, 0}, {3500, 0},
+		})
+	})
+
+	t.Run("get_map_geojson takes the resolution in meters and the minimum probability", func(t *testing.T) {
+		resp, collection := getMapGeoJSON(map[string]interface{}{"resolution": 0.1})
+		test.That(t, resp["resolution"], test.ShouldEqual, 0.1)
+		// the corners of the smaller region no longer share a cell
+		test.That(t, resp["num_polygons"], test.ShouldEqual, 5)
+		test.That(t, collection.Features[0].Properties["area_mm2"], test.ShouldEqual, 2e6)
+
+		resp, collection = getMapGeoJSON(map[string]interface{}{"min_probability": 50})
+		test.That(t, resp["num_polygons"], test.ShouldEqual, 1)
+		test.That(t, collection.Features[0].Properties["area_mm2"], test.ShouldEqual, 2e6)
+	})
+
+	t.Run("get_map_geojson fails for an invalid request", func(t *testing.T) {
+		for _, val := range []interface{}{
+			"0.25",
+			map[string]interface{}{"resolution": 0},
+			map[string]interface{}{"resolution": -0.25},
+			map[string]interface{}{"min_probability": -1},
+			map[string]interface{}{"min_probability": 101},
+			map[string]interface{}{"min_probability": "50"},
+		} {
+			resp, err := svc.DoCommand(context.Background(), map[string]interface{}{GetMapGeoJSONCommand: val})
+			test.That(t, errors.Is(err, ErrBadMapGeoJSONRequest), test.ShouldBeTrue)
+			test.That(t, resp, test.ShouldBeNil)
+		}
+	})
+
+	t.Run("get_map_geojson returns no polygons for an empty map", func(t *testing.T) {
+		points, lowProbabilityPoints = nil, nil
+		resp, collection := getMapGeoJSON(nil)
+		test.That(t, resp["num_polygons"], test.ShouldEqual, 0)
+		test.That(t, collection.Features, test.ShouldBeEmpty)
+
+		pointCloudMapErr = cartofacade.ErrPointCloudMapEmpty
+		resp, collection = getMapGeoJSON(nil)
+		test.That(t, resp["num_polygons"], test.ShouldEqual, 0)
+		test.That(t, collection.Features, test.ShouldBeEmpty)
+	})
+}
+
+func TestWriteInternalStateToPathCommand(t *testing.T) {
+	internalState := []byte("internal state")
+	mockCartoFacade := &cartofacade.Mock{}
+	mockCartoFacade.InternalStateFunc = func(ctx context.Context, timeout time.Duration) ([]byte, error) {
+		return internalState, nil
+	}
+	svc := newTestService(mockCartoFacade, logging.NewTestLogger(t))
+	svc.cartoFacadeInternalTimeout = 5 * time.Second
+	svc.configHash = "0123abcd"
+	allowedDir := t.TempDir()
+	otherDir := t.TempDir()
+
+	t.Run("write_internal_state_to_path fails without internal_state_export_dirs", func(t *testing.T) {
+		resp, err := svc.DoCommand(context.Background(),
+			map[string]interface{}{WriteInternalStateToPathCommand: filepath.Join(allowedDir, "map.pbstream")})
+		test.That(t, err, test.ShouldBeError, ErrInternalStateExportNotConfigured)
+		test.That(t, resp, test.ShouldBeNil)
+	})
+
+	svc.internalStateExportDirs = []string{allowedDir}
+
+	t.Run("write_internal_state_to_path writes the internal state within an allowed directory", func(t *testing.T) {
+		path := filepath.Join(allowedDir, "map.pbstream")
+		resp, err := svc.DoCommand(context.Background(), map[string]interface{}{WriteInternalStateToPathCommand: path})
+		test.That(t, err, test.ShouldBeNil)
+		resolvedDir, err := filepath.EvalSymlinks(allowedDir)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, resp, test.ShouldResemble, map[string]interface{}{
+			"path":       filepath.Join(resolvedDir, "map.pbstream"),
+			"size_bytes": len(internalState),
+			// sha256 of "internal state"
+			"sha256":        "faa8ae48494657f00dd93486a0fbc9f0379a20c52740c9db274f51d91d2625ce",
+			"metadata_path": filepath.Join(resolvedDir, "map.pbstream.metadata.json"),
+		})
+
+		written, err := os.ReadFile(path)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, written, test.ShouldResemble, internalState)
+	})
+
+	t.Run("write_internal_state_to_path writes the metadata of the internal state next to it", func(t *testing.T) {
+		written, err := os.ReadFile(filepath.Join(allowedDir, "map.pbstream"+internalStateMetadataSuffix))
+		test.That(t, err, test.ShouldBeNil)
+		var metadata map[string]interface{}
+		test.That(t, json.Unmarshal(written, &metadata), test.ShouldBeNil)
+		test.That(t, metadata, test.ShouldResemble, map[string]interface{}{
+			"size_bytes":     float64(len(internalState)),
+			"sha256":         "faa8ae48494657f00dd93486a0fbc9f0379a20c52740c9db274f51d91d2625ce",
+			ModuleVersionKey: ModuleVersion,
+			ConfigHashKey:    "0123abcd",
+		})
+	})
+
+	t.Run("write_internal_state_to_path rejects paths outside the allowed directories", func(t *testing.T) {
+		test.That(t, os.Symlink(otherDir, filepath.Join(allowedDir, "link")), test.ShouldBeNil)
+		for _, path := range []string{
+			filepath.Join(otherDir, "map.pbstream"),
+			filepath.Join(allowedDir, "..", filepath.Base(otherDir), "map.pbstream"),
+			filepath.Join(allowedDir, "link", "map.pbstream"),
+			allowedDir,
+		} {
+			resp, err := svc.DoCommand(context.Background(), map[string]interface{}{WriteInternalStateToPathCommand: path})
+			test.That(t, errors.Is(err, ErrInternalStatePathNotAllowed), test.ShouldBeTrue)
+			test.That(t, resp, test.ShouldBeNil)
+		}
+		entries, err := os.ReadDir(otherDir)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, entries, test.ShouldBeEmpty)
+	})
+
+	t.Run("write_internal_state_to_path fails for a directory that does not exist", func(t *testing.T) {
+		missingDir := filepath.Join(allowedDir, "missing")
+		resp, err := svc.DoCommand(context.Background(),
+			map[string]interface{}{WriteInternalStateToPathCommand: filepath.Join(missingDir, "map.pbstream")})
+		test.That(t, err, test.ShouldBeError, errors.Wrap(ErrInternalStateDirNotFound, missingDir))
+		test.That(t, resp, test.ShouldBeNil)
+		_, err = os.Stat(missingDir)
+		test.That(t, os.IsNotExist(err), test.ShouldBeTrue)
+	})
+
+	t.Run("write_internal_state_to_path fails for a path that is not absolute", func(t *testing.T) {
+		for _, val := range []interface{}{"map.pbstream", 1} {
+			resp, err := svc.DoCommand(context.Background(), map[string]interface{}{WriteInternalStateToPathCommand: val})
+			test.That(t, errors.Is(err, ErrBadInternalStatePath), test.ShouldBeTrue)
+			test.That(t, err.Error(), test.ShouldStartWith, "invalid argument for "+WriteInternalStateToPathCommand+": ")
+			test.That(t, resp, test.ShouldBeNil)
+		}
+	})
+
+	t.Run("concurrent write_internal_state_to_path calls write complete files", func(t *testing.T) {
+		paths := []string{
+			filepath.Join(allowedDir, "concurrent.pbstream"),
+			filepath.Join(allowedDir, "concurrent.pbstream"),
+			filepath.Join(allowedDir, "concurrent_1.pbstream"),
+			filepath.Join(allowedDir, "concurrent_2.pbstream"),
+		}
+		errs := make(chan error, len(paths))
+		for _, path := range paths {
+			go func(path string) {
+				_, err := svc.DoCommand(context.Background(), map[string]interface{}{WriteInternalStateToPathCommand: path})
+				errs <- err
+			}(path)
+		}
+		for range paths {
+			test.That(t, <-errs, test.ShouldBeNil)
+		}
+		for _, path := range paths {
+			written, err := os.ReadFile(path)
+			test.That(t, err, test.ShouldBeNil)
+			test.That(t, written, test.ShouldResemble, internalState)
+		}
+		tmpFiles, err := filepath.Glob(filepath.Join(allowedDir, "*.tmp"))
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, tmpFiles, test.ShouldBeEmpty)
+	})
+
+	t.Run("write_internal_state_to_path fails when closed", func(t *testing.T) {
+		svc.closed = true
+		defer func() { svc.closed = false }()
+		resp, err := svc.DoCommand(context.Background(),
+			map[string]interface{}{WriteInternalStateToPathCommand: filepath.Join(allowedDir, "closed.pbstream")})
+		test.That(t, err, test.ShouldBeError, ErrClosed)
+		test.That(t, resp, test.ShouldBeNil)
+	})
+}
+
+func TestShadowCommands(t *testing.T) {
+	logger := logging.NewTestLogger(t)
+	primary := &cartofacade.Mock{}
+	shadow := &cartofacade.Mock{}
+	svc := newTestService(primary, logger)
+	svc.cartoFacadeTimeout = 5 * time.Second
+
+	t.Run("shadow commands fail without shadow_config", func(t *testing.T) {
+		resp, err := svc.DoCommand(context.Background(), map[string]interface{}{ShadowPositionCommand: ""})
+		test.That(t, err, test.ShouldBeError, ErrShadowNotConfigured)
+		test.That(t, resp, test.ShouldBeNil)
+
+		resp, err = svc.DoCommand(context.Background(), map[string]interface{}{ShadowMapInfoCommand: ""})
+		test.That(t, err, test.ShouldBeError, ErrShadowNotConfigured)
+		test.That(t, resp, test.ShouldBeNil)
+	})
+
+	svc.shadowCartofacade = shadow
+
+	t.Run("shadow_position returns the positions of the primary and the shadow", func(t *testing.T) {
+		primary.PositionFunc = func(ctx context.Context, timeout time.Duration) (cartofacade.Position, error) {
+			return cartofacade.Position{X: 1, Y: 2, Real: 1}, nil
+		}
+		shadow.PositionFunc = func(ctx context.Context, timeout time.Duration) (cartofacade.Position, error) {
+			return cartofacade.Position{X: 1.5, Y: 2.5, Real: 1}, nil
+		}
+		resp, err := svc.DoCommand(context.Background(), map[string]interface{}{ShadowPositionCommand: ""})
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, resp, test.ShouldResemble, map[string]interface{}{
+			PrimaryKey: map[string]interface{}{"x": 1.0, "y": 2.0, "z": 0.0, "real": 1.0, "imag": 0.0, "jmag": 0.0, "kmag": 0.0},
+			ShadowKey:  map[string]interface{}{"x": 1.5, "y": 2.5, "z": 0.0, "real": 1.0, "imag": 0.0, "jmag": 0.0, "kmag": 0.0},
+		})
+
+		shadow.PositionFunc = func(ctx context.Context, timeout time.Duration) (cartofacade.Position, error) {
+			return cartofacade.Position{}, errors.New("no pose yet")
+		}
+		_, err = svc.DoCommand(context.Background(), map[string]interface{}{ShadowPositionCommand: ""})
+		test.That(t, err, test.ShouldNotBeNil)
+		test.That(t, err.Error(), test.ShouldContainSubstring, "shadow cartographer instance: no pose yet")
+	})
+
+	t.Run("shadow_map_info returns the map info of the primary and the shadow", func(t *testing.T) {
+		makePCD := func(numPoints int) []byte {
+			points := make([]r3.Vector, numPoints)
+			for i := range points {
+				points[i] = r3.Vector{X: float64(i)}
+			}
+			return pcdtest.PointsToPCD(t, points)
+		}
+		primary.PointCloudMapFunc = func(ctx context.Context, timeout time.Duration) ([]byte, error) {
+			return makePCD(3), nil
+		}
+		primary.TrajectoriesFunc = func(ctx context.Context, timeout time.Duration) ([]cartofacade.Trajectory, error) {
+			return []cartofacade.Trajectory{{ID: 0, State: cartofacade.TrajectoryActive}}, nil
+		}
+		shadow.PointCloudMapFunc = func(ctx context.Context, timeout time.Duration) ([]byte, error) {
+			return makePCD(5), nil
+		}
+		shadow.TrajectoriesFunc = primary.TrajectoriesFunc
+
+		resp, err := svc.DoCommand(context.Background(), map[string]interface{}{ShadowMapInfoCommand: ""})
+		test.That(t, err, test.ShouldBeNil)
+		trajectories := []interface{}{map[string]interface{}{"id": 0, "state": "active"}}
+		test.That(t, resp, test.ShouldResemble, map[string]interface{}{
+			PrimaryKey: map[string]interface{}{"num_points": 3, TrajectoriesKey: trajectories},
+			ShadowKey:  map[string]interface{}{"num_points": 5, TrajectoriesKey: trajectories},
+			UnitsKey:   map[string]interface{}{PositionUnitKey: "mm", PointCloudMapUnitKey: "m"},
+		})
+	})
+
+	t.Run("the shadow shuts down with the primary", func(t *testing.T) {
+		svc.cancelSensorProcessFunc = func() {}
+		svc.cancelCartoFacadeFunc = func() {}
+		var drained, stopped, terminated []string
+		for name, cf := range map[string]*cartofacade.Mock{"primary": primary, "shadow": shadow} {
+			cf.DrainFunc = func(ctx context.Context, timeout time.Duration) error {
+				drained = append(drained, name)
+				return nil
+			}
+			cf.StopFunc = func(ctx context.Context, timeout time.Duration) error {
+				stopped = append(stopped, name)
+				return nil
+			}
+			cf.TerminateFunc = func(ctx context.Context, timeout time.Duration) error {
+				terminated = append(terminated, name)
+				return nil
+			}
+		}
+		reached, err := svc.closeInPhases(context.Background())
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, reached, test.ShouldEqual, closePhaseStopWorkers)
+		test.That(t, drained, test.ShouldResemble, []string{"shadow", "primary"})
+		test.That(t, stopped, test.ShouldResemble, []string{"shadow", "primary"})
+		test.That(t, terminated, test.ShouldResemble, []string{"shadow", "primary"})
+	})
+}
+
+func TestUnitsDeclaration(t *testing.T) {
+	t.Run("positions are declared in millimeters and the pointcloud map in meters", func(t *testing.T) {
+		test.That(t, unitsToMap(), test.ShouldResemble, map[string]interface{}{
+			PositionUnitKey:      "mm",
+			PointCloudMapUnitKey: "m",
+		})
+	})
+
+	t.Run("the coordinates of the office map match the declared unit", func(t *testing.T) {
+		officeMap, err := os.ReadFile(artifact.MustPath("viam-cartographer/outputs/viam-office-02-22-3/pointcloud/pointcloud_0.pcd"))
+		test.That(t, err, test.ShouldBeNil)
+		mockCartoFacade := &cartofacade.Mock{}
+		mockCartoFacade.PointCloudMapFunc = func(ctx context.Context, timeout time.Duration) ([]byte, error) {
+			return officeMap, nil
+		}
+		pcd, err := mockCartoFacade.PointCloudMap(context.Background(), time.Second)
+		test.That(t, err, test.ShouldBeNil)
+
+		// rdk's pointcloud package reads the meters of a pcd in millimeters, so an office of a few meters to a few
+		// hundred meters across is only that size if the pcd holds meters
+		pc, err := pointcloud.ReadPCD(bytes.NewReader(pcd))
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, pc.Size(), test.ShouldBeGreaterThan, 0)
+		meta := pc.MetaData()
+		extentMm := math.Max(meta.MaxX-meta.MinX, meta.MaxY-meta.MinY)
+		test.That(t, extentMm, test.ShouldBeBetween, 1e3, 1e6)
+
+		// the points of the occupancy grid of the office map, which is read in meters, agree with it
+		grid, err := newOccupancyGrid(pcd, occupancyGridRequest{Resolution: 0.05})
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, float64(max(grid.width, grid.height))*0.05*1000, test.ShouldAlmostEqual, extentMm, 2*0.05*1000)
+	})
+}
+
+func TestDoCommandRegistry(t *testing.T) {
+	svc := &CartographerService{
+		Named:  resource.NewName(slam.API, "test").AsNamed(),
+		logger: logging.NewTestLogger(t),
+	}
+	supported := []string{
+		ListCommandsCommand,
+		VersionCommand,
+		JobDoneCommand,
+		JobProgressCommand,
+		StatusCommand,
+		ClearWarningsCommand,
+		ClearRecentErrorsCommand,
+		SetLogLevelCommand,
+		StartNewTrajectoryCommand,
+		SetModeCommand,
+		RelocalizeCommand,
+		LoadInternalStateCommand,
+		GetSessionStartTimeCommand,
+		GetAlgoConfigCommand,
+		SensorMetricsCommand,
+		SensorStatsCommand,
+		SlamStatsCommand,
+		ExportMetricsCSVCommand,
+		ChangeHeatmapCommand,
+		SubscribePosesCommand,
+		PollPosesCommand,
+		UnsubscribePosesCommand,
+		GetMapDeltaCommand,
+		GetTelemetryCompactCommand,
+		GetOccupancyGridCommand,
+		GetMapGeoJSONCommand,
+		GetTrajectoryCommand,
+		SubmapListCommand,
+		GetSubmapCommand,
+		WriteInternalStateToPathCommand,
+		ShadowPositionCommand,
+		ShadowMapInfoCommand,
+		SetMappingBoundsCommand,
+		SetSessionPostprocessingCommand,
+		postprocess.ToggleCommand,
+		postprocess.AddCommand,
+		postprocess.RemoveCommand,
+		postprocess.CropCommand,
+		postprocess.DownsampleCommand,
+		postprocess.UndoCommand,
+		postprocess.PathCommand,
+	}
+
+	t.Run("list_commands lists every supported command with its description", func(t *testing.T) {
+		resp, err := svc.DoCommand(context.Background(), map[string]interface{}{ListCommandsCommand: nil})
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, resp[SchemaVersionKey], test.ShouldEqual, DoCommandSchemaVersion)
+		commands, ok := resp[CommandsKey].(map[string]interface{})
+		test.That(t, ok, test.ShouldBeTrue)
+		test.That(t, len(commands), test.ShouldEqual, len(supported))
+		test.That(t, len(doCommands), test.ShouldEqual, len(supported))
+		for _, name := range supported {
+			command, ok := commands[name].(map[string]interface{})
+			test.That(t, ok, test.ShouldBeTrue)
+			test.That(t, command["description"], test.ShouldNotBeEmpty)
+			test.That(t, command, test.ShouldContainKey, "input")
+		}
+	})
+
+	t.Run("every command is dispatched to its handler", func(t *testing.T) {
+		registered := doCommands
+		defer func() { doCommands = registered }()
+
+		var handled []string
+		doCommands = map[string]doCommand{}
+		for name := range registered {
+			test.That(t, registered[name].handle, test.ShouldNotBeNil)
+			doCommands[name] = doCommand{
+				handle: func(cartoSvc *CartographerService, ctx context.Context, val interface{}) (map[string]interface{}, error) {
+					handled = append(handled, name)
+					return map[string]interface{}{name: val}, nil
+				},
+			}
+		}
+		for _, name := range supported {
+			resp, err := svc.DoCommand(context.Background(), map[string]interface{}{name: "value"})
+			test.That(t, err, test.ShouldBeNil)
+			test.That(t, resp, test.ShouldResemble, map[string]interface{}{name: "value"})
+		}
+		test.That(t, handled, test.ShouldResemble, supported)
+	})
+
+	t.Run("is unimplemented for a request without a command", func(t *testing.T) {
+		resp, err := svc.DoCommand(context.Background(), map[string]interface{}{})
+		test.That(t, err, test.ShouldEqual, viamgrpc.UnimplementedError)
+		test.That(t, resp, test.ShouldBeNil)
+	})
+
+	t.Run("runs every command of a request in the order of their names and merges their responses", func(t *testing.T) {
+		registered := doCommands
+		defer func() { doCommands = registered }()
+
+		var handled []string
+		doCommands = map[string]doCommand{}
+		for _, name := range []string{"a", "b", "c"} {
+			doCommands[name] = doCommand{
+				handle: func(cartoSvc *CartographerService, ctx context.Context, val interface{}) (map[string]interface{}, error) {
+					handled = append(handled, name)
+					if val == "fail" {
+						return nil, errors.New("failed")
+					}
+					return map[string]interface{}{name: val}, nil
+				},
+			}
+		}
+		resp, err := svc.DoCommand(context.Background(), map[string]interface{}{"a": 1.0, "b": 2.0, "c": 3.0})
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, resp, test.ShouldResemble, map[string]interface{}{"a": 1.0, "b": 2.0, "c": 3.0})
+		test.That(t, handled, test.ShouldResemble, []string{"a", "b", "c"})
+
+		handled = nil
+		resp, err = svc.DoCommand(context.Background(), map[string]interface{}{"a": 1.0, "b": "fail", "c": 3.0})
+		test.That(t, err, test.ShouldBeError, errors.New("failed"))
+		test.That(t, resp, test.ShouldBeNil)
+		test.That(t, handled, test.ShouldResemble, []string{"a", "b"})
+
+		// the unknown commands of a request are skipped and reported, the others are run
+		handled = nil
+		resp, err = svc.DoCommand(context.Background(), map[string]interface{}{"a": 1.0, "unknown": nil, "d": nil})
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, resp["a"], test.ShouldEqual, 1.0)
+		unknown, ok := resp[UnknownCommandsKey].(map[string]interface{})
+		test.That(t, ok, test.ShouldBeTrue)
+		test.That(t, unknown, test.ShouldHaveLength, 2)
+		test.That(t, unknown["unknown"], test.ShouldContainSubstring, "unknown command \"unknown\"")
+		test.That(t, unknown["d"], test.ShouldContainSubstring, "unknown command \"d\"")
+		test.That(t, handled, test.ShouldResemble, []string{"a"})
+
+		// a request of unknown commands only fails
+		handled = nil
+		resp, err = svc.DoCommand(context.Background(), map[string]interface{}{"unknown": nil, "d": nil})
+		test.That(t, errors.Is(err, viamgrpc.UnimplementedError), test.ShouldBeTrue)
+		test.That(t, err.Error(), test.ShouldContainSubstring, "unknown command \"d\"")
+		test.That(t, resp, test.ShouldBeNil)
+		test.That(t, handled, test.ShouldBeEmpty)
+	})
+
+	t.Run("suggests similar commands for an unknown command", func(t *testing.T) {
+		resp, err := svc.DoCommand(context.Background(), map[string]interface{}{"job_dne": nil})
+		test.That(t, errors.Is(err, viamgrpc.UnimplementedError), test.ShouldBeTrue)
+		test.That(t, err.Error(), test.ShouldContainSubstring, "did you mean "+JobDoneCommand)
+		test.That(t, resp, test.ShouldBeNil)
+
+		_, err = svc.DoCommand(context.Background(), map[string]interface{}{"shadow": nil})
+		test.That(t, err.Error(), test.ShouldContainSubstring, "did you mean "+ShadowMapInfoCommand+", "+ShadowPositionCommand)
+
+		_, err = svc.DoCommand(context.Background(), map[string]interface{}{"fake_flag": true})
+		test.That(t, errors.Is(err, viamgrpc.UnimplementedError), test.ShouldBeTrue)
+		test.That(t, err.Error(), test.ShouldContainSubstring, "see "+ListCommandsCommand)
+	})
+}
+
+func TestDoCommandArgumentLimits(t *testing.T) {
+	svc := &CartographerService{
+		Named:                  resource.NewName(slam.API, "test").AsNamed(),
+		logger:                 logging.NewTestLogger(t),
+		maxPostprocessingTasks: 10,
+	}
+	nested := interface{}(1.0)
+	for i := 0; i < maxDoCommandArgDepth; i++ {
+		nested = []interface{}{nested}
+	}
+	manyPoints := make([]interface{}, maxPostprocessingTaskPoints+1)
+	for i := range manyPoints {
+		manyPoints[i] = map[string]interface{}{"X": 1.0, "Y": 2.0}
+	}
+	manyElements := make([]interface{}, maxDoCommandArgElements+1)
+	for _, tc := range []struct {
+		name   string
+		val    interface{}
+		detail string
+	}{
+		{name: "nested too deeply", val: []interface{}{nested}, detail: "nested deeper than 8 levels"},
+		{name: "too long strings", val: strings.Repeat("a", maxDoCommandArgStringLength+1), detail: "a string of 4097 bytes"},
+		{
+			name:   "too long map keys",
+			val:    []interface{}{map[string]interface{}{strings.Repeat("a", maxDoCommandArgStringLength+1): 1.0}},
+			detail: "a string of 4097 bytes",
+		},
+		{name: "too many elements", val: manyElements, detail: "hold more than 100000 elements"},
+		{name: "too many points", val: manyPoints, detail: "got 10001 points, expected at most 10000"},
+	} {
+		t.Run(fmt.Sprintf("rejects %s", tc.name), func(t *testing.T) {
+			resp, err := svc.DoCommand(context.Background(), map[string]interface{}{postprocess.AddCommand: tc.val})
+			test.That(t, err, test.ShouldNotBeNil)
+			test.That(t, err.Error(), test.ShouldStartWith, "invalid argument for "+postprocess.AddCommand+": ")
+			test.That(t, err.Error(), test.ShouldContainSubstring, tc.detail)
+			test.That(t, resp, test.ShouldBeNil)
+		})
+	}
+
+	t.Run("accepts values within the limits", func(t *testing.T) {
+		resp, err := svc.DoCommand(context.Background(),
+			map[string]interface{}{postprocess.AddCommand: manyPoints[:maxPostprocessingTaskPoints]})
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, resp, test.ShouldResemble, map[string]interface{}{postprocess.AddCommand: SuccessMessage})
+		test.That(t, len(svc.postprocessingTasks[0].Points), test.ShouldEqual, maxPostprocessingTaskPoints)
+	})
+
+	t.Run("describes values of the wrong type", func(t *testing.T) {
+		_, err := svc.DoCommand(context.Background(), map[string]interface{}{postprocess.AddCommand: "points"})
+		test.That(t, errors.Is(err, ErrBadPostprocessingPointsFormat), test.ShouldBeTrue)
+		test.That(t, err.Error(), test.ShouldStartWith, "invalid argument for "+postprocess.AddCommand+": ")
+		test.That(t, err.Error(), test.ShouldContainSubstring, "expected array, got string")
+
+		_, err = svc.DoCommand(context.Background(),
+			map[string]interface{}{SetMappingBoundsCommand: map[string]interface{}{"min_x": "1"}})
+		test.That(t, errors.Is(err, ErrBadMappingBoundsFormat), test.ShouldBeTrue)
+		test.That(t, err.Error(), test.ShouldContainSubstring, "min_x: expected number, got string")
+	})
+}
+
+// FuzzDoCommand sends JSON values to every command that takes a value, checking that no value makes a handler
+// panic and that rejected values are reported as invalid arguments of the command.
+func FuzzDoCommand(f *testing.F) {
+	for _, seed := range []string{
+		`null`, `true`, `0`, `-1`, `1.5`, `1e308`, `""`, `"info"`, `"png"`, `"/tmp/x"`, `[]`, `{}`,
+		`[{"X": 1, "Y": 2}]`, `[{"X": "1"}]`, `[null]`, `[[[[[[[[[[1]]]]]]]]]]`,
+		`{"x": 1, "y": 2, "theta": 3}`, `{"x": null}`, `{"resolution": 0.1, "occupied_threshold": 2}`,
+		`{"resolution": "0.1"}`, `{"min_x": -1, "max_x": 1, "min_y": -1, "max_y": 1}`, `{"min_x": {}}`,
+		`{"since_unix_ms": 1000, "chunk": 0}`, `{"chunk": 1}`, `{"postprocessed": false}`, `"localize"`, `"map"`,
+	} {
+		f.Add(seed)
+	}
+
+	pcd := pcdtest.PointsToPCD(f, []r3.Vector{{X: 100}})
+	mockCartoFacade := &cartofacade.Mock{}
+	mockCartoFacade.PointCloudMapFunc = func(ctx context.Context, timeout time.Duration) ([]byte, error) {
+		return pcd, nil
+	}
+	mockCartoFacade.StartNewTrajectoryFunc = func(
+		ctx context.Context, timeout time.Duration, initialPose *cartofacade.TrajectoryPose,
+	) (cartofacade.NewTrajectory, error) {
+		return cartofacade.NewTrajectory{}, nil
+	}
+	mockCartoFacade.TrajectoryFunc = func(ctx context.Context, timeout time.Duration) ([]cartofacade.TrajectoryNode, error) {
+		return []cartofacade.TrajectoryNode{{Time: time.UnixMilli(1000), Pose: spatialmath.NewZeroPose()}}, nil
+	}
+	mockCartoFacade.SetSlamModeFunc = func(ctx context.Context, timeout time.Duration, mode cartofacade.SlamMode) error {
+		return nil
+	}
+	lidar := &inject.TimedLidar{}
+	lidar.DataFrequencyHzFunc = func() int { return 5 }
+	svc := &CartographerService{
+		Named:       resource.NewName(slam.API, "test").AsNamed(),
+		lidar:       lidar,
+		cartofacade: mockCartoFacade,
+		cartoLib: &cartofacade.CartoLibMock{
+			SetLogLevelFunc: func(minloglevel, verbose int) error { return nil },
+		},
+		changeDetector:         &sensorprocess.ChangeDetector{Resolution: changeDetectionResolution},
+		maxPostprocessingTasks: 1,
+	}
+	commands := []string{
+		SetLogLevelCommand, StartNewTrajectoryCommand, ChangeHeatmapCommand, GetMapDeltaCommand,
+		GetTelemetryCompactCommand, GetOccupancyGridCommand, GetMapGeoJSONCommand, GetTrajectoryCommand,
+		WriteInternalStateToPathCommand, SetMappingBoundsCommand, SetSessionPostprocessingCommand,
+		SetModeCommand, postprocess.AddCommand, postprocess.RemoveCommand,
+	}
+
+	f.Fuzz(func(t *testing.T, valJSON string) {
+		var val interface{}
+		if err := json.Unmarshal([]byte(valJSON), &val); err != nil {
+			t.Skip()
+		}
+		svc.logger = logging.NewTestLogger(t)
+		for _, command := range commands {
+			svc.postprocessingTasks = nil
+			_, err := svc.DoCommand(context.Background(), map[string]interface{}{command: val})
+			var argErr *invalidArgumentError
+			if errors.As(err, &argErr) {
+				test.That(t, err.Error(), test.ShouldStartWith, "invalid argument for "+command+": ")
+			}
+		}
+	})
+}
@@ -0,0 +1,123 @@
+package viamcartographer
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"github.com/pkg/errors"
+)
+
+// The limits of the values of DoCommand requests, which come from arbitrary clients. They are far above what any
+// command needs, so that they only reject malformed requests before they are decoded.
+const (
+	// maxDoCommandArgDepth is the number of levels lists and maps may be nested to in the value of a command.
+	maxDoCommandArgDepth = 8
+	// maxDoCommandArgStringLength is the length, in bytes, of the longest string or map key of the value of a
+	// command.
+	maxDoCommandArgStringLength = 4096
+	// maxDoCommandArgElements is the number of elements of all lists and maps of the value of a command.
+	maxDoCommandArgElements = 100_000
+	// maxPostprocessingTaskPoints is the number of points a postprocessing task may add or remove.
+	maxPostprocessingTaskPoints = 10_000
+)
+
+// invalidArgumentError is the error for the value of a command that could not be decoded or is not valid for the
+// command. DoCommand fills in the command, so that all such errors read "invalid argument for <command>: <detail>".
+type invalidArgumentError struct {
+	command string
+	err     error
+}
+
+func (e *invalidArgumentError) Error() string {
+	return fmt.Sprintf("invalid argument for %s: %v", e.command, e.err)
+}
+
+func (e *invalidArgumentError) Unwrap() error {
+	return e.err
+}
+
+// invalidArgument returns err as an invalid argument error.
+func invalidArgument(err error) error {
+	return &invalidArgumentError{err: err}
+}
+
+// checkDoCommandArg returns an error if the value of a command exceeds the limits of DoCommand values.
+func checkDoCommandArg(val interface{}) error {
+	numElements := 0
+	var check func(val interface{}, depth int) error
+	check = func(val interface{}, depth int) error {
+		switch v := val.(type) {
+		case string:
+			if len(v) > maxDoCommandArgStringLength {
+				return errors.Errorf("a string of %d bytes exceeds the limit of %d bytes", len(v), maxDoCommandArgStringLength)
+			}
+		case []interface{}:
+			if depth > maxDoCommandArgDepth {
+				return errors.Errorf("lists and maps are nested deeper than %d levels", maxDoCommandArgDepth)
+			}
+			if numElements += len(v); numElements > maxDoCommandArgElements {
+				return errors.Errorf("lists and maps hold more than %d elements", maxDoCommandArgElements)
+			}
+			for _, elem := range v {
+				if err := check(elem, depth+1); err != nil {
+					return err
+				}
+			}
+		case map[string]interface{}:
+			if depth > maxDoCommandArgDepth {
+				return errors.Errorf("lists and maps are nested deeper than %d levels", maxDoCommandArgDepth)
+			}
+			if numElements += len(v); numElements > maxDoCommandArgElements {
+				return errors.Errorf("lists and maps hold more than %d elements", maxDoCommandArgElements)
+			}
+			for key, elem := range v {
+				if err := check(key, depth); err != nil {
+					return err
+				}
+				if err := check(elem, depth+1); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	return check(val, 1)
+}
+
+// decodeDoCommandArg decodes the value of a command into a T, mapping the keys of maps to the fields of structs by
+// their json tags. The error of a value that does not fit T describes where and what was expected.
+func decodeDoCommandArg[T any](val interface{}) (T, error) {
+	var decoded T
+	valJSON, err := json.Marshal(val)
+	if err != nil {
+		return decoded, err
+	}
+	if err := json.Unmarshal(valJSON, &decoded); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) {
+			err = errors.Errorf("expected %s, got %s", jsonTypeName(typeErr.Type.Kind()), typeErr.Value)
+			if typeErr.Field != "" {
+				err = errors.Wrap(err, typeErr.Field)
+			}
+		}
+		return decoded, err
+	}
+	return decoded, nil
+}
+
+// jsonTypeName returns the name of the JSON type a value of the Go kind is decoded from.
+func jsonTypeName(kind reflect.Kind) string {
+	switch kind {
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "bool"
+	case reflect.Slice, reflect.Array:
+		return "array"
+	case reflect.Map, reflect.Struct:
+		return "object"
+	default:
+		return "number"
+	}
+}
@@ -0,0 +1,252 @@
+// Package floorplan contains functionality to convert externally generated occupancy grids, e.g. floor plans or
+// maps of other SLAM systems, into maps cartographer can localize against
+package floorplan
+
+import (
+	"bufio"
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/golang/geo/r3"
+	"github.com/pkg/errors"
+	"go.viam.com/rdk/pointcloud"
+)
+
+const (
+	// occupiedThreshold & freeThreshold are the occupancy above which a cell is occupied & below which it is free,
+	// where the occupancy of a pixel is 1 for black & 0 for white. Cells in between are unknown. These are the
+	// defaults of the ROS map_server, whose maps are the most common source of occupancy grids.
+	occupiedThreshold = 0.65
+	freeThreshold     = 0.196
+	// occupiedProbability & freeProbability are the probabilities, in percent, of occupied & free cells, which
+	// cartographer clamps into its own probability bounds.
+	occupiedProbability = 100
+	freeProbability     = 0
+	// maxPixels bounds the size of an occupancy grid, which is loaded into memory entirely.
+	maxPixels = 1 << 26
+)
+
+var (
+	// ErrUnsupportedFormat denotes that an occupancy grid is neither a PGM nor a PNG image.
+	ErrUnsupportedFormat = errors.New("floor plan image must be a .pgm or .png file")
+	// ErrNoKnownCells denotes that an occupancy grid consists of unknown cells only.
+	ErrNoKnownCells = errors.New("floor plan image has no occupied or free cells")
+)
+
+// FloorPlan is an occupancy grid converted into a probability grid.
+type FloorPlan struct {
+	// PCD has a point, in meters, at the center of every known cell of the grid, with the probability of the
+	// cell being occupied, in percent, in the blue channel of its color, as in the pointcloud map.
+	PCD []byte
+	// ResolutionMm is the width of a cell in millimeters.
+	ResolutionMm float64
+	// Occupied, Free & Unknown are the number of cells by state. Unknown cells are not part of the PCD.
+	Occupied int
+	Free     int
+	Unknown  int
+}
+
+// Supported returns whether the image at path has the extension of a supported occupancy grid format.
+func Supported(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".pgm", ".png":
+		return true
+	default:
+		return false
+	}
+}
+
+// Convert reads the occupancy grid image at path, whose pixels are resolutionMm millimeters wide, and converts it
+// into a probability grid. The bottom left corner of the image is placed at (originXMm, originYMm) & the top of
+// the image is the positive y direction.
+func Convert(path string, resolutionMm, originXMm, originYMm float64) (*FloorPlan, error) {
+	if !Supported(path) {
+		return nil, ErrUnsupportedFormat
+	}
+	if resolutionMm <= 0 {
+		return nil, errors.New("floor plan resolution must be greater than zero")
+	}
+
+	//nolint:gosec
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		//nolint:errcheck
+		file.Close()
+	}()
+
+	var img image.Image
+	if strings.ToLower(filepath.Ext(path)) == ".pgm" {
+		img, err = decodePGM(file)
+	} else {
+		img, err = png.Decode(file)
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to decode floor plan image %q", path)
+	}
+	return fromImage(img, resolutionMm, originXMm, originYMm)
+}
+
+func fromImage(img image.Image, resolutionMm, originXMm, originYMm float64) (*FloorPlan, error) {
+	bounds := img.Bounds()
+	if bounds.Dx()*bounds.Dy() > maxPixels {
+		return nil, errors.Errorf("floor plan image has more than %d pixels", maxPixels)
+	}
+
+	floorPlan := &FloorPlan{ResolutionMm: resolutionMm}
+	pc := pointcloud.New()
+	for row := bounds.Min.Y; row < bounds.Max.Y; row++ {
+		for col := bounds.Min.X; col < bounds.Max.X; col++ {
+			probability, known := cellProbability(img.At(col, row))
+			if !known {
+				floorPlan.Unknown++
+				continue
+			}
+			if probability == occupiedProbability {
+				floorPlan.Occupied++
+			} else {
+				floorPlan.Free++
+			}
+			// image rows run from the top down
+			point := r3.Vector{
+				X: originXMm + (float64(col-bounds.Min.X)+0.5)*resolutionMm,
+				Y: originYMm + (float64(bounds.Max.Y-row)-0.5)*resolutionMm,
+			}
+			if err := pc.Set(point, pointcloud.NewColoredData(color.NRGBA{B: probability})); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if pc.Size() == 0 {
+		return nil, ErrNoKnownCells
+	}
+
+	var buf bytes.Buffer
+	if err := pointcloud.ToPCD(pc, &buf, pointcloud.PCDBinary); err != nil {
+		return nil, err
+	}
+	floorPlan.PCD = buf.Bytes()
+	return floorPlan, nil
+}
+
+// cellProbability classifies a pixel by its occupancy & returns the probability of the cell being occupied, in
+// percent, for occupied & free cells. Pixels which are not fully opaque are unknown.
+func cellProbability(c color.Color) (uint8, bool) {
+	_, _, _, alpha := c.RGBA()
+	if alpha != math.MaxUint16 {
+		return 0, false
+	}
+	gray := color.Gray16Model.Convert(c).(color.Gray16)
+	occupancy := 1 - float64(gray.Y)/math.MaxUint16
+	switch {
+	case occupancy > occupiedThreshold:
+		return occupiedProbability, true
+	case occupancy < freeThreshold:
+		return freeProbability, true
+	default:
+		return 0, false
+	}
+}
+
+// decodePGM decodes a binary (P5) or plain (P2) PGM image, as written by the ROS map_server.
+func decodePGM(r io.Reader) (image.Image, error) {
+	br := bufio.NewReader(r)
+	magic, err := readPGMToken(br)
+	if err != nil {
+		return nil, err
+	}
+	if magic != "P5" && magic != "P2" {
+		return nil, errors.Errorf("not a pgm image, unexpected magic number %q", magic)
+	}
+
+	var header [3]int
+	for i := range header {
+		token, err := readPGMToken(br)
+		if err != nil {
+			return nil, errors.Wrap(err, "malformed pgm header")
+		}
+		if header[i], err = strconv.Atoi(token); err != nil || header[i] <= 0 {
+			return nil, errors.Errorf("malformed pgm header, invalid value %q", token)
+		}
+	}
+	width, height, maxVal := header[0], header[1], header[2]
+	if maxVal > math.MaxUint16 {
+		return nil, errors.Errorf("malformed pgm header, maximum gray value %d is greater than %d", maxVal, math.MaxUint16)
+	}
+	if width*height > maxPixels {
+		return nil, errors.Errorf("pgm image has more than %d pixels", maxPixels)
+	}
+
+	bytesPerSample := 1
+	if maxVal > math.MaxUint8 {
+		bytesPerSample = 2
+	}
+	row := make([]byte, width*bytesPerSample)
+	img := image.NewGray16(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		if magic == "P5" {
+			if _, err := io.ReadFull(br, row); err != nil {
+				return nil, errors.Wrap(err, "pgm image is truncated")
+			}
+		}
+		for x := 0; x < width; x++ {
+			var sample int
+			switch {
+			case magic == "P2":
+				token, err := readPGMToken(br)
+				if err != nil {
+					return nil, errors.Wrap(err, "pgm image is truncated")
+				}
+				if sample, err = strconv.Atoi(token); err != nil {
+					return nil, errors.Errorf("malformed pgm image, invalid gray value %q", token)
+				}
+			case bytesPerSample == 2:
+				sample = int(row[2*x])<<8 | int(row[2*x+1])
+			default:
+				sample = int(row[x])
+			}
+			if sample < 0 || sample > maxVal {
+				return nil, errors.Errorf("malformed pgm image, gray value %d is out of range", sample)
+			}
+			img.SetGray16(x, y, color.Gray16{Y: uint16(sample * math.MaxUint16 / maxVal)})
+		}
+	}
+	return img, nil
+}
+
+// readPGMToken reads the next whitespace separated token of a PGM image, skipping comments. The whitespace
+// character ending the token is consumed, which is where the samples of a binary PGM image start.
+func readPGMToken(br *bufio.Reader) (string, error) {
+	var token []byte
+	for {
+		b, err := br.ReadByte()
+		if err != nil {
+			if errors.Is(err, io.EOF) && len(token) > 0 {
+				return string(token), nil
+			}
+			return "", err
+		}
+		switch {
+		case b == '#' && len(token) == 0:
+			if _, err := br.ReadString('\n'); err != nil {
+				return "", err
+			}
+		case b == ' ' || b == '\t' || b == '\n' || b == '\r' || b == '\v' || b == '\f':
+			if len(token) > 0 {
+				return string(token), nil
+			}
+		default:
+			token = append(token, b)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package floorplan
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang/geo/r3"
+	"go.viam.com/rdk/pointcloud"
+	"go.viam.com/test"
+)
+
+func writeImage(t *testing.T, name string, content []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	test.That(t, os.WriteFile(path, content, 0o600), test.ShouldBeNil)
+	return path
+}
+
+// cells returns the probability of every cell of the floor plan by the position of its center.
+func cells(t *testing.T, floorPlan *FloorPlan) map[r3.Vector]uint8 {
+	t.Helper()
+	pc, err := pointcloud.ReadPCD(bytes.NewReader(floorPlan.PCD))
+	test.That(t, err, test.ShouldBeNil)
+	cells := map[r3.Vector]uint8{}
+	pc.Iterate(0, 0, func(p r3.Vector, d pointcloud.Data) bool {
+		_, _, b := d.RGB255()
+		// the pcd is in meters, stored as float32
+		cells[r3.Vector{X: math.Round(p.X), Y: math.Round(p.Y)}] = b
+		return true
+	})
+	return cells
+}
+
+func TestConvert(t *testing.T) {
+	// a 3x2 grid, with the occupied, unknown & free cell of the ROS map_server in the top row
+	expectedCells := map[r3.Vector]uint8{
+		{X: 1025, Y: 2075}: occupiedProbability,
+		{X: 1125, Y: 2075}: freeProbability,
+		{X: 1025, Y: 2025}: freeProbability,
+		{X: 1075, Y: 2025}: occupiedProbability,
+		{X: 1125, Y: 2025}: freeProbability,
+	}
+
+	t.Run("converts a binary pgm image", func(t *testing.T) {
+		pgm := append([]byte("P5\n# CREATOR: map_saver.cpp 0.050 m/pix\n3 2\n255\n"), 0, 205, 254, 254, 0, 254)
+		floorPlan, err := Convert(writeImage(t, "map.pgm", pgm), 50, 1000, 2000)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, floorPlan.Occupied, test.ShouldEqual, 2)
+		test.That(t, floorPlan.Free, test.ShouldEqual, 3)
+		test.That(t, floorPlan.Unknown, test.ShouldEqual, 1)
+		test.That(t, cells(t, floorPlan), test.ShouldResemble, expectedCells)
+	})
+
+	t.Run("converts a plain pgm image", func(t *testing.T) {
+		pgm := []byte("P2 3 2 # width & height\n100\n0 80 100\n100 0 100\n")
+		floorPlan, err := Convert(writeImage(t, "map.pgm", pgm), 50, 1000, 2000)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, cells(t, floorPlan), test.ShouldResemble, expectedCells)
+	})
+
+	t.Run("converts a 16 bit pgm image", func(t *testing.T) {
+		pgm := append([]byte("P5 3 2 65535\n"), 0, 0, 0xcd, 0xcd, 0xff, 0xff, 0xff, 0xff, 0, 0, 0xff, 0xff)
+		floorPlan, err := Convert(writeImage(t, "map.pgm", pgm), 50, 1000, 2000)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, cells(t, floorPlan), test.ShouldResemble, expectedCells)
+	})
+
+	t.Run("converts a png image with transparent pixels as unknown", func(t *testing.T) {
+		img := image.NewNRGBA(image.Rect(0, 0, 3, 2))
+		img.Set(0, 0, color.NRGBA{A: 255})
+		img.Set(1, 0, color.NRGBA{R: 255, G: 255, B: 255, A: 0})
+		img.Set(2, 0, color.NRGBA{R: 255, G: 255, B: 255, A: 255})
+		img.Set(0, 1, color.NRGBA{R: 250, G: 250, B: 250, A: 255})
+		img.Set(1, 1, color.NRGBA{R: 20, G: 20, B: 20, A: 255})
+		img.Set(2, 1, color.NRGBA{R: 255, G: 255, B: 255, A: 255})
+		var buf bytes.Buffer
+		test.That(t, png.Encode(&buf, img), test.ShouldBeNil)
+
+		floorPlan, err := Convert(writeImage(t, "map.png", buf.Bytes()), 50, 1000, 2000)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, floorPlan.Unknown, test.ShouldEqual, 1)
+		test.That(t, cells(t, floorPlan), test.ShouldResemble, expectedCells)
+	})
+
+	t.Run("fails for an unsupported format", func(t *testing.T) {
+		_, err := Convert(writeImage(t, "map.jpg", []byte{}), 50, 0, 0)
+		test.That(t, err, test.ShouldBeError, ErrUnsupportedFormat)
+	})
+
+	t.Run("fails for a non positive resolution", func(t *testing.T) {
+		_, err := Convert(writeImage(t, "map.pgm", []byte("P2 1 1 255 0\n")), 0, 0, 0)
+		test.That(t, err, test.ShouldBeError, "floor plan resolution must be greater than zero")
+	})
+
+	t.Run("fails for a grid of unknown cells", func(t *testing.T) {
+		_, err := Convert(writeImage(t, "map.pgm", []byte("P2 2 1 255 205 205\n")), 50, 0, 0)
+		test.That(t, err, test.ShouldBeError, ErrNoKnownCells)
+	})
+
+	t.Run("fails for malformed pgm images", func(t *testing.T) {
+		for content, msg := range map[string]string{
+			"P6 1 1 255 0":      "not a pgm image, unexpected magic number \"P6\"",
+			"P2 1 x 255 0":      "malformed pgm header, invalid value \"x\"",
+			"P2 1 1 70000 0":    "malformed pgm header, maximum gray value 70000 is greater than 65535",
+			"P2 2 1 100 0 101":  "malformed pgm image, gray value 101 is out of range",
+			"P5 2 2 255\n\x00":  "pgm image is truncated: unexpected EOF",
+			"P2 2 1 255 0":      "pgm image is truncated: EOF",
+			"P2 1 1 255 zero\n": "malformed pgm image, invalid gray value \"zero\"",
+		} {
+			path := writeImage(t, "map.pgm", []byte(content))
+			_, err := Convert(path, 50, 0, 0)
+			test.That(t, err, test.ShouldBeError, "unable to decode floor plan image \""+path+"\": "+msg)
+		}
+	})
+}
@@ -0,0 +1,83 @@
+package viamcartographer
+
+import (
+	"context"
+	"time"
+
+	"github.com/viam-modules/viam-cartographer/cartofacade"
+)
+
+const (
+	// InitialOptimizationInProgressKey denotes whether the optimization of the existing map that
+	// optimize_on_start_async runs in the background is in progress.
+	InitialOptimizationInProgressKey = "initial_optimization_in_progress"
+)
+
+// deferInitialOptimization returns cartoAlgoConfig without optimize_on_start if optimize_on_start_async is set and
+// there is an existing map for it to optimize, so that cartographer is started once the map is loaded.
+// startSensorProcesses then runs the optimization in the background.
+func (cartoSvc *CartographerService) deferInitialOptimization(
+	cartoAlgoConfig cartofacade.CartoAlgoConfig,
+) cartofacade.CartoAlgoConfig {
+	// a floor plan is a single submap, so there is nothing to optimize on start
+	if !cartoSvc.optimizeOnStartAsync || !cartoAlgoConfig.OptimizeOnStart ||
+		cartoSvc.existingMap == "" || cartoSvc.floorPlan != nil {
+		return cartoAlgoConfig
+	}
+	cartoSvc.initialOptimizationDeferred = true
+	cartoAlgoConfig.OptimizeOnStart = false
+	return cartoAlgoConfig
+}
+
+// startSensorProcesses starts the sensor processes and, if the initial optimization was deferred, runs it in the
+// background. If the library runs the optimization on a thread of its own, i.e. provides
+// FeatureBackgroundInitialOptimization, the sensors are read meanwhile and localized against the existing map as it
+// was loaded, and the poses published are marked as pre-optimization. Otherwise every call into cartographer would
+// wait on the optimization, so the sensors are read once it completes. Their config is set up right away either
+// way, so that the DoCommands do not race with it. Cancelling ctx stops waiting on the optimization, though it
+// keeps running in C until it completes.
+func startSensorProcesses(ctx context.Context, cartoSvc *CartographerService) {
+	spConfig := newSensorProcessConfig(cartoSvc)
+	if !cartoSvc.initialOptimizationDeferred {
+		runSensorProcesses(ctx, cartoSvc, spConfig)
+		return
+	}
+
+	background := cartoSvc.cartoLib.Capabilities().Has(cartofacade.FeatureBackgroundInitialOptimization)
+	cartoSvc.initialOptimizationInBackground.Store(background)
+	cartoSvc.initialOptimizationInProgress.Store(true)
+	cartoSvc.poseSubscriptions.preOptimization.Store(background)
+	if background {
+		cartoSvc.logger.Info("running the optimization of optimize_on_start in the background, the poses are " +
+			"localized against the existing map as loaded until it completes")
+		runSensorProcesses(ctx, cartoSvc, spConfig)
+	} else {
+		cartoSvc.logger.Info("running the optimization of optimize_on_start in the background, " +
+			"the sensors are read once it completes")
+	}
+	cartoSvc.goWorker("initial_optimization", func(w *worker) {
+		defer cartoSvc.initialOptimizationInProgress.Store(false)
+		defer cartoSvc.poseSubscriptions.preOptimization.Store(false)
+		start := time.Now()
+		err := cartoSvc.cartofacade.RunInitialOptimization(ctx, cartoSvc.cartoFacadeInternalTimeout)
+		switch {
+		case ctx.Err() != nil:
+			cartoSvc.logger.Infow("stopped waiting for the initial optimization", "duration", time.Since(start))
+			return
+		case err != nil:
+			cartoSvc.logger.Errorw("the initial optimization failed, the sensors are read with the existing map as "+
+				"loaded", "error", err)
+		default:
+			cartoSvc.logger.Infow("finished the initial optimization", "duration", time.Since(start))
+		}
+		if !background {
+			runSensorProcesses(ctx, cartoSvc, spConfig)
+		}
+	})
+}
+
+// initialOptimizationBlocking returns whether the initial optimization is in progress on the worker goroutine of the
+// cartofacade, which every other call into cartographer would wait on.
+func (cartoSvc *CartographerService) initialOptimizationBlocking() bool {
+	return cartoSvc.initialOptimizationInProgress.Load() && !cartoSvc.initialOptimizationInBackground.Load()
+}
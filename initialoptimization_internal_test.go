@@ -0,0 +1,215 @@
+package viamcartographer
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.viam.com/rdk/logging"
+	"go.viam.com/test"
+	"go.viam.com/utils/testutils"
+
+	"github.com/viam-modules/viam-cartographer/cartofacade"
+	"github.com/viam-modules/viam-cartographer/floorplan"
+	s "github.com/viam-modules/viam-cartographer/sensors"
+)
+
+func TestInitialOptimization(t *testing.T) {
+	logger := logging.NewTestLogger(t)
+	ctx := context.Background()
+	deps := s.SetupDeps(s.GoodLidar, s.NoMovementSensor)
+	lidar, err := s.NewLidar(ctx, deps, string(s.GoodLidar), 1000, logger)
+	test.That(t, err, test.ShouldBeNil)
+
+	t.Run("is only deferred with optimize_on_start_async and an existing map to optimize", func(t *testing.T) {
+		algoConfig := cartofacade.GetTestAlgoConfig(false)
+		algoConfig.OptimizeOnStart = true
+		for _, tc := range []struct {
+			name        string
+			async       bool
+			existingMap string
+			floorPlan   *floorplan.FloorPlan
+			deferred    bool
+		}{
+			{name: "async with an existing map", async: true, existingMap: "map.pbstream", deferred: true},
+			{name: "not async", existingMap: "map.pbstream"},
+			{name: "async without an existing map", async: true},
+			{name: "async with a floor plan", async: true, existingMap: "map.pbstream", floorPlan: &floorplan.FloorPlan{}},
+		} {
+			t.Run(tc.name, func(t *testing.T) {
+				svc := newTestService(&cartofacade.Mock{}, logger)
+				svc.optimizeOnStartAsync = tc.async
+				svc.existingMap = tc.existingMap
+				svc.floorPlan = tc.floorPlan
+				startedAlgoConfig := svc.deferInitialOptimization(algoConfig)
+				test.That(t, svc.initialOptimizationDeferred, test.ShouldEqual, tc.deferred)
+				test.That(t, startedAlgoConfig.OptimizeOnStart, test.ShouldEqual, !tc.deferred)
+			})
+		}
+	})
+
+	newSvc := func(
+		optimize func(ctx context.Context) error, features ...cartofacade.Feature,
+	) (*CartographerService, *atomic.Int64) {
+		var numAdded atomic.Int64
+		cf := &cartofacade.Mock{}
+		cf.RunInitialOptimizationFunc = func(ctx context.Context, timeout time.Duration) error {
+			test.That(t, timeout, test.ShouldEqual, time.Minute)
+			return optimize(ctx)
+		}
+		cf.AddLidarReadingFunc = func(
+			ctx context.Context, timeout time.Duration, lidarName string, currentReading s.TimedLidarReadingResponse,
+		) error {
+			numAdded.Add(1)
+			return nil
+		}
+		cf.TrajectoriesFunc = func(ctx context.Context, timeout time.Duration) ([]cartofacade.Trajectory, error) {
+			return nil, nil
+		}
+		cf.PositionFunc = func(ctx context.Context, timeout time.Duration) (cartofacade.Position, error) {
+			return cartofacade.Position{Real: 1}, nil
+		}
+		cf.UnresponsiveFunc = func() bool { return false }
+		cf.DrainFunc = func(ctx context.Context, timeout time.Duration) error { return nil }
+		cf.StopFunc = func(ctx context.Context, timeout time.Duration) error { return nil }
+		cf.TerminateFunc = func(ctx context.Context, timeout time.Duration) error { return nil }
+
+		svc := newTestService(cf, logger)
+		svc.cartoLib = &cartofacade.CartoLibMock{
+			LogLevelFunc:     func() (int, int) { return 1, 0 },
+			CapabilitiesFunc: func() cartofacade.Capabilities { return cartofacade.NewCapabilities(features...) },
+		}
+		svc.lidar = lidar
+		svc.cartoFacadeTimeout = 5 * time.Second
+		svc.cartoFacadeInternalTimeout = time.Minute
+		svc.initialOptimizationDeferred = true
+		svc.cancelCartoFacadeFunc = func() {}
+		return svc, &numAdded
+	}
+
+	status := func(t *testing.T, svc *CartographerService) map[string]interface{} {
+		resp, err := svc.DoCommand(context.Background(), map[string]interface{}{StatusCommand: ""})
+		test.That(t, err, test.ShouldBeNil)
+		return resp
+	}
+
+	t.Run("the sensors are localized against the map as loaded while it is optimized", func(t *testing.T) {
+		release := make(chan struct{})
+		svc, numAdded := newSvc(func(ctx context.Context) error {
+			<-release
+			return nil
+		}, cartofacade.FeatureBackgroundInitialOptimization)
+		cancelCtx, cancelFunc := context.WithCancel(context.Background())
+		svc.cancelSensorProcessFunc = cancelFunc
+		resp, err := svc.DoCommand(context.Background(), map[string]interface{}{SubscribePosesCommand: ""})
+		test.That(t, err, test.ShouldBeNil)
+		id := resp["id"]
+
+		startSensorProcesses(cancelCtx, svc)
+		testutils.WaitForAssertion(t, func(tb testing.TB) {
+			tb.Helper()
+			test.That(tb, numAdded.Load(), test.ShouldBeGreaterThan, 0)
+		})
+		resp = status(t, svc)
+		test.That(t, resp[InitialOptimizationInProgressKey], test.ShouldBeTrue)
+		_, ok := resp[TrajectoriesKey]
+		test.That(t, ok, test.ShouldBeTrue)
+		_, err = svc.Position(context.Background())
+		test.That(t, err, test.ShouldBeNil)
+		telemetry := svc.compactTelemetry(context.Background(), time.Now())
+		test.That(t, telemetry.Flags, test.ShouldEqual,
+			CompactTelemetryInitialOptimizationInProgress|CompactTelemetryPoseValid)
+
+		resp, err = svc.DoCommand(context.Background(), map[string]interface{}{PollPosesCommand: id})
+		test.That(t, err, test.ShouldBeNil)
+		poses := resp[PosesKey].([]interface{})
+		test.That(t, poses, test.ShouldNotBeEmpty)
+		test.That(t, poses[0].(map[string]interface{})[PreOptimizationKey], test.ShouldBeTrue)
+
+		close(release)
+		testutils.WaitForAssertion(t, func(tb testing.TB) {
+			tb.Helper()
+			test.That(tb, status(t, svc)[InitialOptimizationInProgressKey], test.ShouldBeFalse)
+		})
+		test.That(t, svc.poseSubscriptions.preOptimization.Load(), test.ShouldBeFalse)
+		test.That(t, svc.Close(context.Background()), test.ShouldBeNil)
+	})
+
+	t.Run("closing stops waiting for the optimization in the background", func(t *testing.T) {
+		started := make(chan struct{})
+		svc, _ := newSvc(func(ctx context.Context) error {
+			close(started)
+			<-ctx.Done()
+			return ctx.Err()
+		}, cartofacade.FeatureBackgroundInitialOptimization)
+		cancelCtx, cancelFunc := context.WithCancel(context.Background())
+		svc.cancelSensorProcessFunc = cancelFunc
+
+		startSensorProcesses(cancelCtx, svc)
+		<-started
+		test.That(t, svc.Close(context.Background()), test.ShouldBeNil)
+		test.That(t, svc.initialOptimizationInProgress.Load(), test.ShouldBeFalse)
+		test.That(t, svc.workers.running(), test.ShouldBeEmpty)
+	})
+
+	t.Run("without the background optimization the sensors are read once it completes", func(t *testing.T) {
+		release := make(chan struct{})
+		svc, numAdded := newSvc(func(ctx context.Context) error {
+			<-release
+			return nil
+		})
+		cancelCtx, cancelFunc := context.WithCancel(context.Background())
+		svc.cancelSensorProcessFunc = cancelFunc
+
+		start := time.Now()
+		startSensorProcesses(cancelCtx, svc)
+		test.That(t, time.Since(start), test.ShouldBeLessThan, time.Second)
+
+		resp := status(t, svc)
+		test.That(t, resp[InitialOptimizationInProgressKey], test.ShouldBeTrue)
+		_, ok := resp[TrajectoriesKey]
+		test.That(t, ok, test.ShouldBeFalse)
+		_, err := svc.Position(context.Background())
+		test.That(t, errors.Is(err, ErrInitialOptimizationInProgress), test.ShouldBeTrue)
+		telemetry := svc.compactTelemetry(context.Background(), time.Now())
+		test.That(t, telemetry.Flags, test.ShouldEqual, CompactTelemetryInitialOptimizationInProgress)
+		// a long optimization does not restart the module
+		svc.restartOnHang = func() { t.Fatal("the module was restarted during the initial optimization") }
+		svc.handleCartoFacadeHang(time.Hour, nil)
+		time.Sleep(50 * time.Millisecond)
+		test.That(t, numAdded.Load(), test.ShouldEqual, 0)
+
+		close(release)
+		testutils.WaitForAssertion(t, func(tb testing.TB) {
+			tb.Helper()
+			test.That(tb, numAdded.Load(), test.ShouldBeGreaterThan, 0)
+			test.That(tb, status(t, svc)[InitialOptimizationInProgressKey], test.ShouldBeFalse)
+		})
+		_, err = svc.Position(context.Background())
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, svc.Close(context.Background()), test.ShouldBeNil)
+	})
+
+	t.Run("without the background optimization closing cancels it and the sensors are never read", func(t *testing.T) {
+		started := make(chan struct{})
+		var cancelled atomic.Bool
+		svc, numAdded := newSvc(func(ctx context.Context) error {
+			close(started)
+			<-ctx.Done()
+			cancelled.Store(true)
+			return ctx.Err()
+		})
+		cancelCtx, cancelFunc := context.WithCancel(context.Background())
+		svc.cancelSensorProcessFunc = cancelFunc
+
+		startSensorProcesses(cancelCtx, svc)
+		<-started
+		test.That(t, svc.Close(context.Background()), test.ShouldBeNil)
+		test.That(t, cancelled.Load(), test.ShouldBeTrue)
+		test.That(t, svc.initialOptimizationInProgress.Load(), test.ShouldBeFalse)
+		test.That(t, numAdded.Load(), test.ShouldEqual, 0)
+		test.That(t, svc.workers.running(), test.ShouldBeEmpty)
+	})
+}
@@ -16,9 +16,14 @@ import (
 
 	viamcartographer "github.com/viam-modules/viam-cartographer"
 	"github.com/viam-modules/viam-cartographer/cartofacade"
+	"github.com/viam-modules/viam-cartographer/sensors"
 	"github.com/viam-modules/viam-cartographer/testhelper"
 )
 
+// trajectoryErrorToleranceMm is how much larger the final position error, in millimeters, of mapping a dataset with
+// an additional sensor may be than that of mapping it with lidar only, as scan matching is not exact either way.
+const trajectoryErrorToleranceMm = 10
+
 // saveInternalState saves cartographer's internal state in the data directory.
 func saveInternalState(t *testing.T, internalState []byte, dataDir string) string {
 	timeStamp := time.Now().UTC()
@@ -191,3 +196,51 @@ func TestIntegrationCartographer(t *testing.T) {
 		})
 	}
 }
+
+// TestIntegrationCartographerTwoSessions provides end-to-end testing of mapping the mock dataset in two sessions,
+// i.e. two trajectories, with a single cartographer instance.
+func TestIntegrationCartographerTwoSessions(t *testing.T) {
+	logger := logging.NewTestLogger(t)
+
+	internalState := testhelper.IntegrationCartographerTwoSessions(t, logger)
+	test.That(t, len(internalState), test.ShouldBeGreaterThan, 0)
+}
+
+// TestIntegrationCartographerFloorPlan provides end-to-end testing of localizing the mock dataset against an
+// occupancy grid image rendered from its own final map, as a floor plan.
+func TestIntegrationCartographerFloorPlan(t *testing.T) {
+	logger := logging.NewTestLogger(t)
+
+	testhelper.IntegrationCartographerFloorPlan(t, logger)
+}
+
+// TestIntegrationCartographerSyntheticDataset provides end-to-end testing of mapping a synthetic dataset offline,
+// with lidar only, with lidar, IMU and odometer and with lidar and the velocities of a wheel encoder.
+func TestIntegrationCartographerSyntheticDataset(t *testing.T) {
+	logger := logging.NewTestLogger(t)
+
+	datasetDir := t.TempDir()
+	cfg := sensors.DefaultSyntheticDatasetConfig()
+	test.That(t, sensors.GenerateSyntheticDataset(datasetDir, cfg), test.ShouldBeNil)
+
+	t.Run("lidar only", func(t *testing.T) {
+		internalState := testhelper.IntegrationCartographerOnDataset(t, datasetDir, logger, false, false)
+		test.That(t, len(internalState), test.ShouldBeGreaterThan, 0)
+	})
+
+	t.Run("lidar, imu and odometer", func(t *testing.T) {
+		internalState := testhelper.IntegrationCartographerOnDataset(t, datasetDir, logger, true, true)
+		test.That(t, len(internalState), test.ShouldBeGreaterThan, 0)
+	})
+
+	t.Run("the velocity odometry of a wheel encoder does not worsen the trajectory of lidar only", func(t *testing.T) {
+		expectedPosition, err := sensors.SyntheticDatasetFinalPosition(cfg)
+		test.That(t, err, test.ShouldBeNil)
+		lidarOnlyError := testhelper.IntegrationCartographerPositionOnDataset(t, datasetDir, logger, false).
+			Sub(expectedPosition).Norm()
+		velocityError := testhelper.IntegrationCartographerPositionOnDataset(t, datasetDir, logger, true).
+			Sub(expectedPosition).Norm()
+		t.Logf("final position error: lidar only %.1fmm, with velocity odometry %.1fmm", lidarOnlyError, velocityError)
+		test.That(t, velocityError, test.ShouldBeLessThanOrEqualTo, lidarOnlyError+trajectoryErrorToleranceMm)
+	})
+}
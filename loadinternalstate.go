@@ -0,0 +1,131 @@
+package viamcartographer
+
+import (
+	"context"
+	"os"
+
+	"github.com/pkg/errors"
+	"go.uber.org/multierr"
+
+	"github.com/viam-modules/viam-cartographer/cartofacade"
+	"github.com/viam-modules/viam-cartographer/floorplan"
+)
+
+// loadInternalState replaces cartographer with one that localizes against the internal state at path and returns
+// the slam mode it is started in. The internal state is validated and migrated as an existing map is by New, so
+// that cartographer is never passed one it cannot load. The sensor processes are stopped while cartographer is
+// replaced and restarted once it is, the endpoints wait until it is replaced, and the postprocessing of the
+// previous map is cleared. If cartographer fails to load the internal state, the map that was localized against
+// before is loaded again.
+func (cartoSvc *CartographerService) loadInternalState(ctx context.Context, path string) (cartofacade.SlamMode, error) {
+	if _, err := os.Stat(path); err != nil {
+		return cartofacade.UnknownMode, err
+	}
+
+	// Close can not run while cartographer is replaced
+	cartoSvc.mu.Lock()
+	defer cartoSvc.mu.Unlock()
+	if cartoSvc.closed {
+		return cartofacade.UnknownMode, ErrClosed
+	}
+	if enableMapping, _ := cartoSvc.mode(); enableMapping {
+		return cartofacade.UnknownMode, ErrLoadInternalStateWhileMapping
+	}
+	// a truncated internal state is rejected rather than falling back to a previous one, as it was asked for
+	_, path, err := cartoSvc.prepareExistingMap(path, false)
+	if err != nil {
+		return cartofacade.UnknownMode, err
+	}
+
+	// the sensor processes read the mode, so they are stopped before set_mode is locked out. The endpoints, set_mode
+	// among them, lock the cartofacade before the mode.
+	cartoSvc.cancelSensorProcessFunc()
+	cartoSvc.waitForWorkers()
+	cartoSvc.cartoFacadeMu.Lock()
+	defer cartoSvc.cartoFacadeMu.Unlock()
+	cartoSvc.modeMu.Lock()
+	defer cartoSvc.modeMu.Unlock()
+	if cartoSvc.enableMapping {
+		cartoSvc.restartSensorProcesses()
+		return cartofacade.UnknownMode, ErrLoadInternalStateWhileMapping
+	}
+
+	if err := cartoSvc.terminateCartoFacades(ctx); err != nil {
+		return cartofacade.UnknownMode, errors.Wrap(err, "failed to terminate cartographer, the service has to be "+
+			"reconfigured")
+	}
+
+	previousMap, previousFloorPlan := cartoSvc.existingMap, cartoSvc.floorPlan
+	if err := cartoSvc.reinitCartoFacade(path, nil); err != nil {
+		cartoSvc.logger.Errorw("failed to load the internal state, loading the previous map again",
+			"path", path, "error", err)
+		if reloadErr := cartoSvc.reinitCartoFacade(previousMap, previousFloorPlan); reloadErr != nil {
+			return cartofacade.UnknownMode, multierr.Combine(err, errors.Wrap(reloadErr,
+				"failed to load the previous map again, the service has to be reconfigured"))
+		}
+		cartoSvc.restartSensorProcesses()
+		return cartofacade.UnknownMode, err
+	}
+
+	cartoSvc.clearPostprocessing()
+	cartoSvc.restartSensorProcesses()
+	cartoSvc.logger.Infow("loaded the internal state", "path", path, "previous", previousMap,
+		"slam_mode", cartoSvc.SlamMode)
+	return cartoSvc.SlamMode, nil
+}
+
+// terminateCartoFacades stops and terminates the cartofacades, as Close does, and waits for their workers to return.
+func (cartoSvc *CartographerService) terminateCartoFacades(ctx context.Context) error {
+	err := multierr.Combine(
+		cartoSvc.callCartoFacades(closePhaseDrainFacade, func(cf cartofacade.Interface) error {
+			return cf.Drain(ctx, cartoSvc.cartoFacadeTimeout)
+		}),
+		cartoSvc.callCartoFacades(closePhaseStopFacade, func(cf cartofacade.Interface) error {
+			return cf.Stop(ctx, cartoSvc.cartoFacadeTimeout)
+		}),
+		cartoSvc.callCartoFacades(closePhaseTerminateFacade, func(cf cartofacade.Interface) error {
+			return cf.Terminate(ctx, cartoSvc.cartoFacadeTimeout)
+		}),
+	)
+	cartoSvc.cancelCartoFacadeFunc()
+	cartoSvc.cartoFacadeWorkers.Wait()
+	cartoSvc.shadowCartofacade = nil
+	return err
+}
+
+// reinitCartoFacade initializes and starts cartographer with existingMap and floorPlan once the previous
+// cartofacade has been terminated.
+func (cartoSvc *CartographerService) reinitCartoFacade(existingMap string, floorPlan *floorplan.FloorPlan) error {
+	cartoFacadeCtx, cancelCartoFacadeFunc := context.WithCancel(context.Background())
+	cartoSvc.cancelCartoFacadeFunc = cancelCartoFacadeFunc
+	cartoSvc.existingMap = existingMap
+	cartoSvc.floorPlan = floorPlan
+	cartoSvc.initialOptimizationDeferred = false
+
+	initFunc := cartoSvc.initCartoFacadeFunc
+	if initFunc == nil {
+		initFunc = initCartoFacade
+	}
+	if err := initFunc(cartoFacadeCtx, cartoSvc); err != nil {
+		cancelCartoFacadeFunc()
+		return err
+	}
+	cartoSvc.enforceTrajectoryLimit(cartoFacadeCtx)
+	return nil
+}
+
+// restartSensorProcesses starts the sensor processes again once loadInternalState has stopped them.
+func (cartoSvc *CartographerService) restartSensorProcesses() {
+	sensorProcessCtx, cancelSensorProcessFunc := context.WithCancel(context.Background())
+	cartoSvc.cancelSensorProcessFunc = cancelSensorProcessFunc
+	startSensorProcessWorkers(sensorProcessCtx, cartoSvc)
+}
+
+// clearPostprocessing clears the postprocessing tasks and the edited map, which belong to the previous map.
+func (cartoSvc *CartographerService) clearPostprocessing() {
+	cartoSvc.postprocessingTasks = nil
+	cartoSvc.postprocessedPointCloud = nil
+	cartoSvc.postprocessed.Store(false)
+	cartoSvc.editedMap = nil
+	cartoSvc.editedMapInconsistent.Store(false)
+}
@@ -0,0 +1,270 @@
+package viamcartographer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.viam.com/rdk/logging"
+	"go.viam.com/test"
+	"go.viam.com/utils/testutils"
+
+	"github.com/viam-modules/viam-cartographer/cartofacade"
+	"github.com/viam-modules/viam-cartographer/pbstream"
+	"github.com/viam-modules/viam-cartographer/postprocess"
+	s "github.com/viam-modules/viam-cartographer/sensors"
+)
+
+// loadInternalStateMock is a cartofacade that counts the lidar readings added to it and records whether it was
+// terminated.
+type loadInternalStateMock struct {
+	*cartofacade.Mock
+	numAdded   atomic.Int64
+	terminated atomic.Bool
+}
+
+func newLoadInternalStateMock() *loadInternalStateMock {
+	cf := &loadInternalStateMock{Mock: &cartofacade.Mock{}}
+	cf.AddLidarReadingFunc = func(
+		ctx context.Context, timeout time.Duration, lidarName string, currentReading s.TimedLidarReadingResponse,
+	) error {
+		if cf.terminated.Load() {
+			return errors.New("reading added to a terminated cartofacade")
+		}
+		cf.numAdded.Add(1)
+		return nil
+	}
+	cf.TrajectoriesFunc = func(ctx context.Context, timeout time.Duration) ([]cartofacade.Trajectory, error) {
+		return nil, nil
+	}
+	cf.PositionFunc = func(ctx context.Context, timeout time.Duration) (cartofacade.Position, error) {
+		if cf.terminated.Load() {
+			return cartofacade.Position{}, errors.New("position of a terminated cartofacade")
+		}
+		return cartofacade.Position{Real: 1}, nil
+	}
+	cf.UnresponsiveFunc = func() bool { return false }
+	cf.DrainFunc = func(ctx context.Context, timeout time.Duration) error { return nil }
+	cf.StopFunc = func(ctx context.Context, timeout time.Duration) error { return nil }
+	cf.TerminateFunc = func(ctx context.Context, timeout time.Duration) error {
+		cf.terminated.Store(true)
+		return nil
+	}
+	return cf
+}
+
+func TestLoadInternalStateCommand(t *testing.T) {
+	logger := logging.NewTestLogger(t)
+	ctx := context.Background()
+	deps := s.SetupDeps(s.GoodLidar, s.NoMovementSensor)
+	lidar, err := s.NewLidar(ctx, deps, string(s.GoodLidar), 1000, logger)
+	test.That(t, err, test.ShouldBeNil)
+
+	internalState := filepath.Join(t.TempDir(), "map.pbstream")
+	writeTestPbstream(t, internalState, false, time.Now())
+	previousMap := "previous.pbstream"
+	// versionUnavailable is how libraries that cannot probe internal state versions respond
+	versionUnavailable := func(path string) (cartofacade.InternalStateVersion, error) {
+		return cartofacade.InternalStateVersion{}, cartofacade.ErrInternalStateVersionUnavailable
+	}
+
+	newSvc := func(cf *loadInternalStateMock, enableMapping bool) *CartographerService {
+		svc := newTestService(cf.Mock, logger)
+		svc.lidar = lidar
+		svc.cartoFacadeTimeout = 5 * time.Second
+		svc.cartoFacadeInternalTimeout = time.Minute
+		svc.enableMapping = enableMapping
+		svc.SlamMode = cartofacade.LocalizingMode
+		if enableMapping {
+			svc.SlamMode = cartofacade.UpdatingMode
+		}
+		svc.existingMap = previousMap
+		svc.cartoLib = &cartofacade.CartoLibMock{InternalStateVersionFunc: versionUnavailable}
+		svc.cancelCartoFacadeFunc = func() {}
+		cancelCtx, cancelFunc := context.WithCancel(context.Background())
+		svc.cancelSensorProcessFunc = cancelFunc
+		startSensorProcessWorkers(cancelCtx, svc)
+		testutils.WaitForAssertion(t, func(tb testing.TB) {
+			tb.Helper()
+			test.That(tb, cf.numAdded.Load(), test.ShouldBeGreaterThan, 0)
+		})
+		return svc
+	}
+	// initCartoFacadeFunc replaces the cartofacade with the mock of the map being loaded, failing for those
+	// without one
+	initCartoFacadeFunc := func(cfs map[string]*loadInternalStateMock, loaded *[]string) func(
+		ctx context.Context, cartoSvc *CartographerService,
+	) error {
+		return func(ctx context.Context, cartoSvc *CartographerService) error {
+			*loaded = append(*loaded, cartoSvc.existingMap)
+			cf, ok := cfs[cartoSvc.existingMap]
+			if !ok {
+				return errors.New("failed to load the internal state")
+			}
+			cartoSvc.cartofacade = cf.Mock
+			cartoSvc.SlamMode = cartofacade.LocalizingMode
+			return nil
+		}
+	}
+	runningWorkers := func(svc *CartographerService) []string {
+		var names []string
+		for _, w := range svc.workers.running() {
+			names = append(names, w.name)
+		}
+		return names
+	}
+
+	t.Run("restarts the sensor processes on cartographer localizing against the internal state", func(t *testing.T) {
+		previousCf := newLoadInternalStateMock()
+		svc := newSvc(previousCf, false)
+		svc.postprocessingTasks = []postprocess.Task{{Instruction: postprocess.Add}}
+		svc.postprocessed.Store(true)
+		editedMap := []byte("edited")
+		svc.editedMap = &editedMap
+
+		cf := newLoadInternalStateMock()
+		var loaded []string
+		svc.initCartoFacadeFunc = initCartoFacadeFunc(map[string]*loadInternalStateMock{internalState: cf}, &loaded)
+		// the position is never asked of a cartofacade that has been terminated
+		positionDone := make(chan struct{})
+		positionErrs := make(chan error, 1)
+		go func() {
+			defer close(positionErrs)
+			for {
+				select {
+				case <-positionDone:
+					return
+				default:
+				}
+				if _, err := svc.Position(ctx); err != nil {
+					positionErrs <- err
+					return
+				}
+			}
+		}()
+		resp, err := svc.DoCommand(ctx, map[string]interface{}{LoadInternalStateCommand: internalState})
+		close(positionDone)
+		test.That(t, <-positionErrs, test.ShouldBeNil)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, resp, test.ShouldResemble, map[string]interface{}{
+			LoadInternalStateCommand: SuccessMessage,
+			SlamModeKey:              cartofacade.LocalizingMode.String(),
+		})
+		test.That(t, loaded, test.ShouldResemble, []string{internalState})
+		test.That(t, svc.existingMap, test.ShouldEqual, internalState)
+		test.That(t, previousCf.terminated.Load(), test.ShouldBeTrue)
+
+		testutils.WaitForAssertion(t, func(tb testing.TB) {
+			tb.Helper()
+			test.That(tb, cf.numAdded.Load(), test.ShouldBeGreaterThan, 0)
+		})
+		test.That(t, runningWorkers(svc), test.ShouldContain, "lidar_sensor_process:"+lidar.Name())
+		test.That(t, svc.postprocessingTasks, test.ShouldBeEmpty)
+		test.That(t, svc.postprocessed.Load(), test.ShouldBeFalse)
+		test.That(t, svc.editedMap, test.ShouldBeNil)
+
+		test.That(t, svc.Close(ctx), test.ShouldBeNil)
+		test.That(t, cf.terminated.Load(), test.ShouldBeTrue)
+		test.That(t, svc.workers.running(), test.ShouldBeEmpty)
+	})
+
+	t.Run("loads the previous map again if cartographer fails to load the internal state", func(t *testing.T) {
+		previousCf := newLoadInternalStateMock()
+		svc := newSvc(previousCf, false)
+		svc.postprocessingTasks = []postprocess.Task{{Instruction: postprocess.Add}}
+
+		reloadedCf := newLoadInternalStateMock()
+		var loaded []string
+		svc.initCartoFacadeFunc = initCartoFacadeFunc(map[string]*loadInternalStateMock{previousMap: reloadedCf}, &loaded)
+		resp, err := svc.DoCommand(ctx, map[string]interface{}{LoadInternalStateCommand: internalState})
+		test.That(t, err, test.ShouldBeError, errors.New("failed to load the internal state"))
+		test.That(t, resp, test.ShouldBeNil)
+		test.That(t, loaded, test.ShouldResemble, []string{internalState, previousMap})
+		test.That(t, svc.existingMap, test.ShouldEqual, previousMap)
+
+		testutils.WaitForAssertion(t, func(tb testing.TB) {
+			tb.Helper()
+			test.That(tb, reloadedCf.numAdded.Load(), test.ShouldBeGreaterThan, 0)
+		})
+		test.That(t, svc.postprocessingTasks, test.ShouldHaveLength, 1)
+		test.That(t, svc.Close(ctx), test.ShouldBeNil)
+		test.That(t, svc.workers.running(), test.ShouldBeEmpty)
+	})
+
+	t.Run("loads the migrated copy of an internal state of an older version", func(t *testing.T) {
+		t.Setenv(moduleDataDirEnvVar, t.TempDir())
+		migrated := filepath.Join(internalStateMigrationDir(), "map_v2.pbstream")
+		previousCf := newLoadInternalStateMock()
+		svc := newSvc(previousCf, false)
+		svc.cartoLib = &cartofacade.CartoLibMock{
+			InternalStateVersionFunc: func(path string) (cartofacade.InternalStateVersion, error) {
+				return cartofacade.InternalStateVersion{Version: 1, CurrentVersion: 2}, nil
+			},
+			MigrateInternalStateFunc: func(src, dst string) error {
+				data, err := os.ReadFile(src)
+				if err != nil {
+					return err
+				}
+				return os.WriteFile(dst, data, 0o600)
+			},
+		}
+
+		cf := newLoadInternalStateMock()
+		var loaded []string
+		svc.initCartoFacadeFunc = initCartoFacadeFunc(map[string]*loadInternalStateMock{migrated: cf}, &loaded)
+		_, err := svc.DoCommand(ctx, map[string]interface{}{LoadInternalStateCommand: internalState})
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, loaded, test.ShouldResemble, []string{migrated})
+		test.That(t, svc.existingMap, test.ShouldEqual, migrated)
+		test.That(t, svc.Close(ctx), test.ShouldBeNil)
+	})
+
+	t.Run("rejects truncated internal states without replacing cartographer", func(t *testing.T) {
+		truncated := filepath.Join(t.TempDir(), "truncated.pbstream")
+		writeTestPbstream(t, truncated, true, time.Now())
+		cf := newLoadInternalStateMock()
+		svc := newSvc(cf, false)
+		var loaded []string
+		svc.initCartoFacadeFunc = initCartoFacadeFunc(map[string]*loadInternalStateMock{}, &loaded)
+
+		_, err := svc.DoCommand(ctx, map[string]interface{}{LoadInternalStateCommand: truncated})
+		test.That(t, errors.Is(err, pbstream.ErrTruncated), test.ShouldBeTrue)
+		test.That(t, loaded, test.ShouldBeEmpty)
+		test.That(t, cf.terminated.Load(), test.ShouldBeFalse)
+		test.That(t, svc.existingMap, test.ShouldEqual, previousMap)
+		test.That(t, runningWorkers(svc), test.ShouldContain, "lidar_sensor_process:"+lidar.Name())
+		test.That(t, svc.Close(ctx), test.ShouldBeNil)
+	})
+
+	t.Run("is rejected while mapping", func(t *testing.T) {
+		cf := newLoadInternalStateMock()
+		svc := newSvc(cf, true)
+		_, err := svc.DoCommand(ctx, map[string]interface{}{LoadInternalStateCommand: internalState})
+		test.That(t, err, test.ShouldBeError, ErrLoadInternalStateWhileMapping)
+		test.That(t, cf.terminated.Load(), test.ShouldBeFalse)
+		test.That(t, svc.SlamMode, test.ShouldEqual, cartofacade.UpdatingMode)
+		test.That(t, runningWorkers(svc), test.ShouldContain, "lidar_sensor_process:"+lidar.Name())
+		test.That(t, svc.Close(ctx), test.ShouldBeNil)
+	})
+
+	t.Run("rejects paths of files that are not internal states", func(t *testing.T) {
+		cf := newLoadInternalStateMock()
+		svc := newSvc(cf, false)
+		for _, val := range []interface{}{nil, 1.0, "map.pcd", internalState + ".bak"} {
+			resp, err := svc.DoCommand(ctx, map[string]interface{}{LoadInternalStateCommand: val})
+			test.That(t, errors.Is(err, ErrBadLoadInternalStatePath), test.ShouldBeTrue)
+			test.That(t, resp, test.ShouldBeNil)
+		}
+
+		_, err := svc.DoCommand(ctx, map[string]interface{}{
+			LoadInternalStateCommand: filepath.Join(t.TempDir(), "missing.pbstream"),
+		})
+		test.That(t, errors.Is(err, os.ErrNotExist), test.ShouldBeTrue)
+		test.That(t, cf.terminated.Load(), test.ShouldBeFalse)
+		test.That(t, svc.Close(ctx), test.ShouldBeNil)
+	})
+}
@@ -0,0 +1,91 @@
+package viamcartographer
+
+import (
+	"time"
+
+	"github.com/viam-modules/viam-cartographer/cartofacade"
+)
+
+const (
+	// LocalizationLostKey denotes whether the lidar readings stopped matching the map.
+	LocalizationLostKey = "localization_lost"
+)
+
+// localizationHealth tracks whether the lidar readings still match the map while localizing, from the match
+// confidence of the positions polled for the session stats. A robot carried into a room that is not on the map
+// keeps getting poses that drift with its odometry while the matching silently fails. It is only accessed by the
+// session stats monitor.
+type localizationHealth struct {
+	minConfidence float64
+	timeout       time.Duration
+	// lowSince is the time the match confidence has been below minConfidence since, or the zero time if it is not.
+	lowSince time.Time
+	// lastGood is the last position whose match confidence was at least minConfidence, polled at lastGoodAt.
+	lastGood    cartofacade.Position
+	lastGoodAt  time.Time
+	hasLastGood bool
+}
+
+// update records the match confidence of pos, polled at now, and returns whether the localization is lost, i.e.
+// whether the match confidence has stayed below minConfidence for at least timeout. pos must have a known match
+// confidence.
+func (health *localizationHealth) update(pos cartofacade.Position, now time.Time) bool {
+	if pos.Confidence >= health.minConfidence {
+		health.lowSince = time.Time{}
+		health.lastGood = pos
+		health.lastGoodAt = now
+		health.hasLastGood = true
+		return false
+	}
+	if health.lowSince.IsZero() {
+		health.lowSince = now
+	}
+	return now.Sub(health.lowSince) >= health.timeout
+}
+
+// reset forgets the match confidences recorded so far, as they do not carry over from when the service was not
+// localizing.
+func (health *localizationHealth) reset() {
+	health.lowSince = time.Time{}
+	health.hasLastGood = false
+}
+
+// checkLocalization sets the localization lost status flag and warns, with the last good position, once the match
+// confidence of the polled positions has stayed below localization_min_confidence_percent for
+// localization_lost_timeout_sec while localizing, and clears it once the lidar readings match the map again or the
+// service stops localizing. An unknown match confidence, e.g. before the first optimization of the pose graph on
+// startup, leaves the flag as it is. It is only called by the session stats monitor.
+func (cartoSvc *CartographerService) checkLocalization(pos cartofacade.Position, now time.Time) {
+	health := &cartoSvc.localizationHealth
+	if _, slamMode := cartoSvc.mode(); slamMode != cartofacade.LocalizingMode {
+		health.reset()
+		cartoSvc.localizationLost.Store(false)
+		return
+	}
+	if pos.Confidence < 0 {
+		return
+	}
+
+	lost := health.update(pos, now)
+	if lost == cartoSvc.localizationLost.Load() {
+		return
+	}
+	cartoSvc.localizationLost.Store(lost)
+	if !lost {
+		cartoSvc.logger.Infow("the lidar readings match the map again, the localization recovered",
+			"match_confidence", pos.Confidence)
+		return
+	}
+	keysAndValues := []interface{}{
+		"match_confidence", pos.Confidence,
+		"min_confidence", health.minConfidence,
+		"low_since", health.lowSince.UTC().Format(time.RFC3339Nano),
+	}
+	if health.hasLastGood {
+		keysAndValues = append(keysAndValues,
+			"last_good_position_mm", map[string]float64{"x": health.lastGood.X, "y": health.lastGood.Y, "z": health.lastGood.Z},
+			"last_good_position_time", health.lastGoodAt.UTC().Format(time.RFC3339Nano))
+	}
+	cartoSvc.logger.Warnw("the lidar readings no longer match the map, the localization is lost and the position "+
+		"drifts with the odometry. The robot may be in an area that is not on the map", keysAndValues...)
+}
@@ -0,0 +1,125 @@
+package viamcartographer
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.viam.com/rdk/logging"
+	"go.viam.com/test"
+
+	"github.com/viam-modules/viam-cartographer/cartofacade"
+)
+
+func TestLocalizationLost(t *testing.T) {
+	const lostWarning = "the lidar readings no longer match the map, the localization is lost"
+	const recoveredMessage = "the localization recovered"
+	logger, obs := logging.NewObservedTestLogger(t)
+	mockCartoFacade := &cartofacade.Mock{}
+	mockCartoFacade.UnresponsiveFunc = func() bool { return true }
+	mockCartoFacade.PositionFunc = func(ctx context.Context, timeout time.Duration) (cartofacade.Position, error) {
+		return cartofacade.Position{Real: 1}, nil
+	}
+	svc := newTestService(mockCartoFacade, logger)
+	svc.SlamMode = cartofacade.LocalizingMode
+	svc.cartoLib = &cartofacade.CartoLibMock{LogLevelFunc: func() (int, int) { return 0, 0 }}
+	svc.localizationHealth = localizationHealth{
+		minConfidence: 0.5,
+		timeout:       5 * time.Second,
+	}
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	// checkConfidences feeds a position with each of the match confidences through the detector, one per second
+	// from the given second after start on
+	checkConfidences := func(fromSec int, confidences ...float64) {
+		for i, confidence := range confidences {
+			pos := cartofacade.Position{X: float64(fromSec + i), Y: 2, Z: 0, Real: 1, Confidence: confidence}
+			svc.checkLocalization(pos, start.Add(time.Duration(fromSec+i)*time.Second))
+		}
+	}
+	localizationLost := func() interface{} {
+		resp, err := svc.DoCommand(context.Background(), map[string]interface{}{StatusCommand: ""})
+		test.That(t, err, test.ShouldBeNil)
+		return resp[LocalizationLostKey]
+	}
+
+	t.Run("the localization is not lost while the match confidence dips for less than the timeout", func(t *testing.T) {
+		checkConfidences(0, 0.8, 0.7, 0.3, 0.2, 0.4, 0.1, 0.6, 0.2, 0.3)
+		test.That(t, localizationLost(), test.ShouldBeFalse)
+		test.That(t, obs.FilterMessageSnippet(lostWarning).Len(), test.ShouldEqual, 0)
+	})
+
+	t.Run("the localization is lost once the match confidence stays low for the timeout", func(t *testing.T) {
+		// the match confidence has been low since second 7
+		checkConfidences(9, 0.2, 0.1, 0.3, 0.2)
+		test.That(t, localizationLost(), test.ShouldBeTrue)
+		warnings := obs.FilterMessageSnippet(lostWarning).All()
+		test.That(t, len(warnings), test.ShouldEqual, 1)
+		test.That(t, warnings[0].ContextMap()["match_confidence"], test.ShouldEqual, 0.2)
+		test.That(t, warnings[0].ContextMap()["low_since"], test.ShouldEqual, "2024-01-01T00:00:07Z")
+		test.That(t, warnings[0].ContextMap()["last_good_position_mm"], test.ShouldResemble,
+			map[string]float64{"x": 6, "y": 2, "z": 0})
+		test.That(t, warnings[0].ContextMap()["last_good_position_time"], test.ShouldEqual, "2024-01-01T00:00:06Z")
+
+		checkConfidences(13, 0.1, 0.2)
+		test.That(t, obs.FilterMessageSnippet(lostWarning).Len(), test.ShouldEqual, 1)
+	})
+
+	t.Run("Position returns an error while the localization is lost only if position_error_on_localization_lost is set",
+		func(t *testing.T) {
+			_, err := svc.Position(context.Background())
+			test.That(t, err, test.ShouldBeNil)
+
+			svc.positionErrorOnLocalizationLost = true
+			_, err = svc.Position(context.Background())
+			test.That(t, err, test.ShouldBeError, ErrLocalizationLost)
+		})
+
+	t.Run("the localization recovers once the lidar readings match the map again", func(t *testing.T) {
+		checkConfidences(15, 0.9)
+		test.That(t, localizationLost(), test.ShouldBeFalse)
+		test.That(t, obs.FilterMessageSnippet(recoveredMessage).Len(), test.ShouldEqual, 1)
+		_, err := svc.Position(context.Background())
+		test.That(t, err, test.ShouldBeNil)
+	})
+
+	t.Run("the localization is lost when the lidar readings are off the map", func(t *testing.T) {
+		checkConfidences(16, 0, 0, 0, 0, 0)
+		test.That(t, localizationLost(), test.ShouldBeFalse)
+		checkConfidences(21, 0)
+		test.That(t, localizationLost(), test.ShouldBeTrue)
+		test.That(t, obs.FilterMessageSnippet(lostWarning).Len(), test.ShouldEqual, 2)
+	})
+
+	t.Run("an unknown match confidence leaves the localization lost flag as it is", func(t *testing.T) {
+		checkConfidences(22, -1, -1, -1, -1, -1, -1, -1, -1, -1, -1)
+		test.That(t, localizationLost(), test.ShouldBeTrue)
+		checkConfidences(32, 0.9)
+		test.That(t, localizationLost(), test.ShouldBeFalse)
+		checkConfidences(33, -1, -1, -1, -1, -1, -1, -1, -1, -1, -1)
+		test.That(t, localizationLost(), test.ShouldBeFalse)
+		test.That(t, obs.FilterMessageSnippet(lostWarning).Len(), test.ShouldEqual, 2)
+	})
+
+	t.Run("the localization lost flag clears and is omitted outside of localization mode", func(t *testing.T) {
+		checkConfidences(43, 0, 0, 0, 0, 0, 0)
+		test.That(t, localizationLost(), test.ShouldBeTrue)
+		svc.SlamMode = cartofacade.MappingMode
+		checkConfidences(49, 0)
+		test.That(t, localizationLost(), test.ShouldBeNil)
+		_, err := svc.Position(context.Background())
+		test.That(t, err, test.ShouldBeNil)
+
+		// the match confidences from before do not carry over
+		svc.SlamMode = cartofacade.LocalizingMode
+		checkConfidences(50, 0, 0, 0, 0, 0)
+		test.That(t, localizationLost(), test.ShouldBeFalse)
+	})
+
+	t.Run("the localization is not lost on startup before the match confidence is known", func(t *testing.T) {
+		svc.localizationHealth.reset()
+		svc.localizationLost.Store(false)
+		checkConfidences(100, -1, -1, -1, -1, -1, -1, -1, -1, -1, -1)
+		test.That(t, localizationLost(), test.ShouldBeFalse)
+		test.That(t, obs.FilterMessageSnippet(lostWarning).Len(), test.ShouldEqual, 3)
+	})
+}
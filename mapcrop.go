@@ -0,0 +1,98 @@
+package viamcartographer
+
+import (
+	"math"
+
+	"github.com/golang/geo/r2"
+	"github.com/pkg/errors"
+
+	"github.com/viam-modules/viam-cartographer/postprocess"
+	s "github.com/viam-modules/viam-cartographer/sensors"
+)
+
+const (
+	// MapCropMappingBounds is the value of a map crop that crops to the mapping bounds.
+	MapCropMappingBounds = "mapping_bounds"
+	// mapCropPolygonKey is the key of the vertices of a map crop that crops to a polygon.
+	mapCropPolygonKey = "polygon"
+)
+
+// mapCrop is the region an exported map is cropped to, either the mapping bounds at the time of the export, a
+// fixed box or a fixed polygon.
+type mapCrop struct {
+	mappingBounds bool
+	box           postprocess.Box
+	polygon       *s.MappingBounds
+}
+
+// mapCropRegion is the region of a map crop at the time of an export.
+type mapCropRegion struct {
+	// box is the box, in millimeters, that encloses the region, which an exported grid covers.
+	box postprocess.Box
+	// polygon is the polygon the map is cropped to, nil if it is cropped to box.
+	polygon *s.MappingBounds
+}
+
+// parseMapCrop parses a map crop from MapCropMappingBounds, a box in the format of postprocess_crop or a polygon of
+// at least three vertices in the format of the polygon of the mapping_bounds config.
+func parseMapCrop(val interface{}) (mapCrop, error) {
+	if str, ok := val.(string); ok {
+		if str != MapCropMappingBounds {
+			return mapCrop{}, ErrBadMapCrop
+		}
+		return mapCrop{mappingBounds: true}, nil
+	}
+	if valMap, ok := val.(map[string]interface{}); ok && valMap[mapCropPolygonKey] != nil {
+		decoded, err := decodeDoCommandArg[struct {
+			Polygon []r2.Point `json:"polygon"`
+		}](val)
+		if err != nil {
+			return mapCrop{}, errors.Wrap(ErrBadMapCrop, err.Error())
+		}
+		polygon, err := s.NewMappingBounds(decoded.Polygon, false)
+		if err != nil {
+			return mapCrop{}, errors.Wrap(ErrBadMapCrop, err.Error())
+		}
+		return mapCrop{polygon: polygon}, nil
+	}
+	task, err := postprocess.ParseCropDoCommand(val)
+	if err != nil {
+		return mapCrop{}, errors.Wrap(ErrBadMapCrop, err.Error())
+	}
+	return mapCrop{box: task.Box}, nil
+}
+
+// mapCropRegion returns the region crop crops the map to, which is the polygon of the mapping bounds as they are at
+// the time of the call if crop is MapCropMappingBounds.
+func (cartoSvc *CartographerService) mapCropRegion(crop mapCrop) (mapCropRegion, error) {
+	polygon := crop.polygon
+	if crop.mappingBounds {
+		if polygon = cartoSvc.mappingBounds.Load(); polygon == nil {
+			return mapCropRegion{}, ErrNoMappingBounds
+		}
+	}
+	if polygon == nil {
+		return mapCropRegion{box: crop.box}, nil
+	}
+	box := postprocess.Box{MinX: math.Inf(1), MinY: math.Inf(1), MaxX: math.Inf(-1), MaxY: math.Inf(-1)}
+	for _, v := range polygon.Vertices() {
+		box.MinX = math.Min(box.MinX, v.X)
+		box.MinY = math.Min(box.MinY, v.Y)
+		box.MaxX = math.Max(box.MaxX, v.X)
+		box.MaxY = math.Max(box.MaxY, v.Y)
+	}
+	return mapCropRegion{box: box, polygon: polygon}, nil
+}
+
+// crop removes the points of pcd outside of the region. A box is cropped to with a crop task that is applied once
+// rather than registered as a postprocessing task, a polygon as the mapping bounds clip the map.
+func (region mapCropRegion) crop(pcd []byte) ([]byte, error) {
+	if region.polygon != nil {
+		return region.polygon.ClipPointCloud(pcd)
+	}
+	var cropped []byte
+	if err := postprocess.UpdatePointCloud(pcd, &cropped, []postprocess.Task{{Instruction: postprocess.Crop, Box: region.box}}); err != nil {
+		return nil, err
+	}
+	return cropped, nil
+}
@@ -0,0 +1,223 @@
+package viamcartographer
+
+import (
+	"bytes"
+	"context"
+	"image/color"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/golang/geo/r3"
+	"go.viam.com/rdk/pointcloud"
+)
+
+const (
+	// mapDeltaRevisions is the number of most recent revisions whose changes are kept.
+	mapDeltaRevisions = 20
+	// mapRevisionPollInterval is the interval the map is diffed against its latest revision at.
+	mapRevisionPollInterval = 5 * time.Second
+	// mapRevisionIdleTimeout is how long the map keeps being diffed after the last get_map_delta request.
+	mapRevisionIdleTimeout = time.Minute
+	// GetMapDeltaCommand is sent to DoCommand to get the points that changed since a revision of the map.
+	GetMapDeltaCommand = "get_map_delta"
+	// MapRevisionKey is the key of the revision of the map.
+	MapRevisionKey = "revision"
+	// FullRefreshRequiredKey denotes that the get_map_delta response holds the full map.
+	FullRefreshRequiredKey = "full_refresh_required"
+)
+
+// mapDeltaPoint is a point of the map in the spatial hash of a map revision, keyed by its coordinates rounded to
+// the millimeter, which is far below the resolution of the map.
+type mapDeltaPoint struct {
+	x, y, z int64
+}
+
+func newMapDeltaPoint(p r3.Vector) mapDeltaPoint {
+	return mapDeltaPoint{x: int64(math.Round(p.X)), y: int64(math.Round(p.Y)), z: int64(math.Round(p.Z))}
+}
+
+// mapDeltaData is a point of the map as read from the pointcloud.
+type mapDeltaData struct {
+	point r3.Vector
+	color color.NRGBA
+}
+
+// mapRevisionChange holds the points that were added to the map, or whose color changed, in a revision, and
+// whether any were removed.
+type mapRevisionChange struct {
+	revision int
+	added    map[mapDeltaPoint]mapDeltaData
+	removed  bool
+}
+
+// mapRevisions numbers the distinct versions of the pointcloud map that the map revision tracker has seen, and
+// keeps the changes of the most recent ones, so that clients can fetch the points added since the revision they
+// last saw rather than the whole map. It is safe for concurrent use.
+type mapRevisions struct {
+	mu sync.Mutex
+	// revision is the revision of points, 0 until a map has been seen.
+	revision int
+	points   map[mapDeltaPoint]mapDeltaData
+	pcd      []byte
+	changes  []mapRevisionChange
+	// lastRequested is when get_map_delta was last requested, the map is only diffed while it is in use.
+	lastRequested time.Time
+}
+
+// mapDelta is the response to a client that saw the map at some revision.
+type mapDelta struct {
+	revision int
+	// fullRefreshRequired denotes that the points added since the revision of the client are unavailable, so that
+	// pcd holds the full map rather than those points.
+	fullRefreshRequired bool
+	pcd                 []byte
+	numPoints           int
+}
+
+// update diffs the map against the latest revision and starts a new revision if it differs.
+func (revisions *mapRevisions) update(pcd []byte) error {
+	pc, err := pointcloud.ReadPCD(bytes.NewReader(pcd))
+	if err != nil {
+		return err
+	}
+	points := make(map[mapDeltaPoint]mapDeltaData, pc.Size())
+	pc.Iterate(0, 0, func(p r3.Vector, d pointcloud.Data) bool {
+		var c color.NRGBA
+		if d != nil && d.HasColor() {
+			r, g, b := d.RGB255()
+			c = color.NRGBA{R: r, G: g, B: b, A: 255}
+		}
+		points[newMapDeltaPoint(p)] = mapDeltaData{point: p, color: c}
+		return true
+	})
+
+	revisions.mu.Lock()
+	defer revisions.mu.Unlock()
+	change := mapRevisionChange{revision: revisions.revision + 1, added: map[mapDeltaPoint]mapDeltaData{}}
+	for p, data := range points {
+		if previous, ok := revisions.points[p]; !ok || previous.color != data.color {
+			change.added[p] = data
+		}
+	}
+	for p := range revisions.points {
+		if _, ok := points[p]; !ok {
+			change.removed = true
+			break
+		}
+	}
+	if revisions.revision > 0 && len(change.added) == 0 && !change.removed {
+		return nil
+	}
+
+	revisions.revision = change.revision
+	revisions.points = points
+	revisions.pcd = pcd
+	revisions.changes = append(revisions.changes, change)
+	if len(revisions.changes) > mapDeltaRevisions {
+		revisions.changes = revisions.changes[len(revisions.changes)-mapDeltaRevisions:]
+	}
+	return nil
+}
+
+// request records that get_map_delta was requested at now.
+func (revisions *mapRevisions) request(now time.Time) {
+	revisions.mu.Lock()
+	defer revisions.mu.Unlock()
+	revisions.lastRequested = now
+}
+
+// inUse returns whether get_map_delta was requested within mapRevisionIdleTimeout of now.
+func (revisions *mapRevisions) inUse(now time.Time) bool {
+	revisions.mu.Lock()
+	defer revisions.mu.Unlock()
+	return !revisions.lastRequested.IsZero() && now.Sub(revisions.lastRequested) < mapRevisionIdleTimeout
+}
+
+// startMapRevisionTracker diffs the map against its latest revision every mapRevisionPollInterval until ctx is
+// done, while get_map_delta is in use. The revisions thereby follow the changes of the map at a steady pace, rather
+// than the requests of the clients, and get_map_delta answers from them without getting the map.
+func startMapRevisionTracker(ctx context.Context, cartoSvc *CartographerService) {
+	cartoSvc.goWorker("map_revision_tracker", func(w *worker) {
+		ticker := time.NewTicker(mapRevisionPollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			w.heartbeat()
+			if !cartoSvc.mapRevisions.inUse(time.Now()) || cartoSvc.cartofacade.Unresponsive() {
+				// the request would wait on the hung call
+				continue
+			}
+			if err := cartoSvc.updateMapRevisions(ctx); err != nil {
+				cartoSvc.logger.Debugw("could not get the map to diff it against its latest revision", "error", err)
+			}
+		}
+	})
+}
+
+// updateMapRevisions gets the map and diffs it against the latest revision. The revisions are shared by all
+// callers, so the map ignores the postprocessing override of sessions.
+func (cartoSvc *CartographerService) updateMapRevisions(ctx context.Context) error {
+	pc, err := cartoSvc.pointCloudMap(ctx, cartoSvc.pointCloudMapOptions(context.Background(), false))
+	if err != nil {
+		return err
+	}
+	return cartoSvc.mapRevisions.update(pc)
+}
+
+// current returns the latest revision.
+func (revisions *mapRevisions) current() int {
+	revisions.mu.Lock()
+	defer revisions.mu.Unlock()
+	return revisions.revision
+}
+
+// delta returns the points that were added to the map, or whose color changed, since the given revision. The full
+// map is returned instead if the changes since then are no longer kept, include removed points, or hold at least
+// as many points as the full map. A negative revision requests the full map.
+func (revisions *mapRevisions) delta(since int) (mapDelta, error) {
+	revisions.mu.Lock()
+	defer revisions.mu.Unlock()
+	fullRefresh := mapDelta{
+		revision:            revisions.revision,
+		fullRefreshRequired: true,
+		pcd:                 revisions.pcd,
+		numPoints:           len(revisions.points),
+	}
+	if since < 0 || since > revisions.revision || len(revisions.changes) == 0 ||
+		since < revisions.changes[0].revision-1 {
+		return fullRefresh, nil
+	}
+
+	added := map[mapDeltaPoint]mapDeltaData{}
+	for _, change := range revisions.changes {
+		if change.revision <= since {
+			continue
+		}
+		if change.removed {
+			return fullRefresh, nil
+		}
+		for p, data := range change.added {
+			added[p] = data
+		}
+	}
+	if len(added) > 0 && len(added) >= len(revisions.points) {
+		return fullRefresh, nil
+	}
+
+	pc := pointcloud.NewWithPrealloc(len(added))
+	for _, data := range added {
+		if err := pc.Set(data.point, pointcloud.NewColoredData(data.color)); err != nil {
+			return mapDelta{}, err
+		}
+	}
+	var buf bytes.Buffer
+	if err := pointcloud.ToPCD(pc, &buf, pointcloud.PCDBinary); err != nil {
+		return mapDelta{}, err
+	}
+	return mapDelta{revision: revisions.revision, pcd: buf.Bytes(), numPoints: len(added)}, nil
+}
@@ -0,0 +1,162 @@
+package viamcartographer
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"testing"
+	"time"
+
+	"github.com/golang/geo/r3"
+	"github.com/pkg/errors"
+	"go.viam.com/rdk/logging"
+	"go.viam.com/rdk/pointcloud"
+	"go.viam.com/test"
+
+	"github.com/viam-modules/viam-cartographer/cartofacade"
+	"github.com/viam-modules/viam-cartographer/testhelper/pcdtest"
+)
+
+func TestGetMapDeltaCommand(t *testing.T) {
+	var points []r3.Vector
+	var numPointCloudMapCalls int
+	mockCartoFacade := &cartofacade.Mock{}
+	mockCartoFacade.PointCloudMapFunc = func(ctx context.Context, timeout time.Duration) ([]byte, error) {
+		numPointCloudMapCalls++
+		return pcdtest.PointsToPCD(t, points), nil
+	}
+	svc := newTestService(mockCartoFacade, logging.NewTestLogger(t))
+	getMapDelta := func(val interface{}) (int, bool, []r3.Vector) {
+		resp, err := svc.DoCommand(context.Background(), map[string]interface{}{GetMapDeltaCommand: val})
+		test.That(t, err, test.ShouldBeNil)
+		pcd, err := base64.StdEncoding.DecodeString(resp[GetMapDeltaCommand].(string))
+		test.That(t, err, test.ShouldBeNil)
+		pc, err := pointcloud.ReadPCD(bytes.NewReader(pcd))
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, resp["num_points"], test.ShouldEqual, pc.Size())
+		var deltaPoints []r3.Vector
+		pc.Iterate(0, 0, func(p r3.Vector, d pointcloud.Data) bool {
+			deltaPoints = append(deltaPoints, p)
+			return true
+		})
+		return resp[MapRevisionKey].(int), resp[FullRefreshRequiredKey].(bool), deltaPoints
+	}
+	// trackMap diffs the map against the latest revision as the map revision tracker does on every tick
+	trackMap := func() {
+		test.That(t, svc.updateMapRevisions(context.Background()), test.ShouldBeNil)
+	}
+	for x := 0.0; x < 10; x++ {
+		points = append(points, r3.Vector{X: x * 50})
+	}
+
+	t.Run("get_map_delta returns the full map at the first revision", func(t *testing.T) {
+		revision, fullRefresh, deltaPoints := getMapDelta(nil)
+		test.That(t, revision, test.ShouldEqual, 1)
+		test.That(t, fullRefresh, test.ShouldBeTrue)
+		test.That(t, len(deltaPoints), test.ShouldEqual, 10)
+	})
+
+	t.Run("get_map_delta keeps the revision while the map does not change", func(t *testing.T) {
+		trackMap()
+		revision, fullRefresh, deltaPoints := getMapDelta(1.0)
+		test.That(t, revision, test.ShouldEqual, 1)
+		test.That(t, fullRefresh, test.ShouldBeFalse)
+		test.That(t, deltaPoints, test.ShouldBeEmpty)
+	})
+
+	t.Run("get_map_delta returns only the points added since the given revision", func(t *testing.T) {
+		points = append(points, r3.Vector{Y: 50})
+		trackMap()
+		revision, fullRefresh, deltaPoints := getMapDelta(1.0)
+		test.That(t, revision, test.ShouldEqual, 2)
+		test.That(t, fullRefresh, test.ShouldBeFalse)
+		test.That(t, deltaPoints, test.ShouldResemble, []r3.Vector{{Y: 50}})
+
+		points = append(points, r3.Vector{Y: 100})
+		trackMap()
+		revision, fullRefresh, deltaPoints = getMapDelta(2.0)
+		test.That(t, revision, test.ShouldEqual, 3)
+		test.That(t, fullRefresh, test.ShouldBeFalse)
+		test.That(t, deltaPoints, test.ShouldResemble, []r3.Vector{{Y: 100}})
+
+		revision, fullRefresh, deltaPoints = getMapDelta(1.0)
+		test.That(t, revision, test.ShouldEqual, 3)
+		test.That(t, fullRefresh, test.ShouldBeFalse)
+		test.That(t, len(deltaPoints), test.ShouldEqual, 2)
+	})
+
+	t.Run("get_map_delta requires a full refresh for an unknown revision", func(t *testing.T) {
+		for _, val := range []interface{}{nil, 4.0} {
+			revision, fullRefresh, deltaPoints := getMapDelta(val)
+			test.That(t, revision, test.ShouldEqual, 3)
+			test.That(t, fullRefresh, test.ShouldBeTrue)
+			test.That(t, len(deltaPoints), test.ShouldEqual, 12)
+		}
+	})
+
+	t.Run("get_map_delta requires a full refresh once points are removed", func(t *testing.T) {
+		points = points[1:]
+		trackMap()
+		revision, fullRefresh, deltaPoints := getMapDelta(3.0)
+		test.That(t, revision, test.ShouldEqual, 4)
+		test.That(t, fullRefresh, test.ShouldBeTrue)
+		test.That(t, len(deltaPoints), test.ShouldEqual, 11)
+
+		points = append(points, r3.Vector{Y: 150})
+		trackMap()
+		revision, fullRefresh, deltaPoints = getMapDelta(4.0)
+		test.That(t, revision, test.ShouldEqual, 5)
+		test.That(t, fullRefresh, test.ShouldBeFalse)
+		test.That(t, deltaPoints, test.ShouldResemble, []r3.Vector{{Y: 150}})
+	})
+
+	t.Run("get_map_delta requires a full refresh once the revision is no longer kept", func(t *testing.T) {
+		for i := 1; i <= mapDeltaRevisions; i++ {
+			points = append(points, r3.Vector{Z: float64(i) * 50})
+			trackMap()
+		}
+		revision, fullRefresh, _ := getMapDelta(4.0)
+		test.That(t, revision, test.ShouldEqual, 5+mapDeltaRevisions)
+		test.That(t, fullRefresh, test.ShouldBeTrue)
+
+		revision, fullRefresh, deltaPoints := getMapDelta(5.0)
+		test.That(t, revision, test.ShouldEqual, 5+mapDeltaRevisions)
+		test.That(t, fullRefresh, test.ShouldBeFalse)
+		test.That(t, len(deltaPoints), test.ShouldEqual, mapDeltaRevisions)
+	})
+
+	t.Run("get_map_delta requires a full refresh when the delta is as large as the map", func(t *testing.T) {
+		points = []r3.Vector{{X: 1000}}
+		trackMap()
+		revision, fullRefresh, deltaPoints := getMapDelta(float64(5 + mapDeltaRevisions))
+		test.That(t, revision, test.ShouldEqual, 6+mapDeltaRevisions)
+		test.That(t, fullRefresh, test.ShouldBeTrue)
+		test.That(t, deltaPoints, test.ShouldResemble, []r3.Vector{{X: 1000}})
+	})
+
+	t.Run("get_map_delta answers from the revisions without getting the map", func(t *testing.T) {
+		numPointCloudMapCalls = 0
+		points = append(points, r3.Vector{X: 2000})
+		revision, fullRefresh, deltaPoints := getMapDelta(float64(6 + mapDeltaRevisions))
+		test.That(t, revision, test.ShouldEqual, 6+mapDeltaRevisions)
+		test.That(t, fullRefresh, test.ShouldBeFalse)
+		test.That(t, deltaPoints, test.ShouldBeEmpty)
+		test.That(t, numPointCloudMapCalls, test.ShouldEqual, 0)
+	})
+
+	t.Run("the map is only diffed while get_map_delta is in use", func(t *testing.T) {
+		now := time.Now()
+		test.That(t, svc.mapRevisions.inUse(now), test.ShouldBeTrue)
+		test.That(t, svc.mapRevisions.inUse(now.Add(mapRevisionIdleTimeout)), test.ShouldBeFalse)
+		test.That(t, (&mapRevisions{}).inUse(now), test.ShouldBeFalse)
+	})
+
+	t.Run("get_map_delta fails for an invalid revision", func(t *testing.T) {
+		for _, val := range []interface{}{-1.0, 1.5, "1"} {
+			resp, err := svc.DoCommand(context.Background(), map[string]interface{}{GetMapDeltaCommand: val})
+			test.That(t, errors.Is(err, ErrBadMapRevision), test.ShouldBeTrue)
+			test.That(t, err.Error(), test.ShouldStartWith, "invalid argument for "+GetMapDeltaCommand+": ")
+			test.That(t, resp, test.ShouldBeNil)
+		}
+	})
+}
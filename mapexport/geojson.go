@@ -0,0 +1,259 @@
+// Package mapexport converts the pointcloud map into lightweight formats for consumers that do not need all of its
+// points, e.g. the outline of the mapped area for a fleet dashboard
+package mapexport
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"sort"
+
+	"github.com/golang/geo/r3"
+	"github.com/pkg/errors"
+	"go.viam.com/rdk/pointcloud"
+)
+
+// maxCells bounds the size of the grid the outline is traced on, which covers the bounding box of the map.
+const maxCells = 25_000_000
+
+// OutlineOptions determine which points of the map the outline covers and how fine it is.
+type OutlineOptions struct {
+	// ResolutionMm is the size, in millimeters, of the cells of the grid the points are binned into. The vertices of
+	// the outline lie on the corners of the cells.
+	ResolutionMm float64
+	// MinProbability is the probability, in percent, a point of the map must have at least to be covered. 0 covers
+	// every point of the map, i.e. the whole mapped area, 51 only the occupied ones.
+	MinProbability int
+}
+
+// Outline is the outline of the map as a GeoJSON FeatureCollection.
+type Outline struct {
+	// GeoJSON has a Polygon Feature for every region of the map that is disconnected from the others, ordered by
+	// area, largest first. The coordinates are in millimeters in the map frame rather than in longitude and
+	// latitude. The exterior rings are counterclockwise and holes in the regions are filled, so that a region
+	// has no interior rings. Every Feature has the area of its region in square millimeters as area_mm2.
+	GeoJSON []byte
+	// NumPolygons is the number of Features of GeoJSON.
+	NumPolygons int
+}
+
+type featureCollection struct {
+	Type     string    `json:"type"`
+	Features []feature `json:"features"`
+}
+
+type feature struct {
+	Type       string                 `json:"type"`
+	Geometry   polygon                `json:"geometry"`
+	Properties map[string]interface{} `json:"properties"`
+}
+
+type polygon struct {
+	Type        string         `json:"type"`
+	Coordinates [][][2]float64 `json:"coordinates"`
+}
+
+// vertex is a corner of a cell of the grid, in cells.
+type vertex struct {
+	x, y int
+}
+
+// edge is a side of a cell that lies on the outline, directed so that the cell is on its left.
+type edge struct {
+	from, to vertex
+}
+
+// OutlineGeoJSON projects the points of the pointcloud map pcd, whose coordinates are in meters and read in
+// millimeters, onto the XY plane and returns the outline of the cells of the resolution of opts that hold points.
+// Cells that touch only at their corners belong to separate regions. An empty pcd is an empty map, whose outline
+// has no Features.
+func OutlineGeoJSON(pcd []byte, opts OutlineOptions) (*Outline, error) {
+	if opts.ResolutionMm <= 0 {
+		return nil, errors.New("the resolution of the outline must be greater than zero")
+	}
+
+	type cell struct {
+		x, y int
+	}
+	cells := map[cell]struct{}{}
+	minCell := cell{x: math.MaxInt, y: math.MaxInt}
+	maxCell := cell{x: math.MinInt, y: math.MinInt}
+	if len(pcd) > 0 {
+		pc, err := pointcloud.ReadPCD(bytes.NewReader(pcd))
+		if err != nil {
+			return nil, err
+		}
+		pc.Iterate(0, 0, func(p r3.Vector, d pointcloud.Data) bool {
+			if opts.MinProbability > 0 {
+				if d == nil || !d.HasColor() {
+					return true
+				}
+				if _, _, probability := d.RGB255(); int(probability) < opts.MinProbability {
+					return true
+				}
+			}
+			c := cell{x: int(math.Floor(p.X / opts.ResolutionMm)), y: int(math.Floor(p.Y / opts.ResolutionMm))}
+			cells[c] = struct{}{}
+			minCell = cell{x: min(minCell.x, c.x), y: min(minCell.y, c.y)}
+			maxCell = cell{x: max(maxCell.x, c.x), y: max(maxCell.y, c.y)}
+			return true
+		})
+	}
+	if len(cells) == 0 {
+		return toOutline(nil)
+	}
+
+	// the grid has a border of empty cells, from which the cells outside of the regions are flooded
+	width, height := maxCell.x-minCell.x+3, maxCell.y-minCell.y+3
+	if width*height > maxCells {
+		return nil, errors.Errorf("an outline of %dx%d cells at a resolution of %g millimeters exceeds %d cells, "+
+			"request a coarser resolution", width-2, height-2, opts.ResolutionMm, maxCells)
+	}
+	filled := make([]bool, width*height)
+	for c := range cells {
+		filled[(c.y-minCell.y+1)*width+c.x-minCell.x+1] = true
+	}
+	fillHoles(filled, width, height)
+
+	loops := traceLoops(filled, width, height)
+	features := make([]feature, 0, len(loops))
+	for _, loop := range loops {
+		ring := make([][2]float64, 0, len(loop)+1)
+		for _, v := range append(loop, loop[0]) {
+			ring = append(ring, [2]float64{
+				float64(v.x+minCell.x-1) * opts.ResolutionMm,
+				float64(v.y+minCell.y-1) * opts.ResolutionMm,
+			})
+		}
+		features = append(features, feature{
+			Type:       "Feature",
+			Geometry:   polygon{Type: "Polygon", Coordinates: [][][2]float64{ring}},
+			Properties: map[string]interface{}{"area_mm2": ringArea(ring)},
+		})
+	}
+	sort.SliceStable(features, func(i, j int) bool {
+		return features[i].Properties["area_mm2"].(float64) > features[j].Properties["area_mm2"].(float64)
+	})
+	return toOutline(features)
+}
+
+// toOutline encodes the features as a FeatureCollection.
+func toOutline(features []feature) (*Outline, error) {
+	if features == nil {
+		features = []feature{}
+	}
+	geoJSON, err := json.Marshal(featureCollection{Type: "FeatureCollection", Features: features})
+	if err != nil {
+		return nil, err
+	}
+	return &Outline{GeoJSON: geoJSON, NumPolygons: len(features)}, nil
+}
+
+// fillHoles fills the cells of the grid that can not be reached from its border without crossing a filled cell.
+func fillHoles(filled []bool, width, height int) {
+	outside := make([]bool, len(filled))
+	outside[0] = true
+	stack := []int{0}
+	for len(stack) > 0 {
+		i := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		x, y := i%width, i/width
+		for _, n := range [][2]int{{x - 1, y}, {x + 1, y}, {x, y - 1}, {x, y + 1}} {
+			if n[0] < 0 || n[0] >= width || n[1] < 0 || n[1] >= height {
+				continue
+			}
+			j := n[1]*width + n[0]
+			if !filled[j] && !outside[j] {
+				outside[j] = true
+				stack = append(stack, j)
+			}
+		}
+	}
+	for i := range filled {
+		filled[i] = !outside[i]
+	}
+}
+
+// traceLoops returns the boundaries of the filled cells of the grid as closed loops of vertices, counterclockwise
+// and without the vertices in between collinear edges. The grid has no holes, so every loop is the boundary of a
+// region.
+func traceLoops(filled []bool, width, height int) [][]vertex {
+	isFilled := func(x, y int) bool {
+		return x >= 0 && x < width && y >= 0 && y < height && filled[y*width+x]
+	}
+	var edges []edge
+	outgoing := map[vertex][]edge{}
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			if !isFilled(x, y) {
+				continue
+			}
+			var sides []edge
+			if !isFilled(x, y-1) {
+				sides = append(sides, edge{vertex{x, y}, vertex{x + 1, y}})
+			}
+			if !isFilled(x+1, y) {
+				sides = append(sides, edge{vertex{x + 1, y}, vertex{x + 1, y + 1}})
+			}
+			if !isFilled(x, y+1) {
+				sides = append(sides, edge{vertex{x + 1, y + 1}, vertex{x, y + 1}})
+			}
+			if !isFilled(x-1, y) {
+				sides = append(sides, edge{vertex{x, y + 1}, vertex{x, y}})
+			}
+			for _, side := range sides {
+				edges = append(edges, side)
+				outgoing[side.from] = append(outgoing[side.from], side)
+			}
+		}
+	}
+
+	used := map[edge]bool{}
+	var loops [][]vertex
+	for _, start := range edges {
+		if used[start] {
+			continue
+		}
+		var loop []vertex
+		for current := start; !used[current]; {
+			used[current] = true
+			next := nextEdge(current, outgoing[current.to])
+			if direction(next) != direction(current) {
+				loop = append(loop, current.to)
+			}
+			current = next
+		}
+		loops = append(loops, loop)
+	}
+	return loops
+}
+
+// nextEdge returns which of the candidates continues the outline after current. Two candidates meet where two
+// cells touch only at their corners, which are kept in separate regions by turning left.
+func nextEdge(current edge, candidates []edge) edge {
+	if len(candidates) == 1 {
+		return candidates[0]
+	}
+	d := direction(current)
+	left := vertex{x: -d.y, y: d.x}
+	for _, candidate := range candidates {
+		if direction(candidate) == left {
+			return candidate
+		}
+	}
+	return candidates[0]
+}
+
+// direction returns the unit vector of the edge.
+func direction(e edge) vertex {
+	return vertex{x: e.to.x - e.from.x, y: e.to.y - e.from.y}
+}
+
+// ringArea returns the area enclosed by the closed counterclockwise ring.
+func ringArea(ring [][2]float64) float64 {
+	area := 0.0
+	for i := 0; i+1 < len(ring); i++ {
+		area += ring[i][0]*ring[i+1][1] - ring[i+1][0]*ring[i][1]
+	}
+	return area / 2
+}
@@ -0,0 +1,143 @@
+package mapexport
+
+import (
+	"bytes"
+	"encoding/json"
+	"image/color"
+	"testing"
+
+	"github.com/golang/geo/r3"
+	"go.viam.com/rdk/pointcloud"
+	"go.viam.com/test"
+)
+
+// toPCD returns a pointcloud map with a point, in millimeters, at the center of each of the 100 millimeter cells,
+// with the probability in the blue channel of its color.
+func toPCD(t *testing.T, probability uint8, cells ...[2]int) []byte {
+	t.Helper()
+	pc := pointcloud.New()
+	for _, c := range cells {
+		p := r3.Vector{X: float64(c[0])*100 + 50, Y: float64(c[1])*100 + 50}
+		test.That(t, pc.Set(p, pointcloud.NewColoredData(color.NRGBA{B: probability})), test.ShouldBeNil)
+	}
+	var buf bytes.Buffer
+	test.That(t, pointcloud.ToPCD(pc, &buf, pointcloud.PCDBinary), test.ShouldBeNil)
+	return buf.Bytes()
+}
+
+// decode returns the rings and areas of the features of the outline.
+func decode(t *testing.T, outline *Outline) ([][][2]float64, []float64) {
+	t.Helper()
+	var collection featureCollection
+	test.That(t, json.Unmarshal(outline.GeoJSON, &collection), test.ShouldBeNil)
+	test.That(t, collection.Type, test.ShouldEqual, "FeatureCollection")
+	test.That(t, collection.Features, test.ShouldHaveLength, outline.NumPolygons)
+	var rings [][][2]float64
+	var areas []float64
+	for _, f := range collection.Features {
+		test.That(t, f.Type, test.ShouldEqual, "Feature")
+		test.That(t, f.Geometry.Type, test.ShouldEqual, "Polygon")
+		test.That(t, f.Geometry.Coordinates, test.ShouldHaveLength, 1)
+		ring := f.Geometry.Coordinates[0]
+		test.That(t, ring[0], test.ShouldResemble, ring[len(ring)-1])
+		rings = append(rings, ring)
+		areas = append(areas, f.Properties["area_mm2"].(float64))
+	}
+	return rings, areas
+}
+
+func TestOutlineGeoJSON(t *testing.T) {
+	opts := OutlineOptions{ResolutionMm: 100}
+
+	t.Run("an empty map has no features", func(t *testing.T) {
+		for _, pcd := range [][]byte{nil, toPCD(t, 0)} {
+			outline, err := OutlineGeoJSON(pcd, opts)
+			test.That(t, err, test.ShouldBeNil)
+			test.That(t, outline.NumPolygons, test.ShouldEqual, 0)
+			test.That(t, string(outline.GeoJSON), test.ShouldEqual, `{"type":"FeatureCollection","features":[]}`)
+		}
+	})
+
+	t.Run("outlines a block of cells counterclockwise in millimeters", func(t *testing.T) {
+		outline, err := OutlineGeoJSON(toPCD(t, 0, [2]int{1, 2}, [2]int{2, 2}, [2]int{1, 3}, [2]int{2, 3}), opts)
+		test.That(t, err, test.ShouldBeNil)
+		rings, areas := decode(t, outline)
+		test.That(t, rings, test.ShouldResemble, [][][2]float64{
+			{{300, 200}, {300, 400}, {100, 400}, {100, 200}, {300, 200}},
+		})
+		test.That(t, areas, test.ShouldResemble, []float64{40000})
+	})
+
+	t.Run("fills the holes of a region", func(t *testing.T) {
+		// the walls of a 5x4 room
+		var walls [][2]int
+		for x := 0; x < 5; x++ {
+			walls = append(walls, [2]int{x, 0}, [2]int{x, 3})
+		}
+		for y := 1; y < 3; y++ {
+			walls = append(walls, [2]int{0, y}, [2]int{4, y})
+		}
+		outline, err := OutlineGeoJSON(toPCD(t, 0, walls...), opts)
+		test.That(t, err, test.ShouldBeNil)
+		rings, areas := decode(t, outline)
+		test.That(t, rings, test.ShouldResemble, [][][2]float64{
+			{{500, 0}, {500, 400}, {0, 400}, {0, 0}, {500, 0}},
+		})
+		test.That(t, areas, test.ShouldResemble, []float64{200000})
+	})
+
+	t.Run("has a polygon for every disconnected region, largest first", func(t *testing.T) {
+		outline, err := OutlineGeoJSON(toPCD(t, 0,
+			[2]int{-5, -5},
+			[2]int{0, 0}, [2]int{1, 0}, [2]int{2, 0}, [2]int{2, 1},
+		), opts)
+		test.That(t, err, test.ShouldBeNil)
+		rings, areas := decode(t, outline)
+		test.That(t, rings, test.ShouldResemble, [][][2]float64{
+			{{300, 0}, {300, 200}, {200, 200}, {200, 100}, {0, 100}, {0, 0}, {300, 0}},
+			{{-400, -500}, {-400, -400}, {-500, -400}, {-500, -500}, {-400, -500}},
+		})
+		test.That(t, areas, test.ShouldResemble, []float64{40000, 10000})
+	})
+
+	t.Run("cells that touch only at their corners are separate regions", func(t *testing.T) {
+		outline, err := OutlineGeoJSON(toPCD(t, 0, [2]int{0, 0}, [2]int{1, 1}), opts)
+		test.That(t, err, test.ShouldBeNil)
+		rings, areas := decode(t, outline)
+		test.That(t, rings, test.ShouldHaveLength, 2)
+		test.That(t, rings, test.ShouldContain, [][2]float64{{100, 0}, {100, 100}, {0, 100}, {0, 0}, {100, 0}})
+		test.That(t, rings, test.ShouldContain, [][2]float64{{200, 100}, {200, 200}, {100, 200}, {100, 100}, {200, 100}})
+		test.That(t, areas, test.ShouldResemble, []float64{10000, 10000})
+	})
+
+	t.Run("covers only the points of at least the minimum probability", func(t *testing.T) {
+		pc := pointcloud.New()
+		test.That(t, pc.Set(r3.Vector{X: 50, Y: 50}, pointcloud.NewColoredData(color.NRGBA{B: 100})), test.ShouldBeNil)
+		test.That(t, pc.Set(r3.Vector{X: 550, Y: 50}, pointcloud.NewColoredData(color.NRGBA{B: 10})), test.ShouldBeNil)
+		var buf bytes.Buffer
+		test.That(t, pointcloud.ToPCD(pc, &buf, pointcloud.PCDBinary), test.ShouldBeNil)
+
+		outline, err := OutlineGeoJSON(buf.Bytes(), opts)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, outline.NumPolygons, test.ShouldEqual, 2)
+
+		outline, err = OutlineGeoJSON(buf.Bytes(), OutlineOptions{ResolutionMm: 100, MinProbability: 51})
+		test.That(t, err, test.ShouldBeNil)
+		rings, _ := decode(t, outline)
+		test.That(t, rings, test.ShouldResemble, [][][2]float64{
+			{{100, 0}, {100, 100}, {0, 100}, {0, 0}, {100, 0}},
+		})
+	})
+
+	t.Run("fails for an invalid resolution or a grid that is too large", func(t *testing.T) {
+		_, err := OutlineGeoJSON(toPCD(t, 0, [2]int{0, 0}), OutlineOptions{})
+		test.That(t, err, test.ShouldBeError, "the resolution of the outline must be greater than zero")
+
+		_, err = OutlineGeoJSON(toPCD(t, 0, [2]int{0, 0}, [2]int{10000, 10000}), opts)
+		test.That(t, err, test.ShouldNotBeNil)
+		test.That(t, err.Error(), test.ShouldContainSubstring, "request a coarser resolution")
+
+		_, err = OutlineGeoJSON([]byte("not a pcd"), opts)
+		test.That(t, err, test.ShouldNotBeNil)
+	})
+}
@@ -0,0 +1,192 @@
+package viamcartographer
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/viam-modules/viam-cartographer/cartofacade"
+)
+
+const (
+	// MapStalledKey denotes whether the map stopped changing with the lidar readings.
+	MapStalledKey = "map_stalled"
+)
+
+// mapGrowth tracks whether the map changes with the lidar readings added to cartographer in mapping mode.
+// Cartographer has been seen to silently stop updating the map, which leaves a frozen map without an error
+// anywhere. It is only accessed by the map growth monitor, and reset while none is running.
+type mapGrowth struct {
+	size    mapSize
+	hasSize bool
+	// lidarReadingsAtLastGrowth is the number of lidar readings that had been added when the size of the map last
+	// changed.
+	lidarReadingsAtLastGrowth int64
+	// lidarReadingsAtLastCheck is the number of lidar readings that had been added at the last check.
+	lidarReadingsAtLastCheck int64
+}
+
+// mapSize is how far the map has grown, as cartographer reports it without serializing the map.
+type mapSize struct {
+	// insertions grows with every lidar reading inserted into the map: it is the sum of the versions of the
+	// submaps, or the number of nodes of the pose graph if cartographer does not report its submaps.
+	insertions int
+	// numSubmaps is the number of submaps, -1 if cartographer does not report its submaps.
+	numSubmaps int
+}
+
+// mapGrowthMonitor runs the map growth monitor along with the sensor processes while the service is in mapping
+// mode, which set_mode switches in and out of while they run.
+type mapGrowthMonitor struct {
+	mu sync.Mutex
+	// ctx is the context of the sensor processes the monitor runs along with, nil until they are started.
+	ctx context.Context
+	// stop cancels the monitor and waits for it to return, nil while it is not running.
+	stop func()
+}
+
+// resetMapGrowthMonitor ties the map growth monitor to the sensor processes that run with ctx, stopping the one of
+// the previous sensor processes, and starts it if slamMode is mapping mode.
+func (cartoSvc *CartographerService) resetMapGrowthMonitor(ctx context.Context, slamMode cartofacade.SlamMode) {
+	monitor := &cartoSvc.mapGrowthMonitor
+	monitor.mu.Lock()
+	if monitor.stop != nil {
+		monitor.stop()
+		monitor.stop = nil
+	}
+	monitor.ctx = ctx
+	monitor.mu.Unlock()
+	cartoSvc.updateMapGrowthMonitor(slamMode)
+}
+
+// updateMapGrowthMonitor starts the map growth monitor if slamMode is mapping mode and it is not running, and stops
+// it and clears the map stalled flag in any other mode. It does nothing before the sensor processes are started.
+func (cartoSvc *CartographerService) updateMapGrowthMonitor(slamMode cartofacade.SlamMode) {
+	monitor := &cartoSvc.mapGrowthMonitor
+	monitor.mu.Lock()
+	defer monitor.mu.Unlock()
+	if slamMode != cartofacade.MappingMode {
+		if monitor.stop != nil {
+			monitor.stop()
+			monitor.stop = nil
+		}
+		cartoSvc.mapStalled.Store(false)
+		return
+	}
+	if monitor.stop != nil || monitor.ctx == nil {
+		return
+	}
+	// the previous monitor has returned, so the map is tracked from scratch
+	cartoSvc.mapGrowth = mapGrowth{}
+	ctx, cancel := context.WithCancel(monitor.ctx)
+	done := startMapGrowthMonitor(ctx, cartoSvc)
+	monitor.stop = func() {
+		cancel()
+		<-done
+	}
+}
+
+// startMapGrowthMonitor checks whether the map changed with the lidar readings added since the last check every
+// mapGrowthPollInterval until ctx is done. The returned channel is closed once it returns.
+func startMapGrowthMonitor(ctx context.Context, cartoSvc *CartographerService) <-chan struct{} {
+	done := make(chan struct{})
+	cartoSvc.goWorker("map_growth_monitor", func(w *worker) {
+		defer close(done)
+		ticker := time.NewTicker(mapGrowthPollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			w.heartbeat()
+			if cartoSvc.cartofacade.Unresponsive() {
+				// the request would wait on the hung call
+				continue
+			}
+			cartoSvc.checkMapGrowth(ctx)
+		}
+	})
+	return done
+}
+
+// checkMapGrowth gets the size of the map from cartographer and hands it to handleMapSize, unless no lidar reading
+// was added since the last check, in which case the map is not expected to change.
+func (cartoSvc *CartographerService) checkMapGrowth(ctx context.Context) {
+	numLidarReadings := cartoSvc.addedLidarReadings.Load()
+	if numLidarReadings == cartoSvc.mapGrowth.lidarReadingsAtLastCheck {
+		return
+	}
+	size, err := cartoSvc.currentMapSize(ctx)
+	if err != nil {
+		cartoSvc.logger.Debugw("could not get the size of the map to check whether it is growing", "error", err)
+		return
+	}
+	cartoSvc.handleMapSize(size, numLidarReadings)
+}
+
+// currentMapSize returns the size of the map from the versions of the submaps, which only requires their ids and
+// poses from cartographer. Without support for submaps it falls back to the number of nodes last read by the slam
+// stats monitor.
+func (cartoSvc *CartographerService) currentMapSize(ctx context.Context) (mapSize, error) {
+	if !cartoSvc.cartoLib.Capabilities().Has(cartofacade.FeatureSubmaps) {
+		stats := cartoSvc.slamStats.Load()
+		if stats == nil {
+			return mapSize{}, errors.New("cartographer reports neither its submaps nor the number of nodes yet")
+		}
+		return mapSize{insertions: stats.NumNodes, numSubmaps: -1}, nil
+	}
+	submaps, err := cartoSvc.cartofacade.SubmapList(ctx, cartoSvc.cartoFacadeInternalTimeout)
+	if err != nil {
+		return mapSize{}, err
+	}
+	size := mapSize{numSubmaps: len(submaps)}
+	for _, submap := range submaps {
+		size.insertions += submap.Version
+	}
+	return size, nil
+}
+
+// handleMapSize sets the map stalled status flag and warns once the size of the map has not changed over
+// map_stall_lidar_readings lidar readings, and clears it once the map changes again. It is only called by the map
+// growth monitor.
+func (cartoSvc *CartographerService) handleMapSize(size mapSize, numLidarReadings int64) {
+	growth := &cartoSvc.mapGrowth
+	growth.lidarReadingsAtLastCheck = numLidarReadings
+	if !growth.hasSize || size != growth.size {
+		growth.size = size
+		growth.hasSize = true
+		growth.lidarReadingsAtLastGrowth = numLidarReadings
+		if cartoSvc.mapStalled.Swap(false) {
+			cartoSvc.logger.Infow("cartographer's map is being updated again", cartoSvc.mapSizeKeysAndValues(size)...)
+		}
+		return
+	}
+
+	lidarReadingsSinceGrowth := numLidarReadings - growth.lidarReadingsAtLastGrowth
+	if lidarReadingsSinceGrowth < cartoSvc.mapStallLidarReadings || cartoSvc.mapStalled.Load() {
+		return
+	}
+	cartoSvc.mapStalled.Store(true)
+	keysAndValues := append([]interface{}{
+		"lidar_readings_since_last_growth", lidarReadingsSinceGrowth,
+		"map_stall_lidar_readings", cartoSvc.mapStallLidarReadings,
+	}, cartoSvc.mapSizeKeysAndValues(size)...)
+	cartoSvc.logger.Warnw("cartographer's map has not changed although lidar readings are being added, cartographer "+
+		"may have stopped updating the map. This is expected while the robot is standing still", keysAndValues...)
+}
+
+// mapSizeKeysAndValues returns the log fields of the submap and node counts of the map that are known.
+func (cartoSvc *CartographerService) mapSizeKeysAndValues(size mapSize) []interface{} {
+	var keysAndValues []interface{}
+	if size.numSubmaps >= 0 {
+		keysAndValues = append(keysAndValues, "num_submaps", size.numSubmaps)
+	}
+	if stats := cartoSvc.slamStats.Load(); stats != nil {
+		keysAndValues = append(keysAndValues, "num_nodes", stats.NumNodes)
+	}
+	return keysAndValues
+}
@@ -0,0 +1,106 @@
+package viamcartographer
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.viam.com/rdk/logging"
+	"go.viam.com/test"
+
+	"github.com/viam-modules/viam-cartographer/cartofacade"
+)
+
+func TestMapGrowth(t *testing.T) {
+	const stalledWarning = "cartographer's map has not changed although lidar readings are being added"
+	const resumedMessage = "cartographer's map is being updated again"
+	logger, obs := logging.NewObservedTestLogger(t)
+	submaps := []cartofacade.Submap{{Version: 4}, {Version: 2}}
+	mockCartoFacade := &cartofacade.Mock{}
+	mockCartoFacade.UnresponsiveFunc = func() bool { return true }
+	mockCartoFacade.PointCloudMapFunc = func(ctx context.Context, timeout time.Duration) ([]byte, error) {
+		t.Error("the map must not be serialized to check whether it is growing")
+		return nil, errors.New("unexpected call")
+	}
+	mockCartoFacade.SubmapListFunc = func(ctx context.Context, timeout time.Duration) ([]cartofacade.Submap, error) {
+		return submaps, nil
+	}
+	svc := newTestService(mockCartoFacade, logger)
+	svc.SlamMode = cartofacade.MappingMode
+	capabilities := cartofacade.NewCapabilities(cartofacade.FeatureSubmaps)
+	svc.cartoLib = &cartofacade.CartoLibMock{
+		LogLevelFunc:     func() (int, int) { return 0, 0 },
+		CapabilitiesFunc: func() cartofacade.Capabilities { return capabilities },
+	}
+	svc.mapStallLidarReadings = 10
+	svc.slamStats.Store(&cartofacade.SlamStats{NumNodes: 42})
+	addLidarReadingsAndCheck := func(numReadings int64) {
+		svc.addedLidarReadings.Add(numReadings)
+		svc.checkMapGrowth(context.Background())
+	}
+	mapStalled := func() interface{} {
+		resp, err := svc.DoCommand(context.Background(), map[string]interface{}{StatusCommand: ""})
+		test.That(t, err, test.ShouldBeNil)
+		return resp[MapStalledKey]
+	}
+
+	t.Run("the map is not stalled while it does not change for fewer lidar readings than map_stall_lidar_readings", func(t *testing.T) {
+		addLidarReadingsAndCheck(1)
+		addLidarReadingsAndCheck(5)
+		addLidarReadingsAndCheck(4)
+		test.That(t, mapStalled(), test.ShouldBeFalse)
+		test.That(t, obs.FilterMessageSnippet(stalledWarning).Len(), test.ShouldEqual, 0)
+	})
+
+	t.Run("the map is stalled once it does not change for map_stall_lidar_readings lidar readings", func(t *testing.T) {
+		addLidarReadingsAndCheck(1)
+		test.That(t, mapStalled(), test.ShouldBeTrue)
+		warnings := obs.FilterMessageSnippet(stalledWarning).All()
+		test.That(t, len(warnings), test.ShouldEqual, 1)
+		test.That(t, warnings[0].ContextMap()["lidar_readings_since_last_growth"], test.ShouldEqual, int64(10))
+		test.That(t, warnings[0].ContextMap()["num_submaps"], test.ShouldEqual, int64(2))
+		test.That(t, warnings[0].ContextMap()["num_nodes"], test.ShouldEqual, int64(42))
+
+		addLidarReadingsAndCheck(20)
+		test.That(t, obs.FilterMessageSnippet(stalledWarning).Len(), test.ShouldEqual, 1)
+	})
+
+	t.Run("the map is not checked while no lidar readings are added", func(t *testing.T) {
+		submaps = []cartofacade.Submap{{Version: 4}, {Version: 3}}
+		addLidarReadingsAndCheck(0)
+		test.That(t, mapStalled(), test.ShouldBeTrue)
+	})
+
+	t.Run("the map stalled flag clears once the map changes", func(t *testing.T) {
+		addLidarReadingsAndCheck(1)
+		test.That(t, mapStalled(), test.ShouldBeFalse)
+		test.That(t, obs.FilterMessageSnippet(resumedMessage).Len(), test.ShouldEqual, 1)
+
+		addLidarReadingsAndCheck(10)
+		test.That(t, mapStalled(), test.ShouldBeTrue)
+		test.That(t, obs.FilterMessageSnippet(stalledWarning).Len(), test.ShouldEqual, 2)
+	})
+
+	t.Run("the number of nodes tracks the map without support for submaps", func(t *testing.T) {
+		capabilities = cartofacade.NewCapabilities()
+		addLidarReadingsAndCheck(1)
+		test.That(t, mapStalled(), test.ShouldBeFalse)
+
+		addLidarReadingsAndCheck(10)
+		test.That(t, mapStalled(), test.ShouldBeTrue)
+		warnings := obs.FilterMessageSnippet(stalledWarning).All()
+		test.That(t, len(warnings), test.ShouldEqual, 3)
+		test.That(t, warnings[2].ContextMap()["num_submaps"], test.ShouldBeNil)
+		test.That(t, warnings[2].ContextMap()["num_nodes"], test.ShouldEqual, int64(42))
+
+		svc.slamStats.Store(&cartofacade.SlamStats{NumNodes: 43})
+		addLidarReadingsAndCheck(1)
+		test.That(t, mapStalled(), test.ShouldBeFalse)
+	})
+
+	t.Run("status omits the map stalled flag outside of mapping mode", func(t *testing.T) {
+		svc.SlamMode = cartofacade.LocalizingMode
+		test.That(t, mapStalled(), test.ShouldBeNil)
+	})
+}
@@ -0,0 +1,150 @@
+package viamcartographer
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/viam-modules/viam-cartographer/sensorprocess"
+	s "github.com/viam-modules/viam-cartographer/sensors"
+)
+
+const (
+	// ExportMetricsCSVCommand is sent to DoCommand to export the job statistics and sensor metrics as a CSV.
+	ExportMetricsCSVCommand = "export_metrics_csv"
+)
+
+// metricsCSVColumns are the columns of the metrics CSV, named after the keys of the job_done and sensor_metrics
+// responses and of the job_progress response prefixed by job_progress, with the keys of nested values joined by an
+// underscore. Columns may only be appended so that CSVs
+// exported by different versions of the module can be combined.
+var metricsCSVColumns = []string{
+	"job_done",
+	"cause",
+	"completed_at",
+	"final_optimization_succeeded",
+	"cancelled",
+	"num_lidar_readings",
+	"num_imu_readings",
+	"num_odometer_readings",
+	"num_skipped_lidar_readings",
+	"dropped_scans",
+	sensorprocess.LidarSensor + "_count",
+	sensorprocess.LidarSensor + "_p50_ms",
+	sensorprocess.LidarSensor + "_p95_ms",
+	sensorprocess.LidarSensor + "_max_ms",
+	sensorprocess.LidarSensor + "_empty_readings",
+	sensorprocess.IMUSensor + "_count",
+	sensorprocess.IMUSensor + "_p50_ms",
+	sensorprocess.IMUSensor + "_p95_ms",
+	sensorprocess.IMUSensor + "_max_ms",
+	sensorprocess.OdometerSensor + "_count",
+	sensorprocess.OdometerSensor + "_p50_ms",
+	sensorprocess.OdometerSensor + "_p95_ms",
+	sensorprocess.OdometerSensor + "_max_ms",
+	FacadeWorkerKey + "_duty_cycle_percent",
+	SlamStatsCommand + "_num_nodes",
+	SlamStatsCommand + "_num_unoptimized_nodes",
+	SlamStatsCommand + "_oldest_unoptimized_node_age_sec",
+	MemoryKey + "_cartographer_allocated_bytes",
+	MapOverlapKey + "_num_readings",
+	MapOverlapKey + "_overlap_percent",
+	"num_rejected_readings",
+	"skip_final_optimization",
+	"final_optimization_iterations",
+	JobProgressCommand + "_num_lidar_readings_processed",
+	JobProgressCommand + "_num_movement_sensor_readings_processed",
+	JobProgressCommand + "_elapsed_sec",
+	JobProgressCommand + "_expected_lidar_readings",
+	JobProgressCommand + "_percent",
+	SessionStartTimeKey,
+	SessionStatsKey + "_started_at",
+	SessionStatsKey + "_elapsed_sec",
+	SessionStatsKey + "_distance_traveled_mm",
+	SessionStatsKey + "_num_pose_jumps",
+	MemoryKey + "_cartographer_memory_available",
+	MemoryKey + "_go_heap_alloc_bytes",
+	MemoryKey + "_go_heap_sys_bytes",
+	MemoryKey + "_go_sys_bytes",
+	MemoryKey + "_go_num_gc",
+}
+
+// metricsCSV returns the job statistics and sensor metrics as a CSV with a comment line holding the module
+// version and the config hash, a header row of metricsCSVColumns and a single row of values. Values that are not
+// available, e.g. the latencies of a sensor that had no reading accepted yet, are left empty.
+func (cartoSvc *CartographerService) metricsCSV(ctx context.Context) ([]byte, error) {
+	jobDone, err := cartoSvc.doJobDone(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	sensorMetrics, err := cartoSvc.doSensorMetrics(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	values := map[string]interface{}{}
+	flattenMetrics(values, "", jobDone)
+	flattenMetrics(values, "", sensorMetrics)
+	if cartoSvc.jobSummary != nil {
+		flattenMetrics(values, JobProgressCommand, cartoSvc.jobSummary.Progress(time.Now()))
+	}
+	if cartoSvc.scanFilter != nil {
+		values["dropped_scans"] = cartoSvc.scanFilter.DroppedCount()
+	}
+
+	row := make([]string, len(metricsCSVColumns))
+	for i, column := range metricsCSVColumns {
+		if val, ok := values[column]; ok {
+			row[i] = fmt.Sprint(val)
+		}
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "# %s=%s %s=%s\n", ModuleVersionKey, ModuleVersion, ConfigHashKey, cartoSvc.configHash)
+	w := csv.NewWriter(&buf)
+	if err := w.WriteAll([][]string{metricsCSVColumns, row}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// flattenMetrics adds the values of metrics to values, with the keys of nested maps joined to their parent key
+// by an underscore.
+func flattenMetrics(values map[string]interface{}, prefix string, metrics map[string]interface{}) {
+	for key, val := range metrics {
+		if prefix != "" {
+			key = prefix + "_" + key
+		}
+		if nested, ok := val.(map[string]interface{}); ok {
+			flattenMetrics(values, key, nested)
+			continue
+		}
+		values[key] = val
+	}
+}
+
+// writeMetricsCSVOnCompletion writes the metrics CSV to the first of internal_state_export_dirs once the offline
+// job has finished, so that the statistics of a run are kept after the service is closed. The slam stats are
+// refreshed first, as the last poll may predate the final optimization.
+func (cartoSvc *CartographerService) writeMetricsCSVOnCompletion(ctx context.Context, completedAt time.Time) {
+	if len(cartoSvc.internalStateExportDirs) == 0 {
+		return
+	}
+	if !cartoSvc.cartofacade.Unresponsive() {
+		if stats, err := cartoSvc.cartofacade.SlamStats(ctx, cartoSvc.cartoFacadeTimeout); err == nil {
+			cartoSvc.slamStats.Store(&stats)
+		}
+	}
+	metrics, err := cartoSvc.metricsCSV(ctx)
+	if err == nil {
+		path := filepath.Join(cartoSvc.internalStateExportDirs[0],
+			fmt.Sprintf("%s_metrics_%s.csv", s.EncodeNameForPath(cartoSvc.Name().ShortName()), completedAt.UTC().Format("20060102T150405Z")))
+		if err = writeFileAtomically(path, metrics); err == nil {
+			cartoSvc.logger.Infow("wrote the metrics of the offline job", "path", path)
+			return
+		}
+	}
+	cartoSvc.logger.Warnw("failed to write the metrics of the offline job", "error", err)
+}
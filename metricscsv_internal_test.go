@@ -0,0 +1,156 @@
+package viamcartographer
+
+import (
+	"context"
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.viam.com/rdk/logging"
+	"go.viam.com/rdk/resource"
+	"go.viam.com/rdk/services/slam"
+	"go.viam.com/test"
+
+	"github.com/viam-modules/viam-cartographer/cartofacade"
+	"github.com/viam-modules/viam-cartographer/sensorprocess"
+)
+
+// withoutGoMemoryStats returns metricsCSV with the memory statistics of the go runtime, which vary from run to run,
+// left empty, after checking that they are set.
+func withoutGoMemoryStats(t *testing.T, metricsCSV string) string {
+	t.Helper()
+	comment, table, ok := strings.Cut(metricsCSV, "\n")
+	test.That(t, ok, test.ShouldBeTrue)
+	records, err := csv.NewReader(strings.NewReader(table)).ReadAll()
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, records, test.ShouldHaveLength, 2)
+	for i, column := range records[0] {
+		if strings.HasPrefix(column, MemoryKey+"_go_") {
+			test.That(t, records[1][i], test.ShouldNotBeEmpty)
+			records[1][i] = ""
+		}
+	}
+	var buf strings.Builder
+	buf.WriteString(comment + "\n")
+	w := csv.NewWriter(&buf)
+	test.That(t, w.WriteAll(records), test.ShouldBeNil)
+	return buf.String()
+}
+
+func TestExportMetricsCSVCommand(t *testing.T) {
+	mockCartoFacade := &cartofacade.Mock{}
+	mockCartoFacade.DutyCycleFunc = func() (float64, bool) { return 42.5, true }
+	mockCartoFacade.MemoryUsageFunc = func() (uint64, bool) { return 1234, true }
+	mockCartoFacade.SlamStatsFunc = func(ctx context.Context, timeout time.Duration) (cartofacade.SlamStats, error) {
+		return cartofacade.SlamStats{NumNodes: 100, NumUnoptimizedNodes: 0}, nil
+	}
+	svc := newTestService(mockCartoFacade, logging.NewTestLogger(t))
+	svc.jobSummary = &sensorprocess.JobSummary{}
+	svc.ingestionLatency = &sensorprocess.IngestionLatency{MaxP95: defaultMaxIngestionLatency}
+	svc.scanFilter = &sensorprocess.ScanFilter{MinPointsPerScan: 10}
+	svc.configHash = "0123abcd"
+	svc.emptyLidarReadings.Store(3)
+	svc.handleSlamStats(cartofacade.SlamStats{NumNodes: 90, NumUnoptimizedNodes: 12, OldestUnoptimizedNodeAge: 2500 * time.Millisecond}, false)
+	completedAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	svc.jobResult.Store(&sensorprocess.OfflineJobResult{
+		JobDone:                    true,
+		Cause:                      sensorprocess.CauseDatasetExhausted,
+		CompletedAt:                completedAt,
+		FinalOptimizationSucceeded: true,
+	})
+	svc.jobDone.Store(true)
+
+	// the ingestion latencies depend on the wall clock time and are left out of the deterministic run, the memory
+	// statistics of the go runtime are left empty by withoutGoMemoryStats
+	const golden = "# module_version=development config_hash=0123abcd\n" +
+		"job_done,cause,completed_at,final_optimization_succeeded,cancelled," +
+		"num_lidar_readings,num_imu_readings,num_odometer_readings,num_skipped_lidar_readings,dropped_scans," +
+		"lidar_count,lidar_p50_ms,lidar_p95_ms,lidar_max_ms,lidar_empty_readings," +
+		"imu_count,imu_p50_ms,imu_p95_ms,imu_max_ms,odometer_count,odometer_p50_ms,odometer_p95_ms,odometer_max_ms," +
+		"facade_worker_duty_cycle_percent,slam_stats_num_nodes,slam_stats_num_unoptimized_nodes," +
+		"slam_stats_oldest_unoptimized_node_age_sec,memory_cartographer_allocated_bytes," +
+		"map_overlap_num_readings,map_overlap_overlap_percent," +
+		"num_rejected_readings,skip_final_optimization,final_optimization_iterations," +
+		"job_progress_num_lidar_readings_processed,job_progress_num_movement_sensor_readings_processed," +
+		"job_progress_elapsed_sec,job_progress_expected_lidar_readings,job_progress_percent," +
+		"session_start_time,session_stats_started_at,session_stats_elapsed_sec,session_stats_distance_traveled_mm," +
+		"session_stats_num_pose_jumps,memory_cartographer_memory_available,memory_go_heap_alloc_bytes," +
+		"memory_go_heap_sys_bytes,memory_go_sys_bytes,memory_go_num_gc\n" +
+		"true,dataset_exhausted,2024-01-02T03:04:05Z,true,false,0,0,0,0,0,,,,,3,,,,,,,,,42.5,90,12,2.5,1234,,," +
+		"0,false,,0,0,0,,,,,,,,true,,,,\n"
+
+	t.Run("export_metrics_csv returns the metrics as a csv", func(t *testing.T) {
+		resp, err := svc.DoCommand(context.Background(), map[string]interface{}{ExportMetricsCSVCommand: nil})
+		test.That(t, err, test.ShouldBeNil)
+		metricsCSV, ok := resp["csv"].(string)
+		test.That(t, ok, test.ShouldBeTrue)
+		test.That(t, withoutGoMemoryStats(t, metricsCSV), test.ShouldEqual, golden)
+	})
+
+	t.Run("the columns of the csv are only ever appended to", func(t *testing.T) {
+		header := strings.Split(strings.Split(golden, "\n")[1], ",")
+		test.That(t, metricsCSVColumns[:len(header)], test.ShouldResemble, header)
+	})
+
+	allowedDir := t.TempDir()
+
+	t.Run("export_metrics_csv fails to write a file without internal_state_export_dirs", func(t *testing.T) {
+		resp, err := svc.DoCommand(context.Background(),
+			map[string]interface{}{ExportMetricsCSVCommand: filepath.Join(allowedDir, "metrics.csv")})
+		test.That(t, err, test.ShouldBeError, ErrInternalStateExportNotConfigured)
+		test.That(t, resp, test.ShouldBeNil)
+	})
+
+	svc.internalStateExportDirs = []string{allowedDir}
+	resolvedDir, err := filepath.EvalSymlinks(allowedDir)
+	test.That(t, err, test.ShouldBeNil)
+
+	t.Run("export_metrics_csv fails for a relative path", func(t *testing.T) {
+		resp, err := svc.DoCommand(context.Background(), map[string]interface{}{ExportMetricsCSVCommand: "metrics.csv"})
+		test.That(t, errors.Is(err, ErrBadMetricsCSVPath), test.ShouldBeTrue)
+		test.That(t, err.Error(), test.ShouldStartWith, "invalid argument for "+ExportMetricsCSVCommand+": ")
+		test.That(t, resp, test.ShouldBeNil)
+	})
+
+	t.Run("export_metrics_csv fails for a path outside of internal_state_export_dirs", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "metrics.csv")
+		resp, err := svc.DoCommand(context.Background(), map[string]interface{}{ExportMetricsCSVCommand: path})
+		test.That(t, errors.Is(err, ErrInternalStatePathNotAllowed), test.ShouldBeTrue)
+		test.That(t, resp, test.ShouldBeNil)
+	})
+
+	t.Run("export_metrics_csv writes the csv within an allowed directory", func(t *testing.T) {
+		path := filepath.Join(allowedDir, "metrics.csv")
+		resp, err := svc.DoCommand(context.Background(), map[string]interface{}{ExportMetricsCSVCommand: path})
+		test.That(t, err, test.ShouldBeNil)
+		written, err := os.ReadFile(path)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, resp, test.ShouldResemble, map[string]interface{}{
+			"path":       filepath.Join(resolvedDir, "metrics.csv"),
+			"size_bytes": len(written),
+		})
+		test.That(t, withoutGoMemoryStats(t, string(written)), test.ShouldEqual, golden)
+	})
+
+	t.Run("the csv is written to the first export dir once the offline job is done", func(t *testing.T) {
+		svc.writeMetricsCSVOnCompletion(context.Background(), completedAt)
+		written, err := os.ReadFile(filepath.Join(allowedDir, "test_metrics_20240102T030405Z.csv"))
+		test.That(t, err, test.ShouldBeNil)
+		// the slam stats are refreshed before writing
+		test.That(t, withoutGoMemoryStats(t, string(written)), test.ShouldEqual,
+			strings.Replace(golden, "42.5,90,12,2.5,1234", "42.5,100,0,0,1234", 1))
+	})
+
+	t.Run("the csv written once the offline job is done is named by the encoded name of the service", func(t *testing.T) {
+		named := svc.Named
+		defer func() { svc.Named = named }()
+		svc.Named = resource.NewName(slam.API, "cart:front/slam").AsNamed()
+		svc.writeMetricsCSVOnCompletion(context.Background(), completedAt)
+		_, err := os.Stat(filepath.Join(allowedDir, "cart%3Afront%2Fslam_metrics_20240102T030405Z.csv"))
+		test.That(t, err, test.ShouldBeNil)
+	})
+}
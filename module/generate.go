@@ -0,0 +1,52 @@
+package main
+
+import (
+	"flag"
+
+	"github.com/pkg/errors"
+	"go.viam.com/rdk/logging"
+
+	"github.com/viam-modules/viam-cartographer/sensors"
+)
+
+// generateDatasetArg is the first module argument that runs the synthetic dataset generator instead of the module.
+const generateDatasetArg = "-generate-dataset"
+
+// generateDataset writes a synthetic offline dataset to the directory given by the -dir flag in args.
+// The remaining flags override the defaults of sensors.DefaultSyntheticDatasetConfig.
+func generateDataset(args []string, logger logging.Logger) error {
+	cfg := sensors.DefaultSyntheticDatasetConfig()
+
+	flags := flag.NewFlagSet(generateDatasetArg, flag.ContinueOnError)
+	dir := flags.String("dir", "", "directory to write the dataset to")
+	flags.Int64Var(&cfg.Seed, "seed", cfg.Seed, "seed of the obstacle placement and the lidar noise")
+	flags.IntVar(&cfg.NumScans, "num-scans", cfg.NumScans, "number of lidar scans")
+	flags.IntVar(&cfg.MovementSensorReadingsPerScan, "movement-sensor-readings-per-scan", cfg.MovementSensorReadingsPerScan,
+		"number of IMU and odometer readings per lidar scan")
+	flags.Float64Var(&cfg.RoomWidthM, "room-width", cfg.RoomWidthM, "width of the room in meters")
+	flags.Float64Var(&cfg.RoomLengthM, "room-length", cfg.RoomLengthM, "length of the room in meters")
+	flags.IntVar(&cfg.NumObstacles, "num-obstacles", cfg.NumObstacles, "number of box obstacles in the room")
+	flags.IntVar(&cfg.PointsPerScan, "points-per-scan", cfg.PointsPerScan, "number of lidar beams per scan")
+	flags.Float64Var(&cfg.MaxRangeM, "max-range", cfg.MaxRangeM, "maximum lidar range in meters")
+	flags.Float64Var(&cfg.RangeNoiseStdDevM, "range-noise", cfg.RangeNoiseStdDevM,
+		"standard deviation of the lidar range noise in meters")
+	flags.Float64Var(&cfg.SpeedMPS, "speed", cfg.SpeedMPS, "speed of the robot in m/s")
+	flags.DurationVar(&cfg.ScanInterval, "scan-interval", cfg.ScanInterval, "time between two lidar scans")
+	flags.IntVar(&cfg.CompressionLevel, "compression-level", cfg.CompressionLevel,
+		"gzip level of the lidar scans, 1 to 9 or -1 for the default level, 0 writes them uncompressed")
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return err
+	}
+	if *dir == "" {
+		return errors.New("-dir is required to generate a dataset")
+	}
+
+	if err := sensors.GenerateSyntheticDataset(*dir, cfg); err != nil {
+		return err
+	}
+	logger.Infow("generated synthetic dataset", "dir", *dir, "num_scans", cfg.NumScans, "seed", cfg.Seed)
+	return nil
+}
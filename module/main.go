@@ -5,6 +5,7 @@ import (
 	"context"
 	"strings"
 
+	"go.viam.com/rdk/components/movementsensor"
 	"go.viam.com/rdk/logging"
 	"go.viam.com/rdk/module"
 	"go.viam.com/rdk/services/slam"
@@ -31,6 +32,8 @@ func mainWithArgs(ctx context.Context, args []string, logger logging.Logger) err
 	if GitRevision != "" {
 		versionFields = append(versionFields, "git_rev", GitRevision)
 	}
+	viamcartographer.ModuleVersion = Version
+
 	if len(versionFields) != 0 {
 		logger.Infow(viamcartographer.Model.String(), versionFields...)
 	} else {
@@ -41,6 +44,10 @@ func mainWithArgs(ctx context.Context, args []string, logger logging.Logger) err
 		return nil
 	}
 
+	if len(args) >= 2 && args[1] == generateDatasetArg {
+		return generateDataset(args[2:], logger)
+	}
+
 	if err := viamcartographer.InitCartoLib(logger); err != nil {
 		return err
 	}
@@ -56,12 +63,18 @@ func mainWithArgs(ctx context.Context, args []string, logger logging.Logger) err
 	if err != nil {
 		return err
 	}
+	viamcartographer.ParentResourceResolver = cartoModule.GetParentResource
 
 	// Add the cartographer model to the module
 	if err = cartoModule.AddModelFromRegistry(ctx, slam.API, viamcartographer.Model); err != nil {
 		return err
 	}
 
+	// Add the movement sensor model that republishes the pose of cartographer to the module
+	if err = cartoModule.AddModelFromRegistry(ctx, movementsensor.API, viamcartographer.PoseSensorModel); err != nil {
+		return err
+	}
+
 	// Start the module
 	err = cartoModule.Start(ctx)
 	defer cartoModule.Close(ctx)
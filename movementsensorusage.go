@@ -0,0 +1,53 @@
+package viamcartographer
+
+const (
+	// MovementSensorUsageKey is the key of whether cartographer uses the data of the movement sensor.
+	MovementSensorUsageKey = "movement_sensor_usage"
+)
+
+// movementSensorUsageToMap returns whether cartographer uses the IMU and the odometer data of the movement sensor,
+// as resolved from its properties, and how many of their readings it accepted, in the format of the status
+// response.
+func (cartoSvc *CartographerService) movementSensorUsageToMap() map[string]interface{} {
+	return map[string]interface{}{
+		"movement_sensor":            cartoSvc.movementSensor.Name(),
+		"use_imu_data":               cartoSvc.requestedAlgoConfig.UseIMUData,
+		"use_odometer_data":          cartoSvc.useOdometerData,
+		"imu_readings_accepted":      cartoSvc.addedIMUReadings.Load(),
+		"odometer_readings_accepted": cartoSvc.addedOdometerReadings.Load(),
+		"unused":                     cartoSvc.movementSensorUnused.Load(),
+	}
+}
+
+// checkMovementSensorUsage sets the movement sensor unused flag and warns once cartographer has accepted
+// movementSensorUnusedLidarReadings lidar readings but none of the movement sensor, and clears it once a reading
+// of the movement sensor is accepted. A configured movement sensor otherwise looks like it improves the map even
+// when none of its data reaches cartographer. It is only called by the slam stats monitor.
+func (cartoSvc *CartographerService) checkMovementSensorUsage() {
+	if cartoSvc.movementSensor == nil {
+		return
+	}
+	numIMUReadings := cartoSvc.addedIMUReadings.Load()
+	numOdometerReadings := cartoSvc.addedOdometerReadings.Load()
+	if numIMUReadings+numOdometerReadings > 0 {
+		if cartoSvc.movementSensorUnused.Swap(false) {
+			cartoSvc.logger.Infow("cartographer is accepting the readings of the movement sensor",
+				"movement_sensor", cartoSvc.movementSensor.Name(),
+				"imu_readings_accepted", numIMUReadings,
+				"odometer_readings_accepted", numOdometerReadings)
+		}
+		return
+	}
+	numLidarReadings := cartoSvc.addedLidarReadings.Load()
+	if numLidarReadings < movementSensorUnusedLidarReadings || cartoSvc.movementSensorUnused.Load() {
+		return
+	}
+	cartoSvc.movementSensorUnused.Store(true)
+	cartoSvc.logger.Warnw("a movement sensor is configured, but cartographer has not accepted any of its readings, "+
+		"the map is built from the lidar readings alone. Check the properties of the movement sensor and the "+
+		"errors of its readings",
+		"movement_sensor", cartoSvc.movementSensor.Name(),
+		"use_imu_data", cartoSvc.requestedAlgoConfig.UseIMUData,
+		"use_odometer_data", cartoSvc.useOdometerData,
+		"lidar_readings_accepted", numLidarReadings)
+}
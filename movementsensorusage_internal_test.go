@@ -0,0 +1,79 @@
+package viamcartographer
+
+import (
+	"context"
+	"testing"
+
+	"go.viam.com/rdk/logging"
+	"go.viam.com/test"
+
+	"github.com/viam-modules/viam-cartographer/cartofacade"
+	"github.com/viam-modules/viam-cartographer/sensors/inject"
+)
+
+func TestMovementSensorUsage(t *testing.T) {
+	const unusedWarning = "a movement sensor is configured, but cartographer has not accepted any of its readings"
+	const usedMessage = "cartographer is accepting the readings of the movement sensor"
+	logger, obs := logging.NewObservedTestLogger(t)
+	mockCartoFacade := &cartofacade.Mock{}
+	mockCartoFacade.UnresponsiveFunc = func() bool { return true }
+	injectMovementSensor := inject.TimedMovementSensor{}
+	injectMovementSensor.NameFunc = func() string { return "my-imu" }
+	svc := newTestService(mockCartoFacade, logger)
+	svc.cartoLib = &cartofacade.CartoLibMock{LogLevelFunc: func() (int, int) { return 0, 0 }}
+	svc.movementSensor = &injectMovementSensor
+	svc.requestedAlgoConfig = cartofacade.CartoAlgoConfig{UseIMUData: true}
+	movementSensorUsage := func() map[string]interface{} {
+		resp, err := svc.DoCommand(context.Background(), map[string]interface{}{StatusCommand: nil})
+		test.That(t, err, test.ShouldBeNil)
+		usage, ok := resp[MovementSensorUsageKey].(map[string]interface{})
+		test.That(t, ok, test.ShouldBeTrue)
+		return usage
+	}
+
+	t.Run("status holds the resolved use of the movement sensor data", func(t *testing.T) {
+		usage := movementSensorUsage()
+		test.That(t, usage["movement_sensor"], test.ShouldEqual, "my-imu")
+		test.That(t, usage["use_imu_data"], test.ShouldBeTrue)
+		test.That(t, usage["use_odometer_data"], test.ShouldBeFalse)
+		test.That(t, usage["imu_readings_accepted"], test.ShouldEqual, 0)
+		test.That(t, usage["odometer_readings_accepted"], test.ShouldEqual, 0)
+		test.That(t, usage["unused"], test.ShouldBeFalse)
+	})
+
+	t.Run("the movement sensor is not unused before enough lidar readings were accepted", func(t *testing.T) {
+		svc.addedLidarReadings.Add(movementSensorUnusedLidarReadings - 1)
+		svc.checkMovementSensorUsage()
+		test.That(t, movementSensorUsage()["unused"], test.ShouldBeFalse)
+		test.That(t, obs.FilterMessageSnippet(unusedWarning).Len(), test.ShouldEqual, 0)
+	})
+
+	t.Run("a configured movement sensor without accepted readings is unused and warned about once", func(t *testing.T) {
+		svc.addedLidarReadings.Add(1)
+		svc.checkMovementSensorUsage()
+		svc.checkMovementSensorUsage()
+		test.That(t, movementSensorUsage()["unused"], test.ShouldBeTrue)
+		warnings := obs.FilterMessageSnippet(unusedWarning).All()
+		test.That(t, len(warnings), test.ShouldEqual, 1)
+		test.That(t, warnings[0].ContextMap()["movement_sensor"], test.ShouldEqual, "my-imu")
+		test.That(t, warnings[0].ContextMap()["use_imu_data"], test.ShouldBeTrue)
+		test.That(t, warnings[0].ContextMap()["lidar_readings_accepted"], test.ShouldEqual, int64(movementSensorUnusedLidarReadings))
+	})
+
+	t.Run("the unused flag clears once a reading of the movement sensor is accepted", func(t *testing.T) {
+		svc.addedIMUReadings.Add(3)
+		svc.checkMovementSensorUsage()
+		usage := movementSensorUsage()
+		test.That(t, usage["unused"], test.ShouldBeFalse)
+		test.That(t, usage["imu_readings_accepted"], test.ShouldEqual, 3)
+		test.That(t, obs.FilterMessageSnippet(usedMessage).Len(), test.ShouldEqual, 1)
+	})
+
+	t.Run("status omits the movement sensor usage without a movement sensor", func(t *testing.T) {
+		svc.movementSensor = nil
+		svc.checkMovementSensorUsage()
+		resp, err := svc.DoCommand(context.Background(), map[string]interface{}{StatusCommand: nil})
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, resp, test.ShouldNotContainKey, MovementSensorUsageKey)
+	})
+}
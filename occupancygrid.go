@@ -0,0 +1,161 @@
+package viamcartographer
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+
+	"github.com/golang/geo/r3"
+	"github.com/pkg/errors"
+	"go.viam.com/rdk/pointcloud"
+)
+
+const (
+	// defaultOccupancyGridResolution is the cell size, in meters, if it is not given.
+	defaultOccupancyGridResolution = 0.05
+	// defaultOccupiedProbability and defaultFreeProbability are the probabilities, in percent, above and below
+	// which points are occupied and free if they are not given, which match the thresholds of the ROS map_server.
+	defaultOccupiedProbability = 65
+	defaultFreeProbability     = 19.6
+	// maxOccupancyGridCells bounds the size of the grid, 25 MB of PGM image.
+	maxOccupancyGridCells = 25_000_000
+	// GetOccupancyGridCommand is sent to DoCommand to get the map as a 2D occupancy grid.
+	GetOccupancyGridCommand = "get_occupancy_grid"
+)
+
+// The values of the cells of an occupancy grid in the PGM image, which match the ones the ROS map_server writes
+// and reads with trinary thresholds.
+const (
+	occupancyGridOccupied = 0
+	occupancyGridFree     = 254
+	occupancyGridUnknown  = 205
+)
+
+// occupancyGridRequest is the value of get_occupancy_grid.
+type occupancyGridRequest struct {
+	// Resolution is the size of the cells in meters.
+	Resolution float64 `json:"resolution"`
+	// OccupiedThreshold is the number of occupied points a cell must hold more than to be occupied. Cells that
+	// hold fewer are free, unless they hold a point whose probability is between FreeProbability and
+	// OccupiedProbability, and cells without points are unknown.
+	OccupiedThreshold int `json:"occupied_threshold"`
+	// OccupiedProbability and FreeProbability are the probabilities, in percent, of the blue channel of the color
+	// of the points of the map, at or above which a point is occupied and above which it is not free. Points
+	// without a color are occupied.
+	OccupiedProbability float64 `json:"occupied_probability"`
+	FreeProbability     float64 `json:"free_probability"`
+	// crop, if set, is the region the map was cropped to, the box of which the grid covers.
+	crop *mapCropRegion
+}
+
+// occupancyGrid is a 2D projection of the pointcloud map.
+type occupancyGrid struct {
+	width, height int
+	// resolution is the size of the cells in meters.
+	resolution float64
+	// originX and originY are the position, in meters, of the lower left corner of the grid in the map frame.
+	originX, originY float64
+	numOccupied      int
+	pgm              []byte
+}
+
+// yaml returns the metadata of the grid in the format of the ROS map_server, for the grid written to imagePath.
+func (grid occupancyGrid) yaml(imagePath string) string {
+	return fmt.Sprintf("image: %s\nmode: trinary\nresolution: %g\norigin: [%g, %g, 0]\nnegate: 0\n"+
+		"occupied_thresh: 0.65\nfree_thresh: 0.196\n", imagePath, grid.resolution, grid.originX, grid.originY)
+}
+
+// newOccupancyGrid projects the points of the pointcloud map pcd, whose coordinates are in meters and read in
+// millimeters, onto the XY plane and bins them into cells of the resolution of req, which are occupied, free or
+// unknown by the probabilities of their points. The grid covers the cells that hold points, or the crop box of req
+// if it is set, with +y of the map frame facing up in the PGM image.
+func newOccupancyGrid(pcd []byte, req occupancyGridRequest) (occupancyGrid, error) {
+	pc, err := pointcloud.ReadPCD(bytes.NewReader(pcd))
+	if err != nil {
+		return occupancyGrid{}, err
+	}
+	if pc.Size() == 0 && req.crop == nil {
+		return occupancyGrid{}, ErrOccupancyGridMapEmpty
+	}
+
+	type cell struct {
+		x, y int
+	}
+	// cellPoints are the points of a cell that are occupied, and whether any of them is neither occupied nor free
+	type cellPoints struct {
+		numOccupied int
+		uncertain   bool
+	}
+	resolutionMm := req.Resolution * 1000
+	cells := map[cell]*cellPoints{}
+	minCell := cell{x: math.MaxInt, y: math.MaxInt}
+	maxCell := cell{x: math.MinInt, y: math.MinInt}
+	pc.Iterate(0, 0, func(p r3.Vector, d pointcloud.Data) bool {
+		c := cell{x: int(math.Floor(p.X / resolutionMm)), y: int(math.Floor(p.Y / resolutionMm))}
+		points, ok := cells[c]
+		if !ok {
+			points = &cellPoints{}
+			cells[c] = points
+		}
+		probability := 100.
+		if d != nil && d.HasColor() {
+			_, _, blue := d.RGB255()
+			probability = float64(blue)
+		}
+		switch {
+		case probability >= req.OccupiedProbability:
+			points.numOccupied++
+		case probability > req.FreeProbability:
+			points.uncertain = true
+		}
+		minCell = cell{x: min(minCell.x, c.x), y: min(minCell.y, c.y)}
+		maxCell = cell{x: max(maxCell.x, c.x), y: max(maxCell.y, c.y)}
+		return true
+	})
+	if req.crop != nil {
+		minX, minY := math.Floor(req.crop.box.MinX/resolutionMm), math.Floor(req.crop.box.MinY/resolutionMm)
+		maxX, maxY := math.Floor(req.crop.box.MaxX/resolutionMm), math.Floor(req.crop.box.MaxY/resolutionMm)
+		// checked before converting to cells, as the box of an explicit crop may be arbitrarily large
+		if (maxX-minX+1)*(maxY-minY+1) > maxOccupancyGridCells {
+			return occupancyGrid{}, errors.Errorf("an occupancy grid of %gx%g cells at a resolution of %g meters "+
+				"exceeds %d cells, request a coarser resolution or a smaller crop", maxX-minX+1, maxY-minY+1, req.Resolution,
+				maxOccupancyGridCells)
+		}
+		minCell = cell{x: int(minX), y: int(minY)}
+		maxCell = cell{x: int(maxX), y: int(maxY)}
+	}
+
+	grid := occupancyGrid{
+		width:      maxCell.x - minCell.x + 1,
+		height:     maxCell.y - minCell.y + 1,
+		resolution: req.Resolution,
+		originX:    float64(minCell.x) * req.Resolution,
+		originY:    float64(minCell.y) * req.Resolution,
+	}
+	if grid.width*grid.height > maxOccupancyGridCells {
+		return occupancyGrid{}, errors.Errorf("an occupancy grid of %dx%d cells at a resolution of %g meters "+
+			"exceeds %d cells, request a coarser resolution", grid.width, grid.height, req.Resolution, maxOccupancyGridCells)
+	}
+
+	header := fmt.Sprintf("P5\n%d %d\n255\n", grid.width, grid.height)
+	grid.pgm = make([]byte, len(header)+grid.width*grid.height)
+	copy(grid.pgm, header)
+	pixels := grid.pgm[len(header):]
+	for i := range pixels {
+		pixels[i] = occupancyGridUnknown
+	}
+	for c, points := range cells {
+		var value byte
+		switch {
+		case points.numOccupied > req.OccupiedThreshold:
+			value = occupancyGridOccupied
+			grid.numOccupied++
+		case points.uncertain:
+			value = occupancyGridUnknown
+		default:
+			value = occupancyGridFree
+		}
+		pixels[(maxCell.y-c.y)*grid.width+c.x-minCell.x] = value
+	}
+	return grid, nil
+}
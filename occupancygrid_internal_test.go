@@ -0,0 +1,234 @@
+package viamcartographer
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"image/color"
+	"testing"
+	"time"
+
+	"github.com/golang/geo/r2"
+	"github.com/golang/geo/r3"
+	"github.com/pkg/errors"
+	"go.viam.com/rdk/logging"
+	"go.viam.com/rdk/pointcloud"
+	"go.viam.com/test"
+
+	"github.com/viam-modules/viam-cartographer/cartofacade"
+	s "github.com/viam-modules/viam-cartographer/sensors"
+	"github.com/viam-modules/viam-cartographer/testhelper/pcdtest"
+)
+
+func TestGetOccupancyGridCommand(t *testing.T) {
+	points := []r3.Vector{{X: -60, Y: -10}, {X: 10, Y: 10}, {X: 20, Y: 30}, {X: 140, Y: 90}}
+	var pointCloudMapErr error
+	// probabilityMap, if set, is returned instead of the points
+	var probabilityMap []byte
+	mockCartoFacade := &cartofacade.Mock{}
+	mockCartoFacade.PointCloudMapFunc = func(ctx context.Context, timeout time.Duration) ([]byte, error) {
+		if pointCloudMapErr != nil {
+			return nil, pointCloudMapErr
+		}
+		if probabilityMap != nil {
+			return probabilityMap, nil
+		}
+		return pcdtest.PointsToPCD(t, points), nil
+	}
+	svc := newTestService(mockCartoFacade, logging.NewTestLogger(t))
+	getOccupancyGrid := func(val interface{}) (map[string]interface{}, []byte) {
+		resp, err := svc.DoCommand(context.Background(), map[string]interface{}{GetOccupancyGridCommand: val})
+		test.That(t, err, test.ShouldBeNil)
+		pgm, err := base64.StdEncoding.DecodeString(resp[GetOccupancyGridCommand].(string))
+		test.That(t, err, test.ShouldBeNil)
+		header := fmt.Sprintf("P5\n%d %d\n255\n", resp["width"], resp["height"])
+		test.That(t, string(pgm[:len(header)]), test.ShouldEqual, header)
+		return resp, pgm[len(header):]
+	}
+
+	t.Run("get_occupancy_grid bins the map into cells of 0.05 meters by default", func(t *testing.T) {
+		resp, cells := getOccupancyGrid(nil)
+		test.That(t, resp["width"], test.ShouldEqual, 5)
+		test.That(t, resp["height"], test.ShouldEqual, 3)
+		test.That(t, resp["resolution"], test.ShouldEqual, 0.05)
+		test.That(t, resp["origin"], test.ShouldResemble, []float64{-0.1, -0.05, 0})
+		test.That(t, resp["num_occupied_cells"], test.ShouldEqual, 3)
+		test.That(t, resp["yaml"], test.ShouldContainSubstring, "image: test.pgm\n")
+		test.That(t, resp["yaml"], test.ShouldContainSubstring, "resolution: 0.05\n")
+		test.That(t, resp["yaml"], test.ShouldContainSubstring, "origin: [-0.1, -0.05, 0]\n")
+		test.That(t, cells, test.ShouldResemble, []byte{
+			205, 205, 205, 205, 0,
+			205, 205, 0, 205, 205,
+			0, 205, 205, 205, 205,
+		})
+	})
+
+	t.Run("get_occupancy_grid marks cells with no more points than the threshold as free", func(t *testing.T) {
+		resp, cells := getOccupancyGrid(map[string]interface{}{"resolution": 0.1, "occupied_threshold": 1})
+		test.That(t, resp["width"], test.ShouldEqual, 3)
+		test.That(t, resp["height"], test.ShouldEqual, 2)
+		test.That(t, resp["resolution"], test.ShouldEqual, 0.1)
+		test.That(t, resp["origin"], test.ShouldResemble, []float64{-0.1, -0.1, 0})
+		test.That(t, resp["num_occupied_cells"], test.ShouldEqual, 1)
+		test.That(t, cells, test.ShouldResemble, []byte{
+			205, 0, 254,
+			254, 205, 205,
+		})
+	})
+
+	t.Run("get_occupancy_grid marks cells by the probabilities of their points", func(t *testing.T) {
+		// the probability of a point of the map is the blue channel of its color, in percent
+		pc := pointcloud.New()
+		for _, p := range []struct {
+			x           float64
+			probability uint8
+		}{{10, 90}, {60, 40}, {110, 10}} {
+			data := pointcloud.NewColoredData(color.NRGBA{B: p.probability, A: 255})
+			test.That(t, pc.Set(r3.Vector{X: p.x, Y: 10}, data), test.ShouldBeNil)
+		}
+		buf := new(bytes.Buffer)
+		test.That(t, pointcloud.ToPCD(pc, buf, pointcloud.PCDBinary), test.ShouldBeNil)
+		probabilityMap = buf.Bytes()
+		defer func() { probabilityMap = nil }()
+
+		resp, cells := getOccupancyGrid(nil)
+		test.That(t, resp["num_occupied_cells"], test.ShouldEqual, 1)
+		test.That(t, cells, test.ShouldResemble, []byte{0, 205, 254})
+
+		resp, cells = getOccupancyGrid(map[string]interface{}{"occupied_probability": 30, "free_probability": 5})
+		test.That(t, resp["num_occupied_cells"], test.ShouldEqual, 2)
+		test.That(t, cells, test.ShouldResemble, []byte{0, 0, 205})
+	})
+
+	t.Run("get_occupancy_grid fails for an invalid request", func(t *testing.T) {
+		for _, val := range []interface{}{
+			"0.05",
+			map[string]interface{}{"resolution": 0},
+			map[string]interface{}{"resolution": -0.05},
+			map[string]interface{}{"occupied_threshold": -1},
+			map[string]interface{}{"occupied_threshold": "1"},
+			map[string]interface{}{"occupied_probability": 101},
+			map[string]interface{}{"free_probability": -1},
+			map[string]interface{}{"occupied_probability": 50, "free_probability": 50},
+		} {
+			resp, err := svc.DoCommand(context.Background(), map[string]interface{}{GetOccupancyGridCommand: val})
+			test.That(t, errors.Is(err, ErrBadOccupancyGridRequest), test.ShouldBeTrue)
+			test.That(t, resp, test.ShouldBeNil)
+		}
+	})
+
+	t.Run("get_occupancy_grid fails for a resolution that results in too many cells", func(t *testing.T) {
+		resp, err := svc.DoCommand(context.Background(),
+			map[string]interface{}{GetOccupancyGridCommand: map[string]interface{}{"resolution": 0.00001}})
+		test.That(t, err, test.ShouldNotBeNil)
+		test.That(t, err.Error(), test.ShouldContainSubstring, "request a coarser resolution")
+		test.That(t, resp, test.ShouldBeNil)
+	})
+
+	t.Run("get_occupancy_grid covers the crop box and moves the origin to its corner", func(t *testing.T) {
+		resp, cells := getOccupancyGrid(map[string]interface{}{
+			"crop": map[string]interface{}{"minx": 0.0, "miny": 0.0, "maxx": 200.0, "maxy": 200.0},
+		})
+		test.That(t, resp["width"], test.ShouldEqual, 5)
+		test.That(t, resp["height"], test.ShouldEqual, 5)
+		test.That(t, resp["origin"], test.ShouldResemble, []float64{0, 0, 0})
+		test.That(t, resp["yaml"], test.ShouldContainSubstring, "origin: [0, 0, 0]\n")
+		test.That(t, resp["num_occupied_cells"], test.ShouldEqual, 2)
+		test.That(t, cells, test.ShouldResemble, []byte{
+			205, 205, 205, 205, 205,
+			205, 205, 205, 205, 205,
+			205, 205, 205, 205, 205,
+			205, 205, 0, 205, 205,
+			0, 205, 205, 205, 205,
+		})
+
+		resp, cells = getOccupancyGrid(map[string]interface{}{
+			"resolution": 0.1,
+			"crop":       map[string]interface{}{"minx": 1000.0, "miny": 1000.0, "maxx": 1100.0, "maxy": 1100.0},
+		})
+		test.That(t, resp["origin"], test.ShouldResemble, []float64{1, 1, 0})
+		test.That(t, resp["num_occupied_cells"], test.ShouldEqual, 0)
+		test.That(t, cells, test.ShouldResemble, []byte{205, 205, 205, 205})
+	})
+
+	t.Run("get_occupancy_grid crops to the polygon of the mapping bounds and covers the box enclosing it", func(t *testing.T) {
+		resp, err := svc.DoCommand(context.Background(),
+			map[string]interface{}{GetOccupancyGridCommand: map[string]interface{}{"crop": MapCropMappingBounds}})
+		test.That(t, err, test.ShouldBeError, ErrNoMappingBounds)
+		test.That(t, resp, test.ShouldBeNil)
+
+		bounds, err := s.NewMappingBounds([]r2.Point{{X: -100, Y: -100}, {X: 100, Y: -100}, {X: 0, Y: 100}}, false)
+		test.That(t, err, test.ShouldBeNil)
+		svc.mappingBounds.Store(bounds)
+		defer svc.mappingBounds.Store(nil)
+
+		resp, cells := getOccupancyGrid(map[string]interface{}{"resolution": 0.1, "occupied_threshold": 1, "crop": MapCropMappingBounds})
+		test.That(t, resp["width"], test.ShouldEqual, 3)
+		test.That(t, resp["height"], test.ShouldEqual, 3)
+		test.That(t, resp["origin"], test.ShouldResemble, []float64{-0.1, -0.1, 0})
+		test.That(t, resp["num_occupied_cells"], test.ShouldEqual, 1)
+		// the point at (-60, -10) lies inside of the box but outside of the triangle
+		test.That(t, cells, test.ShouldResemble, []byte{
+			205, 205, 205,
+			205, 0, 205,
+			205, 205, 205,
+		})
+	})
+
+	t.Run("get_occupancy_grid crops to a polygon", func(t *testing.T) {
+		resp, cells := getOccupancyGrid(map[string]interface{}{
+			"resolution":         0.1,
+			"occupied_threshold": 1,
+			"crop": map[string]interface{}{"polygon": []interface{}{
+				map[string]interface{}{"x": -100.0, "y": -100.0},
+				map[string]interface{}{"x": 0.0, "y": -100.0},
+				map[string]interface{}{"x": -100.0, "y": 100.0},
+			}},
+		})
+		test.That(t, resp["width"], test.ShouldEqual, 2)
+		test.That(t, resp["height"], test.ShouldEqual, 3)
+		test.That(t, resp["origin"], test.ShouldResemble, []float64{-0.1, -0.1, 0})
+		test.That(t, resp["num_occupied_cells"], test.ShouldEqual, 0)
+		test.That(t, cells, test.ShouldResemble, []byte{
+			205, 205,
+			205, 205,
+			254, 205,
+		})
+	})
+
+	t.Run("get_occupancy_grid fails for an invalid crop", func(t *testing.T) {
+		for _, crop := range []interface{}{
+			"bounds",
+			map[string]interface{}{"minx": 0.0},
+			map[string]interface{}{"minx": 10.0, "miny": 0.0, "maxx": 0.0, "maxy": 10.0},
+			map[string]interface{}{"polygon": []interface{}{map[string]interface{}{"x": 0.0, "y": 0.0}}},
+			map[string]interface{}{"polygon": "triangle"},
+		} {
+			resp, err := svc.DoCommand(context.Background(),
+				map[string]interface{}{GetOccupancyGridCommand: map[string]interface{}{"crop": crop}})
+			test.That(t, errors.Is(err, ErrBadMapCrop), test.ShouldBeTrue)
+			test.That(t, err.Error(), test.ShouldStartWith, "invalid argument for "+GetOccupancyGridCommand+": ")
+			test.That(t, resp, test.ShouldBeNil)
+		}
+
+		resp, err := svc.DoCommand(context.Background(), map[string]interface{}{GetOccupancyGridCommand: map[string]interface{}{
+			"crop": map[string]interface{}{"minx": -1e300, "miny": -1e300, "maxx": 1e300, "maxy": 1e300},
+		}})
+		test.That(t, err, test.ShouldNotBeNil)
+		test.That(t, err.Error(), test.ShouldContainSubstring, "or a smaller crop")
+		test.That(t, resp, test.ShouldBeNil)
+	})
+
+	t.Run("get_occupancy_grid fails with an informative error for an empty map", func(t *testing.T) {
+		points = nil
+		resp, err := svc.DoCommand(context.Background(), map[string]interface{}{GetOccupancyGridCommand: nil})
+		test.That(t, err, test.ShouldBeError, ErrOccupancyGridMapEmpty)
+		test.That(t, resp, test.ShouldBeNil)
+
+		pointCloudMapErr = cartofacade.ErrPointCloudMapEmpty
+		resp, err = svc.DoCommand(context.Background(), map[string]interface{}{GetOccupancyGridCommand: nil})
+		test.That(t, err, test.ShouldBeError, ErrOccupancyGridMapEmpty)
+		test.That(t, resp, test.ShouldBeNil)
+	})
+}
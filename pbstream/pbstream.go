@@ -0,0 +1,139 @@
+// Package pbstream contains functionality to validate cartographer internal state (.pbstream) files
+package pbstream
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+)
+
+const (
+	// Extension is the file extension of a cartographer internal state file.
+	Extension = ".pbstream"
+	// magic is the number cartographer writes at the start of every pbstream, see
+	// cartographer/io/proto_stream.cc.
+	magic uint64 = 0x7b1d1f7b5bf501db
+	// frameHeaderSize is the size of the little endian uint64 written before each record.
+	frameHeaderSize = 8
+)
+
+var (
+	// ErrTruncated denotes that a pbstream ends with an incomplete record, e.g. because a save was interrupted.
+	ErrTruncated = errors.New("pbstream is truncated")
+	// ErrInvalidMagic denotes that a file does not start with the pbstream magic number.
+	ErrInvalidMagic = errors.New("pbstream does not start with the expected magic number")
+	// ErrNoRecords denotes that a pbstream does not contain any records.
+	ErrNoRecords = errors.New("pbstream does not contain any records")
+)
+
+// Validate checks the framing of the pbstream at path: the magic number must be present and every record
+// must be complete. A nil error does not guarantee the records themselves can be deserialized.
+func Validate(path string) error {
+	//nolint:gosec
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	var header [frameHeaderSize]byte
+	if _, err := io.ReadFull(file, header[:]); err != nil {
+		return fmt.Errorf("%w: %s is missing the magic number", ErrTruncated, path)
+	}
+	if binary.LittleEndian.Uint64(header[:]) != magic {
+		return fmt.Errorf("%w: %s", ErrInvalidMagic, path)
+	}
+
+	offset := int64(frameHeaderSize)
+	numRecords := 0
+	for offset < info.Size() {
+		if _, err := io.ReadFull(file, header[:]); err != nil {
+			return fmt.Errorf("%w: %s has an incomplete record header at byte %d", ErrTruncated, path, offset)
+		}
+		recordSize := binary.LittleEndian.Uint64(header[:])
+		offset += frameHeaderSize
+		if recordSize > uint64(info.Size()-offset) {
+			return fmt.Errorf("%w: %s record %d at byte %d needs %d bytes but only %d remain",
+				ErrTruncated, path, numRecords, offset, recordSize, info.Size()-offset)
+		}
+		if offset, err = file.Seek(int64(recordSize), io.SeekCurrent); err != nil {
+			return err
+		}
+		numRecords++
+	}
+
+	if numRecords == 0 {
+		return fmt.Errorf("%w: %s", ErrNoRecords, path)
+	}
+	return nil
+}
+
+// FindPreviousIntact returns the most recently modified pbstream in dirs, other than path itself, which is
+// not newer than path and passes Validate. The directory of path is searched if no dirs are given. An empty
+// string is returned if there is no such file.
+func FindPreviousIntact(path string, dirs ...string) (string, error) {
+	target, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	if len(dirs) == 0 {
+		dirs = []string{filepath.Dir(path)}
+	}
+
+	type candidate struct {
+		path    string
+		modTime int64
+	}
+	var candidates []candidate
+	var candidateInfos []os.FileInfo
+	for _, dir := range dirs {
+		dirEntries, err := os.ReadDir(dir)
+		if err != nil {
+			return "", err
+		}
+		for _, entry := range dirEntries {
+			if entry.IsDir() || !strings.HasSuffix(entry.Name(), Extension) {
+				continue
+			}
+			info, err := entry.Info()
+			if err != nil || os.SameFile(info, target) || info.ModTime().After(target.ModTime()) {
+				continue
+			}
+			// the same directory may be given twice, e.g. as the directory of path and as the one auto-saves land in
+			if slices.ContainsFunc(candidateInfos, func(other os.FileInfo) bool { return os.SameFile(info, other) }) {
+				continue
+			}
+			candidateInfos = append(candidateInfos, info)
+			candidates = append(candidates, candidate{
+				path:    filepath.Join(dir, entry.Name()),
+				modTime: info.ModTime().UnixNano(),
+			})
+		}
+	}
+
+	// newest first, ties broken by name so timestamped file names resolve deterministically
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].modTime != candidates[j].modTime {
+			return candidates[i].modTime > candidates[j].modTime
+		}
+		return candidates[i].path > candidates[j].path
+	})
+
+	for _, c := range candidates {
+		if Validate(c.path) == nil {
+			return c.path, nil
+		}
+	}
+	return "", nil
+}
@@ -0,0 +1,121 @@
+package pbstream
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.viam.com/test"
+)
+
+// makePbstream returns a pbstream with one record per payload.
+func makePbstream(payloads ...[]byte) []byte {
+	data := binary.LittleEndian.AppendUint64(nil, magic)
+	for _, payload := range payloads {
+		data = binary.LittleEndian.AppendUint64(data, uint64(len(payload)))
+		data = append(data, payload...)
+	}
+	return data
+}
+
+func writePbstream(t *testing.T, dir, name string, data []byte, modTime time.Time) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	test.That(t, os.WriteFile(path, data, 0o600), test.ShouldBeNil)
+	test.That(t, os.Chtimes(path, modTime, modTime), test.ShouldBeNil)
+	return path
+}
+
+func TestValidate(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	intact := makePbstream([]byte("header"), []byte("pose graph"), []byte("submap"))
+
+	t.Run("intact pbstream is valid", func(t *testing.T) {
+		path := writePbstream(t, dir, "intact.pbstream", intact, now)
+		test.That(t, Validate(path), test.ShouldBeNil)
+	})
+
+	t.Run("pbstream with an incomplete final record is truncated", func(t *testing.T) {
+		path := writePbstream(t, dir, "truncated_payload.pbstream", intact[:len(intact)-2], now)
+		test.That(t, Validate(path), test.ShouldWrap, ErrTruncated)
+	})
+
+	t.Run("pbstream with an incomplete final record header is truncated", func(t *testing.T) {
+		data := append(makePbstream([]byte("header")), 1, 0, 0)
+		path := writePbstream(t, dir, "truncated_header.pbstream", data, now)
+		test.That(t, Validate(path), test.ShouldWrap, ErrTruncated)
+	})
+
+	t.Run("pbstream without a complete magic number is truncated", func(t *testing.T) {
+		path := writePbstream(t, dir, "truncated_magic.pbstream", intact[:4], now)
+		test.That(t, Validate(path), test.ShouldWrap, ErrTruncated)
+	})
+
+	t.Run("file without the magic number is invalid", func(t *testing.T) {
+		path := writePbstream(t, dir, "not_a.pbstream", []byte("definitely not a pbstream"), now)
+		test.That(t, Validate(path), test.ShouldWrap, ErrInvalidMagic)
+	})
+
+	t.Run("pbstream without records is invalid", func(t *testing.T) {
+		path := writePbstream(t, dir, "empty.pbstream", makePbstream(), now)
+		test.That(t, Validate(path), test.ShouldWrap, ErrNoRecords)
+	})
+
+	t.Run("missing file returns an error", func(t *testing.T) {
+		test.That(t, Validate(filepath.Join(dir, "missing.pbstream")), test.ShouldWrap, os.ErrNotExist)
+	})
+}
+
+func TestFindPreviousIntact(t *testing.T) {
+	now := time.Now()
+	intact := makePbstream([]byte("header"), []byte("pose graph"))
+	truncated := intact[:len(intact)-1]
+
+	t.Run("returns the newest intact pbstream older than the truncated one", func(t *testing.T) {
+		dir := t.TempDir()
+		writePbstream(t, dir, "internal_state_0.pbstream", intact, now.Add(-3*time.Minute))
+		expected := writePbstream(t, dir, "internal_state_1.pbstream", intact, now.Add(-2*time.Minute))
+		writePbstream(t, dir, "internal_state_2.pbstream", truncated, now.Add(-time.Minute))
+		writePbstream(t, dir, "internal_state_4.pbstream", intact, now.Add(time.Minute))
+		writePbstream(t, dir, "notes.txt", intact, now.Add(-time.Minute))
+		path := writePbstream(t, dir, "internal_state_3.pbstream", truncated, now)
+
+		fallback, err := FindPreviousIntact(path)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, fallback, test.ShouldEqual, expected)
+	})
+
+	t.Run("searches the given directories rather than the directory of the pbstream", func(t *testing.T) {
+		deployDir, stateDir := t.TempDir(), t.TempDir()
+		writePbstream(t, deployDir, "internal_state_0.pbstream", intact, now.Add(-time.Minute))
+		expected := writePbstream(t, stateDir, "autosave_0.pbstream", intact, now.Add(-2*time.Minute))
+		path := writePbstream(t, deployDir, "internal_state_1.pbstream", truncated, now)
+
+		fallback, err := FindPreviousIntact(path, stateDir)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, fallback, test.ShouldEqual, expected)
+
+		fallback, err = FindPreviousIntact(path, stateDir, deployDir, deployDir)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, fallback, test.ShouldEqual, filepath.Join(deployDir, "internal_state_0.pbstream"))
+	})
+
+	t.Run("returns an empty string when there is no intact pbstream", func(t *testing.T) {
+		dir := t.TempDir()
+		writePbstream(t, dir, "internal_state_0.pbstream", truncated, now.Add(-time.Minute))
+		path := writePbstream(t, dir, "internal_state_1.pbstream", truncated, now)
+
+		fallback, err := FindPreviousIntact(path)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, fallback, test.ShouldBeEmpty)
+	})
+
+	t.Run("returns an error when the pbstream does not exist", func(t *testing.T) {
+		fallback, err := FindPreviousIntact(filepath.Join(t.TempDir(), "missing.pbstream"))
+		test.That(t, err, test.ShouldNotBeNil)
+		test.That(t, fallback, test.ShouldBeEmpty)
+	})
+}
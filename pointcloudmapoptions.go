@@ -0,0 +1,39 @@
+package viamcartographer
+
+import (
+	"context"
+
+	"github.com/viam-modules/viam-cartographer/postprocess"
+)
+
+// pointCloudMapOptions determine which map pointCloudMap returns. They are resolved once per call, so that a call
+// is not affected by the postprocessing being toggled or edited while it runs.
+type pointCloudMapOptions struct {
+	// returnEditedMap returns the edited map of the existing_map package if there is one.
+	returnEditedMap bool
+	// postprocessed applies the postprocessing tasks, or returns the postprocessed pointcloud of postprocess_path
+	// in localization mode.
+	postprocessed           bool
+	postprocessingTasks     []postprocess.Task
+	postprocessedPointCloud *[]byte
+	// crop crops the map, after it is postprocessed, if it is set.
+	crop *mapCropRegion
+}
+
+// pointCloudMapOptions returns the options of a call made with ctx, with the postprocessing of the service
+// unless the session of ctx overrides it.
+func (cartoSvc *CartographerService) pointCloudMapOptions(ctx context.Context, returnEditedMap bool) pointCloudMapOptions {
+	// the postprocessing is edited by DoCommand while PointCloudMap runs
+	cartoSvc.mu.Lock()
+	opts := pointCloudMapOptions{
+		returnEditedMap:         returnEditedMap,
+		postprocessed:           cartoSvc.postprocessed.Load(),
+		postprocessingTasks:     append([]postprocess.Task(nil), cartoSvc.postprocessingTasks...),
+		postprocessedPointCloud: cartoSvc.postprocessedPointCloud,
+	}
+	cartoSvc.mu.Unlock()
+	if postprocessed, ok := cartoSvc.sessionPostprocessing.get(sessionID(ctx)); ok {
+		opts.postprocessed = postprocessed
+	}
+	return opts
+}
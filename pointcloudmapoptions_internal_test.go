@@ -0,0 +1,272 @@
+package viamcartographer
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/geo/r3"
+	"github.com/pkg/errors"
+	"go.viam.com/rdk/logging"
+	"go.viam.com/rdk/pointcloud"
+	"go.viam.com/rdk/resource"
+	"go.viam.com/rdk/services/slam"
+	"go.viam.com/rdk/session"
+	"go.viam.com/test"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/viam-modules/viam-cartographer/cartofacade"
+	"github.com/viam-modules/viam-cartographer/postprocess"
+	"github.com/viam-modules/viam-cartographer/testhelper/pcdtest"
+)
+
+func TestPostprocessingTaskLimit(t *testing.T) {
+	svc := &CartographerService{
+		Named:                  resource.NewName(slam.API, "test").AsNamed(),
+		logger:                 logging.NewTestLogger(t),
+		maxPostprocessingTasks: 2,
+	}
+	points := []interface{}{map[string]interface{}{"X": float64(1), "Y": float64(2)}}
+	box := map[string]interface{}{"minx": float64(0), "miny": float64(0), "maxx": float64(1000), "maxy": float64(1000)}
+
+	t.Run("points can be added and removed up to max_postprocessing_tasks", func(t *testing.T) {
+		_, err := svc.DoCommand(context.Background(), map[string]interface{}{postprocess.AddCommand: points})
+		test.That(t, err, test.ShouldBeNil)
+		_, err = svc.DoCommand(context.Background(), map[string]interface{}{postprocess.RemoveCommand: points})
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, len(svc.postprocessingTasks), test.ShouldEqual, 2)
+	})
+
+	t.Run("adding, removing or cropping points beyond max_postprocessing_tasks fails", func(t *testing.T) {
+		for cmd, val := range map[string]interface{}{
+			postprocess.AddCommand:    points,
+			postprocess.RemoveCommand: points,
+			postprocess.CropCommand:   box,
+		} {
+			resp, err := svc.DoCommand(context.Background(), map[string]interface{}{cmd: val})
+			test.That(t, errors.Is(err, ErrTooManyPostprocessingTasks), test.ShouldBeTrue)
+			test.That(t, err.Error(), test.ShouldContainSubstring, "the limit of max_postprocessing_tasks is 2")
+			test.That(t, resp, test.ShouldBeNil)
+		}
+		test.That(t, len(svc.postprocessingTasks), test.ShouldEqual, 2)
+	})
+
+	t.Run("tasks can be added and undone while PointCloudMap reads them", func(t *testing.T) {
+		tasks := svc.postprocessingTasks
+		defer func() { svc.postprocessingTasks = tasks }()
+		svc.postprocessingTasks = nil
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(3)
+			go func() {
+				defer wg.Done()
+				//nolint:errcheck
+				svc.DoCommand(context.Background(), map[string]interface{}{postprocess.AddCommand: points})
+			}()
+			go func() {
+				defer wg.Done()
+				//nolint:errcheck
+				svc.DoCommand(context.Background(), map[string]interface{}{postprocess.UndoCommand: nil})
+			}()
+			go func() {
+				defer wg.Done()
+				svc.pointCloudMapOptions(context.Background(), false)
+			}()
+		}
+		wg.Wait()
+		test.That(t, len(svc.postprocessingTasks), test.ShouldBeBetweenOrEqual, 0, 2)
+	})
+
+	t.Run("undoing a task makes room for another one", func(t *testing.T) {
+		_, err := svc.DoCommand(context.Background(), map[string]interface{}{postprocess.UndoCommand: nil})
+		test.That(t, err, test.ShouldBeNil)
+		_, err = svc.DoCommand(context.Background(), map[string]interface{}{postprocess.CropCommand: box})
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, len(svc.postprocessingTasks), test.ShouldEqual, 2)
+		test.That(t, svc.postprocessingTasks[1], test.ShouldResemble, postprocess.Task{
+			Instruction: postprocess.Crop,
+			Box:         postprocess.Box{MaxX: 1000, MaxY: 1000},
+		})
+	})
+
+	t.Run("cropping fails for an invalid box", func(t *testing.T) {
+		for _, val := range []interface{}{
+			nil,
+			[]interface{}{float64(0), float64(0), float64(1000), float64(1000)},
+			map[string]interface{}{"minx": float64(0), "miny": float64(0), "maxx": float64(1000)},
+			map[string]interface{}{"minx": "0", "miny": float64(0), "maxx": float64(1000), "maxy": float64(1000)},
+			map[string]interface{}{"minx": float64(1000), "miny": float64(0), "maxx": float64(0), "maxy": float64(1000)},
+		} {
+			resp, err := svc.DoCommand(context.Background(), map[string]interface{}{postprocess.CropCommand: val})
+			test.That(t, errors.Is(err, ErrBadPostprocessingCropFormat), test.ShouldBeTrue)
+			test.That(t, err.Error(), test.ShouldStartWith, "invalid argument for "+postprocess.CropCommand+": ")
+			test.That(t, resp, test.ShouldBeNil)
+		}
+		test.That(t, len(svc.postprocessingTasks), test.ShouldEqual, 2)
+	})
+}
+
+func TestPostprocessDownsample(t *testing.T) {
+	// a dense 50x50 grid of points 10mm apart
+	pc := pointcloud.New()
+	for x := 0.0; x < 500; x += 10 {
+		for y := 0.0; y < 500; y += 10 {
+			test.That(t, pc.Set(r3.Vector{X: x, Y: y}, pointcloud.NewBasicData()), test.ShouldBeNil)
+		}
+	}
+	var pcd bytes.Buffer
+	test.That(t, pointcloud.ToPCD(pc, &pcd, pointcloud.PCDBinary), test.ShouldBeNil)
+	rawMap := pcd.Bytes()
+
+	mockCartoFacade := &cartofacade.Mock{}
+	mockCartoFacade.PointCloudMapFunc = func(ctx context.Context, timeout time.Duration) ([]byte, error) {
+		return rawMap, nil
+	}
+	svc := newTestService(mockCartoFacade, logging.NewTestLogger(t))
+	svc.maxPostprocessingTasks = 1
+	numPoints := func(t *testing.T) int {
+		t.Helper()
+		callback, err := svc.PointCloudMap(context.Background(), false)
+		test.That(t, err, test.ShouldBeNil)
+		pcm, err := slam.HelperConcatenateChunksToFull(callback)
+		test.That(t, err, test.ShouldBeNil)
+		pc, err := pointcloud.ReadPCD(bytes.NewReader(pcm))
+		test.That(t, err, test.ShouldBeNil)
+		return pc.Size()
+	}
+
+	t.Run("the pointcloud map keeps a single point per voxel while postprocessing is toggled on", func(t *testing.T) {
+		resp, err := svc.DoCommand(context.Background(), map[string]interface{}{postprocess.DownsampleCommand: float64(100)})
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, resp, test.ShouldResemble, map[string]interface{}{postprocess.DownsampleCommand: SuccessMessage})
+		test.That(t, numPoints(t), test.ShouldEqual, 5*5)
+
+		_, err = svc.DoCommand(context.Background(), map[string]interface{}{postprocess.ToggleCommand: nil})
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, numPoints(t), test.ShouldEqual, 50*50)
+		_, err = svc.DoCommand(context.Background(), map[string]interface{}{postprocess.ToggleCommand: nil})
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, numPoints(t), test.ShouldEqual, 5*5)
+
+		_, err = svc.DoCommand(context.Background(), map[string]interface{}{postprocess.UndoCommand: nil})
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, numPoints(t), test.ShouldEqual, 50*50)
+	})
+
+	t.Run("downsampling fails for an invalid voxel size", func(t *testing.T) {
+		for _, val := range []interface{}{nil, "100", float64(0), float64(-100)} {
+			resp, err := svc.DoCommand(context.Background(), map[string]interface{}{postprocess.DownsampleCommand: val})
+			test.That(t, errors.Is(err, ErrBadPostprocessingVoxelSize), test.ShouldBeTrue)
+			test.That(t, err.Error(), test.ShouldStartWith, "invalid argument for "+postprocess.DownsampleCommand+": ")
+			test.That(t, resp, test.ShouldBeNil)
+		}
+		test.That(t, svc.postprocessingTasks, test.ShouldBeEmpty)
+	})
+}
+
+func TestSessionPostprocessing(t *testing.T) {
+	rawMap := pcdtest.PointsToPCD(t, []r3.Vector{{X: 100}})
+
+	mockCartoFacade := &cartofacade.Mock{}
+	mockCartoFacade.PointCloudMapFunc = func(ctx context.Context, timeout time.Duration) ([]byte, error) {
+		return rawMap, nil
+	}
+	svc := newTestService(mockCartoFacade, logging.NewTestLogger(t))
+	svc.maxPostprocessingTasks = 1
+	points := []interface{}{map[string]interface{}{"X": float64(1000), "Y": float64(1000)}}
+	_, err := svc.DoCommand(context.Background(), map[string]interface{}{postprocess.AddCommand: points})
+	test.That(t, err, test.ShouldBeNil)
+
+	pointCloudMap := func(t *testing.T, ctx context.Context) []byte {
+		t.Helper()
+		callback, err := svc.PointCloudMap(ctx, false)
+		test.That(t, err, test.ShouldBeNil)
+		pcm, err := slam.HelperConcatenateChunksToFull(callback)
+		test.That(t, err, test.ShouldBeNil)
+		return pcm
+	}
+	postprocessedMap := pointCloudMap(t, context.Background())
+	test.That(t, postprocessedMap, test.ShouldNotResemble, rawMap)
+
+	newSessionCtx := func() context.Context {
+		return session.ToContext(context.Background(), session.New(context.Background(), "owner", time.Minute, nil))
+	}
+	setSessionPostprocessing := func(ctx context.Context, val interface{}) (map[string]interface{}, error) {
+		return svc.DoCommand(ctx, map[string]interface{}{SetSessionPostprocessingCommand: val})
+	}
+
+	t.Run("the override requires a session and a valid value", func(t *testing.T) {
+		resp, err := setSessionPostprocessing(context.Background(), map[string]interface{}{"postprocessed": false})
+		test.That(t, err, test.ShouldBeError, ErrNoSession)
+		test.That(t, resp, test.ShouldBeNil)
+
+		for _, val := range []interface{}{map[string]interface{}{}, map[string]interface{}{"postprocessed": "false"}, false} {
+			resp, err = setSessionPostprocessing(newSessionCtx(), val)
+			test.That(t, errors.Is(err, ErrBadSessionPostprocessing), test.ShouldBeTrue)
+			test.That(t, err.Error(), test.ShouldStartWith, "invalid argument for "+SetSessionPostprocessingCommand+": ")
+			test.That(t, resp, test.ShouldBeNil)
+		}
+	})
+
+	t.Run("a session gets the raw map while other callers get the postprocessed map", func(t *testing.T) {
+		rawCtx := newSessionCtx()
+		resp, err := setSessionPostprocessing(rawCtx, map[string]interface{}{"postprocessed": false})
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, resp, test.ShouldResemble, map[string]interface{}{PostprocessToggleResponseKey: false})
+		test.That(t, svc.postprocessed.Load(), test.ShouldBeTrue)
+
+		callers := []struct {
+			ctx      context.Context
+			expected []byte
+			maps     [][]byte
+		}{
+			{ctx: rawCtx, expected: rawMap},
+			{ctx: newSessionCtx(), expected: postprocessedMap},
+			{ctx: context.Background(), expected: postprocessedMap},
+		}
+		var wg sync.WaitGroup
+		for i := range callers {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 20; j++ {
+					callback, err := svc.PointCloudMap(callers[i].ctx, false)
+					if err != nil {
+						return
+					}
+					pcm, err := slam.HelperConcatenateChunksToFull(callback)
+					if err != nil {
+						return
+					}
+					callers[i].maps = append(callers[i].maps, pcm)
+				}
+			}()
+		}
+		wg.Wait()
+		for _, caller := range callers {
+			test.That(t, len(caller.maps), test.ShouldEqual, 20)
+			for _, pcm := range caller.maps {
+				test.That(t, pcm, test.ShouldResemble, caller.expected)
+			}
+		}
+
+		resp, err = setSessionPostprocessing(rawCtx, nil)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, resp, test.ShouldResemble, map[string]interface{}{PostprocessToggleResponseKey: true})
+		test.That(t, pointCloudMap(t, rawCtx), test.ShouldResemble, postprocessedMap)
+	})
+
+	t.Run("a session gets the postprocessed map while postprocessing is toggled off", func(t *testing.T) {
+		ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(session.IDMetadataKey, "session-id"))
+		_, err := setSessionPostprocessing(ctx, map[string]interface{}{"postprocessed": true})
+		test.That(t, err, test.ShouldBeNil)
+		_, err = svc.DoCommand(context.Background(), map[string]interface{}{postprocess.ToggleCommand: nil})
+		test.That(t, err, test.ShouldBeNil)
+		defer svc.postprocessed.Store(true)
+
+		test.That(t, pointCloudMap(t, ctx), test.ShouldResemble, postprocessedMap)
+		test.That(t, pointCloudMap(t, context.Background()), test.ShouldResemble, rawMap)
+	})
+}
@@ -0,0 +1,171 @@
+package viamcartographer
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/golang/geo/r3"
+	geo "github.com/kellydunn/golang-geo"
+	"github.com/pkg/errors"
+	"go.viam.com/rdk/components/movementsensor"
+	"go.viam.com/rdk/logging"
+	"go.viam.com/rdk/resource"
+	"go.viam.com/rdk/spatialmath"
+
+	vcConfig "github.com/viam-modules/viam-cartographer/config"
+)
+
+// PoseSensorModel is the model name of the movement sensor that republishes the pose of cartographer.
+var PoseSensorModel = resource.NewModel("viam", "slam", "cartographer-pose")
+
+const (
+	// posePollInterval is the minimum time between two calls to cartographer for its pose. Calls to the pose
+	// sensor in between are served the last pose.
+	posePollInterval = 100 * time.Millisecond
+	// maxPoseStaleness is how long the last pose is served while calls to cartographer for its pose fail.
+	maxPoseStaleness = 5 * time.Second
+)
+
+// cartoSvcs holds the running cartographer services of the module by name, so the pose sensor gets the pose of
+// its SLAM service in-process rather than through a client of the SLAM API.
+var cartoSvcs sync.Map
+
+func init() {
+	resource.RegisterComponent(movementsensor.API, PoseSensorModel, resource.Registration[
+		movementsensor.MovementSensor, *vcConfig.PoseSensorConfig]{
+		Constructor: newPoseSensor,
+	})
+}
+
+// poseSensor is a movement sensor whose position and orientation are the pose of a cartographer service of the
+// same module.
+type poseSensor struct {
+	resource.Named
+	resource.AlwaysRebuild
+	resource.TriviallyCloseable
+	slamService string
+	logger      logging.Logger
+
+	mu          sync.Mutex
+	pose        spatialmath.Pose
+	origin      *spatialmath.GeoPose
+	lastPolled  time.Time
+	lastUpdated time.Time
+	// now returns the current time. It is only overridden by tests.
+	now func() time.Time
+}
+
+func newPoseSensor(
+	ctx context.Context,
+	deps resource.Dependencies,
+	c resource.Config,
+	logger logging.Logger,
+) (movementsensor.MovementSensor, error) {
+	conf, err := resource.NativeConfig[*vcConfig.PoseSensorConfig](c)
+	if err != nil {
+		return nil, err
+	}
+	return &poseSensor{
+		Named:       c.ResourceName().AsNamed(),
+		slamService: conf.SLAMService,
+		logger:      logger,
+		now:         time.Now,
+	}, nil
+}
+
+// latestPose returns the pose of cartographer in the map frame and the geo pose of the map frame origin.
+func (ps *poseSensor) latestPose(ctx context.Context) (spatialmath.Pose, *spatialmath.GeoPose, error) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	now := ps.now()
+	if ps.pose != nil && now.Sub(ps.lastPolled) < posePollInterval {
+		return ps.pose, ps.origin, nil
+	}
+	ps.lastPolled = now
+
+	pose, origin, err := ps.pollPose(ctx)
+	if err != nil {
+		if ps.pose != nil && now.Sub(ps.lastUpdated) <= maxPoseStaleness {
+			ps.logger.Debugw("failed to get the pose from cartographer, using the last pose", "error", err)
+			return ps.pose, ps.origin, nil
+		}
+		return nil, nil, err
+	}
+	ps.pose = pose
+	ps.origin = origin
+	ps.lastUpdated = now
+	return pose, origin, nil
+}
+
+func (ps *poseSensor) pollPose(ctx context.Context) (spatialmath.Pose, *spatialmath.GeoPose, error) {
+	val, ok := cartoSvcs.Load(ps.slamService)
+	if !ok {
+		return nil, nil, errors.Errorf("no running %s service named %q in this module", Model, ps.slamService)
+	}
+	cartoSvc := val.(*CartographerService)
+	pose, err := cartoSvc.Position(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	// without an odometer the map frame is not geo referenced, so it is placed at (0, 0) with its y axis facing
+	// north, the same way odometer readings are placed before they are added to cartographer
+	origin := cartoSvc.odometerOrigin.Load()
+	if origin == nil {
+		origin = spatialmath.NewGeoPose(geo.NewPoint(0, 0), 0)
+	}
+	return pose, origin, nil
+}
+
+// Position returns the geo point of the pose of cartographer. It is relative to the first odometer reading that
+// was added to cartographer when there is one.
+func (ps *poseSensor) Position(ctx context.Context, extra map[string]interface{}) (*geo.Point, float64, error) {
+	pose, origin, err := ps.latestPose(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	return spatialmath.PoseToGeoPose(origin, pose).Location(), 0, nil
+}
+
+// Orientation returns the orientation of the pose of cartographer in the map frame.
+func (ps *poseSensor) Orientation(ctx context.Context, extra map[string]interface{}) (spatialmath.Orientation, error) {
+	pose, _, err := ps.latestPose(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return pose.Orientation(), nil
+}
+
+// Properties returns the supported properties of the pose sensor.
+func (ps *poseSensor) Properties(ctx context.Context, extra map[string]interface{}) (*movementsensor.Properties, error) {
+	return &movementsensor.Properties{
+		PositionSupported:    true,
+		OrientationSupported: true,
+	}, nil
+}
+
+// Readings returns the position and orientation of the pose sensor.
+func (ps *poseSensor) Readings(ctx context.Context, extra map[string]interface{}) (map[string]interface{}, error) {
+	return movementsensor.DefaultAPIReadings(ctx, ps, extra)
+}
+
+func (ps *poseSensor) LinearVelocity(ctx context.Context, extra map[string]interface{}) (r3.Vector, error) {
+	return r3.Vector{}, movementsensor.ErrMethodUnimplementedLinearVelocity
+}
+
+func (ps *poseSensor) AngularVelocity(ctx context.Context, extra map[string]interface{}) (spatialmath.AngularVelocity, error) {
+	return spatialmath.AngularVelocity{}, movementsensor.ErrMethodUnimplementedAngularVelocity
+}
+
+func (ps *poseSensor) LinearAcceleration(ctx context.Context, extra map[string]interface{}) (r3.Vector, error) {
+	return r3.Vector{}, movementsensor.ErrMethodUnimplementedLinearAcceleration
+}
+
+func (ps *poseSensor) CompassHeading(ctx context.Context, extra map[string]interface{}) (float64, error) {
+	return 0, movementsensor.ErrMethodUnimplementedCompassHeading
+}
+
+func (ps *poseSensor) Accuracy(ctx context.Context, extra map[string]interface{}) (*movementsensor.Accuracy, error) {
+	return nil, movementsensor.ErrMethodUnimplementedAccuracy
+}
@@ -0,0 +1,126 @@
+package viamcartographer
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	geo "github.com/kellydunn/golang-geo"
+	"go.viam.com/rdk/components/movementsensor"
+	"go.viam.com/rdk/logging"
+	"go.viam.com/rdk/resource"
+	"go.viam.com/rdk/services/slam"
+	"go.viam.com/rdk/spatialmath"
+	"go.viam.com/test"
+
+	"github.com/viam-modules/viam-cartographer/cartofacade"
+	vcConfig "github.com/viam-modules/viam-cartographer/config"
+)
+
+func TestPoseSensor(t *testing.T) {
+	logger := logging.NewTestLogger(t)
+	mockCartoFacade := &cartofacade.Mock{}
+	cartoSvc := &CartographerService{
+		Named:       resource.NewName(slam.API, "test_slam").AsNamed(),
+		cartofacade: mockCartoFacade,
+		logger:      logger,
+	}
+
+	facadePos := cartofacade.Position{X: 1000, Real: 1}
+	mockCartoFacade.PositionFunc = func(ctx context.Context, timeout time.Duration) (cartofacade.Position, error) {
+		return facadePos, nil
+	}
+
+	res, err := newPoseSensor(context.Background(), nil, resource.Config{
+		Name:                "test_pose",
+		API:                 movementsensor.API,
+		Model:               PoseSensorModel,
+		ConvertedAttributes: &vcConfig.PoseSensorConfig{SLAMService: "test_slam"},
+	}, logger)
+	test.That(t, err, test.ShouldBeNil)
+	ps := res.(*poseSensor)
+	now := time.Now()
+	ps.now = func() time.Time { return now }
+
+	// positionInMapFrame returns the position of the pose sensor in millimeters relative to origin
+	positionInMapFrame := func(t *testing.T, origin *geo.Point) (float64, float64) {
+		t.Helper()
+		point, altitude, err := ps.Position(context.Background(), nil)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, altitude, test.ShouldEqual, 0)
+		position := spatialmath.GeoPointToPoint(point, origin)
+		return position.X, position.Y
+	}
+
+	t.Run("fails when the slam service is not running in the module", func(t *testing.T) {
+		_, _, err := ps.Position(context.Background(), nil)
+		test.That(t, err, test.ShouldBeError, errors.New("no running viam:slam:cartographer service named \"test_slam\" in this module"))
+	})
+
+	cartoSvcs.Store("test_slam", cartoSvc)
+	defer cartoSvcs.Delete("test_slam")
+
+	t.Run("supports position and orientation", func(t *testing.T) {
+		props, err := ps.Properties(context.Background(), nil)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, props, test.ShouldResemble, &movementsensor.Properties{
+			PositionSupported:    true,
+			OrientationSupported: true,
+		})
+		_, err = ps.CompassHeading(context.Background(), nil)
+		test.That(t, err, test.ShouldBeError, movementsensor.ErrMethodUnimplementedCompassHeading)
+	})
+
+	t.Run("places the map frame at (0, 0) without an odometer origin", func(t *testing.T) {
+		x, y := positionInMapFrame(t, geo.NewPoint(0, 0))
+		test.That(t, x, test.ShouldAlmostEqual, 1000, 1)
+		test.That(t, y, test.ShouldAlmostEqual, 0, 1)
+
+		orientation, err := ps.Orientation(context.Background(), nil)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, spatialmath.OrientationAlmostEqual(orientation, &spatialmath.Quaternion{Real: 1}), test.ShouldBeTrue)
+	})
+
+	t.Run("tracks the cartographer pose at most once per poll interval", func(t *testing.T) {
+		facadePos = cartofacade.Position{X: 2000, Real: 1}
+		x, _ := positionInMapFrame(t, geo.NewPoint(0, 0))
+		test.That(t, x, test.ShouldAlmostEqual, 1000, 1)
+
+		now = now.Add(posePollInterval)
+		x, _ = positionInMapFrame(t, geo.NewPoint(0, 0))
+		test.That(t, x, test.ShouldAlmostEqual, 2000, 1)
+	})
+
+	t.Run("places the map frame at the odometer origin", func(t *testing.T) {
+		origin := geo.NewPoint(40.7, -73.9)
+		// the robot initially faced north, so the x axis of the map frame points north and the y axis west
+		cartoSvc.odometerOrigin.Store(spatialmath.NewGeoPose(origin, 270))
+		defer cartoSvc.odometerOrigin.Store(nil)
+
+		facadePos = cartofacade.Position{X: 1000, Y: 500, Real: 1}
+		now = now.Add(posePollInterval)
+		east, north := positionInMapFrame(t, origin)
+		test.That(t, east, test.ShouldAlmostEqual, -500, 1)
+		test.That(t, north, test.ShouldAlmostEqual, 1000, 1)
+	})
+
+	t.Run("serves the last pose until it is stale while cartographer fails", func(t *testing.T) {
+		facadePos = cartofacade.Position{X: 3000, Real: 1}
+		now = now.Add(posePollInterval)
+		x, _ := positionInMapFrame(t, geo.NewPoint(0, 0))
+		test.That(t, x, test.ShouldAlmostEqual, 3000, 1)
+
+		expectedErr := errors.New("cartographer failed")
+		mockCartoFacade.PositionFunc = func(ctx context.Context, timeout time.Duration) (cartofacade.Position, error) {
+			return cartofacade.Position{}, expectedErr
+		}
+		now = now.Add(maxPoseStaleness)
+		x, _ = positionInMapFrame(t, geo.NewPoint(0, 0))
+		test.That(t, x, test.ShouldAlmostEqual, 3000, 1)
+
+		now = now.Add(posePollInterval)
+		_, _, err := ps.Position(context.Background(), nil)
+		test.That(t, err, test.ShouldBeError, expectedErr)
+	})
+}
@@ -0,0 +1,186 @@
+package viamcartographer
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/viam-modules/viam-cartographer/cartofacade"
+)
+
+const (
+	// SubscribePosesCommand is sent to DoCommand to register a subscription to the poses of cartographer.
+	SubscribePosesCommand = "subscribe_poses"
+	// PollPosesCommand is sent to DoCommand to get the poses published to a subscription since the last poll.
+	PollPosesCommand = "poll_poses"
+	// UnsubscribePosesCommand is sent to DoCommand to remove a subscription to the poses of cartographer.
+	UnsubscribePosesCommand = "unsubscribe_poses"
+	// PosesKey is the key of the poses of the poll_poses response.
+	PosesKey = "poses"
+	// NumDroppedPosesKey is the key of the number of poses dropped from a full subscription since the last poll.
+	NumDroppedPosesKey = "num_dropped"
+	// PreOptimizationKey is set on the poses of the poll_poses response that were published while the existing map
+	// was optimized in the background, which are localized against the map as it was loaded.
+	PreOptimizationKey = "pre_optimization"
+	// defaultPoseSubscriptionBufferSize is the number of poses a subscription holds if it does not set one.
+	defaultPoseSubscriptionBufferSize = 100
+	// maxPoseSubscriptionBufferSize is the largest number of poses a subscription may hold.
+	maxPoseSubscriptionBufferSize = 10_000
+	// maxPoseSubscriptions is the number of subscriptions that may be registered at the same time.
+	maxPoseSubscriptions = 64
+	// poseSubscriptionTimeout is how long a subscription is kept without being polled.
+	poseSubscriptionTimeout = time.Minute
+)
+
+// timedPose is a pose published to the pose subscriptions along with the time it holds as of and whether it
+// was published before the initial optimization completed.
+type timedPose struct {
+	pos             cartofacade.Position
+	at              time.Time
+	preOptimization bool
+}
+
+// poseSubscription is a bounded ring buffer of the poses published since the subscription was last polled. Once it
+// is full, the oldest pose is dropped for every new one.
+type poseSubscription struct {
+	poses      []timedPose
+	start      int
+	numPoses   int
+	numDropped int
+	lastActive time.Time
+}
+
+// add adds pose to the subscription, dropping the oldest pose if it is full.
+func (sub *poseSubscription) add(pose timedPose) {
+	if sub.numPoses == len(sub.poses) {
+		sub.poses[sub.start] = pose
+		sub.start = (sub.start + 1) % len(sub.poses)
+		sub.numDropped++
+		return
+	}
+	sub.poses[(sub.start+sub.numPoses)%len(sub.poses)] = pose
+	sub.numPoses++
+}
+
+// drain returns the poses of the subscription from the oldest to the newest and the number of poses dropped since
+// the last drain, and empties it.
+func (sub *poseSubscription) drain() ([]timedPose, int) {
+	poses := make([]timedPose, sub.numPoses)
+	for i := range poses {
+		poses[i] = sub.poses[(sub.start+i)%len(sub.poses)]
+	}
+	numDropped := sub.numDropped
+	sub.start, sub.numPoses, sub.numDropped = 0, 0, 0
+	return poses, numDropped
+}
+
+// resize changes the number of poses the subscription holds to bufferSize, keeping the newest poses.
+func (sub *poseSubscription) resize(bufferSize int) {
+	if bufferSize == len(sub.poses) {
+		return
+	}
+	poses, numDropped := sub.drain()
+	if len(poses) > bufferSize {
+		numDropped += len(poses) - bufferSize
+		poses = poses[len(poses)-bufferSize:]
+	}
+	sub.poses = make([]timedPose, bufferSize)
+	sub.numPoses = copy(sub.poses, poses)
+	sub.numDropped = numDropped
+}
+
+// poseSubscriptions are the subscriptions of clients to the poses of cartographer, so that they are notified of new
+// poses rather than each polling Position. The pose is published by the lidar sensor processes after every lidar
+// reading that was added, i.e. at the data frequency of the lidars online, and by the session stats monitor every
+// sessionStatsPollInterval, which catches the pose changing without a new lidar reading, e.g. once it is optimized.
+// Subscriptions that are not polled for poseSubscriptionTimeout expire, so that those of clients that went away do
+// not leak. The zero value holds no subscriptions.
+type poseSubscriptions struct {
+	mu   sync.Mutex
+	subs map[string]*poseSubscription
+	// last is the last pose published, which is not published again until it changes.
+	last    cartofacade.Position
+	hasLast bool
+	// preOptimization is set while the existing map is optimized in the background, and marks the poses published
+	// meanwhile.
+	preOptimization atomic.Bool
+}
+
+// subscribe registers the subscription id holding up to bufferSize poses as of now. Subscribing again with the id
+// of a registered subscription keeps its poses and changes its buffer size.
+func (ps *poseSubscriptions) subscribe(id string, bufferSize int, now time.Time) error {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	ps.expire(now)
+	if sub, ok := ps.subs[id]; ok {
+		sub.resize(bufferSize)
+		sub.lastActive = now
+		return nil
+	}
+	if len(ps.subs) >= maxPoseSubscriptions {
+		return ErrTooManyPoseSubscriptions
+	}
+	if ps.subs == nil {
+		ps.subs = map[string]*poseSubscription{}
+	}
+	ps.subs[id] = &poseSubscription{poses: make([]timedPose, bufferSize), lastActive: now}
+	return nil
+}
+
+// poll returns the poses published to the subscription id since it was last polled and the number of them that
+// were dropped because it was full. It fails with ErrUnknownPoseSubscription if the subscription expired or was
+// never registered.
+func (ps *poseSubscriptions) poll(id string, now time.Time) ([]timedPose, int, error) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	ps.expire(now)
+	sub, ok := ps.subs[id]
+	if !ok {
+		return nil, 0, ErrUnknownPoseSubscription
+	}
+	sub.lastActive = now
+	poses, numDropped := sub.drain()
+	return poses, numDropped, nil
+}
+
+// unsubscribe removes the subscription id and returns whether it was registered.
+func (ps *poseSubscriptions) unsubscribe(id string) bool {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	_, ok := ps.subs[id]
+	delete(ps.subs, id)
+	return ok
+}
+
+// HasSubscribers returns whether any subscription is registered. Expired subscriptions are only removed once a
+// pose is published, so it may return true for one more pose after the last subscription expired.
+func (ps *poseSubscriptions) HasSubscribers() bool {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	return len(ps.subs) > 0
+}
+
+// PublishPose adds pos, which holds as of poseTime, to every subscription unless it is the same as the last pose
+// published. The subscriptions that expired as of now are removed first.
+func (ps *poseSubscriptions) PublishPose(pos cartofacade.Position, poseTime, now time.Time) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	ps.expire(now)
+	if ps.hasLast && pos == ps.last {
+		return
+	}
+	ps.last, ps.hasLast = pos, true
+	for _, sub := range ps.subs {
+		sub.add(timedPose{pos: pos, at: poseTime, preOptimization: ps.preOptimization.Load()})
+	}
+}
+
+// expire removes the subscriptions that have not been polled for poseSubscriptionTimeout as of now. It is called
+// with mu held.
+func (ps *poseSubscriptions) expire(now time.Time) {
+	for id, sub := range ps.subs {
+		if now.Sub(sub.lastActive) >= poseSubscriptionTimeout {
+			delete(ps.subs, id)
+		}
+	}
+}
@@ -0,0 +1,227 @@
+package viamcartographer
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.viam.com/rdk/logging"
+	"go.viam.com/test"
+	"go.viam.com/utils/testutils"
+
+	"github.com/viam-modules/viam-cartographer/cartofacade"
+	"github.com/viam-modules/viam-cartographer/sensorprocess"
+)
+
+func TestPoseSubscriptions(t *testing.T) {
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	xs := func(poses []timedPose) []float64 {
+		var xs []float64
+		for _, pose := range poses {
+			xs = append(xs, pose.pos.X)
+		}
+		return xs
+	}
+
+	t.Run("every subscriber receives the poses published since its last poll", func(t *testing.T) {
+		var ps poseSubscriptions
+		test.That(t, ps.HasSubscribers(), test.ShouldBeFalse)
+		test.That(t, ps.subscribe("a", 10, now), test.ShouldBeNil)
+		test.That(t, ps.HasSubscribers(), test.ShouldBeTrue)
+		ps.PublishPose(cartofacade.Position{X: 1}, now, now)
+		test.That(t, ps.subscribe("b", 10, now), test.ShouldBeNil)
+		ps.PublishPose(cartofacade.Position{X: 2}, now, now)
+		// the pose did not change, so it is not published again
+		ps.PublishPose(cartofacade.Position{X: 2}, now, now)
+		ps.PublishPose(cartofacade.Position{X: 3}, now, now)
+
+		poses, numDropped, err := ps.poll("a", now)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, xs(poses), test.ShouldResemble, []float64{1, 2, 3})
+		test.That(t, numDropped, test.ShouldEqual, 0)
+
+		poses, _, err = ps.poll("b", now)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, xs(poses), test.ShouldResemble, []float64{2, 3})
+
+		// a pose holds as of the reading time of the lidar reading it was localized for
+		readingTime := now.Add(-time.Second)
+		ps.PublishPose(cartofacade.Position{X: 4}, readingTime, now)
+		poses, _, err = ps.poll("a", now)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, xs(poses), test.ShouldResemble, []float64{4})
+		test.That(t, poses[0].at, test.ShouldEqual, readingTime)
+		poses, _, err = ps.poll("a", now)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, poses, test.ShouldBeEmpty)
+
+		test.That(t, ps.unsubscribe("a"), test.ShouldBeTrue)
+		test.That(t, ps.unsubscribe("a"), test.ShouldBeFalse)
+		_, _, err = ps.poll("a", now)
+		test.That(t, err, test.ShouldBeError, ErrUnknownPoseSubscription)
+		poses, _, err = ps.poll("b", now)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, xs(poses), test.ShouldResemble, []float64{4})
+	})
+
+	t.Run("a full subscription drops its oldest poses", func(t *testing.T) {
+		var ps poseSubscriptions
+		test.That(t, ps.subscribe("small", 3, now), test.ShouldBeNil)
+		test.That(t, ps.subscribe("large", 10, now), test.ShouldBeNil)
+		for x := 1; x <= 7; x++ {
+			ps.PublishPose(cartofacade.Position{X: float64(x)}, now, now)
+		}
+
+		poses, numDropped, err := ps.poll("small", now)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, xs(poses), test.ShouldResemble, []float64{5, 6, 7})
+		test.That(t, numDropped, test.ShouldEqual, 4)
+		poses, numDropped, err = ps.poll("large", now)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, xs(poses), test.ShouldResemble, []float64{1, 2, 3, 4, 5, 6, 7})
+		test.That(t, numDropped, test.ShouldEqual, 0)
+
+		// the number of dropped poses is reset by the poll
+		ps.PublishPose(cartofacade.Position{X: 8}, now, now)
+		poses, numDropped, err = ps.poll("small", now)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, xs(poses), test.ShouldResemble, []float64{8})
+		test.That(t, numDropped, test.ShouldEqual, 0)
+
+		// subscribing again shrinks the subscription to its newest poses
+		for x := 9; x <= 12; x++ {
+			ps.PublishPose(cartofacade.Position{X: float64(x)}, now, now)
+		}
+		test.That(t, ps.subscribe("large", 2, now), test.ShouldBeNil)
+		poses, numDropped, err = ps.poll("large", now)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, xs(poses), test.ShouldResemble, []float64{11, 12})
+		test.That(t, numDropped, test.ShouldEqual, 3)
+	})
+
+	t.Run("subscriptions expire once they are not polled", func(t *testing.T) {
+		var ps poseSubscriptions
+		test.That(t, ps.subscribe("polled", 10, now), test.ShouldBeNil)
+		test.That(t, ps.subscribe("idle", 10, now), test.ShouldBeNil)
+
+		later := now.Add(poseSubscriptionTimeout / 2)
+		_, _, err := ps.poll("polled", later)
+		test.That(t, err, test.ShouldBeNil)
+
+		// publishing removes the idle subscription, so it does not keep filling up
+		ps.PublishPose(cartofacade.Position{X: 1}, now.Add(poseSubscriptionTimeout), now.Add(poseSubscriptionTimeout))
+		test.That(t, ps.subs, test.ShouldHaveLength, 1)
+		_, _, err = ps.poll("idle", now.Add(poseSubscriptionTimeout))
+		test.That(t, err, test.ShouldBeError, ErrUnknownPoseSubscription)
+
+		poses, _, err := ps.poll("polled", later.Add(poseSubscriptionTimeout-time.Second))
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, xs(poses), test.ShouldResemble, []float64{1})
+		_, _, err = ps.poll("polled", later.Add(2*poseSubscriptionTimeout))
+		test.That(t, err, test.ShouldBeError, ErrUnknownPoseSubscription)
+		test.That(t, ps.subs, test.ShouldBeEmpty)
+	})
+
+	t.Run("the number of subscriptions is bounded", func(t *testing.T) {
+		var ps poseSubscriptions
+		for i := 0; i < maxPoseSubscriptions; i++ {
+			test.That(t, ps.subscribe(string(rune('a'+i)), 1, now), test.ShouldBeNil)
+		}
+		test.That(t, ps.subscribe("one too many", 1, now), test.ShouldBeError, ErrTooManyPoseSubscriptions)
+		// subscribing again does not register another subscription
+		test.That(t, ps.subscribe("a", 1, now), test.ShouldBeNil)
+
+		// expired subscriptions make room for new ones
+		test.That(t, ps.subscribe("one too many", 1, now.Add(poseSubscriptionTimeout)), test.ShouldBeNil)
+		test.That(t, ps.subs, test.ShouldHaveLength, 1)
+	})
+}
+
+func TestPoseSubscriptionCommands(t *testing.T) {
+	ctx := context.Background()
+	mockCartoFacade := &cartofacade.Mock{}
+	svc := newTestService(mockCartoFacade, logging.NewTestLogger(t))
+
+	t.Run("poses polled by the session stats monitor are published to the subscribers", func(t *testing.T) {
+		var x atomic.Int64
+		mockCartoFacade.UnresponsiveFunc = func() bool { return false }
+		mockCartoFacade.PositionFunc = func(ctx context.Context, timeout time.Duration) (cartofacade.Position, error) {
+			return cartofacade.Position{X: float64(x.Add(1)), Real: 1}, nil
+		}
+		svc.sessionStats = newSessionStats(time.Now(), defaultMaxSpeedMmPerSec)
+		svc.sensorStats = &sensorprocess.SensorStats{IsOnline: true}
+
+		for _, id := range []string{"a", "b"} {
+			resp, err := svc.DoCommand(ctx, map[string]interface{}{
+				SubscribePosesCommand: map[string]interface{}{"id": id, "buffer_size": 5.0},
+			})
+			test.That(t, err, test.ShouldBeNil)
+			test.That(t, resp, test.ShouldResemble, map[string]interface{}{
+				SubscribePosesCommand: SuccessMessage,
+				"id":                  id,
+				"buffer_size":         5,
+				"expires_after_sec":   poseSubscriptionTimeout.Seconds(),
+			})
+		}
+
+		cancelCtx, cancelFunc := context.WithCancel(ctx)
+		startSessionStatsMonitor(cancelCtx, svc)
+		for _, id := range []string{"a", "b"} {
+			testutils.WaitForAssertion(t, func(tb testing.TB) {
+				tb.Helper()
+				resp, err := svc.DoCommand(ctx, map[string]interface{}{PollPosesCommand: id})
+				test.That(tb, err, test.ShouldBeNil)
+				test.That(tb, resp[NumDroppedPosesKey], test.ShouldEqual, 0)
+				poses, ok := resp[PosesKey].([]interface{})
+				test.That(tb, ok, test.ShouldBeTrue)
+				test.That(tb, poses, test.ShouldNotBeEmpty)
+				pose, ok := poses[0].(map[string]interface{})
+				test.That(tb, ok, test.ShouldBeTrue)
+				test.That(tb, pose["x"], test.ShouldBeGreaterThan, 0)
+				test.That(tb, pose["real"], test.ShouldEqual, 1.0)
+				_, err = time.Parse(time.RFC3339Nano, pose["time"].(string))
+				test.That(tb, err, test.ShouldBeNil)
+			})
+		}
+		cancelFunc()
+		svc.waitForWorkers()
+
+		resp, err := svc.DoCommand(ctx, map[string]interface{}{UnsubscribePosesCommand: "a"})
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, resp, test.ShouldResemble, map[string]interface{}{UnsubscribePosesCommand: SuccessMessage})
+		_, err = svc.DoCommand(ctx, map[string]interface{}{PollPosesCommand: "a"})
+		test.That(t, err, test.ShouldBeError, ErrUnknownPoseSubscription)
+		_, err = svc.DoCommand(ctx, map[string]interface{}{UnsubscribePosesCommand: "a"})
+		test.That(t, err, test.ShouldBeError, ErrUnknownPoseSubscription)
+	})
+
+	t.Run("subscriptions default to a buffer of 100 poses", func(t *testing.T) {
+		resp, err := svc.DoCommand(ctx, map[string]interface{}{
+			SubscribePosesCommand: map[string]interface{}{"id": "default"},
+		})
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, resp["buffer_size"], test.ShouldEqual, defaultPoseSubscriptionBufferSize)
+	})
+
+	t.Run("invalid arguments are rejected", func(t *testing.T) {
+		for _, val := range []interface{}{
+			nil,
+			"a",
+			map[string]interface{}{"buffer_size": 5.0},
+			map[string]interface{}{"id": "a", "buffer_size": 0.0},
+			map[string]interface{}{"id": "a", "buffer_size": float64(maxPoseSubscriptionBufferSize + 1)},
+			map[string]interface{}{"id": "a", "buffer_size": "5"},
+		} {
+			_, err := svc.DoCommand(ctx, map[string]interface{}{SubscribePosesCommand: val})
+			test.That(t, errors.Is(err, ErrBadPoseSubscription), test.ShouldBeTrue)
+		}
+		for _, cmd := range []string{PollPosesCommand, UnsubscribePosesCommand} {
+			for _, val := range []interface{}{nil, "", 1.0} {
+				_, err := svc.DoCommand(ctx, map[string]interface{}{cmd: val})
+				test.That(t, errors.Is(err, ErrBadPoseSubscriptionID), test.ShouldBeTrue)
+			}
+		}
+	})
+}
@@ -0,0 +1,97 @@
+package postprocess
+
+import (
+	"bytes"
+	"errors"
+	"math"
+
+	"github.com/golang/geo/r2"
+	"github.com/golang/geo/r3"
+	"go.viam.com/rdk/pointcloud"
+)
+
+const (
+	// minBoundingBoxOverlap is the minimum intersection over union of the bounding boxes of an edited map and
+	// the map it was edited from for them to be considered consistent.
+	minBoundingBoxOverlap = 0.5
+	// maxCentroidOffset is the maximum distance between the centroids of an edited map and the map it was
+	// edited from, relative to the diagonal of the bounding box of the latter, for them to be considered consistent.
+	maxCentroidOffset = 0.25
+)
+
+var errEmptyMap = errors.New("cannot check the consistency of an empty map")
+
+// MapConsistency describes how well an edited map corresponds to the map it was edited from. Edits add and
+// remove points locally, so an edited map of the same map covers roughly the same area with roughly the
+// same point distribution.
+type MapConsistency struct {
+	// BoundingBoxOverlap is the intersection over union of the 2D bounding boxes of the two maps.
+	BoundingBoxOverlap float64
+	// CentroidOffset is the distance between the centroids of the two maps relative to the diagonal of the
+	// bounding box of the map the edited map is compared to.
+	CentroidOffset float64
+}
+
+// Consistent returns whether the edited map is considered to be an edit of the map it was compared to.
+func (c MapConsistency) Consistent() bool {
+	return c.BoundingBoxOverlap >= minBoundingBoxOverlap && c.CentroidOffset <= maxCentroidOffset
+}
+
+// CheckMapConsistency compares the bounding box and the centroid of the points of the edited map with
+// those of the map, both in the PCD format.
+func CheckMapConsistency(editedMap, currentMap []byte) (MapConsistency, error) {
+	editedBounds, editedCentroid, err := mapExtent(editedMap)
+	if err != nil {
+		return MapConsistency{}, err
+	}
+	bounds, centroid, err := mapExtent(currentMap)
+	if err != nil {
+		return MapConsistency{}, err
+	}
+
+	var overlap float64
+	if union := area(editedBounds.Union(bounds)); union > 0 {
+		overlap = area(editedBounds.Intersection(bounds)) / union
+	} else if editedBounds.ApproxEqual(bounds) {
+		// both maps are a single point or line
+		overlap = 1
+	}
+
+	var centroidOffset float64
+	offset := editedCentroid.Sub(centroid).Norm()
+	if diagonal := bounds.Size().Norm(); diagonal > 0 {
+		centroidOffset = offset / diagonal
+	} else if offset > 0 {
+		centroidOffset = math.Inf(1)
+	}
+
+	return MapConsistency{BoundingBoxOverlap: overlap, CentroidOffset: centroidOffset}, nil
+}
+
+// mapExtent returns the 2D bounding box and centroid of the points of a pointcloud map.
+func mapExtent(pcd []byte) (r2.Rect, r2.Point, error) {
+	pc, err := pointcloud.ReadPCD(bytes.NewReader(pcd))
+	if err != nil {
+		return r2.Rect{}, r2.Point{}, err
+	}
+	if pc.Size() == 0 {
+		return r2.Rect{}, r2.Point{}, errEmptyMap
+	}
+
+	bounds := r2.EmptyRect()
+	var sum r2.Point
+	pc.Iterate(0, 0, func(p r3.Vector, d pointcloud.Data) bool {
+		point := r2.Point{X: p.X, Y: p.Y}
+		bounds = bounds.AddPoint(point)
+		sum = sum.Add(point)
+		return true
+	})
+	return bounds, sum.Mul(1 / float64(pc.Size())), nil
+}
+
+func area(rect r2.Rect) float64 {
+	if rect.IsEmpty() {
+		return 0
+	}
+	return rect.X.Length() * rect.Y.Length()
+}
@@ -0,0 +1,66 @@
+package postprocess
+
+import (
+	"testing"
+
+	"github.com/golang/geo/r3"
+	"go.viam.com/test"
+
+	"github.com/viam-modules/viam-cartographer/testhelper/pcdtest"
+)
+
+func TestCheckMapConsistency(t *testing.T) {
+	var currentMap []byte
+	test.That(t, vecSliceToBytes(pcdtest.GridPoints(10, 1000, r3.Vector{}), &currentMap), test.ShouldBeNil)
+
+	t.Run("a map is consistent with itself", func(t *testing.T) {
+		consistency, err := CheckMapConsistency(currentMap, currentMap)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, consistency.BoundingBoxOverlap, test.ShouldAlmostEqual, 1)
+		test.That(t, consistency.CentroidOffset, test.ShouldAlmostEqual, 0)
+		test.That(t, consistency.Consistent(), test.ShouldBeTrue)
+	})
+
+	t.Run("a map with points added and removed is consistent", func(t *testing.T) {
+		points := pcdtest.GridPoints(10, 1000, r3.Vector{})[10:]
+		points = append(points, r3.Vector{X: 4500, Y: 4500}, r3.Vector{X: 9500, Y: 9500})
+		var editedMap []byte
+		test.That(t, vecSliceToBytes(points, &editedMap), test.ShouldBeNil)
+
+		consistency, err := CheckMapConsistency(editedMap, currentMap)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, consistency.BoundingBoxOverlap, test.ShouldBeGreaterThanOrEqualTo, minBoundingBoxOverlap)
+		test.That(t, consistency.Consistent(), test.ShouldBeTrue)
+	})
+
+	t.Run("an unrelated map is inconsistent", func(t *testing.T) {
+		var unrelatedMap []byte
+		test.That(t, vecSliceToBytes(pcdtest.GridPoints(5, 100, r3.Vector{X: 50000, Y: -20000}), &unrelatedMap), test.ShouldBeNil)
+
+		consistency, err := CheckMapConsistency(unrelatedMap, currentMap)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, consistency.BoundingBoxOverlap, test.ShouldEqual, 0)
+		test.That(t, consistency.CentroidOffset, test.ShouldBeGreaterThan, 1)
+		test.That(t, consistency.Consistent(), test.ShouldBeFalse)
+	})
+
+	t.Run("a shifted map is inconsistent", func(t *testing.T) {
+		var shiftedMap []byte
+		test.That(t, vecSliceToBytes(pcdtest.GridPoints(10, 1000, r3.Vector{X: 4500, Y: 4500}), &shiftedMap), test.ShouldBeNil)
+
+		consistency, err := CheckMapConsistency(shiftedMap, currentMap)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, consistency.BoundingBoxOverlap, test.ShouldBeLessThan, minBoundingBoxOverlap)
+		test.That(t, consistency.Consistent(), test.ShouldBeFalse)
+	})
+
+	t.Run("empty and invalid maps return an error", func(t *testing.T) {
+		var emptyMap []byte
+		test.That(t, vecSliceToBytes(nil, &emptyMap), test.ShouldBeNil)
+		_, err := CheckMapConsistency(emptyMap, currentMap)
+		test.That(t, err, test.ShouldBeError, errEmptyMap)
+
+		_, err = CheckMapConsistency(currentMap, []byte("not a pcd"))
+		test.That(t, err, test.ShouldNotBeNil)
+	})
+}
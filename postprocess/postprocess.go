@@ -4,8 +4,10 @@ package postprocess
 import (
 	"bytes"
 	"errors"
+	"fmt"
 	"image/color"
 	"math"
+	"sort"
 
 	"github.com/golang/geo/r3"
 	"go.viam.com/rdk/pointcloud"
@@ -19,6 +21,10 @@ const (
 	Add Instruction = iota
 	// Remove is the instruction for removing points.
 	Remove = iota
+	// Crop is the instruction for removing the points outside of a box.
+	Crop = iota
+	// Downsample is the instruction for keeping a single point per voxel.
+	Downsample = iota
 )
 
 const (
@@ -26,6 +32,10 @@ const (
 	removalRadius  = 100 // mm
 	xKey           = "X"
 	yKey           = "Y"
+	minXKey        = "minx"
+	minYKey        = "miny"
+	maxXKey        = "maxx"
+	maxYKey        = "maxy"
 
 	// ToggleCommand can be used to turn postprocessing on and off.
 	ToggleCommand = "postprocess_toggle"
@@ -33,6 +43,10 @@ const (
 	AddCommand = "postprocess_add"
 	// RemoveCommand can be used to remove points from the pointcloud  map.
 	RemoveCommand = "postprocess_remove"
+	// CropCommand can be used to remove the points outside of a box from the pointcloud map.
+	CropCommand = "postprocess_crop"
+	// DownsampleCommand can be used to keep a single point per voxel of the pointcloud map.
+	DownsampleCommand = "postprocess_downsample"
 	// UndoCommand can be used to undo last postprocessing step.
 	UndoCommand = "postprocess_undo"
 	// PathCommand can be used to specify a pcd that has already been postprocessed.
@@ -42,18 +56,48 @@ const (
 var (
 	errPointsNotASlice = errors.New("could not parse provided points as a slice")
 	errPointNotAMap    = errors.New("could not parse provided point as a map")
-	errXNotProvided    = errors.New("could X not provided")
+	errXNotProvided    = errors.New("X not provided")
 	errXNotFloat64     = errors.New("could not parse provided X as a float64")
-	errYNotProvided    = errors.New("could X not provided")
-	errYNotFloat64     = errors.New("could not parse provided X as a float64")
-	errRemovingPoints  = errors.New("unexpected number of points after removal")
+	errYNotProvided    = errors.New("Y not provided")
+	errYNotFloat64     = errors.New("could not parse provided Y as a float64")
 	errNilUpdatedData  = errors.New("cannot provide nil updated data")
+	errBoxNotAMap      = errors.New("could not parse provided box as a map")
+	errBoundNotFloat64 = errors.New("could not parse provided bound as a float64")
+	errBoundMissing    = errors.New("bound not provided")
+	errEmptyBox        = errors.New("the minimum of the box exceeds its maximum")
+
+	errVoxelSizeNotFloat64  = errors.New("could not parse provided voxel size as a float64")
+	errVoxelSizeNotPositive = errors.New("the voxel size must be a positive number of mm")
 )
 
+// Box is a rectangle in the XY plane of the pointcloud map, in mm.
+type Box struct {
+	MinX, MinY, MaxX, MaxY float64
+}
+
+// contains returns whether p lies within the box, including its edges.
+func (box Box) contains(p r3.Vector) bool {
+	return p.X >= box.MinX && p.X <= box.MaxX && p.Y >= box.MinY && p.Y <= box.MaxY
+}
+
+// intersect returns the box of the points within both box and other. It is empty if they do not overlap.
+func (box Box) intersect(other Box) Box {
+	return Box{
+		MinX: math.Max(box.MinX, other.MinX),
+		MinY: math.Max(box.MinY, other.MinY),
+		MaxX: math.Min(box.MaxX, other.MaxX),
+		MaxY: math.Min(box.MaxY, other.MaxY),
+	}
+}
+
 // Task can be used to construct a postprocessing step.
 type Task struct {
 	Instruction Instruction
 	Points      []r3.Vector
+	// Box is the box of a Crop task.
+	Box Box
+	// VoxelSizeMm is the edge length of the voxels of a Downsample task.
+	VoxelSizeMm float64
 }
 
 // ParseDoCommand parses postprocessing DoCommands into Tasks.
@@ -90,7 +134,7 @@ func ParseDoCommand(
 
 		yFloat, ok := y.(float64)
 		if !ok {
-			return Task{}, errXNotFloat64
+			return Task{}, errYNotFloat64
 		}
 
 		task.Points = append(task.Points, r3.Vector{X: xFloat, Y: yFloat})
@@ -98,9 +142,50 @@ func ParseDoCommand(
 	return task, nil
 }
 
+// ParseCropDoCommand parses the box of a crop DoCommand into a Crop Task.
+func ParseCropDoCommand(unstructuredBox interface{}) (Task, error) {
+	boxMap, ok := unstructuredBox.(map[string]interface{})
+	if !ok {
+		return Task{}, errBoxNotAMap
+	}
+
+	var bounds [4]float64
+	for i, key := range []string{minXKey, minYKey, maxXKey, maxYKey} {
+		bound, ok := boxMap[key]
+		if !ok {
+			return Task{}, fmt.Errorf("%w: %s", errBoundMissing, key)
+		}
+		boundFloat, ok := bound.(float64)
+		if !ok {
+			return Task{}, fmt.Errorf("%w: %s", errBoundNotFloat64, key)
+		}
+		bounds[i] = boundFloat
+	}
+
+	box := Box{MinX: bounds[0], MinY: bounds[1], MaxX: bounds[2], MaxY: bounds[3]}
+	if box.MinX > box.MaxX || box.MinY > box.MaxY {
+		return Task{}, errEmptyBox
+	}
+	return Task{Instruction: Crop, Box: box}, nil
+}
+
+// ParseDownsampleDoCommand parses the voxel size of a downsample DoCommand into a Downsample Task.
+func ParseDownsampleDoCommand(unstructuredVoxelSize interface{}) (Task, error) {
+	voxelSizeMm, ok := unstructuredVoxelSize.(float64)
+	if !ok {
+		return Task{}, errVoxelSizeNotFloat64
+	}
+	if !(voxelSizeMm > 0) || math.IsInf(voxelSizeMm, 1) {
+		return Task{}, errVoxelSizeNotPositive
+	}
+	return Task{Instruction: Downsample, VoxelSizeMm: voxelSizeMm}, nil
+}
+
 /*
-UpdatePointCloud iterated through a list of tasks and adds or removes points from data
-and writes the updated pointcloud to updatedData.
+UpdatePointCloud applies a list of tasks to data and writes the updated pointcloud to updatedData.
+The tasks are compacted first, so that the pointcloud is read and written once regardless of the
+number of tasks, and filtered once plus once per Downsample task. The result is the same as applying
+the tasks one after the other.
 */
 func UpdatePointCloud(
 	data []byte,
@@ -112,37 +197,63 @@ func UpdatePointCloud(
 	}
 
 	*updatedData = append(*updatedData, data...)
+	if len(tasks) == 0 {
+		return nil
+	}
 
-	// iterate through tasks and add or remove points
-	for _, task := range tasks {
-		switch task.Instruction {
-		case Add:
-			err := updatePointCloudWithAddedPoints(updatedData, task.Points)
-			if err != nil {
-				return err
-			}
-		case Remove:
-			err := updatePointCloudWithRemovedPoints(updatedData, task.Points)
-			if err != nil {
-				return err
-			}
+	pc, err := pointcloud.ReadPCD(bytes.NewReader(*updatedData))
+	if err != nil {
+		return err
+	}
+
+	// which point of a voxel is kept depends on the points added and removed before, so the tasks are only
+	// compacted up to each Downsample task
+	var compactFrom int
+	for i, task := range tasks {
+		if task.Instruction != Downsample {
+			continue
+		}
+		if pc, err = applyCompactedTasks(pc, compactTasks(tasks[compactFrom:i])); err != nil {
+			return err
 		}
+		if pc, err = downsample(pc, task.VoxelSizeMm); err != nil {
+			return err
+		}
+		compactFrom = i + 1
+	}
+	if pc, err = applyCompactedTasks(pc, compactTasks(tasks[compactFrom:])); err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	if err := pointcloud.ToPCD(pc, &buf, pointcloud.PCDBinary); err != nil {
+		return err
 	}
+	*updatedData = buf.Bytes()
 	return nil
 }
 
-func updatePointCloudWithAddedPoints(updatedData *[]byte, points []r3.Vector) error {
-	if updatedData == nil {
-		return errNilUpdatedData
+// applyCompactedTasks returns the pointcloud pc is updated to by compacted.
+func applyCompactedTasks(pc pointcloud.PointCloud, compacted compactedTasks) (pointcloud.PointCloud, error) {
+	if compacted.isEmpty() {
+		return pc, nil
 	}
 
-	reader := bytes.NewReader(*updatedData)
-	pc, err := pointcloud.ReadPCD(reader)
-	if err != nil {
-		return err
+	updatedPC := pointcloud.NewWithPrealloc(pc.Size() + len(compacted.added))
+	var setErr error
+	pc.Iterate(0, 0, func(p r3.Vector, d pointcloud.Data) bool {
+		if compacted.removed.contains(p) || (compacted.crop != nil && !compacted.crop.contains(p)) {
+			return true
+		}
+		setErr = updatedPC.Set(p, d)
+		// end early if point cannot be set
+		return setErr == nil
+	})
+	if setErr != nil {
+		return nil, setErr
 	}
 
-	for _, point := range points {
+	for _, point := range compacted.added {
 		/*
 			Viam expects pointcloud data with fields "x y z" or "x y z rgb", and for
 			this to be specified in the pointcloud header in the FIELDS entry. If color
@@ -151,83 +262,167 @@ func updatePointCloudWithAddedPoints(updatedData *[]byte, points []r3.Vector) er
 			confidence score to be encoded in the blue parameter of the RGB value, on a
 			scale from 1-100.
 		*/
-		err := pc.Set(point, pointcloud.NewColoredData(color.NRGBA{B: fullConfidence, R: math.MaxUint8}))
+		err := updatedPC.Set(point, pointcloud.NewColoredData(color.NRGBA{B: fullConfidence, R: math.MaxUint8}))
 		if err != nil {
-			return err
+			return nil, err
 		}
 	}
+	return updatedPC, nil
+}
 
-	var buf bytes.Buffer
-	err = pointcloud.ToPCD(pc, &buf, pointcloud.PCDBinary)
-	if err != nil {
-		return err
+// downsample returns the pointcloud of a single point of pc per voxel of voxelSizeMm. The point closest to the
+// center of its voxel is kept, with its data, so that the result does not depend on the order pc is iterated in.
+func downsample(pc pointcloud.PointCloud, voxelSizeMm float64) (pointcloud.PointCloud, error) {
+	type voxelPoint struct {
+		p        r3.Vector
+		d        pointcloud.Data
+		distance float64
 	}
+	voxels := map[[3]int64]voxelPoint{}
+	pc.Iterate(0, 0, func(p r3.Vector, d pointcloud.Data) bool {
+		voxel := [3]int64{
+			int64(math.Floor(p.X / voxelSizeMm)),
+			int64(math.Floor(p.Y / voxelSizeMm)),
+			int64(math.Floor(p.Z / voxelSizeMm)),
+		}
+		center := r3.Vector{
+			X: (float64(voxel[0]) + 0.5) * voxelSizeMm,
+			Y: (float64(voxel[1]) + 0.5) * voxelSizeMm,
+			Z: (float64(voxel[2]) + 0.5) * voxelSizeMm,
+		}
+		candidate := voxelPoint{p: p, d: d, distance: p.Distance(center)}
+		kept, ok := voxels[voxel]
+		if !ok || candidate.distance < kept.distance ||
+			(candidate.distance == kept.distance && lessVector(candidate.p, kept.p)) {
+			voxels[voxel] = candidate
+		}
+		return true
+	})
 
-	// Initialize updatedData with new points
-	*updatedData = make([]byte, buf.Len())
-	updatedReader := bytes.NewReader(buf.Bytes())
-	_, err = updatedReader.Read(*updatedData)
-	if err != nil {
-		return err
+	// the points are set in a fixed order, so that the same pointcloud is always written the same way
+	keptPoints := make([]voxelPoint, 0, len(voxels))
+	for _, kept := range voxels {
+		keptPoints = append(keptPoints, kept)
 	}
+	sort.Slice(keptPoints, func(i, j int) bool { return lessVector(keptPoints[i].p, keptPoints[j].p) })
 
-	return nil
+	downsampledPC := pointcloud.NewWithPrealloc(len(keptPoints))
+	for _, kept := range keptPoints {
+		if err := downsampledPC.Set(kept.p, kept.d); err != nil {
+			return nil, err
+		}
+	}
+	return downsampledPC, nil
 }
 
-func updatePointCloudWithRemovedPoints(updatedData *[]byte, points []r3.Vector) error {
-	if updatedData == nil {
-		return errNilUpdatedData
+// lessVector orders vectors by X, then Y, then Z.
+func lessVector(a, b r3.Vector) bool {
+	if a.X != b.X {
+		return a.X < b.X
 	}
-
-	reader := bytes.NewReader(*updatedData)
-	pc, err := pointcloud.ReadPCD(reader)
-	if err != nil {
-		return err
+	if a.Y != b.Y {
+		return a.Y < b.Y
 	}
+	return a.Z < b.Z
+}
 
-	updatedPC := pointcloud.NewWithPrealloc(pc.Size() - len(points))
-	pointsVisited := 0
+// compactedTasks is the combined effect of a list of tasks on a pointcloud: the points of the pointcloud within
+// the removal radius of any removed point or outside of the crop box are removed and the added points are added.
+type compactedTasks struct {
+	removed *removalIndex
+	// crop is the intersection of the boxes of all Crop tasks, or nil if there are none.
+	crop *Box
+	// added are the points of all Add tasks that were not removed by a later Remove or Crop task.
+	added []r3.Vector
+}
 
-	filterRemovedPoints := func(p r3.Vector, d pointcloud.Data) bool {
-		pointsVisited++
-		// Always return true so iteration continues
+// isEmpty returns whether the compacted tasks leave a pointcloud as it is.
+func (compacted compactedTasks) isEmpty() bool {
+	return len(compacted.removed.cells) == 0 && compacted.crop == nil && len(compacted.added) == 0
+}
 
-		for _, point := range points {
-			// remove all points within the removalRadius from the removed points
-			if point.Distance(p) <= removalRadius {
-				return true
+// compactTasks merges the Add tasks into a single list of points and folds the Remove tasks into a single
+// removal index. A Remove task only removes the points added before it, so the added points are filtered by
+// every Remove task that follows them. The Crop tasks are folded into a single box the same way, as a point of
+// the pointcloud is only kept if it lies within the box of every Crop task. The tasks themselves are left as they
+// are, so that undoing a task is still a matter of dropping it from the list.
+func compactTasks(tasks []Task) compactedTasks {
+	compacted := compactedTasks{removed: newRemovalIndex()}
+	for _, task := range tasks {
+		switch task.Instruction {
+		case Add:
+			compacted.added = append(compacted.added, task.Points...)
+		case Remove:
+			taskRemoved := newRemovalIndex()
+			for _, point := range task.Points {
+				taskRemoved.add(point)
+				compacted.removed.add(point)
+			}
+			kept := compacted.added[:0]
+			for _, point := range compacted.added {
+				if !taskRemoved.contains(point) {
+					kept = append(kept, point)
+				}
+			}
+			compacted.added = kept
+		case Crop:
+			crop := task.Box
+			if compacted.crop != nil {
+				crop = compacted.crop.intersect(crop)
 			}
+			compacted.crop = &crop
+			kept := compacted.added[:0]
+			for _, point := range compacted.added {
+				if task.Box.contains(point) {
+					kept = append(kept, point)
+				}
+			}
+			compacted.added = kept
 		}
-
-		err := updatedPC.Set(p, d)
-		// end early if point cannot be set
-		return err == nil
 	}
+	return compacted
+}
 
-	pc.Iterate(0, 0, filterRemovedPoints)
+// removalIndex is a spatial index of removed points in cells of the size of the removal radius, so that
+// whether a point is within the removal radius of any removed point is decided from the removed points
+// of the surrounding cells only.
+type removalIndex struct {
+	cells map[[3]int64][]r3.Vector
+}
 
-	// confirm iterate did not have to end early
-	if pc.Size() != pointsVisited {
-		/*
-			Note: this condition will occur if some error occurred while copying valid points
-			and will be how we can tell that this error occurred: err := updatedPC.Set(p, d)
-		*/
-		return errRemovingPoints
-	}
+func newRemovalIndex() *removalIndex {
+	return &removalIndex{cells: map[[3]int64][]r3.Vector{}}
+}
 
-	buf := bytes.Buffer{}
-	err = pointcloud.ToPCD(updatedPC, &buf, pointcloud.PCDBinary)
-	if err != nil {
-		return err
+func removalCell(p r3.Vector) [3]int64 {
+	return [3]int64{
+		int64(math.Floor(p.X / removalRadius)),
+		int64(math.Floor(p.Y / removalRadius)),
+		int64(math.Floor(p.Z / removalRadius)),
 	}
+}
 
-	// Overwrite updatedData with new points
-	*updatedData = make([]byte, buf.Len())
-	updatedReader := bytes.NewReader(buf.Bytes())
-	_, err = updatedReader.Read(*updatedData)
-	if err != nil {
-		return err
-	}
+func (index *removalIndex) add(p r3.Vector) {
+	cell := removalCell(p)
+	index.cells[cell] = append(index.cells[cell], p)
+}
 
-	return nil
+// contains returns whether p is within the removal radius of a removed point.
+func (index *removalIndex) contains(p r3.Vector) bool {
+	if len(index.cells) == 0 {
+		return false
+	}
+	cell := removalCell(p)
+	for dx := int64(-1); dx <= 1; dx++ {
+		for dy := int64(-1); dy <= 1; dy++ {
+			for dz := int64(-1); dz <= 1; dz++ {
+				for _, removed := range index.cells[[3]int64{cell[0] + dx, cell[1] + dy, cell[2] + dz}] {
+					if removed.Distance(p) <= removalRadius {
+						return true
+					}
+				}
+			}
+		}
+	}
+	return false
 }
@@ -3,8 +3,10 @@ package postprocess
 import (
 	"bytes"
 	"errors"
+	"fmt"
 	"image/color"
 	"math"
+	"strings"
 	"testing"
 
 	"github.com/golang/geo/r3"
@@ -72,6 +74,82 @@ func TestParseDoCommand(t *testing.T) {
 	})
 }
 
+func TestParseCropDoCommand(t *testing.T) {
+	box := func(minX, minY, maxX, maxY interface{}) map[string]interface{} {
+		return map[string]interface{}{"minx": minX, "miny": minY, "maxx": maxX, "maxy": maxY}
+	}
+
+	for _, tc := range []TestCase{
+		{
+			msg: "errors if the box is not a map",
+			cmd: []interface{}{float64(0), float64(0), float64(1), float64(1)},
+			err: errBoxNotAMap,
+		},
+		{
+			msg: "errors if a bound is not provided",
+			cmd: map[string]interface{}{"minx": float64(0), "miny": float64(0), "maxx": float64(1)},
+			err: errBoundMissing,
+		},
+		{
+			msg: "errors if a bound is not float64",
+			cmd: box(float64(0), float64(0), 1, float64(1)),
+			err: errBoundNotFloat64,
+		},
+		{
+			msg: "errors if the minimum of the box exceeds its maximum",
+			cmd: box(float64(0), float64(2), float64(1), float64(1)),
+			err: errEmptyBox,
+		},
+	} {
+		t.Run(tc.msg, func(t *testing.T) {
+			task, err := ParseCropDoCommand(tc.cmd)
+			test.That(t, errors.Is(err, tc.err), test.ShouldBeTrue)
+			test.That(t, task, test.ShouldResemble, Task{})
+		})
+	}
+
+	t.Run("succeeds if the box is a map of float64 bounds", func(t *testing.T) {
+		task, err := ParseCropDoCommand(box(float64(-1000), float64(-500), float64(1000), float64(500)))
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, task, test.ShouldResemble, Task{
+			Instruction: Crop,
+			Box:         Box{MinX: -1000, MinY: -500, MaxX: 1000, MaxY: 500},
+		})
+	})
+}
+
+func TestParseDownsampleDoCommand(t *testing.T) {
+	for _, tc := range []TestCase{
+		{
+			msg: "errors if the voxel size is not float64",
+			cmd: 50,
+			err: errVoxelSizeNotFloat64,
+		},
+		{
+			msg: "errors if the voxel size is zero",
+			cmd: float64(0),
+			err: errVoxelSizeNotPositive,
+		},
+		{
+			msg: "errors if the voxel size is negative",
+			cmd: float64(-50),
+			err: errVoxelSizeNotPositive,
+		},
+	} {
+		t.Run(tc.msg, func(t *testing.T) {
+			task, err := ParseDownsampleDoCommand(tc.cmd)
+			test.That(t, err, test.ShouldBeError, tc.err)
+			test.That(t, task, test.ShouldResemble, Task{})
+		})
+	}
+
+	t.Run("succeeds if the voxel size is a positive float64", func(t *testing.T) {
+		task, err := ParseDownsampleDoCommand(float64(50))
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, task, test.ShouldResemble, Task{Instruction: Downsample, VoxelSizeMm: 50})
+	})
+}
+
 func TestUpdatePointCloudWithAddedPoints(t *testing.T) {
 	t.Run("errors if byte slice cannot be converted to PCD", func(t *testing.T) {
 		originalPointsBytes := []byte("hello")
@@ -154,6 +232,254 @@ func TestUpdatePointCloud(t *testing.T) {
 	test.That(t, updatedData, test.ShouldResemble, postprocessedPointsBytes)
 }
 
+func TestUpdatePointCloudCrop(t *testing.T) {
+	// a 40x40 grid of points 50mm apart, from 0 to 1950mm
+	var originalPoints []r3.Vector
+	for x := 0.0; x < 2000; x += 50 {
+		for y := 0.0; y < 2000; y += 50 {
+			originalPoints = append(originalPoints, r3.Vector{X: x, Y: y})
+		}
+	}
+	var originalPointsBytes []byte
+	err := vecSliceToBytes(originalPoints, &originalPointsBytes)
+	test.That(t, err, test.ShouldBeNil)
+
+	numPoints := func(data []byte) int {
+		pc, err := pointcloud.ReadPCD(bytes.NewReader(data))
+		test.That(t, err, test.ShouldBeNil)
+		return pc.Size()
+	}
+	update := func(tasks []Task) []byte {
+		var updatedData []byte
+		test.That(t, UpdatePointCloud(originalPointsBytes, &updatedData, tasks), test.ShouldBeNil)
+		return updatedData
+	}
+
+	t.Run("drops the points outside of the box", func(t *testing.T) {
+		// the box includes its edges, so it holds 11x21 points of the grid
+		cropped := update([]Task{{Instruction: Crop, Box: Box{MinX: 500, MinY: 0, MaxX: 1000, MaxY: 1000}}})
+		test.That(t, numPoints(cropped), test.ShouldEqual, 11*21)
+
+		cropped = update([]Task{{Instruction: Crop, Box: Box{MinX: 5000, MinY: 5000, MaxX: 6000, MaxY: 6000}}})
+		test.That(t, numPoints(cropped), test.ShouldEqual, 0)
+	})
+
+	t.Run("stacks with the add and remove tasks in order", func(t *testing.T) {
+		tasks := []Task{
+			{Instruction: Add, Points: []r3.Vector{{X: 3000, Y: 3000}, {X: 525, Y: 525}}},
+			{Instruction: Remove, Points: []r3.Vector{{X: 500, Y: 500}}},
+			{Instruction: Crop, Box: Box{MinX: 0, MinY: 0, MaxX: 1000, MaxY: 1000}},
+			{Instruction: Add, Points: []r3.Vector{{X: 4000, Y: 4000}}},
+			{Instruction: Crop, Box: Box{MinX: 500, MinY: 500, MaxX: 5000, MaxY: 5000}},
+		}
+		// the points within the removal radius of (500, 500), the added (525, 525) among them, are removed, the
+		// added (3000, 3000) is cropped by the first box and the added (4000, 4000) is kept by the second one
+		box := Box{MinX: 500, MinY: 500, MaxX: 1000, MaxY: 1000}
+		removed := 0
+		for _, p := range originalPoints {
+			if box.contains(p) && p.Distance(r3.Vector{X: 500, Y: 500}) <= removalRadius {
+				removed++
+			}
+		}
+		test.That(t, numPoints(update(tasks)), test.ShouldEqual, 11*11-removed+1)
+	})
+
+	t.Run("undoing the crop restores the output before it", func(t *testing.T) {
+		tasks := []Task{
+			{Instruction: Add, Points: []r3.Vector{{X: 3000, Y: 3000}}},
+			{Instruction: Crop, Box: Box{MinX: 0, MinY: 0, MaxX: 1000, MaxY: 1000}},
+		}
+		beforeCrop := update(tasks[:1])
+		test.That(t, numPoints(beforeCrop), test.ShouldEqual, len(originalPoints)+1)
+		test.That(t, numPoints(update(tasks)), test.ShouldEqual, 21*21)
+		test.That(t, update(tasks[:1]), test.ShouldResemble, beforeCrop)
+		test.That(t, update(nil), test.ShouldResemble, originalPointsBytes)
+	})
+}
+
+func TestUpdatePointCloudDownsample(t *testing.T) {
+	// a dense 100x100 grid of points 10mm apart, from 0 to 990mm
+	var originalPoints []r3.Vector
+	for x := 0.0; x < 1000; x += 10 {
+		for y := 0.0; y < 1000; y += 10 {
+			originalPoints = append(originalPoints, r3.Vector{X: x, Y: y})
+		}
+	}
+	var originalPointsBytes []byte
+	err := vecSliceToBytes(originalPoints, &originalPointsBytes)
+	test.That(t, err, test.ShouldBeNil)
+
+	update := func(tasks []Task) []byte {
+		var updatedData []byte
+		test.That(t, UpdatePointCloud(originalPointsBytes, &updatedData, tasks), test.ShouldBeNil)
+		return updatedData
+	}
+	// headerField returns the value of the field of the header of a PCD
+	headerField := func(data []byte, field string) string {
+		for _, line := range strings.Split(string(data), "\n") {
+			if strings.HasPrefix(line, "DATA") {
+				break
+			}
+			if value, ok := strings.CutPrefix(line, field+" "); ok {
+				return value
+			}
+		}
+		return ""
+	}
+
+	for _, tc := range []struct {
+		voxelSizeMm float64
+		numPoints   int
+	}{
+		{voxelSizeMm: 5, numPoints: 100 * 100},
+		{voxelSizeMm: 50, numPoints: 20 * 20},
+		{voxelSizeMm: 100, numPoints: 10 * 10},
+		{voxelSizeMm: 2000, numPoints: 1},
+	} {
+		t.Run(fmt.Sprintf("keeps a single point per voxel of %vmm", tc.voxelSizeMm), func(t *testing.T) {
+			downsampled := update([]Task{{Instruction: Downsample, VoxelSizeMm: tc.voxelSizeMm}})
+			pc, err := pointcloud.ReadPCD(bytes.NewReader(downsampled))
+			test.That(t, err, test.ShouldBeNil)
+			test.That(t, pc.Size(), test.ShouldEqual, tc.numPoints)
+			test.That(t, headerField(downsampled, "WIDTH"), test.ShouldEqual, fmt.Sprint(tc.numPoints))
+			test.That(t, headerField(downsampled, "HEIGHT"), test.ShouldEqual, "1")
+			test.That(t, headerField(downsampled, "POINTS"), test.ShouldEqual, fmt.Sprint(tc.numPoints))
+		})
+	}
+
+	t.Run("keeps the point closest to the center of its voxel", func(t *testing.T) {
+		downsampled := update([]Task{{Instruction: Downsample, VoxelSizeMm: 100}})
+		pc, err := pointcloud.ReadPCD(bytes.NewReader(downsampled))
+		test.That(t, err, test.ShouldBeNil)
+		// the grid has a point at the center of every voxel, e.g. at (50, 50)
+		pc.Iterate(0, 0, func(p r3.Vector, d pointcloud.Data) bool {
+			test.That(t, math.Mod(p.X, 100), test.ShouldAlmostEqual, 50, 0.01)
+			test.That(t, math.Mod(p.Y, 100), test.ShouldAlmostEqual, 50, 0.01)
+			return true
+		})
+	})
+
+	t.Run("applies to the points added before it but not to the points added after it", func(t *testing.T) {
+		tasks := []Task{
+			{Instruction: Add, Points: []r3.Vector{{X: 2005, Y: 2005}, {X: 2010, Y: 2010}}},
+			{Instruction: Downsample, VoxelSizeMm: 100},
+			{Instruction: Add, Points: []r3.Vector{{X: 3005, Y: 3005}, {X: 3010, Y: 3010}}},
+		}
+		downsampled := update(tasks)
+		test.That(t, headerField(downsampled, "POINTS"), test.ShouldEqual, fmt.Sprint(10*10+1+2))
+		// undoing the points added after the downsampling keeps the downsampled points
+		test.That(t, headerField(update(tasks[:2]), "POINTS"), test.ShouldEqual, fmt.Sprint(10*10+1))
+		test.That(t, update(tasks[:1]), test.ShouldNotResemble, downsampled)
+	})
+}
+
+func TestUpdatePointCloudCompaction(t *testing.T) {
+	var originalPoints []r3.Vector
+	for x := 0.0; x < 2000; x += 50 {
+		for y := 0.0; y < 2000; y += 50 {
+			originalPoints = append(originalPoints, r3.Vector{X: x, Y: y})
+		}
+	}
+	var originalPointsBytes []byte
+	err := vecSliceToBytes(originalPoints, &originalPointsBytes)
+	test.That(t, err, test.ShouldBeNil)
+
+	// the tasks add points, remove some of the points added before and add points at removed locations again
+	tasks := []Task{
+		{Instruction: Add, Points: []r3.Vector{{X: 2500, Y: 2500}, {X: 3000, Y: 3000}}},
+		{Instruction: Add, Points: []r3.Vector{{X: 500, Y: 500}}},
+		{Instruction: Remove, Points: []r3.Vector{{X: 520, Y: 480}, {X: 2550, Y: 2550}, {X: 1950, Y: 0}}},
+		{Instruction: Add, Points: []r3.Vector{{X: 500, Y: 500}, {X: 2550, Y: 2550}}},
+		{Instruction: Remove, Points: []r3.Vector{{X: 3000, Y: 3000}, {X: 0, Y: 1000}, {X: 1000, Y: 1000}}},
+		{Instruction: Remove, Points: []r3.Vector{{X: 1000, Y: 1025}}},
+		{Instruction: Add, Points: []r3.Vector{{X: 1000, Y: 1000}, {X: -500, Y: -500}}},
+		{Instruction: Crop, Box: Box{MinX: -1000, MinY: 0, MaxX: 3000, MaxY: 1500}},
+		{Instruction: Downsample, VoxelSizeMm: 120},
+		{Instruction: Add, Points: []r3.Vector{{X: 2500, Y: 2500}, {X: 2510, Y: 2510}}},
+		{Instruction: Remove, Points: []r3.Vector{{X: 0, Y: 0}}},
+		{Instruction: Downsample, VoxelSizeMm: 250},
+		{Instruction: Crop, Box: Box{MinX: 500, MinY: -1000, MaxX: 4000, MaxY: 4000}},
+	}
+
+	// undoing tasks drops them from the end of the list, so every prefix of the tasks must give the same pointcloud
+	// as applying its tasks one after the other without any compaction
+	for numTasks := 0; numTasks <= len(tasks); numTasks++ {
+		expected := append([]byte{}, originalPointsBytes...)
+		for _, task := range tasks[:numTasks] {
+			switch task.Instruction {
+			case Add:
+				err = updatePointCloudWithAddedPoints(&expected, task.Points)
+			case Remove:
+				err = updatePointCloudWithRemovedPoints(&expected, task.Points)
+			case Crop:
+				err = updatePointCloudWithCroppedPoints(&expected, task.Box)
+			case Downsample:
+				err = updatePointCloudWithDownsampledPoints(&expected, task.VoxelSizeMm)
+			}
+			test.That(t, err, test.ShouldBeNil)
+		}
+
+		var updatedData []byte
+		err = UpdatePointCloud(originalPointsBytes, &updatedData, tasks[:numTasks])
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, updatedData, test.ShouldResemble, expected)
+	}
+}
+
+func TestRemovalIndex(t *testing.T) {
+	index := newRemovalIndex()
+	test.That(t, index.contains(r3.Vector{}), test.ShouldBeFalse)
+
+	index.add(r3.Vector{X: 1000, Y: 1000, Z: 0})
+	for _, tc := range []struct {
+		point    r3.Vector
+		contains bool
+	}{
+		{r3.Vector{X: 1000, Y: 1000}, true},
+		{r3.Vector{X: 1000 + removalRadius, Y: 1000}, true},
+		{r3.Vector{X: 1000 - removalRadius, Y: 1000}, true},
+		{r3.Vector{X: 1000 + removalRadius + 1, Y: 1000}, false},
+		{r3.Vector{X: 1070, Y: 1070}, true},
+		{r3.Vector{X: 1071, Y: 1071}, false},
+		{r3.Vector{X: 1000, Y: 1000, Z: -removalRadius}, true},
+		{r3.Vector{X: 1000, Y: 1000, Z: -removalRadius - 1}, false},
+	} {
+		test.That(t, index.contains(tc.point), test.ShouldEqual, tc.contains)
+	}
+}
+
+// BenchmarkUpdatePointCloud measures how applying the tasks scales with their number. As the tasks are compacted,
+// the pointcloud is only filtered once, so the time grows with the number of points of the tasks rather than
+// with the number of tasks times the size of the pointcloud.
+func BenchmarkUpdatePointCloud(b *testing.B) {
+	var originalPoints []r3.Vector
+	for x := 0.0; x < 10000; x += 50 {
+		for y := 0.0; y < 10000; y += 50 {
+			originalPoints = append(originalPoints, r3.Vector{X: x, Y: y})
+		}
+	}
+	var originalPointsBytes []byte
+	if err := vecSliceToBytes(originalPoints, &originalPointsBytes); err != nil {
+		b.Fatal(err)
+	}
+
+	for _, numTasks := range []int{1, 10, 100, 1000} {
+		tasks := make([]Task, numTasks)
+		for i := range tasks {
+			point := r3.Vector{X: float64(i * 37 % 10000), Y: float64(i * 91 % 10000)}
+			tasks[i] = Task{Instruction: Instruction(i % 2), Points: []r3.Vector{point}}
+		}
+		b.Run(fmt.Sprintf("%d tasks", numTasks), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				var updatedData []byte
+				if err := UpdatePointCloud(originalPointsBytes, &updatedData, tasks); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
 func vecSliceToBytes(points []r3.Vector, outputData *[]byte) error {
 	pc := pointcloud.NewWithPrealloc(len(points))
 	for _, p := range points {
@@ -172,3 +498,165 @@ func vecSliceToBytes(points []r3.Vector, outputData *[]byte) error {
 	updatedReader.Read(*outputData)
 	return nil
 }
+
+// The helpers below apply a single task to the pointcloud without the compaction UpdatePointCloud does, so that
+// its results can be checked against them.
+
+// errRemovingPoints is returned by updatePointCloudWithRemovedPoints when a point could not be kept.
+var errRemovingPoints = errors.New("unexpected number of points after removal")
+
+func updatePointCloudWithAddedPoints(updatedData *[]byte, points []r3.Vector) error {
+	if updatedData == nil {
+		return errNilUpdatedData
+	}
+
+	reader := bytes.NewReader(*updatedData)
+	pc, err := pointcloud.ReadPCD(reader)
+	if err != nil {
+		return err
+	}
+
+	for _, point := range points {
+		/*
+			Viam expects pointcloud data with fields "x y z" or "x y z rgb", and for
+			this to be specified in the pointcloud header in the FIELDS entry. If color
+			data is included in the pointcloud, Viam's services assume that the color
+			value encodes a confidence score for that data point. Viam expects the
+			confidence score to be encoded in the blue parameter of the RGB value, on a
+			scale from 1-100.
+		*/
+		err := pc.Set(point, pointcloud.NewColoredData(color.NRGBA{B: fullConfidence, R: math.MaxUint8}))
+		if err != nil {
+			return err
+		}
+	}
+
+	var buf bytes.Buffer
+	err = pointcloud.ToPCD(pc, &buf, pointcloud.PCDBinary)
+	if err != nil {
+		return err
+	}
+
+	// Initialize updatedData with new points
+	*updatedData = make([]byte, buf.Len())
+	updatedReader := bytes.NewReader(buf.Bytes())
+	_, err = updatedReader.Read(*updatedData)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func updatePointCloudWithRemovedPoints(updatedData *[]byte, points []r3.Vector) error {
+	if updatedData == nil {
+		return errNilUpdatedData
+	}
+
+	reader := bytes.NewReader(*updatedData)
+	pc, err := pointcloud.ReadPCD(reader)
+	if err != nil {
+		return err
+	}
+
+	updatedPC := pointcloud.NewWithPrealloc(pc.Size())
+	pointsVisited := 0
+
+	filterRemovedPoints := func(p r3.Vector, d pointcloud.Data) bool {
+		pointsVisited++
+		// Always return true so iteration continues
+
+		for _, point := range points {
+			// remove all points within the removalRadius from the removed points
+			if point.Distance(p) <= removalRadius {
+				return true
+			}
+		}
+
+		err := updatedPC.Set(p, d)
+		// end early if point cannot be set
+		return err == nil
+	}
+
+	pc.Iterate(0, 0, filterRemovedPoints)
+
+	// confirm iterate did not have to end early
+	if pc.Size() != pointsVisited {
+		/*
+			Note: this condition will occur if some error occurred while copying valid points
+			and will be how we can tell that this error occurred: err := updatedPC.Set(p, d)
+		*/
+		return errRemovingPoints
+	}
+
+	buf := bytes.Buffer{}
+	err = pointcloud.ToPCD(updatedPC, &buf, pointcloud.PCDBinary)
+	if err != nil {
+		return err
+	}
+
+	// Overwrite updatedData with new points
+	*updatedData = make([]byte, buf.Len())
+	updatedReader := bytes.NewReader(buf.Bytes())
+	_, err = updatedReader.Read(*updatedData)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func updatePointCloudWithCroppedPoints(updatedData *[]byte, box Box) error {
+	if updatedData == nil {
+		return errNilUpdatedData
+	}
+
+	pc, err := pointcloud.ReadPCD(bytes.NewReader(*updatedData))
+	if err != nil {
+		return err
+	}
+
+	updatedPC := pointcloud.NewWithPrealloc(pc.Size())
+	var setErr error
+	pc.Iterate(0, 0, func(p r3.Vector, d pointcloud.Data) bool {
+		if !box.contains(p) {
+			return true
+		}
+		setErr = updatedPC.Set(p, d)
+		// end early if point cannot be set
+		return setErr == nil
+	})
+	if setErr != nil {
+		return setErr
+	}
+
+	var buf bytes.Buffer
+	if err := pointcloud.ToPCD(updatedPC, &buf, pointcloud.PCDBinary); err != nil {
+		return err
+	}
+	*updatedData = buf.Bytes()
+	return nil
+}
+
+func updatePointCloudWithDownsampledPoints(updatedData *[]byte, voxelSizeMm float64) error {
+	if updatedData == nil {
+		return errNilUpdatedData
+	}
+
+	pc, err := pointcloud.ReadPCD(bytes.NewReader(*updatedData))
+	if err != nil {
+		return err
+	}
+
+	downsampledPC, err := downsample(pc, voxelSizeMm)
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	if err := pointcloud.ToPCD(downsampledPC, &buf, pointcloud.PCDBinary); err != nil {
+		return err
+	}
+	*updatedData = buf.Bytes()
+	return nil
+}
@@ -0,0 +1,190 @@
+package viamcartographer
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+	"go.viam.com/rdk/logging"
+)
+
+const (
+	// RecentErrorsKey is the key of the most recent warnings and errors logged by the service.
+	RecentErrorsKey = "recent_errors"
+	// DroppedRecentErrorsKey is the key of the number of warnings and errors that are no longer listed.
+	DroppedRecentErrorsKey = "dropped_recent_errors"
+	// ClearRecentErrorsCommand is sent to DoCommand to clear the recent warnings and errors.
+	ClearRecentErrorsCommand = "clear_recent_errors"
+	// ClearedRecentErrorsKey is the key of the number of cleared entries.
+	ClearedRecentErrorsKey = "cleared_recent_errors"
+)
+
+// recentError is a warning or error logged by the service.
+type recentError struct {
+	time    time.Time
+	level   zapcore.Level
+	message string
+	// err is the value of the error field of the log entry, if any. The other fields are not kept, so that values
+	// passed along with a message are not exposed to API clients.
+	err string
+}
+
+// recentErrors keeps the most recent warnings and errors logged by the service, so that they can be read through the
+// status command without access to the logs of the module.
+type recentErrors struct {
+	mu sync.Mutex
+	// entries holds the kept entries in a ring buffer of size entries, with next the index the next one is stored
+	// at once it is full.
+	entries []recentError
+	size    int
+	next    int
+	dropped int
+}
+
+func newRecentErrors(size int) *recentErrors {
+	return &recentErrors{size: size}
+}
+
+// keep keeps a warning or error, replacing the oldest kept entry once size entries are kept. Of keysAndValues, only
+// the value of the error key is kept.
+func (r *recentErrors) keep(level zapcore.Level, message string, keysAndValues []interface{}) {
+	kept := recentError{time: time.Now(), level: level, message: message}
+	for i := 0; i+1 < len(keysAndValues); i += 2 {
+		if key, ok := keysAndValues[i].(string); ok && key == "error" {
+			if err, ok := keysAndValues[i+1].(error); ok && err != nil {
+				kept.err = err.Error()
+			}
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.entries) < r.size {
+		r.entries = append(r.entries, kept)
+		return
+	}
+	r.entries[r.next] = kept
+	r.next = (r.next + 1) % r.size
+	r.dropped++
+}
+
+// toList returns the kept entries, oldest first, in the format of DoCommand responses, along with the number of
+// entries that were replaced by newer ones.
+func (r *recentErrors) toList() ([]interface{}, int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	list := []interface{}{}
+	for i := range r.entries {
+		kept := r.entries[(r.next+i)%len(r.entries)]
+		entry := map[string]interface{}{
+			"time":    kept.time.UTC().Format(time.RFC3339Nano),
+			"level":   kept.level.String(),
+			"message": kept.message,
+		}
+		if kept.err != "" {
+			entry["error"] = kept.err
+		}
+		list = append(list, entry)
+	}
+	return list, r.dropped
+}
+
+// clear removes all entries and returns how many there were, including the replaced ones.
+func (r *recentErrors) clear() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	cleared := len(r.entries) + r.dropped
+	r.entries = nil
+	r.next = 0
+	r.dropped = 0
+	return cleared
+}
+
+// recentErrorsLogger is the logger of the service, which keeps the warnings and errors it logs in recentErrors. It
+// wraps the logger of the resource rather than adding recentErrors as an appender of it, as appenders cannot be
+// removed once added and are shared with the loggers of other resources.
+type recentErrorsLogger struct {
+	logging.Logger
+	recentErrors *recentErrors
+}
+
+func newRecentErrorsLogger(logger logging.Logger, recentErrors *recentErrors) logging.Logger {
+	return &recentErrorsLogger{Logger: logger, recentErrors: recentErrors}
+}
+
+// keep keeps the entry if it is logged at the level of the logger.
+func (l *recentErrorsLogger) keep(level logging.Level, message string, keysAndValues []interface{}) {
+	if level >= l.GetLevel() {
+		l.recentErrors.keep(level.AsZap(), message, keysAndValues)
+	}
+}
+
+func (l *recentErrorsLogger) Sublogger(subname string) logging.Logger {
+	return newRecentErrorsLogger(l.Logger.Sublogger(subname), l.recentErrors)
+}
+
+func (l *recentErrorsLogger) WithFields(args ...interface{}) logging.Logger {
+	return newRecentErrorsLogger(l.Logger.WithFields(args...), l.recentErrors)
+}
+
+func (l *recentErrorsLogger) Warn(args ...interface{}) {
+	l.keep(logging.WARN, fmt.Sprint(args...), nil)
+	l.Logger.Warn(args...)
+}
+
+func (l *recentErrorsLogger) Warnf(template string, args ...interface{}) {
+	l.keep(logging.WARN, fmt.Sprintf(template, args...), nil)
+	l.Logger.Warnf(template, args...)
+}
+
+func (l *recentErrorsLogger) Warnw(msg string, keysAndValues ...interface{}) {
+	l.keep(logging.WARN, msg, keysAndValues)
+	l.Logger.Warnw(msg, keysAndValues...)
+}
+
+func (l *recentErrorsLogger) CWarn(ctx context.Context, args ...interface{}) {
+	l.keep(logging.WARN, fmt.Sprint(args...), nil)
+	l.Logger.CWarn(ctx, args...)
+}
+
+func (l *recentErrorsLogger) CWarnf(ctx context.Context, template string, args ...interface{}) {
+	l.keep(logging.WARN, fmt.Sprintf(template, args...), nil)
+	l.Logger.CWarnf(ctx, template, args...)
+}
+
+func (l *recentErrorsLogger) CWarnw(ctx context.Context, msg string, keysAndValues ...interface{}) {
+	l.keep(logging.WARN, msg, keysAndValues)
+	l.Logger.CWarnw(ctx, msg, keysAndValues...)
+}
+
+func (l *recentErrorsLogger) Error(args ...interface{}) {
+	l.keep(logging.ERROR, fmt.Sprint(args...), nil)
+	l.Logger.Error(args...)
+}
+
+func (l *recentErrorsLogger) Errorf(template string, args ...interface{}) {
+	l.keep(logging.ERROR, fmt.Sprintf(template, args...), nil)
+	l.Logger.Errorf(template, args...)
+}
+
+func (l *recentErrorsLogger) Errorw(msg string, keysAndValues ...interface{}) {
+	l.keep(logging.ERROR, msg, keysAndValues)
+	l.Logger.Errorw(msg, keysAndValues...)
+}
+
+func (l *recentErrorsLogger) CError(ctx context.Context, args ...interface{}) {
+	l.keep(logging.ERROR, fmt.Sprint(args...), nil)
+	l.Logger.CError(ctx, args...)
+}
+
+func (l *recentErrorsLogger) CErrorf(ctx context.Context, template string, args ...interface{}) {
+	l.keep(logging.ERROR, fmt.Sprintf(template, args...), nil)
+	l.Logger.CErrorf(ctx, template, args...)
+}
+
+func (l *recentErrorsLogger) CErrorw(ctx context.Context, msg string, keysAndValues ...interface{}) {
+	l.keep(logging.ERROR, msg, keysAndValues)
+	l.Logger.CErrorw(ctx, msg, keysAndValues...)
+}
@@ -0,0 +1,97 @@
+package viamcartographer
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.viam.com/rdk/logging"
+	"go.viam.com/test"
+
+	"github.com/viam-modules/viam-cartographer/cartofacade"
+)
+
+func TestRecentErrorsStatus(t *testing.T) {
+	mockCartoFacade := &cartofacade.Mock{}
+	mockCartoFacade.UnresponsiveFunc = func() bool { return true }
+	logger := logging.NewTestLogger(t)
+	svc := newTestService(mockCartoFacade, logger)
+	svc.cartoLib = &cartofacade.CartoLibMock{LogLevelFunc: func() (int, int) { return 0, 0 }}
+	svc.recentErrors = newRecentErrors(3)
+	resourceLogger := logger
+	logger = newRecentErrorsLogger(resourceLogger, svc.recentErrors)
+
+	t.Run("status omits the recent errors when there are none", func(t *testing.T) {
+		logger.Info("not a warning")
+		resp, err := svc.DoCommand(context.Background(), map[string]interface{}{StatusCommand: ""})
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, resp, test.ShouldNotContainKey, RecentErrorsKey)
+		test.That(t, resp, test.ShouldNotContainKey, DroppedRecentErrorsKey)
+	})
+
+	t.Run("status omits the warnings and errors that are not logged by the service", func(t *testing.T) {
+		resourceLogger.Warn("warning of the resource logger")
+		logging.NewTestLogger(t).Error("error of another resource")
+		logger.Sublogger("sensors").Info("not a warning")
+		resp, err := svc.DoCommand(context.Background(), map[string]interface{}{StatusCommand: ""})
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, resp, test.ShouldNotContainKey, RecentErrorsKey)
+	})
+
+	t.Run("status lists the recent warnings and errors with their level and error", func(t *testing.T) {
+		start := time.Now()
+		logger.Warnw("skipping lidar reading", "error", errors.New("VIAM_CARTO_LIDAR_READING_INVALID"), "lidar", "rplidar")
+		logger.Sublogger("sensors").Errorf("failed to get the position: %v", "timeout")
+
+		resp, err := svc.DoCommand(context.Background(), map[string]interface{}{StatusCommand: ""})
+		test.That(t, err, test.ShouldBeNil)
+		recentErrors, ok := resp[RecentErrorsKey].([]interface{})
+		test.That(t, ok, test.ShouldBeTrue)
+		test.That(t, recentErrors, test.ShouldHaveLength, 2)
+		for _, entry := range recentErrors {
+			loggedAt, err := time.Parse(time.RFC3339Nano, entry.(map[string]interface{})["time"].(string))
+			test.That(t, err, test.ShouldBeNil)
+			test.That(t, loggedAt, test.ShouldHappenOnOrAfter, start.Truncate(time.Second))
+			delete(entry.(map[string]interface{}), "time")
+		}
+		test.That(t, recentErrors, test.ShouldResemble, []interface{}{
+			map[string]interface{}{
+				"level":   "warn",
+				"message": "skipping lidar reading",
+				"error":   "VIAM_CARTO_LIDAR_READING_INVALID",
+			},
+			map[string]interface{}{"level": "error", "message": "failed to get the position: timeout"},
+		})
+		test.That(t, resp, test.ShouldNotContainKey, DroppedRecentErrorsKey)
+	})
+
+	t.Run("status lists only the most recent entries and counts the older ones", func(t *testing.T) {
+		for i := 0; i < 4; i++ {
+			logger.Warnf("warning %d", i)
+		}
+
+		resp, err := svc.DoCommand(context.Background(), map[string]interface{}{StatusCommand: ""})
+		test.That(t, err, test.ShouldBeNil)
+		recentErrors := resp[RecentErrorsKey].([]interface{})
+		test.That(t, recentErrors, test.ShouldHaveLength, 3)
+		for i, entry := range recentErrors {
+			test.That(t, entry.(map[string]interface{})["message"], test.ShouldEqual, fmt.Sprintf("warning %d", i+1))
+		}
+		test.That(t, resp[DroppedRecentErrorsKey], test.ShouldEqual, 3)
+	})
+
+	t.Run("clear_recent_errors clears the recent errors", func(t *testing.T) {
+		resp, err := svc.DoCommand(context.Background(), map[string]interface{}{ClearRecentErrorsCommand: nil})
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, resp, test.ShouldResemble, map[string]interface{}{
+			ClearRecentErrorsCommand: SuccessMessage,
+			ClearedRecentErrorsKey:   6,
+		})
+
+		resp, err = svc.DoCommand(context.Background(), map[string]interface{}{StatusCommand: ""})
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, resp, test.ShouldNotContainKey, RecentErrorsKey)
+	})
+}
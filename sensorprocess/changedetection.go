@@ -0,0 +1,202 @@
+package sensorprocess
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"sync"
+
+	"github.com/golang/geo/r3"
+	"go.viam.com/rdk/pointcloud"
+	"go.viam.com/rdk/spatialmath"
+)
+
+// heatmapMarginCells is the number of cells the heatmap extends past the map on every side, so that changes at
+// the edge of the map, e.g. an obstacle placed in front of a wall, are captured.
+const heatmapMarginCells = 20
+
+// ErrChangeDetectionMapNotLoaded denotes that the heatmap was requested before the map was loaded.
+var ErrChangeDetectionMapNotLoaded = errors.New("the map for change detection has not been loaded yet")
+
+type cell struct {
+	x, y int
+}
+
+// readOccupiedCells returns the cells, of resolution millimeters, that hold a point of the pointcloud map pcd,
+// along with the cells with the minimum and the maximum coordinates. The map is divided into cells once, so that
+// comparing a lidar reading against it is a lookup per point.
+func readOccupiedCells(pcd []byte, resolution float64) (map[cell]struct{}, cell, cell, error) {
+	pc, err := pointcloud.ReadPCD(bytes.NewReader(pcd))
+	if err != nil {
+		return nil, cell{}, cell{}, err
+	}
+
+	occupied := map[cell]struct{}{}
+	minCell := cell{x: math.MaxInt, y: math.MaxInt}
+	maxCell := cell{x: math.MinInt, y: math.MinInt}
+	pc.Iterate(0, 0, func(p r3.Vector, d pointcloud.Data) bool {
+		c := cellOf(p, resolution)
+		occupied[c] = struct{}{}
+		minCell = cell{x: min(minCell.x, c.x), y: min(minCell.y, c.y)}
+		maxCell = cell{x: max(maxCell.x, c.x), y: max(maxCell.y, c.y)}
+		return true
+	})
+	return occupied, minCell, maxCell, nil
+}
+
+func cellOf(p r3.Vector, resolution float64) cell {
+	return cell{x: int(math.Floor(p.X / resolution)), y: int(math.Floor(p.Y / resolution))}
+}
+
+// isNearOccupied returns whether c or any neighboring cell is occupied, which tolerates the noise of lidar readings
+// and of the pose they are placed in the map frame with.
+func isNearOccupied(occupied map[cell]struct{}, c cell) bool {
+	for dx := -1; dx <= 1; dx++ {
+		for dy := -1; dy <= 1; dy++ {
+			if _, ok := occupied[cell{x: c.x + dx, y: c.y + dy}]; ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ChangeDetector compares lidar readings, placed in the map frame, against the map cartographer localizes against
+// and accumulates where they disagree in a heatmap, without changing the map. A point of a reading disagrees with
+// the map if neither its cell nor any neighboring cell is occupied in the map. The heatmap only covers the map and
+// a margin around it, so its memory is bounded by the size of the map in cells of the resolution. It is safe for
+// concurrent use.
+type ChangeDetector struct {
+	// Resolution is the size, in millimeters, of the cells the map and the heatmap are divided into.
+	Resolution float64
+
+	mu       sync.Mutex
+	occupied map[cell]struct{}
+	min, max cell
+	heatmap  map[cell]int64
+	numScans int64
+}
+
+// SetMap loads the map, a pointcloud in the PCD format, that readings are compared against.
+func (detector *ChangeDetector) SetMap(pcd []byte) error {
+	occupied, minCell, maxCell, err := readOccupiedCells(pcd, detector.Resolution)
+	if err != nil {
+		return err
+	}
+	if len(occupied) == 0 {
+		return errors.New("cannot detect changes against an empty map")
+	}
+
+	detector.mu.Lock()
+	defer detector.mu.Unlock()
+	detector.occupied = occupied
+	detector.min = cell{x: minCell.x - heatmapMarginCells, y: minCell.y - heatmapMarginCells}
+	detector.max = cell{x: maxCell.x + heatmapMarginCells, y: maxCell.y + heatmapMarginCells}
+	detector.heatmap = map[cell]int64{}
+	detector.numScans = 0
+	return nil
+}
+
+// addReading compares the points of the reading, placed in the map frame with scanPose, against the map and
+// returns the fraction of the points within the heatmap that disagree with it. Returns false if the map has not
+// been loaded yet.
+func (detector *ChangeDetector) addReading(pc pointcloud.PointCloud, scanPose spatialmath.Pose) (float64, bool) {
+	detector.mu.Lock()
+	defer detector.mu.Unlock()
+	if detector.occupied == nil {
+		return 0, false
+	}
+
+	var numPoints, numDisagreeing int
+	pc.Iterate(0, 0, func(p r3.Vector, d pointcloud.Data) bool {
+		c := cellOf(spatialmath.Compose(scanPose, spatialmath.NewPoseFromPoint(p)).Point(), detector.Resolution)
+		if c.x < detector.min.x || c.x > detector.max.x || c.y < detector.min.y || c.y > detector.max.y {
+			return true
+		}
+		numPoints++
+		if !isNearOccupied(detector.occupied, c) {
+			numDisagreeing++
+			detector.heatmap[c]++
+		}
+		return true
+	})
+	detector.numScans++
+	if numPoints == 0 {
+		return 0, true
+	}
+	return float64(numDisagreeing) / float64(numPoints), true
+}
+
+// NumScans returns the number of readings that were compared against the map.
+func (detector *ChangeDetector) NumScans() int64 {
+	detector.mu.Lock()
+	defer detector.mu.Unlock()
+	return detector.numScans
+}
+
+// NumChangedCells returns the number of cells in which a reading disagreed with the map.
+func (detector *ChangeDetector) NumChangedCells() int {
+	detector.mu.Lock()
+	defer detector.mu.Unlock()
+	return len(detector.heatmap)
+}
+
+// HeatmapPCD returns the heatmap as a pointcloud in the PCD format with a point at the center of every cell in
+// which a reading disagreed with the map. The red channel of a point is the number of disagreeing points in its
+// cell relative to the cell with the most.
+func (detector *ChangeDetector) HeatmapPCD() ([]byte, error) {
+	detector.mu.Lock()
+	defer detector.mu.Unlock()
+	if detector.occupied == nil {
+		return nil, ErrChangeDetectionMapNotLoaded
+	}
+
+	maxCount := detector.maxCount()
+	pc := pointcloud.NewWithPrealloc(len(detector.heatmap))
+	for c, count := range detector.heatmap {
+		center := r3.Vector{X: (float64(c.x) + 0.5) * detector.Resolution, Y: (float64(c.y) + 0.5) * detector.Resolution}
+		intensity := uint8(math.Round(255 * float64(count) / float64(maxCount)))
+		if err := pc.Set(center, pointcloud.NewColoredData(color.NRGBA{R: intensity, A: 255})); err != nil {
+			return nil, err
+		}
+	}
+	var buf bytes.Buffer
+	if err := pointcloud.ToPCD(pc, &buf, pointcloud.PCDBinary); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// HeatmapPNG returns the heatmap as a grayscale PNG image with a pixel per cell, covering the map and the margin
+// around it with +y of the map frame facing up. The brightness of a pixel is the number of disagreeing points in
+// its cell relative to the cell with the most.
+func (detector *ChangeDetector) HeatmapPNG() ([]byte, error) {
+	detector.mu.Lock()
+	defer detector.mu.Unlock()
+	if detector.occupied == nil {
+		return nil, ErrChangeDetectionMapNotLoaded
+	}
+
+	maxCount := detector.maxCount()
+	img := image.NewGray(image.Rect(0, 0, detector.max.x-detector.min.x+1, detector.max.y-detector.min.y+1))
+	for c, count := range detector.heatmap {
+		intensity := uint8(math.Round(255 * float64(count) / float64(maxCount)))
+		img.SetGray(c.x-detector.min.x, detector.max.y-c.y, color.Gray{Y: intensity})
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (detector *ChangeDetector) maxCount() int64 {
+	var maxCount int64
+	for _, count := range detector.heatmap {
+		maxCount = max(maxCount, count)
+	}
+	return maxCount
+}
@@ -0,0 +1,138 @@
+package sensorprocess
+
+import (
+	"bytes"
+	"context"
+	"image/png"
+	"testing"
+	"time"
+
+	"github.com/golang/geo/r3"
+	"go.viam.com/rdk/logging"
+	"go.viam.com/rdk/pointcloud"
+	"go.viam.com/test"
+
+	"github.com/viam-modules/viam-cartographer/cartofacade"
+	s "github.com/viam-modules/viam-cartographer/sensors"
+	"github.com/viam-modules/viam-cartographer/sensors/inject"
+	"github.com/viam-modules/viam-cartographer/testhelper/pcdtest"
+)
+
+// roomWalls returns points every 50mm along the walls of a 5m x 5m room with a corner at the origin.
+func roomWalls() []r3.Vector {
+	var points []r3.Vector
+	for d := 0.0; d <= 5000; d += 50 {
+		points = append(points,
+			r3.Vector{X: d, Y: 0}, r3.Vector{X: d, Y: 5000},
+			r3.Vector{X: 0, Y: d}, r3.Vector{X: 5000, Y: d})
+	}
+	return points
+}
+
+func TestChangeDetection(t *testing.T) {
+	logger := logging.NewTestLogger(t)
+	resolution := 100.0
+	robotPosition := r3.Vector{X: 2500, Y: 2500}
+	// an obstacle that is not in the map, in the map frame
+	obstacleMin := r3.Vector{X: 3500, Y: 1500}
+	obstacleMax := r3.Vector{X: 3800, Y: 1800}
+
+	// the scan sees the walls and the obstacle, in the lidar frame
+	var scanPoints []r3.Vector
+	for _, p := range roomWalls() {
+		scanPoints = append(scanPoints, p.Sub(robotPosition))
+	}
+	for x := obstacleMin.X; x <= obstacleMax.X; x += 50 {
+		for y := obstacleMin.Y; y <= obstacleMax.Y; y += 50 {
+			scanPoints = append(scanPoints, r3.Vector{X: x, Y: y}.Sub(robotPosition))
+		}
+	}
+	reading := s.TimedLidarReadingResponse{Reading: pcdtest.PointsToPCD(t, scanPoints), ReadingTime: time.Now().UTC()}
+
+	cf := cartofacade.Mock{}
+	cf.AddLidarReadingFunc = func(
+		ctx context.Context,
+		timeout time.Duration,
+		sensorName string,
+		currentReading s.TimedLidarReadingResponse,
+	) error {
+		return nil
+	}
+	cf.PositionFunc = func(ctx context.Context, timeout time.Duration) (cartofacade.Position, error) {
+		return cartofacade.Position{X: robotPosition.X, Y: robotPosition.Y, Real: 1}, nil
+	}
+	injectLidar := inject.TimedLidar{}
+	injectLidar.NameFunc = func() string { return "good_lidar" }
+
+	detector := &ChangeDetector{Resolution: resolution}
+	config := Config{
+		Logger:         logger,
+		CartoFacade:    &cf,
+		IsOnline:       true,
+		Lidar:          &injectLidar,
+		Timeout:        10 * time.Second,
+		ChangeDetector: detector,
+	}
+
+	t.Run("readings are not compared before the map is loaded", func(t *testing.T) {
+		test.That(t, config.tryAddLidarReading(context.Background(), reading), test.ShouldBeNil)
+		test.That(t, detector.NumScans(), test.ShouldEqual, 0)
+		_, err := detector.HeatmapPNG()
+		test.That(t, err, test.ShouldBeError, ErrChangeDetectionMapNotLoaded)
+	})
+
+	test.That(t, detector.SetMap(pcdtest.PointsToPCD(t, roomWalls())), test.ShouldBeNil)
+
+	t.Run("readings that match the map do not change the heatmap", func(t *testing.T) {
+		var wallPoints []r3.Vector
+		for _, p := range roomWalls() {
+			wallPoints = append(wallPoints, p.Sub(robotPosition))
+		}
+		wallReading := s.TimedLidarReadingResponse{Reading: pcdtest.PointsToPCD(t, wallPoints), ReadingTime: time.Now().UTC()}
+		test.That(t, config.tryAddLidarReading(context.Background(), wallReading), test.ShouldBeNil)
+		test.That(t, detector.NumScans(), test.ShouldEqual, 1)
+		test.That(t, detector.NumChangedCells(), test.ShouldEqual, 0)
+	})
+
+	for i := 0; i < 3; i++ {
+		reading.ReadingTime = time.Now().UTC()
+		test.That(t, config.tryAddLidarReading(context.Background(), reading), test.ShouldBeNil)
+	}
+
+	t.Run("the heatmap pointcloud highlights the obstacle", func(t *testing.T) {
+		test.That(t, detector.NumScans(), test.ShouldEqual, 4)
+		test.That(t, detector.NumChangedCells(), test.ShouldBeGreaterThan, 0)
+
+		heatmap, err := detector.HeatmapPCD()
+		test.That(t, err, test.ShouldBeNil)
+		pc, err := pointcloud.ReadPCD(bytes.NewReader(heatmap))
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, pc.Size(), test.ShouldEqual, detector.NumChangedCells())
+		pc.Iterate(0, 0, func(p r3.Vector, d pointcloud.Data) bool {
+			test.That(t, p.X, test.ShouldBeBetweenOrEqual, obstacleMin.X-resolution, obstacleMax.X+resolution)
+			test.That(t, p.Y, test.ShouldBeBetweenOrEqual, obstacleMin.Y-resolution, obstacleMax.Y+resolution)
+			test.That(t, d.HasColor(), test.ShouldBeTrue)
+			return true
+		})
+	})
+
+	t.Run("the heatmap image highlights the obstacle", func(t *testing.T) {
+		heatmap, err := detector.HeatmapPNG()
+		test.That(t, err, test.ShouldBeNil)
+		img, err := png.Decode(bytes.NewReader(heatmap))
+		test.That(t, err, test.ShouldBeNil)
+		// the map spans cells 0 to 50 with a margin of heatmapMarginCells on every side
+		test.That(t, img.Bounds().Dx(), test.ShouldEqual, 51+2*heatmapMarginCells)
+		test.That(t, img.Bounds().Dy(), test.ShouldEqual, 51+2*heatmapMarginCells)
+
+		pixelAt := func(p r3.Vector) uint32 {
+			x := int(p.X/resolution) + heatmapMarginCells
+			y := img.Bounds().Dy() - 1 - (int(p.Y/resolution) + heatmapMarginCells)
+			gray, _, _, _ := img.At(x, y).RGBA()
+			return gray
+		}
+		test.That(t, pixelAt(obstacleMin.Add(obstacleMax).Mul(0.5)), test.ShouldBeGreaterThan, 0)
+		test.That(t, pixelAt(r3.Vector{X: 2500, Y: 0}), test.ShouldEqual, 0)
+		test.That(t, pixelAt(robotPosition), test.ShouldEqual, 0)
+	})
+}
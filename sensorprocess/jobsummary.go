@@ -0,0 +1,209 @@
+package sensorprocess
+
+import (
+	"context"
+	"math"
+	"sync/atomic"
+	"time"
+)
+
+// JobDoneCause describes why the sensor process finished.
+type JobDoneCause string
+
+const (
+	// CauseDatasetExhausted denotes that the end of the lidar dataset was reached.
+	CauseDatasetExhausted JobDoneCause = "dataset_exhausted"
+	// CauseMovementSensorEnded denotes that the end of the movement sensor dataset was reached before the end of
+	// the lidar dataset.
+	CauseMovementSensorEnded JobDoneCause = "movement_sensor_ended"
+	// CauseCancelled denotes that the offline sensor process was cancelled before reaching the end of a dataset.
+	CauseCancelled JobDoneCause = "cancelled"
+	// CauseSensorError denotes that a sensor failed to return a reading for a reason other than the end of its dataset.
+	CauseSensorError JobDoneCause = "sensor_error"
+	// CauseMixedClockDomains denotes that the offline sensor process refused to start as the lidar and the
+	// movement sensor have different clock domains.
+	CauseMixedClockDomains JobDoneCause = "mixed_clock_domains"
+	// CauseSensorSkew denotes that the offline sensor process stopped at a movement sensor reading that was further
+	// than max_sensor_skew_ms from the most recent lidar reading.
+	CauseSensorSkew JobDoneCause = "sensor_skew"
+	// CauseMaxDuration denotes that the offline sensor process stopped before reaching the end of a dataset as it
+	// ran for max_job_duration_sec.
+	CauseMaxDuration JobDoneCause = "max_duration"
+	// CauseOnline denotes that the sensor process runs in online mode, where there is no end of a dataset.
+	CauseOnline JobDoneCause = "online"
+)
+
+// OfflineJobResult describes how the offline sensor process finished.
+type OfflineJobResult struct {
+	// JobDone is whether the end of either the lidar or movement sensor dataset or the max job duration was reached.
+	JobDone     bool
+	Cause       JobDoneCause
+	CompletedAt time.Time
+	// FinalOptimizationSucceeded is whether the final optimization was run and succeeded.
+	FinalOptimizationSucceeded bool
+}
+
+// ToMap returns the result in the format of a DoCommand response.
+func (result OfflineJobResult) ToMap() map[string]interface{} {
+	return map[string]interface{}{
+		"cause":                        string(result.Cause),
+		"completed_at":                 result.CompletedAt.UTC().Format(time.RFC3339),
+		"final_optimization_succeeded": result.FinalOptimizationSucceeded,
+	}
+}
+
+// JobSummary records the progress of the offline sensor process. It is safe for concurrent use.
+type JobSummary struct {
+	// SkipFinalOptimization and FinalOptimizationIterations are the settings of the final optimization the offline
+	// sensor process runs with. Zero iterations denote the default of cartographer's lua config.
+	SkipFinalOptimization       bool
+	FinalOptimizationIterations int
+	// ExpectedLidarReadings, if not zero, is the number of readings of the datasets of all lidars, from which the
+	// progress is reported as a percentage.
+	ExpectedLidarReadings int
+
+	// startedAt and finishedAt are the wall clock times in unix nanoseconds the offline sensor process started and
+	// finished at, or 0.
+	startedAt  atomic.Int64
+	finishedAt atomic.Int64
+	// numProcessedLidarReadings are the readings taken from the lidar datasets, whether they were added, dropped
+	// or skipped. numProcessedMovementSensorReadings are the movement sensor readings that were added.
+	numProcessedLidarReadings          atomic.Int64
+	numProcessedMovementSensorReadings atomic.Int64
+
+	numLidarReadings    atomic.Int64
+	numIMUReadings      atomic.Int64
+	numOdometerReadings atomic.Int64
+	// numSkippedLidarReadings are the lidar readings that failed, e.g. for corrupt or missing files of the
+	// dataset, and were skipped.
+	numSkippedLidarReadings atomic.Int64
+	// numRejectedReadings are the lidar, IMU and odometer readings that cartographer kept rejecting and that were
+	// skipped.
+	numRejectedReadings atomic.Int64
+	cancelled           atomic.Bool
+}
+
+// Cancelled returns whether the offline sensor process was cancelled before reaching the end of the dataset.
+func (summary *JobSummary) Cancelled() bool {
+	return summary.cancelled.Load()
+}
+
+// ToMap returns the summary in the format of a DoCommand response.
+func (summary *JobSummary) ToMap() map[string]interface{} {
+	resp := map[string]interface{}{
+		"cancelled":                  summary.cancelled.Load(),
+		"num_lidar_readings":         summary.numLidarReadings.Load(),
+		"num_imu_readings":           summary.numIMUReadings.Load(),
+		"num_odometer_readings":      summary.numOdometerReadings.Load(),
+		"num_skipped_lidar_readings": summary.numSkippedLidarReadings.Load(),
+		"num_rejected_readings":      summary.numRejectedReadings.Load(),
+		"skip_final_optimization":    summary.SkipFinalOptimization,
+	}
+	if summary.FinalOptimizationIterations > 0 {
+		resp["final_optimization_iterations"] = summary.FinalOptimizationIterations
+	}
+	return resp
+}
+
+// Progress returns how far along the offline sensor process is at now in the format of a DoCommand response. The
+// elapsed time stops once the process has finished. The percentage of the lidar dataset that was processed is
+// only held if ExpectedLidarReadings is set.
+func (summary *JobSummary) Progress(now time.Time) map[string]interface{} {
+	numProcessedLidarReadings := summary.numProcessedLidarReadings.Load()
+	resp := map[string]interface{}{
+		"num_lidar_readings_processed":           numProcessedLidarReadings,
+		"num_movement_sensor_readings_processed": summary.numProcessedMovementSensorReadings.Load(),
+		"elapsed_sec":                            0.0,
+	}
+	if startedAt := summary.startedAt.Load(); startedAt != 0 {
+		if finishedAt := summary.finishedAt.Load(); finishedAt != 0 {
+			now = time.Unix(0, finishedAt)
+		}
+		resp["elapsed_sec"] = now.Sub(time.Unix(0, startedAt)).Seconds()
+	}
+	if summary.ExpectedLidarReadings > 0 {
+		resp["expected_lidar_readings"] = summary.ExpectedLidarReadings
+		// the expected number of readings may be off, which is not reported as more than all of the dataset
+		resp["percent"] = math.Min(100, 100*float64(numProcessedLidarReadings)/float64(summary.ExpectedLidarReadings))
+	}
+	return resp
+}
+
+// startJob records that the offline sensor process started.
+func (config *Config) startJob() {
+	if config.JobSummary != nil {
+		config.JobSummary.startedAt.Store(time.Now().UnixNano())
+	}
+}
+
+// finishJob records that the offline sensor process finished.
+func (config *Config) finishJob() {
+	if config.JobSummary != nil {
+		config.JobSummary.finishedAt.Store(time.Now().UnixNano())
+	}
+}
+
+// countProcessedLidarReading records that a reading was taken from a lidar dataset in offline mode.
+func (config *Config) countProcessedLidarReading() {
+	if config.JobSummary != nil {
+		config.JobSummary.numProcessedLidarReadings.Add(1)
+	}
+}
+
+// countLidarReading records that a lidar reading was added in offline mode.
+func (config *Config) countLidarReading() {
+	if config.JobSummary != nil {
+		config.JobSummary.numLidarReadings.Add(1)
+	}
+}
+
+// countSkippedLidarReading records that a lidar reading failed and was skipped in offline mode.
+func (config *Config) countSkippedLidarReading() {
+	if config.JobSummary != nil {
+		config.JobSummary.numSkippedLidarReadings.Add(1)
+	}
+}
+
+// countRejectedReading records that a reading that cartographer kept rejecting was skipped in offline mode, and
+// returns the number of such readings so far, or false without a JobSummary.
+func (config *Config) countRejectedReading() (int64, bool) {
+	if config.JobSummary == nil {
+		return 0, false
+	}
+	return config.JobSummary.numRejectedReadings.Add(1), true
+}
+
+// countMovementSensorReading records that a movement sensor reading was added in offline mode.
+func (config *Config) countMovementSensorReading() {
+	if config.JobSummary == nil {
+		return
+	}
+	config.JobSummary.numProcessedMovementSensorReadings.Add(1)
+	if config.MovementSensor.Properties().IMUSupported {
+		config.JobSummary.numIMUReadings.Add(1)
+	}
+	if config.MovementSensor.Properties().OdometerSupported {
+		config.JobSummary.numOdometerReadings.Add(1)
+	}
+}
+
+// handleOfflineCancellation marks the job as cancelled and tells the user that the readings added so far can
+// still be saved. The final optimization is only run if configured, as it may take a long time and the
+// cancellation usually means the service is shutting down. The cartofacade is left running either way.
+// Returns whether the final optimization was run and succeeded.
+func (config *Config) handleOfflineCancellation(ctx context.Context) bool {
+	if config.JobSummary != nil {
+		config.JobSummary.cancelled.Store(true)
+		config.Logger.Infow("Offline mapping cancelled before the end of the dataset",
+			"num_lidar_readings", config.JobSummary.numLidarReadings.Load(),
+			"num_imu_readings", config.JobSummary.numIMUReadings.Load(),
+			"num_odometer_readings", config.JobSummary.numOdometerReadings.Load())
+	}
+	var finalOptimizationSucceeded bool
+	if config.RunFinalOptimizationOnCancel {
+		finalOptimizationSucceeded = config.runFinalOptimization(context.WithoutCancel(ctx))
+	}
+	config.Logger.Info("Partial map can be saved with InternalState or the write_internal_state_to_path DoCommand " +
+		"until the slam service is closed")
+	return finalOptimizationSucceeded
+}
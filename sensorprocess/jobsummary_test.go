@@ -0,0 +1,317 @@
+package sensorprocess
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.viam.com/rdk/components/camera/replaypcd"
+	replaymovementsensor "go.viam.com/rdk/components/movementsensor/replay"
+	"go.viam.com/rdk/logging"
+	"go.viam.com/test"
+
+	"github.com/viam-modules/viam-cartographer/cartofacade"
+	s "github.com/viam-modules/viam-cartographer/sensors"
+	"github.com/viam-modules/viam-cartographer/sensors/inject"
+)
+
+func TestOfflineSensorProcessCancellation(t *testing.T) {
+	logger, obs := logging.NewObservedTestLogger(t)
+	now := time.Now().UTC()
+
+	// setup returns a config whose offline process cancels the context once numLidarBeforeCancel lidar
+	// readings were added, and counters of the final optimizations and terminations of the cartofacade.
+	setup := func(cancel context.CancelFunc, numLidarBeforeCancel int) (*Config, *int, *int) {
+		injectLidar := inject.TimedLidar{}
+		injectLidar.NameFunc = func() string { return "good_lidar" }
+		injectLidar.DataFrequencyHzFunc = func() int { return 0 }
+		numLidarData := 0
+		injectLidar.TimedLidarReadingFunc = func(ctx context.Context) (s.TimedLidarReadingResponse, error) {
+			if numLidarData >= 100 {
+				return s.TimedLidarReadingResponse{}, replaypcd.ErrEndOfDataset
+			}
+			numLidarData++
+			return s.TimedLidarReadingResponse{
+				Reading:     []byte("12345"),
+				ReadingTime: now.Add(time.Duration(2*numLidarData) * time.Millisecond),
+			}, nil
+		}
+
+		injectMovementSensor := inject.TimedMovementSensor{}
+		injectMovementSensor.NameFunc = func() string { return "good_movement_sensor" }
+		injectMovementSensor.DataFrequencyHzFunc = func() int { return 0 }
+		injectMovementSensor.PropertiesFunc = func() s.MovementSensorProperties {
+			return s.MovementSensorProperties{IMUSupported: true}
+		}
+		numIMUData := 0
+		injectMovementSensor.TimedMovementSensorReadingFunc = func(ctx context.Context) (s.TimedMovementSensorReadingResponse, error) {
+			numIMUData++
+			return s.TimedMovementSensorReadingResponse{
+				TimedIMUResponse: &s.TimedIMUReadingResponse{
+					ReadingTime: now.Add(time.Duration(2*numIMUData+1) * time.Millisecond),
+				},
+			}, nil
+		}
+
+		cf := cartofacade.Mock{}
+		numAddedLidarData := 0
+		cf.AddLidarReadingFunc = func(ctx context.Context, timeout time.Duration,
+			lidarName string, currentReading s.TimedLidarReadingResponse,
+		) error {
+			numAddedLidarData++
+			if numAddedLidarData == numLidarBeforeCancel {
+				cancel()
+			}
+			return nil
+		}
+		cf.AddIMUReadingFunc = func(ctx context.Context, timeout time.Duration,
+			imuName string, currentReading s.TimedIMUReadingResponse,
+		) error {
+			return ctx.Err()
+		}
+		numFinalOptimizations := 0
+		cf.RunFinalOptimizationFunc = func(ctx context.Context, timeout time.Duration) error {
+			numFinalOptimizations++
+			return ctx.Err()
+		}
+		numTerminations := 0
+		cf.TerminateFunc = func(ctx context.Context, timeout time.Duration) error {
+			numTerminations++
+			return nil
+		}
+
+		return &Config{
+			Logger:         logger,
+			CartoFacade:    &cf,
+			Lidar:          &injectLidar,
+			MovementSensor: &injectMovementSensor,
+			JobSummary:     &JobSummary{},
+			Timeout:        10 * time.Second,
+		}, &numFinalOptimizations, &numTerminations
+	}
+
+	t.Run("cancelling mid run records the readings added so far and skips the final optimization", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		config, numFinalOptimizations, numTerminations := setup(cancel, 3)
+
+		result := config.StartOfflineSensorProcess(ctx)
+		test.That(t, result.JobDone, test.ShouldBeFalse)
+		test.That(t, result.Cause, test.ShouldEqual, CauseCancelled)
+		test.That(t, result.FinalOptimizationSucceeded, test.ShouldBeFalse)
+		test.That(t, config.JobSummary.Cancelled(), test.ShouldBeTrue)
+		test.That(t, config.JobSummary.ToMap(), test.ShouldResemble, map[string]interface{}{
+			"cancelled":                  true,
+			"num_lidar_readings":         int64(3),
+			"num_imu_readings":           int64(2),
+			"num_odometer_readings":      int64(0),
+			"num_skipped_lidar_readings": int64(0),
+			"num_rejected_readings":      int64(0),
+			"skip_final_optimization":    false,
+		})
+		test.That(t, *numFinalOptimizations, test.ShouldEqual, 0)
+		test.That(t, *numTerminations, test.ShouldEqual, 0)
+		test.That(t, obs.FilterMessageSnippet("can be saved with InternalState").Len(), test.ShouldEqual, 1)
+	})
+
+	t.Run("cancelling mid run runs the final optimization if configured", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		config, numFinalOptimizations, numTerminations := setup(cancel, 2)
+		config.RunFinalOptimizationOnCancel = true
+
+		result := config.StartOfflineSensorProcess(ctx)
+		test.That(t, result.JobDone, test.ShouldBeFalse)
+		test.That(t, result.Cause, test.ShouldEqual, CauseCancelled)
+		test.That(t, result.FinalOptimizationSucceeded, test.ShouldBeTrue)
+		test.That(t, config.JobSummary.Cancelled(), test.ShouldBeTrue)
+		test.That(t, *numFinalOptimizations, test.ShouldEqual, 1)
+		test.That(t, *numTerminations, test.ShouldEqual, 0)
+		test.That(t, obs.FilterMessageSnippet("Failed to finish processing all sensor readings").Len(), test.ShouldEqual, 0)
+	})
+
+	t.Run("reaching the end of the dataset is not a cancellation", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		config, numFinalOptimizations, _ := setup(cancel, -1)
+
+		result := config.StartOfflineSensorProcess(ctx)
+		test.That(t, result.JobDone, test.ShouldBeTrue)
+		test.That(t, result.Cause, test.ShouldEqual, CauseDatasetExhausted)
+		test.That(t, result.FinalOptimizationSucceeded, test.ShouldBeTrue)
+		test.That(t, config.JobSummary.Cancelled(), test.ShouldBeFalse)
+		test.That(t, config.JobSummary.ToMap()["num_lidar_readings"], test.ShouldEqual, int64(100))
+		test.That(t, *numFinalOptimizations, test.ShouldEqual, 1)
+	})
+
+	t.Run("reaching the end of the dataset skips the final optimization if configured", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		config, numFinalOptimizations, _ := setup(cancel, -1)
+		config.SkipFinalOptimization = true
+		config.JobSummary.SkipFinalOptimization = true
+
+		result := config.StartOfflineSensorProcess(ctx)
+		test.That(t, result.JobDone, test.ShouldBeTrue)
+		test.That(t, result.Cause, test.ShouldEqual, CauseDatasetExhausted)
+		test.That(t, result.FinalOptimizationSucceeded, test.ShouldBeFalse)
+		test.That(t, config.JobSummary.ToMap()["skip_final_optimization"], test.ShouldBeTrue)
+		test.That(t, *numFinalOptimizations, test.ShouldEqual, 0)
+		test.That(t, obs.FilterMessageSnippet("Skipping final optimization").Len(), test.ShouldEqual, 1)
+	})
+
+	t.Run("the movement sensor dataset ending first is reported as its cause", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		config, numFinalOptimizations, _ := setup(cancel, -1)
+		injectMovementSensor := config.MovementSensor.(*inject.TimedMovementSensor)
+		imuReadingFunc := injectMovementSensor.TimedMovementSensorReadingFunc
+		numIMUData := 0
+		injectMovementSensor.TimedMovementSensorReadingFunc = func(ctx context.Context) (s.TimedMovementSensorReadingResponse, error) {
+			if numIMUData >= 5 {
+				return s.TimedMovementSensorReadingResponse{}, replaymovementsensor.ErrEndOfDataset
+			}
+			numIMUData++
+			return imuReadingFunc(ctx)
+		}
+
+		result := config.StartOfflineSensorProcess(ctx)
+		test.That(t, result.JobDone, test.ShouldBeTrue)
+		test.That(t, result.Cause, test.ShouldEqual, CauseMovementSensorEnded)
+		test.That(t, *numFinalOptimizations, test.ShouldEqual, 1)
+	})
+
+	t.Run("reaching the max job duration finishes the job before the end of the dataset", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		config, numFinalOptimizations, _ := setup(cancel, -1)
+		config.MaxJobDuration = time.Nanosecond
+
+		result := config.StartOfflineSensorProcess(ctx)
+		test.That(t, result.JobDone, test.ShouldBeTrue)
+		test.That(t, result.Cause, test.ShouldEqual, CauseMaxDuration)
+		test.That(t, result.FinalOptimizationSucceeded, test.ShouldBeTrue)
+		test.That(t, config.JobSummary.Cancelled(), test.ShouldBeFalse)
+		test.That(t, config.JobSummary.ToMap()["num_lidar_readings"], test.ShouldBeLessThan, int64(100))
+		test.That(t, *numFinalOptimizations, test.ShouldEqual, 1)
+		test.That(t, obs.FilterMessageSnippet("max_job_duration_sec").Len(), test.ShouldEqual, 1)
+	})
+}
+
+func TestOfflineJobResult(t *testing.T) {
+	result := OfflineJobResult{
+		JobDone:                    true,
+		Cause:                      CauseDatasetExhausted,
+		CompletedAt:                time.Date(2024, 1, 2, 3, 4, 5, 6, time.FixedZone("UTC+1", 3600)),
+		FinalOptimizationSucceeded: true,
+	}
+	test.That(t, result.ToMap(), test.ShouldResemble, map[string]interface{}{
+		"cause":                        "dataset_exhausted",
+		"completed_at":                 "2024-01-02T02:04:05Z",
+		"final_optimization_succeeded": true,
+	})
+}
+
+func TestJobProgress(t *testing.T) {
+	logger := logging.NewTestLogger(t)
+	now := time.Now().UTC()
+	const numLidarReadings = 10
+
+	injectLidar := inject.TimedLidar{}
+	injectLidar.NameFunc = func() string { return "good_lidar" }
+	injectLidar.DataFrequencyHzFunc = func() int { return 0 }
+	numLidarData := 0
+	injectLidar.TimedLidarReadingFunc = func(ctx context.Context) (s.TimedLidarReadingResponse, error) {
+		if numLidarData >= numLidarReadings {
+			return s.TimedLidarReadingResponse{}, replaypcd.ErrEndOfDataset
+		}
+		numLidarData++
+		return s.TimedLidarReadingResponse{
+			Reading:     []byte("12345"),
+			ReadingTime: now.Add(time.Duration(2*numLidarData) * time.Millisecond),
+		}, nil
+	}
+
+	injectMovementSensor := inject.TimedMovementSensor{}
+	injectMovementSensor.NameFunc = func() string { return "good_movement_sensor" }
+	injectMovementSensor.DataFrequencyHzFunc = func() int { return 0 }
+	injectMovementSensor.PropertiesFunc = func() s.MovementSensorProperties {
+		return s.MovementSensorProperties{IMUSupported: true}
+	}
+	numIMUData := 0
+	injectMovementSensor.TimedMovementSensorReadingFunc = func(ctx context.Context) (s.TimedMovementSensorReadingResponse, error) {
+		numIMUData++
+		return s.TimedMovementSensorReadingResponse{
+			TimedIMUResponse: &s.TimedIMUReadingResponse{
+				ReadingTime: now.Add(time.Duration(2*numIMUData+1) * time.Millisecond),
+			},
+		}, nil
+	}
+
+	summary := &JobSummary{ExpectedLidarReadings: numLidarReadings}
+	test.That(t, summary.Progress(time.Now()), test.ShouldResemble, map[string]interface{}{
+		"num_lidar_readings_processed":           int64(0),
+		"num_movement_sensor_readings_processed": int64(0),
+		"elapsed_sec":                            0.0,
+		"expected_lidar_readings":                numLidarReadings,
+		"percent":                                0.0,
+	})
+
+	// the progress while the nth lidar reading is added
+	var progress []map[string]interface{}
+	cf := cartofacade.Mock{}
+	cf.AddLidarReadingFunc = func(ctx context.Context, timeout time.Duration,
+		lidarName string, currentReading s.TimedLidarReadingResponse,
+	) error {
+		progress = append(progress, summary.Progress(time.Now()))
+		return nil
+	}
+	cf.AddIMUReadingFunc = func(ctx context.Context, timeout time.Duration,
+		imuName string, currentReading s.TimedIMUReadingResponse,
+	) error {
+		return nil
+	}
+	cf.RunFinalOptimizationFunc = func(ctx context.Context, timeout time.Duration) error {
+		return nil
+	}
+	config := &Config{
+		Logger:         logger,
+		CartoFacade:    &cf,
+		Lidar:          &injectLidar,
+		MovementSensor: &injectMovementSensor,
+		JobSummary:     summary,
+		Timeout:        10 * time.Second,
+	}
+
+	result := config.StartOfflineSensorProcess(context.Background())
+	test.That(t, result.Cause, test.ShouldEqual, CauseDatasetExhausted)
+
+	test.That(t, progress, test.ShouldHaveLength, numLidarReadings)
+	for i, p := range progress {
+		test.That(t, p["num_lidar_readings_processed"], test.ShouldEqual, int64(i+1))
+		test.That(t, p["num_movement_sensor_readings_processed"], test.ShouldEqual, int64(i))
+		test.That(t, p["percent"], test.ShouldAlmostEqual, float64(10*(i+1)))
+		test.That(t, p["elapsed_sec"], test.ShouldBeGreaterThanOrEqualTo, 0.0)
+		if i > 0 {
+			test.That(t, p["elapsed_sec"], test.ShouldBeGreaterThanOrEqualTo, progress[i-1]["elapsed_sec"])
+		}
+	}
+
+	t.Run("the elapsed time stops once the offline sensor process has finished", func(t *testing.T) {
+		final := summary.Progress(time.Now())
+		test.That(t, final["num_lidar_readings_processed"], test.ShouldEqual, int64(numLidarReadings))
+		test.That(t, final["percent"], test.ShouldEqual, 100.0)
+		test.That(t, summary.Progress(time.Now().Add(time.Hour)), test.ShouldResemble, final)
+	})
+
+	t.Run("the percentage does not exceed 100 for too few expected lidar readings", func(t *testing.T) {
+		summary.ExpectedLidarReadings = numLidarReadings / 2
+		test.That(t, summary.Progress(time.Now())["percent"], test.ShouldEqual, 100.0)
+	})
+
+	t.Run("the percentage is left out without expected lidar readings", func(t *testing.T) {
+		summary.ExpectedLidarReadings = 0
+		_, ok := summary.Progress(time.Now())["percent"]
+		test.That(t, ok, test.ShouldBeFalse)
+	})
+}
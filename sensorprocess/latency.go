@@ -0,0 +1,157 @@
+package sensorprocess
+
+import (
+	"slices"
+	"sync"
+	"time"
+)
+
+const (
+	// latencyWindowSize is the number of most recent readings per sensor that latency percentiles are computed over.
+	latencyWindowSize = 1000
+	// minLatencySamples is the number of readings of a sensor needed before its p95 latency is checked.
+	minLatencySamples = 20
+	// latencyWarningInterval is the minimum time between two warnings about the latency of a sensor.
+	latencyWarningInterval = 10 * time.Second
+)
+
+// Sensor names that ingestion latencies are recorded under.
+const (
+	LidarSensor    = "lidar"
+	IMUSensor      = "imu"
+	OdometerSensor = "odometer"
+)
+
+// IngestionLatency records, per sensor, the time from the reading time of a reading to its acceptance by the
+// cartofacade, i.e. how stale readings are when cartographer gets them. It is safe for concurrent use by the
+// lidar and movement sensor processes.
+type IngestionLatency struct {
+	// MaxP95 is the p95 latency above which a warning is logged in online mode.
+	MaxP95 time.Duration
+
+	mu        sync.Mutex
+	histories map[string]*latencyHistory
+	// now returns the wall clock time readings are accepted at. It is only overridden by tests.
+	now func() time.Time
+}
+
+// latencyHistory holds the latencies of the most recent readings of a sensor in a ring buffer.
+type latencyHistory struct {
+	latencies  []time.Duration
+	next       int
+	count      int64
+	max        time.Duration
+	lastWarned time.Time
+}
+
+// LatencyStats summarizes the ingestion latency of a sensor.
+type LatencyStats struct {
+	// Count is the number of readings that were accepted.
+	Count int64
+	// P50 and P95 are computed over the most recent readings.
+	P50 time.Duration
+	P95 time.Duration
+	// Max is the maximum over all readings.
+	Max time.Duration
+}
+
+// ToMap returns the latency stats in milliseconds in the format of DoCommand responses.
+func (stats LatencyStats) ToMap() map[string]interface{} {
+	return map[string]interface{}{
+		"count":  stats.Count,
+		"p50_ms": float64(stats.P50) / float64(time.Millisecond),
+		"p95_ms": float64(stats.P95) / float64(time.Millisecond),
+		"max_ms": float64(stats.Max) / float64(time.Millisecond),
+	}
+}
+
+// Stats returns the latency stats of every sensor that had a reading accepted.
+func (latency *IngestionLatency) Stats() map[string]LatencyStats {
+	latency.mu.Lock()
+	defer latency.mu.Unlock()
+	stats := map[string]LatencyStats{}
+	for sensor, history := range latency.histories {
+		stats[sensor] = history.stats()
+	}
+	return stats
+}
+
+func (history *latencyHistory) stats() LatencyStats {
+	sorted := slices.Clone(history.latencies)
+	slices.Sort(sorted)
+	return LatencyStats{
+		Count: history.count,
+		P50:   percentile(sorted, 50),
+		P95:   percentile(sorted, 95),
+		Max:   history.max,
+	}
+}
+
+// percentile returns the nearest rank percentile of the sorted latencies.
+func percentile(sorted []time.Duration, p int) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := (p*len(sorted) + 99) / 100
+	return sorted[max(rank, 1)-1]
+}
+
+// record adds the latency of a reading of sensor with the given reading time that was just accepted, and
+// returns the stats of the sensor if its p95 latency exceeds MaxP95 and it has not been warned about recently.
+func (latency *IngestionLatency) record(sensor string, readingTime time.Time) (LatencyStats, bool) {
+	latency.mu.Lock()
+	defer latency.mu.Unlock()
+
+	now := time.Now()
+	if latency.now != nil {
+		now = latency.now()
+	}
+	if latency.histories == nil {
+		latency.histories = map[string]*latencyHistory{}
+	}
+	history, ok := latency.histories[sensor]
+	if !ok {
+		history = &latencyHistory{}
+		latency.histories[sensor] = history
+	}
+
+	readingLatency := now.Sub(readingTime)
+	if len(history.latencies) < latencyWindowSize {
+		history.latencies = append(history.latencies, readingLatency)
+	} else {
+		history.latencies[history.next] = readingLatency
+	}
+	history.next = (history.next + 1) % latencyWindowSize
+	history.count++
+	history.max = max(history.max, readingLatency)
+
+	if latency.MaxP95 <= 0 || len(history.latencies) < minLatencySamples || now.Sub(history.lastWarned) < latencyWarningInterval {
+		return LatencyStats{}, false
+	}
+	stats := history.stats()
+	if stats.P95 <= latency.MaxP95 {
+		return LatencyStats{}, false
+	}
+	history.lastWarned = now
+	return stats, true
+}
+
+// recordIngestionLatency records the latency of a reading of sensor, with its reading time as reported by the
+// sensor, that was accepted by the cartofacade. In online mode a throttled warning is logged when the p95
+// latency exceeds the bound. Offline readings are historical, so their latency is recorded but not warned about.
+func (config *Config) recordIngestionLatency(sensor string, readingTime time.Time) {
+	if config.IngestionLatency == nil {
+		return
+	}
+	stats, exceeded := config.IngestionLatency.record(sensor, readingTime)
+	if !exceeded || !config.IsOnline {
+		return
+	}
+	statsMap := stats.ToMap()
+	config.Logger.Warnw("readings are stale by the time cartographer gets them, which degrades the map",
+		"sensor", sensor,
+		"p50_ms", statsMap["p50_ms"],
+		"p95_ms", statsMap["p95_ms"],
+		"max_ms", statsMap["max_ms"],
+		"max_ingestion_latency_ms", config.IngestionLatency.MaxP95.Milliseconds())
+}
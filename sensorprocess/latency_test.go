@@ -0,0 +1,183 @@
+package sensorprocess
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.viam.com/rdk/logging"
+	"go.viam.com/rdk/spatialmath"
+	"go.viam.com/test"
+
+	"github.com/viam-modules/viam-cartographer/cartofacade"
+	s "github.com/viam-modules/viam-cartographer/sensors"
+	"github.com/viam-modules/viam-cartographer/sensors/inject"
+)
+
+const staleReadingsWarning = "readings are stale by the time cartographer gets them"
+
+func TestIngestionLatency(t *testing.T) {
+	// every reading is accepted a second after the previous one, so that the readings stay in order
+	acceptanceTime := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	// the lidar returns readings that are 1ms, 2ms, ... older than their acceptance time
+	var lidarLatency time.Duration
+	injectLidar := inject.TimedLidar{}
+	injectLidar.NameFunc = func() string { return "good_lidar" }
+	injectLidar.DataFrequencyHzFunc = func() int { return 5 }
+	injectLidar.TimedLidarReadingFunc = func(ctx context.Context) (s.TimedLidarReadingResponse, error) {
+		acceptanceTime = acceptanceTime.Add(time.Second)
+		lidarLatency += time.Millisecond
+		return s.TimedLidarReadingResponse{
+			Reading:     []byte("12345"),
+			ReadingTime: acceptanceTime.Add(-lidarLatency),
+		}, nil
+	}
+
+	// the movement sensor returns readings that are 200ms older than their acceptance time
+	injectMovementSensor := inject.TimedMovementSensor{}
+	injectMovementSensor.NameFunc = func() string { return "good_movement_sensor" }
+	injectMovementSensor.DataFrequencyHzFunc = func() int { return 20 }
+	injectMovementSensor.TimedMovementSensorReadingFunc = func(ctx context.Context) (s.TimedMovementSensorReadingResponse, error) {
+		acceptanceTime = acceptanceTime.Add(time.Second)
+		return s.TimedMovementSensorReadingResponse{
+			TimedIMUResponse: &s.TimedIMUReadingResponse{
+				AngularVelocity: spatialmath.AngularVelocity{Z: 1},
+				ReadingTime:     acceptanceTime.Add(-200 * time.Millisecond),
+			},
+		}, nil
+	}
+
+	newConfig := func(logger logging.Logger, isOnline bool) (Config, *cartofacade.Mock) {
+		cf := cartofacade.Mock{}
+		cf.AddLidarReadingFunc = func(
+			ctx context.Context,
+			timeout time.Duration,
+			sensorName string,
+			currentReading s.TimedLidarReadingResponse,
+		) error {
+			return nil
+		}
+		cf.AddIMUReadingFunc = func(
+			ctx context.Context,
+			timeout time.Duration,
+			sensorName string,
+			currentReading s.TimedIMUReadingResponse,
+		) error {
+			return nil
+		}
+		return Config{
+			Logger:         logger,
+			CartoFacade:    &cf,
+			IsOnline:       isOnline,
+			Lidar:          &injectLidar,
+			MovementSensor: &injectMovementSensor,
+			Timeout:        10 * time.Second,
+			IngestionLatency: &IngestionLatency{
+				MaxP95: 100 * time.Millisecond,
+				now:    func() time.Time { return acceptanceTime },
+			},
+		}, &cf
+	}
+
+	addLidarReadings := func(t *testing.T, config Config, n int) {
+		t.Helper()
+		for i := 0; i < n; i++ {
+			reading, err := config.Lidar.TimedLidarReading(context.Background())
+			test.That(t, err, test.ShouldBeNil)
+			test.That(t, config.tryAddLidarReading(context.Background(), reading), test.ShouldBeNil)
+		}
+	}
+
+	addIMUReadings := func(t *testing.T, config Config, n int) {
+		t.Helper()
+		for i := 0; i < n; i++ {
+			reading, err := config.MovementSensor.TimedMovementSensorReading(context.Background())
+			test.That(t, err, test.ShouldBeNil)
+			test.That(t, config.tryAddIMUReading(context.Background(), *reading.TimedIMUResponse), test.ShouldBeNil)
+		}
+	}
+
+	t.Run("records the latency percentiles of accepted readings per sensor", func(t *testing.T) {
+		lidarLatency = 0
+		logger, obs := logging.NewObservedTestLogger(t)
+		config, _ := newConfig(logger, true)
+
+		addLidarReadings(t, config, 100)
+
+		stats := config.IngestionLatency.Stats()
+		test.That(t, len(stats), test.ShouldEqual, 1)
+		test.That(t, stats[LidarSensor], test.ShouldResemble, LatencyStats{
+			Count: 100,
+			P50:   50 * time.Millisecond,
+			P95:   95 * time.Millisecond,
+			Max:   100 * time.Millisecond,
+		})
+		test.That(t, stats[LidarSensor].ToMap(), test.ShouldResemble, map[string]interface{}{
+			"count":  int64(100),
+			"p50_ms": 50.0,
+			"p95_ms": 95.0,
+			"max_ms": 100.0,
+		})
+		test.That(t, obs.FilterMessageSnippet(staleReadingsWarning).Len(), test.ShouldEqual, 0)
+	})
+
+	t.Run("does not record readings that were not accepted", func(t *testing.T) {
+		lidarLatency = 0
+		logger := logging.NewTestLogger(t)
+		config, cf := newConfig(logger, true)
+		cf.AddLidarReadingFunc = func(
+			ctx context.Context,
+			timeout time.Duration,
+			sensorName string,
+			currentReading s.TimedLidarReadingResponse,
+		) error {
+			return errors.New("failed to add lidar reading")
+		}
+
+		reading, err := config.Lidar.TimedLidarReading(context.Background())
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, config.tryAddLidarReading(context.Background(), reading), test.ShouldNotBeNil)
+		test.That(t, config.IngestionLatency.Stats(), test.ShouldBeEmpty)
+	})
+
+	t.Run("warns once in online mode when the p95 latency exceeds the bound", func(t *testing.T) {
+		lidarLatency = 0
+		logger, obs := logging.NewObservedTestLogger(t)
+		config, _ := newConfig(logger, true)
+
+		addLidarReadings(t, config, 50)
+		addIMUReadings(t, config, minLatencySamples-1)
+		test.That(t, obs.FilterMessageSnippet(staleReadingsWarning).Len(), test.ShouldEqual, 0)
+
+		addIMUReadings(t, config, 10)
+		warnings := obs.FilterMessageSnippet(staleReadingsWarning).All()
+		test.That(t, len(warnings), test.ShouldEqual, 1)
+		test.That(t, warnings[0].ContextMap()["sensor"], test.ShouldEqual, IMUSensor)
+		test.That(t, warnings[0].ContextMap()["p95_ms"], test.ShouldEqual, 200.0)
+
+		stats := config.IngestionLatency.Stats()
+		test.That(t, stats[IMUSensor].Count, test.ShouldEqual, minLatencySamples+9)
+		test.That(t, stats[IMUSensor].P95, test.ShouldEqual, 200*time.Millisecond)
+		test.That(t, stats[LidarSensor].Max, test.ShouldEqual, 50*time.Millisecond)
+	})
+
+	t.Run("does not warn in offline mode", func(t *testing.T) {
+		lidarLatency = 0
+		logger, obs := logging.NewObservedTestLogger(t)
+		config, _ := newConfig(logger, false)
+
+		addIMUReadings(t, config, 2*minLatencySamples)
+		test.That(t, obs.FilterMessageSnippet(staleReadingsWarning).Len(), test.ShouldEqual, 0)
+		test.That(t, config.IngestionLatency.Stats()[IMUSensor].P95, test.ShouldEqual, 200*time.Millisecond)
+	})
+}
+
+func TestPercentile(t *testing.T) {
+	test.That(t, percentile(nil, 95), test.ShouldEqual, 0)
+	test.That(t, percentile([]time.Duration{time.Second}, 50), test.ShouldEqual, time.Second)
+	sorted := []time.Duration{1, 2, 3, 4}
+	test.That(t, percentile(sorted, 50), test.ShouldEqual, 2)
+	test.That(t, percentile(sorted, 95), test.ShouldEqual, 4)
+}
@@ -4,30 +4,64 @@ package sensorprocess
 import (
 	"context"
 	"errors"
+	"fmt"
 	"math"
 	"time"
 
+	"github.com/golang/geo/r3"
 	"go.viam.com/rdk/components/camera/replaypcd"
+	"go.viam.com/rdk/spatialmath"
 
 	"github.com/viam-modules/viam-cartographer/cartofacade"
 	s "github.com/viam-modules/viam-cartographer/sensors"
 )
 
 // StartLidar polls the lidar to get the next sensor reading and adds it to the cartofacade.
-// Stops when the context is Done.
+// Stops when the context is Done. If LidarResolver is set, the lidar is resolved again once its camera stays
+// unavailable.
 func (config *Config) StartLidar(ctx context.Context) {
+	numUnavailable := 0
 	for {
 		select {
 		case <-ctx.Done():
 			return
 		default:
-			if err := config.addLidarReadingInOnline(ctx); err != nil {
+			config.heartbeat()
+			err := config.addLidarReadingInOnline(ctx)
+			if err != nil {
 				config.Logger.Warn(err)
 			}
+			if !s.IsLidarUnavailableError(err) {
+				numUnavailable = 0
+				continue
+			}
+			numUnavailable++
+			if config.LidarResolver != nil && numUnavailable >= config.LidarReconnectFailures {
+				config.refreshLidar(ctx, numUnavailable)
+				numUnavailable = 0
+			}
 		}
 	}
 }
 
+// refreshLidar resolves the camera of Lidar again with LidarResolver after numUnavailable readings in a row failed
+// because it was unavailable, so that readings resume once a camera that was rebuilt is available again.
+func (config *Config) refreshLidar(ctx context.Context, numUnavailable int) {
+	refreshable, ok := config.Lidar.(s.RefreshableLidar)
+	if !ok {
+		return
+	}
+	lidar, err := refreshable.Refresh(ctx, config.LidarResolver)
+	if err != nil {
+		config.Logger.Warnw("failed to resolve the lidar again after its readings failed",
+			"lidar", config.Lidar.Name(), "consecutive_failures", numUnavailable, "error", err)
+		return
+	}
+	config.Lidar = lidar
+	config.Logger.Infow("resolved the lidar again after its readings failed",
+		"lidar", lidar.Name(), "consecutive_failures", numUnavailable)
+}
+
 // addLidarReadingsInOnline ensures the most recent lidar scan, after any corresponding IMU scans, gets processed
 // by cartographer.
 func (config *Config) addLidarReadingInOnline(ctx context.Context) error {
@@ -41,39 +75,106 @@ func (config *Config) addLidarReadingInOnline(ctx context.Context) error {
 	}
 
 	// add lidar data to cartographer and sleep remainder of time interval
-	timeToSleep := config.tryAddLidarReadingOnce(ctx, lidarReading)
+	timeToSleep := 1000 / config.Lidar.DataFrequencyHz()
+	supportedReading, err := config.supportedLidarReading(lidarReading)
+	if err == nil && !config.isDegenerateLidarReading(supportedReading) {
+		if clippedReading, ok := config.clipLidarReading(ctx, supportedReading); ok {
+			timeToSleep = config.tryAddLidarReadingOnce(ctx, clippedReading)
+		}
+	}
 	if !lidarReading.TestIsReplaySensor {
 		time.Sleep(time.Duration(timeToSleep) * time.Millisecond)
 		config.Logger.Debugf("lidar sleep for %vms", timeToSleep)
 	}
-	return nil
+	return err
+}
+
+// supportedLidarReading returns the reading with a PCD cartographer can read, which is converted if
+// ConvertUnsupportedPCD is set. Otherwise, readings cartographer cannot read return an s.ErrUnsupportedPCD.
+func (config *Config) supportedLidarReading(reading s.TimedLidarReadingResponse) (s.TimedLidarReadingResponse, error) {
+	pcd, err := s.SupportedPCD(reading.Reading, config.ConvertUnsupportedPCD)
+	if err != nil {
+		return s.TimedLidarReadingResponse{}, fmt.Errorf("lidar %v: %w", config.Lidar.Name(), err)
+	}
+	reading.Reading = pcd
+	return reading, nil
+}
+
+// clipLidarReading removes the points of the reading that lie outside of the mapping bounds, if any are set.
+// The points are placed in the map frame using the latest pose from cartographer, or the map origin if there
+// is none yet. Returns false if no points remain, in which case the reading should not be added.
+func (config *Config) clipLidarReading(ctx context.Context, reading s.TimedLidarReadingResponse) (s.TimedLidarReadingResponse, bool) {
+	if config.MappingBounds == nil {
+		return reading, true
+	}
+	bounds := config.MappingBounds.Load()
+	if bounds == nil {
+		return reading, true
+	}
+
+	scanPose := spatialmath.NewZeroPose()
+	if pos, err := config.CartoFacade.Position(ctx, config.Timeout); err == nil {
+		scanPose = spatialmath.NewPose(
+			r3.Vector{X: pos.X, Y: pos.Y, Z: pos.Z},
+			&spatialmath.Quaternion{Real: pos.Real, Imag: pos.Imag, Jmag: pos.Jmag, Kmag: pos.Kmag},
+		)
+	}
+
+	clipped, numKept, numRemoved, err := bounds.ClipLidarReading(reading.Reading, scanPose)
+	if err != nil {
+		config.Logger.Warnw("Adding lidar reading without applying mapping bounds", "error", err)
+		return reading, true
+	}
+	if numRemoved == 0 {
+		return reading, true
+	}
+	if numKept == 0 {
+		config.Logger.Debugf("Skipping lidar reading at %v with no points inside the mapping bounds", reading.ReadingTime)
+		return reading, false
+	}
+
+	config.Logger.Debugf("Removed %d points outside of the mapping bounds from lidar reading at %v", numRemoved, reading.ReadingTime)
+	reading.Reading = clipped
+	return reading, true
 }
 
 // tryAddLidarReadingUntilSuccess adds a reading to the cartofacade and retries on error (offline mode). While add lidar
 // reading fails, keep trying to add the same reading - in offline mode we want to process each reading so if we cannot
-// acquire the lock we should try again.
+// acquire the lock we should try again. A reading that cartographer rejects for its contents is only retried
+// MaxRejectedReadingRetries times, then it is skipped and errReadingSkipped is returned. A reading that is out of
+// order is not retried, errReadingOutOfOrder is returned.
 func (config *Config) tryAddLidarReadingUntilSuccess(ctx context.Context, reading s.TimedLidarReadingResponse) error {
+	numRejections := 0
 	for {
 		select {
 		case <-ctx.Done():
 			return ctx.Err()
 		default:
-			if err := config.tryAddLidarReading(ctx, reading); err != nil {
-				if !errors.Is(err, cartofacade.ErrUnableToAcquireLock) {
-					config.Logger.Warnw("Retrying sensor reading due to error from cartofacade", "error", err)
-				}
-			} else {
-				return nil
+			err := config.tryAddLidarReading(ctx, reading)
+			switch {
+			case err == nil, errors.Is(err, errReadingOutOfOrder):
+				return err
+			case config.rejectedTooOften(err, &numRejections):
+				config.skipRejectedReading(LidarSensor, reading.ReadingTime, err)
+				return errReadingSkipped
+			case !errors.Is(err, cartofacade.ErrUnableToAcquireLock):
+				config.Logger.Warnw("Retrying sensor reading due to error from cartofacade", "error", err)
 			}
 		}
 	}
 }
 
-// tryAddLidarReadingOnce adds a reading to the carto facade and does not retry. Returns remainder of time interval.
+// tryAddLidarReadingOnce adds a reading to the carto facade and does not retry, unless LidarBufferSize is set, in
+// which case readings that fail due to lock contention are buffered. Returns remainder of time interval.
 func (config *Config) tryAddLidarReadingOnce(ctx context.Context, reading s.TimedLidarReadingResponse) int {
 	startTime := time.Now().UTC()
 
-	if err := config.tryAddLidarReading(ctx, reading); err != nil {
+	if config.LidarBufferSize > 0 {
+		if config.lidarBuffer == nil {
+			config.lidarBuffer = newReadingBuffer[s.TimedLidarReadingResponse](config.LidarBufferSize)
+		}
+		addBufferedReadings(ctx, config, config.lidarBuffer, LidarSensor, reading, config.tryAddLidarReading)
+	} else if err := config.tryAddLidarReading(ctx, reading); err != nil && !errors.Is(err, errReadingOutOfOrder) {
 		if errors.Is(err, cartofacade.ErrUnableToAcquireLock) {
 			config.Logger.Debugw("Skipping lidar reading due to lock contention in cartofacade", "error", err)
 		} else {
@@ -84,13 +185,101 @@ func (config *Config) tryAddLidarReadingOnce(ctx context.Context, reading s.Time
 	return int(math.Max(0, float64(1000/config.Lidar.DataFrequencyHz()-timeElapsedMs)))
 }
 
-// tryAddLidarReading tries to add a reading to the carto facade.
+// tryAddLidarReading tries to add a reading to the carto facade. A reading that is not newer than the last one
+// added is dropped with errReadingOutOfOrder instead.
 func (config *Config) tryAddLidarReading(ctx context.Context, reading s.TimedLidarReadingResponse) error {
+	readingTime := reading.ReadingTime
+	// buffered readings are older than the most recent one
+	if config.LastLidarReadingTime != nil && readingTime.UnixNano() > config.LastLidarReadingTime.Load() {
+		config.LastLidarReadingTime.Store(readingTime.UnixNano())
+	}
+	if config.outOfOrder(LidarSensor, readingTime, config.lastAddedLidarReadingTime) {
+		return errReadingOutOfOrder
+	}
+	reading.ReadingTime = config.rebaseReadingTime(reading.ReadingTime)
 	err := config.CartoFacade.AddLidarReading(ctx, config.Timeout, config.Lidar.Name(), reading)
+	config.diagnoseRejection(reading, err)
+	config.recordLidarReading(readingTime, err)
 	if err != nil {
 		config.Logger.Debugf("%v \t | LIDAR | Failure \t \t | %v \n", reading.ReadingTime, reading.ReadingTime.Unix())
 	} else {
 		config.Logger.Debugf("%v \t | LIDAR | Success \t \t | %v \n", reading.ReadingTime, reading.ReadingTime.Unix())
+		config.lastAddedLidarReadingTime = readingTime
+		if config.AddedLidarReadings != nil {
+			config.AddedLidarReadings.Add(1)
+		}
+		config.recordIngestionLatency(LidarSensor, readingTime)
+		if pos, ok := config.addedLidarReadingPose(ctx); ok {
+			if config.PosePublisher != nil {
+				config.PosePublisher.PublishPose(pos, readingTime, time.Now())
+			}
+			config.compareWithMap(reading.Reading, pos)
+		}
+		config.mirrorLidarReading(ctx, reading)
 	}
 	return err
 }
+
+// addedLidarReadingPose returns the pose cartographer localized the lidar reading that was just added at, if it is
+// published to PosePublisher or compared against the map.
+func (config *Config) addedLidarReadingPose(ctx context.Context) (cartofacade.Position, bool) {
+	publish := config.PosePublisher != nil && config.PosePublisher.HasSubscribers()
+	if !publish && config.ChangeDetector == nil && config.MapOverlap == nil {
+		return cartofacade.Position{}, false
+	}
+	pos, err := config.CartoFacade.Position(ctx, config.Timeout)
+	if err != nil {
+		config.Logger.Debugw("could not get the pose of an added lidar reading", "error", err)
+		return cartofacade.Position{}, false
+	}
+	return pos, true
+}
+
+// compareWithMap compares a lidar reading that was added to cartographer against the map with ChangeDetector and
+// MapOverlap, using the pose pos cartographer localized it at. Neither affects cartographer.
+func (config *Config) compareWithMap(reading []byte, pos cartofacade.Position) {
+	if config.ChangeDetector == nil && config.MapOverlap == nil {
+		return
+	}
+	pc, err := s.ReadLidarReading(reading)
+	if err != nil {
+		config.Logger.Debugw("skipping the comparison of a lidar reading against the map", "error", err)
+		return
+	}
+	scanPose := spatialmath.NewPose(
+		r3.Vector{X: pos.X, Y: pos.Y, Z: pos.Z},
+		&spatialmath.Quaternion{Real: pos.Real, Imag: pos.Imag, Jmag: pos.Jmag, Kmag: pos.Kmag},
+	)
+	if config.ChangeDetector != nil {
+		if disagreement, ok := config.ChangeDetector.addReading(pc, scanPose); ok {
+			config.Logger.Debugw("compared lidar reading against the map", "disagreement", disagreement)
+		}
+	}
+	if config.MapOverlap != nil {
+		if overlap, ok := config.MapOverlap.addReading(pc, scanPose); ok {
+			config.Logger.Debugw("compared lidar reading against the existing map", "overlap", overlap)
+		}
+	}
+}
+
+// diagnoseRejection records whether cartographer rejected a reading with RejectionDiagnostic and logs the diagnosis
+// once enough readings have been rejected in a row. Readings that are skipped due to lock contention are neither
+// accepted nor rejected.
+func (config *Config) diagnoseRejection(reading s.TimedLidarReadingResponse, err error) {
+	if config.RejectionDiagnostic == nil || errors.Is(err, cartofacade.ErrUnableToAcquireLock) {
+		return
+	}
+	diagnosis, ok := config.RejectionDiagnostic.addResult(config.Lidar.Name(), reading.Reading, err)
+	if !ok {
+		return
+	}
+	keysAndValues := []interface{}{"lidar", config.Lidar.Name()}
+	for _, key := range []string{
+		"error", "consecutive_rejections", "header", "num_points", "min_mm", "max_mm", "problems",
+	} {
+		if value, ok := diagnosis[key]; ok {
+			keysAndValues = append(keysAndValues, key, value)
+		}
+	}
+	config.Logger.Errorw("cartographer keeps rejecting lidar readings that passed validation", keysAndValues...)
+}
@@ -1,17 +1,29 @@
 package sensorprocess
 
 import (
+	"bytes"
 	"context"
 	"errors"
+	"os"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/golang/geo/r2"
+	"github.com/golang/geo/r3"
+	"go.viam.com/rdk/components/camera"
 	"go.viam.com/rdk/logging"
+	"go.viam.com/rdk/pointcloud"
+	"go.viam.com/rdk/resource"
+	rdkinject "go.viam.com/rdk/testutils/inject"
 	"go.viam.com/test"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 
 	"github.com/viam-modules/viam-cartographer/cartofacade"
 	s "github.com/viam-modules/viam-cartographer/sensors"
 	"github.com/viam-modules/viam-cartographer/sensors/inject"
+	"github.com/viam-modules/viam-cartographer/testhelper/pcdtest"
 )
 
 func TestStartLidar(t *testing.T) {
@@ -38,6 +50,172 @@ func TestStartLidar(t *testing.T) {
 
 		config.StartLidar(cancelCtx)
 	})
+
+	t.Run("resolves the lidar again once its camera stays unavailable and resumes adding readings", func(t *testing.T) {
+		reading := pcdtest.PointsToPCD(t, []r3.Vector{{X: 1000}})
+		var numStaleReadings, numRefreshes, numStaleReadingsAtRefresh atomic.Int64
+		staleLidar := &inject.TimedLidar{}
+		staleLidar.NameFunc = func() string { return "front" }
+		staleLidar.DataFrequencyHzFunc = func() int { return 100 }
+		staleLidar.TimedLidarReadingFunc = func(ctx context.Context) (s.TimedLidarReadingResponse, error) {
+			numStaleReadings.Add(1)
+			return s.TimedLidarReadingResponse{}, resource.NewNotAvailableError(camera.Named("front"), errors.New("closed"))
+		}
+		swappedLidar := &inject.TimedLidar{}
+		swappedLidar.NameFunc = func() string { return "front" }
+		swappedLidar.DataFrequencyHzFunc = func() int { return 100 }
+		swappedLidar.TimedLidarReadingFunc = func(ctx context.Context) (s.TimedLidarReadingResponse, error) {
+			return s.TimedLidarReadingResponse{Reading: reading, ReadingTime: time.Now()}, nil
+		}
+		staleLidar.RefreshFunc = func(ctx context.Context, resolve s.ResourceResolver) (s.TimedLidar, error) {
+			numRefreshes.Add(1)
+			numStaleReadingsAtRefresh.Store(numStaleReadings.Load())
+			return swappedLidar, nil
+		}
+
+		var numAdded atomic.Int64
+		cf := cartofacade.Mock{}
+		cf.AddLidarReadingFunc = func(ctx context.Context, timeout time.Duration, lidarName string,
+			currentReading s.TimedLidarReadingResponse,
+		) error {
+			numAdded.Add(1)
+			return nil
+		}
+		config := Config{
+			Logger:                 logger,
+			CartoFacade:            &cf,
+			IsOnline:               true,
+			Lidar:                  staleLidar,
+			LidarResolver:          s.DependenciesResolver(resource.Dependencies{}),
+			LidarReconnectFailures: 5,
+			Timeout:                10 * time.Second,
+		}
+
+		cancelCtx, cancelFunc := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			config.StartLidar(cancelCtx)
+		}()
+		for numAdded.Load() < 3 {
+			time.Sleep(time.Millisecond)
+		}
+		cancelFunc()
+		<-done
+		test.That(t, numRefreshes.Load(), test.ShouldEqual, 1)
+		test.That(t, numStaleReadingsAtRefresh.Load(), test.ShouldEqual, 5)
+		test.That(t, numStaleReadings.Load(), test.ShouldEqual, 5)
+		test.That(t, config.Lidar, test.ShouldEqual, swappedLidar)
+	})
+
+	t.Run("does not resolve the lidar again for other errors", func(t *testing.T) {
+		var numReadings int
+		injectLidar := &inject.TimedLidar{}
+		injectLidar.NameFunc = func() string { return "front" }
+		injectLidar.DataFrequencyHzFunc = func() int { return 100 }
+		var numRefreshes int
+		injectLidar.RefreshFunc = func(ctx context.Context, resolve s.ResourceResolver) (s.TimedLidar, error) {
+			numRefreshes++
+			return nil, errors.New("unexpected refresh")
+		}
+		cancelCtx, cancelFunc := context.WithCancel(context.Background())
+		injectLidar.TimedLidarReadingFunc = func(ctx context.Context) (s.TimedLidarReadingResponse, error) {
+			numReadings++
+			if numReadings == 20 {
+				cancelFunc()
+			}
+			return s.TimedLidarReadingResponse{}, errors.New("timed out")
+		}
+		config := Config{
+			Logger:                 logger,
+			CartoFacade:            &cartofacade.Mock{},
+			IsOnline:               true,
+			Lidar:                  injectLidar,
+			LidarResolver:          s.DependenciesResolver(resource.Dependencies{}),
+			LidarReconnectFailures: 5,
+			Timeout:                10 * time.Second,
+		}
+		config.StartLidar(cancelCtx)
+		test.That(t, numReadings, test.ShouldEqual, 20)
+		test.That(t, numRefreshes, test.ShouldEqual, 0)
+	})
+
+	t.Run("resolves the rebuilt camera of a filtered lidar and resumes adding its readings", func(t *testing.T) {
+		deps := s.SetupDeps(s.GoodLidar, s.NoMovementSensor)
+		closedCamera := deps[camera.Named(string(s.GoodLidar))].(*rdkinject.Camera)
+		lidar, err := s.NewLidar(context.Background(), deps, string(s.GoodLidar), 100, logger)
+		test.That(t, err, test.ShouldBeNil)
+		var numClosedReadings atomic.Int64
+		closedCamera.NextPointCloudFunc = func(ctx context.Context) (pointcloud.PointCloud, error) {
+			numClosedReadings.Add(1)
+			return nil, status.Error(codes.Canceled, "grpc: the client connection is closing")
+		}
+		rebuiltCamera := s.SetupDeps(s.GoodLidar, s.NoMovementSensor)[camera.Named(string(s.GoodLidar))]
+		var numResolves atomic.Int64
+		resolver := func(ctx context.Context, name resource.Name) (resource.Resource, error) {
+			numResolves.Add(1)
+			test.That(t, name, test.ShouldResemble, camera.Named(string(s.GoodLidar)))
+			return rebuiltCamera, nil
+		}
+
+		var numAdded atomic.Int64
+		cf := cartofacade.Mock{}
+		cf.AddLidarReadingFunc = func(ctx context.Context, timeout time.Duration, lidarName string,
+			currentReading s.TimedLidarReadingResponse,
+		) error {
+			numAdded.Add(1)
+			return nil
+		}
+		config := Config{
+			Logger:                 logger,
+			CartoFacade:            &cf,
+			IsOnline:               true,
+			Lidar:                  s.NewFilteringLidar(lidar, s.LidarPointFilter{MaxRangeMm: 10000}),
+			LidarResolver:          resolver,
+			LidarReconnectFailures: 5,
+			Timeout:                10 * time.Second,
+		}
+
+		cancelCtx, cancelFunc := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			config.StartLidar(cancelCtx)
+		}()
+		for numAdded.Load() < 3 {
+			time.Sleep(time.Millisecond)
+		}
+		cancelFunc()
+		<-done
+		test.That(t, numResolves.Load(), test.ShouldEqual, 1)
+		test.That(t, numClosedReadings.Load(), test.ShouldEqual, 5)
+	})
+
+	t.Run("reports a heartbeat for every reading it attempts", func(t *testing.T) {
+		var numReadings, numHeartbeats int
+		injectLidar := &inject.TimedLidar{}
+		injectLidar.NameFunc = func() string { return "front" }
+		injectLidar.DataFrequencyHzFunc = func() int { return 100 }
+		cancelCtx, cancelFunc := context.WithCancel(context.Background())
+		injectLidar.TimedLidarReadingFunc = func(ctx context.Context) (s.TimedLidarReadingResponse, error) {
+			numReadings++
+			test.That(t, numHeartbeats, test.ShouldEqual, numReadings)
+			if numReadings == 10 {
+				cancelFunc()
+			}
+			return s.TimedLidarReadingResponse{}, errors.New("timed out")
+		}
+		config := Config{
+			Logger:      logger,
+			CartoFacade: &cartofacade.Mock{},
+			IsOnline:    true,
+			Lidar:       injectLidar,
+			Heartbeat:   func() { numHeartbeats++ },
+			Timeout:     10 * time.Second,
+		}
+		config.StartLidar(cancelCtx)
+		test.That(t, numHeartbeats, test.ShouldEqual, 10)
+	})
 }
 
 func TestAddLidarReadingInOnline(t *testing.T) {
@@ -70,6 +248,77 @@ func TestAddLidarReadingInOnline(t *testing.T) {
 	})
 }
 
+func TestSupportedLidarReading(t *testing.T) {
+	logger := logging.NewTestLogger(t)
+	organized, err := os.ReadFile("../sensors/testdata/organized.pcd")
+	test.That(t, err, test.ShouldBeNil)
+	readingTime := time.Date(2021, 8, 15, 14, 30, 45, 100, time.UTC)
+
+	newConfig := func(isOnline bool, added *[]s.TimedLidarReadingResponse) Config {
+		injectLidar := inject.TimedLidar{}
+		injectLidar.NameFunc = func() string { return "depth_camera" }
+		injectLidar.DataFrequencyHzFunc = func() int { return 5 }
+		injectLidar.TimedLidarReadingFunc = func(ctx context.Context) (s.TimedLidarReadingResponse, error) {
+			return s.TimedLidarReadingResponse{Reading: organized, ReadingTime: readingTime, TestIsReplaySensor: true}, nil
+		}
+		cf := cartofacade.Mock{}
+		cf.AddLidarReadingFunc = func(
+			ctx context.Context,
+			timeout time.Duration,
+			sensorName string,
+			currentReading s.TimedLidarReadingResponse,
+		) error {
+			*added = append(*added, currentReading)
+			return nil
+		}
+		return Config{
+			Logger:      logger,
+			CartoFacade: &cf,
+			IsOnline:    isOnline,
+			Lidar:       &injectLidar,
+			Timeout:     10 * time.Second,
+		}
+	}
+
+	t.Run("online lidar rejects an organized pointcloud without adding it", func(t *testing.T) {
+		var added []s.TimedLidarReadingResponse
+		config := newConfig(true, &added)
+		err := config.addLidarReadingInOnline(context.Background())
+		test.That(t, errors.Is(err, s.ErrUnsupportedPCD), test.ShouldBeTrue)
+		test.That(t, err.Error(), test.ShouldContainSubstring, "lidar depth_camera")
+		test.That(t, err.Error(), test.ShouldContainSubstring, "convert_unsupported_pcd")
+		test.That(t, added, test.ShouldBeEmpty)
+	})
+
+	t.Run("online lidar adds an organized pointcloud converted at its reading time", func(t *testing.T) {
+		var added []s.TimedLidarReadingResponse
+		config := newConfig(true, &added)
+		config.ConvertUnsupportedPCD = true
+		test.That(t, config.addLidarReadingInOnline(context.Background()), test.ShouldBeNil)
+		test.That(t, added, test.ShouldHaveLength, 1)
+		test.That(t, added[0].ReadingTime, test.ShouldEqual, readingTime)
+		converted, err := s.SupportedPCD(organized, true)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, added[0].Reading, test.ShouldResemble, converted)
+	})
+
+	t.Run("offline lidar gives up on organized pointclouds", func(t *testing.T) {
+		var added []s.TimedLidarReadingResponse
+		config := newConfig(false, &added)
+		_, err := config.nextOfflineLidarReading(context.Background())
+		test.That(t, errors.Is(err, s.ErrUnsupportedPCD), test.ShouldBeTrue)
+		test.That(t, err.Error(), test.ShouldContainSubstring, "giving up after 1 consecutive lidar readings failed")
+
+		config.ConvertUnsupportedPCD = true
+		reading, err := config.nextOfflineLidarReading(context.Background())
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, reading.ReadingTime, test.ShouldEqual, readingTime)
+		numPoints, err := s.NumPoints(reading.Reading)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, numPoints, test.ShouldEqual, 9)
+	})
+}
+
 func TestTryAddLidarReadingUntilSuccess(t *testing.T) {
 	logger := logging.NewTestLogger(t)
 	cf := cartofacade.Mock{}
@@ -135,6 +384,81 @@ func TestTryAddLidarReadingUntilSuccess(t *testing.T) {
 			test.That(t, call.currentReading.ReadingTime, test.ShouldEqual, firstTimestamp)
 		}
 	})
+
+	t.Run("a reading that cartographer keeps rejecting is skipped after MaxRejectedReadingRetries retries", func(t *testing.T) {
+		config.MaxRejectedReadingRetries = 2
+		config.JobSummary = &JobSummary{}
+		defer func() {
+			config.MaxRejectedReadingRetries = 0
+			config.JobSummary = nil
+		}()
+
+		numCalls := 0
+		cf.AddLidarReadingFunc = func(
+			ctx context.Context,
+			timeout time.Duration,
+			sensorName string,
+			currentReading s.TimedLidarReadingResponse,
+		) error {
+			numCalls++
+			// lock contention and transient errors do not count as rejections
+			switch numCalls {
+			case 2:
+				return cartofacade.ErrUnableToAcquireLock
+			case 4:
+				return errUnknown
+			}
+			return cartofacade.ErrLidarReadingInvalid
+		}
+
+		// the reading of the previous test was added
+		lidarReading.ReadingTime = lidarReading.ReadingTime.Add(time.Second)
+		err := config.tryAddLidarReadingUntilSuccess(context.Background(), lidarReading)
+		test.That(t, err, test.ShouldBeError, errReadingSkipped)
+		test.That(t, numCalls, test.ShouldEqual, 5)
+		test.That(t, config.JobSummary.ToMap()["num_rejected_readings"], test.ShouldEqual, int64(1))
+	})
+
+	t.Run("a reading that cartographer rejects is skipped right away without retries", func(t *testing.T) {
+		config.JobSummary = &JobSummary{}
+		defer func() { config.JobSummary = nil }()
+
+		numCalls := 0
+		cf.AddLidarReadingFunc = func(
+			ctx context.Context,
+			timeout time.Duration,
+			sensorName string,
+			currentReading s.TimedLidarReadingResponse,
+		) error {
+			numCalls++
+			return cartofacade.ErrLidarReadingInvalid
+		}
+
+		lidarReading.ReadingTime = lidarReading.ReadingTime.Add(time.Second)
+		err := config.tryAddLidarReadingUntilSuccess(context.Background(), lidarReading)
+		test.That(t, err, test.ShouldBeError, errReadingSkipped)
+		test.That(t, numCalls, test.ShouldEqual, 1)
+		test.That(t, config.JobSummary.ToMap()["num_rejected_readings"], test.ShouldEqual, int64(1))
+	})
+
+	t.Run("a reading is retried indefinitely while cartographer is locked", func(t *testing.T) {
+		numCalls := 0
+		cf.AddLidarReadingFunc = func(
+			ctx context.Context,
+			timeout time.Duration,
+			sensorName string,
+			currentReading s.TimedLidarReadingResponse,
+		) error {
+			numCalls++
+			if numCalls <= 20 {
+				return cartofacade.ErrUnableToAcquireLock
+			}
+			return nil
+		}
+
+		test.That(t, config.tryAddLidarReadingUntilSuccess(context.Background(), lidarReading), test.ShouldBeNil)
+		test.That(t, numCalls, test.ShouldEqual, 21)
+	})
 }
 
 func TestTryAddLidarReadingOnce(t *testing.T) {
@@ -157,6 +481,11 @@ func TestTryAddLidarReadingOnce(t *testing.T) {
 		Lidar:       &injectLidar,
 		Timeout:     10 * time.Second,
 	}
+	// every reading is newer than the last one, as readings that are not newer than the last one added are dropped
+	nextReading := func() s.TimedLidarReadingResponse {
+		reading.ReadingTime = reading.ReadingTime.Add(time.Second)
+		return reading
+	}
 	t.Run("when AddLidarReading blocks for more than the data rate and succeeds, time to sleep is 0", func(t *testing.T) {
 		cf.AddLidarReadingFunc = func(
 			ctx context.Context,
@@ -168,7 +497,7 @@ func TestTryAddLidarReadingOnce(t *testing.T) {
 			return nil
 		}
 
-		timeToSleep := config.tryAddLidarReadingOnce(context.Background(), reading)
+		timeToSleep := config.tryAddLidarReadingOnce(context.Background(), nextReading())
 		test.That(t, timeToSleep, test.ShouldEqual, 0)
 	})
 
@@ -183,7 +512,7 @@ func TestTryAddLidarReadingOnce(t *testing.T) {
 			return cartofacade.ErrUnableToAcquireLock
 		}
 
-		timeToSleep := config.tryAddLidarReadingOnce(context.Background(), reading)
+		timeToSleep := config.tryAddLidarReadingOnce(context.Background(), nextReading())
 		test.That(t, timeToSleep, test.ShouldEqual, 0)
 	})
 
@@ -199,7 +528,7 @@ func TestTryAddLidarReadingOnce(t *testing.T) {
 			return errUnknown
 		}
 
-		timeToSleep := config.tryAddLidarReadingOnce(context.Background(), reading)
+		timeToSleep := config.tryAddLidarReadingOnce(context.Background(), nextReading())
 		test.That(t, timeToSleep, test.ShouldEqual, 0)
 	})
 
@@ -213,7 +542,7 @@ func TestTryAddLidarReadingOnce(t *testing.T) {
 			return nil
 		}
 
-		timeToSleep := config.tryAddLidarReadingOnce(context.Background(), reading)
+		timeToSleep := config.tryAddLidarReadingOnce(context.Background(), nextReading())
 		test.That(t, timeToSleep, test.ShouldBeGreaterThan, 0)
 		test.That(t, timeToSleep, test.ShouldBeLessThanOrEqualTo, 1000/config.Lidar.DataFrequencyHz())
 	})
@@ -229,7 +558,7 @@ func TestTryAddLidarReadingOnce(t *testing.T) {
 			return cartofacade.ErrUnableToAcquireLock
 		}
 
-		timeToSleep := config.tryAddLidarReadingOnce(context.Background(), reading)
+		timeToSleep := config.tryAddLidarReadingOnce(context.Background(), nextReading())
 		test.That(t, timeToSleep, test.ShouldBeGreaterThan, 0)
 		test.That(t, timeToSleep, test.ShouldBeLessThanOrEqualTo, 1000/config.Lidar.DataFrequencyHz())
 	})
@@ -245,7 +574,7 @@ func TestTryAddLidarReadingOnce(t *testing.T) {
 			return errUnknown
 		}
 
-		timeToSleep := config.tryAddLidarReadingOnce(context.Background(), reading)
+		timeToSleep := config.tryAddLidarReadingOnce(context.Background(), nextReading())
 		test.That(t, timeToSleep, test.ShouldBeGreaterThan, 0)
 		test.That(t, timeToSleep, test.ShouldBeLessThanOrEqualTo, 1000/config.Lidar.DataFrequencyHz())
 	})
@@ -264,12 +593,14 @@ func TestTryAddLidarReading(t *testing.T) {
 	injectLidar.NameFunc = func() string { return "good_lidar" }
 	injectLidar.DataFrequencyHzFunc = func() int { return dataFrequencyHz }
 
+	var addedReadings atomic.Int64
 	config := Config{
-		Logger:      logger,
-		CartoFacade: &cf,
-		IsOnline:    injectLidar.DataFrequencyHzFunc() != 0,
-		Lidar:       &injectLidar,
-		Timeout:     10 * time.Second,
+		Logger:             logger,
+		CartoFacade:        &cf,
+		IsOnline:           injectLidar.DataFrequencyHzFunc() != 0,
+		Lidar:              &injectLidar,
+		Timeout:            10 * time.Second,
+		AddedLidarReadings: &addedReadings,
 	}
 	t.Run("return error when AddLidarReading errors out", func(t *testing.T) {
 		expectedErr := errors.New("failed to get lidar reading")
@@ -285,6 +616,7 @@ func TestTryAddLidarReading(t *testing.T) {
 		err := config.tryAddLidarReading(context.Background(), reading)
 		test.That(t, err, test.ShouldNotBeNil)
 		test.That(t, err, test.ShouldBeError, expectedErr)
+		test.That(t, addedReadings.Load(), test.ShouldEqual, 0)
 	})
 
 	t.Run("succeeds when AddLidarReading succeeds", func(t *testing.T) {
@@ -299,5 +631,155 @@ func TestTryAddLidarReading(t *testing.T) {
 
 		err := config.tryAddLidarReading(context.Background(), reading)
 		test.That(t, err, test.ShouldBeNil)
+		test.That(t, addedReadings.Load(), test.ShouldEqual, 1)
+	})
+}
+
+// testPosePublisher records the poses published to it.
+type testPosePublisher struct {
+	hasSubscribers bool
+	poses          []cartofacade.Position
+	readingTimes   []time.Time
+}
+
+func (publisher *testPosePublisher) HasSubscribers() bool {
+	return publisher.hasSubscribers
+}
+
+func (publisher *testPosePublisher) PublishPose(pos cartofacade.Position, readingTime, now time.Time) {
+	publisher.poses = append(publisher.poses, pos)
+	publisher.readingTimes = append(publisher.readingTimes, readingTime)
+}
+
+func TestPublishAddedLidarReadingPose(t *testing.T) {
+	logger := logging.NewTestLogger(t)
+	cf := cartofacade.Mock{}
+	var numPositionCalls int
+	cf.PositionFunc = func(ctx context.Context, timeout time.Duration) (cartofacade.Position, error) {
+		numPositionCalls++
+		return cartofacade.Position{X: float64(numPositionCalls), Real: 1}, nil
+	}
+	var addErr error
+	cf.AddLidarReadingFunc = func(
+		ctx context.Context,
+		timeout time.Duration,
+		sensorName string,
+		currentReading s.TimedLidarReadingResponse,
+	) error {
+		return addErr
+	}
+
+	injectLidar := inject.TimedLidar{}
+	injectLidar.NameFunc = func() string { return "good_lidar" }
+	injectLidar.DataFrequencyHzFunc = func() int { return 5 }
+
+	publisher := &testPosePublisher{}
+	config := Config{
+		Logger:        logger,
+		CartoFacade:   &cf,
+		IsOnline:      true,
+		Lidar:         &injectLidar,
+		Timeout:       10 * time.Second,
+		PosePublisher: publisher,
+	}
+	readingTime := time.Now().UTC()
+	nextReading := func() s.TimedLidarReadingResponse {
+		readingTime = readingTime.Add(200 * time.Millisecond)
+		return s.TimedLidarReadingResponse{Reading: []byte("12345"), ReadingTime: readingTime}
+	}
+
+	t.Run("does not get the pose without subscribers", func(t *testing.T) {
+		test.That(t, config.tryAddLidarReading(context.Background(), nextReading()), test.ShouldBeNil)
+		test.That(t, numPositionCalls, test.ShouldEqual, 0)
+		test.That(t, publisher.poses, test.ShouldBeEmpty)
+	})
+
+	t.Run("publishes the pose of every added lidar reading to subscribers at its reading time", func(t *testing.T) {
+		publisher.hasSubscribers = true
+		first, second := nextReading(), nextReading()
+		test.That(t, config.tryAddLidarReading(context.Background(), first), test.ShouldBeNil)
+		test.That(t, config.tryAddLidarReading(context.Background(), second), test.ShouldBeNil)
+		test.That(t, publisher.poses, test.ShouldResemble, []cartofacade.Position{{X: 1, Real: 1}, {X: 2, Real: 1}})
+		test.That(t, publisher.readingTimes, test.ShouldResemble, []time.Time{first.ReadingTime, second.ReadingTime})
+	})
+
+	t.Run("does not publish a pose for a lidar reading that was not added", func(t *testing.T) {
+		addErr = errors.New("failed to add lidar reading")
+		test.That(t, config.tryAddLidarReading(context.Background(), nextReading()), test.ShouldBeError, addErr)
+		test.That(t, numPositionCalls, test.ShouldEqual, 2)
+		test.That(t, len(publisher.poses), test.ShouldEqual, 2)
+	})
+}
+
+func TestClipLidarReading(t *testing.T) {
+	logger := logging.NewTestLogger(t)
+	cf := cartofacade.Mock{}
+	cf.PositionFunc = func(ctx context.Context, timeout time.Duration) (cartofacade.Position, error) {
+		return cartofacade.Position{X: 500, Real: 1}, nil
+	}
+
+	// scan straddling the +x boundary of a 2m x 2m box once translated by the 500mm returned by Position
+	pc := pointcloud.New()
+	for _, p := range []r3.Vector{{X: 0}, {X: 500}, {X: 1000}} {
+		test.That(t, pc.Set(p, pointcloud.NewBasicData()), test.ShouldBeNil)
+	}
+	buf := new(bytes.Buffer)
+	test.That(t, pointcloud.ToPCD(pc, buf, pointcloud.PCDBinary), test.ShouldBeNil)
+	reading := s.TimedLidarReadingResponse{Reading: buf.Bytes(), ReadingTime: time.Now().UTC()}
+
+	bounds, err := s.NewMappingBounds([]r2.Point{
+		{X: -1000, Y: -1000}, {X: 1000, Y: -1000}, {X: 1000, Y: 1000}, {X: -1000, Y: 1000},
+	}, false)
+	test.That(t, err, test.ShouldBeNil)
+	var mappingBounds atomic.Pointer[s.MappingBounds]
+
+	config := Config{
+		Logger:        logger,
+		CartoFacade:   &cf,
+		MappingBounds: &mappingBounds,
+		Timeout:       10 * time.Second,
+	}
+
+	t.Run("reading is unchanged when no mapping bounds are set", func(t *testing.T) {
+		clippedReading, ok := config.clipLidarReading(context.Background(), reading)
+		test.That(t, ok, test.ShouldBeTrue)
+		test.That(t, clippedReading, test.ShouldResemble, reading)
+	})
+
+	t.Run("points outside of the mapping bounds are removed", func(t *testing.T) {
+		mappingBounds.Store(bounds)
+		defer mappingBounds.Store(nil)
+
+		clippedReading, ok := config.clipLidarReading(context.Background(), reading)
+		test.That(t, ok, test.ShouldBeTrue)
+		test.That(t, clippedReading.ReadingTime, test.ShouldEqual, reading.ReadingTime)
+		clippedPC, err := pointcloud.ReadPCD(bytes.NewReader(clippedReading.Reading))
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, clippedPC.Size(), test.ShouldEqual, 2)
+		_, ok = clippedPC.At(1000, 0, 0)
+		test.That(t, ok, test.ShouldBeFalse)
+	})
+
+	t.Run("reading is skipped when all points are outside of the mapping bounds", func(t *testing.T) {
+		mappingBounds.Store(bounds)
+		defer mappingBounds.Store(nil)
+
+		cf.PositionFunc = func(ctx context.Context, timeout time.Duration) (cartofacade.Position, error) {
+			return cartofacade.Position{X: 5000, Real: 1}, nil
+		}
+		_, ok := config.clipLidarReading(context.Background(), reading)
+		test.That(t, ok, test.ShouldBeFalse)
+	})
+
+	t.Run("map origin is used when there is no pose yet", func(t *testing.T) {
+		mappingBounds.Store(bounds)
+		defer mappingBounds.Store(nil)
+
+		cf.PositionFunc = func(ctx context.Context, timeout time.Duration) (cartofacade.Position, error) {
+			return cartofacade.Position{}, errors.New("no pose yet")
+		}
+		clippedReading, ok := config.clipLidarReading(context.Background(), reading)
+		test.That(t, ok, test.ShouldBeTrue)
+		test.That(t, clippedReading, test.ShouldResemble, reading)
 	})
 }
@@ -0,0 +1,110 @@
+package sensorprocess
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/golang/geo/r3"
+	"go.viam.com/rdk/pointcloud"
+	"go.viam.com/rdk/spatialmath"
+)
+
+// maxOverlapPoints is the number of points of a lidar reading that are compared against the existing map at most.
+// Readings with more points are subsampled evenly, which keeps the estimate cheap enough for every reading on a
+// Raspberry Pi.
+const maxOverlapPoints = 200
+
+// MapOverlap estimates, while updating an existing map, how much of the lidar readings fall onto the existing map,
+// i.e. whether the robot revisits mapped space, where cartographer can close loops, or explores new territory. A
+// point overlaps the existing map if its cell or any neighboring cell is occupied in it. The overlap is averaged
+// over the most recent readings. It is safe for concurrent use.
+type MapOverlap struct {
+	// Resolution is the size, in millimeters, of the cells the existing map is divided into.
+	Resolution float64
+	// Window is the number of most recent readings the overlap is averaged over.
+	Window int
+
+	mu       sync.Mutex
+	occupied map[cell]struct{}
+	// overlaps holds the overlap of the last Window readings, with next the index the next one is stored at.
+	overlaps []float64
+	next     int
+	numScans int64
+}
+
+// SetMap loads the existing map, a pointcloud in the PCD format, that readings are compared against.
+func (overlap *MapOverlap) SetMap(pcd []byte) error {
+	occupied, _, _, err := readOccupiedCells(pcd, overlap.Resolution)
+	if err != nil {
+		return err
+	}
+	if len(occupied) == 0 {
+		return errors.New("cannot estimate the overlap with an empty map")
+	}
+
+	overlap.mu.Lock()
+	defer overlap.mu.Unlock()
+	overlap.occupied = occupied
+	overlap.overlaps = nil
+	overlap.next = 0
+	overlap.numScans = 0
+	return nil
+}
+
+// addReading compares up to maxOverlapPoints points of the reading, placed in the map frame with scanPose, against
+// the existing map and returns the fraction of them that overlap it. Returns false if the map has not been loaded
+// yet or the reading has no points.
+func (overlap *MapOverlap) addReading(pc pointcloud.PointCloud, scanPose spatialmath.Pose) (float64, bool) {
+	if pc.Size() == 0 {
+		return 0, false
+	}
+	stride := (pc.Size() + maxOverlapPoints - 1) / maxOverlapPoints
+
+	overlap.mu.Lock()
+	defer overlap.mu.Unlock()
+	if overlap.occupied == nil {
+		return 0, false
+	}
+
+	var i, numPoints, numOverlapping int
+	pc.Iterate(0, 0, func(p r3.Vector, d pointcloud.Data) bool {
+		i++
+		if (i-1)%stride != 0 {
+			return true
+		}
+		numPoints++
+		c := cellOf(spatialmath.Compose(scanPose, spatialmath.NewPoseFromPoint(p)).Point(), overlap.Resolution)
+		if isNearOccupied(overlap.occupied, c) {
+			numOverlapping++
+		}
+		return true
+	})
+
+	fraction := float64(numOverlapping) / float64(numPoints)
+	if len(overlap.overlaps) < overlap.Window {
+		overlap.overlaps = append(overlap.overlaps, fraction)
+	} else {
+		overlap.overlaps[overlap.next] = fraction
+	}
+	overlap.next = (overlap.next + 1) % max(overlap.Window, 1)
+	overlap.numScans++
+	return fraction, true
+}
+
+// ToMap returns the number of readings that were compared against the existing map as num_readings and, once
+// there is one, the average percentage of the points of the last Window readings that overlap the existing map as
+// overlap_percent.
+func (overlap *MapOverlap) ToMap() map[string]interface{} {
+	overlap.mu.Lock()
+	defer overlap.mu.Unlock()
+	resp := map[string]interface{}{"num_readings": overlap.numScans}
+	if len(overlap.overlaps) == 0 {
+		return resp
+	}
+	var sum float64
+	for _, fraction := range overlap.overlaps {
+		sum += fraction
+	}
+	resp["overlap_percent"] = 100 * sum / float64(len(overlap.overlaps))
+	return resp
+}
@@ -0,0 +1,100 @@
+package sensorprocess
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang/geo/r3"
+	"go.viam.com/rdk/logging"
+	"go.viam.com/test"
+
+	"github.com/viam-modules/viam-cartographer/cartofacade"
+	s "github.com/viam-modules/viam-cartographer/sensors"
+	"github.com/viam-modules/viam-cartographer/sensors/inject"
+	"github.com/viam-modules/viam-cartographer/testhelper/pcdtest"
+)
+
+func TestMapOverlap(t *testing.T) {
+	logger := logging.NewTestLogger(t)
+	robotPosition := r3.Vector{X: 2500, Y: 2500}
+
+	// a scan of the walls of the mapped room and a scan of a room of the same size 20m away, in the lidar frame
+	var insidePoints, outsidePoints []r3.Vector
+	for _, p := range roomWalls() {
+		insidePoints = append(insidePoints, p.Sub(robotPosition))
+		outsidePoints = append(outsidePoints, p.Add(r3.Vector{X: 20000}).Sub(robotPosition))
+	}
+	inside := s.TimedLidarReadingResponse{Reading: pcdtest.PointsToPCD(t, insidePoints), ReadingTime: time.Now().UTC()}
+	outside := s.TimedLidarReadingResponse{Reading: pcdtest.PointsToPCD(t, outsidePoints), ReadingTime: time.Now().UTC()}
+	// the scans have more points than are compared
+	test.That(t, len(insidePoints), test.ShouldBeGreaterThan, maxOverlapPoints)
+
+	cf := cartofacade.Mock{}
+	cf.AddLidarReadingFunc = func(
+		ctx context.Context,
+		timeout time.Duration,
+		sensorName string,
+		currentReading s.TimedLidarReadingResponse,
+	) error {
+		return nil
+	}
+	cf.PositionFunc = func(ctx context.Context, timeout time.Duration) (cartofacade.Position, error) {
+		return cartofacade.Position{X: robotPosition.X, Y: robotPosition.Y, Real: 1}, nil
+	}
+	injectLidar := inject.TimedLidar{}
+	injectLidar.NameFunc = func() string { return "good_lidar" }
+
+	overlap := &MapOverlap{Resolution: 100, Window: 4}
+	config := Config{
+		Logger:      logger,
+		CartoFacade: &cf,
+		IsOnline:    true,
+		Lidar:       &injectLidar,
+		Timeout:     10 * time.Second,
+		MapOverlap:  overlap,
+	}
+	// readings that are not newer than the last one added are dropped
+	readingTime := time.Now().UTC()
+	addLidarReading := func(reading s.TimedLidarReadingResponse) error {
+		readingTime = readingTime.Add(time.Second)
+		reading.ReadingTime = readingTime
+		return config.tryAddLidarReading(context.Background(), reading)
+	}
+
+	t.Run("readings are not compared before the map is loaded", func(t *testing.T) {
+		test.That(t, addLidarReading(inside), test.ShouldBeNil)
+		test.That(t, overlap.ToMap(), test.ShouldResemble, map[string]interface{}{"num_readings": int64(0)})
+	})
+
+	test.That(t, overlap.SetMap(pcdtest.PointsToPCD(t, roomWalls())), test.ShouldBeNil)
+
+	t.Run("a reading within the map fully overlaps it", func(t *testing.T) {
+		test.That(t, addLidarReading(inside), test.ShouldBeNil)
+		test.That(t, overlap.ToMap(), test.ShouldResemble, map[string]interface{}{
+			"num_readings":    int64(1),
+			"overlap_percent": 100.0,
+		})
+	})
+
+	t.Run("the overlap is averaged over the last readings", func(t *testing.T) {
+		test.That(t, addLidarReading(outside), test.ShouldBeNil)
+		test.That(t, overlap.ToMap()["overlap_percent"], test.ShouldEqual, 50.0)
+
+		for i := 0; i < 3; i++ {
+			test.That(t, addLidarReading(outside), test.ShouldBeNil)
+		}
+		test.That(t, overlap.ToMap(), test.ShouldResemble, map[string]interface{}{
+			"num_readings":    int64(5),
+			"overlap_percent": 0.0,
+		})
+
+		test.That(t, addLidarReading(inside), test.ShouldBeNil)
+		test.That(t, overlap.ToMap()["overlap_percent"], test.ShouldEqual, 25.0)
+	})
+
+	t.Run("fails for an empty map", func(t *testing.T) {
+		err := (&MapOverlap{Resolution: 100, Window: 4}).SetMap(pcdtest.PointsToPCD(t, nil))
+		test.That(t, err, test.ShouldBeError, "cannot estimate the overlap with an empty map")
+	})
+}
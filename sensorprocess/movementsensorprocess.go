@@ -4,15 +4,23 @@ package sensorprocess
 import (
 	"context"
 	"errors"
+	"fmt"
 	"math"
 	"time"
 
+	geo "github.com/kellydunn/golang-geo"
 	replaymovementsensor "go.viam.com/rdk/components/movementsensor/replay"
+	"go.viam.com/rdk/spatialmath"
+	"go.viam.com/rdk/utils"
 
 	"github.com/viam-modules/viam-cartographer/cartofacade"
 	s "github.com/viam-modules/viam-cartographer/sensors"
 )
 
+// maxConsecutiveInvalidOrientations is the number of movement sensor readings in a row whose orientation may be
+// invalid before offline mode gives up on the dataset.
+const maxConsecutiveInvalidOrientations = 100
+
 // StartMovementSensor polls the movement sensor to get the next sensor reading
 // and adds it to the cartofacade. Stops when the context is Done.
 func (config *Config) StartMovementSensor(ctx context.Context) {
@@ -21,6 +29,7 @@ func (config *Config) StartMovementSensor(ctx context.Context) {
 		case <-ctx.Done():
 			return
 		default:
+			config.heartbeat()
 			if err := config.addMovementSensorReadingInOnline(ctx); err != nil {
 				config.Logger.Warn(err)
 			}
@@ -32,10 +41,16 @@ func (config *Config) StartMovementSensor(ctx context.Context) {
 // cartofacade.
 func (config *Config) addMovementSensorReadingInOnline(ctx context.Context) error {
 	// get next movement sensor data response
-	movementSensorReading, err := config.MovementSensor.TimedMovementSensorReading(ctx)
+	movementSensorReading, err := config.nextMovementSensorReading(ctx)
 	if err != nil {
-		if errors.Is(err, replaymovementsensor.ErrEndOfDataset) {
+		switch {
+		case errors.Is(err, replaymovementsensor.ErrEndOfDataset):
 			time.Sleep(1 * time.Second)
+		case errors.Is(err, s.ErrInvalidOrientation):
+			// the movement sensor already warns about the dropped reading, throttled, so the next one is waited for
+			// rather than requested right away
+			time.Sleep(time.Second / time.Duration(config.MovementSensor.DataFrequencyHz()))
+			return nil
 		}
 		return err
 	}
@@ -51,11 +66,39 @@ func (config *Config) addMovementSensorReadingInOnline(ctx context.Context) erro
 	return nil
 }
 
+// nextMovementSensorReading returns the next reading of the movement sensor. The velocity reading of a movement
+// sensor that reports its odometry as velocities is integrated into the odometer reading of the response, exactly
+// once per reading, so that it is added to cartographer like that of any other odometer. In offline mode, readings
+// whose orientation is invalid are skipped for the next one of the dataset, up to maxConsecutiveInvalidOrientations
+// in a row.
+func (config *Config) nextMovementSensorReading(ctx context.Context) (s.TimedMovementSensorReadingResponse, error) {
+	reading, err := config.MovementSensor.TimedMovementSensorReading(ctx)
+	for numInvalid := 1; !config.IsOnline && errors.Is(err, s.ErrInvalidOrientation) && ctx.Err() == nil; numInvalid++ {
+		if numInvalid >= maxConsecutiveInvalidOrientations {
+			return reading, fmt.Errorf("giving up after %d consecutive movement sensor readings had an invalid "+
+				"orientation: %w", numInvalid, err)
+		}
+		reading, err = config.MovementSensor.TimedMovementSensorReading(ctx)
+	}
+	if err != nil || reading.TimedVelocityResponse == nil {
+		return reading, err
+	}
+	if config.VelocityIntegrator == nil {
+		config.VelocityIntegrator = &cartofacade.VelocityIntegrator{}
+	}
+	odometerReading := config.VelocityIntegrator.Integrate(*reading.TimedVelocityResponse)
+	reading.TimedOdometerResponse = &odometerReading
+	return reading, nil
+}
+
 // tryAddMovementSensorReadingUntilSuccess adds a reading to the cartofacade and retries on error (offline mode).
 // While add sensor reading fails, keep trying to add the same reading - in offline mode we want to
-// process each reading so if we cannot acquire the lock we should try again.
+// process each reading so if we cannot acquire the lock we should try again. The IMU or odometer reading that
+// cartographer rejects for its contents is only retried MaxRejectedReadingRetries times, then it is skipped, and
+// errReadingSkipped is returned if neither was added. A reading that is out of order is not retried either.
 func (config *Config) tryAddMovementSensorReadingUntilSuccess(ctx context.Context, reading s.TimedMovementSensorReadingResponse) error {
-	var imuDone, odometerDone bool
+	var imuDone, odometerDone, added bool
+	var numIMURejections, numOdometerRejections int
 	// set IMU as done since it is not supported: we won't attempt to add IMU data to cartographer
 	if !config.MovementSensor.Properties().IMUSupported {
 		imuDone = true
@@ -70,36 +113,69 @@ func (config *Config) tryAddMovementSensorReadingUntilSuccess(ctx context.Contex
 			return ctx.Err()
 		default:
 			if !odometerDone {
-				if err := config.tryAddOdometerReading(ctx, *reading.TimedOdometerResponse); err != nil {
-					if !errors.Is(err, cartofacade.ErrUnableToAcquireLock) {
-						config.Logger.Warnw("Retrying odometer sensor reading due to error from cartofacade", "error", err)
-					}
-				} else {
+				err := config.tryAddOdometerReading(ctx, *reading.TimedOdometerResponse)
+				switch {
+				case err == nil:
+					odometerDone, added = true, true
+				case errors.Is(err, errReadingOutOfOrder):
 					odometerDone = true
+				case config.rejectedTooOften(err, &numOdometerRejections):
+					config.skipRejectedReading(OdometerSensor, reading.TimedOdometerResponse.ReadingTime, err)
+					odometerDone = true
+				case !errors.Is(err, cartofacade.ErrUnableToAcquireLock):
+					config.Logger.Warnw("Retrying odometer sensor reading due to error from cartofacade", "error", err)
 				}
 			}
 			if !imuDone {
-				if err := config.tryAddIMUReading(ctx, *reading.TimedIMUResponse); err != nil {
-					if !errors.Is(err, cartofacade.ErrUnableToAcquireLock) {
-						config.Logger.Warnw("Retrying IMU sensor reading due to error from cartofacade", "error", err)
-					}
-				} else {
+				err := config.tryAddIMUReading(ctx, *reading.TimedIMUResponse)
+				switch {
+				case err == nil:
+					imuDone, added = true, true
+				case errors.Is(err, errReadingOutOfOrder):
+					imuDone = true
+				case config.rejectedTooOften(err, &numIMURejections):
+					config.skipRejectedReading(IMUSensor, reading.TimedIMUResponse.ReadingTime, err)
 					imuDone = true
+				case !errors.Is(err, cartofacade.ErrUnableToAcquireLock):
+					config.Logger.Warnw("Retrying IMU sensor reading due to error from cartofacade", "error", err)
 				}
 			}
 			if imuDone && odometerDone {
+				if !added {
+					return errReadingSkipped
+				}
 				return nil
 			}
 		}
 	}
 }
 
-// tryAddMovementSensorReadingOnce adds a reading to the carto facade and does not retry. Returns remainder of time interval.
+// tryAddMovementSensorReadingOnce adds a reading to the carto facade and does not retry, unless
+// MovementSensorBufferSize is set, in which case readings that fail due to lock contention are buffered. Returns
+// remainder of time interval.
 func (config *Config) tryAddMovementSensorReadingOnce(ctx context.Context, reading s.TimedMovementSensorReadingResponse) int {
 	startTime := time.Now().UTC()
 
-	if config.MovementSensor.Properties().OdometerSupported {
-		if err := config.tryAddOdometerReading(ctx, *reading.TimedOdometerResponse); err != nil {
+	if config.LastLidarReadingTime != nil {
+		var lastLidarReadingTime time.Time
+		if lastLidarReadingTimeUnixNano := config.LastLidarReadingTime.Load(); lastLidarReadingTimeUnixNano != 0 {
+			lastLidarReadingTime = time.Unix(0, lastLidarReadingTimeUnixNano)
+		}
+		if err := config.checkSensorSkew(lastLidarReadingTime, config.movementSensorReadingTime(reading)); err != nil {
+			config.warnSkewedReading(err)
+			return config.remainingMovementSensorInterval(startTime)
+		}
+	}
+
+	if config.MovementSensor.Properties().OdometerSupported && config.MovementSensorBufferSize > 0 {
+		if config.odometerBuffer == nil {
+			config.odometerBuffer = newReadingBuffer[s.TimedOdometerReadingResponse](config.MovementSensorBufferSize)
+		}
+		addBufferedReadings(ctx, config, config.odometerBuffer, OdometerSensor, *reading.TimedOdometerResponse,
+			config.tryAddOdometerReading)
+	} else if config.MovementSensor.Properties().OdometerSupported {
+		err := config.tryAddOdometerReading(ctx, *reading.TimedOdometerResponse)
+		if err != nil && !errors.Is(err, errReadingOutOfOrder) {
 			if errors.Is(err, cartofacade.ErrUnableToAcquireLock) {
 				config.Logger.Debugw("Skipping odometer sensor reading due to lock contention in cartofacade", "error", err)
 			} else {
@@ -108,8 +184,14 @@ func (config *Config) tryAddMovementSensorReadingOnce(ctx context.Context, readi
 		}
 	}
 
-	if config.MovementSensor.Properties().IMUSupported {
-		if err := config.tryAddIMUReading(ctx, *reading.TimedIMUResponse); err != nil {
+	if config.MovementSensor.Properties().IMUSupported && config.MovementSensorBufferSize > 0 {
+		if config.imuBuffer == nil {
+			config.imuBuffer = newReadingBuffer[s.TimedIMUReadingResponse](config.MovementSensorBufferSize)
+		}
+		addBufferedReadings(ctx, config, config.imuBuffer, IMUSensor, *reading.TimedIMUResponse, config.tryAddIMUReading)
+	} else if config.MovementSensor.Properties().IMUSupported {
+		err := config.tryAddIMUReading(ctx, *reading.TimedIMUResponse)
+		if err != nil && !errors.Is(err, errReadingOutOfOrder) {
 			if errors.Is(err, cartofacade.ErrUnableToAcquireLock) {
 				config.Logger.Debugw("Skipping IMU sensor reading due to lock contention in cartofacade", "error", err)
 			} else {
@@ -118,28 +200,83 @@ func (config *Config) tryAddMovementSensorReadingOnce(ctx context.Context, readi
 		}
 	}
 
+	return config.remainingMovementSensorInterval(startTime)
+}
+
+// remainingMovementSensorInterval returns the remainder of the time interval of the movement sensor that started
+// at startTime in milliseconds.
+func (config *Config) remainingMovementSensorInterval(startTime time.Time) int {
 	timeElapsedMs := int(time.Since(startTime).Milliseconds())
 	return int(math.Max(0, float64(1000/config.MovementSensor.DataFrequencyHz()-timeElapsedMs)))
 }
 
-// tryAddIMUReading tries to add an IMU reading to the carto facade.
+// tryAddIMUReading tries to add an IMU reading to the carto facade. A reading that is not newer than the last one
+// added is dropped with errReadingOutOfOrder instead.
 func (config *Config) tryAddIMUReading(ctx context.Context, reading s.TimedIMUReadingResponse) error {
+	readingTime := reading.ReadingTime
+	if config.outOfOrder(IMUSensor, readingTime, config.lastAddedIMUReadingTime) {
+		return errReadingOutOfOrder
+	}
+	reading.ReadingTime = config.rebaseReadingTime(reading.ReadingTime)
 	err := config.CartoFacade.AddIMUReading(ctx, config.Timeout, config.MovementSensor.Name(), reading)
+	config.recordIMUReading(readingTime, err)
 	if err != nil {
 		config.Logger.Debugf("%v \t |  IMU  | Failure \t \t | %v \n", reading.ReadingTime, reading.ReadingTime.Unix())
 	} else {
 		config.Logger.Debugf("%v \t |  IMU  | Success \t \t | %v \n", reading.ReadingTime, reading.ReadingTime.Unix())
+		config.lastAddedIMUReadingTime = readingTime
+		config.recordIngestionLatency(IMUSensor, readingTime)
+		if config.AddedIMUReadings != nil {
+			config.AddedIMUReadings.Add(1)
+		}
+		config.mirrorIMUReading(ctx, reading)
 	}
 	return err
 }
 
-// tryAddOdometerReading tries to add an odometer reading to the carto facade.
+// tryAddOdometerReading tries to add an odometer reading to the carto facade. A reading that is not newer than the
+// last one added is dropped with errReadingOutOfOrder instead.
 func (config *Config) tryAddOdometerReading(ctx context.Context, reading s.TimedOdometerReadingResponse) error {
+	readingTime := reading.ReadingTime
+	if config.outOfOrder(OdometerSensor, readingTime, config.lastAddedOdometerReadingTime) {
+		return errReadingOutOfOrder
+	}
+	if reading.Position == nil && config.MovementSensor.Properties().HeadingOnly {
+		reading.Position = headingOnlyPosition()
+	}
+	reading.ReadingTime = config.rebaseReadingTime(reading.ReadingTime)
 	err := config.CartoFacade.AddOdometerReading(ctx, config.Timeout, config.MovementSensor.Name(), reading)
+	config.recordOdometerReading(readingTime, err)
 	if err != nil {
 		config.Logger.Debugf("%v \t |  Odometer  | Failure \t \t | %v \n", reading.ReadingTime, reading.ReadingTime.Unix())
 	} else {
 		config.Logger.Debugf("%v \t |  Odometer  | Success \t \t | %v \n", reading.ReadingTime, reading.ReadingTime.Unix())
+		config.lastAddedOdometerReadingTime = readingTime
+		config.recordIngestionLatency(OdometerSensor, readingTime)
+		if config.AddedOdometerReadings != nil {
+			config.AddedOdometerReadings.Add(1)
+		}
+		config.setOdometerOrigin(reading)
+		config.mirrorOdometerReading(ctx, reading)
 	}
 	return err
 }
+
+// headingOnlyPosition returns the position of the odometer readings of a heading only movement sensor, which is
+// the origin, as the movement sensor does not know its position. The readings only carry the heading measured by
+// the movement sensor, no estimate of cartographer is fed back into them.
+func headingOnlyPosition() *geo.Point {
+	return geo.NewPoint(0, 0)
+}
+
+// setOdometerOrigin stores the geo pose of the reading as the odometer origin unless an earlier reading was stored.
+// The heading of the origin is that of the y axis of the map frame, which is aligned with the initial pose.
+func (config *Config) setOdometerOrigin(reading s.TimedOdometerReadingResponse) {
+	if config.OdometerOrigin == nil || config.OdometerOrigin.Load() != nil {
+		return
+	}
+	// the yaw is right handed from east while the heading is left handed from north
+	heading := -utils.RadToDeg(reading.Orientation.EulerAngles().Yaw)
+	heading = math.Mod(math.Mod(heading, 360)+360, 360)
+	config.OdometerOrigin.CompareAndSwap(nil, spatialmath.NewGeoPose(reading.Position, heading))
+}
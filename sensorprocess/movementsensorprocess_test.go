@@ -3,6 +3,7 @@ package sensorprocess
 import (
 	"context"
 	"errors"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -36,7 +37,7 @@ func TestStartMovementSensor(t *testing.T) {
 		cancelCtx, cancelFunc := context.WithCancel(context.Background())
 
 		lidar, imu := s.NoLidar, s.FinishedReplayIMU
-		replaySensor, err := s.NewMovementSensor(context.Background(), s.SetupDeps(lidar, imu), string(imu), 20, logger)
+		replaySensor, err := s.NewMovementSensor(context.Background(), s.SetupDeps(lidar, imu), string(imu), 20, s.DegreesPerSecond, logger)
 		test.That(t, err, test.ShouldBeNil)
 
 		config.MovementSensor = replaySensor
@@ -164,6 +165,57 @@ func TestTryAddMovementSensorReadingUntilSuccess(t *testing.T) {
 	t.Run("replay movement sensor attempts to add sensor data until success", func(t *testing.T) {
 		validAddMovementSensorReadingUntilSuccessTestHelper(ctx, t, config, cf, s.ReplayMovementSensorBothIMUAndOdometer)
 	})
+
+	t.Run("an IMU or odometer reading that cartographer keeps rejecting is skipped", func(t *testing.T) {
+		movementSensor := &inject.TimedMovementSensor{}
+		movementSensor.NameFunc = func() string { return "movement_sensor" }
+		movementSensor.PropertiesFunc = func() s.MovementSensorProperties {
+			return s.MovementSensorProperties{IMUSupported: true, OdometerSupported: true}
+		}
+		reading := s.TimedMovementSensorReadingResponse{
+			TimedIMUResponse:      &s.TimedIMUReadingResponse{ReadingTime: time.Now()},
+			TimedOdometerResponse: &s.TimedOdometerReadingResponse{Position: s.TestPosition, ReadingTime: time.Now()},
+		}
+		config := config
+		config.MovementSensor = movementSensor
+		config.MaxRejectedReadingRetries = 1
+		config.JobSummary = &JobSummary{}
+
+		var numIMUCalls, numOdometerCalls int
+		cf.AddIMUReadingFunc = func(
+			ctx context.Context, timeout time.Duration, sensorName string, currentReading s.TimedIMUReadingResponse,
+		) error {
+			numIMUCalls++
+			return cartofacade.ErrIMUReadingInvalid
+		}
+		odometerErr := error(nil)
+		cf.AddOdometerReadingFunc = func(
+			ctx context.Context, timeout time.Duration, sensorName string, currentReading s.TimedOdometerReadingResponse,
+		) error {
+			numOdometerCalls++
+			return odometerErr
+		}
+		config.CartoFacade = &cf
+
+		// the odometer reading is added, the IMU reading is skipped
+		test.That(t, config.tryAddMovementSensorReadingUntilSuccess(ctx, reading), test.ShouldBeNil)
+		test.That(t, numIMUCalls, test.ShouldEqual, 2)
+		test.That(t, numOdometerCalls, test.ShouldEqual, 1)
+		test.That(t, config.JobSummary.ToMap()["num_rejected_readings"], test.ShouldEqual, int64(1))
+
+		// neither is added
+		numIMUCalls, numOdometerCalls = 0, 0
+		odometerErr = cartofacade.ErrOdometerReadingInvalid
+		reading = s.TimedMovementSensorReadingResponse{
+			TimedIMUResponse:      &s.TimedIMUReadingResponse{ReadingTime: time.Now()},
+			TimedOdometerResponse: &s.TimedOdometerReadingResponse{Position: s.TestPosition, ReadingTime: time.Now()},
+		}
+		err := config.tryAddMovementSensorReadingUntilSuccess(ctx, reading)
+		test.That(t, err, test.ShouldBeError, errReadingSkipped)
+		test.That(t, numIMUCalls, test.ShouldEqual, 2)
+		test.That(t, numOdometerCalls, test.ShouldEqual, 2)
+		test.That(t, config.JobSummary.ToMap()["num_rejected_readings"], test.ShouldEqual, int64(3))
+	})
 }
 
 func TestTryAddMovementSensorReadingOnce(t *testing.T) {
@@ -242,13 +294,15 @@ func TestTryAddIMUReading(t *testing.T) {
 		}
 	}
 
+	var addedReadings atomic.Int64
 	config := Config{
-		Logger:         logger,
-		CartoFacade:    &cf,
-		IsOnline:       injectLidar.DataFrequencyHzFunc() != 0,
-		Lidar:          &injectLidar,
-		MovementSensor: &injectImu,
-		Timeout:        10 * time.Second,
+		Logger:           logger,
+		CartoFacade:      &cf,
+		IsOnline:         injectLidar.DataFrequencyHzFunc() != 0,
+		Lidar:            &injectLidar,
+		MovementSensor:   &injectImu,
+		Timeout:          10 * time.Second,
+		AddedIMUReadings: &addedReadings,
 	}
 
 	t.Run("return error when AddIMUReading errors out", func(t *testing.T) {
@@ -265,6 +319,7 @@ func TestTryAddIMUReading(t *testing.T) {
 		err := config.tryAddIMUReading(context.Background(), imuReading)
 		test.That(t, err, test.ShouldNotBeNil)
 		test.That(t, err, test.ShouldBeError, expectedErr)
+		test.That(t, addedReadings.Load(), test.ShouldEqual, 0)
 	})
 
 	t.Run("succeeds when AddIMUReading succeeds", func(t *testing.T) {
@@ -279,6 +334,7 @@ func TestTryAddIMUReading(t *testing.T) {
 
 		err := config.tryAddIMUReading(context.Background(), imuReading)
 		test.That(t, err, test.ShouldBeNil)
+		test.That(t, addedReadings.Load(), test.ShouldEqual, 1)
 	})
 }
 
@@ -303,13 +359,15 @@ func TestTryAddOdometerReading(t *testing.T) {
 		}
 	}
 
+	var addedReadings atomic.Int64
 	config := Config{
-		Logger:         logger,
-		CartoFacade:    &cf,
-		IsOnline:       injectLidar.DataFrequencyHzFunc() != 0,
-		Lidar:          &injectLidar,
-		MovementSensor: &injectOdometer,
-		Timeout:        10 * time.Second,
+		Logger:                logger,
+		CartoFacade:           &cf,
+		IsOnline:              injectLidar.DataFrequencyHzFunc() != 0,
+		Lidar:                 &injectLidar,
+		MovementSensor:        &injectOdometer,
+		Timeout:               10 * time.Second,
+		AddedOdometerReadings: &addedReadings,
 	}
 
 	t.Run("return error when AddOdometerReading errors out", func(t *testing.T) {
@@ -326,6 +384,7 @@ func TestTryAddOdometerReading(t *testing.T) {
 		err := config.tryAddOdometerReading(context.Background(), odometerReading)
 		test.That(t, err, test.ShouldNotBeNil)
 		test.That(t, err, test.ShouldBeError, expectedErr)
+		test.That(t, addedReadings.Load(), test.ShouldEqual, 0)
 	})
 
 	t.Run("succeeds when AddOdometerReading succeeds", func(t *testing.T) {
@@ -340,5 +399,242 @@ func TestTryAddOdometerReading(t *testing.T) {
 
 		err := config.tryAddOdometerReading(context.Background(), odometerReading)
 		test.That(t, err, test.ShouldBeNil)
+		test.That(t, addedReadings.Load(), test.ShouldEqual, 1)
+	})
+
+	t.Run("stores the first odometer reading that was added as the odometer origin", func(t *testing.T) {
+		var origin atomic.Pointer[spatialmath.GeoPose]
+		config.OdometerOrigin = &origin
+		defer func() { config.OdometerOrigin = nil }()
+
+		firstReading := s.TimedOdometerReadingResponse{
+			Position: geo.NewPoint(40.7, -73.9),
+			// facing north, so the y axis of the map frame points west
+			Orientation: &spatialmath.OrientationVectorDegrees{OZ: 1, Theta: 90},
+			ReadingTime: time.Now().UTC(),
+		}
+		test.That(t, config.tryAddOdometerReading(context.Background(), firstReading), test.ShouldBeNil)
+		odometerReading.ReadingTime = firstReading.ReadingTime.Add(time.Second)
+		test.That(t, config.tryAddOdometerReading(context.Background(), odometerReading), test.ShouldBeNil)
+
+		test.That(t, origin.Load().Location(), test.ShouldResemble, firstReading.Position)
+		test.That(t, origin.Load().Heading(), test.ShouldAlmostEqual, 270)
+	})
+}
+
+func TestHeadingOnlyOdometerReading(t *testing.T) {
+	logger := logging.NewTestLogger(t)
+	ctx := context.Background()
+	movementSensor, err := s.NewHeadingOnlyMovementSensor(ctx, s.SetupDeps(s.NoLidar, s.CompassMovementSensor),
+		string(s.CompassMovementSensor), 20, s.DegreesPerSecond, logger)
+	test.That(t, err, test.ShouldBeNil)
+	reading, err := movementSensor.TimedMovementSensorReading(ctx)
+	test.That(t, err, test.ShouldBeNil)
+
+	cf := cartofacade.Mock{}
+	var added []s.TimedOdometerReadingResponse
+	cf.AddOdometerReadingFunc = func(
+		ctx context.Context,
+		timeout time.Duration,
+		sensorName string,
+		currentReading s.TimedOdometerReadingResponse,
+	) error {
+		added = append(added, currentReading)
+		return nil
+	}
+	config := Config{
+		Logger:         logger,
+		CartoFacade:    &cf,
+		IsOnline:       true,
+		MovementSensor: movementSensor,
+		Timeout:        10 * time.Second,
+	}
+
+	t.Run("the readings hold the heading of the movement sensor at the origin", func(t *testing.T) {
+		cf.PositionFunc = func(ctx context.Context, timeout time.Duration) (cartofacade.Position, error) {
+			t.Error("the position of cartographer must not be fed back into the odometer readings")
+			return cartofacade.Position{X: 1000, Y: 2000}, nil
+		}
+		for i := 0; i < 3; i++ {
+			added = nil
+			reading.TimedOdometerResponse.ReadingTime = reading.TimedOdometerResponse.ReadingTime.Add(time.Second)
+			test.That(t, config.tryAddOdometerReading(ctx, *reading.TimedOdometerResponse), test.ShouldBeNil)
+			test.That(t, added[0].Position, test.ShouldResemble, geo.NewPoint(0, 0))
+			test.That(t, added[0].Orientation, test.ShouldResemble, reading.TimedOdometerResponse.Orientation)
+		}
+	})
+
+	t.Run("the position of the readings of other movement sensors is kept", func(t *testing.T) {
+		injectOdometer := inject.TimedMovementSensor{}
+		injectOdometer.NameFunc = func() string { return "good_odometer" }
+		injectOdometer.PropertiesFunc = func() s.MovementSensorProperties {
+			return s.MovementSensorProperties{OdometerSupported: true}
+		}
+		odometerConfig := config
+		odometerConfig.MovementSensor = &injectOdometer
+		added = nil
+		odometerReading := s.TimedOdometerReadingResponse{
+			Position:    geo.NewPoint(5, 4),
+			Orientation: &spatialmath.Quaternion{Real: 1},
+			ReadingTime: reading.TimedOdometerResponse.ReadingTime.Add(time.Second),
+		}
+		test.That(t, odometerConfig.tryAddOdometerReading(ctx, odometerReading), test.ShouldBeNil)
+		test.That(t, added[0].Position, test.ShouldResemble, odometerReading.Position)
+	})
+}
+
+func TestVelocityOdometerReading(t *testing.T) {
+	logger := logging.NewTestLogger(t)
+	ctx := context.Background()
+	start := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	// a wheel encoder driving east at 0.5 m/s, whose readings are a second apart
+	var numReadings int
+	encoder := &inject.TimedMovementSensor{}
+	encoder.NameFunc = func() string { return "wheel_encoder" }
+	encoder.DataFrequencyHzFunc = func() int { return 1000 }
+	encoder.PropertiesFunc = func() s.MovementSensorProperties {
+		return s.MovementSensorProperties{OdometerSupported: true, VelocitySupported: true}
+	}
+	encoder.TimedMovementSensorReadingFunc = func(ctx context.Context) (s.TimedMovementSensorReadingResponse, error) {
+		reading := s.TimedMovementSensorReadingResponse{
+			TimedVelocityResponse: &s.TimedVelocityReadingResponse{
+				LinearVelocity: r3.Vector{X: 0.5},
+				ReadingTime:    start.Add(time.Duration(numReadings) * time.Second),
+			},
+			TestIsReplaySensor: true,
+		}
+		numReadings++
+		return reading, nil
+	}
+
+	cf := cartofacade.Mock{}
+	var added []s.TimedOdometerReadingResponse
+	addErrs := []error{}
+	cf.AddOdometerReadingFunc = func(
+		ctx context.Context,
+		timeout time.Duration,
+		sensorName string,
+		currentReading s.TimedOdometerReadingResponse,
+	) error {
+		if len(addErrs) > 0 {
+			err := addErrs[0]
+			addErrs = addErrs[1:]
+			return err
+		}
+		added = append(added, currentReading)
+		return nil
+	}
+	newConfig := func(isOnline bool) Config {
+		numReadings, added = 0, nil
+		return Config{
+			Logger:         logger,
+			CartoFacade:    &cf,
+			IsOnline:       isOnline,
+			MovementSensor: encoder,
+			Timeout:        10 * time.Second,
+		}
+	}
+	eastMm := func(reading s.TimedOdometerReadingResponse) float64 {
+		return spatialmath.GeoPointToPoint(reading.Position, geo.NewPoint(0, 0)).X
+	}
+
+	t.Run("online, the velocity readings are added as integrated odometer readings", func(t *testing.T) {
+		config := newConfig(true)
+		for i := 0; i < 3; i++ {
+			test.That(t, config.addMovementSensorReadingInOnline(ctx), test.ShouldBeNil)
+		}
+		test.That(t, len(added), test.ShouldEqual, 3)
+		for i, reading := range added {
+			test.That(t, reading.ReadingTime, test.ShouldEqual, start.Add(time.Duration(i)*time.Second))
+			test.That(t, eastMm(reading), test.ShouldAlmostEqual, 500*float64(i), 1)
+		}
+	})
+
+	t.Run("offline, a velocity reading that is retried is integrated once", func(t *testing.T) {
+		config := newConfig(false)
+		for i := 0; i < 2; i++ {
+			reading, err := config.nextMovementSensorReading(ctx)
+			test.That(t, err, test.ShouldBeNil)
+			addErrs = []error{cartofacade.ErrUnableToAcquireLock, cartofacade.ErrUnableToAcquireLock}
+			test.That(t, config.tryAddMovementSensorReadingUntilSuccess(ctx, reading), test.ShouldBeNil)
+		}
+		test.That(t, len(added), test.ShouldEqual, 2)
+		test.That(t, eastMm(added[1]), test.ShouldAlmostEqual, 500, 1)
+	})
+}
+
+func TestInvalidOrientationMovementSensorReading(t *testing.T) {
+	logger := logging.NewTestLogger(t)
+	ctx := context.Background()
+
+	// an odometer whose orientation is invalid for the first numInvalid readings
+	var numReadings, numInvalid int
+	odometer := &inject.TimedMovementSensor{}
+	odometer.NameFunc = func() string { return "odometer" }
+	odometer.DataFrequencyHzFunc = func() int { return 1000 }
+	odometer.PropertiesFunc = func() s.MovementSensorProperties {
+		return s.MovementSensorProperties{OdometerSupported: true}
+	}
+	odometer.TimedMovementSensorReadingFunc = func(ctx context.Context) (s.TimedMovementSensorReadingResponse, error) {
+		numReadings++
+		if numReadings <= numInvalid {
+			return s.TimedMovementSensorReadingResponse{}, s.ErrInvalidOrientation
+		}
+		return s.TimedMovementSensorReadingResponse{
+			TimedOdometerResponse: &s.TimedOdometerReadingResponse{
+				Position:    s.TestPosition,
+				Orientation: s.TestUnitOrientation,
+				ReadingTime: time.Now().UTC(),
+			},
+		}, nil
+	}
+
+	cf := cartofacade.Mock{}
+	var numAdded int
+	cf.AddOdometerReadingFunc = func(
+		ctx context.Context,
+		timeout time.Duration,
+		sensorName string,
+		currentReading s.TimedOdometerReadingResponse,
+	) error {
+		numAdded++
+		return nil
+	}
+	newConfig := func(isOnline bool, invalid int) Config {
+		numReadings, numInvalid, numAdded = 0, invalid, 0
+		return Config{
+			Logger:         logger,
+			CartoFacade:    &cf,
+			IsOnline:       isOnline,
+			MovementSensor: odometer,
+			Timeout:        10 * time.Second,
+		}
+	}
+
+	t.Run("online, a reading with an invalid orientation is dropped without requesting another one", func(t *testing.T) {
+		config := newConfig(true, 1)
+		test.That(t, config.addMovementSensorReadingInOnline(ctx), test.ShouldBeNil)
+		test.That(t, numReadings, test.ShouldEqual, 1)
+		test.That(t, numAdded, test.ShouldEqual, 0)
+
+		test.That(t, config.addMovementSensorReadingInOnline(ctx), test.ShouldBeNil)
+		test.That(t, numReadings, test.ShouldEqual, 2)
+		test.That(t, numAdded, test.ShouldEqual, 1)
+	})
+
+	t.Run("offline, readings with an invalid orientation are skipped for the next one", func(t *testing.T) {
+		config := newConfig(false, 3)
+		reading, err := config.nextMovementSensorReading(ctx)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, reading.TimedOdometerResponse, test.ShouldNotBeNil)
+		test.That(t, numReadings, test.ShouldEqual, 4)
+	})
+
+	t.Run("offline, gives up once too many readings in a row have an invalid orientation", func(t *testing.T) {
+		config := newConfig(false, maxConsecutiveInvalidOrientations)
+		_, err := config.nextMovementSensorReading(ctx)
+		test.That(t, errors.Is(err, s.ErrInvalidOrientation), test.ShouldBeTrue)
+		test.That(t, numReadings, test.ShouldEqual, maxConsecutiveInvalidOrientations)
 	})
 }
@@ -0,0 +1,87 @@
+package sensorprocess
+
+import (
+	"context"
+	"errors"
+
+	"github.com/viam-modules/viam-cartographer/cartofacade"
+)
+
+// readingBuffer is a bounded FIFO of the readings of a sensor that could not be added to the cartofacade online
+// because its lock was held, oldest first. Once it is full, the oldest reading is dropped for a new one. It is
+// only used by the sensor process of its sensor, so it is not safe for concurrent use.
+type readingBuffer[T any] struct {
+	// readings is a ring whose oldest reading is at start.
+	readings    []T
+	start, size int
+}
+
+func newReadingBuffer[T any](capacity int) *readingBuffer[T] {
+	return &readingBuffer[T]{readings: make([]T, capacity)}
+}
+
+// push appends the reading and returns whether the oldest reading was dropped for it as the buffer was full.
+func (buffer *readingBuffer[T]) push(reading T) bool {
+	if buffer.size == len(buffer.readings) {
+		buffer.readings[buffer.start] = reading
+		buffer.start = (buffer.start + 1) % len(buffer.readings)
+		return true
+	}
+	buffer.readings[(buffer.start+buffer.size)%len(buffer.readings)] = reading
+	buffer.size++
+	return false
+}
+
+// peek returns the oldest reading, if there is one.
+func (buffer *readingBuffer[T]) peek() (T, bool) {
+	if buffer.size == 0 {
+		var zero T
+		return zero, false
+	}
+	return buffer.readings[buffer.start], true
+}
+
+// pop removes the oldest reading.
+func (buffer *readingBuffer[T]) pop() {
+	if buffer.size == 0 {
+		return
+	}
+	var zero T
+	buffer.readings[buffer.start] = zero
+	buffer.start = (buffer.start + 1) % len(buffer.readings)
+	buffer.size--
+}
+
+// addBufferedReadings appends the reading of the sensor of sensorType to the buffer and adds the readings of the
+// buffer with add, oldest first, so that they reach cartographer in the order of their timestamps. The first
+// reading that fails because the lock of the cartofacade is held is left in the buffer, with the ones after it,
+// to be added again before the next reading. Readings that fail for other reasons are skipped.
+func addBufferedReadings[T any](
+	ctx context.Context,
+	config *Config,
+	buffer *readingBuffer[T],
+	sensorType string,
+	reading T,
+	add func(context.Context, T) error,
+) {
+	if buffer.push(reading) {
+		config.recordDroppedReading(sensorType)
+		config.Logger.Debugw("Dropping the oldest buffered sensor reading as the buffer is full", "sensor", sensorType)
+	}
+	for {
+		next, ok := buffer.peek()
+		if !ok || ctx.Err() != nil {
+			return
+		}
+		err := add(ctx, next)
+		if errors.Is(err, cartofacade.ErrUnableToAcquireLock) {
+			config.Logger.Debugw("Buffering sensor reading due to lock contention in cartofacade",
+				"sensor", sensorType, "buffered_readings", buffer.size, "error", err)
+			return
+		}
+		if err != nil && !errors.Is(err, errReadingOutOfOrder) {
+			config.Logger.Warnw("Skipping sensor reading due to error from cartofacade", "sensor", sensorType, "error", err)
+		}
+		buffer.pop()
+	}
+}
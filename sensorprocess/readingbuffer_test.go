@@ -0,0 +1,205 @@
+package sensorprocess
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang/geo/r3"
+	geo "github.com/kellydunn/golang-geo"
+	"go.viam.com/rdk/logging"
+	"go.viam.com/rdk/spatialmath"
+	"go.viam.com/test"
+
+	"github.com/viam-modules/viam-cartographer/cartofacade"
+	s "github.com/viam-modules/viam-cartographer/sensors"
+	"github.com/viam-modules/viam-cartographer/sensors/inject"
+	"github.com/viam-modules/viam-cartographer/testhelper/pcdtest"
+)
+
+func TestReadingBuffer(t *testing.T) {
+	buffer := newReadingBuffer[int](3)
+	_, ok := buffer.peek()
+	test.That(t, ok, test.ShouldBeFalse)
+
+	drained := func() []int {
+		var readings []int
+		for reading, ok := buffer.peek(); ok; reading, ok = buffer.peek() {
+			readings = append(readings, reading)
+			buffer.pop()
+		}
+		return readings
+	}
+
+	for i := 1; i <= 3; i++ {
+		test.That(t, buffer.push(i), test.ShouldBeFalse)
+	}
+	test.That(t, buffer.push(4), test.ShouldBeTrue)
+	test.That(t, buffer.push(5), test.ShouldBeTrue)
+	test.That(t, drained(), test.ShouldResemble, []int{3, 4, 5})
+
+	// the ring wraps around
+	test.That(t, buffer.push(6), test.ShouldBeFalse)
+	test.That(t, buffer.push(7), test.ShouldBeFalse)
+	buffer.pop()
+	test.That(t, buffer.push(8), test.ShouldBeFalse)
+	test.That(t, buffer.push(9), test.ShouldBeFalse)
+	test.That(t, drained(), test.ShouldResemble, []int{7, 8, 9})
+	buffer.pop()
+	test.That(t, buffer.size, test.ShouldEqual, 0)
+}
+
+func TestBufferedLidarReadings(t *testing.T) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	at := func(i int) time.Time { return start.Add(time.Duration(i) * 200 * time.Millisecond) }
+	const numReadings = 20
+	// the lock is held while the first lockedReadings readings are read, several read intervals
+	const lockedReadings = 6
+
+	// startLidar runs the online lidar sensor process until the last reading was handled and returns the reading
+	// times that were added to cartographer, in the order they were added
+	startLidar := func(t *testing.T, bufferSize int) ([]time.Time, *SensorStats) {
+		t.Helper()
+		reading := pcdtest.PointsToPCD(t, []r3.Vector{{X: 1000}})
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		numRead := 0
+		injectLidar := &inject.TimedLidar{}
+		injectLidar.NameFunc = func() string { return "front" }
+		injectLidar.DataFrequencyHzFunc = func() int { return 5 }
+		injectLidar.TimedLidarReadingFunc = func(ctx context.Context) (s.TimedLidarReadingResponse, error) {
+			numRead++
+			return s.TimedLidarReadingResponse{Reading: reading, ReadingTime: at(numRead), TestIsReplaySensor: true}, nil
+		}
+		var added []time.Time
+		cf := &cartofacade.Mock{}
+		cf.AddLidarReadingFunc = func(
+			ctx context.Context, timeout time.Duration, lidarName string, currentReading s.TimedLidarReadingResponse,
+		) error {
+			if numRead <= lockedReadings {
+				return cartofacade.ErrUnableToAcquireLock
+			}
+			added = append(added, currentReading.ReadingTime)
+			if currentReading.ReadingTime.Equal(at(numReadings)) {
+				cancel()
+			}
+			return nil
+		}
+		config := Config{
+			Logger:          logging.NewTestLogger(t),
+			CartoFacade:     cf,
+			IsOnline:        true,
+			Lidar:           injectLidar,
+			LidarBufferSize: bufferSize,
+			SensorStats:     &SensorStats{IsOnline: true},
+			Timeout:         10 * time.Second,
+		}
+		config.StartLidar(ctx)
+		test.That(t, numRead, test.ShouldEqual, numReadings)
+		for i := 1; i < len(added); i++ {
+			test.That(t, added[i], test.ShouldHappenAfter, added[i-1])
+		}
+		return added, config.SensorStats
+	}
+
+	t.Run("readings that fail for lock contention are added in order once the lock is released", func(t *testing.T) {
+		added, stats := startLidar(t, 10)
+		expected := make([]time.Time, 0, numReadings)
+		for i := 1; i <= numReadings; i++ {
+			expected = append(expected, at(i))
+		}
+		test.That(t, added, test.ShouldResemble, expected)
+		lidarStats := stats.ToMap()[LidarSensor].(map[string]interface{})
+		test.That(t, lidarStats["lock_errors"], test.ShouldEqual, int64(lockedReadings))
+		test.That(t, lidarStats["buffer_dropped"], test.ShouldEqual, int64(0))
+	})
+
+	t.Run("the oldest readings are dropped once the buffer is full", func(t *testing.T) {
+		// the readings until the lock is released and the first one after it don't fit into the buffer
+		const bufferSize = 3
+		added, stats := startLidar(t, bufferSize)
+		numDropped := lockedReadings + 1 - bufferSize
+		expected := make([]time.Time, 0, numReadings)
+		for i := numDropped + 1; i <= numReadings; i++ {
+			expected = append(expected, at(i))
+		}
+		test.That(t, added, test.ShouldResemble, expected)
+		lidarStats := stats.ToMap()[LidarSensor].(map[string]interface{})
+		test.That(t, lidarStats["buffer_dropped"], test.ShouldEqual, int64(numDropped))
+	})
+
+	t.Run("readings that fail for lock contention are skipped without a buffer", func(t *testing.T) {
+		added, stats := startLidar(t, 0)
+		test.That(t, added, test.ShouldHaveLength, numReadings-lockedReadings)
+		test.That(t, added[0], test.ShouldEqual, at(lockedReadings+1))
+		lidarStats := stats.ToMap()[LidarSensor].(map[string]interface{})
+		test.That(t, lidarStats["buffer_dropped"], test.ShouldEqual, int64(0))
+	})
+}
+
+func TestBufferedMovementSensorReadings(t *testing.T) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	at := func(i int) time.Time { return start.Add(time.Duration(i) * 50 * time.Millisecond) }
+	const numReadings = 10
+
+	injectMovementSensor := &inject.TimedMovementSensor{}
+	injectMovementSensor.NameFunc = func() string { return "imu_and_odometer" }
+	injectMovementSensor.DataFrequencyHzFunc = func() int { return 20 }
+	injectMovementSensor.PropertiesFunc = func() s.MovementSensorProperties {
+		return s.MovementSensorProperties{IMUSupported: true, OdometerSupported: true}
+	}
+
+	// the IMU and the odometer readings are buffered separately, so that the lock contention of one does not hold
+	// back the other
+	numAttempts := 0
+	var imuAdded, odometerAdded []time.Time
+	cf := &cartofacade.Mock{}
+	cf.AddIMUReadingFunc = func(
+		ctx context.Context, timeout time.Duration, movementSensorName string, currentReading s.TimedIMUReadingResponse,
+	) error {
+		if numAttempts <= 4 {
+			return cartofacade.ErrUnableToAcquireLock
+		}
+		imuAdded = append(imuAdded, currentReading.ReadingTime)
+		return nil
+	}
+	cf.AddOdometerReadingFunc = func(
+		ctx context.Context, timeout time.Duration, movementSensorName string, currentReading s.TimedOdometerReadingResponse,
+	) error {
+		if numAttempts <= 2 {
+			return cartofacade.ErrUnableToAcquireLock
+		}
+		odometerAdded = append(odometerAdded, currentReading.ReadingTime)
+		return nil
+	}
+	config := Config{
+		Logger:                   logging.NewTestLogger(t),
+		CartoFacade:              cf,
+		IsOnline:                 true,
+		MovementSensor:           injectMovementSensor,
+		MovementSensorBufferSize: 5,
+		SensorStats:              &SensorStats{IsOnline: true},
+		Timeout:                  10 * time.Second,
+	}
+
+	var expected []time.Time
+	for numAttempts = 1; numAttempts <= numReadings; numAttempts++ {
+		config.tryAddMovementSensorReadingOnce(context.Background(), s.TimedMovementSensorReadingResponse{
+			TimedIMUResponse: &s.TimedIMUReadingResponse{ReadingTime: at(numAttempts)},
+			TimedOdometerResponse: &s.TimedOdometerReadingResponse{
+				Position:    geo.NewPoint(0, 0),
+				Orientation: spatialmath.NewZeroOrientation(),
+				ReadingTime: at(numAttempts),
+			},
+		})
+		expected = append(expected, at(numAttempts))
+	}
+	test.That(t, imuAdded, test.ShouldResemble, expected)
+	test.That(t, odometerAdded, test.ShouldResemble, expected)
+
+	stats := config.SensorStats.ToMap()
+	test.That(t, stats[IMUSensor].(map[string]interface{})["lock_errors"], test.ShouldEqual, int64(4))
+	test.That(t, stats[OdometerSensor].(map[string]interface{})["lock_errors"], test.ShouldEqual, int64(2))
+	test.That(t, stats[IMUSensor].(map[string]interface{})["buffer_dropped"], test.ShouldEqual, int64(0))
+}
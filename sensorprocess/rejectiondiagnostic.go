@@ -0,0 +1,158 @@
+package sensorprocess
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+
+	"github.com/golang/geo/r3"
+	"go.viam.com/rdk/pointcloud"
+
+	s "github.com/viam-modules/viam-cartographer/sensors"
+)
+
+const (
+	// maxPlausibleCoordinate is the distance, in millimeters, from the lidar beyond which the coordinates of a
+	// rejected reading are reported as out of range. Readings written in millimeters instead of meters exceed it.
+	maxPlausibleCoordinate = 1e6
+	// maxDiagnosedHeaderLines bounds the number of lines of the PCD header of a rejected reading that are reported.
+	maxDiagnosedHeaderLines = 20
+)
+
+// RejectionDiagnostic diagnoses why cartographer rejects lidar readings, e.g. because they lack fields it needs
+// that the validation of the lidar does not check. Once NumRejections readings in a row have been rejected, the
+// last of them is parsed and its PCD header, number of points, coordinate ranges and the error returned by
+// cartographer are logged and kept as the diagnosis. This happens at most once per streak of rejections. The
+// streaks of every lidar are kept separately. It is safe for concurrent use.
+type RejectionDiagnostic struct {
+	// NumRejections is the number of consecutive rejected readings after which the last of them is diagnosed.
+	NumRejections int
+
+	mu sync.Mutex
+	// streaks holds the current streak of rejections of every lidar by name, so that the readings of one lidar
+	// that are accepted do not end the streak of another.
+	streaks   map[string]*rejectionStreak
+	diagnosis map[string]interface{}
+	// diagnosedLidar is the name of the lidar of the reading of the diagnosis.
+	diagnosedLidar string
+}
+
+// rejectionStreak is a streak of rejected readings of a lidar.
+type rejectionStreak struct {
+	numConsecutive int
+	// diagnosed denotes whether a reading of the streak has been diagnosed.
+	diagnosed bool
+}
+
+// addResult records whether cartographer accepted a reading of lidar, and diagnoses the reading if it is the
+// NumRejections-th rejected one of the lidar in a row. Returns the diagnosis if there is a new one.
+func (diag *RejectionDiagnostic) addResult(lidar string, reading []byte, err error) (map[string]interface{}, bool) {
+	diag.mu.Lock()
+	defer diag.mu.Unlock()
+	if diag.streaks == nil {
+		diag.streaks = map[string]*rejectionStreak{}
+	}
+	streak, ok := diag.streaks[lidar]
+	if !ok {
+		streak = &rejectionStreak{}
+		diag.streaks[lidar] = streak
+	}
+	if err == nil {
+		*streak = rejectionStreak{}
+		return nil, false
+	}
+	streak.numConsecutive++
+	if streak.diagnosed || streak.numConsecutive < max(diag.NumRejections, 1) {
+		return nil, false
+	}
+	streak.diagnosed = true
+	diag.diagnosedLidar = lidar
+	diag.diagnosis = diagnoseLidarReading(reading)
+	diag.diagnosis["lidar"] = lidar
+	diag.diagnosis["error"] = err.Error()
+	diag.diagnosis["consecutive_rejections"] = streak.numConsecutive
+	return diag.diagnosis, true
+}
+
+// ToMap returns the latest diagnosis along with whether the readings of its lidar are still being rejected as
+// rejecting, or nil if no reading has been diagnosed yet.
+func (diag *RejectionDiagnostic) ToMap() map[string]interface{} {
+	diag.mu.Lock()
+	defer diag.mu.Unlock()
+	if diag.diagnosis == nil {
+		return nil
+	}
+	resp := map[string]interface{}{"rejecting": diag.streaks[diag.diagnosedLidar].diagnosed}
+	for k, v := range diag.diagnosis {
+		resp[k] = v
+	}
+	return resp
+}
+
+// diagnoseLidarReading describes a PCD: its header, its number of points, the ranges of its coordinates in
+// millimeters and the problems found with it.
+func diagnoseLidarReading(reading []byte) map[string]interface{} {
+	diagnosis := map[string]interface{}{"header": pcdHeader(reading)}
+	problems := []string{}
+	defer func() {
+		diagnosis["problems"] = problems
+	}()
+
+	pc, err := s.ReadLidarReading(reading)
+	if err != nil {
+		problems = append(problems, fmt.Sprintf("the reading cannot be parsed as a pointcloud: %v", err))
+		return diagnosis
+	}
+	diagnosis["num_points"] = pc.Size()
+	if pc.Size() == 0 {
+		problems = append(problems, "the reading has no points")
+		return diagnosis
+	}
+
+	minPoint := r3.Vector{X: math.Inf(1), Y: math.Inf(1), Z: math.Inf(1)}
+	maxPoint := r3.Vector{X: math.Inf(-1), Y: math.Inf(-1), Z: math.Inf(-1)}
+	var numNonFinite, numOutOfRange int
+	pc.Iterate(0, 0, func(p r3.Vector, d pointcloud.Data) bool {
+		if math.IsNaN(p.X) || math.IsNaN(p.Y) || math.IsNaN(p.Z) ||
+			math.IsInf(p.X, 0) || math.IsInf(p.Y, 0) || math.IsInf(p.Z, 0) {
+			numNonFinite++
+			return true
+		}
+		if p.Norm() > maxPlausibleCoordinate {
+			numOutOfRange++
+		}
+		minPoint = r3.Vector{X: math.Min(minPoint.X, p.X), Y: math.Min(minPoint.Y, p.Y), Z: math.Min(minPoint.Z, p.Z)}
+		maxPoint = r3.Vector{X: math.Max(maxPoint.X, p.X), Y: math.Max(maxPoint.Y, p.Y), Z: math.Max(maxPoint.Z, p.Z)}
+		return true
+	})
+	if numNonFinite < pc.Size() {
+		diagnosis["min_mm"] = map[string]interface{}{"x": minPoint.X, "y": minPoint.Y, "z": minPoint.Z}
+		diagnosis["max_mm"] = map[string]interface{}{"x": maxPoint.X, "y": maxPoint.Y, "z": maxPoint.Z}
+	}
+	if numNonFinite > 0 {
+		problems = append(problems, fmt.Sprintf("%d points have non-finite coordinates", numNonFinite))
+	}
+	if numOutOfRange > 0 {
+		problems = append(problems, fmt.Sprintf("%d points are more than %vm from the lidar, "+
+			"the coordinates of the PCD must be in meters", numOutOfRange, maxPlausibleCoordinate/1000))
+	}
+	return diagnosis
+}
+
+// pcdHeader returns the lines of the header of a PCD up to and including its DATA line, at most
+// maxDiagnosedHeaderLines of them.
+func pcdHeader(reading []byte) []string {
+	header := []string{}
+	scanner := bufio.NewScanner(bytes.NewReader(reading))
+	for len(header) < maxDiagnosedHeaderLines && scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		header = append(header, line)
+		if strings.HasPrefix(line, "DATA") {
+			break
+		}
+	}
+	return header
+}
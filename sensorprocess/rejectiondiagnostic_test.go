@@ -0,0 +1,148 @@
+package sensorprocess
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang/geo/r3"
+	"go.viam.com/rdk/logging"
+	"go.viam.com/test"
+
+	"github.com/viam-modules/viam-cartographer/cartofacade"
+	s "github.com/viam-modules/viam-cartographer/sensors"
+	"github.com/viam-modules/viam-cartographer/sensors/inject"
+	"github.com/viam-modules/viam-cartographer/testhelper/pcdtest"
+)
+
+func TestRejectionDiagnostic(t *testing.T) {
+	logger, logs := logging.NewObservedTestLogger(t)
+
+	// a reading written in millimeters instead of meters
+	outOfRange := s.TimedLidarReadingResponse{
+		Reading:     pcdtest.PointsToPCD(t, []r3.Vector{{X: -2e6, Y: 1e6}, {X: 3e6, Y: -1e6, Z: 5e5}}),
+		ReadingTime: time.Now().UTC(),
+	}
+
+	errInvalid := errors.New("VIAM_CARTO_LIDAR_READING_INVALID")
+	var addErr error
+	cf := cartofacade.Mock{}
+	cf.AddLidarReadingFunc = func(
+		ctx context.Context,
+		timeout time.Duration,
+		sensorName string,
+		currentReading s.TimedLidarReadingResponse,
+	) error {
+		return addErr
+	}
+	injectLidar := inject.TimedLidar{}
+	injectLidar.NameFunc = func() string { return "good_lidar" }
+
+	diag := &RejectionDiagnostic{NumRejections: 3}
+	config := Config{
+		Logger:              logger,
+		CartoFacade:         &cf,
+		IsOnline:            true,
+		Lidar:               &injectLidar,
+		Timeout:             10 * time.Second,
+		RejectionDiagnostic: diag,
+	}
+	// readings that are not newer than the last one added are dropped
+	readingTime := outOfRange.ReadingTime
+	addLidarReading := func(reading s.TimedLidarReadingResponse) error {
+		readingTime = readingTime.Add(time.Second)
+		reading.ReadingTime = readingTime
+		return config.tryAddLidarReading(context.Background(), reading)
+	}
+	numDiagnoses := func() int {
+		return logs.FilterMessage("cartographer keeps rejecting lidar readings that passed validation").Len()
+	}
+
+	t.Run("readings are not diagnosed before enough are rejected in a row", func(t *testing.T) {
+		addErr = errInvalid
+		test.That(t, addLidarReading(outOfRange), test.ShouldBeError, errInvalid)
+		test.That(t, addLidarReading(outOfRange), test.ShouldBeError, errInvalid)
+		addErr = nil
+		test.That(t, addLidarReading(outOfRange), test.ShouldBeNil)
+		addErr = cartofacade.ErrUnableToAcquireLock
+		test.That(t, addLidarReading(outOfRange), test.ShouldBeError)
+		addErr = errInvalid
+		test.That(t, addLidarReading(outOfRange), test.ShouldBeError, errInvalid)
+		test.That(t, addLidarReading(outOfRange), test.ShouldBeError, errInvalid)
+		test.That(t, diag.ToMap(), test.ShouldBeNil)
+		test.That(t, numDiagnoses(), test.ShouldEqual, 0)
+	})
+
+	t.Run("the reading that completes a streak of rejections is diagnosed", func(t *testing.T) {
+		test.That(t, addLidarReading(outOfRange), test.ShouldBeError, errInvalid)
+		test.That(t, numDiagnoses(), test.ShouldEqual, 1)
+
+		diagnosis := diag.ToMap()
+		test.That(t, diagnosis["rejecting"], test.ShouldBeTrue)
+		test.That(t, diagnosis["error"], test.ShouldEqual, "VIAM_CARTO_LIDAR_READING_INVALID")
+		test.That(t, diagnosis["consecutive_rejections"], test.ShouldEqual, 3)
+		test.That(t, diagnosis["num_points"], test.ShouldEqual, 2)
+		test.That(t, diagnosis["header"], test.ShouldContain, "POINTS 2")
+		test.That(t, diagnosis["header"], test.ShouldContain, "DATA binary")
+		minMm := diagnosis["min_mm"].(map[string]interface{})
+		maxMm := diagnosis["max_mm"].(map[string]interface{})
+		test.That(t, minMm["x"], test.ShouldAlmostEqual, -2e6)
+		test.That(t, maxMm["x"], test.ShouldAlmostEqual, 3e6)
+		test.That(t, minMm["y"], test.ShouldAlmostEqual, -1e6)
+		test.That(t, maxMm["z"], test.ShouldAlmostEqual, 5e5)
+		test.That(t, diagnosis["problems"], test.ShouldResemble, []string{
+			"2 points are more than 1000m from the lidar, the coordinates of the PCD must be in meters",
+		})
+	})
+
+	t.Run("a streak of rejections is diagnosed only once", func(t *testing.T) {
+		for i := 0; i < 5; i++ {
+			test.That(t, addLidarReading(outOfRange), test.ShouldBeError, errInvalid)
+		}
+		test.That(t, numDiagnoses(), test.ShouldEqual, 1)
+		test.That(t, diag.ToMap()["consecutive_rejections"], test.ShouldEqual, 3)
+	})
+
+	t.Run("the diagnosis is kept once readings are accepted again", func(t *testing.T) {
+		addErr = nil
+		test.That(t, addLidarReading(outOfRange), test.ShouldBeNil)
+		test.That(t, diag.ToMap()["rejecting"], test.ShouldBeFalse)
+		test.That(t, diag.ToMap()["error"], test.ShouldEqual, "VIAM_CARTO_LIDAR_READING_INVALID")
+	})
+
+	t.Run("a new streak of rejections is diagnosed again", func(t *testing.T) {
+		addErr = errInvalid
+		for i := 0; i < 3; i++ {
+			test.That(t, addLidarReading(outOfRange), test.ShouldBeError, errInvalid)
+		}
+		test.That(t, numDiagnoses(), test.ShouldEqual, 2)
+		test.That(t, diag.ToMap()["rejecting"], test.ShouldBeTrue)
+	})
+
+	t.Run("the readings of another lidar that are accepted do not end a streak", func(t *testing.T) {
+		otherLidar := inject.TimedLidar{}
+		otherLidar.NameFunc = func() string { return "other_lidar" }
+		otherConfig := config
+		otherConfig.Lidar = &otherLidar
+		addErr = nil
+		reading := outOfRange
+		reading.ReadingTime = readingTime.Add(time.Second)
+		test.That(t, otherConfig.tryAddLidarReading(context.Background(), reading), test.ShouldBeNil)
+		test.That(t, diag.ToMap()["rejecting"], test.ShouldBeTrue)
+		test.That(t, diag.ToMap()["lidar"], test.ShouldEqual, "good_lidar")
+
+		addErr = errInvalid
+		test.That(t, addLidarReading(outOfRange), test.ShouldBeError, errInvalid)
+		test.That(t, numDiagnoses(), test.ShouldEqual, 2)
+	})
+
+	t.Run("readings that cannot be parsed are diagnosed", func(t *testing.T) {
+		diagnosis := diagnoseLidarReading([]byte("VERSION .7\nFIELDS x y z\nDATA ascii\n1 2\n"))
+		test.That(t, diagnosis["header"], test.ShouldResemble, []string{"VERSION .7", "FIELDS x y z", "DATA ascii"})
+		test.That(t, diagnosis, test.ShouldNotContainKey, "num_points")
+		problems := diagnosis["problems"].([]string)
+		test.That(t, len(problems), test.ShouldEqual, 1)
+		test.That(t, problems[0], test.ShouldStartWith, "the reading cannot be parsed as a pointcloud")
+	})
+}
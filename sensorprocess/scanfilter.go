@@ -0,0 +1,86 @@
+package sensorprocess
+
+import (
+	"sync/atomic"
+	"time"
+
+	s "github.com/viam-modules/viam-cartographer/sensors"
+)
+
+// degenerateScanWarningInterval is the minimum time between two warnings about dropped lidar readings.
+const degenerateScanWarningInterval = 10 * time.Second
+
+// ScanFilter drops lidar readings that have too few usable points to be matched against the map, e.g. because
+// the lidar is covered or facing a wall closer than the min range.
+type ScanFilter struct {
+	// MinPointsPerScan is the number of usable points a reading needs to be added to cartographer.
+	// Zero disables the filter.
+	MinPointsPerScan int
+	// MinRange is the distance, in meters, below which points are not usable.
+	MinRange float64
+
+	droppedCount atomic.Int64
+	// lastWarned is the time of the last warning in unix nanoseconds. It is atomic like droppedCount, as the
+	// filter is shared by pointer between the copies of a config.
+	lastWarned atomic.Int64
+	// total, if set, is the filter of the first lidar, which the readings this one drops are also counted in.
+	total *ScanFilter
+}
+
+// DroppedCount returns the number of lidar readings that were dropped because they had too few usable points,
+// including those of the additional lidars.
+func (filter *ScanFilter) DroppedCount() int64 {
+	return filter.droppedCount.Load()
+}
+
+// forLidar returns a filter of the same settings for an additional lidar, which warns about the readings it drops
+// on its own and counts them in the total of this filter.
+func (filter *ScanFilter) forLidar() *ScanFilter {
+	return &ScanFilter{MinPointsPerScan: filter.MinPointsPerScan, MinRange: filter.MinRange, total: filter}
+}
+
+// isDegenerateLidarReading returns whether the reading has fewer usable points than required by the scan filter,
+// in which case it is counted and should not be added. Without a scan filter, readings without points are skipped
+// instead, as lidars may return them e.g. during a blind interval and cartographer rejects them. Readings whose
+// points cannot be counted are not dropped.
+func (config *Config) isDegenerateLidarReading(reading s.TimedLidarReadingResponse) bool {
+	filter := config.ScanFilter
+	if filter == nil || filter.MinPointsPerScan <= 0 {
+		return config.isEmptyLidarReading(reading)
+	}
+
+	numUsable, err := s.NumUsablePoints(reading.Reading, filter.MinRange)
+	if err != nil {
+		config.Logger.Warnw("Adding lidar reading without checking its number of points", "error", err)
+		return false
+	}
+	if numUsable >= filter.MinPointsPerScan {
+		return false
+	}
+
+	count := filter.droppedCount.Add(1)
+	if filter.total != nil {
+		count = filter.total.droppedCount.Add(1)
+	}
+	now := time.Now().UnixNano()
+	last := filter.lastWarned.Load()
+	if time.Duration(now-last) >= degenerateScanWarningInterval && filter.lastWarned.CompareAndSwap(last, now) {
+		config.Logger.Warnw("dropping lidar reading with too few usable points",
+			"lidar", config.Lidar.Name(), "reading_time", reading.ReadingTime, "usable_points", numUsable,
+			"min_points_per_scan", filter.MinPointsPerScan, "total_dropped", count)
+	}
+	return true
+}
+
+// isEmptyLidarReading returns whether the reading is a valid pointcloud without points, in which case it is counted.
+func (config *Config) isEmptyLidarReading(reading s.TimedLidarReadingResponse) bool {
+	numPoints, err := s.NumPoints(reading.Reading)
+	if err != nil || numPoints > 0 {
+		return false
+	}
+	if config.EmptyLidarReadings != nil {
+		config.EmptyLidarReadings.Add(1)
+	}
+	config.Logger.Debugf("Skipping lidar reading at %v without points", reading.ReadingTime)
+	return true
+}
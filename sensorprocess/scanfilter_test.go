@@ -0,0 +1,289 @@
+package sensorprocess
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang/geo/r3"
+	"go.viam.com/rdk/components/camera/replaypcd"
+	"go.viam.com/rdk/components/movementsensor/replay"
+	"go.viam.com/rdk/logging"
+	"go.viam.com/test"
+
+	"github.com/viam-modules/viam-cartographer/cartofacade"
+	s "github.com/viam-modules/viam-cartographer/sensors"
+	"github.com/viam-modules/viam-cartographer/sensors/inject"
+	"github.com/viam-modules/viam-cartographer/testhelper/pcdtest"
+)
+
+// makeScan returns a PCD with numPoints points, at least 1m away from the lidar.
+func makeScan(t *testing.T, numPoints int) []byte {
+	t.Helper()
+	points := make([]r3.Vector, numPoints)
+	for i := range points {
+		points[i] = r3.Vector{X: 1000, Y: 1000 * float64(i)}
+	}
+	return pcdtest.PointsToPCD(t, points)
+}
+
+func TestIsDegenerateLidarReading(t *testing.T) {
+	logger := logging.NewTestLogger(t)
+	injectLidar := inject.TimedLidar{}
+	injectLidar.NameFunc = func() string { return "good_lidar" }
+
+	filter := &ScanFilter{MinPointsPerScan: 3, MinRange: 0.2}
+	config := Config{
+		Logger:     logger,
+		Lidar:      &injectLidar,
+		ScanFilter: filter,
+	}
+
+	emptyReading := s.TimedLidarReadingResponse{Reading: makeScan(t, 0), ReadingTime: time.Now().UTC()}
+	justBelowReading := s.TimedLidarReadingResponse{Reading: makeScan(t, 2), ReadingTime: time.Now().UTC()}
+	normalReading := s.TimedLidarReadingResponse{Reading: makeScan(t, 3), ReadingTime: time.Now().UTC()}
+
+	t.Run("empty scan is dropped", func(t *testing.T) {
+		test.That(t, config.isDegenerateLidarReading(emptyReading), test.ShouldBeTrue)
+		test.That(t, filter.DroppedCount(), test.ShouldEqual, 1)
+	})
+
+	t.Run("scan just below the threshold is dropped", func(t *testing.T) {
+		test.That(t, config.isDegenerateLidarReading(justBelowReading), test.ShouldBeTrue)
+		test.That(t, filter.DroppedCount(), test.ShouldEqual, 2)
+	})
+
+	t.Run("normal scan is kept", func(t *testing.T) {
+		test.That(t, config.isDegenerateLidarReading(normalReading), test.ShouldBeFalse)
+		test.That(t, filter.DroppedCount(), test.ShouldEqual, 2)
+	})
+
+	t.Run("points closer than the min range do not count", func(t *testing.T) {
+		closeFilter := &ScanFilter{MinPointsPerScan: 3, MinRange: 2}
+		closeConfig := config
+		closeConfig.ScanFilter = closeFilter
+		test.That(t, closeConfig.isDegenerateLidarReading(normalReading), test.ShouldBeTrue)
+		test.That(t, closeFilter.DroppedCount(), test.ShouldEqual, 1)
+	})
+
+	t.Run("threshold of zero disables the filter", func(t *testing.T) {
+		disabledConfig := config
+		disabledConfig.ScanFilter = &ScanFilter{}
+		test.That(t, disabledConfig.isDegenerateLidarReading(justBelowReading), test.ShouldBeFalse)
+		test.That(t, disabledConfig.ScanFilter.DroppedCount(), test.ShouldEqual, 0)
+
+		disabledConfig.ScanFilter = nil
+		test.That(t, disabledConfig.isDegenerateLidarReading(justBelowReading), test.ShouldBeFalse)
+	})
+
+	t.Run("empty scan is skipped without the filter", func(t *testing.T) {
+		var emptyReadings atomic.Int64
+		disabledConfig := config
+		disabledConfig.EmptyLidarReadings = &emptyReadings
+		for _, disabledFilter := range []*ScanFilter{{}, nil} {
+			disabledConfig.ScanFilter = disabledFilter
+			test.That(t, disabledConfig.isDegenerateLidarReading(emptyReading), test.ShouldBeTrue)
+		}
+		test.That(t, emptyReadings.Load(), test.ShouldEqual, 2)
+
+		invalidReading := s.TimedLidarReadingResponse{Reading: []byte("not a pcd"), ReadingTime: time.Now().UTC()}
+		test.That(t, disabledConfig.isDegenerateLidarReading(invalidReading), test.ShouldBeFalse)
+		test.That(t, emptyReadings.Load(), test.ShouldEqual, 2)
+	})
+
+	t.Run("reading that can not be parsed is kept", func(t *testing.T) {
+		invalidReading := s.TimedLidarReadingResponse{Reading: []byte("not a pcd"), ReadingTime: time.Now().UTC()}
+		test.That(t, config.isDegenerateLidarReading(invalidReading), test.ShouldBeFalse)
+		test.That(t, filter.DroppedCount(), test.ShouldEqual, 2)
+	})
+}
+
+func TestOfflineSensorProcessSkipsDegenerateLidarReadings(t *testing.T) {
+	logger := logging.NewTestLogger(t)
+	now := time.Now().UTC()
+
+	cases := []struct {
+		description            string
+		lidarReadingTimeMs     []int
+		lidarNumPoints         []int
+		imuReadingTimeMs       []int
+		expectedDataInsertions []string
+	}{
+		{
+			description:            "dropped readings do not change the order of the remaining readings",
+			lidarReadingTimeMs:     []int{1, 3, 5, 7},
+			lidarNumPoints:         []int{3, 2, 0, 3},
+			imuReadingTimeMs:       []int{2, 4, 6, 8, 10},
+			expectedDataInsertions: []string{"lidar: 1", "imu: 2", "imu: 4", "imu: 6", "lidar: 7"},
+		},
+		{
+			description:            "movement sensor data is skipped until the first lidar reading that is not dropped",
+			lidarReadingTimeMs:     []int{1, 3, 5, 7},
+			lidarNumPoints:         []int{0, 2, 3, 3},
+			imuReadingTimeMs:       []int{2, 4, 6, 8},
+			expectedDataInsertions: []string{"lidar: 5", "imu: 6", "lidar: 7"},
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.description, func(t *testing.T) {
+			injectLidar := inject.TimedLidar{}
+			injectLidar.NameFunc = func() string { return "good_lidar" }
+			injectLidar.DataFrequencyHzFunc = func() int { return 0 }
+			numLidarData := 0
+			injectLidar.TimedLidarReadingFunc = func(ctx context.Context) (s.TimedLidarReadingResponse, error) {
+				if numLidarData >= len(tt.lidarReadingTimeMs) {
+					return s.TimedLidarReadingResponse{}, replaypcd.ErrEndOfDataset
+				}
+				reading := s.TimedLidarReadingResponse{
+					Reading:     makeScan(t, tt.lidarNumPoints[numLidarData]),
+					ReadingTime: now.Add(time.Duration(tt.lidarReadingTimeMs[numLidarData]) * time.Millisecond),
+				}
+				numLidarData++
+				return reading, nil
+			}
+
+			injectMovementSensor := inject.TimedMovementSensor{}
+			injectMovementSensor.NameFunc = func() string { return "good_movement_sensor" }
+			injectMovementSensor.DataFrequencyHzFunc = func() int { return 0 }
+			injectMovementSensor.PropertiesFunc = func() s.MovementSensorProperties {
+				return s.MovementSensorProperties{IMUSupported: true}
+			}
+			numIMUData := 0
+			injectMovementSensor.TimedMovementSensorReadingFunc = func(ctx context.Context) (s.TimedMovementSensorReadingResponse, error) {
+				if numIMUData >= len(tt.imuReadingTimeMs) {
+					return s.TimedMovementSensorReadingResponse{}, replay.ErrEndOfDataset
+				}
+				reading := s.TimedMovementSensorReadingResponse{
+					TimedIMUResponse: &s.TimedIMUReadingResponse{
+						ReadingTime: now.Add(time.Duration(tt.imuReadingTimeMs[numIMUData]) * time.Millisecond),
+					},
+				}
+				numIMUData++
+				return reading, nil
+			}
+
+			actualDataInsertions := []string{}
+			cf := cartofacade.Mock{}
+			cf.AddLidarReadingFunc = func(ctx context.Context, timeout time.Duration,
+				lidarName string, currentReading s.TimedLidarReadingResponse,
+			) error {
+				actualDataInsertions = append(actualDataInsertions,
+					"lidar: "+strconv.Itoa(int(currentReading.ReadingTime.Sub(now).Milliseconds())))
+				return nil
+			}
+			cf.AddIMUReadingFunc = func(ctx context.Context, timeout time.Duration,
+				imuName string, currentReading s.TimedIMUReadingResponse,
+			) error {
+				actualDataInsertions = append(actualDataInsertions,
+					"imu: "+strconv.Itoa(int(currentReading.ReadingTime.Sub(now).Milliseconds())))
+				return nil
+			}
+			cf.RunFinalOptimizationFunc = func(context.Context, time.Duration) error {
+				return nil
+			}
+
+			filter := &ScanFilter{MinPointsPerScan: 3}
+			config := Config{
+				Logger:         logger,
+				CartoFacade:    &cf,
+				Lidar:          &injectLidar,
+				MovementSensor: &injectMovementSensor,
+				ScanFilter:     filter,
+				Timeout:        10 * time.Second,
+			}
+
+			endOfDataSetReached := config.StartOfflineSensorProcess(context.Background()).JobDone
+			test.That(t, endOfDataSetReached, test.ShouldBeTrue)
+			test.That(t, actualDataInsertions, test.ShouldResemble, tt.expectedDataInsertions)
+			test.That(t, filter.DroppedCount(), test.ShouldEqual, 2)
+		})
+	}
+}
+
+func TestEmptyLidarReadingsAreSkipped(t *testing.T) {
+	now := time.Now().UTC()
+	const numReadings = 6
+
+	// the lidar alternates between empty and populated readings, starting with an empty one
+	newLidar := func() *inject.TimedLidar {
+		injectLidar := &inject.TimedLidar{}
+		injectLidar.NameFunc = func() string { return "good_lidar" }
+		numLidarData := 0
+		injectLidar.TimedLidarReadingFunc = func(ctx context.Context) (s.TimedLidarReadingResponse, error) {
+			if numLidarData >= numReadings {
+				return s.TimedLidarReadingResponse{}, replaypcd.ErrEndOfDataset
+			}
+			reading := s.TimedLidarReadingResponse{
+				Reading:     makeScan(t, 3*(numLidarData%2)),
+				ReadingTime: now.Add(time.Duration(numLidarData) * time.Millisecond),
+			}
+			numLidarData++
+			return reading, nil
+		}
+		return injectLidar
+	}
+
+	newCartoFacade := func(addedReadingTimesMs *[]int) *cartofacade.Mock {
+		cf := &cartofacade.Mock{}
+		cf.AddLidarReadingFunc = func(ctx context.Context, timeout time.Duration,
+			lidarName string, currentReading s.TimedLidarReadingResponse,
+		) error {
+			if numPoints, err := s.NumPoints(currentReading.Reading); err != nil || numPoints == 0 {
+				return errors.New("VIAM_CARTO_LIDAR_READING_EMPTY")
+			}
+			*addedReadingTimesMs = append(*addedReadingTimesMs, int(currentReading.ReadingTime.Sub(now).Milliseconds()))
+			return nil
+		}
+		cf.RunFinalOptimizationFunc = func(context.Context, time.Duration) error {
+			return nil
+		}
+		return cf
+	}
+
+	t.Run("online", func(t *testing.T) {
+		logger, obs := logging.NewObservedTestLogger(t)
+		injectLidar := newLidar()
+		injectLidar.DataFrequencyHzFunc = func() int { return 1000 }
+		var addedReadingTimesMs []int
+		var emptyReadings atomic.Int64
+		config := Config{
+			Logger:             logger,
+			CartoFacade:        newCartoFacade(&addedReadingTimesMs),
+			IsOnline:           true,
+			Lidar:              injectLidar,
+			EmptyLidarReadings: &emptyReadings,
+			Timeout:            10 * time.Second,
+		}
+
+		for i := 0; i < numReadings; i++ {
+			test.That(t, config.addLidarReadingInOnline(context.Background()), test.ShouldBeNil)
+		}
+		test.That(t, addedReadingTimesMs, test.ShouldResemble, []int{1, 3, 5})
+		test.That(t, emptyReadings.Load(), test.ShouldEqual, 3)
+		test.That(t, obs.FilterMessageSnippet("error from cartofacade").Len(), test.ShouldEqual, 0)
+	})
+
+	t.Run("offline", func(t *testing.T) {
+		logger, obs := logging.NewObservedTestLogger(t)
+		injectLidar := newLidar()
+		injectLidar.DataFrequencyHzFunc = func() int { return 0 }
+		var addedReadingTimesMs []int
+		var emptyReadings atomic.Int64
+		config := Config{
+			Logger:             logger,
+			CartoFacade:        newCartoFacade(&addedReadingTimesMs),
+			Lidar:              injectLidar,
+			EmptyLidarReadings: &emptyReadings,
+			Timeout:            10 * time.Second,
+		}
+
+		test.That(t, config.StartOfflineSensorProcess(context.Background()).JobDone, test.ShouldBeTrue)
+		test.That(t, addedReadingTimesMs, test.ShouldResemble, []int{1, 3, 5})
+		test.That(t, emptyReadings.Load(), test.ShouldEqual, 3)
+		test.That(t, obs.FilterMessageSnippet("error from cartofacade").Len(), test.ShouldEqual, 0)
+	})
+}
@@ -4,13 +4,16 @@ package sensorprocess
 import (
 	"context"
 	"errors"
+	"fmt"
 	"sort"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"go.viam.com/rdk/components/camera/replaypcd"
 	replaymovementsensor "go.viam.com/rdk/components/movementsensor/replay"
 	"go.viam.com/rdk/logging"
+	"go.viam.com/rdk/spatialmath"
 
 	"github.com/viam-modules/viam-cartographer/cartofacade"
 	s "github.com/viam-modules/viam-cartographer/sensors"
@@ -23,22 +26,194 @@ const (
 	movementSensor
 )
 
+// ErrMixedClockDomains denotes that the reading times of the lidar and the movement sensor are taken from
+// different clocks, see s.ErrMixedClockDomains.
+var ErrMixedClockDomains = s.ErrMixedClockDomains
+
+// ErrSensorSkew denotes that the reading time of a movement sensor reading is further from that of the most recent
+// lidar reading than the max sensor skew, e.g. as the clock of a replay sensor drifted.
+var ErrSensorSkew = errors.New("the movement sensor reading is too far from the most recent lidar reading")
+
+// skewWarningInterval is the minimum time between two warnings about movement sensor readings dropped for their
+// skew from the lidar readings.
+const skewWarningInterval = 10 * time.Second
+
+// errReadingSkipped denotes that a reading was skipped in offline mode as cartographer kept rejecting it.
+var errReadingSkipped = errors.New("reading skipped after cartographer kept rejecting it")
+
+// errReadingOutOfOrder denotes that a reading was dropped rather than added to the cartofacade, as its reading time
+// is not after that of the last reading of its sensor that was added, which cartographer would reject.
+var errReadingOutOfOrder = errors.New("reading dropped as it is not newer than the last reading added")
+
 type offlineSensorReadingTime struct {
-	sensorType  sensorType
+	sensorType sensorType
+	// lidarIndex is the index of the lidar among the configs returned by LidarConfigs, for lidar readings.
+	lidarIndex  int
 	readingTime time.Time
 }
 
+// PosePublisher publishes the poses cartographer localized the lidar readings added to it at.
+type PosePublisher interface {
+	// HasSubscribers returns whether a published pose would be received by anyone, so that the pose is not
+	// requested from cartographer otherwise.
+	HasSubscribers() bool
+	// PublishPose publishes pos, which cartographer localized the lidar reading taken at readingTime at, as of now.
+	PublishPose(pos cartofacade.Position, readingTime, now time.Time)
+}
+
 // Config holds config needed throughout the process of adding a sensor reading to the cartofacade.
 type Config struct {
 	CartoFacade cartofacade.Interface
 	IsOnline    bool
 
-	Lidar          s.TimedLidar
-	MovementSensor s.TimedMovementSensor
+	Lidar s.TimedLidar
+	// AdditionalLidars are lidars whose readings are added to cartographer along with those of Lidar, under their
+	// own names. In offline mode their readings are merged with the others by their time stamps.
+	AdditionalLidars []s.TimedLidar
+	MovementSensor   s.TimedMovementSensor
+	// MappingBounds, if set, holds the region lidar readings are clipped to. It may be changed at any time
+	// and applies to all readings that are added afterwards.
+	MappingBounds *atomic.Pointer[s.MappingBounds]
+	// OdometerOrigin, if set, is set to the geo pose of the first odometer reading that was added to cartographer,
+	// which is where the map frame is anchored.
+	OdometerOrigin *atomic.Pointer[spatialmath.GeoPose]
+	// SessionClock, if set, rebases the times of all readings added to cartographer to a session relative epoch.
+	SessionClock *SessionClock
+	// ScanFilter, if set, drops lidar readings with too few usable points before they are added to cartographer.
+	ScanFilter *ScanFilter
+	// EmptyLidarReadings, if set, counts the lidar readings that were skipped for having no points while ScanFilter
+	// is disabled. Otherwise they are dropped by ScanFilter.
+	EmptyLidarReadings *atomic.Int64
+	// AddedLidarReadings, if set, counts the lidar readings that were added to CartoFacade.
+	AddedLidarReadings *atomic.Int64
+	// AddedIMUReadings and AddedOdometerReadings, if set, count the IMU and odometer readings that were added to
+	// CartoFacade.
+	AddedIMUReadings      *atomic.Int64
+	AddedOdometerReadings *atomic.Int64
+	// PosePublisher, if set, is published the pose cartographer localized every lidar reading that was added to
+	// CartoFacade at, while it has subscribers, so that they receive poses at the data frequency of the lidars.
+	PosePublisher PosePublisher
+	// ChangeDetector, if set, compares every lidar reading that was added to CartoFacade against the map.
+	ChangeDetector *ChangeDetector
+	// MapOverlap, if set, estimates how much of every lidar reading that was added to CartoFacade overlaps the
+	// existing map.
+	MapOverlap *MapOverlap
+	// RejectionDiagnostic, if set, diagnoses the lidar readings CartoFacade keeps rejecting.
+	RejectionDiagnostic *RejectionDiagnostic
+	// ShadowMirror, if set, submits every reading that was added to CartoFacade to a shadow cartofacade, to compare
+	// an alternative algo config side by side.
+	ShadowMirror *ShadowMirror
+	// IngestionLatency, if set, records the time from the reading time of every reading added to the cartofacade
+	// to its acceptance.
+	IngestionLatency *IngestionLatency
+	// JobSummary, if set, records the progress of the offline sensor process.
+	JobSummary *JobSummary
+	// SensorStats, if set, counts the attempts to add the readings of every sensor to CartoFacade and their
+	// outcomes.
+	SensorStats *SensorStats
+	// RunFinalOptimizationOnCancel runs the final optimization when the offline sensor process is cancelled.
+	RunFinalOptimizationOnCancel bool
+	// MaxJobDuration, if not zero, is how long the offline sensor process may add readings before it stops and
+	// finishes the job as if it had reached the end of a dataset.
+	MaxJobDuration time.Duration
+	// SkipFinalOptimization skips the final optimization once the end of a dataset is reached.
+	SkipFinalOptimization bool
+	// MaxConsecutiveLidarFailures is the number of consecutive lidar readings that may fail in offline mode, e.g.
+	// for corrupt or missing files of the dataset, before the offline sensor process gives up. Failed readings are
+	// skipped and counted in JobSummary.
+	MaxConsecutiveLidarFailures int
+	// AdditionalLidarReadingTimeout, if not zero, is how long the offline sensor process waits for the next reading
+	// of an additional lidar before it continues without the lidar, so that a stalled lidar does not stall the
+	// readings of the others.
+	AdditionalLidarReadingTimeout time.Duration
+	// MaxRejectedReadingRetries is the number of times a reading that cartographer rejects for its contents, e.g.
+	// one corrupt frame of a dataset, is added again in offline mode before it is skipped and counted in
+	// JobSummary. Readings that fail for lock contention are retried indefinitely.
+	MaxRejectedReadingRetries int
+	// LidarResolver, if set, resolves the camera of Lidar again in online mode once LidarReconnectFailures
+	// readings in a row failed because it is unavailable, e.g. because it crashed and was rebuilt, leaving Lidar
+	// with a closed handle. It should resolve from the live dependency graph, as the dependencies the service was
+	// constructed with still hold the closed handle. Lidar must be a s.RefreshableLidar.
+	LidarResolver          s.ResourceResolver
+	LidarReconnectFailures int
+	// VelocityIntegrator integrates the velocity readings of a movement sensor whose properties have
+	// VelocitySupported set into the odometer readings that are added to cartographer. It is created on the first
+	// velocity reading if it is not set.
+	VelocityIntegrator *cartofacade.VelocityIntegrator
+	// AllowMixedClockDomains lets the offline sensor process combine a lidar and a movement sensor of different
+	// clock domains, whose first readings otherwise make it fail with ErrMixedClockDomains.
+	AllowMixedClockDomains bool
+	// MaxSensorSkew, if not zero, is how far the reading time of a movement sensor reading may be from that of the
+	// most recent reading of Lidar. Online, movement sensor readings past it are dropped with a warning. Offline,
+	// the sensor process fails with ErrSensorSkew.
+	MaxSensorSkew time.Duration
+	// LastLidarReadingTime, if set, holds the reading time in unix nanoseconds of the most recent reading of Lidar
+	// that was attempted to be added to CartoFacade, which MaxSensorSkew is checked against online.
+	LastLidarReadingTime *atomic.Int64
+	// LidarBufferSize, if not zero, is the number of lidar readings that are kept online when adding them fails
+	// because the lock of CartoFacade is held, to be added again, oldest first, before the next reading. Once the
+	// buffer is full, its oldest reading is dropped and counted in SensorStats. Without it, such readings are
+	// skipped.
+	LidarBufferSize int
+	// MovementSensorBufferSize is LidarBufferSize for the IMU and the odometer readings of MovementSensor, which
+	// are buffered separately from each other.
+	MovementSensorBufferSize int
+	// Heartbeat, if set, is called every time the sensor process moves on to the next reading, so that a sensor
+	// process that is stuck can be told apart from one that is idle.
+	Heartbeat func()
+	// ConvertUnsupportedPCD converts lidar readings cartographer cannot read, e.g. organized pointclouds, with
+	// s.SupportedPCD, rather than skipping them with an error.
+	ConvertUnsupportedPCD bool
 
 	Timeout         time.Duration
 	InternalTimeout time.Duration
 	Logger          logging.Logger
+
+	// the buffers of LidarBufferSize and MovementSensorBufferSize, which are created on the first reading that is
+	// added with them
+	lidarBuffer    *readingBuffer[s.TimedLidarReadingResponse]
+	imuBuffer      *readingBuffer[s.TimedIMUReadingResponse]
+	odometerBuffer *readingBuffer[s.TimedOdometerReadingResponse]
+	// additionalLidar denotes that Lidar is one of the AdditionalLidars of the config this one was copied from
+	additionalLidar bool
+	// the reading times of the last readings of Lidar, and of the IMU and the odometer of MovementSensor, that
+	// were added, which the reading times of the next ones must be after
+	lastAddedLidarReadingTime    time.Time
+	lastAddedIMUReadingTime      time.Time
+	lastAddedOdometerReadingTime time.Time
+	// the time of the last warning about movement sensor readings dropped for their skew, and the number of
+	// readings dropped since
+	lastSkewWarning       time.Time
+	numSkewedSinceWarning int
+}
+
+// LidarConfigs returns a config per lidar, that of Lidar first, which add the readings of their lidar. They
+// are copies of the config, that share all of its helpers, except that every lidar has its own scan filter and
+// keeps its own rejection streaks and sensor stats. In online mode StartLidar is run on each of them.
+func (config *Config) LidarConfigs() []*Config {
+	configs := []*Config{config}
+	for _, timedLidar := range config.AdditionalLidars {
+		lidarConfig := *config
+		lidarConfig.Lidar = timedLidar
+		lidarConfig.AdditionalLidars = nil
+		lidarConfig.additionalLidar = true
+		if config.ScanFilter != nil {
+			lidarConfig.ScanFilter = config.ScanFilter.forLidar()
+		}
+		// the skew of the movement sensor is only checked against the readings of the first lidar
+		lidarConfig.LastLidarReadingTime = nil
+		lidarConfig.lidarBuffer = nil
+		lidarConfig.lastAddedLidarReadingTime = time.Time{}
+		configs = append(configs, &lidarConfig)
+	}
+	return configs
+}
+
+// heartbeat calls Heartbeat if it is set.
+func (config *Config) heartbeat() {
+	if config.Heartbeat != nil {
+		config.Heartbeat()
+	}
 }
 
 // getInitialMovementSensorReading gets the initial movement sensor reading.
@@ -50,8 +225,8 @@ func (config *Config) getInitialMovementSensorReading(ctx context.Context,
 		!config.MovementSensor.Properties().OdometerSupported) {
 		return s.TimedMovementSensorReadingResponse{}, errors.New("movement sensor is not supported")
 	}
-	for {
-		movementSensorReading, err := config.MovementSensor.TimedMovementSensorReading(ctx)
+	for first := true; ; first = false {
+		movementSensorReading, err := config.nextMovementSensorReading(ctx)
 		if err != nil {
 			return s.TimedMovementSensorReadingResponse{}, err
 		}
@@ -66,21 +241,117 @@ func (config *Config) getInitialMovementSensorReading(ctx context.Context,
 			readingTime = movementSensorReading.TimedIMUResponse.ReadingTime
 		}
 
+		// readings of different clock domains would be discarded until the end of the dataset or forever
+		if first {
+			if err := config.checkClockDomains(lidarReading, movementSensorReading, readingTime); err != nil {
+				return s.TimedMovementSensorReadingResponse{}, err
+			}
+		}
+
 		if !readingTime.Before(lidarReading.ReadingTime) {
 			return movementSensorReading, nil
 		}
 	}
 }
 
+// checkClockDomains returns an error naming both sensors and the times of their first readings if the first
+// lidar and movement sensor readings are of different clock domains, unless AllowMixedClockDomains is set.
+func (config *Config) checkClockDomains(
+	lidarReading s.TimedLidarReadingResponse,
+	movementSensorReading s.TimedMovementSensorReadingResponse,
+	movementSensorReadingTime time.Time,
+) error {
+	err := s.MixedClockDomainsError(config.Lidar.Name(), lidarReading,
+		config.MovementSensor.Name(), movementSensorReading, movementSensorReadingTime)
+	if err == nil {
+		return nil
+	}
+	if !config.AllowMixedClockDomains {
+		return fmt.Errorf("%w, set allow_mixed_clock_domains to combine them anyway", err)
+	}
+	config.Logger.Warnw("combining sensors of different clock domains as allow_mixed_clock_domains is set", "error", err)
+	return nil
+}
+
+// checkSensorSkew returns an error wrapping ErrSensorSkew that names both sensors and their reading times if the
+// reading time of a movement sensor reading is further than MaxSensorSkew from that of the most recent reading of
+// Lidar. It is disabled if MaxSensorSkew is zero or there was no lidar reading yet.
+func (config *Config) checkSensorSkew(lidarReadingTime, movementSensorReadingTime time.Time) error {
+	if config.MaxSensorSkew <= 0 || lidarReadingTime.IsZero() {
+		return nil
+	}
+	skew := movementSensorReadingTime.Sub(lidarReadingTime).Abs()
+	if skew <= config.MaxSensorSkew {
+		return nil
+	}
+	return fmt.Errorf("%w: movement sensor %q has a reading at %s, %s from the reading of lidar %q at %s, "+
+		"which is more than max_sensor_skew_ms of %d", ErrSensorSkew,
+		config.MovementSensor.Name(), movementSensorReadingTime.UTC().Format(time.RFC3339Nano), skew,
+		config.Lidar.Name(), lidarReadingTime.UTC().Format(time.RFC3339Nano), config.MaxSensorSkew.Milliseconds())
+}
+
+// warnSkewedReading warns that a movement sensor reading is dropped for its skew err from the lidar readings at
+// most once every skewWarningInterval, along with the number of readings dropped since the previous warning, so
+// that a drifting clock does not log every reading of the movement sensor.
+func (config *Config) warnSkewedReading(err error) {
+	config.numSkewedSinceWarning++
+	now := time.Now()
+	if now.Sub(config.lastSkewWarning) < skewWarningInterval {
+		return
+	}
+	config.Logger.Warnw("Skipping movement sensor reading due to its skew from the lidar readings", "error", err,
+		"num_skipped_since_last_warning", config.numSkewedSinceWarning)
+	config.lastSkewWarning = now
+	config.numSkewedSinceWarning = 0
+}
+
+// movementSensorReadingTime returns the reading time of a movement sensor reading, which is that of its IMU
+// reading if the movement sensor supports an IMU, as it is taken last, and that of its odometer reading otherwise.
+func (config *Config) movementSensorReadingTime(reading s.TimedMovementSensorReadingResponse) time.Time {
+	if config.MovementSensor.Properties().IMUSupported {
+		return reading.TimedIMUResponse.ReadingTime
+	}
+	return reading.TimedOdometerResponse.ReadingTime
+}
+
 // StartOfflineSensorProcess starts the process of adding lidar and movement sensor data
-// in a deterministically defined order to cartographer. Returns a bool that indicates
-// whether or not the end of either the lidar or movement sensor datasets have been reached.
-func (config *Config) StartOfflineSensorProcess(ctx context.Context) bool {
+// in a deterministically defined order to cartographer. Returns a result that indicates
+// whether or not the end of either the lidar or movement sensor datasets have been reached, and why
+// the process finished. If the context is cancelled first, the job summary is marked as cancelled.
+func (config *Config) StartOfflineSensorProcess(ctx context.Context) OfflineJobResult {
+	config.startJob()
+	defer config.finishJob()
+	cause, finalOptimizationSucceeded := config.addOfflineSensorReadings(ctx)
+	// a sensor read fails when the context is cancelled during it
+	if cause == CauseCancelled || (cause == CauseSensorError && ctx.Err() != nil) {
+		cause = CauseCancelled
+		finalOptimizationSucceeded = config.handleOfflineCancellation(ctx)
+	}
+	return OfflineJobResult{
+		JobDone: cause == CauseDatasetExhausted || cause == CauseMovementSensorEnded ||
+			cause == CauseMaxDuration,
+		Cause:                      cause,
+		CompletedAt:                time.Now(),
+		FinalOptimizationSucceeded: finalOptimizationSucceeded,
+	}
+}
+
+// addOfflineSensorReadings adds the lidar and movement sensor data in order of their time stamps until one of the
+// datasets has reached its end, MaxJobDuration has elapsed or the context is cancelled. Returns why it stopped and
+// whether the final optimization, which is run once a dataset has reached its end or MaxJobDuration has elapsed,
+// succeeded. Additional lidars whose dataset
+// reaches its end or whose readings keep failing are left out from then on, without ending the process.
+func (config *Config) addOfflineSensorReadings(ctx context.Context) (JobDoneCause, bool) {
+	start := time.Now()
 	// get the initial lidar reading
-	lidarReading, err := config.Lidar.TimedLidarReading(ctx)
+	lidarReading, err := config.nextOfflineLidarReading(ctx)
 	if err != nil {
 		config.Logger.Warn(err)
-		return strings.Contains(err.Error(), replaypcd.ErrEndOfDataset.Error())
+		if strings.Contains(err.Error(), replaypcd.ErrEndOfDataset.Error()) {
+			config.recordEndOfDataset()
+			return CauseDatasetExhausted, false
+		}
+		return CauseSensorError, false
 	}
 
 	var movementSensorReading s.TimedMovementSensorReadingResponse
@@ -89,46 +360,72 @@ func (config *Config) StartOfflineSensorProcess(ctx context.Context) bool {
 		// get the initial IMU reading; discard all IMU readings that were recorded before the first lidar reading
 		movementSensorReading, err = config.getInitialMovementSensorReading(ctx, lidarReading)
 		if err != nil {
+			if errors.Is(err, ErrMixedClockDomains) {
+				config.Logger.Errorw("refusing to start the offline sensor process", "error", err)
+				return CauseMixedClockDomains, false
+			}
 			config.Logger.Warn(err)
-			return strings.Contains(err.Error(), replaymovementsensor.ErrEndOfDataset.Error())
+			if strings.Contains(err.Error(), replaymovementsensor.ErrEndOfDataset.Error()) {
+				config.recordEndOfDataset()
+				return CauseMovementSensorEnded, false
+			}
+			return CauseSensorError, false
 		}
 	}
 
+	// the readings of the lidars of lidarConfigs, of which those of the active ones are yet to be added
+	lidarConfigs := config.LidarConfigs()
+	lidarReadings := make([]s.TimedLidarReadingResponse, len(lidarConfigs))
+	activeLidars := make([]bool, len(lidarConfigs))
+	lidarReadings[0], activeLidars[0] = lidarReading, true
+	for i := 1; i < len(lidarConfigs); i++ {
+		lidarReadings[i], activeLidars[i] = config.nextAdditionalOfflineLidarReading(ctx, lidarConfigs[i])
+	}
+
+	// the reading time of the most recent reading of the first lidar, which the movement sensor readings may not be
+	// further than MaxSensorSkew from
+	var lastLidarReadingTime time.Time
+
 	// loop over all the data until one of the datasets has reached its end
 	for {
 		select {
 		case <-ctx.Done():
-			return false
+			return CauseCancelled, false
 		default:
+			if config.MaxJobDuration > 0 && time.Since(start) >= config.MaxJobDuration {
+				config.Logger.Infow("Stopping offline mapping before the end of the dataset as max_job_duration_sec "+
+					"was reached", "max_job_duration", config.MaxJobDuration)
+				return CauseMaxDuration, config.runFinalOptimizationAtEnd(ctx)
+			}
+			config.heartbeat()
 			// create a map of supported sensors and their reading time stamps
-			readingTimes := []offlineSensorReadingTime{
-				{sensorType: lidar, readingTime: lidarReading.ReadingTime},
+			readingTimes := []offlineSensorReadingTime{}
+			for i, reading := range lidarReadings {
+				if activeLidars[i] {
+					readingTimes = append(readingTimes,
+						offlineSensorReadingTime{sensorType: lidar, lidarIndex: i, readingTime: reading.ReadingTime})
+				}
 			}
 			// default to the slightly later imu timestamp: in case that the odometer time stamp was
 			// taken before the lidar time stamp, but the imu time stamp was taken after the lidar time
 			// stamp, we'll want to prioritize adding the lidar measurement before adding the movement
 			// sensor measurement
-			if config.MovementSensor != nil && config.MovementSensor.Properties().IMUSupported {
+			if config.MovementSensor != nil && (config.MovementSensor.Properties().IMUSupported ||
+				config.MovementSensor.Properties().OdometerSupported) {
 				readingTimes = append(readingTimes,
 					offlineSensorReadingTime{
 						sensorType:  movementSensor,
-						readingTime: movementSensorReading.TimedIMUResponse.ReadingTime,
-					})
-			} else if config.MovementSensor != nil && config.MovementSensor.Properties().OdometerSupported {
-				readingTimes = append(readingTimes,
-					offlineSensorReadingTime{
-						sensorType:  movementSensor,
-						readingTime: movementSensorReading.TimedOdometerResponse.ReadingTime,
+						readingTime: config.movementSensorReadingTime(movementSensorReading),
 					})
 			}
 
 			// sort the readings based on their time stamp
-			sort.Slice(readingTimes,
+			sort.SliceStable(readingTimes,
 				func(i, j int) bool {
-					// if the timestamps are the same, we want to prioritize the lidar measurement before
-					// the movement sensor measurement
+					// if the timestamps are the same, we want to prioritize the lidar measurements before
+					// the movement sensor measurement, and keep the lidars in order
 					if readingTimes[i].readingTime.Equal(readingTimes[j].readingTime) {
-						return readingTimes[i].sensorType == lidar
+						return readingTimes[i].sensorType == lidar && readingTimes[j].sensorType != lidar
 					}
 					return readingTimes[i].readingTime.Before(readingTimes[j].readingTime)
 				})
@@ -136,40 +433,172 @@ func (config *Config) StartOfflineSensorProcess(ctx context.Context) bool {
 			// insert the reading with the earliest time stamp
 			switch readingTimes[0].sensorType {
 			case lidar:
-				if err := config.tryAddLidarReadingUntilSuccess(ctx, lidarReading); err != nil {
-					return false
+				lidarIndex := readingTimes[0].lidarIndex
+				lidarConfig := lidarConfigs[lidarIndex]
+				if lidarIndex == 0 {
+					lastLidarReadingTime = lidarReadings[0].ReadingTime
+				}
+				if clippedReading, ok := lidarConfig.clipLidarReading(ctx, lidarReadings[lidarIndex]); ok {
+					if err := lidarConfig.tryAddLidarReadingUntilSuccess(ctx, clippedReading); err == nil {
+						config.countLidarReading()
+						config.recordInsertedReading()
+					} else if !errors.Is(err, errReadingSkipped) && !errors.Is(err, errReadingOutOfOrder) {
+						return CauseCancelled, false
+					}
 				}
 
-				lidarReading, err = config.Lidar.TimedLidarReading(ctx)
+				if lidarIndex != 0 {
+					lidarReadings[lidarIndex], activeLidars[lidarIndex] =
+						config.nextAdditionalOfflineLidarReading(ctx, lidarConfig)
+					continue
+				}
+				lidarReadings[0], err = config.nextOfflineLidarReading(ctx)
 				if err != nil {
 					config.Logger.Warn(err)
-					lidarEndOfDataSetReached := strings.Contains(err.Error(), replaypcd.ErrEndOfDataset.Error())
-					if lidarEndOfDataSetReached {
-						config.runFinalOptimization(ctx)
+					if strings.Contains(err.Error(), replaypcd.ErrEndOfDataset.Error()) {
+						config.recordEndOfDataset()
+						return CauseDatasetExhausted, config.runFinalOptimizationAtEnd(ctx)
 					}
-					return lidarEndOfDataSetReached
+					return CauseSensorError, false
 				}
 			case movementSensor:
-				if err := config.tryAddMovementSensorReadingUntilSuccess(ctx, movementSensorReading); err != nil {
-					return false
+				if err := config.checkSensorSkew(lastLidarReadingTime, readingTimes[0].readingTime); err != nil {
+					config.Logger.Errorw("stopping the offline sensor process", "error", err)
+					return CauseSensorSkew, false
 				}
-				movementSensorReading, err = config.MovementSensor.TimedMovementSensorReading(ctx)
+				if err := config.tryAddMovementSensorReadingUntilSuccess(ctx, movementSensorReading); err == nil {
+					config.countMovementSensorReading()
+					config.recordInsertedReading()
+				} else if !errors.Is(err, errReadingSkipped) {
+					return CauseCancelled, false
+				}
+				movementSensorReading, err = config.nextMovementSensorReading(ctx)
 				if err != nil {
 					config.Logger.Warn(err)
-					msEndOfDataSetReached := strings.Contains(err.Error(), replaymovementsensor.ErrEndOfDataset.Error())
-					if msEndOfDataSetReached {
-						config.runFinalOptimization(ctx)
+					if strings.Contains(err.Error(), replaymovementsensor.ErrEndOfDataset.Error()) {
+						config.recordEndOfDataset()
+						return CauseMovementSensorEnded, config.runFinalOptimizationAtEnd(ctx)
 					}
-					return msEndOfDataSetReached
+					return CauseSensorError, false
 				}
 			}
 		}
 	}
 }
 
-func (config *Config) runFinalOptimization(ctx context.Context) {
+// nextOfflineLidarReading returns the next lidar reading that is neither empty nor dropped by the scan filter.
+// Such readings are skipped before they take part in ordering the readings by their time stamps, so that the
+// remaining readings are added in the same order as without them. Readings that fail for a reason other than the
+// end of the dataset are skipped as well, unless more than MaxConsecutiveLidarFailures fail in a row.
+func (config *Config) nextOfflineLidarReading(ctx context.Context) (s.TimedLidarReadingResponse, error) {
+	numConsecutiveFailures := 0
+	for {
+		lidarReading, err := config.Lidar.TimedLidarReading(ctx)
+		if err == nil {
+			lidarReading, err = config.supportedLidarReading(lidarReading)
+		}
+		if err != nil {
+			if ctx.Err() != nil || strings.Contains(err.Error(), replaypcd.ErrEndOfDataset.Error()) {
+				return lidarReading, err
+			}
+			config.countProcessedLidarReading()
+			numConsecutiveFailures++
+			if numConsecutiveFailures > config.MaxConsecutiveLidarFailures {
+				return lidarReading, fmt.Errorf("giving up after %d consecutive lidar readings failed: %w",
+					numConsecutiveFailures, err)
+			}
+			config.Logger.Warnw("skipping lidar reading that failed", "error", err,
+				"consecutive_failures", numConsecutiveFailures)
+			config.countSkippedLidarReading()
+			continue
+		}
+		config.countProcessedLidarReading()
+		if !config.isDegenerateLidarReading(lidarReading) {
+			return lidarReading, nil
+		}
+		numConsecutiveFailures = 0
+		if ctx.Err() != nil {
+			return s.TimedLidarReadingResponse{}, ctx.Err()
+		}
+	}
+}
+
+// nextAdditionalOfflineLidarReading returns the next reading of an additional lidar, along with whether there is
+// one. There is none once the dataset of the lidar has reached its end, its readings keep failing or it takes longer
+// than AdditionalLidarReadingTimeout, in which case the offline sensor process continues without the lidar.
+func (config *Config) nextAdditionalOfflineLidarReading(
+	ctx context.Context,
+	lidarConfig *Config,
+) (s.TimedLidarReadingResponse, bool) {
+	readingCtx := ctx
+	if config.AdditionalLidarReadingTimeout > 0 {
+		var cancel context.CancelFunc
+		readingCtx, cancel = context.WithTimeout(ctx, config.AdditionalLidarReadingTimeout)
+		defer cancel()
+	}
+	lidarReading, err := lidarConfig.nextOfflineLidarReading(readingCtx)
+	if err != nil {
+		if ctx.Err() == nil {
+			config.Logger.Warnw("continuing without additional lidar", "lidar", lidarConfig.Lidar.Name(), "error", err)
+		}
+		return lidarReading, false
+	}
+	return lidarReading, true
+}
+
+// runFinalOptimizationAtEnd runs the final optimization once the end of a dataset is reached, unless
+// SkipFinalOptimization is set. Returns whether it was run and succeeded.
+func (config *Config) runFinalOptimizationAtEnd(ctx context.Context) bool {
+	if config.SkipFinalOptimization {
+		config.Logger.Info("Skipping final optimization as skip_final_optimization is set")
+		return false
+	}
+	return config.runFinalOptimization(ctx)
+}
+
+func (config *Config) runFinalOptimization(ctx context.Context) bool {
 	config.Logger.Info("Beginning final optimization")
 	if err := config.CartoFacade.RunFinalOptimization(ctx, config.InternalTimeout); err != nil {
 		config.Logger.Error("Failed to finish processing all sensor readings: ", err)
+		return false
+	}
+	return true
+}
+
+// rejectedTooOften counts the rejection of a reading in numRejections if err denotes that cartographer rejected it
+// for its contents, and returns whether it was rejected more than MaxRejectedReadingRetries times, so that it
+// should be skipped.
+func (config *Config) rejectedTooOften(err error, numRejections *int) bool {
+	if !cartofacade.IsReadingRejected(err) {
+		return false
+	}
+	*numRejections++
+	return *numRejections > config.MaxRejectedReadingRetries
+}
+
+// skipRejectedReading counts and warns about a reading of sensor, taken at readingTime, that is skipped in offline
+// mode as cartographer kept rejecting it with err.
+func (config *Config) skipRejectedReading(sensor string, readingTime time.Time, err error) {
+	keysAndValues := []interface{}{
+		"sensor", sensor,
+		"reading_time", readingTime,
+		"attempts", config.MaxRejectedReadingRetries + 1,
+		"error", err,
+	}
+	if numRejected, ok := config.countRejectedReading(); ok {
+		keysAndValues = append(keysAndValues, "num_rejected_readings", numRejected)
+	}
+	config.Logger.Warnw("Skipping sensor reading that cartographer keeps rejecting", keysAndValues...)
+}
+
+// outOfOrder returns whether a reading of sensor, taken at readingTime, is not after the reading time of the last
+// reading of the sensor that was added, lastAdded, in which case it is counted and logged as dropped.
+func (config *Config) outOfOrder(sensor string, readingTime, lastAdded time.Time) bool {
+	if lastAdded.IsZero() || readingTime.After(lastAdded) {
+		return false
 	}
+	config.recordOutOfOrderReading(sensor)
+	config.Logger.Debugw("Dropping sensor reading that is not newer than the last reading added",
+		"sensor", sensor, "reading_time", readingTime, "last_added_reading_time", lastAdded)
+	return true
 }
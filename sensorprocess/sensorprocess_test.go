@@ -1,24 +1,33 @@
 package sensorprocess
 
 import (
+	"bytes"
 	"context"
 	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/golang/geo/r3"
 	geo "github.com/kellydunn/golang-geo"
+	"go.uber.org/zap/zaptest/observer"
 	"go.viam.com/rdk/components/camera/replaypcd"
 	"go.viam.com/rdk/components/movementsensor/replay"
 	"go.viam.com/rdk/logging"
+	"go.viam.com/rdk/pointcloud"
 	"go.viam.com/rdk/spatialmath"
 	"go.viam.com/test"
 
 	"github.com/viam-modules/viam-cartographer/cartofacade"
 	s "github.com/viam-modules/viam-cartographer/sensors"
 	"github.com/viam-modules/viam-cartographer/sensors/inject"
+	"github.com/viam-modules/viam-cartographer/testhelper/pcdtest"
 )
 
 func TestStartOfflineSensorProcess(t *testing.T) {
@@ -104,7 +113,7 @@ func TestStartOfflineSensorProcess(t *testing.T) {
 			return nil
 		}
 
-		endOfDataSetReached := config.StartOfflineSensorProcess(context.Background())
+		endOfDataSetReached := config.StartOfflineSensorProcess(context.Background()).JobDone
 		test.That(t, endOfDataSetReached, test.ShouldBeTrue)
 		test.That(t, countAddedLidarData, test.ShouldEqual, 0)
 		test.That(t, countAddedIMUData, test.ShouldEqual, 0)
@@ -124,7 +133,7 @@ func TestStartOfflineSensorProcess(t *testing.T) {
 		config.Lidar = replaySensor
 		config.MovementSensor = nil
 
-		endOfDataSetReached := config.StartOfflineSensorProcess(context.Background())
+		endOfDataSetReached := config.StartOfflineSensorProcess(context.Background()).JobDone
 		test.That(t, endOfDataSetReached, test.ShouldBeTrue)
 	})
 
@@ -212,9 +221,11 @@ func TestStartOfflineSensorProcess(t *testing.T) {
 			},
 		}
 
-		for _, tt := range cases {
+		// the readings of every case are newer than those of the previous cases, which the config added last
+		start := time.Now().UTC()
+		for i, tt := range cases {
 			t.Run(tt.description, func(t *testing.T) {
-				now := time.Now().UTC()
+				now := start.Add(time.Duration(i) * time.Second)
 
 				if tt.imuEnabled || tt.odometerEnabled {
 					config.MovementSensor = &injectMovementSensor
@@ -301,7 +312,7 @@ func TestStartOfflineSensorProcess(t *testing.T) {
 				expectedCountAddedIMUData := countItemsInList(tt.expectedDataInsertions, "imu")
 				expectedCountAddedOdometerData := countItemsInList(tt.expectedDataInsertions, "odometer")
 
-				endOfDataSetReached := config.StartOfflineSensorProcess(context.Background())
+				endOfDataSetReached := config.StartOfflineSensorProcess(context.Background()).JobDone
 				test.That(t, endOfDataSetReached, test.ShouldBeTrue)
 				test.That(t, countAddedLidarData, test.ShouldEqual, expectedCountAddedLidarData)
 				test.That(t, countAddedIMUData, test.ShouldEqual, expectedCountAddedIMUData)
@@ -467,3 +478,741 @@ func TestGetInitialMovementSensorReading(t *testing.T) {
 		}
 	})
 }
+
+// datasetLidar returns a lidar that reads the frames of a lidar dataset in order, like a replay camera. A frame
+// that cannot be read or parsed is skipped with an error. The reading times advance by interval per returned
+// reading only, so that skipped frames do not leave gaps in them.
+func datasetLidar(framePaths []string, start time.Time, interval time.Duration) *inject.TimedLidar {
+	injectLidar := &inject.TimedLidar{}
+	injectLidar.NameFunc = func() string { return "dataset_lidar" }
+	injectLidar.DataFrequencyHzFunc = func() int { return 0 }
+	var i, numReturned int
+	injectLidar.TimedLidarReadingFunc = func(ctx context.Context) (s.TimedLidarReadingResponse, error) {
+		if i >= len(framePaths) {
+			return s.TimedLidarReadingResponse{}, replaypcd.ErrEndOfDataset
+		}
+		framePath := framePaths[i]
+		i++
+		frame, err := s.ReadLidarDatasetFrame(framePath)
+		if err != nil {
+			return s.TimedLidarReadingResponse{}, err
+		}
+		pc, err := pointcloud.ReadPCD(bytes.NewReader(frame))
+		if err != nil {
+			return s.TimedLidarReadingResponse{}, err
+		}
+		buf := new(bytes.Buffer)
+		if err := pointcloud.ToPCD(pc, buf, pointcloud.PCDBinary); err != nil {
+			return s.TimedLidarReadingResponse{}, err
+		}
+		readingTime := start.Add(time.Duration(numReturned) * interval)
+		numReturned++
+		return s.TimedLidarReadingResponse{Reading: buf.Bytes(), ReadingTime: readingTime}, nil
+	}
+	return injectLidar
+}
+
+func TestOfflineDatasetWithUnreadableFrames(t *testing.T) {
+	logger := logging.NewTestLogger(t)
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	interval := 200 * time.Millisecond
+
+	// a dataset of 6 frames of which frame 2 is corrupt and frame 3 is missing
+	dir := t.TempDir()
+	for i := 0; i < 6; i++ {
+		reading := pcdtest.PointsToPCD(t, []r3.Vector{{X: float64(1000 + i)}})
+		if i == 2 {
+			reading = []byte("not a pcd")
+		}
+		_, err := s.WriteLidarDatasetFrame(dir, strconv.Itoa(i), reading, s.NoDatasetCompression)
+		test.That(t, err, test.ShouldBeNil)
+	}
+	framePaths, err := s.ListLidarDatasetFrames(dir)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, os.Remove(framePaths[3]), test.ShouldBeNil)
+
+	setup := func(maxConsecutiveLidarFailures int) (*Config, *[]time.Time) {
+		var addedReadingTimes []time.Time
+		cf := cartofacade.Mock{}
+		cf.AddLidarReadingFunc = func(ctx context.Context, timeout time.Duration,
+			lidarName string, currentReading s.TimedLidarReadingResponse,
+		) error {
+			addedReadingTimes = append(addedReadingTimes, currentReading.ReadingTime)
+			return nil
+		}
+		cf.RunFinalOptimizationFunc = func(ctx context.Context, timeout time.Duration) error {
+			return nil
+		}
+		return &Config{
+			Logger:                      logger,
+			CartoFacade:                 &cf,
+			Lidar:                       datasetLidar(framePaths, start, interval),
+			Timeout:                     10 * time.Second,
+			JobSummary:                  &JobSummary{},
+			MaxConsecutiveLidarFailures: maxConsecutiveLidarFailures,
+		}, &addedReadingTimes
+	}
+
+	t.Run("unreadable frames are skipped and counted without gaps in the reading times", func(t *testing.T) {
+		config, addedReadingTimes := setup(2)
+		result := config.StartOfflineSensorProcess(context.Background())
+		test.That(t, result.JobDone, test.ShouldBeTrue)
+		test.That(t, result.Cause, test.ShouldEqual, CauseDatasetExhausted)
+		test.That(t, config.JobSummary.ToMap()["num_lidar_readings"], test.ShouldEqual, int64(4))
+		test.That(t, config.JobSummary.ToMap()["num_skipped_lidar_readings"], test.ShouldEqual, int64(2))
+
+		test.That(t, *addedReadingTimes, test.ShouldHaveLength, 4)
+		for i, readingTime := range *addedReadingTimes {
+			test.That(t, readingTime, test.ShouldEqual, start.Add(time.Duration(i)*interval))
+		}
+	})
+
+	t.Run("the process gives up once more consecutive frames are unreadable than allowed", func(t *testing.T) {
+		config, addedReadingTimes := setup(1)
+		result := config.StartOfflineSensorProcess(context.Background())
+		test.That(t, result.JobDone, test.ShouldBeFalse)
+		test.That(t, result.Cause, test.ShouldEqual, CauseSensorError)
+		test.That(t, config.JobSummary.ToMap()["num_skipped_lidar_readings"], test.ShouldEqual, int64(1))
+		test.That(t, *addedReadingTimes, test.ShouldHaveLength, 2)
+	})
+
+	t.Run("a frame that cartographer keeps rejecting is skipped and the process continues", func(t *testing.T) {
+		config, _ := setup(2)
+		config.MaxRejectedReadingRetries = 1
+		var addedReadingTimes []time.Time
+		config.CartoFacade.(*cartofacade.Mock).AddLidarReadingFunc = func(ctx context.Context, timeout time.Duration,
+			lidarName string, currentReading s.TimedLidarReadingResponse,
+		) error {
+			if currentReading.ReadingTime.Equal(start.Add(interval)) {
+				return cartofacade.ErrLidarReadingInvalid
+			}
+			addedReadingTimes = append(addedReadingTimes, currentReading.ReadingTime)
+			return nil
+		}
+		result := config.StartOfflineSensorProcess(context.Background())
+		test.That(t, result.JobDone, test.ShouldBeTrue)
+		test.That(t, result.Cause, test.ShouldEqual, CauseDatasetExhausted)
+		test.That(t, config.JobSummary.ToMap()["num_lidar_readings"], test.ShouldEqual, int64(3))
+		test.That(t, config.JobSummary.ToMap()["num_rejected_readings"], test.ShouldEqual, int64(1))
+		test.That(t, addedReadingTimes, test.ShouldHaveLength, 3)
+	})
+}
+
+func TestMixedClockDomains(t *testing.T) {
+	logger, obs := logging.NewObservedTestLogger(t)
+	ctx := context.Background()
+	deps := s.SetupDeps(s.GoodLidar, s.ReplayIMU)
+	lidar, err := s.NewLidar(ctx, deps, string(s.GoodLidar), 0, logger)
+	test.That(t, err, test.ShouldBeNil)
+	movementSensor, err := s.NewMovementSensor(ctx, deps, string(s.ReplayIMU), 0, s.DegreesPerSecond, logger)
+	test.That(t, err, test.ShouldBeNil)
+
+	numAddedReadings := 0
+	cf := cartofacade.Mock{}
+	cf.AddLidarReadingFunc = func(ctx context.Context, timeout time.Duration,
+		lidarName string, currentReading s.TimedLidarReadingResponse,
+	) error {
+		numAddedReadings++
+		return nil
+	}
+	cf.AddIMUReadingFunc = func(ctx context.Context, timeout time.Duration,
+		movementSensorName string, currentReading s.TimedIMUReadingResponse,
+	) error {
+		numAddedReadings++
+		return nil
+	}
+	config := Config{
+		Logger:         logger,
+		CartoFacade:    &cf,
+		Lidar:          lidar,
+		MovementSensor: movementSensor,
+		Timeout:        10 * time.Second,
+		JobSummary:     &JobSummary{},
+	}
+
+	t.Run("a live lidar and a replay movement sensor are refused", func(t *testing.T) {
+		result := config.StartOfflineSensorProcess(ctx)
+		test.That(t, result.JobDone, test.ShouldBeFalse)
+		test.That(t, result.Cause, test.ShouldEqual, CauseMixedClockDomains)
+		test.That(t, numAddedReadings, test.ShouldEqual, 0)
+
+		logs := obs.FilterMessageSnippet("refusing to start the offline sensor process").All()
+		test.That(t, len(logs), test.ShouldEqual, 1)
+		msg := logs[0].ContextMap()["error"].(string)
+		test.That(t, msg, test.ShouldStartWith, ErrMixedClockDomains.Error())
+		test.That(t, msg, test.ShouldContainSubstring, "lidar \"good_lidar\" is live with its first reading at ")
+		test.That(t, msg, test.ShouldContainSubstring, "movement sensor \"replay_imu\" is replay with its first "+
+			"reading at "+s.TestTimestamp)
+		test.That(t, msg, test.ShouldEndWith, "set allow_mixed_clock_domains to combine them anyway")
+	})
+
+	t.Run("sensors of different clock domains are combined when allowed", func(t *testing.T) {
+		config.AllowMixedClockDomains = true
+		lidarReading, err := lidar.TimedLidarReading(ctx)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, lidarReading.ClockDomain(), test.ShouldEqual, s.ClockDomainLive)
+		movementSensorReading, err := movementSensor.TimedMovementSensorReading(ctx)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, movementSensorReading.ClockDomain(), test.ShouldEqual, s.ClockDomainReplay)
+
+		err = config.checkClockDomains(lidarReading, movementSensorReading,
+			movementSensorReading.TimedIMUResponse.ReadingTime)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, obs.FilterMessageSnippet("allow_mixed_clock_domains is set").Len(), test.ShouldEqual, 1)
+	})
+}
+
+func TestSensorSkew(t *testing.T) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	at := func(ms int) time.Time { return start.Add(time.Duration(ms) * time.Millisecond) }
+
+	setup := func(t *testing.T, maxSensorSkew time.Duration, lidarOffsetsMs, imuOffsetsMs []int) (
+		*Config, *[]time.Time, *observer.ObservedLogs,
+	) {
+		logger, obs := logging.NewObservedTestLogger(t)
+		lidarOffsets := []*time.Duration{}
+		for _, offset := range lidarOffsetsMs {
+			duration := time.Duration(offset) * time.Millisecond
+			lidarOffsets = append(lidarOffsets, &duration)
+		}
+		injectLidar := scriptedLidar(t, "good_lidar", 0, start, lidarOffsets)
+
+		injectMovementSensor := &inject.TimedMovementSensor{}
+		injectMovementSensor.NameFunc = func() string { return "good_imu" }
+		injectMovementSensor.DataFrequencyHzFunc = func() int { return 20 }
+		injectMovementSensor.PropertiesFunc = func() s.MovementSensorProperties {
+			return s.MovementSensorProperties{IMUSupported: true}
+		}
+		var i int
+		injectMovementSensor.TimedMovementSensorReadingFunc = func(ctx context.Context) (
+			s.TimedMovementSensorReadingResponse, error,
+		) {
+			if i >= len(imuOffsetsMs) {
+				return s.TimedMovementSensorReadingResponse{}, replay.ErrEndOfDataset
+			}
+			readingTime := at(imuOffsetsMs[i])
+			i++
+			return s.TimedMovementSensorReadingResponse{
+				TimedIMUResponse: &s.TimedIMUReadingResponse{ReadingTime: readingTime},
+			}, nil
+		}
+
+		addedIMUReadingTimes := []time.Time{}
+		cf := cartofacade.Mock{}
+		cf.AddLidarReadingFunc = func(ctx context.Context, timeout time.Duration,
+			lidarName string, currentReading s.TimedLidarReadingResponse,
+		) error {
+			return nil
+		}
+		cf.AddIMUReadingFunc = func(ctx context.Context, timeout time.Duration,
+			movementSensorName string, currentReading s.TimedIMUReadingResponse,
+		) error {
+			addedIMUReadingTimes = append(addedIMUReadingTimes, currentReading.ReadingTime)
+			return nil
+		}
+		config := &Config{
+			Logger:         logger,
+			CartoFacade:    &cf,
+			Lidar:          injectLidar,
+			MovementSensor: injectMovementSensor,
+			MaxSensorSkew:  maxSensorSkew,
+			Timeout:        10 * time.Second,
+			JobSummary:     &JobSummary{},
+		}
+		return config, &addedIMUReadingTimes, obs
+	}
+
+	t.Run("skew from the most recent lidar reading", func(t *testing.T) {
+		cases := []struct {
+			description    string
+			maxSensorSkew  time.Duration
+			lidarTime      time.Time
+			movementTime   time.Time
+			expectRejected bool
+		}{
+			{"disabled", 0, at(0), at(10000), false},
+			{"no lidar reading yet", 50 * time.Millisecond, time.Time{}, at(10000), false},
+			{"same time", 50 * time.Millisecond, at(100), at(100), false},
+			{"later by less than the max", 50 * time.Millisecond, at(100), at(149), false},
+			{"later by exactly the max", 50 * time.Millisecond, at(100), at(150), false},
+			{"later by more than the max", 50 * time.Millisecond, at(100), at(150).Add(time.Nanosecond), true},
+			{"earlier by exactly the max", 50 * time.Millisecond, at(100), at(50), false},
+			{"earlier by more than the max", 50 * time.Millisecond, at(100), at(50).Add(-time.Nanosecond), true},
+		}
+		for _, tc := range cases {
+			t.Run(tc.description, func(t *testing.T) {
+				config, _, _ := setup(t, tc.maxSensorSkew, nil, nil)
+				err := config.checkSensorSkew(tc.lidarTime, tc.movementTime)
+				if tc.expectRejected {
+					test.That(t, errors.Is(err, ErrSensorSkew), test.ShouldBeTrue)
+				} else {
+					test.That(t, err, test.ShouldBeNil)
+				}
+			})
+		}
+	})
+
+	t.Run("online, movement sensor readings past the max skew are dropped", func(t *testing.T) {
+		cases := []struct {
+			description   string
+			lastLidarTime time.Time
+			imuTime       time.Time
+			expectAdded   bool
+		}{
+			{"before the first lidar reading", time.Time{}, at(1000), true},
+			{"at the max skew", at(100), at(150), true},
+			{"past the max skew", at(100), at(151), false},
+			{"before the lidar reading past the max skew", at(100), at(49), false},
+		}
+		for _, tc := range cases {
+			t.Run(tc.description, func(t *testing.T) {
+				config, added, obs := setup(t, 50*time.Millisecond, nil, nil)
+				config.IsOnline = true
+				config.LastLidarReadingTime = &atomic.Int64{}
+				if !tc.lastLidarTime.IsZero() {
+					config.LastLidarReadingTime.Store(tc.lastLidarTime.UnixNano())
+				}
+				config.tryAddMovementSensorReadingOnce(context.Background(), s.TimedMovementSensorReadingResponse{
+					TimedIMUResponse: &s.TimedIMUReadingResponse{ReadingTime: tc.imuTime},
+				})
+				skipped := obs.FilterMessageSnippet("Skipping movement sensor reading due to its skew").Len()
+				if tc.expectAdded {
+					test.That(t, *added, test.ShouldResemble, []time.Time{tc.imuTime})
+					test.That(t, skipped, test.ShouldEqual, 0)
+				} else {
+					test.That(t, *added, test.ShouldBeEmpty)
+					test.That(t, skipped, test.ShouldEqual, 1)
+				}
+			})
+		}
+	})
+
+	t.Run("online, the warnings about dropped movement sensor readings are rate limited", func(t *testing.T) {
+		config, added, obs := setup(t, 50*time.Millisecond, nil, nil)
+		config.IsOnline = true
+		config.LastLidarReadingTime = &atomic.Int64{}
+		config.LastLidarReadingTime.Store(at(100).UnixNano())
+		for i := 0; i < 5; i++ {
+			config.tryAddMovementSensorReadingOnce(context.Background(), s.TimedMovementSensorReadingResponse{
+				TimedIMUResponse: &s.TimedIMUReadingResponse{ReadingTime: at(200 + i)},
+			})
+		}
+		test.That(t, *added, test.ShouldBeEmpty)
+		warnings := obs.FilterMessageSnippet("Skipping movement sensor reading due to its skew").All()
+		test.That(t, len(warnings), test.ShouldEqual, 1)
+		test.That(t, warnings[0].ContextMap()["num_skipped_since_last_warning"], test.ShouldEqual, int64(1))
+
+		// the readings dropped in between are counted in the next warning
+		config.lastSkewWarning = time.Now().Add(-skewWarningInterval)
+		config.tryAddMovementSensorReadingOnce(context.Background(), s.TimedMovementSensorReadingResponse{
+			TimedIMUResponse: &s.TimedIMUReadingResponse{ReadingTime: at(300)},
+		})
+		warnings = obs.FilterMessageSnippet("Skipping movement sensor reading due to its skew").All()
+		test.That(t, len(warnings), test.ShouldEqual, 2)
+		test.That(t, warnings[1].ContextMap()["num_skipped_since_last_warning"], test.ShouldEqual, int64(5))
+	})
+
+	t.Run("online, the most recent lidar reading time is recorded before rebasing it", func(t *testing.T) {
+		config, _, _ := setup(t, 50*time.Millisecond, nil, nil)
+		config.IsOnline = true
+		config.LastLidarReadingTime = &atomic.Int64{}
+		config.tryAddLidarReading(context.Background(), s.TimedLidarReadingResponse{ReadingTime: at(100)})
+		test.That(t, config.LastLidarReadingTime.Load(), test.ShouldEqual, at(100).UnixNano())
+	})
+
+	t.Run("offline, a movement sensor reading past the max skew fails the sensor process", func(t *testing.T) {
+		config, added, obs := setup(t, 50*time.Millisecond, []int{0, 100, 200, 300}, []int{10, 150, 260, 310})
+		result := config.StartOfflineSensorProcess(context.Background())
+		test.That(t, result.JobDone, test.ShouldBeFalse)
+		test.That(t, result.Cause, test.ShouldEqual, CauseSensorSkew)
+		test.That(t, *added, test.ShouldResemble, []time.Time{at(10), at(150)})
+
+		logs := obs.FilterMessageSnippet("stopping the offline sensor process").All()
+		test.That(t, len(logs), test.ShouldEqual, 1)
+		msg := logs[0].ContextMap()["error"].(string)
+		test.That(t, msg, test.ShouldStartWith, ErrSensorSkew.Error())
+		test.That(t, msg, test.ShouldContainSubstring, "movement sensor \"good_imu\" has a reading at "+
+			at(260).Format(time.RFC3339Nano))
+		test.That(t, msg, test.ShouldContainSubstring, "lidar \"good_lidar\" at "+at(200).Format(time.RFC3339Nano))
+		test.That(t, msg, test.ShouldEndWith, "max_sensor_skew_ms of 50")
+	})
+
+	t.Run("offline, movement sensor readings within the max skew are all added", func(t *testing.T) {
+		config, added, _ := setup(t, 50*time.Millisecond, []int{0, 100, 200, 300}, []int{10, 150, 250})
+		result := config.StartOfflineSensorProcess(context.Background())
+		test.That(t, result.Cause, test.ShouldNotEqual, CauseSensorSkew)
+		test.That(t, *added, test.ShouldResemble, []time.Time{at(10), at(150), at(250)})
+	})
+}
+
+// scriptedLidar returns a lidar that returns a reading at each of the given offsets from start, followed by the end
+// of the dataset. A nil entry of offsets makes the reading fail.
+func scriptedLidar(t *testing.T, name string, dataFrequencyHz int, start time.Time, offsets []*time.Duration) *inject.TimedLidar {
+	reading := pcdtest.PointsToPCD(t, []r3.Vector{{X: 1000}})
+	injectLidar := &inject.TimedLidar{}
+	injectLidar.NameFunc = func() string { return name }
+	injectLidar.DataFrequencyHzFunc = func() int { return dataFrequencyHz }
+	var i int
+	injectLidar.TimedLidarReadingFunc = func(ctx context.Context) (s.TimedLidarReadingResponse, error) {
+		if i >= len(offsets) {
+			return s.TimedLidarReadingResponse{}, replaypcd.ErrEndOfDataset
+		}
+		offset := offsets[i]
+		i++
+		if offset == nil {
+			return s.TimedLidarReadingResponse{}, errors.New("unreadable frame")
+		}
+		return s.TimedLidarReadingResponse{Reading: reading, ReadingTime: start.Add(*offset)}, nil
+	}
+	return injectLidar
+}
+
+func TestMultipleLidars(t *testing.T) {
+	logger := logging.NewTestLogger(t)
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	ms := func(offsets ...int) []*time.Duration {
+		durations := []*time.Duration{}
+		for _, offset := range offsets {
+			if offset < 0 {
+				durations = append(durations, nil)
+				continue
+			}
+			duration := time.Duration(offset) * time.Millisecond
+			durations = append(durations, &duration)
+		}
+		return durations
+	}
+
+	setup := func(lidar s.TimedLidar, additionalLidars ...s.TimedLidar) (*Config, func() []string) {
+		var mu sync.Mutex
+		var added []string
+		cf := cartofacade.Mock{}
+		cf.AddLidarReadingFunc = func(ctx context.Context, timeout time.Duration,
+			lidarName string, currentReading s.TimedLidarReadingResponse,
+		) error {
+			mu.Lock()
+			defer mu.Unlock()
+			added = append(added, fmt.Sprintf("%s@%d", lidarName, currentReading.ReadingTime.Sub(start).Milliseconds()))
+			return nil
+		}
+		cf.RunFinalOptimizationFunc = func(ctx context.Context, timeout time.Duration) error {
+			return nil
+		}
+		config := &Config{
+			Logger:           logger,
+			CartoFacade:      &cf,
+			Lidar:            lidar,
+			AdditionalLidars: additionalLidars,
+			Timeout:          10 * time.Second,
+			JobSummary:       &JobSummary{},
+		}
+		return config, func() []string {
+			mu.Lock()
+			defer mu.Unlock()
+			return append([]string{}, added...)
+		}
+	}
+
+	t.Run("offline readings of all lidars are merged by their time stamps", func(t *testing.T) {
+		config, added := setup(
+			scriptedLidar(t, "front", 0, start, ms(0, 20, 40, 60)),
+			scriptedLidar(t, "rear", 0, start, ms(10, 20, 30)),
+			scriptedLidar(t, "side", 0, start, ms(5)),
+		)
+		result := config.StartOfflineSensorProcess(context.Background())
+		test.That(t, result.JobDone, test.ShouldBeTrue)
+		test.That(t, result.Cause, test.ShouldEqual, CauseDatasetExhausted)
+		test.That(t, added(), test.ShouldResemble, []string{
+			"front@0", "side@5", "rear@10", "front@20", "rear@20", "rear@30", "front@40", "front@60",
+		})
+		test.That(t, config.JobSummary.ToMap()["num_lidar_readings"], test.ShouldEqual, int64(8))
+	})
+
+	t.Run("offline the process continues without an additional lidar whose readings keep failing", func(t *testing.T) {
+		config, added := setup(
+			scriptedLidar(t, "front", 0, start, ms(0, 20, 40)),
+			scriptedLidar(t, "rear", 0, start, ms(10, -1, -1, 50)),
+		)
+		config.MaxConsecutiveLidarFailures = 1
+		result := config.StartOfflineSensorProcess(context.Background())
+		test.That(t, result.Cause, test.ShouldEqual, CauseDatasetExhausted)
+		test.That(t, added(), test.ShouldResemble, []string{"front@0", "rear@10", "front@20", "front@40"})
+	})
+
+	t.Run("offline the process continues without an additional lidar that stalls", func(t *testing.T) {
+		rear := scriptedLidar(t, "rear", 0, start, ms(10, 30))
+		scriptedReading := rear.TimedLidarReadingFunc
+		var numReadings int
+		rear.TimedLidarReadingFunc = func(ctx context.Context) (s.TimedLidarReadingResponse, error) {
+			if numReadings++; numReadings > 1 {
+				<-ctx.Done()
+				return s.TimedLidarReadingResponse{}, ctx.Err()
+			}
+			return scriptedReading(ctx)
+		}
+		config, added := setup(scriptedLidar(t, "front", 0, start, ms(0, 20, 40)), rear)
+		config.AdditionalLidarReadingTimeout = 50 * time.Millisecond
+		result := config.StartOfflineSensorProcess(context.Background())
+		test.That(t, result.Cause, test.ShouldEqual, CauseDatasetExhausted)
+		test.That(t, added(), test.ShouldResemble, []string{"front@0", "rear@10", "front@20", "front@40"})
+	})
+
+	t.Run("every lidar has its own scan filter and sensor stats", func(t *testing.T) {
+		config, _ := setup(
+			scriptedLidar(t, "front", 0, start, ms(0, 20, 40)),
+			scriptedLidar(t, "rear", 0, start, ms(10, 30)),
+		)
+		config.ScanFilter = &ScanFilter{MinPointsPerScan: 1}
+		config.SensorStats = &SensorStats{}
+		lidarConfigs := config.LidarConfigs()
+		test.That(t, lidarConfigs[1].ScanFilter, test.ShouldNotEqual, config.ScanFilter)
+		test.That(t, lidarConfigs[1].ScanFilter.MinPointsPerScan, test.ShouldEqual, 1)
+
+		result := config.StartOfflineSensorProcess(context.Background())
+		test.That(t, result.Cause, test.ShouldEqual, CauseDatasetExhausted)
+		stats := config.SensorStats.ToMap()
+		test.That(t, stats[LidarSensor].(map[string]interface{})["readings_added"], test.ShouldEqual, int64(3))
+		rearStats := stats["additional_lidars"].(map[string]interface{})["rear"].(map[string]interface{})
+		test.That(t, rearStats["readings_added"], test.ShouldEqual, int64(2))
+	})
+
+	t.Run("online every lidar is polled at its own data frequency and keeps going while another fails", func(t *testing.T) {
+		reading := pcdtest.PointsToPCD(t, []r3.Vector{{X: 1000}})
+		timedLidarReading := func(ctx context.Context) (s.TimedLidarReadingResponse, error) {
+			return s.TimedLidarReadingResponse{Reading: reading, ReadingTime: start}, nil
+		}
+		front := &inject.TimedLidar{}
+		front.NameFunc = func() string { return "front" }
+		front.DataFrequencyHzFunc = func() int { return 100 }
+		front.TimedLidarReadingFunc = timedLidarReading
+		rear := &inject.TimedLidar{}
+		rear.NameFunc = func() string { return "rear" }
+		rear.DataFrequencyHzFunc = func() int { return 20 }
+		rear.TimedLidarReadingFunc = timedLidarReading
+		broken := &inject.TimedLidar{}
+		broken.NameFunc = func() string { return "broken" }
+		broken.DataFrequencyHzFunc = func() int { return 100 }
+		broken.TimedLidarReadingFunc = func(ctx context.Context) (s.TimedLidarReadingResponse, error) {
+			time.Sleep(10 * time.Millisecond)
+			return s.TimedLidarReadingResponse{}, errors.New("lidar disconnected")
+		}
+
+		config, added := setup(front, rear, broken)
+		config.IsOnline = true
+		lidarConfigs := config.LidarConfigs()
+		test.That(t, lidarConfigs, test.ShouldHaveLength, 3)
+		test.That(t, lidarConfigs[0], test.ShouldEqual, config)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		var workers sync.WaitGroup
+		for _, lidarConfig := range lidarConfigs {
+			workers.Add(1)
+			go func() {
+				defer workers.Done()
+				lidarConfig.StartLidar(ctx)
+			}()
+		}
+		time.Sleep(300 * time.Millisecond)
+		cancel()
+		workers.Wait()
+
+		counts := map[string]int{}
+		for _, reading := range added() {
+			counts[strings.Split(reading, "@")[0]]++
+		}
+		test.That(t, counts["front"], test.ShouldBeGreaterThan, counts["rear"])
+		test.That(t, counts["rear"], test.ShouldBeGreaterThan, 0)
+		test.That(t, counts["rear"], test.ShouldBeLessThanOrEqualTo, 7)
+		test.That(t, counts, test.ShouldNotContainKey, "broken")
+	})
+}
+
+func TestSensorNames(t *testing.T) {
+	logger := logging.NewTestLogger(t)
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	for _, names := range [][]string{
+		{"front lidar", "rear lidar"},
+		{"cart:front/lidar", "cart:rear/lidar"},
+	} {
+		t.Run(fmt.Sprintf("the readings of a dataset recorded from %q are added with the exact names", names), func(t *testing.T) {
+			// every lidar is recorded to a directory named by its encoded name, the first one for longer, as the
+			// process ends with its dataset
+			dir := t.TempDir()
+			for i, name := range names {
+				lidarDir := filepath.Join(dir, s.EncodeNameForPath(name))
+				test.That(t, os.Mkdir(lidarDir, 0o750), test.ShouldBeNil)
+				for j := 0; j < len(names)-i; j++ {
+					reading := pcdtest.PointsToPCD(t, []r3.Vector{{X: float64(1000 + i)}})
+					_, err := s.WriteLidarDatasetFrame(lidarDir, strconv.Itoa(j), reading, s.NoDatasetCompression)
+					test.That(t, err, test.ShouldBeNil)
+				}
+			}
+			dirEntries, err := os.ReadDir(dir)
+			test.That(t, err, test.ShouldBeNil)
+			test.That(t, dirEntries, test.ShouldHaveLength, len(names))
+
+			var lidars []s.TimedLidar
+			for i, name := range names {
+				framePaths, err := s.ListLidarDatasetFrames(filepath.Join(dir, s.EncodeNameForPath(name)))
+				test.That(t, err, test.ShouldBeNil)
+				test.That(t, framePaths, test.ShouldHaveLength, len(names)-i)
+				lidar := datasetLidar(framePaths, start.Add(time.Duration(i)*time.Millisecond), time.Second)
+				lidar.NameFunc = func() string { return name }
+				lidars = append(lidars, lidar)
+			}
+			for _, entry := range dirEntries {
+				name, err := s.DecodeNameFromPath(entry.Name())
+				test.That(t, err, test.ShouldBeNil)
+				test.That(t, names, test.ShouldContain, name)
+			}
+
+			var added []string
+			cf := cartofacade.Mock{}
+			cf.AddLidarReadingFunc = func(ctx context.Context, timeout time.Duration,
+				lidarName string, currentReading s.TimedLidarReadingResponse,
+			) error {
+				added = append(added, lidarName)
+				return nil
+			}
+			cf.RunFinalOptimizationFunc = func(ctx context.Context, timeout time.Duration) error {
+				return nil
+			}
+			config := &Config{
+				Logger:           logger,
+				CartoFacade:      &cf,
+				Lidar:            lidars[0],
+				AdditionalLidars: lidars[1:],
+				Timeout:          10 * time.Second,
+				JobSummary:       &JobSummary{},
+			}
+			result := config.StartOfflineSensorProcess(context.Background())
+			test.That(t, result.Cause, test.ShouldEqual, CauseDatasetExhausted)
+			test.That(t, added, test.ShouldResemble, append(names, names[0]))
+		})
+	}
+
+	t.Run("online the readings of a movement sensor are added with its exact name", func(t *testing.T) {
+		for _, name := range []string{"front imu", "cart:base/imu"} {
+			var added []string
+			cf := cartofacade.Mock{}
+			cf.AddIMUReadingFunc = func(ctx context.Context, timeout time.Duration, sensorName string,
+				currentReading s.TimedIMUReadingResponse,
+			) error {
+				added = append(added, sensorName)
+				return nil
+			}
+			cf.AddOdometerReadingFunc = func(ctx context.Context, timeout time.Duration, sensorName string,
+				currentReading s.TimedOdometerReadingResponse,
+			) error {
+				added = append(added, sensorName)
+				return nil
+			}
+			injectMovementSensor := inject.TimedMovementSensor{}
+			injectMovementSensor.NameFunc = func() string { return name }
+			config := Config{
+				Logger:         logger,
+				CartoFacade:    &cf,
+				IsOnline:       true,
+				MovementSensor: &injectMovementSensor,
+				Timeout:        10 * time.Second,
+			}
+			config.tryAddIMUReading(context.Background(), s.TimedIMUReadingResponse{ReadingTime: start})
+			config.tryAddOdometerReading(context.Background(), s.TimedOdometerReadingResponse{
+				Position:    geo.NewPoint(0, 0),
+				Orientation: spatialmath.NewZeroOrientation(),
+				ReadingTime: start,
+			})
+			test.That(t, added, test.ShouldResemble, []string{name, name})
+		}
+	})
+}
+
+func TestOutOfOrderReadings(t *testing.T) {
+	logger := logging.NewTestLogger(t)
+	readingTime := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	// readings repeat or go back in time after the second one
+	offsets := []time.Duration{0, time.Second, time.Second, 0, 2 * time.Second, time.Second}
+
+	var lidarTimes, imuTimes, odometerTimes []time.Time
+	cf := cartofacade.Mock{}
+	cf.AddLidarReadingFunc = func(ctx context.Context, timeout time.Duration, lidarName string,
+		currentReading s.TimedLidarReadingResponse,
+	) error {
+		lidarTimes = append(lidarTimes, currentReading.ReadingTime)
+		return nil
+	}
+	cf.AddIMUReadingFunc = func(ctx context.Context, timeout time.Duration, sensorName string,
+		currentReading s.TimedIMUReadingResponse,
+	) error {
+		imuTimes = append(imuTimes, currentReading.ReadingTime)
+		return nil
+	}
+	cf.AddOdometerReadingFunc = func(ctx context.Context, timeout time.Duration, sensorName string,
+		currentReading s.TimedOdometerReadingResponse,
+	) error {
+		odometerTimes = append(odometerTimes, currentReading.ReadingTime)
+		return nil
+	}
+
+	injectLidar := inject.TimedLidar{}
+	injectLidar.NameFunc = func() string { return "good_lidar" }
+	injectLidar.DataFrequencyHzFunc = func() int { return 5 }
+	injectMovementSensor := inject.TimedMovementSensor{}
+	injectMovementSensor.NameFunc = func() string { return "good_movement_sensor" }
+	injectMovementSensor.DataFrequencyHzFunc = func() int { return 20 }
+	injectMovementSensor.PropertiesFunc = func() s.MovementSensorProperties {
+		return s.MovementSensorProperties{IMUSupported: true, OdometerSupported: true}
+	}
+	config := Config{
+		Logger:         logger,
+		CartoFacade:    &cf,
+		IsOnline:       true,
+		Lidar:          &injectLidar,
+		MovementSensor: &injectMovementSensor,
+		Timeout:        10 * time.Second,
+		SensorStats:    &SensorStats{IsOnline: true},
+	}
+
+	for _, offset := range offsets {
+		at := readingTime.Add(offset)
+		config.tryAddLidarReadingOnce(context.Background(), s.TimedLidarReadingResponse{ReadingTime: at})
+		config.tryAddMovementSensorReadingOnce(context.Background(), s.TimedMovementSensorReadingResponse{
+			TimedIMUResponse: &s.TimedIMUReadingResponse{ReadingTime: at},
+			TimedOdometerResponse: &s.TimedOdometerReadingResponse{
+				Position:    geo.NewPoint(0, 0),
+				Orientation: spatialmath.NewZeroOrientation(),
+				ReadingTime: at,
+			},
+		})
+	}
+
+	expectedTimes := []time.Time{readingTime, readingTime.Add(time.Second), readingTime.Add(2 * time.Second)}
+	test.That(t, lidarTimes, test.ShouldResemble, expectedTimes)
+	test.That(t, imuTimes, test.ShouldResemble, expectedTimes)
+	test.That(t, odometerTimes, test.ShouldResemble, expectedTimes)
+
+	stats := config.SensorStats.ToMap()
+	for _, sensor := range []string{LidarSensor, IMUSensor, OdometerSensor} {
+		counters := stats[sensor].(map[string]interface{})
+		test.That(t, counters["readings_attempted"], test.ShouldEqual, int64(3))
+		test.That(t, counters["readings_added"], test.ShouldEqual, int64(3))
+		test.That(t, counters["out_of_order_dropped"], test.ShouldEqual, int64(3))
+	}
+
+	t.Run("an out of order reading is skipped rather than retried in offline mode", func(t *testing.T) {
+		numAttempts := 0
+		cf.AddLidarReadingFunc = func(ctx context.Context, timeout time.Duration, lidarName string,
+			currentReading s.TimedLidarReadingResponse,
+		) error {
+			numAttempts++
+			return nil
+		}
+		config.IsOnline = false
+		err := config.tryAddLidarReadingUntilSuccess(context.Background(), s.TimedLidarReadingResponse{
+			ReadingTime: readingTime.Add(time.Second),
+		})
+		test.That(t, err, test.ShouldBeError, errReadingOutOfOrder)
+		test.That(t, numAttempts, test.ShouldEqual, 0)
+	})
+}
@@ -0,0 +1,200 @@
+package sensorprocess
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/viam-modules/viam-cartographer/cartofacade"
+)
+
+// SensorStats counts, per sensor, the attempts to add readings to the cartofacade and their outcomes, and in
+// offline mode how many readings were inserted and when the end of a dataset was reached. It is safe for
+// concurrent use by the lidar and movement sensor processes.
+type SensorStats struct {
+	// IsOnline leaves out the offline stats.
+	IsOnline bool
+
+	lidar    sensorCounters
+	imu      sensorCounters
+	odometer sensorCounters
+	// additionalLidars holds the counters of the additional lidars by name, which are created on their first
+	// reading.
+	additionalLidarsMu sync.Mutex
+	additionalLidars   map[string]*sensorCounters
+
+	numInsertedReadings atomic.Int64
+	// endOfDatasetAt is the wall clock time in unix nanoseconds the end of a dataset was reached, or 0.
+	endOfDatasetAt atomic.Int64
+}
+
+// sensorCounters count the attempts to add the readings of a sensor to the cartofacade.
+type sensorCounters struct {
+	attempted     atomic.Int64
+	added         atomic.Int64
+	lockErrors    atomic.Int64
+	unknownErrors atomic.Int64
+	// bufferDropped counts the readings that were dropped from the full buffer of LidarBufferSize or
+	// MovementSensorBufferSize online.
+	bufferDropped atomic.Int64
+	// outOfOrderDropped counts the readings that were dropped rather than attempted, as they were not newer than
+	// the last reading added.
+	outOfOrderDropped atomic.Int64
+	// lastReadingTime is the reading time in unix nanoseconds of the last reading that was attempted, or 0.
+	lastReadingTime atomic.Int64
+}
+
+// record counts an attempt to add a reading taken at readingTime that failed with err, if it is not nil.
+func (counters *sensorCounters) record(readingTime time.Time, err error) {
+	counters.attempted.Add(1)
+	counters.lastReadingTime.Store(readingTime.UnixNano())
+	switch {
+	case err == nil:
+		counters.added.Add(1)
+	case errors.Is(err, cartofacade.ErrUnableToAcquireLock):
+		counters.lockErrors.Add(1)
+	default:
+		counters.unknownErrors.Add(1)
+	}
+}
+
+func (counters *sensorCounters) toMap() map[string]interface{} {
+	resp := map[string]interface{}{
+		"readings_attempted":   counters.attempted.Load(),
+		"readings_added":       counters.added.Load(),
+		"lock_errors":          counters.lockErrors.Load(),
+		"unknown_errors":       counters.unknownErrors.Load(),
+		"buffer_dropped":       counters.bufferDropped.Load(),
+		"out_of_order_dropped": counters.outOfOrderDropped.Load(),
+	}
+	if lastReadingTime := counters.lastReadingTime.Load(); lastReadingTime != 0 {
+		resp["last_reading_time"] = time.Unix(0, lastReadingTime).UTC().Format(time.RFC3339Nano)
+	}
+	return resp
+}
+
+// ToMap returns the stats in the format of a DoCommand response. The offline entry is only held in offline mode.
+func (stats *SensorStats) ToMap() map[string]interface{} {
+	resp := map[string]interface{}{
+		LidarSensor:    stats.lidar.toMap(),
+		IMUSensor:      stats.imu.toMap(),
+		OdometerSensor: stats.odometer.toMap(),
+	}
+	stats.additionalLidarsMu.Lock()
+	if len(stats.additionalLidars) > 0 {
+		additionalLidars := map[string]interface{}{}
+		for name, counters := range stats.additionalLidars {
+			additionalLidars[name] = counters.toMap()
+		}
+		resp["additional_lidars"] = additionalLidars
+	}
+	stats.additionalLidarsMu.Unlock()
+	if !stats.IsOnline {
+		offline := map[string]interface{}{"readings_inserted": stats.numInsertedReadings.Load()}
+		if endOfDatasetAt := stats.endOfDatasetAt.Load(); endOfDatasetAt != 0 {
+			offline["end_of_dataset_at"] = time.Unix(0, endOfDatasetAt).UTC().Format(time.RFC3339Nano)
+		}
+		resp["offline"] = offline
+	}
+	return resp
+}
+
+// LastLidarReadingTime returns the reading time of the last reading of the first lidar that was attempted, or the
+// zero time if there was none.
+func (stats *SensorStats) LastLidarReadingTime() time.Time {
+	lastReadingTime := stats.lidar.lastReadingTime.Load()
+	if lastReadingTime == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, lastReadingTime)
+}
+
+// lidarCounters returns the counters of Lidar, which are those of the lidar entry for the first lidar and of the
+// additional lidars entry for the others.
+func (config *Config) lidarCounters() *sensorCounters {
+	stats := config.SensorStats
+	if !config.additionalLidar {
+		return &stats.lidar
+	}
+	stats.additionalLidarsMu.Lock()
+	defer stats.additionalLidarsMu.Unlock()
+	if stats.additionalLidars == nil {
+		stats.additionalLidars = map[string]*sensorCounters{}
+	}
+	counters, ok := stats.additionalLidars[config.Lidar.Name()]
+	if !ok {
+		counters = &sensorCounters{}
+		stats.additionalLidars[config.Lidar.Name()] = counters
+	}
+	return counters
+}
+
+// recordLidarReading counts an attempt to add a lidar reading taken at readingTime, which failed with err if it is
+// not nil.
+func (config *Config) recordLidarReading(readingTime time.Time, err error) {
+	if config.SensorStats != nil {
+		config.lidarCounters().record(readingTime, err)
+	}
+}
+
+// recordIMUReading counts an attempt to add an IMU reading taken at readingTime, which failed with err if it is
+// not nil.
+func (config *Config) recordIMUReading(readingTime time.Time, err error) {
+	if config.SensorStats != nil {
+		config.SensorStats.imu.record(readingTime, err)
+	}
+}
+
+// recordOdometerReading counts an attempt to add an odometer reading taken at readingTime, which failed with err
+// if it is not nil.
+func (config *Config) recordOdometerReading(readingTime time.Time, err error) {
+	if config.SensorStats != nil {
+		config.SensorStats.odometer.record(readingTime, err)
+	}
+}
+
+// recordDroppedReading counts a reading of the sensor of sensorType that was dropped from its full buffer.
+func (config *Config) recordDroppedReading(sensorType string) {
+	if config.SensorStats == nil {
+		return
+	}
+	switch sensorType {
+	case LidarSensor:
+		config.lidarCounters().bufferDropped.Add(1)
+	case IMUSensor:
+		config.SensorStats.imu.bufferDropped.Add(1)
+	case OdometerSensor:
+		config.SensorStats.odometer.bufferDropped.Add(1)
+	}
+}
+
+// recordOutOfOrderReading counts a reading of the sensor of sensorType that was dropped as it was not newer than
+// the last reading added.
+func (config *Config) recordOutOfOrderReading(sensorType string) {
+	if config.SensorStats == nil {
+		return
+	}
+	switch sensorType {
+	case LidarSensor:
+		config.lidarCounters().outOfOrderDropped.Add(1)
+	case IMUSensor:
+		config.SensorStats.imu.outOfOrderDropped.Add(1)
+	case OdometerSensor:
+		config.SensorStats.odometer.outOfOrderDropped.Add(1)
+	}
+}
+
+// recordInsertedReading counts a reading that was inserted in offline mode.
+func (config *Config) recordInsertedReading() {
+	if config.SensorStats != nil {
+		config.SensorStats.numInsertedReadings.Add(1)
+	}
+}
+
+// recordEndOfDataset records that the end of a dataset was reached in offline mode.
+func (config *Config) recordEndOfDataset() {
+	if config.SensorStats != nil {
+		config.SensorStats.endOfDatasetAt.CompareAndSwap(0, time.Now().UnixNano())
+	}
+}
@@ -0,0 +1,156 @@
+package sensorprocess
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/golang/geo/r3"
+	geo "github.com/kellydunn/golang-geo"
+	"go.viam.com/rdk/logging"
+	"go.viam.com/rdk/spatialmath"
+	"go.viam.com/test"
+
+	"github.com/viam-modules/viam-cartographer/cartofacade"
+	s "github.com/viam-modules/viam-cartographer/sensors"
+	"github.com/viam-modules/viam-cartographer/sensors/inject"
+	"github.com/viam-modules/viam-cartographer/testhelper/pcdtest"
+)
+
+func TestSensorStats(t *testing.T) {
+	logger := logging.NewTestLogger(t)
+	readingTime := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	t.Run("the attempts to add readings are counted by their outcome", func(t *testing.T) {
+		errs := []error{nil, cartofacade.ErrUnableToAcquireLock, errors.New("unknown"), nil}
+		next := func() error {
+			err := errs[0]
+			errs = append(errs[1:], errs[0])
+			return err
+		}
+		cf := cartofacade.Mock{}
+		cf.AddLidarReadingFunc = func(ctx context.Context, timeout time.Duration, lidarName string,
+			currentReading s.TimedLidarReadingResponse,
+		) error {
+			return next()
+		}
+		cf.AddIMUReadingFunc = func(ctx context.Context, timeout time.Duration, sensorName string,
+			currentReading s.TimedIMUReadingResponse,
+		) error {
+			return next()
+		}
+		cf.AddOdometerReadingFunc = func(ctx context.Context, timeout time.Duration, sensorName string,
+			currentReading s.TimedOdometerReadingResponse,
+		) error {
+			return next()
+		}
+
+		injectLidar := inject.TimedLidar{}
+		injectLidar.NameFunc = func() string { return "good_lidar" }
+		injectMovementSensor := inject.TimedMovementSensor{}
+		injectMovementSensor.NameFunc = func() string { return "good_movement_sensor" }
+		injectMovementSensor.PropertiesFunc = func() s.MovementSensorProperties {
+			return s.MovementSensorProperties{IMUSupported: true, OdometerSupported: true}
+		}
+		config := Config{
+			Logger:         logger,
+			CartoFacade:    &cf,
+			IsOnline:       true,
+			Lidar:          &injectLidar,
+			MovementSensor: &injectMovementSensor,
+			Timeout:        10 * time.Second,
+			SensorStats:    &SensorStats{IsOnline: true},
+		}
+		test.That(t, config.SensorStats.ToMap()[LidarSensor], test.ShouldResemble, map[string]interface{}{
+			"readings_attempted":   int64(0),
+			"readings_added":       int64(0),
+			"lock_errors":          int64(0),
+			"unknown_errors":       int64(0),
+			"buffer_dropped":       int64(0),
+			"out_of_order_dropped": int64(0),
+		})
+
+		for i := 0; i < len(errs); i++ {
+			at := readingTime.Add(time.Duration(i) * time.Second)
+			config.tryAddLidarReading(context.Background(), s.TimedLidarReadingResponse{ReadingTime: at})
+			config.tryAddIMUReading(context.Background(), s.TimedIMUReadingResponse{ReadingTime: at})
+			config.tryAddOdometerReading(context.Background(), s.TimedOdometerReadingResponse{
+				Position:    geo.NewPoint(0, 0),
+				Orientation: spatialmath.NewZeroOrientation(),
+				ReadingTime: at,
+			})
+		}
+
+		stats := config.SensorStats.ToMap()
+		for _, sensor := range []string{LidarSensor, IMUSensor, OdometerSensor} {
+			test.That(t, stats[sensor], test.ShouldResemble, map[string]interface{}{
+				"readings_attempted":   int64(4),
+				"readings_added":       int64(2),
+				"lock_errors":          int64(1),
+				"unknown_errors":       int64(1),
+				"buffer_dropped":       int64(0),
+				"out_of_order_dropped": int64(0),
+				"last_reading_time":    "2024-01-01T12:00:03Z",
+			})
+		}
+		_, ok := stats["offline"]
+		test.That(t, ok, test.ShouldBeFalse)
+	})
+
+	t.Run("the offline sensor process counts the inserted readings and the end of the dataset", func(t *testing.T) {
+		dir := t.TempDir()
+		for i := 0; i < 3; i++ {
+			reading := pcdtest.PointsToPCD(t, []r3.Vector{{X: float64(1000 + i)}})
+			_, err := s.WriteLidarDatasetFrame(dir, strconv.Itoa(i), reading, s.NoDatasetCompression)
+			test.That(t, err, test.ShouldBeNil)
+		}
+		framePaths, err := s.ListLidarDatasetFrames(dir)
+		test.That(t, err, test.ShouldBeNil)
+
+		numAttempts := 0
+		cf := cartofacade.Mock{}
+		cf.AddLidarReadingFunc = func(ctx context.Context, timeout time.Duration,
+			lidarName string, currentReading s.TimedLidarReadingResponse,
+		) error {
+			// every reading is retried once after failing for lock contention
+			numAttempts++
+			if numAttempts%2 == 1 {
+				return cartofacade.ErrUnableToAcquireLock
+			}
+			return nil
+		}
+		cf.RunFinalOptimizationFunc = func(ctx context.Context, timeout time.Duration) error {
+			return nil
+		}
+		config := Config{
+			Logger:      logger,
+			CartoFacade: &cf,
+			Lidar:       datasetLidar(framePaths, readingTime, time.Second),
+			Timeout:     10 * time.Second,
+			SensorStats: &SensorStats{},
+		}
+
+		before := time.Now()
+		result := config.StartOfflineSensorProcess(context.Background())
+		test.That(t, result.Cause, test.ShouldEqual, CauseDatasetExhausted)
+
+		stats := config.SensorStats.ToMap()
+		test.That(t, stats[LidarSensor], test.ShouldResemble, map[string]interface{}{
+			"readings_attempted":   int64(6),
+			"readings_added":       int64(3),
+			"lock_errors":          int64(3),
+			"unknown_errors":       int64(0),
+			"buffer_dropped":       int64(0),
+			"out_of_order_dropped": int64(0),
+			"last_reading_time":    "2024-01-01T12:00:02Z",
+		})
+		offline, ok := stats["offline"].(map[string]interface{})
+		test.That(t, ok, test.ShouldBeTrue)
+		test.That(t, offline["readings_inserted"], test.ShouldEqual, int64(3))
+		endOfDatasetAt, err := time.Parse(time.RFC3339Nano, offline["end_of_dataset_at"].(string))
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, endOfDatasetAt.Before(before), test.ShouldBeFalse)
+	})
+}
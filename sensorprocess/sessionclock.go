@@ -0,0 +1,46 @@
+package sensorprocess
+
+import (
+	"sync"
+	"time"
+)
+
+// SessionEpoch is the time the first reading of a session is rebased to when timestamps are rebased.
+var SessionEpoch = time.Unix(0, 0).UTC()
+
+// SessionClock rebases reading times to a session relative epoch: the first reading that is rebased is
+// placed at SessionEpoch and all later readings keep their offset to it. It is safe for concurrent use by
+// the lidar and movement sensor processes.
+type SessionClock struct {
+	mu        sync.Mutex
+	started   bool
+	startTime time.Time
+}
+
+// Rebase returns readingTime relative to the session epoch. The first call starts the session.
+func (clock *SessionClock) Rebase(readingTime time.Time) time.Time {
+	clock.mu.Lock()
+	defer clock.mu.Unlock()
+	if !clock.started {
+		clock.started = true
+		clock.startTime = readingTime
+	}
+	return SessionEpoch.Add(readingTime.Sub(clock.startTime))
+}
+
+// StartTime returns the wall clock time of the first rebased reading, i.e. the wall clock time that
+// corresponds to SessionEpoch, and whether the session has started. A rebased time t can be converted back
+// to wall clock time with StartTime().Add(t.Sub(SessionEpoch)).
+func (clock *SessionClock) StartTime() (time.Time, bool) {
+	clock.mu.Lock()
+	defer clock.mu.Unlock()
+	return clock.startTime, clock.started
+}
+
+// rebaseReadingTime rebases readingTime if the config has a session clock and returns it unchanged otherwise.
+func (config *Config) rebaseReadingTime(readingTime time.Time) time.Time {
+	if config.SessionClock == nil {
+		return readingTime
+	}
+	return config.SessionClock.Rebase(readingTime)
+}
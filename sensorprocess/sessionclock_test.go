@@ -0,0 +1,125 @@
+package sensorprocess
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.viam.com/rdk/logging"
+	"go.viam.com/test"
+
+	"github.com/viam-modules/viam-cartographer/cartofacade"
+	s "github.com/viam-modules/viam-cartographer/sensors"
+	"github.com/viam-modules/viam-cartographer/sensors/inject"
+)
+
+func TestSessionClock(t *testing.T) {
+	// wall clock that was wrong at boot
+	startTime := time.Date(1970, 1, 3, 4, 5, 6, 7000000, time.UTC)
+
+	t.Run("session has not started before the first reading", func(t *testing.T) {
+		clock := SessionClock{}
+		_, started := clock.StartTime()
+		test.That(t, started, test.ShouldBeFalse)
+	})
+
+	t.Run("first reading is the session epoch and later readings keep their offset", func(t *testing.T) {
+		clock := SessionClock{}
+		test.That(t, clock.Rebase(startTime), test.ShouldEqual, SessionEpoch)
+		test.That(t, clock.Rebase(startTime.Add(250*time.Millisecond)), test.ShouldEqual, SessionEpoch.Add(250*time.Millisecond))
+		test.That(t, clock.Rebase(startTime.Add(-time.Second)), test.ShouldEqual, SessionEpoch.Add(-time.Second))
+
+		recordedStartTime, started := clock.StartTime()
+		test.That(t, started, test.ShouldBeTrue)
+		test.That(t, recordedStartTime, test.ShouldEqual, startTime)
+	})
+
+	t.Run("rebased times convert back to wall clock times", func(t *testing.T) {
+		clock := SessionClock{}
+		readingTime := startTime.Add(90 * time.Minute)
+		clock.Rebase(startTime)
+		rebased := clock.Rebase(readingTime)
+
+		recordedStartTime, _ := clock.StartTime()
+		test.That(t, recordedStartTime.Add(rebased.Sub(SessionEpoch)), test.ShouldEqual, readingTime)
+	})
+}
+
+func TestRebasedReadingsAreAddedToCartoFacade(t *testing.T) {
+	logger := logging.NewTestLogger(t)
+	cf := cartofacade.Mock{}
+	startTime := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	var lidarCalls []addLidarReadingArgs
+	cf.AddLidarReadingFunc = func(
+		ctx context.Context,
+		timeout time.Duration,
+		sensorName string,
+		currentReading s.TimedLidarReadingResponse,
+	) error {
+		lidarCalls = append(lidarCalls, addLidarReadingArgs{timeout: timeout, sensorName: sensorName, currentReading: currentReading})
+		return nil
+	}
+	var imuCalls []addIMUReadingArgs
+	cf.AddIMUReadingFunc = func(
+		ctx context.Context,
+		timeout time.Duration,
+		sensorName string,
+		currentReading s.TimedIMUReadingResponse,
+	) error {
+		imuCalls = append(imuCalls, addIMUReadingArgs{timeout: timeout, sensorName: sensorName, currentReading: currentReading})
+		return nil
+	}
+	var odometerCalls []addOdometerReadingArgs
+	cf.AddOdometerReadingFunc = func(
+		ctx context.Context,
+		timeout time.Duration,
+		sensorName string,
+		currentReading s.TimedOdometerReadingResponse,
+	) error {
+		odometerCalls = append(odometerCalls, addOdometerReadingArgs{timeout: timeout, sensorName: sensorName, currentReading: currentReading})
+		return nil
+	}
+
+	injectLidar := inject.TimedLidar{}
+	injectLidar.NameFunc = func() string { return "good_lidar" }
+	injectLidar.DataFrequencyHzFunc = func() int { return 5 }
+	injectMovementSensor := inject.TimedMovementSensor{}
+	injectMovementSensor.NameFunc = func() string { return "good_movement_sensor" }
+	injectMovementSensor.DataFrequencyHzFunc = func() int { return 20 }
+	injectMovementSensor.PropertiesFunc = func() s.MovementSensorProperties {
+		return s.MovementSensorProperties{IMUSupported: true, OdometerSupported: true}
+	}
+
+	config := Config{
+		Logger:         logger,
+		CartoFacade:    &cf,
+		IsOnline:       true,
+		Lidar:          &injectLidar,
+		MovementSensor: &injectMovementSensor,
+		SessionClock:   &SessionClock{},
+		Timeout:        10 * time.Second,
+	}
+
+	config.tryAddLidarReadingOnce(context.Background(), s.TimedLidarReadingResponse{Reading: []byte("12345"), ReadingTime: startTime})
+	config.tryAddMovementSensorReadingOnce(context.Background(), s.TimedMovementSensorReadingResponse{
+		TimedIMUResponse:      &s.TimedIMUReadingResponse{ReadingTime: startTime.Add(60 * time.Millisecond)},
+		TimedOdometerResponse: &s.TimedOdometerReadingResponse{ReadingTime: startTime.Add(50 * time.Millisecond)},
+	})
+	config.tryAddLidarReadingOnce(context.Background(), s.TimedLidarReadingResponse{
+		Reading:     []byte("12345"),
+		ReadingTime: startTime.Add(200 * time.Millisecond),
+	})
+
+	test.That(t, len(lidarCalls), test.ShouldEqual, 2)
+	test.That(t, lidarCalls[0].currentReading.ReadingTime, test.ShouldEqual, SessionEpoch)
+	test.That(t, lidarCalls[1].currentReading.ReadingTime, test.ShouldEqual, SessionEpoch.Add(200*time.Millisecond))
+	test.That(t, len(odometerCalls), test.ShouldEqual, 1)
+	test.That(t, odometerCalls[0].currentReading.ReadingTime, test.ShouldEqual, SessionEpoch.Add(50*time.Millisecond))
+	test.That(t, len(imuCalls), test.ShouldEqual, 1)
+	test.That(t, imuCalls[0].currentReading.ReadingTime, test.ShouldEqual, SessionEpoch.Add(60*time.Millisecond))
+
+	recordedStartTime, started := config.SessionClock.StartTime()
+	test.That(t, started, test.ShouldBeTrue)
+	test.That(t, recordedStartTime, test.ShouldEqual, startTime)
+}
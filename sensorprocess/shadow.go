@@ -0,0 +1,146 @@
+package sensorprocess
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"go.viam.com/rdk/logging"
+
+	"github.com/viam-modules/viam-cartographer/cartofacade"
+	s "github.com/viam-modules/viam-cartographer/sensors"
+)
+
+const (
+	// shadowQueueSize is the number of readings that may be queued for the shadow cartofacade.
+	shadowQueueSize = 100
+	// shadowDropWarningInterval is the minimum time between two warnings about readings dropped for the shadow
+	// cartofacade as its queue is full.
+	shadowDropWarningInterval = 10 * time.Second
+)
+
+// shadowReading is a reading queued for the shadow cartofacade.
+type shadowReading struct {
+	sensor string
+	add    func(ctx context.Context, shadow cartofacade.Interface) error
+}
+
+// ShadowMirror submits every reading that was added to the cartofacade to a shadow cartofacade, to compare an
+// alternative algo config side by side. The readings are queued and submitted in order by Run, so that a slow
+// shadow does not delay the sensor processes. Once the queue is full, online mode drops the readings for the shadow,
+// while offline mode waits for the shadow, so that it is submitted the whole dataset.
+type ShadowMirror struct {
+	CartoFacade cartofacade.Interface
+	Logger      logging.Logger
+	IsOnline    bool
+
+	queue      chan shadowReading
+	numDropped atomic.Int64
+	// lastDropWarning is the time of the last warning about dropped readings in unix nanoseconds, as the mirror
+	// is shared by pointer between the copies of a config.
+	lastDropWarning atomic.Int64
+}
+
+// NewShadowMirror returns a mirror to the shadow cartofacade cf, which submits nothing until Run is called.
+func NewShadowMirror(cf cartofacade.Interface, logger logging.Logger, isOnline bool) *ShadowMirror {
+	return &ShadowMirror{
+		CartoFacade: cf,
+		Logger:      logger,
+		IsOnline:    isOnline,
+		queue:       make(chan shadowReading, shadowQueueSize),
+	}
+}
+
+// Run submits the queued readings to the shadow cartofacade until ctx is done, calling heartbeat, if set, after
+// every reading. The readings still queued then are dropped.
+func (mirror *ShadowMirror) Run(ctx context.Context, heartbeat func()) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case reading := <-mirror.queue:
+			mirror.submit(ctx, reading)
+		}
+		if heartbeat != nil {
+			heartbeat()
+		}
+	}
+}
+
+// NumDropped returns the number of readings that were dropped for the shadow cartofacade as its queue was full.
+func (mirror *ShadowMirror) NumDropped() int64 {
+	return mirror.numDropped.Load()
+}
+
+// submit submits reading to the shadow cartofacade. Failures are only logged and the reading is never retried.
+func (mirror *ShadowMirror) submit(ctx context.Context, reading shadowReading) {
+	if err := reading.add(ctx, mirror.CartoFacade); err != nil {
+		if errors.Is(err, cartofacade.ErrUnableToAcquireLock) {
+			mirror.Logger.Debugw("Skipping "+reading.sensor+" reading for the shadow cartofacade due to lock contention",
+				"error", err)
+		} else {
+			mirror.Logger.Warnw("Skipping "+reading.sensor+" reading for the shadow cartofacade due to error", "error", err)
+		}
+	}
+}
+
+// enqueue queues reading for the shadow cartofacade. Once the queue is full, it drops the reading in online mode
+// and waits for room or for ctx to be done in offline mode.
+func (mirror *ShadowMirror) enqueue(ctx context.Context, reading shadowReading) {
+	if !mirror.IsOnline {
+		select {
+		case mirror.queue <- reading:
+		case <-ctx.Done():
+		}
+		return
+	}
+	select {
+	case mirror.queue <- reading:
+		return
+	default:
+	}
+	numDropped := mirror.numDropped.Add(1)
+	now := time.Now().UnixNano()
+	last := mirror.lastDropWarning.Load()
+	if time.Duration(now-last) >= shadowDropWarningInterval && mirror.lastDropWarning.CompareAndSwap(last, now) {
+		mirror.Logger.Warnw("Dropping "+reading.sensor+" reading for the shadow cartofacade as it is falling behind",
+			"queue_size", shadowQueueSize, "total_dropped", numDropped)
+	}
+}
+
+// mirrorReading queues a reading that was added to the cartofacade for the shadow cartofacade, if any.
+func (config *Config) mirrorReading(
+	ctx context.Context,
+	sensor string,
+	add func(ctx context.Context, shadow cartofacade.Interface) error,
+) {
+	if config.ShadowMirror == nil {
+		return
+	}
+	config.ShadowMirror.enqueue(ctx, shadowReading{sensor: sensor, add: add})
+}
+
+// mirrorLidarReading queues a lidar reading for the shadow cartofacade, if any.
+func (config *Config) mirrorLidarReading(ctx context.Context, reading s.TimedLidarReadingResponse) {
+	name, timeout := config.Lidar.Name(), config.Timeout
+	config.mirrorReading(ctx, "lidar", func(ctx context.Context, shadow cartofacade.Interface) error {
+		return shadow.AddLidarReading(ctx, timeout, name, reading)
+	})
+}
+
+// mirrorIMUReading queues an IMU reading for the shadow cartofacade, if any.
+func (config *Config) mirrorIMUReading(ctx context.Context, reading s.TimedIMUReadingResponse) {
+	name, timeout := config.MovementSensor.Name(), config.Timeout
+	config.mirrorReading(ctx, "IMU", func(ctx context.Context, shadow cartofacade.Interface) error {
+		return shadow.AddIMUReading(ctx, timeout, name, reading)
+	})
+}
+
+// mirrorOdometerReading queues an odometer reading for the shadow cartofacade, if any.
+func (config *Config) mirrorOdometerReading(ctx context.Context, reading s.TimedOdometerReadingResponse) {
+	name, timeout := config.MovementSensor.Name(), config.Timeout
+	config.mirrorReading(ctx, "odometer", func(ctx context.Context, shadow cartofacade.Interface) error {
+		return shadow.AddOdometerReading(ctx, timeout, name, reading)
+	})
+}
@@ -0,0 +1,226 @@
+package sensorprocess
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.viam.com/rdk/logging"
+	"go.viam.com/test"
+
+	"github.com/viam-modules/viam-cartographer/cartofacade"
+	s "github.com/viam-modules/viam-cartographer/sensors"
+	"github.com/viam-modules/viam-cartographer/sensors/inject"
+)
+
+// countingMock returns a cartofacade mock which counts the readings that were submitted to it and returns the
+// error returned by addErr for each of them.
+func countingMock(numReadings map[string]int, addErr func() error) *cartofacade.Mock {
+	cf := cartofacade.Mock{}
+	cf.AddLidarReadingFunc = func(ctx context.Context, timeout time.Duration,
+		lidarName string, currentReading s.TimedLidarReadingResponse,
+	) error {
+		numReadings["lidar"]++
+		return addErr()
+	}
+	cf.AddIMUReadingFunc = func(ctx context.Context, timeout time.Duration,
+		imuName string, currentReading s.TimedIMUReadingResponse,
+	) error {
+		numReadings["imu"]++
+		return addErr()
+	}
+	cf.AddOdometerReadingFunc = func(ctx context.Context, timeout time.Duration,
+		odometerName string, currentReading s.TimedOdometerReadingResponse,
+	) error {
+		numReadings["odometer"]++
+		return addErr()
+	}
+	return &cf
+}
+
+// submitQueued synchronously submits the readings that are queued for the shadow cartofacade of config.
+func submitQueued(config Config) {
+	for len(config.ShadowMirror.queue) > 0 {
+		config.ShadowMirror.submit(context.Background(), <-config.ShadowMirror.queue)
+	}
+}
+
+func TestShadowCartoFacade(t *testing.T) {
+	logger := logging.NewTestLogger(t)
+	now := time.Now().UTC()
+
+	injectLidar := inject.TimedLidar{}
+	injectLidar.NameFunc = func() string { return "good_lidar" }
+	injectLidar.DataFrequencyHzFunc = func() int { return 5 }
+	injectMovementSensor := inject.TimedMovementSensor{}
+	injectMovementSensor.NameFunc = func() string { return "good_movement_sensor" }
+	injectMovementSensor.DataFrequencyHzFunc = func() int { return 20 }
+	injectMovementSensor.PropertiesFunc = func() s.MovementSensorProperties {
+		return s.MovementSensorProperties{IMUSupported: true, OdometerSupported: true}
+	}
+
+	lidarReading := s.TimedLidarReadingResponse{Reading: []byte("12345"), ReadingTime: now}
+	movementSensorReading := s.TimedMovementSensorReadingResponse{
+		TimedIMUResponse:      &s.TimedIMUReadingResponse{ReadingTime: now.Add(10 * time.Millisecond)},
+		TimedOdometerResponse: &s.TimedOdometerReadingResponse{ReadingTime: now.Add(10 * time.Millisecond)},
+	}
+	// readings that are not newer than the last one added are dropped
+	laterLidarReading := s.TimedLidarReadingResponse{Reading: []byte("12345"), ReadingTime: now.Add(time.Second)}
+	laterMovementSensorReading := s.TimedMovementSensorReadingResponse{
+		TimedIMUResponse:      &s.TimedIMUReadingResponse{ReadingTime: now.Add(time.Second + 10*time.Millisecond)},
+		TimedOdometerResponse: &s.TimedOdometerReadingResponse{ReadingTime: now.Add(time.Second + 10*time.Millisecond)},
+	}
+
+	newConfig := func(primary, shadow cartofacade.Interface) Config {
+		config := Config{
+			Logger:         logger,
+			CartoFacade:    primary,
+			IsOnline:       true,
+			Lidar:          &injectLidar,
+			MovementSensor: &injectMovementSensor,
+			Timeout:        10 * time.Second,
+		}
+		if shadow != nil {
+			config.ShadowMirror = NewShadowMirror(shadow, logger, config.IsOnline)
+		}
+		return config
+	}
+
+	t.Run("every reading added to the primary is submitted to the shadow", func(t *testing.T) {
+		primaryReadings := map[string]int{}
+		shadowReadings := map[string]int{}
+		config := newConfig(
+			countingMock(primaryReadings, func() error { return nil }),
+			countingMock(shadowReadings, func() error { return nil }),
+		)
+
+		config.tryAddLidarReadingOnce(context.Background(), lidarReading)
+		config.tryAddMovementSensorReadingOnce(context.Background(), movementSensorReading)
+		test.That(t, config.tryAddLidarReadingUntilSuccess(context.Background(), laterLidarReading), test.ShouldBeNil)
+		test.That(t, config.tryAddMovementSensorReadingUntilSuccess(context.Background(), laterMovementSensorReading),
+			test.ShouldBeNil)
+		test.That(t, shadowReadings, test.ShouldBeEmpty)
+
+		submitQueued(config)
+		expectedReadings := map[string]int{"lidar": 2, "imu": 2, "odometer": 2}
+		test.That(t, primaryReadings, test.ShouldResemble, expectedReadings)
+		test.That(t, shadowReadings, test.ShouldResemble, expectedReadings)
+	})
+
+	t.Run("shadow failures are not retried and do not affect the primary", func(t *testing.T) {
+		primaryReadings := map[string]int{}
+		shadowReadings := map[string]int{}
+		config := newConfig(
+			countingMock(primaryReadings, func() error { return nil }),
+			countingMock(shadowReadings, func() error { return errors.New("shadow failure") }),
+		)
+
+		test.That(t, config.tryAddLidarReadingUntilSuccess(context.Background(), lidarReading), test.ShouldBeNil)
+		test.That(t, config.tryAddMovementSensorReadingUntilSuccess(context.Background(), movementSensorReading), test.ShouldBeNil)
+		submitQueued(config)
+
+		expectedReadings := map[string]int{"lidar": 1, "imu": 1, "odometer": 1}
+		test.That(t, primaryReadings, test.ShouldResemble, expectedReadings)
+		test.That(t, shadowReadings, test.ShouldResemble, expectedReadings)
+	})
+
+	t.Run("readings are submitted to the shadow once the primary added them", func(t *testing.T) {
+		primaryReadings := map[string]int{}
+		shadowReadings := map[string]int{}
+		numAttempts := 0
+		config := newConfig(
+			countingMock(primaryReadings, func() error {
+				numAttempts++
+				if numAttempts%2 == 1 {
+					return cartofacade.ErrUnableToAcquireLock
+				}
+				return nil
+			}),
+			countingMock(shadowReadings, func() error { return nil }),
+		)
+
+		config.tryAddLidarReadingOnce(context.Background(), lidarReading)
+		test.That(t, shadowReadings["lidar"], test.ShouldEqual, 0)
+
+		test.That(t, config.tryAddLidarReadingUntilSuccess(context.Background(), lidarReading), test.ShouldBeNil)
+		submitQueued(config)
+		test.That(t, primaryReadings["lidar"], test.ShouldEqual, 2)
+		test.That(t, shadowReadings["lidar"], test.ShouldEqual, 1)
+	})
+
+	t.Run("readings are dropped in online mode once the queue of a slow shadow is full", func(t *testing.T) {
+		primaryReadings := map[string]int{}
+		shadowReadings := map[string]int{}
+		config := newConfig(
+			countingMock(primaryReadings, func() error { return nil }),
+			countingMock(shadowReadings, func() error { return nil }),
+		)
+
+		for i := 0; i < shadowQueueSize+3; i++ {
+			config.mirrorLidarReading(context.Background(), lidarReading)
+		}
+		test.That(t, config.ShadowMirror.NumDropped(), test.ShouldEqual, 3)
+
+		submitQueued(config)
+		test.That(t, shadowReadings["lidar"], test.ShouldEqual, shadowQueueSize)
+	})
+
+	t.Run("offline mode waits for the shadow once its queue is full", func(t *testing.T) {
+		shadowReadings := map[string]int{}
+		config := newConfig(countingMock(map[string]int{}, func() error { return nil }), nil)
+		config.IsOnline = false
+		config.ShadowMirror = NewShadowMirror(countingMock(shadowReadings, func() error { return nil }), logger, false)
+
+		for i := 0; i < shadowQueueSize; i++ {
+			config.mirrorLidarReading(context.Background(), lidarReading)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		config.mirrorLidarReading(ctx, lidarReading)
+		test.That(t, ctx.Err(), test.ShouldNotBeNil)
+		test.That(t, config.ShadowMirror.NumDropped(), test.ShouldEqual, 0)
+
+		submitQueued(config)
+		test.That(t, shadowReadings["lidar"], test.ShouldEqual, shadowQueueSize)
+	})
+
+	t.Run("Run submits the queued readings in order until ctx is done", func(t *testing.T) {
+		submitted := make(chan time.Time, 3)
+		shadow := cartofacade.Mock{}
+		shadow.AddLidarReadingFunc = func(ctx context.Context, timeout time.Duration,
+			lidarName string, currentReading s.TimedLidarReadingResponse,
+		) error {
+			submitted <- currentReading.ReadingTime
+			return nil
+		}
+		config := newConfig(countingMock(map[string]int{}, func() error { return nil }), &shadow)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			config.ShadowMirror.Run(ctx, nil)
+			close(done)
+		}()
+
+		for i := 0; i < 3; i++ {
+			reading := lidarReading
+			reading.ReadingTime = now.Add(time.Duration(i) * time.Second)
+			config.mirrorLidarReading(context.Background(), reading)
+		}
+		for i := 0; i < 3; i++ {
+			test.That(t, <-submitted, test.ShouldEqual, now.Add(time.Duration(i)*time.Second))
+		}
+
+		cancel()
+		<-done
+	})
+
+	t.Run("nothing is submitted without a shadow", func(t *testing.T) {
+		primaryReadings := map[string]int{}
+		config := newConfig(countingMock(primaryReadings, func() error { return nil }), nil)
+
+		config.tryAddLidarReadingOnce(context.Background(), lidarReading)
+		test.That(t, primaryReadings["lidar"], test.ShouldEqual, 1)
+	})
+}
@@ -36,17 +36,17 @@ type addOdometerReadingArgs struct {
 
 var (
 	//nolint:dupword
-	expectedPCD = []byte(`VERSION .7
+	expectedPCD = append([]byte(`VERSION .7
 FIELDS x y z
 SIZE 4 4 4
 TYPE F F F
 COUNT 1 1 1
-WIDTH 0
+WIDTH 1
 HEIGHT 1
 VIEWPOINT 0 0 0 1 0 0 0
-POINTS 0
+POINTS 1
 DATA binary
-`)
+`), "\x00\x00\x80?\x00\x00\x00\x00\x00\x00\x00\x00"...)
 
 	errUnknown = errors.New("unknown error")
 )
@@ -169,7 +169,7 @@ func validAddMovementSensorReadingInOnlineTestHelper(
 	logger := logging.NewTestLogger(t)
 	dataFrequencyHz := 100
 	movementSensor, err := s.NewMovementSensor(context.Background(), s.SetupDeps(s.NoLidar, testMovementSensor),
-		string(testMovementSensor), dataFrequencyHz, logger)
+		string(testMovementSensor), dataFrequencyHz, s.DegreesPerSecond, logger)
 	test.That(t, err, test.ShouldBeNil)
 
 	var imuCalls []addIMUReadingArgs
@@ -287,7 +287,7 @@ func invalidAddMovementSensorReadingInOnlineTestHelper(
 	lidarFrequencyHz := 10
 	movementSensorFrequencyHz := 10
 	movementSensor, err := s.NewMovementSensor(context.Background(), s.SetupDeps(s.NoLidar, testMovementSensor),
-		string(testMovementSensor), movementSensorFrequencyHz, logger)
+		string(testMovementSensor), movementSensorFrequencyHz, s.DegreesPerSecond, logger)
 	test.That(t, err, test.ShouldBeNil)
 
 	var imuCalls []addIMUReadingArgs
@@ -345,7 +345,7 @@ func validAddMovementSensorReadingUntilSuccessTestHelper(
 	logger := logging.NewTestLogger(t)
 	dataFrequencyHz := 0
 	movementSensor, err := s.NewMovementSensor(context.Background(), s.SetupDeps(s.NoLidar, testMovementSensor),
-		string(testMovementSensor), dataFrequencyHz, logger)
+		string(testMovementSensor), dataFrequencyHz, s.DegreesPerSecond, logger)
 	test.That(t, err, test.ShouldBeNil)
 
 	var imuCalls []addIMUReadingArgs
@@ -465,6 +465,17 @@ func tryAddMovementSensorReadingOnceTestHelper(
 			ReadingTime: now,
 		}
 	}
+	// every reading is newer than the last one, as readings that are not newer than the last one added are dropped
+	nextMovementSensorReading := func() s.TimedMovementSensorReadingResponse {
+		now = now.Add(time.Second)
+		if movementSensorReading.TimedIMUResponse != nil {
+			movementSensorReading.TimedIMUResponse.ReadingTime = now
+		}
+		if movementSensorReading.TimedOdometerResponse != nil {
+			movementSensorReading.TimedOdometerResponse.ReadingTime = now
+		}
+		return movementSensorReading
+	}
 
 	if config.MovementSensor.Properties().IMUSupported {
 		// In case that the odometer is also supported, let's assume it works fast and efficiently for all the
@@ -496,7 +507,7 @@ func tryAddMovementSensorReadingOnceTestHelper(
 				return nil
 			}
 
-			timeToSleep := config.tryAddMovementSensorReadingOnce(context.Background(), movementSensorReading)
+			timeToSleep := config.tryAddMovementSensorReadingOnce(context.Background(), nextMovementSensorReading())
 			test.That(t, timeToSleep, test.ShouldEqual, 0)
 
 			if config.MovementSensor.Properties().IMUSupported {
@@ -522,7 +533,7 @@ func tryAddMovementSensorReadingOnceTestHelper(
 				return cartofacade.ErrUnableToAcquireLock
 			}
 
-			timeToSleep := config.tryAddMovementSensorReadingOnce(context.Background(), movementSensorReading)
+			timeToSleep := config.tryAddMovementSensorReadingOnce(context.Background(), nextMovementSensorReading())
 			test.That(t, timeToSleep, test.ShouldEqual, 0)
 		})
 
@@ -537,7 +548,7 @@ func tryAddMovementSensorReadingOnceTestHelper(
 				return errUnknown
 			}
 
-			timeToSleep := config.tryAddMovementSensorReadingOnce(context.Background(), movementSensorReading)
+			timeToSleep := config.tryAddMovementSensorReadingOnce(context.Background(), nextMovementSensorReading())
 			test.That(t, timeToSleep, test.ShouldEqual, 0)
 		})
 
@@ -551,7 +562,7 @@ func tryAddMovementSensorReadingOnceTestHelper(
 				return nil
 			}
 
-			timeToSleep := config.tryAddMovementSensorReadingOnce(context.Background(), movementSensorReading)
+			timeToSleep := config.tryAddMovementSensorReadingOnce(context.Background(), nextMovementSensorReading())
 			test.That(t, timeToSleep, test.ShouldBeGreaterThan, 0)
 			test.That(t, timeToSleep, test.ShouldBeLessThanOrEqualTo, 1000/config.MovementSensor.DataFrequencyHz())
 		})
@@ -566,7 +577,7 @@ func tryAddMovementSensorReadingOnceTestHelper(
 				return cartofacade.ErrUnableToAcquireLock
 			}
 
-			timeToSleep := config.tryAddMovementSensorReadingOnce(context.Background(), movementSensorReading)
+			timeToSleep := config.tryAddMovementSensorReadingOnce(context.Background(), nextMovementSensorReading())
 			test.That(t, timeToSleep, test.ShouldBeGreaterThan, 0)
 			test.That(t, timeToSleep, test.ShouldBeLessThanOrEqualTo, 1000/config.MovementSensor.DataFrequencyHz())
 		})
@@ -582,7 +593,7 @@ func tryAddMovementSensorReadingOnceTestHelper(
 				return errUnknown
 			}
 
-			timeToSleep := config.tryAddMovementSensorReadingOnce(context.Background(), movementSensorReading)
+			timeToSleep := config.tryAddMovementSensorReadingOnce(context.Background(), nextMovementSensorReading())
 			test.That(t, timeToSleep, test.ShouldBeGreaterThan, 0)
 			test.That(t, timeToSleep, test.ShouldBeLessThanOrEqualTo, 1000/config.MovementSensor.DataFrequencyHz())
 		})
@@ -618,7 +629,7 @@ func tryAddMovementSensorReadingOnceTestHelper(
 				return nil
 			}
 
-			timeToSleep := config.tryAddMovementSensorReadingOnce(context.Background(), movementSensorReading)
+			timeToSleep := config.tryAddMovementSensorReadingOnce(context.Background(), nextMovementSensorReading())
 			test.That(t, timeToSleep, test.ShouldEqual, 0)
 
 			if config.MovementSensor.Properties().OdometerSupported {
@@ -646,7 +657,7 @@ func tryAddMovementSensorReadingOnceTestHelper(
 				return cartofacade.ErrUnableToAcquireLock
 			}
 
-			timeToSleep := config.tryAddMovementSensorReadingOnce(context.Background(), movementSensorReading)
+			timeToSleep := config.tryAddMovementSensorReadingOnce(context.Background(), nextMovementSensorReading())
 			test.That(t, timeToSleep, test.ShouldEqual, 0)
 		})
 
@@ -662,7 +673,7 @@ func tryAddMovementSensorReadingOnceTestHelper(
 				return errUnknown
 			}
 
-			timeToSleep := config.tryAddMovementSensorReadingOnce(context.Background(), movementSensorReading)
+			timeToSleep := config.tryAddMovementSensorReadingOnce(context.Background(), nextMovementSensorReading())
 			test.That(t, timeToSleep, test.ShouldEqual, 0)
 		})
 
@@ -676,7 +687,7 @@ func tryAddMovementSensorReadingOnceTestHelper(
 				return nil
 			}
 
-			timeToSleep := config.tryAddMovementSensorReadingOnce(context.Background(), movementSensorReading)
+			timeToSleep := config.tryAddMovementSensorReadingOnce(context.Background(), nextMovementSensorReading())
 			test.That(t, timeToSleep, test.ShouldBeGreaterThan, 0)
 			test.That(t, timeToSleep, test.ShouldBeLessThanOrEqualTo, 1000/config.MovementSensor.DataFrequencyHz())
 		})
@@ -692,7 +703,7 @@ func tryAddMovementSensorReadingOnceTestHelper(
 				return cartofacade.ErrUnableToAcquireLock
 			}
 
-			timeToSleep := config.tryAddMovementSensorReadingOnce(context.Background(), movementSensorReading)
+			timeToSleep := config.tryAddMovementSensorReadingOnce(context.Background(), nextMovementSensorReading())
 			test.That(t, timeToSleep, test.ShouldBeGreaterThan, 0)
 			test.That(t, timeToSleep, test.ShouldBeLessThanOrEqualTo, 1000/config.MovementSensor.DataFrequencyHz())
 		})
@@ -708,7 +719,7 @@ func tryAddMovementSensorReadingOnceTestHelper(
 				return errUnknown
 			}
 
-			timeToSleep := config.tryAddMovementSensorReadingOnce(context.Background(), movementSensorReading)
+			timeToSleep := config.tryAddMovementSensorReadingOnce(context.Background(), nextMovementSensorReading())
 			test.That(t, timeToSleep, test.ShouldBeGreaterThan, 0)
 			test.That(t, timeToSleep, test.ShouldBeLessThanOrEqualTo, 1000/config.MovementSensor.DataFrequencyHz())
 		})
@@ -0,0 +1,131 @@
+package sensors
+
+import (
+	"bytes"
+	"math"
+
+	"github.com/golang/geo/r2"
+	"github.com/golang/geo/r3"
+	"github.com/pkg/errors"
+	"go.viam.com/rdk/pointcloud"
+	"go.viam.com/rdk/spatialmath"
+)
+
+const (
+	// metersToMillimeters converts distances in meters, the unit of PCD files, to the millimeters used by
+	// pointclouds, mapping bounds and poses.
+	metersToMillimeters = 1000
+	// boundaryTolerance is the distance in millimeters within which a point is considered to lie on the boundary.
+	boundaryTolerance = 1e-6
+)
+
+// ErrInvalidMappingBounds denotes that mapping bounds do not describe a region with a non zero area.
+var ErrInvalidMappingBounds = errors.New("mapping bounds must have at least three vertices enclosing a non zero area")
+
+// MappingBounds is a 2D region in the map frame, in millimeters, that lidar scans are clipped to before
+// they are added to cartographer. Points on the boundary are inside the region.
+type MappingBounds struct {
+	vertices []r2.Point
+	// ClipPointCloudMap denotes whether PointCloudMap output should be clipped to the region as well.
+	ClipPointCloudMap bool
+}
+
+// NewMappingBounds returns mapping bounds enclosed by the polygon with the given vertices.
+func NewMappingBounds(vertices []r2.Point, clipPointCloudMap bool) (*MappingBounds, error) {
+	if len(vertices) < 3 {
+		return nil, ErrInvalidMappingBounds
+	}
+	var area float64
+	for i, v := range vertices {
+		next := vertices[(i+1)%len(vertices)]
+		area += v.Cross(next)
+	}
+	if area == 0 || math.IsNaN(area) || math.IsInf(area, 0) {
+		return nil, ErrInvalidMappingBounds
+	}
+	return &MappingBounds{vertices: append([]r2.Point(nil), vertices...), ClipPointCloudMap: clipPointCloudMap}, nil
+}
+
+// Vertices returns the vertices of the polygon enclosing the mapping bounds.
+func (b *MappingBounds) Vertices() []r2.Point {
+	return append([]r2.Point(nil), b.vertices...)
+}
+
+// Contains returns whether p, in millimeters in the map frame, lies inside or on the boundary of the region.
+func (b *MappingBounds) Contains(p r2.Point) bool {
+	inside := false
+	for i, v := range b.vertices {
+		next := b.vertices[(i+1)%len(b.vertices)]
+		if onSegment(p, v, next) {
+			return true
+		}
+		// ray casting towards +x
+		if (v.Y > p.Y) != (next.Y > p.Y) {
+			crossingX := v.X + (p.Y-v.Y)*(next.X-v.X)/(next.Y-v.Y)
+			if p.X < crossingX {
+				inside = !inside
+			}
+		}
+	}
+	return inside
+}
+
+func onSegment(p, a, b r2.Point) bool {
+	ab := b.Sub(a)
+	ap := p.Sub(a)
+	length := ab.Norm()
+	if length == 0 {
+		return ap.Norm() <= boundaryTolerance
+	}
+	if math.Abs(ab.Cross(ap))/length > boundaryTolerance {
+		return false
+	}
+	dot := ab.Dot(ap)
+	return dot >= -boundaryTolerance*length && dot <= length*length+boundaryTolerance*length
+}
+
+// ClipLidarReading returns the lidar reading with all points outside of the region removed, along with the
+// number of points that were kept and removed. scanPose is the pose of the lidar in the map frame at the time of the
+// reading and is used to place the points, which are in the lidar frame, in the map frame.
+// The points that are kept are returned unchanged, in the lidar frame.
+func (b *MappingBounds) ClipLidarReading(reading []byte, scanPose spatialmath.Pose) ([]byte, int, int, error) {
+	return b.clip(reading, scanPose)
+}
+
+// ClipPointCloud returns the pointcloud map, in the map frame, with all points outside of the
+// region removed.
+func (b *MappingBounds) ClipPointCloud(pcd []byte) ([]byte, error) {
+	clipped, _, _, err := b.clip(pcd, spatialmath.NewZeroPose())
+	return clipped, err
+}
+
+func (b *MappingBounds) clip(pcd []byte, pose spatialmath.Pose) ([]byte, int, int, error) {
+	pc, err := ReadLidarReading(pcd)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+
+	clipped := pointcloud.NewWithPrealloc(pc.Size())
+	numRemoved := 0
+	var setErr error
+	pc.Iterate(0, 0, func(p r3.Vector, d pointcloud.Data) bool {
+		mapPoint := spatialmath.Compose(pose, spatialmath.NewPoseFromPoint(p)).Point()
+		if !b.Contains(r2.Point{X: mapPoint.X, Y: mapPoint.Y}) {
+			numRemoved++
+			return true
+		}
+		if setErr = clipped.Set(p, d); setErr != nil {
+			return false
+		}
+		return true
+	})
+	if setErr != nil {
+		return nil, 0, 0, setErr
+	}
+
+	buf := new(bytes.Buffer)
+	if err := pointcloud.ToPCD(clipped, buf, pointcloud.PCDBinary); err != nil {
+		return nil, 0, 0, err
+	}
+	return buf.Bytes(), clipped.Size(), numRemoved, nil
+}
@@ -0,0 +1,105 @@
+package sensors_test
+
+import (
+	"testing"
+
+	"github.com/golang/geo/r2"
+	"github.com/golang/geo/r3"
+	"go.viam.com/rdk/spatialmath"
+	"go.viam.com/test"
+
+	s "github.com/viam-modules/viam-cartographer/sensors"
+	"github.com/viam-modules/viam-cartographer/testhelper/pcdtest"
+)
+
+func TestNewMappingBounds(t *testing.T) {
+	t.Run("fewer than three vertices is invalid", func(t *testing.T) {
+		bounds, err := s.NewMappingBounds([]r2.Point{{X: 0, Y: 0}, {X: 1, Y: 1}}, false)
+		test.That(t, err, test.ShouldBeError, s.ErrInvalidMappingBounds)
+		test.That(t, bounds, test.ShouldBeNil)
+	})
+
+	t.Run("collinear vertices are invalid", func(t *testing.T) {
+		bounds, err := s.NewMappingBounds([]r2.Point{{X: 0, Y: 0}, {X: 1, Y: 1}, {X: 2, Y: 2}}, false)
+		test.That(t, err, test.ShouldBeError, s.ErrInvalidMappingBounds)
+		test.That(t, bounds, test.ShouldBeNil)
+	})
+}
+
+func TestMappingBoundsContains(t *testing.T) {
+	// concave L shaped region
+	bounds, err := s.NewMappingBounds([]r2.Point{
+		{X: 0, Y: 0}, {X: 2000, Y: 0}, {X: 2000, Y: 1000}, {X: 1000, Y: 1000}, {X: 1000, Y: 2000}, {X: 0, Y: 2000},
+	}, false)
+	test.That(t, err, test.ShouldBeNil)
+
+	test.That(t, bounds.Contains(r2.Point{X: 500, Y: 500}), test.ShouldBeTrue)
+	test.That(t, bounds.Contains(r2.Point{X: 500, Y: 1500}), test.ShouldBeTrue)
+	test.That(t, bounds.Contains(r2.Point{X: 1500, Y: 1500}), test.ShouldBeFalse)
+	test.That(t, bounds.Contains(r2.Point{X: -1, Y: 500}), test.ShouldBeFalse)
+
+	// points exactly on the boundary, including vertices, are kept
+	test.That(t, bounds.Contains(r2.Point{X: 0, Y: 500}), test.ShouldBeTrue)
+	test.That(t, bounds.Contains(r2.Point{X: 1500, Y: 1000}), test.ShouldBeTrue)
+	test.That(t, bounds.Contains(r2.Point{X: 1000, Y: 1000}), test.ShouldBeTrue)
+	test.That(t, bounds.Contains(r2.Point{X: 2000, Y: 0}), test.ShouldBeTrue)
+}
+
+func TestMappingBoundsClipLidarReading(t *testing.T) {
+	// 2m x 2m box centered on the map origin
+	bounds, err := s.NewMappingBounds([]r2.Point{
+		{X: -1000, Y: -1000}, {X: 1000, Y: -1000}, {X: 1000, Y: 1000}, {X: -1000, Y: 1000},
+	}, false)
+	test.That(t, err, test.ShouldBeNil)
+
+	// scan straddling the +x boundary of the box, in the lidar frame
+	scan := pcdtest.PointsToPCD(t, []r3.Vector{
+		{X: 500, Y: 0},
+		{X: 1000, Y: 500},
+		{X: 1500, Y: 0},
+		{X: 0, Y: -2000},
+	})
+
+	t.Run("clips points outside of the bounds with the lidar at the map origin", func(t *testing.T) {
+		clipped, numKept, numRemoved, err := bounds.ClipLidarReading(scan, spatialmath.NewZeroPose())
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, numKept, test.ShouldEqual, 2)
+		test.That(t, numRemoved, test.ShouldEqual, 2)
+		test.That(t, pcdtest.SortedPoints(t, clipped), test.ShouldResemble, []r3.Vector{{X: 500, Y: 0}, {X: 1000, Y: 500}})
+	})
+
+	t.Run("places points in the map frame using the scan pose", func(t *testing.T) {
+		// lidar 500mm to the left of the map origin, rotated by 90 degrees
+		scanPose := spatialmath.NewPose(
+			r3.Vector{X: -500, Y: 0},
+			&spatialmath.OrientationVectorDegrees{OZ: 1, Theta: 90},
+		)
+		clipped, numKept, numRemoved, err := bounds.ClipLidarReading(scan, scanPose)
+		test.That(t, err, test.ShouldBeNil)
+		// (500, 0) -> (-500, 500), (1000, 500) -> (-1000, 1000) on the corner, (1500, 0) -> (-500, 1500),
+		// (0, -2000) -> (1500, 0)
+		test.That(t, numKept, test.ShouldEqual, 2)
+		test.That(t, numRemoved, test.ShouldEqual, 2)
+		test.That(t, pcdtest.SortedPoints(t, clipped), test.ShouldResemble, []r3.Vector{{X: 500, Y: 0}, {X: 1000, Y: 500}})
+	})
+
+	t.Run("returns an empty reading when no points are inside the bounds", func(t *testing.T) {
+		clipped, numKept, numRemoved, err := bounds.ClipLidarReading(scan, spatialmath.NewPoseFromPoint(r3.Vector{X: 10000}))
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, numKept, test.ShouldEqual, 0)
+		test.That(t, numRemoved, test.ShouldEqual, 4)
+		test.That(t, pcdtest.SortedPoints(t, clipped), test.ShouldBeEmpty)
+	})
+
+	t.Run("returns an error for an invalid reading", func(t *testing.T) {
+		clipped, _, _, err := bounds.ClipLidarReading([]byte("not a pcd"), spatialmath.NewZeroPose())
+		test.That(t, err, test.ShouldNotBeNil)
+		test.That(t, clipped, test.ShouldBeNil)
+	})
+
+	t.Run("clips a pointcloud map in the map frame", func(t *testing.T) {
+		clipped, err := bounds.ClipPointCloud(scan)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, pcdtest.SortedPoints(t, clipped), test.ShouldResemble, []r3.Vector{{X: 500, Y: 0}, {X: 1000, Y: 500}})
+	})
+}
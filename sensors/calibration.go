@@ -0,0 +1,165 @@
+package sensors
+
+import (
+	"bytes"
+	"context"
+	"time"
+
+	"github.com/golang/geo/r3"
+	"github.com/pkg/errors"
+	"go.viam.com/rdk/pointcloud"
+	"go.viam.com/rdk/spatialmath"
+)
+
+// calibratedLidar transforms the readings of a lidar into the frame of the base of the robot and shifts their
+// reading times.
+type calibratedLidar struct {
+	TimedLidar
+	extrinsics spatialmath.Pose
+	timeOffset time.Duration
+}
+
+// NewCalibratedLidar returns the lidar with the points of its readings transformed by extrinsics, the pose of the
+// lidar relative to the base of the robot, unless it is nil, and their reading times shifted by timeOffset.
+func NewCalibratedLidar(lidar TimedLidar, extrinsics spatialmath.Pose, timeOffset time.Duration) TimedLidar {
+	if extrinsics == nil && timeOffset == 0 {
+		return lidar
+	}
+	return &calibratedLidar{TimedLidar: lidar, extrinsics: extrinsics, timeOffset: timeOffset}
+}
+
+// TimedLidarReading returns the next reading of the lidar, calibrated.
+func (lidar *calibratedLidar) TimedLidarReading(ctx context.Context) (TimedLidarReadingResponse, error) {
+	reading, err := lidar.TimedLidar.TimedLidarReading(ctx)
+	if err != nil {
+		return reading, err
+	}
+	if lidar.extrinsics != nil {
+		if reading.Reading, err = TransformLidarReading(reading.Reading, lidar.extrinsics); err != nil {
+			return TimedLidarReadingResponse{}, err
+		}
+	}
+	reading.ReadingTime = reading.ReadingTime.Add(lidar.timeOffset)
+	return reading, nil
+}
+
+// ResourceHealth returns the health of the resource the lidar it calibrates reads from.
+func (lidar *calibratedLidar) ResourceHealth() (ResourceHealth, bool) {
+	return ResourceHealthOf(lidar.TimedLidar)
+}
+
+// Refresh returns the lidar with its camera resolved again by resolve, calibrated the same way. It fails if the
+// lidar it calibrates is not a RefreshableLidar.
+func (lidar *calibratedLidar) Refresh(ctx context.Context, resolve ResourceResolver) (TimedLidar, error) {
+	refreshable, ok := lidar.TimedLidar.(RefreshableLidar)
+	if !ok {
+		return nil, errors.Errorf("lidar %v cannot be refreshed", lidar.Name())
+	}
+	refreshed, err := refreshable.Refresh(ctx, resolve)
+	if err != nil {
+		return nil, err
+	}
+	return &calibratedLidar{TimedLidar: refreshed, extrinsics: lidar.extrinsics, timeOffset: lidar.timeOffset}, nil
+}
+
+// TransformLidarReading returns the lidar reading with its points transformed by pose.
+func TransformLidarReading(reading []byte, pose spatialmath.Pose) ([]byte, error) {
+	pc, err := ReadLidarReading(reading)
+	if err != nil {
+		return nil, err
+	}
+
+	transformed := pointcloud.NewWithPrealloc(pc.Size())
+	var setErr error
+	pc.Iterate(0, 0, func(p r3.Vector, d pointcloud.Data) bool {
+		setErr = transformed.Set(spatialmath.Compose(pose, spatialmath.NewPoseFromPoint(p)).Point(), d)
+		return setErr == nil
+	})
+	if setErr != nil {
+		return nil, setErr
+	}
+
+	buf := new(bytes.Buffer)
+	if err := pointcloud.ToPCD(transformed, buf, pointcloud.PCDBinary); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// calibratedMovementSensor rotates the IMU readings, the velocity readings and the odometer orientations of a
+// movement sensor into the frame of the base of the robot and shifts the reading times of all of its readings.
+type calibratedMovementSensor struct {
+	TimedMovementSensor
+	imuOrientation spatialmath.Pose
+	timeOffset     time.Duration
+}
+
+// NewCalibratedMovementSensor returns the movement sensor with its IMU readings and odometer orientations rotated by
+// imuOrientation, the orientation of the movement sensor relative to the base of the robot, unless it is nil or
+// the identity, and the reading times of all of its readings shifted by timeOffset. Without either, the movement
+// sensor is returned as is, so that its readings are not copied.
+func NewCalibratedMovementSensor(
+	movementSensor TimedMovementSensor,
+	imuOrientation spatialmath.Orientation,
+	timeOffset time.Duration,
+) TimedMovementSensor {
+	if imuOrientation != nil && spatialmath.OrientationAlmostEqual(imuOrientation, spatialmath.NewZeroOrientation()) {
+		imuOrientation = nil
+	}
+	if imuOrientation == nil && timeOffset == 0 {
+		return movementSensor
+	}
+	calibrated := &calibratedMovementSensor{TimedMovementSensor: movementSensor, timeOffset: timeOffset}
+	if imuOrientation != nil {
+		calibrated.imuOrientation = spatialmath.NewPoseFromOrientation(imuOrientation)
+	}
+	return calibrated
+}
+
+// ResourceHealth returns the health of the resource the movement sensor it calibrates reads from.
+func (ms *calibratedMovementSensor) ResourceHealth() (ResourceHealth, bool) {
+	return ResourceHealthOf(ms.TimedMovementSensor)
+}
+
+// TimedMovementSensorReading returns the next reading of the movement sensor, calibrated.
+func (ms *calibratedMovementSensor) TimedMovementSensorReading(ctx context.Context) (TimedMovementSensorReadingResponse, error) {
+	reading, err := ms.TimedMovementSensor.TimedMovementSensorReading(ctx)
+	if err != nil {
+		return reading, err
+	}
+	if reading.TimedIMUResponse != nil {
+		imuReading := *reading.TimedIMUResponse
+		if ms.imuOrientation != nil {
+			imuReading.LinearAcceleration = ms.rotate(imuReading.LinearAcceleration)
+			imuReading.AngularVelocity = spatialmath.AngularVelocity(ms.rotate(r3.Vector(imuReading.AngularVelocity)))
+		}
+		imuReading.ReadingTime = imuReading.ReadingTime.Add(ms.timeOffset)
+		reading.TimedIMUResponse = &imuReading
+	}
+	if reading.TimedOdometerResponse != nil {
+		odometerReading := *reading.TimedOdometerResponse
+		if ms.imuOrientation != nil && odometerReading.Orientation != nil {
+			// the orientation of the base is that of the movement sensor undoing its orientation relative to the base
+			odometerReading.Orientation = spatialmath.Compose(
+				spatialmath.NewPoseFromOrientation(odometerReading.Orientation),
+				spatialmath.PoseInverse(ms.imuOrientation),
+			).Orientation()
+		}
+		odometerReading.ReadingTime = odometerReading.ReadingTime.Add(ms.timeOffset)
+		reading.TimedOdometerResponse = &odometerReading
+	}
+	if reading.TimedVelocityResponse != nil {
+		velocityReading := *reading.TimedVelocityResponse
+		if ms.imuOrientation != nil {
+			velocityReading.LinearVelocity = ms.rotate(velocityReading.LinearVelocity)
+			velocityReading.AngularVelocity = spatialmath.AngularVelocity(ms.rotate(r3.Vector(velocityReading.AngularVelocity)))
+		}
+		velocityReading.ReadingTime = velocityReading.ReadingTime.Add(ms.timeOffset)
+		reading.TimedVelocityResponse = &velocityReading
+	}
+	return reading, nil
+}
+
+func (ms *calibratedMovementSensor) rotate(v r3.Vector) r3.Vector {
+	return spatialmath.Compose(ms.imuOrientation, spatialmath.NewPoseFromPoint(v)).Point()
+}
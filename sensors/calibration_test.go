@@ -0,0 +1,164 @@
+package sensors_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang/geo/r3"
+	"go.viam.com/rdk/resource"
+	"go.viam.com/rdk/spatialmath"
+	"go.viam.com/test"
+
+	s "github.com/viam-modules/viam-cartographer/sensors"
+	"github.com/viam-modules/viam-cartographer/sensors/inject"
+	"github.com/viam-modules/viam-cartographer/testhelper/pcdtest"
+)
+
+func shouldAlmostEqualVector(t *testing.T, actual, expected r3.Vector) {
+	t.Helper()
+	test.That(t, actual.X, test.ShouldAlmostEqual, expected.X, 1e-3)
+	test.That(t, actual.Y, test.ShouldAlmostEqual, expected.Y, 1e-3)
+	test.That(t, actual.Z, test.ShouldAlmostEqual, expected.Z, 1e-3)
+}
+
+func TestCalibratedLidar(t *testing.T) {
+	readingTime := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	lidar := &inject.TimedLidar{}
+	lidar.NameFunc = func() string { return "my-lidar" }
+	lidar.TimedLidarReadingFunc = func(ctx context.Context) (s.TimedLidarReadingResponse, error) {
+		return s.TimedLidarReadingResponse{
+			Reading:     pcdtest.PointsToPCD(t, []r3.Vector{{X: 1000, Y: 0, Z: 0}, {X: 0, Y: 2000, Z: 0}}),
+			ReadingTime: readingTime,
+		}, nil
+	}
+
+	t.Run("is the lidar itself without calibration", func(t *testing.T) {
+		test.That(t, s.NewCalibratedLidar(lidar, nil, 0), test.ShouldEqual, lidar)
+	})
+
+	t.Run("transforms the points by the extrinsics and shifts the reading time", func(t *testing.T) {
+		extrinsics := spatialmath.NewPose(r3.Vector{X: 100, Y: 0, Z: 300}, &spatialmath.OrientationVectorDegrees{OZ: 1, Theta: 90})
+		calibrated := s.NewCalibratedLidar(lidar, extrinsics, -20*time.Millisecond)
+		test.That(t, calibrated.Name(), test.ShouldEqual, "my-lidar")
+
+		reading, err := calibrated.TimedLidarReading(context.Background())
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, reading.ReadingTime, test.ShouldEqual, readingTime.Add(-20*time.Millisecond))
+		points := pcdtest.SortedPoints(t, reading.Reading)
+		test.That(t, len(points), test.ShouldEqual, 2)
+		shouldAlmostEqualVector(t, points[0], r3.Vector{X: -1900, Y: 0, Z: 300})
+		shouldAlmostEqualVector(t, points[1], r3.Vector{X: 100, Y: 1000, Z: 300})
+	})
+
+	t.Run("stays calibrated when the lidar is resolved again", func(t *testing.T) {
+		refreshedLidar := &inject.TimedLidar{}
+		refreshedLidar.NameFunc = lidar.NameFunc
+		refreshedLidar.TimedLidarReadingFunc = lidar.TimedLidarReadingFunc
+		lidar.RefreshFunc = func(ctx context.Context, resolve s.ResourceResolver) (s.TimedLidar, error) {
+			return refreshedLidar, nil
+		}
+		calibrated := s.NewCalibratedLidar(lidar, nil, -20*time.Millisecond).(s.RefreshableLidar)
+		refreshed, err := calibrated.Refresh(context.Background(), s.DependenciesResolver(resource.Dependencies{}))
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, refreshed, test.ShouldNotEqual, calibrated)
+
+		reading, err := refreshed.TimedLidarReading(context.Background())
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, reading.ReadingTime, test.ShouldEqual, readingTime.Add(-20*time.Millisecond))
+	})
+}
+
+func TestCalibratedMovementSensor(t *testing.T) {
+	readingTime := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	movementSensor := &inject.TimedMovementSensor{}
+	movementSensor.NameFunc = func() string { return "my-movement-sensor" }
+	movementSensor.PropertiesFunc = func() s.MovementSensorProperties {
+		return s.MovementSensorProperties{IMUSupported: true, OdometerSupported: true}
+	}
+	movementSensor.TimedMovementSensorReadingFunc = func(ctx context.Context) (s.TimedMovementSensorReadingResponse, error) {
+		return s.TimedMovementSensorReadingResponse{
+			TimedIMUResponse: &s.TimedIMUReadingResponse{
+				AngularVelocity:    spatialmath.AngularVelocity{X: 0, Y: 0, Z: 1},
+				LinearAcceleration: r3.Vector{X: 0, Y: 0, Z: 9.8},
+				ReadingTime:        readingTime,
+			},
+			TimedOdometerResponse: &s.TimedOdometerReadingResponse{ReadingTime: readingTime},
+		}, nil
+	}
+
+	t.Run("is the movement sensor itself without calibration", func(t *testing.T) {
+		test.That(t, s.NewCalibratedMovementSensor(movementSensor, nil, 0), test.ShouldEqual, movementSensor)
+	})
+
+	t.Run("rotates the IMU readings and shifts the reading times", func(t *testing.T) {
+		// mounted upside down
+		calibrated := s.NewCalibratedMovementSensor(movementSensor,
+			&spatialmath.OrientationVectorDegrees{OZ: -1}, 5*time.Millisecond)
+		test.That(t, calibrated.Properties(), test.ShouldResemble, movementSensor.Properties())
+
+		reading, err := calibrated.TimedMovementSensorReading(context.Background())
+		test.That(t, err, test.ShouldBeNil)
+		shouldAlmostEqualVector(t, r3.Vector(reading.TimedIMUResponse.AngularVelocity), r3.Vector{X: 0, Y: 0, Z: -1})
+		shouldAlmostEqualVector(t, reading.TimedIMUResponse.LinearAcceleration, r3.Vector{X: 0, Y: 0, Z: -9.8})
+		test.That(t, reading.TimedIMUResponse.ReadingTime, test.ShouldEqual, readingTime.Add(5*time.Millisecond))
+		test.That(t, reading.TimedOdometerResponse.ReadingTime, test.ShouldEqual, readingTime.Add(5*time.Millisecond))
+	})
+
+	t.Run("is the movement sensor itself with the identity orientation", func(t *testing.T) {
+		test.That(t, s.NewCalibratedMovementSensor(movementSensor, spatialmath.NewZeroOrientation(), 0),
+			test.ShouldEqual, movementSensor)
+		test.That(t, s.NewCalibratedMovementSensor(movementSensor, &spatialmath.OrientationVectorDegrees{OZ: 1}, 0),
+			test.ShouldEqual, movementSensor)
+	})
+
+	t.Run("rotates the readings of a movement sensor mounted sideways", func(t *testing.T) {
+		sideways := &inject.TimedMovementSensor{}
+		sideways.TimedMovementSensorReadingFunc = func(ctx context.Context) (s.TimedMovementSensorReadingResponse, error) {
+			return s.TimedMovementSensorReadingResponse{
+				TimedIMUResponse: &s.TimedIMUReadingResponse{
+					AngularVelocity:    spatialmath.AngularVelocity{X: 2, Y: 0, Z: 1},
+					LinearAcceleration: r3.Vector{X: 1, Y: 0, Z: 9.8},
+					ReadingTime:        readingTime,
+				},
+				TimedOdometerResponse: &s.TimedOdometerReadingResponse{
+					// the movement sensor faces along the y axis of the world while the base faces along its x axis
+					Orientation: &spatialmath.OrientationVectorDegrees{OZ: 1, Theta: 90},
+					ReadingTime: readingTime,
+				},
+			}, nil
+		}
+		// turned by 90 degrees around the z axis, so that its x axis is the y axis of the base
+		calibrated := s.NewCalibratedMovementSensor(sideways, &spatialmath.OrientationVectorDegrees{OZ: 1, Theta: 90}, 0)
+		test.That(t, calibrated, test.ShouldNotEqual, sideways)
+
+		reading, err := calibrated.TimedMovementSensorReading(context.Background())
+		test.That(t, err, test.ShouldBeNil)
+		shouldAlmostEqualVector(t, reading.TimedIMUResponse.LinearAcceleration, r3.Vector{X: 0, Y: 1, Z: 9.8})
+		shouldAlmostEqualVector(t, r3.Vector(reading.TimedIMUResponse.AngularVelocity), r3.Vector{X: 0, Y: 2, Z: 1})
+		test.That(t, spatialmath.OrientationAlmostEqual(reading.TimedOdometerResponse.Orientation,
+			spatialmath.NewZeroOrientation()), test.ShouldBeTrue)
+		test.That(t, reading.TimedIMUResponse.ReadingTime, test.ShouldEqual, readingTime)
+	})
+
+	t.Run("rotates the velocity readings of a wheel encoder mounted sideways", func(t *testing.T) {
+		encoder := &inject.TimedMovementSensor{}
+		encoder.TimedMovementSensorReadingFunc = func(ctx context.Context) (s.TimedMovementSensorReadingResponse, error) {
+			return s.TimedMovementSensorReadingResponse{
+				TimedVelocityResponse: &s.TimedVelocityReadingResponse{
+					LinearVelocity:  r3.Vector{X: 1},
+					AngularVelocity: spatialmath.AngularVelocity{Z: 0.5},
+					ReadingTime:     readingTime,
+				},
+			}, nil
+		}
+		calibrated := s.NewCalibratedMovementSensor(encoder,
+			&spatialmath.OrientationVectorDegrees{OZ: 1, Theta: 90}, 5*time.Millisecond)
+
+		reading, err := calibrated.TimedMovementSensorReading(context.Background())
+		test.That(t, err, test.ShouldBeNil)
+		shouldAlmostEqualVector(t, reading.TimedVelocityResponse.LinearVelocity, r3.Vector{X: 0, Y: 1, Z: 0})
+		shouldAlmostEqualVector(t, r3.Vector(reading.TimedVelocityResponse.AngularVelocity), r3.Vector{X: 0, Y: 0, Z: 0.5})
+		test.That(t, reading.TimedVelocityResponse.ReadingTime, test.ShouldEqual, readingTime.Add(5*time.Millisecond))
+	})
+}
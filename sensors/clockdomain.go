@@ -0,0 +1,162 @@
+package sensors
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ErrMixedClockDomains denotes that the reading times of the lidar and the movement sensor are taken from
+// different clocks, e.g. for a replay lidar combined with a live movement sensor, so that their readings cannot be
+// ordered by their reading times.
+var ErrMixedClockDomains = errors.New("the lidar and the movement sensor have different clock domains")
+
+// ClockDomain denotes the clock the reading times of a sensor are taken from. Reading times of different clock
+// domains are from unrelated epochs, so the readings of sensors of different clock domains cannot be ordered by
+// their reading times.
+type ClockDomain string
+
+const (
+	// ClockDomainLive denotes reading times taken from the clock of the machine when the reading is obtained.
+	ClockDomainLive ClockDomain = "live"
+	// ClockDomainReplay denotes reading times that were recorded along with the data a replay sensor returns.
+	ClockDomainReplay ClockDomain = "replay"
+)
+
+// clockDomain returns the clock domain of a reading depending on whether it carries replay metadata.
+func clockDomain(isReplaySensor bool) ClockDomain {
+	if isReplaySensor {
+		return ClockDomainReplay
+	}
+	return ClockDomainLive
+}
+
+// ClockDomain returns the clock domain of the reading, inferred from whether it carries replay metadata.
+func (reading TimedLidarReadingResponse) ClockDomain() ClockDomain {
+	return clockDomain(reading.TestIsReplaySensor)
+}
+
+// ClockDomain returns the clock domain of the reading, inferred from whether it carries replay metadata.
+func (reading TimedMovementSensorReadingResponse) ClockDomain() ClockDomain {
+	return clockDomain(reading.TestIsReplaySensor)
+}
+
+// MixedClockDomainsError returns an error wrapping ErrMixedClockDomains that names both sensors and the times of
+// their first readings if the first lidar and movement sensor readings are of different clock domains, and nil
+// otherwise.
+func MixedClockDomainsError(
+	lidarName string,
+	lidarReading TimedLidarReadingResponse,
+	movementSensorName string,
+	movementSensorReading TimedMovementSensorReadingResponse,
+	movementSensorReadingTime time.Time,
+) error {
+	lidarClockDomain := lidarReading.ClockDomain()
+	movementSensorClockDomain := movementSensorReading.ClockDomain()
+	if lidarClockDomain == movementSensorClockDomain {
+		return nil
+	}
+	return fmt.Errorf("%w: lidar %q is %s with its first reading at %s, but movement sensor %q is %s with "+
+		"its first reading at %s", ErrMixedClockDomains,
+		lidarName, lidarClockDomain, lidarReading.ReadingTime.UTC().Format(time.RFC3339Nano),
+		movementSensorName, movementSensorClockDomain, movementSensorReadingTime.UTC().Format(time.RFC3339Nano))
+}
+
+// CheckClockDomains takes the first reading of lidar and of movementSensor and returns an error wrapping
+// ErrMixedClockDomains if they are of different clock domains. The returned sensors return the readings taken
+// first, so that the check does not drop a reading of a replay sensor. The check is skipped if either sensor fails
+// to return a reading, which is left to the sensor processes, or if the movement sensor supports neither an IMU
+// nor an odometer.
+func CheckClockDomains(
+	ctx context.Context,
+	lidar TimedLidar,
+	movementSensor TimedMovementSensor,
+) (TimedLidar, TimedMovementSensor, error) {
+	if movementSensor == nil || (!movementSensor.Properties().IMUSupported &&
+		!movementSensor.Properties().OdometerSupported) {
+		return lidar, movementSensor, nil
+	}
+	lidarReading, err := lidar.TimedLidarReading(ctx)
+	if err != nil {
+		return lidar, movementSensor, nil
+	}
+	lidar = &firstReadingLidar{TimedLidar: lidar, first: &lidarReading}
+	movementSensorReading, err := movementSensor.TimedMovementSensorReading(ctx)
+	if err != nil {
+		return lidar, movementSensor, nil
+	}
+	movementSensor = &firstReadingMovementSensor{TimedMovementSensor: movementSensor, first: &movementSensorReading}
+
+	var movementSensorReadingTime time.Time
+	switch {
+	case movementSensorReading.TimedOdometerResponse != nil:
+		movementSensorReadingTime = movementSensorReading.TimedOdometerResponse.ReadingTime
+	case movementSensorReading.TimedIMUResponse != nil:
+		movementSensorReadingTime = movementSensorReading.TimedIMUResponse.ReadingTime
+	}
+	return lidar, movementSensor, MixedClockDomainsError(lidar.Name(), lidarReading,
+		movementSensor.Name(), movementSensorReading, movementSensorReadingTime)
+}
+
+// firstReadingLidar returns a reading that was taken from the lidar it wraps before as its first reading.
+type firstReadingLidar struct {
+	TimedLidar
+	mu    sync.Mutex
+	first *TimedLidarReadingResponse
+}
+
+// TimedLidarReading returns the reading taken before on the first call, and the next reading of the lidar after.
+func (lidar *firstReadingLidar) TimedLidarReading(ctx context.Context) (TimedLidarReadingResponse, error) {
+	lidar.mu.Lock()
+	first := lidar.first
+	lidar.first = nil
+	lidar.mu.Unlock()
+	if first != nil {
+		return *first, nil
+	}
+	return lidar.TimedLidar.TimedLidarReading(ctx)
+}
+
+// ResourceHealth returns the health of the resource the lidar it wraps reads from.
+func (lidar *firstReadingLidar) ResourceHealth() (ResourceHealth, bool) {
+	return ResourceHealthOf(lidar.TimedLidar)
+}
+
+// Refresh returns the lidar it wraps with its camera resolved again by resolve, without the reading taken before.
+// It fails if the lidar it wraps is not a RefreshableLidar.
+func (lidar *firstReadingLidar) Refresh(ctx context.Context, resolve ResourceResolver) (TimedLidar, error) {
+	refreshable, ok := lidar.TimedLidar.(RefreshableLidar)
+	if !ok {
+		return nil, errors.Errorf("lidar %v cannot be refreshed", lidar.Name())
+	}
+	return refreshable.Refresh(ctx, resolve)
+}
+
+// firstReadingMovementSensor returns a reading that was taken from the movement sensor it wraps before as its
+// first reading.
+type firstReadingMovementSensor struct {
+	TimedMovementSensor
+	mu    sync.Mutex
+	first *TimedMovementSensorReadingResponse
+}
+
+// TimedMovementSensorReading returns the reading taken before on the first call, and the next reading of the
+// movement sensor after.
+func (ms *firstReadingMovementSensor) TimedMovementSensorReading(ctx context.Context) (TimedMovementSensorReadingResponse, error) {
+	ms.mu.Lock()
+	first := ms.first
+	ms.first = nil
+	ms.mu.Unlock()
+	if first != nil {
+		return *first, nil
+	}
+	return ms.TimedMovementSensor.TimedMovementSensorReading(ctx)
+}
+
+// ResourceHealth returns the health of the resource the movement sensor it wraps reads from.
+func (ms *firstReadingMovementSensor) ResourceHealth() (ResourceHealth, bool) {
+	return ResourceHealthOf(ms.TimedMovementSensor)
+}
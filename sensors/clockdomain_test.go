@@ -0,0 +1,64 @@
+package sensors_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go.viam.com/rdk/logging"
+	"go.viam.com/test"
+
+	s "github.com/viam-modules/viam-cartographer/sensors"
+)
+
+func TestCheckClockDomains(t *testing.T) {
+	logger := logging.NewTestLogger(t)
+	ctx := context.Background()
+
+	t.Run("sensors of the same clock domain return the readings taken by the check first", func(t *testing.T) {
+		deps := s.SetupDeps(s.ReplayLidar, s.ReplayIMU)
+		lidar, err := s.NewLidar(ctx, deps, string(s.ReplayLidar), 0, logger)
+		test.That(t, err, test.ShouldBeNil)
+		movementSensor, err := s.NewMovementSensor(ctx, deps, string(s.ReplayIMU), 0, s.DegreesPerSecond, logger)
+		test.That(t, err, test.ShouldBeNil)
+
+		checkedLidar, checkedMovementSensor, err := s.CheckClockDomains(ctx, lidar, movementSensor)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, checkedLidar.Name(), test.ShouldEqual, string(s.ReplayLidar))
+		test.That(t, checkedMovementSensor.Name(), test.ShouldEqual, string(s.ReplayIMU))
+
+		lidarReading, err := checkedLidar.TimedLidarReading(ctx)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, lidarReading.ClockDomain(), test.ShouldEqual, s.ClockDomainReplay)
+		movementSensorReading, err := checkedMovementSensor.TimedMovementSensorReading(ctx)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, movementSensorReading.ClockDomain(), test.ShouldEqual, s.ClockDomainReplay)
+
+		_, ok := s.ResourceHealthOf(checkedLidar)
+		test.That(t, ok, test.ShouldBeTrue)
+	})
+
+	t.Run("a live lidar and a replay movement sensor return an error naming both", func(t *testing.T) {
+		deps := s.SetupDeps(s.GoodLidar, s.ReplayIMU)
+		lidar, err := s.NewLidar(ctx, deps, string(s.GoodLidar), 0, logger)
+		test.That(t, err, test.ShouldBeNil)
+		movementSensor, err := s.NewMovementSensor(ctx, deps, string(s.ReplayIMU), 0, s.DegreesPerSecond, logger)
+		test.That(t, err, test.ShouldBeNil)
+
+		_, _, err = s.CheckClockDomains(ctx, lidar, movementSensor)
+		test.That(t, errors.Is(err, s.ErrMixedClockDomains), test.ShouldBeTrue)
+		test.That(t, err.Error(), test.ShouldContainSubstring, "lidar \""+string(s.GoodLidar)+"\" is live")
+		test.That(t, err.Error(), test.ShouldContainSubstring, "movement sensor \""+string(s.ReplayIMU)+"\" is replay")
+	})
+
+	t.Run("the check is skipped without a movement sensor", func(t *testing.T) {
+		deps := s.SetupDeps(s.GoodLidar, s.NoMovementSensor)
+		lidar, err := s.NewLidar(ctx, deps, string(s.GoodLidar), 0, logger)
+		test.That(t, err, test.ShouldBeNil)
+
+		checkedLidar, checkedMovementSensor, err := s.CheckClockDomains(ctx, lidar, nil)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, checkedLidar, test.ShouldEqual, lidar)
+		test.That(t, checkedMovementSensor, test.ShouldBeNil)
+	})
+}
@@ -0,0 +1,166 @@
+package sensors
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// PCDExtension is the file extension of an uncompressed lidar dataset frame.
+	PCDExtension = ".pcd"
+	// CompressedPCDExtension is the file extension of a gzip compressed lidar dataset frame.
+	CompressedPCDExtension = ".pcd.gz"
+	// NoDatasetCompression denotes that lidar dataset frames are written uncompressed.
+	NoDatasetCompression = 0
+)
+
+// ErrInvalidDatasetCompressionLevel denotes that a lidar dataset compression level is outside of the supported range.
+var ErrInvalidDatasetCompressionLevel = errors.Errorf(
+	"dataset compression level must be between %d and %d, %d for the default level, or %d to disable compression",
+	gzip.BestSpeed, gzip.BestCompression, gzip.DefaultCompression, NoDatasetCompression,
+)
+
+// ValidateDatasetCompressionLevel returns an error if the compression level is not supported.
+func ValidateDatasetCompressionLevel(compressionLevel int) error {
+	if compressionLevel == NoDatasetCompression || compressionLevel == gzip.DefaultCompression {
+		return nil
+	}
+	if compressionLevel < gzip.BestSpeed || compressionLevel > gzip.BestCompression {
+		return ErrInvalidDatasetCompressionLevel
+	}
+	return nil
+}
+
+// WriteLidarDatasetFrame writes a lidar reading to dir using name as the file stem. The reading is gzip
+// compressed with a .pcd.gz suffix unless compressionLevel is NoDatasetCompression, in which case it is
+// written as is with a .pcd suffix. The path of the written file is returned.
+func WriteLidarDatasetFrame(dir, name string, reading []byte, compressionLevel int) (string, error) {
+	if err := ValidateDatasetCompressionLevel(compressionLevel); err != nil {
+		return "", err
+	}
+
+	if compressionLevel == NoDatasetCompression {
+		path := filepath.Join(dir, name+PCDExtension)
+		return path, os.WriteFile(path, reading, 0o640)
+	}
+
+	buf := new(bytes.Buffer)
+	gz, err := gzip.NewWriterLevel(buf, compressionLevel)
+	if err != nil {
+		return "", err
+	}
+	if _, err := gz.Write(reading); err != nil {
+		return "", err
+	}
+	if err := gz.Close(); err != nil {
+		return "", err
+	}
+
+	path := filepath.Join(dir, name+CompressedPCDExtension)
+	return path, os.WriteFile(path, buf.Bytes(), 0o640)
+}
+
+// ReadLidarDatasetFrame returns the lidar reading stored at path, transparently decompressing
+// it if it has a .pcd.gz suffix or is a binary compressed PCD.
+func ReadLidarDatasetFrame(path string) ([]byte, error) {
+	reading, err := readLidarDatasetFile(path)
+	if err != nil {
+		return nil, err
+	}
+	reading, err = DecompressPCD(reading)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to decompress %s", path)
+	}
+	return reading, nil
+}
+
+// readLidarDatasetFile returns the contents of the lidar dataset frame at path, gunzipped if it has a
+// .pcd.gz suffix.
+func readLidarDatasetFile(path string) ([]byte, error) {
+	//nolint:gosec
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	if !strings.HasSuffix(path, CompressedPCDExtension) {
+		return io.ReadAll(file)
+	}
+
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to decompress %s", path)
+	}
+	defer gz.Close()
+
+	reading, err := io.ReadAll(gz)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to decompress %s", path)
+	}
+	return reading, nil
+}
+
+// datasetFrameStem returns the name of a lidar dataset frame without its extension, and whether
+// the file is a lidar dataset frame at all.
+func datasetFrameStem(fileName string) (string, bool) {
+	if stem, ok := strings.CutSuffix(fileName, CompressedPCDExtension); ok {
+		return stem, true
+	}
+	if stem, ok := strings.CutSuffix(fileName, PCDExtension); ok {
+		return stem, true
+	}
+	return "", false
+}
+
+// ListLidarDatasetFrames returns the paths of the lidar dataset frames in dir in the order they were
+// recorded. Compressed and uncompressed frames may be mixed. Frames named by an integer index are ordered
+// numerically, all other frames (e.g. RFC3339 timestamps) are ordered lexically.
+func ListLidarDatasetFrames(dir string) ([]string, error) {
+	dirEntries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	stems := map[string]string{}
+	for _, entry := range dirEntries {
+		if entry.IsDir() {
+			continue
+		}
+		stem, ok := datasetFrameStem(entry.Name())
+		if !ok {
+			continue
+		}
+		if existing, ok := stems[stem]; ok {
+			return nil, errors.Errorf("lidar dataset frame %s is stored as both %s and %s", stem, existing, entry.Name())
+		}
+		stems[stem] = entry.Name()
+	}
+
+	names := make([]string, 0, len(stems))
+	for stem := range stems {
+		names = append(names, stem)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		iIndex, iErr := strconv.ParseUint(names[i], 10, 64)
+		jIndex, jErr := strconv.ParseUint(names[j], 10, 64)
+		if iErr == nil && jErr == nil {
+			return iIndex < jIndex
+		}
+		return names[i] < names[j]
+	})
+
+	paths := make([]string, 0, len(names))
+	for _, stem := range names {
+		paths = append(paths, filepath.Join(dir, stems[stem]))
+	}
+	return paths, nil
+}
@@ -0,0 +1,122 @@
+package sensors_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/golang/geo/r3"
+	"go.viam.com/rdk/pointcloud"
+	"go.viam.com/test"
+
+	s "github.com/viam-modules/viam-cartographer/sensors"
+)
+
+func makeTestDatasetFrames(t *testing.T, numFrames int) [][]byte {
+	t.Helper()
+	var frames [][]byte
+	for i := 0; i < numFrames; i++ {
+		pc := pointcloud.New()
+		for j := 0; j < 100; j++ {
+			err := pc.Set(r3.Vector{X: float64(i), Y: float64(j), Z: 0}, pointcloud.NewBasicData())
+			test.That(t, err, test.ShouldBeNil)
+		}
+		buf := new(bytes.Buffer)
+		test.That(t, pointcloud.ToPCD(pc, buf, pointcloud.PCDBinary), test.ShouldBeNil)
+		frames = append(frames, buf.Bytes())
+	}
+	return frames
+}
+
+func replayDataset(t *testing.T, dir string) [][]byte {
+	t.Helper()
+	paths, err := s.ListLidarDatasetFrames(dir)
+	test.That(t, err, test.ShouldBeNil)
+	var readings [][]byte
+	for _, path := range paths {
+		reading, err := s.ReadLidarDatasetFrame(path)
+		test.That(t, err, test.ShouldBeNil)
+		readings = append(readings, reading)
+	}
+	return readings
+}
+
+func TestLidarDatasetCompression(t *testing.T) {
+	// 12 frames ensures numeric rather than lexical ordering is exercised (2 < 10)
+	frames := makeTestDatasetFrames(t, 12)
+
+	writeDataset := func(t *testing.T, compressionLevel func(i int) int) string {
+		dir := t.TempDir()
+		for i, frame := range frames {
+			_, err := s.WriteLidarDatasetFrame(dir, strconv.Itoa(i), frame, compressionLevel(i))
+			test.That(t, err, test.ShouldBeNil)
+		}
+		return dir
+	}
+
+	uncompressedDir := writeDataset(t, func(int) int { return s.NoDatasetCompression })
+	uncompressedReadings := replayDataset(t, uncompressedDir)
+	test.That(t, uncompressedReadings, test.ShouldResemble, frames)
+
+	t.Run("compressed frames replay identically to uncompressed frames", func(t *testing.T) {
+		dir := writeDataset(t, func(int) int { return gzip.BestCompression })
+
+		path := filepath.Join(dir, "0"+s.CompressedPCDExtension)
+		info, err := os.Stat(path)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, info.Size(), test.ShouldBeLessThan, len(frames[0]))
+
+		test.That(t, replayDataset(t, dir), test.ShouldResemble, uncompressedReadings)
+	})
+
+	t.Run("mixed compressed and uncompressed frames replay in order", func(t *testing.T) {
+		dir := writeDataset(t, func(i int) int {
+			if i%2 == 0 {
+				return gzip.BestSpeed
+			}
+			return s.NoDatasetCompression
+		})
+		test.That(t, replayDataset(t, dir), test.ShouldResemble, uncompressedReadings)
+	})
+
+	t.Run("a frame stored both compressed and uncompressed is an error", func(t *testing.T) {
+		dir := writeDataset(t, func(int) int { return s.NoDatasetCompression })
+		_, err := s.WriteLidarDatasetFrame(dir, "3", frames[3], gzip.DefaultCompression)
+		test.That(t, err, test.ShouldBeNil)
+
+		paths, err := s.ListLidarDatasetFrames(dir)
+		test.That(t, err, test.ShouldNotBeNil)
+		test.That(t, paths, test.ShouldBeNil)
+	})
+
+	t.Run("timestamp named frames replay in lexical order", func(t *testing.T) {
+		dir := t.TempDir()
+		names := []string{"2024-01-01T00:00:00.2Z", "2024-01-01T00:00:00.1Z", "2024-01-01T00:00:01Z"}
+		for i, name := range names {
+			_, err := s.WriteLidarDatasetFrame(dir, name, frames[i], gzip.DefaultCompression)
+			test.That(t, err, test.ShouldBeNil)
+		}
+		test.That(t, replayDataset(t, dir), test.ShouldResemble, [][]byte{frames[1], frames[0], frames[2]})
+	})
+
+	t.Run("non frame files are ignored", func(t *testing.T) {
+		dir := writeDataset(t, func(int) int { return gzip.BestSpeed })
+		test.That(t, os.WriteFile(filepath.Join(dir, "data.json"), []byte("{}"), 0o600), test.ShouldBeNil)
+		test.That(t, replayDataset(t, dir), test.ShouldResemble, uncompressedReadings)
+	})
+}
+
+func TestValidateDatasetCompressionLevel(t *testing.T) {
+	for _, level := range []int{s.NoDatasetCompression, gzip.DefaultCompression, gzip.BestSpeed, gzip.BestCompression} {
+		test.That(t, s.ValidateDatasetCompressionLevel(level), test.ShouldBeNil)
+	}
+	for _, level := range []int{gzip.HuffmanOnly, gzip.BestCompression + 1} {
+		test.That(t, s.ValidateDatasetCompressionLevel(level), test.ShouldBeError, s.ErrInvalidDatasetCompressionLevel)
+	}
+
+	_, err := s.WriteLidarDatasetFrame(t.TempDir(), "0", []byte("pcd"), gzip.BestCompression+1)
+	test.That(t, err, test.ShouldBeError, s.ErrInvalidDatasetCompressionLevel)
+}
@@ -0,0 +1,227 @@
+package sensors
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/golang/geo/r3"
+	geo "github.com/kellydunn/golang-geo"
+	"github.com/pkg/errors"
+	"go.viam.com/rdk/components/camera/replaypcd"
+	replaymovementsensor "go.viam.com/rdk/components/movementsensor/replay"
+	"go.viam.com/rdk/pointcloud"
+	"go.viam.com/rdk/spatialmath"
+)
+
+// DatasetReplayConfig configures the replay of a sensor of an offline dataset.
+type DatasetReplayConfig struct {
+	Name            string
+	DataFrequencyHz int
+	// Start is the reading time of the first reading, every following reading is Interval later.
+	Start    time.Time
+	Interval time.Duration
+	// Loop starts over at the first reading once the end of the dataset is reached, instead of returning the end
+	// of dataset error of the replay sensors. The reading times keep increasing by Interval across the loops, so
+	// that they wrap around without going back in time.
+	Loop bool
+}
+
+// datasetReplay keeps track of the index of the next reading of a replay.
+type datasetReplay struct {
+	config DatasetReplayConfig
+
+	mu sync.Mutex
+	// numReadings is the number of readings returned so far, over all loops.
+	numReadings int
+}
+
+// next returns the index into a dataset of numReadings readings and the reading time of the next reading, or
+// false once the end of the dataset is reached without looping.
+func (replay *datasetReplay) next(numReadings int) (int, time.Time, bool) {
+	replay.mu.Lock()
+	defer replay.mu.Unlock()
+	if numReadings == 0 || (!replay.config.Loop && replay.numReadings >= numReadings) {
+		return 0, time.Time{}, false
+	}
+	i := replay.numReadings % numReadings
+	readingTime := replay.config.Start.Add(time.Duration(replay.numReadings) * replay.config.Interval)
+	replay.numReadings++
+	return i, readingTime, true
+}
+
+// DatasetLidar replays the lidar dataset frames of an offline dataset as a TimedLidar. It is safe for concurrent
+// use.
+type DatasetLidar struct {
+	datasetReplay
+	// frames are the frames of the dataset encoded as binary PCDs, which are read once so that looping over them
+	// does not allocate.
+	frames [][]byte
+}
+
+// NewDatasetLidar returns a DatasetLidar replaying the lidar dataset frames of the offline dataset in datasetDir.
+func NewDatasetLidar(datasetDir string, config DatasetReplayConfig) (*DatasetLidar, error) {
+	framePaths, err := ListLidarDatasetFrames(filepath.Join(datasetDir, LidarDatasetDir))
+	if err != nil {
+		return nil, err
+	}
+	if len(framePaths) == 0 {
+		return nil, errors.Errorf("the offline dataset in %s has no lidar dataset frames", datasetDir)
+	}
+	lidar := &DatasetLidar{datasetReplay: datasetReplay{config: config}}
+	for _, framePath := range framePaths {
+		frame, err := ReadLidarDatasetFrame(framePath)
+		if err != nil {
+			return nil, err
+		}
+		// the frames are encoded again anyway, so frames cartographer cannot read are converted rather than rejected
+		if frame, err = SupportedPCD(frame, true); err != nil {
+			return nil, errors.Wrapf(err, "failed to read pcd %s", framePath)
+		}
+		pc, err := pointcloud.ReadPCD(bytes.NewReader(frame))
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to read pcd %s", framePath)
+		}
+		buf := new(bytes.Buffer)
+		if err := pointcloud.ToPCD(pc, buf, pointcloud.PCDBinary); err != nil {
+			return nil, err
+		}
+		lidar.frames = append(lidar.frames, buf.Bytes())
+	}
+	return lidar, nil
+}
+
+// Name returns the name of the lidar.
+func (lidar *DatasetLidar) Name() string {
+	return lidar.config.Name
+}
+
+// DataFrequencyHz returns the data rate of the lidar.
+func (lidar *DatasetLidar) DataFrequencyHz() int {
+	return lidar.config.DataFrequencyHz
+}
+
+// TimedLidarReading returns the next frame of the dataset. The reading must not be modified, as it is returned
+// again by the next loop.
+func (lidar *DatasetLidar) TimedLidarReading(ctx context.Context) (TimedLidarReadingResponse, error) {
+	i, readingTime, ok := lidar.next(len(lidar.frames))
+	if !ok {
+		return TimedLidarReadingResponse{}, replaypcd.ErrEndOfDataset
+	}
+	return TimedLidarReadingResponse{Reading: lidar.frames[i], ReadingTime: readingTime}, nil
+}
+
+// DatasetMovementSensor replays the readings of the movement sensor dataset of an offline dataset as a
+// TimedMovementSensor. It is safe for concurrent use.
+type DatasetMovementSensor struct {
+	datasetReplay
+	data       MovementSensorDataset
+	properties MovementSensorProperties
+}
+
+// NewDatasetMovementSensor returns a DatasetMovementSensor replaying the IMU and odometer readings, as set in
+// properties, of the movement sensor dataset of the offline dataset in datasetDir.
+func NewDatasetMovementSensor(
+	datasetDir string,
+	config DatasetReplayConfig,
+	properties MovementSensorProperties,
+) (*DatasetMovementSensor, error) {
+	data, err := ReadMovementSensorDataset(filepath.Join(datasetDir, MovementSensorDatasetFile))
+	if err != nil {
+		return nil, err
+	}
+	if len(data.AngVelData) == 0 {
+		return nil, errors.Errorf("the offline dataset in %s has no movement sensor readings", datasetDir)
+	}
+	if len(data.LinAccData) != len(data.AngVelData) || len(data.OrientationData) != len(data.AngVelData) ||
+		len(data.PosData) != len(data.AngVelData) ||
+		(properties.VelocitySupported && len(data.LinVelData) != len(data.AngVelData)) {
+		return nil, errors.Errorf("the movement sensor readings of the offline dataset in %s are not of the same number",
+			datasetDir)
+	}
+	return &DatasetMovementSensor{
+		datasetReplay: datasetReplay{config: config},
+		data:          data,
+		properties:    properties,
+	}, nil
+}
+
+// Name returns the name of the movement sensor.
+func (ms *DatasetMovementSensor) Name() string {
+	return ms.config.Name
+}
+
+// DataFrequencyHz returns the data rate of the movement sensor.
+func (ms *DatasetMovementSensor) DataFrequencyHz() int {
+	return ms.config.DataFrequencyHz
+}
+
+// Properties returns which of IMU and odometer readings the movement sensor replays.
+func (ms *DatasetMovementSensor) Properties() MovementSensorProperties {
+	return ms.properties
+}
+
+// TimedMovementSensorReading returns the next reading of the dataset.
+func (ms *DatasetMovementSensor) TimedMovementSensorReading(ctx context.Context) (TimedMovementSensorReadingResponse, error) {
+	i, readingTime, ok := ms.next(len(ms.data.AngVelData))
+	if !ok {
+		return TimedMovementSensorReadingResponse{}, replaymovementsensor.ErrEndOfDataset
+	}
+	return ms.data.Reading(i, readingTime, ms.properties), nil
+}
+
+// Reading returns the i-th reading of the dataset taken at readingTime, with the IMU and odometer readings only
+// filled in if properties supports them. If properties has VelocitySupported set, the velocity reading is filled
+// in instead of the odometer reading, which is integrated from it.
+func (data MovementSensorDataset) Reading(
+	i int,
+	readingTime time.Time,
+	properties MovementSensorProperties,
+) TimedMovementSensorReadingResponse {
+	var timedIMUResponse TimedIMUReadingResponse
+	if properties.IMUSupported {
+		linAcc := data.LinAccData[i].LinAcc
+		angVel := data.AngVelData[i].AngVel
+		timedIMUResponse = TimedIMUReadingResponse{
+			LinearAcceleration: r3.Vector{X: linAcc.X, Y: linAcc.Y, Z: linAcc.Z},
+			AngularVelocity:    spatialmath.AngularVelocity{X: angVel.X, Y: angVel.Y, Z: angVel.Z},
+			ReadingTime:        readingTime,
+		}
+	}
+
+	if properties.VelocitySupported {
+		linVel := data.LinVelData[i].LinVel
+		angVel := data.AngVelData[i].AngVel
+		return TimedMovementSensorReadingResponse{
+			TimedIMUResponse: &timedIMUResponse,
+			TimedVelocityResponse: &TimedVelocityReadingResponse{
+				LinearVelocity:  r3.Vector{X: linVel.X, Y: linVel.Y, Z: linVel.Z},
+				AngularVelocity: spatialmath.AngularVelocity{X: angVel.X, Y: angVel.Y, Z: angVel.Z},
+				ReadingTime:     readingTime,
+			},
+		}
+	}
+
+	var timedOdometerResponse TimedOdometerReadingResponse
+	if properties.OdometerSupported {
+		coordinate := data.PosData[i].Coordinate
+		orientation := data.OrientationData[i].Orientation
+		timedOdometerResponse = TimedOdometerReadingResponse{
+			Position: geo.NewPoint(coordinate.Latitude, coordinate.Longitude),
+			Orientation: &spatialmath.OrientationVector{
+				Theta: orientation.Theta,
+				OX:    orientation.Ox,
+				OY:    orientation.Oy,
+				OZ:    orientation.Oz,
+			},
+			ReadingTime: readingTime,
+		}
+	}
+
+	return TimedMovementSensorReadingResponse{
+		TimedIMUResponse:      &timedIMUResponse,
+		TimedOdometerResponse: &timedOdometerResponse,
+	}
+}
@@ -0,0 +1,103 @@
+package sensors_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.viam.com/rdk/components/camera/replaypcd"
+	replaymovementsensor "go.viam.com/rdk/components/movementsensor/replay"
+	"go.viam.com/test"
+
+	s "github.com/viam-modules/viam-cartographer/sensors"
+)
+
+func TestDatasetReplay(t *testing.T) {
+	cfg := s.DefaultSyntheticDatasetConfig()
+	cfg.NumScans = 3
+	cfg.MovementSensorReadingsPerScan = 2
+	dir := t.TempDir()
+	test.That(t, s.GenerateSyntheticDataset(dir, cfg), test.ShouldBeNil)
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	t.Run("the lidar returns the end of dataset error after the last frame", func(t *testing.T) {
+		lidar, err := s.NewDatasetLidar(dir, s.DatasetReplayConfig{
+			Name:            "front lidar",
+			DataFrequencyHz: 5,
+			Start:           start,
+			Interval:        200 * time.Millisecond,
+		})
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, lidar.Name(), test.ShouldEqual, "front lidar")
+		test.That(t, lidar.DataFrequencyHz(), test.ShouldEqual, 5)
+		for i := 0; i < cfg.NumScans; i++ {
+			reading, err := lidar.TimedLidarReading(context.Background())
+			test.That(t, err, test.ShouldBeNil)
+			test.That(t, reading.Reading, test.ShouldNotBeEmpty)
+			test.That(t, reading.ReadingTime, test.ShouldEqual, start.Add(time.Duration(i)*200*time.Millisecond))
+		}
+		_, err = lidar.TimedLidarReading(context.Background())
+		test.That(t, errors.Is(err, replaypcd.ErrEndOfDataset), test.ShouldBeTrue)
+	})
+
+	t.Run("the looping lidar starts over with reading times that keep increasing", func(t *testing.T) {
+		lidar, err := s.NewDatasetLidar(dir, s.DatasetReplayConfig{Start: start, Interval: time.Second, Loop: true})
+		test.That(t, err, test.ShouldBeNil)
+		var readings []s.TimedLidarReadingResponse
+		for i := 0; i < 3*cfg.NumScans; i++ {
+			reading, err := lidar.TimedLidarReading(context.Background())
+			test.That(t, err, test.ShouldBeNil)
+			test.That(t, reading.ReadingTime, test.ShouldEqual, start.Add(time.Duration(i)*time.Second))
+			readings = append(readings, reading)
+		}
+		for i := cfg.NumScans; i < len(readings); i++ {
+			test.That(t, readings[i].Reading, test.ShouldResemble, readings[i%cfg.NumScans].Reading)
+		}
+	})
+
+	t.Run("the movement sensor replays the readings it supports", func(t *testing.T) {
+		ms, err := s.NewDatasetMovementSensor(dir, s.DatasetReplayConfig{
+			Name:     "imu",
+			Start:    start,
+			Interval: 100 * time.Millisecond,
+		}, s.MovementSensorProperties{IMUSupported: true})
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, ms.Properties(), test.ShouldResemble, s.MovementSensorProperties{IMUSupported: true})
+		numReadings := cfg.NumScans * cfg.MovementSensorReadingsPerScan
+		for i := 0; i < numReadings; i++ {
+			reading, err := ms.TimedMovementSensorReading(context.Background())
+			test.That(t, err, test.ShouldBeNil)
+			test.That(t, reading.TimedIMUResponse.ReadingTime, test.ShouldEqual, start.Add(time.Duration(i)*100*time.Millisecond))
+			test.That(t, reading.TimedIMUResponse.LinearAcceleration.Z, test.ShouldBeGreaterThan, 9)
+			test.That(t, reading.TimedOdometerResponse.Position, test.ShouldBeNil)
+		}
+		_, err = ms.TimedMovementSensorReading(context.Background())
+		test.That(t, errors.Is(err, replaymovementsensor.ErrEndOfDataset), test.ShouldBeTrue)
+	})
+
+	t.Run("the looping movement sensor starts over with reading times that keep increasing", func(t *testing.T) {
+		ms, err := s.NewDatasetMovementSensor(dir, s.DatasetReplayConfig{Start: start, Interval: time.Second, Loop: true},
+			s.MovementSensorProperties{OdometerSupported: true})
+		test.That(t, err, test.ShouldBeNil)
+		numReadings := cfg.NumScans * cfg.MovementSensorReadingsPerScan
+		first, err := ms.TimedMovementSensorReading(context.Background())
+		test.That(t, err, test.ShouldBeNil)
+		for i := 1; i < numReadings; i++ {
+			_, err := ms.TimedMovementSensorReading(context.Background())
+			test.That(t, err, test.ShouldBeNil)
+		}
+		looped, err := ms.TimedMovementSensorReading(context.Background())
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, looped.TimedOdometerResponse.Position, test.ShouldResemble, first.TimedOdometerResponse.Position)
+		test.That(t, looped.TimedOdometerResponse.ReadingTime, test.ShouldEqual,
+			start.Add(time.Duration(numReadings)*time.Second))
+	})
+
+	t.Run("a dataset without readings cannot be replayed", func(t *testing.T) {
+		_, err := s.NewDatasetLidar(t.TempDir(), s.DatasetReplayConfig{})
+		test.That(t, err, test.ShouldNotBeNil)
+		_, err = s.NewDatasetMovementSensor(t.TempDir(), s.DatasetReplayConfig{}, s.MovementSensorProperties{})
+		test.That(t, err, test.ShouldNotBeNil)
+	})
+}
@@ -0,0 +1,136 @@
+package sensors
+
+import (
+	"bytes"
+	"context"
+	"math"
+
+	"github.com/golang/geo/r3"
+	"github.com/pkg/errors"
+	"go.viam.com/rdk/pointcloud"
+)
+
+// LidarPointFilter removes points of lidar readings, in the lidar frame, that are closer than MinRangeMm, further
+// than MaxRangeMm or, if HasAngularWindow is set, outside of the angular window from AngleMinDeg to AngleMaxDeg,
+// e.g. points of the chassis of the robot the lidar sees. Ranges of 0 are not applied.
+type LidarPointFilter struct {
+	MinRangeMm float64
+	MaxRangeMm float64
+	// The angles are in degrees counterclockwise from the +x axis of the lidar, between -180 and 180. A window
+	// whose minimum angle is greater than its maximum angle wraps around -180 and 180.
+	HasAngularWindow bool
+	AngleMinDeg      float64
+	AngleMaxDeg      float64
+}
+
+// IsZero returns whether the filter keeps all points.
+func (filter LidarPointFilter) IsZero() bool {
+	return filter.MinRangeMm == 0 && filter.MaxRangeMm == 0 && !filter.HasAngularWindow
+}
+
+// Validate returns an error if the ranges are negative or inverted or the angles are out of range.
+func (filter LidarPointFilter) Validate() error {
+	if filter.MinRangeMm < 0 || filter.MaxRangeMm < 0 {
+		return errors.New("the ranges of a lidar point filter must not be negative")
+	}
+	if filter.MaxRangeMm != 0 && filter.MaxRangeMm <= filter.MinRangeMm {
+		return errors.New("the max range of a lidar point filter must be greater than its min range")
+	}
+	if filter.HasAngularWindow && (math.Abs(filter.AngleMinDeg) > 180 || math.Abs(filter.AngleMaxDeg) > 180) {
+		return errors.New("the angles of a lidar point filter must be between -180 and 180 degrees")
+	}
+	return nil
+}
+
+// keeps returns whether the filter keeps the point p, in millimeters in the lidar frame.
+func (filter LidarPointFilter) keeps(p r3.Vector) bool {
+	distance := p.Norm()
+	if distance < filter.MinRangeMm || (filter.MaxRangeMm != 0 && distance > filter.MaxRangeMm) {
+		return false
+	}
+	if !filter.HasAngularWindow {
+		return true
+	}
+	angle := math.Atan2(p.Y, p.X) * 180 / math.Pi
+	if filter.AngleMinDeg <= filter.AngleMaxDeg {
+		return angle >= filter.AngleMinDeg && angle <= filter.AngleMaxDeg
+	}
+	return angle >= filter.AngleMinDeg || angle <= filter.AngleMaxDeg
+}
+
+// FilterLidarReading returns the lidar reading, an ASCII, binary or binary compressed PCD, as a binary PCD with the
+// points the filter removes left out, along with the number of points that were kept and removed.
+func (filter LidarPointFilter) FilterLidarReading(reading []byte) ([]byte, int, int, error) {
+	pc, err := ReadLidarReading(reading)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+
+	filtered := pointcloud.NewWithPrealloc(pc.Size())
+	numRemoved := 0
+	var setErr error
+	pc.Iterate(0, 0, func(p r3.Vector, d pointcloud.Data) bool {
+		if !filter.keeps(p) {
+			numRemoved++
+			return true
+		}
+		setErr = filtered.Set(p, d)
+		return setErr == nil
+	})
+	if setErr != nil {
+		return nil, 0, 0, setErr
+	}
+
+	buf := new(bytes.Buffer)
+	if err := pointcloud.ToPCD(filtered, buf, pointcloud.PCDBinary); err != nil {
+		return nil, 0, 0, err
+	}
+	return buf.Bytes(), filtered.Size(), numRemoved, nil
+}
+
+// filteringLidar removes the points of the readings of a lidar that its filter does not keep.
+type filteringLidar struct {
+	TimedLidar
+	filter LidarPointFilter
+}
+
+// NewFilteringLidar returns the lidar with the points of its readings filtered by filter, or the lidar itself if
+// the filter keeps all points. Readings are filtered in the frame of the lidar, so the lidar must not be
+// calibrated yet.
+func NewFilteringLidar(lidar TimedLidar, filter LidarPointFilter) TimedLidar {
+	if filter.IsZero() {
+		return lidar
+	}
+	return &filteringLidar{TimedLidar: lidar, filter: filter}
+}
+
+// TimedLidarReading returns the next reading of the lidar, filtered.
+func (lidar *filteringLidar) TimedLidarReading(ctx context.Context) (TimedLidarReadingResponse, error) {
+	reading, err := lidar.TimedLidar.TimedLidarReading(ctx)
+	if err != nil {
+		return reading, err
+	}
+	if reading.Reading, _, _, err = lidar.filter.FilterLidarReading(reading.Reading); err != nil {
+		return TimedLidarReadingResponse{}, err
+	}
+	return reading, nil
+}
+
+// ResourceHealth returns the health of the resource the lidar it filters reads from.
+func (lidar *filteringLidar) ResourceHealth() (ResourceHealth, bool) {
+	return ResourceHealthOf(lidar.TimedLidar)
+}
+
+// Refresh returns the lidar with its camera resolved again by resolve, filtered the same way. It fails if the
+// lidar it filters is not a RefreshableLidar.
+func (lidar *filteringLidar) Refresh(ctx context.Context, resolve ResourceResolver) (TimedLidar, error) {
+	refreshable, ok := lidar.TimedLidar.(RefreshableLidar)
+	if !ok {
+		return nil, errors.Errorf("lidar %v cannot be refreshed", lidar.Name())
+	}
+	refreshed, err := refreshable.Refresh(ctx, resolve)
+	if err != nil {
+		return nil, err
+	}
+	return &filteringLidar{TimedLidar: refreshed, filter: lidar.filter}, nil
+}
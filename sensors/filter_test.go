@@ -0,0 +1,118 @@
+package sensors_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang/geo/r3"
+	"go.viam.com/rdk/pointcloud"
+	"go.viam.com/rdk/resource"
+	"go.viam.com/test"
+
+	s "github.com/viam-modules/viam-cartographer/sensors"
+	"github.com/viam-modules/viam-cartographer/sensors/inject"
+	"github.com/viam-modules/viam-cartographer/testhelper/pcdtest"
+)
+
+// filterTestPoints are points around the lidar in millimeters: two of the chassis within 200mm, four at 1m in
+// every direction and one at 10m ahead.
+var filterTestPoints = []r3.Vector{
+	{X: 100}, {X: -150, Y: 50},
+	{X: 1000}, {Y: 1000}, {X: -1000}, {Y: -1000},
+	{X: 10000},
+}
+
+func TestLidarPointFilter(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		filter   s.LidarPointFilter
+		expected []r3.Vector
+	}{
+		{
+			name:     "min range removes the points within the radius",
+			filter:   s.LidarPointFilter{MinRangeMm: 200},
+			expected: []r3.Vector{{X: -1000}, {Y: -1000}, {Y: 1000}, {X: 1000}, {X: 10000}},
+		},
+		{
+			name:     "max range removes the points beyond the radius",
+			filter:   s.LidarPointFilter{MinRangeMm: 200, MaxRangeMm: 5000},
+			expected: []r3.Vector{{X: -1000}, {Y: -1000}, {Y: 1000}, {X: 1000}},
+		},
+		{
+			name:     "an angular window keeps the points within it",
+			filter:   s.LidarPointFilter{HasAngularWindow: true, AngleMinDeg: -90, AngleMaxDeg: 90},
+			expected: []r3.Vector{{Y: -1000}, {Y: 1000}, {X: 100}, {X: 1000}, {X: 10000}},
+		},
+		{
+			name:     "an angular window can wrap around 180 degrees",
+			filter:   s.LidarPointFilter{MinRangeMm: 200, HasAngularWindow: true, AngleMinDeg: 135, AngleMaxDeg: -135},
+			expected: []r3.Vector{{X: -1000}},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			for _, format := range []pointcloud.PCDType{pointcloud.PCDAscii, pointcloud.PCDBinary} {
+				reading := pcdtest.PointsToPCDWithFormat(t, filterTestPoints, format)
+				filtered, numKept, numRemoved, err := tc.filter.FilterLidarReading(reading)
+				test.That(t, err, test.ShouldBeNil)
+				test.That(t, numKept, test.ShouldEqual, len(tc.expected))
+				test.That(t, numRemoved, test.ShouldEqual, len(filterTestPoints)-len(tc.expected))
+				points := pcdtest.SortedPoints(t, filtered)
+				test.That(t, len(points), test.ShouldEqual, len(tc.expected))
+				for i := range points {
+					shouldAlmostEqualVector(t, points[i], tc.expected[i])
+				}
+			}
+		})
+	}
+
+	t.Run("invalid filters fail validation", func(t *testing.T) {
+		test.That(t, s.LidarPointFilter{MinRangeMm: 200}.Validate(), test.ShouldBeNil)
+		test.That(t, s.LidarPointFilter{MinRangeMm: -1}.Validate(), test.ShouldNotBeNil)
+		test.That(t, s.LidarPointFilter{MinRangeMm: 200, MaxRangeMm: 100}.Validate(), test.ShouldNotBeNil)
+		test.That(t, s.LidarPointFilter{HasAngularWindow: true, AngleMinDeg: -190}.Validate(), test.ShouldNotBeNil)
+	})
+}
+
+func TestFilteringLidar(t *testing.T) {
+	readingTime := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	lidar := &inject.TimedLidar{}
+	lidar.NameFunc = func() string { return "my-lidar" }
+	lidar.TimedLidarReadingFunc = func(ctx context.Context) (s.TimedLidarReadingResponse, error) {
+		return s.TimedLidarReadingResponse{
+			Reading:     pcdtest.PointsToPCDWithFormat(t, filterTestPoints, pointcloud.PCDAscii),
+			ReadingTime: readingTime,
+		}, nil
+	}
+
+	t.Run("is the lidar itself without filters", func(t *testing.T) {
+		test.That(t, s.NewFilteringLidar(lidar, s.LidarPointFilter{}), test.ShouldEqual, lidar)
+	})
+
+	t.Run("removes the points of the readings the filter does not keep", func(t *testing.T) {
+		filtering := s.NewFilteringLidar(lidar, s.LidarPointFilter{MinRangeMm: 200})
+		test.That(t, filtering.Name(), test.ShouldEqual, "my-lidar")
+
+		reading, err := filtering.TimedLidarReading(context.Background())
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, reading.ReadingTime, test.ShouldEqual, readingTime)
+		test.That(t, len(pcdtest.SortedPoints(t, reading.Reading)), test.ShouldEqual, len(filterTestPoints)-2)
+	})
+
+	t.Run("stays filtered when the lidar is resolved again", func(t *testing.T) {
+		refreshedLidar := &inject.TimedLidar{}
+		refreshedLidar.NameFunc = lidar.NameFunc
+		refreshedLidar.TimedLidarReadingFunc = lidar.TimedLidarReadingFunc
+		lidar.RefreshFunc = func(ctx context.Context, resolve s.ResourceResolver) (s.TimedLidar, error) {
+			return refreshedLidar, nil
+		}
+		filtering := s.NewFilteringLidar(lidar, s.LidarPointFilter{MinRangeMm: 200}).(s.RefreshableLidar)
+		refreshed, err := filtering.Refresh(context.Background(), s.DependenciesResolver(resource.Dependencies{}))
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, refreshed, test.ShouldNotEqual, filtering)
+
+		reading, err := refreshed.TimedLidarReading(context.Background())
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, len(pcdtest.SortedPoints(t, reading.Reading)), test.ShouldEqual, len(filterTestPoints)-2)
+	})
+}
@@ -0,0 +1,360 @@
+package sensors
+
+import (
+	"bytes"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/golang/geo/r1"
+	"github.com/golang/geo/r2"
+	"github.com/golang/geo/r3"
+	geo "github.com/kellydunn/golang-geo"
+	"github.com/pkg/errors"
+	"go.viam.com/rdk/pointcloud"
+)
+
+const (
+	// standardGravity is the gravitational acceleration, in m/s^2, reported on the z axis of a synthetic IMU.
+	standardGravity = 9.80665
+	// obstacleMinSizeM and obstacleMaxSizeM bound the side lengths, in meters, of synthetic obstacles.
+	obstacleMinSizeM = 0.3
+	obstacleMaxSizeM = 0.8
+	// obstacleWallClearanceM is the minimum distance, in meters, between a synthetic obstacle and the walls.
+	obstacleWallClearanceM = 0.2
+	// obstaclePathClearanceM is the minimum distance, in meters, between a synthetic obstacle and the trajectory.
+	obstaclePathClearanceM = 0.5
+	// maxObstaclePlacementAttempts bounds the number of random placements tried per synthetic obstacle.
+	maxObstaclePlacementAttempts = 1000
+	// trajectoryRadiusRatio is the radius of the circular trajectory relative to the shorter side of the room.
+	trajectoryRadiusRatio = 0.25
+)
+
+// SyntheticDatasetConfig parameterizes the environment, trajectory and sensors of a synthetic offline dataset.
+type SyntheticDatasetConfig struct {
+	// Seed seeds the placement of the obstacles and the lidar noise.
+	Seed int64
+	// NumScans is the number of lidar scans.
+	NumScans int
+	// MovementSensorReadingsPerScan is the number of movement sensor readings taken per lidar scan.
+	MovementSensorReadingsPerScan int
+	// RoomWidthM and RoomLengthM are the dimensions of the rectangular room in meters.
+	RoomWidthM  float64
+	RoomLengthM float64
+	// NumObstacles is the number of box obstacles placed in the room.
+	NumObstacles int
+	// PointsPerScan is the number of evenly spaced beams of a lidar scan.
+	PointsPerScan int
+	// MaxRangeM is the maximum range of the lidar in meters. Beams that hit nothing within it yield no point.
+	MaxRangeM float64
+	// RangeNoiseStdDevM is the standard deviation, in meters, of the gaussian noise added to each lidar range.
+	RangeNoiseStdDevM float64
+	// SpeedMPS is the speed of the robot in m/s.
+	SpeedMPS float64
+	// ScanInterval is the time between two lidar scans.
+	ScanInterval time.Duration
+	// StartTime is the time of the first reading.
+	StartTime time.Time
+	// CompressionLevel is the gzip level the lidar scans are compressed with, see WriteLidarDatasetFrame.
+	CompressionLevel int
+}
+
+// DefaultSyntheticDatasetConfig returns a config for a small dataset with the same number of lidar scans
+// and movement sensor readings, and the same reading intervals, as the integration test mock data.
+func DefaultSyntheticDatasetConfig() SyntheticDatasetConfig {
+	return SyntheticDatasetConfig{
+		Seed:                          1,
+		NumScans:                      10,
+		MovementSensorReadingsPerScan: 4,
+		RoomWidthM:                    10,
+		RoomLengthM:                   8,
+		NumObstacles:                  5,
+		PointsPerScan:                 720,
+		MaxRangeM:                     12,
+		RangeNoiseStdDevM:             0.01,
+		SpeedMPS:                      0.5,
+		ScanInterval:                  200 * time.Millisecond,
+		StartTime:                     time.Date(2021, 8, 15, 14, 30, 45, 1, time.UTC),
+	}
+}
+
+// Validate returns an error if the config cannot be used to generate a dataset.
+func (cfg SyntheticDatasetConfig) Validate() error {
+	switch {
+	case cfg.NumScans <= 0:
+		return errors.New("synthetic dataset number of scans must be greater than zero")
+	case cfg.MovementSensorReadingsPerScan <= 0:
+		return errors.New("synthetic dataset movement sensor readings per scan must be greater than zero")
+	case cfg.RoomWidthM <= 0 || cfg.RoomLengthM <= 0:
+		return errors.New("synthetic dataset room dimensions must be greater than zero")
+	case cfg.NumObstacles < 0:
+		return errors.New("synthetic dataset number of obstacles cannot be less than zero")
+	case cfg.PointsPerScan <= 0:
+		return errors.New("synthetic dataset points per scan must be greater than zero")
+	case cfg.MaxRangeM <= 0:
+		return errors.New("synthetic dataset max range must be greater than zero")
+	case cfg.RangeNoiseStdDevM < 0:
+		return errors.New("synthetic dataset range noise cannot be less than zero")
+	case cfg.SpeedMPS < 0:
+		return errors.New("synthetic dataset speed cannot be less than zero")
+	case cfg.ScanInterval <= 0:
+		return errors.New("synthetic dataset scan interval must be greater than zero")
+	}
+	return ValidateDatasetCompressionLevel(cfg.CompressionLevel)
+}
+
+// syntheticPose is a 2D pose of the robot in meters and radians.
+type syntheticPose struct {
+	position r2.Point
+	heading  float64
+}
+
+// syntheticEnvironment is a rectangular room with box obstacles and a robot driving counterclockwise on a
+// circle around the center of the room. The robot starts at the bottom of the circle facing the +x axis.
+type syntheticEnvironment struct {
+	room      r2.Rect
+	obstacles []r2.Rect
+	center    r2.Point
+	radius    float64
+	// angularSpeed is the yaw rate of the robot in radians/s.
+	angularSpeed float64
+}
+
+func newSyntheticEnvironment(cfg SyntheticDatasetConfig, rng *rand.Rand) (*syntheticEnvironment, error) {
+	room := r2.RectFromPoints(r2.Point{}, r2.Point{X: cfg.RoomWidthM, Y: cfg.RoomLengthM})
+	env := &syntheticEnvironment{
+		room:   room,
+		center: room.Center(),
+		radius: trajectoryRadiusRatio * math.Min(cfg.RoomWidthM, cfg.RoomLengthM),
+	}
+	env.angularSpeed = cfg.SpeedMPS / env.radius
+
+	for len(env.obstacles) < cfg.NumObstacles {
+		obstacle, ok := env.placeObstacle(rng)
+		if !ok {
+			return nil, errors.Errorf("could not place %d obstacles in a %vm x %vm room", cfg.NumObstacles, cfg.RoomWidthM, cfg.RoomLengthM)
+		}
+		env.obstacles = append(env.obstacles, obstacle)
+	}
+	return env, nil
+}
+
+// placeObstacle returns a randomly sized and placed obstacle that keeps clear of the walls and the trajectory.
+func (env *syntheticEnvironment) placeObstacle(rng *rand.Rand) (r2.Rect, bool) {
+	free := env.room.ExpandedByMargin(-obstacleWallClearanceM)
+	for range maxObstaclePlacementAttempts {
+		size := r2.Point{
+			X: obstacleMinSizeM + rng.Float64()*(obstacleMaxSizeM-obstacleMinSizeM),
+			Y: obstacleMinSizeM + rng.Float64()*(obstacleMaxSizeM-obstacleMinSizeM),
+		}
+		center := r2.Point{
+			X: free.X.Lo + rng.Float64()*free.X.Length(),
+			Y: free.Y.Lo + rng.Float64()*free.Y.Length(),
+		}
+		obstacle := r2.RectFromCenterSize(center, size)
+		if !free.Contains(obstacle) {
+			continue
+		}
+
+		// the closest and farthest points of the obstacle to the center of the trajectory
+		closest := obstacle.ClampPoint(env.center)
+		farthest := r2.Point{
+			X: farthestBound(obstacle.X, env.center.X),
+			Y: farthestBound(obstacle.Y, env.center.Y),
+		}
+		if closest.Sub(env.center).Norm() > env.radius+obstaclePathClearanceM ||
+			farthest.Sub(env.center).Norm() < env.radius-obstaclePathClearanceM {
+			return obstacle, true
+		}
+	}
+	return r2.Rect{}, false
+}
+
+// farthestBound returns the bound of the interval that is farthest from x.
+func farthestBound(interval r1.Interval, x float64) float64 {
+	if x-interval.Lo > interval.Hi-x {
+		return interval.Lo
+	}
+	return interval.Hi
+}
+
+// pose returns the pose of the robot in the room at elapsed seconds since the start of the dataset.
+func (env *syntheticEnvironment) pose(elapsed float64) syntheticPose {
+	heading := env.angularSpeed * elapsed
+	angle := heading - math.Pi/2
+	return syntheticPose{
+		position: env.center.Add(r2.Point{X: math.Cos(angle), Y: math.Sin(angle)}.Mul(env.radius)),
+		heading:  heading,
+	}
+}
+
+// rayRectIntersection returns the distances along the ray from origin in the unit direction dir at which it
+// enters and exits rect, and whether the line of the ray intersects rect at all.
+func rayRectIntersection(origin, dir r2.Point, rect r2.Rect) (float64, float64, bool) {
+	tNear, tFar := math.Inf(-1), math.Inf(1)
+	for _, axis := range []struct {
+		origin, dir float64
+		interval    r1.Interval
+	}{
+		{origin.X, dir.X, rect.X},
+		{origin.Y, dir.Y, rect.Y},
+	} {
+		if axis.dir == 0 {
+			if !axis.interval.Contains(axis.origin) {
+				return 0, 0, false
+			}
+			continue
+		}
+		t1 := (axis.interval.Lo - axis.origin) / axis.dir
+		t2 := (axis.interval.Hi - axis.origin) / axis.dir
+		tNear = math.Max(tNear, math.Min(t1, t2))
+		tFar = math.Min(tFar, math.Max(t1, t2))
+	}
+	return tNear, tFar, tNear <= tFar
+}
+
+// castRay returns the distance from origin to the first wall or obstacle hit in the unit direction dir.
+func (env *syntheticEnvironment) castRay(origin, dir r2.Point) float64 {
+	// the robot is inside the room, so the ray hits a wall where it exits the room
+	_, dist, _ := rayRectIntersection(origin, dir, env.room)
+	for _, obstacle := range env.obstacles {
+		if tNear, _, ok := rayRectIntersection(origin, dir, obstacle); ok && tNear > 0 && tNear < dist {
+			dist = tNear
+		}
+	}
+	return dist
+}
+
+// scan returns a lidar reading, in meters in the lidar frame, taken at pose.
+func (env *syntheticEnvironment) scan(cfg SyntheticDatasetConfig, pose syntheticPose, rng *rand.Rand) ([]byte, error) {
+	pc := pointcloud.NewWithPrealloc(cfg.PointsPerScan)
+	for i := range cfg.PointsPerScan {
+		beamAngle := 2 * math.Pi * float64(i) / float64(cfg.PointsPerScan)
+		dir := r2.Point{X: math.Cos(pose.heading + beamAngle), Y: math.Sin(pose.heading + beamAngle)}
+		dist := env.castRay(pose.position, dir) + cfg.RangeNoiseStdDevM*rng.NormFloat64()
+		if dist <= 0 || dist > cfg.MaxRangeM {
+			continue
+		}
+		// pointclouds are in millimeters and are written to the PCD in meters
+		point := r3.Vector{X: dist * math.Cos(beamAngle), Y: dist * math.Sin(beamAngle)}.Mul(metersToMillimeters)
+		if err := pc.Set(point, pointcloud.NewBasicData()); err != nil {
+			return nil, err
+		}
+	}
+
+	buf := new(bytes.Buffer)
+	if err := pointcloud.ToPCD(pc, buf, pointcloud.PCDBinary); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// syntheticGeoPoint returns the GPS coordinate of a position, in meters relative to the start of the
+// trajectory, that spatialmath.GeoPointToPoint converts back to the position relative to (0, 0).
+func syntheticGeoPoint(position r2.Point) *geo.Point {
+	const metersPerKilometer = 1000
+	return geo.NewPoint(
+		(position.Y/metersPerKilometer/geo.EARTH_RADIUS)*180/math.Pi,
+		(position.X/metersPerKilometer/geo.EARTH_RADIUS)*180/math.Pi,
+	)
+}
+
+func toDatasetTime(t time.Time) DatasetTime {
+	return DatasetTime{Seconds: int(t.Unix()), Nanos: t.Nanosecond()}
+}
+
+// movementSensorReadings returns the movement sensor readings of the robot driving on its trajectory. The
+// odometer reports the pose relative to the start of the trajectory, the IMU reports the yaw rate and the
+// centripetal acceleration, which points to the left of the robot, plus gravity. The linear velocity, as a wheel
+// encoder reports it, points to the front of the robot.
+func (env *syntheticEnvironment) movementSensorReadings(cfg SyntheticDatasetConfig) MovementSensorDataset {
+	numReadings := cfg.NumScans * cfg.MovementSensorReadingsPerScan
+	interval := cfg.ScanInterval / time.Duration(cfg.MovementSensorReadingsPerScan)
+	start := env.pose(0)
+
+	var data MovementSensorDataset
+	for i := range numReadings {
+		readingTime := toDatasetTime(cfg.StartTime.Add(time.Duration(i) * interval))
+		pose := env.pose((time.Duration(i) * interval).Seconds())
+		coordinate := syntheticGeoPoint(pose.position.Sub(start.position))
+
+		data.AngVelData = append(data.AngVelData, AngularVelocityData{
+			TimeReceived:  readingTime,
+			TimeRequested: readingTime,
+			AngVel:        DatasetVector{Z: env.angularSpeed},
+		})
+		data.LinAccData = append(data.LinAccData, LinearAccelerationData{
+			TimeReceived:  readingTime,
+			TimeRequested: readingTime,
+			LinAcc:        DatasetVector{Y: cfg.SpeedMPS * env.angularSpeed, Z: standardGravity},
+		})
+		data.LinVelData = append(data.LinVelData, LinearVelocityData{
+			TimeReceived:  readingTime,
+			TimeRequested: readingTime,
+			LinVel:        DatasetVector{X: cfg.SpeedMPS},
+		})
+		data.OrientationData = append(data.OrientationData, OrientationData{
+			TimeReceived:  readingTime,
+			TimeRequested: readingTime,
+			Orientation:   DatasetOrientation{Oz: 1, Theta: pose.heading - start.heading},
+		})
+		data.PosData = append(data.PosData, PositionData{
+			TimeReceived:  readingTime,
+			TimeRequested: readingTime,
+			Coordinate:    DatasetCoordinate{Latitude: coordinate.Lat(), Longitude: coordinate.Lng()},
+		})
+	}
+	return data
+}
+
+// SyntheticDatasetFinalPosition returns the position, in millimeters, of the last lidar scan of the dataset
+// GenerateSyntheticDataset writes for cfg, relative to the first scan and in the frame of the robot at the first
+// scan, which is the frame of the map cartographer builds from the dataset.
+func SyntheticDatasetFinalPosition(cfg SyntheticDatasetConfig) (r3.Vector, error) {
+	if err := cfg.Validate(); err != nil {
+		return r3.Vector{}, err
+	}
+	env, err := newSyntheticEnvironment(cfg, rand.New(rand.NewSource(cfg.Seed)))
+	if err != nil {
+		return r3.Vector{}, err
+	}
+	start := env.pose(0)
+	end := env.pose((time.Duration(cfg.NumScans-1) * cfg.ScanInterval).Seconds())
+	offset := end.position.Sub(start.position)
+	sin, cos := math.Sincos(-start.heading)
+	return r3.Vector{X: offset.X*cos - offset.Y*sin, Y: offset.X*sin + offset.Y*cos}.Mul(metersToMillimeters), nil
+}
+
+// GenerateSyntheticDataset writes an offline dataset of a robot driving through a rectangular room with box
+// obstacles to dir: cfg.NumScans lidar scans named by their index in dir/lidar and the matching IMU and
+// odometer readings in dir/movement_sensor/data.json. The output is deterministic for a given config.
+func GenerateSyntheticDataset(dir string, cfg SyntheticDatasetConfig) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+
+	rng := rand.New(rand.NewSource(cfg.Seed))
+	env, err := newSyntheticEnvironment(cfg, rng)
+	if err != nil {
+		return err
+	}
+
+	lidarDir := filepath.Join(dir, LidarDatasetDir)
+	if err := os.MkdirAll(lidarDir, 0o750); err != nil {
+		return err
+	}
+	for i := range cfg.NumScans {
+		reading, err := env.scan(cfg, env.pose((time.Duration(i) * cfg.ScanInterval).Seconds()), rng)
+		if err != nil {
+			return err
+		}
+		if _, err := WriteLidarDatasetFrame(lidarDir, strconv.Itoa(i), reading, cfg.CompressionLevel); err != nil {
+			return err
+		}
+	}
+
+	return WriteMovementSensorDataset(filepath.Join(dir, MovementSensorDatasetFile), env.movementSensorReadings(cfg))
+}
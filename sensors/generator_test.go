@@ -0,0 +1,170 @@
+package sensors_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/golang/geo/r3"
+	geo "github.com/kellydunn/golang-geo"
+	"go.viam.com/rdk/pointcloud"
+	"go.viam.com/rdk/spatialmath"
+	"go.viam.com/test"
+
+	s "github.com/viam-modules/viam-cartographer/sensors"
+)
+
+func readDatasetFiles(t *testing.T, dir string) map[string][]byte {
+	t.Helper()
+	files := map[string][]byte{}
+	err := filepath.WalkDir(dir, func(path string, entry os.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		contents, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		relativePath, err := filepath.Rel(dir, path)
+		files[relativePath] = contents
+		return err
+	})
+	test.That(t, err, test.ShouldBeNil)
+	return files
+}
+
+func TestGenerateSyntheticDataset(t *testing.T) {
+	cfg := s.DefaultSyntheticDatasetConfig()
+
+	t.Run("writes readable lidar scans and movement sensor readings", func(t *testing.T) {
+		dir := t.TempDir()
+		test.That(t, s.GenerateSyntheticDataset(dir, cfg), test.ShouldBeNil)
+
+		framePaths, err := s.ListLidarDatasetFrames(filepath.Join(dir, s.LidarDatasetDir))
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, len(framePaths), test.ShouldEqual, cfg.NumScans)
+		for _, framePath := range framePaths {
+			reading, err := s.ReadLidarDatasetFrame(framePath)
+			test.That(t, err, test.ShouldBeNil)
+			pc, err := pointcloud.ReadPCD(bytes.NewReader(reading))
+			test.That(t, err, test.ShouldBeNil)
+			// the room is closed, so every beam hits a wall or an obstacle
+			test.That(t, pc.Size(), test.ShouldEqual, cfg.PointsPerScan)
+			pc.Iterate(0, 0, func(p r3.Vector, d pointcloud.Data) bool {
+				test.That(t, p.Norm(), test.ShouldBeLessThanOrEqualTo, 1000*cfg.MaxRangeM)
+				test.That(t, p.Z, test.ShouldEqual, 0)
+				return true
+			})
+		}
+
+		data, err := s.ReadMovementSensorDataset(filepath.Join(dir, s.MovementSensorDatasetFile))
+		test.That(t, err, test.ShouldBeNil)
+		numReadings := cfg.NumScans * cfg.MovementSensorReadingsPerScan
+		test.That(t, len(data.AngVelData), test.ShouldEqual, numReadings)
+		test.That(t, len(data.LinAccData), test.ShouldEqual, numReadings)
+		test.That(t, len(data.OrientationData), test.ShouldEqual, numReadings)
+		test.That(t, len(data.PosData), test.ShouldEqual, numReadings)
+		test.That(t, len(data.LinVelData), test.ShouldEqual, numReadings)
+
+		// the odometer starts at the origin and follows a circle of radius r counterclockwise
+		radius := 0.25 * math.Min(cfg.RoomWidthM, cfg.RoomLengthM)
+		angularSpeed := cfg.SpeedMPS / radius
+		last := numReadings - 1
+		elapsed := float64(last) * (cfg.ScanInterval / 4).Seconds()
+		position := spatialmath.GeoPointToPoint(
+			geo.NewPoint(data.PosData[last].Coordinate.Latitude, data.PosData[last].Coordinate.Longitude),
+			geo.NewPoint(0, 0),
+		)
+		test.That(t, position.X, test.ShouldAlmostEqual, 1000*radius*math.Sin(angularSpeed*elapsed), 0.1)
+		test.That(t, position.Y, test.ShouldAlmostEqual, 1000*radius*(1-math.Cos(angularSpeed*elapsed)), 0.1)
+		test.That(t, data.OrientationData[last].Orientation.Theta, test.ShouldAlmostEqual, angularSpeed*elapsed)
+		test.That(t, data.AngVelData[last].AngVel.Z, test.ShouldAlmostEqual, angularSpeed)
+		test.That(t, data.LinAccData[last].LinAcc.Y, test.ShouldAlmostEqual, cfg.SpeedMPS*angularSpeed)
+		test.That(t, data.LinVelData[last].LinVel, test.ShouldResemble, s.DatasetVector{X: cfg.SpeedMPS})
+
+		// the last lidar scan lies on the same circle, relative to the first one
+		finalPosition, err := s.SyntheticDatasetFinalPosition(cfg)
+		test.That(t, err, test.ShouldBeNil)
+		scanElapsed := float64(cfg.NumScans-1) * cfg.ScanInterval.Seconds()
+		test.That(t, finalPosition.X, test.ShouldAlmostEqual, 1000*radius*math.Sin(angularSpeed*scanElapsed), 0.1)
+		test.That(t, finalPosition.Y, test.ShouldAlmostEqual, 1000*radius*(1-math.Cos(angularSpeed*scanElapsed)), 0.1)
+
+		readingTime := cfg.StartTime.Add(cfg.ScanInterval / 4)
+		test.That(t, data.PosData[1].TimeReceived, test.ShouldResemble, s.DatasetTime{
+			Seconds: int(readingTime.Unix()),
+			Nanos:   readingTime.Nanosecond(),
+		})
+	})
+
+	t.Run("is deterministic given a seed", func(t *testing.T) {
+		dir1 := t.TempDir()
+		dir2 := t.TempDir()
+		dir3 := t.TempDir()
+		test.That(t, s.GenerateSyntheticDataset(dir1, cfg), test.ShouldBeNil)
+		test.That(t, s.GenerateSyntheticDataset(dir2, cfg), test.ShouldBeNil)
+		otherSeedCfg := cfg
+		otherSeedCfg.Seed++
+		test.That(t, s.GenerateSyntheticDataset(dir3, otherSeedCfg), test.ShouldBeNil)
+
+		files := readDatasetFiles(t, dir1)
+		test.That(t, len(files), test.ShouldEqual, cfg.NumScans+1)
+		test.That(t, readDatasetFiles(t, dir2), test.ShouldResemble, files)
+		otherSeedFiles := readDatasetFiles(t, dir3)
+		test.That(t, otherSeedFiles["lidar/0.pcd"], test.ShouldNotResemble, files["lidar/0.pcd"])
+	})
+
+	t.Run("compresses the lidar scans with the compression level", func(t *testing.T) {
+		uncompressedDir := t.TempDir()
+		test.That(t, s.GenerateSyntheticDataset(uncompressedDir, cfg), test.ShouldBeNil)
+		uncompressedFiles := readDatasetFiles(t, uncompressedDir)
+
+		compressedCfg := cfg
+		compressedCfg.CompressionLevel = gzip.BestCompression
+		compressedDir := t.TempDir()
+		test.That(t, s.GenerateSyntheticDataset(compressedDir, compressedCfg), test.ShouldBeNil)
+
+		framePaths, err := s.ListLidarDatasetFrames(filepath.Join(compressedDir, s.LidarDatasetDir))
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, len(framePaths), test.ShouldEqual, cfg.NumScans)
+		for i, framePath := range framePaths {
+			test.That(t, framePath, test.ShouldEndWith, s.CompressedPCDExtension)
+			compressed, err := os.ReadFile(framePath)
+			test.That(t, err, test.ShouldBeNil)
+			uncompressed := uncompressedFiles[filepath.Join(s.LidarDatasetDir, strconv.Itoa(i)+s.PCDExtension)]
+			test.That(t, len(compressed), test.ShouldBeLessThan, len(uncompressed))
+
+			reading, err := s.ReadLidarDatasetFrame(framePath)
+			test.That(t, err, test.ShouldBeNil)
+			test.That(t, reading, test.ShouldResemble, uncompressed)
+		}
+	})
+
+	t.Run("rejects invalid configs", func(t *testing.T) {
+		invalidCfg := cfg
+		invalidCfg.NumScans = 0
+		err := s.GenerateSyntheticDataset(t.TempDir(), invalidCfg)
+		test.That(t, err, test.ShouldBeError, "synthetic dataset number of scans must be greater than zero")
+
+		invalidCfg = cfg
+		invalidCfg.ScanInterval = 0
+		err = s.GenerateSyntheticDataset(t.TempDir(), invalidCfg)
+		test.That(t, err, test.ShouldBeError, "synthetic dataset scan interval must be greater than zero")
+
+		invalidCfg = cfg
+		invalidCfg.CompressionLevel = gzip.BestCompression + 1
+		err = s.GenerateSyntheticDataset(t.TempDir(), invalidCfg)
+		test.That(t, err, test.ShouldBeError, s.ErrInvalidDatasetCompressionLevel)
+	})
+
+	t.Run("fails when the obstacles do not fit in the room", func(t *testing.T) {
+		smallRoomCfg := cfg
+		smallRoomCfg.RoomWidthM = 1
+		smallRoomCfg.RoomLengthM = 1
+		err := s.GenerateSyntheticDataset(t.TempDir(), smallRoomCfg)
+		test.That(t, err, test.ShouldBeError, "could not place 5 obstacles in a 1m x 1m room")
+	})
+}
@@ -13,6 +13,7 @@ type TimedLidar struct {
 	NameFunc              func() string
 	DataFrequencyHzFunc   func() int
 	TimedLidarReadingFunc func(ctx context.Context) (s.TimedLidarReadingResponse, error)
+	RefreshFunc           func(ctx context.Context, resolve s.ResourceResolver) (s.TimedLidar, error)
 }
 
 // Name calls the injected Name or the real version.
@@ -38,3 +39,11 @@ func (tls *TimedLidar) TimedLidarReading(ctx context.Context) (s.TimedLidarReadi
 	}
 	return tls.TimedLidarReadingFunc(ctx)
 }
+
+// Refresh calls the injected Refresh or the real version.
+func (tls *TimedLidar) Refresh(ctx context.Context, resolve s.ResourceResolver) (s.TimedLidar, error) {
+	if tls.RefreshFunc == nil {
+		return tls.Lidar.Refresh(ctx, resolve)
+	}
+	return tls.RefreshFunc(ctx, resolve)
+}
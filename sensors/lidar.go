@@ -1,17 +1,33 @@
 package sensors
 
 import (
+	"bufio"
 	"bytes"
 	"context"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/golang/geo/r3"
 	"github.com/pkg/errors"
 	"go.opencensus.io/trace"
 	"go.viam.com/rdk/components/camera"
 	"go.viam.com/rdk/logging"
 	"go.viam.com/rdk/pointcloud"
 	"go.viam.com/rdk/resource"
+	"go.viam.com/rdk/rimage/transform"
 	"go.viam.com/rdk/utils/contextutils"
+	goutils "go.viam.com/utils"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// nextPointCloudProbeAttempts is the number of times NewLidar requests a pointcloud before giving up, as a
+	// lidar may fail its first reads while it starts up.
+	nextPointCloudProbeAttempts = 3
+	// nextPointCloudProbeInterval is the interval between the attempts of NewLidar to request a pointcloud.
+	nextPointCloudProbeInterval = 200 * time.Millisecond
 )
 
 // TimedLidar describes a sensor that reports the time the reading is from & whether or not it is
@@ -22,6 +38,25 @@ type TimedLidar interface {
 	TimedLidarReading(ctx context.Context) (TimedLidarReadingResponse, error)
 }
 
+// RefreshableLidar is a TimedLidar whose camera can be resolved again, e.g. after it was rebuilt and the handle
+// the lidar holds was closed.
+type RefreshableLidar interface {
+	TimedLidar
+	Refresh(ctx context.Context, resolve ResourceResolver) (TimedLidar, error)
+}
+
+// ResourceResolver resolves a resource by name. A resolver backed by the live dependency graph, e.g. the parent
+// robot of the module, returns the new handle of a resource that was rebuilt.
+type ResourceResolver func(ctx context.Context, name resource.Name) (resource.Resource, error)
+
+// DependenciesResolver returns a ResourceResolver that looks the resource up in deps. As deps hold the handles
+// from when they were passed in, it does not see a resource that was rebuilt since.
+func DependenciesResolver(deps resource.Dependencies) ResourceResolver {
+	return func(ctx context.Context, name resource.Name) (resource.Resource, error) {
+		return deps.Lookup(name)
+	}
+}
+
 // TimedLidarReadingResponse represents a lidar reading with a time & allows the caller
 // to know if the reading is from a replay camera.
 type TimedLidarReadingResponse struct {
@@ -35,6 +70,7 @@ type Lidar struct {
 	name            string
 	dataFrequencyHz int
 	Lidar           camera.Camera
+	health          *readHealth
 }
 
 // Name returns the name of the lidar.
@@ -47,9 +83,22 @@ func (lidar Lidar) DataFrequencyHz() int {
 	return lidar.dataFrequencyHz
 }
 
+// ResourceHealth returns the health of the camera of the lidar.
+func (lidar Lidar) ResourceHealth() (ResourceHealth, bool) {
+	return lidar.health.resourceHealth()
+}
+
 // TimedLidarReading returns data from the lidar and the time the reading is from & whether
 // it was a replay sensor or not.
 func (lidar Lidar) TimedLidarReading(ctx context.Context) (TimedLidarReadingResponse, error) {
+	reading, err := lidar.timedLidarReading(ctx)
+	if lidar.health != nil {
+		lidar.health.record(time.Now(), err)
+	}
+	return reading, err
+}
+
+func (lidar Lidar) timedLidarReading(ctx context.Context) (TimedLidarReadingResponse, error) {
 	testIsReplaySensor := false
 
 	ctxWithMetadata, md := contextutils.ContextWithMetadata(ctx)
@@ -73,7 +122,41 @@ func (lidar Lidar) TimedLidarReading(ctx context.Context) (TimedLidarReadingResp
 	return TimedLidarReadingResponse{Reading: buf.Bytes(), ReadingTime: readingTime, TestIsReplaySensor: testIsReplaySensor}, nil
 }
 
-// NewLidar returns a new Lidar.
+// Refresh returns the lidar with its camera resolved again by resolve.
+func (lidar Lidar) Refresh(ctx context.Context, resolve ResourceResolver) (TimedLidar, error) {
+	res, err := resolve(ctx, camera.Named(lidar.name))
+	if err != nil {
+		return nil, errors.Wrapf(err, "error getting lidar camera %v for slam service", lidar.name)
+	}
+	cam, ok := res.(camera.Camera)
+	if !ok {
+		return nil, errors.Errorf("error getting lidar camera %v for slam service: %T is not a camera", lidar.name, res)
+	}
+	return Lidar{name: lidar.name, dataFrequencyHz: lidar.dataFrequencyHz, Lidar: cam, health: lidar.health}, nil
+}
+
+// IsLidarUnavailableError returns whether a lidar reading failed because the camera is unavailable, e.g. because
+// the handle the lidar holds was closed when the camera was rebuilt, rather than for a transient reason. A remote
+// camera whose client connection was closed fails with the gRPC code Canceled.
+func IsLidarUnavailableError(err error) bool {
+	if err == nil {
+		return false
+	}
+	if resource.IsNotAvailableError(err) || resource.IsNotFoundError(err) {
+		return true
+	}
+	switch status.Code(err) {
+	case codes.Unavailable, codes.NotFound, codes.Canceled:
+		return true
+	default:
+		return false
+	}
+}
+
+// NewLidar returns a new Lidar. The camera is checked to be usable as a lidar by requiring that its properties
+// report PCD support and, in online mode, that it returns a pointcloud within a few attempts. A lidar that does not
+// return one but may still be starting up is constructed with a warning. The pointcloud is not requested in offline
+// mode, as that would skip the first reading of the dataset.
 func NewLidar(
 	ctx context.Context,
 	deps resource.Dependencies,
@@ -88,20 +171,111 @@ func NewLidar(
 		return Lidar{}, errors.Wrapf(err, "error getting lidar camera %v for slam service", cameraName)
 	}
 
-	// If there is a camera provided in the 'camera' field, we enforce that it supports PCD.
 	properties, err := lidar.Properties(ctx)
 	if err != nil {
-		return Lidar{}, errors.Wrapf(err, "error getting lidar camera properties %v for slam service", cameraName)
+		return Lidar{}, newUnusableLidarError(cameraName, nil, errors.Wrap(err, "Properties failed"))
 	}
 
 	if !properties.SupportsPCD {
-		return Lidar{}, errors.New("configuring lidar camera error: " +
-			"'camera' must support PCD")
+		return Lidar{}, newUnusableLidarError(cameraName, []string{"Properties"},
+			errors.New("its properties report that it does not support PCD"))
+	}
+
+	passedChecks := []string{"Properties", "SupportsPCD"}
+	if dataFrequencyHz != 0 {
+		err := probeNextPointCloud(ctx, lidar)
+		switch {
+		case err == nil:
+			passedChecks = append(passedChecks, "NextPointCloud")
+		case cannotReturnPointClouds(err):
+			return Lidar{}, newUnusableLidarError(cameraName, passedChecks, errors.Wrap(err, "NextPointCloud failed"))
+		default:
+			// the lidar may still be starting up, its read errors are reported by the sensor process from here on
+			logger.Warnw("lidar camera did not return a pointcloud, proceeding as it may still be starting up",
+				"camera", cameraName, "attempts", nextPointCloudProbeAttempts, "error", err)
+		}
 	}
 
 	return Lidar{
 		name:            cameraName,
 		dataFrequencyHz: dataFrequencyHz,
 		Lidar:           lidar,
+		health:          newReadHealth(camera.Named(cameraName), passedChecks),
 	}, nil
 }
+
+// probeNextPointCloud requests a pointcloud from the lidar up to nextPointCloudProbeAttempts times and returns the
+// error of the last attempt if none succeeded. It stops early if the lidar cannot return pointclouds at all.
+func probeNextPointCloud(ctx context.Context, lidar camera.Camera) error {
+	var err error
+	for attempt := 0; attempt < nextPointCloudProbeAttempts; attempt++ {
+		if attempt > 0 && !goutils.SelectContextOrWait(ctx, nextPointCloudProbeInterval) {
+			return err
+		}
+		if _, err = lidar.NextPointCloud(ctx); err == nil || cannotReturnPointClouds(err) {
+			return err
+		}
+	}
+	return err
+}
+
+// cannotReturnPointClouds returns whether NextPointCloud failed because the camera cannot return pointclouds at
+// all, e.g. a color camera without intrinsics, rather than for a reason that may pass. The error of a remote camera
+// only holds the message of the original error.
+func cannotReturnPointClouds(err error) bool {
+	return errors.Is(err, transform.ErrNoIntrinsics) ||
+		strings.Contains(err.Error(), transform.ErrNoIntrinsics.Error()) ||
+		status.Code(err) == codes.Unimplemented
+}
+
+// newUnusableLidarError returns the error for a camera that failed a check in NewLidar, listing the checks it
+// passed before.
+func newUnusableLidarError(cameraName string, passedChecks []string, reason error) error {
+	passed := "none"
+	if len(passedChecks) > 0 {
+		passed = strings.Join(passedChecks, ", ")
+	}
+	return errors.Errorf("camera %v cannot be used as a SLAM lidar: %v (passed checks: %v)", cameraName, reason, passed)
+}
+
+// NumPoints returns the number of points of the lidar reading as stated in its PCD header, without decoding
+// the points.
+func NumPoints(reading []byte) (int, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(reading))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		switch fields[0] {
+		case "POINTS":
+			if len(fields) != 2 {
+				return 0, errors.Errorf("invalid PCD header line %q", scanner.Text())
+			}
+			return strconv.Atoi(fields[1])
+		case "DATA":
+			return 0, errors.New("PCD header does not state the number of points")
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+	return 0, errors.New("lidar reading is not a PCD")
+}
+
+// NumUsablePoints returns the number of points of the lidar reading that are at least minRange meters away
+// from the lidar. Cartographer discards all points that are closer than that.
+func NumUsablePoints(reading []byte, minRange float64) (int, error) {
+	pc, err := ReadLidarReading(reading)
+	if err != nil {
+		return 0, err
+	}
+	numUsable := 0
+	pc.Iterate(0, 0, func(p r3.Vector, d pointcloud.Data) bool {
+		if p.Norm() >= minRange*metersToMillimeters {
+			numUsable++
+		}
+		return true
+	})
+	return numUsable, nil
+}
@@ -5,11 +5,19 @@ import (
 	"testing"
 	"time"
 
+	"github.com/golang/geo/r3"
 	"github.com/pkg/errors"
+	"go.viam.com/rdk/components/camera"
 	"go.viam.com/rdk/logging"
+	"go.viam.com/rdk/pointcloud"
+	"go.viam.com/rdk/resource"
+	"go.viam.com/rdk/testutils/inject"
 	"go.viam.com/test"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 
 	s "github.com/viam-modules/viam-cartographer/sensors"
+	"github.com/viam-modules/viam-cartographer/testhelper/pcdtest"
 )
 
 func TestNewLidar(t *testing.T) {
@@ -33,6 +41,50 @@ func TestNewLidar(t *testing.T) {
 		test.That(t, actualLidar, test.ShouldResemble, s.Lidar{})
 	})
 
+	t.Run("Failed lidar creation with a camera that does not support PCD", func(t *testing.T) {
+		lidar, imu := s.LidarWithInvalidProperties, s.NoMovementSensor
+		actualLidar, err := s.NewLidar(context.Background(), s.SetupDeps(lidar, imu), string(lidar), testDataFrequencyHz, logger)
+		test.That(t, err, test.ShouldBeError,
+			errors.New("camera lidar_with_invalid_properties cannot be used as a SLAM lidar: "+
+				"its properties report that it does not support PCD (passed checks: Properties)"))
+		test.That(t, actualLidar, test.ShouldResemble, s.Lidar{})
+	})
+
+	t.Run("Failed lidar creation with a camera that does not return pointclouds", func(t *testing.T) {
+		lidar, imu := s.ColorCamera, s.NoMovementSensor
+		actualLidar, err := s.NewLidar(context.Background(), s.SetupDeps(lidar, imu), string(lidar), testDataFrequencyHz, logger)
+		test.That(t, err, test.ShouldBeError,
+			errors.New("camera color_camera cannot be used as a SLAM lidar: NextPointCloud failed: "+
+				"cannot do a projection to a point cloud: camera intrinsic parameters are not available "+
+				"(passed checks: Properties, SupportsPCD)"))
+		test.That(t, actualLidar, test.ShouldResemble, s.Lidar{})
+	})
+
+	t.Run("Lidar creation retries the pointcloud of a lidar that is warming up", func(t *testing.T) {
+		lidar, imu := s.WarmingUpLidar, s.NoMovementSensor
+		actualLidar, err := s.NewLidar(context.Background(), s.SetupDeps(lidar, imu), string(lidar), testDataFrequencyHz, logger)
+		test.That(t, err, test.ShouldBeNil)
+		health, ok := s.ResourceHealthOf(actualLidar)
+		test.That(t, ok, test.ShouldBeTrue)
+		test.That(t, health.StartupChecks, test.ShouldResemble, []string{"Properties", "SupportsPCD", "NextPointCloud"})
+	})
+
+	t.Run("Lidar creation proceeds without the pointcloud check when the reads keep failing", func(t *testing.T) {
+		lidar, imu := s.LidarWithErroringFunctions, s.NoMovementSensor
+		actualLidar, err := s.NewLidar(context.Background(), s.SetupDeps(lidar, imu), string(lidar), testDataFrequencyHz, logger)
+		test.That(t, err, test.ShouldBeNil)
+		health, ok := s.ResourceHealthOf(actualLidar)
+		test.That(t, ok, test.ShouldBeTrue)
+		test.That(t, health.StartupChecks, test.ShouldResemble, []string{"Properties", "SupportsPCD"})
+	})
+
+	t.Run("Offline lidar creation does not request a pointcloud", func(t *testing.T) {
+		lidar, imu := s.ColorCamera, s.NoMovementSensor
+		actualLidar, err := s.NewLidar(context.Background(), s.SetupDeps(lidar, imu), string(lidar), 0, logger)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, actualLidar.Name(), test.ShouldEqual, string(lidar))
+	})
+
 	t.Run("Successful lidar creation", func(t *testing.T) {
 		lidar, imu := s.GoodLidar, s.NoMovementSensor
 		actualLidar, err := s.NewLidar(context.Background(), s.SetupDeps(lidar, imu), string(lidar), testDataFrequencyHz, logger)
@@ -89,9 +141,11 @@ func TestTimedLidarSensorReading(t *testing.T) {
 		test.That(t, tsr.Reading, test.ShouldNotBeNil)
 		expectedResult := "VERSION .7\nFIELDS x y z\n" +
 			"SIZE 4 4 4\nTYPE F F F\n" +
-			"COUNT 1 1 1\nWIDTH 0\nHEIGHT 1\n" +
-			"VIEWPOINT 0 0 0 1 0 0 0\nPOINTS 0\n" +
-			"DATA binary\n"
+			"COUNT 1 1 1\nWIDTH 1\nHEIGHT 1\n" +
+			"VIEWPOINT 0 0 0 1 0 0 0\nPOINTS 1\n" +
+			"DATA binary\n" +
+			// the test lidar point, (1, 0, 0) in meters, as little endian float32s
+			"\x00\x00\x80?\x00\x00\x00\x00\x00\x00\x00\x00"
 		test.That(t, tsr.Reading, test.ShouldResemble, []byte(expectedResult))
 		test.That(t, tsr.ReadingTime.After(beforeReading), test.ShouldBeTrue)
 		test.That(t, tsr.ReadingTime.Location(), test.ShouldEqual, time.UTC)
@@ -110,3 +164,137 @@ func TestTimedLidarSensorReading(t *testing.T) {
 		test.That(t, tsr.TestIsReplaySensor, test.ShouldBeTrue)
 	})
 }
+
+func TestRefreshLidar(t *testing.T) {
+	logger := logging.NewTestLogger(t)
+	ctx := context.Background()
+	lidar, imu := s.GoodLidar, s.NoMovementSensor
+	deps := s.SetupDeps(lidar, imu)
+	goodLidar, err := s.NewLidar(ctx, deps, string(lidar), testDataFrequencyHz, logger)
+	test.That(t, err, test.ShouldBeNil)
+	refreshable, ok := goodLidar.(s.RefreshableLidar)
+	test.That(t, ok, test.ShouldBeTrue)
+
+	t.Run("resolves the camera again from the dependencies", func(t *testing.T) {
+		refreshed, err := refreshable.Refresh(ctx, s.DependenciesResolver(s.SetupDeps(lidar, imu)))
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, refreshed.Name(), test.ShouldEqual, string(lidar))
+		test.That(t, refreshed.DataFrequencyHz(), test.ShouldEqual, testDataFrequencyHz)
+
+		tsr, err := refreshed.TimedLidarReading(ctx)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, len(tsr.Reading), test.ShouldBeGreaterThan, 0)
+	})
+
+	t.Run("resolves the rebuilt camera from the live dependency graph", func(t *testing.T) {
+		closed := s.SetupDeps(lidar, imu)[camera.Named(string(lidar))].(*inject.Camera)
+		closed.NextPointCloudFunc = func(ctx context.Context) (pointcloud.PointCloud, error) {
+			return nil, status.Error(codes.Canceled, "grpc: the client connection is closing")
+		}
+		closedDeps := resource.Dependencies{camera.Named(string(lidar)): closed}
+		closedLidar, err := refreshable.Refresh(ctx, s.DependenciesResolver(closedDeps))
+		test.That(t, err, test.ShouldBeNil)
+		_, err = closedLidar.TimedLidarReading(ctx)
+		test.That(t, s.IsLidarUnavailableError(err), test.ShouldBeTrue)
+
+		rebuilt := s.SetupDeps(lidar, imu)[camera.Named(string(lidar))]
+		var resolved []resource.Name
+		refreshed, err := closedLidar.(s.RefreshableLidar).Refresh(ctx,
+			func(ctx context.Context, name resource.Name) (resource.Resource, error) {
+				resolved = append(resolved, name)
+				return rebuilt, nil
+			})
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, resolved, test.ShouldResemble, []resource.Name{camera.Named(string(lidar))})
+
+		tsr, err := refreshed.TimedLidarReading(ctx)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, len(tsr.Reading), test.ShouldBeGreaterThan, 0)
+	})
+
+	t.Run("fails when the camera is missing from the dependencies", func(t *testing.T) {
+		refreshed, err := refreshable.Refresh(ctx, s.DependenciesResolver(s.SetupDeps(s.NoLidar, imu)))
+		test.That(t, err, test.ShouldNotBeNil)
+		test.That(t, err.Error(), test.ShouldContainSubstring, "error getting lidar camera good_lidar for slam service")
+		test.That(t, refreshed, test.ShouldBeNil)
+	})
+
+	t.Run("fails when the resolved resource is not a camera", func(t *testing.T) {
+		movementSensor := s.SetupDeps(s.NoLidar, s.GoodMovementSensorBothIMUAndOdometer)
+		refreshed, err := refreshable.Refresh(ctx, func(ctx context.Context, name resource.Name) (resource.Resource, error) {
+			for _, res := range movementSensor {
+				return res, nil
+			}
+			return nil, resource.NewNotFoundError(name)
+		})
+		test.That(t, err, test.ShouldNotBeNil)
+		test.That(t, err.Error(), test.ShouldContainSubstring, "is not a camera")
+		test.That(t, refreshed, test.ShouldBeNil)
+	})
+}
+
+func TestIsLidarUnavailableError(t *testing.T) {
+	name := camera.Named("lidar")
+	test.That(t, s.IsLidarUnavailableError(nil), test.ShouldBeFalse)
+	test.That(t, s.IsLidarUnavailableError(errors.New("NextPointCloud error: timed out")), test.ShouldBeFalse)
+	test.That(t, s.IsLidarUnavailableError(errors.New("NextPointCloud error: resource is closed")), test.ShouldBeFalse)
+	test.That(t, s.IsLidarUnavailableError(errors.Wrap(resource.NewNotFoundError(name), "NextPointCloud error")),
+		test.ShouldBeTrue)
+	test.That(t, s.IsLidarUnavailableError(resource.NewNotAvailableError(name, errors.New("crashed"))), test.ShouldBeTrue)
+	test.That(t, s.IsLidarUnavailableError(
+		errors.Wrap(status.Error(codes.Canceled, "grpc: the client connection is closing"), "NextPointCloud error")),
+		test.ShouldBeTrue)
+	test.That(t, s.IsLidarUnavailableError(status.Error(codes.Unavailable, "connection refused")), test.ShouldBeTrue)
+	test.That(t, s.IsLidarUnavailableError(status.Error(codes.DeadlineExceeded, "timed out")), test.ShouldBeFalse)
+}
+
+func TestNumPoints(t *testing.T) {
+	t.Run("empty scan has no points", func(t *testing.T) {
+		numPoints, err := s.NumPoints(pcdtest.PointsToPCD(t, nil))
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, numPoints, test.ShouldEqual, 0)
+	})
+
+	t.Run("returns the number of points of the scan", func(t *testing.T) {
+		numPoints, err := s.NumPoints(pcdtest.PointsToPCD(t, []r3.Vector{{X: 100}, {X: 3000, Y: -4000}}))
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, numPoints, test.ShouldEqual, 2)
+	})
+
+	t.Run("returns an error for an invalid reading", func(t *testing.T) {
+		_, err := s.NumPoints([]byte("not a pcd"))
+		test.That(t, err, test.ShouldNotBeNil)
+
+		_, err = s.NumPoints([]byte("VERSION .7\nFIELDS x y z\nDATA binary\n"))
+		test.That(t, err, test.ShouldNotBeNil)
+	})
+}
+
+func TestNumUsablePoints(t *testing.T) {
+	t.Run("empty scan has no usable points", func(t *testing.T) {
+		numUsable, err := s.NumUsablePoints(pcdtest.PointsToPCD(t, nil), 0.2)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, numUsable, test.ShouldEqual, 0)
+	})
+
+	t.Run("points closer than the min range are not usable", func(t *testing.T) {
+		scan := pcdtest.PointsToPCD(t, []r3.Vector{
+			{X: 100},
+			{X: 100, Y: 100},
+			{X: 200},
+			{X: 3000, Y: -4000},
+		})
+		numUsable, err := s.NumUsablePoints(scan, 0.2)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, numUsable, test.ShouldEqual, 2)
+
+		numUsable, err = s.NumUsablePoints(scan, 0)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, numUsable, test.ShouldEqual, 4)
+	})
+
+	t.Run("returns an error for an invalid reading", func(t *testing.T) {
+		_, err := s.NumUsablePoints([]byte("not a pcd"), 0.2)
+		test.That(t, err, test.ShouldNotBeNil)
+	})
+}
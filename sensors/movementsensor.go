@@ -3,6 +3,8 @@ package sensors
 
 import (
 	"context"
+	"math"
+	"sync/atomic"
 	"time"
 
 	"github.com/golang/geo/r3"
@@ -21,6 +23,13 @@ const (
 	movementSensorReadingTimeToleranceMsec = 50 // Milliseconds
 	replayTimestampErrorMessage            = "replay sensor timestamp parse RFC3339Nano error"
 	timedMovementSensorReadingTimeout      = 5 * time.Second
+	// orientationNormTolerance is how far the norm of an orientation quaternion may deviate from 1
+	// before it gets renormalized.
+	orientationNormTolerance = 1e-9
+	// minOrientationNorm is the smallest quaternion norm that can still be normalized.
+	minOrientationNorm = 1e-6
+	// invalidReadingWarningInterval is the minimum time between two warnings about invalid readings.
+	invalidReadingWarningInterval = 10 * time.Second
 )
 
 var (
@@ -28,11 +37,66 @@ var (
 	// ErrMovementSensorNeitherIMUNorOdometer denotes that the provided movement sensor does neither support
 	// an IMU nor a movement sensor.
 	ErrMovementSensorNeitherIMUNorOdometer = errors.New("'movement_sensor' must either support both LinearAcceleration and " +
-		"AngularVelocity, or both Position and Orientation")
+		"AngularVelocity, or both Position and Orientation, or both LinearVelocity and AngularVelocity with velocity_odometry")
 	// ErrNoValidReadingObtained denotes that the attempt to obtain a valid IMU or odometer reading failed.
 	ErrNoValidReadingObtained = errors.New("could not obtain a reading that satisfies the time tolerance requirement")
+	// ErrInvalidOrientation denotes that an orientation could not be normalized into a unit quaternion.
+	ErrInvalidOrientation = errors.New("orientation cannot be normalized into a valid quaternion")
+	// ErrMovementSensorNoHeading denotes that a heading only movement sensor supports neither Orientation
+	// nor CompassHeading.
+	ErrMovementSensorNoHeading = errors.New("'movement_sensor' must support Orientation or CompassHeading " +
+		"to be used with heading_only")
+	// ErrMovementSensorHeadingOnlyWithPosition denotes that a heading only movement sensor supports Position, in
+	// which case it can be used as an odometer.
+	ErrMovementSensorHeadingOnlyWithPosition = errors.New("heading_only is only supported for a 'movement_sensor' " +
+		"that does not support Position")
+	// ErrMovementSensorNoVelocity denotes that a velocity odometry movement sensor does not support both
+	// LinearVelocity and AngularVelocity.
+	ErrMovementSensorNoVelocity = errors.New("'movement_sensor' must support both LinearVelocity and AngularVelocity " +
+		"to be used with velocity_odometry")
+	// ErrMovementSensorVelocityOdometryWithPosition denotes that a velocity odometry movement sensor supports both
+	// Position and Orientation, in which case it can be used as an odometer.
+	ErrMovementSensorVelocityOdometryWithPosition = errors.New("velocity_odometry is only supported for a " +
+		"'movement_sensor' that does not support both Position and Orientation")
 )
 
+// odometrySource is where the odometer readings of a movement sensor come from.
+type odometrySource int
+
+const (
+	// odometryFromPosition takes the odometer readings from Position and Orientation.
+	odometryFromPosition odometrySource = iota
+	// odometryFromHeading takes the heading of the odometer readings from Orientation or CompassHeading, see
+	// NewHeadingOnlyMovementSensor.
+	odometryFromHeading
+	// odometryFromVelocity integrates the odometer readings from LinearVelocity and AngularVelocity, see
+	// NewVelocityOdometryMovementSensor.
+	odometryFromVelocity
+)
+
+// AngularVelocityUnits are the units a movement sensor reports its angular velocity in.
+type AngularVelocityUnits string
+
+const (
+	// DegreesPerSecond is the unit of the angular velocity of movement sensors that follow the movement sensor API.
+	DegreesPerSecond AngularVelocityUnits = "deg_per_sec"
+	// RadiansPerSecond is the unit of the angular velocity of movement sensors that report it in radians per second
+	// in spite of the movement sensor API, e.g. those that pass through the readings of their driver.
+	RadiansPerSecond AngularVelocityUnits = "rad_per_sec"
+)
+
+// toRadiansPerSecond converts an angular velocity in the given units into radians per second.
+func toRadiansPerSecond(angVel spatialmath.AngularVelocity, units AngularVelocityUnits) spatialmath.AngularVelocity {
+	if units == RadiansPerSecond {
+		return angVel
+	}
+	return spatialmath.AngularVelocity{
+		X: rdkutils.DegToRad(angVel.X),
+		Y: rdkutils.DegToRad(angVel.Y),
+		Z: rdkutils.DegToRad(angVel.Z),
+	}
+}
+
 // TimedMovementSensor describes a sensor that reports the time the reading is from & whether or not it is
 // from a replay sensor.
 type TimedMovementSensor interface {
@@ -46,6 +110,13 @@ type TimedMovementSensor interface {
 type MovementSensorProperties struct {
 	IMUSupported      bool
 	OdometerSupported bool
+	// HeadingOnly denotes that the odometer readings only hold a heading and no position, which has to be
+	// synthesized before they are added to cartographer.
+	HeadingOnly bool
+	// VelocitySupported denotes that the movement sensor, e.g. a wheel encoder, reports its odometry as velocity
+	// readings instead of odometer readings, which have to be integrated into poses before they are added to
+	// cartographer.
+	VelocitySupported bool
 }
 
 // TimedMovementSensorReadingResponse contains IMU and odometer sensor reading responses
@@ -53,31 +124,56 @@ type MovementSensorProperties struct {
 type TimedMovementSensorReadingResponse struct {
 	TimedIMUResponse      *TimedIMUReadingResponse
 	TimedOdometerResponse *TimedOdometerReadingResponse
+	TimedVelocityResponse *TimedVelocityReadingResponse
 	TestIsReplaySensor    bool
 }
 
 // TimedIMUReadingResponse represents an IMU sensor reading with a time.
 type TimedIMUReadingResponse struct {
-	AngularVelocity    spatialmath.AngularVelocity // We set the values in radians/s instead of deg/s
+	// AngularVelocity is always in radians per second, whatever the units of the movement sensor. The conversion
+	// happens exactly once, when the reading is obtained from the movement sensor.
+	AngularVelocity    spatialmath.AngularVelocity
 	LinearAcceleration r3.Vector
 	ReadingTime        time.Time
 }
 
-// TimedOdometerReadingResponse represents an odometer sensor reading with a time.
+// TimedOdometerReadingResponse represents an odometer sensor reading with a time. The position is nil for the
+// readings of a heading only movement sensor.
 type TimedOdometerReadingResponse struct {
 	Position    *geo.Point
 	Orientation spatialmath.Orientation
 	ReadingTime time.Time
 }
 
+// TimedVelocityReadingResponse represents a velocity reading with a time. The linear velocity is in meters per
+// second and, like the angular velocity, in the frame of the movement sensor.
+type TimedVelocityReadingResponse struct {
+	LinearVelocity r3.Vector
+	// AngularVelocity is always in radians per second, like that of TimedIMUReadingResponse.
+	AngularVelocity spatialmath.AngularVelocity
+	ReadingTime     time.Time
+}
+
 // MovementSensor represents a movement sensor.
 type MovementSensor struct {
 	name               string
 	dataFrequencyHz    int
+	angVelUnits        AngularVelocityUnits
 	imuSupported       bool
 	odometerSupported  bool
+	headingOnly        bool
+	velocitySupported  bool
+	useCompassHeading  bool
 	sensor             movementsensor.MovementSensor
 	testIsReplaySensor bool
+	logger             logging.Logger
+
+	invalidOrientationCount atomic.Int64
+	// lastInvalidOrientationWarned is the time, in unix nanoseconds, of the last warning about an invalid
+	// orientation, as readings are read concurrently.
+	lastInvalidOrientationWarned atomic.Int64
+
+	health *readHealth
 }
 
 // Name returns the name of the movement sensor.
@@ -90,24 +186,59 @@ func (ms *MovementSensor) DataFrequencyHz() int {
 	return ms.dataFrequencyHz
 }
 
+// ResourceHealth returns the health of the movement sensor resource.
+func (ms *MovementSensor) ResourceHealth() (ResourceHealth, bool) {
+	return ms.health.resourceHealth()
+}
+
 // TimedMovementSensorReading returns data from the movement sensor and the time the reading is from & whether
 // it was a replay sensor or not.
 func (ms *MovementSensor) TimedMovementSensorReading(ctx context.Context) (TimedMovementSensorReadingResponse, error) {
+	reading, err := ms.timedMovementSensorReading(ctx)
+	if ms.health != nil {
+		ms.health.record(time.Now(), err)
+	}
+	return reading, err
+}
+
+func (ms *MovementSensor) timedMovementSensorReading(ctx context.Context) (TimedMovementSensorReadingResponse, error) {
 	var (
-		readingTimeAngularVel, readingTimeLinearAcc time.Time
-		readingTimePosition, readingTimeOrientation time.Time
-		angVel                                      spatialmath.AngularVelocity
-		linAcc                                      r3.Vector
-		position                                    *geo.Point
-		orientation                                 spatialmath.Orientation
-		timedIMUReadingResponse                     *TimedIMUReadingResponse
-		timedOdometerReadingResponse                *TimedOdometerReadingResponse
-		err                                         error
+		readingTimeAngularVel, readingTimeLinearAcc         time.Time
+		readingTimePosition, readingTimeOrientation         time.Time
+		readingTimeLinearVel, readingTimeVelocityAngularVel time.Time
+		angVel, velocityAngVel                              spatialmath.AngularVelocity
+		linAcc, linVel                                      r3.Vector
+		position                                            *geo.Point
+		orientation                                         spatialmath.Orientation
+		timedIMUReadingResponse                             *TimedIMUReadingResponse
+		timedOdometerReadingResponse                        *TimedOdometerReadingResponse
+		timedVelocityReadingResponse                        *TimedVelocityReadingResponse
+		err                                                 error
 	)
 
 	timeoutCtx, cancel := context.WithTimeout(ctx, timedMovementSensorReadingTimeout)
 	defer cancel()
-	if ms.odometerSupported {
+	if ms.headingOnly {
+		if timedOdometerReadingResponse, err = ms.timedHeadingReading(timeoutCtx); err != nil {
+			return TimedMovementSensorReadingResponse{}, err
+		}
+	} else if ms.velocitySupported {
+	velocityLoop:
+		for {
+			select {
+			case <-timeoutCtx.Done():
+				return TimedMovementSensorReadingResponse{}, errors.Wrap(timeoutCtx.Err(), "timed out getting velocity data")
+			default:
+				if timedVelocityReadingResponse, err = ms.timedVelocityReading(timeoutCtx, &linVel, &velocityAngVel,
+					&readingTimeLinearVel, &readingTimeVelocityAngularVel); err != nil && !errors.Is(err, ErrNoValidReadingObtained) {
+					return TimedMovementSensorReadingResponse{}, err
+				}
+				if timedVelocityReadingResponse != nil {
+					break velocityLoop
+				}
+			}
+		}
+	} else if ms.odometerSupported {
 	odometerLoop:
 		for {
 			select {
@@ -119,6 +250,11 @@ func (ms *MovementSensor) TimedMovementSensorReading(ctx context.Context) (Timed
 					return TimedMovementSensorReadingResponse{}, err
 				}
 				if timedOdometerReadingResponse != nil {
+					// the reading is dropped rather than polling the movement sensor again until the timeout, as its
+					// orientation is likely to stay invalid, and a fresh one is requested with the next reading
+					if err = ms.normalizeOdometerReading(timedOdometerReadingResponse); err != nil {
+						return TimedMovementSensorReadingResponse{}, err
+					}
 					break odometerLoop
 				}
 			}
@@ -144,6 +280,7 @@ func (ms *MovementSensor) TimedMovementSensorReading(ctx context.Context) (Timed
 	return TimedMovementSensorReadingResponse{
 		TimedIMUResponse:      timedIMUReadingResponse,
 		TimedOdometerResponse: timedOdometerReadingResponse,
+		TimedVelocityResponse: timedVelocityReadingResponse,
 		TestIsReplaySensor:    ms.testIsReplaySensor,
 	}, nil
 }
@@ -159,12 +296,8 @@ func (ms *MovementSensor) timedIMUReading(ctx context.Context, angVel *spatialma
 		if readingTimeAngularVel.Sub(readingTimeLinearAcc).Abs().Milliseconds() < movementSensorReadingTimeToleranceMsec {
 			return TimedIMUReadingResponse{
 				LinearAcceleration: *linAcc,
-				AngularVelocity: spatialmath.AngularVelocity{
-					X: rdkutils.DegToRad(angVel.X),
-					Y: rdkutils.DegToRad(angVel.Y),
-					Z: rdkutils.DegToRad(angVel.Z),
-				},
-				ReadingTime: averageReadingTimes(readingTimeLinearAcc, readingTimeAngularVel),
+				AngularVelocity:    toRadiansPerSecond(*angVel, ms.angVelUnits),
+				ReadingTime:        averageReadingTimes(readingTimeLinearAcc, readingTimeAngularVel),
 			}, true
 		}
 		return TimedIMUReadingResponse{}, false
@@ -274,21 +407,231 @@ func (ms *MovementSensor) timedOdometerReading(ctx context.Context, position *ge
 	return nil, ErrNoValidReadingObtained
 }
 
+// timedVelocityReading returns a velocity reading once the linear and angular velocity of the movement sensor were
+// taken within the time tolerance of each other, like timedIMUReading.
+func (ms *MovementSensor) timedVelocityReading(ctx context.Context, linVel *r3.Vector, angVel *spatialmath.AngularVelocity,
+	readingTimeLinearVel, readingTimeAngularVel *time.Time,
+) (*TimedVelocityReadingResponse, error) {
+	var err error
+
+	returnReadingIfTimestampsWithinTolerance := func() (*TimedVelocityReadingResponse, bool) {
+		if readingTimeAngularVel.Sub(*readingTimeLinearVel).Abs().Milliseconds() < movementSensorReadingTimeToleranceMsec {
+			return &TimedVelocityReadingResponse{
+				LinearVelocity:  *linVel,
+				AngularVelocity: toRadiansPerSecond(*angVel, ms.angVelUnits),
+				ReadingTime:     averageReadingTimes(*readingTimeLinearVel, *readingTimeAngularVel),
+			}, true
+		}
+		return nil, false
+	}
+
+	if *readingTimeLinearVel == undefinedTime || readingTimeLinearVel.Sub(*readingTimeAngularVel).Milliseconds() < 0 {
+		ctxWithMetadata, md := contextutils.ContextWithMetadata(ctx)
+		if *linVel, err = ms.sensor.LinearVelocity(ctxWithMetadata, make(map[string]interface{})); err != nil {
+			return nil, errors.Wrap(err, "could not obtain LinearVelocity")
+		}
+		if *readingTimeLinearVel, err = ms.readingTime(md); err != nil {
+			return nil, err
+		}
+	}
+
+	if response, ok := returnReadingIfTimestampsWithinTolerance(); ok {
+		return response, nil
+	}
+
+	if *readingTimeAngularVel == undefinedTime || readingTimeAngularVel.Sub(*readingTimeLinearVel).Milliseconds() < 0 {
+		ctxWithMetadata, md := contextutils.ContextWithMetadata(ctx)
+		if *angVel, err = ms.sensor.AngularVelocity(ctxWithMetadata, make(map[string]interface{})); err != nil {
+			return nil, errors.Wrap(err, "could not obtain AngularVelocity")
+		}
+		if *readingTimeAngularVel, err = ms.readingTime(md); err != nil {
+			return nil, err
+		}
+	}
+
+	if response, ok := returnReadingIfTimestampsWithinTolerance(); ok {
+		return response, nil
+	}
+
+	return nil, ErrNoValidReadingObtained
+}
+
+// readingTime returns the time a reading was requested at for a replay movement sensor, which it sets in the
+// metadata md of the request, and the current time otherwise.
+func (ms *MovementSensor) readingTime(md map[string][]string) (time.Time, error) {
+	timeRequestedMetadata, ok := md[contextutils.TimeRequestedMetadataKey]
+	if !ok {
+		return time.Now().UTC(), nil
+	}
+	ms.testIsReplaySensor = true
+	readingTime, err := time.Parse(time.RFC3339Nano, timeRequestedMetadata[0])
+	if err != nil {
+		return time.Time{}, errors.Wrap(err, replayTimestampErrorMessage)
+	}
+	return readingTime, nil
+}
+
+// timedHeadingReading returns an odometer reading without a position whose orientation is the heading of the
+// movement sensor, taken from its orientation or, if it does not support Orientation, its compass heading.
+func (ms *MovementSensor) timedHeadingReading(ctx context.Context) (*TimedOdometerReadingResponse, error) {
+	var (
+		yaw         float64
+		readingTime time.Time
+	)
+	ctxWithMetadata, md := contextutils.ContextWithMetadata(ctx)
+	if ms.useCompassHeading {
+		heading, err := ms.sensor.CompassHeading(ctxWithMetadata, make(map[string]interface{}))
+		if err != nil {
+			return nil, errors.Wrap(err, "could not obtain CompassHeading")
+		}
+		// the heading of the x axis is left handed from north while the yaw is right handed from east
+		yaw = rdkutils.DegToRad(90 - heading)
+	} else {
+		orientation, err := ms.sensor.Orientation(ctxWithMetadata, make(map[string]interface{}))
+		if err != nil {
+			return nil, errors.Wrap(err, "could not obtain Orientation")
+		}
+		if orientation == nil {
+			return nil, ErrInvalidOrientation
+		}
+		yaw = orientation.EulerAngles().Yaw
+	}
+
+	if timeRequestedMetadata, ok := md[contextutils.TimeRequestedMetadataKey]; ok {
+		ms.testIsReplaySensor = true
+		var err error
+		if readingTime, err = time.Parse(time.RFC3339Nano, timeRequestedMetadata[0]); err != nil {
+			return nil, errors.Wrap(err, replayTimestampErrorMessage)
+		}
+	} else {
+		readingTime = time.Now().UTC()
+	}
+
+	reading := &TimedOdometerReadingResponse{
+		Orientation: &spatialmath.EulerAngles{Yaw: yaw},
+		ReadingTime: readingTime,
+	}
+	if err := ms.normalizeOdometerReading(reading); err != nil {
+		return nil, err
+	}
+	return reading, nil
+}
+
+// normalizeOdometerReading replaces the orientation of the reading with its normalized quaternion. Readings whose
+// orientation cannot be normalized are counted and rejected with a throttled warning.
+func (ms *MovementSensor) normalizeOdometerReading(reading *TimedOdometerReadingResponse) error {
+	quat, err := NormalizeOrientation(reading.Orientation)
+	if err != nil {
+		count := ms.invalidOrientationCount.Add(1)
+		now := time.Now().UnixNano()
+		last := ms.lastInvalidOrientationWarned.Load()
+		// only the reading that swaps in the new time warns
+		if ms.logger != nil && time.Duration(now-last) >= invalidReadingWarningInterval &&
+			ms.lastInvalidOrientationWarned.CompareAndSwap(last, now) {
+			ms.logger.Warnw("dropping odometer reading with invalid orientation",
+				"movement_sensor", ms.name, "orientation", reading.Orientation, "total_dropped", count)
+		}
+		return err
+	}
+	reading.Orientation = quat
+	return nil
+}
+
+// InvalidOrientationCount returns the number of odometer readings that were dropped because their
+// orientation could not be normalized.
+func (ms *MovementSensor) InvalidOrientationCount() int64 {
+	return ms.invalidOrientationCount.Load()
+}
+
+// NormalizeOrientation converts the orientation into a unit quaternion, renormalizing it if its norm is
+// slightly off. Returns ErrInvalidOrientation if the orientation is nil, contains NaN or Inf components,
+// or has a norm too close to zero to be normalized.
+func NormalizeOrientation(orientation spatialmath.Orientation) (*spatialmath.Quaternion, error) {
+	if orientation == nil {
+		return nil, ErrInvalidOrientation
+	}
+	quat := orientation.Quaternion()
+	for _, component := range []float64{quat.Real, quat.Imag, quat.Jmag, quat.Kmag} {
+		if math.IsNaN(component) || math.IsInf(component, 0) {
+			return nil, ErrInvalidOrientation
+		}
+	}
+
+	norm := math.Sqrt(quat.Real*quat.Real + quat.Imag*quat.Imag + quat.Jmag*quat.Jmag + quat.Kmag*quat.Kmag)
+	if norm < minOrientationNorm || math.IsInf(norm, 0) {
+		return nil, ErrInvalidOrientation
+	}
+	if math.Abs(norm-1) <= orientationNormTolerance {
+		return &spatialmath.Quaternion{Real: quat.Real, Imag: quat.Imag, Jmag: quat.Jmag, Kmag: quat.Kmag}, nil
+	}
+	return &spatialmath.Quaternion{
+		Real: quat.Real / norm,
+		Imag: quat.Imag / norm,
+		Jmag: quat.Jmag / norm,
+		Kmag: quat.Kmag / norm,
+	}, nil
+}
+
 // Properties returns MovementSensorProperties, which holds information about whether or not an IMU
 // and/or odometer are supported.
 func (ms *MovementSensor) Properties() MovementSensorProperties {
 	return MovementSensorProperties{
 		IMUSupported:      ms.imuSupported,
 		OdometerSupported: ms.odometerSupported,
+		HeadingOnly:       ms.headingOnly,
+		VelocitySupported: ms.velocitySupported,
 	}
 }
 
-// NewMovementSensor returns a new movement sensor.
+// NewMovementSensor returns a new movement sensor. The angular velocity of its IMU readings is converted from
+// angVelUnits into radians per second.
 func NewMovementSensor(
 	ctx context.Context,
 	deps resource.Dependencies,
 	movementSensorName string,
 	dataFrequencyHz int,
+	angVelUnits AngularVelocityUnits,
+	logger logging.Logger,
+) (TimedMovementSensor, error) {
+	return newMovementSensor(ctx, deps, movementSensorName, dataFrequencyHz, angVelUnits, odometryFromPosition, logger)
+}
+
+// NewHeadingOnlyMovementSensor returns a new movement sensor for a movement sensor that supports Orientation or
+// CompassHeading but not Position, e.g. a compass. Its odometer readings only hold the heading, their position
+// has to be synthesized before they are added to cartographer. It is otherwise the same as NewMovementSensor.
+func NewHeadingOnlyMovementSensor(
+	ctx context.Context,
+	deps resource.Dependencies,
+	movementSensorName string,
+	dataFrequencyHz int,
+	angVelUnits AngularVelocityUnits,
+	logger logging.Logger,
+) (TimedMovementSensor, error) {
+	return newMovementSensor(ctx, deps, movementSensorName, dataFrequencyHz, angVelUnits, odometryFromHeading, logger)
+}
+
+// NewVelocityOdometryMovementSensor returns a new movement sensor for a movement sensor that supports LinearVelocity
+// and AngularVelocity but not both Position and Orientation, e.g. a wheel encoder. Its odometer readings are
+// velocity readings, which have to be integrated into poses before they are added to cartographer. It is otherwise
+// the same as NewMovementSensor.
+func NewVelocityOdometryMovementSensor(
+	ctx context.Context,
+	deps resource.Dependencies,
+	movementSensorName string,
+	dataFrequencyHz int,
+	angVelUnits AngularVelocityUnits,
+	logger logging.Logger,
+) (TimedMovementSensor, error) {
+	return newMovementSensor(ctx, deps, movementSensorName, dataFrequencyHz, angVelUnits, odometryFromVelocity, logger)
+}
+
+func newMovementSensor(
+	ctx context.Context,
+	deps resource.Dependencies,
+	movementSensorName string,
+	dataFrequencyHz int,
+	angVelUnits AngularVelocityUnits,
+	odometry odometrySource,
 	logger logging.Logger,
 ) (TimedMovementSensor, error) {
 	_, span := trace.StartSpan(ctx, "viamcartographer::sensors::NewMovementSensor")
@@ -309,17 +652,61 @@ func NewMovementSensor(
 	imuSupported := properties.LinearAccelerationSupported && properties.AngularVelocitySupported
 	odometerSupported := properties.PositionSupported && properties.OrientationSupported
 
+	headingOnly := odometry == odometryFromHeading
+	useCompassHeading := false
+	if headingOnly {
+		if properties.PositionSupported {
+			return &MovementSensor{}, ErrMovementSensorHeadingOnlyWithPosition
+		}
+		if !properties.OrientationSupported && !properties.CompassHeadingSupported {
+			return &MovementSensor{}, ErrMovementSensorNoHeading
+		}
+		odometerSupported = true
+		useCompassHeading = !properties.OrientationSupported
+	}
+
+	// the odometry of e.g. a wheel encoder is integrated from its velocities, which is only done if configured
+	velocitySupported := odometry == odometryFromVelocity
+	if velocitySupported {
+		if odometerSupported {
+			return &MovementSensor{}, ErrMovementSensorVelocityOdometryWithPosition
+		}
+		if !properties.LinearVelocitySupported || !properties.AngularVelocitySupported {
+			return &MovementSensor{}, ErrMovementSensorNoVelocity
+		}
+		odometerSupported = true
+	}
+
 	// A movement sensor must be support either an IMU, or an odometer, or both.
 	if !imuSupported && !odometerSupported {
 		return &MovementSensor{}, ErrMovementSensorNeitherIMUNorOdometer
 	}
 
+	passedChecks := []string{"Properties"}
+	if imuSupported {
+		passedChecks = append(passedChecks, "IMUSupported")
+	}
+	switch {
+	case headingOnly:
+		passedChecks = append(passedChecks, "HeadingSupported")
+	case velocitySupported:
+		passedChecks = append(passedChecks, "VelocitySupported")
+	case odometerSupported:
+		passedChecks = append(passedChecks, "OdometerSupported")
+	}
+
 	return &MovementSensor{
 		name:              movementSensorName,
 		dataFrequencyHz:   dataFrequencyHz,
+		angVelUnits:       angVelUnits,
 		imuSupported:      imuSupported,
 		odometerSupported: odometerSupported,
+		headingOnly:       headingOnly,
+		velocitySupported: velocitySupported,
+		useCompassHeading: useCompassHeading,
 		sensor:            movementSensor,
+		logger:            logger,
+		health:            newReadHealth(movementsensor.Named(movementSensorName), passedChecks),
 	}, nil
 }
 
@@ -4,6 +4,7 @@ package sensors_test
 import (
 	"context"
 	"errors"
+	"math"
 	"testing"
 	"time"
 
@@ -25,7 +26,7 @@ func TestNewMovementSensor(t *testing.T) {
 	t.Run("No movement sensor provided", func(t *testing.T) {
 		lidar, movementSensor := s.GoodLidar, s.NoMovementSensor
 		deps := s.SetupDeps(lidar, movementSensor)
-		actualMs, err := s.NewMovementSensor(context.Background(), deps, string(movementSensor), testDataFrequencyHz, logger)
+		actualMs, err := s.NewMovementSensor(context.Background(), deps, string(movementSensor), testDataFrequencyHz, s.DegreesPerSecond, logger)
 		test.That(t, err, test.ShouldBeNil)
 		test.That(t, actualMs, test.ShouldResemble, &s.MovementSensor{})
 	})
@@ -33,7 +34,7 @@ func TestNewMovementSensor(t *testing.T) {
 	t.Run("Failed movement sensor creation with non-existing movement sensor", func(t *testing.T) {
 		lidar, movementSensor := s.GoodLidar, s.GibberishMovementSensor
 		deps := s.SetupDeps(lidar, movementSensor)
-		actualMs, err := s.NewMovementSensor(context.Background(), deps, string(movementSensor), testDataFrequencyHz, logger)
+		actualMs, err := s.NewMovementSensor(context.Background(), deps, string(movementSensor), testDataFrequencyHz, s.DegreesPerSecond, logger)
 		test.That(t, err, test.ShouldBeError,
 			errors.New("error getting movement sensor \""+string(movementSensor)+"\" for slam service: "+
 				"Resource missing from dependencies. Resource: rdk:component:movement_sensor/"+string(movementSensor)))
@@ -43,7 +44,7 @@ func TestNewMovementSensor(t *testing.T) {
 	t.Run("Failed movement creation with sensor that does not support IMU nor odometer", func(t *testing.T) {
 		lidar, movementSensor := s.GoodLidar, s.MovementSensorWithInvalidProperties
 		deps := s.SetupDeps(lidar, movementSensor)
-		actualMs, err := s.NewMovementSensor(context.Background(), deps, string(movementSensor), testDataFrequencyHz, logger)
+		actualMs, err := s.NewMovementSensor(context.Background(), deps, string(movementSensor), testDataFrequencyHz, s.DegreesPerSecond, logger)
 		test.That(t, err, test.ShouldBeError, s.ErrMovementSensorNeitherIMUNorOdometer)
 		test.That(t, actualMs, test.ShouldResemble, &s.MovementSensor{})
 	})
@@ -51,7 +52,7 @@ func TestNewMovementSensor(t *testing.T) {
 	t.Run("Successful movement sensor creation that supports an IMU", func(t *testing.T) {
 		lidar, imu := s.GoodLidar, s.GoodIMU
 		deps := s.SetupDeps(lidar, imu)
-		actualMs, err := s.NewMovementSensor(context.Background(), deps, string(imu), testDataFrequencyHz, logger)
+		actualMs, err := s.NewMovementSensor(context.Background(), deps, string(imu), testDataFrequencyHz, s.DegreesPerSecond, logger)
 		test.That(t, err, test.ShouldBeNil)
 		test.That(t, actualMs.Name(), test.ShouldEqual, string(imu))
 
@@ -67,17 +68,29 @@ func TestNewMovementSensor(t *testing.T) {
 		test.That(t, actualReading.TimedOdometerResponse, test.ShouldBeNil)
 	})
 
+	t.Run("Successful movement sensor creation that supports an IMU reporting radians per second", func(t *testing.T) {
+		lidar, imu := s.GoodLidar, s.GoodIMU
+		deps := s.SetupDeps(lidar, imu)
+		actualMs, err := s.NewMovementSensor(context.Background(), deps, string(imu), testDataFrequencyHz, s.RadiansPerSecond, logger)
+		test.That(t, err, test.ShouldBeNil)
+
+		actualReading, err := actualMs.TimedMovementSensorReading(context.Background())
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, actualReading.TimedIMUResponse.LinearAcceleration, test.ShouldResemble, s.TestLinAcc)
+		test.That(t, actualReading.TimedIMUResponse.AngularVelocity, test.ShouldResemble, s.TestAngVel)
+	})
+
 	t.Run("Successful movement sensor creation that supports an odometer", func(t *testing.T) {
 		lidar, odometer := s.GoodLidar, s.GoodOdometer
 		deps := s.SetupDeps(lidar, odometer)
-		actualMs, err := s.NewMovementSensor(context.Background(), deps, string(odometer), testDataFrequencyHz, logger)
+		actualMs, err := s.NewMovementSensor(context.Background(), deps, string(odometer), testDataFrequencyHz, s.DegreesPerSecond, logger)
 		test.That(t, err, test.ShouldBeNil)
 		test.That(t, actualMs.Name(), test.ShouldEqual, string(odometer))
 
 		actualReading, err := actualMs.TimedMovementSensorReading(context.Background())
 		test.That(t, err, test.ShouldBeNil)
 		test.That(t, actualReading.TimedOdometerResponse.Position, test.ShouldResemble, s.TestPosition)
-		test.That(t, actualReading.TimedOdometerResponse.Orientation, test.ShouldResemble, s.TestOrientation)
+		test.That(t, actualReading.TimedOdometerResponse.Orientation, test.ShouldResemble, s.TestNormalizedOrientation)
 		test.That(t, actualReading.TimedIMUResponse, test.ShouldBeNil)
 	})
 }
@@ -89,7 +102,7 @@ func TestProperties(t *testing.T) {
 	t.Run("only IMU supported", func(t *testing.T) {
 		lidar, imu := s.GoodLidar, s.GoodIMU
 		deps := s.SetupDeps(lidar, imu)
-		actualIMU, err := s.NewMovementSensor(ctx, deps, string(imu), testDataFrequencyHz, logger)
+		actualIMU, err := s.NewMovementSensor(ctx, deps, string(imu), testDataFrequencyHz, s.DegreesPerSecond, logger)
 		test.That(t, err, test.ShouldBeNil)
 		properties := actualIMU.Properties()
 		test.That(t, properties.IMUSupported, test.ShouldBeTrue)
@@ -99,7 +112,7 @@ func TestProperties(t *testing.T) {
 	t.Run("only odometer supported", func(t *testing.T) {
 		lidar, odometer := s.GoodLidar, s.GoodOdometer
 		deps := s.SetupDeps(lidar, odometer)
-		actualOdometer, err := s.NewMovementSensor(ctx, deps, string(odometer), testDataFrequencyHz, logger)
+		actualOdometer, err := s.NewMovementSensor(ctx, deps, string(odometer), testDataFrequencyHz, s.DegreesPerSecond, logger)
 		test.That(t, err, test.ShouldBeNil)
 		properties := actualOdometer.Properties()
 		test.That(t, properties.IMUSupported, test.ShouldBeFalse)
@@ -109,7 +122,7 @@ func TestProperties(t *testing.T) {
 	t.Run("both IMU and odometer supported", func(t *testing.T) {
 		lidar, movementSensor := s.GoodLidar, s.GoodMovementSensorBothIMUAndOdometer
 		deps := s.SetupDeps(lidar, movementSensor)
-		actualMovementSensor, err := s.NewMovementSensor(ctx, deps, string(movementSensor), testDataFrequencyHz, logger)
+		actualMovementSensor, err := s.NewMovementSensor(ctx, deps, string(movementSensor), testDataFrequencyHz, s.DegreesPerSecond, logger)
 		test.That(t, err, test.ShouldBeNil)
 		properties := actualMovementSensor.Properties()
 		test.That(t, properties.IMUSupported, test.ShouldBeTrue)
@@ -124,7 +137,7 @@ func TestTimedMovementSensorReading(t *testing.T) {
 	t.Run("when the movement sensor's IMU functions return an error, timedIMUReading wraps that error", func(t *testing.T) {
 		lidar, imu := s.GoodLidar, s.IMUWithErroringFunctions
 		deps := s.SetupDeps(lidar, imu)
-		actualIMU, err := s.NewMovementSensor(ctx, deps, string(imu), testDataFrequencyHz, logger)
+		actualIMU, err := s.NewMovementSensor(ctx, deps, string(imu), testDataFrequencyHz, s.DegreesPerSecond, logger)
 		test.That(t, err, test.ShouldBeNil)
 
 		actualReading, err := actualIMU.TimedMovementSensorReading(ctx)
@@ -136,7 +149,7 @@ func TestTimedMovementSensorReading(t *testing.T) {
 	t.Run("when the movement sensor's odometer functions return an error, timedOdometerReading wraps that error", func(t *testing.T) {
 		lidar, odometer := s.GoodLidar, s.OdometerWithErroringFunctions
 		deps := s.SetupDeps(lidar, odometer)
-		actualOdometer, err := s.NewMovementSensor(ctx, deps, string(odometer), testDataFrequencyHz, logger)
+		actualOdometer, err := s.NewMovementSensor(ctx, deps, string(odometer), testDataFrequencyHz, s.DegreesPerSecond, logger)
 		test.That(t, err, test.ShouldBeNil)
 
 		actualReading, err := actualOdometer.TimedMovementSensorReading(ctx)
@@ -148,7 +161,7 @@ func TestTimedMovementSensorReading(t *testing.T) {
 	t.Run("when a live IMU succeeds, returns current time in UTC and the reading", func(t *testing.T) {
 		lidar, imu := s.GoodLidar, s.GoodIMU
 		deps := s.SetupDeps(lidar, imu)
-		actualIMU, err := s.NewMovementSensor(ctx, deps, string(imu), testDataFrequencyHz, logger)
+		actualIMU, err := s.NewMovementSensor(ctx, deps, string(imu), testDataFrequencyHz, s.DegreesPerSecond, logger)
 		test.That(t, err, test.ShouldBeNil)
 
 		beforeReading := time.Now().UTC()
@@ -177,7 +190,7 @@ func TestTimedMovementSensorReading(t *testing.T) {
 	t.Run("when a live odometer succeeds, returns current time in UTC and the reading", func(t *testing.T) {
 		lidar, odometer := s.GoodLidar, s.GoodOdometer
 		deps := s.SetupDeps(lidar, odometer)
-		actualOdometer, err := s.NewMovementSensor(ctx, deps, string(odometer), testDataFrequencyHz, logger)
+		actualOdometer, err := s.NewMovementSensor(ctx, deps, string(odometer), testDataFrequencyHz, s.DegreesPerSecond, logger)
 		test.That(t, err, test.ShouldBeNil)
 
 		beforeReading := time.Now().UTC()
@@ -190,7 +203,7 @@ func TestTimedMovementSensorReading(t *testing.T) {
 
 		test.That(t, err, test.ShouldBeNil)
 		test.That(t, actualReading.TimedOdometerResponse.Position, test.ShouldResemble, s.TestPosition)
-		test.That(t, actualReading.TimedOdometerResponse.Orientation, test.ShouldResemble, s.TestOrientation)
+		test.That(t, actualReading.TimedOdometerResponse.Orientation, test.ShouldResemble, s.TestNormalizedOrientation)
 		test.That(t, actualReading.TimedOdometerResponse.ReadingTime.After(beforeReading), test.ShouldBeTrue)
 		test.That(t, actualReading.TimedOdometerResponse.ReadingTime.Before(afterReading), test.ShouldBeTrue)
 		test.That(t, actualReading.TimedOdometerResponse.ReadingTime.Location(), test.ShouldEqual, time.UTC)
@@ -202,7 +215,7 @@ func TestTimedMovementSensorReading(t *testing.T) {
 		" returns current time in UTC and the reading", func(t *testing.T) {
 		lidar, odometer := s.GoodLidar, s.GoodMovementSensorBothIMUAndOdometer
 		deps := s.SetupDeps(lidar, odometer)
-		actualOdometer, err := s.NewMovementSensor(ctx, deps, string(odometer), testDataFrequencyHz, logger)
+		actualOdometer, err := s.NewMovementSensor(ctx, deps, string(odometer), testDataFrequencyHz, s.DegreesPerSecond, logger)
 		test.That(t, err, test.ShouldBeNil)
 
 		beforeReading := time.Now().UTC()
@@ -215,7 +228,7 @@ func TestTimedMovementSensorReading(t *testing.T) {
 
 		test.That(t, err, test.ShouldBeNil)
 		test.That(t, actualReading.TimedOdometerResponse.Position, test.ShouldResemble, s.TestPosition)
-		test.That(t, actualReading.TimedOdometerResponse.Orientation, test.ShouldResemble, s.TestOrientation)
+		test.That(t, actualReading.TimedOdometerResponse.Orientation, test.ShouldResemble, s.TestNormalizedOrientation)
 		test.That(t, actualReading.TimedOdometerResponse.ReadingTime.After(beforeReading), test.ShouldBeTrue)
 		test.That(t, actualReading.TimedOdometerResponse.ReadingTime.Before(afterReading), test.ShouldBeTrue)
 		test.That(t, actualReading.TimedOdometerResponse.ReadingTime.Location(), test.ShouldEqual, time.UTC)
@@ -225,3 +238,204 @@ func TestTimedMovementSensorReading(t *testing.T) {
 		test.That(t, actualReading.TestIsReplaySensor, test.ShouldBeFalse)
 	})
 }
+
+func TestTimedMovementSensorReadingOrientationNormalization(t *testing.T) {
+	logger := logging.NewTestLogger(t)
+	ctx := context.Background()
+
+	t.Run("when a live odometer returns a valid orientation, returns it unchanged", func(t *testing.T) {
+		lidar, odometer := s.GoodLidar, s.UnitOrientationOdometer
+		deps := s.SetupDeps(lidar, odometer)
+		actualOdometer, err := s.NewMovementSensor(ctx, deps, string(odometer), testDataFrequencyHz, s.DegreesPerSecond, logger)
+		test.That(t, err, test.ShouldBeNil)
+
+		actualReading, err := actualOdometer.TimedMovementSensorReading(ctx)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, actualReading.TimedOdometerResponse.Orientation, test.ShouldResemble, s.TestUnitOrientation)
+		test.That(t, actualOdometer.(*s.MovementSensor).InvalidOrientationCount(), test.ShouldEqual, 0)
+	})
+
+	t.Run("when a live odometer returns a denormalized orientation, returns the renormalized orientation", func(t *testing.T) {
+		lidar, odometer := s.GoodLidar, s.DenormalizedOrientationOdometer
+		deps := s.SetupDeps(lidar, odometer)
+		actualOdometer, err := s.NewMovementSensor(ctx, deps, string(odometer), testDataFrequencyHz, s.DegreesPerSecond, logger)
+		test.That(t, err, test.ShouldBeNil)
+
+		actualReading, err := actualOdometer.TimedMovementSensorReading(ctx)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, actualReading.TimedOdometerResponse.Position, test.ShouldResemble, s.TestPosition)
+		test.That(t, actualReading.TimedOdometerResponse.Orientation, test.ShouldResemble, s.TestUnitOrientation)
+		test.That(t, actualOdometer.(*s.MovementSensor).InvalidOrientationCount(), test.ShouldEqual, 0)
+	})
+
+	t.Run("when a live odometer returns a zero orientation, drops the reading, counts it and returns the error", func(t *testing.T) {
+		lidar, odometer := s.GoodLidar, s.ZeroOrientationOdometer
+		deps := s.SetupDeps(lidar, odometer)
+		actualOdometer, err := s.NewMovementSensor(ctx, deps, string(odometer), testDataFrequencyHz, s.DegreesPerSecond, logger)
+		test.That(t, err, test.ShouldBeNil)
+
+		actualReading, err := actualOdometer.TimedMovementSensorReading(ctx)
+		test.That(t, err, test.ShouldBeError, s.ErrInvalidOrientation)
+		test.That(t, actualReading, test.ShouldResemble, s.TimedMovementSensorReadingResponse{})
+		test.That(t, actualOdometer.(*s.MovementSensor).InvalidOrientationCount(), test.ShouldEqual, 1)
+
+		_, err = actualOdometer.TimedMovementSensorReading(ctx)
+		test.That(t, err, test.ShouldBeError, s.ErrInvalidOrientation)
+		test.That(t, actualOdometer.(*s.MovementSensor).InvalidOrientationCount(), test.ShouldEqual, 2)
+	})
+}
+
+func TestNormalizeOrientation(t *testing.T) {
+	t.Run("nil orientation is rejected", func(t *testing.T) {
+		quat, err := s.NormalizeOrientation(nil)
+		test.That(t, err, test.ShouldBeError, s.ErrInvalidOrientation)
+		test.That(t, quat, test.ShouldBeNil)
+	})
+
+	t.Run("zero quaternion is rejected", func(t *testing.T) {
+		quat, err := s.NormalizeOrientation(s.TestZeroOrientation)
+		test.That(t, err, test.ShouldBeError, s.ErrInvalidOrientation)
+		test.That(t, quat, test.ShouldBeNil)
+	})
+
+	t.Run("quaternions with NaN or Inf components are rejected", func(t *testing.T) {
+		quat, err := s.NormalizeOrientation(&spatialmath.Quaternion{Real: math.NaN(), Imag: 0, Jmag: 0, Kmag: 1})
+		test.That(t, err, test.ShouldBeError, s.ErrInvalidOrientation)
+		test.That(t, quat, test.ShouldBeNil)
+
+		quat, err = s.NormalizeOrientation(&spatialmath.Quaternion{Real: math.Inf(1), Imag: 0, Jmag: 0, Kmag: 1})
+		test.That(t, err, test.ShouldBeError, s.ErrInvalidOrientation)
+		test.That(t, quat, test.ShouldBeNil)
+	})
+
+	t.Run("denormalized quaternion is renormalized", func(t *testing.T) {
+		quat, err := s.NormalizeOrientation(s.TestDenormalizedOrientation)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, quat, test.ShouldResemble, s.TestUnitOrientation)
+	})
+
+	t.Run("the test orientation is normalized into the normalized test orientation", func(t *testing.T) {
+		quat, err := s.NormalizeOrientation(s.TestOrientation)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, quat, test.ShouldResemble, s.TestNormalizedOrientation)
+	})
+
+	t.Run("unit quaternion is passed through", func(t *testing.T) {
+		quat, err := s.NormalizeOrientation(s.TestUnitOrientation)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, quat, test.ShouldResemble, s.TestUnitOrientation)
+	})
+
+	t.Run("zero orientation vector is converted to a unit quaternion", func(t *testing.T) {
+		quat, err := s.NormalizeOrientation(&spatialmath.OrientationVector{})
+		test.That(t, err, test.ShouldBeNil)
+		norm := math.Sqrt(quat.Real*quat.Real + quat.Imag*quat.Imag + quat.Jmag*quat.Jmag + quat.Kmag*quat.Kmag)
+		test.That(t, norm, test.ShouldAlmostEqual, 1)
+	})
+}
+
+func TestHeadingOnlyMovementSensor(t *testing.T) {
+	logger := logging.NewTestLogger(t)
+	ctx := context.Background()
+
+	t.Run("fails for a movement sensor that supports Position", func(t *testing.T) {
+		movementSensor := s.GoodOdometer
+		actualMs, err := s.NewHeadingOnlyMovementSensor(ctx, s.SetupDeps(s.GoodLidar, movementSensor), string(movementSensor),
+			testDataFrequencyHz, s.DegreesPerSecond, logger)
+		test.That(t, err, test.ShouldBeError, s.ErrMovementSensorHeadingOnlyWithPosition)
+		test.That(t, actualMs, test.ShouldResemble, &s.MovementSensor{})
+	})
+
+	t.Run("fails for a movement sensor without a heading", func(t *testing.T) {
+		movementSensor := s.GoodIMU
+		actualMs, err := s.NewHeadingOnlyMovementSensor(ctx, s.SetupDeps(s.GoodLidar, movementSensor), string(movementSensor),
+			testDataFrequencyHz, s.DegreesPerSecond, logger)
+		test.That(t, err, test.ShouldBeError, s.ErrMovementSensorNoHeading)
+		test.That(t, actualMs, test.ShouldResemble, &s.MovementSensor{})
+	})
+
+	t.Run("a movement sensor that only supports Orientation is not an odometer without heading_only", func(t *testing.T) {
+		movementSensor := s.OrientationOnlyMovementSensor
+		_, err := s.NewMovementSensor(ctx, s.SetupDeps(s.GoodLidar, movementSensor), string(movementSensor),
+			testDataFrequencyHz, s.DegreesPerSecond, logger)
+		test.That(t, err, test.ShouldBeError, s.ErrMovementSensorNeitherIMUNorOdometer)
+	})
+
+	for _, tc := range []struct {
+		movementSensor s.TestSensor
+		expectedYaw    float64
+	}{
+		{movementSensor: s.OrientationOnlyMovementSensor, expectedYaw: s.TestOrientation.EulerAngles().Yaw},
+		// the compass heading of 90 degrees points east, which is a yaw of zero
+		{movementSensor: s.CompassMovementSensor, expectedYaw: 0},
+	} {
+		t.Run("returns the heading of "+string(tc.movementSensor)+" without a position", func(t *testing.T) {
+			ms, err := s.NewHeadingOnlyMovementSensor(ctx, s.SetupDeps(s.GoodLidar, tc.movementSensor),
+				string(tc.movementSensor), testDataFrequencyHz, s.DegreesPerSecond, logger)
+			test.That(t, err, test.ShouldBeNil)
+			test.That(t, ms.Properties(), test.ShouldResemble, s.MovementSensorProperties{
+				OdometerSupported: true,
+				HeadingOnly:       true,
+			})
+
+			beforeReading := time.Now().UTC()
+			reading, err := ms.TimedMovementSensorReading(ctx)
+			test.That(t, err, test.ShouldBeNil)
+			test.That(t, reading.TimedIMUResponse, test.ShouldBeNil)
+			test.That(t, reading.TimedOdometerResponse.Position, test.ShouldBeNil)
+			test.That(t, reading.TimedOdometerResponse.ReadingTime.Before(beforeReading), test.ShouldBeFalse)
+			angles := reading.TimedOdometerResponse.Orientation.EulerAngles()
+			test.That(t, angles.Yaw, test.ShouldAlmostEqual, tc.expectedYaw)
+			test.That(t, angles.Roll, test.ShouldAlmostEqual, 0)
+			test.That(t, angles.Pitch, test.ShouldAlmostEqual, 0)
+		})
+	}
+}
+
+func TestVelocityMovementSensor(t *testing.T) {
+	logger := logging.NewTestLogger(t)
+	ctx := context.Background()
+
+	t.Run("a movement sensor that only supports velocities is not an odometer unless configured", func(t *testing.T) {
+		_, err := s.NewMovementSensor(ctx, s.SetupDeps(s.GoodLidar, s.WheelEncoder), string(s.WheelEncoder),
+			testDataFrequencyHz, s.DegreesPerSecond, logger)
+		test.That(t, err, test.ShouldBeError, s.ErrMovementSensorNeitherIMUNorOdometer)
+	})
+
+	t.Run("returns an error for a movement sensor that supports Position and Orientation", func(t *testing.T) {
+		movementSensor := s.GoodMovementSensorBothIMUAndOdometer
+		_, err := s.NewVelocityOdometryMovementSensor(ctx, s.SetupDeps(s.GoodLidar, movementSensor),
+			string(movementSensor), testDataFrequencyHz, s.DegreesPerSecond, logger)
+		test.That(t, err, test.ShouldBeError, s.ErrMovementSensorVelocityOdometryWithPosition)
+	})
+
+	t.Run("returns an error for a movement sensor without velocities", func(t *testing.T) {
+		movementSensor := s.GoodIMU
+		_, err := s.NewVelocityOdometryMovementSensor(ctx, s.SetupDeps(s.GoodLidar, movementSensor),
+			string(movementSensor), testDataFrequencyHz, s.DegreesPerSecond, logger)
+		test.That(t, err, test.ShouldBeError, s.ErrMovementSensorNoVelocity)
+	})
+
+	ms, err := s.NewVelocityOdometryMovementSensor(ctx, s.SetupDeps(s.GoodLidar, s.WheelEncoder),
+		string(s.WheelEncoder), testDataFrequencyHz, s.DegreesPerSecond, logger)
+	test.That(t, err, test.ShouldBeNil)
+
+	t.Run("a movement sensor that only supports velocities is an odometer if configured", func(t *testing.T) {
+		test.That(t, ms.Properties(), test.ShouldResemble, s.MovementSensorProperties{
+			OdometerSupported: true,
+			VelocitySupported: true,
+		})
+	})
+
+	t.Run("returns a velocity reading with the angular velocity in radians per second", func(t *testing.T) {
+		beforeReading := time.Now().UTC()
+		reading, err := ms.TimedMovementSensorReading(ctx)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, reading.TimedIMUResponse, test.ShouldBeNil)
+		test.That(t, reading.TimedOdometerResponse, test.ShouldBeNil)
+		test.That(t, reading.TimedVelocityResponse.LinearVelocity, test.ShouldResemble, s.TestLinVel)
+		test.That(t, reading.TimedVelocityResponse.AngularVelocity.X, test.ShouldAlmostEqual, rdkutils.DegToRad(s.TestAngVel.X))
+		test.That(t, reading.TimedVelocityResponse.AngularVelocity.Y, test.ShouldAlmostEqual, rdkutils.DegToRad(s.TestAngVel.Y))
+		test.That(t, reading.TimedVelocityResponse.ReadingTime.Before(beforeReading), test.ShouldBeFalse)
+	})
+}
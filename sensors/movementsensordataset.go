@@ -0,0 +1,124 @@
+package sensors
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// LidarDatasetDir is the directory of an offline dataset that holds its lidar dataset frames.
+	LidarDatasetDir = "lidar"
+	// MovementSensorDatasetFile is the file of an offline dataset that holds its movement sensor readings.
+	MovementSensorDatasetFile = "movement_sensor/data.json"
+)
+
+// DatasetTime is the time a reading of a movement sensor dataset was requested or received.
+type DatasetTime struct {
+	Seconds int `json:"seconds"`
+	Nanos   int `json:"nanos"`
+}
+
+// DatasetCoordinate is a GPS coordinate of a movement sensor dataset.
+type DatasetCoordinate struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+}
+
+// DatasetVector is an angular velocity, in radians/s, a linear acceleration, in m/s^2, or a linear velocity, in
+// m/s, of a movement sensor dataset.
+type DatasetVector struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+	Z float64 `json:"z"`
+}
+
+// DatasetOrientation is an orientation vector, with theta in radians, of a movement sensor dataset.
+type DatasetOrientation struct {
+	Ox    float64 `json:"o_x"`
+	Oy    float64 `json:"o_y"`
+	Oz    float64 `json:"o_z"`
+	Theta float64 `json:"theta"`
+}
+
+// AngularVelocityData is an angular velocity reading of a movement sensor dataset.
+type AngularVelocityData struct {
+	MetaDataIndex int           `json:"MetadataIndex"`
+	TimeReceived  DatasetTime   `json:"TimeReceived"`
+	TimeRequested DatasetTime   `json:"TimeRequested"`
+	AngVel        DatasetVector `json:"angular_velocity"`
+}
+
+// LinearAccelerationData is a linear acceleration reading of a movement sensor dataset.
+type LinearAccelerationData struct {
+	MetaDataIndex int           `json:"MetadataIndex"`
+	TimeReceived  DatasetTime   `json:"TimeReceived"`
+	TimeRequested DatasetTime   `json:"TimeRequested"`
+	LinAcc        DatasetVector `json:"linear_acceleration"`
+}
+
+// LinearVelocityData is a linear velocity reading of a movement sensor dataset.
+type LinearVelocityData struct {
+	MetaDataIndex int           `json:"MetadataIndex"`
+	TimeReceived  DatasetTime   `json:"TimeReceived"`
+	TimeRequested DatasetTime   `json:"TimeRequested"`
+	LinVel        DatasetVector `json:"linear_velocity"`
+}
+
+// OrientationData is an orientation reading of a movement sensor dataset.
+type OrientationData struct {
+	MetaDataIndex int                `json:"MetadataIndex"`
+	TimeReceived  DatasetTime        `json:"TimeReceived"`
+	TimeRequested DatasetTime        `json:"TimeRequested"`
+	Orientation   DatasetOrientation `json:"orientation"`
+}
+
+// PositionData is a position reading of a movement sensor dataset.
+type PositionData struct {
+	MetaDataIndex int               `json:"MetadataIndex"`
+	TimeReceived  DatasetTime       `json:"TimeReceived"`
+	TimeRequested DatasetTime       `json:"TimeRequested"`
+	AltitudeM     int               `json:"altitude_m"`
+	Coordinate    DatasetCoordinate `json:"coordinate"`
+}
+
+// MovementSensorDataset holds the readings of a movement sensor dataset. The i-th reading of each kind
+// was taken at the same time.
+type MovementSensorDataset struct {
+	AngVelData      []AngularVelocityData    `json:"AngVelData"`
+	LinAccData      []LinearAccelerationData `json:"LinAccData"`
+	OrientationData []OrientationData        `json:"OrientationData"`
+	PosData         []PositionData           `json:"PosData"`
+	// LinVelData is only set for the datasets of a movement sensor that reports its odometry as velocities, e.g.
+	// a wheel encoder.
+	LinVelData []LinearVelocityData `json:"LinVelData,omitempty"`
+}
+
+// WriteMovementSensorDataset writes the movement sensor dataset as json to path, creating its parent
+// directory if needed.
+func WriteMovementSensorDataset(path string, data MovementSensorDataset) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return err
+	}
+	bytes, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, bytes, 0o640)
+}
+
+// ReadMovementSensorDataset returns the movement sensor dataset stored as json at path.
+func ReadMovementSensorDataset(path string) (MovementSensorDataset, error) {
+	//nolint:gosec
+	bytes, err := os.ReadFile(path)
+	if err != nil {
+		return MovementSensorDataset{}, err
+	}
+	var data MovementSensorDataset
+	if err := json.Unmarshal(bytes, &data); err != nil {
+		return MovementSensorDataset{}, errors.Wrapf(err, "failed to unmarshal %s", path)
+	}
+	return data, nil
+}
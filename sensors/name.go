@@ -0,0 +1,46 @@
+package sensors
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// EncodeNameForPath returns a resource name, e.g. "front lidar" or the remote "cart:front/lidar", encoded as a
+// single file name. Every byte other than ASCII letters, digits, '-', '_' and '.' is percent-encoded, as is a
+// leading '.', so the file name neither escapes its directory nor is hidden. DecodeNameFromPath reverses it.
+// Resource names are only encoded where they are used as paths and are passed as is everywhere else.
+func EncodeNameForPath(name string) string {
+	var b strings.Builder
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if c < utf8.RuneSelf && (unicode.IsLetter(rune(c)) || unicode.IsDigit(rune(c)) ||
+			c == '-' || c == '_' || (c == '.' && i > 0)) {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+	return b.String()
+}
+
+// DecodeNameFromPath returns the resource name a file name was encoded from by EncodeNameForPath.
+func DecodeNameFromPath(fileName string) (string, error) {
+	return url.PathUnescape(fileName)
+}
+
+// UnsupportedNameCharacters returns why the name of a sensor holds characters that are known to break the
+// cartofacade, or "" if it holds none. Such names are still passed to the cartofacade as is.
+func UnsupportedNameCharacters(name string) string {
+	if !utf8.ValidString(name) {
+		// cartographer stores the sensor ids of its trajectories as protobuf strings, which must be valid UTF-8
+		return "is not valid UTF-8, so the internal state holding it cannot be loaded"
+	}
+	if strings.ContainsFunc(name, unicode.IsControl) {
+		// the cartofacade writes the names of sensors it does not expect to its logs as is
+		return "holds control characters, which garble the logs of the cartofacade"
+	}
+	return ""
+}
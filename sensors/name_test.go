@@ -0,0 +1,52 @@
+package sensors_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go.viam.com/test"
+
+	s "github.com/viam-modules/viam-cartographer/sensors"
+)
+
+func TestEncodeNameForPath(t *testing.T) {
+	for name, fileName := range map[string]string{
+		"lidar":            "lidar",
+		"front_lidar-2.v1": "front_lidar-2.v1",
+		"front lidar":      "front%20lidar",
+		"cart:front/lidar": "cart%3Afront%2Flidar",
+		"100%":             "100%25",
+		".":                "%2E",
+		"..":               "%2E.",
+		".hidden":          "%2Ehidden",
+		"../lidar":         "%2E.%2Flidar",
+		"lidar\\ä":         "lidar%5C%C3%A4",
+	} {
+		t.Run(name, func(t *testing.T) {
+			test.That(t, s.EncodeNameForPath(name), test.ShouldEqual, fileName)
+			decoded, err := s.DecodeNameFromPath(fileName)
+			test.That(t, err, test.ShouldBeNil)
+			test.That(t, decoded, test.ShouldEqual, name)
+
+			// the encoded name is a file of dir
+			dir := t.TempDir()
+			path := filepath.Join(dir, s.EncodeNameForPath(name))
+			test.That(t, filepath.Dir(path), test.ShouldEqual, dir)
+			test.That(t, os.WriteFile(path, []byte(name), 0o640), test.ShouldBeNil)
+			dirEntries, err := os.ReadDir(dir)
+			test.That(t, err, test.ShouldBeNil)
+			test.That(t, dirEntries, test.ShouldHaveLength, 1)
+			test.That(t, dirEntries[0].Name(), test.ShouldEqual, fileName)
+		})
+	}
+}
+
+func TestUnsupportedNameCharacters(t *testing.T) {
+	for _, name := range []string{"lidar", "front lidar", "cart:front/lidar", "lidar ä"} {
+		test.That(t, s.UnsupportedNameCharacters(name), test.ShouldBeEmpty)
+	}
+	test.That(t, s.UnsupportedNameCharacters("lidar\xff"), test.ShouldContainSubstring, "UTF-8")
+	test.That(t, s.UnsupportedNameCharacters("lidar\x00"), test.ShouldContainSubstring, "control characters")
+	test.That(t, s.UnsupportedNameCharacters("lidar\n"), test.ShouldContainSubstring, "control characters")
+}
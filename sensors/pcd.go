@@ -0,0 +1,431 @@
+package sensors
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/golang/geo/r3"
+	"github.com/pkg/errors"
+	"go.viam.com/rdk/pointcloud"
+)
+
+// ErrUnsupportedPCD denotes a lidar reading that cartographer cannot read, e.g. the organized pointcloud of a depth
+// camera or one with 16-bit fields.
+var ErrUnsupportedPCD = errors.New("cartographer only reads unorganized pointclouds whose fields are 4 bytes")
+
+const (
+	pcdDataASCII            = "ascii"
+	pcdDataBinary           = "binary"
+	pcdDataBinaryCompressed = "binary_compressed"
+	// supportedPCDFieldSize is the only size of the fields of a PCD cartographer reads.
+	supportedPCDFieldSize = 4
+	// compressedPCDSizesLength is the length of the compressed and the uncompressed size that precede the data of
+	// a binary compressed PCD.
+	compressedPCDSizesLength = 8
+)
+
+// pcdHeader is the header of a PCD, as far as it is needed to convert its data.
+type pcdHeader struct {
+	// lines are the lines of the header up to, but excluding, its DATA line.
+	lines  []string
+	fields []string
+	sizes  []int
+	types  []string
+	counts []int
+	// height is the number of rows of an organized pointcloud, or 1.
+	height    int
+	numPoints int
+	data      string
+	// dataOffset is the offset of the data in the PCD.
+	dataOffset int
+}
+
+// fieldSizes returns the number of bytes of every field of a point.
+func (header pcdHeader) fieldSizes() []int {
+	fieldSizes := make([]int, len(header.sizes))
+	for i, size := range header.sizes {
+		fieldSizes[i] = size * header.counts[i]
+	}
+	return fieldSizes
+}
+
+// pointSize returns the number of bytes of a point.
+func (header pcdHeader) pointSize() int {
+	size := 0
+	for _, fieldSize := range header.fieldSizes() {
+		size += fieldSize
+	}
+	return size
+}
+
+// unsupportedReason returns why cartographer cannot read a PCD with the header, or "" if it can.
+func (header pcdHeader) unsupportedReason() string {
+	if header.height > 1 {
+		return fmt.Sprintf("the pointcloud is organized in %d rows", header.height)
+	}
+	for i, size := range header.sizes {
+		if size != supportedPCDFieldSize {
+			name := strconv.Itoa(i)
+			if i < len(header.fields) {
+				name = header.fields[i]
+			}
+			return fmt.Sprintf("field %s of the pointcloud has %d bytes", name, size)
+		}
+	}
+	return ""
+}
+
+// parsePCDHeader parses the header of a PCD up to and including its DATA line.
+func parsePCDHeader(pcd []byte) (pcdHeader, error) {
+	header := pcdHeader{height: 1}
+	offset := 0
+	for offset < len(pcd) {
+		end := bytes.IndexByte(pcd[offset:], '\n')
+		if end < 0 {
+			return pcdHeader{}, errors.New("PCD header does not have a DATA line")
+		}
+		line := strings.TrimSpace(string(pcd[offset : offset+end]))
+		offset += end + 1
+		fields := strings.Fields(line)
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			header.lines = append(header.lines, line)
+			continue
+		}
+		var err error
+		switch fields[0] {
+		case "FIELDS":
+			header.fields = fields[1:]
+		case "SIZE":
+			header.sizes, err = parsePCDHeaderInts(fields[1:])
+		case "TYPE":
+			header.types = fields[1:]
+		case "COUNT":
+			header.counts, err = parsePCDHeaderInts(fields[1:])
+		case "HEIGHT":
+			header.height, err = parsePCDHeaderInt(fields)
+		case "POINTS":
+			header.numPoints, err = parsePCDHeaderInt(fields)
+		case "DATA":
+			if len(fields) != 2 {
+				return pcdHeader{}, errors.Errorf("invalid PCD header line %q", line)
+			}
+			header.data = fields[1]
+			header.dataOffset = offset
+		}
+		if err != nil {
+			return pcdHeader{}, errors.Wrapf(err, "invalid PCD header line %q", line)
+		}
+		if header.data != "" {
+			break
+		}
+		header.lines = append(header.lines, line)
+	}
+	if header.data == "" {
+		return pcdHeader{}, errors.New("PCD header does not have a DATA line")
+	}
+	if header.counts == nil {
+		header.counts = make([]int, len(header.sizes))
+		for i := range header.counts {
+			header.counts[i] = 1
+		}
+	}
+	if len(header.counts) != len(header.sizes) {
+		return pcdHeader{}, errors.Errorf("PCD header has %d SIZE but %d COUNT values", len(header.sizes), len(header.counts))
+	}
+	return header, nil
+}
+
+// parsePCDHeaderInt parses the single integer of a PCD header line.
+func parsePCDHeaderInt(tokens []string) (int, error) {
+	if len(tokens) != 2 {
+		return 0, errors.New("expected a single value")
+	}
+	return strconv.Atoi(tokens[1])
+}
+
+// parsePCDHeaderInts parses the non-negative integers of a PCD header line.
+func parsePCDHeaderInts(tokens []string) ([]int, error) {
+	ints := make([]int, len(tokens))
+	for i, token := range tokens {
+		val, err := strconv.Atoi(token)
+		if err != nil {
+			return nil, err
+		}
+		if val < 0 {
+			return nil, errors.Errorf("%d is negative", val)
+		}
+		ints[i] = val
+	}
+	return ints, nil
+}
+
+// DecompressPCD converts a binary compressed PCD, as written by PCL, into a binary PCD, which is the only
+// binary format cartographer reads. Any other PCD is returned as is, without a copy.
+func DecompressPCD(pcd []byte) ([]byte, error) {
+	// only the header is parsed to detect the format, so that the points of uncompressed PCDs are not touched
+	if !bytes.Contains(pcd, []byte("DATA "+pcdDataBinaryCompressed)) {
+		return pcd, nil
+	}
+	header, err := parsePCDHeader(pcd)
+	if err != nil {
+		return nil, err
+	}
+	if header.data != pcdDataBinaryCompressed {
+		return pcd, nil
+	}
+
+	data := pcd[header.dataOffset:]
+	if len(data) < compressedPCDSizesLength {
+		return nil, errors.New("binary compressed PCD is missing the sizes of its data")
+	}
+	compressedSize := int(binary.LittleEndian.Uint32(data))
+	uncompressedSize := int(binary.LittleEndian.Uint32(data[4:]))
+	pointSize := header.pointSize()
+	if uncompressedSize != header.numPoints*pointSize {
+		return nil, errors.Errorf("binary compressed PCD holds %d bytes of data but %d points of %d bytes",
+			uncompressedSize, header.numPoints, pointSize)
+	}
+	if compressedSize > len(data)-compressedPCDSizesLength {
+		return nil, errors.Errorf("binary compressed PCD holds %d bytes of compressed data but states %d",
+			len(data)-compressedPCDSizesLength, compressedSize)
+	}
+	fieldMajor, err := lzfDecompress(data[compressedPCDSizesLength:compressedPCDSizesLength+compressedSize], uncompressedSize)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decompress binary compressed PCD")
+	}
+
+	out := bytes.NewBuffer(make([]byte, 0, header.dataOffset+uncompressedSize))
+	for _, line := range header.lines {
+		out.WriteString(line + "\n")
+	}
+	out.WriteString("DATA " + pcdDataBinary + "\n")
+	// the data of a binary compressed PCD holds every field of all points in turn, that of a binary PCD every
+	// point in turn
+	points := make([]byte, uncompressedSize)
+	fieldOffset := 0
+	for _, fieldSize := range header.fieldSizes() {
+		fieldData := fieldMajor[fieldOffset*header.numPoints:]
+		for i := 0; i < header.numPoints; i++ {
+			copy(points[i*pointSize+fieldOffset:], fieldData[i*fieldSize:(i+1)*fieldSize])
+		}
+		fieldOffset += fieldSize
+	}
+	out.Write(points)
+	return out.Bytes(), nil
+}
+
+// ReadLidarReading parses a lidar reading into a pointcloud. Binary compressed PCDs, which pointcloud.ReadPCD does
+// not read, are decompressed first.
+func ReadLidarReading(reading []byte) (pointcloud.PointCloud, error) {
+	pcd, err := DecompressPCD(reading)
+	if err != nil {
+		return nil, err
+	}
+	return pointcloud.ReadPCD(bytes.NewReader(pcd))
+}
+
+// lzfDecompress decompresses data compressed with the LZF algorithm into uncompressedSize bytes.
+func lzfDecompress(in []byte, uncompressedSize int) ([]byte, error) {
+	out := make([]byte, 0, uncompressedSize)
+	for i := 0; i < len(in); {
+		ctrl := int(in[i])
+		i++
+		if ctrl < 1<<5 {
+			// a run of ctrl+1 literal bytes
+			length := ctrl + 1
+			if i+length > len(in) {
+				return nil, errors.New("literal run exceeds the compressed data")
+			}
+			if len(out)+length > uncompressedSize {
+				return nil, errors.New("decompressed data exceeds its stated size")
+			}
+			out = append(out, in[i:i+length]...)
+			i += length
+			continue
+		}
+
+		// a back reference of length bytes, which may overlap the bytes it produces
+		length := ctrl >> 5
+		if length == 7 {
+			if i >= len(in) {
+				return nil, errors.New("back reference exceeds the compressed data")
+			}
+			length += int(in[i])
+			i++
+		}
+		if i >= len(in) {
+			return nil, errors.New("back reference exceeds the compressed data")
+		}
+		ref := len(out) - (ctrl&0x1f)<<8 - int(in[i]) - 1
+		i++
+		length += 2
+		if ref < 0 {
+			return nil, errors.New("back reference precedes the decompressed data")
+		}
+		if len(out)+length > uncompressedSize {
+			return nil, errors.New("decompressed data exceeds its stated size")
+		}
+		for j := 0; j < length; j++ {
+			out = append(out, out[ref+j])
+		}
+	}
+	if len(out) != uncompressedSize {
+		return nil, errors.Errorf("decompressed %d bytes but expected %d", len(out), uncompressedSize)
+	}
+	return out, nil
+}
+
+// SupportedPCD returns the lidar reading as is if cartographer can read it, decompressed if it is a binary
+// compressed PCD so that it is decompressed once for everything that reads it afterwards. Otherwise, if convert is
+// set, it returns the reading converted into an unorganized binary PCD of the x, y and z fields as 4 byte floats,
+// without its invalid points, and an ErrUnsupportedPCD stating why cartographer cannot read it if not. Readings
+// whose header cannot be parsed are returned as is, for cartographer to reject them.
+func SupportedPCD(reading []byte, convert bool) ([]byte, error) {
+	header, err := parsePCDHeader(reading)
+	if err != nil {
+		return reading, nil
+	}
+	reason := header.unsupportedReason()
+	if reason == "" {
+		if header.data == pcdDataBinaryCompressed {
+			return DecompressPCD(reading)
+		}
+		return reading, nil
+	}
+	if !convert {
+		return nil, errors.Wrapf(ErrUnsupportedPCD, "%s, set convert_unsupported_pcd to true to convert the lidar readings",
+			reason)
+	}
+	converted, err := convertPCD(reading, header)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to convert lidar reading as %s", reason)
+	}
+	return converted, nil
+}
+
+// convertPCD converts a PCD with the header into an unorganized binary PCD of the x, y and z fields as 4 byte
+// floats, dropping points that are not finite or at the origin, as depth cameras report points without a return.
+func convertPCD(pcd []byte, header pcdHeader) ([]byte, error) {
+	if header.data == pcdDataBinaryCompressed {
+		var err error
+		if pcd, err = DecompressPCD(pcd); err != nil {
+			return nil, err
+		}
+		if header, err = parsePCDHeader(pcd); err != nil {
+			return nil, err
+		}
+	}
+	if len(header.fields) != len(header.sizes) || len(header.types) != len(header.sizes) {
+		return nil, errors.New("PCD header does not have a SIZE and TYPE for every field")
+	}
+
+	// the indices of the x, y and z fields, and the offset of every field in a point
+	xyz := [3]int{-1, -1, -1}
+	for i, field := range header.fields {
+		if j := strings.Index("xyz", field); len(field) == 1 && j >= 0 {
+			xyz[j] = i
+		}
+	}
+	if xyz[0] < 0 || xyz[1] < 0 || xyz[2] < 0 {
+		return nil, errors.New("PCD does not have x, y and z fields")
+	}
+
+	var points []r3.Vector
+	addPoint := func(point r3.Vector) {
+		if !math.IsNaN(point.Norm()) && !math.IsInf(point.Norm(), 0) && point != (r3.Vector{}) {
+			points = append(points, point)
+		}
+	}
+	data := pcd[header.dataOffset:]
+	switch header.data {
+	case pcdDataBinary:
+		pointSize := header.pointSize()
+		if len(data) < header.numPoints*pointSize {
+			return nil, errors.Errorf("PCD holds %d bytes of data but %d points of %d bytes", len(data),
+				header.numPoints, pointSize)
+		}
+		fieldOffsets := make([]int, len(header.sizes))
+		for i, fieldSize := range header.fieldSizes()[:len(header.sizes)-1] {
+			fieldOffsets[i+1] = fieldOffsets[i] + fieldSize
+		}
+		for i := 0; i < header.numPoints; i++ {
+			var coordinates [3]float64
+			for j, field := range xyz {
+				start := i*pointSize + fieldOffsets[field]
+				val, err := decodePCDValue(data[start:start+header.sizes[field]], header.types[field])
+				if err != nil {
+					return nil, errors.Wrapf(err, "field %s", header.fields[field])
+				}
+				coordinates[j] = val
+			}
+			addPoint(r3.Vector{X: coordinates[0], Y: coordinates[1], Z: coordinates[2]})
+		}
+	case pcdDataASCII:
+		// the index of the first value of every field in a line
+		fieldIndices := make([]int, len(header.counts))
+		for i, count := range header.counts[:len(header.counts)-1] {
+			fieldIndices[i+1] = fieldIndices[i] + count
+		}
+		lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+		if len(lines) < header.numPoints {
+			return nil, errors.Errorf("PCD holds %d lines of data but %d points", len(lines), header.numPoints)
+		}
+		for _, line := range lines[:header.numPoints] {
+			values := strings.Fields(line)
+			var coordinates [3]float64
+			for j, field := range xyz {
+				if fieldIndices[field] >= len(values) {
+					return nil, errors.Errorf("PCD data line %q does not have field %s", line, header.fields[field])
+				}
+				val, err := strconv.ParseFloat(values[fieldIndices[field]], 64)
+				if err != nil {
+					return nil, errors.Wrapf(err, "field %s", header.fields[field])
+				}
+				coordinates[j] = val
+			}
+			addPoint(r3.Vector{X: coordinates[0], Y: coordinates[1], Z: coordinates[2]})
+		}
+	default:
+		return nil, errors.Errorf("unsupported PCD DATA %s", header.data)
+	}
+
+	out := []byte(fmt.Sprintf("VERSION .7\nFIELDS x y z\nSIZE 4 4 4\nTYPE F F F\nCOUNT 1 1 1\nWIDTH %d\nHEIGHT 1\n"+
+		"VIEWPOINT 0 0 0 1 0 0 0\nPOINTS %d\nDATA %s\n", len(points), len(points), pcdDataBinary))
+	for _, point := range points {
+		for _, coordinate := range []float64{point.X, point.Y, point.Z} {
+			out = binary.LittleEndian.AppendUint32(out, math.Float32bits(float32(coordinate)))
+		}
+	}
+	return out, nil
+}
+
+// decodePCDValue decodes the little endian value of a PCD field of the TYPE typ.
+func decodePCDValue(b []byte, typ string) (float64, error) {
+	switch {
+	case typ == "F" && len(b) == 4:
+		return float64(math.Float32frombits(binary.LittleEndian.Uint32(b))), nil
+	case typ == "F" && len(b) == 8:
+		return math.Float64frombits(binary.LittleEndian.Uint64(b)), nil
+	case typ == "I" && len(b) == 1:
+		return float64(int8(b[0])), nil
+	case typ == "I" && len(b) == 2:
+		return float64(int16(binary.LittleEndian.Uint16(b))), nil
+	case typ == "I" && len(b) == 4:
+		return float64(int32(binary.LittleEndian.Uint32(b))), nil
+	case typ == "I" && len(b) == 8:
+		return float64(int64(binary.LittleEndian.Uint64(b))), nil
+	case typ == "U" && len(b) == 1:
+		return float64(b[0]), nil
+	case typ == "U" && len(b) == 2:
+		return float64(binary.LittleEndian.Uint16(b)), nil
+	case typ == "U" && len(b) == 4:
+		return float64(binary.LittleEndian.Uint32(b)), nil
+	case typ == "U" && len(b) == 8:
+		return float64(binary.LittleEndian.Uint64(b)), nil
+	}
+	return 0, errors.Errorf("unsupported TYPE %s of %d bytes", typ, len(b))
+}
@@ -0,0 +1,267 @@
+package sensors_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang/geo/r3"
+	"github.com/pkg/errors"
+	"go.viam.com/rdk/pointcloud"
+	"go.viam.com/test"
+
+	s "github.com/viam-modules/viam-cartographer/sensors"
+)
+
+const (
+	binaryScanPath           = "testdata/scan_binary.pcd"
+	binaryCompressedScanPath = "testdata/scan_binary_compressed.pcd"
+	// organizedPCDPath is a 4x3 pointcloud of a depth camera, whose every fourth point is NaN.
+	organizedPCDPath = "testdata/organized.pcd"
+	// sixteenBitPCDPath is a pointcloud of 16-bit integer fields, two of whose points are at the origin.
+	sixteenBitPCDPath = "testdata/16bit_fields.pcd"
+)
+
+// pcdPoints returns the points of a PCD, in millimeters.
+func pcdPoints(t *testing.T, pcd []byte) []r3.Vector {
+	t.Helper()
+	pc, err := pointcloud.ReadPCD(bytes.NewReader(pcd))
+	test.That(t, err, test.ShouldBeNil)
+	var points []r3.Vector
+	pc.Iterate(0, 0, func(p r3.Vector, d pointcloud.Data) bool {
+		points = append(points, p)
+		return true
+	})
+	return points
+}
+
+// compressedPCD returns a binary compressed PCD with the given header and field-major data, compressed as LZF
+// literal runs only.
+func compressedPCD(header string, fieldMajor []byte) []byte {
+	var compressed []byte
+	for start := 0; start < len(fieldMajor); start += 32 {
+		end := start + 32
+		if end > len(fieldMajor) {
+			end = len(fieldMajor)
+		}
+		compressed = append(compressed, byte(end-start-1))
+		compressed = append(compressed, fieldMajor[start:end]...)
+	}
+	pcd := []byte(header + "DATA binary_compressed\n")
+	pcd = binary.LittleEndian.AppendUint32(pcd, uint32(len(compressed)))
+	pcd = binary.LittleEndian.AppendUint32(pcd, uint32(len(fieldMajor)))
+	return append(pcd, compressed...)
+}
+
+func TestDecompressPCD(t *testing.T) {
+	binaryScan, err := os.ReadFile(binaryScanPath)
+	test.That(t, err, test.ShouldBeNil)
+	compressedScan, err := os.ReadFile(binaryCompressedScanPath)
+	test.That(t, err, test.ShouldBeNil)
+
+	t.Run("returns a PCD that is not binary compressed as is", func(t *testing.T) {
+		pcd, err := s.DecompressPCD(binaryScan)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, &pcd[0], test.ShouldEqual, &binaryScan[0])
+	})
+
+	t.Run("decompresses a binary compressed scan into the binary scan", func(t *testing.T) {
+		pcd, err := s.DecompressPCD(compressedScan)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, pcd, test.ShouldResemble, binaryScan)
+
+		pc, err := pointcloud.ReadPCD(bytes.NewReader(pcd))
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, pc.Size(), test.ShouldEqual, 720)
+	})
+
+	t.Run("interleaves fields of different sizes", func(t *testing.T) {
+		header := "VERSION .7\nFIELDS x label\nSIZE 4 1\nTYPE F U\nCOUNT 1 2\nWIDTH 3\nHEIGHT 1\nPOINTS 3\n"
+		xs := []byte{1, 1, 1, 1, 2, 2, 2, 2, 3, 3, 3, 3}
+		labels := []byte{10, 11, 20, 21, 30, 31}
+		pcd, err := s.DecompressPCD(compressedPCD(header, append(xs, labels...)))
+		test.That(t, err, test.ShouldBeNil)
+
+		expected := append([]byte(header+"DATA binary\n"),
+			1, 1, 1, 1, 10, 11,
+			2, 2, 2, 2, 20, 21,
+			3, 3, 3, 3, 30, 31)
+		test.That(t, pcd, test.ShouldResemble, expected)
+	})
+
+	t.Run("errors on invalid binary compressed PCDs", func(t *testing.T) {
+		header := "VERSION .7\nFIELDS x\nSIZE 4\nTYPE F\nCOUNT 1\nWIDTH 2\nHEIGHT 1\nPOINTS 2\n"
+		valid := compressedPCD(header, []byte{1, 2, 3, 4, 5, 6, 7, 8})
+
+		_, err := s.DecompressPCD(valid[:len(valid)-1])
+		test.That(t, err, test.ShouldBeError)
+		test.That(t, err.Error(), test.ShouldContainSubstring, "compressed data but states")
+
+		_, err = s.DecompressPCD(compressedPCD(header, []byte{1, 2, 3, 4}))
+		test.That(t, err, test.ShouldBeError)
+		test.That(t, err.Error(), test.ShouldContainSubstring, "holds 4 bytes of data but 2 points of 4 bytes")
+
+		// a back reference to the 8 bytes before the first one
+		backReference := append([]byte(header+"DATA binary_compressed\n"), 2, 0, 0, 0, 8, 0, 0, 0, 6<<5, 7)
+		_, err = s.DecompressPCD(backReference)
+		test.That(t, err, test.ShouldBeError)
+		test.That(t, err.Error(), test.ShouldContainSubstring, "back reference precedes the decompressed data")
+
+		_, err = s.DecompressPCD([]byte("VERSION .7\nDATA binary_compressed"))
+		test.That(t, err, test.ShouldBeError)
+		test.That(t, err.Error(), test.ShouldContainSubstring, "PCD header does not have a DATA line")
+	})
+
+	t.Run("decompresses binary compressed dataset frames", func(t *testing.T) {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "0.pcd")
+		test.That(t, os.WriteFile(path, compressedScan, 0o640), test.ShouldBeNil)
+		reading, err := s.ReadLidarDatasetFrame(path)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, reading, test.ShouldResemble, binaryScan)
+
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		_, err = gz.Write(compressedScan)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, gz.Close(), test.ShouldBeNil)
+		path = filepath.Join(dir, "1"+s.CompressedPCDExtension)
+		test.That(t, os.WriteFile(path, buf.Bytes(), 0o640), test.ShouldBeNil)
+		reading, err = s.ReadLidarDatasetFrame(path)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, reading, test.ShouldResemble, binaryScan)
+	})
+}
+
+func TestSupportedPCD(t *testing.T) {
+	binaryScan, err := os.ReadFile(binaryScanPath)
+	test.That(t, err, test.ShouldBeNil)
+	organized, err := os.ReadFile(organizedPCDPath)
+	test.That(t, err, test.ShouldBeNil)
+	sixteenBit, err := os.ReadFile(sixteenBitPCDPath)
+	test.That(t, err, test.ShouldBeNil)
+
+	t.Run("returns a PCD cartographer reads as is", func(t *testing.T) {
+		for _, convert := range []bool{false, true} {
+			pcd, err := s.SupportedPCD(binaryScan, convert)
+			test.That(t, err, test.ShouldBeNil)
+			test.That(t, &pcd[0], test.ShouldEqual, &binaryScan[0])
+		}
+
+		pcd, err := s.SupportedPCD([]byte("he0llo"), false)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, pcd, test.ShouldResemble, []byte("he0llo"))
+	})
+
+	t.Run("decompresses a binary compressed PCD cartographer reads", func(t *testing.T) {
+		binaryCompressedScan, err := os.ReadFile(binaryCompressedScanPath)
+		test.That(t, err, test.ShouldBeNil)
+		pcd, err := s.SupportedPCD(binaryCompressedScan, false)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, pcd, test.ShouldResemble, binaryScan)
+	})
+
+	t.Run("rejects an organized PCD naming the flag to convert it", func(t *testing.T) {
+		_, err := s.SupportedPCD(organized, false)
+		test.That(t, errors.Is(err, s.ErrUnsupportedPCD), test.ShouldBeTrue)
+		test.That(t, err.Error(), test.ShouldContainSubstring, "the pointcloud is organized in 3 rows")
+		test.That(t, err.Error(), test.ShouldContainSubstring, "convert_unsupported_pcd")
+	})
+
+	t.Run("rejects a PCD with 16-bit fields naming the flag to convert it", func(t *testing.T) {
+		_, err := s.SupportedPCD(sixteenBit, false)
+		test.That(t, errors.Is(err, s.ErrUnsupportedPCD), test.ShouldBeTrue)
+		test.That(t, err.Error(), test.ShouldContainSubstring, "field x of the pointcloud has 2 bytes")
+		test.That(t, err.Error(), test.ShouldContainSubstring, "convert_unsupported_pcd")
+	})
+
+	t.Run("flattens an organized PCD without its invalid points", func(t *testing.T) {
+		pcd, err := s.SupportedPCD(organized, true)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, string(pcd), test.ShouldContainSubstring, "WIDTH 9\nHEIGHT 1\n")
+		var expected []r3.Vector
+		for row := 1; row <= 3; row++ {
+			for col := 1; col <= 3; col++ {
+				expected = append(expected, r3.Vector{X: 500 * float64(col), Y: 250 * float64(row), Z: 1500})
+			}
+		}
+		test.That(t, pcdPoints(t, pcd), test.ShouldHaveLength, len(expected))
+		for _, point := range expected {
+			test.That(t, pcdPoints(t, pcd), test.ShouldContain, point)
+		}
+
+		// the converted PCD is read as is
+		again, err := s.SupportedPCD(pcd, false)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, again, test.ShouldResemble, pcd)
+	})
+
+	t.Run("casts 16-bit fields to 4 byte floats without the points at the origin", func(t *testing.T) {
+		pcd, err := s.SupportedPCD(sixteenBit, true)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, string(pcd), test.ShouldContainSubstring, "FIELDS x y z\nSIZE 4 4 4\nTYPE F F F\n")
+		test.That(t, pcdPoints(t, pcd), test.ShouldResemble, []r3.Vector{
+			{X: 1000e3, Y: -500e3, Z: 250e3},
+			{X: -2000e3, Y: 1500e3, Z: 0},
+			{X: 300e3, Y: 300e3, Z: -100e3},
+			{X: 32000e3, Y: -32000e3, Z: 1e3},
+		})
+	})
+
+	t.Run("converts an ascii PCD", func(t *testing.T) {
+		ascii := "VERSION .7\nFIELDS x y z\nSIZE 8 8 8\nTYPE F F F\nCOUNT 1 1 1\nWIDTH 2\nHEIGHT 1\nPOINTS 2\n" +
+			"DATA ascii\n1.5 2 -3\nnan nan nan\n"
+		pcd, err := s.SupportedPCD([]byte(ascii), true)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, pcdPoints(t, pcd), test.ShouldResemble, []r3.Vector{{X: 1500, Y: 2000, Z: -3000}})
+	})
+
+	t.Run("errors on a PCD it cannot convert", func(t *testing.T) {
+		_, err := s.SupportedPCD(sixteenBit[:len(sixteenBit)-1], true)
+		test.That(t, err, test.ShouldBeError)
+		test.That(t, err.Error(), test.ShouldContainSubstring, "failed to convert lidar reading")
+
+		noZ := bytes.Replace(sixteenBit, []byte("FIELDS x y z intensity"), []byte("FIELDS x y w intensity"), 1)
+		_, err = s.SupportedPCD(noZ, true)
+		test.That(t, err, test.ShouldBeError)
+		test.That(t, err.Error(), test.ShouldContainSubstring, "PCD does not have x, y and z fields")
+	})
+}
+
+func TestReadLidarReading(t *testing.T) {
+	binaryScan, err := os.ReadFile(binaryScanPath)
+	test.That(t, err, test.ShouldBeNil)
+	binaryCompressedScan, err := os.ReadFile(binaryCompressedScanPath)
+	test.That(t, err, test.ShouldBeNil)
+
+	t.Run("reads a binary compressed PCD like the binary one", func(t *testing.T) {
+		pc, err := s.ReadLidarReading(binaryCompressedScan)
+		test.That(t, err, test.ShouldBeNil)
+		binaryPoints := pcdPoints(t, binaryScan)
+		test.That(t, pc.Size(), test.ShouldEqual, len(binaryPoints))
+		for _, p := range binaryPoints {
+			_, ok := pc.At(p.X, p.Y, p.Z)
+			test.That(t, ok, test.ShouldBeTrue)
+		}
+	})
+
+	t.Run("binary compressed readings are filtered and counted", func(t *testing.T) {
+		numUsable, err := s.NumUsablePoints(binaryCompressedScan, 0.5)
+		test.That(t, err, test.ShouldBeNil)
+		expectedNumUsable, err := s.NumUsablePoints(binaryScan, 0.5)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, numUsable, test.ShouldEqual, expectedNumUsable)
+
+		filter := s.LidarPointFilter{MinRangeMm: 500}
+		filtered, numKept, numRemoved, err := filter.FilterLidarReading(binaryCompressedScan)
+		test.That(t, err, test.ShouldBeNil)
+		_, expectedNumKept, expectedNumRemoved, err := filter.FilterLidarReading(binaryScan)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, numKept, test.ShouldEqual, expectedNumKept)
+		test.That(t, numRemoved, test.ShouldEqual, expectedNumRemoved)
+		test.That(t, pcdPoints(t, filtered), test.ShouldHaveLength, numKept)
+	})
+}
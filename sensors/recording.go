@@ -0,0 +1,95 @@
+package sensors
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.viam.com/rdk/logging"
+)
+
+// datasetFrameTimeFormat is the format of the reading times the frames of a recording are named by. Unlike
+// time.RFC3339Nano it keeps trailing zeros, so that the names of the frames sort lexically in the order of their
+// reading times.
+const datasetFrameTimeFormat = "2006-01-02T15:04:05.000000000Z07:00"
+
+// recordingLidar writes the readings of a lidar to the lidar dataset frames of an offline dataset.
+type recordingLidar struct {
+	TimedLidar
+	dir              string
+	compressionLevel int
+	logger           logging.Logger
+	// lastWarned is the time in unix nanoseconds a failure to write a frame was last warned about.
+	lastWarned *atomic.Int64
+}
+
+// NewRecordingLidar returns the lidar with each of its readings also written to the offline dataset in datasetDir,
+// compressed with compressionLevel as WriteLidarDatasetFrame does. The frames are named by their reading time in
+// UTC, so that ListLidarDatasetFrames returns them in the order they were read. A reading that cannot be written is
+// returned anyway with a throttled warning, so that recording never stops the lidar from being read.
+func NewRecordingLidar(
+	lidar TimedLidar,
+	datasetDir string,
+	compressionLevel int,
+	logger logging.Logger,
+) (TimedLidar, error) {
+	if err := ValidateDatasetCompressionLevel(compressionLevel); err != nil {
+		return nil, err
+	}
+	dir := filepath.Join(datasetDir, LidarDatasetDir)
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, errors.Wrapf(err, "failed to create the lidar dataset directory %s", dir)
+	}
+	return &recordingLidar{
+		TimedLidar:       lidar,
+		dir:              dir,
+		compressionLevel: compressionLevel,
+		logger:           logger,
+		lastWarned:       &atomic.Int64{},
+	}, nil
+}
+
+// TimedLidarReading returns the next reading of the lidar, once it is written to the dataset.
+func (lidar *recordingLidar) TimedLidarReading(ctx context.Context) (TimedLidarReadingResponse, error) {
+	reading, err := lidar.TimedLidar.TimedLidarReading(ctx)
+	if err != nil {
+		return reading, err
+	}
+	name := reading.ReadingTime.UTC().Format(datasetFrameTimeFormat)
+	if _, err := WriteLidarDatasetFrame(lidar.dir, name, reading.Reading, lidar.compressionLevel); err != nil {
+		now := time.Now().UnixNano()
+		last := lidar.lastWarned.Load()
+		if time.Duration(now-last) >= invalidReadingWarningInterval && lidar.lastWarned.CompareAndSwap(last, now) {
+			lidar.logger.Warnw("failed to record lidar reading", "lidar", lidar.Name(), "error", err)
+		}
+	}
+	return reading, nil
+}
+
+// ResourceHealth returns the health of the resource the lidar it records reads from.
+func (lidar *recordingLidar) ResourceHealth() (ResourceHealth, bool) {
+	return ResourceHealthOf(lidar.TimedLidar)
+}
+
+// Refresh returns the lidar with its camera resolved again by resolve, recorded to the same dataset. It fails if
+// the lidar it records is not a RefreshableLidar.
+func (lidar *recordingLidar) Refresh(ctx context.Context, resolve ResourceResolver) (TimedLidar, error) {
+	refreshable, ok := lidar.TimedLidar.(RefreshableLidar)
+	if !ok {
+		return nil, errors.Errorf("lidar %v cannot be refreshed", lidar.Name())
+	}
+	refreshed, err := refreshable.Refresh(ctx, resolve)
+	if err != nil {
+		return nil, err
+	}
+	return &recordingLidar{
+		TimedLidar:       refreshed,
+		dir:              lidar.dir,
+		compressionLevel: lidar.compressionLevel,
+		logger:           lidar.logger,
+		lastWarned:       lidar.lastWarned,
+	}, nil
+}
@@ -0,0 +1,105 @@
+package sensors_test
+
+import (
+	"compress/gzip"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"go.viam.com/rdk/logging"
+	"go.viam.com/test"
+
+	s "github.com/viam-modules/viam-cartographer/sensors"
+)
+
+func TestRecordingLidar(t *testing.T) {
+	logger := logging.NewTestLogger(t)
+	cfg := s.DefaultSyntheticDatasetConfig()
+	cfg.NumScans = 4
+	datasetDir := t.TempDir()
+	test.That(t, s.GenerateSyntheticDataset(datasetDir, cfg), test.ShouldBeNil)
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	// record replays the dataset through a recording lidar and returns the readings it returned
+	record := func(t *testing.T, recordingDir string, compressionLevel int) [][]byte {
+		t.Helper()
+		lidar, err := s.NewDatasetLidar(datasetDir, s.DatasetReplayConfig{Start: start, Interval: time.Second})
+		test.That(t, err, test.ShouldBeNil)
+		recordingLidar, err := s.NewRecordingLidar(lidar, recordingDir, compressionLevel, logger)
+		test.That(t, err, test.ShouldBeNil)
+		var readings [][]byte
+		for i := 0; i < cfg.NumScans; i++ {
+			reading, err := recordingLidar.TimedLidarReading(context.Background())
+			test.That(t, err, test.ShouldBeNil)
+			test.That(t, reading.ReadingTime, test.ShouldEqual, start.Add(time.Duration(i)*time.Second))
+			readings = append(readings, reading.Reading)
+		}
+		return readings
+	}
+
+	// replay returns the readings of the recording in recordingDir
+	replay := func(t *testing.T, recordingDir string) [][]byte {
+		t.Helper()
+		lidar, err := s.NewDatasetLidar(recordingDir, s.DatasetReplayConfig{Start: start, Interval: time.Second})
+		test.That(t, err, test.ShouldBeNil)
+		var readings [][]byte
+		for i := 0; i < cfg.NumScans; i++ {
+			reading, err := lidar.TimedLidarReading(context.Background())
+			test.That(t, err, test.ShouldBeNil)
+			readings = append(readings, reading.Reading)
+		}
+		return readings
+	}
+
+	uncompressedDir := t.TempDir()
+	recorded := record(t, uncompressedDir, s.NoDatasetCompression)
+
+	t.Run("names the frames by their reading time", func(t *testing.T) {
+		framePaths, err := s.ListLidarDatasetFrames(filepath.Join(uncompressedDir, s.LidarDatasetDir))
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, len(framePaths), test.ShouldEqual, cfg.NumScans)
+		for i, framePath := range framePaths {
+			test.That(t, filepath.Base(framePath), test.ShouldEqual,
+				start.Add(time.Duration(i)*time.Second).Format("2006-01-02T15:04:05.000000000Z")+s.PCDExtension)
+		}
+	})
+
+	t.Run("compressed recordings replay the same readings as uncompressed ones", func(t *testing.T) {
+		compressedDir := t.TempDir()
+		test.That(t, record(t, compressedDir, gzip.BestCompression), test.ShouldResemble, recorded)
+
+		framePaths, err := s.ListLidarDatasetFrames(filepath.Join(compressedDir, s.LidarDatasetDir))
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, len(framePaths), test.ShouldEqual, cfg.NumScans)
+		for _, framePath := range framePaths {
+			test.That(t, framePath, test.ShouldEndWith, s.CompressedPCDExtension)
+		}
+		test.That(t, replay(t, compressedDir), test.ShouldResemble, replay(t, uncompressedDir))
+	})
+
+	t.Run("recordings that mix compressed and uncompressed frames replay in order", func(t *testing.T) {
+		mixedDir := t.TempDir()
+		record(t, mixedDir, gzip.BestSpeed)
+		framePaths, err := s.ListLidarDatasetFrames(filepath.Join(mixedDir, s.LidarDatasetDir))
+		test.That(t, err, test.ShouldBeNil)
+		for i := 0; i < len(framePaths); i += 2 {
+			reading, err := s.ReadLidarDatasetFrame(framePaths[i])
+			test.That(t, err, test.ShouldBeNil)
+			test.That(t, os.Remove(framePaths[i]), test.ShouldBeNil)
+			name := strings.TrimSuffix(filepath.Base(framePaths[i]), s.CompressedPCDExtension)
+			_, err = s.WriteLidarDatasetFrame(filepath.Dir(framePaths[i]), name, reading, s.NoDatasetCompression)
+			test.That(t, err, test.ShouldBeNil)
+		}
+		test.That(t, replay(t, mixedDir), test.ShouldResemble, replay(t, uncompressedDir))
+	})
+
+	t.Run("rejects invalid compression levels", func(t *testing.T) {
+		lidar, err := s.NewDatasetLidar(datasetDir, s.DatasetReplayConfig{})
+		test.That(t, err, test.ShouldBeNil)
+		_, err = s.NewRecordingLidar(lidar, t.TempDir(), gzip.BestCompression+1, logger)
+		test.That(t, err, test.ShouldBeError, s.ErrInvalidDatasetCompressionLevel)
+	})
+}
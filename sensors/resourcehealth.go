@@ -0,0 +1,86 @@
+package sensors
+
+import (
+	"sync"
+	"time"
+
+	"go.viam.com/rdk/resource"
+)
+
+// ResourceHealth is the health of the robot resource a sensor reads from, to tell which physical camera or
+// movement sensor a misbehaving SLAM service is bound to and whether it is healthy.
+type ResourceHealth struct {
+	// Name is the fully qualified resource name of the resource.
+	Name resource.Name
+	// StartupChecks are the checks the resource passed when the sensor was constructed, in the order they ran.
+	StartupChecks []string
+	// LastSuccessfulReadAt is the time of the last read from the resource that succeeded, or the zero time if none
+	// did.
+	LastSuccessfulReadAt time.Time
+	// LastError is the error of the last read from the resource that failed, at LastErrorAt, or "" if none did.
+	LastError   string
+	LastErrorAt time.Time
+}
+
+// ResourceHealthReporter is implemented by the sensors that read from a robot resource and by the sensors that
+// wrap them.
+type ResourceHealthReporter interface {
+	// ResourceHealth returns the health of the resource the sensor reads from, or false if it does not read from
+	// one.
+	ResourceHealth() (ResourceHealth, bool)
+}
+
+// ResourceHealthOf returns the health of the resource sensor reads from, or false if sensor is not a
+// ResourceHealthReporter or does not read from a resource.
+func ResourceHealthOf(sensor interface{}) (ResourceHealth, bool) {
+	reporter, ok := sensor.(ResourceHealthReporter)
+	if !ok {
+		return ResourceHealth{}, false
+	}
+	return reporter.ResourceHealth()
+}
+
+// readHealth records the outcome of the reads from a resource. It is kept behind a pointer so that the copies of
+// a sensor, e.g. the one returned by Refresh, share it.
+type readHealth struct {
+	name          resource.Name
+	startupChecks []string
+
+	mu                   sync.Mutex
+	lastSuccessfulReadAt time.Time
+	lastError            string
+	lastErrorAt          time.Time
+}
+
+func newReadHealth(name resource.Name, startupChecks []string) *readHealth {
+	return &readHealth{name: name, startupChecks: startupChecks}
+}
+
+// record records the outcome of a read that completed at now and failed with err, if it is not nil.
+func (health *readHealth) record(now time.Time, err error) {
+	health.mu.Lock()
+	defer health.mu.Unlock()
+	if err != nil {
+		health.lastError = err.Error()
+		health.lastErrorAt = now
+		return
+	}
+	health.lastSuccessfulReadAt = now
+}
+
+// resourceHealth returns the health recorded so far, or false if health is nil, i.e. for the zero value of a
+// sensor.
+func (health *readHealth) resourceHealth() (ResourceHealth, bool) {
+	if health == nil {
+		return ResourceHealth{}, false
+	}
+	health.mu.Lock()
+	defer health.mu.Unlock()
+	return ResourceHealth{
+		Name:                 health.name,
+		StartupChecks:        append([]string{}, health.startupChecks...),
+		LastSuccessfulReadAt: health.lastSuccessfulReadAt,
+		LastError:            health.lastError,
+		LastErrorAt:          health.lastErrorAt,
+	}, true
+}
@@ -0,0 +1,86 @@
+package sensors_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.viam.com/rdk/components/camera"
+	"go.viam.com/rdk/components/movementsensor"
+	"go.viam.com/rdk/logging"
+	"go.viam.com/test"
+
+	s "github.com/viam-modules/viam-cartographer/sensors"
+	"github.com/viam-modules/viam-cartographer/sensors/inject"
+)
+
+func TestResourceHealth(t *testing.T) {
+	logger := logging.NewTestLogger(t)
+	ctx := context.Background()
+
+	t.Run("the lidar records the outcome of its reads, across refreshes and wrappers", func(t *testing.T) {
+		deps := s.SetupDeps(s.LidarWithErroringFunctions, s.NoMovementSensor)
+		lidar, err := s.NewLidar(ctx, deps, string(s.LidarWithErroringFunctions), testDataFrequencyHz, logger)
+		test.That(t, err, test.ShouldBeNil)
+		wrapped := s.NewCalibratedLidar(s.NewFilteringLidar(lidar, s.LidarPointFilter{MinRangeMm: 200}), nil, time.Millisecond)
+
+		health, ok := s.ResourceHealthOf(wrapped)
+		test.That(t, ok, test.ShouldBeTrue)
+		test.That(t, health.Name, test.ShouldResemble, camera.Named(string(s.LidarWithErroringFunctions)))
+		test.That(t, health.StartupChecks, test.ShouldResemble, []string{"Properties", "SupportsPCD"})
+		test.That(t, health.LastSuccessfulReadAt.IsZero(), test.ShouldBeTrue)
+		test.That(t, health.LastError, test.ShouldBeEmpty)
+
+		before := time.Now()
+		_, err = wrapped.TimedLidarReading(ctx)
+		test.That(t, err, test.ShouldNotBeNil)
+		refreshed, err := wrapped.(s.RefreshableLidar).Refresh(ctx, s.DependenciesResolver(deps))
+		test.That(t, err, test.ShouldBeNil)
+		health, ok = s.ResourceHealthOf(refreshed)
+		test.That(t, ok, test.ShouldBeTrue)
+		test.That(t, health.LastError, test.ShouldContainSubstring, s.InvalidSensorTestErrMsg)
+		test.That(t, health.LastErrorAt.Before(before), test.ShouldBeFalse)
+	})
+
+	t.Run("the lidar does not check for a pointcloud on startup in offline mode", func(t *testing.T) {
+		deps := s.SetupDeps(s.GoodLidar, s.NoMovementSensor)
+		lidar, err := s.NewLidar(ctx, deps, string(s.GoodLidar), 0, logger)
+		test.That(t, err, test.ShouldBeNil)
+		health, ok := s.ResourceHealthOf(lidar)
+		test.That(t, ok, test.ShouldBeTrue)
+		test.That(t, health.StartupChecks, test.ShouldResemble, []string{"Properties", "SupportsPCD"})
+
+		before := time.Now()
+		_, err = lidar.TimedLidarReading(ctx)
+		test.That(t, err, test.ShouldBeNil)
+		health, _ = s.ResourceHealthOf(lidar)
+		test.That(t, health.LastSuccessfulReadAt.Before(before), test.ShouldBeFalse)
+	})
+
+	t.Run("the movement sensor records the outcome of its reads", func(t *testing.T) {
+		deps := s.SetupDeps(s.NoLidar, s.CompassMovementSensor)
+		movementSensor, err := s.NewHeadingOnlyMovementSensor(ctx, deps, string(s.CompassMovementSensor),
+			testDataFrequencyHz, s.DegreesPerSecond, logger)
+		test.That(t, err, test.ShouldBeNil)
+		health, ok := s.ResourceHealthOf(movementSensor)
+		test.That(t, ok, test.ShouldBeTrue)
+		test.That(t, health.Name, test.ShouldResemble, movementsensor.Named(string(s.CompassMovementSensor)))
+		test.That(t, health.StartupChecks, test.ShouldResemble, []string{"Properties", "HeadingSupported"})
+
+		_, err = movementSensor.TimedMovementSensorReading(ctx)
+		test.That(t, err, test.ShouldBeNil)
+		health, _ = s.ResourceHealthOf(movementSensor)
+		test.That(t, health.LastSuccessfulReadAt.IsZero(), test.ShouldBeFalse)
+	})
+
+	t.Run("sensors that do not read from a resource report no health", func(t *testing.T) {
+		_, ok := s.ResourceHealthOf(s.Lidar{})
+		test.That(t, ok, test.ShouldBeFalse)
+		_, ok = s.ResourceHealthOf(&inject.TimedLidar{})
+		test.That(t, ok, test.ShouldBeFalse)
+		_, ok = s.ResourceHealthOf(s.NewCalibratedLidar(&inject.TimedLidar{}, nil, time.Millisecond))
+		test.That(t, ok, test.ShouldBeFalse)
+		_, ok = s.ResourceHealthOf(nil)
+		test.That(t, ok, test.ShouldBeFalse)
+	})
+}
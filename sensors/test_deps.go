@@ -26,6 +26,8 @@ const BadTime = "NOT A TIME"
 var (
 	// TestTimestamp can be used to test specific timestamps provided by a replay sensor.
 	TestTimestamp = time.Now().UTC().Format("2006-01-02T15:04:05.999999Z")
+	// TestLidarPoint is the point of the pointcloud the good lidar returns, in millimeters.
+	TestLidarPoint = r3.Vector{X: 1000}
 	// TestLinAcc is the successful mock linear acceleration result used for testing.
 	TestLinAcc = r3.Vector{X: 1, Y: 2, Z: 3}
 	// TestAngVel is the successful mock angular velocity result used for testing.
@@ -34,6 +36,27 @@ var (
 	TestPosition = geo.NewPoint(5, 4)
 	// TestOrientation is the successful mock orientation result used for testing.
 	TestOrientation = &spatialmath.Quaternion{Real: 0.1, Imag: -0.2, Jmag: 2.5, Kmag: -9.1}
+	// TestNormalizedOrientation is TestOrientation normalized into a unit quaternion, as odometer readings return it.
+	TestNormalizedOrientation = &spatialmath.Quaternion{
+		Real: TestOrientation.Real / testOrientationNorm,
+		Imag: TestOrientation.Imag / testOrientationNorm,
+		Jmag: TestOrientation.Jmag / testOrientationNorm,
+		Kmag: TestOrientation.Kmag / testOrientationNorm,
+	}
+	// TestUnitOrientation is a mock orientation result of unit length, which odometer readings return unchanged.
+	TestUnitOrientation = &spatialmath.Quaternion{Real: 0.5, Imag: -0.5, Jmag: 0.5, Kmag: -0.5}
+	// TestDenormalizedOrientation is a mock orientation result whose quaternion is not of unit length, and which is
+	// normalized into TestUnitOrientation.
+	TestDenormalizedOrientation = &spatialmath.Quaternion{Real: 1, Imag: -1, Jmag: 1, Kmag: -1}
+	// TestZeroOrientation is a mock orientation result whose quaternion cannot be normalized.
+	TestZeroOrientation = &spatialmath.Quaternion{}
+	// TestCompassHeading is the successful mock compass heading result, in degrees, used for testing.
+	TestCompassHeading = 90.0
+	// TestLinVel is the successful mock linear velocity result, in meters per second, used for testing.
+	TestLinVel = r3.Vector{X: 0.5}
+
+	testOrientationNorm = math.Sqrt(TestOrientation.Real*TestOrientation.Real + TestOrientation.Imag*TestOrientation.Imag +
+		TestOrientation.Jmag*TestOrientation.Jmag + TestOrientation.Kmag*TestOrientation.Kmag)
 )
 
 // TestSensor represents sensors used for testing.
@@ -53,6 +76,9 @@ const (
 	LidarWithErroringFunctions TestSensor = "lidar_with_erroring_functions"
 	// LidarWithInvalidProperties is a lidar whose properties are invalid.
 	LidarWithInvalidProperties TestSensor = "lidar_with_invalid_properties"
+	// ColorCamera is a camera whose properties claim PCD support but whose NextPointCloud function fails for lack of
+	// intrinsics, like a color camera configured as the lidar by mistake.
+	ColorCamera TestSensor = "color_camera"
 	// GibberishLidar is a lidar that can't be found in the dependencies.
 	GibberishLidar TestSensor = "gibberish_lidar"
 	// NoLidar is a lidar that represents that no lidar is set up or added.
@@ -94,6 +120,18 @@ const (
 	// FinishedReplayOdometer is an odometer whose Position and Orientation functions return an end of
 	// dataset error.
 	FinishedReplayOdometer TestSensor = "finished_replay_odometer"
+	// UnitOrientationOdometer is an odometer whose orientation is a unit quaternion.
+	UnitOrientationOdometer TestSensor = "unit_orientation_odometer"
+	// DenormalizedOrientationOdometer is an odometer whose orientation is not a unit quaternion.
+	DenormalizedOrientationOdometer TestSensor = "denormalized_orientation_odometer"
+	// ZeroOrientationOdometer is an odometer whose orientation is an all-zero quaternion.
+	ZeroOrientationOdometer TestSensor = "zero_orientation_odometer"
+	// OrientationOnlyMovementSensor is a movement sensor that only supports Orientation.
+	OrientationOnlyMovementSensor TestSensor = "orientation_only_movement_sensor"
+	// CompassMovementSensor is a movement sensor that only supports CompassHeading.
+	CompassMovementSensor TestSensor = "compass_movement_sensor"
+	// WheelEncoder is a movement sensor that only supports LinearVelocity and AngularVelocity.
+	WheelEncoder TestSensor = "wheel_encoder"
 
 	// ------------- IMU + ODOMETER Test Sensors ----------.
 
@@ -127,24 +165,33 @@ var (
 		WarmingUpLidar:             getWarmingUpLidar,
 		LidarWithErroringFunctions: getLidarWithErroringFunctions,
 		LidarWithInvalidProperties: getLidarWithInvalidProperties,
+		ColorCamera:                getColorCamera,
 		ReplayLidar:                func() *inject.Camera { return getReplayLidar(TestTimestamp) },
 		InvalidReplayLidar:         func() *inject.Camera { return getReplayLidar(BadTime) },
 		FinishedReplayLidar:        getFinishedReplayLidar,
 	}
 
 	testMovementSensors = map[TestSensor]func() *inject.MovementSensor{
-		GoodIMU:                              getGoodIMU,
-		IMUWithErroringFunctions:             getIMUWithErroringFunctions,
-		ReplayIMU:                            func() *inject.MovementSensor { return getReplayIMU(TestTimestamp) },
-		InvalidReplayIMU:                     func() *inject.MovementSensor { return getReplayIMU(BadTime) },
-		FinishedReplayIMU:                    getFinishedReplayIMU,
-		GoodOdometer:                         getGoodOdometer,
-		OdometerWithErroringFunctions:        getOdometerWithErroringFunctions,
-		ReplayOdometer:                       func() *inject.MovementSensor { return getReplayOdometer(TestTimestamp) },
-		InvalidReplayOdometer:                func() *inject.MovementSensor { return getReplayOdometer(BadTime) },
-		FinishedReplayOdometer:               getFinishedReplayOdometer,
-		MovementSensorNotIMUNotOdometer:      getMovementSensorNotIMUAndNotOdometer,
-		GoodMovementSensorBothIMUAndOdometer: getGoodMovementSensorBothIMUAndOdometer,
+		GoodIMU:                       getGoodIMU,
+		IMUWithErroringFunctions:      getIMUWithErroringFunctions,
+		ReplayIMU:                     func() *inject.MovementSensor { return getReplayIMU(TestTimestamp) },
+		InvalidReplayIMU:              func() *inject.MovementSensor { return getReplayIMU(BadTime) },
+		FinishedReplayIMU:             getFinishedReplayIMU,
+		GoodOdometer:                  getGoodOdometer,
+		OdometerWithErroringFunctions: getOdometerWithErroringFunctions,
+		ReplayOdometer:                func() *inject.MovementSensor { return getReplayOdometer(TestTimestamp) },
+		InvalidReplayOdometer:         func() *inject.MovementSensor { return getReplayOdometer(BadTime) },
+		FinishedReplayOdometer:        getFinishedReplayOdometer,
+		UnitOrientationOdometer:       func() *inject.MovementSensor { return getOdometerWithOrientation(TestUnitOrientation) },
+		DenormalizedOrientationOdometer: func() *inject.MovementSensor {
+			return getOdometerWithOrientation(TestDenormalizedOrientation)
+		},
+		ZeroOrientationOdometer:                               func() *inject.MovementSensor { return getOdometerWithOrientation(TestZeroOrientation) },
+		OrientationOnlyMovementSensor:                         getOrientationOnlyMovementSensor,
+		CompassMovementSensor:                                 getCompassMovementSensor,
+		WheelEncoder:                                          getWheelEncoder,
+		MovementSensorNotIMUNotOdometer:                       getMovementSensorNotIMUAndNotOdometer,
+		GoodMovementSensorBothIMUAndOdometer:                  getGoodMovementSensorBothIMUAndOdometer,
 		MovementSensorBothIMUAndOdometerWithErroringFunctions: getMovementSensorBothIMUAndOdometerWithErroringFunctions,
 		MovementSensorWithErroringPropertiesFunc:              getMovementSensorWithErroringPropertiesFunc,
 		MovementSensorWithInvalidProperties:                   getMovementSensorWithInvalidProperties,
@@ -171,7 +218,8 @@ func SetupDeps(lidarName, movementSensorName TestSensor) resource.Dependencies {
 func getGoodLidar() *inject.Camera {
 	cam := &inject.Camera{}
 	cam.NextPointCloudFunc = func(ctx context.Context) (pointcloud.PointCloud, error) {
-		return pointcloud.New(), nil
+		pc := pointcloud.New()
+		return pc, pc.Set(TestLidarPoint, pointcloud.NewBasicData())
 	}
 	cam.ProjectorFunc = func(ctx context.Context) (transform.Projector, error) {
 		return nil, transform.NewNoIntrinsicsError("")
@@ -229,6 +277,20 @@ func getLidarWithInvalidProperties() *inject.Camera {
 	return cam
 }
 
+func getColorCamera() *inject.Camera {
+	cam := &inject.Camera{}
+	cam.NextPointCloudFunc = func(ctx context.Context) (pointcloud.PointCloud, error) {
+		return nil, transform.NewNoIntrinsicsError("cannot do a projection to a point cloud")
+	}
+	cam.ProjectorFunc = func(ctx context.Context) (transform.Projector, error) {
+		return nil, transform.NewNoIntrinsicsError("")
+	}
+	cam.PropertiesFunc = func(ctx context.Context) (camera.Properties, error) {
+		return camera.Properties{SupportsPCD: true}, nil
+	}
+	return cam
+}
+
 func getReplayLidar(testTime string) *inject.Camera {
 	cam := &inject.Camera{}
 	cam.NextPointCloudFunc = func(ctx context.Context) (pointcloud.PointCloud, error) {
@@ -338,12 +400,16 @@ func getFinishedReplayIMU() *inject.MovementSensor {
 }
 
 func getGoodOdometer() *inject.MovementSensor {
+	return getOdometerWithOrientation(TestOrientation)
+}
+
+func getOdometerWithOrientation(orientation spatialmath.Orientation) *inject.MovementSensor {
 	odometer := &inject.MovementSensor{}
 	odometer.PositionFunc = func(ctx context.Context, extra map[string]interface{}) (*geo.Point, float64, error) {
 		return TestPosition, 0.0, nil
 	}
 	odometer.OrientationFunc = func(ctx context.Context, extra map[string]interface{}) (spatialmath.Orientation, error) {
-		return TestOrientation, nil
+		return orientation, nil
 	}
 	odometer.PropertiesFunc = func(ctx context.Context, extra map[string]interface{}) (*movementsensor.Properties, error) {
 		return &movementsensor.Properties{
@@ -354,6 +420,49 @@ func getGoodOdometer() *inject.MovementSensor {
 	return odometer
 }
 
+func getOrientationOnlyMovementSensor() *inject.MovementSensor {
+	movementSensor := &inject.MovementSensor{}
+	movementSensor.OrientationFunc = func(ctx context.Context, extra map[string]interface{}) (spatialmath.Orientation, error) {
+		return TestOrientation, nil
+	}
+	movementSensor.PropertiesFunc = func(ctx context.Context, extra map[string]interface{}) (*movementsensor.Properties, error) {
+		return &movementsensor.Properties{
+			OrientationSupported: true,
+		}, nil
+	}
+	return movementSensor
+}
+
+func getCompassMovementSensor() *inject.MovementSensor {
+	movementSensor := &inject.MovementSensor{}
+	movementSensor.CompassHeadingFunc = func(ctx context.Context, extra map[string]interface{}) (float64, error) {
+		return TestCompassHeading, nil
+	}
+	movementSensor.PropertiesFunc = func(ctx context.Context, extra map[string]interface{}) (*movementsensor.Properties, error) {
+		return &movementsensor.Properties{
+			CompassHeadingSupported: true,
+		}, nil
+	}
+	return movementSensor
+}
+
+func getWheelEncoder() *inject.MovementSensor {
+	movementSensor := &inject.MovementSensor{}
+	movementSensor.LinearVelocityFunc = func(ctx context.Context, extra map[string]interface{}) (r3.Vector, error) {
+		return TestLinVel, nil
+	}
+	movementSensor.AngularVelocityFunc = func(ctx context.Context, extra map[string]interface{}) (spatialmath.AngularVelocity, error) {
+		return TestAngVel, nil
+	}
+	movementSensor.PropertiesFunc = func(ctx context.Context, extra map[string]interface{}) (*movementsensor.Properties, error) {
+		return &movementsensor.Properties{
+			LinearVelocitySupported:  true,
+			AngularVelocitySupported: true,
+		}, nil
+	}
+	return movementSensor
+}
+
 func getOdometerWithErroringFunctions() *inject.MovementSensor {
 	odometer := &inject.MovementSensor{}
 	odometer.PositionFunc = func(ctx context.Context, extra map[string]interface{}) (*geo.Point, float64, error) {
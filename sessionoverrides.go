@@ -0,0 +1,74 @@
+package viamcartographer
+
+import (
+	"context"
+	"sync"
+
+	"go.viam.com/rdk/session"
+	"google.golang.org/grpc/metadata"
+)
+
+// maxSessionOverrides is the number of sessions whose override of an option is kept. Setting the override of
+// another session drops the override that was set the longest ago.
+const maxSessionOverrides = 1000
+
+// sessionID returns the ID of the session a request is made in, or "" if it is made outside of a session.
+func sessionID(ctx context.Context) string {
+	if sess, ok := session.FromContext(ctx); ok {
+		return sess.ID().String()
+	}
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if ids := md.Get(session.IDMetadataKey); len(ids) == 1 {
+			return ids[0]
+		}
+	}
+	return ""
+}
+
+// sessionOverrides holds an option of PointCloudMap that a session overrides for its own calls, by the ID of the
+// session.
+type sessionOverrides[T any] struct {
+	mu        sync.Mutex
+	overrides map[string]T
+	// order holds the IDs of the sessions of overrides from the least to the most recently set.
+	order []string
+}
+
+// get returns the override of the session id, if it has one.
+func (so *sessionOverrides[T]) get(id string) (T, bool) {
+	var override T
+	if id == "" {
+		return override, false
+	}
+	so.mu.Lock()
+	defer so.mu.Unlock()
+	override, ok := so.overrides[id]
+	return override, ok
+}
+
+// set sets the override of the session id, or clears it if override is nil.
+func (so *sessionOverrides[T]) set(id string, override *T) {
+	so.mu.Lock()
+	defer so.mu.Unlock()
+	if _, ok := so.overrides[id]; ok {
+		delete(so.overrides, id)
+		for i, orderedID := range so.order {
+			if orderedID == id {
+				so.order = append(so.order[:i], so.order[i+1:]...)
+				break
+			}
+		}
+	}
+	if override == nil {
+		return
+	}
+	if so.overrides == nil {
+		so.overrides = map[string]T{}
+	}
+	if len(so.order) >= maxSessionOverrides {
+		delete(so.overrides, so.order[0])
+		so.order = so.order[1:]
+	}
+	so.overrides[id] = *override
+	so.order = append(so.order, id)
+}
@@ -0,0 +1,44 @@
+package viamcartographer
+
+import (
+	"strconv"
+	"testing"
+
+	"go.viam.com/test"
+)
+
+func TestSessionOverrides(t *testing.T) {
+	t.Run("an override is kept per session and can be cleared", func(t *testing.T) {
+		var so sessionOverrides[int]
+		one, two := 1, 2
+		so.set("a", &one)
+		so.set("b", &two)
+
+		override, ok := so.get("a")
+		test.That(t, ok, test.ShouldBeTrue)
+		test.That(t, override, test.ShouldEqual, 1)
+		override, ok = so.get("b")
+		test.That(t, ok, test.ShouldBeTrue)
+		test.That(t, override, test.ShouldEqual, 2)
+		_, ok = so.get("")
+		test.That(t, ok, test.ShouldBeFalse)
+
+		so.set("a", nil)
+		_, ok = so.get("a")
+		test.That(t, ok, test.ShouldBeFalse)
+		test.That(t, so.order, test.ShouldResemble, []string{"b"})
+	})
+
+	t.Run("the override that was set the longest ago is dropped", func(t *testing.T) {
+		var so sessionOverrides[bool]
+		override := false
+		for i := 0; i <= maxSessionOverrides; i++ {
+			so.set(strconv.Itoa(i), &override)
+		}
+		_, ok := so.get("0")
+		test.That(t, ok, test.ShouldBeFalse)
+		_, ok = so.get(strconv.Itoa(maxSessionOverrides))
+		test.That(t, ok, test.ShouldBeTrue)
+		test.That(t, len(so.overrides), test.ShouldEqual, maxSessionOverrides)
+	})
+}
@@ -0,0 +1,118 @@
+package viamcartographer
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/golang/geo/r3"
+)
+
+const (
+	// SessionStatsKey is the key of the stats of the current session.
+	SessionStatsKey = "session_stats"
+)
+
+// sessionStats accumulates how long the current session has been mapping and how far the robot moved in it, from
+// the positions polled from cartographer. A session starts along with the sensor processes and again with every
+// new trajectory.
+type sessionStats struct {
+	// maxSpeedMmPerSec is the speed between the reading times of two consecutive positions above which the robot
+	// is considered to have been relocalized rather than to have moved, so the distance is not counted. Reading
+	// times rather than the wall clock are used so that the speed is right however fast the readings are added,
+	// as in offline mode.
+	maxSpeedMmPerSec float64
+
+	mu              sync.Mutex
+	startedAt       time.Time
+	distanceMm      float64
+	numPoseJumps    int
+	lastPosition    r3.Vector
+	lastReadingTime time.Time
+	hasLastPosition bool
+}
+
+// newSessionStats returns session stats for a session that started at startedAt.
+func newSessionStats(startedAt time.Time, maxSpeedMmPerSec float64) *sessionStats {
+	return &sessionStats{maxSpeedMmPerSec: maxSpeedMmPerSec, startedAt: startedAt}
+}
+
+// addPosition adds the distance from the last position to position, which cartographer localized the lidar reading
+// taken at readingTime at, to the distance traveled, unless it is a jump. The position is ignored if there was no
+// new lidar reading since the last one, as the robot cannot have been seen to move.
+func (stats *sessionStats) addPosition(position r3.Vector, readingTime time.Time) {
+	stats.mu.Lock()
+	defer stats.mu.Unlock()
+	if stats.hasLastPosition {
+		if !readingTime.After(stats.lastReadingTime) {
+			return
+		}
+		delta := position.Sub(stats.lastPosition).Norm()
+		if delta > stats.maxSpeedMmPerSec*readingTime.Sub(stats.lastReadingTime).Seconds() {
+			stats.numPoseJumps++
+		} else {
+			stats.distanceMm += delta
+		}
+	}
+	stats.lastPosition = position
+	stats.lastReadingTime = readingTime
+	stats.hasLastPosition = true
+}
+
+// reset starts a new session at startedAt.
+func (stats *sessionStats) reset(startedAt time.Time) {
+	stats.mu.Lock()
+	defer stats.mu.Unlock()
+	stats.startedAt = startedAt
+	stats.distanceMm = 0
+	stats.numPoseJumps = 0
+	stats.hasLastPosition = false
+}
+
+// toMap returns the session stats as of now for DoCommand responses.
+func (stats *sessionStats) toMap(now time.Time) map[string]interface{} {
+	stats.mu.Lock()
+	defer stats.mu.Unlock()
+	return map[string]interface{}{
+		"started_at":           stats.startedAt.UTC().Format(time.RFC3339Nano),
+		"elapsed_sec":          now.Sub(stats.startedAt).Seconds(),
+		"distance_traveled_mm": stats.distanceMm,
+		"num_pose_jumps":       stats.numPoseJumps,
+	}
+}
+
+// startSessionStatsMonitor polls the position from cartographer every sessionStatsPollInterval until ctx is done
+// and adds it to the session stats, along with the reading time of the last lidar reading. Its match confidence tells whether the localization is lost. It is also
+// published to the pose subscriptions.
+func startSessionStatsMonitor(ctx context.Context, cartoSvc *CartographerService) {
+	cartoSvc.goWorker("session_stats_monitor", func(w *worker) {
+		ticker := time.NewTicker(sessionStatsPollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			w.heartbeat()
+			if cartoSvc.cartofacade.Unresponsive() {
+				// the request would wait on the hung call
+				continue
+			}
+			pos, err := cartoSvc.cartofacade.Position(ctx, cartoSvc.cartoFacadeTimeout)
+			if err != nil {
+				cartoSvc.logger.Debugw("could not get the position for the session stats", "error", err)
+				continue
+			}
+			now := time.Now()
+			// the position is that of the last lidar reading cartographer localized
+			poseTime := now
+			if readingTime := cartoSvc.sensorStats.LastLidarReadingTime(); !readingTime.IsZero() {
+				cartoSvc.sessionStats.addPosition(r3.Vector{X: pos.X, Y: pos.Y, Z: pos.Z}, readingTime)
+				poseTime = readingTime
+			}
+			cartoSvc.checkLocalization(pos, now)
+			cartoSvc.poseSubscriptions.PublishPose(pos, poseTime, now)
+		}
+	})
+}
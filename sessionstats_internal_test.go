@@ -0,0 +1,99 @@
+package viamcartographer
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang/geo/r3"
+	"go.viam.com/rdk/logging"
+	"go.viam.com/test"
+
+	"github.com/viam-modules/viam-cartographer/cartofacade"
+)
+
+func TestSessionStats(t *testing.T) {
+	startedAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	stats := newSessionStats(startedAt, 2000)
+
+	t.Run("jumps are excluded from the distance traveled", func(t *testing.T) {
+		for _, position := range []struct {
+			position    r3.Vector
+			readingTime time.Duration
+		}{
+			{r3.Vector{X: 0, Y: 0}, 0},
+			{r3.Vector{X: 300, Y: 400}, 300 * time.Millisecond},
+			// faster than 1 m/s, but the readings are a second apart
+			{r3.Vector{X: 1200, Y: 1600}, 1300 * time.Millisecond},
+			// no new lidar reading, so the position is ignored
+			{r3.Vector{X: 1500, Y: 1600}, 1300 * time.Millisecond},
+			// relocalization snap
+			{r3.Vector{X: 10000, Y: 1600}, 1500 * time.Millisecond},
+			{r3.Vector{X: 10000, Y: 1900}, 1700 * time.Millisecond},
+		} {
+			stats.addPosition(position.position, startedAt.Add(position.readingTime))
+		}
+		test.That(t, stats.toMap(startedAt.Add(90*time.Second)), test.ShouldResemble, map[string]interface{}{
+			"started_at":           "2024-01-02T03:04:05Z",
+			"elapsed_sec":          90.0,
+			"distance_traveled_mm": 2300.0,
+			"num_pose_jumps":       1,
+		})
+	})
+
+	t.Run("the speed is computed from the reading times rather than the wall clock", func(t *testing.T) {
+		// offline, a dataset is added far faster than it was recorded
+		offlineStats := newSessionStats(startedAt, 2000)
+		for i := 0; i < 10; i++ {
+			offlineStats.addPosition(r3.Vector{X: float64(i) * 1500}, startedAt.Add(time.Duration(i)*time.Second))
+		}
+		sessionStats := offlineStats.toMap(startedAt.Add(time.Second))
+		test.That(t, sessionStats["distance_traveled_mm"], test.ShouldEqual, 13500.0)
+		test.That(t, sessionStats["num_pose_jumps"], test.ShouldEqual, 0)
+	})
+
+	mockCartoFacade := &cartofacade.Mock{}
+	mockCartoFacade.UnresponsiveFunc = func() bool { return false }
+	mockCartoFacade.TrajectoriesFunc = func(ctx context.Context, timeout time.Duration) ([]cartofacade.Trajectory, error) {
+		return []cartofacade.Trajectory{{ID: 0, State: cartofacade.TrajectoryActive}}, nil
+	}
+	mockCartoFacade.StartNewTrajectoryFunc = func(
+		ctx context.Context,
+		timeout time.Duration,
+		initialPose *cartofacade.TrajectoryPose,
+	) (cartofacade.NewTrajectory, error) {
+		return cartofacade.NewTrajectory{FinishedTrajectoryID: 0, TrajectoryID: 1}, nil
+	}
+	svc := newTestService(mockCartoFacade, logging.NewTestLogger(t))
+	svc.cartoLib = &cartofacade.CartoLibMock{LogLevelFunc: func() (int, int) { return 1, 0 }}
+	svc.cartoFacadeTimeout = 5 * time.Second
+	svc.sessionStats = stats
+
+	t.Run("status and job_done include the session stats", func(t *testing.T) {
+		for _, cmd := range []string{StatusCommand, JobDoneCommand} {
+			resp, err := svc.DoCommand(context.Background(), map[string]interface{}{cmd: ""})
+			test.That(t, err, test.ShouldBeNil)
+			sessionStats, ok := resp[SessionStatsKey].(map[string]interface{})
+			test.That(t, ok, test.ShouldBeTrue)
+			test.That(t, sessionStats["distance_traveled_mm"], test.ShouldEqual, 2300.0)
+			test.That(t, sessionStats["started_at"], test.ShouldEqual, "2024-01-02T03:04:05Z")
+		}
+	})
+
+	t.Run("a new trajectory starts a new session", func(t *testing.T) {
+		_, err := svc.DoCommand(context.Background(), map[string]interface{}{StartNewTrajectoryCommand: nil})
+		test.That(t, err, test.ShouldBeNil)
+		sessionStats := stats.toMap(time.Now())
+		test.That(t, sessionStats["distance_traveled_mm"], test.ShouldEqual, 0.0)
+		test.That(t, sessionStats["num_pose_jumps"], test.ShouldEqual, 0)
+		test.That(t, sessionStats["elapsed_sec"], test.ShouldBeLessThan, 60)
+
+		// the first position of the new session is not compared to the last one of the previous session
+		now := time.Now()
+		stats.addPosition(r3.Vector{X: 0, Y: 0}, now)
+		stats.addPosition(r3.Vector{X: 0, Y: 500}, now.Add(time.Second))
+		sessionStats = stats.toMap(time.Now())
+		test.That(t, sessionStats["distance_traveled_mm"], test.ShouldEqual, 500.0)
+		test.That(t, sessionStats["num_pose_jumps"], test.ShouldEqual, 0)
+	})
+}
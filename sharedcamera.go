@@ -0,0 +1,76 @@
+package viamcartographer
+
+import (
+	"sync"
+
+	"go.viam.com/rdk/resource"
+)
+
+const (
+	// SharedCameraKey denotes whether another service of the module reads one of the cameras.
+	SharedCameraKey = "shared_camera"
+)
+
+// cameraClaims holds the cameras read by the cartographer services of the module. A camera serializes its
+// NextPointCloud calls, so two services reading the same camera each get about half of its frame rate.
+var cameraClaims = &cameraRegistry{claims: map[resource.Name][]*CartographerService{}}
+
+// cameraRegistry maps the resource name of a camera to the services that read it, in the order they claimed it.
+type cameraRegistry struct {
+	mu     sync.Mutex
+	claims map[resource.Name][]*CartographerService
+}
+
+// claim records that cartoSvc reads the camera named name. If another service reads it already, every service
+// reading it is flagged as sharing a camera and warns.
+func (registry *cameraRegistry) claim(cartoSvc *CartographerService, name resource.Name) {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	others := registry.claims[name]
+	registry.claims[name] = append(others, cartoSvc)
+	if len(others) == 0 {
+		return
+	}
+
+	otherNames := make([]string, 0, len(others))
+	for _, other := range others {
+		otherNames = append(otherNames, other.Name().String())
+		other.sharedCamera.Store(true)
+		other.logger.Warnw("another slam service now reads the same camera, each of them only gets part of its "+
+			"frame rate", "camera", name.String(), "slam_service", cartoSvc.Name().String())
+	}
+	cartoSvc.sharedCamera.Store(true)
+	cartoSvc.logger.Warnw("other slam services already read the same camera, each of them only gets part of its "+
+		"frame rate", "camera", name.String(), "slam_services", otherNames)
+}
+
+// release removes the claims of cartoSvc and clears the shared camera flag of the services that no longer share a
+// camera. It is a no-op if cartoSvc claimed no camera.
+func (registry *cameraRegistry) release(cartoSvc *CartographerService) {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	for name, claimants := range registry.claims {
+		remaining := make([]*CartographerService, 0, len(claimants))
+		for _, claimant := range claimants {
+			if claimant != cartoSvc {
+				remaining = append(remaining, claimant)
+			}
+		}
+		if len(remaining) == 0 {
+			delete(registry.claims, name)
+			continue
+		}
+		registry.claims[name] = remaining
+	}
+	cartoSvc.sharedCamera.Store(false)
+
+	stillShared := map[*CartographerService]bool{}
+	for _, claimants := range registry.claims {
+		for _, claimant := range claimants {
+			stillShared[claimant] = stillShared[claimant] || len(claimants) > 1
+		}
+	}
+	for claimant, shared := range stillShared {
+		claimant.sharedCamera.Store(shared)
+	}
+}
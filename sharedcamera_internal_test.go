@@ -0,0 +1,66 @@
+package viamcartographer
+
+import (
+	"testing"
+
+	"go.uber.org/zap/zaptest/observer"
+	"go.viam.com/rdk/components/camera"
+	"go.viam.com/rdk/logging"
+	"go.viam.com/rdk/resource"
+	"go.viam.com/rdk/services/slam"
+	"go.viam.com/test"
+)
+
+func TestCameraClaims(t *testing.T) {
+	registry := &cameraRegistry{claims: map[resource.Name][]*CartographerService{}}
+	newService := func(name string) (*CartographerService, *observer.ObservedLogs) {
+		logger, obs := logging.NewObservedTestLogger(t)
+		return &CartographerService{Named: resource.NewName(slam.API, name).AsNamed(), logger: logger}, obs
+	}
+	lidar := camera.Named("lidar")
+	otherLidar := camera.Named("other_lidar")
+
+	t.Run("both services that read the same camera are flagged and warn", func(t *testing.T) {
+		first, firstObs := newService("first")
+		second, secondObs := newService("second")
+		registry.claim(first, lidar)
+		test.That(t, first.sharedCamera.Load(), test.ShouldBeFalse)
+		test.That(t, firstObs.FilterMessageSnippet("same camera").Len(), test.ShouldEqual, 0)
+
+		registry.claim(second, lidar)
+		test.That(t, first.sharedCamera.Load(), test.ShouldBeTrue)
+		test.That(t, second.sharedCamera.Load(), test.ShouldBeTrue)
+		test.That(t, firstObs.FilterMessageSnippet("another slam service now reads the same camera").Len(),
+			test.ShouldEqual, 1)
+		test.That(t, secondObs.FilterMessageSnippet("other slam services already read the same camera").Len(),
+			test.ShouldEqual, 1)
+
+		registry.release(second)
+		test.That(t, first.sharedCamera.Load(), test.ShouldBeFalse)
+		test.That(t, second.sharedCamera.Load(), test.ShouldBeFalse)
+		registry.release(first)
+		test.That(t, registry.claims, test.ShouldBeEmpty)
+	})
+
+	t.Run("a service stays flagged while it shares any of its cameras", func(t *testing.T) {
+		first, _ := newService("first")
+		second, _ := newService("second")
+		third, _ := newService("third")
+		registry.claim(first, lidar)
+		registry.claim(first, otherLidar)
+		registry.claim(second, lidar)
+		registry.claim(third, otherLidar)
+
+		registry.release(second)
+		test.That(t, first.sharedCamera.Load(), test.ShouldBeTrue)
+		test.That(t, third.sharedCamera.Load(), test.ShouldBeTrue)
+		registry.release(third)
+		test.That(t, first.sharedCamera.Load(), test.ShouldBeFalse)
+		test.That(t, registry.claims, test.ShouldHaveLength, 2)
+
+		// releasing a service that claimed no camera is a no-op
+		registry.release(third)
+		registry.release(first)
+		test.That(t, registry.claims, test.ShouldBeEmpty)
+	})
+}
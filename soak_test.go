@@ -0,0 +1,262 @@
+//go:build soak
+
+package viamcartographer_test
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"testing"
+	"time"
+
+	"go.viam.com/rdk/logging"
+	"go.viam.com/rdk/services/slam"
+	"go.viam.com/test"
+	"go.viam.com/utils/artifact"
+
+	viamcartographer "github.com/viam-modules/viam-cartographer"
+	vcConfig "github.com/viam-modules/viam-cartographer/config"
+	"github.com/viam-modules/viam-cartographer/sensors"
+	"github.com/viam-modules/viam-cartographer/testhelper"
+)
+
+// The settings of the soak test, read from environment variables. Durations are in the format of
+// time.ParseDuration, growth rates in megabytes per hour.
+const (
+	// soakDurationEnvVar is how long readings are ingested for.
+	soakDurationEnvVar = "SOAK_DURATION"
+	// soakWarmupEnvVar is how long the memory usage is left out of the growth rates after the start, while the
+	// submaps of the existing map are loaded and the caches of cartographer fill up.
+	soakWarmupEnvVar = "SOAK_WARMUP"
+	// soakSampleIntervalEnvVar is how often the memory usage is sampled.
+	soakSampleIntervalEnvVar = "SOAK_SAMPLE_INTERVAL"
+	// soakMaxGoHeapGrowthEnvVar is the growth rate of the go heap above which the soak test fails.
+	soakMaxGoHeapGrowthEnvVar = "SOAK_MAX_GO_HEAP_GROWTH_MB_PER_HOUR"
+	// soakMaxCartographerGrowthEnvVar is the growth rate of the memory allocated by cartographer above which the
+	// soak test fails.
+	soakMaxCartographerGrowthEnvVar = "SOAK_MAX_CARTOGRAPHER_GROWTH_MB_PER_HOUR"
+	// soakCSVEnvVar is the path the samples are written to as a CSV.
+	soakCSVEnvVar = "SOAK_CSV"
+
+	defaultSoakDuration              = time.Hour
+	defaultSoakWarmup                = 10 * time.Minute
+	defaultSoakSampleInterval        = 30 * time.Second
+	defaultSoakMaxGoHeapGrowth       = 16.0
+	defaultSoakMaxCartographerGrowth = 64.0
+
+	soakMockDataPath     = "viam-cartographer/mock_data"
+	soakExistingMapPath  = "viam-cartographer/outputs/viam-office-02-22-3/internal_state/internal_state_0.pbstream"
+	soakLidarHz          = 5
+	soakMovementSensorHz = 20
+)
+
+// soakSample is the memory usage of the process at elapsed since the start of the soak test.
+type soakSample struct {
+	elapsed                    time.Duration
+	goHeapAllocBytes           uint64
+	numGoroutines              int
+	cartographerAllocatedBytes uint64
+	cartographerAvailable      bool
+}
+
+// TestSoak ingests the mock dataset, looped over, through the cartofacade in online mode for hours to catch
+// memory that leaks across the cgo boundary. It localizes against the map of the mock dataset, so that the
+// memory usage levels off once the submaps are loaded, and fails if the go heap or the memory allocated by
+// cartographer keep growing faster than allowed after the warmup. Run it with
+//
+//	go test -tags soak -run TestSoak -timeout 0 -v .
+//
+// or make test-soak, setting the SOAK_ environment variables to change its settings.
+func TestSoak(t *testing.T) {
+	duration := soakDurationSetting(t, soakDurationEnvVar, defaultSoakDuration)
+	warmup := soakDurationSetting(t, soakWarmupEnvVar, defaultSoakWarmup)
+	sampleInterval := soakDurationSetting(t, soakSampleIntervalEnvVar, defaultSoakSampleInterval)
+	maxGoHeapGrowth := soakFloatSetting(t, soakMaxGoHeapGrowthEnvVar, defaultSoakMaxGoHeapGrowth)
+	maxCartographerGrowth := soakFloatSetting(t, soakMaxCartographerGrowthEnvVar, defaultSoakMaxCartographerGrowth)
+	csvPath := os.Getenv(soakCSVEnvVar)
+	if csvPath == "" {
+		csvPath = filepath.Join(os.TempDir(), "viam-cartographer-soak-"+time.Now().UTC().Format("20060102T150405Z")+".csv")
+	}
+	test.That(t, warmup, test.ShouldBeLessThan, duration)
+
+	// hours of debug logs would be kept by a test logger, which shows up in the go heap
+	logger := logging.NewLogger("soak")
+	logger.SetLevel(logging.WARN)
+	termFunc := testhelper.InitTestCL(t, logger)
+	defer termFunc()
+
+	// online pacing: the readings are polled at the data frequency and are as far apart as its period
+	start := time.Now()
+	datasetDir := artifact.MustPath(soakMockDataPath)
+	lidar, err := sensors.NewDatasetLidar(datasetDir, sensors.DatasetReplayConfig{
+		Name:            string(testhelper.LidarWithErroringFunctions),
+		DataFrequencyHz: soakLidarHz,
+		Start:           start,
+		Interval:        time.Second / soakLidarHz,
+		Loop:            true,
+	})
+	test.That(t, err, test.ShouldBeNil)
+	movementSensor, err := sensors.NewDatasetMovementSensor(datasetDir, sensors.DatasetReplayConfig{
+		Name:            string(testhelper.MovementSensorWithErroringFunctions),
+		DataFrequencyHz: soakMovementSensorHz,
+		Start:           start,
+		Interval:        time.Second / soakMovementSensorHz,
+		Loop:            true,
+	}, sensors.MovementSensorProperties{IMUSupported: true})
+	test.That(t, err, test.ShouldBeNil)
+
+	enableMapping := false
+	attrCfg := &vcConfig.Config{
+		Camera: map[string]string{
+			"name":              string(testhelper.LidarWithErroringFunctions),
+			"data_frequency_hz": strconv.Itoa(soakLidarHz),
+		},
+		MovementSensor: map[string]string{
+			"name":              string(testhelper.MovementSensorWithErroringFunctions),
+			"data_frequency_hz": strconv.Itoa(soakMovementSensorHz),
+		},
+		ExistingMap:   artifact.MustPath(soakExistingMapPath),
+		EnableMapping: &enableMapping,
+		ConfigParams:  map[string]string{"mode": string(viamcartographer.Dim2d)},
+	}
+	svc, err := testhelper.CreateIntegrationSLAMService(t, attrCfg, lidar, movementSensor, logger)
+	test.That(t, err, test.ShouldBeNil)
+	defer func() {
+		test.That(t, svc.Close(context.Background()), test.ShouldBeNil)
+	}()
+
+	var samples []soakSample
+	ticker := time.NewTicker(sampleInterval)
+	defer ticker.Stop()
+	for elapsed := time.Duration(0); elapsed < duration; elapsed = time.Since(start) {
+		<-ticker.C
+		_, err := svc.Position(context.Background())
+		test.That(t, err, test.ShouldBeNil)
+		sample := sampleSoakMemory(t, svc, time.Since(start))
+		samples = append(samples, sample)
+		t.Logf("%s: go heap %d bytes, cartographer %d bytes, %d goroutines", sample.elapsed.Round(time.Second),
+			sample.goHeapAllocBytes, sample.cartographerAllocatedBytes, sample.numGoroutines)
+	}
+
+	writeSoakCSV(t, csvPath, samples)
+	t.Logf("wrote %d samples to %s", len(samples), csvPath)
+
+	var warmSamples []soakSample
+	for _, sample := range samples {
+		if sample.elapsed >= warmup {
+			warmSamples = append(warmSamples, sample)
+		}
+	}
+	test.That(t, len(warmSamples), test.ShouldBeGreaterThanOrEqualTo, 2)
+
+	goHeapGrowth := soakGrowthMBPerHour(warmSamples, func(sample soakSample) uint64 { return sample.goHeapAllocBytes })
+	t.Logf("go heap grows by %.2f MB/h after the warmup, at most %.2f MB/h are allowed", goHeapGrowth, maxGoHeapGrowth)
+	test.That(t, goHeapGrowth, test.ShouldBeLessThanOrEqualTo, maxGoHeapGrowth)
+
+	if !warmSamples[0].cartographerAvailable {
+		t.Log("the memory allocated by cartographer is not available on this platform, only the go heap was checked")
+		return
+	}
+	cartographerGrowth := soakGrowthMBPerHour(warmSamples,
+		func(sample soakSample) uint64 { return sample.cartographerAllocatedBytes })
+	t.Logf("cartographer grows by %.2f MB/h after the warmup, at most %.2f MB/h are allowed",
+		cartographerGrowth, maxCartographerGrowth)
+	test.That(t, cartographerGrowth, test.ShouldBeLessThanOrEqualTo, maxCartographerGrowth)
+}
+
+// sampleSoakMemory returns the memory usage of the go heap after a garbage collection, so that only live objects
+// are counted, and that of cartographer as reported in the sensor_metrics response.
+func sampleSoakMemory(t *testing.T, svc slam.Service, elapsed time.Duration) soakSample {
+	t.Helper()
+	runtime.GC()
+	var memStats runtime.MemStats
+	runtime.ReadMemStats(&memStats)
+	sample := soakSample{
+		elapsed:          elapsed,
+		goHeapAllocBytes: memStats.HeapAlloc,
+		numGoroutines:    runtime.NumGoroutine(),
+	}
+
+	resp, err := svc.DoCommand(context.Background(), map[string]interface{}{viamcartographer.SensorMetricsCommand: nil})
+	test.That(t, err, test.ShouldBeNil)
+	memory, ok := resp[viamcartographer.MemoryKey].(map[string]interface{})
+	test.That(t, ok, test.ShouldBeTrue)
+	if allocatedBytes, ok := memory["cartographer_allocated_bytes"].(uint64); ok {
+		sample.cartographerAllocatedBytes = allocatedBytes
+		sample.cartographerAvailable = true
+	}
+	return sample
+}
+
+// soakGrowthMBPerHour returns the slope of the least squares fit of the values of samples over their elapsed time
+// in megabytes per hour.
+func soakGrowthMBPerHour(samples []soakSample, value func(soakSample) uint64) float64 {
+	var sumX, sumY, sumXX, sumXY float64
+	for _, sample := range samples {
+		x := sample.elapsed.Hours()
+		y := float64(value(sample)) / 1e6
+		sumX += x
+		sumY += y
+		sumXX += x * x
+		sumXY += x * y
+	}
+	n := float64(len(samples))
+	return (n*sumXY - sumX*sumY) / (n*sumXX - sumX*sumX)
+}
+
+// writeSoakCSV writes samples to path as a CSV, for inspection of how the memory usage developed.
+func writeSoakCSV(t *testing.T, path string, samples []soakSample) {
+	t.Helper()
+	file, err := os.Create(path)
+	test.That(t, err, test.ShouldBeNil)
+	defer func() {
+		test.That(t, file.Close(), test.ShouldBeNil)
+	}()
+	w := csv.NewWriter(file)
+	test.That(t, w.Write([]string{
+		"elapsed_sec", "go_heap_alloc_bytes", "num_goroutines", "cartographer_allocated_bytes",
+	}), test.ShouldBeNil)
+	for _, sample := range samples {
+		cartographerAllocatedBytes := ""
+		if sample.cartographerAvailable {
+			cartographerAllocatedBytes = strconv.FormatUint(sample.cartographerAllocatedBytes, 10)
+		}
+		test.That(t, w.Write([]string{
+			fmt.Sprintf("%.0f", sample.elapsed.Seconds()),
+			strconv.FormatUint(sample.goHeapAllocBytes, 10),
+			strconv.Itoa(sample.numGoroutines),
+			cartographerAllocatedBytes,
+		}), test.ShouldBeNil)
+	}
+	w.Flush()
+	test.That(t, w.Error(), test.ShouldBeNil)
+}
+
+// soakDurationSetting returns the duration set by the environment variable name, or defaultValue if it is not set.
+func soakDurationSetting(t *testing.T, name string, defaultValue time.Duration) time.Duration {
+	t.Helper()
+	val := os.Getenv(name)
+	if val == "" {
+		return defaultValue
+	}
+	duration, err := time.ParseDuration(val)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, duration, test.ShouldBeGreaterThan, 0)
+	return duration
+}
+
+// soakFloatSetting returns the number set by the environment variable name, or defaultValue if it is not set.
+func soakFloatSetting(t *testing.T, name string, defaultValue float64) float64 {
+	t.Helper()
+	val := os.Getenv(name)
+	if val == "" {
+		return defaultValue
+	}
+	f, err := strconv.ParseFloat(val, 64)
+	test.That(t, err, test.ShouldBeNil)
+	return f
+}
@@ -0,0 +1,104 @@
+package viamcartographer
+
+import (
+	"context"
+	"encoding/base64"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/viam-modules/viam-cartographer/cartofacade"
+)
+
+const (
+	// submapPointCloudChunkSizeBytes keeps each base64 encoded response within the chunk size.
+	submapPointCloudChunkSizeBytes = chunkSizeBytes / 4 * 3
+	// SubmapListCommand is sent to DoCommand to list the submaps of the pose graph.
+	SubmapListCommand = "submap_list"
+	// GetSubmapCommand is sent to DoCommand to get the pointcloud of a single submap.
+	GetSubmapCommand = "get_submap"
+)
+
+// submapRequest is the value of get_submap.
+type submapRequest struct {
+	TrajectoryID *int `json:"trajectory_id"`
+	SubmapIndex  *int `json:"submap_index"`
+	// Chunk is the index of the chunk of the pointcloud of the submap to return.
+	Chunk int `json:"chunk"`
+	// Version, if set, is the version of the submap the chunks requested before were from, so that a client does
+	// not stitch together chunks of different versions of a submap that is still being inserted into.
+	Version *int `json:"version"`
+}
+
+// submapCache keeps the pointcloud of the submap get_submap painted last, so that the chunks of the same version
+// of a submap are cut from a single painting of it. It is safe for concurrent use.
+type submapCache struct {
+	mu     sync.Mutex
+	submap *cartofacade.SubmapPointCloud
+}
+
+// submapPointCloud returns the submap of id with its pointcloud, which is only painted again if the version of the
+// submap changed since it was last painted.
+func (cache *submapCache) submapPointCloud(
+	ctx context.Context,
+	cf cartofacade.Interface,
+	timeout time.Duration,
+	id cartofacade.SubmapID,
+) (cartofacade.SubmapPointCloud, error) {
+	submaps, err := cf.SubmapList(ctx, timeout)
+	if err != nil {
+		return cartofacade.SubmapPointCloud{}, err
+	}
+	version := -1
+	for _, submap := range submaps {
+		if submap.ID == id {
+			version = submap.Version
+		}
+	}
+	if version < 0 {
+		return cartofacade.SubmapPointCloud{}, cartofacade.ErrSubmapNotFound
+	}
+
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	if cache.submap != nil && cache.submap.ID == id && cache.submap.Version == version {
+		return *cache.submap, nil
+	}
+	submap, err := cf.Submap(ctx, timeout, id)
+	if err != nil {
+		return cartofacade.SubmapPointCloud{}, err
+	}
+	cache.submap = &submap
+	return submap, nil
+}
+
+// submapToMap converts a submap into its submap_list format.
+func submapToMap(submap cartofacade.Submap) map[string]interface{} {
+	point := submap.Pose.Point()
+	orientation := submap.Pose.Orientation().OrientationVectorDegrees()
+	return map[string]interface{}{
+		"trajectory_id": submap.ID.TrajectoryID,
+		"submap_index":  submap.ID.SubmapIndex,
+		"version":       submap.Version,
+		"x":             point.X,
+		"y":             point.Y,
+		"z":             point.Z,
+		"o_x":           orientation.OX,
+		"o_y":           orientation.OY,
+		"o_z":           orientation.OZ,
+		"theta":         orientation.Theta,
+	}
+}
+
+// submapPointCloudChunk returns the chunk of index i of the pointcloud of a submap, base64 encoded, and the number
+// of chunks. There is always at least one chunk, which is empty if the pointcloud is.
+func submapPointCloudChunk(pcd []byte, i int) (string, int, error) {
+	numChunks := max(1, (len(pcd)+submapPointCloudChunkSizeBytes-1)/submapPointCloudChunkSizeBytes)
+	if i >= numChunks {
+		return "", 0, errors.Wrapf(ErrSubmapChunkOutOfRange, "chunk %d requested, the submap has %d chunks", i, numChunks)
+	}
+	start := i * submapPointCloudChunkSizeBytes
+	end := min(start+submapPointCloudChunkSizeBytes, len(pcd))
+	return base64.StdEncoding.EncodeToString(pcd[start:end]), numChunks, nil
+}
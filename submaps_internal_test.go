@@ -0,0 +1,197 @@
+package viamcartographer
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"testing"
+	"time"
+
+	"github.com/golang/geo/r3"
+	"github.com/pkg/errors"
+	"go.viam.com/rdk/logging"
+	"go.viam.com/rdk/spatialmath"
+	"go.viam.com/test"
+
+	"github.com/viam-modules/viam-cartographer/cartofacade"
+)
+
+func TestSubmapCommands(t *testing.T) {
+	submaps := []cartofacade.Submap{
+		{ID: cartofacade.SubmapID{TrajectoryID: 0, SubmapIndex: 0}, Version: 180,
+			Pose: spatialmath.NewPoseFromPoint(r3.Vector{X: 100, Y: 200})},
+		{ID: cartofacade.SubmapID{TrajectoryID: 0, SubmapIndex: 1}, Version: 42, Pose: spatialmath.NewPose(
+			r3.Vector{X: -100}, &spatialmath.OrientationVectorDegrees{OZ: 1, Theta: 90})},
+	}
+	var pcd []byte
+	var submapErr error
+	var requested cartofacade.SubmapID
+	var numPainted int
+	mockCartoFacade := &cartofacade.Mock{}
+	mockCartoFacade.SubmapListFunc = func(ctx context.Context, timeout time.Duration) ([]cartofacade.Submap, error) {
+		return submaps, submapErr
+	}
+	mockCartoFacade.SubmapFunc = func(
+		ctx context.Context,
+		timeout time.Duration,
+		id cartofacade.SubmapID,
+	) (cartofacade.SubmapPointCloud, error) {
+		requested = id
+		numPainted++
+		for _, submap := range submaps {
+			if submap.ID == id {
+				return cartofacade.SubmapPointCloud{Submap: submap, PointCloud: pcd}, submapErr
+			}
+		}
+		return cartofacade.SubmapPointCloud{}, cartofacade.ErrSubmapNotFound
+	}
+	svc := newTestService(mockCartoFacade, logging.NewTestLogger(t))
+	getSubmap := func(val interface{}) map[string]interface{} {
+		resp, err := svc.DoCommand(context.Background(), map[string]interface{}{GetSubmapCommand: val})
+		test.That(t, err, test.ShouldBeNil)
+		return resp
+	}
+
+	t.Run("submap_list returns the id, version and pose of every submap", func(t *testing.T) {
+		resp, err := svc.DoCommand(context.Background(), map[string]interface{}{SubmapListCommand: nil})
+		test.That(t, err, test.ShouldBeNil)
+		list := resp[SubmapListCommand].([]interface{})
+		test.That(t, len(list), test.ShouldEqual, 2)
+
+		first := list[0].(map[string]interface{})
+		test.That(t, first["trajectory_id"], test.ShouldEqual, 0)
+		test.That(t, first["submap_index"], test.ShouldEqual, 0)
+		test.That(t, first["version"], test.ShouldEqual, 180)
+		test.That(t, first["x"], test.ShouldEqual, 100)
+		test.That(t, first["y"], test.ShouldEqual, 200)
+		test.That(t, first["o_z"], test.ShouldEqual, 1)
+
+		second := list[1].(map[string]interface{})
+		test.That(t, second["submap_index"], test.ShouldEqual, 1)
+		test.That(t, second["version"], test.ShouldEqual, 42)
+		test.That(t, second["x"], test.ShouldEqual, -100)
+		test.That(t, second["theta"], test.ShouldAlmostEqual, 90)
+	})
+
+	t.Run("get_submap returns the pointcloud of the submap", func(t *testing.T) {
+		pcd = []byte("VERSION .7\nPOINTS 0\nDATA binary\n")
+		resp := getSubmap(map[string]interface{}{"trajectory_id": 0, "submap_index": 1})
+		test.That(t, requested, test.ShouldResemble, cartofacade.SubmapID{TrajectoryID: 0, SubmapIndex: 1})
+		test.That(t, resp["chunk"], test.ShouldEqual, 0)
+		test.That(t, resp["num_chunks"], test.ShouldEqual, 1)
+		test.That(t, resp["submap_index"], test.ShouldEqual, 1)
+		test.That(t, resp["version"], test.ShouldEqual, 42)
+		decoded, err := base64.StdEncoding.DecodeString(resp[GetSubmapCommand].(string))
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, decoded, test.ShouldResemble, pcd)
+	})
+
+	t.Run("get_submap returns a single empty chunk for an empty pointcloud", func(t *testing.T) {
+		pcd = nil
+		resp := getSubmap(map[string]interface{}{"trajectory_id": 0, "submap_index": 0})
+		test.That(t, resp["num_chunks"], test.ShouldEqual, 1)
+		test.That(t, resp[GetSubmapCommand], test.ShouldEqual, "")
+	})
+
+	t.Run("get_submap returns large pointclouds in chunks", func(t *testing.T) {
+		pcd = bytes.Repeat([]byte{1, 2, 3}, submapPointCloudChunkSizeBytes/3+1)
+		submaps[0].Version++
+		numPainted = 0
+		resp := getSubmap(map[string]interface{}{"trajectory_id": 0, "submap_index": 0})
+		test.That(t, resp["num_chunks"], test.ShouldEqual, 2)
+		first, err := base64.StdEncoding.DecodeString(resp[GetSubmapCommand].(string))
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, len(first), test.ShouldEqual, submapPointCloudChunkSizeBytes)
+		test.That(t, len(resp[GetSubmapCommand].(string)), test.ShouldBeLessThanOrEqualTo, chunkSizeBytes)
+
+		resp = getSubmap(map[string]interface{}{"trajectory_id": 0, "submap_index": 0, "chunk": 1, "version": 181})
+		test.That(t, resp["chunk"], test.ShouldEqual, 1)
+		second, err := base64.StdEncoding.DecodeString(resp[GetSubmapCommand].(string))
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, append(first, second...), test.ShouldResemble, pcd)
+		// the chunks are cut from a single painting of the submap
+		test.That(t, numPainted, test.ShouldEqual, 1)
+
+		resp, err = svc.DoCommand(context.Background(), map[string]interface{}{
+			GetSubmapCommand: map[string]interface{}{"trajectory_id": 0, "submap_index": 0, "chunk": 2},
+		})
+		test.That(t, errors.Is(err, ErrSubmapChunkOutOfRange), test.ShouldBeTrue)
+		test.That(t, err.Error(), test.ShouldStartWith, "invalid argument for "+GetSubmapCommand+": ")
+		test.That(t, resp, test.ShouldBeNil)
+	})
+
+	t.Run("get_submap paints the submap again once its version changed", func(t *testing.T) {
+		numPainted = 0
+		submaps[0].Version++
+		pcd = []byte("VERSION .7\nPOINTS 0\nDATA binary\n")
+		resp, err := svc.DoCommand(context.Background(), map[string]interface{}{
+			GetSubmapCommand: map[string]interface{}{"trajectory_id": 0, "submap_index": 0, "chunk": 1, "version": 181},
+		})
+		test.That(t, errors.Is(err, ErrSubmapVersionChanged), test.ShouldBeTrue)
+		test.That(t, err.Error(), test.ShouldStartWith, "invalid argument for "+GetSubmapCommand+": ")
+		test.That(t, err.Error(), test.ShouldContainSubstring, "the submap is at version 182")
+		test.That(t, resp, test.ShouldBeNil)
+		test.That(t, numPainted, test.ShouldEqual, 1)
+
+		resp = getSubmap(map[string]interface{}{"trajectory_id": 0, "submap_index": 0})
+		test.That(t, resp["version"], test.ShouldEqual, 182)
+		decoded, err := base64.StdEncoding.DecodeString(resp[GetSubmapCommand].(string))
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, decoded, test.ShouldResemble, pcd)
+		test.That(t, numPainted, test.ShouldEqual, 1)
+	})
+
+	t.Run("get_submap fails for an invalid request", func(t *testing.T) {
+		for _, val := range []interface{}{
+			nil,
+			"0",
+			map[string]interface{}{"trajectory_id": 0},
+			map[string]interface{}{"submap_index": 0},
+			map[string]interface{}{"trajectory_id": "0", "submap_index": 0},
+			map[string]interface{}{"trajectory_id": 0, "submap_index": 0, "chunk": -1},
+		} {
+			resp, err := svc.DoCommand(context.Background(), map[string]interface{}{GetSubmapCommand: val})
+			test.That(t, errors.Is(err, ErrBadSubmapRequest), test.ShouldBeTrue)
+			test.That(t, err.Error(), test.ShouldStartWith, "invalid argument for "+GetSubmapCommand+": ")
+			test.That(t, resp, test.ShouldBeNil)
+		}
+	})
+
+	t.Run("get_submap fails for a submap that does not exist", func(t *testing.T) {
+		resp, err := svc.DoCommand(context.Background(), map[string]interface{}{
+			GetSubmapCommand: map[string]interface{}{"trajectory_id": 1, "submap_index": 0},
+		})
+		test.That(t, errors.Is(err, cartofacade.ErrSubmapNotFound), test.ShouldBeTrue)
+		test.That(t, err.Error(), test.ShouldStartWith, "invalid argument for "+GetSubmapCommand+": ")
+		test.That(t, resp, test.ShouldBeNil)
+	})
+
+	t.Run("the submap commands return the error of cartographer", func(t *testing.T) {
+		submapErr = errors.New("VIAM_CARTO_NOT_IN_IO_INITIALIZED_STATE")
+		resp, err := svc.DoCommand(context.Background(), map[string]interface{}{SubmapListCommand: nil})
+		test.That(t, err, test.ShouldBeError, submapErr)
+		test.That(t, resp, test.ShouldBeNil)
+		resp, err = svc.DoCommand(context.Background(), map[string]interface{}{
+			GetSubmapCommand: map[string]interface{}{"trajectory_id": 0, "submap_index": 0},
+		})
+		test.That(t, err, test.ShouldBeError, submapErr)
+		test.That(t, resp, test.ShouldBeNil)
+	})
+
+	t.Run("submap commands fail gracefully if the cartographer library predates them", func(t *testing.T) {
+		lib := &cartofacade.CartoLibMock{CapabilitiesFunc: func() cartofacade.Capabilities {
+			return cartofacade.NewCapabilities()
+		}}
+		svc := newTestService(&cartofacade.Mock{
+			CartoFacade: cartofacade.New(lib, cartofacade.CartoConfig{}, cartofacade.CartoAlgoConfig{}),
+		}, logging.NewTestLogger(t))
+		for cmd, val := range map[string]interface{}{
+			SubmapListCommand: nil,
+			GetSubmapCommand:  map[string]interface{}{"trajectory_id": 0.0, "submap_index": 0.0},
+		} {
+			resp, err := svc.DoCommand(context.Background(), map[string]interface{}{cmd: val})
+			test.That(t, resp, test.ShouldBeNil)
+			test.That(t, errors.Is(err, cartofacade.ErrFeatureUnavailable), test.ShouldBeTrue)
+		}
+	})
+}
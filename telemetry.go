@@ -0,0 +1,142 @@
+package viamcartographer
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"math"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/viam-modules/viam-cartographer/cartofacade"
+)
+
+const (
+	// GetTelemetryCompactCommand is sent to DoCommand to get the telemetry as a base64 encoded CompactTelemetry.
+	GetTelemetryCompactCommand = "get_telemetry_compact"
+	// CompactTelemetryVersion is the version of the layout of CompactTelemetry.
+	CompactTelemetryVersion = 1
+	// CompactTelemetryUnknownPoseAge is the pose age of a CompactTelemetry before a lidar reading was added.
+	CompactTelemetryUnknownPoseAge = math.MaxUint32
+)
+
+// The flags of the health of the service in a CompactTelemetry.
+const (
+	// CompactTelemetryPoseValid denotes that the pose is one cartographer returned, it is zero otherwise.
+	CompactTelemetryPoseValid uint16 = 1 << iota
+	// CompactTelemetryUnresponsive denotes that a call to cartographer is hung.
+	CompactTelemetryUnresponsive
+	// CompactTelemetryMapStalled denotes that the map stopped growing while mapping.
+	CompactTelemetryMapStalled
+	// CompactTelemetryJobDone denotes that the offline sensor process has finished.
+	CompactTelemetryJobDone
+	// CompactTelemetryEditedMapInconsistent denotes that the edited map no longer matches the map of cartographer.
+	CompactTelemetryEditedMapInconsistent
+	// CompactTelemetryInitialOptimizationInProgress denotes that the existing map is optimized in the background,
+	// so that the pose, if valid, is localized against the map as loaded.
+	CompactTelemetryInitialOptimizationInProgress
+	// CompactTelemetryLocalizationLost denotes that the lidar readings stopped matching the map while localizing.
+	CompactTelemetryLocalizationLost
+)
+
+// CompactTelemetry is the telemetry get_telemetry_compact returns, for fleets that cannot afford to poll the status
+// response. It is encoded little endian in the order of its fields, so its layout must only change along with
+// CompactTelemetryVersion.
+type CompactTelemetry struct {
+	Version uint8
+	// SlamMode is a cartofacade.SlamMode.
+	SlamMode uint8
+	Flags    uint16
+	// TakenAtUnixMs is the time the telemetry was taken at.
+	TakenAtUnixMs int64
+	// X, Y and Z are the position in mm and Real, Imag, Jmag and Kmag the orientation of the pose in the map frame.
+	X, Y, Z                float64
+	Real, Imag, Jmag, Kmag float64
+	// PoseAgeMs is the time since the last lidar reading was added, which the pose is as of, or
+	// CompactTelemetryUnknownPoseAge.
+	PoseAgeMs uint32
+	// MapRevision is the latest revision of the map tracked for get_map_delta.
+	MapRevision           uint32
+	AddedLidarReadings    uint64
+	AddedIMUReadings      uint64
+	AddedOdometerReadings uint64
+	// DroppedLidarReadings are the lidar readings skipped for being empty or having too few usable points.
+	DroppedLidarReadings uint64
+}
+
+// encode returns the telemetry in its binary layout.
+func (telemetry CompactTelemetry) encode() ([]byte, error) {
+	telemetry.Version = CompactTelemetryVersion
+	buf := bytes.NewBuffer(make([]byte, 0, binary.Size(telemetry)))
+	if err := binary.Write(buf, binary.LittleEndian, telemetry); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// DecodeCompactTelemetry decodes the binary telemetry returned by get_telemetry_compact, once base64 decoded.
+func DecodeCompactTelemetry(blob []byte) (CompactTelemetry, error) {
+	var telemetry CompactTelemetry
+	if len(blob) == 0 {
+		return CompactTelemetry{}, errors.Wrap(ErrBadCompactTelemetry, "it is empty")
+	}
+	if blob[0] != CompactTelemetryVersion {
+		return CompactTelemetry{}, errors.Wrapf(ErrBadCompactTelemetry, "version %d is not supported, expected %d",
+			blob[0], CompactTelemetryVersion)
+	}
+	if len(blob) != binary.Size(telemetry) {
+		return CompactTelemetry{}, errors.Wrapf(ErrBadCompactTelemetry, "it has %d bytes, expected %d",
+			len(blob), binary.Size(telemetry))
+	}
+	if err := binary.Read(bytes.NewReader(blob), binary.LittleEndian, &telemetry); err != nil {
+		return CompactTelemetry{}, errors.Wrap(ErrBadCompactTelemetry, err.Error())
+	}
+	return telemetry, nil
+}
+
+// compactTelemetry returns the telemetry of the service as of now.
+func (cartoSvc *CartographerService) compactTelemetry(ctx context.Context, now time.Time) CompactTelemetry {
+	_, slamMode := cartoSvc.mode()
+	telemetry := CompactTelemetry{
+		SlamMode:              uint8(slamMode),
+		TakenAtUnixMs:         now.UnixMilli(),
+		PoseAgeMs:             CompactTelemetryUnknownPoseAge,
+		MapRevision:           uint32(cartoSvc.mapRevisions.current()),
+		AddedLidarReadings:    uint64(cartoSvc.addedLidarReadings.Load()),
+		AddedIMUReadings:      uint64(cartoSvc.addedIMUReadings.Load()),
+		AddedOdometerReadings: uint64(cartoSvc.addedOdometerReadings.Load()),
+		DroppedLidarReadings:  uint64(cartoSvc.emptyLidarReadings.Load()),
+	}
+	if cartoSvc.scanFilter != nil {
+		telemetry.DroppedLidarReadings += uint64(cartoSvc.scanFilter.DroppedCount())
+	}
+
+	setFlag := func(flag uint16, set bool) {
+		if set {
+			telemetry.Flags |= flag
+		}
+	}
+	unresponsive := cartoSvc.cartofacade.Unresponsive()
+	setFlag(CompactTelemetryUnresponsive, unresponsive)
+	setFlag(CompactTelemetryMapStalled, slamMode == cartofacade.MappingMode && cartoSvc.mapStalled.Load())
+	setFlag(CompactTelemetryJobDone, cartoSvc.jobDone.Load())
+	setFlag(CompactTelemetryEditedMapInconsistent, cartoSvc.editedMap != nil && cartoSvc.editedMapInconsistent.Load())
+	setFlag(CompactTelemetryLocalizationLost, slamMode == cartofacade.LocalizingMode && cartoSvc.localizationLost.Load())
+	setFlag(CompactTelemetryInitialOptimizationInProgress, cartoSvc.initialOptimizationInProgress.Load())
+
+	if addedAt := cartoSvc.cartofacade.Status().LastLidarReadingAddedAt; !addedAt.IsZero() {
+		poseAgeMs := math.Max(0, float64(now.Sub(addedAt).Milliseconds()))
+		telemetry.PoseAgeMs = uint32(math.Min(poseAgeMs, CompactTelemetryUnknownPoseAge-1))
+	}
+	// a call to get the position would wait on the hung call or on the optimization
+	if unresponsive || cartoSvc.initialOptimizationBlocking() {
+		return telemetry
+	}
+	if pos, err := cartoSvc.cartofacade.Position(ctx, cartoSvc.cartoFacadeTimeout); err == nil {
+		telemetry.Flags |= CompactTelemetryPoseValid
+		telemetry.X, telemetry.Y, telemetry.Z = pos.X, pos.Y, pos.Z
+		telemetry.Real, telemetry.Imag, telemetry.Jmag, telemetry.Kmag = pos.Real, pos.Imag, pos.Jmag, pos.Kmag
+	}
+	return telemetry
+}
@@ -0,0 +1,126 @@
+package viamcartographer
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"testing"
+	"time"
+
+	"go.viam.com/rdk/logging"
+	"go.viam.com/test"
+
+	"github.com/viam-modules/viam-cartographer/cartofacade"
+)
+
+func TestCompactTelemetry(t *testing.T) {
+	telemetry := CompactTelemetry{
+		Version:               CompactTelemetryVersion,
+		SlamMode:              uint8(cartofacade.LocalizingMode),
+		Flags:                 CompactTelemetryPoseValid | CompactTelemetryMapStalled | CompactTelemetryJobDone,
+		TakenAtUnixMs:         1700000000123,
+		X:                     1.5,
+		Y:                     -2.25,
+		Real:                  1,
+		Kmag:                  0.5,
+		PoseAgeMs:             250,
+		MapRevision:           7,
+		AddedLidarReadings:    100,
+		AddedIMUReadings:      2000,
+		AddedOdometerReadings: 300,
+		DroppedLidarReadings:  4,
+	}
+
+	t.Run("round trips through its binary layout", func(t *testing.T) {
+		blob, err := telemetry.encode()
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, len(blob), test.ShouldBeLessThan, 200)
+		decoded, err := DecodeCompactTelemetry(blob)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, decoded, test.ShouldResemble, telemetry)
+	})
+
+	t.Run("has a stable layout", func(t *testing.T) {
+		// changing the layout requires a new CompactTelemetryVersion, as fleets decode the old one
+		golden := "010215007b68e5cf8b010000000000000000f83f00000000000002c000000000" +
+			"00000000000000000000f03f0000000000000000000000000000000000000000" +
+			"0000e03ffa000000070000006400000000000000d0070000000000002c010000" +
+			"000000000400000000000000"
+		blob, err := telemetry.encode()
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, hex.EncodeToString(blob), test.ShouldEqual, golden)
+	})
+
+	t.Run("rejects blobs that are not compact telemetry", func(t *testing.T) {
+		blob, err := telemetry.encode()
+		test.That(t, err, test.ShouldBeNil)
+
+		_, err = DecodeCompactTelemetry(nil)
+		test.That(t, errors.Is(err, ErrBadCompactTelemetry), test.ShouldBeTrue)
+
+		_, err = DecodeCompactTelemetry(append([]byte{CompactTelemetryVersion + 1}, blob[1:]...))
+		test.That(t, errors.Is(err, ErrBadCompactTelemetry), test.ShouldBeTrue)
+		test.That(t, err.Error(), test.ShouldContainSubstring, "version 2 is not supported")
+
+		_, err = DecodeCompactTelemetry(blob[:len(blob)-1])
+		test.That(t, errors.Is(err, ErrBadCompactTelemetry), test.ShouldBeTrue)
+		test.That(t, err.Error(), test.ShouldContainSubstring, "it has 107 bytes, expected 108")
+	})
+
+	mockCartoFacade := &cartofacade.Mock{}
+	unresponsive := false
+	mockCartoFacade.UnresponsiveFunc = func() bool { return unresponsive }
+	addedAt := time.Now().Add(-time.Second)
+	mockCartoFacade.StatusFunc = func() cartofacade.Status {
+		return cartofacade.Status{LastLidarReadingAddedAt: addedAt}
+	}
+	mockCartoFacade.PositionFunc = func(ctx context.Context, timeout time.Duration) (cartofacade.Position, error) {
+		return cartofacade.Position{X: 10, Y: 20, Real: 1}, nil
+	}
+	svc := newTestService(mockCartoFacade, logging.NewTestLogger(t))
+	svc.SlamMode = cartofacade.MappingMode
+	svc.addedLidarReadings.Store(12)
+	svc.addedIMUReadings.Store(34)
+	svc.emptyLidarReadings.Store(2)
+	svc.mapStalled.Store(true)
+	svc.localizationLost.Store(true)
+
+	getTelemetry := func(t *testing.T) CompactTelemetry {
+		resp, err := svc.DoCommand(context.Background(), map[string]interface{}{GetTelemetryCompactCommand: nil})
+		test.That(t, err, test.ShouldBeNil)
+		blob, err := base64.StdEncoding.DecodeString(resp[GetTelemetryCompactCommand].(string))
+		test.That(t, err, test.ShouldBeNil)
+		telemetry, err := DecodeCompactTelemetry(blob)
+		test.That(t, err, test.ShouldBeNil)
+		return telemetry
+	}
+
+	t.Run("get_telemetry_compact returns the telemetry of the service", func(t *testing.T) {
+		telemetry := getTelemetry(t)
+		test.That(t, telemetry.SlamMode, test.ShouldEqual, uint8(cartofacade.MappingMode))
+		// the localization is only lost while localizing
+		test.That(t, telemetry.Flags, test.ShouldEqual, CompactTelemetryPoseValid|CompactTelemetryMapStalled)
+		test.That(t, telemetry.X, test.ShouldEqual, 10)
+		test.That(t, telemetry.Y, test.ShouldEqual, 20)
+		test.That(t, telemetry.Real, test.ShouldEqual, 1)
+		test.That(t, telemetry.PoseAgeMs, test.ShouldBeBetweenOrEqual, 1000, 60000)
+		test.That(t, telemetry.AddedLidarReadings, test.ShouldEqual, 12)
+		test.That(t, telemetry.AddedIMUReadings, test.ShouldEqual, 34)
+		test.That(t, telemetry.AddedOdometerReadings, test.ShouldEqual, 0)
+		test.That(t, telemetry.DroppedLidarReadings, test.ShouldEqual, 2)
+	})
+
+	t.Run("get_telemetry_compact does not wait on an unresponsive cartographer", func(t *testing.T) {
+		unresponsive = true
+		addedAt = time.Time{}
+		mockCartoFacade.PositionFunc = func(ctx context.Context, timeout time.Duration) (cartofacade.Position, error) {
+			t.Fatal("the position was requested from an unresponsive cartographer")
+			return cartofacade.Position{}, nil
+		}
+		telemetry := getTelemetry(t)
+		test.That(t, telemetry.Flags, test.ShouldEqual, CompactTelemetryUnresponsive|CompactTelemetryMapStalled)
+		test.That(t, telemetry.X, test.ShouldEqual, 0)
+		test.That(t, telemetry.PoseAgeMs, test.ShouldEqual, uint32(CompactTelemetryUnknownPoseAge))
+	})
+}
@@ -4,11 +4,10 @@ package testhelper
 import (
 	"bytes"
 	"context"
-	"encoding/json"
 	"fmt"
-	"io"
+	"math"
 	"os"
-	"path"
+	"path/filepath"
 	"reflect"
 	"runtime"
 	"strconv"
@@ -16,8 +15,8 @@ import (
 	"testing"
 	"time"
 
+	"github.com/golang/geo/r2"
 	"github.com/golang/geo/r3"
-	geo "github.com/kellydunn/golang-geo"
 	"github.com/pkg/errors"
 	replaylidar "go.viam.com/rdk/components/camera/replaypcd"
 	replaymovementsensor "go.viam.com/rdk/components/movementsensor/replay"
@@ -51,73 +50,19 @@ const (
 	testTimeout                       = 20 * time.Second
 	darwin                            = "darwin"
 	linux                             = "linux"
+	// floorPlanResolutionMm is the width of the pixels of the floor plan rendered from the mock dataset, matching
+	// the resolution of cartographer's submaps.
+	floorPlanResolutionMm = 50
+	// occupiedPixel, freePixel and unknownPixel are the gray values the ROS map_server writes occupancy grids with.
+	occupiedPixel = 0
+	freePixel     = 254
+	unknownPixel  = 205
+	// floorPlanPositionToleranceMm and floorPlanHeadingToleranceRad are how far the pose localized against the
+	// floor plan may be from the mapped pose, as the floor plan is only as precise as its pixels.
+	floorPlanPositionToleranceMm = 2 * floorPlanResolutionMm
+	floorPlanHeadingToleranceRad = 0.05
 )
 
-type dataTime struct {
-	Seconds int `json:"seconds"`
-	Nanos   int `json:"nanos"`
-}
-
-type coordinate struct {
-	Latitude  float64 `json:"latitude"`
-	Longitude float64 `json:"longitude"`
-}
-
-type angularVelocity struct {
-	X float64 `json:"x"`
-	Y float64 `json:"y"`
-	Z float64 `json:"z"`
-}
-
-type linearAcceleration struct {
-	X float64 `json:"x"`
-	Y float64 `json:"y"`
-	Z float64 `json:"z"`
-}
-
-type orientation struct {
-	Ox    float64 `json:"o_x"`
-	Oy    float64 `json:"o_y"`
-	Oz    float64 `json:"o_z"`
-	Theta float64 `json:"theta"`
-}
-
-type angVelData struct {
-	MetaDataIndex int             `json:"MetadataIndex"`
-	TimeReceived  dataTime        `json:"TimeReceived"`
-	TimeRequested dataTime        `json:"TimeRequested"`
-	AngVel        angularVelocity `json:"angular_velocity"`
-}
-
-type linAccData struct {
-	MetaDataIndex int                `json:"MetadataIndex"`
-	TimeReceived  dataTime           `json:"TimeReceived"`
-	TimeRequested dataTime           `json:"TimeRequested"`
-	LinAcc        linearAcceleration `json:"linear_acceleration"`
-}
-
-type orientationData struct {
-	MetaDataIndex int         `json:"MetadataIndex"`
-	TimeReceived  dataTime    `json:"TimeReceived"`
-	TimeRequested dataTime    `json:"TimeRequested"`
-	Orientation   orientation `json:"orientation"`
-}
-
-type posData struct {
-	MetaDataIndex int        `json:"MetadataIndex"`
-	TimeReceived  dataTime   `json:"TimeReceived"`
-	TimeRequested dataTime   `json:"TimeRequested"`
-	AltitudeM     int        `json:"altitude_m"`
-	Coordinate    coordinate `json:"coordinate"`
-}
-
-type movementSensorData struct {
-	AngVelData      []angVelData      `json:"AngVelData"`
-	LinAccData      []linAccData      `json:"LinAccData"`
-	OrientationData []orientationData `json:"OrientationData"`
-	PosData         []posData         `json:"PosData"`
-}
-
 // Test final position and orientation are at approximately the expected values.
 func testCartographerPosition(t *testing.T, svc slam.Service, useIMU bool,
 	useOdometer bool,
@@ -211,7 +156,7 @@ func testCartographerPosition(t *testing.T, svc slam.Service, useIMU bool,
 }
 
 // Checks the cartographer map and confirms there at least 100 map points.
-func testCartographerMap(t *testing.T, svc slam.Service, localizationMode bool) {
+func testCartographerMap(t *testing.T, svc slam.Service, localizationMode bool) []byte {
 	props, err := svc.Properties(context.Background())
 	test.That(t, err, test.ShouldBeNil)
 	test.That(t, props.CloudSlam, test.ShouldBeFalse)
@@ -225,6 +170,7 @@ func testCartographerMap(t *testing.T, svc slam.Service, localizationMode bool)
 	test.That(t, err, test.ShouldBeNil)
 	t.Logf("Pointcloud points: %v", pointcloud.Size())
 	test.That(t, pointcloud.Size(), test.ShouldBeGreaterThanOrEqualTo, 100)
+	return pcd
 }
 
 // timeTracker stores the current and next timestamps for both the movement sensor and the lidar.
@@ -256,14 +202,17 @@ type timeTracker struct {
 // ensure test outputs of cartographer are deterministic.
 func integrationTimedLidar(
 	t *testing.T,
+	datasetDir string,
 	lidar map[string]string,
 	sensorReadingInterval time.Duration,
 	done chan struct{},
 	timeTracker *timeTracker,
 	useMovementSensor bool,
+	sessionBreak *sessionBreak,
 ) (s.TimedLidar, error) {
 	// Check that the required amount of lidar data is present
-	if err := mockLidarReadingsValid(); err != nil {
+	framePaths, err := mockLidarReadingsValid(datasetDir)
+	if err != nil {
 		return nil, err
 	}
 
@@ -307,14 +256,23 @@ func integrationTimedLidar(
 			return s.TimedLidarReadingResponse{}, replaylidar.ErrEndOfDataset
 		}
 
-		// Get next lidar data
-		resp, err := createTimedLidarReadingResponse(t, i, timeTracker)
+		// Pause between the two sessions of a multi session run until the next session was started
+		if sessionBreak != nil && i == sessionBreak.afterReading {
+			sessionBreak.once.Do(func() {
+				close(sessionBreak.reached)
+				<-sessionBreak.resume
+			})
+		}
+
+		// Get next lidar data. A frame that cannot be read or parsed is skipped with an error, without advancing
+		// the time tracker so that it does not leave a gap in the timestamps.
+		resp, err := createTimedLidarReadingResponse(framePaths[i], timeTracker)
+		i++
 		if err != nil {
 			return resp, err
 		}
 
-		// Advance the data index and update time tracker (manual timestamps occurs here)
-		i++
+		// Update time tracker (manual timestamps occurs here)
 		timeTracker.lidarTime = timeTracker.lidarTime.Add(sensorReadingInterval)
 		timeTracker.nextLidarTime = timeTracker.lidarTime.Add(sensorReadingInterval)
 
@@ -338,6 +296,113 @@ func IntegrationCartographer(
 	enableMapping bool,
 	expectedMode cartofacade.SlamMode,
 ) []byte {
+	internalState, _, _ := integrationCartographer(t, artifact.MustPath(mockDataPath), existingMap, nil, subAlgo, logger,
+		online, useIMU, useOdometer, false, enableMapping, expectedMode, true)
+	return internalState
+}
+
+// IntegrationCartographerOnDataset runs viam-cartographer offline in mapping mode on the dataset in datasetDir,
+// e.g. one written by sensors.GenerateSyntheticDataset, using its lidar readings and, if enabled, its IMU and
+// odometer readings. It checks that a map was built and returns the final internal state of cartographer.
+func IntegrationCartographerOnDataset(
+	t *testing.T,
+	datasetDir string,
+	logger logging.Logger,
+	useIMU bool,
+	useOdometer bool,
+) []byte {
+	internalState, _, _ := integrationCartographer(t, datasetDir, "", nil, viamcartographer.Dim2d, logger,
+		false, useIMU, useOdometer, false, true, cartofacade.MappingMode, false)
+	return internalState
+}
+
+// IntegrationCartographerPositionOnDataset runs viam-cartographer offline in mapping mode on the dataset in
+// datasetDir with lidar only or, if useVelocity is set, with the velocity readings of its movement sensor as the
+// odometry of a wheel encoder. It returns the final position of cartographer in millimeters.
+func IntegrationCartographerPositionOnDataset(
+	t *testing.T,
+	datasetDir string,
+	logger logging.Logger,
+	useVelocity bool,
+) r3.Vector {
+	_, _, pose := integrationCartographer(t, datasetDir, "", nil, viamcartographer.Dim2d, logger,
+		false, false, false, useVelocity, true, cartofacade.MappingMode, false)
+	return pose.Point()
+}
+
+// IntegrationCartographerFloorPlan runs viam-cartographer online in mapping mode with lidar only on the mock
+// dataset, renders the final map into an occupancy grid image and runs viam-cartographer online again in
+// localizing mode with the image as its floor plan, checking that it localizes at the pose it was mapped at.
+func IntegrationCartographerFloorPlan(t *testing.T, logger logging.Logger) {
+	datasetDir := artifact.MustPath(mockDataPath)
+	_, pointCloudMap, mappedPose := integrationCartographer(t, datasetDir, "", nil, viamcartographer.Dim2d, logger,
+		true, false, false, false, true, cartofacade.MappingMode, true)
+
+	floorPlan := writeFloorPlan(t, pointCloudMap, floorPlanResolutionMm, t.TempDir())
+	// the position can't be compared to the expected one of the mock data, which depends on the trajectory that
+	// was built, but the floor plan is in the frame of the map, so the robot must be localized where it was mapped
+	_, _, localizedPose := integrationCartographer(t, datasetDir, "", floorPlan, viamcartographer.Dim2d, logger,
+		true, false, false, false, false, cartofacade.LocalizingMode, false)
+	positionError := localizedPose.Point().Sub(mappedPose.Point()).Norm()
+	headingError := spatialmath.QuatToR3AA(
+		spatialmath.OrientationBetween(mappedPose.Orientation(), localizedPose.Orientation()).Quaternion()).Norm()
+	t.Logf("localized against the floor plan %.1fmm and %.4frad from the mapped pose", positionError, headingError)
+	test.That(t, positionError, test.ShouldBeLessThanOrEqualTo, floorPlanPositionToleranceMm)
+	test.That(t, headingError, test.ShouldBeLessThanOrEqualTo, floorPlanHeadingToleranceRad)
+}
+
+// writeFloorPlan renders the pointcloud map into an occupancy grid image with pixels resolutionMm millimeters wide,
+// as the ROS map_server writes them, in dir. Pixels holding a point with a probability above 50% are occupied,
+// those holding only other points are free and all other pixels are unknown.
+func writeFloorPlan(t *testing.T, pointCloudMap []byte, resolutionMm float64, dir string) *vcConfig.FloorPlan {
+	t.Helper()
+	pc, err := pointcloud.ReadPCD(bytes.NewReader(pointCloudMap))
+	test.That(t, err, test.ShouldBeNil)
+	meta := pc.MetaData()
+	width := int(math.Floor((meta.MaxX-meta.MinX)/resolutionMm)) + 1
+	height := int(math.Floor((meta.MaxY-meta.MinY)/resolutionMm)) + 1
+
+	pixels := bytes.Repeat([]byte{unknownPixel}, width*height)
+	pc.Iterate(0, 0, func(p r3.Vector, d pointcloud.Data) bool {
+		col := int(math.Floor((p.X - meta.MinX) / resolutionMm))
+		row := height - 1 - int(math.Floor((p.Y-meta.MinY)/resolutionMm))
+		if _, _, probability := d.RGB255(); probability > 50 {
+			pixels[row*width+col] = occupiedPixel
+		} else if pixels[row*width+col] != occupiedPixel {
+			pixels[row*width+col] = freePixel
+		}
+		return true
+	})
+
+	image := filepath.Join(dir, "floor_plan.pgm")
+	content := append([]byte(fmt.Sprintf("P5\n%d %d\n255\n", width, height)), pixels...)
+	test.That(t, os.WriteFile(image, content, 0o600), test.ShouldBeNil)
+	return &vcConfig.FloorPlan{
+		Image:        image,
+		ResolutionMm: resolutionMm,
+		Origin:       &r2.Point{X: meta.MinX, Y: meta.MinY},
+	}
+}
+
+// integrationCartographer implements IntegrationCartographer on the dataset in datasetDir, localizing against
+// floorPlan instead of existingMap if it is set. If useVelocity is set, the movement sensor is a wheel encoder
+// reporting the velocity readings of the dataset. The position is only compared to the expected position on the
+// mock data if testPosition is set. It returns the final internal state, pointcloud map and pose of cartographer.
+func integrationCartographer(
+	t *testing.T,
+	datasetDir string,
+	existingMap string,
+	floorPlan *vcConfig.FloorPlan,
+	subAlgo viamcartographer.SubAlgo,
+	logger logging.Logger,
+	online bool,
+	useIMU bool,
+	useOdometer bool,
+	useVelocity bool,
+	enableMapping bool,
+	expectedMode cartofacade.SlamMode,
+	testPosition bool,
+) ([]byte, []byte, spatialmath.Pose) {
 	termFunc := InitTestCL(t, logger)
 	defer termFunc()
 
@@ -348,6 +413,7 @@ func IntegrationCartographer(
 
 	attrCfg := &vcConfig.Config{
 		ExistingMap:   existingMap,
+		FloorPlan:     floorPlan,
 		EnableMapping: &enableMapping,
 		ConfigParams: map[string]string{
 			"mode": reflect.ValueOf(subAlgo).String(),
@@ -376,7 +442,8 @@ func IntegrationCartographer(
 
 	// Add movement sensor component to config (optional)
 	movementSensorDone := make(chan struct{})
-	if useIMU || useOdometer {
+	useMovementSensor := useIMU || useOdometer || useVelocity
+	if useMovementSensor {
 		// We're using MovementSensorWithErroringFunctions as a placeholder for deps.
 		// We're defining and using the injection movement sensor
 		// to overwrite this movement sensor when we create the slam service.
@@ -393,19 +460,22 @@ func IntegrationCartographer(
 				"data_frequency_hz": "20",
 			}
 		}
+		if useVelocity {
+			attrCfg.MovementSensor["velocity_odometry"] = "true"
+		}
 		timeTracker.movementSensorTime = timeTracker.lidarTime
 	}
 
 	// Start Sensors
-	timedLidar, err := integrationTimedLidar(t, attrCfg.Camera,
-		defaultLidarTimeInterval, lidarDone, &timeTracker, useIMU || useOdometer)
+	timedLidar, err := integrationTimedLidar(t, datasetDir, attrCfg.Camera,
+		defaultLidarTimeInterval, lidarDone, &timeTracker, useMovementSensor, nil)
 	test.That(t, err, test.ShouldBeNil)
 
 	var timedMovementSensor s.TimedMovementSensor
-	if useIMU || useOdometer {
-		timedMovementSensor, err = integrationTimedMovementSensor(t, attrCfg.MovementSensor,
+	if useMovementSensor {
+		timedMovementSensor, err = integrationTimedMovementSensor(t, datasetDir, attrCfg.MovementSensor,
 			defaultMovementSensorTimeInterval, movementSensorDone, &timeTracker,
-			useIMU, useOdometer)
+			useIMU, useOdometer, useVelocity)
 		test.That(t, err, test.ShouldBeNil)
 	}
 
@@ -426,7 +496,7 @@ func IntegrationCartographer(
 	t.Logf("lidar sensor process duration %dms (timeout = %dms)", time.Since(start).Milliseconds(), testTimeout.Milliseconds())
 	test.That(t, finishedProcessingLidarData, test.ShouldBeTrue)
 
-	if useIMU || useOdometer {
+	if useMovementSensor {
 		finishedProcessingMsData := utils.SelectContextOrWaitChan(ctx, movementSensorDone)
 		t.Logf("movement sensor process duration %dms (timeout = %dms)", time.Since(start).Milliseconds(), testTimeout.Milliseconds())
 		test.That(t, finishedProcessingMsData, test.ShouldBeTrue)
@@ -434,8 +504,12 @@ func IntegrationCartographer(
 	t.Logf("sensor processes have completed, all data has been ingested")
 
 	// Test end points and retrieve internal state
-	testCartographerPosition(t, svc, useIMU, useOdometer)
-	testCartographerMap(t, svc, cSvc.SlamMode == cartofacade.LocalizingMode)
+	if testPosition {
+		testCartographerPosition(t, svc, useIMU, useOdometer)
+	}
+	pose, err := svc.Position(context.Background())
+	test.That(t, err, test.ShouldBeNil)
+	pointCloudMap := testCartographerMap(t, svc, cSvc.SlamMode == cartofacade.LocalizingMode)
 
 	internalState, err := slam.InternalStateFull(context.Background(), svc)
 	test.That(t, err, test.ShouldBeNil)
@@ -447,6 +521,88 @@ func IntegrationCartographer(
 	t.Logf("test duration %dms", testDuration.Milliseconds())
 
 	// return the internal state so updating mode can be tested
+	return internalState, pointCloudMap, pose
+}
+
+// sessionBreak splits the mock lidar readings into two sessions: the mock closes reached before returning
+// reading afterReading and blocks until resume is closed.
+type sessionBreak struct {
+	afterReading uint64
+	reached      chan struct{}
+	resume       chan struct{}
+	once         sync.Once
+}
+
+// IntegrationCartographerTwoSessions runs viam-cartographer online in mapping mode with lidar only and splits the
+// mock dataset into two sessions by starting a new trajectory halfway through it. It checks that the first
+// trajectory is kept frozen in the pose graph, that the remaining readings are added to the new trajectory and
+// that the map is built from both sessions. The final internal state of cartographer is returned.
+func IntegrationCartographerTwoSessions(t *testing.T, logger logging.Logger) []byte {
+	termFunc := InitTestCL(t, logger)
+	defer termFunc()
+
+	timeTracker := timeTracker{
+		mu:        &sync.Mutex{},
+		lidarTime: time.Date(2021, 8, 15, 14, 30, 45, 1, time.UTC),
+	}
+
+	enableMapping := true
+	attrCfg := &vcConfig.Config{
+		EnableMapping: &enableMapping,
+		ConfigParams: map[string]string{
+			"mode": reflect.ValueOf(viamcartographer.Dim2d).String(),
+		},
+		Camera: map[string]string{
+			"name":              string(LidarWithErroringFunctions),
+			"data_frequency_hz": "5",
+		},
+	}
+
+	lidarDone := make(chan struct{})
+	sessions := &sessionBreak{
+		afterReading: NumPointCloudFiles / 2,
+		reached:      make(chan struct{}),
+		resume:       make(chan struct{}),
+	}
+	timedLidar, err := integrationTimedLidar(t, artifact.MustPath(mockDataPath), attrCfg.Camera,
+		defaultLidarTimeInterval, lidarDone, &timeTracker, false, sessions)
+	test.That(t, err, test.ShouldBeNil)
+
+	svc, err := CreateIntegrationSLAMService(t, attrCfg, timedLidar, nil, logger)
+	test.That(t, err, test.ShouldBeNil)
+
+	ctx, cancelFunc := context.WithTimeout(context.Background(), testTimeout)
+	defer cancelFunc()
+
+	// 1. Wait for the first session to be ingested and start the second session
+	test.That(t, utils.SelectContextOrWaitChan(ctx, sessions.reached), test.ShouldBeTrue)
+	resp, err := svc.DoCommand(context.Background(), map[string]interface{}{viamcartographer.StartNewTrajectoryCommand: nil})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, resp[viamcartographer.FinishedTrajectoryIDKey], test.ShouldEqual, 0)
+	test.That(t, resp[viamcartographer.TrajectoryIDKey], test.ShouldEqual, 1)
+	close(sessions.resume)
+
+	// 2. Wait for the second session to be ingested
+	test.That(t, utils.SelectContextOrWaitChan(ctx, lidarDone), test.ShouldBeTrue)
+	t.Logf("sensor processes have completed, all data has been ingested")
+
+	// 3. Both trajectories are part of the pose graph and the first one is frozen
+	resp, err = svc.DoCommand(context.Background(), map[string]interface{}{viamcartographer.StatusCommand: ""})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, resp[viamcartographer.TrajectoriesKey], test.ShouldResemble, []interface{}{
+		map[string]interface{}{"id": 0, "state": cartofacade.TrajectoryFrozen.String()},
+		map[string]interface{}{"id": 1, "state": cartofacade.TrajectoryActive.String()},
+	})
+
+	// 4. The position is tracked on the new trajectory and the map contains both sessions
+	_, err = svc.Position(context.Background())
+	test.That(t, err, test.ShouldBeNil)
+	testCartographerMap(t, svc, false)
+
+	internalState, err := slam.InternalStateFull(context.Background(), svc)
+	test.That(t, err, test.ShouldBeNil)
+
+	test.That(t, svc.Close(context.Background()), test.ShouldBeNil)
 	return internalState
 }
 
@@ -462,12 +618,14 @@ func IntegrationCartographer(
 // ensure test outputs of cartographer are deterministic.
 func integrationTimedMovementSensor(
 	t *testing.T,
+	datasetDir string,
 	movementSensor map[string]string,
 	sensorReadingInterval time.Duration,
 	done chan struct{},
 	timeTracker *timeTracker,
 	useIMU bool,
 	useOdometer bool,
+	useVelocity bool,
 ) (s.TimedMovementSensor, error) {
 	// Return nil if movement sensor is not defined
 	if movementSensor["name"] == "" {
@@ -476,16 +634,25 @@ func integrationTimedMovementSensor(
 
 	// Check that the required amount of movement sensor data is present and
 	// create a mock dataset from provided mock data artifact file.
-	mockDataset, err := mockMovementSensorReadingsValid(t)
+	mockDataset, err := mockMovementSensorReadingsValid(datasetDir)
 	if err != nil {
 		return nil, err
 	}
+	if useVelocity && len(mockDataset.LinVelData) != len(mockDataset.AngVelData) {
+		return nil, errors.New("the movement sensor readings of the dataset hold no velocity readings")
+	}
 
 	dataFrequencyHz, err := strconv.Atoi(movementSensor["data_frequency_hz"])
 	if err != nil {
 		return nil, err
 	}
 
+	properties := s.MovementSensorProperties{
+		IMUSupported:      useIMU,
+		OdometerSupported: useOdometer || useVelocity,
+		VelocitySupported: useVelocity,
+	}
+
 	var i uint64
 	injectMovementSensor := &inject.TimedMovementSensor{}
 	injectMovementSensor.NameFunc = func() string { return movementSensor["name"] }
@@ -516,7 +683,7 @@ func integrationTimedMovementSensor(
 		}
 
 		// Get next movement sensor data
-		resp := createTimedMovementSensorReadingResponse(mockDataset, i, timeTracker, useIMU, useOdometer)
+		resp := createTimedMovementSensorReadingResponse(mockDataset, i, timeTracker, properties)
 
 		// Advance the data index and update time tracker (manual timestamps occurs here)
 		i++
@@ -525,33 +692,27 @@ func integrationTimedMovementSensor(
 		return resp, nil
 	}
 	injectMovementSensor.PropertiesFunc = func() s.MovementSensorProperties {
-		return s.MovementSensorProperties{
-			IMUSupported:      useIMU,
-			OdometerSupported: useOdometer,
-		}
+		return properties
 	}
 
 	return injectMovementSensor, nil
 }
 
-func createTimedLidarReadingResponse(t *testing.T, i uint64, timeTracker *timeTracker,
+func createTimedLidarReadingResponse(framePath string, timeTracker *timeTracker,
 ) (s.TimedLidarReadingResponse, error) {
-	file, err := os.Open(artifact.MustPath(mockDataPath + "/lidar/" + strconv.FormatUint(i, 10) + ".pcd"))
+	frame, err := s.ReadLidarDatasetFrame(framePath)
 	if err != nil {
-		t.Error("TEST FAILED TimedLidarReading Mock failed to open pcd file")
-		return s.TimedLidarReadingResponse{}, err
+		return s.TimedLidarReadingResponse{}, errors.Wrap(err, "TimedLidarReading Mock failed to open pcd file")
 	}
-	readingPc, err := pointcloud.ReadPCD(file)
+	readingPc, err := pointcloud.ReadPCD(bytes.NewReader(frame))
 	if err != nil {
-		t.Error("TEST FAILED TimedLidarReading Mock failed to read pcd")
-		return s.TimedLidarReadingResponse{}, err
+		return s.TimedLidarReadingResponse{}, errors.Wrapf(err, "TimedLidarReading Mock failed to read pcd %s", framePath)
 	}
 
 	buf := new(bytes.Buffer)
 
 	if err = pointcloud.ToPCD(readingPc, buf, pointcloud.PCDBinary); err != nil {
-		t.Error("TEST FAILED TimedLidarReading Mock failed to parse pcd")
-		return s.TimedLidarReadingResponse{}, err
+		return s.TimedLidarReadingResponse{}, errors.Wrap(err, "TimedLidarReading Mock failed to parse pcd")
 	}
 
 	resp := s.TimedLidarReadingResponse{
@@ -561,138 +722,52 @@ func createTimedLidarReadingResponse(t *testing.T, i uint64, timeTracker *timeTr
 	return resp, nil
 }
 
-func createTimedMovementSensorReadingResponse(data movementSensorData, i uint64,
-	timeTracker *timeTracker, useIMU, useOdometer bool,
+func createTimedMovementSensorReadingResponse(data s.MovementSensorDataset, i uint64,
+	timeTracker *timeTracker, properties s.MovementSensorProperties,
 ) s.TimedMovementSensorReadingResponse {
-	var timedIMUResponse s.TimedIMUReadingResponse
-	if useIMU {
-		// linear acceleration
-		linAccX := data.LinAccData[i].LinAcc.X
-		linAccY := data.LinAccData[i].LinAcc.Y
-		linAccZ := data.LinAccData[i].LinAcc.Z
-
-		linAcc := r3.Vector{X: linAccX, Y: linAccY, Z: linAccZ}
-
-		// angular velocity
-		angVelX := data.AngVelData[i].AngVel.X
-		angVelY := data.AngVelData[i].AngVel.Y
-		angVelZ := data.AngVelData[i].AngVel.Z
-
-		angVel := spatialmath.AngularVelocity{X: angVelX, Y: angVelY, Z: angVelZ}
-
-		// timed imu response
-		timedIMUResponse = s.TimedIMUReadingResponse{
-			LinearAcceleration: linAcc,
-			AngularVelocity:    angVel,
-			ReadingTime:        timeTracker.movementSensorTime,
-		}
-	}
-
-	var timedOdometerResponse s.TimedOdometerReadingResponse
-	if useOdometer {
-		// position
-		latitude := data.PosData[i].Coordinate.Latitude
-		longitude := data.PosData[i].Coordinate.Longitude
-
-		position := geo.NewPoint(latitude, longitude)
-
-		// orientation
-		ox := data.OrientationData[i].Orientation.Ox
-		oy := data.OrientationData[i].Orientation.Oy
-		oz := data.OrientationData[i].Orientation.Oz
-		theta := data.OrientationData[i].Orientation.Theta
-
-		orientation := &spatialmath.OrientationVector{
-			Theta: theta,
-			OX:    ox,
-			OY:    oy,
-			OZ:    oz,
-		}
-
-		// timed odometer response
-		timedOdometerResponse = s.TimedOdometerReadingResponse{
-			Position:    position,
-			Orientation: orientation,
-			ReadingTime: timeTracker.movementSensorTime,
-		}
-	}
-
-	resp := s.TimedMovementSensorReadingResponse{
-		TimedIMUResponse:      &timedIMUResponse,
-		TimedOdometerResponse: &timedOdometerResponse,
-	}
-	return resp
+	return data.Reading(int(i), timeTracker.movementSensorTime, properties)
 }
 
-func mockLidarReadingsValid() error {
-	dirEntries, err := os.ReadDir(artifact.MustPath(mockDataPath + "/lidar"))
+// mockLidarReadingsValid returns the paths of the first NumPointCloudFiles lidar readings of the dataset in
+// datasetDir, which may be stored either compressed (.pcd.gz) or uncompressed (.pcd).
+func mockLidarReadingsValid(datasetDir string) ([]string, error) {
+	lidarDir := filepath.Join(datasetDir, s.LidarDatasetDir)
+	framePaths, err := s.ListLidarDatasetFrames(lidarDir)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	var files []string
-	for _, f := range dirEntries {
-		if !f.IsDir() {
-			files = append(files, f.Name())
-		}
-	}
-	if len(files) < NumPointCloudFiles {
-		return errors.Errorf("expected at least %v lidar reading files for integration test", NumPointCloudFiles)
+	if len(framePaths) < NumPointCloudFiles {
+		return nil, errors.Errorf("expected at least %v lidar reading files for integration test", NumPointCloudFiles)
 	}
 	for i := range NumPointCloudFiles {
-		found := false
-		expectedFile := fmt.Sprintf("%d.pcd", i)
-		for _, file := range files {
-			if file == expectedFile {
-				found = true
-				break
-			}
-		}
-
-		if !found {
-			return errors.Errorf("expected %s to exist for integration test", path.Join(mockDataPath+"/lidar", expectedFile))
+		fileName := filepath.Base(framePaths[i])
+		if fileName != fmt.Sprintf("%d%s", i, s.PCDExtension) && fileName != fmt.Sprintf("%d%s", i, s.CompressedPCDExtension) {
+			expectedFile := fmt.Sprintf("%d.pcd", i)
+			return nil, errors.Errorf("expected %s to exist for integration test", filepath.Join(lidarDir, expectedFile))
 		}
 	}
-	return nil
+	return framePaths[:NumPointCloudFiles], nil
 }
 
-func mockMovementSensorReadingsValid(t *testing.T) (movementSensorData, error) {
-	file, err := os.Open(artifact.MustPath(mockDataPath + "/movement_sensor/data.json"))
+// mockMovementSensorReadingsValid returns the movement sensor readings of the dataset in datasetDir.
+func mockMovementSensorReadingsValid(datasetDir string) (s.MovementSensorDataset, error) {
+	data, err := s.ReadMovementSensorDataset(filepath.Join(datasetDir, s.MovementSensorDatasetFile))
 	if err != nil {
-		t.Error("TEST FAILED TimedMovementSensorReading Mock failed to open data file")
-		return movementSensorData{}, err
-	}
-	defer func() {
-		if err := file.Close(); err != nil {
-			t.Error("TEST FAILED TimedMovementSensorReading Mock failed to close data file")
-		}
-		test.That(t, err, test.ShouldBeNil)
-	}()
-
-	byteValue, err := io.ReadAll(file)
-	if err != nil {
-		t.Error("TEST FAILED TimedMovementSensorReading Mock failed to read data file")
-		return movementSensorData{}, err
-	}
-
-	var data movementSensorData
-
-	if err = json.Unmarshal(byteValue, &data); err != nil {
-		t.Error("TEST FAILED TimedMovementSensorReading Mock failed to unmarshal json")
-		return movementSensorData{}, err
+		return s.MovementSensorDataset{}, err
 	}
 
 	expectedDataNum := len(data.AngVelData)
 	if expectedDataNum < NumMovementSensorData {
 		err = errors.Errorf("expected at least %v movement sensor readings for integration test", NumMovementSensorData)
-		return movementSensorData{}, err
+		return s.MovementSensorDataset{}, err
 	}
 
 	if expectedDataNum != len(data.LinAccData) &&
 		expectedDataNum != len(data.OrientationData) &&
 		expectedDataNum != len(data.PosData) {
 		err = errors.New("TEST FAILED TimedMovementSensorReading movement sensor readings don't contain same number of data")
-		return movementSensorData{}, err
+		return s.MovementSensorDataset{}, err
 	}
 
 	return data, nil
@@ -0,0 +1,66 @@
+// Package pcdtest provides helpers to build and read the PCDs of tests. It only depends on rdk, so that the tests
+// of every package can use it, including those of viamcartographer and the packages it depends on.
+package pcdtest
+
+import (
+	"bytes"
+	"sort"
+	"testing"
+
+	"github.com/golang/geo/r3"
+	"go.viam.com/rdk/pointcloud"
+	"go.viam.com/test"
+)
+
+// PointsToPCD encodes points, in millimeters, as a binary PCD, the format cartographer returns the pointcloud map
+// in.
+func PointsToPCD(tb testing.TB, points []r3.Vector) []byte {
+	tb.Helper()
+	return PointsToPCDWithFormat(tb, points, pointcloud.PCDBinary)
+}
+
+// PointsToPCDWithFormat encodes points, in millimeters, as a PCD of format.
+func PointsToPCDWithFormat(tb testing.TB, points []r3.Vector, format pointcloud.PCDType) []byte {
+	tb.Helper()
+	pc := pointcloud.New()
+	for _, p := range points {
+		test.That(tb, pc.Set(p, pointcloud.NewBasicData()), test.ShouldBeNil)
+	}
+	buf := new(bytes.Buffer)
+	test.That(tb, pointcloud.ToPCD(pc, buf, format), test.ShouldBeNil)
+	return buf.Bytes()
+}
+
+// SortedPoints returns the points of pcd, in millimeters, sorted by x, then y, then z.
+func SortedPoints(tb testing.TB, pcd []byte) []r3.Vector {
+	tb.Helper()
+	pc, err := pointcloud.ReadPCD(bytes.NewReader(pcd))
+	test.That(tb, err, test.ShouldBeNil)
+	var points []r3.Vector
+	pc.Iterate(0, 0, func(p r3.Vector, d pointcloud.Data) bool {
+		points = append(points, p)
+		return true
+	})
+	sort.Slice(points, func(i, j int) bool {
+		if points[i].X != points[j].X {
+			return points[i].X < points[j].X
+		}
+		if points[i].Y != points[j].Y {
+			return points[i].Y < points[j].Y
+		}
+		return points[i].Z < points[j].Z
+	})
+	return points
+}
+
+// GridPoints returns the points of a size x size grid, in millimeters, with spacing between neighboring points
+// and offset as its lower left corner.
+func GridPoints(size int, spacing float64, offset r3.Vector) []r3.Vector {
+	var points []r3.Vector
+	for i := 0; i < size; i++ {
+		for j := 0; j < size; j++ {
+			points = append(points, offset.Add(r3.Vector{X: float64(i) * spacing, Y: float64(j) * spacing}))
+		}
+	}
+	return points
+}
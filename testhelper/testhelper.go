@@ -28,7 +28,7 @@ import (
 )
 
 const (
-	// SlamTimeFormat is the timestamp format used in the dataprocess.
+	// SlamTimeFormat is the timestamp format of the names of internal state files in tests.
 	SlamTimeFormat = "2006-01-02T15:04:05.0000Z"
 	// CartoFacadeTimeoutForTest is the timeout used for capi requests for tests.
 	CartoFacadeTimeoutForTest = 5 * time.Second
@@ -0,0 +1,86 @@
+package viamcartographer
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/viam-modules/viam-cartographer/cartofacade"
+	"github.com/viam-modules/viam-cartographer/sensorprocess"
+)
+
+const (
+	// trajectoryNodeSizeBytes is an upper bound of the encoded size of a node.
+	trajectoryNodeSizeBytes = 512
+	// trajectoryNodesPerChunk keeps each response within the chunk size of the pointcloud map.
+	trajectoryNodesPerChunk = chunkSizeBytes / trajectoryNodeSizeBytes
+	// GetTrajectoryCommand is sent to DoCommand to get the pose history of the robot.
+	GetTrajectoryCommand = "get_trajectory"
+)
+
+// trajectoryRequest is the value of get_trajectory.
+type trajectoryRequest struct {
+	// SinceUnixMs, if set, is the time in unix milliseconds that only later nodes are returned after.
+	SinceUnixMs *int64 `json:"since_unix_ms"`
+	// Chunk is the index of the chunk of the nodes to return.
+	Chunk int `json:"chunk"`
+}
+
+// toWallClockTime converts the times of the nodes back to wall clock time if timestamps are rebased.
+func (cartoSvc *CartographerService) toWallClockTime(nodes []cartofacade.TrajectoryNode) []cartofacade.TrajectoryNode {
+	if cartoSvc.sessionClock == nil {
+		return nodes
+	}
+	startTime, started := cartoSvc.sessionClock.StartTime()
+	if !started {
+		return nodes
+	}
+	for i := range nodes {
+		nodes[i].Time = startTime.Add(nodes[i].Time.Sub(sensorprocess.SessionEpoch))
+	}
+	return nodes
+}
+
+// nodesSince returns the nodes that are later than since, keeping their order.
+func nodesSince(nodes []cartofacade.TrajectoryNode, since time.Time) []cartofacade.TrajectoryNode {
+	later := make([]cartofacade.TrajectoryNode, 0, len(nodes))
+	for _, node := range nodes {
+		if node.Time.After(since) {
+			later = append(later, node)
+		}
+	}
+	return later
+}
+
+// trajectoryChunk returns the chunk of index i of the nodes, converted to their get_trajectory format, and the
+// number of chunks. There is always at least one chunk, which is empty if there are no nodes.
+func trajectoryChunk(nodes []cartofacade.TrajectoryNode, i int) ([]interface{}, int, error) {
+	numChunks := max(1, (len(nodes)+trajectoryNodesPerChunk-1)/trajectoryNodesPerChunk)
+	if i >= numChunks {
+		return nil, 0, errors.Wrapf(ErrTrajectoryChunkOutOfRange, "chunk %d requested, the trajectory has %d chunks", i, numChunks)
+	}
+	start := i * trajectoryNodesPerChunk
+	end := min(start+trajectoryNodesPerChunk, len(nodes))
+	chunk := make([]interface{}, 0, end-start)
+	for _, node := range nodes[start:end] {
+		chunk = append(chunk, trajectoryNodeToMap(node))
+	}
+	return chunk, numChunks, nil
+}
+
+// trajectoryNodeToMap converts a node into its get_trajectory format.
+func trajectoryNodeToMap(node cartofacade.TrajectoryNode) map[string]interface{} {
+	point := node.Pose.Point()
+	orientation := node.Pose.Orientation().OrientationVectorDegrees()
+	return map[string]interface{}{
+		"trajectory_id": node.TrajectoryID,
+		"time_unix_ms":  node.Time.UnixMilli(),
+		"x":             point.X,
+		"y":             point.Y,
+		"z":             point.Z,
+		"o_x":           orientation.OX,
+		"o_y":           orientation.OY,
+		"o_z":           orientation.OZ,
+		"theta":         orientation.Theta,
+	}
+}
@@ -0,0 +1,134 @@
+package viamcartographer
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/golang/geo/r3"
+	"github.com/pkg/errors"
+	"go.viam.com/rdk/logging"
+	"go.viam.com/rdk/spatialmath"
+	"go.viam.com/test"
+
+	"github.com/viam-modules/viam-cartographer/cartofacade"
+	"github.com/viam-modules/viam-cartographer/sensorprocess"
+)
+
+func TestGetTrajectoryCommand(t *testing.T) {
+	var nodes []cartofacade.TrajectoryNode
+	var trajectoryErr error
+	mockCartoFacade := &cartofacade.Mock{}
+	mockCartoFacade.TrajectoryFunc = func(ctx context.Context, timeout time.Duration) ([]cartofacade.TrajectoryNode, error) {
+		// the service converts the times of the nodes in place
+		return append([]cartofacade.TrajectoryNode(nil), nodes...), trajectoryErr
+	}
+	svc := newTestService(mockCartoFacade, logging.NewTestLogger(t))
+	getTrajectory := func(val interface{}) map[string]interface{} {
+		resp, err := svc.DoCommand(context.Background(), map[string]interface{}{GetTrajectoryCommand: val})
+		test.That(t, err, test.ShouldBeNil)
+		return resp
+	}
+
+	t.Run("get_trajectory returns the time and pose of every node", func(t *testing.T) {
+		nodes = []cartofacade.TrajectoryNode{
+			{TrajectoryID: 0, Time: time.UnixMilli(1000), Pose: spatialmath.NewPoseFromPoint(r3.Vector{X: 100, Y: 200})},
+			{TrajectoryID: 1, Time: time.UnixMilli(2000), Pose: spatialmath.NewPose(
+				r3.Vector{X: -100}, &spatialmath.OrientationVectorDegrees{OZ: 1, Theta: 90})},
+		}
+		resp := getTrajectory(nil)
+		test.That(t, resp["chunk"], test.ShouldEqual, 0)
+		test.That(t, resp["num_chunks"], test.ShouldEqual, 1)
+		poses := resp[GetTrajectoryCommand].([]interface{})
+		test.That(t, len(poses), test.ShouldEqual, 2)
+
+		first := poses[0].(map[string]interface{})
+		test.That(t, first["trajectory_id"], test.ShouldEqual, 0)
+		test.That(t, first["time_unix_ms"], test.ShouldEqual, 1000)
+		test.That(t, first["x"], test.ShouldEqual, 100)
+		test.That(t, first["y"], test.ShouldEqual, 200)
+		test.That(t, first["o_z"], test.ShouldEqual, 1)
+		test.That(t, first["theta"], test.ShouldEqual, 0)
+
+		second := poses[1].(map[string]interface{})
+		test.That(t, second["trajectory_id"], test.ShouldEqual, 1)
+		test.That(t, second["time_unix_ms"], test.ShouldEqual, 2000)
+		test.That(t, second["x"], test.ShouldEqual, -100)
+		test.That(t, second["o_z"], test.ShouldAlmostEqual, 1)
+		test.That(t, second["theta"], test.ShouldAlmostEqual, 90)
+	})
+
+	t.Run("get_trajectory only returns the nodes later than since_unix_ms", func(t *testing.T) {
+		resp := getTrajectory(map[string]interface{}{"since_unix_ms": 1000})
+		poses := resp[GetTrajectoryCommand].([]interface{})
+		test.That(t, len(poses), test.ShouldEqual, 1)
+		test.That(t, poses[0].(map[string]interface{})["time_unix_ms"], test.ShouldEqual, 2000)
+
+		resp = getTrajectory(map[string]interface{}{"since_unix_ms": 2000})
+		test.That(t, resp[GetTrajectoryCommand], test.ShouldBeEmpty)
+		test.That(t, resp["num_chunks"], test.ShouldEqual, 1)
+	})
+
+	t.Run("get_trajectory returns wall clock times when timestamps are rebased", func(t *testing.T) {
+		svc.sessionClock = &sensorprocess.SessionClock{}
+		defer func() { svc.sessionClock = nil }()
+		startTime := time.UnixMilli(1_700_000_000_000)
+		svc.sessionClock.Rebase(startTime)
+		nodes = []cartofacade.TrajectoryNode{
+			{Time: sensorprocess.SessionEpoch.Add(1500 * time.Millisecond), Pose: spatialmath.NewZeroPose()},
+		}
+		resp := getTrajectory(map[string]interface{}{"since_unix_ms": startTime.UnixMilli()})
+		poses := resp[GetTrajectoryCommand].([]interface{})
+		test.That(t, len(poses), test.ShouldEqual, 1)
+		test.That(t, poses[0].(map[string]interface{})["time_unix_ms"], test.ShouldEqual, startTime.UnixMilli()+1500)
+	})
+
+	t.Run("get_trajectory returns large trajectories in chunks", func(t *testing.T) {
+		nodes = make([]cartofacade.TrajectoryNode, trajectoryNodesPerChunk+1)
+		for i := range nodes {
+			nodes[i] = cartofacade.TrajectoryNode{Time: time.UnixMilli(int64(i)), Pose: spatialmath.NewZeroPose()}
+		}
+		resp := getTrajectory(nil)
+		test.That(t, resp["num_chunks"], test.ShouldEqual, 2)
+		test.That(t, len(resp[GetTrajectoryCommand].([]interface{})), test.ShouldEqual, trajectoryNodesPerChunk)
+
+		resp = getTrajectory(map[string]interface{}{"chunk": 1})
+		test.That(t, resp["chunk"], test.ShouldEqual, 1)
+		poses := resp[GetTrajectoryCommand].([]interface{})
+		test.That(t, len(poses), test.ShouldEqual, 1)
+		test.That(t, poses[0].(map[string]interface{})["time_unix_ms"], test.ShouldEqual, trajectoryNodesPerChunk)
+
+		// the encoded size of a chunk stays within the chunk size of the pointcloud map
+		chunkJSON, err := json.Marshal(getTrajectory(nil))
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, len(chunkJSON), test.ShouldBeLessThanOrEqualTo, chunkSizeBytes)
+
+		resp, err = svc.DoCommand(context.Background(),
+			map[string]interface{}{GetTrajectoryCommand: map[string]interface{}{"chunk": 2}})
+		test.That(t, errors.Is(err, ErrTrajectoryChunkOutOfRange), test.ShouldBeTrue)
+		test.That(t, err.Error(), test.ShouldStartWith, "invalid argument for "+GetTrajectoryCommand+": ")
+		test.That(t, resp, test.ShouldBeNil)
+	})
+
+	t.Run("get_trajectory fails for an invalid request", func(t *testing.T) {
+		for _, val := range []interface{}{
+			"1000",
+			map[string]interface{}{"since_unix_ms": "1000"},
+			map[string]interface{}{"chunk": -1},
+			map[string]interface{}{"chunk": 0.5},
+		} {
+			resp, err := svc.DoCommand(context.Background(), map[string]interface{}{GetTrajectoryCommand: val})
+			test.That(t, errors.Is(err, ErrBadTrajectoryRequest), test.ShouldBeTrue)
+			test.That(t, err.Error(), test.ShouldStartWith, "invalid argument for "+GetTrajectoryCommand+": ")
+			test.That(t, resp, test.ShouldBeNil)
+		}
+	})
+
+	t.Run("get_trajectory returns the error of cartographer", func(t *testing.T) {
+		trajectoryErr = errors.New("VIAM_CARTO_NOT_IN_IO_INITIALIZED_STATE")
+		resp, err := svc.DoCommand(context.Background(), map[string]interface{}{GetTrajectoryCommand: nil})
+		test.That(t, err, test.ShouldBeError, trajectoryErr)
+		test.That(t, resp, test.ShouldBeNil)
+	})
+}
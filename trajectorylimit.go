@@ -0,0 +1,68 @@
+package viamcartographer
+
+import (
+	"context"
+	"sort"
+
+	"github.com/pkg/errors"
+
+	"github.com/viam-modules/viam-cartographer/cartofacade"
+)
+
+// enforceTrajectoryLimit checks the number of trajectories of cartographer's pose graph that are not frozen against
+// max_active_trajectories, which grows with every session of set_mode or an updated existing map. Past the limit,
+// the oldest of them are finished and frozen if freeze_oldest_on_limit is set, so that they stay in the pose graph
+// to localize against while the optimization no longer works on them, and are only warned about otherwise. The
+// trajectory sensor readings are added to is never frozen.
+func (cartoSvc *CartographerService) enforceTrajectoryLimit(ctx context.Context) {
+	if cartoSvc.maxActiveTrajectories == 0 {
+		return
+	}
+	trajectories, err := cartoSvc.cartofacade.Trajectories(ctx, cartoSvc.cartoFacadeTimeout)
+	if err != nil {
+		cartoSvc.logger.Warnw("could not check the number of active trajectories", "error", err)
+		return
+	}
+
+	var active []cartofacade.Trajectory
+	for _, trajectory := range trajectories {
+		if trajectory.State == cartofacade.TrajectoryActive || trajectory.State == cartofacade.TrajectoryFinished {
+			active = append(active, trajectory)
+		}
+	}
+	excess := len(active) - cartoSvc.maxActiveTrajectories
+	if excess <= 0 {
+		return
+	}
+	if !cartoSvc.freezeOldestOnLimit {
+		cartoSvc.logger.Warnw("there are more active trajectories than max_active_trajectories, which slows down "+
+			"the optimization of the pose graph. Set freeze_oldest_on_limit to freeze the oldest of them",
+			"active_trajectories", len(active),
+			"max_active_trajectories", cartoSvc.maxActiveTrajectories)
+		return
+	}
+
+	// trajectory ids are assigned in the order the trajectories were started
+	sort.Slice(active, func(i, j int) bool { return active[i].ID < active[j].ID })
+	for _, trajectory := range active {
+		if excess == 0 {
+			return
+		}
+		if trajectory.State == cartofacade.TrajectoryActive {
+			continue
+		}
+		err := cartoSvc.cartofacade.FreezeTrajectory(ctx, cartoSvc.cartoFacadeTimeout, trajectory.ID)
+		if errors.Is(err, cartofacade.ErrTrajectoryActive) {
+			continue
+		}
+		if err != nil {
+			cartoSvc.logger.Warnw("could not freeze the oldest active trajectory",
+				"trajectory_id", trajectory.ID, "error", err)
+			return
+		}
+		cartoSvc.logger.Infow("froze the oldest active trajectory as there are more than max_active_trajectories",
+			"trajectory_id", trajectory.ID,
+			"max_active_trajectories", cartoSvc.maxActiveTrajectories)
+		excess--
+	}
+}
@@ -0,0 +1,118 @@
+package viamcartographer
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.uber.org/zap/zaptest/observer"
+	"go.viam.com/rdk/logging"
+	"go.viam.com/rdk/resource"
+	"go.viam.com/rdk/services/slam"
+	"go.viam.com/test"
+
+	"github.com/viam-modules/viam-cartographer/cartofacade"
+	"github.com/viam-modules/viam-cartographer/sensors/inject"
+)
+
+func TestTrajectoryLimit(t *testing.T) {
+	const frozeMessage = "froze the oldest active trajectory"
+	const limitWarning = "more active trajectories than max_active_trajectories"
+	dataFrequencyHz := 5
+	lidar := &inject.TimedLidar{}
+	lidar.NameFunc = func() string { return "my-lidar" }
+	lidar.DataFrequencyHzFunc = func() int { return dataFrequencyHz }
+
+	// the mock pose graph finishes the current trajectory and starts a new one on every switch of the mode, as
+	// cartographer does
+	var poseGraph []cartofacade.Trajectory
+	mockCartoFacade := &cartofacade.Mock{}
+	mockCartoFacade.SetSlamModeFunc = func(ctx context.Context, timeout time.Duration, mode cartofacade.SlamMode) error {
+		poseGraph[len(poseGraph)-1].State = cartofacade.TrajectoryFinished
+		poseGraph = append(poseGraph, cartofacade.Trajectory{ID: len(poseGraph), State: cartofacade.TrajectoryActive})
+		return nil
+	}
+	mockCartoFacade.TrajectoriesFunc = func(ctx context.Context, timeout time.Duration) ([]cartofacade.Trajectory, error) {
+		return append([]cartofacade.Trajectory{}, poseGraph...), nil
+	}
+	var frozen []int
+	mockCartoFacade.FreezeTrajectoryFunc = func(ctx context.Context, timeout time.Duration, id int) error {
+		if poseGraph[id].State == cartofacade.TrajectoryActive {
+			return cartofacade.ErrTrajectoryActive
+		}
+		poseGraph[id].State = cartofacade.TrajectoryFrozen
+		frozen = append(frozen, id)
+		return nil
+	}
+	mockCartoFacade.SlamStatsFunc = func(ctx context.Context, timeout time.Duration) (cartofacade.SlamStats, error) {
+		return cartofacade.SlamStats{}, nil
+	}
+	newSvc := func(freezeOldestOnLimit bool) (*CartographerService, *observer.ObservedLogs) {
+		poseGraph = []cartofacade.Trajectory{{ID: 0, State: cartofacade.TrajectoryActive}}
+		frozen = nil
+		logger, obs := logging.NewObservedTestLogger(t)
+		return &CartographerService{
+			Named:                 resource.NewName(slam.API, "test").AsNamed(),
+			logger:                logger,
+			lidar:                 lidar,
+			cartofacade:           mockCartoFacade,
+			enableMapping:         true,
+			SlamMode:              cartofacade.MappingMode,
+			maxActiveTrajectories: 2,
+			freezeOldestOnLimit:   freezeOldestOnLimit,
+		}, obs
+	}
+	// every session after the first one starts with a switch of the mode
+	runSessions := func(t *testing.T, svc *CartographerService) {
+		t.Helper()
+		svc.enforceTrajectoryLimit(context.Background())
+		for _, mode := range []string{ModeLocalize, ModeMap} {
+			_, err := svc.DoCommand(context.Background(), map[string]interface{}{SetModeCommand: mode})
+			test.That(t, err, test.ShouldBeNil)
+		}
+	}
+
+	t.Run("freezes the oldest trajectory once the third session exceeds the limit", func(t *testing.T) {
+		svc, obs := newSvc(true)
+		runSessions(t, svc)
+		test.That(t, frozen, test.ShouldResemble, []int{0})
+		test.That(t, obs.FilterMessageSnippet(frozeMessage).Len(), test.ShouldEqual, 1)
+		test.That(t, obs.FilterMessageSnippet(limitWarning).Len(), test.ShouldEqual, 0)
+
+		resp, err := svc.DoCommand(context.Background(), map[string]interface{}{SlamStatsCommand: ""})
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, resp[TrajectoriesKey], test.ShouldResemble, []interface{}{
+			map[string]interface{}{"id": 0, "state": "frozen"},
+			map[string]interface{}{"id": 1, "state": "finished"},
+			map[string]interface{}{"id": 2, "state": "active"},
+		})
+	})
+
+	t.Run("only warns when freeze_oldest_on_limit is not set", func(t *testing.T) {
+		svc, obs := newSvc(false)
+		runSessions(t, svc)
+		test.That(t, frozen, test.ShouldBeEmpty)
+		test.That(t, obs.FilterMessageSnippet(limitWarning).Len(), test.ShouldEqual, 1)
+	})
+
+	t.Run("never freezes the trajectory sensor readings are added to", func(t *testing.T) {
+		svc, obs := newSvc(true)
+		svc.maxActiveTrajectories = 1
+		poseGraph = []cartofacade.Trajectory{
+			{ID: 0, State: cartofacade.TrajectoryActive},
+			{ID: 1, State: cartofacade.TrajectoryFinished},
+			{ID: 2, State: cartofacade.TrajectoryFinished},
+		}
+		svc.enforceTrajectoryLimit(context.Background())
+		test.That(t, frozen, test.ShouldResemble, []int{1, 2})
+		test.That(t, poseGraph[0].State, test.ShouldEqual, cartofacade.TrajectoryActive)
+		test.That(t, obs.FilterMessageSnippet(frozeMessage).Len(), test.ShouldEqual, 2)
+	})
+
+	t.Run("does nothing without max_active_trajectories", func(t *testing.T) {
+		svc, _ := newSvc(true)
+		svc.maxActiveTrajectories = 0
+		runSessions(t, svc)
+		test.That(t, frozen, test.ShouldBeEmpty)
+	})
+}
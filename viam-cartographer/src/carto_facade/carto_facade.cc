@@ -1,13 +1,26 @@
 // This is an experimental integration of cartographer into RDK.
 #include "carto_facade.h"
 
+#include <algorithm>
 #include <boost/dll/runtime_symbol_info.hpp>
 #include <boost/filesystem.hpp>
 #include <boost/format.hpp>
 #include <boost/uuid/uuid.hpp>             // uuid class
 #include <boost/uuid/uuid_generators.hpp>  // generators
 #include <boost/uuid/uuid_io.hpp>
-
+#include <fstream>
+
+#if defined(__GLIBC__)
+#include <malloc.h>
+#elif defined(__APPLE__)
+#include <malloc/malloc.h>
+#endif
+
+#include "cartographer/common/math.h"
+#include "cartographer/io/internal/mapping_state_serialization.h"
+#include "cartographer/io/proto_stream.h"
+#include "cartographer/io/serialization_format_migration.h"
+#include "cartographer/mapping/proto/serialization.pb.h"
 #include "glog/logging.h"
 #include "map_builder.h"
 #include "util.h"
@@ -66,6 +79,141 @@ int calculate_probability_from_color_channels(ColorARGB pixel_color) {
     return prob;
 }
 
+// fill_submap_slice unpacks the texture of a submap queried from the map
+// builder into submap_slice, so that it can be painted
+void fill_submap_slice(
+    const cartographer::mapping::PoseGraphInterface::SubmapPose &submap_pose,
+    const cartographer::mapping::proto::SubmapQuery::Response &response_proto,
+    ::cartographer::io::SubmapSlice &submap_slice) {
+    auto submap_textures =
+        absl::make_unique<::cartographer::io::SubmapTextures>();
+    submap_textures->version = response_proto.submap_version();
+    for (const auto &texture_proto : response_proto.textures()) {
+        const std::string compressed_cells(texture_proto.cells().begin(),
+                                           texture_proto.cells().end());
+        submap_textures->textures.emplace_back(
+            ::cartographer::io::SubmapTexture{
+                ::cartographer::io::UnpackTextureData(compressed_cells,
+                                                      texture_proto.width(),
+                                                      texture_proto.height()),
+                texture_proto.width(), texture_proto.height(),
+                texture_proto.resolution(),
+                cartographer::transform::ToRigid3(texture_proto.slice_pose())});
+    }
+
+    const auto fetched_texture = submap_textures->textures.begin();
+    submap_slice.pose = submap_pose.pose;
+    submap_slice.width = fetched_texture->width;
+    submap_slice.height = fetched_texture->height;
+    submap_slice.slice_pose = fetched_texture->slice_pose;
+    submap_slice.resolution = fetched_texture->resolution;
+    submap_slice.cairo_data.clear();
+
+    submap_slice.surface = ::cartographer::io::DrawTexture(
+        fetched_texture->pixels.intensity, fetched_texture->pixels.alpha,
+        fetched_texture->width, fetched_texture->height,
+        &submap_slice.cairo_data);
+}
+
+// painted_slices_to_pcd samples painted submap slices into a binary pcd with
+// a point, in meters, at the center of every observed pixel whose
+// probability of being occupied is not 0
+std::string painted_slices_to_pcd(
+    cartographer::io::PaintSubmapSlicesResult &painted_slices) {
+    // Get data from painted surface in ARGB32 format
+    auto painted_surface = painted_slices.surface.get();
+    auto image_format = cairo_image_surface_get_format(painted_surface);
+    if (image_format != cartographer::io::kCairoFormat) {
+        std::string error_log =
+            "Error cairo surface in wrong format, expected Cairo_Format_ARGB32";
+        LOG(ERROR) << error_log;
+        throw std::runtime_error(error_log);
+    }
+    int width = cairo_image_surface_get_width(painted_surface);
+    int height = cairo_image_surface_get_height(painted_surface);
+    auto image_data_ptr = cairo_image_surface_get_data(painted_surface);
+
+    // Get pixel containing map origin (0, 0)
+    float origin_pixel_x = painted_slices.origin.x();
+    float origin_pixel_y = painted_slices.origin.y();
+
+    // Iterate over image data and add to pointcloud buffer
+    int num_points = 0;
+    std::string pcd_data;
+    for (int pixel_y = 0; pixel_y < height; pixel_y++) {
+        for (int pixel_x = 0; pixel_x < width; pixel_x++) {
+            // Get byte index associated with pixel
+            int pixel_index = pixel_x + pixel_y * width;
+            int byte_index = pixel_index * bytesPerPixel;
+
+            // We assume we are running on a little-endian system, so the ARGB
+            // order is reversed
+            ColorARGB pixel_color;
+            pixel_color.A = image_data_ptr[byte_index + 3];
+            pixel_color.R = image_data_ptr[byte_index + 2];
+            pixel_color.G = image_data_ptr[byte_index + 1];
+            pixel_color.B = image_data_ptr[byte_index + 0];
+
+            // Skip pixel if it contains empty data (default color)
+            if (check_if_empty_pixel(pixel_color)) {
+                continue;
+            }
+
+            // Determine probability based on the color of the pixel and skip if
+            // it is 0
+            int prob = calculate_probability_from_color_channels(pixel_color);
+            if (prob == 0) {
+                continue;
+            }
+
+            // Convert pixel location to pointcloud point in meters
+            float x_pos = (pixel_x - origin_pixel_x) * resolutionMeters;
+            // Y is inverted to match output from getPosition()
+            float y_pos = -(pixel_y - origin_pixel_y) * resolutionMeters;
+            float z_pos = 0;  // Z is 0 in 2D SLAM
+
+            // Add point to buffer
+            viam::carto_facade::util::write_float_to_buffer_in_bytes(pcd_data,
+                                                                     x_pos);
+            viam::carto_facade::util::write_float_to_buffer_in_bytes(pcd_data,
+                                                                     y_pos);
+            viam::carto_facade::util::write_float_to_buffer_in_bytes(pcd_data,
+                                                                     z_pos);
+            viam::carto_facade::util::write_int_to_buffer_in_bytes(pcd_data,
+                                                                   prob);
+
+            num_points++;
+        }
+    }
+
+    // Write our PCD file, which is written as a binary.
+    std::string pointcloud =
+        viam::carto_facade::util::pcd_header(num_points, true);
+
+    // Writes data buffer to the pointcloud string
+    pointcloud += pcd_data;
+    return pointcloud;
+}
+
+viam_carto_submap to_viam_carto_submap(
+    const cartographer::mapping::SubmapId &submap_id,
+    const cartographer::mapping::PoseGraphInterface::SubmapPose &submap_pose) {
+    auto pos_vector = submap_pose.pose.translation();
+    auto pos_quat = submap_pose.pose.rotation();
+    viam_carto_submap s;
+    s.trajectory_id = submap_id.trajectory_id;
+    s.submap_index = submap_id.submap_index;
+    s.version = submap_pose.version;
+    s.x = pos_vector.x() * 1000;
+    s.y = pos_vector.y() * 1000;
+    s.z = pos_vector.z() * 1000;
+    s.real = pos_quat.w();
+    s.imag = pos_quat.x();
+    s.jmag = pos_quat.y();
+    s.kmag = pos_quat.z();
+    return s;
+}
+
 std::ostream &operator<<(std::ostream &os,
                          const viam::carto_facade::SlamMode &slam_mode) {
     std::string slam_mode_str;
@@ -114,16 +262,61 @@ config from_viam_carto_config(viam_carto_config vcc) {
     c.movement_sensor = to_std_string(vcc.movement_sensor);
     c.enable_mapping = vcc.enable_mapping;
     c.existing_map = to_std_string(vcc.existing_map);
+    c.floor_plan = to_std_string(vcc.floor_plan);
+    c.floor_plan_resolution = vcc.floor_plan_resolution;
     c.lidar_config = vcc.lidar_config;
 
     if (c.camera.empty()) {
         throw VIAM_CARTO_LIDAR_CONFIG_INVALID;
     }
+    if (vcc.additional_cameras != nullptr) {
+        for (int i = 0; i < vcc.additional_cameras->qty; i++) {
+            std::string camera =
+                to_std_string(vcc.additional_cameras->entry[i]);
+            if (camera.empty() || camera == c.camera ||
+                std::find(c.additional_cameras.begin(),
+                          c.additional_cameras.end(),
+                          camera) != c.additional_cameras.end()) {
+                throw VIAM_CARTO_LIDAR_CONFIG_INVALID;
+            }
+            c.additional_cameras.push_back(camera);
+        }
+    }
     validate_lidar_config(c.lidar_config);
 
+    c.sensor_streams = vcc.sensor_streams;
+    switch (c.sensor_streams) {
+        case VIAM_CARTO_SENSOR_STREAMS_UNSPECIFIED:
+            break;
+        case VIAM_CARTO_LIDAR_ONLY:
+            if (!c.movement_sensor.empty()) {
+                throw VIAM_CARTO_SENSOR_STREAMS_INVALID;
+            }
+            break;
+        case VIAM_CARTO_LIDAR_AND_MOVEMENT_SENSOR:
+            if (c.movement_sensor.empty()) {
+                throw VIAM_CARTO_SENSOR_STREAMS_INVALID;
+            }
+            break;
+        default:
+            throw VIAM_CARTO_SENSOR_STREAMS_INVALID;
+    }
+
+    if (!c.floor_plan.empty()) {
+        // a floor plan is a 2D map & replaces the existing map
+        if (!c.existing_map.empty() || c.floor_plan_resolution <= 0 ||
+            c.lidar_config != VIAM_CARTO_TWO_D) {
+            throw VIAM_CARTO_FLOOR_PLAN_INVALID;
+        }
+    }
+
     return c;
 };
 
+std::string additional_range_sensor_id(const std::string &camera) {
+    return kRangeSensorId.id + "/" + camera;
+}
+
 std::string find_lua_files() {
     auto programLocation = boost::dll::program_location();
     auto localRelativePathToLuas = programLocation.parent_path().parent_path();
@@ -178,7 +371,7 @@ CartoFacade::CartoFacade(viam_carto_lib *pVCL, const viam_carto_config c,
     path_to_internal_state_file = config.existing_map;
 };
 
-CartoFacade::~CartoFacade() {}
+CartoFacade::~CartoFacade() { JoinInitialOptimization(); }
 
 void CartoFacade::IOInit() {
     if (state != CartoFacadeState::INITIALIZED) {
@@ -186,8 +379,9 @@ void CartoFacade::IOInit() {
                    << CartoFacadeState::INITIALIZED;
         throw VIAM_CARTO_NOT_IN_INITIALIZED_STATE;
     }
-    slam_mode =
-        determine_slam_mode(path_to_internal_state_file, config.enable_mapping);
+    slam_mode = determine_slam_mode(
+        !path_to_internal_state_file.empty() || !config.floor_plan.empty(),
+        config.enable_mapping);
 
     VLOG(1) << "slam mode: " << slam_mode;
     auto cd = find_lua_files();
@@ -225,6 +419,10 @@ void CartoFacade::IOInit() {
             algo_config.occupied_space_weight);
         map_builder.OverwriteTranslationWeight(algo_config.translation_weight);
         map_builder.OverwriteRotationWeight(algo_config.rotation_weight);
+        if (algo_config.final_optimization_iterations > 0) {
+            map_builder.OverwriteMaxNumFinalIterations(
+                algo_config.final_optimization_iterations);
+        }
 
         if (algo_config.has_initial_trajectory_pose) {
             if (slam_mode == viam::carto_facade::SlamMode::MAPPING) {
@@ -235,6 +433,24 @@ void CartoFacade::IOInit() {
                     algo_config.initial_trajectory_pose_x,
                     algo_config.initial_trajectory_pose_y,
                     algo_config.initial_trajectory_pose_theta);
+                if (algo_config.has_initial_trajectory_pose_sigma &&
+                    slam_mode == viam::carto_facade::SlamMode::LOCALIZING) {
+                    // cartographer does not take the covariance of the
+                    // initial pose, so the first readings are searched for
+                    // within three standard deviations of it instead. The
+                    // constraint search windows are not widened, as they
+                    // would stay widened for the rest of the session. Only
+                    // the localization trajectory, which is not part of the
+                    // map, can be restarted where the readings match.
+                    double sigma_xy =
+                        std::max(algo_config.initial_trajectory_pose_sigma_x,
+                                 algo_config.initial_trajectory_pose_sigma_y);
+                    relocalization_linear_search_window = 3 * sigma_xy;
+                    relocalization_angular_search_window =
+                        3 * cartographer::common::DegToRad(
+                                algo_config.initial_trajectory_pose_sigma_theta);
+                    relocalization_readings_left = kRelocalizationReadings;
+                }
             }
         }
 
@@ -243,33 +459,39 @@ void CartoFacade::IOInit() {
 
     if (slam_mode == viam::carto_facade::SlamMode::UPDATING ||
         slam_mode == viam::carto_facade::SlamMode::LOCALIZING) {
-        // Check if apriori map file exists
-        std::ifstream f(path_to_internal_state_file);
-        if (!f.good()) {
-            throw VIAM_CARTO_INTERNAL_STATE_FILE_SYSTEM_ERROR;
-        }
         // load_frozen_trajectory has to be true for LOCALIZING slam mode,
         // and false for UPDATING slam mode.
         bool load_frozen_trajectory =
             (slam_mode == viam::carto_facade::SlamMode::LOCALIZING);
-        if (algo_config.optimize_on_start) {
-            VLOG(1) << "running optimize_on_start";
-            CacheLatestMap();
-
-            std::unique_lock optimization_lock{optimization_shared_mutex,
-                                               std::defer_lock};
-            optimization_lock.lock();
-            // Load apriori map (internal state)
-            std::lock_guard<std::mutex> lk(map_builder_mutex);
-            map_builder.LoadMapFromFile(config.existing_map,
-                                        load_frozen_trajectory,
-                                        algo_config.optimize_on_start);
+        if (!config.floor_plan.empty()) {
+            // a floor plan is a single submap, so there is nothing to
+            // optimize on start
+            LoadFloorPlan(load_frozen_trajectory);
         } else {
-            // Load apriori map (internal state)
-            std::lock_guard<std::mutex> lk(map_builder_mutex);
-            map_builder.LoadMapFromFile(config.existing_map,
-                                        load_frozen_trajectory,
-                                        algo_config.optimize_on_start);
+            // Check if apriori map file exists
+            std::ifstream f(path_to_internal_state_file);
+            if (!f.good()) {
+                throw VIAM_CARTO_INTERNAL_STATE_FILE_SYSTEM_ERROR;
+            }
+            if (algo_config.optimize_on_start) {
+                VLOG(1) << "running optimize_on_start";
+                CacheLatestMap();
+
+                std::unique_lock optimization_lock{optimization_shared_mutex,
+                                                   std::defer_lock};
+                optimization_lock.lock();
+                // Load apriori map (internal state)
+                std::lock_guard<std::mutex> lk(map_builder_mutex);
+                map_builder.LoadMapFromFile(config.existing_map,
+                                            load_frozen_trajectory,
+                                            algo_config.optimize_on_start);
+            } else {
+                // Load apriori map (internal state)
+                std::lock_guard<std::mutex> lk(map_builder_mutex);
+                map_builder.LoadMapFromFile(config.existing_map,
+                                            load_frozen_trajectory,
+                                            algo_config.optimize_on_start);
+            }
         }
 
         CacheMapInLocalizationMode();
@@ -277,11 +499,37 @@ void CartoFacade::IOInit() {
 
     {
         std::lock_guard<std::mutex> lk(map_builder_mutex);
+        std::vector<std::string> additional_range_sensor_ids;
+        for (const auto &camera : config.additional_cameras) {
+            additional_range_sensor_ids.push_back(
+                additional_range_sensor_id(camera));
+        }
+        map_builder.SetAdditionalRangeSensors(additional_range_sensor_ids);
         map_builder.StartTrajectoryBuilder(algo_config.use_imu_data);
     }
     state = CartoFacadeState::IO_INITIALIZED;
 };
 
+void CartoFacade::LoadFloorPlan(bool load_frozen_trajectory) {
+    VLOG(1) << "LoadFloorPlan() resolution: " << config.floor_plan_resolution
+            << " load_frozen_trajectory: " << load_frozen_trajectory;
+    std::vector<Eigen::Vector2f> positions;
+    std::vector<float> probabilities;
+    if (!viam::carto_facade::util::probability_grid_cells(
+            config.floor_plan, positions, probabilities)) {
+        LOG(ERROR) << "floor plan is not a valid probability grid pcd";
+        throw VIAM_CARTO_FLOOR_PLAN_INVALID;
+    }
+    if (positions.empty()) {
+        LOG(ERROR) << "floor plan has no known cells";
+        throw VIAM_CARTO_FLOOR_PLAN_INVALID;
+    }
+    std::lock_guard<std::mutex> lk(map_builder_mutex);
+    map_builder.LoadFloorPlan(positions, probabilities,
+                              config.floor_plan_resolution,
+                              load_frozen_trajectory);
+}
+
 void CartoFacade::CacheLatestMap() {
     VLOG(1) << "CacheLatestMap()";
     std::string pointcloud_map_tmp;
@@ -361,40 +609,9 @@ CartoFacade::GetLatestPaintedMapSlices() {
     }
 
     for (const auto &&submap_id_pose : submap_poses) {
-        auto submap_textures =
-            absl::make_unique<::cartographer::io::SubmapTextures>();
-        submap_textures->version =
-            response_protos[submap_id_pose.id].submap_version();
-        for (const auto &texture_proto :
-             response_protos[submap_id_pose.id].textures()) {
-            const std::string compressed_cells(texture_proto.cells().begin(),
-                                               texture_proto.cells().end());
-            submap_textures->textures.emplace_back(
-                ::cartographer::io::SubmapTexture{
-                    ::cartographer::io::UnpackTextureData(
-                        compressed_cells, texture_proto.width(),
-                        texture_proto.height()),
-                    texture_proto.width(), texture_proto.height(),
-                    texture_proto.resolution(),
-                    cartographer::transform::ToRigid3(
-                        texture_proto.slice_pose())});
-        }
-
-        // Prepares SubmapSlice
-        ::cartographer::io::SubmapSlice &submap_slice =
-            submap_slices[submap_id_pose.id];
-        const auto fetched_texture = submap_textures->textures.begin();
-        submap_slice.pose = submap_id_pose.data.pose;
-        submap_slice.width = fetched_texture->width;
-        submap_slice.height = fetched_texture->height;
-        submap_slice.slice_pose = fetched_texture->slice_pose;
-        submap_slice.resolution = fetched_texture->resolution;
-        submap_slice.cairo_data.clear();
-
-        submap_slice.surface = ::cartographer::io::DrawTexture(
-            fetched_texture->pixels.intensity, fetched_texture->pixels.alpha,
-            fetched_texture->width, fetched_texture->height,
-            &submap_slice.cairo_data);
+        fill_submap_slice(submap_id_pose.data,
+                          response_protos[submap_id_pose.id],
+                          submap_slices[submap_id_pose.id]);
     }
     cartographer::io::PaintSubmapSlicesResult painted_slices =
         cartographer::io::PaintSubmapSlices(submap_slices, resolutionMeters);
@@ -422,78 +639,7 @@ void CartoFacade::GetLatestSampledPointCloudMapString(std::string &pointcloud) {
         }
     }
 
-    // Get data from painted surface in ARGB32 format
-    auto painted_surface = painted_slices->surface.get();
-    auto image_format = cairo_image_surface_get_format(painted_surface);
-    if (image_format != cartographer::io::kCairoFormat) {
-        std::string error_log =
-            "Error cairo surface in wrong format, expected Cairo_Format_ARGB32";
-        LOG(ERROR) << error_log;
-        throw std::runtime_error(error_log);
-    }
-    int width = cairo_image_surface_get_width(painted_surface);
-    int height = cairo_image_surface_get_height(painted_surface);
-    auto image_data_ptr = cairo_image_surface_get_data(painted_surface);
-
-    // Get pixel containing map origin (0, 0)
-    float origin_pixel_x = painted_slices->origin.x();
-    float origin_pixel_y = painted_slices->origin.y();
-
-    // Iterate over image data and add to pointcloud buffer
-    int num_points = 0;
-    std::string pcd_data;
-    for (int pixel_y = 0; pixel_y < height; pixel_y++) {
-        for (int pixel_x = 0; pixel_x < width; pixel_x++) {
-            // Get byte index associated with pixel
-            int pixel_index = pixel_x + pixel_y * width;
-            int byte_index = pixel_index * bytesPerPixel;
-
-            // We assume we are running on a little-endian system, so the ARGB
-            // order is reversed
-            ColorARGB pixel_color;
-            pixel_color.A = image_data_ptr[byte_index + 3];
-            pixel_color.R = image_data_ptr[byte_index + 2];
-            pixel_color.G = image_data_ptr[byte_index + 1];
-            pixel_color.B = image_data_ptr[byte_index + 0];
-
-            // Skip pixel if it contains empty data (default color)
-            if (check_if_empty_pixel(pixel_color)) {
-                continue;
-            }
-
-            // Determine probability based on the color of the pixel and skip if
-            // it is 0
-            int prob = calculate_probability_from_color_channels(pixel_color);
-            if (prob == 0) {
-                continue;
-            }
-
-            // Convert pixel location to pointcloud point in meters
-            float x_pos = (pixel_x - origin_pixel_x) * resolutionMeters;
-            // Y is inverted to match output from getPosition()
-            float y_pos = -(pixel_y - origin_pixel_y) * resolutionMeters;
-            float z_pos = 0;  // Z is 0 in 2D SLAM
-
-            // Add point to buffer
-            viam::carto_facade::util::write_float_to_buffer_in_bytes(pcd_data,
-                                                                     x_pos);
-            viam::carto_facade::util::write_float_to_buffer_in_bytes(pcd_data,
-                                                                     y_pos);
-            viam::carto_facade::util::write_float_to_buffer_in_bytes(pcd_data,
-                                                                     z_pos);
-            viam::carto_facade::util::write_int_to_buffer_in_bytes(pcd_data,
-                                                                   prob);
-
-            num_points++;
-        }
-    }
-
-    // Write our PCD file, which is written as a binary.
-    pointcloud = viam::carto_facade::util::pcd_header(num_points, true);
-
-    // Writes data buffer to the pointcloud string
-    pointcloud += pcd_data;
-    return;
+    pointcloud = painted_slices_to_pcd(*painted_slices);
 }
 
 void CartoFacade::RunFinalOptimization() {
@@ -537,6 +683,7 @@ void CartoFacade::GetPosition(viam_carto_get_position_response *r) {
     r->imag = pos_quat.x();
     r->jmag = pos_quat.y();
     r->kmag = pos_quat.z();
+    r->confidence = map_builder.GetMatchConfidence();
 };
 
 void CartoFacade::GetPointCloudMap(viam_carto_get_point_cloud_map_response *r) {
@@ -583,25 +730,28 @@ void CartoFacade::GetPointCloudMap(viam_carto_get_point_cloud_map_response *r) {
 // the internal state.
 // This is the ticket to remove that failure mode:
 // https://viam.atlassian.net/browse/RSDK-3878
-void CartoFacade::GetInternalState(viam_carto_get_internal_state_response *r) {
-    if (state != CartoFacadeState::STARTED) {
-        LOG(ERROR) << "carto facade is in state: " << state << " expected "
-                   << CartoFacadeState::STARTED;
-        throw VIAM_CARTO_NOT_IN_STARTED_STATE;
-    }
+std::string CartoFacade::SaveInternalStateToTempFile() {
     boost::uuids::uuid uuid = boost::uuids::random_generator()();
 
     std::string filename = "/tmp/temp_internal_state_" +
                            boost::uuids::to_string(uuid) + ".pbstream";
 
-    {
-        std::lock_guard<std::mutex> lk(map_builder_mutex);
-        bool ok = map_builder.SaveMapToFile(true, filename);
-        if (!ok) {
-            LOG(ERROR) << "Failed to save the internal state as a pbstream.";
-            throw VIAM_CARTO_GET_INTERNAL_STATE_FILE_WRITE_IO_ERROR;
-        }
+    std::lock_guard<std::mutex> lk(map_builder_mutex);
+    bool ok = map_builder.SaveMapToFile(true, filename);
+    if (!ok) {
+        LOG(ERROR) << "Failed to save the internal state as a pbstream.";
+        throw VIAM_CARTO_GET_INTERNAL_STATE_FILE_WRITE_IO_ERROR;
     }
+    return filename;
+}
+
+void CartoFacade::GetInternalState(viam_carto_get_internal_state_response *r) {
+    if (state != CartoFacadeState::STARTED) {
+        LOG(ERROR) << "carto facade is in state: " << state << " expected "
+                   << CartoFacadeState::STARTED;
+        throw VIAM_CARTO_NOT_IN_STARTED_STATE;
+    }
+    std::string filename = SaveInternalStateToTempFile();
 
     std::string internal_state;
     try {
@@ -615,84 +765,509 @@ void CartoFacade::GetInternalState(viam_carto_get_internal_state_response *r) {
     r->internal_state = to_bstring(internal_state);
 };
 
-void CartoFacade::Start() {
-    if (state != CartoFacadeState::IO_INITIALIZED) {
-        LOG(ERROR) << "carto facade is in state: " << state << " expected "
-                   << CartoFacadeState::IO_INITIALIZED;
-        throw VIAM_CARTO_NOT_IN_IO_INITIALIZED_STATE;
-    }
-    state = CartoFacadeState::STARTED;
-};
-
-void CartoFacade::Stop() {
+InternalStateStream *CartoFacade::GetInternalStateStream() {
     if (state != CartoFacadeState::STARTED) {
         LOG(ERROR) << "carto facade is in state: " << state << " expected "
                    << CartoFacadeState::STARTED;
         throw VIAM_CARTO_NOT_IN_STARTED_STATE;
     }
-    state = CartoFacadeState::IO_INITIALIZED;
+    std::string filename = SaveInternalStateToTempFile();
+
+    auto stream = std::make_unique<InternalStateStream>();
+    stream->filename = filename;
+    stream->file.open(filename, std::ios::binary);
+    if (!stream->file.is_open()) {
+        LOG(ERROR) << "Failed to open internal state file: " << filename;
+        std::remove(filename.c_str());
+        throw VIAM_CARTO_GET_INTERNAL_STATE_FILE_READ_IO_ERROR;
+    }
+    return stream.release();
 };
 
-void CartoFacade::AddLidarReading(const viam_carto_lidar_reading *sr) {
-    if (state != CartoFacadeState::STARTED) {
+void CartoFacade::GetAlgoConfig(viam_carto_algo_config *ac) {
+    if (state == CartoFacadeState::INITIALIZED) {
         LOG(ERROR) << "carto facade is in state: " << state
                    << " expected it to be in state: "
+                   << CartoFacadeState::IO_INITIALIZED << " or "
                    << CartoFacadeState::STARTED;
-        throw VIAM_CARTO_NOT_IN_STARTED_STATE;
+        throw VIAM_CARTO_NOT_IN_IO_INITIALIZED_STATE;
     }
-
-    bstring camera_sensor = to_bstring(config.camera);
-    bool known_sensor = biseq(camera_sensor, sr->lidar);
-    bdestroy(camera_sensor);
-    if (!known_sensor) {
-        VLOG(1) << "expected sensor: " << to_std_string(sr->lidar) << " to be "
-                << config.camera;
-        throw VIAM_CARTO_UNKNOWN_SENSOR_NAME;
+    // values which are not map builder options are reported as requested
+    *ac = algo_config;
+    {
+        std::lock_guard<std::mutex> lk(map_builder_mutex);
+        ac->optimize_every_n_nodes = map_builder.GetOptimizeEveryNNodes();
+        ac->num_range_data = map_builder.GetNumRangeData();
+        ac->missing_data_ray_length = map_builder.GetMissingDataRayLength();
+        ac->max_range = map_builder.GetMaxRange();
+        ac->min_range = map_builder.GetMinRange();
+        ac->use_imu_data = map_builder.GetUseIMUData();
+        ac->max_submaps_to_keep = map_builder.GetMaxSubmapsToKeep();
+        ac->fresh_submaps_count = map_builder.GetFreshSubmapsCount();
+        ac->min_covered_area = map_builder.GetMinCoveredArea();
+        ac->min_added_submaps_count = map_builder.GetMinAddedSubmapsCount();
+        ac->occupied_space_weight = map_builder.GetOccupiedSpaceWeight();
+        ac->translation_weight = map_builder.GetTranslationWeight();
+        ac->rotation_weight = map_builder.GetRotationWeight();
+        if (algo_config.final_optimization_iterations > 0) {
+            ac->final_optimization_iterations =
+                map_builder.GetMaxNumFinalIterations();
+        }
     }
+};
 
-    std::string lidar_reading = to_std_string(sr->lidar_reading);
-    if (lidar_reading.length() == 0) {
-        throw VIAM_CARTO_LIDAR_READING_EMPTY;
+int to_viam_carto_trajectory_state(
+    cartographer::mapping::PoseGraphInterface::TrajectoryState state) {
+    switch (state) {
+        case cartographer::mapping::PoseGraphInterface::TrajectoryState::
+            ACTIVE:
+            return VIAM_CARTO_TRAJECTORY_STATE_ACTIVE;
+        case cartographer::mapping::PoseGraphInterface::TrajectoryState::
+            FINISHED:
+            return VIAM_CARTO_TRAJECTORY_STATE_FINISHED;
+        case cartographer::mapping::PoseGraphInterface::TrajectoryState::
+            FROZEN:
+            return VIAM_CARTO_TRAJECTORY_STATE_FROZEN;
+        case cartographer::mapping::PoseGraphInterface::TrajectoryState::
+            DELETED:
+            return VIAM_CARTO_TRAJECTORY_STATE_DELETED;
+        default:
+            throw VIAM_CARTO_UNKNOWN_ERROR;
     }
+}
 
-    int64_t lidar_reading_time_unix_milli = sr->lidar_reading_time_unix_milli;
-    auto [success, measurement] = viam::carto_facade::util::carto_lidar_reading(
-        lidar_reading, lidar_reading_time_unix_milli);
-    if (!success) {
-        throw VIAM_CARTO_LIDAR_READING_INVALID;
+void CartoFacade::StartNewTrajectory(
+    const viam_carto_start_new_trajectory_request *req,
+    viam_carto_start_new_trajectory_response *r) {
+    if (state == CartoFacadeState::INITIALIZED) {
+        LOG(ERROR) << "carto facade is in state: " << state
+                   << " expected it to be in state: "
+                   << CartoFacadeState::IO_INITIALIZED << " or "
+                   << CartoFacadeState::STARTED;
+        throw VIAM_CARTO_NOT_IN_IO_INITIALIZED_STATE;
     }
-
-    cartographer::transform::Rigid3d tmp_global_pose;
-
-    if (map_builder_mutex.try_lock()) {
-        VLOG(1) << "AddSensorData timestamp: " << measurement.time
-                << " Sensor type: Lidar "
-                << " measurement.ranges.size(): " << measurement.ranges.size();
-        map_builder.AddSensorData(kRangeSensorId.id, measurement);
-        tmp_global_pose = map_builder.GetGlobalPose();
-        map_builder_mutex.unlock();
-        {
-            std::lock_guard<std::mutex> lk(viam_response_mutex);
-            latest_global_pose = tmp_global_pose;
-        }
-        return;
-    } else {
-        throw VIAM_CARTO_UNABLE_TO_ACQUIRE_LOCK;
+    {
+        std::lock_guard<std::mutex> lk(map_builder_mutex);
+        r->finished_trajectory_id = map_builder.StartNewTrajectory(
+            algo_config.use_imu_data, req->has_initial_pose,
+            req->initial_pose_x, req->initial_pose_y,
+            req->initial_pose_theta);
+        r->trajectory_id = map_builder.trajectory_id;
+    }
+    {
+        std::lock_guard<std::mutex> lk(viam_response_mutex);
+        latest_global_pose = cartographer::transform::Rigid3d();
     }
+    LOG(INFO) << "finished trajectory " << r->finished_trajectory_id
+              << " and started trajectory " << r->trajectory_id;
 };
 
-void CartoFacade::AddIMUReading(const viam_carto_imu_reading *sr) {
-    if (state != CartoFacadeState::STARTED) {
+void CartoFacade::FreezeTrajectory(int trajectory_id) {
+    if (state == CartoFacadeState::INITIALIZED) {
         LOG(ERROR) << "carto facade is in state: " << state
                    << " expected it to be in state: "
+                   << CartoFacadeState::IO_INITIALIZED << " or "
                    << CartoFacadeState::STARTED;
-        throw VIAM_CARTO_NOT_IN_STARTED_STATE;
+        throw VIAM_CARTO_NOT_IN_IO_INITIALIZED_STATE;
     }
-    bstring movement_sensor = to_bstring(config.movement_sensor);
-
-    bool known_sensor = biseq(movement_sensor, sr->imu);
-    bdestroy(movement_sensor);
-
+    using TrajectoryState =
+        cartographer::mapping::PoseGraphInterface::TrajectoryState;
+    {
+        std::lock_guard<std::mutex> lk(map_builder_mutex);
+        if (trajectory_id == map_builder.trajectory_id) {
+            throw VIAM_CARTO_TRAJECTORY_ACTIVE;
+        }
+        auto states = map_builder.GetTrajectoryStates();
+        auto it = states.find(trajectory_id);
+        if (it == states.end() || it->second == TrajectoryState::DELETED) {
+            throw VIAM_CARTO_TRAJECTORY_NOT_FOUND;
+        }
+        if (it->second == TrajectoryState::FROZEN) {
+            return;
+        }
+        map_builder.FreezeTrajectory(trajectory_id, it->second);
+    }
+    LOG(INFO) << "froze trajectory " << trajectory_id;
+};
+
+void CartoFacade::RestartTrajectory(
+    const viam_carto_restart_trajectory_request *req,
+    viam_carto_restart_trajectory_response *r) {
+    if (state == CartoFacadeState::INITIALIZED) {
+        LOG(ERROR) << "carto facade is in state: " << state
+                   << " expected it to be in state: "
+                   << CartoFacadeState::IO_INITIALIZED << " or "
+                   << CartoFacadeState::STARTED;
+        throw VIAM_CARTO_NOT_IN_IO_INITIALIZED_STATE;
+    }
+    if (slam_mode != viam::carto_facade::SlamMode::LOCALIZING) {
+        LOG(ERROR) << "can only restart the trajectory in slam mode "
+                   << viam::carto_facade::SlamMode::LOCALIZING
+                   << ", but it is in slam mode " << slam_mode;
+        throw VIAM_CARTO_NOT_LOCALIZING;
+    }
+    {
+        std::lock_guard<std::mutex> lk(map_builder_mutex);
+        r->restarted_trajectory_id = map_builder.RestartTrajectory(
+            algo_config.use_imu_data, req->has_initial_pose,
+            req->initial_pose_x, req->initial_pose_y,
+            req->initial_pose_theta);
+        r->trajectory_id = map_builder.trajectory_id;
+    }
+    {
+        std::lock_guard<std::mutex> lk(viam_response_mutex);
+        latest_global_pose = cartographer::transform::Rigid3d();
+    }
+    LOG(INFO) << "restarted trajectory " << r->restarted_trajectory_id
+              << " as trajectory " << r->trajectory_id;
+};
+
+void CartoFacade::SetSlamMode(viam::carto_facade::SlamMode sm) {
+    if (state == CartoFacadeState::INITIALIZED) {
+        LOG(ERROR) << "carto facade is in state: " << state
+                   << " expected it to be in state: "
+                   << CartoFacadeState::IO_INITIALIZED << " or "
+                   << CartoFacadeState::STARTED;
+        throw VIAM_CARTO_NOT_IN_IO_INITIALIZED_STATE;
+    }
+    if (sm == slam_mode) {
+        return;
+    }
+    bool pure_localization = sm == viam::carto_facade::SlamMode::LOCALIZING;
+    // In localization mode the map is not expected to change, so it is
+    // cached before the switch like it is on start.
+    std::string pointcloud_map;
+    if (pure_localization) {
+        GetLatestSampledPointCloudMapString(pointcloud_map);
+        if (pointcloud_map.empty()) {
+            LOG(ERROR) << "can not localize against a map without points";
+            throw VIAM_CARTO_POINTCLOUD_MAP_EMPTY;
+        }
+    }
+    int finished_trajectory_id;
+    int trajectory_id;
+    {
+        std::lock_guard<std::mutex> lk(map_builder_mutex);
+        finished_trajectory_id = map_builder.SwitchTrajectory(
+            algo_config.use_imu_data, pure_localization,
+            algo_config.max_submaps_to_keep);
+        trajectory_id = map_builder.trajectory_id;
+    }
+    if (pure_localization) {
+        std::lock_guard<std::mutex> lk(viam_response_mutex);
+        latest_pointcloud_map = std::move(pointcloud_map);
+    }
+    slam_mode = sm;
+    LOG(INFO) << "switched to slam mode " << sm << ", finished trajectory "
+              << finished_trajectory_id << " and started trajectory "
+              << trajectory_id;
+};
+
+void CartoFacade::GetTrajectories(viam_carto_get_trajectories_response *r) {
+    if (state == CartoFacadeState::INITIALIZED) {
+        LOG(ERROR) << "carto facade is in state: " << state
+                   << " expected it to be in state: "
+                   << CartoFacadeState::IO_INITIALIZED << " or "
+                   << CartoFacadeState::STARTED;
+        throw VIAM_CARTO_NOT_IN_IO_INITIALIZED_STATE;
+    }
+    std::map<int, cartographer::mapping::PoseGraphInterface::TrajectoryState>
+        trajectory_states;
+    {
+        std::lock_guard<std::mutex> lk(map_builder_mutex);
+        trajectory_states = map_builder.GetTrajectoryStates();
+    }
+    r->num_trajectories = trajectory_states.size();
+    r->trajectories = new viam_carto_trajectory[trajectory_states.size()];
+    int i = 0;
+    for (auto &&[trajectory_id, trajectory_state] : trajectory_states) {
+        r->trajectories[i].trajectory_id = trajectory_id;
+        r->trajectories[i].state =
+            to_viam_carto_trajectory_state(trajectory_state);
+        i++;
+    }
+};
+
+void CartoFacade::GetTrajectory(viam_carto_get_trajectory_response *r) {
+    if (state == CartoFacadeState::INITIALIZED) {
+        LOG(ERROR) << "carto facade is in state: " << state
+                   << " expected it to be in state: "
+                   << CartoFacadeState::IO_INITIALIZED << " or "
+                   << CartoFacadeState::STARTED;
+        throw VIAM_CARTO_NOT_IN_IO_INITIALIZED_STATE;
+    }
+    cartographer::mapping::MapById<cartographer::mapping::NodeId,
+                                   cartographer::mapping::TrajectoryNodePose>
+        node_poses;
+    {
+        std::lock_guard<std::mutex> lk(map_builder_mutex);
+        node_poses = map_builder.GetTrajectoryNodePoses();
+    }
+    std::vector<viam_carto_trajectory_node> nodes;
+    for (const auto &node : node_poses) {
+        // the data of trimmed nodes, including their time, is released
+        if (!node.data.constant_pose_data.has_value()) {
+            continue;
+        }
+        auto pos_vector = node.data.global_pose.translation();
+        auto pos_quat = node.data.global_pose.rotation();
+        viam_carto_trajectory_node n;
+        n.trajectory_id = node.id.trajectory_id;
+        n.time_unix_milli =
+            std::chrono::duration_cast<std::chrono::milliseconds>(
+                node.data.constant_pose_data.value().time -
+                cartographer::common::FromUniversal(0))
+                .count();
+        n.x = pos_vector.x() * 1000;
+        n.y = pos_vector.y() * 1000;
+        n.z = pos_vector.z() * 1000;
+        n.real = pos_quat.w();
+        n.imag = pos_quat.x();
+        n.jmag = pos_quat.y();
+        n.kmag = pos_quat.z();
+        nodes.push_back(n);
+    }
+    // nodes are ordered by node index within a trajectory, which is the
+    // order they were inserted in, not necessarily the order of their times
+    std::stable_sort(nodes.begin(), nodes.end(),
+                     [](const viam_carto_trajectory_node &a,
+                        const viam_carto_trajectory_node &b) {
+                         if (a.trajectory_id != b.trajectory_id) {
+                             return a.trajectory_id < b.trajectory_id;
+                         }
+                         return a.time_unix_milli < b.time_unix_milli;
+                     });
+    r->num_nodes = nodes.size();
+    r->nodes = new viam_carto_trajectory_node[nodes.size()];
+    std::copy(nodes.begin(), nodes.end(), r->nodes);
+};
+
+void CartoFacade::GetSubmapList(viam_carto_get_submap_list_response *r) {
+    if (state == CartoFacadeState::INITIALIZED) {
+        LOG(ERROR) << "carto facade is in state: " << state
+                   << " expected it to be in state: "
+                   << CartoFacadeState::IO_INITIALIZED << " or "
+                   << CartoFacadeState::STARTED;
+        throw VIAM_CARTO_NOT_IN_IO_INITIALIZED_STATE;
+    }
+    cartographer::mapping::MapById<
+        cartographer::mapping::SubmapId,
+        cartographer::mapping::PoseGraphInterface::SubmapPose>
+        submap_poses;
+    {
+        std::lock_guard<std::mutex> lk(map_builder_mutex);
+        submap_poses =
+            map_builder.map_builder_->pose_graph()->GetAllSubmapPoses();
+    }
+    r->num_submaps = submap_poses.size();
+    r->submaps = new viam_carto_submap[submap_poses.size()];
+    int i = 0;
+    for (const auto &&submap_id_pose : submap_poses) {
+        r->submaps[i] =
+            to_viam_carto_submap(submap_id_pose.id, submap_id_pose.data);
+        i++;
+    }
+};
+
+void CartoFacade::GetSubmap(const viam_carto_get_submap_request *req,
+                            viam_carto_get_submap_response *r) {
+    if (state == CartoFacadeState::INITIALIZED) {
+        LOG(ERROR) << "carto facade is in state: " << state
+                   << " expected it to be in state: "
+                   << CartoFacadeState::IO_INITIALIZED << " or "
+                   << CartoFacadeState::STARTED;
+        throw VIAM_CARTO_NOT_IN_IO_INITIALIZED_STATE;
+    }
+    const cartographer::mapping::SubmapId submap_id{req->trajectory_id,
+                                                    req->submap_index};
+    cartographer::mapping::PoseGraphInterface::SubmapPose submap_pose;
+    cartographer::mapping::proto::SubmapQuery::Response response_proto;
+    {
+        std::lock_guard<std::mutex> lk(map_builder_mutex);
+        auto submap_poses =
+            map_builder.map_builder_->pose_graph()->GetAllSubmapPoses();
+        if (!submap_poses.Contains(submap_id)) {
+            LOG(ERROR) << "submap " << submap_id
+                       << " is not in the pose graph";
+            throw VIAM_CARTO_SUBMAP_NOT_FOUND;
+        }
+        submap_pose = submap_poses.at(submap_id);
+        const std::string error =
+            map_builder.map_builder_->SubmapToProto(submap_id, &response_proto);
+        if (error != "") {
+            std::string errorLog = "Error writing submap to proto: ";
+            errorLog += error;
+            LOG(ERROR) << errorLog;
+            throw std::runtime_error(errorLog);
+        }
+    }
+
+    std::map<cartographer::mapping::SubmapId, ::cartographer::io::SubmapSlice>
+        submap_slices;
+    fill_submap_slice(submap_pose, response_proto, submap_slices[submap_id]);
+    cartographer::io::PaintSubmapSlicesResult painted_slices =
+        cartographer::io::PaintSubmapSlices(submap_slices, resolutionMeters);
+
+    r->submap = to_viam_carto_submap(submap_id, submap_pose);
+    r->point_cloud_pcd = to_bstring(painted_slices_to_pcd(painted_slices));
+};
+
+void CartoFacade::GetSlamStats(viam_carto_get_slam_stats_response *r) {
+    if (state == CartoFacadeState::INITIALIZED) {
+        LOG(ERROR) << "carto facade is in state: " << state
+                   << " expected it to be in state: "
+                   << CartoFacadeState::IO_INITIALIZED << " or "
+                   << CartoFacadeState::STARTED;
+        throw VIAM_CARTO_NOT_IN_IO_INITIALIZED_STATE;
+    }
+    std::lock_guard<std::mutex> lk(map_builder_mutex);
+    map_builder.GetOptimizationLag(&r->num_nodes, &r->num_unoptimized_nodes,
+                                   &r->oldest_unoptimized_node_age_sec);
+};
+
+void CartoFacade::Start() {
+    if (state != CartoFacadeState::IO_INITIALIZED) {
+        LOG(ERROR) << "carto facade is in state: " << state << " expected "
+                   << CartoFacadeState::IO_INITIALIZED;
+        throw VIAM_CARTO_NOT_IN_IO_INITIALIZED_STATE;
+    }
+    state = CartoFacadeState::STARTED;
+};
+
+void CartoFacade::Stop() {
+    if (state != CartoFacadeState::STARTED) {
+        LOG(ERROR) << "carto facade is in state: " << state << " expected "
+                   << CartoFacadeState::STARTED;
+        throw VIAM_CARTO_NOT_IN_STARTED_STATE;
+    }
+    JoinInitialOptimization();
+    state = CartoFacadeState::IO_INITIALIZED;
+};
+
+void CartoFacade::StartInitialOptimization() {
+    if (state != CartoFacadeState::STARTED) {
+        LOG(ERROR) << "carto facade is in state: " << state << " expected "
+                   << CartoFacadeState::STARTED;
+        throw VIAM_CARTO_NOT_IN_STARTED_STATE;
+    }
+    if (thread_initial_optimization != nullptr) {
+        LOG(ERROR) << "the initial optimization was already started";
+        throw VIAM_CARTO_INITIAL_OPTIMIZATION_ALREADY_STARTED;
+    }
+    // the same as optimize_on_start while starting: the map is cached before
+    // the optimization and served from the cache while it runs
+    CacheLatestMap();
+    initial_optimization_running = true;
+    thread_initial_optimization = std::make_unique<std::thread>([this]() {
+        std::unique_lock optimization_lock{optimization_shared_mutex};
+        LOG(INFO) << "Optimizing map on start, this may take a few minutes";
+        // map_builder_mutex is not held, so that readings are added while
+        // the optimization runs; the pose graph is safe for concurrent use
+        map_builder.map_builder_->pose_graph()->RunFinalOptimization();
+        initial_optimization_running = false;
+    });
+}
+
+bool CartoFacade::InitialOptimizationRunning() {
+    return initial_optimization_running;
+}
+
+void CartoFacade::JoinInitialOptimization() {
+    if (thread_initial_optimization != nullptr &&
+        thread_initial_optimization->joinable()) {
+        thread_initial_optimization->join();
+    }
+}
+
+void CartoFacade::AddLidarReading(const viam_carto_lidar_reading *sr) {
+    if (state != CartoFacadeState::STARTED) {
+        LOG(ERROR) << "carto facade is in state: " << state
+                   << " expected it to be in state: "
+                   << CartoFacadeState::STARTED;
+        throw VIAM_CARTO_NOT_IN_STARTED_STATE;
+    }
+
+    std::string lidar = to_std_string(sr->lidar);
+    std::string range_sensor_id = kRangeSensorId.id;
+    if (lidar != config.camera) {
+        if (std::find(config.additional_cameras.begin(),
+                      config.additional_cameras.end(),
+                      lidar) == config.additional_cameras.end()) {
+            VLOG(1) << "expected sensor: " << lidar << " to be "
+                    << config.camera << " or one of the additional cameras";
+            throw VIAM_CARTO_UNKNOWN_SENSOR_NAME;
+        }
+        range_sensor_id = additional_range_sensor_id(lidar);
+    }
+
+    std::string lidar_reading = to_std_string(sr->lidar_reading);
+    if (lidar_reading.length() == 0) {
+        throw VIAM_CARTO_LIDAR_READING_EMPTY;
+    }
+
+    int64_t lidar_reading_time_unix_milli = sr->lidar_reading_time_unix_milli;
+    auto [success, measurement] = viam::carto_facade::util::carto_lidar_reading(
+        lidar_reading, lidar_reading_time_unix_milli);
+    if (!success) {
+        throw VIAM_CARTO_LIDAR_READING_INVALID;
+    }
+
+    cartographer::transform::Rigid3d tmp_global_pose;
+
+    if (map_builder_mutex.try_lock()) {
+        VLOG(1) << "AddSensorData timestamp: " << measurement.time
+                << " Sensor type: Lidar "
+                << " measurement.ranges.size(): " << measurement.ranges.size();
+        map_builder.AddSensorData(range_sensor_id, measurement);
+        if (relocalization_readings_left > 0 &&
+            range_sensor_id == kRangeSensorId.id) {
+            TryRelocalization();
+        }
+        tmp_global_pose = map_builder.GetGlobalPose();
+        map_builder_mutex.unlock();
+        {
+            std::lock_guard<std::mutex> lk(viam_response_mutex);
+            latest_global_pose = tmp_global_pose;
+        }
+        return;
+    } else {
+        throw VIAM_CARTO_UNABLE_TO_ACQUIRE_LOCK;
+    }
+};
+
+void CartoFacade::TryRelocalization() {
+    // local SLAM may not have inserted a reading yet, e.g. while the collator
+    // waits for the IMU
+    if (!map_builder.local_pose_initialized) {
+        return;
+    }
+    relocalization_readings_left--;
+    if (map_builder.RelocalizeTrajectory(
+            algo_config.use_imu_data, relocalization_linear_search_window,
+            relocalization_angular_search_window)) {
+        relocalization_readings_left = 0;
+        return;
+    }
+    if (relocalization_readings_left == 0) {
+        LOG(WARNING) << "the first " << kRelocalizationReadings
+                     << " lidar readings did not match the map within the "
+                        "standard deviations of the initial pose, it is kept "
+                        "as is";
+    }
+}
+
+void CartoFacade::AddIMUReading(const viam_carto_imu_reading *sr) {
+    if (state != CartoFacadeState::STARTED) {
+        LOG(ERROR) << "carto facade is in state: " << state
+                   << " expected it to be in state: "
+                   << CartoFacadeState::STARTED;
+        throw VIAM_CARTO_NOT_IN_STARTED_STATE;
+    }
+    bstring movement_sensor = to_bstring(config.movement_sensor);
+
+    bool known_sensor = biseq(movement_sensor, sr->imu);
+    bdestroy(movement_sensor);
+
     if (!known_sensor) {
         VLOG(1) << "expected sensor: " << to_std_string(sr->imu) << " to be "
                 << config.movement_sensor;
@@ -786,10 +1361,10 @@ void CartoFacade::AddOdometerReading(const viam_carto_odometer_reading *sr) {
     }
 };
 
-viam::carto_facade::SlamMode determine_slam_mode(
-    std::string path_to_internal_state_file, bool enable_mapping) {
-    // Check if an existing map has been provided
-    if (path_to_internal_state_file.size() != 0) {
+viam::carto_facade::SlamMode determine_slam_mode(bool has_apriori_map,
+                                                 bool enable_mapping) {
+    // Check if an existing map or a floor plan has been provided
+    if (has_apriori_map) {
         // There is an apriori map (internal state) present, so we're
         // running either in updating or localization mode.
         if (!enable_mapping) {
@@ -851,309 +1426,885 @@ extern int viam_carto_lib_init(viam_carto_lib **ppVCL, int minloglevel,
     return VIAM_CARTO_SUCCESS;
 };
 
-extern int viam_carto_lib_terminate(viam_carto_lib **ppVCL) {
-    if (ppVCL == nullptr) {
-        return VIAM_CARTO_LIB_INVALID;
+extern int viam_carto_lib_terminate(viam_carto_lib **ppVCL) {
+    if (ppVCL == nullptr) {
+        return VIAM_CARTO_LIB_INVALID;
+    }
+
+    if (*ppVCL == nullptr) {
+        return VIAM_CARTO_LIB_INVALID;
+    }
+
+    FLAGS_logtostdout = 0;
+    FLAGS_minloglevel = 0;
+    FLAGS_v = 0;
+    google::ShutdownGoogleLogging();
+    free(*ppVCL);
+    *ppVCL = nullptr;
+    return VIAM_CARTO_SUCCESS;
+};
+
+extern int viam_carto_lib_set_log_level(viam_carto_lib *pVCL, int minloglevel,
+                                        int verbose) {
+    if (pVCL == nullptr) {
+        return VIAM_CARTO_LIB_INVALID;
+    }
+    if (minloglevel < google::GLOG_INFO || minloglevel > google::GLOG_FATAL ||
+        verbose < 0) {
+        return VIAM_CARTO_LOG_LEVEL_INVALID;
+    }
+
+    FLAGS_minloglevel = minloglevel;
+    FLAGS_v = verbose;
+    pVCL->minloglevel = minloglevel;
+    pVCL->verbose = verbose;
+    return VIAM_CARTO_SUCCESS;
+};
+
+extern int viam_carto_lib_get_abi(viam_carto_abi *abi) {
+    if (abi == nullptr) {
+        return VIAM_CARTO_GET_ABI_RESPONSE_INVALID;
+    }
+    abi->version = VIAM_CARTO_ABI_VERSION;
+    abi->config_size = sizeof(viam_carto_config);
+    abi->algo_config_size = sizeof(viam_carto_algo_config);
+    return VIAM_CARTO_SUCCESS;
+}
+
+extern int viam_carto_lib_get_memory_usage(
+    viam_carto_lib *pVCL, viam_carto_get_memory_usage_response *r) {
+    if (pVCL == nullptr) {
+        return VIAM_CARTO_LIB_INVALID;
+    }
+    if (r == nullptr) {
+        return VIAM_CARTO_GET_MEMORY_USAGE_RESPONSE_INVALID;
+    }
+    // the go runtime does not allocate its heap through malloc, so the
+    // allocator's statistics only account for the C & C++ side of the process
+#if defined(__GLIBC__) && (__GLIBC__ > 2 || __GLIBC_MINOR__ >= 33)
+    struct mallinfo2 info = mallinfo2();
+    r->allocated_bytes = info.uordblks + info.hblkhd;
+#elif defined(__GLIBC__)
+    // mallinfo's fields overflow past 4GiB
+    struct mallinfo info = mallinfo();
+    r->allocated_bytes =
+        (unsigned int)info.uordblks + (unsigned int)info.hblkhd;
+#elif defined(__APPLE__)
+    malloc_statistics_t stats;
+    malloc_zone_statistics(nullptr, &stats);
+    r->allocated_bytes = stats.size_in_use;
+#else
+    return VIAM_CARTO_MEMORY_USAGE_UNAVAILABLE;
+#endif
+    return VIAM_CARTO_SUCCESS;
+};
+
+namespace {
+// kInternalStateMagic is the number cartographer writes, little endian, at the
+// start of every internal state file, see cartographer/io/proto_stream.cc
+constexpr uint64_t kInternalStateMagic = 0x7b1d1f7b5bf501db;
+
+// has_internal_state_magic returns whether the file at path can be read and
+// starts with kInternalStateMagic
+bool has_internal_state_magic(const std::string &path) {
+    std::ifstream file(path, std::ios::binary);
+    unsigned char bytes[sizeof(kInternalStateMagic)];
+    if (!file.read(reinterpret_cast<char *>(bytes), sizeof(bytes))) {
+        return false;
+    }
+    uint64_t magic = 0;
+    for (size_t i = 0; i < sizeof(bytes); ++i) {
+        magic |= static_cast<uint64_t>(bytes[i]) << (8 * i);
+    }
+    return magic == kInternalStateMagic;
+}
+
+// read_internal_state_version returns the serialization format version of
+// the internal state file at path
+int read_internal_state_version(const std::string &path) {
+    // ProtoStreamReader aborts the process on files it cannot open or which
+    // lack its magic number, so neither is passed to it
+    if (!viam::carto_facade::fs::is_regular_file(path) ||
+        !has_internal_state_magic(path)) {
+        throw VIAM_CARTO_INTERNAL_STATE_INVALID;
+    }
+    cartographer::io::ProtoStreamReader reader(path);
+    cartographer::mapping::proto::SerializationHeader header;
+    if (!reader.ReadProto(&header)) {
+        throw VIAM_CARTO_INTERNAL_STATE_INVALID;
+    }
+    return header.format_version();
+}
+}  // namespace
+
+extern int viam_carto_lib_get_internal_state_version(
+    viam_carto_lib *pVCL, bstring path,
+    viam_carto_get_internal_state_version_response *r) {
+    if (pVCL == nullptr) {
+        return VIAM_CARTO_LIB_INVALID;
+    }
+    if (r == nullptr) {
+        return VIAM_CARTO_GET_INTERNAL_STATE_VERSION_RESPONSE_INVALID;
+    }
+    try {
+        r->version = read_internal_state_version(
+            viam::carto_facade::to_std_string(path));
+        r->current_version =
+            cartographer::io::kMappingStateSerializationFormatVersion;
+    } catch (int err) {
+        return err;
+    } catch (std::exception &e) {
+        LOG(ERROR) << e.what();
+        return VIAM_CARTO_UNKNOWN_ERROR;
+    }
+    return VIAM_CARTO_SUCCESS;
+};
+
+extern int viam_carto_lib_migrate_internal_state(viam_carto_lib *pVCL,
+                                                 bstring src, bstring dst) {
+    if (pVCL == nullptr) {
+        return VIAM_CARTO_LIB_INVALID;
+    }
+    try {
+        std::string src_path = viam::carto_facade::to_std_string(src);
+        std::string dst_path = viam::carto_facade::to_std_string(dst);
+        // cartographer only provides a migration from the format without
+        // submap histograms
+        if (read_internal_state_version(src_path) !=
+            cartographer::io::kFormatVersionWithoutSubmapHistograms) {
+            return VIAM_CARTO_INTERNAL_STATE_MIGRATION_UNSUPPORTED;
+        }
+        cartographer::io::ProtoStreamReader input(src_path);
+        cartographer::io::ProtoStreamWriter output(dst_path);
+        cartographer::io::MigrateStreamFormatToVersion2(&input, &output, true);
+        if (!output.Close()) {
+            return VIAM_CARTO_INTERNAL_STATE_MIGRATION_FAILED;
+        }
+    } catch (int err) {
+        return err;
+    } catch (std::exception &e) {
+        LOG(ERROR) << e.what();
+        return VIAM_CARTO_INTERNAL_STATE_MIGRATION_FAILED;
+    }
+    return VIAM_CARTO_SUCCESS;
+};
+
+extern int viam_carto_init(viam_carto **ppVC, viam_carto_lib *pVCL,
+                           const viam_carto_config c,
+                           const viam_carto_algo_config ac) {
+    if (ppVC == nullptr) {
+        return VIAM_CARTO_VC_INVALID;
+    }
+    if (pVCL == nullptr) {
+        return VIAM_CARTO_LIB_INVALID;
+    }
+    // check that IMU is correctly set up
+    if (ac.use_imu_data == true && biseqcstr(c.movement_sensor, ("")) == true) {
+        return VIAM_CARTO_IMU_PROVIDED_AND_IMU_ENABLED_MISMATCH;
+    }
+
+    // allocate viam_carto struct
+    viam_carto *vc = (viam_carto *)malloc(sizeof(viam_carto));
+    if (vc == nullptr) {
+        return VIAM_CARTO_OUT_OF_MEMORY;
+    }
+    viam::carto_facade::CartoFacade *cf;
+    try {
+        cf = new viam::carto_facade::CartoFacade(pVCL, c, ac);
+    } catch (int err) {
+        free(vc);
+        return err;
+    } catch (std::exception &e) {
+        free(vc);
+        LOG(ERROR) << e.what();
+        return VIAM_CARTO_UNKNOWN_ERROR;
+    }
+
+    int slam_mode = VIAM_CARTO_SLAM_MODE_UNKNOWN;
+    try {
+        cf->IOInit();
+        slam_mode =
+            viam::carto_facade::slam_mode_to_vc_slam_mode(cf->slam_mode);
+    } catch (int err) {
+        delete cf;
+        free(vc);
+        return err;
+    } catch (std::exception &e) {
+        LOG(ERROR) << e.what();
+        delete cf;
+        free(vc);
+        return VIAM_CARTO_UNKNOWN_ERROR;
+    }
+    vc->carto_obj = cf;
+    vc->slam_mode = slam_mode;
+
+    // point to newly created viam_carto struct
+    *ppVC = vc;
+    return VIAM_CARTO_SUCCESS;
+};
+
+extern int viam_carto_start(viam_carto *vc) {
+    if (vc == nullptr) {
+        return VIAM_CARTO_VC_INVALID;
+    }
+    try {
+        viam::carto_facade::CartoFacade *cf =
+            static_cast<viam::carto_facade::CartoFacade *>(vc->carto_obj);
+        cf->Start();
+    } catch (int err) {
+        return err;
+    } catch (std::exception &e) {
+        LOG(ERROR) << e.what();
+        return VIAM_CARTO_UNKNOWN_ERROR;
+    }
+    return VIAM_CARTO_SUCCESS;
+};
+
+extern int viam_carto_stop(viam_carto *vc) {
+    if (vc == nullptr) {
+        return VIAM_CARTO_VC_INVALID;
+    }
+
+    try {
+        viam::carto_facade::CartoFacade *cf =
+            static_cast<viam::carto_facade::CartoFacade *>(vc->carto_obj);
+        cf->Stop();
+    } catch (int err) {
+        return err;
+    } catch (std::exception &e) {
+        LOG(ERROR) << e.what();
+        return VIAM_CARTO_UNKNOWN_ERROR;
+    }
+    return VIAM_CARTO_SUCCESS;
+};
+
+extern int viam_carto_terminate(viam_carto **ppVC) {
+    if (ppVC == nullptr) {
+        return VIAM_CARTO_VC_INVALID;
+    }
+
+    if (*ppVC == nullptr) {
+        return VIAM_CARTO_VC_INVALID;
+    }
+    viam::carto_facade::CartoFacade *cf =
+        static_cast<viam::carto_facade::CartoFacade *>((*ppVC)->carto_obj);
+    if (cf->state != viam::carto_facade::CartoFacadeState::INITIALIZED &&
+        cf->state != viam::carto_facade::CartoFacadeState::IO_INITIALIZED) {
+        LOG(ERROR) << "carto facade is in state: " << cf->state << " expected "
+                   << viam::carto_facade::CartoFacadeState::INITIALIZED
+                   << " or "
+                   << viam::carto_facade::CartoFacadeState::IO_INITIALIZED;
+        return VIAM_CARTO_NOT_IN_TERMINATABLE_STATE;
+    }
+    delete cf;
+    free((viam_carto *)*ppVC);
+    *ppVC = nullptr;
+    return VIAM_CARTO_SUCCESS;
+};
+
+extern int viam_carto_add_lidar_reading(viam_carto *vc,
+                                        const viam_carto_lidar_reading *sr) {
+    if (vc == nullptr) {
+        return VIAM_CARTO_VC_INVALID;
+    }
+
+    if (sr == nullptr) {
+        return VIAM_CARTO_LIDAR_READING_INVALID;
+    }
+
+    try {
+        viam::carto_facade::CartoFacade *cf =
+            static_cast<viam::carto_facade::CartoFacade *>(vc->carto_obj);
+        cf->AddLidarReading(sr);
+    } catch (int err) {
+        return err;
+    } catch (std::exception &e) {
+        LOG(ERROR) << e.what();
+        return VIAM_CARTO_UNKNOWN_ERROR;
+    }
+    return VIAM_CARTO_SUCCESS;
+};
+
+extern int viam_carto_add_lidar_reading_destroy(viam_carto_lidar_reading *sr) {
+    if (sr == nullptr) {
+        return VIAM_CARTO_LIDAR_READING_INVALID;
+    }
+    int return_code = VIAM_CARTO_SUCCESS;
+    int rc = BSTR_OK;
+    // destroy lidar_reading
+    rc = bdestroy(sr->lidar_reading);
+    if (rc != BSTR_OK) {
+        return_code = VIAM_CARTO_DESTRUCTOR_ERROR;
+    }
+    sr->lidar_reading = nullptr;
+
+    // destroy sensor
+    rc = bdestroy(sr->lidar);
+    if (rc != BSTR_OK) {
+        return_code = VIAM_CARTO_DESTRUCTOR_ERROR;
+    }
+    sr->lidar = nullptr;
+
+    return return_code;
+};
+
+extern int viam_carto_add_imu_reading(viam_carto *vc,
+                                      const viam_carto_imu_reading *sr) {
+    if (vc == nullptr) {
+        return VIAM_CARTO_VC_INVALID;
+    }
+
+    if (sr == nullptr) {
+        return VIAM_CARTO_IMU_READING_INVALID;
+    }
+
+    try {
+        viam::carto_facade::CartoFacade *cf =
+            static_cast<viam::carto_facade::CartoFacade *>(vc->carto_obj);
+        cf->AddIMUReading(sr);
+    } catch (int err) {
+        return err;
+    } catch (std::exception &e) {
+        LOG(ERROR) << e.what();
+        return VIAM_CARTO_UNKNOWN_ERROR;
+    }
+    return VIAM_CARTO_SUCCESS;
+};
+
+extern int viam_carto_add_imu_reading_destroy(viam_carto_imu_reading *sr) {
+    if (sr == nullptr) {
+        return VIAM_CARTO_IMU_READING_INVALID;
+    }
+    int return_code = VIAM_CARTO_SUCCESS;
+    int rc = BSTR_OK;
+
+    // destroy sensor
+    rc = bdestroy(sr->imu);
+    if (rc != BSTR_OK) {
+        return_code = VIAM_CARTO_DESTRUCTOR_ERROR;
+    }
+    sr->imu = nullptr;
+
+    return return_code;
+};
+
+extern int viam_carto_add_odometer_reading(
+    viam_carto *vc, const viam_carto_odometer_reading *sr) {
+    if (vc == nullptr) {
+        return VIAM_CARTO_VC_INVALID;
+    }
+
+    if (sr == nullptr) {
+        return VIAM_CARTO_ODOMETER_READING_INVALID;
+    }
+
+    try {
+        viam::carto_facade::CartoFacade *cf =
+            static_cast<viam::carto_facade::CartoFacade *>(vc->carto_obj);
+        cf->AddOdometerReading(sr);
+    } catch (int err) {
+        return err;
+    } catch (std::exception &e) {
+        LOG(ERROR) << e.what();
+        return VIAM_CARTO_UNKNOWN_ERROR;
+    }
+    return VIAM_CARTO_SUCCESS;
+};
+
+extern int viam_carto_add_odometer_reading_destroy(
+    viam_carto_odometer_reading *sr) {
+    if (sr == nullptr) {
+        return VIAM_CARTO_ODOMETER_READING_INVALID;
+    }
+    int return_code = VIAM_CARTO_SUCCESS;
+    int rc = BSTR_OK;
+
+    // destroy sensor
+    rc = bdestroy(sr->odometer);
+    if (rc != BSTR_OK) {
+        return_code = VIAM_CARTO_DESTRUCTOR_ERROR;
+    }
+    sr->odometer = nullptr;
+
+    return return_code;
+};
+
+extern int viam_carto_get_position(viam_carto *vc,
+                                   viam_carto_get_position_response *r) {
+    if (vc == nullptr) {
+        return VIAM_CARTO_VC_INVALID;
+    }
+
+    if (r == nullptr) {
+        return VIAM_CARTO_GET_POSITION_RESPONSE_INVALID;
+    }
+
+    try {
+        viam::carto_facade::CartoFacade *cf =
+            static_cast<viam::carto_facade::CartoFacade *>((vc)->carto_obj);
+        cf->GetPosition(r);
+    } catch (int err) {
+        return err;
+    } catch (std::exception &e) {
+        LOG(ERROR) << e.what();
+        return VIAM_CARTO_UNKNOWN_ERROR;
+    }
+    return VIAM_CARTO_SUCCESS;
+};
+
+extern int viam_carto_get_position_response_destroy(
+    viam_carto_get_position_response *r) {
+    if (r == nullptr) {
+        return VIAM_CARTO_GET_POSITION_RESPONSE_INVALID;
+    }
+    int return_code = VIAM_CARTO_SUCCESS;
+    return return_code;
+};
+
+extern int viam_carto_get_point_cloud_map(
+    viam_carto *vc, viam_carto_get_point_cloud_map_response *r) {
+    if (vc == nullptr) {
+        return VIAM_CARTO_VC_INVALID;
+    }
+
+    if (r == nullptr) {
+        return VIAM_CARTO_GET_POINT_CLOUD_MAP_RESPONSE_INVALID;
+    }
+    try {
+        viam::carto_facade::CartoFacade *cf =
+            static_cast<viam::carto_facade::CartoFacade *>((vc)->carto_obj);
+        cf->GetPointCloudMap(r);
+    } catch (int err) {
+        return err;
+    } catch (std::exception &e) {
+        LOG(ERROR) << e.what();
+        return VIAM_CARTO_UNKNOWN_ERROR;
+    }
+
+    return VIAM_CARTO_SUCCESS;
+};
+
+extern int viam_carto_get_point_cloud_map_response_destroy(
+    viam_carto_get_point_cloud_map_response *r) {
+    if (r == nullptr) {
+        return VIAM_CARTO_GET_POINT_CLOUD_MAP_RESPONSE_INVALID;
+    }
+    int return_code = VIAM_CARTO_SUCCESS;
+    int rc = BSTR_OK;
+    rc = bdestroy(r->point_cloud_pcd);
+    if (rc != BSTR_OK) {
+        return_code = VIAM_CARTO_DESTRUCTOR_ERROR;
+    }
+    r->point_cloud_pcd = nullptr;
+    return return_code;
+};
+
+extern int viam_carto_get_internal_state(
+    viam_carto *vc, viam_carto_get_internal_state_response *r) {
+    if (vc == nullptr) {
+        return VIAM_CARTO_VC_INVALID;
+    }
+
+    if (r == nullptr) {
+        return VIAM_CARTO_GET_INTERNAL_STATE_RESPONSE_INVALID;
+    }
+    try {
+        viam::carto_facade::CartoFacade *cf =
+            static_cast<viam::carto_facade::CartoFacade *>((vc)->carto_obj);
+        cf->GetInternalState(r);
+    } catch (int err) {
+        return err;
+    } catch (std::exception &e) {
+        LOG(ERROR) << e.what();
+        return VIAM_CARTO_UNKNOWN_ERROR;
+    }
+
+    return VIAM_CARTO_SUCCESS;
+};
+
+extern int viam_carto_get_internal_state_response_destroy(
+    viam_carto_get_internal_state_response *r) {
+    if (r == nullptr) {
+        return VIAM_CARTO_GET_INTERNAL_STATE_RESPONSE_INVALID;
+    }
+    int return_code = VIAM_CARTO_SUCCESS;
+    int rc = BSTR_OK;
+    rc = bdestroy(r->internal_state);
+    if (rc != BSTR_OK) {
+        return_code = VIAM_CARTO_DESTRUCTOR_ERROR;
+    }
+    r->internal_state = nullptr;
+    return return_code;
+};
+
+extern int viam_carto_get_internal_state_stream(
+    viam_carto *vc, viam_carto_internal_state_stream **s) {
+    if (vc == nullptr) {
+        return VIAM_CARTO_VC_INVALID;
+    }
+
+    if (s == nullptr) {
+        return VIAM_CARTO_INTERNAL_STATE_STREAM_INVALID;
+    }
+    viam::carto_facade::InternalStateStream *stream;
+    try {
+        viam::carto_facade::CartoFacade *cf =
+            static_cast<viam::carto_facade::CartoFacade *>((vc)->carto_obj);
+        stream = cf->GetInternalStateStream();
+    } catch (int err) {
+        return err;
+    } catch (std::exception &e) {
+        LOG(ERROR) << e.what();
+        return VIAM_CARTO_UNKNOWN_ERROR;
+    }
+
+    viam_carto_internal_state_stream *iss =
+        (viam_carto_internal_state_stream *)malloc(
+            sizeof(viam_carto_internal_state_stream));
+    if (iss == nullptr) {
+        std::remove(stream->filename.c_str());
+        delete stream;
+        return VIAM_CARTO_OUT_OF_MEMORY;
+    }
+    iss->stream_obj = stream;
+    *s = iss;
+    return VIAM_CARTO_SUCCESS;
+};
+
+extern int viam_carto_get_internal_state_chunk(
+    viam_carto_internal_state_stream *s, int max_size,
+    viam_carto_get_internal_state_chunk_response *r) {
+    if (s == nullptr || max_size <= 0) {
+        return VIAM_CARTO_INTERNAL_STATE_STREAM_INVALID;
     }
 
-    if (*ppVCL == nullptr) {
-        return VIAM_CARTO_LIB_INVALID;
+    if (r == nullptr) {
+        return VIAM_CARTO_GET_INTERNAL_STATE_CHUNK_RESPONSE_INVALID;
+    }
+    viam::carto_facade::InternalStateStream *stream =
+        static_cast<viam::carto_facade::InternalStateStream *>(s->stream_obj);
+    try {
+        std::string chunk(max_size, '\0');
+        stream->file.read(&chunk[0], max_size);
+        if (stream->file.bad()) {
+            LOG(ERROR) << "Failed to read internal state file: "
+                       << stream->filename;
+            return VIAM_CARTO_GET_INTERNAL_STATE_FILE_READ_IO_ERROR;
+        }
+        chunk.resize(stream->file.gcount());
+        r->chunk = viam::carto_facade::to_bstring(chunk);
+    } catch (int err) {
+        return err;
+    } catch (std::exception &e) {
+        LOG(ERROR) << e.what();
+        return VIAM_CARTO_UNKNOWN_ERROR;
     }
 
-    FLAGS_logtostdout = 0;
-    FLAGS_minloglevel = 0;
-    FLAGS_v = 0;
-    google::ShutdownGoogleLogging();
-    free(*ppVCL);
-    *ppVCL = nullptr;
     return VIAM_CARTO_SUCCESS;
 };
 
-extern int viam_carto_init(viam_carto **ppVC, viam_carto_lib *pVCL,
-                           const viam_carto_config c,
-                           const viam_carto_algo_config ac) {
-    if (ppVC == nullptr) {
-        return VIAM_CARTO_VC_INVALID;
+extern int viam_carto_get_internal_state_chunk_response_destroy(
+    viam_carto_get_internal_state_chunk_response *r) {
+    if (r == nullptr) {
+        return VIAM_CARTO_GET_INTERNAL_STATE_CHUNK_RESPONSE_INVALID;
     }
-    if (pVCL == nullptr) {
-        return VIAM_CARTO_LIB_INVALID;
+    int return_code = VIAM_CARTO_SUCCESS;
+    int rc = BSTR_OK;
+    rc = bdestroy(r->chunk);
+    if (rc != BSTR_OK) {
+        return_code = VIAM_CARTO_DESTRUCTOR_ERROR;
     }
-    // check that IMU is correctly set up
-    if (ac.use_imu_data == true && biseqcstr(c.movement_sensor, ("")) == true) {
-        return VIAM_CARTO_IMU_PROVIDED_AND_IMU_ENABLED_MISMATCH;
+    r->chunk = nullptr;
+    return return_code;
+};
+
+extern int viam_carto_internal_state_stream_destroy(
+    viam_carto_internal_state_stream **s) {
+    if (s == nullptr || *s == nullptr) {
+        return VIAM_CARTO_INTERNAL_STATE_STREAM_INVALID;
     }
+    viam::carto_facade::InternalStateStream *stream =
+        static_cast<viam::carto_facade::InternalStateStream *>(
+            (*s)->stream_obj);
+    int return_code = VIAM_CARTO_SUCCESS;
+    stream->file.close();
+    if (std::remove(stream->filename.c_str()) != 0) {
+        LOG(ERROR) << "Failed to delete internal state file: "
+                   << stream->filename;
+        return_code = VIAM_CARTO_DESTRUCTOR_ERROR;
+    }
+    delete stream;
+    free(*s);
+    *s = nullptr;
+    return return_code;
+};
 
-    // allocate viam_carto struct
-    viam_carto *vc = (viam_carto *)malloc(sizeof(viam_carto));
+extern int viam_carto_run_final_optimization(viam_carto *vc) {
     if (vc == nullptr) {
-        return VIAM_CARTO_OUT_OF_MEMORY;
+        return VIAM_CARTO_VC_INVALID;
     }
-    viam::carto_facade::CartoFacade *cf;
+
     try {
-        cf = new viam::carto_facade::CartoFacade(pVCL, c, ac);
+        viam::carto_facade::CartoFacade *cf =
+            static_cast<viam::carto_facade::CartoFacade *>((vc)->carto_obj);
+        cf->RunFinalOptimization();
     } catch (int err) {
-        free(vc);
         return err;
     } catch (std::exception &e) {
-        free(vc);
         LOG(ERROR) << e.what();
         return VIAM_CARTO_UNKNOWN_ERROR;
     }
 
-    int slam_mode = VIAM_CARTO_SLAM_MODE_UNKNOWN;
+    return VIAM_CARTO_SUCCESS;
+};
+
+extern int viam_carto_get_algo_config(viam_carto *vc,
+                                      viam_carto_algo_config *ac) {
+    if (vc == nullptr) {
+        return VIAM_CARTO_VC_INVALID;
+    }
+
+    if (ac == nullptr) {
+        return VIAM_CARTO_GET_ALGO_CONFIG_RESPONSE_INVALID;
+    }
+
     try {
-        cf->IOInit();
-        slam_mode =
-            viam::carto_facade::slam_mode_to_vc_slam_mode(cf->slam_mode);
+        viam::carto_facade::CartoFacade *cf =
+            static_cast<viam::carto_facade::CartoFacade *>((vc)->carto_obj);
+        cf->GetAlgoConfig(ac);
     } catch (int err) {
-        delete cf;
-        free(vc);
         return err;
     } catch (std::exception &e) {
         LOG(ERROR) << e.what();
-        delete cf;
-        free(vc);
         return VIAM_CARTO_UNKNOWN_ERROR;
     }
-    vc->carto_obj = cf;
-    vc->slam_mode = slam_mode;
 
-    // point to newly created viam_carto struct
-    *ppVC = vc;
     return VIAM_CARTO_SUCCESS;
 };
 
-extern int viam_carto_start(viam_carto *vc) {
+extern int viam_carto_start_new_trajectory(
+    viam_carto *vc, const viam_carto_start_new_trajectory_request *req,
+    viam_carto_start_new_trajectory_response *r) {
     if (vc == nullptr) {
         return VIAM_CARTO_VC_INVALID;
     }
+
+    if (req == nullptr || r == nullptr) {
+        return VIAM_CARTO_START_NEW_TRAJECTORY_RESPONSE_INVALID;
+    }
+
     try {
         viam::carto_facade::CartoFacade *cf =
-            static_cast<viam::carto_facade::CartoFacade *>(vc->carto_obj);
-        cf->Start();
+            static_cast<viam::carto_facade::CartoFacade *>((vc)->carto_obj);
+        cf->StartNewTrajectory(req, r);
     } catch (int err) {
         return err;
     } catch (std::exception &e) {
         LOG(ERROR) << e.what();
         return VIAM_CARTO_UNKNOWN_ERROR;
     }
+
     return VIAM_CARTO_SUCCESS;
 };
 
-extern int viam_carto_stop(viam_carto *vc) {
+extern int viam_carto_freeze_trajectory(viam_carto *vc, int trajectory_id) {
     if (vc == nullptr) {
         return VIAM_CARTO_VC_INVALID;
     }
 
     try {
         viam::carto_facade::CartoFacade *cf =
-            static_cast<viam::carto_facade::CartoFacade *>(vc->carto_obj);
-        cf->Stop();
+            static_cast<viam::carto_facade::CartoFacade *>((vc)->carto_obj);
+        cf->FreezeTrajectory(trajectory_id);
     } catch (int err) {
         return err;
     } catch (std::exception &e) {
         LOG(ERROR) << e.what();
         return VIAM_CARTO_UNKNOWN_ERROR;
     }
-    return VIAM_CARTO_SUCCESS;
-};
-
-extern int viam_carto_terminate(viam_carto **ppVC) {
-    if (ppVC == nullptr) {
-        return VIAM_CARTO_VC_INVALID;
-    }
 
-    if (*ppVC == nullptr) {
-        return VIAM_CARTO_VC_INVALID;
-    }
-    viam::carto_facade::CartoFacade *cf =
-        static_cast<viam::carto_facade::CartoFacade *>((*ppVC)->carto_obj);
-    if (cf->state != viam::carto_facade::CartoFacadeState::INITIALIZED &&
-        cf->state != viam::carto_facade::CartoFacadeState::IO_INITIALIZED) {
-        LOG(ERROR) << "carto facade is in state: " << cf->state << " expected "
-                   << viam::carto_facade::CartoFacadeState::INITIALIZED
-                   << " or "
-                   << viam::carto_facade::CartoFacadeState::IO_INITIALIZED;
-        return VIAM_CARTO_NOT_IN_TERMINATABLE_STATE;
-    }
-    delete cf;
-    free((viam_carto *)*ppVC);
-    *ppVC = nullptr;
     return VIAM_CARTO_SUCCESS;
 };
 
-extern int viam_carto_add_lidar_reading(viam_carto *vc,
-                                        const viam_carto_lidar_reading *sr) {
+extern int viam_carto_restart_trajectory(
+    viam_carto *vc, const viam_carto_restart_trajectory_request *req,
+    viam_carto_restart_trajectory_response *r) {
     if (vc == nullptr) {
         return VIAM_CARTO_VC_INVALID;
     }
 
-    if (sr == nullptr) {
-        return VIAM_CARTO_LIDAR_READING_INVALID;
+    if (req == nullptr || r == nullptr) {
+        return VIAM_CARTO_UNKNOWN_ERROR;
     }
 
     try {
         viam::carto_facade::CartoFacade *cf =
-            static_cast<viam::carto_facade::CartoFacade *>(vc->carto_obj);
-        cf->AddLidarReading(sr);
+            static_cast<viam::carto_facade::CartoFacade *>((vc)->carto_obj);
+        cf->RestartTrajectory(req, r);
     } catch (int err) {
         return err;
     } catch (std::exception &e) {
         LOG(ERROR) << e.what();
         return VIAM_CARTO_UNKNOWN_ERROR;
     }
+
     return VIAM_CARTO_SUCCESS;
 };
 
-extern int viam_carto_add_lidar_reading_destroy(viam_carto_lidar_reading *sr) {
-    if (sr == nullptr) {
-        return VIAM_CARTO_LIDAR_READING_INVALID;
+extern int viam_carto_set_slam_mode(viam_carto *vc, int slam_mode) {
+    if (vc == nullptr) {
+        return VIAM_CARTO_VC_INVALID;
     }
-    int return_code = VIAM_CARTO_SUCCESS;
-    int rc = BSTR_OK;
-    // destroy lidar_reading
-    rc = bdestroy(sr->lidar_reading);
-    if (rc != BSTR_OK) {
-        return_code = VIAM_CARTO_DESTRUCTOR_ERROR;
+
+    viam::carto_facade::SlamMode sm;
+    switch (slam_mode) {
+        case VIAM_CARTO_SLAM_MODE_MAPPING:
+            sm = viam::carto_facade::SlamMode::MAPPING;
+            break;
+        case VIAM_CARTO_SLAM_MODE_LOCALIZING:
+            sm = viam::carto_facade::SlamMode::LOCALIZING;
+            break;
+        case VIAM_CARTO_SLAM_MODE_UPDATING:
+            sm = viam::carto_facade::SlamMode::UPDATING;
+            break;
+        default:
+            return VIAM_CARTO_SLAM_MODE_INVALID;
     }
-    sr->lidar_reading = nullptr;
 
-    // destroy sensor
-    rc = bdestroy(sr->lidar);
-    if (rc != BSTR_OK) {
-        return_code = VIAM_CARTO_DESTRUCTOR_ERROR;
+    try {
+        viam::carto_facade::CartoFacade *cf =
+            static_cast<viam::carto_facade::CartoFacade *>((vc)->carto_obj);
+        cf->SetSlamMode(sm);
+    } catch (int err) {
+        return err;
+    } catch (std::exception &e) {
+        LOG(ERROR) << e.what();
+        return VIAM_CARTO_UNKNOWN_ERROR;
     }
-    sr->lidar = nullptr;
+    vc->slam_mode = slam_mode;
 
-    return return_code;
+    return VIAM_CARTO_SUCCESS;
 };
 
-extern int viam_carto_add_imu_reading(viam_carto *vc,
-                                      const viam_carto_imu_reading *sr) {
+extern int viam_carto_start_initial_optimization(viam_carto *vc) {
     if (vc == nullptr) {
         return VIAM_CARTO_VC_INVALID;
     }
 
-    if (sr == nullptr) {
-        return VIAM_CARTO_IMU_READING_INVALID;
-    }
-
     try {
         viam::carto_facade::CartoFacade *cf =
-            static_cast<viam::carto_facade::CartoFacade *>(vc->carto_obj);
-        cf->AddIMUReading(sr);
+            static_cast<viam::carto_facade::CartoFacade *>((vc)->carto_obj);
+        cf->StartInitialOptimization();
     } catch (int err) {
         return err;
     } catch (std::exception &e) {
         LOG(ERROR) << e.what();
         return VIAM_CARTO_UNKNOWN_ERROR;
     }
+
     return VIAM_CARTO_SUCCESS;
 };
 
-extern int viam_carto_add_imu_reading_destroy(viam_carto_imu_reading *sr) {
-    if (sr == nullptr) {
-        return VIAM_CARTO_IMU_READING_INVALID;
+extern int viam_carto_get_initial_optimization_running(viam_carto *vc,
+                                                       bool *running) {
+    if (vc == nullptr) {
+        return VIAM_CARTO_VC_INVALID;
     }
-    int return_code = VIAM_CARTO_SUCCESS;
-    int rc = BSTR_OK;
 
-    // destroy sensor
-    rc = bdestroy(sr->imu);
-    if (rc != BSTR_OK) {
-        return_code = VIAM_CARTO_DESTRUCTOR_ERROR;
+    if (running == nullptr) {
+        return VIAM_CARTO_UNKNOWN_ERROR;
     }
-    sr->imu = nullptr;
 
-    return return_code;
+    viam::carto_facade::CartoFacade *cf =
+        static_cast<viam::carto_facade::CartoFacade *>((vc)->carto_obj);
+    *running = cf->InitialOptimizationRunning();
+    return VIAM_CARTO_SUCCESS;
 };
 
-extern int viam_carto_add_odometer_reading(
-    viam_carto *vc, const viam_carto_odometer_reading *sr) {
+extern int viam_carto_get_trajectories(
+    viam_carto *vc, viam_carto_get_trajectories_response *r) {
     if (vc == nullptr) {
         return VIAM_CARTO_VC_INVALID;
     }
 
-    if (sr == nullptr) {
-        return VIAM_CARTO_ODOMETER_READING_INVALID;
+    if (r == nullptr) {
+        return VIAM_CARTO_GET_TRAJECTORIES_RESPONSE_INVALID;
     }
 
     try {
         viam::carto_facade::CartoFacade *cf =
-            static_cast<viam::carto_facade::CartoFacade *>(vc->carto_obj);
-        cf->AddOdometerReading(sr);
+            static_cast<viam::carto_facade::CartoFacade *>((vc)->carto_obj);
+        cf->GetTrajectories(r);
     } catch (int err) {
         return err;
     } catch (std::exception &e) {
         LOG(ERROR) << e.what();
         return VIAM_CARTO_UNKNOWN_ERROR;
     }
+
     return VIAM_CARTO_SUCCESS;
 };
 
-extern int viam_carto_add_odometer_reading_destroy(
-    viam_carto_odometer_reading *sr) {
-    if (sr == nullptr) {
-        return VIAM_CARTO_ODOMETER_READING_INVALID;
-    }
-    int return_code = VIAM_CARTO_SUCCESS;
-    int rc = BSTR_OK;
-
-    // destroy sensor
-    rc = bdestroy(sr->odometer);
-    if (rc != BSTR_OK) {
-        return_code = VIAM_CARTO_DESTRUCTOR_ERROR;
+extern int viam_carto_get_trajectories_response_destroy(
+    viam_carto_get_trajectories_response *r) {
+    if (r == nullptr) {
+        return VIAM_CARTO_GET_TRAJECTORIES_RESPONSE_INVALID;
     }
-    sr->odometer = nullptr;
-
-    return return_code;
+    delete[] r->trajectories;
+    r->trajectories = nullptr;
+    r->num_trajectories = 0;
+    return VIAM_CARTO_SUCCESS;
 };
 
-extern int viam_carto_get_position(viam_carto *vc,
-                                   viam_carto_get_position_response *r) {
+extern int viam_carto_get_trajectory(viam_carto *vc,
+                                     viam_carto_get_trajectory_response *r) {
     if (vc == nullptr) {
         return VIAM_CARTO_VC_INVALID;
     }
 
     if (r == nullptr) {
-        return VIAM_CARTO_GET_POSITION_RESPONSE_INVALID;
+        return VIAM_CARTO_GET_TRAJECTORY_RESPONSE_INVALID;
     }
 
     try {
         viam::carto_facade::CartoFacade *cf =
             static_cast<viam::carto_facade::CartoFacade *>((vc)->carto_obj);
-        cf->GetPosition(r);
+        cf->GetTrajectory(r);
     } catch (int err) {
         return err;
     } catch (std::exception &e) {
         LOG(ERROR) << e.what();
         return VIAM_CARTO_UNKNOWN_ERROR;
     }
+
     return VIAM_CARTO_SUCCESS;
 };
 
-extern int viam_carto_get_position_response_destroy(
-    viam_carto_get_position_response *r) {
+extern int viam_carto_get_trajectory_response_destroy(
+    viam_carto_get_trajectory_response *r) {
     if (r == nullptr) {
-        return VIAM_CARTO_GET_POSITION_RESPONSE_INVALID;
+        return VIAM_CARTO_GET_TRAJECTORY_RESPONSE_INVALID;
     }
-    int return_code = VIAM_CARTO_SUCCESS;
-    return return_code;
+    delete[] r->nodes;
+    r->nodes = nullptr;
+    r->num_nodes = 0;
+    return VIAM_CARTO_SUCCESS;
 };
 
-extern int viam_carto_get_point_cloud_map(
-    viam_carto *vc, viam_carto_get_point_cloud_map_response *r) {
+extern int viam_carto_get_submap_list(viam_carto *vc,
+                                      viam_carto_get_submap_list_response *r) {
     if (vc == nullptr) {
         return VIAM_CARTO_VC_INVALID;
     }
 
     if (r == nullptr) {
-        return VIAM_CARTO_GET_POINT_CLOUD_MAP_RESPONSE_INVALID;
+        return VIAM_CARTO_GET_SUBMAP_LIST_RESPONSE_INVALID;
     }
+
     try {
         viam::carto_facade::CartoFacade *cf =
             static_cast<viam::carto_facade::CartoFacade *>((vc)->carto_obj);
-        cf->GetPointCloudMap(r);
+        cf->GetSubmapList(r);
     } catch (int err) {
         return err;
     } catch (std::exception &e) {
@@ -1164,34 +2315,32 @@ extern int viam_carto_get_point_cloud_map(
     return VIAM_CARTO_SUCCESS;
 };
 
-extern int viam_carto_get_point_cloud_map_response_destroy(
-    viam_carto_get_point_cloud_map_response *r) {
+extern int viam_carto_get_submap_list_response_destroy(
+    viam_carto_get_submap_list_response *r) {
     if (r == nullptr) {
-        return VIAM_CARTO_GET_POINT_CLOUD_MAP_RESPONSE_INVALID;
-    }
-    int return_code = VIAM_CARTO_SUCCESS;
-    int rc = BSTR_OK;
-    rc = bdestroy(r->point_cloud_pcd);
-    if (rc != BSTR_OK) {
-        return_code = VIAM_CARTO_DESTRUCTOR_ERROR;
+        return VIAM_CARTO_GET_SUBMAP_LIST_RESPONSE_INVALID;
     }
-    r->point_cloud_pcd = nullptr;
-    return return_code;
+    delete[] r->submaps;
+    r->submaps = nullptr;
+    r->num_submaps = 0;
+    return VIAM_CARTO_SUCCESS;
 };
 
-extern int viam_carto_get_internal_state(
-    viam_carto *vc, viam_carto_get_internal_state_response *r) {
+extern int viam_carto_get_submap(viam_carto *vc,
+                                 const viam_carto_get_submap_request *req,
+                                 viam_carto_get_submap_response *r) {
     if (vc == nullptr) {
         return VIAM_CARTO_VC_INVALID;
     }
 
-    if (r == nullptr) {
-        return VIAM_CARTO_GET_INTERNAL_STATE_RESPONSE_INVALID;
+    if (req == nullptr || r == nullptr) {
+        return VIAM_CARTO_GET_SUBMAP_RESPONSE_INVALID;
     }
+
     try {
         viam::carto_facade::CartoFacade *cf =
             static_cast<viam::carto_facade::CartoFacade *>((vc)->carto_obj);
-        cf->GetInternalState(r);
+        cf->GetSubmap(req, r);
     } catch (int err) {
         return err;
     } catch (std::exception &e) {
@@ -1202,30 +2351,35 @@ extern int viam_carto_get_internal_state(
     return VIAM_CARTO_SUCCESS;
 };
 
-extern int viam_carto_get_internal_state_response_destroy(
-    viam_carto_get_internal_state_response *r) {
+extern int viam_carto_get_submap_response_destroy(
+    viam_carto_get_submap_response *r) {
     if (r == nullptr) {
-        return VIAM_CARTO_GET_INTERNAL_STATE_RESPONSE_INVALID;
+        return VIAM_CARTO_GET_SUBMAP_RESPONSE_INVALID;
     }
     int return_code = VIAM_CARTO_SUCCESS;
     int rc = BSTR_OK;
-    rc = bdestroy(r->internal_state);
+    rc = bdestroy(r->point_cloud_pcd);
     if (rc != BSTR_OK) {
         return_code = VIAM_CARTO_DESTRUCTOR_ERROR;
     }
-    r->internal_state = nullptr;
+    r->point_cloud_pcd = nullptr;
     return return_code;
 };
 
-extern int viam_carto_run_final_optimization(viam_carto *vc) {
+extern int viam_carto_get_slam_stats(viam_carto *vc,
+                                     viam_carto_get_slam_stats_response *r) {
     if (vc == nullptr) {
         return VIAM_CARTO_VC_INVALID;
     }
 
+    if (r == nullptr) {
+        return VIAM_CARTO_GET_SLAM_STATS_RESPONSE_INVALID;
+    }
+
     try {
         viam::carto_facade::CartoFacade *cf =
             static_cast<viam::carto_facade::CartoFacade *>((vc)->carto_obj);
-        cf->RunFinalOptimization();
+        cf->GetSlamStats(r);
     } catch (int err) {
         return err;
     } catch (std::exception &e) {
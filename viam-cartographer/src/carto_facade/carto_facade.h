@@ -5,8 +5,10 @@
 #ifdef __cplusplus
 #include <atomic>
 #include <chrono>
+#include <fstream>
 #include <shared_mutex>
 #include <string>
+#include <thread>
 
 #include "cartographer/io/submap_painter.h"
 #include "map_builder.h"
@@ -55,6 +57,12 @@ typedef struct viam_carto_get_position_response {
     double imag;
     double jmag;
     double kmag;
+
+    // mean probability, between 0 and 1, of the finished submaps being
+    // occupied at the returns of the latest lidar reading, placed by its
+    // global pose, or -1 if it is unknown because the pose graph has not been
+    // optimized for the first time or there is no finished submap yet
+    double confidence;
 } viam_carto_get_position_response;
 
 typedef struct viam_carto_get_point_cloud_map_response {
@@ -65,6 +73,18 @@ typedef struct viam_carto_get_internal_state_response {
     bstring internal_state;
 } viam_carto_get_internal_state_response;
 
+// Represents an internal state that is read in chunks, so that it never has
+// to be held in memory as a whole
+typedef struct viam_carto_internal_state_stream {
+    void *stream_obj;
+} viam_carto_internal_state_stream;
+
+typedef struct viam_carto_get_internal_state_chunk_response {
+    // the next bytes of the internal state, empty once all of it has been
+    // read
+    bstring chunk;
+} viam_carto_get_internal_state_chunk_response;
+
 typedef struct viam_carto_lidar_reading {
     bstring lidar;
     bstring lidar_reading;
@@ -76,6 +96,17 @@ typedef enum viam_carto_LIDAR_CONFIG {
     VIAM_CARTO_THREE_D = 1
 } viam_carto_LIDAR_CONFIG;
 
+// viam_carto_SENSOR_STREAMS declares which streams of sensor readings will be
+// added. It is checked against movement_sensor, while the streams cartographer
+// waits on follow from use_imu_data, which is only set with an IMU, so a lidar
+// only configuration never waits on IMU readings.
+// VIAM_CARTO_SENSOR_STREAMS_UNSPECIFIED skips the check
+typedef enum viam_carto_SENSOR_STREAMS {
+    VIAM_CARTO_SENSOR_STREAMS_UNSPECIFIED = 0,
+    VIAM_CARTO_LIDAR_ONLY = 1,
+    VIAM_CARTO_LIDAR_AND_MOVEMENT_SENSOR = 2
+} viam_carto_SENSOR_STREAMS;
+
 typedef struct viam_carto_imu_reading {
     bstring imu;
     double lin_acc_x;
@@ -134,6 +165,166 @@ typedef struct viam_carto_odometer_reading {
 #define VIAM_CARTO_IMU_READING_EMPTY 31
 #define VIAM_CARTO_IMU_READING_INVALID 32
 #define VIAM_CARTO_ODOMETER_READING_INVALID 33
+#define VIAM_CARTO_GET_ALGO_CONFIG_RESPONSE_INVALID 34
+#define VIAM_CARTO_START_NEW_TRAJECTORY_RESPONSE_INVALID 35
+#define VIAM_CARTO_GET_TRAJECTORIES_RESPONSE_INVALID 36
+#define VIAM_CARTO_LOG_LEVEL_INVALID 37
+#define VIAM_CARTO_MEMORY_USAGE_UNAVAILABLE 38
+#define VIAM_CARTO_GET_MEMORY_USAGE_RESPONSE_INVALID 39
+#define VIAM_CARTO_GET_SLAM_STATS_RESPONSE_INVALID 40
+#define VIAM_CARTO_FLOOR_PLAN_INVALID 41
+#define VIAM_CARTO_INTERNAL_STATE_VERSION_UNAVAILABLE 42
+#define VIAM_CARTO_GET_INTERNAL_STATE_VERSION_RESPONSE_INVALID 43
+#define VIAM_CARTO_INTERNAL_STATE_INVALID 44
+#define VIAM_CARTO_INTERNAL_STATE_MIGRATION_UNSUPPORTED 45
+#define VIAM_CARTO_INTERNAL_STATE_MIGRATION_FAILED 46
+#define VIAM_CARTO_GET_TRAJECTORY_RESPONSE_INVALID 47
+#define VIAM_CARTO_SENSOR_STREAMS_INVALID 48
+#define VIAM_CARTO_GET_SUBMAP_LIST_RESPONSE_INVALID 49
+#define VIAM_CARTO_GET_SUBMAP_RESPONSE_INVALID 50
+#define VIAM_CARTO_SUBMAP_NOT_FOUND 51
+#define VIAM_CARTO_TRAJECTORY_NOT_FOUND 52
+#define VIAM_CARTO_TRAJECTORY_ACTIVE 53
+#define VIAM_CARTO_NOT_LOCALIZING 54
+#define VIAM_CARTO_INTERNAL_STATE_STREAM_UNAVAILABLE 55
+#define VIAM_CARTO_INTERNAL_STATE_STREAM_INVALID 56
+#define VIAM_CARTO_GET_INTERNAL_STATE_CHUNK_RESPONSE_INVALID 57
+#define VIAM_CARTO_INITIAL_OPTIMIZATION_ALREADY_STARTED 58
+#define VIAM_CARTO_ABI_UNAVAILABLE 59
+#define VIAM_CARTO_GET_ABI_RESPONSE_INVALID 60
+
+// VIAM_CARTO_ABI_VERSION is increased whenever the layout of a struct that is
+// passed to the library changes, e.g. a field is added to viam_carto_config or
+// viam_carto_algo_config. A caller built against another version would
+// misread the structs of the library
+#define VIAM_CARTO_ABI_VERSION 1
+
+#define VIAM_CARTO_TRAJECTORY_STATE_ACTIVE 0
+#define VIAM_CARTO_TRAJECTORY_STATE_FINISHED 1
+#define VIAM_CARTO_TRAJECTORY_STATE_FROZEN 2
+#define VIAM_CARTO_TRAJECTORY_STATE_DELETED 3
+
+typedef struct viam_carto_start_new_trajectory_request {
+    // the initial pose is given in the same units as the
+    // initial_trajectory_pose of the algo config and is relative to the
+    // first trajectory's starting point
+    bool has_initial_pose;
+    double initial_pose_x;
+    double initial_pose_y;
+    double initial_pose_theta;
+} viam_carto_start_new_trajectory_request;
+
+typedef struct viam_carto_start_new_trajectory_response {
+    int finished_trajectory_id;
+    int trajectory_id;
+} viam_carto_start_new_trajectory_response;
+
+typedef struct viam_carto_restart_trajectory_request {
+    // the initial pose is given in the same units as the
+    // initial_trajectory_pose of the algo config and is relative to the
+    // first trajectory's starting point
+    bool has_initial_pose;
+    double initial_pose_x;
+    double initial_pose_y;
+    double initial_pose_theta;
+} viam_carto_restart_trajectory_request;
+
+typedef struct viam_carto_restart_trajectory_response {
+    int restarted_trajectory_id;
+    int trajectory_id;
+} viam_carto_restart_trajectory_response;
+
+typedef struct viam_carto_trajectory {
+    int trajectory_id;
+    int state;
+} viam_carto_trajectory;
+
+typedef struct viam_carto_get_trajectories_response {
+    viam_carto_trajectory *trajectories;
+    int num_trajectories;
+} viam_carto_get_trajectories_response;
+
+typedef struct viam_carto_trajectory_node {
+    int trajectory_id;
+    // the time of the lidar reading the node was created from
+    int64_t time_unix_milli;
+    // the optimized pose of the node, in millimeters from the origin
+    double x;
+    double y;
+    double z;
+
+    // Quaternian information
+    double real;
+    double imag;
+    double jmag;
+    double kmag;
+} viam_carto_trajectory_node;
+
+typedef struct viam_carto_get_trajectory_response {
+    viam_carto_trajectory_node *nodes;
+    int num_nodes;
+} viam_carto_get_trajectory_response;
+
+typedef struct viam_carto_submap {
+    // the id of the submap is its trajectory id & its index within the
+    // trajectory
+    int trajectory_id;
+    int submap_index;
+    // the version of the submap, which increases with every lidar reading
+    // inserted into it
+    int version;
+    // the optimized global pose of the submap, in millimeters from the origin
+    double x;
+    double y;
+    double z;
+
+    // Quaternian information
+    double real;
+    double imag;
+    double jmag;
+    double kmag;
+} viam_carto_submap;
+
+typedef struct viam_carto_get_submap_list_response {
+    viam_carto_submap *submaps;
+    int num_submaps;
+} viam_carto_get_submap_list_response;
+
+typedef struct viam_carto_get_submap_request {
+    int trajectory_id;
+    int submap_index;
+} viam_carto_get_submap_request;
+
+typedef struct viam_carto_get_submap_response {
+    viam_carto_submap submap;
+    // the submap painted on its own, as a binary pcd in the format of the
+    // pointcloud map & in the same frame
+    bstring point_cloud_pcd;
+} viam_carto_get_submap_response;
+
+typedef struct viam_carto_get_slam_stats_response {
+    // the number of nodes of the current trajectory
+    int num_nodes;
+    // the number of nodes of the current trajectory which have not been
+    // covered by an optimization pass of the pose graph yet
+    int num_unoptimized_nodes;
+    // the age of the oldest of those nodes relative to the latest node
+    double oldest_unoptimized_node_age_sec;
+} viam_carto_get_slam_stats_response;
+
+typedef struct viam_carto_get_memory_usage_response {
+    // the number of bytes currently allocated on the heap of the process
+    // outside of the go runtime, which is dominated by cartographer's
+    // submaps & nodes
+    uint64_t allocated_bytes;
+} viam_carto_get_memory_usage_response;
+
+typedef struct viam_carto_get_internal_state_version_response {
+    // the serialization format version of the internal state file
+    int version;
+    // the serialization format version this library writes & loads
+    int current_version;
+} viam_carto_get_internal_state_version_response;
 
 typedef struct viam_carto_algo_config {
     bool optimize_on_start;
@@ -154,6 +345,16 @@ typedef struct viam_carto_algo_config {
     double initial_trajectory_pose_x;
     double initial_trajectory_pose_y;
     double initial_trajectory_pose_theta;
+    // the standard deviations of the initial trajectory pose, x & y in
+    // meters and theta in degrees. The first lidar readings are searched for
+    // in the region they span rather than trusting the initial pose exactly
+    bool has_initial_trajectory_pose_sigma;
+    double initial_trajectory_pose_sigma_x;
+    double initial_trajectory_pose_sigma_y;
+    double initial_trajectory_pose_sigma_theta;
+    // the maximum number of ceres iterations of the final optimization,
+    // 0 leaves it at the max_num_final_iterations of the lua config
+    int final_optimization_iterations;
 
 } viam_carto_algo_config;
 
@@ -163,8 +364,32 @@ typedef struct viam_carto_config {
     viam_carto_LIDAR_CONFIG lidar_config;
     bool enable_mapping;
     bstring existing_map;
+    // floor_plan, if not empty, is loaded as the map instead of existing_map.
+    // it is a pcd in the format of the pointcloud map with a point at the
+    // center of every known cell of an occupancy grid, which holds the
+    // probability of the cell being occupied in percent in the blue channel of
+    // its color. cells without a point are unknown
+    bstring floor_plan;
+    // the size of the cells of floor_plan in meters
+    double floor_plan_resolution;
+    // additional_cameras, if not NULL, holds the names of the lidars other
+    // than camera whose readings are added to the same trajectory. each of
+    // them is a range sensor of its own
+    struct bstrList *additional_cameras;
+    // sensor_streams declares which streams of sensor readings will be added.
+    // VIAM_CARTO_LIDAR_ONLY requires movement_sensor to be empty &
+    // VIAM_CARTO_LIDAR_AND_MOVEMENT_SENSOR requires it to be set
+    viam_carto_SENSOR_STREAMS sensor_streams;
 } viam_carto_config;
 
+typedef struct viam_carto_abi {
+    int version;
+    // the sizes of the structs the library was built with, which catch a
+    // change of their layout that did not increase VIAM_CARTO_ABI_VERSION
+    uint64_t config_size;
+    uint64_t algo_config_size;
+} viam_carto_abi;
+
 // viam_carto_lib_init/4 takes an empty viam_carto_lib pointer to pointer
 // On error: Returns a non 0 error code
 //
@@ -181,6 +406,66 @@ extern int viam_carto_lib_init(viam_carto_lib **vcl,  // OUT
 extern int viam_carto_lib_terminate(viam_carto_lib **vcl  // OUT
 );
 
+// viam_carto_lib_set_log_level/3 takes a valid viam_carto_lib pointer, a glog
+// minloglevel between 0 (INFO) and 3 (FATAL) and a non negative glog verbose
+// level
+// On error: Returns a non 0 error code
+//
+// On success: Returns 0, changes the log levels of all carto instances at
+// runtime & records them in viam_carto_lib
+extern int viam_carto_lib_set_log_level(viam_carto_lib *vcl,  // OUT
+                                        int minloglevel, int verbose);
+
+// viam_carto_lib_get_abi/1 takes a viam_carto_abi pointer
+// On error: Returns a non 0 error code
+//
+// On success: Returns 0, mutates the viam_carto_abi to contain the
+// VIAM_CARTO_ABI_VERSION the library was built with & the sizes of its
+// viam_carto_config & viam_carto_algo_config. It may be called before
+// viam_carto_lib_init/4
+extern int viam_carto_lib_get_abi(viam_carto_abi *abi  // OUT
+);
+
+// viam_carto_lib_get_memory_usage/2 takes a valid viam_carto_lib pointer & a
+// viam_carto_get_memory_usage_response pointer
+// On error: Returns a non 0 error code. VIAM_CARTO_MEMORY_USAGE_UNAVAILABLE
+// is returned on platforms whose allocator does not report its statistics
+//
+// On success: Returns 0, mutates the response to contain the number of bytes
+// currently allocated by the allocator
+extern int viam_carto_lib_get_memory_usage(
+    viam_carto_lib *vcl,                     //
+    viam_carto_get_memory_usage_response *r  // OUT
+);
+
+// viam_carto_lib_get_internal_state_version/3 takes a valid viam_carto_lib
+// pointer, the path of an internal state (pbstream) file & a
+// viam_carto_get_internal_state_version_response pointer
+// On error: Returns a non 0 error code. VIAM_CARTO_INTERNAL_STATE_INVALID is
+// returned if the file does not exist, does not start with the internal state
+// magic number or does not start with a serialization header
+//
+// On success: Returns 0, mutates the response to contain the serialization
+// format version of the file & the one of this library
+extern int viam_carto_lib_get_internal_state_version(
+    viam_carto_lib *vcl,                                //
+    bstring path,                                       //
+    viam_carto_get_internal_state_version_response *r  // OUT
+);
+
+// viam_carto_lib_migrate_internal_state/3 takes a valid viam_carto_lib
+// pointer, the path of an internal state (pbstream) file & the path the
+// migrated internal state is written to
+// On error: Returns a non 0 error code.
+// VIAM_CARTO_INTERNAL_STATE_MIGRATION_UNSUPPORTED is returned if cartographer
+// provides no migration from the version of the file to the current one
+//
+// On success: Returns 0 & writes the internal state in the current
+// serialization format version to dst
+extern int viam_carto_lib_migrate_internal_state(viam_carto_lib *vcl,  //
+                                                 bstring src,          //
+                                                 bstring dst);
+
 // viam_carto_init/4 takes an empty viam_carto pointer to pointer,
 // a viam_carto_lib pointer and a viam_carto_config, and a
 // viam_carto_algo_config
@@ -341,6 +626,55 @@ extern int viam_carto_get_internal_state(
 extern int viam_carto_get_internal_state_response_destroy(
     viam_carto_get_internal_state_response *r);
 
+// viam_carto_get_internal_state_stream/2 takes a viam_carto pointer & an
+// empty viam_carto_internal_state_stream pointer to pointer
+//
+// On error: Returns a non 0 error code
+//
+// On success: Returns 0, mutates the viam_carto_internal_state_stream to
+// point to the current internal state, which is written to a temporary file
+// that viam_carto_get_internal_state_chunk reads from. The stream does not
+// depend on the viam_carto once it has been returned.
+extern int viam_carto_get_internal_state_stream(
+    viam_carto *vc,                       //
+    viam_carto_internal_state_stream **s  // OUT
+);
+
+// viam_carto_get_internal_state_chunk/3 takes a
+// viam_carto_internal_state_stream pointer, the maximum size of the chunk in
+// bytes & a viam_carto_get_internal_state_chunk_response pointer
+//
+// On error: Returns a non 0 error code
+//
+// On success: Returns 0, mutates viam_carto_get_internal_state_chunk_response
+// to contain the next bytes of the internal state, which are empty once all
+// of it has been read
+extern int viam_carto_get_internal_state_chunk(
+    viam_carto_internal_state_stream *s,            //
+    int max_size,                                   //
+    viam_carto_get_internal_state_chunk_response *r  // OUT
+);
+
+// viam_carto_get_internal_state_chunk_response_destroy/1 takes a
+// viam_carto_get_internal_state_chunk_response pointer
+//
+// On error: Returns a non 0 error code
+//
+// On success: Returns 0, frees the
+// viam_carto_get_internal_state_chunk_response.
+extern int viam_carto_get_internal_state_chunk_response_destroy(
+    viam_carto_get_internal_state_chunk_response *r);
+
+// viam_carto_internal_state_stream_destroy/1 takes a
+// viam_carto_internal_state_stream pointer to pointer
+//
+// On error: Returns a non 0 error code
+//
+// On success: Returns 0, deletes the temporary file of the stream & frees
+// the viam_carto_internal_state_stream
+extern int viam_carto_internal_state_stream_destroy(
+    viam_carto_internal_state_stream **s);
+
 // viam_carto_run_final_optimization/2 takes a viam_carto pointer
 //
 // On error: Returns a non 0 error code
@@ -348,6 +682,213 @@ extern int viam_carto_get_internal_state_response_destroy(
 // On success: Returns 0 & blocks until all data has been processed
 extern int viam_carto_run_final_optimization(viam_carto *vc);
 
+// viam_carto_get_algo_config/2 takes a viam_carto pointer, a
+// viam_carto_algo_config pointer
+//
+// On error: Returns a non 0 error code
+//
+// On success: Returns 0, mutates viam_carto_algo_config to contain the
+// algo config cartographer is actually operating with after initialization
+extern int viam_carto_get_algo_config(viam_carto *vc,             //
+                                      viam_carto_algo_config *ac  // OUT
+);
+
+// viam_carto_start_new_trajectory/3 takes a viam_carto pointer, a
+// viam_carto_start_new_trajectory_request pointer and a
+// viam_carto_start_new_trajectory_response pointer
+//
+// On error: Returns a non 0 error code
+//
+// On success: Returns 0, finishes & freezes the current trajectory, which
+// stays part of the pose graph, and starts a new trajectory that all
+// subsequent sensor readings are added to. Mutates
+// viam_carto_start_new_trajectory_response to contain the ids of the
+// finished and the new trajectory.
+extern int viam_carto_start_new_trajectory(
+    viam_carto *vc,                                      //
+    const viam_carto_start_new_trajectory_request *req,  //
+    viam_carto_start_new_trajectory_response *r          // OUT
+);
+
+// viam_carto_freeze_trajectory/2 takes a viam_carto pointer and the id of a
+// trajectory in the pose graph
+//
+// On error: Returns a non 0 error code. Returns
+// VIAM_CARTO_TRAJECTORY_NOT_FOUND if the pose graph has no such trajectory
+// and VIAM_CARTO_TRAJECTORY_ACTIVE if it is the trajectory sensor readings are
+// added to.
+//
+// On success: Returns 0, finishes the trajectory if it is not finished yet
+// and freezes it, so that it stays part of the pose graph for localization
+// while the optimization no longer moves it. Does nothing if the trajectory
+// is frozen already. The pose graph applies the state change
+// asynchronously.
+extern int viam_carto_freeze_trajectory(viam_carto *vc, int trajectory_id);
+
+// viam_carto_restart_trajectory/3 takes a viam_carto pointer, a
+// viam_carto_restart_trajectory_request pointer and a
+// viam_carto_restart_trajectory_response pointer
+//
+// On error: Returns a non 0 error code. Returns VIAM_CARTO_NOT_LOCALIZING if
+// cartographer is not in VIAM_CARTO_SLAM_MODE_LOCALIZING.
+//
+// On success: Returns 0, finishes & deletes the current localization
+// trajectory and starts a new one against the frozen map, at the initial
+// pose of the request if it has one and localized globally against the map
+// otherwise, e.g. after the robot was moved without the sensors noticing.
+// Mutates viam_carto_restart_trajectory_response to contain the ids of the
+// restarted and the new trajectory.
+extern int viam_carto_restart_trajectory(
+    viam_carto *vc,                                    //
+    const viam_carto_restart_trajectory_request *req,  //
+    viam_carto_restart_trajectory_response *r          // OUT
+);
+
+// viam_carto_set_slam_mode/2 takes a viam_carto pointer and one of
+// VIAM_CARTO_SLAM_MODE_MAPPING, VIAM_CARTO_SLAM_MODE_LOCALIZING or
+// VIAM_CARTO_SLAM_MODE_UPDATING
+//
+// On error: Returns a non 0 error code
+//
+// On success: Returns 0, finishes & freezes the current trajectory and starts
+// a new one at the current pose which only localizes against the frozen
+// trajectories in VIAM_CARTO_SLAM_MODE_LOCALIZING and adds to the map
+// otherwise. Sets the slam_mode of the viam_carto. Does nothing if the
+// viam_carto is already in the given slam mode.
+extern int viam_carto_set_slam_mode(viam_carto *vc, int slam_mode);
+
+// viam_carto_start_initial_optimization/1 takes a viam_carto pointer
+//
+// On error: Returns a non 0 error code
+//
+// On success: Returns 0 & starts the optimization that optimize_on_start runs
+// while the viam_carto is started on a background thread, for a viam_carto
+// that was started without it. It does not wait for the optimization, so
+// readings can be added and the position can be gotten while it runs. The
+// pointcloud map is the one cached before the optimization until it completes.
+// Stopping the viam_carto waits for the optimization, as cartographer can not
+// interrupt it.
+extern int viam_carto_start_initial_optimization(viam_carto *vc);
+
+// viam_carto_get_initial_optimization_running/2 takes a viam_carto pointer
+// and a bool pointer
+//
+// On error: Returns a non 0 error code
+//
+// On success: Returns 0, sets running to whether the optimization started by
+// viam_carto_start_initial_optimization is still running
+extern int viam_carto_get_initial_optimization_running(viam_carto *vc,
+                                                       bool *running  // OUT
+);
+
+// viam_carto_get_trajectories/2 takes a viam_carto pointer and a
+// viam_carto_get_trajectories_response pointer
+//
+// On error: Returns a non 0 error code
+//
+// On success: Returns 0, mutates viam_carto_get_trajectories_response to
+// contain the id and VIAM_CARTO_TRAJECTORY_STATE of every trajectory in the
+// pose graph, ordered by id. The response must be freed with
+// viam_carto_get_trajectories_response_destroy.
+extern int viam_carto_get_trajectories(
+    viam_carto *vc,                          //
+    viam_carto_get_trajectories_response *r  // OUT
+);
+
+// viam_carto_get_trajectories_response_destroy/1 takes a
+// viam_carto_get_trajectories_response pointer
+//
+// On error: Returns a non 0 error code
+//
+// On success: Returns 0, frees the viam_carto_get_trajectories_response.
+extern int viam_carto_get_trajectories_response_destroy(
+    viam_carto_get_trajectories_response *r);
+
+// viam_carto_get_trajectory/2 takes a viam_carto pointer and a
+// viam_carto_get_trajectory_response pointer
+//
+// On error: Returns a non 0 error code
+//
+// On success: Returns 0, mutates viam_carto_get_trajectory_response to
+// contain the time & optimized pose of every node of every trajectory in the
+// pose graph, ordered by trajectory id & time. Nodes whose data has been
+// trimmed are left out. The response must be freed with
+// viam_carto_get_trajectory_response_destroy.
+extern int viam_carto_get_trajectory(
+    viam_carto *vc,                        //
+    viam_carto_get_trajectory_response *r  // OUT
+);
+
+// viam_carto_get_trajectory_response_destroy/1 takes a
+// viam_carto_get_trajectory_response pointer
+//
+// On error: Returns a non 0 error code
+//
+// On success: Returns 0, frees the viam_carto_get_trajectory_response.
+extern int viam_carto_get_trajectory_response_destroy(
+    viam_carto_get_trajectory_response *r);
+
+// viam_carto_get_submap_list/2 takes a viam_carto pointer and a
+// viam_carto_get_submap_list_response pointer
+//
+// On error: Returns a non 0 error code
+//
+// On success: Returns 0, mutates viam_carto_get_submap_list_response to
+// contain the id, version & optimized pose of every submap in the pose graph,
+// ordered by id. The response must be freed with
+// viam_carto_get_submap_list_response_destroy.
+extern int viam_carto_get_submap_list(
+    viam_carto *vc,                         //
+    viam_carto_get_submap_list_response *r  // OUT
+);
+
+// viam_carto_get_submap_list_response_destroy/1 takes a
+// viam_carto_get_submap_list_response pointer
+//
+// On error: Returns a non 0 error code
+//
+// On success: Returns 0, frees the viam_carto_get_submap_list_response.
+extern int viam_carto_get_submap_list_response_destroy(
+    viam_carto_get_submap_list_response *r);
+
+// viam_carto_get_submap/3 takes a viam_carto pointer, a
+// viam_carto_get_submap_request pointer and a viam_carto_get_submap_response
+// pointer
+//
+// On error: Returns a non 0 error code, VIAM_CARTO_SUBMAP_NOT_FOUND if the
+// pose graph has no submap of the requested id
+//
+// On success: Returns 0, mutates viam_carto_get_submap_response to contain
+// the id, version & optimized pose of the requested submap & its pointcloud.
+// The response must be freed with viam_carto_get_submap_response_destroy.
+extern int viam_carto_get_submap(
+    viam_carto *vc,                            //
+    const viam_carto_get_submap_request *req,  //
+    viam_carto_get_submap_response *r          // OUT
+);
+
+// viam_carto_get_submap_response_destroy/1 takes a
+// viam_carto_get_submap_response pointer
+//
+// On error: Returns a non 0 error code
+//
+// On success: Returns 0, frees the viam_carto_get_submap_response.
+extern int viam_carto_get_submap_response_destroy(
+    viam_carto_get_submap_response *r);
+
+// viam_carto_get_slam_stats/2 takes a viam_carto pointer & a
+// viam_carto_get_slam_stats_response pointer
+//
+// On error: Returns a non 0 error code
+//
+// On success: Returns 0, mutates the response to contain the number of nodes
+// of the current trajectory & how far the optimization of the pose graph lags
+// behind them
+extern int viam_carto_get_slam_stats(
+    viam_carto *vc,                        //
+    viam_carto_get_slam_stats_response *r  // OUT
+);
+
 #ifdef __cplusplus
 }
 #endif
@@ -362,6 +903,14 @@ enum class SlamMode { MAPPING, LOCALIZING, UPDATING };
 std::ostream &operator<<(std::ostream &os, const SlamMode &slam_mode);
 static const int checkForShutdownIntervalMicroseconds = 1e5;
 
+// InternalStateStream is the stream_obj of a
+// viam_carto_internal_state_stream, the temporary file the internal state is
+// read from in chunks
+typedef struct InternalStateStream {
+    std::string filename;
+    std::ifstream file;
+} InternalStateStream;
+
 // The resolutionMeters variable defines the area in meters that each pixel
 // represents. This is used to draw the cairo map and in so doing defines the
 // resolution of the outputted PCD
@@ -373,8 +922,16 @@ typedef struct config {
     viam_carto_LIDAR_CONFIG lidar_config;
     bool enable_mapping;
     std::string existing_map;
+    std::string floor_plan;
+    double floor_plan_resolution;
+    std::vector<std::string> additional_cameras;
+    viam_carto_SENSOR_STREAMS sensor_streams;
 } config;
 
+// additional_range_sensor_id returns the id of the range sensor the readings
+// of one of the additional cameras are added as.
+std::string additional_range_sensor_id(const std::string &camera);
+
 // function to convert viam_carto_config into  viam::carto_facade::config
 config from_viam_carto_config(viam_carto_config vcc);
 
@@ -385,7 +942,7 @@ const std::string configuration_mapping_basename = "mapping_new_map.lua";
 const std::string configuration_localization_basename = "locating_in_map.lua";
 const std::string configuration_update_basename = "updating_a_map.lua";
 
-carto_facade::SlamMode determine_slam_mode(std::string path_to_map,
+carto_facade::SlamMode determine_slam_mode(bool has_apriori_map,
                                            bool enable_mapping);
 
 int slam_mode_to_vc_slam_mode(viam::carto_facade::SlamMode sm);
@@ -421,19 +978,80 @@ class CartoFacade {
     // maximumGRPCByteChunkSize
     void GetInternalState(viam_carto_get_internal_state_response *r);
 
+    // GetInternalStateStream returns a stream of the current internal state
+    // which is read in chunks from a temporary file
+    InternalStateStream *GetInternalStateStream();
+
     void AddLidarReading(const viam_carto_lidar_reading *sr);
 
     void AddIMUReading(const viam_carto_imu_reading *sr);
 
     void AddOdometerReading(const viam_carto_odometer_reading *sr);
 
+    // GetAlgoConfig returns the algo config values the map builder is
+    // operating with, which may differ from the requested algo_config
+    void GetAlgoConfig(viam_carto_algo_config *ac);
+
+    // StartNewTrajectory finishes & freezes the current trajectory and starts
+    // a new one, optionally at the requested initial pose, so that a new
+    // mapping session can be added to the existing pose graph
+    void StartNewTrajectory(const viam_carto_start_new_trajectory_request *req,
+                            viam_carto_start_new_trajectory_response *r);
+
+    // FreezeTrajectory finishes & freezes a trajectory other than the one
+    // sensor readings are added to
+    void FreezeTrajectory(int trajectory_id);
+
+    // RestartTrajectory replaces the current localization trajectory with a
+    // new one against the frozen map
+    void RestartTrajectory(const viam_carto_restart_trajectory_request *req,
+                           viam_carto_restart_trajectory_response *r);
+
+    // SetSlamMode switches between localizing against the map & adding to it
+    // by finishing & freezing the current trajectory and starting a new one at
+    // the current pose
+    void SetSlamMode(SlamMode sm);
+
+    // GetTrajectories returns the ids & states of all trajectories in the
+    // pose graph
+    void GetTrajectories(viam_carto_get_trajectories_response *r);
+
+    // GetTrajectory returns the time & optimized pose of every node of every
+    // trajectory in the pose graph
+    void GetTrajectory(viam_carto_get_trajectory_response *r);
+
+    // GetSubmapList returns the id, version & optimized pose of every submap
+    // in the pose graph
+    void GetSubmapList(viam_carto_get_submap_list_response *r);
+
+    // GetSubmap returns the id, version & optimized pose of the requested
+    // submap along with the pointcloud of the submap painted on its own
+    void GetSubmap(const viam_carto_get_submap_request *req,
+                   viam_carto_get_submap_response *r);
+
+    // GetSlamStats returns the number of nodes of the current trajectory &
+    // how far the optimization of the pose graph lags behind them
+    void GetSlamStats(viam_carto_get_slam_stats_response *r);
+
     void Start();
 
     void Stop();
 
+    // StartInitialOptimization starts the optimization that optimize_on_start
+    // runs on thread_initial_optimization
+    void StartInitialOptimization();
+
+    // InitialOptimizationRunning returns whether the optimization started by
+    // StartInitialOptimization is still running
+    bool InitialOptimizationRunning();
+
     // non api methods
     void CacheLatestMap();
     void CacheMapInLocalizationMode();
+    // LoadFloorPlan loads the floor plan of the config as a trajectory with a
+    // single finished submap, which is frozen if load_frozen_trajectory is
+    // true.
+    void LoadFloorPlan(bool load_frozen_trajectory);
     void GetLatestSampledPointCloudMapString(std::string &pointcloud);
     void RunFinalOptimization();
     cartographer::io::PaintSubmapSlicesResult GetLatestPaintedMapSlices();
@@ -443,7 +1061,7 @@ class CartoFacade {
     std::string path_to_internal_state_file;
     std::atomic<CartoFacadeState> state{CartoFacadeState::INITIALIZED};
     std::string configuration_directory;
-    SlamMode slam_mode = SlamMode::MAPPING;
+    std::atomic<SlamMode> slam_mode{SlamMode::MAPPING};
 
     // If mutexes map_builder_mutex and optimization_shared_mutex are held
     // concurrently, then optimization_shared_mutex must be taken
@@ -453,11 +1071,37 @@ class CartoFacade {
     MapBuilder map_builder;
 
    private:
+    // SaveInternalStateToTempFile saves the current internal state to a
+    // temporary pbstream file & returns its path
+    std::string SaveInternalStateToTempFile();
+
     // moved from namespace
     std::shared_mutex optimization_shared_mutex;
 
     std::unique_ptr<std::thread> thread_save_internal_state;
 
+    // thread_initial_optimization runs the optimization started by
+    // StartInitialOptimization, holding optimization_shared_mutex exclusively
+    // so that the pointcloud map is served from latest_pointcloud_map
+    std::unique_ptr<std::thread> thread_initial_optimization;
+    std::atomic<bool> initial_optimization_running{false};
+
+    // JoinInitialOptimization waits for the optimization started by
+    // StartInitialOptimization, if any
+    void JoinInitialOptimization();
+
+    // kRelocalizationReadings is the number of lidar readings that are
+    // searched for within the standard deviations of the initial pose
+    static constexpr int kRelocalizationReadings = 10;
+    // TryRelocalization searches for the last lidar reading within the
+    // relocalization search windows and restarts the trajectory where it
+    // matches, until it does or relocalization_readings_left runs out. It is
+    // called with map_builder_mutex held, which guards the fields below.
+    void TryRelocalization();
+    int relocalization_readings_left = 0;
+    double relocalization_linear_search_window = 0;
+    double relocalization_angular_search_window = 0;
+
     std::mutex viam_response_mutex;
     cartographer::transform::Rigid3d latest_global_pose =
         cartographer::transform::Rigid3d();
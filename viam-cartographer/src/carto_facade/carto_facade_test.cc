@@ -12,6 +12,7 @@
 #include <cstring>
 #include <exception>
 #include <filesystem>
+#include <fstream>
 #include <shared_mutex>
 #include <string>
 
@@ -39,6 +40,10 @@ viam_carto_config viam_carto_config_setup(viam_carto_LIDAR_CONFIG lidar_config,
     vcc.movement_sensor = bfromcstr(movement_sensor.c_str());
     vcc.enable_mapping = enable_mapping;
     vcc.existing_map = bfromcstr(existing_map.c_str());
+    vcc.floor_plan = bfromcstr("");
+    vcc.floor_plan_resolution = 0;
+    vcc.additional_cameras = nullptr;
+    vcc.sensor_streams = VIAM_CARTO_SENSOR_STREAMS_UNSPECIFIED;
     return vcc;
 }
 
@@ -46,6 +51,7 @@ void viam_carto_config_teardown(viam_carto_config vcc) {
     BOOST_TEST(bdestroy(vcc.camera) == BSTR_OK);
     BOOST_TEST(bdestroy(vcc.movement_sensor) == BSTR_OK);
     BOOST_TEST(bdestroy(vcc.existing_map) == BSTR_OK);
+    BOOST_TEST(bdestroy(vcc.floor_plan) == BSTR_OK);
 }
 viam_carto_lidar_reading new_test_lidar_reading(
     std::string lidar, std::string pcd_path,
@@ -136,6 +142,10 @@ viam_carto_algo_config viam_carto_algo_config_setup(bool use_imu_data) {
     ac.initial_trajectory_pose_x = 0;
     ac.initial_trajectory_pose_y = 0;
     ac.initial_trajectory_pose_theta = 0;
+    ac.has_initial_trajectory_pose_sigma = false;
+    ac.initial_trajectory_pose_sigma_x = 0;
+    ac.initial_trajectory_pose_sigma_y = 0;
+    ac.initial_trajectory_pose_sigma_theta = 0;
     return ac;
 }
 
@@ -168,6 +178,122 @@ BOOST_AUTO_TEST_CASE(CartoFacade_lib_init_terminate) {
     BOOST_TEST(FLAGS_minloglevel == 0);
 }
 
+BOOST_AUTO_TEST_CASE(CartoFacade_lib_set_log_level) {
+    viam_carto_lib *lib;
+    BOOST_TEST(viam_carto_lib_set_log_level(nullptr, 0, 0) ==
+               VIAM_CARTO_LIB_INVALID);
+    BOOST_TEST(viam_carto_lib_init(&lib, 1, 0) == VIAM_CARTO_SUCCESS);
+
+    // invalid levels are rejected and leave the levels unchanged
+    BOOST_TEST(viam_carto_lib_set_log_level(lib, -1, 0) ==
+               VIAM_CARTO_LOG_LEVEL_INVALID);
+    BOOST_TEST(viam_carto_lib_set_log_level(lib, 4, 0) ==
+               VIAM_CARTO_LOG_LEVEL_INVALID);
+    BOOST_TEST(viam_carto_lib_set_log_level(lib, 0, -1) ==
+               VIAM_CARTO_LOG_LEVEL_INVALID);
+    BOOST_TEST(lib->minloglevel == 1);
+    BOOST_TEST(lib->verbose == 0);
+    BOOST_TEST(FLAGS_minloglevel == 1);
+    BOOST_TEST(FLAGS_v == 0);
+
+    BOOST_TEST(viam_carto_lib_set_log_level(lib, 0, 1) == VIAM_CARTO_SUCCESS);
+    BOOST_TEST(lib->minloglevel == 0);
+    BOOST_TEST(lib->verbose == 1);
+    // begin global side effects
+    BOOST_TEST(FLAGS_minloglevel == 0);
+    BOOST_TEST(FLAGS_v == 1);
+    // end global side effects
+
+    BOOST_TEST(viam_carto_lib_terminate(&lib) == VIAM_CARTO_SUCCESS);
+}
+
+BOOST_AUTO_TEST_CASE(CartoFacade_lib_get_abi) {
+    viam_carto_abi abi;
+    BOOST_TEST(viam_carto_lib_get_abi(nullptr) ==
+               VIAM_CARTO_GET_ABI_RESPONSE_INVALID);
+    BOOST_TEST(viam_carto_lib_get_abi(&abi) == VIAM_CARTO_SUCCESS);
+    BOOST_TEST(abi.version == VIAM_CARTO_ABI_VERSION);
+    BOOST_TEST(abi.config_size == sizeof(viam_carto_config));
+    BOOST_TEST(abi.algo_config_size == sizeof(viam_carto_algo_config));
+}
+
+BOOST_AUTO_TEST_CASE(CartoFacade_lib_get_memory_usage) {
+    viam_carto_lib *lib;
+    viam_carto_get_memory_usage_response r;
+    BOOST_TEST(viam_carto_lib_get_memory_usage(nullptr, &r) ==
+               VIAM_CARTO_LIB_INVALID);
+    BOOST_TEST(viam_carto_lib_init(&lib, 0, 0) == VIAM_CARTO_SUCCESS);
+    BOOST_TEST(viam_carto_lib_get_memory_usage(lib, nullptr) ==
+               VIAM_CARTO_GET_MEMORY_USAGE_RESPONSE_INVALID);
+
+    BOOST_TEST(viam_carto_lib_get_memory_usage(lib, &r) == VIAM_CARTO_SUCCESS);
+    uint64_t allocated_bytes = r.allocated_bytes;
+    BOOST_TEST(allocated_bytes > 0);
+
+    // allocations are accounted for
+    std::vector<char> allocation(64 * 1024 * 1024, 1);
+    BOOST_TEST(viam_carto_lib_get_memory_usage(lib, &r) == VIAM_CARTO_SUCCESS);
+    BOOST_TEST(r.allocated_bytes >= allocated_bytes + allocation.size());
+
+    BOOST_TEST(viam_carto_lib_terminate(&lib) == VIAM_CARTO_SUCCESS);
+}
+
+BOOST_AUTO_TEST_CASE(CartoFacade_lib_internal_state_version) {
+    viam_carto_lib *lib;
+    viam_carto_get_internal_state_version_response r;
+    auto internal_state = fs::current_path() /
+                          fs::path(
+                              ".artifact/data/viam-cartographer/outputs/"
+                              "viam-office-02-22-3/internal_state/"
+                              "internal_state_0.pbstream");
+    bstring path = bfromcstr(internal_state.c_str());
+    bstring missing_path = bfromcstr("/does/not/exist.pbstream");
+    fs::path tmp_dir =
+        fs::temp_directory_path() / fs::path(bfs::unique_path().string());
+    fs::create_directory(tmp_dir);
+    bstring dst_path = bfromcstr((tmp_dir / "migrated.pbstream").c_str());
+
+    BOOST_TEST(viam_carto_lib_get_internal_state_version(nullptr, path, &r) ==
+               VIAM_CARTO_LIB_INVALID);
+    BOOST_TEST(viam_carto_lib_migrate_internal_state(nullptr, path,
+                                                     dst_path) ==
+               VIAM_CARTO_LIB_INVALID);
+    BOOST_TEST(viam_carto_lib_init(&lib, 0, 0) == VIAM_CARTO_SUCCESS);
+    BOOST_TEST(viam_carto_lib_get_internal_state_version(lib, path,
+                                                         nullptr) ==
+               VIAM_CARTO_GET_INTERNAL_STATE_VERSION_RESPONSE_INVALID);
+    BOOST_TEST(viam_carto_lib_get_internal_state_version(
+                   lib, missing_path, &r) == VIAM_CARTO_INTERNAL_STATE_INVALID);
+    // a file without the magic number is rejected rather than aborting
+    fs::path invalid = tmp_dir / "invalid.pbstream";
+    {
+        std::ofstream invalid_file(invalid.string(), std::ios::binary);
+        invalid_file << "not an internal state";
+    }
+    bstring invalid_path = bfromcstr(invalid.c_str());
+    BOOST_TEST(viam_carto_lib_get_internal_state_version(
+                   lib, invalid_path, &r) == VIAM_CARTO_INTERNAL_STATE_INVALID);
+    BOOST_TEST(viam_carto_lib_migrate_internal_state(lib, invalid_path,
+                                                     dst_path) ==
+               VIAM_CARTO_INTERNAL_STATE_INVALID);
+    BOOST_TEST(bdestroy(invalid_path) == BSTR_OK);
+
+    // the test artifact is in the current format
+    BOOST_TEST(viam_carto_lib_get_internal_state_version(lib, path, &r) ==
+               VIAM_CARTO_SUCCESS);
+    BOOST_TEST(r.version == r.current_version);
+    BOOST_TEST(r.current_version > 0);
+    BOOST_TEST(viam_carto_lib_migrate_internal_state(lib, path, dst_path) ==
+               VIAM_CARTO_INTERNAL_STATE_MIGRATION_UNSUPPORTED);
+    BOOST_TEST(!fs::exists(tmp_dir / "migrated.pbstream"));
+
+    BOOST_TEST(viam_carto_lib_terminate(&lib) == VIAM_CARTO_SUCCESS);
+    BOOST_TEST(bdestroy(path) == BSTR_OK);
+    BOOST_TEST(bdestroy(missing_path) == BSTR_OK);
+    BOOST_TEST(bdestroy(dst_path) == BSTR_OK);
+    fs::remove_all(tmp_dir);
+}
+
 BOOST_AUTO_TEST_CASE(CartoFacade_init_validate) {
     viam_carto_lib *lib;
     BOOST_TEST(viam_carto_lib_init(&lib, 0, 1) == VIAM_CARTO_SUCCESS);
@@ -278,7 +404,7 @@ BOOST_AUTO_TEST_CASE(CartoFacade_init_derive_slam_mode) {
         BOOST_TEST(vc1->slam_mode == VIAM_CARTO_SLAM_MODE_MAPPING);
         viam::carto_facade::CartoFacade *cf1 =
             static_cast<viam::carto_facade::CartoFacade *>(vc1->carto_obj);
-        BOOST_TEST(cf1->slam_mode == SlamMode::MAPPING);
+        BOOST_TEST((cf1->slam_mode == SlamMode::MAPPING));
         BOOST_TEST(cf1->map_builder.GetOptimizeEveryNNodes() ==
                    ac.optimize_every_n_nodes);
         BOOST_TEST(cf1->map_builder.GetNumRangeData() == ac.num_range_data);
@@ -341,7 +467,7 @@ BOOST_AUTO_TEST_CASE(CartoFacade_init_derive_slam_mode) {
         BOOST_TEST(vc2->slam_mode == VIAM_CARTO_SLAM_MODE_UPDATING);
         viam::carto_facade::CartoFacade *cf2 =
             static_cast<viam::carto_facade::CartoFacade *>(vc2->carto_obj);
-        BOOST_TEST(cf2->slam_mode == SlamMode::UPDATING);
+        BOOST_TEST((cf2->slam_mode == SlamMode::UPDATING));
         BOOST_TEST(cf2->map_builder.GetOptimizeEveryNNodes() ==
                    ac.optimize_every_n_nodes);
         BOOST_TEST(cf2->map_builder.GetNumRangeData() == ac.num_range_data);
@@ -384,7 +510,7 @@ BOOST_AUTO_TEST_CASE(CartoFacade_init_derive_slam_mode) {
         BOOST_TEST(vc3->slam_mode == VIAM_CARTO_SLAM_MODE_UPDATING);
         viam::carto_facade::CartoFacade *cf2 =
             static_cast<viam::carto_facade::CartoFacade *>(vc3->carto_obj);
-        BOOST_TEST(cf2->slam_mode == SlamMode::UPDATING);
+        BOOST_TEST((cf2->slam_mode == SlamMode::UPDATING));
         BOOST_TEST(viam_carto_terminate(&vc3) == VIAM_CARTO_SUCCESS);
         viam_carto_config_teardown(vcc_updating);
     }
@@ -400,7 +526,7 @@ BOOST_AUTO_TEST_CASE(CartoFacade_init_derive_slam_mode) {
         BOOST_TEST(vc4->slam_mode == VIAM_CARTO_SLAM_MODE_LOCALIZING);
         viam::carto_facade::CartoFacade *cf3 =
             static_cast<viam::carto_facade::CartoFacade *>(vc4->carto_obj);
-        BOOST_TEST(cf3->slam_mode == SlamMode::LOCALIZING);
+        BOOST_TEST((cf3->slam_mode == SlamMode::LOCALIZING));
         BOOST_TEST(cf3->map_builder.GetOptimizeEveryNNodes() ==
                    ac.optimize_every_n_nodes);
         BOOST_TEST(cf3->map_builder.GetNumRangeData() == ac.num_range_data);
@@ -435,7 +561,7 @@ BOOST_AUTO_TEST_CASE(CartoFacade_init_derive_slam_mode) {
         BOOST_TEST(vc5->slam_mode == VIAM_CARTO_SLAM_MODE_LOCALIZING);
         viam::carto_facade::CartoFacade *cf3 =
             static_cast<viam::carto_facade::CartoFacade *>(vc5->carto_obj);
-        BOOST_TEST(cf3->slam_mode == SlamMode::LOCALIZING);
+        BOOST_TEST((cf3->slam_mode == SlamMode::LOCALIZING));
         BOOST_TEST(viam_carto_terminate(&vc5) == VIAM_CARTO_SUCCESS);
         viam_carto_config_teardown(vcc_localizing);
     }
@@ -451,6 +577,54 @@ BOOST_AUTO_TEST_CASE(CartoFacade_init_derive_slam_mode) {
         viam_carto_config_teardown(vcc_invalid);
     }
 
+    {
+        // localizing against a floor plan: an occupied cell next to a free
+        // cell, 5cm apart
+        std::string floor_plan =
+            "VERSION .7\n"
+            "FIELDS x y z rgb\n"
+            "SIZE 4 4 4 4\n"
+            "TYPE F F F U\n"
+            "COUNT 1 1 1 1\n"
+            "WIDTH 2\n"
+            "HEIGHT 1\n"
+            "VIEWPOINT 0 0 0 1 0 0 0\n"
+            "POINTS 2\n"
+            "DATA ascii\n"
+            "0.025 0.025 0 100\n"
+            "0.075 0.025 0 0\n";
+        viam_carto *vc7;
+        struct viam_carto_config vcc_floor_plan = viam_carto_config_setup(
+            VIAM_CARTO_TWO_D, camera, movement_sensor, false, "");
+        BOOST_TEST(bdestroy(vcc_floor_plan.floor_plan) == BSTR_OK);
+        vcc_floor_plan.floor_plan =
+            blk2bstr(floor_plan.c_str(), floor_plan.length());
+        vcc_floor_plan.floor_plan_resolution = 0.05;
+        BOOST_TEST(viam_carto_init(&vc7, lib, vcc_floor_plan, ac) ==
+                   VIAM_CARTO_SUCCESS);
+        BOOST_TEST(vc7->slam_mode == VIAM_CARTO_SLAM_MODE_LOCALIZING);
+        BOOST_TEST(viam_carto_terminate(&vc7) == VIAM_CARTO_SUCCESS);
+
+        // a floor plan can't be combined with an existing map
+        viam_carto *vc8;
+        struct viam_carto_config vcc_floor_plan_and_map =
+            viam_carto_config_setup(VIAM_CARTO_TWO_D, camera, movement_sensor,
+                                    false, internal_state_file_path);
+        BOOST_TEST(bdestroy(vcc_floor_plan_and_map.floor_plan) == BSTR_OK);
+        vcc_floor_plan_and_map.floor_plan =
+            blk2bstr(floor_plan.c_str(), floor_plan.length());
+        vcc_floor_plan_and_map.floor_plan_resolution = 0.05;
+        BOOST_TEST(viam_carto_init(&vc8, lib, vcc_floor_plan_and_map, ac) ==
+                   VIAM_CARTO_FLOOR_PLAN_INVALID);
+
+        // a floor plan needs a resolution
+        vcc_floor_plan.floor_plan_resolution = 0;
+        BOOST_TEST(viam_carto_init(&vc8, lib, vcc_floor_plan, ac) ==
+                   VIAM_CARTO_FLOOR_PLAN_INVALID);
+        viam_carto_config_teardown(vcc_floor_plan_and_map);
+        viam_carto_config_teardown(vcc_floor_plan);
+    }
+
     // TODO: Move all suite level setup & teardown to boost test hook
     fs::remove_all(tmp_dir);
 
@@ -744,6 +918,8 @@ BOOST_AUTO_TEST_CASE(CartoFacade_demo_without_movement_sensor) {
         BOOST_TEST(pr.jmag == 0);
         BOOST_TEST(pr.kmag == 0);
         BOOST_TEST(pr.real == 1);
+        // the pose graph is not optimized before optimize_every_n_nodes
+        BOOST_TEST(pr.confidence == -1);
 
         BOOST_TEST(viam_carto_get_position_response_destroy(&pr) ==
                    VIAM_CARTO_SUCCESS);
@@ -781,6 +957,41 @@ BOOST_AUTO_TEST_CASE(CartoFacade_demo_without_movement_sensor) {
                    VIAM_CARTO_SUCCESS);
     }
 
+    // GetInternalStateStream reads the same internal state in chunks
+    {
+        BOOST_TEST(viam_carto_get_internal_state_stream(nullptr, nullptr) ==
+                   VIAM_CARTO_VC_INVALID);
+        BOOST_TEST(viam_carto_get_internal_state_stream(vc, nullptr) ==
+                   VIAM_CARTO_INTERNAL_STATE_STREAM_INVALID);
+        BOOST_TEST(viam_carto_internal_state_stream_destroy(nullptr) ==
+                   VIAM_CARTO_INTERNAL_STATE_STREAM_INVALID);
+
+        viam_carto_internal_state_stream *iss = nullptr;
+        BOOST_TEST(viam_carto_get_internal_state_stream(vc, &iss) ==
+                   VIAM_CARTO_SUCCESS);
+        BOOST_TEST(viam_carto_get_internal_state_chunk(iss, 0, nullptr) ==
+                   VIAM_CARTO_INTERNAL_STATE_STREAM_INVALID);
+        BOOST_TEST(viam_carto_get_internal_state_chunk(iss, 1024, nullptr) ==
+                   VIAM_CARTO_GET_INTERNAL_STATE_CHUNK_RESPONSE_INVALID);
+
+        int streamed_size = 0;
+        int chunk_size = 0;
+        do {
+            viam_carto_get_internal_state_chunk_response cr;
+            BOOST_TEST(viam_carto_get_internal_state_chunk(iss, 1024, &cr) ==
+                       VIAM_CARTO_SUCCESS);
+            chunk_size = blength(cr.chunk);
+            BOOST_TEST(chunk_size <= 1024);
+            streamed_size += chunk_size;
+            BOOST_TEST(viam_carto_get_internal_state_chunk_response_destroy(
+                           &cr) == VIAM_CARTO_SUCCESS);
+        } while (chunk_size > 0);
+        BOOST_TEST(streamed_size == last_internal_state_response_size);
+        BOOST_TEST(viam_carto_internal_state_stream_destroy(&iss) ==
+                   VIAM_CARTO_SUCCESS);
+        BOOST_TEST(iss == nullptr);
+    }
+
     // third sensor reading
     {
         std::string pcd_path =
@@ -889,6 +1100,18 @@ BOOST_AUTO_TEST_CASE(CartoFacade_config_without_movement_sensor) {
     BOOST_TEST(c.camera == "lidar");
     BOOST_TEST(c.movement_sensor == "");
     BOOST_TEST(c.enable_mapping == true);
+    BOOST_TEST(c.sensor_streams == VIAM_CARTO_SENSOR_STREAMS_UNSPECIFIED);
+
+    vcc.sensor_streams = VIAM_CARTO_LIDAR_ONLY;
+    c = viam::carto_facade::from_viam_carto_config(vcc);
+    BOOST_TEST(c.sensor_streams == VIAM_CARTO_LIDAR_ONLY);
+
+    // the movement sensor streams can't be declared without a movement sensor
+    vcc.sensor_streams = VIAM_CARTO_LIDAR_AND_MOVEMENT_SENSOR;
+    viam_carto *vc;
+    struct viam_carto_algo_config ac = viam_carto_algo_config_setup(false);
+    BOOST_TEST(viam_carto_init(&vc, lib, vcc, ac) ==
+               VIAM_CARTO_SENSOR_STREAMS_INVALID);
 
     viam_carto_config_teardown(vcc);
 
@@ -896,6 +1119,45 @@ BOOST_AUTO_TEST_CASE(CartoFacade_config_without_movement_sensor) {
     BOOST_TEST(viam_carto_lib_terminate(&lib) == VIAM_CARTO_SUCCESS);
 }
 
+BOOST_AUTO_TEST_CASE(CartoFacade_config_with_additional_cameras) {
+    viam_carto_lib *lib;
+    BOOST_TEST(viam_carto_lib_init(&lib, 0, 1) == VIAM_CARTO_SUCCESS);
+    viam_carto *vc;
+    struct viam_carto_algo_config ac = viam_carto_algo_config_setup(false);
+
+    struct viam_carto_config vcc =
+        viam_carto_config_setup(VIAM_CARTO_TWO_D, "lidar", "", true, "");
+    vcc.additional_cameras = bstrListCreate();
+    BOOST_TEST(bstrListAlloc(vcc.additional_cameras, 2) == BSTR_OK);
+    vcc.additional_cameras->entry[0] = bfromcstr("rear_lidar");
+    vcc.additional_cameras->qty = 1;
+
+    struct config c = viam::carto_facade::from_viam_carto_config(vcc);
+    BOOST_TEST(c.camera == "lidar");
+    BOOST_TEST(c.additional_cameras.size() == 1);
+    BOOST_TEST(c.additional_cameras[0] == "rear_lidar");
+    BOOST_TEST(viam::carto_facade::additional_range_sensor_id("rear_lidar") ==
+               "range/rear_lidar");
+    BOOST_TEST(viam_carto_init(&vc, lib, vcc, ac) == VIAM_CARTO_SUCCESS);
+    BOOST_TEST(viam_carto_terminate(&vc) == VIAM_CARTO_SUCCESS);
+
+    // an additional camera must differ from camera & the other ones
+    vcc.additional_cameras->entry[1] = bfromcstr("lidar");
+    vcc.additional_cameras->qty = 2;
+    BOOST_TEST(viam_carto_init(&vc, lib, vcc, ac) ==
+               VIAM_CARTO_LIDAR_CONFIG_INVALID);
+    BOOST_TEST(bassigncstr(vcc.additional_cameras->entry[1], "rear_lidar") ==
+               BSTR_OK);
+    BOOST_TEST(viam_carto_init(&vc, lib, vcc, ac) ==
+               VIAM_CARTO_LIDAR_CONFIG_INVALID);
+
+    BOOST_TEST(bstrListDestroy(vcc.additional_cameras) == BSTR_OK);
+    vcc.additional_cameras = nullptr;
+    viam_carto_config_teardown(vcc);
+
+    BOOST_TEST(viam_carto_lib_terminate(&lib) == VIAM_CARTO_SUCCESS);
+}
+
 BOOST_AUTO_TEST_CASE(CartoFacade_start_stop_without_movement_sensor) {
     //  validate invalid pointer
     BOOST_TEST(viam_carto_start(nullptr) == VIAM_CARTO_VC_INVALID);
@@ -927,6 +1189,614 @@ BOOST_AUTO_TEST_CASE(CartoFacade_start_stop_without_movement_sensor) {
     BOOST_TEST(viam_carto_stop(vc) == VIAM_CARTO_SUCCESS);
     BOOST_TEST(((cf->state) == CartoFacadeState::IO_INITIALIZED));
 
+    // the initial optimization can only be started once started
+    BOOST_TEST(viam_carto_start_initial_optimization(vc) ==
+               VIAM_CARTO_NOT_IN_STARTED_STATE);
+
+    // the initial optimization runs in the background and is waited for by
+    // Stop
+    BOOST_TEST(viam_carto_start(vc) == VIAM_CARTO_SUCCESS);
+    BOOST_TEST(viam_carto_start_initial_optimization(vc) == VIAM_CARTO_SUCCESS);
+    BOOST_TEST(viam_carto_start_initial_optimization(vc) ==
+               VIAM_CARTO_INITIAL_OPTIMIZATION_ALREADY_STARTED);
+    BOOST_TEST(viam_carto_get_initial_optimization_running(vc, nullptr) ==
+               VIAM_CARTO_UNKNOWN_ERROR);
+    BOOST_TEST(viam_carto_stop(vc) == VIAM_CARTO_SUCCESS);
+    bool running = true;
+    BOOST_TEST(viam_carto_get_initial_optimization_running(vc, &running) ==
+               VIAM_CARTO_SUCCESS);
+    BOOST_TEST(running == false);
+
+    // Terminate
+    BOOST_TEST(viam_carto_terminate(&vc) == VIAM_CARTO_SUCCESS);
+    viam_carto_config_teardown(vcc);
+
+    // library terminate
+    BOOST_TEST(viam_carto_lib_terminate(&lib) == VIAM_CARTO_SUCCESS);
+}
+
+BOOST_AUTO_TEST_CASE(CartoFacade_get_algo_config_without_movement_sensor) {
+    //  validate invalid pointers
+    struct viam_carto_algo_config applied;
+    BOOST_TEST(viam_carto_get_algo_config(nullptr, &applied) ==
+               VIAM_CARTO_VC_INVALID);
+
+    // library init
+    viam_carto_lib *lib;
+    BOOST_TEST(viam_carto_lib_init(&lib, 0, 1) == VIAM_CARTO_SUCCESS);
+
+    // Setup
+    viam_carto *vc;
+    std::string camera = "lidar";
+    std::string movement_sensor = "";
+    struct viam_carto_config vcc = viam_carto_config_setup(
+        VIAM_CARTO_THREE_D, camera, movement_sensor, true, "");
+    struct viam_carto_algo_config ac = viam_carto_algo_config_setup(false);
+
+    BOOST_TEST(viam_carto_init(&vc, lib, vcc, ac) == VIAM_CARTO_SUCCESS);
+    BOOST_TEST(vc->slam_mode == VIAM_CARTO_SLAM_MODE_MAPPING);
+    BOOST_TEST(viam_carto_get_algo_config(vc, nullptr) ==
+               VIAM_CARTO_GET_ALGO_CONFIG_RESPONSE_INVALID);
+
+    // GetAlgoConfig returns the values the map builder was overwritten with
+    BOOST_TEST(viam_carto_get_algo_config(vc, &applied) == VIAM_CARTO_SUCCESS);
+    BOOST_TEST(applied.optimize_on_start == ac.optimize_on_start);
+    BOOST_TEST(applied.optimize_every_n_nodes == ac.optimize_every_n_nodes);
+    BOOST_TEST(applied.num_range_data == ac.num_range_data);
+    BOOST_TEST(applied.missing_data_ray_length == ac.missing_data_ray_length);
+    BOOST_TEST(applied.max_range == ac.max_range);
+    BOOST_TEST(applied.min_range == ac.min_range);
+    BOOST_TEST(applied.use_imu_data == ac.use_imu_data);
+    BOOST_TEST(applied.occupied_space_weight == ac.occupied_space_weight);
+    BOOST_TEST(applied.translation_weight == ac.translation_weight);
+    BOOST_TEST(applied.rotation_weight == ac.rotation_weight);
+
+    // Start
+    BOOST_TEST(viam_carto_start(vc) == VIAM_CARTO_SUCCESS);
+    BOOST_TEST(viam_carto_get_algo_config(vc, &applied) == VIAM_CARTO_SUCCESS);
+    BOOST_TEST(applied.num_range_data == ac.num_range_data);
+
+    // Stop
+    BOOST_TEST(viam_carto_stop(vc) == VIAM_CARTO_SUCCESS);
+
+    // Terminate
+    BOOST_TEST(viam_carto_terminate(&vc) == VIAM_CARTO_SUCCESS);
+    viam_carto_config_teardown(vcc);
+
+    // library terminate
+    BOOST_TEST(viam_carto_lib_terminate(&lib) == VIAM_CARTO_SUCCESS);
+}
+
+BOOST_AUTO_TEST_CASE(CartoFacade_new_trajectory_without_movement_sensor) {
+    //  validate invalid pointers
+    viam_carto_start_new_trajectory_request req = {};
+    viam_carto_start_new_trajectory_response r;
+    BOOST_TEST(viam_carto_start_new_trajectory(nullptr, &req, &r) ==
+               VIAM_CARTO_VC_INVALID);
+    viam_carto_get_trajectories_response tr;
+    BOOST_TEST(viam_carto_get_trajectories(nullptr, &tr) ==
+               VIAM_CARTO_VC_INVALID);
+    BOOST_TEST(viam_carto_get_trajectories_response_destroy(nullptr) ==
+               VIAM_CARTO_GET_TRAJECTORIES_RESPONSE_INVALID);
+
+    // library init
+    viam_carto_lib *lib;
+    BOOST_TEST(viam_carto_lib_init(&lib, 0, 1) == VIAM_CARTO_SUCCESS);
+
+    // Setup
+    viam_carto *vc;
+    std::string camera = "lidar";
+    std::string movement_sensor = "";
+    struct viam_carto_config vcc = viam_carto_config_setup(
+        VIAM_CARTO_THREE_D, camera, movement_sensor, true, "");
+    struct viam_carto_algo_config ac = viam_carto_algo_config_setup(false);
+
+    BOOST_TEST(viam_carto_init(&vc, lib, vcc, ac) == VIAM_CARTO_SUCCESS);
+    BOOST_TEST(vc->slam_mode == VIAM_CARTO_SLAM_MODE_MAPPING);
+    BOOST_TEST(viam_carto_start_new_trajectory(vc, nullptr, &r) ==
+               VIAM_CARTO_START_NEW_TRAJECTORY_RESPONSE_INVALID);
+    BOOST_TEST(viam_carto_start_new_trajectory(vc, &req, nullptr) ==
+               VIAM_CARTO_START_NEW_TRAJECTORY_RESPONSE_INVALID);
+    BOOST_TEST(viam_carto_get_trajectories(vc, nullptr) ==
+               VIAM_CARTO_GET_TRAJECTORIES_RESPONSE_INVALID);
+
+    // a single active trajectory after init
+    BOOST_TEST(viam_carto_get_trajectories(vc, &tr) == VIAM_CARTO_SUCCESS);
+    BOOST_TEST(tr.num_trajectories == 1);
+    BOOST_TEST(tr.trajectories[0].trajectory_id == 0);
+    BOOST_TEST(tr.trajectories[0].state == VIAM_CARTO_TRAJECTORY_STATE_ACTIVE);
+    BOOST_TEST(viam_carto_get_trajectories_response_destroy(&tr) ==
+               VIAM_CARTO_SUCCESS);
+
+    // Start
+    BOOST_TEST(viam_carto_start(vc) == VIAM_CARTO_SUCCESS);
+
+    // first session
+    add_lidar_reading_successfully(
+        vc, 1, ".artifact/data/viam-cartographer/mock_lidar/0.pcd",
+        1629037851000000);
+    add_lidar_reading_successfully(
+        vc, 2, ".artifact/data/viam-cartographer/mock_lidar/1.pcd",
+        1629037853000000);
+    {
+        viam_carto_get_position_response pr;
+        BOOST_TEST(viam_carto_get_position(vc, &pr) == VIAM_CARTO_SUCCESS);
+        BOOST_TEST(viam_carto_get_position_response_destroy(&pr) ==
+                   VIAM_CARTO_SUCCESS);
+    }
+
+    // second session starting at a given pose
+    req.has_initial_pose = true;
+    req.initial_pose_x = 1;
+    req.initial_pose_y = 2;
+    req.initial_pose_theta = 0;
+    BOOST_TEST(viam_carto_start_new_trajectory(vc, &req, &r) ==
+               VIAM_CARTO_SUCCESS);
+    BOOST_TEST(r.finished_trajectory_id == 0);
+    BOOST_TEST(r.trajectory_id == 1);
+
+    // the first trajectory stays in the pose graph frozen. The pose graph
+    // applies the state changes asynchronously, so wait for all pending work
+    // to be processed first.
+    BOOST_TEST(viam_carto_run_final_optimization(vc) == VIAM_CARTO_SUCCESS);
+    BOOST_TEST(viam_carto_get_trajectories(vc, &tr) == VIAM_CARTO_SUCCESS);
+    BOOST_TEST(tr.num_trajectories == 2);
+    BOOST_TEST(tr.trajectories[0].trajectory_id == 0);
+    BOOST_TEST(tr.trajectories[0].state == VIAM_CARTO_TRAJECTORY_STATE_FROZEN);
+    BOOST_TEST(tr.trajectories[1].trajectory_id == 1);
+    BOOST_TEST(tr.trajectories[1].state == VIAM_CARTO_TRAJECTORY_STATE_ACTIVE);
+    BOOST_TEST(viam_carto_get_trajectories_response_destroy(&tr) ==
+               VIAM_CARTO_SUCCESS);
+    BOOST_TEST(tr.trajectories == nullptr);
+
+    // only trajectories other than the current one can be frozen, freezing a
+    // frozen trajectory does nothing
+    BOOST_TEST(viam_carto_freeze_trajectory(nullptr, 0) ==
+               VIAM_CARTO_VC_INVALID);
+    BOOST_TEST(viam_carto_freeze_trajectory(vc, 1) ==
+               VIAM_CARTO_TRAJECTORY_ACTIVE);
+    BOOST_TEST(viam_carto_freeze_trajectory(vc, 2) ==
+               VIAM_CARTO_TRAJECTORY_NOT_FOUND);
+    BOOST_TEST(viam_carto_freeze_trajectory(vc, 0) == VIAM_CARTO_SUCCESS);
+
+    // position is not initialized until the new trajectory has a local pose
+    {
+        viam_carto_get_position_response pr;
+        BOOST_TEST(viam_carto_get_position(vc, &pr) ==
+                   VIAM_CARTO_GET_POSITION_NOT_INITIALIZED);
+    }
+
+    // readings are added to the new trajectory
+    add_lidar_reading_successfully(
+        vc, 3, ".artifact/data/viam-cartographer/mock_lidar/2.pcd",
+        1629037855000000);
+    add_lidar_reading_successfully(
+        vc, 4, ".artifact/data/viam-cartographer/mock_lidar/3.pcd",
+        1629037857000000);
+    {
+        viam::carto_facade::CartoFacade *cf =
+            static_cast<viam::carto_facade::CartoFacade *>(vc->carto_obj);
+        BOOST_TEST(cf->map_builder.trajectory_id == 1);
+        viam_carto_get_position_response pr;
+        BOOST_TEST(viam_carto_get_position(vc, &pr) == VIAM_CARTO_SUCCESS);
+        BOOST_TEST(viam_carto_get_position_response_destroy(&pr) ==
+                   VIAM_CARTO_SUCCESS);
+    }
+
+    // Stop
+    BOOST_TEST(viam_carto_stop(vc) == VIAM_CARTO_SUCCESS);
+
+    // Terminate
+    BOOST_TEST(viam_carto_terminate(&vc) == VIAM_CARTO_SUCCESS);
+    viam_carto_config_teardown(vcc);
+
+    // library terminate
+    BOOST_TEST(viam_carto_lib_terminate(&lib) == VIAM_CARTO_SUCCESS);
+}
+
+BOOST_AUTO_TEST_CASE(CartoFacade_set_slam_mode_without_movement_sensor) {
+    //  validate invalid pointers
+    BOOST_TEST(viam_carto_set_slam_mode(nullptr,
+                                        VIAM_CARTO_SLAM_MODE_LOCALIZING) ==
+               VIAM_CARTO_VC_INVALID);
+
+    // library init
+    viam_carto_lib *lib;
+    BOOST_TEST(viam_carto_lib_init(&lib, 0, 1) == VIAM_CARTO_SUCCESS);
+
+    // Setup
+    viam_carto *vc;
+    std::string camera = "lidar";
+    std::string movement_sensor = "";
+    struct viam_carto_config vcc = viam_carto_config_setup(
+        VIAM_CARTO_THREE_D, camera, movement_sensor, true, "");
+    struct viam_carto_algo_config ac = viam_carto_algo_config_setup(false);
+
+    BOOST_TEST(viam_carto_init(&vc, lib, vcc, ac) == VIAM_CARTO_SUCCESS);
+    BOOST_TEST(vc->slam_mode == VIAM_CARTO_SLAM_MODE_MAPPING);
+    BOOST_TEST(viam_carto_set_slam_mode(vc, VIAM_CARTO_SLAM_MODE_UNKNOWN) ==
+               VIAM_CARTO_SLAM_MODE_INVALID);
+
+    // Start
+    BOOST_TEST(viam_carto_start(vc) == VIAM_CARTO_SUCCESS);
+
+    // a map without points can not be localized against
+    BOOST_TEST(viam_carto_set_slam_mode(vc, VIAM_CARTO_SLAM_MODE_LOCALIZING) ==
+               VIAM_CARTO_POINTCLOUD_MAP_EMPTY);
+    BOOST_TEST(vc->slam_mode == VIAM_CARTO_SLAM_MODE_MAPPING);
+
+    add_lidar_reading_successfully(
+        vc, 1, ".artifact/data/viam-cartographer/mock_lidar/0.pcd",
+        1629037851000000);
+    add_lidar_reading_successfully(
+        vc, 2, ".artifact/data/viam-cartographer/mock_lidar/1.pcd",
+        1629037853000000);
+
+    viam::carto_facade::CartoFacade *cf =
+        static_cast<viam::carto_facade::CartoFacade *>(vc->carto_obj);
+
+    // mapping -> localizing
+    BOOST_TEST(viam_carto_set_slam_mode(vc, VIAM_CARTO_SLAM_MODE_LOCALIZING) ==
+               VIAM_CARTO_SUCCESS);
+    BOOST_TEST(vc->slam_mode == VIAM_CARTO_SLAM_MODE_LOCALIZING);
+    BOOST_TEST((cf->slam_mode == SlamMode::LOCALIZING));
+    BOOST_TEST(cf->map_builder.trajectory_id == 1);
+
+    // setting the current slam mode does nothing
+    BOOST_TEST(viam_carto_set_slam_mode(vc, VIAM_CARTO_SLAM_MODE_LOCALIZING) ==
+               VIAM_CARTO_SUCCESS);
+    BOOST_TEST(cf->map_builder.trajectory_id == 1);
+
+    // the position & the cached map are available right after the switch
+    {
+        viam_carto_get_position_response pr;
+        BOOST_TEST(viam_carto_get_position(vc, &pr) == VIAM_CARTO_SUCCESS);
+        BOOST_TEST(viam_carto_get_position_response_destroy(&pr) ==
+                   VIAM_CARTO_SUCCESS);
+        viam_carto_get_point_cloud_map_response mr;
+        BOOST_TEST(viam_carto_get_point_cloud_map(vc, &mr) ==
+                   VIAM_CARTO_SUCCESS);
+        BOOST_TEST(viam_carto_get_point_cloud_map_response_destroy(&mr) ==
+                   VIAM_CARTO_SUCCESS);
+    }
+    add_lidar_reading_successfully(
+        vc, 3, ".artifact/data/viam-cartographer/mock_lidar/2.pcd",
+        1629037855000000);
+
+    // localizing -> mapping
+    BOOST_TEST(viam_carto_set_slam_mode(vc, VIAM_CARTO_SLAM_MODE_MAPPING) ==
+               VIAM_CARTO_SUCCESS);
+    BOOST_TEST(vc->slam_mode == VIAM_CARTO_SLAM_MODE_MAPPING);
+    BOOST_TEST((cf->slam_mode == SlamMode::MAPPING));
+    BOOST_TEST(cf->map_builder.trajectory_id == 2);
+    add_lidar_reading_successfully(
+        vc, 4, ".artifact/data/viam-cartographer/mock_lidar/3.pcd",
+        1629037857000000);
+    {
+        viam_carto_get_position_response pr;
+        BOOST_TEST(viam_carto_get_position(vc, &pr) == VIAM_CARTO_SUCCESS);
+        BOOST_TEST(viam_carto_get_position_response_destroy(&pr) ==
+                   VIAM_CARTO_SUCCESS);
+    }
+
+    // the trajectories of both switches stay in the pose graph frozen
+    BOOST_TEST(viam_carto_run_final_optimization(vc) == VIAM_CARTO_SUCCESS);
+    viam_carto_get_trajectories_response tr;
+    BOOST_TEST(viam_carto_get_trajectories(vc, &tr) == VIAM_CARTO_SUCCESS);
+    BOOST_TEST(tr.num_trajectories == 3);
+    BOOST_TEST(tr.trajectories[0].state == VIAM_CARTO_TRAJECTORY_STATE_FROZEN);
+    BOOST_TEST(tr.trajectories[1].state == VIAM_CARTO_TRAJECTORY_STATE_FROZEN);
+    BOOST_TEST(tr.trajectories[2].state == VIAM_CARTO_TRAJECTORY_STATE_ACTIVE);
+    BOOST_TEST(viam_carto_get_trajectories_response_destroy(&tr) ==
+               VIAM_CARTO_SUCCESS);
+
+    // Stop
+    BOOST_TEST(viam_carto_stop(vc) == VIAM_CARTO_SUCCESS);
+
+    // Terminate
+    BOOST_TEST(viam_carto_terminate(&vc) == VIAM_CARTO_SUCCESS);
+    viam_carto_config_teardown(vcc);
+
+    // library terminate
+    BOOST_TEST(viam_carto_lib_terminate(&lib) == VIAM_CARTO_SUCCESS);
+}
+
+BOOST_AUTO_TEST_CASE(CartoFacade_restart_trajectory_without_movement_sensor) {
+    //  validate invalid pointers
+    viam_carto_restart_trajectory_request req = {};
+    viam_carto_restart_trajectory_response r;
+    BOOST_TEST(viam_carto_restart_trajectory(nullptr, &req, &r) ==
+               VIAM_CARTO_VC_INVALID);
+
+    // library init
+    viam_carto_lib *lib;
+    BOOST_TEST(viam_carto_lib_init(&lib, 0, 1) == VIAM_CARTO_SUCCESS);
+
+    // Setup
+    viam_carto *vc;
+    std::string camera = "lidar";
+    std::string movement_sensor = "";
+    struct viam_carto_config vcc = viam_carto_config_setup(
+        VIAM_CARTO_THREE_D, camera, movement_sensor, true, "");
+    struct viam_carto_algo_config ac = viam_carto_algo_config_setup(false);
+
+    BOOST_TEST(viam_carto_init(&vc, lib, vcc, ac) == VIAM_CARTO_SUCCESS);
+
+    // Start
+    BOOST_TEST(viam_carto_start(vc) == VIAM_CARTO_SUCCESS);
+
+    add_lidar_reading_successfully(
+        vc, 1, ".artifact/data/viam-cartographer/mock_lidar/0.pcd",
+        1629037851000000);
+    add_lidar_reading_successfully(
+        vc, 2, ".artifact/data/viam-cartographer/mock_lidar/1.pcd",
+        1629037853000000);
+
+    // the trajectory is only restarted in localization mode
+    BOOST_TEST(viam_carto_restart_trajectory(vc, &req, &r) ==
+               VIAM_CARTO_NOT_LOCALIZING);
+    BOOST_TEST(viam_carto_set_slam_mode(vc, VIAM_CARTO_SLAM_MODE_LOCALIZING) ==
+               VIAM_CARTO_SUCCESS);
+
+    viam::carto_facade::CartoFacade *cf =
+        static_cast<viam::carto_facade::CartoFacade *>(vc->carto_obj);
+    BOOST_TEST(cf->map_builder.trajectory_id == 1);
+
+    // with a pose hint
+    req.has_initial_pose = true;
+    req.initial_pose_x = 1;
+    req.initial_pose_y = 2;
+    req.initial_pose_theta = 0.5;
+    BOOST_TEST(viam_carto_restart_trajectory(vc, &req, &r) ==
+               VIAM_CARTO_SUCCESS);
+    BOOST_TEST(r.restarted_trajectory_id == 1);
+    BOOST_TEST(r.trajectory_id == 2);
+    BOOST_TEST(cf->map_builder.trajectory_id == 2);
+    BOOST_TEST((cf->slam_mode == SlamMode::LOCALIZING));
+    add_lidar_reading_successfully(
+        vc, 3, ".artifact/data/viam-cartographer/mock_lidar/2.pcd",
+        1629037855000000);
+
+    // without a pose hint
+    req = {};
+    BOOST_TEST(viam_carto_restart_trajectory(vc, &req, &r) ==
+               VIAM_CARTO_SUCCESS);
+    BOOST_TEST(r.restarted_trajectory_id == 2);
+    BOOST_TEST(r.trajectory_id == 3);
+    add_lidar_reading_successfully(
+        vc, 4, ".artifact/data/viam-cartographer/mock_lidar/3.pcd",
+        1629037857000000);
+
+    // Stop
+    BOOST_TEST(viam_carto_stop(vc) == VIAM_CARTO_SUCCESS);
+
+    // Terminate
+    BOOST_TEST(viam_carto_terminate(&vc) == VIAM_CARTO_SUCCESS);
+    viam_carto_config_teardown(vcc);
+
+    // library terminate
+    BOOST_TEST(viam_carto_lib_terminate(&lib) == VIAM_CARTO_SUCCESS);
+}
+
+BOOST_AUTO_TEST_CASE(CartoFacade_get_trajectory_without_movement_sensor) {
+    //  validate invalid pointers
+    viam_carto_get_trajectory_response tr;
+    BOOST_TEST(viam_carto_get_trajectory(nullptr, &tr) ==
+               VIAM_CARTO_VC_INVALID);
+    BOOST_TEST(viam_carto_get_trajectory_response_destroy(nullptr) ==
+               VIAM_CARTO_GET_TRAJECTORY_RESPONSE_INVALID);
+
+    // library init
+    viam_carto_lib *lib;
+    BOOST_TEST(viam_carto_lib_init(&lib, 0, 1) == VIAM_CARTO_SUCCESS);
+
+    // Setup
+    viam_carto *vc;
+    std::string camera = "lidar";
+    std::string movement_sensor = "";
+    struct viam_carto_config vcc = viam_carto_config_setup(
+        VIAM_CARTO_THREE_D, camera, movement_sensor, true, "");
+    struct viam_carto_algo_config ac = viam_carto_algo_config_setup(false);
+
+    BOOST_TEST(viam_carto_init(&vc, lib, vcc, ac) == VIAM_CARTO_SUCCESS);
+    BOOST_TEST(viam_carto_get_trajectory(vc, nullptr) ==
+               VIAM_CARTO_GET_TRAJECTORY_RESPONSE_INVALID);
+
+    // no nodes before any reading is added
+    BOOST_TEST(viam_carto_get_trajectory(vc, &tr) == VIAM_CARTO_SUCCESS);
+    BOOST_TEST(tr.num_nodes == 0);
+    BOOST_TEST(viam_carto_get_trajectory_response_destroy(&tr) ==
+               VIAM_CARTO_SUCCESS);
+
+    // Start
+    BOOST_TEST(viam_carto_start(vc) == VIAM_CARTO_SUCCESS);
+
+    add_lidar_reading_successfully(
+        vc, 1, ".artifact/data/viam-cartographer/mock_lidar/0.pcd",
+        1629037851000000);
+    add_lidar_reading_successfully(
+        vc, 2, ".artifact/data/viam-cartographer/mock_lidar/1.pcd",
+        1629037853000000);
+    add_lidar_reading_successfully(
+        vc, 3, ".artifact/data/viam-cartographer/mock_lidar/2.pcd",
+        1629037855000000);
+
+    // every inserted reading is a node of the only trajectory, ordered by time
+    BOOST_TEST(viam_carto_run_final_optimization(vc) == VIAM_CARTO_SUCCESS);
+    BOOST_TEST(viam_carto_get_trajectory(vc, &tr) == VIAM_CARTO_SUCCESS);
+    BOOST_TEST(tr.num_nodes > 0);
+    for (int i = 0; i < tr.num_nodes; i++) {
+        BOOST_TEST(tr.nodes[i].trajectory_id == 0);
+        if (i > 0) {
+            BOOST_TEST(tr.nodes[i - 1].time_unix_milli <=
+                       tr.nodes[i].time_unix_milli);
+        }
+    }
+    BOOST_TEST(viam_carto_get_trajectory_response_destroy(&tr) ==
+               VIAM_CARTO_SUCCESS);
+    BOOST_TEST(tr.nodes == nullptr);
+    BOOST_TEST(tr.num_nodes == 0);
+
+    // Stop
+    BOOST_TEST(viam_carto_stop(vc) == VIAM_CARTO_SUCCESS);
+
+    // Terminate
+    BOOST_TEST(viam_carto_terminate(&vc) == VIAM_CARTO_SUCCESS);
+    viam_carto_config_teardown(vcc);
+
+    // library terminate
+    BOOST_TEST(viam_carto_lib_terminate(&lib) == VIAM_CARTO_SUCCESS);
+}
+
+BOOST_AUTO_TEST_CASE(CartoFacade_get_submaps_without_movement_sensor) {
+    //  validate invalid pointers
+    viam_carto_get_submap_list_response lr;
+    viam_carto_get_submap_request req;
+    viam_carto_get_submap_response sr;
+    BOOST_TEST(viam_carto_get_submap_list(nullptr, &lr) ==
+               VIAM_CARTO_VC_INVALID);
+    BOOST_TEST(viam_carto_get_submap_list_response_destroy(nullptr) ==
+               VIAM_CARTO_GET_SUBMAP_LIST_RESPONSE_INVALID);
+    BOOST_TEST(viam_carto_get_submap(nullptr, &req, &sr) ==
+               VIAM_CARTO_VC_INVALID);
+    BOOST_TEST(viam_carto_get_submap_response_destroy(nullptr) ==
+               VIAM_CARTO_GET_SUBMAP_RESPONSE_INVALID);
+
+    // library init
+    viam_carto_lib *lib;
+    BOOST_TEST(viam_carto_lib_init(&lib, 0, 1) == VIAM_CARTO_SUCCESS);
+
+    // Setup
+    viam_carto *vc;
+    std::string camera = "lidar";
+    std::string movement_sensor = "";
+    struct viam_carto_config vcc = viam_carto_config_setup(
+        VIAM_CARTO_TWO_D, camera, movement_sensor, true, "");
+    struct viam_carto_algo_config ac = viam_carto_algo_config_setup(false);
+
+    BOOST_TEST(viam_carto_init(&vc, lib, vcc, ac) == VIAM_CARTO_SUCCESS);
+    BOOST_TEST(viam_carto_get_submap_list(vc, nullptr) ==
+               VIAM_CARTO_GET_SUBMAP_LIST_RESPONSE_INVALID);
+    BOOST_TEST(viam_carto_get_submap(vc, nullptr, &sr) ==
+               VIAM_CARTO_GET_SUBMAP_RESPONSE_INVALID);
+    BOOST_TEST(viam_carto_get_submap(vc, &req, nullptr) ==
+               VIAM_CARTO_GET_SUBMAP_RESPONSE_INVALID);
+
+    // no submaps before any reading is added
+    BOOST_TEST(viam_carto_get_submap_list(vc, &lr) == VIAM_CARTO_SUCCESS);
+    BOOST_TEST(lr.num_submaps == 0);
+    BOOST_TEST(viam_carto_get_submap_list_response_destroy(&lr) ==
+               VIAM_CARTO_SUCCESS);
+    req.trajectory_id = 0;
+    req.submap_index = 0;
+    BOOST_TEST(viam_carto_get_submap(vc, &req, &sr) ==
+               VIAM_CARTO_SUBMAP_NOT_FOUND);
+
+    // Start
+    BOOST_TEST(viam_carto_start(vc) == VIAM_CARTO_SUCCESS);
+
+    add_lidar_reading_successfully(
+        vc, 1, ".artifact/data/viam-cartographer/mock_lidar/0.pcd",
+        1629037851000000);
+    add_lidar_reading_successfully(
+        vc, 2, ".artifact/data/viam-cartographer/mock_lidar/1.pcd",
+        1629037853000000);
+    add_lidar_reading_successfully(
+        vc, 3, ".artifact/data/viam-cartographer/mock_lidar/2.pcd",
+        1629037855000000);
+
+    // the submaps of the only trajectory are listed in order & each of them
+    // can be painted on its own
+    BOOST_TEST(viam_carto_run_final_optimization(vc) == VIAM_CARTO_SUCCESS);
+    BOOST_TEST(viam_carto_get_submap_list(vc, &lr) == VIAM_CARTO_SUCCESS);
+    BOOST_TEST(lr.num_submaps > 0);
+    for (int i = 0; i < lr.num_submaps; i++) {
+        BOOST_TEST(lr.submaps[i].trajectory_id == 0);
+        BOOST_TEST(lr.submaps[i].submap_index == i);
+        BOOST_TEST(lr.submaps[i].version > 0);
+
+        req.trajectory_id = lr.submaps[i].trajectory_id;
+        req.submap_index = lr.submaps[i].submap_index;
+        BOOST_TEST(viam_carto_get_submap(vc, &req, &sr) == VIAM_CARTO_SUCCESS);
+        BOOST_TEST(sr.submap.submap_index == i);
+        BOOST_TEST(sr.submap.version == lr.submaps[i].version);
+        BOOST_TEST(sr.submap.x == lr.submaps[i].x);
+        BOOST_TEST(sr.submap.y == lr.submaps[i].y);
+        BOOST_TEST(blength(sr.point_cloud_pcd) > 0);
+        BOOST_TEST(viam_carto_get_submap_response_destroy(&sr) ==
+                   VIAM_CARTO_SUCCESS);
+        BOOST_TEST(sr.point_cloud_pcd == nullptr);
+    }
+    req.submap_index = lr.num_submaps;
+    BOOST_TEST(viam_carto_get_submap(vc, &req, &sr) ==
+               VIAM_CARTO_SUBMAP_NOT_FOUND);
+    BOOST_TEST(viam_carto_get_submap_list_response_destroy(&lr) ==
+               VIAM_CARTO_SUCCESS);
+    BOOST_TEST(lr.submaps == nullptr);
+    BOOST_TEST(lr.num_submaps == 0);
+
+    // Stop
+    BOOST_TEST(viam_carto_stop(vc) == VIAM_CARTO_SUCCESS);
+
+    // Terminate
+    BOOST_TEST(viam_carto_terminate(&vc) == VIAM_CARTO_SUCCESS);
+    viam_carto_config_teardown(vcc);
+
+    // library terminate
+    BOOST_TEST(viam_carto_lib_terminate(&lib) == VIAM_CARTO_SUCCESS);
+}
+
+BOOST_AUTO_TEST_CASE(CartoFacade_slam_stats) {
+    //  validate invalid pointers
+    viam_carto_get_slam_stats_response r;
+    BOOST_TEST(viam_carto_get_slam_stats(nullptr, &r) == VIAM_CARTO_VC_INVALID);
+
+    // library init
+    viam_carto_lib *lib;
+    BOOST_TEST(viam_carto_lib_init(&lib, 0, 1) == VIAM_CARTO_SUCCESS);
+
+    // Setup
+    viam_carto *vc;
+    std::string camera = "lidar";
+    std::string movement_sensor = "";
+    struct viam_carto_config vcc = viam_carto_config_setup(
+        VIAM_CARTO_THREE_D, camera, movement_sensor, true, "");
+    struct viam_carto_algo_config ac = viam_carto_algo_config_setup(false);
+
+    BOOST_TEST(viam_carto_init(&vc, lib, vcc, ac) == VIAM_CARTO_SUCCESS);
+    BOOST_TEST(viam_carto_get_slam_stats(vc, nullptr) ==
+               VIAM_CARTO_GET_SLAM_STATS_RESPONSE_INVALID);
+
+    // no nodes before any reading was added
+    BOOST_TEST(viam_carto_get_slam_stats(vc, &r) == VIAM_CARTO_SUCCESS);
+    BOOST_TEST(r.num_nodes == 0);
+    BOOST_TEST(r.num_unoptimized_nodes == 0);
+    BOOST_TEST(r.oldest_unoptimized_node_age_sec == 0);
+
+    // Start
+    BOOST_TEST(viam_carto_start(vc) == VIAM_CARTO_SUCCESS);
+
+    add_lidar_reading_successfully(
+        vc, 1, ".artifact/data/viam-cartographer/mock_lidar/0.pcd",
+        1629037851000000);
+    add_lidar_reading_successfully(
+        vc, 2, ".artifact/data/viam-cartographer/mock_lidar/1.pcd",
+        1629037853000000);
+    add_lidar_reading_successfully(
+        vc, 3, ".artifact/data/viam-cartographer/mock_lidar/2.pcd",
+        1629037855000000);
+
+    // the unoptimized nodes are a subset of the nodes, which are at most a few
+    // seconds apart
+    BOOST_TEST(viam_carto_get_slam_stats(vc, &r) == VIAM_CARTO_SUCCESS);
+    BOOST_TEST(r.num_nodes > 0);
+    BOOST_TEST(r.num_unoptimized_nodes <= r.num_nodes);
+    BOOST_TEST(r.oldest_unoptimized_node_age_sec >= 0);
+    BOOST_TEST(r.oldest_unoptimized_node_age_sec <= 4);
+
+    // Stop
+    BOOST_TEST(viam_carto_stop(vc) == VIAM_CARTO_SUCCESS);
+
     // Terminate
     BOOST_TEST(viam_carto_terminate(&vc) == VIAM_CARTO_SUCCESS);
     viam_carto_config_teardown(vcc);
@@ -1546,6 +2416,18 @@ BOOST_AUTO_TEST_CASE(CartoFacade_config_with_movement_sensor) {
     BOOST_TEST(c.camera == "lidar");
     BOOST_TEST(c.movement_sensor == "movement_sensor");
     BOOST_TEST(c.enable_mapping == true);
+    BOOST_TEST(c.sensor_streams == VIAM_CARTO_SENSOR_STREAMS_UNSPECIFIED);
+
+    vcc.sensor_streams = VIAM_CARTO_LIDAR_AND_MOVEMENT_SENSOR;
+    c = viam::carto_facade::from_viam_carto_config(vcc);
+    BOOST_TEST(c.sensor_streams == VIAM_CARTO_LIDAR_AND_MOVEMENT_SENSOR);
+
+    // only lidar readings can't be declared along with a movement sensor
+    vcc.sensor_streams = VIAM_CARTO_LIDAR_ONLY;
+    viam_carto *vc;
+    struct viam_carto_algo_config ac = viam_carto_algo_config_setup(true);
+    BOOST_TEST(viam_carto_init(&vc, lib, vcc, ac) ==
+               VIAM_CARTO_SENSOR_STREAMS_INVALID);
 
     viam_carto_config_teardown(vcc);
 
@@ -1,15 +1,26 @@
 // This is an experimental integration of cartographer into RDK.
 #include "cartographer/mapping/map_builder.h"
 
+#include <algorithm>
 #include <sstream>
+#include <utility>
 
 #include "cartographer/common/configuration_file_resolver.h"
 #include "cartographer/common/lua_parameter_dictionary.h"
+#include "cartographer/common/math.h"
+#include "cartographer/common/time.h"
 #include "cartographer/io/proto_stream.h"
 #include "cartographer/mapping/2d/grid_2d.h"
+#include "cartographer/mapping/2d/probability_grid.h"
+#include "cartographer/mapping/2d/submap_2d.h"
+#include "cartographer/mapping/internal/2d/scan_matching/fast_correlative_scan_matcher_2d.h"
 #include "cartographer/mapping/internal/local_slam_result_data.h"
 #include "cartographer/mapping/map_builder_interface.h"
+#include "cartographer/mapping/pose_graph.h"
+#include "cartographer/mapping/probability_values.h"
 #include "cartographer/mapping/trajectory_builder_interface.h"
+#include "cartographer/mapping/value_conversion_tables.h"
+#include "cartographer/sensor/point_cloud.h"
 #include "glog/logging.h"
 #include "map_builder.h"
 
@@ -60,6 +71,8 @@ void MapBuilder::BuildMapBuilder() {
     VLOG(1) << "MapBuilder::BuildMapBuilder";
     map_builder_ =
         cartographer::mapping::CreateMapBuilder(map_builder_options_);
+    map_builder_->pose_graph()->SetGlobalSlamOptimizationCallback(
+        GetGlobalSlamOptimizationCallback());
 }
 
 void MapBuilder::LoadMapFromFile(std::string internal_state_filename,
@@ -84,6 +97,68 @@ void MapBuilder::LoadMapFromFile(std::string internal_state_filename,
                 << trajectory_ids_pair.second;
 }
 
+void MapBuilder::LoadFloorPlan(const std::vector<Eigen::Vector2f> &positions,
+                               const std::vector<float> &probabilities,
+                               double resolution, bool load_frozen_trajectory) {
+    VLOG(1) << "calling map_builder.LoadFloorPlan num_cells: "
+            << positions.size() << " resolution: " << resolution
+            << " load_frozen_trajectory: " << load_frozen_trajectory;
+
+    Eigen::AlignedBox2f bounds;
+    for (const auto &position : positions) {
+        bounds.extend(position);
+    }
+    const float half_cell = resolution / 2.;
+    const Eigen::Vector2f sizes = bounds.sizes();
+    // cartographer's x cell index runs along the y axis & vice versa
+    const cartographer::mapping::CellLimits cell_limits(
+        cartographer::common::RoundToInt(sizes.y() / resolution) + 1,
+        cartographer::common::RoundToInt(sizes.x() / resolution) + 1);
+    const Eigen::Vector2d max =
+        (bounds.max() + Eigen::Vector2f(half_cell, half_cell)).cast<double>();
+
+    cartographer::mapping::ValueConversionTables conversion_tables;
+    auto grid = absl::make_unique<cartographer::mapping::ProbabilityGrid>(
+        cartographer::mapping::MapLimits(resolution, max, cell_limits),
+        &conversion_tables);
+    for (size_t i = 0; i < positions.size(); ++i) {
+        const Eigen::Array2i cell_index =
+            grid->limits().GetCellIndex(positions[i]);
+        if (!grid->limits().Contains(cell_index) ||
+            grid->IsKnown(cell_index)) {
+            continue;
+        }
+        const float probability = cartographer::common::Clamp(
+            probabilities[i], cartographer::mapping::kMinProbability,
+            cartographer::mapping::kMaxProbability);
+        grid->SetProbability(cell_index, probability);
+    }
+    cartographer::mapping::Submap2D submap(Eigen::Vector2f::Zero(),
+                                           std::move(grid), &conversion_tables);
+    submap.Finish();
+
+    cartographer::mapping::proto::TrajectoryBuilderOptionsWithSensorIds
+        options_with_sensor_ids;
+    *options_with_sensor_ids.mutable_trajectory_builder_options() =
+        trajectory_builder_options_;
+    *options_with_sensor_ids.add_sensor_id() =
+        cartographer::mapping::ToProto(kRangeSensorId);
+    const int floor_plan_trajectory_id =
+        map_builder_->AddTrajectoryForDeserialization(options_with_sensor_ids);
+
+    auto pose_graph = dynamic_cast<cartographer::mapping::PoseGraph *>(
+        map_builder_->pose_graph());
+    if (load_frozen_trajectory) {
+        pose_graph->FreezeTrajectory(floor_plan_trajectory_id);
+    }
+    cartographer::mapping::proto::Submap proto =
+        submap.ToProto(/*include_grid_data=*/true);
+    proto.mutable_submap_id()->set_trajectory_id(floor_plan_trajectory_id);
+    proto.mutable_submap_id()->set_submap_index(0);
+    pose_graph->AddSubmapFromProto(cartographer::transform::Rigid3d::Identity(),
+                                   proto);
+}
+
 bool MapBuilder::SaveMapToFile(bool include_unfinished_submaps,
                                const std::string filename_with_timestamp) {
     bool ok = map_builder_->SerializeStateToFile(include_unfinished_submaps,
@@ -97,7 +172,7 @@ bool MapBuilder::SaveMapToFile(bool include_unfinished_submaps,
 void MapBuilder::AddSensorData(
     const std::string &sensor_id,
     cartographer::sensor::TimedPointCloudData measurement) {
-    trajectory_builder->AddSensorData(kRangeSensorId.id, measurement);
+    trajectory_builder->AddSensorData(sensor_id, measurement);
 }
 
 void MapBuilder::AddSensorData(const std::string &sensor_id,
@@ -110,9 +185,17 @@ void MapBuilder::AddSensorData(const std::string &sensor_id,
     trajectory_builder->AddSensorData(kOdometerSensorId.id, measurement);
 }
 
+void MapBuilder::SetAdditionalRangeSensors(
+    const std::vector<std::string> &sensor_ids) {
+    additional_range_sensor_ids = sensor_ids;
+}
+
 void MapBuilder::StartTrajectoryBuilder(bool use_imu_data) {
     VLOG(1) << "MapBuilder::StartTrajectoryBuilder";
     std::set<SensorId> sensorList = {kRangeSensorId};
+    for (const auto &sensor_id : additional_range_sensor_ids) {
+        sensorList.insert(SensorId{SensorId::SensorType::RANGE, sensor_id});
+    }
     if (use_imu_data) {
         sensorList.insert(kIMUSensorId);
     }
@@ -124,6 +207,301 @@ void MapBuilder::StartTrajectoryBuilder(bool use_imu_data) {
     trajectory_builder = map_builder_->GetTrajectoryBuilder(trajectory_id);
 }
 
+int MapBuilder::StartNewTrajectory(bool use_imu_data, bool has_initial_pose,
+                                   double x, double y, double theta) {
+    int finished_trajectory_id = trajectory_id;
+    VLOG(1) << "MapBuilder::StartNewTrajectory finishing trajectory ID: "
+            << finished_trajectory_id;
+    map_builder_->FinishTrajectory(finished_trajectory_id);
+    // Freezing keeps the finished trajectory in the pose graph while
+    // preventing the optimization from moving it, so that the new trajectory
+    // is localized against it.
+    auto pose_graph = dynamic_cast<cartographer::mapping::PoseGraph *>(
+        map_builder_->pose_graph());
+    if (pose_graph != nullptr) {
+        pose_graph->FreezeTrajectory(finished_trajectory_id);
+    }
+
+    if (has_initial_pose) {
+        OverwriteInitialStartTrajectory(x, y, theta);
+    } else {
+        ClearInitialStartTrajectory();
+    }
+
+    // The latest local pose belongs to the finished trajectory and is
+    // meaningless in the frame of the new one.
+    {
+        std::lock_guard<std::mutex> lk(local_slam_result_pose_mutex);
+        local_slam_result_pose = cartographer::transform::Rigid3d();
+    }
+    local_pose_initialized = false;
+
+    StartTrajectoryBuilder(use_imu_data);
+    return finished_trajectory_id;
+}
+
+void MapBuilder::FreezeTrajectory(
+    int id, cartographer::mapping::PoseGraphInterface::TrajectoryState state) {
+    VLOG(1) << "MapBuilder::FreezeTrajectory freezing trajectory ID: " << id;
+    if (state ==
+        cartographer::mapping::PoseGraphInterface::TrajectoryState::ACTIVE) {
+        map_builder_->FinishTrajectory(id);
+    }
+    auto pose_graph = dynamic_cast<cartographer::mapping::PoseGraph *>(
+        map_builder_->pose_graph());
+    if (pose_graph != nullptr) {
+        pose_graph->FreezeTrajectory(id);
+    }
+}
+
+int MapBuilder::RestartTrajectory(bool use_imu_data, bool has_initial_pose,
+                                  double x, double y, double theta) {
+    if (has_initial_pose) {
+        OverwriteInitialStartTrajectory(x, y, theta);
+    } else {
+        ClearInitialStartTrajectory();
+    }
+    return ReplaceTrajectory(use_imu_data);
+}
+
+int MapBuilder::ReplaceTrajectory(bool use_imu_data) {
+    int replaced_trajectory_id = trajectory_id;
+    VLOG(1) << "MapBuilder::ReplaceTrajectory deleting trajectory ID: "
+            << replaced_trajectory_id;
+    // The localization trajectory is not part of the map, so it is deleted
+    // rather than frozen, which keeps its poses from pulling the new
+    // trajectory back to where the robot was before it was moved.
+    map_builder_->FinishTrajectory(replaced_trajectory_id);
+    auto pose_graph = dynamic_cast<cartographer::mapping::PoseGraph *>(
+        map_builder_->pose_graph());
+    if (pose_graph != nullptr) {
+        pose_graph->DeleteTrajectory(replaced_trajectory_id);
+    }
+
+    {
+        std::lock_guard<std::mutex> lk(local_slam_result_pose_mutex);
+        local_slam_result_pose = cartographer::transform::Rigid3d();
+    }
+    local_pose_initialized = false;
+
+    // The pure localization trimmer of the trajectory builder options stays
+    // as SetSlamMode configured it.
+    StartTrajectoryBuilder(use_imu_data);
+    return replaced_trajectory_id;
+}
+
+bool MapBuilder::RelocalizeTrajectory(bool use_imu_data, double linear,
+                                      double angular) {
+    cartographer::sensor::PointCloud returns;
+    cartographer::transform::Rigid3d local_pose;
+    {
+        std::lock_guard<std::mutex> lk(local_slam_result_pose_mutex);
+        returns = local_slam_result_returns;
+        local_pose = local_slam_result_returns_pose;
+    }
+    if (returns.empty()) {
+        return false;
+    }
+    auto pose_graph = map_builder_->pose_graph();
+    // the returns are matched in the tracking frame of the reading, starting
+    // from the global pose its trajectory puts it at, which is the initial
+    // trajectory pose until the trajectory is connected to the map
+    returns = cartographer::sensor::TransformPointCloud(
+        returns, local_pose.inverse().cast<float>());
+    const auto global_pose =
+        pose_graph->GetLocalToGlobalTransform(trajectory_id) * local_pose;
+
+    const auto &constraint_builder_options =
+        map_builder_options_.pose_graph_options().constraint_builder_options();
+    auto scan_matcher_options =
+        constraint_builder_options.fast_correlative_scan_matcher_options();
+    scan_matcher_options.set_linear_search_window(
+        std::max(linear, scan_matcher_options.linear_search_window()));
+    scan_matcher_options.set_angular_search_window(
+        std::max(angular, scan_matcher_options.angular_search_window()));
+
+    float best_score = constraint_builder_options.min_score();
+    bool matched = false;
+    cartographer::transform::Rigid3d matched_pose;
+    for (const auto &submap_id_data : pose_graph->GetAllSubmapData()) {
+        const auto &submap = submap_id_data.data.submap;
+        if (submap_id_data.id.trajectory_id == trajectory_id ||
+            submap == nullptr || !submap->insertion_finished()) {
+            continue;
+        }
+        auto submap_2d =
+            std::dynamic_pointer_cast<const cartographer::mapping::Submap2D>(
+                submap);
+        if (submap_2d == nullptr) {
+            continue;
+        }
+        // the grid of a submap is in the local frame of its trajectory
+        const auto grid_to_global =
+            submap_id_data.data.pose * submap->local_pose().inverse();
+        cartographer::mapping::scan_matching::FastCorrelativeScanMatcher2D
+            scan_matcher(*submap_2d->grid(), scan_matcher_options);
+        float score;
+        cartographer::transform::Rigid2d pose_in_grid;
+        if (scan_matcher.Match(cartographer::transform::Project2D(
+                                   grid_to_global.inverse() * global_pose),
+                               returns, best_score, &score, &pose_in_grid) &&
+            score >= best_score) {
+            best_score = score;
+            matched = true;
+            matched_pose =
+                grid_to_global * cartographer::transform::Embed3D(pose_in_grid);
+        }
+    }
+    if (!matched) {
+        return false;
+    }
+
+    // the initial trajectory pose is relative to the start of the first
+    // trajectory, which is where its first node is in the global frame
+    auto relative_pose = matched_pose;
+    const auto node_poses = pose_graph->GetTrajectoryNodePoses();
+    const auto first_trajectory_nodes = node_poses.trajectory(0);
+    if (first_trajectory_nodes.begin() != first_trajectory_nodes.end()) {
+        relative_pose =
+            first_trajectory_nodes.begin()->data.global_pose.inverse() *
+            matched_pose;
+    }
+    auto initial_trajectory_pose =
+        trajectory_builder_options_.mutable_initial_trajectory_pose();
+    *initial_trajectory_pose->mutable_relative_pose() =
+        cartographer::transform::ToProto(relative_pose);
+    initial_trajectory_pose->set_to_trajectory_id(0);
+    initial_trajectory_pose->set_timestamp(0);
+    LOG(INFO) << "relocalized the trajectory from " << global_pose << " to "
+              << matched_pose << " with score " << best_score;
+    ReplaceTrajectory(use_imu_data);
+    return true;
+}
+
+int MapBuilder::SwitchTrajectory(bool use_imu_data, bool pure_localization,
+                                 int max_submaps_to_keep) {
+    int finished_trajectory_id = trajectory_id;
+    VLOG(1) << "MapBuilder::SwitchTrajectory finishing trajectory ID: "
+            << finished_trajectory_id;
+    // The global pose has to be taken before the trajectory is finished, as
+    // its local to global transform is dropped with it.
+    auto global_pose = GetGlobalPose();
+    map_builder_->FinishTrajectory(finished_trajectory_id);
+    auto pose_graph = dynamic_cast<cartographer::mapping::PoseGraph *>(
+        map_builder_->pose_graph());
+    if (pose_graph != nullptr) {
+        pose_graph->FreezeTrajectory(finished_trajectory_id);
+    }
+
+    if (pure_localization) {
+        trajectory_builder_options_.mutable_pure_localization_trimmer()
+            ->set_max_submaps_to_keep(max_submaps_to_keep);
+    } else {
+        trajectory_builder_options_.clear_pure_localization_trimmer();
+    }
+
+    // The new trajectory continues at the current pose, which is given
+    // relative to the latest node of the finished trajectory. Cartographer
+    // requires the trajectory the initial pose is relative to to have nodes,
+    // so without any the new trajectory is localized against the map instead.
+    auto nodes = map_builder_->pose_graph()->GetTrajectoryNodePoses();
+    auto finished_nodes = nodes.trajectory(finished_trajectory_id);
+    const cartographer::mapping::TrajectoryNodePose *last_node = nullptr;
+    for (const auto &node : finished_nodes) {
+        if (node.data.constant_pose_data.has_value()) {
+            last_node = &node.data;
+        }
+    }
+    if (local_pose_initialized && last_node != nullptr) {
+        auto mutable_initial_trajectory_pose =
+            trajectory_builder_options_.mutable_initial_trajectory_pose();
+        *mutable_initial_trajectory_pose->mutable_relative_pose() =
+            cartographer::transform::ToProto(last_node->global_pose.inverse() *
+                                             global_pose);
+        mutable_initial_trajectory_pose->set_to_trajectory_id(
+            finished_trajectory_id);
+        mutable_initial_trajectory_pose->set_timestamp(
+            cartographer::common::ToUniversal(
+                last_node->constant_pose_data.value().time));
+        // The local frame of the new trajectory starts at the current global
+        // pose, so the pose stays available until its first local result.
+        std::lock_guard<std::mutex> lk(local_slam_result_pose_mutex);
+        local_slam_result_pose = cartographer::transform::Rigid3d::Identity();
+    } else {
+        ClearInitialStartTrajectory();
+        {
+            std::lock_guard<std::mutex> lk(local_slam_result_pose_mutex);
+            local_slam_result_pose = cartographer::transform::Rigid3d();
+        }
+        local_pose_initialized = false;
+    }
+
+    StartTrajectoryBuilder(use_imu_data);
+    return finished_trajectory_id;
+}
+
+std::map<int, cartographer::mapping::PoseGraphInterface::TrajectoryState>
+MapBuilder::GetTrajectoryStates() {
+    return map_builder_->pose_graph()->GetTrajectoryStates();
+}
+
+cartographer::mapping::MapById<cartographer::mapping::NodeId,
+                               cartographer::mapping::TrajectoryNodePose>
+MapBuilder::GetTrajectoryNodePoses() {
+    return map_builder_->pose_graph()->GetTrajectoryNodePoses();
+}
+
+void MapBuilder::GetOptimizationLag(int *num_nodes,
+                                    int *num_unoptimized_nodes,
+                                    double *oldest_unoptimized_node_age_sec) {
+    *num_nodes = 0;
+    *num_unoptimized_nodes = 0;
+    *oldest_unoptimized_node_age_sec = 0;
+
+    int last_optimized_node_index = -1;
+    {
+        std::lock_guard<std::mutex> lk(last_optimized_node_ids_mutex);
+        auto it = last_optimized_node_ids.find(trajectory_id);
+        if (it != last_optimized_node_ids.end()) {
+            last_optimized_node_index = it->second.node_index;
+        }
+    }
+
+    auto nodes = map_builder_->pose_graph()->GetTrajectoryNodes();
+    cartographer::common::Time latest_node_time;
+    cartographer::common::Time oldest_unoptimized_node_time;
+    for (const auto &node : nodes.trajectory(trajectory_id)) {
+        // the data of trimmed nodes is released
+        if (node.data.constant_data == nullptr) {
+            continue;
+        }
+        (*num_nodes)++;
+        latest_node_time = std::max(latest_node_time, node.data.time());
+        if (node.id.node_index <= last_optimized_node_index) {
+            continue;
+        }
+        if (*num_unoptimized_nodes == 0 ||
+            node.data.time() < oldest_unoptimized_node_time) {
+            oldest_unoptimized_node_time = node.data.time();
+        }
+        (*num_unoptimized_nodes)++;
+    }
+    if (*num_unoptimized_nodes > 0) {
+        *oldest_unoptimized_node_age_sec = cartographer::common::ToSeconds(
+            latest_node_time - oldest_unoptimized_node_time);
+    }
+}
+
+cartographer::mapping::PoseGraphInterface::GlobalSlamOptimizationCallback
+MapBuilder::GetGlobalSlamOptimizationCallback() {
+    return [=](const std::map<int, cartographer::mapping::SubmapId> &,
+               const std::map<int, cartographer::mapping::NodeId>
+                   &last_optimized_node_ids_by_trajectory) {
+        std::lock_guard<std::mutex> lk(last_optimized_node_ids_mutex);
+        last_optimized_node_ids = last_optimized_node_ids_by_trajectory;
+    };
+}
+
 cartographer::mapping::MapBuilderInterface::LocalSlamResultCallback
 MapBuilder::GetLocalSlamResultCallback() {
     return [=](const int trajectory_id, const ::cartographer::common::Time time,
@@ -131,10 +509,15 @@ MapBuilder::GetLocalSlamResultCallback() {
                ::cartographer::sensor::RangeData range_data_in_local,
                const std::unique_ptr<
                    const cartographer::mapping::TrajectoryBuilderInterface::
-                       InsertionResult>) {
-        {
-            std::lock_guard<std::mutex> lk(local_slam_result_pose_mutex);
-            local_slam_result_pose = local_pose;
+                       InsertionResult>
+                   insertion_result) {
+        // readings dropped by the motion filter are not inserted and are not
+        // scored; the returns are in the local frame of the trajectory
+        std::lock_guard<std::mutex> lk(local_slam_result_pose_mutex);
+        local_slam_result_pose = local_pose;
+        if (insertion_result != nullptr) {
+            local_slam_result_returns = range_data_in_local.returns;
+            local_slam_result_returns_pose = local_pose;
         }
         local_pose_initialized = true;
     };
@@ -149,6 +532,83 @@ cartographer::transform::Rigid3d MapBuilder::GetGlobalPose() {
     }
 }
 
+double MapBuilder::GetMatchConfidence() {
+    {
+        std::lock_guard<std::mutex> lk(last_optimized_node_ids_mutex);
+        if (last_optimized_node_ids.find(trajectory_id) ==
+            last_optimized_node_ids.end()) {
+            return -1;
+        }
+    }
+    cartographer::sensor::PointCloud returns;
+    {
+        std::lock_guard<std::mutex> lk(local_slam_result_pose_mutex);
+        returns = local_slam_result_returns;
+    }
+    if (returns.empty()) {
+        return -1;
+    }
+
+    // the reading is scored against the submaps that are no longer inserted
+    // into, at their optimized poses, rather than against the submaps it was
+    // just inserted into, as those contain the reading itself
+    auto pose_graph = map_builder_->pose_graph();
+    // the returns are in the local frame of the trajectory
+    const auto local_to_global =
+        pose_graph->GetLocalToGlobalTransform(trajectory_id);
+    std::vector<std::pair<const cartographer::mapping::ProbabilityGrid *,
+                          cartographer::transform::Rigid3d>>
+        finished_grids;
+    const auto submaps = pose_graph->GetAllSubmapData();
+    for (const auto &submap_id_data : submaps) {
+        const auto &submap = submap_id_data.data.submap;
+        if (submap == nullptr || !submap->insertion_finished()) {
+            continue;
+        }
+        auto submap_2d =
+            std::dynamic_pointer_cast<const cartographer::mapping::Submap2D>(
+                submap);
+        auto grid =
+            submap_2d == nullptr
+                ? nullptr
+                : dynamic_cast<const cartographer::mapping::ProbabilityGrid *>(
+                      submap_2d->grid());
+        if (grid != nullptr) {
+            // the grid of a submap is in the local frame of its trajectory
+            finished_grids.emplace_back(
+                grid, submap->local_pose() *
+                          submap_id_data.data.pose.inverse() *
+                          local_to_global);
+        }
+    }
+
+    if (finished_grids.empty()) {
+        return -1;
+    }
+
+    // a return is scored by the highest probability of the finished submaps
+    // that know its cell, and by 0 if none does, as it is off the map
+    double sum = 0;
+    for (const auto &point : returns) {
+        double probability = 0;
+        for (const auto &grid_transform : finished_grids) {
+            const auto grid = grid_transform.first;
+            const Eigen::Array2i cell_index = grid->limits().GetCellIndex(
+                (grid_transform.second * point.position.cast<double>())
+                    .head<2>()
+                    .cast<float>());
+            if (grid->limits().Contains(cell_index) &&
+                grid->IsKnown(cell_index)) {
+                probability = std::max(
+                    probability,
+                    static_cast<double>(grid->GetProbability(cell_index)));
+            }
+        }
+        sum += probability;
+    }
+    return sum / returns.size();
+}
+
 void MapBuilder::OverwriteOptimizeEveryNNodes(int value) {
     auto mutable_pose_graph_options =
         map_builder_options_.mutable_pose_graph_options();
@@ -245,6 +705,12 @@ void MapBuilder::OverwriteRotationWeight(double value) {
     mutable_ceres_scan_matcher_options->set_rotation_weight(value);
 }
 
+void MapBuilder::OverwriteMaxNumFinalIterations(int value) {
+    auto mutable_pose_graph_options =
+        map_builder_options_.mutable_pose_graph_options();
+    mutable_pose_graph_options->set_max_num_final_iterations(value);
+}
+
 void MapBuilder::OverwriteInitialStartTrajectory(double x, double y,
                                                  double theta) {
     auto mutable_initial_trajectory_pose =
@@ -271,6 +737,10 @@ void MapBuilder::OverwriteInitialStartTrajectory(double x, double y,
     mutable_initial_trajectory_pose->set_timestamp(0);
 }
 
+void MapBuilder::ClearInitialStartTrajectory() {
+    trajectory_builder_options_.clear_initial_trajectory_pose();
+}
+
 int MapBuilder::GetOptimizeEveryNNodes() {
     return map_builder_options_.pose_graph_options().optimize_every_n_nodes();
 }
@@ -345,5 +815,9 @@ double MapBuilder::GetRotationWeight() {
         .rotation_weight();
 }
 
+int MapBuilder::GetMaxNumFinalIterations() {
+    return map_builder_options_.pose_graph_options().max_num_final_iterations();
+}
+
 }  // namespace carto_facade
 }  // namespace viam
@@ -3,6 +3,7 @@
 #define VIAM_CARTO_FACADE_MAP_BUILDER_H
 
 #include <string>
+#include <vector>
 
 #include "cartographer/io/proto_stream.h"
 #include "cartographer/mapping/2d/grid_2d.h"
@@ -45,16 +46,87 @@ class MapBuilder {
     void LoadMapFromFile(std::string map_filename, bool load_frozen_trajectory,
                          bool optimize_on_start);
 
+    // LoadFloorPlan adds a trajectory with a single finished submap, built
+    // from the given cells of a probability grid, to the internal
+    // map_builder_. The positions are the centers of the cells in meters &
+    // cells which are not given are unknown. The trajectory is frozen if
+    // load_frozen_trajectory is true.
+    void LoadFloorPlan(const std::vector<Eigen::Vector2f> &positions,
+                       const std::vector<float> &probabilities,
+                       double resolution, bool load_frozen_trajectory);
+
     // SaveMapToFile saves the current map_builder_ state to a pbstream file at
     // the provided path.
     bool SaveMapToFile(bool include_unfinished_submaps,
                        const std::string filename_with_timestamp);
 
+    // SetAdditionalRangeSensors sets the ids of the range sensors other than
+    // kRangeSensorId that trajectory builders started afterwards accept lidar
+    // readings from. Cartographer collates the readings of all range sensors.
+    void SetAdditionalRangeSensors(const std::vector<std::string> &sensor_ids);
+
     void StartTrajectoryBuilder(bool use_imu_data);
 
+    // StartNewTrajectory finishes & freezes the current trajectory, which
+    // stays part of the pose graph, and starts a new trajectory builder. The
+    // new trajectory starts at the given initial pose if has_initial_pose is
+    // true and is localized against the existing trajectories otherwise.
+    // Returns the id of the finished trajectory.
+    int StartNewTrajectory(bool use_imu_data, bool has_initial_pose, double x,
+                           double y, double theta);
+
+    // FreezeTrajectory finishes the trajectory with the given id, which must
+    // not be the current trajectory, if it is active and freezes it, so that
+    // it stays part of the pose graph while the optimization no longer moves
+    // it.
+    void FreezeTrajectory(
+        int id,
+        cartographer::mapping::PoseGraphInterface::TrajectoryState state);
+
+    // RestartTrajectory finishes & deletes the current trajectory, which must
+    // be a localization trajectory, and starts a new trajectory builder with
+    // the same options at the given initial pose if has_initial_pose is set
+    // and localized globally against the frozen trajectories otherwise.
+    int RestartTrajectory(bool use_imu_data, bool has_initial_pose, double x,
+                          double y, double theta);
+
+    // SwitchTrajectory finishes & freezes the current trajectory and starts a
+    // new trajectory builder at the current global pose, which only localizes
+    // against the frozen trajectories & keeps at most max_submaps_to_keep
+    // submaps of its own if pure_localization is true. Returns the id of the
+    // finished trajectory.
+    int SwitchTrajectory(bool use_imu_data, bool pure_localization,
+                         int max_submaps_to_keep);
+
+    // GetTrajectoryStates returns the state of every trajectory in the pose
+    // graph, keyed by trajectory id.
+    std::map<int, cartographer::mapping::PoseGraphInterface::TrajectoryState>
+    GetTrajectoryStates();
+
+    // GetTrajectoryNodePoses returns the optimized global pose of every node
+    // in the pose graph, along with its time unless its data was trimmed.
+    cartographer::mapping::MapById<cartographer::mapping::NodeId,
+                                   cartographer::mapping::TrajectoryNodePose>
+    GetTrajectoryNodePoses();
+
+    // GetOptimizationLag returns the number of nodes of the current trajectory,
+    // the number of them which have not been covered by an optimization pass
+    // of the pose graph yet & the age of the oldest of those in seconds,
+    // measured against the time of the latest node.
+    void GetOptimizationLag(int *num_nodes, int *num_unoptimized_nodes,
+                            double *oldest_unoptimized_node_age_sec);
+
     // GetGlobalPose returns the local pose based on the provided a local pose.
     cartographer::transform::Rigid3d GetGlobalPose();
 
+    // GetMatchConfidence returns the mean probability of the finished submaps
+    // being occupied at the returns of the latest lidar reading that was
+    // inserted, placed by the global pose of the reading, where returns off
+    // the known cells of the finished submaps count as 0. It is -1, i.e.
+    // unknown, if the pose graph has not been optimized yet or there is no
+    // finished submap to score the reading against.
+    double GetMatchConfidence();
+
     // AddSensorData adds sensor data to cartographer's internal state.
     // Throws if adding sensor data fails.
     void AddSensorData(const std::string &sensor_id,
@@ -69,6 +141,11 @@ class MapBuilder {
     cartographer::mapping::MapBuilderInterface::LocalSlamResultCallback
     GetLocalSlamResultCallback();
 
+    // GetGlobalSlamOptimizationCallback records the last node of every
+    // trajectory which was covered by an optimization pass of the pose graph.
+    cartographer::mapping::PoseGraphInterface::GlobalSlamOptimizationCallback
+    GetGlobalSlamOptimizationCallback();
+
     // Overwrite functions to overwrite the exposed cartographer parameters.
     void OverwriteOptimizeEveryNNodes(int value);
     void OverwriteNumRangeData(int value);
@@ -83,7 +160,9 @@ class MapBuilder {
     void OverwriteOccupiedSpaceWeight(double value);
     void OverwriteTranslationWeight(double value);
     void OverwriteRotationWeight(double value);
+    void OverwriteMaxNumFinalIterations(int value);
     void OverwriteInitialStartTrajectory(double x, double y, double theta);
+    void ClearInitialStartTrajectory();
 
     // Getter functions to return the exposed cartographer parameters.
     int GetOptimizeEveryNNodes();
@@ -99,6 +178,7 @@ class MapBuilder {
     double GetOccupiedSpaceWeight();
     double GetTranslationWeight();
     double GetRotationWeight();
+    int GetMaxNumFinalIterations();
 
     std::unique_ptr<cartographer::mapping::MapBuilderInterface> map_builder_;
     cartographer::mapping::TrajectoryBuilderInterface *trajectory_builder;
@@ -108,11 +188,34 @@ class MapBuilder {
         trajectory_builder_options_;
     std::atomic<bool> local_pose_initialized{false};
 
+    // RelocalizeTrajectory searches the finished submaps of the other
+    // trajectories for the returns of the last reading local SLAM inserted,
+    // within the linear (in meters) and angular (in radians) search windows
+    // around the global pose of the reading. The search windows of the
+    // constraint builder are left as configured, so that they are not widened
+    // for the rest of the session. If the returns match with at least the
+    // min_score of the constraint builder, the trajectory is restarted at the
+    // matched pose and true is returned.
+    bool RelocalizeTrajectory(bool use_imu_data, double linear, double angular);
+
    private:
+    // ReplaceTrajectory deletes the active trajectory and starts a new one
+    // with the trajectory builder options, returning the id of the deleted
+    // trajectory.
+    int ReplaceTrajectory(bool use_imu_data);
+
+    std::vector<std::string> additional_range_sensor_ids;
     std::mutex local_slam_result_pose_mutex;
     ::cartographer::transform::Rigid3d local_slam_result_pose =
         cartographer::transform::Rigid3d();
     ;
+    cartographer::sensor::PointCloud local_slam_result_returns;
+    // local_slam_result_returns_pose is the local pose of the reading
+    // local_slam_result_returns were inserted with
+    ::cartographer::transform::Rigid3d local_slam_result_returns_pose =
+        cartographer::transform::Rigid3d();
+    std::mutex last_optimized_node_ids_mutex;
+    std::map<int, cartographer::mapping::NodeId> last_optimized_node_ids;
 };
 }  // namespace carto_facade
 }  // namespace viam
@@ -201,6 +201,36 @@ std::tuple<bool, cartographer::sensor::TimedPointCloudData> carto_lidar_reading(
 
     return {true, point_cloud};
 }
+
+bool probability_grid_cells(std::string pcd,
+                            std::vector<Eigen::Vector2f> &positions,
+                            std::vector<float> &probabilities) {
+    pcl::PCLPointCloud2 blob;
+    try {
+        if (read_pcd(pcd, blob)) {
+            return false;
+        }
+    } catch (std::exception &e) {
+        LOG(ERROR) << "exception thrown during read_pcd: " << e.what();
+        return false;
+    }
+    if (pcl::getFieldIndex(blob, "rgb") == -1) {
+        LOG(ERROR) << "probability grid pcd has no rgb field";
+        return false;
+    }
+    pcl::PointCloud<pcl::PointXYZRGB> cloud;
+    pcl::fromPCLPointCloud2(blob, cloud);
+
+    positions.clear();
+    probabilities.clear();
+    positions.reserve(cloud.points.size());
+    probabilities.reserve(cloud.points.size());
+    for (const auto &point : cloud.points) {
+        positions.push_back(Eigen::Vector2f(point.x, point.y));
+        probabilities.push_back(point.b / 100.0f);
+    }
+    return true;
+}
 }  // namespace util
 }  // namespace carto_facade
 }  // namespace viam
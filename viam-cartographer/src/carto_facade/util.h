@@ -6,6 +6,7 @@
 
 #include <string>
 #include <tuple>
+#include <vector>
 
 #include "cartographer/sensor/timed_point_cloud_data.h"
 
@@ -52,6 +53,14 @@ void write_int_to_buffer_in_bytes(std::string &buffer, int d);
 std::tuple<bool, cartographer::sensor::TimedPointCloudData> carto_lidar_reading(
     std::string lidar_reading, int64_t lidar_reading_time_unix_milli);
 int read_pcd(std::string pcd, pcl::PCLPointCloud2 &blob);
+
+// probability_grid_cells reads the cells of a probability grid from a pcd,
+// where each point is the center of a known cell & the blue channel of its
+// color is the probability of the cell being occupied, in percent.
+// Returns false if the pcd is invalid.
+bool probability_grid_cells(std::string pcd,
+                            std::vector<Eigen::Vector2f> &positions,
+                            std::vector<float> &probabilities);
 }  // namespace util
 }  // namespace carto_facade
 }  // namespace viam
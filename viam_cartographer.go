@@ -5,10 +5,20 @@ package viamcartographer
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"math"
+	"math/rand"
 	"os"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strconv"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -16,15 +26,20 @@ import (
 	"github.com/golang/geo/r3"
 	"github.com/pkg/errors"
 	"go.opencensus.io/trace"
+	"go.uber.org/multierr"
 	"go.uber.org/zap/zapcore"
-	viamgrpc "go.viam.com/rdk/grpc"
+	"go.viam.com/rdk/components/camera"
 	"go.viam.com/rdk/logging"
+	"go.viam.com/rdk/pointcloud"
 	"go.viam.com/rdk/resource"
 	"go.viam.com/rdk/services/slam"
 	"go.viam.com/rdk/spatialmath"
+	"go.viam.com/utils"
 
 	"github.com/viam-modules/viam-cartographer/cartofacade"
 	vcConfig "github.com/viam-modules/viam-cartographer/config"
+	"github.com/viam-modules/viam-cartographer/floorplan"
+	"github.com/viam-modules/viam-cartographer/pbstream"
 	"github.com/viam-modules/viam-cartographer/postprocess"
 	"github.com/viam-modules/viam-cartographer/sensorprocess"
 	s "github.com/viam-modules/viam-cartographer/sensors"
@@ -34,18 +49,136 @@ import (
 var (
 	Model    = resource.NewModel("viam", "slam", "cartographer")
 	cartoLib cartofacade.CartoLib
+	// ModuleVersion is the version of the module the exported metrics are attributed to. It is set by the module.
+	ModuleVersion = "development"
+	// ParentResourceResolver resolves a resource from the live dependency graph of the parent robot, so that a
+	// lidar whose camera was rebuilt gets the new handle. It is set by the module; without it, the cameras are
+	// resolved again from the dependencies the service was constructed with.
+	ParentResourceResolver s.ResourceResolver
+	// defaultRetryableInitErrors are the error codes initializing cartographer is retried on by default.
+	defaultRetryableInitErrors = []string{
+		"VIAM_CARTO_OUT_OF_MEMORY",
+		"VIAM_CARTO_INTERNAL_STATE_FILE_SYSTEM_ERROR",
+		"VIAM_CARTO_UNABLE_TO_ACQUIRE_LOCK",
+	}
 	// ErrClosed denotes that the slam service method was called on a closed slam resource.
 	ErrClosed = errors.Errorf("resource (%s) is closed", Model.String())
 	// ErrUseCloudSlamEnabled denotes that the slam service method was called while use_cloud_slam was set to true.
 	ErrUseCloudSlamEnabled = errors.Errorf("resource (%s) unavailable, configured with use_cloud_slam set to true", Model.String())
 	// ErrNoPostprocessingToUndo denotes that the points have not been properly formatted.
 	ErrNoPostprocessingToUndo = errors.New("there are no postprocessing tasks to undo")
+	// ErrTooManyPostprocessingTasks denotes that max_postprocessing_tasks has been reached.
+	ErrTooManyPostprocessingTasks = errors.New("too many postprocessing tasks, undo tasks or replace them with " +
+		"a postprocessed pcd file using " + postprocess.PathCommand)
 	// ErrBadPostprocessingPointsFormat denotest that the postprocesing points have not been correctly provided.
 	ErrBadPostprocessingPointsFormat = errors.New("invalid postprocessing points format")
+	// ErrBadPostprocessingCropFormat denotes that the box of postprocess_crop has not been correctly provided.
+	ErrBadPostprocessingCropFormat = errors.New("invalid postprocessing crop format, expected " +
+		"{\"minx\": <val>, \"miny\": <val>, \"maxx\": <val>, \"maxy\": <val>} in mm")
+	// ErrBadPostprocessingVoxelSize denotes that the voxel size has not been correctly provided.
+	ErrBadPostprocessingVoxelSize = errors.New("invalid postprocessing voxel size, expected a positive number of mm")
 	// ErrBadPostprocessingPointsFormat denotest that the postprocesing points have not been correctly provided.
 	ErrBadPostprocessingPath = errors.New("could not parse path to pcd")
+	// ErrBadMappingBoundsFormat denotes that the mapping bounds have not been correctly provided.
+	ErrBadMappingBoundsFormat = errors.New("invalid mapping bounds format")
+	// ErrBadMapCrop denotes that the crop of an exported map has not been correctly provided.
+	ErrBadMapCrop = errors.Errorf("invalid map crop, expected %q, "+
+		"{\"minx\": <val>, \"miny\": <val>, \"maxx\": <val>, \"maxy\": <val>} in mm or "+
+		"{\"polygon\": [{\"x\": <val>, \"y\": <val>}, ...]} of at least three vertices in mm", MapCropMappingBounds)
+	// ErrNoMappingBounds denotes that an exported map was cropped to the mapping bounds while none are set.
+	ErrNoMappingBounds = errors.New("cannot crop the map to the mapping bounds, none are set")
+	// ErrNoSession denotes that a session override was sent outside of a session.
+	ErrNoSession = errors.New("session overrides require a session, send them from a client with sessions enabled")
+	// ErrBadLogLevel denotes that the log level has not been correctly provided.
+	ErrBadLogLevel = errors.Errorf("invalid log level, expected one of %q, %q or %q", LogLevelInfo, LogLevelWarn, LogLevelDebug)
+	// ErrBadTrajectoryPoseFormat denotes that the initial pose of a new trajectory has not been correctly provided.
+	ErrBadTrajectoryPoseFormat = errors.New("invalid trajectory pose format, expected {\"x\": <val>, \"y\": <val>, \"theta\": <val>}")
+	// ErrBadMetricsCSVPath denotes that the path to write the metrics CSV to has not been correctly provided.
+	ErrBadMetricsCSVPath = errors.New("invalid metrics CSV path, expected an absolute path")
+	// ErrShadowNotConfigured denotes that a shadow command was sent although shadow_config is not set.
+	ErrShadowNotConfigured = errors.New("shadow_config is not set")
+	// ErrChangeDetectionNotEnabled denotes that the change heatmap was requested although change_detection is not set.
+	ErrChangeDetectionNotEnabled = errors.New("change_detection is not enabled")
+	// ErrBadChangeHeatmapFormat denotes that the format of the change heatmap has not been correctly provided.
+	ErrBadChangeHeatmapFormat = errors.Errorf("invalid change heatmap format, expected %q or %q",
+		ChangeHeatmapFormatPCD, ChangeHeatmapFormatPNG)
+	// ErrInternalStateExportNotConfigured denotes that internal_state_export_dirs is not set.
+	ErrInternalStateExportNotConfigured = errors.New("internal_state_export_dirs is not set")
+	// ErrBadInternalStatePath denotes that the path to write the internal state to has not been correctly provided.
+	ErrBadInternalStatePath = errors.New("invalid internal state path, expected an absolute path")
+	// ErrInternalStatePathNotAllowed denotes that the path is not within internal_state_export_dirs.
+	ErrInternalStatePathNotAllowed = errors.New("internal state path is not within internal_state_export_dirs")
+	// ErrInternalStateDirNotFound denotes that the directory of the internal state path does not exist.
+	ErrInternalStateDirNotFound = errors.New("the directory of the internal state path does not exist")
+	// ErrBadMapRevision denotes that the revision sent with get_map_delta is not a non-negative integer.
+	ErrBadMapRevision = errors.New("invalid map revision, expected null or a non-negative integer")
+	// ErrBadCompactTelemetry denotes that a binary blob is not a CompactTelemetry.
+	ErrBadCompactTelemetry = errors.New("invalid compact telemetry")
+	// ErrBadOccupancyGridRequest denotes that the value sent with get_occupancy_grid has not been correctly provided.
+	ErrBadOccupancyGridRequest = errors.New("invalid occupancy grid request, expected null or " +
+		"{\"resolution\": <meters>, \"occupied_threshold\": <points>, \"crop\": <crop>} with a positive resolution and a non-negative threshold")
+	// ErrOccupancyGridMapEmpty denotes that an occupancy grid was requested before the map has any points.
+	ErrOccupancyGridMapEmpty = errors.New("cannot build an occupancy grid, the pointcloud map is empty; " +
+		"it will have points once cartographer has processed enough lidar readings")
+	// ErrBadMapGeoJSONRequest denotes that the value sent with get_map_geojson has not been correctly provided.
+	ErrBadMapGeoJSONRequest = errors.New("invalid map geojson request, expected null or " +
+		"{\"resolution\": <meters>, \"min_probability\": <percent>} with a positive resolution and a probability of 0 to 100")
+	// ErrBadTrajectoryRequest denotes that the value sent with get_trajectory has not been correctly provided.
+	ErrBadTrajectoryRequest = errors.New("invalid trajectory request, expected null or " +
+		"{\"since_unix_ms\": <val>, \"chunk\": <val>} with a non-negative chunk")
+	// ErrTrajectoryChunkOutOfRange denotes that get_trajectory was sent a chunk it does not have.
+	ErrTrajectoryChunkOutOfRange = errors.New("trajectory chunk out of range")
+	// ErrBadSubmapRequest denotes that the value sent with get_submap has not been correctly provided.
+	ErrBadSubmapRequest = errors.New("invalid submap request, expected " +
+		"{\"trajectory_id\": <val>, \"submap_index\": <val>, \"chunk\": <val>, \"version\": <val>} with a " +
+		"non-negative chunk and an optional version")
+	// ErrSubmapChunkOutOfRange denotes that get_submap was sent the index of a chunk the response does not have.
+	ErrSubmapChunkOutOfRange = errors.New("submap chunk out of range")
+	// ErrSubmapVersionChanged denotes that get_submap was sent the version of a submap that has changed since, so
+	// the chunks have to be requested again from the first.
+	ErrSubmapVersionChanged = errors.New("the version of the submap changed, request its chunks again")
+	// ErrBadSessionPostprocessing denotes that set_session_postprocessing was sent a bad value.
+	ErrBadSessionPostprocessing = errors.New("invalid session postprocessing, expected {\"postprocessed\": <bool>} " +
+		"or null to clear the override")
+	// ErrBadMode denotes that the value sent with set_mode has not been correctly provided.
+	ErrBadMode = errors.Errorf("invalid mode, expected %q or %q", ModeLocalize, ModeMap)
+	// ErrSetModeOffline denotes that set_mode was sent while the offline sensor process is running.
+	ErrSetModeOffline = errors.New("set_mode is not supported while the offline sensor process is running")
+	// ErrRelocalizeWhileMapping denotes that relocalize was sent while mapping is enabled.
+	ErrRelocalizeWhileMapping = errors.Errorf("relocalize is only supported while localizing, switch to it with "+
+		"set_mode %q", ModeLocalize)
+	// ErrBadLoadInternalStatePath denotes that the path sent with load_internal_state has not been correctly provided.
+	ErrBadLoadInternalStatePath = errors.Errorf("invalid internal state path, expected the path of a %s file",
+		internalStateFileType)
+	// ErrLoadInternalStateWhileMapping denotes that load_internal_state was sent while mapping is enabled.
+	ErrLoadInternalStateWhileMapping = errors.Errorf("load_internal_state is only supported while localizing, "+
+		"switch to it with set_mode %q", ModeLocalize)
+	// ErrLoadInternalStateOffline denotes that load_internal_state was sent in offline mode.
+	ErrLoadInternalStateOffline = errors.New("load_internal_state is only supported in online mode")
+	// ErrBadPoseSubscription denotes that the subscription sent with subscribe_poses has not been correctly provided.
+	ErrBadPoseSubscription = errors.Errorf("invalid pose subscription, expected {\"id\": <string>} or "+
+		"{\"id\": <string>, \"buffer_size\": <1 to %d>}", maxPoseSubscriptionBufferSize)
+	// ErrBadPoseSubscriptionID denotes that the subscription id sent with poll_poses or unsubscribe_poses is not a
+	// string.
+	ErrBadPoseSubscriptionID = errors.New("invalid pose subscription id, expected a non-empty string")
+	// ErrUnknownPoseSubscription denotes that a pose subscription was never registered, was removed or expired.
+	ErrUnknownPoseSubscription = errors.Errorf("unknown pose subscription, subscriptions expire when they are not "+
+		"polled for %v, register it again with %s", poseSubscriptionTimeout, SubscribePosesCommand)
+	// ErrTooManyPoseSubscriptions denotes that subscribe_poses was sent while the maximum number of subscriptions
+	// is registered.
+	ErrTooManyPoseSubscriptions = errors.Errorf("cannot register more than %d pose subscriptions", maxPoseSubscriptions)
+	// ErrJobProgressOnline denotes that job_progress was sent in online mode.
+	ErrJobProgressOnline = errors.New("job_progress is only supported in offline mode")
+	// ErrLocalizationLost denotes that Position was called while the localization is lost.
+	ErrLocalizationLost = errors.New("the localization is lost, the lidar readings do not match the map")
+	// ErrInitialOptimizationInProgress denotes that Position was called before the sensors are read, while the
+	// existing map is optimized in the background by a library that predates FeatureBackgroundInitialOptimization.
+	ErrInitialOptimizationInProgress = errors.New("the existing map is being optimized, there is no pose until " +
+		"the optimization of optimize_on_start_async completes")
 	// startPosRegex contains the regex formula for extracting the optional initial_starting_pose values from the config.
 	startPosRegex = regexp.MustCompile(`X:(\d+(?:\.\d+)?),\s*Y:(\d+(?:\.\d+)?),\s*Theta:(\d+(?:\.\d+)?)`)
+	// startPosSigmaRegex is startPosRegex for initial_starting_pose_sigma, matching negatives to reject them.
+	startPosSigmaRegex = regexp.MustCompile(`X:(-?\d+(?:\.\d+)?),\s*Y:(-?\d+(?:\.\d+)?),\s*Theta:(-?\d+(?:\.\d+)?)`)
 )
 
 const (
@@ -56,6 +189,67 @@ const (
 	defaultCartoFacadeInternalTimeout    = 15 * time.Minute
 	chunkSizeBytes                       = 1 * 1024 * 1024
 	internalStateFileType                = ".pbstream"
+	// positionUnit and pointCloudMapUnit are the linear units of positions and of the pointcloud map.
+	positionUnit      = "mm"
+	pointCloudMapUnit = "m"
+	// moduleDataDirEnvVar names the data directory viam-server provides to modules.
+	moduleDataDirEnvVar = "VIAM_MODULE_DATA"
+	// defaultHangThreshold matches the internal timeout, which callers give up after anyway.
+	defaultHangThreshold = defaultCartoFacadeInternalTimeout
+	// defaultMaxIngestionLatency is the p95 ingestion latency above which readings are stale.
+	defaultMaxIngestionLatency = time.Second
+	// defaultMaxDutyCyclePercent is the duty cycle above which cartographer is too slow for the lidar.
+	defaultMaxDutyCyclePercent = 90
+	// sustainedDutyCycleWindows is the number of windows above the max duty cycle between warnings.
+	sustainedDutyCycleWindows = 6
+	// defaultMaxConsecutiveLidarFailures is the number of lidar failures in a row offline mode gives up after.
+	defaultMaxConsecutiveLidarFailures = 10
+	// defaultMaxRejectedReadingRetries is the number of times a rejected reading is retried offline.
+	defaultMaxRejectedReadingRetries = 3
+	// defaultMaxPostprocessingTasks is the number of postprocessing tasks that may be queued.
+	defaultMaxPostprocessingTasks = 1000
+	// defaultMaxInitAttempts is the number of attempts to initialize and start cartographer.
+	defaultMaxInitAttempts = 3
+	// initRetryBaseBackoff doubles with every retry of initializing cartographer, up to initRetryMaxBackoff.
+	initRetryBaseBackoff = time.Second
+	initRetryMaxBackoff  = 10 * time.Second
+	// defaultMaxUnoptimizedNodeAge is the age above which optimization is not keeping up.
+	defaultMaxUnoptimizedNodeAge = time.Minute
+	// internalStateMetadataSuffix is appended to an exported internal state for its metadata.
+	internalStateMetadataSuffix = ".metadata.json"
+	// sessionStatsPollInterval is the interval the position is polled at for the session stats.
+	sessionStatsPollInterval = time.Second
+	// defaultMaxSpeedMmPerSec is the speed between the reading times of two positions above which the robot is
+	// considered relocalized.
+	defaultMaxSpeedMmPerSec = 5000
+	// defaultMapStallLidarReadings is the number of lidar readings without map growth before it stalls.
+	defaultMapStallLidarReadings = 100
+	// defaultLocalizationLostTimeout is how long the match confidence may stay below the minimum.
+	defaultLocalizationLostTimeout = 10 * time.Second
+	// defaultLocalizationMinConfidence is the match confidence below which readings do not match.
+	defaultLocalizationMinConfidence = 0.5
+	// defaultRecentErrorsBufferSize is the number of recent warnings and errors that are kept.
+	defaultRecentErrorsBufferSize = 50
+	// mapGrowthPollInterval is the interval the map growth is checked at in mapping mode.
+	mapGrowthPollInterval = 10 * time.Second
+	// slamStatsPollInterval is the interval the slam stats are polled at.
+	slamStatsPollInterval = 10 * time.Second
+	// editedMapCheckInterval is the time between attempts of the edited map consistency check.
+	editedMapCheckInterval = time.Second
+	// changeDetectionResolution is the cell size, in millimeters, of the change detection.
+	changeDetectionResolution = 100
+	// mapOverlapResolution is the cell size, in millimeters, of the map overlap estimate.
+	mapOverlapResolution = 100
+	// mapOverlapWindow is the number of lidar readings the map overlap is averaged over.
+	mapOverlapWindow = 50
+	// lidarRejectionsToDiagnose is the number of rejected lidar readings in a row that are diagnosed.
+	lidarRejectionsToDiagnose = 5
+	// lidarReconnectFailures is the number of unavailable camera failures before it is resolved again.
+	lidarReconnectFailures = 5
+	// additionalLidarReadingTimeout is how long the next reading of an additional lidar is waited for offline.
+	additionalLidarReadingTimeout = 30 * time.Second
+	// movementSensorUnusedLidarReadings is the number of lidar readings before the movement sensor is unused.
+	movementSensorUnusedLidarReadings = 50
 
 	// JobDoneCommand is the string that needs to be sent to DoCommand to find out if the job has finished.
 	JobDoneCommand = "job_done"
@@ -115,62 +309,239 @@ func init() {
 // must be called before module.AddModelFromRegistry is
 // called.
 func InitCartoLib(logger logging.Logger) error {
-	minloglevel := 1 // warn
-	vlog := 0        //  disabled
+	logLevel := LogLevelWarn
 	if logger.Level() == zapcore.DebugLevel {
-		minloglevel = 0 // info
-		vlog = 1        // verbose enabled
+		logLevel = LogLevelDebug
+	}
+	minloglevel, vlog, err := toGlogLevels(logLevel)
+	if err != nil {
+		return err
 	}
 	lib, err := cartofacade.NewLib(minloglevel, vlog)
 	if err != nil {
 		return err
 	}
 	cartoLib = lib
+	logger.Debugw("initialized cartographer library", "log_level", logLevel,
+		CapabilitiesKey, lib.Capabilities().Available())
+	if unavailable := lib.Capabilities().Unavailable(); len(unavailable) > 0 {
+		logger.Warnw("the cartographer library predates some optional features, they are unavailable until it is "+
+			"updated", "unavailable_features", unavailable)
+	}
 	return nil
 }
 
+// toGlogLevels converts a log level into the glog minloglevel and verbose level cartographer logs with.
+func toGlogLevels(logLevel string) (minloglevel, vlog int, err error) {
+	switch logLevel {
+	case LogLevelInfo:
+		return 0, 0, nil
+	case LogLevelWarn:
+		return 1, 0, nil
+	case LogLevelDebug:
+		return 0, 1, nil
+	default:
+		return 0, 0, ErrBadLogLevel
+	}
+}
+
+// fromGlogLevels converts the glog minloglevel and verbose level cartographer logs with into a log level.
+func fromGlogLevels(minloglevel, vlog int) string {
+	switch {
+	case vlog > 0:
+		return LogLevelDebug
+	case minloglevel == 0:
+		return LogLevelInfo
+	default:
+		return LogLevelWarn
+	}
+}
+
 // TerminateCartoLib is run to terminate the cartographer library.
 func TerminateCartoLib() error {
 	return cartoLib.Terminate()
 }
 
 func initSensorProcesses(cancelCtx context.Context, cartoSvc *CartographerService) {
+	runSensorProcesses(cancelCtx, cartoSvc, newSensorProcessConfig(cartoSvc))
+}
+
+// newSensorProcessConfig returns the config of the sensor processes and sets up the state of the service they
+// report to, which the DoCommands read from.
+func newSensorProcessConfig(cartoSvc *CartographerService) sensorprocess.Config {
 	spConfig := sensorprocess.Config{
-		CartoFacade:     cartoSvc.cartofacade,
-		IsOnline:        cartoSvc.lidar.DataFrequencyHz() != 0,
-		Lidar:           cartoSvc.lidar,
-		MovementSensor:  cartoSvc.movementSensor,
-		Timeout:         cartoSvc.cartoFacadeTimeout,
-		InternalTimeout: cartoSvc.cartoFacadeInternalTimeout,
-		Logger:          cartoSvc.logger,
+		CartoFacade:      cartoSvc.cartofacade,
+		IsOnline:         cartoSvc.lidar.DataFrequencyHz() != 0,
+		Lidar:            cartoSvc.lidar,
+		AdditionalLidars: cartoSvc.additionalLidars,
+		MovementSensor:   cartoSvc.movementSensor,
+		Timeout:          cartoSvc.cartoFacadeTimeout,
+		InternalTimeout:  cartoSvc.cartoFacadeInternalTimeout,
+		Logger:           cartoSvc.logger,
+		MappingBounds:    &cartoSvc.mappingBounds,
+		OdometerOrigin:   &cartoSvc.odometerOrigin,
+		SessionClock:     cartoSvc.sessionClock,
 	}
 
+	if cartoSvc.shadowCartofacade != nil {
+		spConfig.ShadowMirror = sensorprocess.NewShadowMirror(cartoSvc.shadowCartofacade, cartoSvc.logger, spConfig.IsOnline)
+	}
+
+	cartoSvc.ingestionLatency = &sensorprocess.IngestionLatency{MaxP95: cartoSvc.maxIngestionLatency}
+	spConfig.IngestionLatency = cartoSvc.ingestionLatency
+
+	if cartoSvc.minPointsPerScan > 0 {
+		cartoSvc.scanFilter = &sensorprocess.ScanFilter{
+			MinPointsPerScan: cartoSvc.minPointsPerScan,
+			MinRange:         float64(cartoSvc.requestedAlgoConfig.MinRange),
+		}
+		spConfig.ScanFilter = cartoSvc.scanFilter
+	}
+	spConfig.EmptyLidarReadings = &cartoSvc.emptyLidarReadings
+	spConfig.AddedLidarReadings = &cartoSvc.addedLidarReadings
+	spConfig.AddedIMUReadings = &cartoSvc.addedIMUReadings
+	spConfig.AddedOdometerReadings = &cartoSvc.addedOdometerReadings
+	cartoSvc.sensorStats = &sensorprocess.SensorStats{IsOnline: spConfig.IsOnline}
+	spConfig.SensorStats = cartoSvc.sensorStats
+
+	cartoSvc.lidarRejectionDiagnostic = &sensorprocess.RejectionDiagnostic{NumRejections: lidarRejectionsToDiagnose}
+	spConfig.RejectionDiagnostic = cartoSvc.lidarRejectionDiagnostic
+
+	spConfig.PosePublisher = &cartoSvc.poseSubscriptions
+	spConfig.ChangeDetector = cartoSvc.changeDetector
+	spConfig.MapOverlap = cartoSvc.mapOverlap
+	spConfig.MaxSensorSkew = cartoSvc.maxSensorSkew
+	spConfig.ConvertUnsupportedPCD = cartoSvc.convertUnsupportedPCD
+
+	if spConfig.IsOnline {
+		spConfig.LidarResolver = cartoSvc.lidarResolver
+		spConfig.LidarReconnectFailures = lidarReconnectFailures
+		spConfig.LastLidarReadingTime = &atomic.Int64{}
+		spConfig.LidarBufferSize = cartoSvc.lidarBufferSize
+		spConfig.MovementSensorBufferSize = cartoSvc.movementSensorBufferSize
+	} else {
+		cartoSvc.jobSummary = &sensorprocess.JobSummary{
+			SkipFinalOptimization:       cartoSvc.skipFinalOptimization,
+			FinalOptimizationIterations: cartoSvc.finalOptimizationIterations,
+			ExpectedLidarReadings:       cartoSvc.expectedTotal,
+		}
+		spConfig.JobSummary = cartoSvc.jobSummary
+		spConfig.RunFinalOptimizationOnCancel = cartoSvc.runFinalOptimizationOnCancel
+		spConfig.MaxJobDuration = cartoSvc.maxJobDuration
+		spConfig.SkipFinalOptimization = cartoSvc.skipFinalOptimization
+		spConfig.MaxConsecutiveLidarFailures = cartoSvc.maxConsecutiveLidarFailures
+		spConfig.MaxRejectedReadingRetries = cartoSvc.maxRejectedReadingRetries
+		spConfig.AllowMixedClockDomains = cartoSvc.allowMixedClockDomains
+		spConfig.AdditionalLidarReadingTimeout = additionalLidarReadingTimeout
+	}
+	cartoSvc.sessionStats = newSessionStats(time.Now(), cartoSvc.maxSpeedMmPerSec)
+	return spConfig
+}
+
+// runSensorProcesses starts the sensor processes of spConfig, the mirror of their readings to the shadow cartofacade,
+// if any, and the monitors of what they add to cartographer.
+func runSensorProcesses(cancelCtx context.Context, cartoSvc *CartographerService, spConfig sensorprocess.Config) {
+	if spConfig.ShadowMirror != nil {
+		cartoSvc.goWorker("shadow_mirror", func(w *worker) {
+			spConfig.ShadowMirror.Run(cancelCtx, w.heartbeat)
+		})
+	}
 	if spConfig.IsOnline {
-		// online mode is parallelized
-		cartoSvc.sensorProcessWorkers.Add(1)
-		go func() {
-			defer cartoSvc.sensorProcessWorkers.Done()
-			spConfig.StartLidar(cancelCtx)
-		}()
+		// online mode is parallelized, with a worker per lidar. Every worker gets its own copy of the config to
+		// report its heartbeat on
+		for _, lidarConfig := range spConfig.LidarConfigs() {
+			lidarConfig := *lidarConfig
+			cartoSvc.goWorker("lidar_sensor_process:"+lidarConfig.Lidar.Name(), func(w *worker) {
+				lidarConfig.Heartbeat = w.heartbeat
+				lidarConfig.StartLidar(cancelCtx)
+			})
+		}
 
 		if spConfig.MovementSensor != nil {
-			cartoSvc.sensorProcessWorkers.Add(1)
-			go func() {
-				defer cartoSvc.sensorProcessWorkers.Done()
-				spConfig.StartMovementSensor(cancelCtx)
-			}()
+			movementSensorConfig := spConfig
+			cartoSvc.goWorker("movement_sensor_process:"+spConfig.MovementSensor.Name(), func(w *worker) {
+				movementSensorConfig.Heartbeat = w.heartbeat
+				movementSensorConfig.StartMovementSensor(cancelCtx)
+			})
 		}
 	} else {
 		// offline mode is sequential
-		cartoSvc.sensorProcessWorkers.Add(1)
-		go func() {
-			defer cartoSvc.sensorProcessWorkers.Done()
-			if jobDone := spConfig.StartOfflineSensorProcess(cancelCtx); jobDone {
+		offlineConfig := spConfig
+		cartoSvc.goWorker("offline_sensor_process", func(w *worker) {
+			offlineConfig.Heartbeat = w.heartbeat
+			result := offlineConfig.StartOfflineSensorProcess(cancelCtx)
+			cartoSvc.jobResult.Store(&result)
+			if result.JobDone {
 				cartoSvc.jobDone.Store(true)
 				cartoSvc.cancelSensorProcessFunc()
+				cartoSvc.writeMetricsCSVOnCompletion(context.WithoutCancel(cancelCtx), result.CompletedAt)
+			}
+		})
+	}
+
+	startSlamStatsMonitor(cancelCtx, cartoSvc, spConfig.IsOnline)
+	startSessionStatsMonitor(cancelCtx, cartoSvc)
+	cartoSvc.resetMapGrowthMonitor(cancelCtx, cartoSvc.SlamMode)
+	startMapRevisionTracker(cancelCtx, cartoSvc)
+	if cartoSvc.internalStateSaveDir != "" {
+		startAutosave(cancelCtx, cartoSvc)
+	}
+}
+
+// startSlamStatsMonitor polls the slam stats from cartographer every slamStatsPollInterval until ctx is done. In
+// online mode it warns once the optimization of the pose graph lags behind the lidar readings by more than
+// max_unoptimized_node_age_sec, while offline there is no time constraint for the optimization to keep up with.
+// It also checks whether the readings of the movement sensor are being accepted.
+func startSlamStatsMonitor(ctx context.Context, cartoSvc *CartographerService, isOnline bool) {
+	cartoSvc.goWorker("slam_stats_monitor", func(w *worker) {
+		ticker := time.NewTicker(slamStatsPollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
 			}
-		}()
+			w.heartbeat()
+			cartoSvc.checkMovementSensorUsage()
+			if cartoSvc.cartofacade.Unresponsive() {
+				// the request would wait on the hung call
+				continue
+			}
+			stats, err := cartoSvc.cartofacade.SlamStats(ctx, cartoSvc.cartoFacadeTimeout)
+			if err != nil {
+				cartoSvc.logger.Debugw("could not get slam stats", "error", err)
+				continue
+			}
+			cartoSvc.handleSlamStats(stats, isOnline)
+		}
+	})
+}
+
+// handleSlamStats records the slam stats for the sensor_metrics response and, if warn is set, warns when the oldest
+// node not yet covered by an optimization pass exceeds the max unoptimized node age. It is only called by the slam
+// stats monitor.
+func (cartoSvc *CartographerService) handleSlamStats(stats cartofacade.SlamStats, warn bool) {
+	cartoSvc.slamStats.Store(&stats)
+	if !warn {
+		return
+	}
+	if stats.OldestUnoptimizedNodeAge <= cartoSvc.maxUnoptimizedNodeAge {
+		if cartoSvc.unoptimizedNodeAgeExceeded {
+			cartoSvc.logger.Infow("the optimization of cartographer's pose graph caught up with the lidar readings",
+				"oldest_unoptimized_node_age", stats.OldestUnoptimizedNodeAge)
+		}
+		cartoSvc.unoptimizedNodeAgeExceeded = false
+		return
+	}
+	if !cartoSvc.unoptimizedNodeAgeExceeded {
+		cartoSvc.logger.Warnw("the optimization of cartographer's pose graph is falling behind the lidar readings, "+
+			"the map may degrade. Consider tuning optimize_every_n_nodes or lowering the lidar data_frequency_hz",
+			"oldest_unoptimized_node_age", stats.OldestUnoptimizedNodeAge,
+			"num_unoptimized_nodes", stats.NumUnoptimizedNodes,
+			"max_unoptimized_node_age", cartoSvc.maxUnoptimizedNodeAge)
 	}
+	cartoSvc.unoptimizedNodeAgeExceeded = true
 }
 
 // New returns a new slam service for the given robot.
@@ -183,7 +554,7 @@ func New(
 	cartoFacadeInternalTimeout time.Duration,
 	testTimedLidarOverride s.TimedLidar,
 	testTimedMovementSensorOverride s.TimedMovementSensor,
-) (slam.Service, error) {
+) (_ slam.Service, err error) {
 	ctx, span := trace.StartSpan(ctx, "viamcartographer::slamService::New")
 	defer span.End()
 
@@ -202,6 +573,16 @@ func New(
 			c.Model.Name, svcConfig.ConfigParams["mode"])
 	}
 
+	var calibrationFileChecksum string
+	if svcConfig.CalibrationFile != "" {
+		var calibration *vcConfig.Calibration
+		if calibration, calibrationFileChecksum, err = vcConfig.LoadCalibration(svcConfig.CalibrationFile); err != nil {
+			return nil, err
+		}
+		svcConfig = svcConfig.WithCalibration(calibration)
+		logger.Infow("loaded calibration_file", "path", svcConfig.CalibrationFile, "sha256", calibrationFileChecksum)
+	}
+
 	optionalConfigParams, err := vcConfig.GetOptionalParameters(
 		svcConfig,
 		defaultLidarDataFrequencyHz,
@@ -212,11 +593,21 @@ func New(
 		return nil, err
 	}
 
-	// Get the lidar for the Dim2D cartographer sub algorithm
+	recentErrorsBufferSize := defaultRecentErrorsBufferSize
+	if optionalConfigParams.RecentErrorsBufferSize != 0 {
+		recentErrorsBufferSize = optionalConfigParams.RecentErrorsBufferSize
+	}
+	recentErrors := newRecentErrors(recentErrorsBufferSize)
+	logger = newRecentErrorsLogger(logger, recentErrors)
+
+	// Get the lidar for the Dim2D cartographer sub algorithm, the override lidar for testing is used as is
 	lidarName := svcConfig.Camera["name"]
-	timedLidar, err := s.NewLidar(ctx, deps, lidarName, optionalConfigParams.LidarDataFrequencyHz, logger)
-	if err != nil {
-		return nil, err
+	timedLidar := testTimedLidarOverride
+	if timedLidar == nil {
+		timedLidar, err = s.NewLidar(ctx, deps, lidarName, optionalConfigParams.LidarDataFrequencyHz, logger)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	// Get the movement sensor if one is configured and check if it supports an IMU and/or odometer.
@@ -233,40 +624,97 @@ func New(
 			return nil, errors.New("In online mode, but movement sensor data frequency is zero")
 		}
 
-		if timedMovementSensor, err = s.NewMovementSensor(ctx, deps, movementSensorName,
-			optionalConfigParams.MovementSensorDataFrequencyHz, logger); err != nil {
+		newMovementSensor := s.NewMovementSensor
+		switch {
+		case optionalConfigParams.MovementSensorHeadingOnly:
+			newMovementSensor = s.NewHeadingOnlyMovementSensor
+		case optionalConfigParams.MovementSensorVelocityOdometry:
+			newMovementSensor = s.NewVelocityOdometryMovementSensor
+		}
+		if timedMovementSensor, err = newMovementSensor(ctx, deps, movementSensorName,
+			optionalConfigParams.MovementSensorDataFrequencyHz, optionalConfigParams.IMUAngularVelocityUnits, logger); err != nil {
+			return nil, err
+		}
+	}
+
+	additionalLidars, err := newAdditionalLidars(ctx, deps, optionalConfigParams.AdditionalLidars, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	// Override the movement sensor for testing if the override movement sensor is not nil
+	if testTimedMovementSensorOverride != nil {
+		timedMovementSensor = testTimedMovementSensorOverride
+	}
+
+	// readings of different clock domains cannot be ordered, the first readings are kept for the sensor processes
+	timedLidar, timedMovementSensor, err = s.CheckClockDomains(ctx, timedLidar, timedMovementSensor)
+	if err != nil {
+		if !optionalConfigParams.AllowMixedClockDomains {
+			return nil, fmt.Errorf("%w, set allow_mixed_clock_domains to combine them anyway", err)
+		}
+		logger.Warnw("combining sensors of different clock domains as allow_mixed_clock_domains is set", "error", err)
+	}
+
+	var lidarExtrinsics spatialmath.Pose
+	if optionalConfigParams.LidarExtrinsics != nil {
+		lidarExtrinsics = optionalConfigParams.LidarExtrinsics.Pose()
+	}
+	// the readings are recorded as they are read, so that replaying the recording adds the same readings
+	if optionalConfigParams.RecordDatasetDir != "" {
+		if timedLidar, err = s.NewRecordingLidar(timedLidar, optionalConfigParams.RecordDatasetDir,
+			optionalConfigParams.RecordDatasetCompressionLevel, logger); err != nil {
 			return nil, err
 		}
 	}
+	// points are filtered in the frame of the lidar, before they are transformed into the frame of the base
+	timedLidar = s.NewFilteringLidar(timedLidar, optionalConfigParams.LidarPointFilter)
+	timedLidar = s.NewCalibratedLidar(timedLidar, lidarExtrinsics,
+		time.Duration(optionalConfigParams.LidarTimeOffsetMs)*time.Millisecond)
+	if timedMovementSensor != nil {
+		var imuOrientation spatialmath.Orientation
+		if optionalConfigParams.IMUOrientation != nil {
+			imuOrientation = optionalConfigParams.IMUOrientation.Orientation()
+		}
+		timedMovementSensor = s.NewCalibratedMovementSensor(timedMovementSensor, imuOrientation,
+			time.Duration(optionalConfigParams.MovementSensorTimeOffsetMs)*time.Millisecond)
+	}
 
 	// Need to be able to shut down the sensor process before the cartoFacade
 	cancelSensorProcessCtx, cancelSensorProcessFunc := context.WithCancel(context.Background())
 	cancelCartoFacadeCtx, cancelCartoFacadeFunc := context.WithCancel(context.Background())
 
-	// Override the sensors for testing if the override sensors are not nil
-	if testTimedLidarOverride != nil {
-		timedLidar = testTimedLidarOverride
-	}
-	if testTimedMovementSensorOverride != nil {
-		timedMovementSensor = testTimedMovementSensorOverride
+	lidarResolver := ParentResourceResolver
+	if lidarResolver == nil {
+		lidarResolver = s.DependenciesResolver(deps)
 	}
 
 	// Cartographer SLAM Service Object
 	cartoSvc := &CartographerService{
 		Named:                      c.ResourceName().AsNamed(),
 		lidar:                      timedLidar,
+		additionalLidars:           additionalLidars,
+		lidarResolver:              lidarResolver,
 		movementSensor:             timedMovementSensor,
 		subAlgo:                    subAlgo,
 		configParams:               svcConfig.ConfigParams,
 		cancelSensorProcessFunc:    cancelSensorProcessFunc,
 		cancelCartoFacadeFunc:      cancelCartoFacadeFunc,
+		cartoLib:                   &cartoLib,
 		logger:                     logger,
+		recentErrors:               recentErrors,
 		cartoFacadeTimeout:         cartoFacadeTimeout,
 		cartoFacadeInternalTimeout: cartoFacadeInternalTimeout,
 		enableMapping:              optionalConfigParams.EnableMapping,
 		existingMap:                optionalConfigParams.ExistingMap,
+		minPointsPerScan:           optionalConfigParams.MinPointsPerScan,
+		shadowConfigParams:         svcConfig.ShadowConfig,
+		calibrationFile:            svcConfig.CalibrationFile,
+		calibrationFileChecksum:    calibrationFileChecksum,
 	}
 
+	// err is the named result, so that shadowed errors also close the service, which cancels and waits for every
+	// goroutine started so far
 	defer func() {
 		if err != nil {
 			logger.Errorw("New() hit error, closing...", "error", err)
@@ -276,6 +724,145 @@ func New(
 		}
 	}()
 
+	cartoSvc.internalStateExportDirs = optionalConfigParams.InternalStateExportDirs
+
+	if optionalConfigParams.WarmStartDir != "" {
+		cartoSvc.warmStartDir = optionalConfigParams.WarmStartDir
+		cartoSvc.warmStartRetention = defaultWarmStartRetention
+		if optionalConfigParams.WarmStartRetention != 0 {
+			cartoSvc.warmStartRetention = optionalConfigParams.WarmStartRetention
+		}
+		if cartoSvc.existingMap, err = latestWarmStartMap(cartoSvc.warmStartDir, logger); err != nil {
+			return nil, err
+		}
+	}
+
+	if optionalConfigParams.InternalStateSaveDir != "" {
+		cartoSvc.internalStateSaveDir = optionalConfigParams.InternalStateSaveDir
+		cartoSvc.internalStateSaveInterval = time.Duration(optionalConfigParams.InternalStateSaveIntervalSec) * time.Second
+		cartoSvc.internalStateSaveRetention = defaultInternalStateSaveRetention
+		if optionalConfigParams.InternalStateSaveRetention != 0 {
+			cartoSvc.internalStateSaveRetention = optionalConfigParams.InternalStateSaveRetention
+		}
+		if err = createInternalStateSaveDir(cartoSvc.internalStateSaveDir); err != nil {
+			return nil, err
+		}
+	}
+	cartoSvc.configHashInput = newConfigHashInput(svcConfig, optionalConfigParams, calibrationFileChecksum)
+
+	cartoSvc.hangThreshold = defaultHangThreshold
+	if optionalConfigParams.HangThresholdSec != 0 {
+		cartoSvc.hangThreshold = time.Duration(optionalConfigParams.HangThresholdSec) * time.Second
+	}
+	if optionalConfigParams.RestartOnHang {
+		// a call into C can not be interrupted, so the module exits and is restarted by the viam server
+		cartoSvc.restartOnHang = func() { os.Exit(1) }
+	}
+
+	cartoSvc.runFinalOptimizationOnCancel = optionalConfigParams.RunFinalOptimizationOnCancel
+	cartoSvc.optimizeOnClose = optionalConfigParams.OptimizeOnClose
+	if cartoSvc.optimizeOnClose && timedLidar.DataFrequencyHz() == 0 {
+		logger.Info("optimize_on_close is ignored in offline mode, which runs the final optimization once it " +
+			"reaches the end of the dataset")
+		cartoSvc.optimizeOnClose = false
+	}
+	cartoSvc.optimizeOnStartAsync = optionalConfigParams.OptimizeOnStartAsync
+	cartoSvc.skipFinalOptimization = optionalConfigParams.SkipFinalOptimization
+	cartoSvc.finalOptimizationIterations = optionalConfigParams.FinalOptimizationIterations
+	cartoSvc.maxActiveTrajectories = optionalConfigParams.MaxActiveTrajectories
+	cartoSvc.freezeOldestOnLimit = optionalConfigParams.FreezeOldestOnLimit
+	cartoSvc.expectedTotal = optionalConfigParams.ExpectedTotal
+	cartoSvc.maxJobDuration = time.Duration(optionalConfigParams.MaxJobDurationSec) * time.Second
+	cartoSvc.allowMixedClockDomains = optionalConfigParams.AllowMixedClockDomains
+	cartoSvc.maxSensorSkew = time.Duration(optionalConfigParams.MaxSensorSkewMs) * time.Millisecond
+	cartoSvc.lidarBufferSize = optionalConfigParams.LidarBufferSize
+	cartoSvc.movementSensorBufferSize = optionalConfigParams.MovementSensorBufferSize
+	cartoSvc.convertUnsupportedPCD = optionalConfigParams.ConvertUnsupportedPCD
+
+	cartoSvc.maxConsecutiveLidarFailures = defaultMaxConsecutiveLidarFailures
+	if optionalConfigParams.MaxConsecutiveLidarFailures != 0 {
+		cartoSvc.maxConsecutiveLidarFailures = optionalConfigParams.MaxConsecutiveLidarFailures
+	}
+
+	cartoSvc.maxRejectedReadingRetries = defaultMaxRejectedReadingRetries
+	if optionalConfigParams.HasMaxRejectedReadingRetries {
+		cartoSvc.maxRejectedReadingRetries = optionalConfigParams.MaxRejectedReadingRetries
+	}
+
+	cartoSvc.maxPostprocessingTasks = defaultMaxPostprocessingTasks
+	if optionalConfigParams.MaxPostprocessingTasks != 0 {
+		cartoSvc.maxPostprocessingTasks = optionalConfigParams.MaxPostprocessingTasks
+	}
+
+	cartoSvc.maxSpeedMmPerSec = defaultMaxSpeedMmPerSec
+	if optionalConfigParams.MaxSpeedMmPerSec != 0 {
+		cartoSvc.maxSpeedMmPerSec = float64(optionalConfigParams.MaxSpeedMmPerSec)
+	}
+
+	cartoSvc.mapStallLidarReadings = defaultMapStallLidarReadings
+	if optionalConfigParams.MapStallLidarReadings != 0 {
+		cartoSvc.mapStallLidarReadings = int64(optionalConfigParams.MapStallLidarReadings)
+	}
+
+	cartoSvc.localizationHealth.timeout = defaultLocalizationLostTimeout
+	if optionalConfigParams.LocalizationLostTimeoutSec != 0 {
+		cartoSvc.localizationHealth.timeout = time.Duration(optionalConfigParams.LocalizationLostTimeoutSec) * time.Second
+	}
+	cartoSvc.localizationHealth.minConfidence = defaultLocalizationMinConfidence
+	if optionalConfigParams.LocalizationMinConfidencePercent != 0 {
+		cartoSvc.localizationHealth.minConfidence = float64(optionalConfigParams.LocalizationMinConfidencePercent) / 100
+	}
+	cartoSvc.positionErrorOnLocalizationLost = optionalConfigParams.PositionErrorOnLocalizationLost
+
+	cartoSvc.maxInitAttempts = defaultMaxInitAttempts
+	if optionalConfigParams.MaxInitAttempts != 0 {
+		cartoSvc.maxInitAttempts = optionalConfigParams.MaxInitAttempts
+	}
+	retryableInitErrors := defaultRetryableInitErrors
+	if len(optionalConfigParams.RetryableInitErrors) > 0 {
+		retryableInitErrors = optionalConfigParams.RetryableInitErrors
+	}
+	cartoSvc.retryableInitErrors = map[string]bool{}
+	for _, code := range retryableInitErrors {
+		cartoSvc.retryableInitErrors[code] = true
+	}
+	cartoSvc.initRetryBackoff = initRetryBaseBackoff
+
+	cartoSvc.maxUnoptimizedNodeAge = defaultMaxUnoptimizedNodeAge
+	if optionalConfigParams.MaxUnoptimizedNodeAgeSec != 0 {
+		cartoSvc.maxUnoptimizedNodeAge = time.Duration(optionalConfigParams.MaxUnoptimizedNodeAgeSec) * time.Second
+	}
+
+	cartoSvc.maxIngestionLatency = defaultMaxIngestionLatency
+	if optionalConfigParams.MaxIngestionLatencyMs != 0 {
+		cartoSvc.maxIngestionLatency = time.Duration(optionalConfigParams.MaxIngestionLatencyMs) * time.Millisecond
+	}
+
+	cartoSvc.maxDutyCyclePercent = defaultMaxDutyCyclePercent
+	if optionalConfigParams.MaxDutyCyclePercent != 0 {
+		cartoSvc.maxDutyCyclePercent = float64(optionalConfigParams.MaxDutyCyclePercent)
+	}
+
+	if optionalConfigParams.RebaseTimestamps {
+		cartoSvc.sessionClock = &sensorprocess.SessionClock{}
+	}
+
+	if optionalConfigParams.ChangeDetection {
+		cartoSvc.changeDetector = &sensorprocess.ChangeDetector{Resolution: changeDetectionResolution}
+	}
+
+	if cartoSvc.enableMapping && cartoSvc.existingMap != "" {
+		cartoSvc.mapOverlap = &sensorprocess.MapOverlap{Resolution: mapOverlapResolution, Window: mapOverlapWindow}
+	}
+
+	if svcConfig.MappingBounds != nil {
+		mappingBounds, err := toMappingBounds(svcConfig.MappingBounds)
+		if err != nil {
+			return nil, err
+		}
+		cartoSvc.mappingBounds.Store(mappingBounds)
+	}
+
 	// if we have an existing map, check if there is an edited map within the package
 	if cartoSvc.existingMap != "" {
 		packageDir := filepath.Dir(svcConfig.ExistingMap)
@@ -292,290 +879,1190 @@ func New(
 
 	// do not initialize CartoFacade or Sensor Processes when using cloudslam
 	if svcConfig.UseCloudSlam != nil && *svcConfig.UseCloudSlam {
+		ignoredFields := svcConfig.CloudSlamIgnoredFields()
+		if len(ignoredFields) > 0 {
+			logger.Warnw("use_cloud_slam is set, so mapping runs in the cloud and the following fields of the config "+
+				"are ignored by this slam service: "+strings.Join(ignoredFields, ", "),
+				"ignored_fields", ignoredFields)
+		}
+		cancelSensorProcessFunc()
+		cancelCartoFacadeFunc()
 		return &CartographerService{
-			Named:          c.ResourceName().AsNamed(),
-			useCloudSlam:   true,
-			logger:         logger,
-			lidar:          timedLidar,
-			movementSensor: timedMovementSensor,
-			enableMapping:  optionalConfigParams.EnableMapping,
-			existingMap:    optionalConfigParams.ExistingMap,
+			Named:                  c.ResourceName().AsNamed(),
+			useCloudSlam:           true,
+			logger:                 logger,
+			lidar:                  timedLidar,
+			additionalLidars:       additionalLidars,
+			movementSensor:         timedMovementSensor,
+			enableMapping:          optionalConfigParams.EnableMapping,
+			existingMap:            optionalConfigParams.ExistingMap,
+			cloudSlamIgnoredFields: ignoredFields,
 		}, nil
 	}
 
+	if cartoSvc.existingMap != "" {
+		requestedMap := cartoSvc.existingMap
+		var resolvedMap string
+		if resolvedMap, cartoSvc.existingMap, err = cartoSvc.prepareExistingMap(
+			requestedMap,
+			optionalConfigParams.FallbackToPreviousInternalState,
+		); err != nil {
+			return nil, err
+		}
+		if resolvedMap != requestedMap {
+			cartoSvc.constructionWarnings.add(WarningExistingMapFallback, fmt.Sprintf(
+				"existing_map %s is truncated, the previous intact internal state %s is loaded instead",
+				requestedMap, resolvedMap))
+		}
+		if cartoSvc.existingMap != resolvedMap {
+			cartoSvc.constructionWarnings.add(WarningInternalStateMigrated, fmt.Sprintf(
+				"existing_map %s has an older internal state version, the migrated copy %s is loaded instead",
+				resolvedMap, cartoSvc.existingMap))
+		}
+	}
+
+	if optionalConfigParams.FloorPlan != nil {
+		if cartoSvc.floorPlan, err = loadFloorPlan(optionalConfigParams.FloorPlan, logger); err != nil {
+			return nil, err
+		}
+	}
+
 	if err = initCartoFacade(cancelCartoFacadeCtx, cartoSvc); err != nil {
 		return nil, err
 	}
+	cartoSvc.enforceTrajectoryLimit(cancelCartoFacadeCtx)
+
+	cameraClaims.claim(cartoSvc, camera.Named(lidarName))
+	for _, additionalLidar := range optionalConfigParams.AdditionalLidars {
+		cameraClaims.claim(cartoSvc, camera.Named(additionalLidar.Name))
+	}
 
-	initSensorProcesses(cancelSensorProcessCtx, cartoSvc)
+	startSensorProcessWorkers(cancelSensorProcessCtx, cartoSvc)
 
+	cartoSvcs.Store(cartoSvc.Name().Name, cartoSvc)
 	return cartoSvc, nil
 }
 
-// Checks if val is empty, and parses the float32 if there is a value.
-func parseFloat32OrDefault(val string, defaultVal float32) (float32, error) {
-	if val == "" {
-		return defaultVal, nil
+// startSensorProcessWorkers starts the sensor processes along with the workers that work on the map cartographer
+// has loaded once it is available.
+func startSensorProcessWorkers(ctx context.Context, cartoSvc *CartographerService) {
+	startSensorProcesses(ctx, cartoSvc)
+
+	if cartoSvc.editedMap != nil {
+		startEditedMapConsistencyCheck(ctx, cartoSvc)
 	}
-	fVal, err := strconv.ParseFloat(val, 32)
-	if err != nil {
-		return 0, err
+
+	if cartoSvc.changeDetector != nil {
+		onPointCloudMapAvailable(ctx, cartoSvc, "change_detection_map_loader", cartoSvc.loadChangeDetectionMap)
 	}
-	return float32(fVal), nil
-}
 
-// Checks if val is empty, and parses the float64 if there is a value.
-func parseFloat64OrDefault(val string, defaultVal float64) (float64, error) {
-	if val == "" {
-		return defaultVal, nil
+	if cartoSvc.mapOverlap != nil {
+		onPointCloudMapAvailable(ctx, cartoSvc, "map_overlap_map_loader", cartoSvc.loadMapOverlapMap)
 	}
-	return strconv.ParseFloat(val, 64)
 }
 
-// Checks if val is empty, and parses the Int if there is a value.
-func parseIntOrDefault(val string, defaultVal int) (int, error) {
-	if val == "" {
-		return defaultVal, nil
-	}
-	return strconv.Atoi(val)
+// startEditedMapConsistencyCheck compares the edited map with cartographer's map in the background once the latter
+// is available, so that the check does not delay startup.
+func startEditedMapConsistencyCheck(ctx context.Context, cartoSvc *CartographerService) {
+	onPointCloudMapAvailable(ctx, cartoSvc, "edited_map_consistency_check", cartoSvc.checkEditedMapConsistency)
 }
 
-func parseCartoAlgoConfig(configParams map[string]string, logger logging.Logger) (cartofacade.CartoAlgoConfig, error) {
-	cartoAlgoCfg := defaultCartoAlgoCfg
-	var err error
-	for k, val := range configParams {
-		switch k {
-		case "optimize_on_start":
-			if val == "true" {
-				cartoAlgoCfg.OptimizeOnStart = true
-			}
-		case "optimize_every_n_nodes":
-			cartoAlgoCfg.OptimizeEveryNNodes, err = parseIntOrDefault(val, defaultCartoAlgoCfg.OptimizeEveryNNodes)
-			if err != nil {
-				return cartoAlgoCfg, err
-			}
-		case "num_range_data":
-			cartoAlgoCfg.NumRangeData, err = parseIntOrDefault(val, defaultCartoAlgoCfg.NumRangeData)
-			if err != nil {
-				return cartoAlgoCfg, err
-			}
-		case "missing_data_ray_length_meters":
-			cartoAlgoCfg.MissingDataRayLength, err = parseFloat32OrDefault(val, defaultCartoAlgoCfg.MissingDataRayLength)
-			if err != nil {
-				return cartoAlgoCfg, err
-			}
-		case "missing_data_ray_length":
-			cartoAlgoCfg.MissingDataRayLength, err = parseFloat32OrDefault(val, defaultCartoAlgoCfg.MissingDataRayLength)
-			if err != nil {
-				return cartoAlgoCfg, err
-			}
-		case "max_range":
-			cartoAlgoCfg.MaxRange, err = parseFloat32OrDefault(val, defaultCartoAlgoCfg.MaxRange)
-			if err != nil {
-				return cartoAlgoCfg, err
-			}
-		case "max_range_meters":
-			cartoAlgoCfg.MaxRange, err = parseFloat32OrDefault(val, defaultCartoAlgoCfg.MaxRange)
-			if err != nil {
-				return cartoAlgoCfg, err
-			}
-		case "min_range":
-			cartoAlgoCfg.MinRange, err = parseFloat32OrDefault(val, defaultCartoAlgoCfg.MinRange)
-			if err != nil {
-				return cartoAlgoCfg, err
-			}
-		case "min_range_meters":
-			cartoAlgoCfg.MinRange, err = parseFloat32OrDefault(val, defaultCartoAlgoCfg.MinRange)
-			if err != nil {
-				return cartoAlgoCfg, err
-			}
-		case "max_submaps_to_keep":
-			cartoAlgoCfg.MaxSubmapsToKeep, err = parseIntOrDefault(val, defaultCartoAlgoCfg.MaxSubmapsToKeep)
-			if err != nil {
-				return cartoAlgoCfg, err
-			}
-		case "fresh_submaps_count":
-			cartoAlgoCfg.FreshSubmapsCount, err = parseIntOrDefault(val, defaultCartoAlgoCfg.FreshSubmapsCount)
-			if err != nil {
-				return cartoAlgoCfg, err
-			}
-		case "min_covered_area":
-			cartoAlgoCfg.MinCoveredArea, err = parseFloat64OrDefault(val, defaultCartoAlgoCfg.MinCoveredArea)
-			if err != nil {
-				return cartoAlgoCfg, err
-			}
-		case "min_covered_area_meters_squared":
-			cartoAlgoCfg.MinCoveredArea, err = parseFloat64OrDefault(val, defaultCartoAlgoCfg.MinCoveredArea)
-			if err != nil {
-				return cartoAlgoCfg, err
-			}
-		case "min_added_submaps_count":
-			cartoAlgoCfg.MinAddedSubmapsCount, err = parseIntOrDefault(val, defaultCartoAlgoCfg.MinAddedSubmapsCount)
-			if err != nil {
-				return cartoAlgoCfg, err
-			}
-		case "occupied_space_weight":
-			cartoAlgoCfg.OccupiedSpaceWeight, err = parseFloat64OrDefault(val, defaultCartoAlgoCfg.OccupiedSpaceWeight)
-			if err != nil {
-				return cartoAlgoCfg, err
-			}
-		case "translation_weight":
-			cartoAlgoCfg.TranslationWeight, err = parseFloat64OrDefault(val, defaultCartoAlgoCfg.TranslationWeight)
-			if err != nil {
-				return cartoAlgoCfg, err
+// onPointCloudMapAvailable calls f with cartographer's map in the background, as a worker of the given name, once
+// it is available, so that work on the map does not delay startup.
+func onPointCloudMapAvailable(
+	ctx context.Context, cartoSvc *CartographerService, name string, f func(currentMap []byte),
+) {
+	cartoSvc.goWorker(name, func(w *worker) {
+		for {
+			w.heartbeat()
+			currentMap, err := cartoSvc.cartofacade.PointCloudMap(ctx, cartoSvc.cartoFacadeTimeout)
+			if err == nil && len(currentMap) > 0 {
+				f(currentMap)
+				return
 			}
-		case "rotation_weight":
-			cartoAlgoCfg.RotationWeight, err = parseFloat64OrDefault(val, defaultCartoAlgoCfg.RotationWeight)
-			if err != nil {
-				return cartoAlgoCfg, err
-			}
-		case "initial_starting_pose":
-			fVals := startPosRegex.FindStringSubmatch(val)
-			if len(fVals) > 0 {
-				fValX, err := strconv.ParseFloat(fVals[1], 64)
-				if err != nil {
-					return cartoAlgoCfg, err
-				}
-				fValY, err := strconv.ParseFloat(fVals[2], 64)
-				if err != nil {
-					return cartoAlgoCfg, err
-				}
-				fValTheta, err := strconv.ParseFloat(fVals[3], 64)
-				if err != nil {
-					return cartoAlgoCfg, err
-				}
-
-				cartoAlgoCfg.HasInitialTrajectoryPose = true
-				cartoAlgoCfg.InitialTrajectoryPoseX = fValX
-				cartoAlgoCfg.InitialTrajectoryPoseY = fValY
-				cartoAlgoCfg.InitialTrajectoryPoseTheta = fValTheta
-			} else {
-				return cartoAlgoCfg, errors.Errorf("initial_starting_pose needs to be in format 'X:<val>, Y:<val>, Theta:<val>, but received %v", val)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(editedMapCheckInterval):
 			}
-			// ignore mode as it is a special case
-		case "mode":
-		default:
-			logger.Warnf("unused config param: %s: %s", k, val)
 		}
-	}
-	return cartoAlgoCfg, nil
+	})
 }
 
-// initCartoFacade
-// 1. creates a new initCartoFacade
-// 2. initializes it and starts it
-// 3. terminates it if start fails.
-func initCartoFacade(ctx context.Context, cartoSvc *CartographerService) error {
-	cartoAlgoConfig, err := parseCartoAlgoConfig(cartoSvc.configParams, cartoSvc.logger)
+// checkEditedMapConsistency sets the edited map inconsistent status flag and logs a warning if the edited map
+// diverges from cartographer's map.
+func (cartoSvc *CartographerService) checkEditedMapConsistency(currentMap []byte) {
+	consistency, err := postprocess.CheckMapConsistency(*cartoSvc.editedMap, currentMap)
 	if err != nil {
-		return err
+		cartoSvc.logger.Warnw("could not check whether the edited map matches the existing map", "error", err)
+		return
 	}
-
-	var movementSensorName string
-	if cartoSvc.movementSensor == nil {
-		cartoSvc.logger.Debug("No movement sensor provided, setting use_imu_data to false")
-	} else {
-		movementSensorName = cartoSvc.movementSensor.Name()
-		movementSensorProperties := cartoSvc.movementSensor.Properties()
-		if movementSensorProperties.IMUSupported {
-			cartoSvc.logger.Warn("IMU configured, setting use_imu_data to true")
-			cartoAlgoConfig.UseIMUData = true
-		} else {
-			cartoSvc.logger.Warn("Movement sensor was provided but does not support IMU data, setting use_imu_data to false")
-		}
-		if movementSensorProperties.OdometerSupported {
-			cartoSvc.logger.Debug("Odometer is supported")
-		}
+	if consistency.Consistent() {
+		cartoSvc.logger.Debugw("edited map matches the existing map",
+			"bounding_box_overlap", consistency.BoundingBoxOverlap,
+			"centroid_offset", consistency.CentroidOffset)
+		return
 	}
+	cartoSvc.editedMapInconsistent.Store(true)
+	cartoSvc.logger.Warnw("EDITED MAP DOES NOT MATCH THE EXISTING MAP: the "+editedMapName+" in the package of the "+
+		"existing map likely belongs to a different map, so the map that is displayed differs from the map that is "+
+		"localized against",
+		"existing_map", cartoSvc.existingMap,
+		"bounding_box_overlap", consistency.BoundingBoxOverlap,
+		"centroid_offset", consistency.CentroidOffset)
+}
 
-	cartoCfg := cartofacade.CartoConfig{
-		Camera:         cartoSvc.lidar.Name(),
-		MovementSensor: movementSensorName,
-		LidarConfig:    cartofacade.TwoD,
-		EnableMapping:  cartoSvc.enableMapping,
-		ExistingMap:    cartoSvc.existingMap,
+// loadChangeDetectionMap loads cartographer's map, i.e. the map that is localized against, into the change detector.
+func (cartoSvc *CartographerService) loadChangeDetectionMap(currentMap []byte) {
+	if err := cartoSvc.changeDetector.SetMap(currentMap); err != nil {
+		cartoSvc.logger.Warnw("could not load the existing map for change detection", "error", err)
 	}
+}
 
-	cf := cartofacade.New(&cartoLib, cartoCfg, cartoAlgoConfig)
-	slamMode, err := cf.Initialize(ctx, cartoSvc.cartoFacadeTimeout, &cartoSvc.cartoFacadeWorkers)
-	if err != nil {
-		cartoSvc.logger.Errorw("cartofacade initialize failed", "error", err)
-		return err
+// loadMapOverlapMap loads cartographer's map, which is the existing map as it has just been loaded, into the map
+// overlap estimate.
+func (cartoSvc *CartographerService) loadMapOverlapMap(currentMap []byte) {
+	if err := cartoSvc.mapOverlap.SetMap(currentMap); err != nil {
+		cartoSvc.logger.Warnw("could not load the existing map to estimate the overlap with it", "error", err)
 	}
+}
 
-	err = cf.Start(ctx, cartoSvc.cartoFacadeTimeout)
-	if err != nil {
-		cartoSvc.logger.Errorw("cartofacade start failed", "error", err)
-		termErr := cf.Terminate(ctx, cartoSvc.cartoFacadeTimeout)
-		if termErr != nil {
-			cartoSvc.logger.Errorw("cartofacade terminate failed", "error", termErr)
-			return termErr
-		}
-		return err
+// handleCartoFacadeHang logs a call into cartographer that has been in progress for longer than the hang threshold
+// and restarts the module if restart_on_hang is set.
+func (cartoSvc *CartographerService) handleCartoFacadeHang(callDuration time.Duration, stackDump []byte) {
+	cartoSvc.logger.Errorw("cartographer is unresponsive, a call into cartographer has not returned",
+		"call_duration", callDuration,
+		"hang_threshold", cartoSvc.hangThreshold,
+		"stack_dump", string(stackDump))
+	if cartoSvc.initialOptimizationInProgress.Load() {
+		cartoSvc.logger.Info("the call is expected to be the initial optimization of a large map, not restarting")
+		return
+	}
+	if cartoSvc.restartOnHang != nil {
+		cartoSvc.logger.Error("restarting the module as restart_on_hang is set")
+		cartoSvc.restartOnHang()
 	}
-
-	cartoSvc.cartofacade = &cf
-	cartoSvc.SlamMode = slamMode
-
-	return nil
 }
 
-func terminateCartoFacade(ctx context.Context, cartoSvc *CartographerService) error {
-	if cartoSvc.cartofacade == nil {
-		cartoSvc.logger.Debug("terminateCartoFacade called when cartoSvc.cartofacade is nil")
-		return nil
+// handleDutyCycle logs the duty cycle of the cartofacade worker of the last window and warns if it has been above the
+// max duty cycle for sustainedDutyCycleWindows windows in a row. It is only called by the duty cycle monitor.
+func (cartoSvc *CartographerService) handleDutyCycle(dutyCyclePercent float64) {
+	cartoSvc.logger.Debugw("cartographer duty cycle", "duty_cycle_percent", dutyCyclePercent)
+	if dutyCyclePercent <= cartoSvc.maxDutyCyclePercent {
+		cartoSvc.windowsAboveMaxDutyCycle = 0
+		return
 	}
+	cartoSvc.windowsAboveMaxDutyCycle++
+	if cartoSvc.windowsAboveMaxDutyCycle%sustainedDutyCycleWindows == 0 {
+		cartoSvc.logger.Warnw("cartographer is busy processing requests almost all of the time, readings may be "+
+			"processed late or skipped. Consider a lower camera[data_frequency_hz] or movement_sensor[data_frequency_hz]",
+			"duty_cycle_percent", dutyCyclePercent,
+			"max_duty_cycle_percent", cartoSvc.maxDutyCyclePercent,
+			"sustained_for", time.Duration(cartoSvc.windowsAboveMaxDutyCycle)*cartofacade.DutyCycleWindow)
+	}
+}
 
-	stopErr := cartoSvc.cartofacade.Stop(ctx, cartoSvc.cartoFacadeTimeout)
-	if stopErr != nil {
-		cartoSvc.logger.Errorw("cartofacade stop failed", "error", stopErr)
+// addSessionStartTime adds the wall clock time that corresponds to the session epoch to resp, if timestamps are
+// rebased and the session has started. Rebased times can be converted back to wall clock time by adding their
+// offset from sensorprocess.SessionEpoch to it.
+func (cartoSvc *CartographerService) addSessionStartTime(resp map[string]interface{}) {
+	if cartoSvc.sessionClock == nil {
+		return
 	}
+	if startTime, started := cartoSvc.sessionClock.StartTime(); started {
+		resp[SessionStartTimeKey] = startTime.UTC().Format(time.RFC3339Nano)
+	}
+}
 
-	err := cartoSvc.cartofacade.Terminate(ctx, cartoSvc.cartoFacadeTimeout)
+// toMappingBounds converts the mapping bounds config into the region lidar readings are clipped to.
+func toMappingBounds(boundsCfg *vcConfig.MappingBounds) (*s.MappingBounds, error) {
+	vertices, err := boundsCfg.Vertices()
 	if err != nil {
-		cartoSvc.logger.Errorw("cartofacade terminate failed", "error", err)
-		return err
+		return nil, err
 	}
-	return stopErr
+	return s.NewMappingBounds(vertices, boundsCfg.ClipPointCloudMap)
 }
 
-// CartographerService is the structure of the slam service.
-type CartographerService struct {
-	resource.Named
-	resource.AlwaysRebuild
-	mu             sync.Mutex
-	SlamMode       cartofacade.SlamMode
+// newAdditionalLidars returns the additional lidars of the config, read from deps. The points of each lidar are
+// filtered by its own point filter in its frame, like those of the main lidar, before they are transformed by its
+// extrinsics.
+func newAdditionalLidars(
+	ctx context.Context,
+	deps resource.Dependencies,
+	additionalLidarsCfg []vcConfig.AdditionalLidar,
+	logger logging.Logger,
+) ([]s.TimedLidar, error) {
+	var additionalLidars []s.TimedLidar
+	for _, additionalLidar := range additionalLidarsCfg {
+		timedAdditionalLidar, err := s.NewLidar(ctx, deps, additionalLidar.Name, additionalLidar.DataFrequencyHz, logger)
+		if err != nil {
+			return nil, err
+		}
+		var extrinsics spatialmath.Pose
+		if additionalLidar.Extrinsics != nil {
+			extrinsics = additionalLidar.Extrinsics.Pose()
+		}
+		timedAdditionalLidar = s.NewFilteringLidar(timedAdditionalLidar, additionalLidar.PointFilter)
+		additionalLidars = append(additionalLidars, s.NewCalibratedLidar(timedAdditionalLidar, extrinsics, 0))
+	}
+	return additionalLidars, nil
+}
+
+// toTrajectoryPose converts the value of the start_new_trajectory command into the initial pose of the new
+// trajectory. A nil value means the new trajectory has no initial pose.
+func toTrajectoryPose(val interface{}) (*cartofacade.TrajectoryPose, error) {
+	if val == nil {
+		return nil, nil
+	}
+	pose, err := decodeDoCommandArg[struct {
+		X     *float64 `json:"x"`
+		Y     *float64 `json:"y"`
+		Theta *float64 `json:"theta"`
+	}](val)
+	if err != nil {
+		return nil, errors.Wrap(ErrBadTrajectoryPoseFormat, err.Error())
+	}
+	if pose.X == nil || pose.Y == nil || pose.Theta == nil {
+		return nil, errors.Wrap(ErrBadTrajectoryPoseFormat, "x, y and theta are required")
+	}
+	return &cartofacade.TrajectoryPose{X: *pose.X, Y: *pose.Y, Theta: *pose.Theta}, nil
+}
+
+// trajectoriesToList converts trajectories into the format of the status response.
+func trajectoriesToList(trajectories []cartofacade.Trajectory) []interface{} {
+	list := make([]interface{}, 0, len(trajectories))
+	for _, trajectory := range trajectories {
+		list = append(list, map[string]interface{}{"id": trajectory.ID, "state": trajectory.State.String()})
+	}
+	return list
+}
+
+// slamStatsToMap converts slam stats into the format of the slam_stats response.
+func slamStatsToMap(stats cartofacade.SlamStats) map[string]interface{} {
+	return map[string]interface{}{
+		"num_nodes":                       stats.NumNodes,
+		"num_unoptimized_nodes":           stats.NumUnoptimizedNodes,
+		"oldest_unoptimized_node_age_sec": stats.OldestUnoptimizedNodeAge.Seconds(),
+	}
+}
+
+// positionToMap converts a position into the format of the shadow_position response.
+func positionToMap(pos cartofacade.Position) map[string]interface{} {
+	return map[string]interface{}{
+		"x":    pos.X,
+		"y":    pos.Y,
+		"z":    pos.Z,
+		"real": pos.Real,
+		"imag": pos.Imag,
+		"jmag": pos.Jmag,
+		"kmag": pos.Kmag,
+	}
+}
+
+// unitsToMap returns the declaration of the linear units of the service's outputs for the status and
+// shadow_map_info responses. Positions, including those of GetPosition, are in millimeters, as cartofacade
+// converts them from cartographer's meters. The pcds of the pointcloud map hold meters, as the pcd format
+// expects, which rdk's pointcloud package converts to and from millimeters when reading and writing them.
+func unitsToMap() map[string]interface{} {
+	return map[string]interface{}{
+		PositionUnitKey:      positionUnit,
+		PointCloudMapUnitKey: pointCloudMapUnit,
+	}
+}
+
+// getMapInfo returns the number of points of the pointcloud map and the trajectories of the cartofacade in the
+// format of the shadow_map_info response.
+func getMapInfo(ctx context.Context, cf cartofacade.Interface, timeout, internalTimeout time.Duration) (map[string]interface{}, error) {
+	numPoints, err := mapNumPoints(ctx, cf, internalTimeout)
+	if err != nil {
+		return nil, err
+	}
+	trajectories, err := cf.Trajectories(ctx, timeout)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"num_points":    numPoints,
+		TrajectoriesKey: trajectoriesToList(trajectories),
+	}, nil
+}
+
+// mapNumPoints returns the number of points of the pointcloud map of the cartofacade.
+func mapNumPoints(ctx context.Context, cf cartofacade.Interface, internalTimeout time.Duration) (int, error) {
+	pcd, err := cf.PointCloudMap(ctx, internalTimeout)
+	if err != nil {
+		return 0, err
+	}
+	pc, err := pointcloud.ReadPCD(bytes.NewReader(pcd))
+	if err != nil {
+		return 0, err
+	}
+	return pc.Size(), nil
+}
+
+// loadFloorPlan converts the occupancy grid image of the floor plan into the probability grid that cartographer
+// localizes against.
+func loadFloorPlan(floorPlanConfig *vcConfig.FloorPlan, logger logging.Logger) (*floorplan.FloorPlan, error) {
+	var originXMm, originYMm float64
+	if floorPlanConfig.Origin != nil {
+		originXMm, originYMm = floorPlanConfig.Origin.X, floorPlanConfig.Origin.Y
+	}
+	floorPlan, err := floorplan.Convert(floorPlanConfig.Image, floorPlanConfig.ResolutionMm, originXMm, originYMm)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to load floor_plan")
+	}
+	logger.Infow("localizing against floor plan",
+		"image", floorPlanConfig.Image,
+		"occupied_cells", floorPlan.Occupied,
+		"free_cells", floorPlan.Free,
+		"unknown_cells", floorPlan.Unknown)
+	return floorPlan, nil
+}
+
+// resolveExistingMap returns the internal state file that should be loaded for existingMap. An existingMap that
+// fails validation is never passed to cartographer, which aborts on some invalid internal states. A truncated one
+// (e.g. from an interrupted save) is replaced by the most recent intact internal state if
+// fallbackToPreviousInternalState is set. It is searched for in stateDir, the writable directory auto-saves land
+// in, if it is set, as well as next to existingMap, which may be a read-only deploy path. Any other validation
+// error, e.g. a missing file or one that is not an internal state, is returned.
+func resolveExistingMap(
+	existingMap, stateDir string,
+	fallbackToPreviousInternalState bool,
+	logger logging.Logger,
+) (string, error) {
+	validateErr := pbstream.Validate(existingMap)
+	if validateErr == nil {
+		return existingMap, nil
+	}
+	if !errors.Is(validateErr, pbstream.ErrTruncated) {
+		return "", errors.Wrap(validateErr, "existing_map is not a valid internal state")
+	}
+
+	searchDirs := []string{filepath.Dir(existingMap)}
+	if stateDir != "" {
+		searchDirs = append([]string{stateDir}, searchDirs...)
+	}
+	fallback, err := pbstream.FindPreviousIntact(existingMap, searchDirs...)
+	if err != nil {
+		return "", errors.Wrapf(validateErr, "failed to search for a previous internal state: %v", err)
+	}
+
+	switch {
+	case fallback == "":
+		logger.Errorw("existing_map is truncated and no previous intact internal state was found",
+			"existing_map", existingMap, "error", validateErr)
+		return "", validateErr
+	case !fallbackToPreviousInternalState:
+		logger.Errorw("existing_map is truncated, set fallback_to_previous_internal_state to load the previous intact internal state",
+			"existing_map", existingMap, "previous_internal_state", fallback, "error", validateErr)
+		return "", errors.Wrapf(validateErr, "previous intact internal state %s is available", fallback)
+	default:
+		logger.Warnw("existing_map is truncated, falling back to the previous intact internal state",
+			"existing_map", existingMap, "previous_internal_state", fallback, "error", validateErr)
+		return fallback, nil
+	}
+}
+
+// prepareExistingMap returns the internal state file existingMap resolves to, as resolveExistingMap determines it,
+// and the file cartographer should load for it, as migrateExistingMap determines it, so that cartographer is never
+// passed an internal state it cannot load.
+func (cartoSvc *CartographerService) prepareExistingMap(
+	existingMap string,
+	fallbackToPreviousInternalState bool,
+) (string, string, error) {
+	resolvedMap, err := resolveExistingMap(
+		existingMap,
+		cartoSvc.internalStateSaveDir,
+		fallbackToPreviousInternalState,
+		cartoSvc.logger,
+	)
+	if err != nil {
+		return "", "", err
+	}
+	migratedMap, err := migrateExistingMap(cartoSvc.cartoLib, resolvedMap, internalStateMigrationDir(), cartoSvc.logger)
+	if err != nil {
+		return "", "", err
+	}
+	return resolvedMap, migratedMap, nil
+}
+
+// internalStateMigrationDir returns the writable directory internal states are migrated into.
+func internalStateMigrationDir() string {
+	if dir := os.Getenv(moduleDataDirEnvVar); dir != "" {
+		return filepath.Join(dir, "migrated_internal_state")
+	}
+	return filepath.Join(os.TempDir(), "viam-cartographer", "migrated_internal_state")
+}
+
+// migrateExistingMap returns the internal state file that should be loaded for existingMap. If existingMap has a
+// different serialization format version than cartographer loads, it is migrated into migrationDir and the
+// migrated copy is returned; existingMap itself is never modified. Libraries which cannot probe the version of
+// internal states load existingMap as is.
+func migrateExistingMap(
+	lib cartofacade.CartoLibInterface,
+	existingMap, migrationDir string,
+	logger logging.Logger,
+) (string, error) {
+	version, err := lib.InternalStateVersion(existingMap)
+	if errors.Is(err, cartofacade.ErrInternalStateVersionUnavailable) {
+		logger.Debugw("the cartographer library cannot probe internal state versions, loading existing_map as is",
+			"existing_map", existingMap)
+		return existingMap, nil
+	}
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to probe the internal state version of existing_map %s", existingMap)
+	}
+	if version.Version == version.CurrentVersion {
+		return existingMap, nil
+	}
+
+	name := strings.TrimSuffix(filepath.Base(existingMap), filepath.Ext(existingMap))
+	migrated := filepath.Join(migrationDir, fmt.Sprintf("%s_v%d%s", name, version.CurrentVersion, internalStateFileType))
+	logger.Infow("existing_map has a different internal state version than cartographer loads, migrating it",
+		"existing_map", existingMap, "version", version.Version, "current_version", version.CurrentVersion,
+		"migrated_internal_state", migrated)
+	if err := os.MkdirAll(migrationDir, 0o750); err != nil {
+		return "", errors.Wrapf(err, "failed to create the directory to migrate existing_map %s into", existingMap)
+	}
+	if err := lib.MigrateInternalState(existingMap, migrated); err != nil {
+		//nolint:errcheck
+		os.Remove(migrated)
+		return "", errors.Wrapf(err, "existing_map %s has internal state version %d, which cannot be migrated to "+
+			"the current version %d", existingMap, version.Version, version.CurrentVersion)
+	}
+	logger.Infow("migrated existing_map, loading the migrated internal state",
+		"existing_map", existingMap, "migrated_internal_state", migrated)
+	return migrated, nil
+}
+
+// algoConfigParamParser parses the values of config_params. Rather than failing on the first invalid value, it
+// collects an error naming the param, the provided value and the expected values for each of them, so that all of
+// them can be fixed at once.
+type algoConfigParamParser struct {
+	err     error
+	invalid map[string]bool
+}
+
+// fail records that the value val of the param key is not one of the expected values.
+func (parser *algoConfigParamParser) fail(key, val, expected string) {
+	if parser.invalid == nil {
+		parser.invalid = map[string]bool{}
+	}
+	parser.invalid[key] = true
+	parser.err = multierr.Append(parser.err, errors.Errorf("config_params[%s] is %q, expected %s", key, val, expected))
+}
+
+// parseBool returns the boolean val of key, or defaultVal if val is empty or invalid.
+func (parser *algoConfigParamParser) parseBool(key, val string, defaultVal bool) bool {
+	if val == "" {
+		return defaultVal
+	}
+	b, err := strconv.ParseBool(val)
+	if err != nil {
+		parser.fail(key, val, "true or false")
+		return defaultVal
+	}
+	return b
+}
+
+// parseInt returns the integer val of key, which must be at least minVal, or defaultVal if val is empty or invalid.
+func (parser *algoConfigParamParser) parseInt(key, val string, defaultVal, minVal int) int {
+	if val == "" {
+		return defaultVal
+	}
+	i, err := strconv.Atoi(val)
+	if err != nil || i < minVal {
+		parser.fail(key, val, fmt.Sprintf("an integer >= %d", minVal))
+		return defaultVal
+	}
+	return i
+}
+
+// parseFloat returns the finite number val of key, or defaultVal if val is empty or invalid. The number must be
+// greater than zero if positive is set, and at least zero otherwise.
+func (parser *algoConfigParamParser) parseFloat(key, val string, defaultVal float64, positive bool) float64 {
+	if val == "" {
+		return defaultVal
+	}
+	expected := "a number >= 0"
+	if positive {
+		expected = "a number > 0"
+	}
+	f, err := strconv.ParseFloat(val, 64)
+	if err != nil || math.IsNaN(f) || math.IsInf(f, 0) || f < 0 || (positive && f == 0) {
+		parser.fail(key, val, expected)
+		return defaultVal
+	}
+	return f
+}
+
+// parseFloat32 is parseFloat for the params that cartographer takes as float32.
+func (parser *algoConfigParamParser) parseFloat32(key, val string, defaultVal float32, positive bool) float32 {
+	f := parser.parseFloat(key, val, float64(defaultVal), positive)
+	if f > math.MaxFloat32 {
+		parser.fail(key, val, fmt.Sprintf("a number <= %g", math.MaxFloat32))
+		return defaultVal
+	}
+	return float32(f)
+}
+
+// parseFloats parses the numbers of vals.
+func parseFloats(vals []string) ([]float64, error) {
+	fVals := make([]float64, len(vals))
+	for i, val := range vals {
+		var err error
+		if fVals[i], err = strconv.ParseFloat(val, 64); err != nil {
+			return nil, err
+		}
+	}
+	return fVals, nil
+}
+
+// parseCartoAlgoConfig returns the algo config built from configParams along with the keys of configParams that
+// are not algo config params, sorted. The error combines an error for every invalid param, see
+// algoConfigParamParser, so it names all of them at once.
+func parseCartoAlgoConfig(
+	configParams map[string]string,
+	logger logging.Logger,
+) (cartofacade.CartoAlgoConfig, []string, error) {
+	cartoAlgoCfg := defaultCartoAlgoCfg
+	var parser algoConfigParamParser
+	var unused []string
+	// the keys the ranges were given with, which may be the ones with units
+	minRangeKey, maxRangeKey := "min_range", "max_range"
+
+	// the keys are sorted, so that the errors and the unused keys are always in the same order
+	keys := make([]string, 0, len(configParams))
+	for k := range configParams {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		val := configParams[k]
+		switch k {
+		case "optimize_on_start":
+			cartoAlgoCfg.OptimizeOnStart = parser.parseBool(k, val, defaultCartoAlgoCfg.OptimizeOnStart)
+		case "optimize_every_n_nodes":
+			// 0 disables the periodic optimization
+			cartoAlgoCfg.OptimizeEveryNNodes = parser.parseInt(k, val, defaultCartoAlgoCfg.OptimizeEveryNNodes, 0)
+		case "num_range_data":
+			cartoAlgoCfg.NumRangeData = parser.parseInt(k, val, defaultCartoAlgoCfg.NumRangeData, 1)
+		case "missing_data_ray_length", "missing_data_ray_length_meters":
+			cartoAlgoCfg.MissingDataRayLength = parser.parseFloat32(k, val, defaultCartoAlgoCfg.MissingDataRayLength, true)
+		case "max_range", "max_range_meters":
+			cartoAlgoCfg.MaxRange = parser.parseFloat32(k, val, defaultCartoAlgoCfg.MaxRange, true)
+			maxRangeKey = k
+		case "min_range", "min_range_meters":
+			cartoAlgoCfg.MinRange = parser.parseFloat32(k, val, defaultCartoAlgoCfg.MinRange, false)
+			minRangeKey = k
+		case "max_submaps_to_keep":
+			// the pure localization trimmer of cartographer aborts the process for fewer than 2 submaps
+			cartoAlgoCfg.MaxSubmapsToKeep = parser.parseInt(k, val, defaultCartoAlgoCfg.MaxSubmapsToKeep, 2)
+		case "fresh_submaps_count":
+			cartoAlgoCfg.FreshSubmapsCount = parser.parseInt(k, val, defaultCartoAlgoCfg.FreshSubmapsCount, 0)
+		case "min_covered_area", "min_covered_area_meters_squared":
+			cartoAlgoCfg.MinCoveredArea = parser.parseFloat(k, val, defaultCartoAlgoCfg.MinCoveredArea, false)
+		case "min_added_submaps_count":
+			cartoAlgoCfg.MinAddedSubmapsCount = parser.parseInt(k, val, defaultCartoAlgoCfg.MinAddedSubmapsCount, 0)
+		case "occupied_space_weight":
+			cartoAlgoCfg.OccupiedSpaceWeight = parser.parseFloat(k, val, defaultCartoAlgoCfg.OccupiedSpaceWeight, false)
+		case "translation_weight":
+			cartoAlgoCfg.TranslationWeight = parser.parseFloat(k, val, defaultCartoAlgoCfg.TranslationWeight, false)
+		case "rotation_weight":
+			cartoAlgoCfg.RotationWeight = parser.parseFloat(k, val, defaultCartoAlgoCfg.RotationWeight, false)
+		case "initial_starting_pose":
+			fVals := startPosRegex.FindStringSubmatch(val)
+			if len(fVals) == 0 {
+				parser.fail(k, val, "the format 'X:<val>, Y:<val>, Theta:<val>'")
+				continue
+			}
+			pose, err := parseFloats(fVals[1:])
+			if err != nil {
+				parser.fail(k, val, "numbers in the format 'X:<val>, Y:<val>, Theta:<val>'")
+				continue
+			}
+
+			cartoAlgoCfg.HasInitialTrajectoryPose = true
+			cartoAlgoCfg.InitialTrajectoryPoseX = pose[0]
+			cartoAlgoCfg.InitialTrajectoryPoseY = pose[1]
+			cartoAlgoCfg.InitialTrajectoryPoseTheta = pose[2]
+		case "initial_starting_pose_sigma":
+			fVals := startPosSigmaRegex.FindStringSubmatch(val)
+			if len(fVals) == 0 {
+				parser.fail(k, val, "the format 'X:<val>, Y:<val>, Theta:<val>'")
+				continue
+			}
+			sigmas, err := parseFloats(fVals[1:])
+			if err != nil || sigmas[0] < 0 || sigmas[1] < 0 || sigmas[2] < 0 {
+				parser.fail(k, val, "numbers >= 0 in the format 'X:<val>, Y:<val>, Theta:<val>'")
+				continue
+			}
+
+			cartoAlgoCfg.HasInitialTrajectoryPoseSigma = true
+			cartoAlgoCfg.InitialTrajectoryPoseSigmaX = sigmas[0]
+			cartoAlgoCfg.InitialTrajectoryPoseSigmaY = sigmas[1]
+			cartoAlgoCfg.InitialTrajectoryPoseSigmaTheta = sigmas[2]
+			// ignore mode as it is a special case
+		case "mode":
+		default:
+			unused = append(unused, k)
+		}
+	}
+
+	// the ranges are only compared if both are valid, as an invalid one falls back to its default
+	if !parser.invalid[minRangeKey] && !parser.invalid[maxRangeKey] && cartoAlgoCfg.MinRange >= cartoAlgoCfg.MaxRange {
+		parser.err = multierr.Append(parser.err, errors.Errorf("config_params[%s] is %g, expected < config_params[%s], which is %g",
+			minRangeKey, cartoAlgoCfg.MinRange, maxRangeKey, cartoAlgoCfg.MaxRange))
+	}
+	if cartoAlgoCfg.HasInitialTrajectoryPoseSigma && !cartoAlgoCfg.HasInitialTrajectoryPose &&
+		!parser.invalid["initial_starting_pose"] {
+		parser.err = multierr.Append(parser.err,
+			errors.New("config_params[initial_starting_pose_sigma] requires config_params[initial_starting_pose] to be set"))
+	}
+	if len(unused) > 0 {
+		logger.Warnf("unused config params, which are not cartographer config params: %s", strings.Join(unused, ", "))
+	}
+	if parser.err != nil {
+		return cartoAlgoCfg, nil, errors.Wrap(parser.err, "invalid config_params")
+	}
+	return cartoAlgoCfg, unused, nil
+}
+
+// warnUnsupportedSensorNames adds a construction warning for every sensor of cfg whose name holds characters that
+// are known to break the cartofacade. The names are passed to the cartofacade as is regardless.
+func (cartoSvc *CartographerService) warnUnsupportedSensorNames(cfg cartofacade.CartoConfig) {
+	for _, name := range append([]string{cfg.Camera, cfg.MovementSensor}, cfg.AdditionalCameras...) {
+		if reason := s.UnsupportedNameCharacters(name); reason != "" {
+			cartoSvc.constructionWarnings.add(WarningUnsupportedSensorName, fmt.Sprintf("sensor name %q %s", name, reason))
+		}
+	}
+}
+
+// initCartoFacade
+// 1. creates a new initCartoFacade
+// 2. initializes it and starts it
+// 3. terminates it if start fails.
+func initCartoFacade(ctx context.Context, cartoSvc *CartographerService) error {
+	// load_internal_state initializes cartographer again with the same config, whose warnings were logged and kept
+	// as construction warnings the first time
+	warnLogger := cartoSvc.logger
+	if cartoSvc.constructionWarnings.isSealed() {
+		warnLogger = logging.NewBlankLogger(cartoSvc.Name().ShortName())
+	}
+	defer cartoSvc.constructionWarnings.seal()
+
+	cartoAlgoConfig, unusedConfigParams, err := parseCartoAlgoConfig(cartoSvc.configParams, warnLogger)
+	if err != nil {
+		return err
+	}
+	cartoAlgoConfig.FinalOptimizationIterations = cartoSvc.finalOptimizationIterations
+	for _, key := range unusedConfigParams {
+		cartoSvc.constructionWarnings.add(WarningUnusedConfigParam,
+			fmt.Sprintf("config param %s is not a cartographer config param and is ignored", key))
+	}
+
+	var movementSensorName string
+	// the sensor streams are checked by cartographer against the movement sensor
+	sensorStreams := cartofacade.LidarOnly
+	if cartoSvc.movementSensor == nil {
+		cartoSvc.logger.Debug("No movement sensor provided, setting use_imu_data to false")
+		cartoSvc.constructionWarnings.add(WarningNoMovementSensor,
+			"no movement sensor configured, proceeding without IMU and without odometer")
+	} else {
+		movementSensorName = cartoSvc.movementSensor.Name()
+		sensorStreams = cartofacade.LidarAndMovementSensor
+		movementSensorProperties := cartoSvc.movementSensor.Properties()
+		if movementSensorProperties.IMUSupported {
+			warnLogger.Warn("IMU configured, setting use_imu_data to true")
+			cartoAlgoConfig.UseIMUData = true
+		} else {
+			warnLogger.Warn("Movement sensor was provided but does not support IMU data, setting use_imu_data to false")
+			cartoSvc.constructionWarnings.add(WarningMovementSensorWithoutIMU, fmt.Sprintf(
+				"movement sensor %s does not support IMU data, setting use_imu_data to false", movementSensorName))
+		}
+		if movementSensorProperties.OdometerSupported {
+			cartoSvc.logger.Debug("Odometer is supported")
+			cartoSvc.useOdometerData = true
+		} else if movementSensorProperties.IMUSupported {
+			cartoSvc.constructionWarnings.add(WarningMovementSensorWithoutOdometer, fmt.Sprintf(
+				"movement sensor %s supports IMU data but not odometer data, proceeding without odometer",
+				movementSensorName))
+		}
+	}
+
+	cartoCfg := cartofacade.CartoConfig{
+		Camera:         cartoSvc.lidar.Name(),
+		MovementSensor: movementSensorName,
+		LidarConfig:    cartofacade.TwoD,
+		EnableMapping:  cartoSvc.enableMapping,
+		ExistingMap:    cartoSvc.existingMap,
+		SensorStreams:  sensorStreams,
+	}
+	for _, additionalLidar := range cartoSvc.additionalLidars {
+		cartoCfg.AdditionalCameras = append(cartoCfg.AdditionalCameras, additionalLidar.Name())
+	}
+	cartoSvc.warnUnsupportedSensorNames(cartoCfg)
+	if cartoSvc.floorPlan != nil {
+		cartoCfg.FloorPlan = cartoSvc.floorPlan.PCD
+		cartoCfg.FloorPlanResolution = cartoSvc.floorPlan.ResolutionMm / 1000
+	}
+
+	cartoSvc.configHashInput.AlgoConfig = cartoAlgoConfig
+	if cartoSvc.configHash, err = cartoSvc.configHashInput.hash(); err != nil {
+		cartoSvc.logger.Warnw("unable to compute the config hash", "error", err)
+	} else {
+		cartoSvc.logger.Infow("the config hash of this run is "+cartoSvc.configHash, ConfigHashKey, cartoSvc.configHash)
+	}
+
+	startedAlgoConfig := cartoSvc.deferInitialOptimization(cartoAlgoConfig)
+	cf := cartofacade.New(&cartoLib, cartoCfg, startedAlgoConfig)
+	slamMode, err := cartoSvc.initializeAndStartCartoFacade(ctx, &cf)
+	if err != nil {
+		if errors.Is(err, cartofacade.ErrIMUProvidedAndIMUEnabledMismatch) {
+			err = errors.Wrapf(err, "cartographer rejected use_imu_data: %v, which is set from the IMU support of "+
+				"movement_sensor: %q", cartoAlgoConfig.UseIMUData, movementSensorName)
+		}
+		return err
+	}
+	// the monitors are only started once cartographer is, so that there is nothing to clean up if it fails to start
+	cf.StartHangMonitor(ctx, cartoSvc.hangThreshold, cartoSvc.handleCartoFacadeHang, &cartoSvc.cartoFacadeWorkers)
+	if cartoSvc.lidar.DataFrequencyHz() != 0 {
+		// offline, cartographer is meant to be busy all of the time
+		cf.StartDutyCycleMonitor(ctx, cartoSvc.handleDutyCycle, &cartoSvc.cartoFacadeWorkers)
+	}
+	cf.StartMemoryMonitor(ctx, cartofacade.MemoryPollInterval, &cartoSvc.cartoFacadeWorkers)
+
+	cartoSvc.cartofacade = &cf
+	cartoSvc.SlamMode = slamMode
+	cartoSvc.requestedAlgoConfig = cartoAlgoConfig
+
+	if cartoSvc.shadowConfigParams != nil {
+		initShadowCartoFacade(ctx, cartoSvc, cartoCfg, cartoAlgoConfig, warnLogger)
+	}
+
+	appliedAlgoConfig, err := cf.AlgoConfig(ctx, cartoSvc.cartoFacadeTimeout)
+	if err != nil {
+		cartoSvc.logger.Warnw("unable to get the algo config applied by cartographer", "error", err)
+		return nil
+	}
+	for _, msg := range warnAlgoConfigDifferences(warnLogger, startedAlgoConfig, appliedAlgoConfig, slamMode) {
+		cartoSvc.constructionWarnings.add(WarningConfigParamNotApplied, msg)
+	}
+
+	return nil
+}
+
+// initializeAndStartCartoFacade initializes and starts cf, terminating it if starting fails. Both are attempted
+// up to maxInitAttempts times, with a jittered exponential backoff in between, as long as they fail with one of
+// retryableInitErrors, e.g. because a previous instance has not released its resources yet. If it fails, the
+// worker Initialize started has exited by the time the error is returned.
+func (cartoSvc *CartographerService) initializeAndStartCartoFacade(
+	ctx context.Context,
+	cf cartofacade.Interface,
+) (cartofacade.SlamMode, error) {
+	slamMode, err := cartoSvc.attemptInitializeAndStartCartoFacade(ctx, cf)
+	if err != nil {
+		// no other worker is registered before cartographer is started
+		cartoSvc.cancelCartoFacadeFunc()
+		cartoSvc.cartoFacadeWorkers.Wait()
+		return cartofacade.UnknownMode, err
+	}
+	return slamMode, nil
+}
+
+// attemptInitializeAndStartCartoFacade makes the attempts of initializeAndStartCartoFacade.
+func (cartoSvc *CartographerService) attemptInitializeAndStartCartoFacade(
+	ctx context.Context,
+	cf cartofacade.Interface,
+) (cartofacade.SlamMode, error) {
+	backoff := cartoSvc.initRetryBackoff
+	for attempt := 1; ; attempt++ {
+		slamMode, err := cf.Initialize(ctx, cartoSvc.cartoFacadeTimeout, &cartoSvc.cartoFacadeWorkers)
+		if err != nil {
+			cartoSvc.logger.Errorw("cartofacade initialize failed", "error", err)
+		} else {
+			if err = cf.Start(ctx, cartoSvc.cartoFacadeTimeout); err == nil {
+				return slamMode, nil
+			}
+			cartoSvc.logger.Errorw("cartofacade start failed", "error", err)
+			if termErr := cf.Terminate(ctx, cartoSvc.cartoFacadeTimeout); termErr != nil {
+				cartoSvc.logger.Errorw("cartofacade terminate failed", "error", termErr)
+				return cartofacade.UnknownMode, termErr
+			}
+		}
+
+		if !cartoSvc.retryableInitErrors[errors.Cause(err).Error()] || attempt >= cartoSvc.maxInitAttempts {
+			return cartofacade.UnknownMode, err
+		}
+		//nolint:gosec
+		jittered := backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+		cartoSvc.logger.Warnw("initializing cartographer failed with a retryable error, retrying",
+			"error", err, "attempt", attempt, "max_attempts", cartoSvc.maxInitAttempts, "backoff", jittered)
+		if !utils.SelectContextOrWait(ctx, jittered) {
+			return cartofacade.UnknownMode, multierr.Combine(err, ctx.Err())
+		}
+		backoff = min(2*backoff, initRetryMaxBackoff)
+	}
+}
+
+// initShadowCartoFacade initializes and starts a second cartofacade with the algo config of config_params
+// overridden by shadow_config. Failures are only logged, in which case the service runs without a shadow. The
+// warnings about the config are logged to warnLogger.
+func initShadowCartoFacade(
+	ctx context.Context,
+	cartoSvc *CartographerService,
+	cartoCfg cartofacade.CartoConfig,
+	primaryAlgoConfig cartofacade.CartoAlgoConfig,
+	warnLogger logging.Logger,
+) {
+	configParams := map[string]string{}
+	for key, val := range cartoSvc.configParams {
+		configParams[key] = val
+	}
+	for key, val := range cartoSvc.shadowConfigParams {
+		configParams[key] = val
+	}
+	shadowAlgoConfig, _, err := parseCartoAlgoConfig(configParams, warnLogger)
+	if err != nil {
+		cartoSvc.logger.Errorw("invalid shadow_config, running without a shadow cartographer instance", "error", err)
+		return
+	}
+	shadowAlgoConfig.UseIMUData = primaryAlgoConfig.UseIMUData
+
+	var overrides []string
+	for _, diff := range cartofacade.DiffAlgoConfig(primaryAlgoConfig, shadowAlgoConfig, cartoSvc.SlamMode) {
+		overrides = append(overrides, fmt.Sprintf("%s: %v -> %v", diff.Name, diff.Requested, diff.Applied))
+	}
+	warnLogger.Warnw("shadow_config is experimental: a second cartographer instance is submitted every reading, "+
+		"which roughly doubles cartographer's memory use and CPU load",
+		"overrides", overrides)
+	cartoSvc.constructionWarnings.add(WarningShadowConfigExperimental, fmt.Sprintf("shadow_config is experimental and "+
+		"roughly doubles cartographer's memory use and CPU load, overrides: %s", strings.Join(overrides, ", ")))
+
+	// the worker of a shadow which fails to start is stopped right away rather than when the service is closed
+	shadowCtx, cancelShadow := context.WithCancel(ctx)
+	started := false
+	defer func() {
+		if !started {
+			cancelShadow()
+		}
+	}()
+
+	shadow := cartofacade.New(&cartoLib, cartoCfg, shadowAlgoConfig)
+	if _, err := shadow.Initialize(shadowCtx, cartoSvc.cartoFacadeTimeout, &cartoSvc.cartoFacadeWorkers); err != nil {
+		cartoSvc.logger.Errorw("shadow cartofacade initialize failed, running without a shadow cartographer instance",
+			"error", err)
+		return
+	}
+	if err := shadow.Start(shadowCtx, cartoSvc.cartoFacadeTimeout); err != nil {
+		cartoSvc.logger.Errorw("shadow cartofacade start failed, running without a shadow cartographer instance",
+			"error", err)
+		if termErr := shadow.Terminate(shadowCtx, cartoSvc.cartoFacadeTimeout); termErr != nil {
+			cartoSvc.logger.Errorw("shadow cartofacade terminate failed", "error", termErr)
+		}
+		return
+	}
+	started = true
+	cartoSvc.shadowCartofacade = &shadow
+}
+
+// warnAlgoConfigDifferences logs a warning for each algo config value which cartographer is not operating with
+// and returns the warnings.
+func warnAlgoConfigDifferences(
+	logger logging.Logger,
+	requested, applied cartofacade.CartoAlgoConfig,
+	slamMode cartofacade.SlamMode,
+) []string {
+	var warnings []string
+	for _, diff := range cartofacade.DiffAlgoConfig(requested, applied, slamMode) {
+		msg := fmt.Sprintf("config param %s was set to %v but cartographer is operating with %v",
+			diff.Name, diff.Requested, diff.Applied)
+		logger.Warn(msg)
+		warnings = append(warnings, msg)
+	}
+	return warnings
+}
+
+// closePhase is a phase of Close. The phases run in the order they are declared in, each after the previous
+// one has completed, so that no sensor reading is submitted to a cartofacade that is being stopped.
+type closePhase string
+
+const (
+	// closePhaseNone is reached when no phase of Close has completed successfully.
+	closePhaseNone closePhase = "none"
+	// closePhaseStopSensors stops the sensor processes and waits for them to return.
+	closePhaseStopSensors closePhase = "stop_sensor_ingestion"
+	// closePhaseDrainFacade waits for the sensor readings that are being added to the cartofacades, any reading
+	// added after it fails with cartofacade.ErrDrained.
+	closePhaseDrainFacade closePhase = "drain_facade"
+	// closePhaseStopFacade stops the cartofacades.
+	closePhaseStopFacade closePhase = "stop_facade"
+	// closePhaseTerminateFacade terminates the cartofacades.
+	closePhaseTerminateFacade closePhase = "terminate_facade"
+	// closePhaseStopWorkers stops the cartofacade workers and waits for them to return.
+	closePhaseStopWorkers closePhase = "stop_workers"
+)
+
+// closeInPhases runs the phases of Close in order. It returns the last phase reached, i.e. the last phase
+// that completed successfully after all phases before it did, along with the errors of the phases that failed.
+// A phase that failed does not prevent the phases after it from running.
+func (cartoSvc *CartographerService) closeInPhases(ctx context.Context) (closePhase, error) {
+	reached := closePhaseNone
+	var errs error
+	complete := func(phase closePhase, err error) {
+		if err != nil {
+			errs = multierr.Append(errs, errors.Wrapf(err, "close phase %s failed", phase))
+			return
+		}
+		if errs == nil {
+			reached = phase
+		}
+	}
+
+	cartoSvc.cancelSensorProcessFunc()
+	cartoSvc.waitForWorkers()
+	complete(closePhaseStopSensors, nil)
+
+	complete(closePhaseDrainFacade, cartoSvc.callCartoFacades(closePhaseDrainFacade, func(cf cartofacade.Interface) error {
+		return cf.Drain(ctx, cartoSvc.cartoFacadeTimeout)
+	}))
+	cartoSvc.optimizeOnCloseIfSet(ctx)
+	// the internal state can only be saved while cartographer is started, and holds every reading once drained
+	if cartoSvc.warmStartDir != "" && cartoSvc.cartofacade != nil {
+		if path, err := cartoSvc.saveWarmStartMap(ctx, time.Now()); err != nil {
+			cartoSvc.logger.Errorw("failed to save the internal state to warm_start_dir", "path", path, "error", err)
+		} else {
+			cartoSvc.logger.Infow("saved the internal state to warm_start_dir", "path", path)
+		}
+	}
+	complete(closePhaseStopFacade, cartoSvc.callCartoFacades(closePhaseStopFacade, func(cf cartofacade.Interface) error {
+		return cf.Stop(ctx, cartoSvc.cartoFacadeTimeout)
+	}))
+	complete(closePhaseTerminateFacade, cartoSvc.callCartoFacades(closePhaseTerminateFacade, func(cf cartofacade.Interface) error {
+		return cf.Terminate(ctx, cartoSvc.cartoFacadeTimeout)
+	}))
+
+	cartoSvc.cancelCartoFacadeFunc()
+	cartoSvc.cartoFacadeWorkers.Wait()
+	complete(closePhaseStopWorkers, nil)
+
+	return reached, errs
+}
+
+// optimizeOnCloseIfSet runs the final optimization once the cartofacade is drained if optimize_on_close is set,
+// so that the map of an online mapping session is as consistent as that of an offline one. It is skipped in
+// localization mode, which does not change the map. A failed optimization is only logged, it does not prevent
+// the cartofacade from being stopped and terminated.
+func (cartoSvc *CartographerService) optimizeOnCloseIfSet(ctx context.Context) {
+	if !cartoSvc.optimizeOnClose || cartoSvc.cartofacade == nil {
+		return
+	}
+	if _, slamMode := cartoSvc.mode(); slamMode == cartofacade.LocalizingMode {
+		cartoSvc.logger.Debug("skipping the final optimization on close in localization mode")
+		return
+	}
+	cartoSvc.logger.Info("running the final optimization on close")
+	start := time.Now()
+	if err := cartoSvc.cartofacade.RunFinalOptimization(ctx, cartoSvc.cartoFacadeInternalTimeout); err != nil {
+		cartoSvc.logger.Errorw("the final optimization on close failed", "error", err)
+		return
+	}
+	cartoSvc.logger.Infow("finished the final optimization on close", "duration", time.Since(start))
+}
+
+// callCartoFacades calls f on the shadow cartofacade, if there is one, and then on the primary one. The shadow
+// shuts down with the primary, its failures are only logged.
+func (cartoSvc *CartographerService) callCartoFacades(phase closePhase, f func(cf cartofacade.Interface) error) error {
+	if cartoSvc.shadowCartofacade != nil {
+		if err := f(cartoSvc.shadowCartofacade); err != nil {
+			cartoSvc.logger.Errorw("shadow cartofacade failed to close", "phase", phase, "error", err)
+		}
+	}
+
+	if cartoSvc.cartofacade == nil {
+		cartoSvc.logger.Debugw("close phase skipped as cartoSvc.cartofacade is nil", "phase", phase)
+		return nil
+	}
+	err := f(cartoSvc.cartofacade)
+	if err != nil {
+		cartoSvc.logger.Errorw("cartofacade failed to close", "phase", phase, "error", err)
+	}
+	return err
+}
+
+// CartographerService is the structure of the slam service.
+type CartographerService struct {
+	resource.Named
+	resource.AlwaysRebuild
+	mu             sync.Mutex
+	SlamMode       cartofacade.SlamMode
 	closed         bool
 	lidar          s.TimedLidar
 	movementSensor s.TimedMovementSensor
 	subAlgo        SubAlgo
-
-	configParams map[string]string
-
+	// modeMu guards SlamMode and enableMapping, which set_mode changes while the service is running.
+	modeMu sync.RWMutex
+	// cartoFacadeMu guards cartofacade, shadowCartofacade, cancelCartoFacadeFunc, existingMap and floorPlan, which
+	// load_internal_state replaces while the service is running. The endpoints hold it for reading while they use
+	// them, so that they never call a cartofacade that has been terminated.
+	cartoFacadeMu sync.RWMutex
+
+	// additionalLidars are the lidars whose readings are added to cartographer along with those of lidar.
+	additionalLidars []s.TimedLidar
+	// lidarResolver resolves the cameras of the lidars again in online mode once their readings keep failing
+	// because they are unavailable.
+	lidarResolver s.ResourceResolver
+
+	configParams        map[string]string
+	requestedAlgoConfig cartofacade.CartoAlgoConfig
+
+	cartoLib                   cartofacade.CartoLibInterface
 	cartofacade                cartofacade.Interface
 	cartoFacadeTimeout         time.Duration
 	cartoFacadeInternalTimeout time.Duration
+	hangThreshold              time.Duration
+	restartOnHang              func()
+	maxInitAttempts            int
+	retryableInitErrors        map[string]bool
+	initRetryBackoff           time.Duration
+	// initCartoFacadeFunc initializes cartographer again once load_internal_state has terminated it,
+	// initCartoFacade if nil.
+	initCartoFacadeFunc func(ctx context.Context, cartoSvc *CartographerService) error
 
 	cancelSensorProcessFunc func()
 	cancelCartoFacadeFunc   func()
 	logger                  logging.Logger
 	sensorProcessWorkers    sync.WaitGroup
-	cartoFacadeWorkers      sync.WaitGroup
-
-	jobDone atomic.Bool
+	// workers are the sensor process workers that are running, see goWorker, and workerExitGracePeriod is how long
+	// Close waits for them before it logs those that have not exited, defaultWorkerExitGracePeriod if zero
+	workers               workerRegistry
+	workerExitGracePeriod time.Duration
+	cartoFacadeWorkers    sync.WaitGroup
+
+	jobDone                      atomic.Bool
+	jobResult                    atomic.Pointer[sensorprocess.OfflineJobResult]
+	jobSummary                   *sensorprocess.JobSummary
+	runFinalOptimizationOnCancel bool
+	optimizeOnClose              bool
+	skipFinalOptimization        bool
+	finalOptimizationIterations  int
+	expectedTotal                int
+	maxJobDuration               time.Duration
+	maxConsecutiveLidarFailures  int
+	maxRejectedReadingRetries    int
+	allowMixedClockDomains       bool
+	maxSensorSkew                time.Duration
+	lidarBufferSize              int
+	movementSensorBufferSize     int
+	maxActiveTrajectories        int
+	freezeOldestOnLimit          bool
+	convertUnsupportedPCD        bool
+
+	optimizeOnStartAsync bool
+	// initialOptimizationDeferred denotes that cartographer was started without optimize_on_start, which runs in
+	// the background instead while initialOptimizationInProgress is set.
+	initialOptimizationDeferred   bool
+	initialOptimizationInProgress atomic.Bool
+	// initialOptimizationInBackground denotes that the library runs the initial optimization on a thread of its own,
+	// so that the other calls into cartographer do not wait on it.
+	initialOptimizationInBackground atomic.Bool
 
 	postprocessed           atomic.Bool
 	postprocessingTasks     []postprocess.Task
+	maxPostprocessingTasks  int
 	postprocessedPointCloud *[]byte
+	sessionPostprocessing   sessionOverrides[bool]
 	editedMap               *[]byte
-
-	useCloudSlam  bool
-	enableMapping bool
-	existingMap   string
+	editedMapInconsistent   atomic.Bool
+	submapCache             submapCache
+
+	mappingBounds    atomic.Pointer[s.MappingBounds]
+	odometerOrigin   atomic.Pointer[spatialmath.GeoPose]
+	sessionClock     *sensorprocess.SessionClock
+	maxSpeedMmPerSec float64
+	sessionStats     *sessionStats
+	// poseSubscriptions receive the positions of the lidar readings that were added and those polled by the session
+	// stats monitor.
+	poseSubscriptions poseSubscriptions
+
+	calibrationFile         string
+	calibrationFileChecksum string
+
+	minPointsPerScan int
+	scanFilter       *sensorprocess.ScanFilter
+	// lidarRejectionDiagnostic diagnoses the lidar readings cartographer keeps rejecting.
+	lidarRejectionDiagnostic *sensorprocess.RejectionDiagnostic
+	emptyLidarReadings       atomic.Int64
+	addedLidarReadings       atomic.Int64
+
+	// useOdometerData is whether the odometer data of the movement sensor is added to cartographer.
+	useOdometerData       bool
+	addedIMUReadings      atomic.Int64
+	addedOdometerReadings atomic.Int64
+	movementSensorUnused  atomic.Bool
+
+	// mapRevisions numbers the versions of the map seen by the map revision tracker and keeps their changes.
+	mapRevisions mapRevisions
+
+	constructionWarnings constructionWarnings
+	// recentErrors keeps the most recent warnings and errors logged by the service.
+	recentErrors *recentErrors
+
+	mapStallLidarReadings int64
+	mapGrowth             mapGrowth
+	mapGrowthMonitor      mapGrowthMonitor
+	mapStalled            atomic.Bool
+
+	localizationHealth localizationHealth
+	localizationLost   atomic.Bool
+	// sharedCamera denotes whether another service of the module reads one of the cameras of the service.
+	sharedCamera                    atomic.Bool
+	positionErrorOnLocalizationLost bool
+
+	maxIngestionLatency time.Duration
+	ingestionLatency    *sensorprocess.IngestionLatency
+	sensorStats         *sensorprocess.SensorStats
+
+	changeDetector *sensorprocess.ChangeDetector
+	mapOverlap     *sensorprocess.MapOverlap
+
+	maxDutyCyclePercent      float64
+	windowsAboveMaxDutyCycle int
+
+	maxUnoptimizedNodeAge      time.Duration
+	unoptimizedNodeAgeExceeded bool
+	slamStats                  atomic.Pointer[cartofacade.SlamStats]
+
+	shadowConfigParams map[string]string
+	shadowCartofacade  cartofacade.Interface
+
+	internalStateExportDirs []string
+	// warmStartDir is the directory the latest internal state is loaded from on start and saved to on close, which
+	// keeps the warmStartRetention newest internal states.
+	warmStartDir       string
+	warmStartRetention int
+	// internalStateSaveDir is the directory the internal state is saved to every internalStateSaveInterval while
+	// mapping, which keeps the internalStateSaveRetention newest internal states.
+	internalStateSaveDir       string
+	internalStateSaveInterval  time.Duration
+	internalStateSaveRetention int
+	// configHash identifies the tuning of the run in the artifacts it produces. It is computed from
+	// configHashInput once the algo config has been resolved.
+	configHash      string
+	configHashInput configHashInput
+
+	useCloudSlam bool
+	// cloudSlamIgnoredFields are the fields of the config that are ignored as use_cloud_slam is set.
+	cloudSlamIgnoredFields []string
+	enableMapping          bool
+	existingMap            string
+	// floorPlan is the occupancy grid that is localized against instead of an existing map, if any.
+	floorPlan *floorplan.FloorPlan
 }
 
 // Position forwards the request for positional data to the slam library's gRPC service. Once a response is received,
-// it is unpacked into a Pose.
+// it is unpacked into a Pose. While the existing map is optimized in the background, the pose is localized against
+// the map as loaded, which the status reports as initial_optimization_in_progress.
 func (cartoSvc *CartographerService) Position(ctx context.Context) (spatialmath.Pose, error) {
 	ctx, span := trace.StartSpan(ctx, "viamcartographer::CartographerService::Position")
 	defer span.End()
@@ -583,6 +2070,17 @@ func (cartoSvc *CartographerService) Position(ctx context.Context) (spatialmath.
 	if err := cartoSvc.isOpenAndRunningLocally("Position"); err != nil {
 		return nil, err
 	}
+	cartoSvc.cartoFacadeMu.RLock()
+	defer cartoSvc.cartoFacadeMu.RUnlock()
+
+	if cartoSvc.positionErrorOnLocalizationLost && cartoSvc.localizationLost.Load() {
+		return nil, ErrLocalizationLost
+	}
+
+	// the request would wait on the optimization
+	if cartoSvc.initialOptimizationBlocking() {
+		return nil, ErrInitialOptimizationInProgress
+	}
 
 	pos, err := cartoSvc.cartofacade.Position(ctx, cartoSvc.cartoFacadeTimeout)
 	if err != nil {
@@ -610,17 +2108,38 @@ func (cartoSvc *CartographerService) PointCloudMap(ctx context.Context, returnEd
 	if err := cartoSvc.isOpenAndRunningLocally("PointCloudMap"); err != nil {
 		return nil, err
 	}
+	cartoSvc.cartoFacadeMu.RLock()
+	defer cartoSvc.cartoFacadeMu.RUnlock()
+
+	pc, err := cartoSvc.pointCloudMap(ctx, cartoSvc.pointCloudMapOptions(ctx, returnEditedMap))
+	if err != nil {
+		return nil, err
+	}
+	return toChunkedFunc(pc), nil
+}
+
+// pointCloudMap returns the pointcloud map that PointCloudMap returns in chunks, as determined by opts.
+func (cartoSvc *CartographerService) pointCloudMap(ctx context.Context, opts pointCloudMapOptions) ([]byte, error) {
+	pc, err := cartoSvc.uncroppedPointCloudMap(ctx, opts)
+	if err != nil || opts.crop == nil {
+		return pc, err
+	}
+	return opts.crop.crop(pc)
+}
 
+// uncroppedPointCloudMap returns the map pointCloudMap returns before it is cropped.
+func (cartoSvc *CartographerService) uncroppedPointCloudMap(ctx context.Context, opts pointCloudMapOptions) ([]byte, error) {
 	/*
 		cartoSvc.existingMap != "" && !cartoSvc.enableMapping to check if we are in localization mode.
-		cartoSvc.postprocessedPointCloud != nil to check that the pointcloud has been set.
-		cartoSvc.postprocessed.Load() to check if postprocessed has not been toggled off.
+		opts.postprocessedPointCloud != nil to check that the pointcloud has been set.
+		opts.postprocessed to check if postprocessed has not been toggled off.
 	*/
-	if returnEditedMap && cartoSvc.editedMap != nil {
-		return toChunkedFunc(*cartoSvc.editedMap), nil
+	if opts.returnEditedMap && cartoSvc.editedMap != nil {
+		return *cartoSvc.editedMap, nil
 	}
-	if cartoSvc.existingMap != "" && !cartoSvc.enableMapping && cartoSvc.postprocessedPointCloud != nil && cartoSvc.postprocessed.Load() {
-		return toChunkedFunc(*cartoSvc.postprocessedPointCloud), nil
+	if enableMapping, _ := cartoSvc.mode(); cartoSvc.existingMap != "" && !enableMapping &&
+		opts.postprocessedPointCloud != nil && opts.postprocessed {
+		return *opts.postprocessedPointCloud, nil
 	}
 
 	pc, err := cartoSvc.cartofacade.PointCloudMap(ctx, cartoSvc.cartoFacadeInternalTimeout)
@@ -628,17 +2147,23 @@ func (cartoSvc *CartographerService) PointCloudMap(ctx context.Context, returnEd
 		return nil, err
 	}
 
-	if cartoSvc.postprocessed.Load() {
+	if bounds := cartoSvc.mappingBounds.Load(); bounds != nil && bounds.ClipPointCloudMap {
+		if pc, err = bounds.ClipPointCloud(pc); err != nil {
+			return nil, err
+		}
+	}
+
+	if opts.postprocessed {
 		var updatedPc []byte
-		err = postprocess.UpdatePointCloud(pc, &updatedPc, cartoSvc.postprocessingTasks)
+		err = postprocess.UpdatePointCloud(pc, &updatedPc, opts.postprocessingTasks)
 		if err != nil {
 			return nil, err
 		}
 
-		return toChunkedFunc(updatedPc), nil
+		return updatedPc, nil
 	}
 
-	return toChunkedFunc(pc), nil
+	return pc, nil
 }
 
 // InternalState creates a request, calls the slam algorithms InternalState endpoint and returns a callback
@@ -650,6 +2175,18 @@ func (cartoSvc *CartographerService) InternalState(ctx context.Context) (func()
 	if err := cartoSvc.isOpenAndRunningLocally("InternalState"); err != nil {
 		return nil, err
 	}
+	cartoSvc.cartoFacadeMu.RLock()
+	defer cartoSvc.cartoFacadeMu.RUnlock()
+
+	// the internal state is streamed out of cartographer so that it is never held in memory in full, unless the
+	// library does not support it
+	stream, err := cartoSvc.cartofacade.InternalStateStream(ctx, cartoSvc.cartoFacadeInternalTimeout)
+	if err == nil {
+		return cartoSvc.toStreamedChunkedFunc(ctx, stream), nil
+	}
+	if !errors.Is(err, cartofacade.ErrInternalStateStreamUnavailable) {
+		return nil, err
+	}
 
 	is, err := cartoSvc.cartofacade.InternalState(ctx, cartoSvc.cartoFacadeInternalTimeout)
 	if err != nil {
@@ -659,19 +2196,151 @@ func (cartoSvc *CartographerService) InternalState(ctx context.Context) (func()
 	return toChunkedFunc(is), nil
 }
 
+// toStreamedChunkedFunc returns a function that reads the next chunk of at most chunkSizeBytes from stream each time
+// it is called, with the same guarantees as toChunkedFunc. The stream is closed once it has been read in full, a
+// read fails or ctx is done.
+func (cartoSvc *CartographerService) toStreamedChunkedFunc(ctx context.Context, stream io.ReadCloser) func() ([]byte, error) {
+	var closeOnce sync.Once
+	closeStream := func() {
+		closeOnce.Do(func() {
+			if err := stream.Close(); err != nil {
+				cartoSvc.logger.Warnw("failed to close the internal state stream", "error", err)
+			}
+		})
+	}
+	stopAfterFunc := context.AfterFunc(ctx, closeStream)
+
+	var done bool
+	return func() ([]byte, error) {
+		if done {
+			return nil, io.EOF
+		}
+		chunk := make([]byte, chunkSizeBytes)
+		n, err := io.ReadFull(stream, chunk)
+		switch {
+		case err == nil:
+			return chunk, nil
+		case errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF):
+			done = true
+			stopAfterFunc()
+			closeStream()
+			if n == 0 {
+				return nil, io.EOF
+			}
+			return chunk[:n:n], nil
+		default:
+			done = true
+			stopAfterFunc()
+			closeStream()
+			return nil, err
+		}
+	}
+}
+
+// toChunkedFunc returns a function that returns the next chunk of at most chunkSizeBytes of b each time it is
+// called. Every chunk is non-empty and returned with a nil error. Once all of b has been returned, including when
+// its size is a multiple of chunkSizeBytes, the function returns (nil, io.EOF) and never data and an error together.
+// Chunks do not share memory with each other, so a chunk stays valid after later calls.
 func toChunkedFunc(b []byte) func() ([]byte, error) {
-	chunk := make([]byte, chunkSizeBytes)
+	var offset int
+	return func() ([]byte, error) {
+		if offset >= len(b) {
+			return nil, io.EOF
+		}
+		end := min(offset+chunkSizeBytes, len(b))
+		chunk := b[offset:end:end]
+		offset = end
+		return chunk, nil
+	}
+}
+
+// writeInternalStateToPath writes the internal state to path and returns the path, size and checksum of the file.
+// The internal state is written to a temporary file in the same directory that is renamed to path once complete,
+// so the file at path is never partially written, also when the command is invoked concurrently for the same path.
+func (cartoSvc *CartographerService) writeInternalStateToPath(ctx context.Context, path string) (map[string]interface{}, error) {
+	path, err := resolveInternalStateExportPath(path, cartoSvc.internalStateExportDirs)
+	if err != nil {
+		return nil, err
+	}
+
+	is, err := cartoSvc.cartofacade.InternalState(ctx, cartoSvc.cartoFacadeInternalTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := writeFileAtomically(path, is); err != nil {
+		return nil, err
+	}
 
-	reader := bytes.NewReader(b)
+	checksum := sha256.Sum256(is)
+	resp := map[string]interface{}{
+		"path":       path,
+		"size_bytes": len(is),
+		"sha256":     hex.EncodeToString(checksum[:]),
+	}
+	metadata, err := json.MarshalIndent(map[string]interface{}{
+		"size_bytes":     len(is),
+		"sha256":         resp["sha256"],
+		ModuleVersionKey: ModuleVersion,
+		ConfigHashKey:    cartoSvc.configHash,
+	}, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	metadataPath := path + internalStateMetadataSuffix
+	if err := writeFileAtomically(metadataPath, metadata); err != nil {
+		return nil, err
+	}
+	resp["metadata_path"] = metadataPath
+	return resp, nil
+}
+
+// writeFileAtomically writes data to a temporary file in the directory of path that is renamed to path once
+// complete, so the file at path is never partially written.
+func writeFileAtomically(path string, data []byte) error {
+	tmpFile, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	_, err = tmpFile.Write(data)
+	if err == nil {
+		err = tmpFile.Chmod(0o640)
+	}
+	if closeErr := tmpFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmpFile.Name(), path)
+	}
+	if err != nil {
+		utils.UncheckedError(os.Remove(tmpFile.Name()))
+	}
+	return err
+}
 
-	f := func() ([]byte, error) {
-		bytesRead, err := reader.Read(chunk)
+// resolveInternalStateExportPath returns path with the symlinks of its directory resolved if that directory is one
+// of allowedDirs or within one of them, so that neither ".." elements nor symlinks lead outside of allowedDirs.
+func resolveInternalStateExportPath(path string, allowedDirs []string) (string, error) {
+	path = filepath.Clean(path)
+	dir, err := filepath.EvalSymlinks(filepath.Dir(path))
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", errors.Wrap(ErrInternalStateDirNotFound, filepath.Dir(path))
+	}
+	if err != nil {
+		return "", err
+	}
+	for _, allowedDir := range allowedDirs {
+		allowedDir, err := filepath.EvalSymlinks(allowedDir)
 		if err != nil {
-			return nil, err
+			continue
+		}
+		rel, err := filepath.Rel(allowedDir, dir)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			continue
 		}
-		return chunk[:bytesRead], err
+		return filepath.Join(dir, filepath.Base(path)), nil
 	}
-	return f
+	return "", errors.Wrap(ErrInternalStatePathNotAllowed, path)
 }
 
 // Properties returns information regarding the current SLAM session including the mapping mode and
@@ -691,93 +2360,41 @@ func (cartoSvc *CartographerService) Properties(ctx context.Context) (slam.Prope
 	}
 
 	props.SensorInfo = append(props.SensorInfo, slam.SensorInfo{Name: cartoSvc.lidar.Name(), Type: slam.SensorTypeCamera})
+	for _, additionalLidar := range cartoSvc.additionalLidars {
+		props.SensorInfo = append(props.SensorInfo, slam.SensorInfo{Name: additionalLidar.Name(), Type: slam.SensorTypeCamera})
+	}
 	if cartoSvc.movementSensor != nil {
 		props.SensorInfo = append(props.SensorInfo, slam.SensorInfo{Name: cartoSvc.movementSensor.Name(), Type: slam.SensorTypeMovementSensor})
 	}
 
+	// a map without an existing map or a floor plan can only be localized against once set_mode switched to it
+	cartoSvc.cartoFacadeMu.RLock()
+	defer cartoSvc.cartoFacadeMu.RUnlock()
+	enableMapping, slamMode := cartoSvc.mode()
 	switch {
-	case cartoSvc.enableMapping && cartoSvc.existingMap == "":
+	case enableMapping && cartoSvc.existingMap == "":
 		props.MappingMode = slam.MappingModeNewMap
-	case cartoSvc.enableMapping && cartoSvc.existingMap != "":
+	case enableMapping && cartoSvc.existingMap != "":
 		props.MappingMode = slam.MappingModeUpdateExistingMap
-	case !cartoSvc.enableMapping && cartoSvc.existingMap != "":
+	case !enableMapping && (cartoSvc.existingMap != "" || cartoSvc.floorPlan != nil || slamMode == cartofacade.LocalizingMode):
 		props.MappingMode = slam.MappingModeLocalizationOnly
 	default:
-		return slam.Properties{}, errors.New("invalid mode: localizing requires an existing map")
+		return slam.Properties{}, errors.New("invalid mode: localizing requires an existing map or a floor plan")
 	}
 
 	return props, nil
 }
 
-// DoCommand receives arbitrary commands.
-func (cartoSvc *CartographerService) DoCommand(ctx context.Context, req map[string]interface{}) (map[string]interface{}, error) {
-	_, span := trace.StartSpan(ctx, "viamcartographer::CartographerService::DoCommand")
-	defer span.End()
-
-	if err := cartoSvc.isOpenAndRunningLocally("DoCommand"); err != nil {
-		return nil, err
-	}
-
-	if _, ok := req[JobDoneCommand]; ok {
-		return map[string]interface{}{JobDoneCommand: cartoSvc.jobDone.Load()}, nil
-	}
-
-	if _, ok := req[postprocess.ToggleCommand]; ok {
-		cartoSvc.postprocessed.Store(!cartoSvc.postprocessed.Load())
-		return map[string]interface{}{PostprocessToggleResponseKey: cartoSvc.postprocessed.Load()}, nil
-	}
-
-	if points, ok := req[postprocess.AddCommand]; ok {
-		task, err := postprocess.ParseDoCommand(points, postprocess.Add)
-		if err != nil {
-			return nil, errors.Wrap(ErrBadPostprocessingPointsFormat, err.Error())
-		}
-
-		cartoSvc.postprocessingTasks = append(cartoSvc.postprocessingTasks, task)
-		cartoSvc.postprocessed.Store(true)
-		return map[string]interface{}{postprocess.AddCommand: SuccessMessage}, nil
-	}
-
-	if points, ok := req[postprocess.RemoveCommand]; ok {
-		task, err := postprocess.ParseDoCommand(points, postprocess.Remove)
-		if err != nil {
-			return nil, errors.Wrap(ErrBadPostprocessingPointsFormat, err.Error())
-		}
-
-		cartoSvc.postprocessingTasks = append(cartoSvc.postprocessingTasks, task)
-		cartoSvc.postprocessed.Store(true)
-		return map[string]interface{}{postprocess.RemoveCommand: SuccessMessage}, nil
-	}
-
-	if _, ok := req[postprocess.UndoCommand]; ok {
-		if len(cartoSvc.postprocessingTasks) == 0 {
-			return nil, ErrNoPostprocessingToUndo
-		}
-
-		cartoSvc.postprocessingTasks = cartoSvc.postprocessingTasks[:len(cartoSvc.postprocessingTasks)-1]
-		return map[string]interface{}{postprocess.UndoCommand: SuccessMessage}, nil
-	}
-
-	if val, ok := req[postprocess.PathCommand]; ok {
-		path, ok := val.(string)
-		if !ok {
-			return nil, ErrBadPostprocessingPath
-		}
-
-		path = filepath.Clean(path)
-		bytes, err := os.ReadFile(path)
-		if err != nil {
-			return nil, err
-		}
-		cartoSvc.postprocessedPointCloud = &bytes
-		cartoSvc.postprocessed.Store(true)
-		return map[string]interface{}{postprocess.PathCommand: SuccessMessage}, nil
-	}
-
-	return nil, viamgrpc.UnimplementedError
+// mode returns whether the service adds to the map and the slam mode of cartographer, which set_mode may have
+// changed since the service was built.
+func (cartoSvc *CartographerService) mode() (bool, cartofacade.SlamMode) {
+	cartoSvc.modeMu.RLock()
+	defer cartoSvc.modeMu.RUnlock()
+	return cartoSvc.enableMapping, cartoSvc.SlamMode
 }
 
-// Close out of all slam related processes.
+// Close out of all slam related processes. The phases of closing run in the order of closePhase and the last
+// phase reached is logged once closing is complete.
 func (cartoSvc *CartographerService) Close(ctx context.Context) error {
 	cartoSvc.mu.Lock()
 	defer cartoSvc.mu.Unlock()
@@ -791,22 +2408,16 @@ func (cartoSvc *CartographerService) Close(ctx context.Context) error {
 		cartoSvc.logger.Warn("Close() called multiple times")
 		return nil
 	}
-	// stop sensor process workers
-	cartoSvc.cancelSensorProcessFunc()
-	cartoSvc.sensorProcessWorkers.Wait()
+	cartoSvcs.CompareAndDelete(cartoSvc.Name().Name, cartoSvc)
+	cameraClaims.release(cartoSvc)
 
-	// terminate carto facade
-	err := terminateCartoFacade(ctx, cartoSvc)
+	reached, err := cartoSvc.closeInPhases(ctx)
+	cartoSvc.closed = true
 	if err != nil {
-		cartoSvc.logger.Errorw("close hit error", "error", err)
+		cartoSvc.logger.Errorw("Closing complete", "phase", reached, "error", err)
+		return nil
 	}
-
-	// stop carto facade workers
-	cartoSvc.cancelCartoFacadeFunc()
-	cartoSvc.cartoFacadeWorkers.Wait()
-	cartoSvc.closed = true
-
-	cartoSvc.logger.Info("Closing complete")
+	cartoSvc.logger.Infow("Closing complete", "phase", reached)
 	return nil
 }
 
@@ -1,26 +1,52 @@
 package viamcartographer
 
 import (
+	"bytes"
 	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
 	"math"
 	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/golang/geo/r2"
 	"github.com/golang/geo/r3"
 	"github.com/pkg/errors"
 	commonv1 "go.viam.com/api/common/v1"
+	"go.viam.com/rdk/components/camera"
 	"go.viam.com/rdk/logging"
+	"go.viam.com/rdk/pointcloud"
 	"go.viam.com/rdk/resource"
 	"go.viam.com/rdk/services/slam"
 	"go.viam.com/rdk/spatialmath"
 	"go.viam.com/test"
 	"go.viam.com/utils/artifact"
+	"go.viam.com/utils/testutils"
 
 	"github.com/viam-modules/viam-cartographer/cartofacade"
+	vcConfig "github.com/viam-modules/viam-cartographer/config"
+	"github.com/viam-modules/viam-cartographer/floorplan"
+	"github.com/viam-modules/viam-cartographer/pbstream"
+	s "github.com/viam-modules/viam-cartographer/sensors"
 	"github.com/viam-modules/viam-cartographer/sensors/inject"
+	"github.com/viam-modules/viam-cartographer/testhelper/pcdtest"
 )
 
+// newTestService returns a service named test that calls into mockCartoFacade and logs to logger.
+func newTestService(mockCartoFacade *cartofacade.Mock, logger logging.Logger) *CartographerService {
+	return &CartographerService{
+		Named:       resource.NewName(slam.API, "test").AsNamed(),
+		cartofacade: mockCartoFacade,
+		logger:      logger,
+	}
+}
+
 func makeQuaternionFromGenericMap(quat map[string]interface{}) spatialmath.Orientation {
 	return &spatialmath.Quaternion{
 		Real: quat["real"].(float64),
@@ -282,6 +308,23 @@ func setMockInternalStateFunc(
 	) ([]byte, error) {
 		return pc, nil
 	}
+	mock.InternalStateStreamFunc = func(
+		ctx context.Context,
+		timeout time.Duration,
+	) (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(pc)), nil
+	}
+}
+
+// internalStateStreamMock is an internal state stream that records whether it was closed.
+type internalStateStreamMock struct {
+	io.Reader
+	closed atomic.Int64
+}
+
+func (m *internalStateStreamMock) Close() error {
+	m.closed.Add(1)
+	return nil
 }
 
 func TestInternalStateEndpoint(t *testing.T) {
@@ -302,17 +345,157 @@ func TestInternalStateEndpoint(t *testing.T) {
 	t.Run("cartofacade error", func(t *testing.T) {
 		setMockInternalStateFunc(mockCartoFacade, []byte{})
 
+		mockCartoFacade.InternalStateStreamFunc = func(
+			ctx context.Context,
+			timeout time.Duration,
+		) (io.ReadCloser, error) {
+			return nil, errors.New("test")
+		}
+
+		callback, err := svc.InternalState(context.Background())
+		test.That(t, callback, test.ShouldBeNil)
+		test.That(t, err, test.ShouldBeError, errors.New("test"))
+	})
+
+	internalState := make([]byte, 2*chunkSizeBytes+1)
+	for i := range internalState {
+		internalState[i] = byte(i % 251)
+	}
+
+	t.Run("falls back to copying the internal state in full if it can not be streamed", func(t *testing.T) {
+		setMockInternalStateFunc(mockCartoFacade, internalState)
+		mockCartoFacade.InternalStateStreamFunc = func(
+			ctx context.Context,
+			timeout time.Duration,
+		) (io.ReadCloser, error) {
+			return nil, cartofacade.ErrInternalStateStreamUnavailable
+		}
+		getAndCheckCallbackFunc(t, svc.InternalState, false, internalState)
+
 		mockCartoFacade.InternalStateFunc = func(
 			ctx context.Context,
 			timeout time.Duration,
 		) ([]byte, error) {
 			return nil, errors.New("test")
 		}
-
 		callback, err := svc.InternalState(context.Background())
 		test.That(t, callback, test.ShouldBeNil)
 		test.That(t, err, test.ShouldBeError, errors.New("test"))
 	})
+
+	t.Run("closes the stream once it has been read in full", func(t *testing.T) {
+		stream := &internalStateStreamMock{Reader: bytes.NewReader(internalState)}
+		mockCartoFacade.InternalStateStreamFunc = func(
+			ctx context.Context,
+			timeout time.Duration,
+		) (io.ReadCloser, error) {
+			return stream, nil
+		}
+		mockCartoFacade.InternalStateFunc = nil
+
+		callback, err := svc.InternalState(context.Background())
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, stream.closed.Load(), test.ShouldEqual, 0)
+		streamed, err := slam.HelperConcatenateChunksToFull(callback)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, streamed, test.ShouldResemble, internalState)
+		test.That(t, stream.closed.Load(), test.ShouldEqual, 1)
+	})
+
+	t.Run("closes the stream once the context is done", func(t *testing.T) {
+		stream := &internalStateStreamMock{Reader: bytes.NewReader(internalState)}
+		mockCartoFacade.InternalStateStreamFunc = func(
+			ctx context.Context,
+			timeout time.Duration,
+		) (io.ReadCloser, error) {
+			return stream, nil
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		callback, err := svc.InternalState(ctx)
+		test.That(t, err, test.ShouldBeNil)
+		chunk, err := callback()
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, chunk, test.ShouldResemble, internalState[:chunkSizeBytes])
+
+		cancel()
+		testutils.WaitForAssertion(t, func(tb testing.TB) {
+			tb.Helper()
+			test.That(tb, stream.closed.Load(), test.ShouldEqual, 1)
+		})
+	})
+}
+
+func TestChunkedEndpointsAtChunkSizeBoundaries(t *testing.T) {
+	svc := &CartographerService{Named: resource.NewName(slam.API, "test").AsNamed()}
+	mockCartoFacade := &cartofacade.Mock{}
+	svc.cartofacade = mockCartoFacade
+
+	endpoints := map[string]struct {
+		callbackFunc func(ctx context.Context) (func() ([]byte, error), error)
+		setMockFunc  func(mock *cartofacade.Mock, b []byte)
+	}{
+		"PointCloudMap": {
+			callbackFunc: func(ctx context.Context) (func() ([]byte, error), error) { return svc.PointCloudMap(ctx, false) },
+			setMockFunc:  setMockPointCloudFunc,
+		},
+		"InternalState": {
+			callbackFunc: svc.InternalState,
+			setMockFunc:  setMockInternalStateFunc,
+		},
+	}
+
+	for name, endpoint := range endpoints {
+		for _, size := range []int{
+			1,
+			chunkSizeBytes - 1,
+			chunkSizeBytes,
+			chunkSizeBytes + 1,
+			2*chunkSizeBytes - 1,
+			2 * chunkSizeBytes,
+			2*chunkSizeBytes + 1,
+		} {
+			t.Run(fmt.Sprintf("%s returns non-empty chunks then only io.EOF for %d bytes", name, size), func(t *testing.T) {
+				payload := make([]byte, size)
+				for i := range payload {
+					payload[i] = byte(i % 251)
+				}
+				endpoint.setMockFunc(mockCartoFacade, payload)
+
+				callback, err := endpoint.callbackFunc(context.Background())
+				test.That(t, err, test.ShouldBeNil)
+
+				var chunks [][]byte
+				for {
+					chunk, err := callback()
+					if err != nil {
+						test.That(t, err, test.ShouldEqual, io.EOF)
+						test.That(t, chunk, test.ShouldBeNil)
+						break
+					}
+					test.That(t, len(chunk), test.ShouldBeGreaterThan, 0)
+					test.That(t, len(chunk), test.ShouldBeLessThanOrEqualTo, chunkSizeBytes)
+					chunks = append(chunks, chunk)
+				}
+				test.That(t, len(chunks), test.ShouldEqual, (size+chunkSizeBytes-1)/chunkSizeBytes)
+				// earlier chunks are still intact after the last call
+				test.That(t, bytes.Join(chunks, nil), test.ShouldResemble, payload)
+
+				chunk, err := callback()
+				test.That(t, err, test.ShouldEqual, io.EOF)
+				test.That(t, chunk, test.ShouldBeNil)
+			})
+		}
+
+		t.Run(fmt.Sprintf("%s returns only io.EOF for an empty payload", name), func(t *testing.T) {
+			endpoint.setMockFunc(mockCartoFacade, []byte{})
+			callback, err := endpoint.callbackFunc(context.Background())
+			test.That(t, err, test.ShouldBeNil)
+			chunk, err := callback()
+			test.That(t, err, test.ShouldEqual, io.EOF)
+			test.That(t, chunk, test.ShouldBeNil)
+		})
+	}
 }
 
 func TestParseCartoAlgoConfig(t *testing.T) {
@@ -336,7 +519,7 @@ func TestParseCartoAlgoConfig(t *testing.T) {
 		}
 
 		configParams := map[string]string{}
-		cartoAlgoConfig, err := parseCartoAlgoConfig(configParams, logger)
+		cartoAlgoConfig, _, err := parseCartoAlgoConfig(configParams, logger)
 		test.That(t, err, test.ShouldBeNil)
 		test.That(t, cartoAlgoConfig, test.ShouldResemble, defaultCartoAlgoCfg)
 	})
@@ -348,7 +531,7 @@ func TestParseCartoAlgoConfig(t *testing.T) {
 			"num_range_data":          "2",
 			"missing_data_ray_length": "3.0",
 			"max_range":               "4.0",
-			"min_range":               "5.0",
+			"min_range":               "0.5",
 			"max_submaps_to_keep":     "6",
 			"fresh_submaps_count":     "7",
 			"min_covered_area":        "8.0",
@@ -364,7 +547,7 @@ func TestParseCartoAlgoConfig(t *testing.T) {
 			NumRangeData:         2,
 			MissingDataRayLength: 3.0,
 			MaxRange:             4.0,
-			MinRange:             5.0,
+			MinRange:             0.5,
 			MaxSubmapsToKeep:     6,
 			FreshSubmapsCount:    7,
 			MinCoveredArea:       8.0,
@@ -374,7 +557,7 @@ func TestParseCartoAlgoConfig(t *testing.T) {
 			RotationWeight:       12.0,
 		}
 
-		cartoAlgoConfig, err := parseCartoAlgoConfig(configParams, logger)
+		cartoAlgoConfig, _, err := parseCartoAlgoConfig(configParams, logger)
 		test.That(t, err, test.ShouldBeNil)
 		test.That(t, cartoAlgoConfig, test.ShouldResemble, overRidenCartoAlgoCfg)
 	})
@@ -386,7 +569,7 @@ func TestParseCartoAlgoConfig(t *testing.T) {
 			"num_range_data":                  "2",
 			"missing_data_ray_length_meters":  "3.0",
 			"max_range_meters":                "4.0",
-			"min_range_meters":                "5.0",
+			"min_range_meters":                "0.5",
 			"max_submaps_to_keep":             "6",
 			"fresh_submaps_count":             "7",
 			"min_covered_area_meters_squared": "8.0",
@@ -402,7 +585,7 @@ func TestParseCartoAlgoConfig(t *testing.T) {
 			NumRangeData:         2,
 			MissingDataRayLength: 3.0,
 			MaxRange:             4.0,
-			MinRange:             5.0,
+			MinRange:             0.5,
 			MaxSubmapsToKeep:     6,
 			FreshSubmapsCount:    7,
 			MinCoveredArea:       8.0,
@@ -412,7 +595,7 @@ func TestParseCartoAlgoConfig(t *testing.T) {
 			RotationWeight:       12.0,
 		}
 
-		cartoAlgoConfig, err := parseCartoAlgoConfig(configParams, logger)
+		cartoAlgoConfig, _, err := parseCartoAlgoConfig(configParams, logger)
 		test.That(t, err, test.ShouldBeNil)
 		test.That(t, cartoAlgoConfig, test.ShouldResemble, overRidenCartoAlgoCfg)
 	})
@@ -423,7 +606,7 @@ func TestParseCartoAlgoConfig(t *testing.T) {
 			"invalid_param":     "hihi",
 		}
 
-		_, err := parseCartoAlgoConfig(configParams, logger)
+		_, _, err := parseCartoAlgoConfig(configParams, logger)
 		test.That(t, err, test.ShouldBeNil)
 	})
 
@@ -432,9 +615,156 @@ func TestParseCartoAlgoConfig(t *testing.T) {
 			"optimize_every_n_nodes": "hihi",
 		}
 
-		cartoAlgoConfig, err := parseCartoAlgoConfig(configParams, logger)
-		test.That(t, err, test.ShouldBeError, errors.New("strconv.Atoi: parsing \"hihi\": invalid syntax"))
-		test.That(t, cartoAlgoConfig.OptimizeEveryNNodes, test.ShouldResemble, 0)
+		cartoAlgoConfig, _, err := parseCartoAlgoConfig(configParams, logger)
+		test.That(t, err, test.ShouldBeError, errors.New(
+			"invalid config_params: config_params[optimize_every_n_nodes] is \"hihi\", expected an integer >= 0"))
+		test.That(t, cartoAlgoConfig.OptimizeEveryNNodes, test.ShouldEqual, defaultCartoAlgoCfg.OptimizeEveryNNodes)
+
+		// cartographer takes the ranges as float32
+		_, _, err = parseCartoAlgoConfig(map[string]string{"max_range": "1e39"}, logger)
+		test.That(t, err, test.ShouldBeError, errors.New(
+			"invalid config_params: config_params[max_range] is \"1e39\", expected a number <= 3.4028234663852886e+38"))
+	})
+
+	for _, tc := range []struct {
+		key      string
+		valid    []string
+		invalid  []string
+		expected string
+	}{
+		{key: "optimize_on_start", valid: []string{"true", "false"}, invalid: []string{"yes"}, expected: "true or false"},
+		{key: "optimize_every_n_nodes", valid: []string{"0", "5"}, invalid: []string{"-1", "1.5"}, expected: "an integer >= 0"},
+		{key: "num_range_data", valid: []string{"1", "100"}, invalid: []string{"0", "-3", "ten"}, expected: "an integer >= 1"},
+		{key: "missing_data_ray_length", valid: []string{"0.5", "3"}, invalid: []string{"0", "-1", "NaN"}, expected: "a number > 0"},
+		{key: "missing_data_ray_length_meters", valid: []string{"3"}, invalid: []string{"0"}, expected: "a number > 0"},
+		{key: "max_range", valid: []string{"1", "12.5"}, invalid: []string{"0", "-25", "+Inf"}, expected: "a number > 0"},
+		{key: "max_range_meters", valid: []string{"12.5"}, invalid: []string{"-25"}, expected: "a number > 0"},
+		{key: "min_range", valid: []string{"0", "0.5"}, invalid: []string{"-0.2", "near"}, expected: "a number >= 0"},
+		{key: "min_range_meters", valid: []string{"0.5"}, invalid: []string{"-0.2"}, expected: "a number >= 0"},
+		{key: "max_submaps_to_keep", valid: []string{"2", "10"}, invalid: []string{"1", "0"}, expected: "an integer >= 2"},
+		{key: "fresh_submaps_count", valid: []string{"0", "3"}, invalid: []string{"-1"}, expected: "an integer >= 0"},
+		{key: "min_covered_area", valid: []string{"0", "1.5"}, invalid: []string{"-1"}, expected: "a number >= 0"},
+		{key: "min_covered_area_meters_squared", valid: []string{"1.5"}, invalid: []string{"-1"}, expected: "a number >= 0"},
+		{key: "min_added_submaps_count", valid: []string{"0", "1"}, invalid: []string{"-1", "one"}, expected: "an integer >= 0"},
+		{key: "occupied_space_weight", valid: []string{"0", "20"}, invalid: []string{"-20", "heavy"}, expected: "a number >= 0"},
+		{key: "translation_weight", valid: []string{"0", "10"}, invalid: []string{"-10"}, expected: "a number >= 0"},
+		{key: "rotation_weight", valid: []string{"0", "1"}, invalid: []string{"-1"}, expected: "a number >= 0"},
+		{
+			key:      "initial_starting_pose",
+			valid:    []string{"X:1, Y:2, Theta:3"},
+			invalid:  []string{"1, 2, 3"},
+			expected: "the format 'X:<val>, Y:<val>, Theta:<val>'",
+		},
+	} {
+		t.Run(fmt.Sprintf("validates the values of %s", tc.key), func(t *testing.T) {
+			for _, val := range tc.valid {
+				_, _, err := parseCartoAlgoConfig(map[string]string{tc.key: val}, logger)
+				test.That(t, err, test.ShouldBeNil)
+			}
+			for _, val := range tc.invalid {
+				_, _, err := parseCartoAlgoConfig(map[string]string{tc.key: val}, logger)
+				test.That(t, err, test.ShouldBeError, errors.Errorf("invalid config_params: config_params[%s] is %q, expected %s",
+					tc.key, val, tc.expected))
+			}
+		})
+	}
+
+	t.Run("returns an error naming every invalid param", func(t *testing.T) {
+		configParams := map[string]string{
+			"num_range_data":         "0",
+			"occupied_space_weight":  "-1",
+			"optimize_every_n_nodes": "hihi",
+			"translation_weight":     "10",
+			"unknown_param":          "hihi",
+		}
+		_, unused, err := parseCartoAlgoConfig(configParams, logger)
+		test.That(t, err, test.ShouldBeError, errors.New("invalid config_params: "+
+			"config_params[num_range_data] is \"0\", expected an integer >= 1; "+
+			"config_params[occupied_space_weight] is \"-1\", expected a number >= 0; "+
+			"config_params[optimize_every_n_nodes] is \"hihi\", expected an integer >= 0"))
+		test.That(t, unused, test.ShouldBeNil)
+	})
+
+	t.Run("returns error when min_range is not less than max_range", func(t *testing.T) {
+		_, _, err := parseCartoAlgoConfig(map[string]string{"min_range": "5", "max_range": "4"}, logger)
+		test.That(t, err, test.ShouldBeError, errors.New(
+			"invalid config_params: config_params[min_range] is 5, expected < config_params[max_range], which is 4"))
+
+		_, _, err = parseCartoAlgoConfig(map[string]string{"min_range_meters": "30"}, logger)
+		test.That(t, err, test.ShouldBeError, errors.New(
+			"invalid config_params: config_params[min_range_meters] is 30, expected < config_params[max_range], which is 25"))
+
+		// an invalid max_range is not compared, as it falls back to its default
+		_, _, err = parseCartoAlgoConfig(map[string]string{"min_range": "30", "max_range_meters": "far"}, logger)
+		test.That(t, err, test.ShouldBeError, errors.New(
+			"invalid config_params: config_params[max_range_meters] is \"far\", expected a number > 0"))
+	})
+
+	t.Run("the initial starting pose is exact when no standard deviations are given", func(t *testing.T) {
+		configParams := map[string]string{"initial_starting_pose": "X:1, Y:2, Theta:3"}
+
+		cartoAlgoConfig, _, err := parseCartoAlgoConfig(configParams, logger)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, cartoAlgoConfig.HasInitialTrajectoryPose, test.ShouldBeTrue)
+		test.That(t, cartoAlgoConfig.InitialTrajectoryPoseX, test.ShouldEqual, 1)
+		test.That(t, cartoAlgoConfig.InitialTrajectoryPoseY, test.ShouldEqual, 2)
+		test.That(t, cartoAlgoConfig.InitialTrajectoryPoseTheta, test.ShouldEqual, 3)
+		test.That(t, cartoAlgoConfig.HasInitialTrajectoryPoseSigma, test.ShouldBeFalse)
+		_, ok := cartoAlgoConfig.ToMap()["initial_starting_pose_sigma"]
+		test.That(t, ok, test.ShouldBeFalse)
+	})
+
+	t.Run("returns the standard deviations of the initial starting pose", func(t *testing.T) {
+		configParams := map[string]string{
+			"initial_starting_pose":       "X:1, Y:2, Theta:3",
+			"initial_starting_pose_sigma": "X:0.5, Y:0.25, Theta:10",
+		}
+
+		cartoAlgoConfig, _, err := parseCartoAlgoConfig(configParams, logger)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, cartoAlgoConfig.HasInitialTrajectoryPose, test.ShouldBeTrue)
+		test.That(t, cartoAlgoConfig.HasInitialTrajectoryPoseSigma, test.ShouldBeTrue)
+		test.That(t, cartoAlgoConfig.InitialTrajectoryPoseSigmaX, test.ShouldEqual, 0.5)
+		test.That(t, cartoAlgoConfig.InitialTrajectoryPoseSigmaY, test.ShouldEqual, 0.25)
+		test.That(t, cartoAlgoConfig.InitialTrajectoryPoseSigmaTheta, test.ShouldEqual, 10)
+		test.That(t, cartoAlgoConfig.ToMap()["initial_starting_pose_sigma"], test.ShouldResemble,
+			map[string]interface{}{"x": 0.5, "y": 0.25, "theta": 10.0})
+	})
+
+	t.Run("returns error when the standard deviations of the initial starting pose are invalid", func(t *testing.T) {
+		configParams := map[string]string{
+			"initial_starting_pose":       "X:1, Y:2, Theta:3",
+			"initial_starting_pose_sigma": "0.5, 0.25, 10",
+		}
+		_, _, err := parseCartoAlgoConfig(configParams, logger)
+		test.That(t, err, test.ShouldBeError, errors.New("invalid config_params: "+
+			"config_params[initial_starting_pose_sigma] is \"0.5, 0.25, 10\", expected the format 'X:<val>, Y:<val>, Theta:<val>'"))
+
+		configParams["initial_starting_pose_sigma"] = "X:0.5, Y:-0.25, Theta:10"
+		_, _, err = parseCartoAlgoConfig(configParams, logger)
+		test.That(t, err, test.ShouldBeError, errors.New("invalid config_params: "+
+			"config_params[initial_starting_pose_sigma] is \"X:0.5, Y:-0.25, Theta:10\", "+
+			"expected numbers >= 0 in the format 'X:<val>, Y:<val>, Theta:<val>'"))
+	})
+
+	t.Run("returns the keys that are not algo config params", func(t *testing.T) {
+		logger, obs := logging.NewObservedTestLogger(t)
+		configParams := map[string]string{"mode": "2d", "max_range": "10", "test_param": "viam", "another_param": "1"}
+		cartoAlgoConfig, unused, err := parseCartoAlgoConfig(configParams, logger)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, cartoAlgoConfig.MaxRange, test.ShouldEqual, 10)
+		test.That(t, unused, test.ShouldResemble, []string{"another_param", "test_param"})
+		// the keys are logged together
+		warnings := obs.FilterMessageSnippet("unused config params").All()
+		test.That(t, warnings, test.ShouldHaveLength, 1)
+		test.That(t, warnings[0].Message, test.ShouldContainSubstring, "another_param, test_param")
+	})
+
+	t.Run("returns error when the standard deviations are given without an initial starting pose", func(t *testing.T) {
+		configParams := map[string]string{"initial_starting_pose_sigma": "X:0.5, Y:0.25, Theta:10"}
+		_, _, err := parseCartoAlgoConfig(configParams, logger)
+		test.That(t, err, test.ShouldBeError, errors.New(
+			"invalid config_params: config_params[initial_starting_pose_sigma] requires config_params[initial_starting_pose] to be set"))
 	})
 }
 
@@ -485,3 +815,1033 @@ func TestBuiltinQuaternion(t *testing.T) {
 		test.That(t, pose, test.ShouldBeNil)
 	})
 }
+
+func TestWarnAlgoConfigDifferences(t *testing.T) {
+	t.Run("warns once per differing value", func(t *testing.T) {
+		logger, obs := logging.NewObservedTestLogger(t)
+		applied := defaultCartoAlgoCfg
+		applied.MaxRange = 10
+		applied.OptimizeEveryNNodes = 0
+
+		returned := warnAlgoConfigDifferences(logger, defaultCartoAlgoCfg, applied, cartofacade.MappingMode)
+		warnings := obs.FilterMessageSnippet("cartographer is operating with").All()
+		test.That(t, len(warnings), test.ShouldEqual, 2)
+		test.That(t, warnings[0].Message, test.ShouldContainSubstring, "max_range")
+		test.That(t, warnings[1].Message, test.ShouldContainSubstring, "optimize_every_n_nodes")
+		test.That(t, returned, test.ShouldResemble, []string{warnings[0].Message, warnings[1].Message})
+	})
+
+	t.Run("does not warn when cartographer is operating with the requested config", func(t *testing.T) {
+		logger, obs := logging.NewObservedTestLogger(t)
+		returned := warnAlgoConfigDifferences(logger, defaultCartoAlgoCfg, defaultCartoAlgoCfg, cartofacade.MappingMode)
+		test.That(t, obs.FilterMessageSnippet("cartographer is operating with").Len(), test.ShouldEqual, 0)
+		test.That(t, returned, test.ShouldBeEmpty)
+	})
+}
+
+func writeTestPbstream(t *testing.T, path string, truncate bool, modTime time.Time) {
+	t.Helper()
+	// cartographer pbstream framing: magic number followed by size prefixed records
+	data := binary.LittleEndian.AppendUint64(nil, 0x7b1d1f7b5bf501db)
+	data = binary.LittleEndian.AppendUint64(data, 4)
+	data = append(data, []byte("test")...)
+	if truncate {
+		data = data[:len(data)-1]
+	}
+	test.That(t, os.WriteFile(path, data, 0o600), test.ShouldBeNil)
+	test.That(t, os.Chtimes(path, modTime, modTime), test.ShouldBeNil)
+}
+
+func TestResolveExistingMap(t *testing.T) {
+	now := time.Now()
+
+	t.Run("intact existing map is used as is", func(t *testing.T) {
+		logger := logging.NewTestLogger(t)
+		existingMap := filepath.Join(t.TempDir(), "internal_state_1.pbstream")
+		writeTestPbstream(t, existingMap, false, now)
+
+		resolved, err := resolveExistingMap(existingMap, "", false, logger)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, resolved, test.ShouldEqual, existingMap)
+	})
+
+	t.Run("existing map that is not a valid internal state is refused", func(t *testing.T) {
+		logger := logging.NewTestLogger(t)
+		dir := t.TempDir()
+		writeTestPbstream(t, filepath.Join(dir, "internal_state_0.pbstream"), false, now.Add(-time.Minute))
+
+		invalidMagic := filepath.Join(dir, "internal_state_1.pbstream")
+		test.That(t, os.WriteFile(invalidMagic, []byte("not an internal state"), 0o600), test.ShouldBeNil)
+		resolved, err := resolveExistingMap(invalidMagic, "", true, logger)
+		test.That(t, err, test.ShouldWrap, pbstream.ErrInvalidMagic)
+		test.That(t, resolved, test.ShouldBeEmpty)
+
+		noRecords := filepath.Join(dir, "internal_state_2.pbstream")
+		test.That(t, os.WriteFile(noRecords, binary.LittleEndian.AppendUint64(nil, 0x7b1d1f7b5bf501db), 0o600),
+			test.ShouldBeNil)
+		resolved, err = resolveExistingMap(noRecords, "", true, logger)
+		test.That(t, err, test.ShouldWrap, pbstream.ErrNoRecords)
+		test.That(t, resolved, test.ShouldBeEmpty)
+
+		resolved, err = resolveExistingMap(filepath.Join(dir, "missing.pbstream"), "", true, logger)
+		test.That(t, errors.Is(err, os.ErrNotExist), test.ShouldBeTrue)
+		test.That(t, resolved, test.ShouldBeEmpty)
+	})
+
+	t.Run("truncated existing map without a fallback present is refused", func(t *testing.T) {
+		logger, obs := logging.NewObservedTestLogger(t)
+		existingMap := filepath.Join(t.TempDir(), "internal_state_1.pbstream")
+		writeTestPbstream(t, existingMap, true, now)
+
+		resolved, err := resolveExistingMap(existingMap, "", true, logger)
+		test.That(t, err, test.ShouldWrap, pbstream.ErrTruncated)
+		test.That(t, resolved, test.ShouldBeEmpty)
+
+		logs := obs.FilterMessageSnippet("no previous intact internal state").All()
+		test.That(t, len(logs), test.ShouldEqual, 1)
+		test.That(t, logs[0].ContextMap()["existing_map"], test.ShouldEqual, existingMap)
+	})
+
+	t.Run("truncated existing map with a fallback present is refused when fallback is disabled", func(t *testing.T) {
+		logger, obs := logging.NewObservedTestLogger(t)
+		dir := t.TempDir()
+		previous := filepath.Join(dir, "internal_state_0.pbstream")
+		writeTestPbstream(t, previous, false, now.Add(-time.Minute))
+		existingMap := filepath.Join(dir, "internal_state_1.pbstream")
+		writeTestPbstream(t, existingMap, true, now)
+
+		resolved, err := resolveExistingMap(existingMap, "", false, logger)
+		test.That(t, err, test.ShouldWrap, pbstream.ErrTruncated)
+		test.That(t, err.Error(), test.ShouldContainSubstring, previous)
+		test.That(t, resolved, test.ShouldBeEmpty)
+
+		logs := obs.FilterMessageSnippet("set fallback_to_previous_internal_state").All()
+		test.That(t, len(logs), test.ShouldEqual, 1)
+		test.That(t, logs[0].ContextMap()["existing_map"], test.ShouldEqual, existingMap)
+		test.That(t, logs[0].ContextMap()["previous_internal_state"], test.ShouldEqual, previous)
+	})
+
+	t.Run("truncated existing map falls back to the previous intact internal state", func(t *testing.T) {
+		logger, obs := logging.NewObservedTestLogger(t)
+		dir := t.TempDir()
+		previous := filepath.Join(dir, "internal_state_0.pbstream")
+		writeTestPbstream(t, previous, false, now.Add(-time.Minute))
+		existingMap := filepath.Join(dir, "internal_state_1.pbstream")
+		writeTestPbstream(t, existingMap, true, now)
+
+		resolved, err := resolveExistingMap(existingMap, "", true, logger)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, resolved, test.ShouldEqual, previous)
+
+		logs := obs.FilterMessageSnippet("falling back to the previous intact internal state").All()
+		test.That(t, len(logs), test.ShouldEqual, 1)
+		test.That(t, logs[0].ContextMap()["existing_map"], test.ShouldEqual, existingMap)
+		test.That(t, logs[0].ContextMap()["previous_internal_state"], test.ShouldEqual, previous)
+	})
+
+	t.Run("truncated existing map falls back to the previous intact auto-save in the state dir", func(t *testing.T) {
+		logger, obs := logging.NewObservedTestLogger(t)
+		deployDir := t.TempDir()
+		stateDir := t.TempDir()
+		// the previous auto-save in the state dir is newer than the previous internal state next to the existing map
+		writeTestPbstream(t, filepath.Join(deployDir, "internal_state_0.pbstream"), false, now.Add(-2*time.Minute))
+		previous := filepath.Join(stateDir, "autosave_1.pbstream")
+		writeTestPbstream(t, previous, false, now.Add(-time.Minute))
+		writeTestPbstream(t, filepath.Join(stateDir, "autosave_3.pbstream"), false, now.Add(time.Minute))
+		existingMap := filepath.Join(deployDir, "internal_state_2.pbstream")
+		writeTestPbstream(t, existingMap, true, now)
+
+		resolved, err := resolveExistingMap(existingMap, stateDir, true, logger)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, resolved, test.ShouldEqual, previous)
+
+		logs := obs.FilterMessageSnippet("falling back to the previous intact internal state").All()
+		test.That(t, len(logs), test.ShouldEqual, 1)
+		test.That(t, logs[0].ContextMap()["previous_internal_state"], test.ShouldEqual, previous)
+	})
+
+	t.Run("truncated existing map without a fallback in the state dir or next to it is refused", func(t *testing.T) {
+		logger := logging.NewTestLogger(t)
+		existingMap := filepath.Join(t.TempDir(), "internal_state_1.pbstream")
+		writeTestPbstream(t, existingMap, true, now)
+
+		resolved, err := resolveExistingMap(existingMap, t.TempDir(), true, logger)
+		test.That(t, err, test.ShouldWrap, pbstream.ErrTruncated)
+		test.That(t, resolved, test.ShouldBeEmpty)
+	})
+}
+
+func TestWarnUnsupportedSensorNames(t *testing.T) {
+	svc := &CartographerService{}
+	svc.warnUnsupportedSensorNames(cartofacade.CartoConfig{
+		Camera:            "front lidar",
+		MovementSensor:    "cart:base/imu",
+		AdditionalCameras: []string{"cart:rear/lidar"},
+	})
+	warnings, _ := svc.constructionWarnings.toList()
+	test.That(t, warnings, test.ShouldBeEmpty)
+
+	svc.warnUnsupportedSensorNames(cartofacade.CartoConfig{
+		Camera:            "front lidar",
+		AdditionalCameras: []string{"rear\xfflidar", "side\nlidar"},
+	})
+	warnings, _ = svc.constructionWarnings.toList()
+	test.That(t, warnings, test.ShouldResemble, []interface{}{
+		map[string]interface{}{
+			"code":    WarningUnsupportedSensorName,
+			"message": `sensor name "rear\xfflidar" is not valid UTF-8, so the internal state holding it cannot be loaded`,
+		},
+		map[string]interface{}{
+			"code":    WarningUnsupportedSensorName,
+			"message": `sensor name "side\nlidar" holds control characters, which garble the logs of the cartofacade`,
+		},
+	})
+}
+
+func TestMigrateExistingMap(t *testing.T) {
+	existingMap := filepath.Join(t.TempDir(), "internal_state_1.pbstream")
+
+	t.Run("an internal state of the current version is used as is", func(t *testing.T) {
+		logger := logging.NewTestLogger(t)
+		lib := &cartofacade.CartoLibMock{
+			InternalStateVersionFunc: func(path string) (cartofacade.InternalStateVersion, error) {
+				test.That(t, path, test.ShouldEqual, existingMap)
+				return cartofacade.InternalStateVersion{Version: 2, CurrentVersion: 2}, nil
+			},
+			MigrateInternalStateFunc: func(src, dst string) error {
+				t.Fatal("an internal state of the current version must not be migrated")
+				return nil
+			},
+		}
+
+		resolved, err := migrateExistingMap(lib, existingMap, t.TempDir(), logger)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, resolved, test.ShouldEqual, existingMap)
+	})
+
+	t.Run("an internal state is used as is if its version is unavailable", func(t *testing.T) {
+		logger := logging.NewTestLogger(t)
+		lib := &cartofacade.CartoLibMock{
+			InternalStateVersionFunc: func(path string) (cartofacade.InternalStateVersion, error) {
+				return cartofacade.InternalStateVersion{}, cartofacade.ErrInternalStateVersionUnavailable
+			},
+		}
+
+		resolved, err := migrateExistingMap(lib, existingMap, t.TempDir(), logger)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, resolved, test.ShouldEqual, existingMap)
+	})
+
+	t.Run("an internal state of an older version is migrated into the migration dir", func(t *testing.T) {
+		logger, obs := logging.NewObservedTestLogger(t)
+		migrationDir := filepath.Join(t.TempDir(), "migrated")
+		lib := &cartofacade.CartoLibMock{
+			InternalStateVersionFunc: func(path string) (cartofacade.InternalStateVersion, error) {
+				return cartofacade.InternalStateVersion{Version: 1, CurrentVersion: 2}, nil
+			},
+			MigrateInternalStateFunc: func(src, dst string) error {
+				test.That(t, src, test.ShouldEqual, existingMap)
+				return os.WriteFile(dst, []byte("migrated"), 0o600)
+			},
+		}
+
+		resolved, err := migrateExistingMap(lib, existingMap, migrationDir, logger)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, resolved, test.ShouldEqual, filepath.Join(migrationDir, "internal_state_1_v2.pbstream"))
+		content, err := os.ReadFile(resolved)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, string(content), test.ShouldEqual, "migrated")
+
+		logs := obs.FilterMessageSnippet("migrating it").All()
+		test.That(t, len(logs), test.ShouldEqual, 1)
+		test.That(t, logs[0].ContextMap()["version"], test.ShouldEqual, 1)
+		test.That(t, logs[0].ContextMap()["current_version"], test.ShouldEqual, 2)
+	})
+
+	t.Run("an internal state which cannot be migrated is refused naming both versions", func(t *testing.T) {
+		logger := logging.NewTestLogger(t)
+		migrationDir := t.TempDir()
+		lib := &cartofacade.CartoLibMock{
+			InternalStateVersionFunc: func(path string) (cartofacade.InternalStateVersion, error) {
+				return cartofacade.InternalStateVersion{Version: 3, CurrentVersion: 2}, nil
+			},
+			MigrateInternalStateFunc: func(src, dst string) error {
+				return cartofacade.ErrInternalStateMigrationUnsupported
+			},
+		}
+
+		resolved, err := migrateExistingMap(lib, existingMap, migrationDir, logger)
+		test.That(t, err, test.ShouldWrap, cartofacade.ErrInternalStateMigrationUnsupported)
+		test.That(t, err.Error(), test.ShouldContainSubstring, "internal state version 3")
+		test.That(t, err.Error(), test.ShouldContainSubstring, "current version 2")
+		test.That(t, resolved, test.ShouldBeEmpty)
+		entries, err := os.ReadDir(migrationDir)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, entries, test.ShouldBeEmpty)
+	})
+
+	t.Run("an internal state whose version cannot be probed is refused", func(t *testing.T) {
+		logger := logging.NewTestLogger(t)
+		lib := &cartofacade.CartoLibMock{
+			InternalStateVersionFunc: func(path string) (cartofacade.InternalStateVersion, error) {
+				return cartofacade.InternalStateVersion{}, errors.New("VIAM_CARTO_INTERNAL_STATE_INVALID")
+			},
+		}
+
+		_, err := migrateExistingMap(lib, existingMap, t.TempDir(), logger)
+		test.That(t, err, test.ShouldBeError,
+			"failed to probe the internal state version of existing_map "+existingMap+": VIAM_CARTO_INTERNAL_STATE_INVALID")
+	})
+}
+
+func TestNewAdditionalLidars(t *testing.T) {
+	logger := logging.NewTestLogger(t)
+	deps := s.SetupDeps(s.GoodLidar, s.NoMovementSensor)
+	deps[camera.Named("other_lidar")] = deps[camera.Named(string(s.GoodLidar))]
+	// the point of the other lidar, s.TestLidarPoint, is 200mm in front of the base, but 1000mm from the lidar
+	additionalLidarsCfg := []vcConfig.AdditionalLidar{
+		{Name: string(s.GoodLidar)},
+		{Name: "other_lidar", Extrinsics: &vcConfig.Extrinsics{X: -800, OZ: 1}},
+	}
+
+	// readingPoints returns the points of the next reading of each lidar
+	readingPoints := func(t *testing.T, lidars []s.TimedLidar) [][]r3.Vector {
+		t.Helper()
+		var points [][]r3.Vector
+		for _, lidar := range lidars {
+			reading, err := lidar.TimedLidarReading(context.Background())
+			test.That(t, err, test.ShouldBeNil)
+			pc, err := pointcloud.ReadPCD(bytes.NewReader(reading.Reading))
+			test.That(t, err, test.ShouldBeNil)
+			var lidarPoints []r3.Vector
+			pc.Iterate(0, 0, func(p r3.Vector, d pointcloud.Data) bool {
+				lidarPoints = append(lidarPoints, p)
+				return true
+			})
+			points = append(points, lidarPoints)
+		}
+		return points
+	}
+
+	t.Run("filters the points of every additional lidar by its own filter in its own frame", func(t *testing.T) {
+		filteredLidarsCfg := []vcConfig.AdditionalLidar{
+			{Name: string(s.GoodLidar), PointFilter: s.LidarPointFilter{MinRangeMm: 500}},
+			{
+				Name:        "other_lidar",
+				Extrinsics:  &vcConfig.Extrinsics{X: -800, OZ: 1},
+				PointFilter: s.LidarPointFilter{MaxRangeMm: 500},
+			},
+		}
+		lidars, err := newAdditionalLidars(context.Background(), deps, filteredLidarsCfg, logger)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, len(lidars), test.ShouldEqual, 2)
+		test.That(t, lidars[0].Name(), test.ShouldEqual, string(s.GoodLidar))
+		test.That(t, lidars[1].Name(), test.ShouldEqual, "other_lidar")
+		test.That(t, readingPoints(t, lidars), test.ShouldResemble, [][]r3.Vector{{s.TestLidarPoint}, nil})
+	})
+
+	t.Run("transforms the points every additional lidar keeps by its extrinsics", func(t *testing.T) {
+		lidars, err := newAdditionalLidars(context.Background(), deps, additionalLidarsCfg, logger)
+		test.That(t, err, test.ShouldBeNil)
+		points := readingPoints(t, lidars)
+		test.That(t, points[0], test.ShouldResemble, []r3.Vector{s.TestLidarPoint})
+		test.That(t, len(points[1]), test.ShouldEqual, 1)
+		test.That(t, points[1][0].X, test.ShouldAlmostEqual, 200)
+		test.That(t, points[1][0].Y, test.ShouldAlmostEqual, 0)
+	})
+
+	t.Run("fails if an additional lidar is missing", func(t *testing.T) {
+		_, err := newAdditionalLidars(context.Background(), deps,
+			[]vcConfig.AdditionalLidar{{Name: "missing_lidar"}}, logger)
+		test.That(t, err, test.ShouldNotBeNil)
+	})
+}
+
+func TestLoadFloorPlan(t *testing.T) {
+	t.Run("converts the image and logs the cells", func(t *testing.T) {
+		logger, obs := logging.NewObservedTestLogger(t)
+		image := filepath.Join(t.TempDir(), "map.pgm")
+		test.That(t, os.WriteFile(image, []byte("P2 3 1 255 0 205 254\n"), 0o600), test.ShouldBeNil)
+
+		floorPlan, err := loadFloorPlan(&vcConfig.FloorPlan{
+			Image:        image,
+			ResolutionMm: 50,
+			Origin:       &r2.Point{X: -1000, Y: 2000},
+		}, logger)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, floorPlan.ResolutionMm, test.ShouldEqual, 50)
+		test.That(t, floorPlan.PCD, test.ShouldNotBeEmpty)
+
+		logs := obs.FilterMessageSnippet("localizing against floor plan").All()
+		test.That(t, len(logs), test.ShouldEqual, 1)
+		test.That(t, logs[0].ContextMap()["image"], test.ShouldEqual, image)
+		test.That(t, logs[0].ContextMap()["occupied_cells"], test.ShouldEqual, 1)
+		test.That(t, logs[0].ContextMap()["free_cells"], test.ShouldEqual, 1)
+		test.That(t, logs[0].ContextMap()["unknown_cells"], test.ShouldEqual, 1)
+	})
+
+	t.Run("fails for a missing image", func(t *testing.T) {
+		_, err := loadFloorPlan(&vcConfig.FloorPlan{
+			Image:        filepath.Join(t.TempDir(), "map.pgm"),
+			ResolutionMm: 50,
+		}, logging.NewTestLogger(t))
+		test.That(t, errors.Is(err, os.ErrNotExist), test.ShouldBeTrue)
+		test.That(t, err.Error(), test.ShouldStartWith, "unable to load floor_plan")
+	})
+}
+
+func TestPropertiesMappingMode(t *testing.T) {
+	lidar := &inject.TimedLidar{}
+	lidar.NameFunc = func() string { return "my-lidar" }
+	for _, tc := range []struct {
+		name          string
+		enableMapping bool
+		existingMap   string
+		floorPlan     *floorplan.FloorPlan
+		mappingMode   slam.MappingMode
+	}{
+		{name: "mapping", enableMapping: true, mappingMode: slam.MappingModeNewMap},
+		{name: "updating", enableMapping: true, existingMap: "map.pbstream", mappingMode: slam.MappingModeUpdateExistingMap},
+		{name: "localizing", existingMap: "map.pbstream", mappingMode: slam.MappingModeLocalizationOnly},
+		{name: "localizing against a floor plan", floorPlan: &floorplan.FloorPlan{}, mappingMode: slam.MappingModeLocalizationOnly},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cartoSvc := &CartographerService{
+				Named:         resource.NewName(slam.API, "test").AsNamed(),
+				lidar:         lidar,
+				enableMapping: tc.enableMapping,
+				existingMap:   tc.existingMap,
+				floorPlan:     tc.floorPlan,
+			}
+			props, err := cartoSvc.Properties(context.Background())
+			test.That(t, err, test.ShouldBeNil)
+			test.That(t, props.MappingMode, test.ShouldEqual, tc.mappingMode)
+		})
+	}
+
+	t.Run("localizing without a map fails", func(t *testing.T) {
+		cartoSvc := &CartographerService{Named: resource.NewName(slam.API, "test").AsNamed(), lidar: lidar}
+		_, err := cartoSvc.Properties(context.Background())
+		test.That(t, err, test.ShouldBeError, errors.New("invalid mode: localizing requires an existing map or a floor plan"))
+	})
+}
+
+func TestCartoFacadeHang(t *testing.T) {
+	logger, obs := logging.NewObservedTestLogger(t)
+	mockCartoFacade := &cartofacade.Mock{}
+	svc := newTestService(mockCartoFacade, logger)
+	svc.cartoLib = &cartofacade.CartoLibMock{
+		LogLevelFunc: func() (int, int) { return 1, 0 },
+		CapabilitiesFunc: func() cartofacade.Capabilities {
+			return cartofacade.NewCapabilities(cartofacade.FeatureSlamStats)
+		},
+	}
+	svc.hangThreshold = time.Minute
+
+	t.Run("status reports whether the cartofacade is unresponsive", func(t *testing.T) {
+		mockCartoFacade.TrajectoriesFunc = func(ctx context.Context, timeout time.Duration) ([]cartofacade.Trajectory, error) {
+			return []cartofacade.Trajectory{{ID: 0, State: cartofacade.TrajectoryActive}}, nil
+		}
+		mockCartoFacade.UnresponsiveFunc = func() bool { return false }
+		resp, err := svc.DoCommand(context.Background(), map[string]interface{}{StatusCommand: ""})
+		test.That(t, err, test.ShouldBeNil)
+		// the memory usage varies from run to run, it is covered by TestSensorMetricsCommand
+		test.That(t, resp, test.ShouldContainKey, MemoryKey)
+		delete(resp, MemoryKey)
+		cartoFacadeStatus := map[string]interface{}{"state": "new", "queue_depth": int64(0), "final_optimization_run": false}
+		test.That(t, resp, test.ShouldResemble, map[string]interface{}{
+			UnresponsiveKey: false,
+			LogLevelKey:     LogLevelWarn,
+			CapabilitiesKey: []string{"slam_stats"},
+			CartoFacadeKey:  cartoFacadeStatus,
+			SlamModeKey:     "unknown",
+			JobDoneCommand:  false,
+			SharedCameraKey: false,
+			UnitsKey:        map[string]interface{}{PositionUnitKey: "mm", PointCloudMapUnitKey: "m"},
+			TrajectoriesKey: []interface{}{map[string]interface{}{"id": 0, "state": "active"}},
+		})
+
+		// the trajectories are not requested from an unresponsive cartofacade
+		mockCartoFacade.UnresponsiveFunc = func() bool { return true }
+		resp, err = svc.DoCommand(context.Background(), map[string]interface{}{StatusCommand: ""})
+		test.That(t, err, test.ShouldBeNil)
+		delete(resp, MemoryKey)
+		test.That(t, resp, test.ShouldResemble, map[string]interface{}{
+			UnresponsiveKey: true,
+			LogLevelKey:     LogLevelWarn,
+			CapabilitiesKey: []string{"slam_stats"},
+			CartoFacadeKey:  cartoFacadeStatus,
+			SlamModeKey:     "unknown",
+			JobDoneCommand:  false,
+			SharedCameraKey: false,
+			UnitsKey:        map[string]interface{}{PositionUnitKey: "mm", PointCloudMapUnitKey: "m"},
+		})
+	})
+
+	t.Run("logs the stack dump of a hang without restarting by default", func(t *testing.T) {
+		svc.handleCartoFacadeHang(2*time.Minute, []byte("goroutine 1 [running]"))
+		logs := obs.FilterMessageSnippet("cartographer is unresponsive").All()
+		test.That(t, len(logs), test.ShouldEqual, 1)
+		test.That(t, logs[0].ContextMap()["stack_dump"], test.ShouldEqual, "goroutine 1 [running]")
+		test.That(t, obs.FilterMessageSnippet("restarting the module").Len(), test.ShouldEqual, 0)
+	})
+
+	t.Run("restarts when restart_on_hang is set", func(t *testing.T) {
+		restarts := 0
+		svc.restartOnHang = func() { restarts++ }
+		svc.handleCartoFacadeHang(2*time.Minute, []byte("goroutine 1 [running]"))
+		test.That(t, restarts, test.ShouldEqual, 1)
+		test.That(t, obs.FilterMessageSnippet("restarting the module").Len(), test.ShouldEqual, 1)
+	})
+}
+
+func TestCartoFacadeStatus(t *testing.T) {
+	logger := logging.NewTestLogger(t)
+	status := cartofacade.Status{State: cartofacade.StateInitialized}
+	mockCartoFacade := &cartofacade.Mock{}
+	mockCartoFacade.StatusFunc = func() cartofacade.Status { return status }
+	mockCartoFacade.TrajectoriesFunc = func(ctx context.Context, timeout time.Duration) ([]cartofacade.Trajectory, error) {
+		return nil, nil
+	}
+	svc := newTestService(mockCartoFacade, logger)
+	svc.cartoLib = &cartofacade.CartoLibMock{LogLevelFunc: func() (int, int) { return 1, 0 }}
+	svc.SlamMode = cartofacade.MappingMode
+	cartoFacadeStatus := func(t *testing.T) map[string]interface{} {
+		t.Helper()
+		resp, err := svc.DoCommand(context.Background(), map[string]interface{}{StatusCommand: ""})
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, resp[SlamModeKey], test.ShouldEqual, "mapping")
+		return resp[CartoFacadeKey].(map[string]interface{})
+	}
+
+	test.That(t, cartoFacadeStatus(t), test.ShouldResemble, map[string]interface{}{
+		"state":                  "initialized",
+		"queue_depth":            int64(0),
+		"final_optimization_run": false,
+	})
+
+	status = cartofacade.Status{
+		State:                   cartofacade.StateStarted,
+		LastLidarReadingAddedAt: time.Date(2024, 1, 1, 12, 0, 0, 500, time.UTC),
+		QueueDepth:              2,
+	}
+	test.That(t, cartoFacadeStatus(t), test.ShouldResemble, map[string]interface{}{
+		"state":                       "started",
+		"last_lidar_reading_added_at": "2024-01-01T12:00:00.0000005Z",
+		"queue_depth":                 int64(2),
+		"final_optimization_run":      false,
+	})
+
+	status.State = cartofacade.StateTerminated
+	status.FinalOptimizationRun = true
+	svc.jobDone.Store(true)
+	resp, err := svc.DoCommand(context.Background(), map[string]interface{}{StatusCommand: ""})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, resp[JobDoneCommand], test.ShouldBeTrue)
+	test.That(t, resp[CartoFacadeKey].(map[string]interface{})["state"], test.ShouldEqual, "terminated")
+	test.That(t, resp[CartoFacadeKey].(map[string]interface{})["final_optimization_run"], test.ShouldBeTrue)
+}
+
+func TestInitializeAndStartCartoFacade(t *testing.T) {
+	errRetryable := errors.New("VIAM_CARTO_OUT_OF_MEMORY")
+	newService := func(mockCartoFacade *cartofacade.Mock) (*CartographerService, *int) {
+		numInitialized := 0
+		mockCartoFacade.StartFunc = func(ctx context.Context, timeout time.Duration) error { return nil }
+		mockCartoFacade.TerminateFunc = func(ctx context.Context, timeout time.Duration) error { return nil }
+		return &CartographerService{
+			Named:                 resource.NewName(slam.API, "test").AsNamed(),
+			logger:                logging.NewTestLogger(t),
+			maxInitAttempts:       3,
+			retryableInitErrors:   map[string]bool{errRetryable.Error(): true},
+			initRetryBackoff:      time.Millisecond,
+			cancelCartoFacadeFunc: func() {},
+		}, &numInitialized
+	}
+	failInitializations := func(mockCartoFacade *cartofacade.Mock, numInitialized *int, numFailures int, err error) {
+		mockCartoFacade.InitializeFunc = func(
+			ctx context.Context,
+			timeout time.Duration,
+			activeBackgroundWorkers *sync.WaitGroup,
+		) (cartofacade.SlamMode, error) {
+			*numInitialized++
+			if *numInitialized <= numFailures {
+				return cartofacade.UnknownMode, err
+			}
+			return cartofacade.MappingMode, nil
+		}
+	}
+
+	t.Run("retries retryable initialize failures", func(t *testing.T) {
+		mockCartoFacade := &cartofacade.Mock{}
+		svc, numInitialized := newService(mockCartoFacade)
+		failInitializations(mockCartoFacade, numInitialized, 2, errRetryable)
+
+		slamMode, err := svc.initializeAndStartCartoFacade(context.Background(), mockCartoFacade)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, slamMode, test.ShouldEqual, cartofacade.MappingMode)
+		test.That(t, *numInitialized, test.ShouldEqual, 3)
+	})
+
+	t.Run("fails once the attempts are exhausted", func(t *testing.T) {
+		mockCartoFacade := &cartofacade.Mock{}
+		svc, numInitialized := newService(mockCartoFacade)
+		failInitializations(mockCartoFacade, numInitialized, 3, errRetryable)
+
+		_, err := svc.initializeAndStartCartoFacade(context.Background(), mockCartoFacade)
+		test.That(t, err, test.ShouldBeError, errRetryable)
+		test.That(t, *numInitialized, test.ShouldEqual, 3)
+	})
+
+	t.Run("does not retry errors that are not retryable", func(t *testing.T) {
+		mockCartoFacade := &cartofacade.Mock{}
+		svc, numInitialized := newService(mockCartoFacade)
+		errLuaConfigNotFound := errors.New("VIAM_CARTO_LUA_CONFIG_NOT_FOUND")
+		failInitializations(mockCartoFacade, numInitialized, 1, errLuaConfigNotFound)
+
+		_, err := svc.initializeAndStartCartoFacade(context.Background(), mockCartoFacade)
+		test.That(t, err, test.ShouldBeError, errLuaConfigNotFound)
+		test.That(t, *numInitialized, test.ShouldEqual, 1)
+	})
+
+	t.Run("terminates and retries when starting fails", func(t *testing.T) {
+		mockCartoFacade := &cartofacade.Mock{}
+		svc, numInitialized := newService(mockCartoFacade)
+		failInitializations(mockCartoFacade, numInitialized, 0, nil)
+		numStarted, numTerminated := 0, 0
+		mockCartoFacade.StartFunc = func(ctx context.Context, timeout time.Duration) error {
+			numStarted++
+			if numStarted == 1 {
+				return errRetryable
+			}
+			return nil
+		}
+		mockCartoFacade.TerminateFunc = func(ctx context.Context, timeout time.Duration) error {
+			numTerminated++
+			return nil
+		}
+
+		_, err := svc.initializeAndStartCartoFacade(context.Background(), mockCartoFacade)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, *numInitialized, test.ShouldEqual, 2)
+		test.That(t, numStarted, test.ShouldEqual, 2)
+		test.That(t, numTerminated, test.ShouldEqual, 1)
+	})
+
+	t.Run("does not retry when terminating fails", func(t *testing.T) {
+		mockCartoFacade := &cartofacade.Mock{}
+		svc, numInitialized := newService(mockCartoFacade)
+		failInitializations(mockCartoFacade, numInitialized, 0, nil)
+		errTerminate := errors.New("VIAM_CARTO_NOT_IN_TERMINATABLE_STATE")
+		mockCartoFacade.StartFunc = func(ctx context.Context, timeout time.Duration) error { return errRetryable }
+		mockCartoFacade.TerminateFunc = func(ctx context.Context, timeout time.Duration) error { return errTerminate }
+
+		_, err := svc.initializeAndStartCartoFacade(context.Background(), mockCartoFacade)
+		test.That(t, err, test.ShouldBeError, errTerminate)
+		test.That(t, *numInitialized, test.ShouldEqual, 1)
+	})
+
+	t.Run("stops retrying when cancelled and can be closed", func(t *testing.T) {
+		mockCartoFacade := &cartofacade.Mock{}
+		svc, numInitialized := newService(mockCartoFacade)
+		svc.initRetryBackoff = time.Hour
+		cancelCtx, cancelFunc := context.WithCancel(context.Background())
+		svc.cancelSensorProcessFunc = func() {}
+		svc.cancelCartoFacadeFunc = cancelFunc
+		failInitializations(mockCartoFacade, numInitialized, 3, errRetryable)
+		initializeFunc := mockCartoFacade.InitializeFunc
+		mockCartoFacade.InitializeFunc = func(
+			ctx context.Context,
+			timeout time.Duration,
+			activeBackgroundWorkers *sync.WaitGroup,
+		) (cartofacade.SlamMode, error) {
+			// as New is cancelled while initializing
+			cancelFunc()
+			return initializeFunc(ctx, timeout, activeBackgroundWorkers)
+		}
+
+		_, err := svc.initializeAndStartCartoFacade(cancelCtx, mockCartoFacade)
+		test.That(t, errors.Is(err, errRetryable), test.ShouldBeTrue)
+		test.That(t, errors.Is(err, context.Canceled), test.ShouldBeTrue)
+		test.That(t, *numInitialized, test.ShouldEqual, 1)
+		test.That(t, svc.Close(context.Background()), test.ShouldBeNil)
+		test.That(t, svc.closed, test.ShouldBeTrue)
+	})
+
+	errStart := errors.New("VIAM_CARTO_NOT_IN_STARTED_STATE")
+	errTerminate := errors.New("VIAM_CARTO_NOT_IN_TERMINATABLE_STATE")
+	errLuaConfigNotFound := errors.New("VIAM_CARTO_LUA_CONFIG_NOT_FOUND")
+	for _, tc := range []struct {
+		stage         string
+		initializeErr error
+		startErr      error
+		terminateErr  error
+		expectedErr   error
+	}{
+		{stage: "initialize", initializeErr: errLuaConfigNotFound, expectedErr: errLuaConfigNotFound},
+		{stage: "start", startErr: errStart, expectedErr: errStart},
+		{stage: "terminate", startErr: errStart, terminateErr: errTerminate, expectedErr: errTerminate},
+		{stage: "no"},
+	} {
+		t.Run(fmt.Sprintf("the worker started by initialize is stopped when %s stage fails", tc.stage), func(t *testing.T) {
+			numGoroutines := runtime.NumGoroutine()
+			mockCartoFacade := &cartofacade.Mock{}
+			svc, _ := newService(mockCartoFacade)
+			cancelCtx, cancelFunc := context.WithCancel(context.Background())
+			defer cancelFunc()
+			svc.cancelCartoFacadeFunc = cancelFunc
+			var workerRunning atomic.Bool
+			mockCartoFacade.InitializeFunc = func(
+				ctx context.Context,
+				timeout time.Duration,
+				activeBackgroundWorkers *sync.WaitGroup,
+			) (cartofacade.SlamMode, error) {
+				// as the cartofacade worker which calls into C
+				workerRunning.Store(true)
+				activeBackgroundWorkers.Add(1)
+				go func() {
+					defer activeBackgroundWorkers.Done()
+					<-ctx.Done()
+					workerRunning.Store(false)
+				}()
+				return cartofacade.MappingMode, tc.initializeErr
+			}
+			mockCartoFacade.StartFunc = func(ctx context.Context, timeout time.Duration) error { return tc.startErr }
+			mockCartoFacade.TerminateFunc = func(ctx context.Context, timeout time.Duration) error { return tc.terminateErr }
+
+			_, err := svc.initializeAndStartCartoFacade(cancelCtx, mockCartoFacade)
+			if tc.expectedErr == nil {
+				test.That(t, err, test.ShouldBeNil)
+				test.That(t, cancelCtx.Err(), test.ShouldBeNil)
+				test.That(t, workerRunning.Load(), test.ShouldBeTrue)
+				return
+			}
+			test.That(t, err, test.ShouldBeError, tc.expectedErr)
+			test.That(t, cancelCtx.Err(), test.ShouldBeError, context.Canceled)
+			test.That(t, workerRunning.Load(), test.ShouldBeFalse)
+			testutils.WaitForAssertion(t, func(tb testing.TB) {
+				tb.Helper()
+				test.That(tb, runtime.NumGoroutine(), test.ShouldBeLessThanOrEqualTo, numGoroutines)
+			})
+		})
+	}
+}
+
+func TestHandleSlamStats(t *testing.T) {
+	const fallingBehindWarning = "is falling behind the lidar readings"
+	const caughtUpMessage = "caught up with the lidar readings"
+	logger, obs := logging.NewObservedTestLogger(t)
+	svc := &CartographerService{
+		Named:                 resource.NewName(slam.API, "test").AsNamed(),
+		logger:                logger,
+		maxUnoptimizedNodeAge: defaultMaxUnoptimizedNodeAge,
+	}
+	behind := cartofacade.SlamStats{NumNodes: 100, NumUnoptimizedNodes: 80, OldestUnoptimizedNodeAge: 2 * defaultMaxUnoptimizedNodeAge}
+	caughtUp := cartofacade.SlamStats{NumNodes: 100, NumUnoptimizedNodes: 2, OldestUnoptimizedNodeAge: time.Second}
+
+	t.Run("offline there is no warning when the optimization falls behind", func(t *testing.T) {
+		svc.handleSlamStats(behind, false)
+		test.That(t, obs.FilterMessageSnippet(fallingBehindWarning).Len(), test.ShouldEqual, 0)
+		test.That(t, *svc.slamStats.Load(), test.ShouldResemble, behind)
+	})
+
+	t.Run("online the warning is logged once when the optimization falls behind", func(t *testing.T) {
+		svc.handleSlamStats(caughtUp, true)
+		svc.handleSlamStats(behind, true)
+		svc.handleSlamStats(behind, true)
+		warnings := obs.FilterMessageSnippet(fallingBehindWarning).All()
+		test.That(t, len(warnings), test.ShouldEqual, 1)
+		test.That(t, warnings[0].ContextMap()["num_unoptimized_nodes"], test.ShouldEqual, int64(80))
+		test.That(t, obs.FilterMessageSnippet(caughtUpMessage).Len(), test.ShouldEqual, 0)
+	})
+
+	t.Run("online the recovery is logged and the warning is logged again when falling behind again", func(t *testing.T) {
+		svc.handleSlamStats(caughtUp, true)
+		svc.handleSlamStats(caughtUp, true)
+		test.That(t, obs.FilterMessageSnippet(caughtUpMessage).Len(), test.ShouldEqual, 1)
+		test.That(t, *svc.slamStats.Load(), test.ShouldResemble, caughtUp)
+
+		svc.handleSlamStats(behind, true)
+		test.That(t, obs.FilterMessageSnippet(fallingBehindWarning).Len(), test.ShouldEqual, 2)
+	})
+}
+
+func TestHandleDutyCycle(t *testing.T) {
+	const sustainedWarning = "cartographer is busy processing requests almost all of the time"
+	logger, obs := logging.NewObservedTestLogger(t)
+	svc := &CartographerService{
+		Named:               resource.NewName(slam.API, "test").AsNamed(),
+		logger:              logger,
+		maxDutyCyclePercent: defaultMaxDutyCyclePercent,
+	}
+
+	t.Run("a duty cycle above the max is only reported once it is sustained", func(t *testing.T) {
+		for i := 0; i < sustainedDutyCycleWindows-1; i++ {
+			svc.handleDutyCycle(95)
+		}
+		test.That(t, obs.FilterMessageSnippet(sustainedWarning).Len(), test.ShouldEqual, 0)
+		test.That(t, obs.FilterMessageSnippet("cartographer duty cycle").Len(), test.ShouldEqual, sustainedDutyCycleWindows-1)
+
+		svc.handleDutyCycle(95)
+		warnings := obs.FilterMessageSnippet(sustainedWarning).All()
+		test.That(t, len(warnings), test.ShouldEqual, 1)
+		test.That(t, warnings[0].ContextMap()["duty_cycle_percent"], test.ShouldEqual, 95.0)
+	})
+
+	t.Run("a duty cycle at or below the max resets the sustained period", func(t *testing.T) {
+		svc.handleDutyCycle(defaultMaxDutyCyclePercent)
+		for i := 0; i < sustainedDutyCycleWindows-1; i++ {
+			svc.handleDutyCycle(95)
+		}
+		test.That(t, obs.FilterMessageSnippet(sustainedWarning).Len(), test.ShouldEqual, 1)
+
+		svc.handleDutyCycle(95)
+		test.That(t, obs.FilterMessageSnippet(sustainedWarning).Len(), test.ShouldEqual, 2)
+	})
+}
+
+func TestEditedMapConsistencyCheck(t *testing.T) {
+	logger := logging.NewTestLogger(t)
+	officeMap, err := os.ReadFile(artifact.MustPath("viam-cartographer/outputs/viam-office-02-22-3/pointcloud/pointcloud_0.pcd"))
+	test.That(t, err, test.ShouldBeNil)
+
+	// a small map 100m away from the office map
+	unrelatedMap := pcdtest.PointsToPCD(t, pcdtest.GridPoints(10, 100, r3.Vector{X: 100000, Y: 100000}))
+
+	newSvc := func(editedMap []byte) (*CartographerService, *cartofacade.Mock) {
+		mockCartoFacade := &cartofacade.Mock{}
+		mockCartoFacade.UnresponsiveFunc = func() bool { return true }
+		return &CartographerService{
+			Named:              resource.NewName(slam.API, "test").AsNamed(),
+			cartoLib:           &cartofacade.CartoLibMock{LogLevelFunc: func() (int, int) { return 0, 0 }},
+			cartofacade:        mockCartoFacade,
+			cartoFacadeTimeout: 5 * time.Second,
+			logger:             logger,
+			editedMap:          &editedMap,
+		}, mockCartoFacade
+	}
+
+	status := func(t *testing.T, svc *CartographerService) map[string]interface{} {
+		resp, err := svc.DoCommand(context.Background(), map[string]interface{}{StatusCommand: ""})
+		test.That(t, err, test.ShouldBeNil)
+		return resp
+	}
+
+	t.Run("status omits the flag without an edited map", func(t *testing.T) {
+		svc, _ := newSvc(nil)
+		svc.editedMap = nil
+		_, ok := status(t, svc)[EditedMapInconsistentKey]
+		test.That(t, ok, test.ShouldBeFalse)
+	})
+
+	t.Run("an edited map of the office map is consistent", func(t *testing.T) {
+		svc, _ := newSvc(officeMap)
+		svc.checkEditedMapConsistency(officeMap)
+		test.That(t, status(t, svc)[EditedMapInconsistentKey], test.ShouldBeFalse)
+	})
+
+	t.Run("an unrelated edited map is flagged once cartographer's map is available", func(t *testing.T) {
+		svc, mockCartoFacade := newSvc(unrelatedMap)
+		mapAvailable := make(chan struct{})
+		mockCartoFacade.PointCloudMapFunc = func(ctx context.Context, timeout time.Duration) ([]byte, error) {
+			select {
+			case <-mapAvailable:
+				return officeMap, nil
+			default:
+				return nil, errors.New("map not available yet")
+			}
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		startEditedMapConsistencyCheck(ctx, svc)
+		test.That(t, status(t, svc)[EditedMapInconsistentKey], test.ShouldBeFalse)
+
+		close(mapAvailable)
+		testutils.WaitForAssertion(t, func(tb testing.TB) {
+			tb.Helper()
+			test.That(tb, status(t, svc)[EditedMapInconsistentKey], test.ShouldBeTrue)
+		})
+		svc.sensorProcessWorkers.Wait()
+	})
+
+	t.Run("the check stops when the service is closed before cartographer's map is available", func(t *testing.T) {
+		svc, mockCartoFacade := newSvc(unrelatedMap)
+		mockCartoFacade.PointCloudMapFunc = func(ctx context.Context, timeout time.Duration) ([]byte, error) {
+			return nil, errors.New("map not available yet")
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		startEditedMapConsistencyCheck(ctx, svc)
+		cancel()
+		svc.sensorProcessWorkers.Wait()
+		test.That(t, status(t, svc)[EditedMapInconsistentKey], test.ShouldBeFalse)
+	})
+}
+
+func TestCloseOrdering(t *testing.T) {
+	logger := logging.NewTestLogger(t)
+	ctx := context.Background()
+	deps := s.SetupDeps(s.GoodLidar, s.GoodMovementSensorBothIMUAndOdometer)
+	dataFrequencyHz := 1000
+	lidar, err := s.NewLidar(ctx, deps, string(s.GoodLidar), dataFrequencyHz, logger)
+	test.That(t, err, test.ShouldBeNil)
+	movementSensor, err := s.NewMovementSensor(ctx, deps, string(s.GoodMovementSensorBothIMUAndOdometer),
+		dataFrequencyHz, s.DegreesPerSecond, logger)
+	test.That(t, err, test.ShouldBeNil)
+
+	for i := 0; i < 5; i++ {
+		var mu sync.Mutex
+		var phases []string
+		record := func(phase string) {
+			mu.Lock()
+			defer mu.Unlock()
+			phases = append(phases, phase)
+		}
+
+		var drained atomic.Bool
+		var numAdded, numAddedAfterDrain atomic.Int64
+		add := func() error {
+			if drained.Load() {
+				numAddedAfterDrain.Add(1)
+				return cartofacade.ErrDrained
+			}
+			numAdded.Add(1)
+			return nil
+		}
+		cf := &cartofacade.Mock{}
+		cf.AddLidarReadingFunc = func(
+			ctx context.Context, timeout time.Duration, lidarName string, currentReading s.TimedLidarReadingResponse,
+		) error {
+			return add()
+		}
+		cf.AddIMUReadingFunc = func(
+			ctx context.Context, timeout time.Duration, movementSensorName string, currentReading s.TimedIMUReadingResponse,
+		) error {
+			return add()
+		}
+		cf.AddOdometerReadingFunc = func(
+			ctx context.Context, timeout time.Duration, movementSensorName string, currentReading s.TimedOdometerReadingResponse,
+		) error {
+			return add()
+		}
+		cf.PositionFunc = func(ctx context.Context, timeout time.Duration) (cartofacade.Position, error) {
+			return cartofacade.Position{Real: 1}, nil
+		}
+		cf.DrainFunc = func(ctx context.Context, timeout time.Duration) error {
+			drained.Store(true)
+			record("drain")
+			return nil
+		}
+		cf.StopFunc = func(ctx context.Context, timeout time.Duration) error {
+			record("stop")
+			return nil
+		}
+		cf.TerminateFunc = func(ctx context.Context, timeout time.Duration) error {
+			record("terminate")
+			return nil
+		}
+
+		cancelSensorProcessCtx, cancelSensorProcessFunc := context.WithCancel(context.Background())
+		cancelCartoFacadeCtx, cancelCartoFacadeFunc := context.WithCancel(context.Background())
+		svc := newTestService(cf, logger)
+		svc.lidar = lidar
+		svc.movementSensor = movementSensor
+		svc.cartoFacadeTimeout = 5 * time.Second
+		svc.cancelSensorProcessFunc = cancelSensorProcessFunc
+		svc.cancelCartoFacadeFunc = cancelCartoFacadeFunc
+		svc.cartoFacadeWorkers.Add(1)
+		go func() {
+			defer svc.cartoFacadeWorkers.Done()
+			<-cancelCartoFacadeCtx.Done()
+			record("stop workers")
+		}()
+		initSensorProcesses(cancelSensorProcessCtx, svc)
+
+		testutils.WaitForAssertion(t, func(tb testing.TB) {
+			tb.Helper()
+			test.That(tb, numAdded.Load(), test.ShouldBeGreaterThan, 100)
+		})
+		test.That(t, svc.Close(ctx), test.ShouldBeNil)
+
+		test.That(t, numAddedAfterDrain.Load(), test.ShouldEqual, 0)
+		test.That(t, phases, test.ShouldResemble, []string{"drain", "stop", "terminate", "stop workers"})
+		test.That(t, svc.closed, test.ShouldBeTrue)
+	}
+
+	t.Run("the phase reached is the last phase before the first failure", func(t *testing.T) {
+		cf := &cartofacade.Mock{}
+		cf.StopFunc = func(ctx context.Context, timeout time.Duration) error {
+			return errors.New("stop failed")
+		}
+		terminated := false
+		cf.TerminateFunc = func(ctx context.Context, timeout time.Duration) error {
+			terminated = true
+			return nil
+		}
+		svc := newTestService(cf, logger)
+		svc.cancelSensorProcessFunc = func() {}
+		svc.cancelCartoFacadeFunc = func() {}
+		reached, err := svc.closeInPhases(ctx)
+		test.That(t, err, test.ShouldBeError, "close phase stop_facade failed: stop failed")
+		test.That(t, reached, test.ShouldEqual, closePhaseDrainFacade)
+		test.That(t, terminated, test.ShouldBeTrue)
+	})
+
+	optimizeOnClose := func(slamMode cartofacade.SlamMode, optimizeErr error) (*CartographerService, *[]string) {
+		var calls []string
+		cf := &cartofacade.Mock{}
+		cf.DrainFunc = func(ctx context.Context, timeout time.Duration) error {
+			calls = append(calls, "drain")
+			return nil
+		}
+		cf.RunFinalOptimizationFunc = func(ctx context.Context, timeout time.Duration) error {
+			test.That(t, timeout, test.ShouldEqual, time.Minute)
+			calls = append(calls, "run final optimization")
+			return optimizeErr
+		}
+		cf.StopFunc = func(ctx context.Context, timeout time.Duration) error {
+			calls = append(calls, "stop")
+			return nil
+		}
+		cf.TerminateFunc = func(ctx context.Context, timeout time.Duration) error {
+			calls = append(calls, "terminate")
+			return nil
+		}
+		svc := newTestService(cf, logger)
+		svc.SlamMode = slamMode
+		svc.cartoFacadeTimeout = 5 * time.Second
+		svc.cartoFacadeInternalTimeout = time.Minute
+		svc.optimizeOnClose = true
+		svc.cancelSensorProcessFunc = func() { calls = append(calls, "stop sensors") }
+		svc.cancelCartoFacadeFunc = func() {}
+		return svc, &calls
+	}
+
+	t.Run("optimize_on_close runs the final optimization after the sensors stop and before termination", func(t *testing.T) {
+		svc, calls := optimizeOnClose(cartofacade.MappingMode, nil)
+		test.That(t, svc.Close(ctx), test.ShouldBeNil)
+		test.That(t, *calls, test.ShouldResemble,
+			[]string{"stop sensors", "drain", "run final optimization", "stop", "terminate"})
+	})
+
+	t.Run("a failed final optimization on close does not prevent termination", func(t *testing.T) {
+		svc, calls := optimizeOnClose(cartofacade.UpdatingMode, errors.New("optimization failed"))
+		reached, err := svc.closeInPhases(ctx)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, reached, test.ShouldEqual, closePhaseStopWorkers)
+		test.That(t, *calls, test.ShouldResemble,
+			[]string{"stop sensors", "drain", "run final optimization", "stop", "terminate"})
+	})
+
+	t.Run("the final optimization on close is skipped in localization mode or if optimize_on_close is not set",
+		func(t *testing.T) {
+			svc, calls := optimizeOnClose(cartofacade.LocalizingMode, nil)
+			test.That(t, svc.Close(ctx), test.ShouldBeNil)
+			test.That(t, *calls, test.ShouldResemble, []string{"stop sensors", "drain", "stop", "terminate"})
+
+			svc, calls = optimizeOnClose(cartofacade.MappingMode, nil)
+			svc.optimizeOnClose = false
+			test.That(t, svc.Close(ctx), test.ShouldBeNil)
+			test.That(t, *calls, test.ShouldResemble, []string{"stop sensors", "drain", "stop", "terminate"})
+		})
+}
@@ -9,15 +9,20 @@ package viamcartographer_test
 
 import (
 	"context"
+	"fmt"
 	"os"
+	"path/filepath"
+	"runtime"
 	"testing"
 
 	"github.com/pkg/errors"
 	viamgrpc "go.viam.com/rdk/grpc"
 	"go.viam.com/rdk/logging"
+	"go.viam.com/rdk/resource"
 	"go.viam.com/rdk/services/slam"
 	"go.viam.com/test"
 	"go.viam.com/utils/artifact"
+	"go.viam.com/utils/testutils"
 
 	viamcartographer "github.com/viam-modules/viam-cartographer"
 	"github.com/viam-modules/viam-cartographer/cartofacade"
@@ -77,6 +82,64 @@ func TestNew(t *testing.T) {
 		test.That(t, svc.Close(context.Background()), test.ShouldBeNil)
 	})
 
+	t.Run("Warns about the fields of the config that are ignored when use_cloud_slam is set", func(t *testing.T) {
+		logger, obs := logging.NewObservedTestLogger(t)
+		maxIngestionLatencyMs := 100
+		attrCfg := &vcConfig.Config{
+			Camera:                map[string]string{"name": string(s.GoodLidar), "data_frequency_hz": "5"},
+			MovementSensor:        map[string]string{"name": string(s.GoodIMU), "data_frequency_hz": testIMUDataFreqHz},
+			ConfigParams:          map[string]string{"mode": "2d", "optimize_every_n_nodes": "3"},
+			EnableMapping:         &_true,
+			UseCloudSlam:          &_true,
+			MaxIngestionLatencyMs: &maxIngestionLatencyMs,
+		}
+
+		svc, err := testhelper.CreateSLAMService(t, attrCfg, logger)
+		test.That(t, err, test.ShouldBeNil)
+
+		ignoredFields := []string{
+			"camera[data_frequency_hz]",
+			"movement_sensor[data_frequency_hz]",
+			"config_params[optimize_every_n_nodes]",
+			"max_ingestion_latency_ms",
+		}
+		warnings := obs.FilterMessageSnippet("use_cloud_slam is set").All()
+		test.That(t, len(warnings), test.ShouldEqual, 1)
+		test.That(t, warnings[0].Message, test.ShouldContainSubstring,
+			"camera[data_frequency_hz], movement_sensor[data_frequency_hz], config_params[optimize_every_n_nodes], max_ingestion_latency_ms")
+		test.That(t, warnings[0].ContextMap()["ignored_fields"], test.ShouldResemble, []interface{}{
+			"camera[data_frequency_hz]",
+			"movement_sensor[data_frequency_hz]",
+			"config_params[optimize_every_n_nodes]",
+			"max_ingestion_latency_ms",
+		})
+
+		// the names of the sensors are retained for reporting
+		props, err := svc.Properties(context.Background())
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, props.CloudSlam, test.ShouldBeTrue)
+		test.That(t, props.SensorInfo, test.ShouldResemble, []slam.SensorInfo{
+			{Name: string(s.GoodLidar), Type: slam.SensorTypeCamera},
+			{Name: string(s.GoodIMU), Type: slam.SensorTypeMovementSensor},
+		})
+
+		resp, err := svc.DoCommand(context.Background(), map[string]interface{}{viamcartographer.StatusCommand: nil})
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, resp, test.ShouldResemble, map[string]interface{}{
+			"use_cloud_slam":                  true,
+			"camera":                          string(s.GoodLidar),
+			"movement_sensor":                 string(s.GoodIMU),
+			viamcartographer.IgnoredFieldsKey: ignoredFields,
+		})
+
+		// other commands are unavailable
+		resp, err = svc.DoCommand(context.Background(), map[string]interface{}{viamcartographer.SensorMetricsCommand: nil})
+		test.That(t, resp, test.ShouldBeNil)
+		test.That(t, err, test.ShouldBeError, viamcartographer.ErrUseCloudSlamEnabled)
+
+		test.That(t, svc.Close(context.Background()), test.ShouldBeNil)
+	})
+
 	t.Run("Successful creation of cartographer slam service with good lidar without IMU", func(t *testing.T) {
 		termFunc := testhelper.InitTestCL(t, logger)
 		defer termFunc()
@@ -124,6 +187,29 @@ func TestNew(t *testing.T) {
 		test.That(t, svc.Close(context.Background()), test.ShouldBeNil)
 	})
 
+	t.Run("Failed creation of cartographer slam service with a live lidar and a replay IMU", func(t *testing.T) {
+		termFunc := testhelper.InitTestCL(t, logger)
+		defer termFunc()
+
+		attrCfg := &vcConfig.Config{
+			Camera:         map[string]string{"name": string(s.GoodLidar), "data_frequency_hz": testLidarDataFreqHz},
+			ConfigParams:   map[string]string{"mode": "2d"},
+			MovementSensor: map[string]string{"name": string(s.ReplayIMU), "data_frequency_hz": testIMUDataFreqHz},
+			EnableMapping:  &_true,
+		}
+
+		_, err := testhelper.CreateSLAMService(t, attrCfg, logger)
+		test.That(t, errors.Is(err, s.ErrMixedClockDomains), test.ShouldBeTrue)
+		test.That(t, err.Error(), test.ShouldContainSubstring, string(s.GoodLidar))
+		test.That(t, err.Error(), test.ShouldContainSubstring, string(s.ReplayIMU))
+
+		allowMixedClockDomains := true
+		attrCfg.AllowMixedClockDomains = &allowMixedClockDomains
+		svc, err := testhelper.CreateSLAMService(t, attrCfg, logger)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, svc.Close(context.Background()), test.ShouldBeNil)
+	})
+
 	t.Run("Successful creation of cartographer slam service with good lidar with IMU", func(t *testing.T) {
 		termFunc := testhelper.InitTestCL(t, logger)
 		defer termFunc()
@@ -307,6 +393,134 @@ func TestNew(t *testing.T) {
 		test.That(t, err, test.ShouldBeError, errors.New("error validating \"path\": \"camera[name]\" is required"))
 		test.That(t, svc, test.ShouldBeNil)
 	})
+
+	t.Run("Fails to create cartographer slam service when the lidar cannot be recorded", func(t *testing.T) {
+		termFunc := testhelper.InitTestCL(t, logger)
+		defer termFunc()
+
+		// the dataset directory cannot be created below a regular file
+		notADir := filepath.Join(t.TempDir(), "not_a_dir")
+		test.That(t, os.WriteFile(notADir, nil, 0o600), test.ShouldBeNil)
+		attrCfg := &vcConfig.Config{
+			Camera:           map[string]string{"name": string(s.GoodLidar), "data_frequency_hz": testLidarDataFreqHz},
+			ConfigParams:     map[string]string{"mode": "2d"},
+			EnableMapping:    &_true,
+			RecordDatasetDir: notADir,
+		}
+
+		numGoroutines := runtime.NumGoroutine()
+		svc, err := testhelper.CreateSLAMService(t, attrCfg, logger)
+		test.That(t, err, test.ShouldNotBeNil)
+		test.That(t, err.Error(), test.ShouldContainSubstring, "failed to create the lidar dataset directory")
+		test.That(t, svc, test.ShouldBeNil)
+		testutils.WaitForAssertion(t, func(tb testing.TB) {
+			tb.Helper()
+			test.That(tb, runtime.NumGoroutine(), test.ShouldBeLessThanOrEqualTo, numGoroutines)
+		})
+	})
+}
+
+func TestConstructionWarnings(t *testing.T) {
+	logger := logging.NewTestLogger(t)
+
+	// codes returns the codes of the construction warnings in the status response of svc.
+	codes := func(t *testing.T, svc slam.Service) []string {
+		t.Helper()
+		resp, err := svc.DoCommand(context.Background(), map[string]interface{}{viamcartographer.StatusCommand: nil})
+		test.That(t, err, test.ShouldBeNil)
+		warnings, ok := resp[viamcartographer.ConstructionWarningsKey].([]interface{})
+		if !ok {
+			return nil
+		}
+		var codes []string
+		for _, warning := range warnings {
+			w, ok := warning.(map[string]interface{})
+			test.That(t, ok, test.ShouldBeTrue)
+			test.That(t, w["message"], test.ShouldNotBeEmpty)
+			codes = append(codes, w["code"].(string))
+		}
+		return codes
+	}
+
+	for _, tc := range []struct {
+		name           string
+		movementSensor map[string]string
+		configParams   map[string]string
+		expectedCodes  []string
+	}{
+		{
+			name:          "without a movement sensor and with unused config params",
+			configParams:  map[string]string{"mode": "2d", "test_param": "viam", "another_param": "1"},
+			expectedCodes: []string{"UNUSED_CONFIG_PARAM", "UNUSED_CONFIG_PARAM", "NO_MOVEMENT_SENSOR"},
+		},
+		{
+			name:           "with a movement sensor without odometer",
+			movementSensor: map[string]string{"name": string(s.GoodIMU), "data_frequency_hz": testIMUDataFreqHz},
+			configParams:   map[string]string{"mode": "2d"},
+			expectedCodes:  []string{"MOVEMENT_SENSOR_WITHOUT_ODOMETER"},
+		},
+		{
+			name:           "with a movement sensor without IMU",
+			movementSensor: map[string]string{"name": string(s.GoodOdometer), "data_frequency_hz": testIMUDataFreqHz},
+			configParams:   map[string]string{"mode": "2d"},
+			expectedCodes:  []string{"MOVEMENT_SENSOR_WITHOUT_IMU"},
+		},
+		{
+			name:           "without warnings",
+			movementSensor: map[string]string{"name": string(s.GoodMovementSensorBothIMUAndOdometer), "data_frequency_hz": testIMUDataFreqHz},
+			configParams:   map[string]string{"mode": "2d"},
+		},
+	} {
+		t.Run("lists the construction warnings "+tc.name+" until they are cleared", func(t *testing.T) {
+			termFunc := testhelper.InitTestCL(t, logger)
+			defer termFunc()
+
+			attrCfg := &vcConfig.Config{
+				Camera:         map[string]string{"name": string(s.GoodLidar), "data_frequency_hz": testLidarDataFreqHz},
+				MovementSensor: tc.movementSensor,
+				ConfigParams:   tc.configParams,
+				EnableMapping:  &_true,
+			}
+			svc, err := testhelper.CreateSLAMService(t, attrCfg, logger)
+			test.That(t, err, test.ShouldBeNil)
+			defer func() {
+				test.That(t, svc.Close(context.Background()), test.ShouldBeNil)
+			}()
+
+			test.That(t, codes(t, svc), test.ShouldResemble, tc.expectedCodes)
+
+			resp, err := svc.DoCommand(context.Background(), map[string]interface{}{viamcartographer.ClearWarningsCommand: nil})
+			test.That(t, err, test.ShouldBeNil)
+			test.That(t, resp[viamcartographer.ClearedWarningsKey], test.ShouldEqual, len(tc.expectedCodes))
+			test.That(t, codes(t, svc), test.ShouldBeNil)
+		})
+	}
+
+	t.Run("caps the construction warnings", func(t *testing.T) {
+		termFunc := testhelper.InitTestCL(t, logger)
+		defer termFunc()
+
+		configParams := map[string]string{"mode": "2d"}
+		for i := 0; i < 30; i++ {
+			configParams[fmt.Sprintf("test_param_%d", i)] = "viam"
+		}
+		attrCfg := &vcConfig.Config{
+			Camera:        map[string]string{"name": string(s.GoodLidar), "data_frequency_hz": testLidarDataFreqHz},
+			ConfigParams:  configParams,
+			EnableMapping: &_true,
+		}
+		svc, err := testhelper.CreateSLAMService(t, attrCfg, logger)
+		test.That(t, err, test.ShouldBeNil)
+		defer func() {
+			test.That(t, svc.Close(context.Background()), test.ShouldBeNil)
+		}()
+
+		resp, err := svc.DoCommand(context.Background(), map[string]interface{}{viamcartographer.StatusCommand: nil})
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, resp[viamcartographer.ConstructionWarningsKey], test.ShouldHaveLength, 20)
+		// the 30 unused config params and the missing movement sensor
+		test.That(t, resp[viamcartographer.DroppedConstructionWarningsKey], test.ShouldEqual, 11)
+	})
 }
 
 func TestClose(t *testing.T) {
@@ -360,6 +574,53 @@ func TestClose(t *testing.T) {
 	})
 }
 
+func TestSharedCamera(t *testing.T) {
+	logger := logging.NewTestLogger(t)
+	ctx := context.Background()
+	termFunc := testhelper.InitTestCL(t, logger)
+	defer termFunc()
+
+	// both services read the same injected camera
+	deps := s.SetupDeps(s.GoodLidar, s.NoMovementSensor)
+	newService := func(name string) slam.Service {
+		cfgService := resource.Config{Name: name, API: slam.API, Model: viamcartographer.Model}
+		cfgService.ConvertedAttributes = &vcConfig.Config{
+			Camera:        map[string]string{"name": string(s.GoodLidar), "data_frequency_hz": testLidarDataFreqHz},
+			ConfigParams:  map[string]string{"mode": "2d"},
+			EnableMapping: &_true,
+		}
+		svc, err := viamcartographer.New(ctx, deps, cfgService, logger,
+			testhelper.CartoFacadeTimeoutForTest, testhelper.CartoFacadeInternalTimeoutForTest, nil, nil)
+		test.That(t, err, test.ShouldBeNil)
+		return svc
+	}
+	sharedCamera := func(svc slam.Service) bool {
+		resp, err := svc.DoCommand(ctx, map[string]interface{}{viamcartographer.StatusCommand: nil})
+		test.That(t, err, test.ShouldBeNil)
+		shared, ok := resp[viamcartographer.SharedCameraKey].(bool)
+		test.That(t, ok, test.ShouldBeTrue)
+		return shared
+	}
+
+	first := newService("first")
+	test.That(t, sharedCamera(first), test.ShouldBeFalse)
+
+	second := newService("second")
+	test.That(t, sharedCamera(first), test.ShouldBeTrue)
+	test.That(t, sharedCamera(second), test.ShouldBeTrue)
+
+	// closing a service releases its claim on the camera
+	test.That(t, second.Close(ctx), test.ShouldBeNil)
+	test.That(t, sharedCamera(first), test.ShouldBeFalse)
+
+	third := newService("third")
+	test.That(t, sharedCamera(first), test.ShouldBeTrue)
+	test.That(t, sharedCamera(third), test.ShouldBeTrue)
+	test.That(t, first.Close(ctx), test.ShouldBeNil)
+	test.That(t, sharedCamera(third), test.ShouldBeFalse)
+	test.That(t, third.Close(ctx), test.ShouldBeNil)
+}
+
 func TestDoCommand(t *testing.T) {
 	logger := logging.NewTestLogger(t)
 
@@ -384,7 +645,7 @@ func TestDoCommand(t *testing.T) {
 	t.Run("returns UnimplementedError when given other parameters", func(t *testing.T) {
 		cmd := map[string]interface{}{"fake_flag": true}
 		resp, err := svc.DoCommand(context.Background(), cmd)
-		test.That(t, err, test.ShouldEqual, viamgrpc.UnimplementedError)
+		test.That(t, errors.Is(err, viamgrpc.UnimplementedError), test.ShouldBeTrue)
 		test.That(t, resp, test.ShouldBeNil)
 	})
 	t.Run("returns UnimplementedError when given no parameters", func(t *testing.T) {
@@ -397,10 +658,15 @@ func TestDoCommand(t *testing.T) {
 		cmd := map[string]interface{}{viamcartographer.JobDoneCommand: ""}
 		resp, err := svc.DoCommand(context.Background(), cmd)
 		test.That(t, err, test.ShouldBeNil)
+		// the config hash is a hex encoded SHA-256 checksum
+		test.That(t, resp[viamcartographer.ConfigHashKey], test.ShouldHaveLength, 64)
+		delete(resp, viamcartographer.ConfigHashKey)
+		test.That(t, resp[viamcartographer.SessionStatsKey], test.ShouldNotBeNil)
+		delete(resp, viamcartographer.SessionStatsKey)
 		test.That(
 			t,
 			resp, test.ShouldResemble,
-			map[string]interface{}{viamcartographer.JobDoneCommand: false},
+			map[string]interface{}{viamcartographer.JobDoneCommand: false, "cause": "online"},
 		)
 	})
 	t.Run("changes postprocess bool after 'postprocess_toggle'", func(t *testing.T) {
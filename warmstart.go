@@ -0,0 +1,108 @@
+package viamcartographer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.viam.com/rdk/logging"
+
+	"github.com/viam-modules/viam-cartographer/pbstream"
+)
+
+const (
+	// warmStartMapPrefix is the prefix of the internal states saved to warm_start_dir, which is followed by the
+	// time they were saved at in warmStartMapTimeFormat, so that their names sort from the oldest to the newest.
+	warmStartMapPrefix = "warm_start_"
+	// warmStartMapTimeFormat is the format of the time in the names of the internal states saved to warm_start_dir
+	// and internal_state_save_dir.
+	warmStartMapTimeFormat = "20060102T150405.000000000Z"
+	// defaultWarmStartRetention is the number of internal states kept in warm_start_dir, a week of daily sessions.
+	defaultWarmStartRetention = 7
+)
+
+// listSavedInternalStates returns the paths of the internal states saved to dir whose names start with prefix,
+// from the newest to the oldest.
+func listSavedInternalStates(dir, prefix string) ([]string, error) {
+	dirEntries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var paths []string
+	for _, entry := range dirEntries {
+		if entry.IsDir() || !strings.HasPrefix(entry.Name(), prefix) ||
+			!strings.HasSuffix(entry.Name(), pbstream.Extension) {
+			continue
+		}
+		paths = append(paths, filepath.Join(dir, entry.Name()))
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(paths)))
+	return paths, nil
+}
+
+// latestWarmStartMap returns the newest intact internal state saved to dir, which is created if it does not exist
+// yet, or "" if there is none. Internal states that are truncated, e.g. because the save was interrupted, are
+// skipped.
+func latestWarmStartMap(dir string, logger logging.Logger) (string, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return "", errors.Wrap(err, "failed to create warm_start_dir")
+	}
+	paths, err := listSavedInternalStates(dir, warmStartMapPrefix)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to list the internal states of warm_start_dir")
+	}
+	for _, path := range paths {
+		if err := pbstream.Validate(path); err != nil {
+			logger.Warnw("skipping an invalid internal state of warm_start_dir", "path", path, "error", err)
+			continue
+		}
+		logger.Infow("warm starting from the latest internal state of warm_start_dir", "existing_map", path)
+		return path, nil
+	}
+	logger.Infow("warm_start_dir does not hold an internal state yet, starting a new map", "warm_start_dir", dir)
+	return "", nil
+}
+
+// saveWarmStartMap saves the internal state of cartographer to warm_start_dir, for the next session to start from,
+// and removes the oldest internal states of warm_start_dir beyond warm_start_retention.
+func (cartoSvc *CartographerService) saveWarmStartMap(ctx context.Context, now time.Time) (string, error) {
+	return cartoSvc.saveInternalStateToDir(ctx, cartoSvc.warmStartDir, warmStartMapPrefix, cartoSvc.warmStartRetention, now)
+}
+
+// saveInternalStateToDir saves the internal state of cartographer to dir, named by prefix followed by now, and
+// removes the oldest internal states of dir with the same prefix beyond retention. It returns the path the internal
+// state was saved to, also when only the removal failed.
+func (cartoSvc *CartographerService) saveInternalStateToDir(
+	ctx context.Context,
+	dir, prefix string,
+	retention int,
+	now time.Time,
+) (string, error) {
+	is, err := cartoSvc.cartofacade.InternalState(ctx, cartoSvc.cartoFacadeInternalTimeout)
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, prefix+now.UTC().Format(warmStartMapTimeFormat)+pbstream.Extension)
+	if err := writeFileAtomically(path, is); err != nil {
+		return "", err
+	}
+
+	paths, err := listSavedInternalStates(dir, prefix)
+	if err != nil {
+		return path, errors.Wrapf(err, "failed to list the internal states of %s to remove the oldest", dir)
+	}
+	var errs []string
+	for _, oldPath := range paths[min(len(paths), retention):] {
+		if err := os.Remove(oldPath); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return path, errors.Errorf("failed to remove the oldest internal states of %s: %s", dir, strings.Join(errs, "; "))
+	}
+	return path, nil
+}
@@ -0,0 +1,93 @@
+package viamcartographer
+
+import (
+	"context"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.viam.com/rdk/logging"
+	"go.viam.com/test"
+
+	"github.com/viam-modules/viam-cartographer/cartofacade"
+)
+
+func TestWarmStart(t *testing.T) {
+	logger := logging.NewTestLogger(t)
+	dir := filepath.Join(t.TempDir(), "maps")
+	// testInternalState returns a pbstream whose single record is payload
+	testInternalState := func(payload string) []byte {
+		data := binary.LittleEndian.AppendUint64(nil, 0x7b1d1f7b5bf501db)
+		data = binary.LittleEndian.AppendUint64(data, uint64(len(payload)))
+		return append(data, payload...)
+	}
+	// session starts a session from warm_start_dir and closes it, saving internal state to warm_start_dir. It
+	// returns the existing map the session was started from.
+	session := func(t *testing.T, internalState []byte) string {
+		t.Helper()
+		existingMap, err := latestWarmStartMap(dir, logger)
+		test.That(t, err, test.ShouldBeNil)
+		mockCartoFacade := &cartofacade.Mock{}
+		mockCartoFacade.DrainFunc = func(ctx context.Context, timeout time.Duration) error { return nil }
+		mockCartoFacade.InternalStateFunc = func(ctx context.Context, timeout time.Duration) ([]byte, error) {
+			return internalState, nil
+		}
+		mockCartoFacade.StopFunc = func(ctx context.Context, timeout time.Duration) error { return nil }
+		mockCartoFacade.TerminateFunc = func(ctx context.Context, timeout time.Duration) error { return nil }
+		svc := newTestService(mockCartoFacade, logger)
+		svc.cancelSensorProcessFunc = func() {}
+		svc.cancelCartoFacadeFunc = func() {}
+		svc.existingMap = existingMap
+		svc.warmStartDir = dir
+		svc.warmStartRetention = 2
+		_, err = svc.closeInPhases(context.Background())
+		test.That(t, err, test.ShouldBeNil)
+		return existingMap
+	}
+
+	t.Run("the first session starts a new map", func(t *testing.T) {
+		test.That(t, session(t, testInternalState("session 1")), test.ShouldBeEmpty)
+		paths, err := listSavedInternalStates(dir, warmStartMapPrefix)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, paths, test.ShouldHaveLength, 1)
+	})
+
+	t.Run("the next session starts from the internal state of the previous one", func(t *testing.T) {
+		existingMap := session(t, testInternalState("session 2"))
+		data, err := os.ReadFile(existingMap)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, data, test.ShouldResemble, testInternalState("session 1"))
+
+		existingMap = session(t, testInternalState("session 3"))
+		data, err = os.ReadFile(existingMap)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, data, test.ShouldResemble, testInternalState("session 2"))
+	})
+
+	t.Run("only the newest internal states are kept", func(t *testing.T) {
+		paths, err := listSavedInternalStates(dir, warmStartMapPrefix)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, paths, test.ShouldHaveLength, 2)
+		for i, payload := range []string{"session 3", "session 2"} {
+			data, err := os.ReadFile(paths[i])
+			test.That(t, err, test.ShouldBeNil)
+			test.That(t, data, test.ShouldResemble, testInternalState(payload))
+		}
+	})
+
+	t.Run("a truncated internal state is skipped", func(t *testing.T) {
+		truncated := testInternalState("session 4")
+		existingMap := session(t, truncated[:len(truncated)-1])
+		data, err := os.ReadFile(existingMap)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, data, test.ShouldResemble, testInternalState("session 3"))
+
+		existingMap, err = latestWarmStartMap(dir, logger)
+		test.That(t, err, test.ShouldBeNil)
+		data, err = os.ReadFile(existingMap)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, data, test.ShouldResemble, testInternalState("session 3"))
+	})
+}
@@ -0,0 +1,116 @@
+package viamcartographer
+
+import "sync"
+
+const (
+	// ConstructionWarningsKey is the key of the warnings found while constructing the service.
+	ConstructionWarningsKey = "construction_warnings"
+	// DroppedConstructionWarningsKey is the key of the number of warnings that are not listed.
+	DroppedConstructionWarningsKey = "dropped_construction_warnings"
+	// ClearWarningsCommand is sent to DoCommand to clear the construction warnings.
+	ClearWarningsCommand = "clear_warnings"
+	// ClearedWarningsKey is the key of the number of cleared warnings.
+	ClearedWarningsKey = "cleared_warnings"
+)
+
+// The codes of the construction warnings. They are stable, so that clients can act on them without parsing the
+// message.
+const (
+	// WarningNoMovementSensor denotes that no movement sensor is configured, so cartographer runs without IMU and
+	// odometer data.
+	WarningNoMovementSensor = "NO_MOVEMENT_SENSOR"
+	// WarningMovementSensorWithoutIMU denotes that the movement sensor does not provide IMU data.
+	WarningMovementSensorWithoutIMU = "MOVEMENT_SENSOR_WITHOUT_IMU"
+	// WarningMovementSensorWithoutOdometer denotes that the movement sensor provides IMU data but no odometer data.
+	WarningMovementSensorWithoutOdometer = "MOVEMENT_SENSOR_WITHOUT_ODOMETER"
+	// WarningUnusedConfigParam denotes that a key of config_params is not a cartographer algo config param.
+	WarningUnusedConfigParam = "UNUSED_CONFIG_PARAM"
+	// WarningConfigParamNotApplied denotes that cartographer is operating with a different value than the one a
+	// config param was set to.
+	WarningConfigParamNotApplied = "CONFIG_PARAM_NOT_APPLIED"
+	// WarningExistingMapFallback denotes that existing_map is truncated and the previous intact internal state is
+	// loaded instead.
+	WarningExistingMapFallback = "EXISTING_MAP_FALLBACK"
+	// WarningInternalStateMigrated denotes that existing_map has an older internal state version and a migrated copy
+	// of it is loaded instead.
+	WarningInternalStateMigrated = "INTERNAL_STATE_MIGRATED"
+	// WarningShadowConfigExperimental denotes that a shadow cartographer instance runs alongside the primary one.
+	WarningShadowConfigExperimental = "SHADOW_CONFIG_EXPERIMENTAL"
+	// WarningUnsupportedSensorName denotes that the name of a sensor holds characters that are known to break the
+	// cartofacade.
+	WarningUnsupportedSensorName = "UNSUPPORTED_SENSOR_NAME"
+)
+
+// maxConstructionWarnings bounds the number of construction warnings that are kept, e.g. for config_params with
+// many unused keys. Warnings beyond it are only counted.
+const maxConstructionWarnings = 20
+
+// constructionWarning is a non-fatal problem found while constructing the service.
+type constructionWarning struct {
+	code    string
+	message string
+}
+
+// constructionWarnings holds the construction warnings until they are cleared via the clear_warnings command.
+type constructionWarnings struct {
+	mu       sync.Mutex
+	warnings []constructionWarning
+	dropped  int
+	// sealed is set once cartographer was initialized for the first time. load_internal_state initializes it
+	// again with the same config, which finds the same warnings again.
+	sealed bool
+}
+
+// add keeps a warning with code and message, unless maxConstructionWarnings are kept already or the warnings are
+// sealed.
+func (w *constructionWarnings) add(code, message string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.sealed {
+		return
+	}
+	if len(w.warnings) >= maxConstructionWarnings {
+		w.dropped++
+		return
+	}
+	w.warnings = append(w.warnings, constructionWarning{code: code, message: message})
+}
+
+// toList returns the kept warnings in the format of DoCommand responses, along with the number of warnings that
+// were dropped for exceeding maxConstructionWarnings.
+func (w *constructionWarnings) toList() ([]interface{}, int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	list := []interface{}{}
+	for _, warning := range w.warnings {
+		list = append(list, map[string]interface{}{
+			"code":    warning.code,
+			"message": warning.message,
+		})
+	}
+	return list, w.dropped
+}
+
+// clear removes all warnings and returns how many there were, including the dropped ones.
+func (w *constructionWarnings) clear() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	cleared := len(w.warnings) + w.dropped
+	w.warnings = nil
+	w.dropped = 0
+	return cleared
+}
+
+// seal makes add ignore all further warnings, which are the ones of the config that were found before.
+func (w *constructionWarnings) seal() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.sealed = true
+}
+
+// isSealed returns whether seal was called.
+func (w *constructionWarnings) isSealed() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.sealed
+}
@@ -0,0 +1,85 @@
+package viamcartographer
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"go.viam.com/rdk/logging"
+	"go.viam.com/test"
+
+	"github.com/viam-modules/viam-cartographer/cartofacade"
+)
+
+func TestConstructionWarningsStatus(t *testing.T) {
+	mockCartoFacade := &cartofacade.Mock{}
+	mockCartoFacade.UnresponsiveFunc = func() bool { return true }
+	svc := newTestService(mockCartoFacade, logging.NewTestLogger(t))
+	svc.cartoLib = &cartofacade.CartoLibMock{LogLevelFunc: func() (int, int) { return 0, 0 }}
+
+	t.Run("status omits the construction warnings when there are none", func(t *testing.T) {
+		resp, err := svc.DoCommand(context.Background(), map[string]interface{}{StatusCommand: ""})
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, resp, test.ShouldNotContainKey, ConstructionWarningsKey)
+		test.That(t, resp, test.ShouldNotContainKey, DroppedConstructionWarningsKey)
+	})
+
+	t.Run("status lists the construction warnings with their code until they are cleared", func(t *testing.T) {
+		svc.constructionWarnings.add(WarningNoMovementSensor, "no movement sensor configured")
+		svc.constructionWarnings.add(WarningUnusedConfigParam, "config param test_param is ignored")
+
+		for i := 0; i < 2; i++ {
+			resp, err := svc.DoCommand(context.Background(), map[string]interface{}{StatusCommand: ""})
+			test.That(t, err, test.ShouldBeNil)
+			test.That(t, resp[ConstructionWarningsKey], test.ShouldResemble, []interface{}{
+				map[string]interface{}{"code": "NO_MOVEMENT_SENSOR", "message": "no movement sensor configured"},
+				map[string]interface{}{"code": "UNUSED_CONFIG_PARAM", "message": "config param test_param is ignored"},
+			})
+			test.That(t, resp, test.ShouldNotContainKey, DroppedConstructionWarningsKey)
+		}
+
+		resp, err := svc.DoCommand(context.Background(), map[string]interface{}{ClearWarningsCommand: nil})
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, resp, test.ShouldResemble, map[string]interface{}{
+			ClearWarningsCommand: SuccessMessage,
+			ClearedWarningsKey:   2,
+		})
+
+		resp, err = svc.DoCommand(context.Background(), map[string]interface{}{StatusCommand: ""})
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, resp, test.ShouldNotContainKey, ConstructionWarningsKey)
+	})
+
+	t.Run("status lists at most maxConstructionWarnings and counts the others", func(t *testing.T) {
+		for i := 0; i < maxConstructionWarnings+5; i++ {
+			svc.constructionWarnings.add(WarningUnusedConfigParam, fmt.Sprintf("config param param_%d is ignored", i))
+		}
+
+		resp, err := svc.DoCommand(context.Background(), map[string]interface{}{StatusCommand: ""})
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, resp[ConstructionWarningsKey], test.ShouldHaveLength, maxConstructionWarnings)
+		test.That(t, resp[DroppedConstructionWarningsKey], test.ShouldEqual, 5)
+
+		resp, err = svc.DoCommand(context.Background(), map[string]interface{}{ClearWarningsCommand: nil})
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, resp[ClearedWarningsKey], test.ShouldEqual, maxConstructionWarnings+5)
+	})
+	t.Run("the warnings found again once cartographer is initialized again are not kept", func(t *testing.T) {
+		svc.constructionWarnings.add(WarningNoMovementSensor, "no movement sensor configured")
+		test.That(t, svc.constructionWarnings.isSealed(), test.ShouldBeFalse)
+		svc.constructionWarnings.seal()
+		svc.constructionWarnings.add(WarningNoMovementSensor, "no movement sensor configured")
+
+		resp, err := svc.DoCommand(context.Background(), map[string]interface{}{StatusCommand: ""})
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, resp[ConstructionWarningsKey], test.ShouldHaveLength, 1)
+
+		resp, err = svc.DoCommand(context.Background(), map[string]interface{}{ClearWarningsCommand: nil})
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, resp[ClearedWarningsKey], test.ShouldEqual, 1)
+		svc.constructionWarnings.add(WarningNoMovementSensor, "no movement sensor configured")
+		resp, err = svc.DoCommand(context.Background(), map[string]interface{}{StatusCommand: ""})
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, resp, test.ShouldNotContainKey, ConstructionWarningsKey)
+	})
+}
@@ -0,0 +1,131 @@
+package viamcartographer
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// WorkersKey is the key of the background workers that are running.
+	WorkersKey = "workers"
+)
+
+// defaultWorkerExitGracePeriod is how long Close waits for the background workers to return once they were
+// cancelled before it logs the ones that have not as stragglers.
+const defaultWorkerExitGracePeriod = 10 * time.Second
+
+// worker is a background goroutine of the service that is registered in its workerRegistry while it runs.
+type worker struct {
+	name      string
+	startedAt time.Time
+	// lastHeartbeat is the time, in unix nanoseconds, the worker last reported that it is making progress.
+	lastHeartbeat atomic.Int64
+}
+
+// heartbeat records that the worker is making progress. It does not lock, so that workers can call it on every
+// iteration.
+func (w *worker) heartbeat() {
+	w.lastHeartbeat.Store(time.Now().UnixNano())
+}
+
+// workerRegistry keeps track of the background workers of the service that are running, so that a worker that is
+// stuck or was never shut down is visible in the status response and on Close. The zero value is ready to use.
+type workerRegistry struct {
+	mu      sync.Mutex
+	workers map[*worker]struct{}
+}
+
+// register adds a worker of the given name, which does not need to be unique, to the registry and returns it.
+func (registry *workerRegistry) register(name string, now time.Time) *worker {
+	w := &worker{name: name, startedAt: now}
+	w.lastHeartbeat.Store(now.UnixNano())
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	if registry.workers == nil {
+		registry.workers = map[*worker]struct{}{}
+	}
+	registry.workers[w] = struct{}{}
+	return w
+}
+
+// unregister removes a worker that returned from the registry.
+func (registry *workerRegistry) unregister(w *worker) {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	delete(registry.workers, w)
+}
+
+// running returns the workers that are registered, ordered by name and then by when they started.
+func (registry *workerRegistry) running() []*worker {
+	registry.mu.Lock()
+	workers := make([]*worker, 0, len(registry.workers))
+	for w := range registry.workers {
+		workers = append(workers, w)
+	}
+	registry.mu.Unlock()
+	sort.Slice(workers, func(i, j int) bool {
+		if workers[i].name != workers[j].name {
+			return workers[i].name < workers[j].name
+		}
+		return workers[i].startedAt.Before(workers[j].startedAt)
+	})
+	return workers
+}
+
+// toList returns the running workers in the format of the status response.
+func (registry *workerRegistry) toList() []interface{} {
+	workers := registry.running()
+	list := make([]interface{}, 0, len(workers))
+	for _, w := range workers {
+		list = append(list, map[string]interface{}{
+			"name":           w.name,
+			"started_at":     w.startedAt.UTC().Format(time.RFC3339Nano),
+			"last_heartbeat": time.Unix(0, w.lastHeartbeat.Load()).UTC().Format(time.RFC3339Nano),
+		})
+	}
+	return list
+}
+
+// goWorker runs f in a background goroutine that is registered as a worker of the given name while it runs. It is
+// one of the sensor process workers, which Close cancels and waits for before it stops the cartofacade. f is
+// handed its worker to report heartbeats on.
+func (cartoSvc *CartographerService) goWorker(name string, f func(w *worker)) {
+	w := cartoSvc.workers.register(name, time.Now())
+	cartoSvc.sensorProcessWorkers.Add(1)
+	go func() {
+		defer cartoSvc.sensorProcessWorkers.Done()
+		defer cartoSvc.workers.unregister(w)
+		f(w)
+	}()
+}
+
+// waitForWorkers waits for the sensor process workers to return once they were cancelled. The workers that have
+// not returned after the grace period are logged as stragglers along with their last heartbeat, before waiting
+// for them on, as the cartofacade can not be stopped while they might still call into it.
+func (cartoSvc *CartographerService) waitForWorkers() {
+	done := make(chan struct{})
+	go func() {
+		cartoSvc.sensorProcessWorkers.Wait()
+		close(done)
+	}()
+
+	gracePeriod := cartoSvc.workerExitGracePeriod
+	if gracePeriod == 0 {
+		gracePeriod = defaultWorkerExitGracePeriod
+	}
+	select {
+	case <-done:
+		return
+	case <-time.After(gracePeriod):
+	}
+	for _, w := range cartoSvc.workers.running() {
+		cartoSvc.logger.Warnw("background worker has not exited on close, waiting for it",
+			"worker", w.name,
+			"started_at", w.startedAt.UTC().Format(time.RFC3339Nano),
+			"last_heartbeat", time.Unix(0, w.lastHeartbeat.Load()).UTC().Format(time.RFC3339Nano),
+			"grace_period", gracePeriod)
+	}
+	<-done
+}
@@ -0,0 +1,116 @@
+package viamcartographer
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.viam.com/rdk/logging"
+	"go.viam.com/test"
+	"go.viam.com/utils/testutils"
+
+	"github.com/viam-modules/viam-cartographer/cartofacade"
+)
+
+func TestWorkers(t *testing.T) {
+	logger, obs := logging.NewObservedTestLogger(t)
+	mockCartoFacade := &cartofacade.Mock{}
+	mockCartoFacade.UnresponsiveFunc = func() bool { return true }
+	mockCartoFacade.DrainFunc = func(ctx context.Context, timeout time.Duration) error { return nil }
+	mockCartoFacade.StopFunc = func(ctx context.Context, timeout time.Duration) error { return nil }
+	mockCartoFacade.TerminateFunc = func(ctx context.Context, timeout time.Duration) error { return nil }
+	cancelSensorProcessCtx, cancelSensorProcessFunc := context.WithCancel(context.Background())
+	svc := newTestService(mockCartoFacade, logger)
+	svc.cartoLib = &cartofacade.CartoLibMock{LogLevelFunc: func() (int, int) { return 0, 0 }}
+	svc.cancelSensorProcessFunc = cancelSensorProcessFunc
+	svc.cancelCartoFacadeFunc = func() {}
+	svc.workerExitGracePeriod = 50 * time.Millisecond
+
+	t.Run("status omits the workers when none are running", func(t *testing.T) {
+		resp, err := svc.DoCommand(context.Background(), map[string]interface{}{StatusCommand: ""})
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, resp, test.ShouldNotContainKey, WorkersKey)
+	})
+
+	// the responsive worker beats until it is cancelled, the hanging one stops beating and ignores the cancellation
+	start := time.Now()
+	beating := make(chan struct{})
+	svc.goWorker("responsive", func(w *worker) {
+		close(beating)
+		for {
+			select {
+			case <-cancelSensorProcessCtx.Done():
+				return
+			case <-time.After(time.Millisecond):
+				w.heartbeat()
+			}
+		}
+	})
+	hanging := make(chan struct{})
+	svc.goWorker("hanging", func(w *worker) {
+		<-hanging
+	})
+	<-beating
+
+	workerStatus := func(tb testing.TB) map[string]map[string]interface{} {
+		tb.Helper()
+		resp, err := svc.DoCommand(context.Background(), map[string]interface{}{StatusCommand: ""})
+		test.That(tb, err, test.ShouldBeNil)
+		workers, ok := resp[WorkersKey].([]interface{})
+		test.That(tb, ok, test.ShouldBeTrue)
+		byName := map[string]map[string]interface{}{}
+		for _, entry := range workers {
+			byName[entry.(map[string]interface{})["name"].(string)] = entry.(map[string]interface{})
+		}
+		test.That(tb, byName, test.ShouldHaveLength, len(workers))
+		return byName
+	}
+	parseTime := func(tb testing.TB, value interface{}) time.Time {
+		tb.Helper()
+		parsed, err := time.Parse(time.RFC3339Nano, value.(string))
+		test.That(tb, err, test.ShouldBeNil)
+		return parsed
+	}
+
+	t.Run("status lists the running workers by name with their last heartbeat", func(t *testing.T) {
+		resp, err := svc.DoCommand(context.Background(), map[string]interface{}{StatusCommand: ""})
+		test.That(t, err, test.ShouldBeNil)
+		workers := resp[WorkersKey].([]interface{})
+		test.That(t, workers, test.ShouldHaveLength, 2)
+		test.That(t, workers[0].(map[string]interface{})["name"], test.ShouldEqual, "hanging")
+		test.That(t, workers[1].(map[string]interface{})["name"], test.ShouldEqual, "responsive")
+
+		hangingStatus := workerStatus(t)["hanging"]
+		test.That(t, parseTime(t, hangingStatus["started_at"]), test.ShouldHappenOnOrAfter, start)
+		test.That(t, hangingStatus["last_heartbeat"], test.ShouldEqual, hangingStatus["started_at"])
+		testutils.WaitForAssertion(t, func(tb testing.TB) {
+			tb.Helper()
+			responsiveStatus := workerStatus(tb)["responsive"]
+			test.That(tb, parseTime(tb, responsiveStatus["last_heartbeat"]), test.ShouldHappenAfter,
+				parseTime(tb, responsiveStatus["started_at"]))
+		})
+	})
+
+	t.Run("close warns about the workers that have not exited and waits for them", func(t *testing.T) {
+		closed := make(chan error)
+		go func() {
+			closed <- svc.Close(context.Background())
+		}()
+		testutils.WaitForAssertion(t, func(tb testing.TB) {
+			tb.Helper()
+			test.That(tb, obs.FilterMessageSnippet("has not exited on close").Len(), test.ShouldEqual, 1)
+		})
+		warning := obs.FilterMessageSnippet("has not exited on close").All()[0].ContextMap()
+		test.That(t, warning["worker"], test.ShouldEqual, "hanging")
+		test.That(t, warning["last_heartbeat"], test.ShouldNotBeEmpty)
+
+		select {
+		case <-closed:
+			t.Fatal("close returned before the hanging worker exited")
+		case <-time.After(50 * time.Millisecond):
+		}
+		close(hanging)
+		test.That(t, <-closed, test.ShouldBeNil)
+		test.That(t, svc.workers.running(), test.ShouldBeEmpty)
+	})
+}